@@ -0,0 +1,544 @@
+package v2
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/imulab/go-scim/pkg/v2/crud"
+	"github.com/imulab/go-scim/pkg/v2/crud/expr"
+	"github.com/imulab/go-scim/pkg/v2/db"
+	"github.com/imulab/go-scim/pkg/v2/prop"
+	"github.com/imulab/go-scim/pkg/v2/spec"
+	"github.com/imulab/go-scim/pkg/v2/trace"
+	"go.etcd.io/bbolt"
+	"strings"
+)
+
+// Create a db.DB implementation that persists data in bbolt, an embedded key value store of a single file. This
+// implementation supports one-to-one correspondence of a SCIM resource type to a bucket of the store, which is created
+// with its nested buckets upon the first write. Many resource types may share the same store with different buckets.
+// It is intended for small deployments and integration tests that need durability without an external database.
+//
+// Resources are stored as JSON documents of all their attributes, including those that are never returned to clients,
+// keyed by their id. Secondary indexes are maintained in the same transactions for attributes whose uniqueness is
+// server or global, or that have been annotated with "@BoltIndex" (see AnnotationBoltIndex), and Insert and Replace
+// return an error of spec.ErrUniqueness when a unique attribute is violated. Indexes added to an existing bucket are
+// built from the stored resources upon the next write.
+//
+// Filters consisting of eq comparisons on indexed attributes, combined with and or or, are served by looking up the
+// indexes; and other filters by scanning all resources of the bucket. Either way, the candidates are evaluated with
+// the filter, and sorted and paginated in memory, in the same way as db.Memory. Queries are ordered by id when not
+// sorted. This implementation ignores the projection parameters and always returns complete resources.
+//
+// Replace and Delete only modify the resource if its stored version is still the version of the given resource, and
+// return an error of spec.ErrConflict otherwise.
+//
+// The calls with a context carrying a transaction of the store are part of the transaction (see Transaction), and the
+// returned DB implements db.TxDB, whose WithTx starts such a transaction, which the databases of other buckets of the
+// store take part in. It also implements db.BulkWriteDB, which writes all resources in a single write transaction.
+func DB(resourceType *spec.ResourceType, store *bbolt.DB, bucket string) db.DB {
+	return &boltDB{
+		resourceType: resourceType,
+		store:        store,
+		bucket:       []byte(bucket),
+		indexes:      newIndexes(resourceType),
+		filters:      crud.NewFilterCache(0),
+	}
+}
+
+type boltDB struct {
+	resourceType *spec.ResourceType
+	store        *bbolt.DB
+	bucket       []byte
+	indexes      map[string]*index // by attribute id
+	filters      *crud.FilterCache
+}
+
+// name of the nested bucket holding the resources by id
+var resourcesBucket = []byte("resources")
+
+func (d *boltDB) Insert(ctx context.Context, resource *prop.Resource) error {
+	id := resource.IdOrEmpty()
+	if len(id) == 0 {
+		return fmt.Errorf("%w: empty id", spec.ErrInternal)
+	}
+
+	doc, err := document(resource)
+	if err != nil {
+		return err
+	}
+
+	return d.update(ctx, func(b *bbolt.Bucket) error {
+		return d.insert(b, resource, doc)
+	})
+}
+
+func (d *boltDB) InsertMany(ctx context.Context, resources []*prop.Resource) []error {
+	errs := make([]error, len(resources))
+	docs := make([][]byte, len(resources))
+	for i, resource := range resources {
+		if len(resource.IdOrEmpty()) == 0 {
+			errs[i] = fmt.Errorf("%w: empty id", spec.ErrInternal)
+			continue
+		}
+		docs[i], errs[i] = document(resource)
+	}
+
+	return d.updateMany(ctx, errs, func(b *bbolt.Bucket, i int) error {
+		return d.insert(b, resources[i], docs[i])
+	})
+}
+
+func (d *boltDB) Count(ctx context.Context, filter string) (int, error) {
+	var n int
+	err := d.view(ctx, func(b *bbolt.Bucket) error {
+		if b == nil {
+			return nil
+		}
+		if len(strings.TrimSpace(filter)) == 0 {
+			n = countKeys(b.Bucket(resourcesBucket))
+			return nil
+		}
+		candidates, err := d.evaluate(ctx, b, filter)
+		n = len(candidates)
+		return err
+	})
+	return n, err
+}
+
+func (d *boltDB) Get(ctx context.Context, id string, _ *crud.Projection) (*prop.Resource, error) {
+	var resource *prop.Resource
+	err := d.view(ctx, func(b *bbolt.Bucket) (err error) {
+		resource, err = d.get(b, id)
+		return
+	})
+	if err != nil {
+		return nil, err
+	}
+	if resource == nil {
+		return nil, fmt.Errorf("%w: resource not found by id '%s'", spec.ErrNotFound, id)
+	}
+	return resource, nil
+}
+
+// GetMany gets the resources by their ids in one read transaction, and implements db.BatchDB.
+func (d *boltDB) GetMany(ctx context.Context, ids []string, _ *crud.Projection) ([]*prop.Resource, error) {
+	resources := make([]*prop.Resource, 0, len(ids))
+	err := d.view(ctx, func(b *bbolt.Bucket) error {
+		seen := make(map[string]struct{}, len(ids))
+		for _, id := range ids {
+			if _, ok := seen[id]; ok {
+				continue
+			}
+			seen[id] = struct{}{}
+
+			resource, err := d.get(b, id)
+			if err != nil {
+				return err
+			}
+			if resource != nil {
+				resources = append(resources, resource)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return resources, nil
+}
+
+func (d *boltDB) Replace(ctx context.Context, ref *prop.Resource, replacement *prop.Resource) error {
+	doc, err := document(replacement)
+	if err != nil {
+		return err
+	}
+
+	return d.update(ctx, func(b *bbolt.Bucket) error {
+		return d.replace(b, ref, replacement, doc)
+	})
+}
+
+func (d *boltDB) ReplaceMany(ctx context.Context, replacements []db.Replacement) []error {
+	errs := make([]error, len(replacements))
+	docs := make([][]byte, len(replacements))
+	for i, r := range replacements {
+		docs[i], errs[i] = document(r.Replacement)
+	}
+
+	return d.updateMany(ctx, errs, func(b *bbolt.Bucket, i int) error {
+		return d.replace(b, replacements[i].Ref, replacements[i].Replacement, docs[i])
+	})
+}
+
+func (d *boltDB) Delete(ctx context.Context, resource *prop.Resource) error {
+	return d.update(ctx, func(b *bbolt.Bucket) error {
+		return d.remove(b, resource)
+	})
+}
+
+func (d *boltDB) DeleteMany(ctx context.Context, resources []*prop.Resource) []error {
+	return d.updateMany(ctx, make([]error, len(resources)), func(b *bbolt.Bucket, i int) error {
+		return d.remove(b, resources[i])
+	})
+}
+
+func (d *boltDB) Query(ctx context.Context, filter string, sort *crud.Sort, pagination *crud.Pagination, _ *crud.Projection) ([]*prop.Resource, error) {
+	var candidates []*prop.Resource
+	err := d.view(ctx, func(b *bbolt.Bucket) (err error) {
+		candidates, err = d.evaluate(ctx, b, filter)
+		return
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return db.SortAndPage(candidates, sort, pagination)
+}
+
+func (d *boltDB) QueryCursor(ctx context.Context, filter string, sort *crud.Sort, pagination *crud.CursorPagination, _ *crud.Projection) ([]*prop.Resource, string, error) {
+	if sort == nil || len(sort.By) == 0 {
+		sort = &crud.Sort{By: "id"}
+	}
+
+	var candidates []*prop.Resource
+	err := d.view(ctx, func(b *bbolt.Bucket) (err error) {
+		candidates, err = d.evaluate(ctx, b, filter)
+		return
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	if err := sort.Sort(candidates); err != nil {
+		return nil, "", err
+	}
+
+	if pagination != nil && len(pagination.Cursor) > 0 {
+		cursor, err := crud.ParseCursor(pagination.Cursor)
+		if err != nil {
+			return nil, "", err
+		}
+		if candidates, err = sort.After(candidates, cursor); err != nil {
+			return nil, "", err
+		}
+	}
+
+	if pagination == nil || pagination.Count <= 0 || len(candidates) <= pagination.Count {
+		return candidates, "", nil
+	}
+
+	candidates = candidates[:pagination.Count]
+	next, err := crud.NewCursor(candidates[len(candidates)-1], *sort)
+	if err != nil {
+		return nil, "", err
+	}
+	return candidates, next.String(), nil
+}
+
+// Runs fn with the bucket of the resource type in a read transaction, or nil if the bucket has not been created yet.
+// The transaction of the store carried by the context, if any, is used instead (see Transaction).
+func (d *boltDB) view(ctx context.Context, fn func(b *bbolt.Bucket) error) error {
+	if t := txOf(ctx, d.store); t != nil {
+		return errStore(fn(t.tx.Bucket(d.bucket)))
+	}
+	return errStore(d.store.View(func(tx *bbolt.Tx) error {
+		return fn(tx.Bucket(d.bucket))
+	}))
+}
+
+// Runs fn with the bucket of the resource type in a write transaction, which is committed if fn returns nil. The
+// transaction of the store carried by the context, if any, is used instead (see Transaction), which is committed or
+// rolled back as a whole.
+func (d *boltDB) update(ctx context.Context, fn func(b *bbolt.Bucket) error) error {
+	if t := txOf(ctx, d.store); t != nil {
+		b, err := d.prepare(t.tx)
+		if err == nil {
+			err = fn(b)
+		}
+		if err != nil {
+			t.fail(err)
+		}
+		return errStore(err)
+	}
+	return errStore(d.store.Update(func(tx *bbolt.Tx) error {
+		b, err := d.prepare(tx)
+		if err != nil {
+			return err
+		}
+		return fn(b)
+	}))
+}
+
+// Runs fn for every resource whose error is still nil in a single write transaction (see update), and records its
+// error. Since the writes check the resources before writing anything, the resources that fail with those errors (see
+// unwritten) do not fail the others, nor the transaction carried by the context, if any; other errors may have been
+// partially applied, and fail the whole transaction instead, which is returned for every resource.
+func (d *boltDB) updateMany(ctx context.Context, errs []error, fn func(b *bbolt.Bucket, i int) error) []error {
+	err := d.update(ctx, func(b *bbolt.Bucket) error {
+		for i := range errs {
+			if errs[i] != nil {
+				continue
+			}
+			if errs[i] = fn(b, i); errs[i] != nil && !unwritten(errs[i]) {
+				return errs[i]
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		for i := range errs {
+			errs[i] = err
+		}
+	}
+	return errs
+}
+
+// Returns true if the error of a write was returned before anything was written.
+func unwritten(err error) bool {
+	return errors.Is(err, spec.ErrConflict) || errors.Is(err, spec.ErrNotFound) || errors.Is(err, spec.ErrUniqueness)
+}
+
+// Inserts the resource, returning an error of spec.ErrUniqueness if its id or a unique attribute is taken.
+func (d *boltDB) insert(b *bbolt.Bucket, resource *prop.Resource, doc []byte) error {
+	id := resource.IdOrEmpty()
+	resources := b.Bucket(resourcesBucket)
+	if resources.Get([]byte(id)) != nil {
+		return fmt.Errorf("%w: value of 'id' is not unique", spec.ErrUniqueness)
+	}
+	if err := d.indexResource(b, resource); err != nil {
+		return err
+	}
+	return resources.Put([]byte(id), doc)
+}
+
+// Replaces the reference resource with the replacement, if the stored resource still carries its version.
+func (d *boltDB) replace(b *bbolt.Bucket, ref *prop.Resource, replacement *prop.Resource, doc []byte) error {
+	id := ref.IdOrEmpty()
+	stored, err := d.compare(b, id, ref.MetaVersionOrEmpty())
+	if err != nil {
+		return err
+	}
+	if err := d.unindexResource(b, stored); err != nil {
+		return err
+	}
+	if err := d.indexResource(b, replacement); err != nil {
+		// the index entries of the stored resource are put back, so that nothing is written
+		if errors.Is(err, spec.ErrUniqueness) {
+			if err := d.indexResource(b, stored); err != nil {
+				return err
+			}
+		}
+		return err
+	}
+	return b.Bucket(resourcesBucket).Put([]byte(id), doc)
+}
+
+// Deletes the resource, if the stored resource still carries its version.
+func (d *boltDB) remove(b *bbolt.Bucket, resource *prop.Resource) error {
+	id := resource.IdOrEmpty()
+	stored, err := d.compare(b, id, resource.MetaVersionOrEmpty())
+	if err != nil {
+		return err
+	}
+	if err := d.unindexResource(b, stored); err != nil {
+		return err
+	}
+	return b.Bucket(resourcesBucket).Delete([]byte(id))
+}
+
+// Returns the bucket of the resource type, creating it and its nested buckets if necessary. Indexes whose bucket does
+// not exist yet are built from the stored resources.
+func (d *boltDB) prepare(tx *bbolt.Tx) (*bbolt.Bucket, error) {
+	b, err := tx.CreateBucketIfNotExists(d.bucket)
+	if err != nil {
+		return nil, err
+	}
+	resources, err := b.CreateBucketIfNotExists(resourcesBucket)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, i := range d.indexes {
+		if b.Bucket(i.bucket) != nil {
+			continue
+		}
+		ib, err := b.CreateBucket(i.bucket)
+		if err != nil {
+			return nil, err
+		}
+		if err := resources.ForEach(func(_, doc []byte) error {
+			resource, err := d.resource(doc)
+			if err != nil {
+				return err
+			}
+			if key := i.keyOf(resource); key != nil {
+				return ib.Put(key, []byte{})
+			}
+			return nil
+		}); err != nil {
+			return nil, err
+		}
+	}
+
+	return b, nil
+}
+
+// Returns the resource by id, or nil if there is none.
+func (d *boltDB) get(b *bbolt.Bucket, id string) (*prop.Resource, error) {
+	if b == nil {
+		return nil, nil
+	}
+	doc := b.Bucket(resourcesBucket).Get([]byte(id))
+	if doc == nil {
+		return nil, nil
+	}
+	return d.resource(doc)
+}
+
+// Returns the stored resource by id, after checking that it still carries the version, if any.
+func (d *boltDB) compare(b *bbolt.Bucket, id string, version string) (*prop.Resource, error) {
+	stored, err := d.get(b, id)
+	if err != nil {
+		return nil, err
+	}
+	if stored == nil {
+		return nil, fmt.Errorf("%w: resource not found by id '%s'", spec.ErrNotFound, id)
+	}
+	if len(version) > 0 && stored.MetaVersionOrEmpty() != version {
+		return nil, fmt.Errorf("%w: resource by id '%s' was modified since by another request", spec.ErrConflict, id)
+	}
+	return stored, nil
+}
+
+// Adds the index entries of the resource, returning an error of spec.ErrUniqueness if another resource carries the
+// same value of a unique attribute. The unique attributes are all checked before any entry is added, so that nothing
+// is written when the error is returned.
+func (d *boltDB) indexResource(b *bbolt.Bucket, resource *prop.Resource) error {
+	keys := make(map[*index][]byte, len(d.indexes))
+	for _, i := range d.indexes {
+		key := i.keyOf(resource)
+		if key == nil {
+			continue
+		}
+		keys[i] = key
+
+		if i.unique {
+			prefix := key[:bytes.LastIndexByte(key, 0)+1]
+			c := b.Bucket(i.bucket).Cursor()
+			for k, _ := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, _ = c.Next() {
+				if i.idOf(k) != resource.IdOrEmpty() {
+					return fmt.Errorf("%w: value of '%s' is not unique", spec.ErrUniqueness, i.attr.Path())
+				}
+			}
+		}
+	}
+
+	for i, key := range keys {
+		if err := b.Bucket(i.bucket).Put(key, []byte{}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Removes the index entries of the resource.
+func (d *boltDB) unindexResource(b *bbolt.Bucket, resource *prop.Resource) error {
+	for _, i := range d.indexes {
+		if key := i.keyOf(resource); key != nil {
+			if err := b.Bucket(i.bucket).Delete(key); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Returns the resources matching the filter, ordered by id, or all resources when the filter is empty.
+func (d *boltDB) evaluate(ctx context.Context, b *bbolt.Bucket, filter string) (candidates []*prop.Resource, err error) {
+	_, end := trace.Start(ctx, trace.Evaluate)
+	defer func() {
+		end(err)
+	}()
+
+	var root *expr.Expression
+	if len(strings.TrimSpace(filter)) > 0 {
+		if root, err = d.filters.Compile(filter, d.resourceType); err != nil {
+			return nil, err
+		}
+	}
+
+	match := func(resource *prop.Resource) error {
+		if root != nil {
+			if ok, err := crud.EvaluateExpressionOnProperty(resource.RootProperty(), root); err != nil || !ok {
+				return err
+			}
+		}
+		candidates = append(candidates, resource)
+		return nil
+	}
+
+	candidates = make([]*prop.Resource, 0)
+	if b == nil {
+		return candidates, nil
+	}
+	if ids, ok := d.lookup(b, root); ok {
+		for _, id := range ids {
+			resource, err := d.get(b, id)
+			if err != nil {
+				return nil, err
+			}
+			if resource != nil {
+				if err := match(resource); err != nil {
+					return nil, err
+				}
+			}
+		}
+		return candidates, nil
+	}
+
+	err = b.Bucket(resourcesBucket).ForEach(func(_, doc []byte) error {
+		resource, err := d.resource(doc)
+		if err != nil {
+			return err
+		}
+		return match(resource)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return candidates, nil
+}
+
+// Returns the number of keys in the bucket. The statistics of the bucket are used, except in write transactions (see
+// Transaction), where they do not account for the keys written in the transaction yet.
+func countKeys(b *bbolt.Bucket) int {
+	if !b.Tx().Writable() {
+		return b.Stats().KeyN
+	}
+	n := 0
+	c := b.Cursor()
+	for k, _ := c.First(); k != nil; k, _ = c.Next() {
+		n++
+	}
+	return n
+}
+
+// Returns errors of spec.Error as they are, and otherwise, an error of spec.ErrInternal.
+func errStore(err error) error {
+	if err == nil {
+		return nil
+	}
+	var se *spec.Error
+	if errors.As(err, &se) {
+		return err
+	}
+	return fmt.Errorf("%w: %v", spec.ErrInternal, err)
+}
+
+var (
+	_ db.CursorDB    = (*boltDB)(nil)
+	_ db.BatchDB     = (*boltDB)(nil)
+	_ db.TxDB        = (*boltDB)(nil)
+	_ db.BulkWriteDB = (*boltDB)(nil)
+)
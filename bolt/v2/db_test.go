@@ -0,0 +1,367 @@
+package v2
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/imulab/go-scim/pkg/v2/crud"
+	"github.com/imulab/go-scim/pkg/v2/crud/expr"
+	"github.com/imulab/go-scim/pkg/v2/db"
+	scimjson "github.com/imulab/go-scim/pkg/v2/json"
+	"github.com/imulab/go-scim/pkg/v2/prop"
+	"github.com/imulab/go-scim/pkg/v2/spec"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"go.etcd.io/bbolt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestBoltDatabase(t *testing.T) {
+	s := new(BoltDatabaseTestSuite)
+	suite.Run(t, s)
+}
+
+type BoltDatabaseTestSuite struct {
+	suite.Suite
+	resourceType *spec.ResourceType
+}
+
+func (s *BoltDatabaseTestSuite) TestCRUD() {
+	store, done := s.store()
+	defer done()
+	database := DB(s.resourceType, store, "users")
+	ctx := context.Background()
+
+	_, err := database.Get(ctx, "user001", nil)
+	assert.True(s.T(), errors.Is(err, spec.ErrNotFound), "bucket is not created yet")
+
+	foo := s.user(`{"schemas": ["urn:ietf:params:scim:schemas:core:2.0:User"], "id": "user001", "userName": "foo", "password": "s3cret", "emails": [{"value": "foo@bar.com"}], "meta": {"version": "W/\"1\""}}`)
+	require.Nil(s.T(), database.Insert(ctx, foo))
+	err = database.Insert(ctx, s.user(`{"schemas": ["urn:ietf:params:scim:schemas:core:2.0:User"], "id": "user002", "userName": "FOO"}`))
+	assert.True(s.T(), errors.Is(err, spec.ErrUniqueness))
+	err = database.Insert(ctx, s.user(`{"schemas": ["urn:ietf:params:scim:schemas:core:2.0:User"], "id": "user001", "userName": "bar"}`))
+	assert.True(s.T(), errors.Is(err, spec.ErrUniqueness))
+
+	got, err := database.Get(ctx, "user001", nil)
+	require.Nil(s.T(), err)
+	assert.Equal(s.T(), foo.Hash(), got.Hash())
+
+	replacement := s.user(`{"schemas": ["urn:ietf:params:scim:schemas:core:2.0:User"], "id": "user001", "userName": "bar", "meta": {"version": "W/\"2\""}}`)
+	require.Nil(s.T(), database.Replace(ctx, foo, replacement))
+	err = database.Replace(ctx, foo, replacement)
+	assert.True(s.T(), errors.Is(err, spec.ErrConflict), "replaced with a stale version")
+
+	require.Nil(s.T(), database.Insert(ctx, s.user(`{"schemas": ["urn:ietf:params:scim:schemas:core:2.0:User"], "id": "user002", "userName": "foo"}`)), "userName was released")
+	n, err := database.Count(ctx, `userName eq "bar"`)
+	require.Nil(s.T(), err)
+	assert.Equal(s.T(), 1, n)
+
+	err = database.Delete(ctx, foo)
+	assert.True(s.T(), errors.Is(err, spec.ErrConflict), "deleted with a stale version")
+	require.Nil(s.T(), database.Delete(ctx, replacement))
+	err = database.Delete(ctx, replacement)
+	assert.True(s.T(), errors.Is(err, spec.ErrNotFound))
+
+	n, err = database.Count(ctx, "")
+	require.Nil(s.T(), err)
+	assert.Equal(s.T(), 1, n)
+	n, err = database.Count(ctx, `userName eq "bar"`)
+	require.Nil(s.T(), err)
+	assert.Equal(s.T(), 0, n)
+}
+
+func (s *BoltDatabaseTestSuite) TestQuery() {
+	store, done := s.store()
+	defer done()
+	database := DB(s.resourceType, store, "users").(db.CursorDB)
+	ctx := context.Background()
+
+	for _, each := range []string{
+		`{"schemas": ["urn:ietf:params:scim:schemas:core:2.0:User"], "id": "user001", "userName": "carol", "active": true, "emails": [{"value": "carol@foo.com"}]}`,
+		`{"schemas": ["urn:ietf:params:scim:schemas:core:2.0:User"], "id": "user002", "userName": "Bob", "active": false, "emails": [{"value": "bob@bar.com"}]}`,
+		`{"schemas": ["urn:ietf:params:scim:schemas:core:2.0:User"], "id": "user003", "userName": "alice", "active": true}`,
+	} {
+		require.Nil(s.T(), database.Insert(ctx, s.user(each)))
+	}
+
+	tests := []struct {
+		filter     string
+		sort       *crud.Sort
+		pagination *crud.Pagination
+		expect     []string
+	}{
+		{filter: `userName eq "BOB"`, expect: []string{"user002"}},
+		{filter: `userName eq "bob" or userName eq "alice"`, expect: []string{"user002", "user003"}},
+		{filter: `userName eq "carol" and active eq false`, expect: []string{}},
+		{filter: `emails.value ew "foo.com"`, expect: []string{"user001"}},
+		{filter: `active eq true`, sort: &crud.Sort{By: "userName"}, expect: []string{"user003", "user001"}},
+		{sort: &crud.Sort{By: "userName"}, pagination: &crud.Pagination{StartIndex: 2, Count: 1}, expect: []string{"user002"}},
+		{pagination: &crud.Pagination{StartIndex: 5, Count: 1}, expect: []string{}},
+	}
+	for _, test := range tests {
+		s.T().Run(fmt.Sprintf("%s %v %v", test.filter, test.sort, test.pagination), func(t *testing.T) {
+			results, err := database.Query(ctx, test.filter, test.sort, test.pagination, nil)
+			require.Nil(t, err)
+			assert.Equal(t, test.expect, s.ids(results))
+		})
+	}
+
+	results, next, err := database.QueryCursor(ctx, "", &crud.Sort{By: "userName"}, &crud.CursorPagination{Count: 2}, nil)
+	require.Nil(s.T(), err)
+	assert.Equal(s.T(), []string{"user003", "user002"}, s.ids(results))
+	results, next, err = database.QueryCursor(ctx, "", &crud.Sort{By: "userName"}, &crud.CursorPagination{Cursor: next, Count: 2}, nil)
+	require.Nil(s.T(), err)
+	assert.Equal(s.T(), []string{"user001"}, s.ids(results))
+	assert.Empty(s.T(), next)
+
+	results, err = db.GetMany(ctx, database, []string{"user003", "missing", "user001"}, nil)
+	require.Nil(s.T(), err)
+	assert.Equal(s.T(), []string{"user003", "user001"}, s.ids(results))
+}
+
+func (s *BoltDatabaseTestSuite) TestLookup() {
+	store, done := s.store()
+	defer done()
+	d := DB(s.resourceType, store, "users").(*boltDB)
+	ctx := context.Background()
+
+	require.Nil(s.T(), d.Insert(ctx, s.user(`{"schemas": ["urn:ietf:params:scim:schemas:core:2.0:User"], "id": "user001", "userName": "foo"}`)))
+	require.Nil(s.T(), d.Insert(ctx, s.user(`{"schemas": ["urn:ietf:params:scim:schemas:core:2.0:User"], "id": "user002", "userName": "bar"}`)))
+
+	tests := []struct {
+		filter string
+		ok     bool
+		expect []string
+	}{
+		{filter: `userName eq "FOO"`, ok: true, expect: []string{"user001"}},
+		{filter: `urn:ietf:params:scim:schemas:core:2.0:User:userName eq "foo"`, ok: true, expect: []string{"user001"}},
+		{filter: `userName eq "foo" or userName eq "bar"`, ok: true, expect: []string{"user001", "user002"}},
+		{filter: `userName eq "foo" and active eq true`, ok: true, expect: []string{"user001"}},
+		{filter: `userName eq "foo" or active eq true`},
+		{filter: `userName sw "f"`},
+		{filter: `not (userName eq "foo")`},
+	}
+	for _, test := range tests {
+		s.T().Run(test.filter, func(t *testing.T) {
+			root, err := expr.CompileFilter(test.filter)
+			require.Nil(t, err)
+			_ = store.View(func(tx *bbolt.Tx) error {
+				ids, ok := d.lookup(tx.Bucket(d.bucket), root)
+				assert.Equal(t, test.ok, ok)
+				if test.ok {
+					assert.Equal(t, test.expect, ids)
+				}
+				return nil
+			})
+		})
+	}
+}
+
+func (s *BoltDatabaseTestSuite) TestDurability() {
+	dir, err := ioutil.TempDir("", "bolt")
+	require.Nil(s.T(), err)
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+	path := filepath.Join(dir, "scim.db")
+
+	store, err := bbolt.Open(path, 0600, nil)
+	require.Nil(s.T(), err)
+	require.Nil(s.T(), DB(s.resourceType, store, "users").Insert(context.Background(),
+		s.user(`{"schemas": ["urn:ietf:params:scim:schemas:core:2.0:User"], "id": "user001", "userName": "foo"}`)))
+	require.Nil(s.T(), store.Close())
+
+	store, err = bbolt.Open(path, 0600, nil)
+	require.Nil(s.T(), err)
+	defer func() {
+		_ = store.Close()
+	}()
+	results, err := DB(s.resourceType, store, "users").Query(context.Background(), `userName eq "foo"`, nil, nil, nil)
+	require.Nil(s.T(), err)
+	assert.Equal(s.T(), []string{"user001"}, s.ids(results))
+}
+
+func (s *BoltDatabaseTestSuite) TestTransaction() {
+	store, done := s.store()
+	defer done()
+	database := DB(s.resourceType, store, "users")
+	ctx := context.Background()
+
+	foo := s.user(`{"schemas": ["urn:ietf:params:scim:schemas:core:2.0:User"], "id": "user001", "userName": "foo", "meta": {"version": "W/\"1\""}}`)
+	require.Nil(s.T(), database.Insert(ctx, foo))
+
+	err := db.WithTx(ctx, database, func(ctx context.Context) error {
+		if err := database.Insert(ctx, s.user(`{"schemas": ["urn:ietf:params:scim:schemas:core:2.0:User"], "id": "user002", "userName": "bar"}`)); err != nil {
+			return err
+		}
+		return database.Delete(ctx, s.user(`{"schemas": ["urn:ietf:params:scim:schemas:core:2.0:User"], "id": "user001", "meta": {"version": "W/\"stale\""}}`))
+	})
+	assert.True(s.T(), errors.Is(err, spec.ErrConflict))
+	_, err = database.Get(ctx, "user002", nil)
+	assert.True(s.T(), errors.Is(err, spec.ErrNotFound), "insert was rolled back")
+
+	// A failed write rolls back the transaction, even if the error is ignored.
+	err = db.WithTx(ctx, database, func(ctx context.Context) error {
+		_ = database.Insert(ctx, s.user(`{"schemas": ["urn:ietf:params:scim:schemas:core:2.0:User"], "id": "user003", "userName": "FOO"}`))
+		return database.Insert(ctx, s.user(`{"schemas": ["urn:ietf:params:scim:schemas:core:2.0:User"], "id": "user002", "userName": "bar"}`))
+	})
+	assert.True(s.T(), errors.Is(err, spec.ErrUniqueness))
+	_, err = database.Get(ctx, "user002", nil)
+	assert.True(s.T(), errors.Is(err, spec.ErrNotFound))
+
+	err = db.WithTx(ctx, database, func(ctx context.Context) error {
+		if err := database.Insert(ctx, s.user(`{"schemas": ["urn:ietf:params:scim:schemas:core:2.0:User"], "id": "user002", "userName": "bar"}`)); err != nil {
+			return err
+		}
+		n, err := database.Count(ctx, "")
+		if err == nil && n != 2 {
+			err = fmt.Errorf("expected 2 resources in transaction, got %d", n)
+		}
+		return err
+	})
+	require.Nil(s.T(), err)
+	results, err := database.Query(ctx, `userName eq "bar"`, nil, nil, nil)
+	require.Nil(s.T(), err)
+	assert.Equal(s.T(), []string{"user002"}, s.ids(results))
+}
+
+func (s *BoltDatabaseTestSuite) TestBulkWrite() {
+	store, done := s.store()
+	defer done()
+	database := DB(s.resourceType, store, "users").(db.BulkWriteDB)
+	ctx := context.Background()
+
+	errs := database.InsertMany(ctx, []*prop.Resource{
+		s.user(`{"schemas": ["urn:ietf:params:scim:schemas:core:2.0:User"], "id": "user001", "userName": "foo", "meta": {"version": "W/\"1\""}}`),
+		s.user(`{"schemas": ["urn:ietf:params:scim:schemas:core:2.0:User"], "id": "user002", "userName": "FOO"}`),
+		s.user(`{"schemas": ["urn:ietf:params:scim:schemas:core:2.0:User"], "id": "user003", "userName": "bar", "meta": {"version": "W/\"1\""}}`),
+	})
+	require.Len(s.T(), errs, 3)
+	assert.Nil(s.T(), errs[0])
+	assert.True(s.T(), errors.Is(errs[1], spec.ErrUniqueness))
+	assert.Nil(s.T(), errs[2])
+	n, err := database.Count(ctx, "")
+	require.Nil(s.T(), err)
+	assert.Equal(s.T(), 2, n)
+
+	foo, err := database.Get(ctx, "user001", nil)
+	require.Nil(s.T(), err)
+	errs = database.ReplaceMany(ctx, []db.Replacement{
+		{
+			Ref:         foo,
+			Replacement: s.user(`{"schemas": ["urn:ietf:params:scim:schemas:core:2.0:User"], "id": "user001", "userName": "baz", "meta": {"version": "W/\"2\""}}`),
+		},
+		{
+			Ref:         s.user(`{"schemas": ["urn:ietf:params:scim:schemas:core:2.0:User"], "id": "user003", "meta": {"version": "W/\"stale\""}}`),
+			Replacement: s.user(`{"schemas": ["urn:ietf:params:scim:schemas:core:2.0:User"], "id": "user003", "userName": "qux"}`),
+		},
+		{
+			Ref:         s.user(`{"schemas": ["urn:ietf:params:scim:schemas:core:2.0:User"], "id": "user003", "meta": {"version": "W/\"1\""}}`),
+			Replacement: s.user(`{"schemas": ["urn:ietf:params:scim:schemas:core:2.0:User"], "id": "user003", "userName": "baz"}`),
+		},
+	})
+	assert.Nil(s.T(), errs[0])
+	assert.True(s.T(), errors.Is(errs[1], spec.ErrConflict))
+	assert.True(s.T(), errors.Is(errs[2], spec.ErrUniqueness))
+	// the index entries of user003 are left as they were
+	results, err := database.Query(ctx, `userName eq "baz" or userName eq "bar"`, nil, nil, nil)
+	require.Nil(s.T(), err)
+	assert.Equal(s.T(), []string{"user001", "user003"}, s.ids(results))
+
+	errs = database.DeleteMany(ctx, []*prop.Resource{
+		s.user(`{"schemas": ["urn:ietf:params:scim:schemas:core:2.0:User"], "id": "user001"}`),
+		s.user(`{"schemas": ["urn:ietf:params:scim:schemas:core:2.0:User"], "id": "user004"}`),
+	})
+	assert.Nil(s.T(), errs[0])
+	assert.True(s.T(), errors.Is(errs[1], spec.ErrNotFound))
+	results, err = database.Query(ctx, `userName eq "foo"`, nil, nil, nil)
+	require.Nil(s.T(), err)
+	assert.Empty(s.T(), results)
+	n, err = database.Count(ctx, "")
+	require.Nil(s.T(), err)
+	assert.Equal(s.T(), 1, n)
+}
+
+// Returns a store in a temporary file, and the function to close and remove it.
+func (s *BoltDatabaseTestSuite) store() (*bbolt.DB, func()) {
+	dir, err := ioutil.TempDir("", "bolt")
+	require.Nil(s.T(), err)
+
+	store, err := bbolt.Open(filepath.Join(dir, "scim.db"), 0600, nil)
+	require.Nil(s.T(), err)
+
+	return store, func() {
+		_ = store.Close()
+		_ = os.RemoveAll(dir)
+	}
+}
+
+func (s *BoltDatabaseTestSuite) user(raw string) *prop.Resource {
+	resource := prop.NewResource(s.resourceType)
+	require.Nil(s.T(), scimjson.Deserialize([]byte(raw), resource))
+	return resource
+}
+
+func (s *BoltDatabaseTestSuite) ids(resources []*prop.Resource) []string {
+	ids := make([]string, 0, len(resources))
+	for _, each := range resources {
+		ids = append(ids, each.IdOrEmpty())
+	}
+	return ids
+}
+
+func (s *BoltDatabaseTestSuite) SetupSuite() {
+	for _, each := range []struct {
+		filepath  string
+		structure interface{}
+		post      func(parsed interface{})
+	}{
+		{
+			filepath:  "../../public/schemas/core_schema.json",
+			structure: new(spec.Schema),
+			post: func(parsed interface{}) {
+				spec.Schemas().Register(parsed.(*spec.Schema))
+			},
+		},
+		{
+			filepath:  "../../public/schemas/user_schema.json",
+			structure: new(spec.Schema),
+			post: func(parsed interface{}) {
+				spec.Schemas().Register(parsed.(*spec.Schema))
+			},
+		},
+		{
+			filepath:  "../../public/schemas/user_enterprise_extension_schema.json",
+			structure: new(spec.Schema),
+			post: func(parsed interface{}) {
+				spec.Schemas().Register(parsed.(*spec.Schema))
+			},
+		},
+		{
+			filepath:  "../../public/resource_types/user_resource_type.json",
+			structure: new(spec.ResourceType),
+			post: func(parsed interface{}) {
+				s.resourceType = parsed.(*spec.ResourceType)
+				crud.Register(s.resourceType)
+			},
+		},
+	} {
+		f, err := os.Open(each.filepath)
+		require.Nil(s.T(), err)
+
+		raw, err := ioutil.ReadAll(f)
+		require.Nil(s.T(), err)
+
+		err = json.Unmarshal(raw, each.structure)
+		require.Nil(s.T(), err)
+
+		if each.post != nil {
+			each.post(each.structure)
+		}
+	}
+}
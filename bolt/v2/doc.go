@@ -0,0 +1,3 @@
+// This package provides an embedded implementation of db.DB interface backed by bbolt, which persists resources in a
+// single file with secondary indexes, and requires no external database.
+package v2
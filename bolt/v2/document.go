@@ -0,0 +1,28 @@
+package v2
+
+import (
+	"encoding/json"
+	"fmt"
+	scimjson "github.com/imulab/go-scim/pkg/v2/json"
+	"github.com/imulab/go-scim/pkg/v2/prop"
+	"github.com/imulab/go-scim/pkg/v2/spec"
+)
+
+// Returns the JSON document of the resource to store. Unlike the JSON serialization for clients, the document contains
+// all assigned attributes, so that the resource can be restored as it is.
+func document(resource *prop.Resource) ([]byte, error) {
+	raw, err := json.Marshal(prop.Document(resource.RootProperty()))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", spec.ErrInternal, err)
+	}
+	return raw, nil
+}
+
+// Returns the resource restored from the stored JSON document.
+func (d *boltDB) resource(doc []byte) (*prop.Resource, error) {
+	resource := prop.NewResource(d.resourceType)
+	if err := scimjson.Deserialize(doc, resource); err != nil {
+		return nil, err
+	}
+	return resource, nil
+}
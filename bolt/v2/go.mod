@@ -0,0 +1,11 @@
+module github.com/imulab/go-scim/bolt/v2
+
+go 1.13
+
+require (
+	github.com/imulab/go-scim/pkg/v2 v2.0.0
+	github.com/stretchr/testify v1.4.0
+	go.etcd.io/bbolt v1.3.6
+)
+
+replace github.com/imulab/go-scim/pkg/v2 => ../../pkg/v2
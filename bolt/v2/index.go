@@ -0,0 +1,252 @@
+package v2
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/imulab/go-scim/pkg/v2/crud/expr"
+	"github.com/imulab/go-scim/pkg/v2/prop"
+	"github.com/imulab/go-scim/pkg/v2/spec"
+	"go.etcd.io/bbolt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	// @BoltIndex annotates a singular attribute so that a secondary index of its value is maintained in bbolt, which
+	// serves eq filters on the attribute. Attributes whose uniqueness is server or global always have one, which also
+	// enforces the uniqueness.
+	AnnotationBoltIndex = "@BoltIndex"
+)
+
+// index of the values of a singular attribute outside of multiValued attributes. The keys of its bucket are the
+// values, followed by a zero byte and the id of the resource, so that resources with the same value are adjacent.
+type index struct {
+	attr   *spec.Attribute
+	path   []string // names from the top level attribute to attr
+	bucket []byte
+	unique bool
+}
+
+// Returns the indexes of the resource type, by attribute id.
+func newIndexes(resourceType *spec.ResourceType) map[string]*index {
+	indexes := make(map[string]*index)
+
+	var collect func(attr *spec.Attribute, path []string)
+	collect = func(attr *spec.Attribute, path []string) {
+		_ = attr.ForEachSubAttribute(func(sub *spec.Attribute) error {
+			if sub.MultiValued() {
+				return nil
+			}
+			subPath := append(append([]string{}, path...), sub.Name())
+			if sub.Type() == spec.TypeComplex {
+				collect(sub, subPath)
+				return nil
+			}
+			if sub.ID() == "id" {
+				return nil // key of the resources bucket
+			}
+
+			unique := sub.Uniqueness() == spec.UniquenessServer || sub.Uniqueness() == spec.UniquenessGlobal
+			if _, ok := sub.Annotation(AnnotationBoltIndex); ok || unique {
+				indexes[sub.ID()] = &index{
+					attr:   sub,
+					path:   subPath,
+					bucket: []byte("index:" + sub.ID()),
+					unique: unique,
+				}
+			}
+			return nil
+		})
+	}
+	collect(resourceType.SuperAttribute(true), nil)
+
+	return indexes
+}
+
+// Returns the index key of the resource, or nil if the resource has no value for the attribute.
+func (i *index) keyOf(resource *prop.Resource) []byte {
+	nav := resource.Navigator()
+	for _, name := range i.path {
+		nav.Dot(name)
+	}
+	if nav.HasError() || nav.Current().IsUnassigned() {
+		return nil
+	}
+	return i.key(i.prefix(nav.Current().Raw()), resource.IdOrEmpty())
+}
+
+// Returns the prefix of the keys of the resources carrying the value, which is the value in its string form, in lower
+// case for attributes that compare case insensitively.
+func (i *index) prefix(value interface{}) []byte {
+	var s string
+	switch v := value.(type) {
+	case string:
+		s = v
+		if i.attr.Type() == spec.TypeString && !i.attr.CaseExact() {
+			s = strings.ToLower(s)
+		}
+		if i.attr.Type() == spec.TypeDateTime {
+			if t, err := spec.ParseDateTime(v); err == nil {
+				s = t.UTC().Format(spec.ISO8601)
+			}
+		}
+	case int64:
+		s = strconv.FormatInt(v, 10)
+	case float64:
+		s = strconv.FormatFloat(v, 'g', -1, 64)
+	case bool:
+		s = strconv.FormatBool(v)
+	default:
+		s = fmt.Sprint(v)
+	}
+	return append([]byte(s), 0)
+}
+
+func (i *index) key(prefix []byte, id string) []byte {
+	return append(append(make([]byte, 0, len(prefix)+len(id)), prefix...), id...)
+}
+
+// Returns the id of the resource of the key.
+func (i *index) idOf(key []byte) string {
+	return string(key[bytes.LastIndexByte(key, 0)+1:])
+}
+
+// Returns the prefix of the keys matching the literal of an eq filter on the attribute, or false if the literal is not
+// a value of the attribute.
+func (i *index) prefixOfLiteral(literal string) ([]byte, bool) {
+	switch i.attr.Type() {
+	case spec.TypeString, spec.TypeReference, spec.TypeBinary, spec.TypeDateTime:
+		s, err := expr.Unquote(literal)
+		if err != nil {
+			return nil, false
+		}
+		if i.attr.Type() == spec.TypeDateTime {
+			if _, err := spec.ParseDateTime(s); err != nil {
+				return nil, false
+			}
+		}
+		return i.prefix(s), true
+	case spec.TypeInteger:
+		i64, err := strconv.ParseInt(literal, 10, 64)
+		if err != nil {
+			return nil, false
+		}
+		return i.prefix(i64), true
+	case spec.TypeDecimal:
+		f64, err := strconv.ParseFloat(literal, 64)
+		if err != nil {
+			return nil, false
+		}
+		return i.prefix(f64), true
+	case spec.TypeBoolean:
+		b, err := strconv.ParseBool(literal)
+		if err != nil {
+			return nil, false
+		}
+		return i.prefix(b), true
+	default:
+		return nil, false
+	}
+}
+
+// Returns the ids of the resources that may match the filter, in ascending order, by looking up the indexes, or false
+// if the filter cannot be served by the indexes. The filter must still be evaluated on the resources of the ids, as
+// the indexes may return more resources than those matched.
+func (d *boltDB) lookup(b *bbolt.Bucket, root *expr.Expression) ([]string, bool) {
+	ids, ok := d.lookupIDs(b, root)
+	if !ok {
+		return nil, false
+	}
+
+	sorted := make([]string, 0, len(ids))
+	for id := range ids {
+		sorted = append(sorted, id)
+	}
+	sort.Strings(sorted)
+	return sorted, true
+}
+
+func (d *boltDB) lookupIDs(b *bbolt.Bucket, root *expr.Expression) (map[string]struct{}, bool) {
+	if root == nil {
+		return nil, false
+	}
+
+	switch strings.ToLower(root.Token()) {
+	case expr.And:
+		left, leftOk := d.lookupIDs(b, root.Left())
+		right, rightOk := d.lookupIDs(b, root.Right())
+		switch {
+		case leftOk && rightOk:
+			for id := range left {
+				if _, ok := right[id]; !ok {
+					delete(left, id)
+				}
+			}
+			return left, true
+		case leftOk:
+			return left, true
+		default:
+			return right, rightOk
+		}
+	case expr.Or:
+		left, leftOk := d.lookupIDs(b, root.Left())
+		if !leftOk {
+			return nil, false
+		}
+		right, rightOk := d.lookupIDs(b, root.Right())
+		if !rightOk {
+			return nil, false
+		}
+		for id := range right {
+			left[id] = struct{}{}
+		}
+		return left, true
+	case expr.Eq:
+		if !root.IsRelationalOperator() {
+			return nil, false
+		}
+		i := d.indexOf(root.Left())
+		if i == nil {
+			return nil, false
+		}
+		ib := b.Bucket(i.bucket)
+		if ib == nil {
+			return nil, false
+		}
+		prefix, ok := i.prefixOfLiteral(root.Right().Token())
+		if !ok {
+			return nil, false
+		}
+
+		ids := make(map[string]struct{})
+		c := ib.Cursor()
+		for k, _ := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, _ = c.Next() {
+			ids[i.idOf(k)] = struct{}{}
+		}
+		return ids, true
+	default:
+		return nil, false
+	}
+}
+
+// Returns the index of the attribute of the path, or nil if there is none.
+func (d *boltDB) indexOf(head *expr.Expression) *index {
+	if head == nil || head.ContainsFilter() {
+		return nil
+	}
+
+	cursor := head
+	if strings.EqualFold(cursor.Token(), d.resourceType.Schema().ID()) {
+		cursor = cursor.Next()
+	}
+
+	attr := d.resourceType.SuperAttribute(true)
+	for ; cursor != nil && attr != nil; cursor = cursor.Next() {
+		attr = attr.SubAttributeForName(cursor.Token())
+	}
+	if attr == nil {
+		return nil
+	}
+	return d.indexes[attr.ID()]
+}
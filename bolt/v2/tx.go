@@ -0,0 +1,59 @@
+package v2
+
+import (
+	"context"
+	"errors"
+	"github.com/imulab/go-scim/pkg/v2/spec"
+	"go.etcd.io/bbolt"
+)
+
+// Transaction calls fn with a context carrying a write transaction of the store. The calls of the databases on the
+// store with this context (see DB) are part of the transaction, which is committed when fn returns nil, and rolled
+// back when it returns an error or panics. When the context already carries a transaction of the store, fn joins it
+// instead, and it is up to the outermost call to commit or roll back.
+//
+// bbolt allows a single write transaction at a time, which calls with other contexts wait for. As a write that fails
+// within the transaction may have been partially applied, i.e. to the indexes, the transaction is rolled back once a
+// write fails with an error other than spec.ErrConflict or spec.ErrNotFound, which are returned before anything is
+// written, even if fn returns nil; the error of the write is returned then.
+func Transaction(ctx context.Context, store *bbolt.DB, fn func(ctx context.Context) error) error {
+	if t := txOf(ctx, store); t != nil {
+		return fn(ctx)
+	}
+
+	return errStore(store.Update(func(tx *bbolt.Tx) error {
+		t := &transaction{store: store, tx: tx}
+		if err := fn(context.WithValue(ctx, txKey{}, t)); err != nil {
+			return err
+		}
+		return t.failed
+	}))
+}
+
+// WithTx calls fn in a transaction of the store of the database, and implements db.TxDB (see Transaction).
+func (d *boltDB) WithTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	return Transaction(ctx, d.store, fn)
+}
+
+type txKey struct{}
+
+type transaction struct {
+	store  *bbolt.DB
+	tx     *bbolt.Tx
+	failed error // first write that failed and may have been partially applied
+}
+
+// Records the error of a failed write, unless it was returned before anything was written.
+func (t *transaction) fail(err error) {
+	if t.failed == nil && !errors.Is(err, spec.ErrConflict) && !errors.Is(err, spec.ErrNotFound) {
+		t.failed = err
+	}
+}
+
+// Returns the transaction of the store carried by the context, or nil if there is none.
+func txOf(ctx context.Context, store *bbolt.DB) *transaction {
+	if t, ok := ctx.Value(txKey{}).(*transaction); ok && t.store == store {
+		return t
+	}
+	return nil
+}
@@ -0,0 +1,57 @@
+package v2
+
+import (
+	"context"
+	"github.com/go-chi/chi/v5"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Options configures Mount.
+type Options struct {
+	// Middleware are called, in order, before the SCIM handler, i.e. to authenticate the requests with oauth.Middleware.
+	Middleware []func(next http.Handler) http.Handler
+	// Context, if not nil, returns the context of the request handed to the SCIM handler, so that it carries what is
+	// resolved from the route, i.e. the tenant of a path parameter of the prefix (see tenant.With and chi.URLParam).
+	// Otherwise, the context of the request is handed as is.
+	Context func(r *http.Request) context.Context
+}
+
+// Mount registers the handler on the router under the prefix, i.e. "/scim/v2", for all methods, so that the handler of
+// handlerutil.NewServer serves /scim/v2/Users. The handler is called with the path relative to the prefix, which may
+// have path parameters, i.e. "/tenants/{tenant}/scim/v2", and be relative to a sub router.
+func Mount(router chi.Router, prefix string, handler http.Handler, options Options) {
+	serve := http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		path := chi.URLParam(r, "*")
+		// chi matches the escaped path, when there is one, and does not unescape the wildcard.
+		if len(r.URL.RawPath) > 0 {
+			if unescaped, err := url.PathUnescape(path); err == nil {
+				path = unescaped
+			}
+		}
+
+		copied := withPath(r, path)
+		if options.Context != nil {
+			copied = copied.WithContext(options.Context(r))
+		}
+		handler.ServeHTTP(rw, copied)
+	})
+	router.Route(strings.TrimSuffix(prefix, "/"), func(r chi.Router) {
+		r.Use(options.Middleware...)
+		r.Handle("/", serve)
+		r.Handle("/*", serve)
+	})
+}
+
+// Returns a shallow copy of the request, whose URL has the path.
+func withPath(r *http.Request, path string) *http.Request {
+	u := *r.URL
+	u.Path = "/" + strings.TrimPrefix(path, "/")
+	u.RawPath = ""
+
+	copied := new(http.Request)
+	*copied = *r
+	copied.URL = &u
+	return copied
+}
@@ -0,0 +1,3 @@
+// This package mounts the SCIM handlers, i.e. the one of handlerutil.NewServer, on a chi router. chi middleware are
+// net/http middleware, hence those of the core module, i.e. that of the oauth package, are used as is.
+package v2
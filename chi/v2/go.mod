@@ -0,0 +1,11 @@
+module github.com/imulab/go-scim/chi/v2
+
+go 1.14
+
+require (
+	github.com/go-chi/chi/v5 v5.0.8
+	github.com/imulab/go-scim/pkg/v2 v2.0.0
+	github.com/stretchr/testify v1.7.0
+)
+
+replace github.com/imulab/go-scim/pkg/v2 => ../../pkg/v2
@@ -21,7 +21,39 @@ type arguments struct {
 	*args.MongoDB
 	*args.RabbitMQ
 	*args.Logging
-	httpPort int
+	httpPort          int
+	meSubjectHeader   string
+	history           bool
+	async             bool
+	idempotency       bool
+	cascadeDelete     string
+	cascadeManager    bool
+	uniqueAttrs       string
+	collectViolations bool
+	passwordHash      string
+	passwordMinLen    int
+	tenantHeader      string
+	webhooks          string
+	webhookSecret     string
+	logPayloads       bool
+	redactAttrs       string
+	hydrateMembers    bool
+	allowUnresolved   bool
+	computeGroups     bool
+	dynamicGroups     bool
+	clientIDs         bool
+	clientIDFormat    string
+	idGenerator       string
+	snowflakeNode     int
+	userIDPrefix      string
+	groupIDPrefix     string
+	maxUsers          int
+	maxGroups         int
+	maxMembers        int
+	patchAttempts     int
+	authzPolicy       string
+	scopesHeader      string
+	authzStrip        bool
 }
 
 func (arg *arguments) Flags() []cli.Flag {
@@ -34,6 +66,220 @@ func (arg *arguments) Flags() []cli.Flag {
 			Value:       8080,
 			Destination: &arg.httpPort,
 		},
+		&cli.StringFlag{
+			Name:        "me-subject-header",
+			Usage:       "HTTP header carrying the id of the authenticated User, set by a trusted authenticating proxy. /Me is served only when specified, and changes are attributed to the User in the change history",
+			EnvVars:     []string{"ME_SUBJECT_HEADER"},
+			Destination: &arg.meSubjectHeader,
+		},
+		&cli.BoolFlag{
+			Name:        "history",
+			Usage:       "Record the change history of Users and Groups in memory, and serve it at /Users/:id/history and /Groups/:id/history",
+			EnvVars:     []string{"HISTORY"},
+			Value:       false,
+			Destination: &arg.history,
+		},
+		&cli.BoolFlag{
+			Name:        "async",
+			Usage:       "Create, replace and delete Users and Groups asynchronously, responding 202 with an operation whose status is served at /Operations/:id",
+			EnvVars:     []string{"ASYNC"},
+			Value:       false,
+			Destination: &arg.async,
+		},
+		&cli.BoolFlag{
+			Name:        "idempotency",
+			Usage:       "Answer retried creation of Users and Groups carrying the same Idempotency-Key header with the resource originally created. Keys are kept in memory for 24 hours",
+			EnvVars:     []string{"IDEMPOTENCY"},
+			Value:       false,
+			Destination: &arg.idempotency,
+		},
+		&cli.IntFlag{
+			Name:        "patch-attempts",
+			Usage:       "Maximum number of attempts to patch Users and Groups modified concurrently, re-applying the patch to their current state, before the conflict is returned. Requests with If-Match are never retried",
+			EnvVars:     []string{"PATCH_ATTEMPTS"},
+			Value:       1,
+			Destination: &arg.patchAttempts,
+		},
+		&cli.StringFlag{
+			Name:        "cascade-delete",
+			Usage:       "Policy to remove deleted Users and Groups from group members: none, sync (before responding) or async (in the background)",
+			EnvVars:     []string{"CASCADE_DELETE"},
+			Value:       "none",
+			Destination: &arg.cascadeDelete,
+		},
+		&cli.BoolFlag{
+			Name:        "cascade-manager",
+			Usage:       "Also remove the manager of Users referencing deleted Users, according to the cascade-delete policy",
+			EnvVars:     []string{"CASCADE_MANAGER"},
+			Value:       false,
+			Destination: &arg.cascadeManager,
+		},
+		&cli.BoolFlag{
+			Name:        "client-ids",
+			Usage:       "Honor the id supplied by the client when creating Users and Groups, i.e. to migrate resources preserving their ids, instead of always generating one",
+			EnvVars:     []string{"CLIENT_IDS"},
+			Value:       false,
+			Destination: &arg.clientIDs,
+		},
+		&cli.StringFlag{
+			Name:        "client-id-format",
+			Usage:       "Regular expression the ids supplied by clients shall match, when client-ids is enabled. Defaults to up to 128 URL safe characters",
+			EnvVars:     []string{"CLIENT_ID_FORMAT"},
+			Destination: &arg.clientIDFormat,
+		},
+		&cli.StringFlag{
+			Name:        "id-generator",
+			Usage:       "Strategy to generate the ids of Users and Groups: uuidv4, uuidv7, ulid or snowflake. All but uuidv4 sort by creation time",
+			EnvVars:     []string{"ID_GENERATOR"},
+			Value:       "uuidv4",
+			Destination: &arg.idGenerator,
+		},
+		&cli.IntFlag{
+			Name:        "snowflake-node",
+			Usage:       "Node of the snowflake ids, between 0 and 1023, which shall be different for every instance of the server",
+			EnvVars:     []string{"SNOWFLAKE_NODE"},
+			Value:       0,
+			Destination: &arg.snowflakeNode,
+		},
+		&cli.StringFlag{
+			Name:        "user-id-prefix",
+			Usage:       "Prefix of the generated ids of Users, i.e. usr_",
+			EnvVars:     []string{"USER_ID_PREFIX"},
+			Destination: &arg.userIDPrefix,
+		},
+		&cli.StringFlag{
+			Name:        "group-id-prefix",
+			Usage:       "Prefix of the generated ids of Groups, i.e. grp_",
+			EnvVars:     []string{"GROUP_ID_PREFIX"},
+			Destination: &arg.groupIDPrefix,
+		},
+		&cli.IntFlag{
+			Name:        "max-users",
+			Usage:       "Maximum number of Users of a tenant, or of the server without tenant-header. 0 for no limit",
+			EnvVars:     []string{"MAX_USERS"},
+			Value:       0,
+			Destination: &arg.maxUsers,
+		},
+		&cli.IntFlag{
+			Name:        "max-groups",
+			Usage:       "Maximum number of Groups of a tenant, or of the server without tenant-header. 0 for no limit",
+			EnvVars:     []string{"MAX_GROUPS"},
+			Value:       0,
+			Destination: &arg.maxGroups,
+		},
+		&cli.IntFlag{
+			Name:        "max-members",
+			Usage:       "Maximum number of members of a Group. 0 for no limit",
+			EnvVars:     []string{"MAX_MEMBERS"},
+			Value:       0,
+			Destination: &arg.maxMembers,
+		},
+		&cli.StringFlag{
+			Name:        "unique-attributes",
+			Usage:       "Comma delimited paths of attributes whose values shall be unique among Users or Groups, in addition to those of uniqueness=server, i.e. externalId",
+			EnvVars:     []string{"UNIQUE_ATTRIBUTES"},
+			Destination: &arg.uniqueAttrs,
+		},
+		&cli.BoolFlag{
+			Name:        "collect-violations",
+			Usage:       "Report all validation violations of a User or Group at once, instead of only the first one",
+			EnvVars:     []string{"COLLECT_VIOLATIONS"},
+			Value:       false,
+			Destination: &arg.collectViolations,
+		},
+		&cli.StringFlag{
+			Name:        "password-hash",
+			Usage:       "Algorithm to hash User passwords with: bcrypt, argon2id, scrypt or pbkdf2",
+			EnvVars:     []string{"PASSWORD_HASH"},
+			Value:       "bcrypt",
+			Destination: &arg.passwordHash,
+		},
+		&cli.IntFlag{
+			Name:        "password-min-length",
+			Usage:       "Minimum number of characters of User passwords, 0 for no minimum",
+			EnvVars:     []string{"PASSWORD_MIN_LENGTH"},
+			Value:       0,
+			Destination: &arg.passwordMinLen,
+		},
+		&cli.StringFlag{
+			Name:        "authz-policy",
+			Usage:       "Path of the JSON file of the rules granting scopes the attributes of Users and Groups they may read and write. When specified, callers are restricted to the attributes granted to their scopes",
+			EnvVars:     []string{"AUTHZ_POLICY"},
+			Destination: &arg.authzPolicy,
+		},
+		&cli.StringFlag{
+			Name:        "scopes-header",
+			Usage:       "Header carrying the space delimited scopes of the caller for authz-policy, set by a trusted party, i.e. an authenticating reverse proxy",
+			EnvVars:     []string{"SCOPES_HEADER"},
+			Value:       "X-Scopes",
+			Destination: &arg.scopesHeader,
+		},
+		&cli.BoolFlag{
+			Name:        "authz-strip",
+			Usage:       "Revert the modifications of attributes the caller may not write, instead of rejecting the request",
+			EnvVars:     []string{"AUTHZ_STRIP"},
+			Value:       false,
+			Destination: &arg.authzStrip,
+		},
+		&cli.StringFlag{
+			Name:        "tenant-header",
+			Usage:       "HTTP header carrying the tenant of the request, set by a trusted proxy. When specified, every tenant has Users and Groups of its own, kept in memory or in mongo collections suffixed by the tenant, while schemas and resource types are shared. Run groupsync with tenants to apply its group sync messages",
+			EnvVars:     []string{"TENANT_HEADER"},
+			Destination: &arg.tenantHeader,
+		},
+		&cli.StringFlag{
+			Name:        "webhooks",
+			Usage:       "Comma delimited URLs to POST the change events of Users and Groups to, retried with backoff, and logged when they could not be delivered",
+			EnvVars:     []string{"WEBHOOKS"},
+			Destination: &arg.webhooks,
+		},
+		&cli.StringFlag{
+			Name:        "webhook-secret",
+			Usage:       "Secret to sign webhook requests with HMAC-SHA256, in the X-Scim-Signature header",
+			EnvVars:     []string{"WEBHOOK_SECRET"},
+			Destination: &arg.webhookSecret,
+		},
+		&cli.BoolFlag{
+			Name:        "log-payloads",
+			Usage:       "Log the payloads of the calls to the User and Group services at debug level, with the values of password and other sensitive attributes redacted",
+			EnvVars:     []string{"LOG_PAYLOADS"},
+			Value:       false,
+			Destination: &arg.logPayloads,
+		},
+		&cli.StringFlag{
+			Name:        "redact-attributes",
+			Usage:       "Comma delimited paths of User attributes to redact from logged payloads, in addition to those of returned=never or mutability=writeOnly, i.e. emails.value,phoneNumbers.value",
+			EnvVars:     []string{"REDACT_ATTRIBUTES"},
+			Destination: &arg.redactAttrs,
+		},
+		&cli.BoolFlag{
+			Name:        "hydrate-members",
+			Usage:       "Fill in the display and $ref of the members of the Groups returned, from the current state of the member Users and Groups",
+			EnvVars:     []string{"HYDRATE_MEMBERS"},
+			Value:       false,
+			Destination: &arg.hydrateMembers,
+		},
+		&cli.BoolFlag{
+			Name:        "allow-unresolved-members",
+			Usage:       "Accept members added to Groups that do not refer to an existing User or Group, i.e. managed by an external system, instead of rejecting them",
+			EnvVars:     []string{"ALLOW_UNRESOLVED_MEMBERS"},
+			Value:       false,
+			Destination: &arg.allowUnresolved,
+		},
+		&cli.BoolFlag{
+			Name:        "compute-groups",
+			Usage:       "Compute the groups of the Users returned from the members of the Groups, instead of returning those last synchronized; filters on groups still match the latter",
+			EnvVars:     []string{"COMPUTE_GROUPS"},
+			Value:       false,
+			Destination: &arg.computeGroups,
+		},
+		&cli.BoolFlag{
+			Name:        "dynamic-groups",
+			Usage:       "Keep the members of dynamic Groups, whose filter of the urn:imulab:scim:schemas:extension:dynamic:2.0:Group extension selects the Users, up to date as Users change, from the change stream of the User database, or compute them as the Groups are returned if the database has none; the group-resource-type has to include the extension",
+			EnvVars:     []string{"DYNAMIC_GROUPS"},
+			Value:       false,
+			Destination: &arg.dynamicGroups,
+		},
 	}
 	flags = append(flags, arg.Scim.Flags()...)
 	flags = append(flags, arg.MemoryDB.Flags()...)
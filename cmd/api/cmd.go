@@ -1,13 +1,14 @@
 package api
 
 import (
+	"context"
 	"fmt"
-	"github.com/julienschmidt/httprouter"
+	"github.com/imulab/go-scim/pkg/v2/handlerutil"
 	"github.com/urfave/cli/v2"
 	"net/http"
 )
 
-// Command returns a cli.Command that starts an HTTP router to serve the SCIM API.
+// Command returns a cli.Command that starts an HTTP server to serve the SCIM API (see handlerutil.NewServer).
 func Command() *cli.Command {
 	args := newArgs()
 	return &cli.Command{
@@ -20,36 +21,83 @@ func Command() *cli.Command {
 
 			app.ensureSchemaRegistered()
 
-			var router = httprouter.New()
-			{
-				router.GET("/ServiceProviderConfig", ServiceProviderConfigHandler(app.ServiceProviderConfig()))
-				router.GET("/Schemas", SchemasHandler())
-				router.GET("/Schemas/:id", SchemaByIdHandler())
-				router.GET("/ResourceTypes", ResourceTypesHandler(app.UserResourceType(), app.GroupResourceType()))
-				router.GET("/ResourceTypes/:id", ResourceTypeByIdHandler(app.userResourceType, app.GroupResourceType()))
+			if len(app.webhooks()) > 0 {
+				go app.RelayWebhooks(context.Background())
+			}
+			if app.args.dynamicGroups {
+				go app.MaintainDynamicGroups(context.Background())
+			}
 
-				router.GET("/Users/:id", GetHandler(app.UserGetService(), app.Logger()))
-				router.GET("/Users", SearchHandler(app.UserQueryService(), app.Logger()))
-				router.POST("/Users", CreateHandler(app.UserCreateService(), app.Logger()))
-				router.PUT("/Users/:id", ReplaceHandler(app.UserReplaceService(), app.Logger()))
-				router.PATCH("/Users/:id", PatchHandler(app.UserPatchService(), app.Logger()))
-				router.DELETE("/Users/:id", DeleteHandler(app.UserDeleteService(), app.Logger()))
+			users := &handlerutil.Endpoint{
+				ResourceType: app.UserResourceType(),
+				Get:          app.UserGetService(),
+				Query:        app.UserQueryService(),
+				Patch:        app.UserPatchService(),
+			}
+			groups := &handlerutil.Endpoint{
+				ResourceType: app.GroupResourceType(),
+				Get:          app.GroupGetService(),
+				Query:        app.GroupQueryService(),
+				Patch:        app.GroupPatchService(),
+				Members:      app.GroupMembersService(),
+				Membership:   app.GroupMembershipService(),
+			}
+			options := handlerutil.ServerOptions{
+				ServiceProviderConfig: app.ServiceProviderConfig(),
+				Endpoints:             []*handlerutil.Endpoint{users, groups},
+				Bulk:                  app.BulkService(),
+				Search:                app.RootQueryService(),
+				OnError: func(r *http.Request, err error) {
+					app.Logger().
+						Err(err).
+						Str("method", r.Method).
+						Str("path", r.URL.Path).
+						Msg("error when serving request")
+				},
+			}
+			if app.args.async {
+				users.Async = app.UserAsyncService()
+				groups.Async = app.GroupAsyncService()
+				options.Operations = app.OperationService()
+			} else {
+				users.Create, users.Replace, users.Delete = app.UserCreateService(), app.UserReplaceService(), app.UserDeleteService()
+				groups.Create, groups.Replace, groups.Delete = app.GroupCreateService(), app.GroupReplaceService(), app.GroupDeleteService()
+			}
+			if app.args.history {
+				users.History = app.HistoryService()
+				groups.History = app.HistoryService()
+			}
+			if len(app.args.meSubjectHeader) > 0 {
+				options.Me = app.MeService()
+			}
+
+			server := handlerutil.NewServer(options)
+
+			// changes are attributed to the subject carried by the header, if any, in the change history, and /Me is
+			// served to the subject
+			if header := app.args.meSubjectHeader; len(header) > 0 {
+				server = SubjectFromHeader(header, server)
+			}
 
-				router.GET("/Groups/:id", GetHandler(app.GroupGetService(), app.Logger()))
-				router.GET("/Groups", SearchHandler(app.GroupQueryService(), app.Logger()))
-				router.POST("/Groups", CreateHandler(app.GroupCreateService(), app.Logger()))
-				router.PUT("/Groups/:id", ReplaceHandler(app.GroupReplaceService(), app.Logger()))
-				router.PATCH("/Groups/:id", PatchHandler(app.GroupPatchService(), app.Logger()))
-				router.DELETE("/Groups/:id", DeleteHandler(app.GroupDeleteService(), app.Logger()))
+			// callers are restricted to the attributes granted to the scopes carried by the header, if a policy is specified
+			if policy := app.AuthzPolicy(); policy != nil {
+				server = AccessFromHeader(app.args.scopesHeader, policy, server)
+			}
 
-				router.GET("/health", HealthHandler(app.MongoClient(), app.RabbitMQConnection()))
+			// resources are kept apart by the tenant carried by the header, if specified
+			if header := app.args.tenantHeader; len(header) > 0 {
+				server = TenantFromHeader(header, server)
 			}
 
+			mux := http.NewServeMux()
+			mux.Handle("/health", HealthHandler(app.MongoClient(), app.RabbitMQConnection()))
+			handlerutil.Mount(mux, "", server)
+
 			app.Logger().Info().Fields(map[string]interface{}{
 				"port": args.httpPort,
 			}).Msg("Listening for incoming requests.")
 
-			return http.ListenAndServe(fmt.Sprintf(":%d", args.httpPort), router)
+			return http.ListenAndServe(fmt.Sprintf(":%d", args.httpPort), mux)
 		},
 	}
 }
@@ -2,10 +2,16 @@ package api
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
 	"github.com/imulab/go-scim/cmd/internal/groupsync"
 	scimmongo "github.com/imulab/go-scim/mongo/v2"
+	"github.com/imulab/go-scim/pkg/v2/authz"
 	"github.com/imulab/go-scim/pkg/v2/crud"
 	"github.com/imulab/go-scim/pkg/v2/db"
+	"github.com/imulab/go-scim/pkg/v2/event"
+	scimgroupsync "github.com/imulab/go-scim/pkg/v2/groupsync"
+	"github.com/imulab/go-scim/pkg/v2/prop"
 	"github.com/imulab/go-scim/pkg/v2/service"
 	"github.com/imulab/go-scim/pkg/v2/service/filter"
 	"github.com/imulab/go-scim/pkg/v2/spec"
@@ -13,6 +19,11 @@ import (
 	"github.com/streadway/amqp"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
+	"io/ioutil"
+	"net/url"
+	"path/filepath"
+	"regexp"
+	"strings"
 	"sync"
 	"time"
 )
@@ -36,12 +47,35 @@ type applicationContext struct {
 	groupReplaceService       service.Replace
 	userPatchService          service.Patch
 	groupPatchService         service.Patch
+	groupMembershipService    service.Membership
 	userDeleteService         service.Delete
 	groupDeleteService        service.Delete
 	userGetService            service.Get
 	groupGetService           service.Get
 	userQueryService          service.Query
 	groupQueryService         service.Query
+	memberHydrator            *scimgroupsync.Hydrator
+	dynamicGroups             *scimgroupsync.Dynamic
+	groupMembersService       service.Members
+	userGroupsSyncService     *scimgroupsync.SyncService
+	idGenerator               filter.IDGenerator
+	authzPolicy               *authz.Policy
+	rootQueryService          service.Query
+	meService                 service.Me
+	historyDatabase           db.HistoryDB
+	historyService            service.History
+	operationDatabase         db.OperationDB
+	queue                     service.Queue
+	userAsyncService          service.Async
+	groupAsyncService         service.Async
+	operationService          service.OperationStatus
+	keyDatabase               db.KeyDB
+	bulkService               service.Bulk
+	eventOutbox               event.Outbox
+	snapshotDatabases         []db.SnapshotDB
+	snapshotDatabasesLock     sync.Mutex
+	snapshotCtx               context.Context
+	snapshotDone              context.CancelFunc
 }
 
 func (ctx *applicationContext) Logger() *zerolog.Logger {
@@ -124,16 +158,10 @@ func (ctx *applicationContext) MongoClient() *mongo.Client {
 
 func (ctx *applicationContext) UserDatabase() db.DB {
 	if ctx.userDatabase == nil {
+		ctx.userDatabase = ctx.database(ctx.UserResourceType())
 		if ctx.args.UseMemoryDB {
-			ctx.userDatabase = db.Memory()
 			ctx.logInitialized("in-memory user database")
 		} else {
-			ctx.ensureMongoMetadata()
-			resourceType := ctx.UserResourceType()
-			collection := ctx.MongoClient().
-				Database(ctx.args.MongoDB.Database, options.Database()).
-				Collection(resourceType.Name(), options.Collection())
-			ctx.userDatabase = scimmongo.DB(resourceType, collection, scimmongo.Options().IgnoreProjection())
 			ctx.logInitialized("mongo user database")
 		}
 	}
@@ -142,22 +170,76 @@ func (ctx *applicationContext) UserDatabase() db.DB {
 
 func (ctx *applicationContext) GroupDatabase() db.DB {
 	if ctx.groupDatabase == nil {
+		ctx.groupDatabase = ctx.database(ctx.GroupResourceType())
 		if ctx.args.UseMemoryDB {
-			ctx.groupDatabase = db.Memory()
 			ctx.logInitialized("in-memory group database")
 		} else {
-			ctx.ensureMongoMetadata()
-			resourceType := ctx.GroupResourceType()
-			collection := ctx.MongoClient().
-				Database(ctx.args.MongoDB.Database, options.Database()).
-				Collection(resourceType.Name(), options.Collection())
-			ctx.groupDatabase = scimmongo.DB(resourceType, collection, scimmongo.Options().IgnoreProjection())
 			ctx.logInitialized("mongo group database")
 		}
 	}
 	return ctx.groupDatabase
 }
 
+// database returns the database of the resource type, or, when tenant-header is specified, a database that keeps the
+// resources of every tenant in a database of its own.
+func (ctx *applicationContext) database(resourceType *spec.ResourceType) db.DB {
+	if len(ctx.args.tenantHeader) == 0 {
+		database, err := ctx.openDatabase(resourceType, "")
+		if err != nil {
+			ctx.logInitFailure(resourceType.Name()+" database", err)
+			panic(err)
+		}
+		return database
+	}
+	return db.TenantDB(func(_ context.Context, tenant string) (db.DB, error) {
+		return ctx.openDatabase(resourceType, tenant)
+	})
+}
+
+// openDatabase opens the database of the resource type, in memory, persisted in the directory or the mongo collection
+// named after the resource type, suffixed by the tenant if any.
+func (ctx *applicationContext) openDatabase(resourceType *spec.ResourceType, tenant string) (db.DB, error) {
+	name := resourceType.Name()
+	if len(tenant) > 0 {
+		name += "_" + tenant
+	}
+
+	if ctx.args.UseMemoryDB {
+		if len(ctx.args.MemoryDB.Dir) == 0 {
+			return db.Memory(), nil
+		}
+		return ctx.openPersistentMemory(resourceType, name)
+	}
+
+	ctx.ensureMongoMetadata()
+	collection := ctx.MongoClient().
+		Database(ctx.args.MongoDB.Database, options.Database()).
+		Collection(name, options.Collection())
+	return scimmongo.DB(resourceType, collection, scimmongo.Options().IgnoreProjection()), nil
+}
+
+// openPersistentMemory opens the in-memory database persisted in the directory of the name, under memory-dir, and takes
+// its snapshots in the background until the application is closed.
+func (ctx *applicationContext) openPersistentMemory(resourceType *spec.ResourceType, name string) (db.DB, error) {
+	// tenants are carried by a header, hence escaped so that they remain within memory-dir
+	dir := filepath.Join(ctx.args.MemoryDB.Dir, url.PathEscape(name))
+	database, err := db.PersistentMemory(resourceType, db.PersistenceOptions{Dir: dir, Sync: ctx.args.MemoryDB.Sync})
+	if err != nil {
+		return nil, err
+	}
+
+	ctx.snapshotDatabasesLock.Lock()
+	defer ctx.snapshotDatabasesLock.Unlock()
+	if ctx.snapshotCtx == nil {
+		ctx.snapshotCtx, ctx.snapshotDone = context.WithCancel(context.Background())
+	}
+	ctx.snapshotDatabases = append(ctx.snapshotDatabases, database.(db.SnapshotDB))
+	go db.SnapshotEvery(ctx.snapshotCtx, database, ctx.args.MemoryDB.SnapshotInterval, func(err error) {
+		ctx.Logger().Err(err).Str("dir", dir).Msg("failed to snapshot in-memory database")
+	})
+	return database, nil
+}
+
 func (ctx *applicationContext) ensureMongoMetadata() {
 	ctx.registerMongoMetadataOnce.Do(func() {
 		if err := ctx.args.MongoDB.RegisterMetadata(); err != nil {
@@ -168,17 +250,113 @@ func (ctx *applicationContext) ensureMongoMetadata() {
 	})
 }
 
+func (ctx *applicationContext) HistoryDatabase() db.HistoryDB {
+	if ctx.historyDatabase == nil {
+		ctx.historyDatabase = db.MemoryHistory()
+		ctx.logInitialized("in-memory history database")
+	}
+	return ctx.historyDatabase
+}
+
+func (ctx *applicationContext) EventOutbox() event.Outbox {
+	if ctx.eventOutbox == nil {
+		ctx.eventOutbox = event.MemoryOutbox()
+		ctx.logInitialized("in-memory event outbox")
+	}
+	return ctx.eventOutbox
+}
+
+// webhooks returns the webhooks notified of all the change events.
+func (ctx *applicationContext) webhooks() []*event.Webhook {
+	var webhooks []*event.Webhook
+	for _, url := range strings.Split(ctx.args.webhooks, ",") {
+		if url = strings.TrimSpace(url); len(url) > 0 {
+			webhooks = append(webhooks, &event.Webhook{URL: url, Secret: ctx.args.webhookSecret})
+		}
+	}
+	return webhooks
+}
+
+// RelayWebhooks relays the change events from the outbox to the webhooks every second, until the context is done.
+func (ctx *applicationContext) RelayWebhooks(done context.Context) {
+	sink := event.WebhookSink(ctx.webhooks(), event.WebhookOptions{
+		DeadLetter: func(_ context.Context, webhook *event.Webhook, e *event.Event, err error) {
+			ctx.Logger().
+				Err(err).
+				Fields(map[string]interface{}{"webhook": webhook.URL, "eventId": e.ID, "resourceId": e.ResourceID}).
+				Msg("failed to deliver event to webhook")
+		},
+	})
+	ctx.logInitialized("webhook relay")
+	event.RelayEvery(done, ctx.EventOutbox(), sink, time.Second, func(err error) {
+		ctx.Logger().Err(err).Msg("failed to relay events to webhooks")
+	})
+}
+
+// Interceptors returns the interceptor chain around the services that change Users and Groups.
+func (ctx *applicationContext) Interceptors() service.InterceptorChain {
+	var interceptors []service.Interceptor
+	if ctx.args.logPayloads {
+		interceptors = append(interceptors, ctx.loggingInterceptor())
+	}
+	if ctx.args.history {
+		interceptors = append(interceptors, service.HistoryInterceptor(ctx.HistoryDatabase(), service.SubjectResolverFunc(subjectFromContext)))
+	}
+	if len(ctx.webhooks()) > 0 {
+		interceptors = append(interceptors, service.EventInterceptor(ctx.EventOutbox()))
+	}
+	return service.Interceptors(interceptors...)
+}
+
+// loggingInterceptor returns the interceptor to log the calls to the services at debug level, and their failures at
+// warn level. The paths of redact-attributes are redacted from the payloads of Users, in addition to the attributes
+// that are never returned.
+func (ctx *applicationContext) loggingInterceptor() service.Interceptor {
+	var paths []string
+	for _, path := range strings.Split(ctx.args.redactAttrs, ",") {
+		if path = strings.TrimSpace(path); len(path) > 0 {
+			paths = append(paths, path)
+		}
+	}
+	redactor, err := service.NewRedactor(ctx.UserResourceType(), paths...)
+	if err != nil {
+		ctx.logInitFailure("logging interceptor", err)
+		panic(err)
+	}
+
+	return service.LoggingInterceptor(service.LoggerFunc(func(_ context.Context, entry *service.LogEntry) {
+		e := ctx.Logger().Debug()
+		if entry.Err != nil {
+			e = ctx.Logger().Warn().Err(entry.Err)
+		}
+		e = e.Fields(map[string]interface{}{
+			"stage":        entry.Stage,
+			"operation":    entry.Operation,
+			"resourceType": entry.ResourceType,
+			"id":           entry.ResourceID,
+		})
+		if entry.Stage == service.StageResponse {
+			e = e.Dur("duration", entry.Duration)
+		}
+		if len(entry.Payload) > 0 {
+			e = e.RawJSON("payload", entry.Payload)
+		}
+		e.Msg("service call")
+	}), redactor)
+}
+
 func (ctx *applicationContext) UserCreateService() service.Create {
 	if ctx.userCreateService == nil {
-		ctx.userCreateService = service.CreateService(ctx.UserResourceType(), ctx.UserDatabase(), []filter.ByResource{
-			filter.ByPropertyToByResource(
-				filter.ReadOnlyFilter(),
-				filter.UUIDFilter(),
-				filter.BCryptFilter(),
-			),
+		ctx.userCreateService = ctx.Interceptors().Create(ctx.UserResourceType(), service.CreateService(ctx.UserResourceType(), ctx.UserDatabase(), []filter.ByResource{
+			filter.UserGroupsFilter(ctx.UserGroupsSyncService()),
+			filter.ByPropertyToByResource(ctx.writeFilters(append(ctx.idFilters(ctx.UserDatabase(), ctx.args.userIDPrefix), ctx.passwordFilter())...)...),
+			ctx.quotaFilter(ctx.UserDatabase(), ctx.args.maxUsers),
 			filter.MetaFilter(),
-			filter.ByPropertyToByResource(filter.ValidationFilter(ctx.UserDatabase())),
-		})
+			ctx.validationFilter(ctx.UserDatabase()),
+		}))
+		if ctx.args.idempotency {
+			ctx.userCreateService = service.IdempotentCreateService(ctx.UserResourceType(), ctx.userCreateService, ctx.UserDatabase(), ctx.KeyDatabase())
+		}
 		ctx.logInitialized("user create service")
 	}
 	return ctx.userCreateService
@@ -187,19 +365,23 @@ func (ctx *applicationContext) UserCreateService() service.Create {
 func (ctx *applicationContext) GroupCreateService() service.Create {
 	if ctx.groupCreateService == nil {
 		ctx.groupCreateService = &groupCreated{
-			service: service.CreateService(ctx.GroupResourceType(), ctx.GroupDatabase(), []filter.ByResource{
-				filter.ByPropertyToByResource(
-					filter.ReadOnlyFilter(),
-					filter.UUIDFilter(),
-				),
+			service: ctx.Interceptors().Create(ctx.GroupResourceType(), service.CreateService(ctx.GroupResourceType(), ctx.GroupDatabase(), []filter.ByResource{
+				filter.ByPropertyToByResource(ctx.writeFilters(ctx.idFilters(ctx.GroupDatabase(), ctx.args.groupIDPrefix)...)...),
+				filter.DynamicGroupFilter(ctx.DynamicGroups()),
+				ctx.memberReferenceFilter(),
+				ctx.quotaFilter(ctx.GroupDatabase(), ctx.args.maxGroups),
+				filter.GroupCycleFilter(scimgroupsync.NewSyncService(ctx.GroupDatabase())),
 				filter.MetaFilter(),
-				filter.ByPropertyToByResource(filter.ValidationFilter(ctx.GroupDatabase())),
-			}),
+				ctx.validationFilter(ctx.GroupDatabase()),
+			})),
 			sender: &groupSyncSender{
 				channel: ctx.RabbitMQChannel(),
 				logger:  ctx.Logger(),
 			},
 		}
+		if ctx.args.idempotency {
+			ctx.groupCreateService = service.IdempotentCreateService(ctx.GroupResourceType(), ctx.groupCreateService, ctx.GroupDatabase(), ctx.KeyDatabase())
+		}
 		ctx.logInitialized("group create service")
 	}
 	return ctx.groupCreateService
@@ -207,14 +389,15 @@ func (ctx *applicationContext) GroupCreateService() service.Create {
 
 func (ctx *applicationContext) UserReplaceService() service.Replace {
 	if ctx.userReplaceService == nil {
-		ctx.userReplaceService = service.ReplaceService(ctx.ServiceProviderConfig(), ctx.UserResourceType(), ctx.UserDatabase(), []filter.ByResource{
-			filter.ByPropertyToByResource(
+		ctx.userReplaceService = ctx.Interceptors().Replace(ctx.UserResourceType(), service.ReplaceService(ctx.ServiceProviderConfig(), ctx.UserResourceType(), ctx.UserDatabase(), []filter.ByResource{
+			filter.UserGroupsFilter(ctx.UserGroupsSyncService()),
+			filter.ByPropertyToByResource(ctx.writeFilters(
 				filter.ReadOnlyFilter(),
-				filter.BCryptFilter(),
-			),
-			filter.ByPropertyToByResource(filter.ValidationFilter(ctx.UserDatabase())),
+				ctx.passwordFilter(),
+			)...),
+			ctx.validationFilter(ctx.UserDatabase()),
 			filter.MetaFilter(),
-		})
+		}))
 		ctx.logInitialized("user replace service")
 	}
 	return ctx.userReplaceService
@@ -223,13 +406,17 @@ func (ctx *applicationContext) UserReplaceService() service.Replace {
 func (ctx *applicationContext) GroupReplaceService() service.Replace {
 	if ctx.groupReplaceService == nil {
 		ctx.groupReplaceService = &groupReplaced{
-			service: service.ReplaceService(ctx.ServiceProviderConfig(), ctx.GroupResourceType(), ctx.GroupDatabase(), []filter.ByResource{
-				filter.ByPropertyToByResource(
+			service: ctx.Interceptors().Replace(ctx.GroupResourceType(), service.ReplaceService(ctx.ServiceProviderConfig(), ctx.GroupResourceType(), ctx.GroupDatabase(), []filter.ByResource{
+				filter.ByPropertyToByResource(ctx.writeFilters(
 					filter.ReadOnlyFilter(),
-				),
-				filter.ByPropertyToByResource(filter.ValidationFilter(ctx.UserDatabase())),
+				)...),
+				filter.DynamicGroupFilter(ctx.DynamicGroups()),
+				ctx.memberReferenceFilter(),
+				ctx.quotaFilter(ctx.GroupDatabase(), ctx.args.maxGroups),
+				ctx.validationFilter(ctx.UserDatabase()),
+				filter.GroupCycleFilter(scimgroupsync.NewSyncService(ctx.GroupDatabase())),
 				filter.MetaFilter(),
-			}),
+			})),
 			sender: &groupSyncSender{
 				channel: ctx.RabbitMQChannel(),
 				logger:  ctx.Logger(),
@@ -242,14 +429,15 @@ func (ctx *applicationContext) GroupReplaceService() service.Replace {
 
 func (ctx *applicationContext) UserPatchService() service.Patch {
 	if ctx.userPatchService == nil {
-		ctx.userPatchService = service.PatchService(ctx.ServiceProviderConfig(), ctx.UserDatabase(), []filter.ByResource{}, []filter.ByResource{
-			filter.ByPropertyToByResource(
+		ctx.userPatchService = ctx.Interceptors().Patch(ctx.UserResourceType(), ctx.retryOnConflict(service.PatchService(ctx.ServiceProviderConfig(), ctx.UserDatabase(), []filter.ByResource{}, []filter.ByResource{
+			filter.UserGroupsFilter(ctx.UserGroupsSyncService()),
+			filter.ByPropertyToByResource(ctx.writeFilters(
 				filter.ReadOnlyFilter(),
-				filter.BCryptFilter(),
-			),
-			filter.ByPropertyToByResource(filter.ValidationFilter(ctx.UserDatabase())),
+				ctx.passwordFilter(),
+			)...),
+			ctx.validationFilter(ctx.UserDatabase()),
 			filter.MetaFilter(),
-		})
+		})))
 		ctx.logInitialized("user patch service")
 	}
 	return ctx.userPatchService
@@ -258,13 +446,7 @@ func (ctx *applicationContext) UserPatchService() service.Patch {
 func (ctx *applicationContext) GroupPatchService() service.Patch {
 	if ctx.groupPatchService == nil {
 		ctx.groupPatchService = &groupPatched{
-			service: service.PatchService(ctx.ServiceProviderConfig(), ctx.GroupDatabase(), []filter.ByResource{}, []filter.ByResource{
-				filter.ByPropertyToByResource(
-					filter.ReadOnlyFilter(),
-				),
-				filter.ByPropertyToByResource(filter.ValidationFilter(ctx.GroupDatabase())),
-				filter.MetaFilter(),
-			}),
+			service: ctx.Interceptors().Patch(ctx.GroupResourceType(), ctx.retryOnConflict(service.PatchService(ctx.ServiceProviderConfig(), ctx.GroupDatabase(), []filter.ByResource{}, ctx.groupPatchFilters()))),
 			sender: &groupSyncSender{
 				channel: ctx.RabbitMQChannel(),
 				logger:  ctx.Logger(),
@@ -275,9 +457,44 @@ func (ctx *applicationContext) GroupPatchService() service.Patch {
 	return ctx.groupPatchService
 }
 
+// GroupMembershipService returns the service adding and removing members of groups in bulk, which are filtered like
+// patches of groups.
+func (ctx *applicationContext) GroupMembershipService() service.Membership {
+	if ctx.groupMembershipService == nil {
+		membership := service.MembershipService(ctx.ServiceProviderConfig(), ctx.GroupDatabase(), []filter.ByResource{}, ctx.groupPatchFilters())
+		if ctx.args.patchAttempts > 1 {
+			membership = service.RetryMembershipOnConflict(membership, service.ConflictRetry{Attempts: ctx.args.patchAttempts})
+		}
+		ctx.groupMembershipService = &groupMembershipChanged{
+			service: ctx.Interceptors().Membership(ctx.GroupResourceType(), membership),
+			sender: &groupSyncSender{
+				channel: ctx.RabbitMQChannel(),
+				logger:  ctx.Logger(),
+			},
+		}
+		ctx.logInitialized("group membership service")
+	}
+	return ctx.groupMembershipService
+}
+
+// groupPatchFilters returns the filters of patched groups, which run after the patch operations are applied.
+func (ctx *applicationContext) groupPatchFilters() []filter.ByResource {
+	return []filter.ByResource{
+		filter.ByPropertyToByResource(ctx.writeFilters(
+			filter.ReadOnlyFilter(),
+		)...),
+		filter.DynamicGroupFilter(ctx.DynamicGroups()),
+		ctx.memberReferenceFilter(),
+		ctx.quotaFilter(ctx.GroupDatabase(), ctx.args.maxGroups),
+		ctx.validationFilter(ctx.GroupDatabase()),
+		filter.GroupCycleFilter(scimgroupsync.NewSyncService(ctx.GroupDatabase())),
+		filter.MetaFilter(),
+	}
+}
+
 func (ctx *applicationContext) UserDeleteService() service.Delete {
 	if ctx.userDeleteService == nil {
-		ctx.userDeleteService = service.DeleteService(ctx.ServiceProviderConfig(), ctx.UserDatabase())
+		ctx.userDeleteService = ctx.cascade(ctx.Interceptors().Delete(ctx.UserResourceType(), service.DeleteService(ctx.ServiceProviderConfig(), ctx.UserDatabase())), ctx.args.cascadeManager)
 		ctx.logInitialized("user delete service")
 	}
 	return ctx.userDeleteService
@@ -286,7 +503,7 @@ func (ctx *applicationContext) UserDeleteService() service.Delete {
 func (ctx *applicationContext) GroupDeleteService() service.Delete {
 	if ctx.groupDeleteService == nil {
 		ctx.groupDeleteService = &groupDeleted{
-			service: service.DeleteService(ctx.ServiceProviderConfig(), ctx.GroupDatabase()),
+			service: ctx.cascade(ctx.Interceptors().Delete(ctx.GroupResourceType(), service.DeleteService(ctx.ServiceProviderConfig(), ctx.GroupDatabase())), false),
 			sender: &groupSyncSender{
 				channel: ctx.RabbitMQChannel(),
 				logger:  ctx.Logger(),
@@ -297,9 +514,216 @@ func (ctx *applicationContext) GroupDeleteService() service.Delete {
 	return ctx.groupDeleteService
 }
 
+// validationFilter returns the validation filter against the database, which also checks the unique-attributes paths
+// for uniqueness, and reports all violations at once when collect-violations is enabled.
+func (ctx *applicationContext) validationFilter(database db.DB) filter.ByResource {
+	var paths []string
+	for _, path := range strings.Split(ctx.args.uniqueAttrs, ",") {
+		if path = strings.TrimSpace(path); len(path) > 0 {
+			paths = append(paths, path)
+		}
+	}
+	if ctx.args.collectViolations {
+		return filter.ByPropertyToByResourceCollectingErrors(filter.ValidationFilterWithUniqueness(database, paths...))
+	}
+	return filter.ByPropertyToByResource(filter.ValidationFilterWithUniqueness(database, paths...))
+}
+
+// idFilters returns the filters to reset the readOnly attributes of created resources and generate their ids with the
+// id-generator, prefixed by prefix, or, with client-ids, to validate the ids supplied by clients and only generate the
+// missing ones.
+func (ctx *applicationContext) idFilters(database db.DB, prefix string) []filter.ByProperty {
+	generator := ctx.IDGenerator()
+	if len(prefix) > 0 {
+		generator = filter.PrefixedID(prefix, generator)
+	}
+	if !ctx.args.clientIDs {
+		return []filter.ByProperty{filter.ReadOnlyFilter(), filter.IDFilter(generator)}
+	}
+
+	var format *regexp.Regexp
+	if len(ctx.args.clientIDFormat) > 0 {
+		var err error
+		if format, err = regexp.Compile(ctx.args.clientIDFormat); err != nil {
+			ctx.logInitFailure("client id filter", err)
+			panic(err)
+		}
+	}
+	return []filter.ByProperty{
+		filter.ReadOnlyFilterRetainingClientID(),
+		filter.ClientIDFilter(database, format),
+		filter.IDFilter(generator),
+	}
+}
+
+// IDGenerator returns the generator of the ids of Users and Groups, according to id-generator.
+func (ctx *applicationContext) IDGenerator() filter.IDGenerator {
+	if ctx.idGenerator == nil {
+		switch ctx.args.idGenerator {
+		case "", "uuidv4":
+			ctx.idGenerator = filter.UUIDv4()
+		case "uuidv7":
+			ctx.idGenerator = filter.UUIDv7()
+		case "ulid":
+			ctx.idGenerator = filter.ULID()
+		case "snowflake":
+			var err error
+			if ctx.idGenerator, err = filter.Snowflake(int64(ctx.args.snowflakeNode)); err != nil {
+				ctx.logInitFailure("id generator", err)
+				panic(err)
+			}
+		default:
+			err := fmt.Errorf("invalid id-generator '%s'", ctx.args.idGenerator)
+			ctx.logInitFailure("id generator", err)
+			panic(err)
+		}
+		ctx.logInitialized("id generator")
+	}
+	return ctx.idGenerator
+}
+
+// retryOnConflict returns the patch service wrapped to retry patches of resources concurrently modified, up to
+// patch-attempts times.
+func (ctx *applicationContext) retryOnConflict(patch service.Patch) service.Patch {
+	if ctx.args.patchAttempts <= 1 {
+		return patch
+	}
+	return service.RetryPatchOnConflict(patch, service.ConflictRetry{Attempts: ctx.args.patchAttempts})
+}
+
+// memberReferenceFilter returns the filter to resolve the members added to groups against the users and groups they
+// refer to, rejecting those that refer to neither unless allow-unresolved-members is specified.
+func (ctx *applicationContext) memberReferenceFilter() filter.ByResource {
+	return filter.MemberReferenceFilter([]filter.ReferenceTarget{
+		{ResourceType: ctx.UserResourceType(), Database: ctx.UserDatabase()},
+		{ResourceType: ctx.GroupResourceType(), Database: ctx.GroupDatabase()},
+	}, ctx.args.allowUnresolved)
+}
+
+// quotaFilter returns the filter to enforce the quota of every tenant on the resources of the database: at most
+// maxResources of them, and max-members members of Groups.
+func (ctx *applicationContext) quotaFilter(database db.DB, maxResources int) filter.ByResource {
+	return filter.QuotaFilter(database, filter.StaticQuota(&filter.Quota{
+		MaxResources: maxResources,
+		MaxMembers:   ctx.args.maxMembers,
+	}))
+}
+
+// writeFilters returns the filters, preceded by the filter to reject, or with authz-strip revert, the modifications of
+// attributes the caller may not write when an authz-policy is specified.
+func (ctx *applicationContext) writeFilters(filters ...filter.ByProperty) []filter.ByProperty {
+	if ctx.AuthzPolicy() == nil {
+		return filters
+	}
+	return append([]filter.ByProperty{authz.WriteFilter(ctx.args.authzStrip)}, filters...)
+}
+
+// AuthzPolicy returns the policy of the attributes callers may read and write, parsed from the rules of the
+// authz-policy file, or nil if there is none.
+func (ctx *applicationContext) AuthzPolicy() *authz.Policy {
+	if ctx.authzPolicy == nil && len(ctx.args.authzPolicy) > 0 {
+		raw, err := ioutil.ReadFile(ctx.args.authzPolicy)
+		if err != nil {
+			ctx.logInitFailure("authz policy", err)
+			panic(err)
+		}
+		var rules []*authz.Rule
+		if err := json.Unmarshal(raw, &rules); err != nil {
+			ctx.logInitFailure("authz policy", err)
+			panic(err)
+		}
+		ctx.authzPolicy, err = authz.NewPolicy([]*spec.ResourceType{ctx.UserResourceType(), ctx.GroupResourceType()}, rules...)
+		if err != nil {
+			ctx.logInitFailure("authz policy", err)
+			panic(err)
+		}
+		ctx.logInitialized("authz policy")
+	}
+	return ctx.authzPolicy
+}
+
+// passwordFilter returns the filter to check User passwords against the password policy and hash them with the
+// password-hash algorithm. BCrypt hashes with the cost of the @BCrypt annotation of the password attribute, if set.
+func (ctx *applicationContext) passwordFilter() filter.ByProperty {
+	var hasher filter.PasswordHasher
+	switch ctx.args.passwordHash {
+	case "", "bcrypt":
+		hasher = filter.BCryptHasher(10)
+	case "argon2id":
+		hasher = filter.Argon2idHasher(1, 64*1024, 4, 32)
+	case "scrypt":
+		hasher = filter.ScryptHasher(1<<15, 8, 1, 32)
+	case "pbkdf2":
+		hasher = filter.PBKDF2Hasher(600000, 32)
+	default:
+		err := fmt.Errorf("invalid password-hash algorithm '%s'", ctx.args.passwordHash)
+		ctx.logInitFailure("password filter", err)
+		panic(err)
+	}
+	return filter.PasswordFilter(hasher, &filter.PasswordPolicy{MinLength: ctx.args.passwordMinLen})
+}
+
+// cascade returns the delete service wrapped to remove the deleted resource from group members, and optionally from
+// the manager of users, according to the cascade-delete policy.
+func (ctx *applicationContext) cascade(delete service.Delete, manager bool) service.Delete {
+	cascade := &service.Cascade{
+		Groups:       ctx.GroupDatabase(),
+		GroupFilters: []filter.ByResource{filter.MetaFilter()},
+	}
+	if manager {
+		cascade.Users = ctx.UserDatabase()
+		cascade.UserFilters = []filter.ByResource{filter.MetaFilter()}
+	}
+
+	switch ctx.args.cascadeDelete {
+	case "", "none":
+		return delete
+	case "sync":
+	case "async":
+		cascade.Queue = ctx.Queue()
+		cascade.OnError = func(_ context.Context, deleted *prop.Resource, err error) {
+			ctx.Logger().
+				Err(err).
+				Fields(map[string]interface{}{"resourceId": deleted.IdOrEmpty()}).
+				Msg("failed to remove references to deleted resource")
+		}
+	default:
+		err := fmt.Errorf("invalid cascade-delete policy '%s'", ctx.args.cascadeDelete)
+		ctx.logInitFailure("cascade delete", err)
+		panic(err)
+	}
+	return service.CascadeDeleteService(delete, cascade)
+}
+
+func (ctx *applicationContext) BulkService() service.Bulk {
+	if ctx.bulkService == nil {
+		ctx.bulkService = service.BulkService(ctx.ServiceProviderConfig(),
+			&service.BulkEndpoint{
+				ResourceType: ctx.UserResourceType(),
+				Create:       ctx.UserCreateService(),
+				Replace:      ctx.UserReplaceService(),
+				Patch:        ctx.UserPatchService(),
+				Delete:       ctx.UserDeleteService(),
+			},
+			&service.BulkEndpoint{
+				ResourceType: ctx.GroupResourceType(),
+				Create:       ctx.GroupCreateService(),
+				Replace:      ctx.GroupReplaceService(),
+				Patch:        ctx.GroupPatchService(),
+				Delete:       ctx.GroupDeleteService(),
+			},
+		)
+		ctx.logInitialized("bulk service")
+	}
+	return ctx.bulkService
+}
+
 func (ctx *applicationContext) UserGetService() service.Get {
 	if ctx.userGetService == nil {
 		ctx.userGetService = service.GetService(ctx.UserDatabase())
+		if ctx.args.computeGroups {
+			ctx.userGetService = &userGroupsComputed{service: ctx.userGetService, groups: ctx.UserGroupsSyncService()}
+		}
 		ctx.logInitialized("user get service")
 	}
 	return ctx.userGetService
@@ -308,14 +732,98 @@ func (ctx *applicationContext) UserGetService() service.Get {
 func (ctx *applicationContext) GroupGetService() service.Get {
 	if ctx.groupGetService == nil {
 		ctx.groupGetService = service.GetService(ctx.GroupDatabase())
+		if ctx.computesDynamicGroups() {
+			ctx.groupGetService = &groupDynamic{service: ctx.groupGetService, dynamic: ctx.DynamicGroups()}
+		}
+		if ctx.args.hydrateMembers {
+			ctx.groupGetService = &groupHydrated{service: ctx.groupGetService, hydrator: ctx.MemberHydrator()}
+		}
 		ctx.logInitialized("group get service")
 	}
 	return ctx.groupGetService
 }
 
+// GroupMembersService returns the service paging through the members of groups.
+func (ctx *applicationContext) GroupMembersService() service.Members {
+	if ctx.groupMembersService == nil {
+		ctx.groupMembersService = service.MembersService(ctx.ServiceProviderConfig(), ctx.GroupDatabase())
+		ctx.logInitialized("group members service")
+	}
+	return ctx.groupMembersService
+}
+
+// MemberHydrator returns the hydrator of the members of groups, which looks members up in the user and group
+// databases.
+func (ctx *applicationContext) MemberHydrator() *scimgroupsync.Hydrator {
+	if ctx.memberHydrator == nil {
+		ctx.memberHydrator = scimgroupsync.NewHydrator(ctx.UserDatabase(), ctx.GroupDatabase())
+		ctx.logInitialized("member hydrator")
+	}
+	return ctx.memberHydrator
+}
+
+// DynamicGroups returns the evaluator of the members of dynamic groups, which are materialized as the groups are
+// written, and, with dynamic-groups, updated as users change.
+func (ctx *applicationContext) DynamicGroups() *scimgroupsync.Dynamic {
+	if ctx.dynamicGroups == nil {
+		ctx.dynamicGroups = scimgroupsync.NewDynamic(ctx.UserResourceType(), ctx.UserDatabase(), ctx.GroupDatabase(), scimgroupsync.DynamicOptions{
+			Filters: []scimgroupsync.RefFilter{filter.MetaFilter()},
+			Publisher: &groupSyncSender{
+				channel: ctx.RabbitMQChannel(),
+				logger:  ctx.Logger(),
+			},
+		})
+		ctx.logInitialized("dynamic groups")
+	}
+	return ctx.dynamicGroups
+}
+
+// MaintainDynamicGroups updates the members of dynamic groups as the users change, from the change stream of the user
+// database, until the context is done. It returns at once if the database has no change stream, in which case the
+// members are computed as the groups are returned instead.
+func (ctx *applicationContext) MaintainDynamicGroups(done context.Context) {
+	if ctx.computesDynamicGroups() {
+		ctx.Logger().Warn().Msg("user database has no change stream, members of dynamic groups are computed as they are returned")
+		return
+	}
+	err := db.Subscribe(done, ctx.UserDatabase(), func(c context.Context, change *db.Change) error {
+		// a change failing to apply shall not stop the changes that follow
+		if err := ctx.DynamicGroups().Apply(c, change); err != nil {
+			ctx.Logger().Err(err).Fields(map[string]interface{}{"userId": change.ID}).Msg("failed to update the members of dynamic groups")
+		}
+		return nil
+	})
+	if err != nil && done.Err() == nil {
+		ctx.Logger().Err(err).Msg("stopped updating the members of dynamic groups")
+	}
+}
+
+// computesDynamicGroups returns true if the members of dynamic groups have to be computed as they are returned, as
+// the changes of the users are not streamed.
+func (ctx *applicationContext) computesDynamicGroups() bool {
+	if !ctx.args.dynamicGroups {
+		return false
+	}
+	_, ok := ctx.UserDatabase().(db.ChangeStreamDB)
+	return !ok
+}
+
+// UserGroupsSyncService returns the sync service computing the groups of users from the members of the groups, as
+// users are written, and returned with compute-groups.
+func (ctx *applicationContext) UserGroupsSyncService() *scimgroupsync.SyncService {
+	if ctx.userGroupsSyncService == nil {
+		ctx.userGroupsSyncService = scimgroupsync.NewSyncService(ctx.GroupDatabase())
+		ctx.logInitialized("user groups sync service")
+	}
+	return ctx.userGroupsSyncService
+}
+
 func (ctx *applicationContext) UserQueryService() service.Query {
 	if ctx.userQueryService == nil {
-		ctx.userQueryService = service.QueryService(ctx.ServiceProviderConfig(), ctx.UserDatabase())
+		ctx.userQueryService = service.QueryServiceWithGuard(ctx.ServiceProviderConfig(), ctx.UserDatabase(), authz.QueryGuard(ctx.UserResourceType()))
+		if ctx.args.computeGroups {
+			ctx.userQueryService = &usersGroupsComputed{service: ctx.userQueryService, groups: ctx.UserGroupsSyncService()}
+		}
 		ctx.logInitialized("user query service")
 	}
 	return ctx.userQueryService
@@ -323,12 +831,107 @@ func (ctx *applicationContext) UserQueryService() service.Query {
 
 func (ctx *applicationContext) GroupQueryService() service.Query {
 	if ctx.groupQueryService == nil {
-		ctx.groupQueryService = service.QueryService(ctx.ServiceProviderConfig(), ctx.GroupDatabase())
+		ctx.groupQueryService = service.QueryServiceWithGuard(ctx.ServiceProviderConfig(), ctx.GroupDatabase(), authz.QueryGuard(ctx.GroupResourceType()))
+		if ctx.computesDynamicGroups() {
+			ctx.groupQueryService = &groupsDynamic{service: ctx.groupQueryService, dynamic: ctx.DynamicGroups()}
+		}
+		if ctx.args.hydrateMembers {
+			ctx.groupQueryService = &groupsHydrated{service: ctx.groupQueryService, hydrator: ctx.MemberHydrator()}
+		}
 		ctx.logInitialized("group query service")
 	}
 	return ctx.groupQueryService
 }
 
+func (ctx *applicationContext) RootQueryService() service.Query {
+	if ctx.rootQueryService == nil {
+		ctx.rootQueryService = service.RootQueryService(ctx.ServiceProviderConfig(), ctx.UserQueryService(), ctx.GroupQueryService())
+		ctx.logInitialized("root query service")
+	}
+	return ctx.rootQueryService
+}
+
+func (ctx *applicationContext) MeService() service.Me {
+	if ctx.meService == nil {
+		ctx.meService = service.MeService(
+			service.SubjectResolverFunc(subjectFromContext),
+			ctx.UserGetService(),
+			ctx.UserReplaceService(),
+			ctx.UserPatchService(),
+		)
+		ctx.logInitialized("me service")
+	}
+	return ctx.meService
+}
+
+func (ctx *applicationContext) HistoryService() service.History {
+	if ctx.historyService == nil {
+		ctx.historyService = service.HistoryService(ctx.HistoryDatabase())
+		ctx.logInitialized("history service")
+	}
+	return ctx.historyService
+}
+
+func (ctx *applicationContext) OperationDatabase() db.OperationDB {
+	if ctx.operationDatabase == nil {
+		ctx.operationDatabase = db.MemoryOperations()
+		ctx.logInitialized("in-memory operation database")
+	}
+	return ctx.operationDatabase
+}
+
+func (ctx *applicationContext) Queue() service.Queue {
+	if ctx.queue == nil {
+		ctx.queue = service.WorkerQueue(8, 1024)
+		ctx.logInitialized("in-memory job queue")
+	}
+	return ctx.queue
+}
+
+func (ctx *applicationContext) UserAsyncService() service.Async {
+	if ctx.userAsyncService == nil {
+		ctx.userAsyncService = service.AsyncService(ctx.UserResourceType(),
+			ctx.UserCreateService(),
+			ctx.UserReplaceService(),
+			ctx.UserDeleteService(),
+			ctx.OperationDatabase(),
+			ctx.Queue(),
+		)
+		ctx.logInitialized("user async service")
+	}
+	return ctx.userAsyncService
+}
+
+func (ctx *applicationContext) GroupAsyncService() service.Async {
+	if ctx.groupAsyncService == nil {
+		ctx.groupAsyncService = service.AsyncService(ctx.GroupResourceType(),
+			ctx.GroupCreateService(),
+			ctx.GroupReplaceService(),
+			ctx.GroupDeleteService(),
+			ctx.OperationDatabase(),
+			ctx.Queue(),
+		)
+		ctx.logInitialized("group async service")
+	}
+	return ctx.groupAsyncService
+}
+
+func (ctx *applicationContext) OperationService() service.OperationStatus {
+	if ctx.operationService == nil {
+		ctx.operationService = service.OperationService(ctx.OperationDatabase())
+		ctx.logInitialized("operation service")
+	}
+	return ctx.operationService
+}
+
+func (ctx *applicationContext) KeyDatabase() db.KeyDB {
+	if ctx.keyDatabase == nil {
+		ctx.keyDatabase = db.MemoryKeys(24 * time.Hour)
+		ctx.logInitialized("in-memory idempotency key database")
+	}
+	return ctx.keyDatabase
+}
+
 func (ctx *applicationContext) RabbitMQConnection() *amqp.Connection {
 	if ctx.rabbitMqConn == nil {
 		connectCtx, cancelFunc := context.WithTimeout(context.Background(), 30*time.Second)
@@ -369,6 +972,19 @@ func (ctx *applicationContext) Close() {
 	if ctx.rabbitMqChannel != nil {
 		_ = ctx.rabbitMqChannel.Close()
 	}
+
+	// a last snapshot, so that the logs are empty upon restart
+	ctx.snapshotDatabasesLock.Lock()
+	defer ctx.snapshotDatabasesLock.Unlock()
+	if ctx.snapshotDone != nil {
+		ctx.snapshotDone()
+	}
+	for _, database := range ctx.snapshotDatabases {
+		if err := database.Snapshot(context.Background()); err != nil {
+			ctx.Logger().Err(err).Msg("failed to snapshot in-memory database")
+		}
+		_ = database.Close()
+	}
 }
 
 func (ctx *applicationContext) logInitialized(resourceName string) {
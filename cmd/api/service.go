@@ -4,9 +4,11 @@ import (
 	"context"
 	"encoding/json"
 	job "github.com/imulab/go-scim/cmd/internal/groupsync"
+	"github.com/imulab/go-scim/pkg/v2/crud"
 	"github.com/imulab/go-scim/pkg/v2/groupsync"
 	"github.com/imulab/go-scim/pkg/v2/prop"
 	"github.com/imulab/go-scim/pkg/v2/service"
+	"github.com/imulab/go-scim/pkg/v2/tenant"
 	"github.com/rs/zerolog"
 	uuid "github.com/satori/go.uuid"
 	"github.com/streadway/amqp"
@@ -21,15 +23,154 @@ type groupCreated struct {
 }
 
 func (s *groupCreated) Do(ctx context.Context, req *service.CreateRequest) (resp *service.CreateResponse, err error) {
+	resp, err = s.service.Do(ctx, req)
+	if err != nil || resp.DryRun {
+		return
+	}
+
+	s.sender.Send(ctx, resp.Resource, groupsync.Compare(nil, resp.Resource))
+	return
+}
+
+// groupHydrated is a wrapper implementation of service.Get that fills in the display and $ref of the members of the
+// group from the member resources.
+type groupHydrated struct {
+	service  service.Get
+	hydrator *groupsync.Hydrator
+}
+
+func (s *groupHydrated) Do(ctx context.Context, req *service.GetRequest) (resp *service.GetResponse, err error) {
+	resp, err = s.service.Do(ctx, req)
+	if err != nil {
+		return
+	}
+
+	err = s.hydrator.Hydrate(ctx, resp.Resource)
+	return
+}
+
+// groupsHydrated is a wrapper implementation of service.Query that fills in the display and $ref of the members of
+// the groups from the member resources, looking up the members of all the groups at once.
+type groupsHydrated struct {
+	service  service.Query
+	hydrator *groupsync.Hydrator
+}
+
+func (s *groupsHydrated) Do(ctx context.Context, req *service.QueryRequest) (resp *service.QueryResponse, err error) {
+	resp, err = s.service.Do(ctx, req)
+	if err != nil {
+		return
+	}
+
+	groups := make([]*prop.Resource, 0, len(resp.Resources))
+	for _, each := range resp.Resources {
+		if group, ok := each.(*prop.Resource); ok {
+			groups = append(groups, group)
+		}
+	}
+	err = s.hydrator.Hydrate(ctx, groups...)
+	return
+}
+
+// groupDynamic is a wrapper implementation of service.Get that computes the members of the group, if dynamic, from
+// the users matching its filter, unless left out by the projection. Groups whose filter is left out by the projection
+// are returned with the members last materialized.
+type groupDynamic struct {
+	service service.Get
+	dynamic *groupsync.Dynamic
+}
+
+func (s *groupDynamic) Do(ctx context.Context, req *service.GetRequest) (resp *service.GetResponse, err error) {
+	resp, err = s.service.Do(ctx, req)
+	if err != nil || !loadsMembers(req.Projection, resp.Resource) {
+		return
+	}
+
+	err = s.dynamic.Compute(ctx, resp.Resource)
+	return
+}
+
+// groupsDynamic is a wrapper implementation of service.Query that computes the members of the dynamic groups from the
+// users matching their filters, unless left out by the projection.
+type groupsDynamic struct {
+	service service.Query
+	dynamic *groupsync.Dynamic
+}
+
+func (s *groupsDynamic) Do(ctx context.Context, req *service.QueryRequest) (resp *service.QueryResponse, err error) {
 	resp, err = s.service.Do(ctx, req)
 	if err != nil {
 		return
 	}
 
-	s.sender.Send(resp.Resource, groupsync.Compare(nil, resp.Resource))
+	groups := make([]*prop.Resource, 0, len(resp.Resources))
+	for _, each := range resp.Resources {
+		if group, ok := each.(*prop.Resource); ok && loadsMembers(req.Projection, group) {
+			groups = append(groups, group)
+		}
+	}
+	err = s.dynamic.Compute(ctx, groups...)
+	return
+}
+
+// userGroupsComputed is a wrapper implementation of service.Get that computes the groups of the user from the members
+// of the groups, unless left out by the projection.
+type userGroupsComputed struct {
+	service service.Get
+	groups  *groupsync.SyncService
+}
+
+func (s *userGroupsComputed) Do(ctx context.Context, req *service.GetRequest) (resp *service.GetResponse, err error) {
+	resp, err = s.service.Do(ctx, req)
+	if err != nil || !loadsGroups(req.Projection, resp.Resource) {
+		return
+	}
+
+	err = s.groups.SyncGroupPropertyForUser(ctx, resp.Resource)
 	return
 }
 
+// usersGroupsComputed is a wrapper implementation of service.Query that computes the groups of the users from the
+// members of the groups, unless left out by the projection.
+type usersGroupsComputed struct {
+	service service.Query
+	groups  *groupsync.SyncService
+}
+
+func (s *usersGroupsComputed) Do(ctx context.Context, req *service.QueryRequest) (resp *service.QueryResponse, err error) {
+	resp, err = s.service.Do(ctx, req)
+	if err != nil {
+		return
+	}
+
+	users := make([]*prop.Resource, 0, len(resp.Resources))
+	for _, each := range resp.Resources {
+		if user, ok := each.(*prop.Resource); ok && loadsGroups(req.Projection, user) {
+			users = append(users, user)
+		}
+	}
+	err = s.groups.SyncGroupPropertyForUsers(ctx, users...)
+	return
+}
+
+// loadsGroups returns true if the projection loads the groups of the user.
+func loadsGroups(projection *crud.Projection, user *prop.Resource) bool {
+	nav := user.Navigator().Dot("groups")
+	if nav.HasError() {
+		return false
+	}
+	return projection.Loads(nav.Current().Attribute(), user.ResourceType())
+}
+
+// loadsMembers returns true if the projection loads the members of the group.
+func loadsMembers(projection *crud.Projection, group *prop.Resource) bool {
+	nav := group.Navigator().Dot("members")
+	if nav.HasError() {
+		return false
+	}
+	return projection.Loads(nav.Current().Attribute(), group.ResourceType())
+}
+
 // groupReplaced is a wrapper implementation of service.Replace that computes the members joined and members left the
 // group and submit group property sync jobs for them.
 type groupReplaced struct {
@@ -39,11 +180,11 @@ type groupReplaced struct {
 
 func (s *groupReplaced) Do(ctx context.Context, req *service.ReplaceRequest) (resp *service.ReplaceResponse, err error) {
 	resp, err = s.service.Do(ctx, req)
-	if err != nil || !resp.Replaced {
+	if err != nil || !resp.Replaced || resp.DryRun {
 		return
 	}
 
-	s.sender.Send(resp.Resource, groupsync.Compare(resp.Ref, resp.Resource))
+	s.sender.Send(ctx, resp.Resource, groupsync.Compare(resp.Ref, resp.Resource))
 	return
 }
 
@@ -56,11 +197,28 @@ type groupPatched struct {
 
 func (s *groupPatched) Do(ctx context.Context, req *service.PatchRequest) (resp *service.PatchResponse, err error) {
 	resp, err = s.service.Do(ctx, req)
-	if err != nil || !resp.Patched {
+	if err != nil || !resp.Patched || resp.DryRun {
 		return
 	}
 
-	s.sender.Send(resp.Resource, groupsync.Compare(resp.Ref, resp.Resource))
+	s.sender.Send(ctx, resp.Resource, groupsync.Compare(resp.Ref, resp.Resource))
+	return
+}
+
+// groupMembershipChanged is a wrapper implementation of service.Membership that computes the members joined and members
+// left the group and submit a single group property sync job for all of them.
+type groupMembershipChanged struct {
+	service service.Membership
+	sender  *groupSyncSender
+}
+
+func (s *groupMembershipChanged) Do(ctx context.Context, req *service.MembershipRequest) (resp *service.PatchResponse, err error) {
+	resp, err = s.service.Do(ctx, req)
+	if err != nil || !resp.Patched || resp.DryRun {
+		return
+	}
+
+	s.sender.Send(ctx, resp.Resource, groupsync.Compare(resp.Ref, resp.Resource))
 	return
 }
 
@@ -77,7 +235,7 @@ func (s *groupDeleted) Do(ctx context.Context, req *service.DeleteRequest) (resp
 		return
 	}
 
-	s.sender.Send(resp.Deleted, groupsync.Compare(resp.Deleted, nil))
+	s.sender.Send(ctx, resp.Deleted, groupsync.Compare(resp.Deleted, nil))
 	return
 }
 
@@ -88,7 +246,7 @@ type groupSyncSender struct {
 	logger  *zerolog.Logger
 }
 
-func (s *groupSyncSender) Send(group *prop.Resource, diff *groupsync.Diff) {
+func (s *groupSyncSender) Send(ctx context.Context, group *prop.Resource, diff *groupsync.Diff) {
 	if diff.CountLeft()+diff.CountJoined() == 0 {
 		return
 	}
@@ -99,19 +257,27 @@ func (s *groupSyncSender) Send(group *prop.Resource, diff *groupsync.Diff) {
 		"groupId":   group.IdOrEmpty(),
 	}).Msg("Sending group sync messages.")
 
-	go func(messageId string, diff *groupsync.Diff) {
+	go func(messageId string, tenantId string, diff *groupsync.Diff) {
 		diff.ForEachLeft(func(id string) {
-			s.submitMessage(messageId, group, id)
+			s.submitMessage(messageId, tenantId, group.IdOrEmpty(), id)
 		})
 		diff.ForEachJoined(func(id string) {
-			s.submitMessage(messageId, group, id)
+			s.submitMessage(messageId, tenantId, group.IdOrEmpty(), id)
 		})
-	}(messageId, diff)
+	}(messageId, tenant.From(ctx), diff)
+}
+
+// Publish sends the group sync message, so that the members of dynamic groups updated as users change are synchronized
+// likewise (see groupsync.Dynamic).
+func (s *groupSyncSender) Publish(_ context.Context, message *groupsync.Message) error {
+	s.submitMessage(message.ID, message.Tenant, message.GroupID, message.MemberID)
+	return nil
 }
 
-func (s *groupSyncSender) submitMessage(messageId string, group *prop.Resource, memberId string) {
+func (s *groupSyncSender) submitMessage(messageId string, tenantId string, groupId string, memberId string) {
 	msg := job.Message{
-		GroupID:  group.IdOrEmpty(),
+		Tenant:   tenantId,
+		GroupID:  groupId,
 		MemberID: memberId,
 		Trial:    1,
 	}
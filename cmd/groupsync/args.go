@@ -2,6 +2,7 @@ package groupsync
 
 import (
 	"github.com/imulab/go-scim/cmd/internal/args"
+	"github.com/imulab/go-scim/pkg/v2/groupsync"
 	"github.com/urfave/cli/v2"
 )
 
@@ -22,6 +23,8 @@ type arguments struct {
 	*args.RabbitMQ
 	*args.Logging
 	requeueLimit int
+	maxDepth     int
+	tenants      bool
 }
 
 func (arg *arguments) Flags() []cli.Flag {
@@ -32,6 +35,19 @@ func (arg *arguments) Flags() []cli.Flag {
 			EnvVars:     []string{"REQUEUE_LIMIT"},
 			Destination: &arg.requeueLimit,
 		},
+		&cli.IntFlag{
+			Name:        "max-depth",
+			Usage:       "Maximum depth of the nested groups included in the groups of users, as indirect memberships (1 for direct memberships only)",
+			EnvVars:     []string{"MAX_DEPTH"},
+			Value:       groupsync.DefaultMaxDepth,
+			Destination: &arg.maxDepth,
+		},
+		&cli.BoolFlag{
+			Name:        "tenants",
+			Usage:       "Apply the messages of every tenant to the Users and Groups of the tenant, as kept by the api with tenant-header, in memory or in mongo collections suffixed by the tenant",
+			EnvVars:     []string{"TENANTS"},
+			Destination: &arg.tenants,
+		},
 	}
 	flags = append(flags, arg.Scim.Flags()...)
 	flags = append(flags, arg.MemoryDB.Flags()...)
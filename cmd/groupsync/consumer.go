@@ -8,6 +8,7 @@ import (
 	"github.com/imulab/go-scim/pkg/v2/groupsync"
 	"github.com/imulab/go-scim/pkg/v2/prop"
 	"github.com/imulab/go-scim/pkg/v2/service/filter"
+	"github.com/imulab/go-scim/pkg/v2/tenant"
 	"github.com/rs/zerolog"
 	uuid "github.com/satori/go.uuid"
 	"github.com/streadway/amqp"
@@ -79,7 +80,12 @@ func (c *consumer) handle(message amqp.Delivery) {
 		return
 	}
 
-	isUser, err := c.assumeMemberIsUser(payload)
+	ctx := context.Background()
+	if len(payload.Tenant) > 0 {
+		ctx = tenant.With(ctx, payload.Tenant)
+	}
+
+	isUser, err := c.assumeMemberIsUser(ctx, payload)
 	if isUser {
 		if err != nil {
 			c.logger.Error().
@@ -102,7 +108,7 @@ func (c *consumer) handle(message amqp.Delivery) {
 		Fields(map[string]interface{}{"messageId": message.MessageId}).
 		Msg("member is not user, trying group")
 
-	isGroup, err := c.assumeMemberIsGroup(payload)
+	isGroup, err := c.assumeMemberIsGroup(ctx, payload)
 	if isGroup {
 		if err != nil {
 			c.logger.Error().
@@ -126,8 +132,8 @@ func (c *consumer) handle(message amqp.Delivery) {
 		Msg("member (possibly deleted) is neither user nor group, dropping message")
 }
 
-func (c *consumer) assumeMemberIsUser(payload *job.Message) (isUser bool, err error) {
-	user, lookupErr := c.userDatabase.Get(context.Background(), payload.MemberID, nil)
+func (c *consumer) assumeMemberIsUser(ctx context.Context, payload *job.Message) (isUser bool, err error) {
+	user, lookupErr := c.userDatabase.Get(ctx, payload.MemberID, nil)
 	if lookupErr != nil || user == nil {
 		return
 	}
@@ -135,17 +141,17 @@ func (c *consumer) assumeMemberIsUser(payload *job.Message) (isUser bool, err er
 	isUser = true
 	ref := user.Clone()
 
-	err = c.userSyncService.SyncGroupPropertyForUser(context.Background(), user)
+	err = c.userSyncService.SyncGroupPropertyForUser(ctx, user)
 	if err != nil {
 		return
 	}
 
 	if user.Hash() != ref.Hash() {
-		err = c.metaFilter.FilterRef(context.Background(), user, ref)
+		err = c.metaFilter.FilterRef(ctx, user, ref)
 		if err != nil {
 			return
 		}
-		err = c.userDatabase.Replace(context.Background(), ref, user)
+		err = c.userDatabase.Replace(ctx, ref, user)
 		if err != nil {
 			return
 		}
@@ -154,8 +160,8 @@ func (c *consumer) assumeMemberIsUser(payload *job.Message) (isUser bool, err er
 	return
 }
 
-func (c *consumer) assumeMemberIsGroup(payload *job.Message) (isGroup bool, err error) {
-	group, lookupErr := c.groupDatabase.Get(context.Background(), payload.MemberID, nil)
+func (c *consumer) assumeMemberIsGroup(ctx context.Context, payload *job.Message) (isGroup bool, err error) {
+	group, lookupErr := c.groupDatabase.Get(ctx, payload.MemberID, nil)
 	if lookupErr != nil || group == nil {
 		return
 	}
@@ -172,6 +178,7 @@ func (c *consumer) assumeMemberIsGroup(payload *job.Message) (isGroup bool, err
 			return err
 		} else {
 			c.send(&job.Message{
+				Tenant:   payload.Tenant,
 				GroupID:  payload.GroupID,
 				MemberID: value.Raw().(string),
 				Trial:    1,
@@ -111,16 +111,10 @@ func (ctx *applicationContext) MongoClient() *mongo.Client {
 
 func (ctx *applicationContext) UserDatabase() db.DB {
 	if ctx.userDatabase == nil {
+		ctx.userDatabase = ctx.database(ctx.UserResourceType())
 		if ctx.args.UseMemoryDB {
-			ctx.userDatabase = db.Memory()
 			ctx.logInitialized("in-memory user database")
 		} else {
-			ctx.ensureMongoMetadata()
-			resourceType := ctx.UserResourceType()
-			collection := ctx.MongoClient().
-				Database(ctx.args.MongoDB.Database, options.Database()).
-				Collection(resourceType.Name(), options.Collection())
-			ctx.userDatabase = scimmongo.DB(resourceType, collection, scimmongo.Options().IgnoreProjection())
 			ctx.logInitialized("mongo user database")
 		}
 	}
@@ -129,22 +123,45 @@ func (ctx *applicationContext) UserDatabase() db.DB {
 
 func (ctx *applicationContext) GroupDatabase() db.DB {
 	if ctx.groupDatabase == nil {
+		ctx.groupDatabase = ctx.database(ctx.GroupResourceType())
 		if ctx.args.UseMemoryDB {
-			ctx.groupDatabase = db.Memory()
 			ctx.logInitialized("in-memory group database")
 		} else {
-			ctx.ensureMongoMetadata()
-			resourceType := ctx.GroupResourceType()
-			collection := ctx.MongoClient().
-				Database(ctx.args.MongoDB.Database, options.Database()).
-				Collection(resourceType.Name(), options.Collection())
-			ctx.groupDatabase = scimmongo.DB(resourceType, collection, scimmongo.Options().IgnoreProjection())
 			ctx.logInitialized("mongo group database")
 		}
 	}
 	return ctx.groupDatabase
 }
 
+// database returns the database of the resource type, or, when tenants is specified, a database that selects the
+// database of the tenant of the message, as the api does with tenant-header.
+func (ctx *applicationContext) database(resourceType *spec.ResourceType) db.DB {
+	if !ctx.args.tenants {
+		return ctx.openDatabase(resourceType, "")
+	}
+	return db.TenantDB(func(_ context.Context, tenant string) (db.DB, error) {
+		return ctx.openDatabase(resourceType, tenant), nil
+	})
+}
+
+// openDatabase opens the database of the resource type, in memory or the mongo collection named after the resource
+// type, suffixed by the tenant if any.
+func (ctx *applicationContext) openDatabase(resourceType *spec.ResourceType, tenant string) db.DB {
+	if ctx.args.UseMemoryDB {
+		return db.Memory()
+	}
+
+	name := resourceType.Name()
+	if len(tenant) > 0 {
+		name += "_" + tenant
+	}
+	ctx.ensureMongoMetadata()
+	collection := ctx.MongoClient().
+		Database(ctx.args.MongoDB.Database, options.Database()).
+		Collection(name, options.Collection())
+	return scimmongo.DB(resourceType, collection, scimmongo.Options().IgnoreProjection())
+}
+
 func (ctx *applicationContext) ensureMongoMetadata() {
 	ctx.registerMongoMetadataOnce.Do(func() {
 		if err := ctx.args.MongoDB.RegisterMetadata(); err != nil {
@@ -190,7 +207,12 @@ func (ctx *applicationContext) RabbitMQChannel() *amqp.Channel {
 
 func (ctx *applicationContext) UserSyncService() *groupsync.SyncService {
 	if ctx.userSyncService == nil {
-		ctx.userSyncService = groupsync.NewSyncService(ctx.GroupDatabase())
+		ctx.userSyncService = groupsync.NewSyncServiceWithOptions(ctx.GroupDatabase(), groupsync.SyncOptions{
+			MaxDepth: ctx.args.maxDepth,
+			OnCycle: func(cycle []string) {
+				ctx.Logger().Warn().Strs("cycle", cycle).Msg("groups are members of themselves")
+			},
+		})
 		ctx.logInitialized("user sync service")
 	}
 	return ctx.userSyncService
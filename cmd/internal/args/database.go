@@ -11,11 +11,15 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 )
 
 // MemoryDB is the configuration options related to a in-memory db.DB implementation.
 type MemoryDB struct {
-	UseMemoryDB bool
+	UseMemoryDB      bool
+	Dir              string
+	SnapshotInterval time.Duration
+	Sync             bool
 }
 
 func (arg *MemoryDB) Flags() []cli.Flag {
@@ -26,6 +30,26 @@ func (arg *MemoryDB) Flags() []cli.Flag {
 			Value:       false,
 			Destination: &arg.UseMemoryDB,
 		},
+		&cli.StringFlag{
+			Name:        "memory-dir",
+			Usage:       "Directory where the in-memory databases persist their resources, as snapshots and logs of writes, so that they are restored upon restart. If empty, resources are lost upon restart",
+			EnvVars:     []string{"MEMORY_DIR"},
+			Destination: &arg.Dir,
+		},
+		&cli.DurationFlag{
+			Name:        "memory-snapshot-interval",
+			Usage:       "Interval of the snapshots of the in-memory databases persisted in memory-dir, which empty their logs of writes",
+			EnvVars:     []string{"MEMORY_SNAPSHOT_INTERVAL"},
+			Value:       time.Minute,
+			Destination: &arg.SnapshotInterval,
+		},
+		&cli.BoolFlag{
+			Name:        "memory-sync",
+			Usage:       "Flush the logs of writes of the in-memory databases persisted in memory-dir to the disk upon every write, so that no write is lost when the machine fails",
+			EnvVars:     []string{"MEMORY_SYNC"},
+			Value:       false,
+			Destination: &arg.Sync,
+		},
 	}
 }
 
@@ -1,6 +1,7 @@
 package groupsync
 
 type Message struct {
+	Tenant   string `json:"tenant,omitempty"`
 	GroupID  string `json:"group_id"`
 	MemberID string `json:"member_id"`
 	Trial    int    `json:"trial"`
@@ -14,6 +15,7 @@ func (m *Message) Retry() {
 // Fields returns the structure fields in a map, for easy logging.
 func (m *Message) Fields() map[string]interface{} {
 	return map[string]interface{}{
+		"tenant":   m.Tenant,
 		"groupId":  m.GroupID,
 		"memberId": m.MemberID,
 		"trial":    m.Trial,
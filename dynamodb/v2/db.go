@@ -0,0 +1,675 @@
+package v2
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+	"github.com/imulab/go-scim/pkg/v2/crud"
+	"github.com/imulab/go-scim/pkg/v2/crud/expr"
+	"github.com/imulab/go-scim/pkg/v2/db"
+	scimjson "github.com/imulab/go-scim/pkg/v2/json"
+	"github.com/imulab/go-scim/pkg/v2/prop"
+	"github.com/imulab/go-scim/pkg/v2/spec"
+	"github.com/imulab/go-scim/pkg/v2/trace"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Limits of DynamoDB on the number of items in a request.
+const (
+	maxTransactItems = 100
+	maxBatchGetItems = 100
+	maxBatchWrites   = 25
+)
+
+// Number of attempts to write or read the unprocessed items of batch requests before giving up, and the delay before
+// the second attempt, which doubles with every attempt.
+const (
+	maxBatchAttempts = 5
+	batchBackoff     = 50 * time.Millisecond
+)
+
+// Create a db.DB implementation that persists data in DynamoDB. This implementation follows the single table design:
+// the resources of many resource types may share the same table, which shall have been created with the input of
+// CreateTableInput, i.e. by calling EnsureTable when the application starts.
+//
+// Each resource is an item keyed by the resource type and its id, which carries the JSON document of all its
+// attributes, including those that are never returned to clients, along with its id and meta.version. Singular
+// attributes whose uniqueness is server or global have an item for each value, which records the id of the resource
+// carrying it, so that the uniqueness is enforced by conditional writes, and Insert and Replace return an error of
+// spec.ErrUniqueness when it is violated. externalId, members.value and the attributes annotated with
+// "@DynamoDBLookup" (see AnnotationDynamoDBLookup) have lookup items for each value, which are queried through
+// LookupIndex. The items of a resource are written in the same transaction, except that lookup items beyond the limit
+// of DynamoDB on the number of items in a transaction are written after the transaction with batch writes.
+//
+// Filters consisting of eq comparisons on attributes with unique or lookup items, combined with and or or, are served
+// by reading these items; and other filters by querying all resources of the resource type through LookupIndex, in
+// ascending order of id, page by page. Either way, the candidates are evaluated with the filter. Unsorted queries are
+// ordered by id, and stop reading pages as soon as the requested page of SCIM pagination is filled; sorted queries are
+// sorted and paginated in memory. QueryCursor sorted by id resumes reading after the id of the cursor.
+//
+// Replace and Delete only modify the resource if its stored version is still the version of the given resource, and
+// return an error of spec.ErrConflict otherwise, which is enforced by conditional writes. This implementation ignores
+// the projection parameters and always returns complete resources.
+//
+// As items of DynamoDB cannot exceed 400 KB, neither can the documents of the resources. The returned DB does not
+// implement db.TxDB, as the transactions of DynamoDB cannot span reads and writes: the operations called through
+// db.WithTx are applied one by one.
+func DB(resourceType *spec.ResourceType, client dynamodbiface.DynamoDBAPI, table string) db.DB {
+	return &dynamoDB{
+		resourceType: resourceType,
+		client:       client,
+		table:        table,
+		lookups:      newLookups(resourceType),
+		filters:      crud.NewFilterCache(0),
+	}
+}
+
+type dynamoDB struct {
+	resourceType *spec.ResourceType
+	client       dynamodbiface.DynamoDBAPI
+	table        string
+	lookups      map[string]*lookup // by attribute id
+	filters      *crud.FilterCache
+}
+
+func (d *dynamoDB) Insert(ctx context.Context, resource *prop.Resource) error {
+	id := resource.IdOrEmpty()
+	if len(id) == 0 {
+		return fmt.Errorf("%w: empty id", spec.ErrInternal)
+	}
+
+	item, err := d.item(resource)
+	if err != nil {
+		return err
+	}
+
+	w := &writes{table: d.table}
+	w.add(&dynamodb.TransactWriteItem{Put: &dynamodb.Put{
+		TableName:                aws.String(d.table),
+		Item:                     item,
+		ConditionExpression:      aws.String("attribute_not_exists(#pk)"),
+		ExpressionAttributeNames: map[string]*string{"#pk": aws.String(pkAttribute)},
+	}}, fmt.Errorf("%w: value of 'id' is not unique", spec.ErrUniqueness))
+	d.diff(w, nil, resource)
+
+	return d.write(ctx, w)
+}
+
+func (d *dynamoDB) Count(ctx context.Context, filter string) (int, error) {
+	if len(strings.TrimSpace(filter)) > 0 {
+		candidates, err := d.evaluate(ctx, filter, "", -1)
+		return len(candidates), err
+	}
+
+	var n int64
+	err := d.client.QueryPagesWithContext(ctx, d.resourcesQuery(""), func(out *dynamodb.QueryOutput, _ bool) bool {
+		n += aws.Int64Value(out.Count)
+		return true
+	})
+	if err != nil {
+		return 0, errDatabase(err)
+	}
+	return int(n), nil
+}
+
+func (d *dynamoDB) Get(ctx context.Context, id string, _ *crud.Projection) (*prop.Resource, error) {
+	resource, err := d.get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if resource == nil {
+		return nil, fmt.Errorf("%w: resource not found by id '%s'", spec.ErrNotFound, id)
+	}
+	return resource, nil
+}
+
+// GetMany gets the resources by their ids with batch reads, and implements db.BatchDB.
+func (d *dynamoDB) GetMany(ctx context.Context, ids []string, _ *crud.Projection) ([]*prop.Resource, error) {
+	keys := make([]map[string]*dynamodb.AttributeValue, 0, len(ids))
+	seen := make(map[string]struct{}, len(ids))
+	for _, id := range ids {
+		if _, ok := seen[id]; !ok {
+			seen[id] = struct{}{}
+			keys = append(keys, d.resourceKey(id))
+		}
+	}
+
+	resources := make([]*prop.Resource, 0, len(keys))
+	for len(keys) > 0 {
+		n := len(keys)
+		if n > maxBatchGetItems {
+			n = maxBatchGetItems
+		}
+
+		pending := keys[:n]
+		for attempt := 0; len(pending) > 0; attempt++ {
+			if attempt == maxBatchAttempts {
+				return nil, fmt.Errorf("%w: resources remain unprocessed after %d attempts", spec.ErrInternal, attempt)
+			}
+			if err := backoff(ctx, attempt); err != nil {
+				return nil, err
+			}
+			out, err := d.client.BatchGetItemWithContext(ctx, &dynamodb.BatchGetItemInput{
+				RequestItems: map[string]*dynamodb.KeysAndAttributes{
+					d.table: {Keys: pending, ConsistentRead: aws.Bool(true)},
+				},
+			})
+			if err != nil {
+				return nil, errDatabase(err)
+			}
+			for _, item := range out.Responses[d.table] {
+				resource, err := d.resource(item)
+				if err != nil {
+					return nil, err
+				}
+				resources = append(resources, resource)
+			}
+			pending = nil
+			if unprocessed, ok := out.UnprocessedKeys[d.table]; ok {
+				pending = unprocessed.Keys
+			}
+		}
+
+		keys = keys[n:]
+	}
+
+	return db.SortByIDs(resources, ids), nil
+}
+
+func (d *dynamoDB) Replace(ctx context.Context, ref *prop.Resource, replacement *prop.Resource) error {
+	stored, err := d.compare(ctx, ref.IdOrEmpty(), ref.MetaVersionOrEmpty())
+	if err != nil {
+		return err
+	}
+
+	item, err := d.item(replacement)
+	if err != nil {
+		return err
+	}
+
+	w := &writes{table: d.table}
+	w.add(&dynamodb.TransactWriteItem{Put: &dynamodb.Put{
+		TableName:                 aws.String(d.table),
+		Item:                      item,
+		ConditionExpression:       aws.String("#version = :version"),
+		ExpressionAttributeNames:  map[string]*string{"#version": aws.String(versionAttribute)},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{":version": {S: aws.String(stored.MetaVersionOrEmpty())}},
+	}}, d.errModified(ref.IdOrEmpty()))
+	d.diff(w, stored, replacement)
+
+	return d.write(ctx, w)
+}
+
+func (d *dynamoDB) Delete(ctx context.Context, resource *prop.Resource) error {
+	stored, err := d.compare(ctx, resource.IdOrEmpty(), resource.MetaVersionOrEmpty())
+	if err != nil {
+		return err
+	}
+
+	w := &writes{table: d.table}
+	w.add(&dynamodb.TransactWriteItem{Delete: &dynamodb.Delete{
+		TableName:                 aws.String(d.table),
+		Key:                       d.resourceKey(stored.IdOrEmpty()),
+		ConditionExpression:       aws.String("#version = :version"),
+		ExpressionAttributeNames:  map[string]*string{"#version": aws.String(versionAttribute)},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{":version": {S: aws.String(stored.MetaVersionOrEmpty())}},
+	}}, d.errModified(resource.IdOrEmpty()))
+	d.diff(w, stored, nil)
+
+	return d.write(ctx, w)
+}
+
+func (d *dynamoDB) Query(ctx context.Context, filter string, sort *crud.Sort, pagination *crud.Pagination, _ *crud.Projection) ([]*prop.Resource, error) {
+	sorted := sort != nil && len(strings.TrimSpace(sort.By)) > 0
+
+	// Resources are read in the order of id, so that unsorted queries only need to read up to the requested page.
+	limit := -1
+	if pagination != nil && !sorted {
+		limit = pagination.StartIndex - 1
+		if limit < 0 {
+			limit = 0
+		}
+		limit += pagination.Count
+	}
+
+	candidates, err := d.evaluate(ctx, filter, "", limit)
+	if err != nil {
+		return nil, err
+	}
+
+	return db.SortAndPage(candidates, sort, pagination)
+}
+
+func (d *dynamoDB) QueryCursor(ctx context.Context, filter string, sort *crud.Sort, pagination *crud.CursorPagination, _ *crud.Projection) ([]*prop.Resource, string, error) {
+	if sort == nil || len(sort.By) == 0 {
+		sort = &crud.Sort{By: "id"}
+	}
+	keys, err := sort.Keys()
+	if err != nil {
+		return nil, "", err
+	}
+
+	var cursor *crud.Cursor
+	if pagination != nil && len(pagination.Cursor) > 0 {
+		if cursor, err = crud.ParseCursor(pagination.Cursor); err != nil {
+			return nil, "", err
+		}
+	}
+
+	// Resources are read in the order of id, so that queries sorted by id can resume after the cursor and stop as soon
+	// as the page is filled, which is one resource more than requested to tell if there is a next page.
+	var (
+		byID  = len(keys) == 1 && keys[0].By == "id" && keys[0].Order != crud.SortDesc
+		after = ""
+		limit = -1
+	)
+	if byID {
+		if cursor != nil {
+			after = cursor.ID
+		}
+		if pagination != nil && pagination.Count > 0 {
+			limit = pagination.Count + 1
+		}
+	}
+
+	candidates, err := d.evaluate(ctx, filter, after, limit)
+	if err != nil {
+		return nil, "", err
+	}
+	if err := sort.Sort(candidates); err != nil {
+		return nil, "", err
+	}
+	if cursor != nil {
+		if candidates, err = sort.After(candidates, cursor); err != nil {
+			return nil, "", err
+		}
+	}
+
+	if pagination == nil || pagination.Count <= 0 || len(candidates) <= pagination.Count {
+		return candidates, "", nil
+	}
+
+	candidates = candidates[:pagination.Count]
+	next, err := crud.NewCursor(candidates[len(candidates)-1], *sort)
+	if err != nil {
+		return nil, "", err
+	}
+	return candidates, next.String(), nil
+}
+
+// Returns the resource by id, or nil if there is none.
+func (d *dynamoDB) get(ctx context.Context, id string) (*prop.Resource, error) {
+	out, err := d.client.GetItemWithContext(ctx, &dynamodb.GetItemInput{
+		TableName:      aws.String(d.table),
+		Key:            d.resourceKey(id),
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil {
+		return nil, errDatabase(err)
+	}
+	if len(out.Item) == 0 {
+		return nil, nil
+	}
+	return d.resource(out.Item)
+}
+
+// Returns the stored resource by id, after checking that it still carries the version, if any. The write that follows
+// is conditioned on the version of the stored resource, so that the items of the resource are only modified if it was
+// not modified in between.
+func (d *dynamoDB) compare(ctx context.Context, id string, version string) (*prop.Resource, error) {
+	stored, err := d.get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if stored == nil {
+		return nil, fmt.Errorf("%w: resource not found by id '%s'", spec.ErrNotFound, id)
+	}
+	if len(version) > 0 && stored.MetaVersionOrEmpty() != version {
+		return nil, d.errModified(id)
+	}
+	return stored, nil
+}
+
+func (d *dynamoDB) errModified(id string) error {
+	return fmt.Errorf("%w: resource by id '%s' was modified since by another request", spec.ErrConflict, id)
+}
+
+// Returns the resources matching the filter, ordered by id, or all resources when the filter is empty. Only resources
+// whose id is greater than after are returned, if not empty, and no more than limit resources, if not negative.
+func (d *dynamoDB) evaluate(ctx context.Context, filter string, after string, limit int) (candidates []*prop.Resource, err error) {
+	_, end := trace.Start(ctx, trace.Evaluate)
+	defer func() {
+		end(err)
+	}()
+
+	var root *expr.Expression
+	if len(strings.TrimSpace(filter)) > 0 {
+		if root, err = d.filters.Compile(filter, d.resourceType); err != nil {
+			return nil, err
+		}
+	}
+
+	candidates = make([]*prop.Resource, 0)
+	if limit == 0 {
+		return candidates, nil
+	}
+
+	// Returns false when the limit is reached.
+	match := func(resource *prop.Resource) (bool, error) {
+		if root != nil {
+			if ok, err := crud.EvaluateExpressionOnProperty(resource.RootProperty(), root); err != nil || !ok {
+				return err == nil, err
+			}
+		}
+		candidates = append(candidates, resource)
+		return limit < 0 || len(candidates) < limit, nil
+	}
+
+	ids, ok, err := d.lookup(ctx, root)
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		i := sort.SearchStrings(ids, after)
+		if i < len(ids) && ids[i] == after {
+			i++
+		}
+		resources, err := d.GetMany(ctx, ids[i:], nil)
+		if err != nil {
+			return nil, err
+		}
+		for _, resource := range resources {
+			if more, err := match(resource); err != nil {
+				return nil, err
+			} else if !more {
+				break
+			}
+		}
+		return candidates, nil
+	}
+
+	var failure error
+	err = d.client.QueryPagesWithContext(ctx, d.resourcesQuery(after), func(out *dynamodb.QueryOutput, _ bool) bool {
+		for _, item := range out.Items {
+			resource, err := d.resource(item)
+			if err != nil {
+				failure = err
+				return false
+			}
+			if more, err := match(resource); err != nil || !more {
+				failure = err
+				return false
+			}
+		}
+		return true
+	})
+	if err != nil {
+		return nil, errDatabase(err)
+	}
+	if failure != nil {
+		return nil, failure
+	}
+	return candidates, nil
+}
+
+// Returns the query of the resources of the resource type through LookupIndex, in ascending order of id, starting
+// after the id, if not empty.
+func (d *dynamoDB) resourcesQuery(after string) *dynamodb.QueryInput {
+	input := &dynamodb.QueryInput{
+		TableName:                aws.String(d.table),
+		IndexName:                aws.String(LookupIndex),
+		KeyConditionExpression:   aws.String("#sk = :sk"),
+		ExpressionAttributeNames: map[string]*string{"#sk": aws.String(skAttribute)},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":sk": {S: aws.String(d.resourceType.ID())},
+		},
+	}
+	if len(after) > 0 {
+		input.ExclusiveStartKey = d.resourceKey(after)
+	}
+	return input
+}
+
+// writes of a transaction, along with the errors to return when their conditions fail, and the batch writes of the
+// lookup items that do not fit in the transaction
+type writes struct {
+	table  string
+	items  []*dynamodb.TransactWriteItem
+	errs   []error
+	others []*dynamodb.WriteRequest
+}
+
+func (w *writes) add(item *dynamodb.TransactWriteItem, errIfFailed error) {
+	w.items = append(w.items, item)
+	w.errs = append(w.errs, errIfFailed)
+}
+
+// Adds the write of a lookup item, which is part of the transaction unless the transaction is full.
+func (w *writes) addLookup(put *dynamodb.PutRequest, del *dynamodb.DeleteRequest) {
+	if len(w.items) < maxTransactItems {
+		if put != nil {
+			w.add(&dynamodb.TransactWriteItem{Put: &dynamodb.Put{TableName: aws.String(w.table), Item: put.Item}}, nil)
+		} else {
+			w.add(&dynamodb.TransactWriteItem{Delete: &dynamodb.Delete{TableName: aws.String(w.table), Key: del.Key}}, nil)
+		}
+		return
+	}
+	w.others = append(w.others, &dynamodb.WriteRequest{PutRequest: put, DeleteRequest: del})
+}
+
+// Adds the writes of the unique and lookup items that change from the stored resource to the resource. The stored
+// resource is nil when the resource is inserted, and the resource is nil when the stored resource is deleted. Unique
+// items are always written in the transaction.
+func (d *dynamoDB) diff(w *writes, stored *prop.Resource, resource *prop.Resource) {
+	var lookups []*lookup
+	for _, l := range d.lookups {
+		lookups = append(lookups, l)
+	}
+	sort.Slice(lookups, func(i, j int) bool {
+		// unique items first, so that they are always within the transaction
+		if lookups[i].unique != lookups[j].unique {
+			return lookups[i].unique
+		}
+		return lookups[i].attr.ID() < lookups[j].attr.ID()
+	})
+
+	for _, l := range lookups {
+		added, removed := d.changes(l, stored, resource)
+		for _, value := range added {
+			if l.unique {
+				w.add(&dynamodb.TransactWriteItem{Put: &dynamodb.Put{
+					TableName:                aws.String(d.table),
+					Item:                     d.uniqueItem(l, value, resource.IdOrEmpty()),
+					ConditionExpression:      aws.String("attribute_not_exists(#pk)"),
+					ExpressionAttributeNames: map[string]*string{"#pk": aws.String(pkAttribute)},
+				}}, fmt.Errorf("%w: value of '%s' is not unique", spec.ErrUniqueness, l.attr.Path()))
+			} else {
+				w.addLookup(&dynamodb.PutRequest{Item: d.lookupItem(l, value, resource.IdOrEmpty())}, nil)
+			}
+		}
+		for _, value := range removed {
+			if l.unique {
+				w.add(&dynamodb.TransactWriteItem{Delete: &dynamodb.Delete{
+					TableName: aws.String(d.table),
+					Key:       d.uniqueKey(l, value),
+				}}, nil)
+			} else {
+				w.addLookup(nil, &dynamodb.DeleteRequest{Key: d.lookupKey(l, value, stored.IdOrEmpty())})
+			}
+		}
+	}
+}
+
+// Returns the values of the attribute added to and removed from the stored resource by the resource, either of which
+// may be nil.
+func (d *dynamoDB) changes(l *lookup, stored *prop.Resource, resource *prop.Resource) (added []string, removed []string) {
+	var before, after []string
+	if stored != nil {
+		before = l.valuesOf(stored)
+	}
+	if resource != nil {
+		after = l.valuesOf(resource)
+	}
+
+	had := make(map[string]struct{}, len(before))
+	for _, value := range before {
+		had[value] = struct{}{}
+	}
+	has := make(map[string]struct{}, len(after))
+	for _, value := range after {
+		has[value] = struct{}{}
+		if _, ok := had[value]; !ok {
+			added = append(added, value)
+		}
+	}
+	for _, value := range before {
+		if _, ok := has[value]; !ok {
+			removed = append(removed, value)
+		}
+	}
+	return
+}
+
+// Executes the transaction and then the batch writes that do not fit in it. When a condition of the transaction fails,
+// the error of the write with the condition is returned.
+func (d *dynamoDB) write(ctx context.Context, w *writes) error {
+	_, err := d.client.TransactWriteItemsWithContext(ctx, &dynamodb.TransactWriteItemsInput{TransactItems: w.items})
+	if err != nil {
+		if e, ok := err.(*dynamodb.TransactionCanceledException); ok {
+			for i, reason := range e.CancellationReasons {
+				switch aws.StringValue(reason.Code) {
+				case dynamodb.BatchStatementErrorCodeEnumConditionalCheckFailed:
+					if i < len(w.errs) && w.errs[i] != nil {
+						return w.errs[i]
+					}
+				case dynamodb.BatchStatementErrorCodeEnumTransactionConflict:
+					return fmt.Errorf("%w: %s", spec.ErrConflict, e.Message())
+				}
+			}
+		}
+		return errDatabase(err)
+	}
+
+	for len(w.others) > 0 {
+		n := len(w.others)
+		if n > maxBatchWrites {
+			n = maxBatchWrites
+		}
+
+		pending := w.others[:n]
+		for attempt := 0; len(pending) > 0; attempt++ {
+			if attempt == maxBatchAttempts {
+				return fmt.Errorf("%w: lookup items remain unprocessed after %d attempts", spec.ErrInternal, attempt)
+			}
+			if err := backoff(ctx, attempt); err != nil {
+				return err
+			}
+			out, err := d.client.BatchWriteItemWithContext(ctx, &dynamodb.BatchWriteItemInput{
+				RequestItems: map[string][]*dynamodb.WriteRequest{d.table: pending},
+			})
+			if err != nil {
+				return errDatabase(err)
+			}
+			pending = out.UnprocessedItems[d.table]
+		}
+
+		w.others = w.others[n:]
+	}
+
+	return nil
+}
+
+// Waits before retrying the unprocessed items of a batch request for the attempt, which does not wait for the first
+// attempt, and returns an error of spec.ErrInternal if the context is done in the meantime.
+func backoff(ctx context.Context, attempt int) error {
+	if attempt == 0 {
+		return nil
+	}
+	select {
+	case <-ctx.Done():
+		return fmt.Errorf("%w: %v", spec.ErrInternal, ctx.Err())
+	case <-time.After(batchBackoff << uint(attempt-1)):
+		return nil
+	}
+}
+
+// Returns the key of the item of the resource by id: the partition key is the resource type and the id, and the sort
+// key is the resource type, so that the resources of the resource type can be queried through LookupIndex.
+func (d *dynamoDB) resourceKey(id string) map[string]*dynamodb.AttributeValue {
+	return map[string]*dynamodb.AttributeValue{
+		pkAttribute: {S: aws.String(d.resourceType.ID() + "#" + id)},
+		skAttribute: {S: aws.String(d.resourceType.ID())},
+	}
+}
+
+// Returns the item of the resource.
+func (d *dynamoDB) item(resource *prop.Resource) (map[string]*dynamodb.AttributeValue, error) {
+	raw, err := json.Marshal(prop.Document(resource.RootProperty()))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", spec.ErrInternal, err)
+	}
+
+	item := d.resourceKey(resource.IdOrEmpty())
+	item[idAttribute] = &dynamodb.AttributeValue{S: aws.String(resource.IdOrEmpty())}
+	item[versionAttribute] = &dynamodb.AttributeValue{S: aws.String(resource.MetaVersionOrEmpty())}
+	item[docAttribute] = &dynamodb.AttributeValue{S: aws.String(string(raw))}
+	return item, nil
+}
+
+// Returns the resource restored from the JSON document of the item.
+func (d *dynamoDB) resource(item map[string]*dynamodb.AttributeValue) (*prop.Resource, error) {
+	doc, ok := item[docAttribute]
+	if !ok || doc.S == nil {
+		return nil, fmt.Errorf("%w: item '%s' has no document", spec.ErrInternal, aws.StringValue(item[pkAttribute].S))
+	}
+
+	resource := prop.NewResource(d.resourceType)
+	if err := scimjson.Deserialize([]byte(*doc.S), resource); err != nil {
+		return nil, err
+	}
+	return resource, nil
+}
+
+// Returns the key of the unique item of the value.
+func (d *dynamoDB) uniqueKey(l *lookup, value string) map[string]*dynamodb.AttributeValue {
+	return map[string]*dynamodb.AttributeValue{
+		pkAttribute: {S: aws.String(d.resourceType.ID() + "#" + l.attr.Path() + "#" + value)},
+		skAttribute: {S: aws.String(uniqueSortKey)},
+	}
+}
+
+func (d *dynamoDB) uniqueItem(l *lookup, value string, id string) map[string]*dynamodb.AttributeValue {
+	item := d.uniqueKey(l, value)
+	item[idAttribute] = &dynamodb.AttributeValue{S: aws.String(id)}
+	return item
+}
+
+// Returns the sort key of the lookup items of the value, which is the partition key of LookupIndex.
+func (d *dynamoDB) lookupSortKey(l *lookup, value string) string {
+	return d.resourceType.ID() + "#" + l.attr.Path() + "#" + value
+}
+
+// Returns the key of the lookup item of the value of the resource by id, which shares the partition key of the item of
+// the resource.
+func (d *dynamoDB) lookupKey(l *lookup, value string, id string) map[string]*dynamodb.AttributeValue {
+	return map[string]*dynamodb.AttributeValue{
+		pkAttribute: {S: aws.String(d.resourceType.ID() + "#" + id)},
+		skAttribute: {S: aws.String(d.lookupSortKey(l, value))},
+	}
+}
+
+func (d *dynamoDB) lookupItem(l *lookup, value string, id string) map[string]*dynamodb.AttributeValue {
+	item := d.lookupKey(l, value, id)
+	item[idAttribute] = &dynamodb.AttributeValue{S: aws.String(id)}
+	return item
+}
+
+var (
+	_ db.CursorDB = (*dynamoDB)(nil)
+	_ db.BatchDB  = (*dynamoDB)(nil)
+)
@@ -0,0 +1,462 @@
+package v2
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+	"github.com/imulab/go-scim/pkg/v2/crud"
+	"github.com/imulab/go-scim/pkg/v2/db"
+	scimjson "github.com/imulab/go-scim/pkg/v2/json"
+	"github.com/imulab/go-scim/pkg/v2/prop"
+	"github.com/imulab/go-scim/pkg/v2/spec"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// The tests run against an in-memory fake of the DynamoDB API, unless TEST_DYNAMODB_ENDPOINT is set to the endpoint of
+// DynamoDB Local, i.e. "http://localhost:8000".
+func TestDynamoDatabase(t *testing.T) {
+	s := new(DynamoDatabaseTestSuite)
+	suite.Run(t, s)
+}
+
+type DynamoDatabaseTestSuite struct {
+	suite.Suite
+	userResourceType  *spec.ResourceType
+	groupResourceType *spec.ResourceType
+	endpoint          string
+}
+
+func (s *DynamoDatabaseTestSuite) TestCRUD() {
+	database := DB(s.userResourceType, s.client(), s.table())
+	ctx := context.Background()
+
+	foo := s.resource(s.userResourceType, `{"schemas": ["urn:ietf:params:scim:schemas:core:2.0:User"], "id": "user001", "userName": "foo", "password": "s3cret", "meta": {"version": "W/\"1\""}}`)
+	require.Nil(s.T(), database.Insert(ctx, foo))
+	err := database.Insert(ctx, s.resource(s.userResourceType, `{"schemas": ["urn:ietf:params:scim:schemas:core:2.0:User"], "id": "user002", "userName": "FOO"}`))
+	assert.True(s.T(), errors.Is(err, spec.ErrUniqueness))
+	assert.Contains(s.T(), err.Error(), "'userName'")
+	err = database.Insert(ctx, s.resource(s.userResourceType, `{"schemas": ["urn:ietf:params:scim:schemas:core:2.0:User"], "id": "user001", "userName": "bar"}`))
+	assert.True(s.T(), errors.Is(err, spec.ErrUniqueness))
+	assert.Contains(s.T(), err.Error(), "'id'")
+
+	got, err := database.Get(ctx, "user001", nil)
+	require.Nil(s.T(), err)
+	assert.Equal(s.T(), foo.Hash(), got.Hash())
+	_, err = database.Get(ctx, "missing", nil)
+	assert.True(s.T(), errors.Is(err, spec.ErrNotFound))
+
+	replacement := s.resource(s.userResourceType, `{"schemas": ["urn:ietf:params:scim:schemas:core:2.0:User"], "id": "user001", "userName": "bar", "meta": {"version": "W/\"2\""}}`)
+	require.Nil(s.T(), database.Replace(ctx, foo, replacement))
+	err = database.Replace(ctx, foo, replacement)
+	assert.True(s.T(), errors.Is(err, spec.ErrConflict), "replaced with a stale version")
+
+	require.Nil(s.T(), database.Insert(ctx, s.resource(s.userResourceType, `{"schemas": ["urn:ietf:params:scim:schemas:core:2.0:User"], "id": "user002", "userName": "foo"}`)), "userName was released")
+	err = database.Insert(ctx, s.resource(s.userResourceType, `{"schemas": ["urn:ietf:params:scim:schemas:core:2.0:User"], "id": "user003", "userName": "Bar"}`))
+	assert.True(s.T(), errors.Is(err, spec.ErrUniqueness), "userName was taken by the replacement")
+
+	err = database.Delete(ctx, foo)
+	assert.True(s.T(), errors.Is(err, spec.ErrConflict), "deleted with a stale version")
+	require.Nil(s.T(), database.Delete(ctx, replacement))
+	err = database.Delete(ctx, replacement)
+	assert.True(s.T(), errors.Is(err, spec.ErrNotFound))
+
+	n, err := database.Count(ctx, "")
+	require.Nil(s.T(), err)
+	assert.Equal(s.T(), 1, n)
+	n, err = database.Count(ctx, `userName eq "bar"`)
+	require.Nil(s.T(), err)
+	assert.Equal(s.T(), 0, n)
+}
+
+func (s *DynamoDatabaseTestSuite) TestQuery() {
+	database := DB(s.userResourceType, s.client(), s.table()).(db.CursorDB)
+	ctx := context.Background()
+
+	for _, each := range []string{
+		`{"schemas": ["urn:ietf:params:scim:schemas:core:2.0:User"], "id": "user001", "userName": "carol", "externalId": "c", "active": true, "emails": [{"value": "carol@foo.com"}]}`,
+		`{"schemas": ["urn:ietf:params:scim:schemas:core:2.0:User"], "id": "user002", "userName": "Bob", "externalId": "b", "active": false, "emails": [{"value": "bob@bar.com"}]}`,
+		`{"schemas": ["urn:ietf:params:scim:schemas:core:2.0:User"], "id": "user003", "userName": "alice", "active": true}`,
+	} {
+		require.Nil(s.T(), database.Insert(ctx, s.resource(s.userResourceType, each)))
+	}
+
+	tests := []struct {
+		filter     string
+		sort       *crud.Sort
+		pagination *crud.Pagination
+		expect     []string
+	}{
+		{filter: `userName eq "BOB"`, expect: []string{"user002"}},
+		{filter: `externalId eq "c" or userName eq "alice"`, expect: []string{"user001", "user003"}},
+		{filter: `externalId eq "C"`, expect: []string{}},
+		{filter: `userName eq "carol" and active eq false`, expect: []string{}},
+		{filter: `emails.value ew "foo.com"`, expect: []string{"user001"}},
+		{filter: `active eq true`, sort: &crud.Sort{By: "userName"}, expect: []string{"user003", "user001"}},
+		{filter: `active eq true`, pagination: &crud.Pagination{StartIndex: 2, Count: 1}, expect: []string{"user003"}},
+		{sort: &crud.Sort{By: "userName"}, pagination: &crud.Pagination{StartIndex: 2, Count: 1}, expect: []string{"user002"}},
+		{pagination: &crud.Pagination{StartIndex: 5, Count: 1}, expect: []string{}},
+	}
+	for _, test := range tests {
+		s.T().Run(fmt.Sprintf("%s %v %v", test.filter, test.sort, test.pagination), func(t *testing.T) {
+			results, err := database.Query(ctx, test.filter, test.sort, test.pagination, nil)
+			require.Nil(t, err)
+			assert.Equal(t, test.expect, s.ids(results))
+		})
+	}
+
+	results, next, err := database.QueryCursor(ctx, "", nil, &crud.CursorPagination{Count: 2}, nil)
+	require.Nil(s.T(), err)
+	assert.Equal(s.T(), []string{"user001", "user002"}, s.ids(results))
+	results, next, err = database.QueryCursor(ctx, "", nil, &crud.CursorPagination{Cursor: next, Count: 2}, nil)
+	require.Nil(s.T(), err)
+	assert.Equal(s.T(), []string{"user003"}, s.ids(results))
+	assert.Empty(s.T(), next)
+
+	results, next, err = database.QueryCursor(ctx, "", &crud.Sort{By: "userName"}, &crud.CursorPagination{Count: 2}, nil)
+	require.Nil(s.T(), err)
+	assert.Equal(s.T(), []string{"user003", "user002"}, s.ids(results))
+	results, _, err = database.QueryCursor(ctx, "", &crud.Sort{By: "userName"}, &crud.CursorPagination{Cursor: next, Count: 2}, nil)
+	require.Nil(s.T(), err)
+	assert.Equal(s.T(), []string{"user001"}, s.ids(results))
+
+	results, err = db.GetMany(ctx, database, []string{"user003", "missing", "user001"}, nil)
+	require.Nil(s.T(), err)
+	assert.Equal(s.T(), []string{"user003", "user001"}, s.ids(results))
+}
+
+func (s *DynamoDatabaseTestSuite) TestMembership() {
+	client, table := s.client(), s.table()
+	users := DB(s.userResourceType, client, table)
+	groups := DB(s.groupResourceType, client, table)
+	ctx := context.Background()
+
+	members := make([]string, 0, 150)
+	for i := 0; i < cap(members); i++ {
+		members = append(members, fmt.Sprintf(`{"value": "user%03d"}`, i))
+	}
+	large := s.resource(s.groupResourceType, `{"schemas": ["urn:ietf:params:scim:schemas:core:2.0:Group"], "id": "group001", "displayName": "large", "members": [`+strings.Join(members, ",")+`]}`)
+	require.Nil(s.T(), groups.Insert(ctx, large), "lookup items beyond the transaction are batch written")
+	require.Nil(s.T(), groups.Insert(ctx, s.resource(s.groupResourceType, `{"schemas": ["urn:ietf:params:scim:schemas:core:2.0:Group"], "id": "group002", "displayName": "small", "members": [{"value": "user149"}, {"value": "user150"}]}`)))
+	require.Nil(s.T(), users.Insert(ctx, s.resource(s.userResourceType, `{"schemas": ["urn:ietf:params:scim:schemas:core:2.0:User"], "id": "user149", "userName": "foo"}`)))
+
+	results, err := groups.Query(ctx, `members.value eq "user149"`, nil, nil, nil)
+	require.Nil(s.T(), err)
+	assert.Equal(s.T(), []string{"group001", "group002"}, s.ids(results))
+
+	n, err := users.Count(ctx, "")
+	require.Nil(s.T(), err)
+	assert.Equal(s.T(), 1, n, "resource types sharing the table are apart")
+
+	smaller := s.resource(s.groupResourceType, `{"schemas": ["urn:ietf:params:scim:schemas:core:2.0:Group"], "id": "group001", "displayName": "large", "members": [{"value": "user000"}]}`)
+	require.Nil(s.T(), groups.Replace(ctx, large, smaller))
+	results, err = groups.Query(ctx, `members.value eq "user149" or members.value eq "user000"`, nil, nil, nil)
+	require.Nil(s.T(), err)
+	assert.Equal(s.T(), []string{"group001", "group002"}, s.ids(results))
+	results, err = groups.Query(ctx, `members.value eq "user149"`, nil, nil, nil)
+	require.Nil(s.T(), err)
+	assert.Equal(s.T(), []string{"group002"}, s.ids(results))
+
+	if fake, ok := client.(*fakeDynamoDB); ok {
+		require.Nil(s.T(), groups.Delete(ctx, smaller))
+		require.Nil(s.T(), groups.Delete(ctx, s.resource(s.groupResourceType, `{"schemas": ["urn:ietf:params:scim:schemas:core:2.0:Group"], "id": "group002", "displayName": "small"}`)))
+		require.Nil(s.T(), users.Delete(ctx, s.resource(s.userResourceType, `{"schemas": ["urn:ietf:params:scim:schemas:core:2.0:User"], "id": "user149", "userName": "foo"}`)))
+		assert.Empty(s.T(), fake.items, "no item is left behind")
+	}
+}
+
+func (s *DynamoDatabaseTestSuite) TestLookups() {
+	lookups := newLookups(s.groupResourceType)
+	paths := make([]string, 0, len(lookups))
+	for _, l := range lookups {
+		paths = append(paths, l.attr.Path())
+	}
+	sort.Strings(paths)
+	assert.Equal(s.T(), []string{"externalId", "members.value"}, paths)
+
+	l := newLookups(s.userResourceType)["urn:ietf:params:scim:schemas:core:2.0:User:userName"]
+	require.NotNil(s.T(), l)
+	assert.True(s.T(), l.unique)
+	assert.Equal(s.T(), []string{"foo"}, l.valuesOf(s.resource(s.userResourceType, `{"schemas": ["urn:ietf:params:scim:schemas:core:2.0:User"], "id": "user001", "userName": "Foo"}`)))
+	value, ok := l.valueOfLiteral(`"FOO"`)
+	assert.True(s.T(), ok)
+	assert.Equal(s.T(), "foo", value)
+}
+
+// Returns the client of DynamoDB Local if TEST_DYNAMODB_ENDPOINT is set, or a fake otherwise.
+func (s *DynamoDatabaseTestSuite) client() dynamodbiface.DynamoDBAPI {
+	if len(s.endpoint) == 0 {
+		return newFakeDynamoDB()
+	}
+	return dynamodb.New(session.Must(session.NewSession(&aws.Config{
+		Endpoint:    aws.String(s.endpoint),
+		Region:      aws.String("us-east-1"),
+		Credentials: credentials.NewStaticCredentials("test", "test", ""),
+	})))
+}
+
+// Returns the name of a new table, which is created by EnsureTable when testing with DynamoDB Local.
+func (s *DynamoDatabaseTestSuite) table() string {
+	table := fmt.Sprintf("scim_%d", time.Now().UnixNano())
+	if len(s.endpoint) > 0 {
+		require.Nil(s.T(), EnsureTable(context.Background(), s.client(), table))
+	}
+	return table
+}
+
+func (s *DynamoDatabaseTestSuite) resource(resourceType *spec.ResourceType, raw string) *prop.Resource {
+	resource := prop.NewResource(resourceType)
+	require.Nil(s.T(), scimjson.Deserialize([]byte(raw), resource))
+	return resource
+}
+
+func (s *DynamoDatabaseTestSuite) ids(resources []*prop.Resource) []string {
+	ids := make([]string, 0, len(resources))
+	for _, each := range resources {
+		ids = append(ids, each.IdOrEmpty())
+	}
+	return ids
+}
+
+func (s *DynamoDatabaseTestSuite) SetupSuite() {
+	for _, each := range []struct {
+		filepath  string
+		structure interface{}
+		post      func(parsed interface{})
+	}{
+		{
+			filepath:  "../../public/schemas/core_schema.json",
+			structure: new(spec.Schema),
+			post: func(parsed interface{}) {
+				spec.Schemas().Register(parsed.(*spec.Schema))
+			},
+		},
+		{
+			filepath:  "../../public/schemas/user_schema.json",
+			structure: new(spec.Schema),
+			post: func(parsed interface{}) {
+				spec.Schemas().Register(parsed.(*spec.Schema))
+			},
+		},
+		{
+			filepath:  "../../public/schemas/user_enterprise_extension_schema.json",
+			structure: new(spec.Schema),
+			post: func(parsed interface{}) {
+				spec.Schemas().Register(parsed.(*spec.Schema))
+			},
+		},
+		{
+			filepath:  "../../public/schemas/group_schema.json",
+			structure: new(spec.Schema),
+			post: func(parsed interface{}) {
+				spec.Schemas().Register(parsed.(*spec.Schema))
+			},
+		},
+		{
+			filepath:  "../../public/resource_types/user_resource_type.json",
+			structure: new(spec.ResourceType),
+			post: func(parsed interface{}) {
+				s.userResourceType = parsed.(*spec.ResourceType)
+				crud.Register(s.userResourceType)
+			},
+		},
+		{
+			filepath:  "../../public/resource_types/group_resource_type.json",
+			structure: new(spec.ResourceType),
+			post: func(parsed interface{}) {
+				s.groupResourceType = parsed.(*spec.ResourceType)
+				crud.Register(s.groupResourceType)
+			},
+		},
+	} {
+		f, err := os.Open(each.filepath)
+		require.Nil(s.T(), err)
+
+		raw, err := ioutil.ReadAll(f)
+		require.Nil(s.T(), err)
+
+		err = json.Unmarshal(raw, each.structure)
+		require.Nil(s.T(), err)
+
+		if each.post != nil {
+			each.post(each.structure)
+		}
+	}
+
+	s.endpoint = os.Getenv("TEST_DYNAMODB_ENDPOINT")
+}
+
+// fakeDynamoDB implements the subset of the DynamoDB API used by this package in memory, for the expressions this
+// package uses. Queries return pages of two items, and batch requests of many items leave the last item unprocessed,
+// so that pagination and retries are exercised.
+type fakeDynamoDB struct {
+	dynamodbiface.DynamoDBAPI
+	mu    sync.Mutex
+	items map[[2]string]map[string]*dynamodb.AttributeValue
+}
+
+func newFakeDynamoDB() *fakeDynamoDB {
+	return &fakeDynamoDB{items: map[[2]string]map[string]*dynamodb.AttributeValue{}}
+}
+
+func (f *fakeDynamoDB) key(item map[string]*dynamodb.AttributeValue) [2]string {
+	return [2]string{aws.StringValue(item[pkAttribute].S), aws.StringValue(item[skAttribute].S)}
+}
+
+func (f *fakeDynamoDB) GetItemWithContext(_ aws.Context, in *dynamodb.GetItemInput, _ ...request.Option) (*dynamodb.GetItemOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return &dynamodb.GetItemOutput{Item: f.items[f.key(in.Key)]}, nil
+}
+
+func (f *fakeDynamoDB) BatchGetItemWithContext(_ aws.Context, in *dynamodb.BatchGetItemInput, _ ...request.Option) (*dynamodb.BatchGetItemOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	out := &dynamodb.BatchGetItemOutput{
+		Responses:       map[string][]map[string]*dynamodb.AttributeValue{},
+		UnprocessedKeys: map[string]*dynamodb.KeysAndAttributes{},
+	}
+	for table, keys := range in.RequestItems {
+		for i, key := range keys.Keys {
+			if i > 0 && i == len(keys.Keys)-1 {
+				out.UnprocessedKeys[table] = &dynamodb.KeysAndAttributes{Keys: keys.Keys[i:]}
+				break
+			}
+			if item, ok := f.items[f.key(key)]; ok {
+				out.Responses[table] = append(out.Responses[table], item)
+			}
+		}
+	}
+	return out, nil
+}
+
+func (f *fakeDynamoDB) BatchWriteItemWithContext(_ aws.Context, in *dynamodb.BatchWriteItemInput, _ ...request.Option) (*dynamodb.BatchWriteItemOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	out := &dynamodb.BatchWriteItemOutput{UnprocessedItems: map[string][]*dynamodb.WriteRequest{}}
+	for table, requests := range in.RequestItems {
+		for i, r := range requests {
+			if i > 0 && i == len(requests)-1 {
+				out.UnprocessedItems[table] = requests[i:]
+				break
+			}
+			if r.PutRequest != nil {
+				f.items[f.key(r.PutRequest.Item)] = r.PutRequest.Item
+			} else {
+				delete(f.items, f.key(r.DeleteRequest.Key))
+			}
+		}
+	}
+	return out, nil
+}
+
+func (f *fakeDynamoDB) TransactWriteItemsWithContext(_ aws.Context, in *dynamodb.TransactWriteItemsInput, _ ...request.Option) (*dynamodb.TransactWriteItemsOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if len(in.TransactItems) > maxTransactItems {
+		return nil, fmt.Errorf("too many items in transaction")
+	}
+
+	reasons := make([]*dynamodb.CancellationReason, 0, len(in.TransactItems))
+	failed := false
+	for _, each := range in.TransactItems {
+		var (
+			key       map[string]*dynamodb.AttributeValue
+			condition *string
+			values    map[string]*dynamodb.AttributeValue
+		)
+		switch {
+		case each.Put != nil:
+			key, condition, values = each.Put.Item, each.Put.ConditionExpression, each.Put.ExpressionAttributeValues
+		case each.Delete != nil:
+			key, condition, values = each.Delete.Key, each.Delete.ConditionExpression, each.Delete.ExpressionAttributeValues
+		}
+
+		existing, exists := f.items[f.key(key)]
+		ok := true
+		switch aws.StringValue(condition) {
+		case "":
+		case "attribute_not_exists(#pk)":
+			ok = !exists
+		case "#version = :version":
+			ok = exists && aws.StringValue(existing[versionAttribute].S) == aws.StringValue(values[":version"].S)
+		default:
+			return nil, fmt.Errorf("unsupported condition: %s", aws.StringValue(condition))
+		}
+		if ok {
+			reasons = append(reasons, &dynamodb.CancellationReason{Code: aws.String("None")})
+		} else {
+			failed = true
+			reasons = append(reasons, &dynamodb.CancellationReason{Code: aws.String(dynamodb.BatchStatementErrorCodeEnumConditionalCheckFailed)})
+		}
+	}
+	if failed {
+		return nil, &dynamodb.TransactionCanceledException{CancellationReasons: reasons, Message_: aws.String("transaction cancelled")}
+	}
+
+	for _, each := range in.TransactItems {
+		if each.Put != nil {
+			f.items[f.key(each.Put.Item)] = each.Put.Item
+		} else {
+			delete(f.items, f.key(each.Delete.Key))
+		}
+	}
+	return &dynamodb.TransactWriteItemsOutput{}, nil
+}
+
+func (f *fakeDynamoDB) QueryPagesWithContext(_ aws.Context, in *dynamodb.QueryInput, fn func(*dynamodb.QueryOutput, bool) bool, _ ...request.Option) error {
+	if aws.StringValue(in.IndexName) != LookupIndex || aws.StringValue(in.KeyConditionExpression) != "#sk = :sk" {
+		return fmt.Errorf("unsupported query")
+	}
+
+	f.mu.Lock()
+	var matched []map[string]*dynamodb.AttributeValue
+	for key, item := range f.items {
+		if key[1] == aws.StringValue(in.ExpressionAttributeValues[":sk"].S) {
+			matched = append(matched, item)
+		}
+	}
+	f.mu.Unlock()
+
+	sort.Slice(matched, func(i, j int) bool {
+		return aws.StringValue(matched[i][pkAttribute].S) < aws.StringValue(matched[j][pkAttribute].S)
+	})
+	if in.ExclusiveStartKey != nil {
+		start := aws.StringValue(in.ExclusiveStartKey[pkAttribute].S)
+		i := sort.Search(len(matched), func(i int) bool {
+			return aws.StringValue(matched[i][pkAttribute].S) > start
+		})
+		matched = matched[i:]
+	}
+
+	for len(matched) > 0 {
+		n := 2
+		if n > len(matched) {
+			n = len(matched)
+		}
+		page, last := matched[:n], n == len(matched)
+		if !fn(&dynamodb.QueryOutput{Items: page, Count: aws.Int64(int64(n))}, last) {
+			return nil
+		}
+		matched = matched[n:]
+	}
+	return nil
+}
@@ -0,0 +1,4 @@
+// This package provides DynamoDB implementation of db.DB interface, which stores the resources of all resource types
+// in a single table, and serves lookups by unique attributes, externalId and group members with a global secondary
+// index.
+package v2
@@ -0,0 +1,11 @@
+module github.com/imulab/go-scim/dynamodb/v2
+
+go 1.13
+
+require (
+	github.com/aws/aws-sdk-go v1.44.100
+	github.com/imulab/go-scim/pkg/v2 v2.0.0
+	github.com/stretchr/testify v1.4.0
+)
+
+replace github.com/imulab/go-scim/pkg/v2 => ../../pkg/v2
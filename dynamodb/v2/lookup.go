@@ -0,0 +1,336 @@
+package v2
+
+import (
+	"context"
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/imulab/go-scim/pkg/v2/crud/expr"
+	"github.com/imulab/go-scim/pkg/v2/prop"
+	"github.com/imulab/go-scim/pkg/v2/spec"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	// @DynamoDBLookup annotates an attribute so that lookup items of its values are maintained in DynamoDB, which serve
+	// eq filters on the attribute through LookupIndex. Attributes within multiValued attributes may be annotated, in
+	// which case there is a lookup item for each value. externalId and members.value always have lookup items, and
+	// singular attributes whose uniqueness is server or global always have unique items instead, which also enforce
+	// the uniqueness.
+	AnnotationDynamoDBLookup = "@DynamoDBLookup"
+)
+
+// Paths of the attributes that have lookup items without being annotated.
+var defaultLookups = map[string]struct{}{
+	"externalId":    {},
+	"members.value": {},
+}
+
+// Sort key of the items that guard the uniqueness of a value of a unique attribute.
+const uniqueSortKey = "#unique"
+
+// lookup maintains the items through which the resources carrying a value of the attribute are looked up. Unique
+// attributes have an item keyed by the value, which records the id of the resource; other attributes have an item
+// for every value under the key of the resource, whose sort key is the value, so that they can be queried through
+// LookupIndex.
+type lookup struct {
+	attr   *spec.Attribute
+	path   []*spec.Attribute // from the top level attribute to attr
+	unique bool
+}
+
+// Returns the lookups of the resource type, by attribute id.
+func newLookups(resourceType *spec.ResourceType) map[string]*lookup {
+	lookups := make(map[string]*lookup)
+
+	var collect func(attr *spec.Attribute, path []*spec.Attribute, multiValued bool)
+	collect = func(attr *spec.Attribute, path []*spec.Attribute, multiValued bool) {
+		_ = attr.ForEachSubAttribute(func(sub *spec.Attribute) error {
+			subPath := append(append([]*spec.Attribute{}, path...), sub)
+			if sub.Type() == spec.TypeComplex {
+				collect(sub, subPath, multiValued || sub.MultiValued())
+				return nil
+			}
+			if sub.ID() == "id" {
+				return nil // key of the resource items
+			}
+
+			unique := !multiValued && !sub.MultiValued() &&
+				(sub.Uniqueness() == spec.UniquenessServer || sub.Uniqueness() == spec.UniquenessGlobal)
+			_, annotated := sub.Annotation(AnnotationDynamoDBLookup)
+			_, byDefault := defaultLookups[sub.Path()]
+			if unique || annotated || byDefault {
+				lookups[sub.ID()] = &lookup{attr: sub, path: subPath, unique: unique}
+			}
+			return nil
+		})
+	}
+	collect(resourceType.SuperAttribute(true), nil, false)
+
+	return lookups
+}
+
+// Returns the distinct values of the attribute in the resource, in their string form (see value), in ascending order.
+func (l *lookup) valuesOf(resource *prop.Resource) []string {
+	values := make(map[string]struct{})
+
+	var collect func(property prop.Property, path []*spec.Attribute)
+	collect = func(property prop.Property, path []*spec.Attribute) {
+		if property.IsUnassigned() {
+			return
+		}
+		if property.Attribute().MultiValued() {
+			_ = property.ForEachChild(func(_ int, child prop.Property) error {
+				collect(child, path)
+				return nil
+			})
+			return
+		}
+		if len(path) == 0 {
+			values[l.value(property.Raw())] = struct{}{}
+			return
+		}
+		child, err := property.ChildAtIndex(path[0].Name())
+		if err != nil {
+			return
+		}
+		collect(child, path[1:])
+	}
+	collect(resource.RootProperty(), l.path)
+
+	sorted := make([]string, 0, len(values))
+	for value := range values {
+		sorted = append(sorted, value)
+	}
+	sort.Strings(sorted)
+	return sorted
+}
+
+// Returns the string form of the value, in lower case for attributes that compare case insensitively.
+func (l *lookup) value(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		if l.attr.Type() == spec.TypeString && !l.attr.CaseExact() {
+			return strings.ToLower(v)
+		}
+		if l.attr.Type() == spec.TypeDateTime {
+			if t, err := spec.ParseDateTime(v); err == nil {
+				return t.UTC().Format(spec.ISO8601)
+			}
+		}
+		return v
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// Returns the string form of the literal of an eq filter on the attribute, or false if the literal is not a value of
+// the attribute.
+func (l *lookup) valueOfLiteral(literal string) (string, bool) {
+	switch l.attr.Type() {
+	case spec.TypeString, spec.TypeReference, spec.TypeBinary, spec.TypeDateTime:
+		s, err := expr.Unquote(literal)
+		if err != nil {
+			return "", false
+		}
+		if l.attr.Type() == spec.TypeDateTime {
+			if _, err := spec.ParseDateTime(s); err != nil {
+				return "", false
+			}
+		}
+		return l.value(s), true
+	case spec.TypeInteger:
+		i64, err := strconv.ParseInt(literal, 10, 64)
+		if err != nil {
+			return "", false
+		}
+		return l.value(i64), true
+	case spec.TypeDecimal:
+		f64, err := strconv.ParseFloat(literal, 64)
+		if err != nil {
+			return "", false
+		}
+		return l.value(f64), true
+	case spec.TypeBoolean:
+		b, err := strconv.ParseBool(literal)
+		if err != nil {
+			return "", false
+		}
+		return l.value(b), true
+	default:
+		return "", false
+	}
+}
+
+// Returns the ids of the resources that may match the filter, in ascending order, by reading the lookup items, or false
+// if the filter cannot be served by lookups. The filter must still be evaluated on the resources of the ids, as lookups
+// through LookupIndex are eventually consistent, and may return more resources than those matched.
+func (d *dynamoDB) lookup(ctx context.Context, root *expr.Expression) ([]string, bool, error) {
+	ids, ok, err := d.lookupIDs(ctx, root)
+	if err != nil || !ok {
+		return nil, false, err
+	}
+
+	sorted := make([]string, 0, len(ids))
+	for id := range ids {
+		sorted = append(sorted, id)
+	}
+	sort.Strings(sorted)
+	return sorted, true, nil
+}
+
+func (d *dynamoDB) lookupIDs(ctx context.Context, root *expr.Expression) (map[string]struct{}, bool, error) {
+	if root == nil {
+		return nil, false, nil
+	}
+
+	switch strings.ToLower(root.Token()) {
+	case expr.And:
+		// Only one side is looked up, as the filter is evaluated on the candidates anyway.
+		if left, ok, err := d.lookupIDs(ctx, root.Left()); err != nil || ok {
+			return left, ok, err
+		}
+		return d.lookupIDs(ctx, root.Right())
+	case expr.Or:
+		if !d.canLookup(root.Left()) || !d.canLookup(root.Right()) {
+			return nil, false, nil
+		}
+		left, _, err := d.lookupIDs(ctx, root.Left())
+		if err != nil {
+			return nil, false, err
+		}
+		right, _, err := d.lookupIDs(ctx, root.Right())
+		if err != nil {
+			return nil, false, err
+		}
+		for id := range right {
+			left[id] = struct{}{}
+		}
+		return left, true, nil
+	case expr.Eq:
+		l, value, ok := d.lookupOf(root)
+		if !ok {
+			return nil, false, nil
+		}
+		if l.unique {
+			ids, err := d.lookupUnique(ctx, l, value)
+			return ids, true, err
+		}
+		ids, err := d.lookupValue(ctx, l, value)
+		return ids, true, err
+	default:
+		return nil, false, nil
+	}
+}
+
+// Returns true if lookupIDs can serve the filter, without reading the lookup items, so that the lookups of or filters
+// are not read in vain when any side cannot be served.
+func (d *dynamoDB) canLookup(root *expr.Expression) bool {
+	if root == nil {
+		return false
+	}
+	switch strings.ToLower(root.Token()) {
+	case expr.And:
+		return d.canLookup(root.Left()) || d.canLookup(root.Right())
+	case expr.Or:
+		return d.canLookup(root.Left()) && d.canLookup(root.Right())
+	case expr.Eq:
+		_, _, ok := d.lookupOf(root)
+		return ok
+	default:
+		return false
+	}
+}
+
+// Returns the lookup of the attribute of the eq filter, along with the string form of its literal, or false if there is
+// none.
+func (d *dynamoDB) lookupOf(eq *expr.Expression) (*lookup, string, bool) {
+	if !eq.IsRelationalOperator() {
+		return nil, "", false
+	}
+	l := d.lookupOfPath(eq.Left())
+	if l == nil {
+		return nil, "", false
+	}
+	value, ok := l.valueOfLiteral(eq.Right().Token())
+	if !ok {
+		return nil, "", false
+	}
+	return l, value, true
+}
+
+// Returns the lookup of the attribute of the path, or nil if there is none.
+func (d *dynamoDB) lookupOfPath(head *expr.Expression) *lookup {
+	if head == nil || head.ContainsFilter() {
+		return nil
+	}
+
+	cursor := head
+	if strings.EqualFold(cursor.Token(), d.resourceType.Schema().ID()) {
+		cursor = cursor.Next()
+	}
+
+	attr := d.resourceType.SuperAttribute(true)
+	for ; cursor != nil && attr != nil; cursor = cursor.Next() {
+		attr = attr.SubAttributeForName(cursor.Token())
+	}
+	if attr == nil {
+		return nil
+	}
+	return d.lookups[attr.ID()]
+}
+
+// Returns the id recorded by the unique item of the value, if any.
+func (d *dynamoDB) lookupUnique(ctx context.Context, l *lookup, value string) (map[string]struct{}, error) {
+	out, err := d.client.GetItemWithContext(ctx, &dynamodb.GetItemInput{
+		TableName:      aws.String(d.table),
+		Key:            d.uniqueKey(l, value),
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil {
+		return nil, errDatabase(err)
+	}
+
+	ids := make(map[string]struct{})
+	if id := out.Item[idAttribute]; id != nil && id.S != nil {
+		ids[*id.S] = struct{}{}
+	}
+	return ids, nil
+}
+
+// Returns the ids of the resources having lookup items of the value, queried through LookupIndex.
+func (d *dynamoDB) lookupValue(ctx context.Context, l *lookup, value string) (map[string]struct{}, error) {
+	ids := make(map[string]struct{})
+	err := d.client.QueryPagesWithContext(ctx, &dynamodb.QueryInput{
+		TableName:              aws.String(d.table),
+		IndexName:              aws.String(LookupIndex),
+		KeyConditionExpression: aws.String("#sk = :sk"),
+		ExpressionAttributeNames: map[string]*string{
+			"#sk": aws.String(skAttribute),
+			"#id": aws.String(idAttribute),
+		},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":sk": {S: aws.String(d.lookupSortKey(l, value))},
+		},
+		ProjectionExpression: aws.String("#id"),
+	}, func(out *dynamodb.QueryOutput, _ bool) bool {
+		for _, item := range out.Items {
+			if id := item[idAttribute]; id != nil && id.S != nil {
+				ids[*id.S] = struct{}{}
+			}
+		}
+		return true
+	})
+	if err != nil {
+		return nil, errDatabase(err)
+	}
+	return ids, nil
+}
@@ -0,0 +1,80 @@
+package v2
+
+import (
+	"context"
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+	"github.com/imulab/go-scim/pkg/v2/spec"
+)
+
+// LookupIndex is the name of the global secondary index of the table, which inverts the keys of the items, so that
+// items can be queried by their sort key: resources by their resource type, and lookup items by the attribute values
+// they carry.
+const LookupIndex = "lookup"
+
+// Names of the attributes of the items in the table.
+const (
+	pkAttribute      = "pk"
+	skAttribute      = "sk"
+	idAttribute      = "id"
+	versionAttribute = "version"
+	docAttribute     = "doc"
+)
+
+// CreateTableInput returns the input to create the table, which may be shared by many resource types. The table has a
+// string partition key "pk", a string sort key "sk", and the global secondary index LookupIndex with "sk" as its
+// partition key and "pk" as its sort key, projecting all attributes. The table is billed per request; callers may
+// change the input to provision capacity instead.
+func CreateTableInput(table string) *dynamodb.CreateTableInput {
+	return &dynamodb.CreateTableInput{
+		TableName: aws.String(table),
+		AttributeDefinitions: []*dynamodb.AttributeDefinition{
+			{AttributeName: aws.String(pkAttribute), AttributeType: aws.String(dynamodb.ScalarAttributeTypeS)},
+			{AttributeName: aws.String(skAttribute), AttributeType: aws.String(dynamodb.ScalarAttributeTypeS)},
+		},
+		KeySchema: []*dynamodb.KeySchemaElement{
+			{AttributeName: aws.String(pkAttribute), KeyType: aws.String(dynamodb.KeyTypeHash)},
+			{AttributeName: aws.String(skAttribute), KeyType: aws.String(dynamodb.KeyTypeRange)},
+		},
+		GlobalSecondaryIndexes: []*dynamodb.GlobalSecondaryIndex{
+			{
+				IndexName: aws.String(LookupIndex),
+				KeySchema: []*dynamodb.KeySchemaElement{
+					{AttributeName: aws.String(skAttribute), KeyType: aws.String(dynamodb.KeyTypeHash)},
+					{AttributeName: aws.String(pkAttribute), KeyType: aws.String(dynamodb.KeyTypeRange)},
+				},
+				Projection: &dynamodb.Projection{ProjectionType: aws.String(dynamodb.ProjectionTypeAll)},
+			},
+		},
+		BillingMode: aws.String(dynamodb.BillingModePayPerRequest),
+	}
+}
+
+// EnsureTable creates the table with the input of CreateTableInput unless it already exists, and waits until it is
+// active, so that it can be called every time the application starts.
+func EnsureTable(ctx context.Context, client dynamodbiface.DynamoDBAPI, table string) error {
+	if _, err := client.CreateTableWithContext(ctx, CreateTableInput(table)); err != nil {
+		if e, ok := err.(awserr.Error); !ok || e.Code() != dynamodb.ErrCodeResourceInUseException {
+			return errDatabase(err)
+		}
+	}
+	if err := client.WaitUntilTableExistsWithContext(ctx, &dynamodb.DescribeTableInput{TableName: aws.String(table)}); err != nil {
+		return fmt.Errorf("%w: table '%s' is not active: %v", spec.ErrInternal, table, err)
+	}
+	return nil
+}
+
+// Returns an error of spec.ErrConflict if err reports a request that failed because of concurrent requests on the
+// same items, which may succeed when retried; otherwise, returns an error of spec.ErrInternal.
+func errDatabase(err error) error {
+	if e, ok := err.(awserr.Error); ok {
+		switch e.Code() {
+		case dynamodb.ErrCodeTransactionConflictException, dynamodb.ErrCodeTransactionInProgressException:
+			return fmt.Errorf("%w: %s", spec.ErrConflict, e.Message())
+		}
+	}
+	return fmt.Errorf("%w: %v", spec.ErrInternal, err)
+}
@@ -0,0 +1,4 @@
+// This package mounts the SCIM handlers, i.e. the one of handlerutil.NewServer, on an Echo router, with the middleware
+// of Echo. The net/http middleware of the core module, i.e. that of the oauth package, is Echo middleware once wrapped
+// with echo.WrapMiddleware.
+package v2
@@ -0,0 +1,63 @@
+package v2
+
+import (
+	"context"
+	"github.com/labstack/echo/v4"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Router is the router to Mount on, i.e. *echo.Echo or *echo.Group.
+type Router interface {
+	Group(prefix string, middleware ...echo.MiddlewareFunc) *echo.Group
+}
+
+// Options configures Mount.
+type Options struct {
+	// Middleware are called, in order, before the SCIM handler, i.e. to authenticate the requests. Use
+	// echo.WrapMiddleware for the net/http middleware, i.e. oauth.Middleware.
+	Middleware []echo.MiddlewareFunc
+	// Context, if not nil, returns the context of the request handed to the SCIM handler, so that it carries what the
+	// middleware have resolved into the Echo context, i.e. the tenant of a path parameter of the prefix (see tenant.With).
+	// Otherwise, the context of the request is handed as is.
+	Context func(c echo.Context) context.Context
+}
+
+// Mount registers the handler on the router under the prefix, i.e. "/scim/v2", for all methods, so that the handler of
+// handlerutil.NewServer serves /scim/v2/Users. The handler is called with the path relative to the prefix, which may
+// have path parameters, i.e. "/tenants/:tenant/scim/v2", and be relative to a group. The errors the handler answers
+// with are written by the handler itself, hence bypass the HTTPErrorHandler of Echo.
+func Mount(router Router, prefix string, handler http.Handler, options Options) {
+	group := router.Group(strings.TrimSuffix(prefix, "/"))
+	serve := func(c echo.Context) error {
+		path := c.Param("*")
+		// Echo matches the escaped path, when there is one, and does not unescape the wildcard.
+		if len(c.Request().URL.RawPath) > 0 {
+			if unescaped, err := url.PathUnescape(path); err == nil {
+				path = unescaped
+			}
+		}
+
+		r := withPath(c.Request(), path)
+		if options.Context != nil {
+			r = r.WithContext(options.Context(c))
+		}
+		handler.ServeHTTP(c.Response(), r)
+		return nil
+	}
+	group.Any("", serve, options.Middleware...)
+	group.Any("/*", serve, options.Middleware...)
+}
+
+// Returns a shallow copy of the request, whose URL has the path.
+func withPath(r *http.Request, path string) *http.Request {
+	u := *r.URL
+	u.Path = "/" + strings.TrimPrefix(path, "/")
+	u.RawPath = ""
+
+	copied := new(http.Request)
+	*copied = *r
+	copied.URL = &u
+	return copied
+}
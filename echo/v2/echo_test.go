@@ -0,0 +1,158 @@
+package v2
+
+import (
+	"context"
+	"github.com/imulab/go-scim/pkg/v2/handlerutil"
+	"github.com/imulab/go-scim/pkg/v2/oauth"
+	"github.com/imulab/go-scim/pkg/v2/spec"
+	"github.com/imulab/go-scim/pkg/v2/tenant"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestMount(t *testing.T) {
+	// reports the path and the context it is called with
+	report := http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		rw.Header().Set("X-Path", r.URL.Path)
+		rw.Header().Set("X-Tenant", tenant.From(r.Context()))
+		if principal := oauth.From(r.Context()); principal != nil {
+			rw.Header().Set("X-Subject", principal.Subject)
+		}
+		rw.WriteHeader(http.StatusNoContent)
+	})
+	authenticated := echo.WrapMiddleware(func(next http.Handler) http.Handler {
+		return oauth.Middleware(oauth.Options{
+			Verifier: oauth.NewStaticTokens(&oauth.StaticToken{Token: "s3cret", Subject: "idp"}),
+		}, next)
+	})
+
+	tests := []struct {
+		name    string
+		mount   func(e *echo.Echo)
+		request func() *http.Request
+		expect  func(t *testing.T, rr *httptest.ResponseRecorder)
+	}{
+		{
+			name: "path relative to the prefix",
+			mount: func(e *echo.Echo) {
+				Mount(e, "/scim/v2/", report, Options{})
+			},
+			request: func() *http.Request {
+				return httptest.NewRequest(http.MethodDelete, "/scim/v2/Users/foo", nil)
+			},
+			expect: func(t *testing.T, rr *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusNoContent, rr.Code)
+				assert.Equal(t, "/Users/foo", rr.Header().Get("X-Path"))
+			},
+		},
+		{
+			name: "prefix itself",
+			mount: func(e *echo.Echo) {
+				Mount(e, "/scim", report, Options{})
+			},
+			request: func() *http.Request {
+				return httptest.NewRequest(http.MethodGet, "/scim", nil)
+			},
+			expect: func(t *testing.T, rr *httptest.ResponseRecorder) {
+				assert.Equal(t, "/", rr.Header().Get("X-Path"))
+			},
+		},
+		{
+			name: "escaped path",
+			mount: func(e *echo.Echo) {
+				Mount(e, "/scim", report, Options{})
+			},
+			request: func() *http.Request {
+				return httptest.NewRequest(http.MethodGet, "/scim/Users/a%2Fb", nil)
+			},
+			expect: func(t *testing.T, rr *httptest.ResponseRecorder) {
+				assert.Equal(t, "/Users/a/b", rr.Header().Get("X-Path"))
+			},
+		},
+		{
+			name: "prefix relative to a group",
+			mount: func(e *echo.Echo) {
+				Mount(e.Group("/api"), "/scim", report, Options{})
+			},
+			request: func() *http.Request {
+				return httptest.NewRequest(http.MethodGet, "/api/scim/Users", nil)
+			},
+			expect: func(t *testing.T, rr *httptest.ResponseRecorder) {
+				assert.Equal(t, "/Users", rr.Header().Get("X-Path"))
+			},
+		},
+		{
+			name: "context of path parameter",
+			mount: func(e *echo.Echo) {
+				Mount(e, "/tenants/:tenant/scim", report, Options{
+					Context: func(c echo.Context) context.Context {
+						return tenant.With(c.Request().Context(), c.Param("tenant"))
+					},
+				})
+			},
+			request: func() *http.Request {
+				return httptest.NewRequest(http.MethodGet, "/tenants/acme/scim/Groups", nil)
+			},
+			expect: func(t *testing.T, rr *httptest.ResponseRecorder) {
+				assert.Equal(t, "/Groups", rr.Header().Get("X-Path"))
+				assert.Equal(t, "acme", rr.Header().Get("X-Tenant"))
+			},
+		},
+		{
+			name: "authenticated by net/http middleware",
+			mount: func(e *echo.Echo) {
+				Mount(e, "/scim", report, Options{Middleware: []echo.MiddlewareFunc{authenticated}})
+			},
+			request: func() *http.Request {
+				r := httptest.NewRequest(http.MethodGet, "/scim/Users", nil)
+				r.Header.Set("Authorization", "Bearer s3cret")
+				return r
+			},
+			expect: func(t *testing.T, rr *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusNoContent, rr.Code)
+				assert.Equal(t, "idp", rr.Header().Get("X-Subject"))
+			},
+		},
+		{
+			name: "rejected by net/http middleware",
+			mount: func(e *echo.Echo) {
+				Mount(e, "/scim", report, Options{Middleware: []echo.MiddlewareFunc{authenticated}})
+			},
+			request: func() *http.Request {
+				return httptest.NewRequest(http.MethodGet, "/scim/Users", nil)
+			},
+			expect: func(t *testing.T, rr *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusUnauthorized, rr.Code)
+				assert.Empty(t, rr.Header().Get("X-Path"))
+			},
+		},
+		{
+			name: "SCIM server",
+			mount: func(e *echo.Echo) {
+				Mount(e, "/scim/v2", handlerutil.NewServer(handlerutil.ServerOptions{
+					ServiceProviderConfig: new(spec.ServiceProviderConfig),
+				}), Options{})
+			},
+			request: func() *http.Request {
+				return httptest.NewRequest(http.MethodGet, "/scim/v2/ServiceProviderConfig", nil)
+			},
+			expect: func(t *testing.T, rr *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusOK, rr.Code)
+				assert.Equal(t, spec.ApplicationScimJson, rr.Header().Get("Content-Type"))
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			e := echo.New()
+			test.mount(e)
+			rr := httptest.NewRecorder()
+			e.ServeHTTP(rr, test.request())
+			test.expect(t, rr)
+		})
+	}
+}
@@ -0,0 +1,111 @@
+package v2
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/imulab/go-scim/pkg/v2/spec"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+// client sends requests to the REST API of Elasticsearch and OpenSearch, which is common to both, so that no client
+// library of either is needed.
+type client struct {
+	url    string
+	http   *http.Client
+	header http.Header
+}
+
+func newClient(options Options) *client {
+	c := &client{url: strings.TrimSuffix(options.URL, "/"), http: options.Client, header: options.Header}
+	if c.http == nil {
+		c.http = http.DefaultClient
+	}
+	return c
+}
+
+// errorResponse is the body of responses of error.
+type errorResponse struct {
+	Error struct {
+		Type   string `json:"type"`
+		Reason string `json:"reason"`
+	} `json:"error"`
+}
+
+// Sends the request and decodes the response body into out, if not nil. The body is sent as JSON, unless it is a
+// []byte, which is sent as NDJSON as required by the bulk API. Responses of status 400 and above are returned as an
+// error of spec.ErrInternal, unless the status is accepted, in which case the caller handles the response.
+func (c *client) do(ctx context.Context, method string, path string, body interface{}, out interface{}, accept ...int) (int, error) {
+	var (
+		reader      io.Reader
+		contentType = "application/json"
+	)
+	switch b := body.(type) {
+	case nil:
+	case []byte:
+		reader, contentType = bytes.NewReader(b), "application/x-ndjson"
+	default:
+		raw, err := json.Marshal(b)
+		if err != nil {
+			return 0, fmt.Errorf("%w: %v", spec.ErrInternal, err)
+		}
+		reader = bytes.NewReader(raw)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.url+path, reader)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %v", spec.ErrInternal, err)
+	}
+	for k, v := range c.header {
+		req.Header[k] = v
+	}
+	if reader != nil {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return 0, errElastic(err)
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	raw, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return resp.StatusCode, errElastic(err)
+	}
+
+	if resp.StatusCode >= 400 && !accepted(resp.StatusCode, accept) {
+		var e errorResponse
+		if err := json.Unmarshal(raw, &e); err != nil || len(e.Error.Type) == 0 {
+			return resp.StatusCode, fmt.Errorf("%w: %s %s responded %d", spec.ErrInternal, method, path, resp.StatusCode)
+		}
+		return resp.StatusCode, fmt.Errorf("%w: %s %s responded %d: %s: %s", spec.ErrInternal, method, path,
+			resp.StatusCode, e.Error.Type, e.Error.Reason)
+	}
+
+	if out != nil && len(raw) > 0 {
+		if err := json.Unmarshal(raw, out); err != nil {
+			return resp.StatusCode, errElastic(err)
+		}
+	}
+	return resp.StatusCode, nil
+}
+
+func accepted(status int, accept []int) bool {
+	for _, each := range accept {
+		if each == status {
+			return true
+		}
+	}
+	return false
+}
+
+func errElastic(err error) error {
+	return fmt.Errorf("%w: %v", spec.ErrInternal, err)
+}
@@ -0,0 +1,380 @@
+package v2
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/imulab/go-scim/pkg/v2/crud"
+	"github.com/imulab/go-scim/pkg/v2/crud/translate"
+	"github.com/imulab/go-scim/pkg/v2/db"
+	"github.com/imulab/go-scim/pkg/v2/prop"
+	"github.com/imulab/go-scim/pkg/v2/spec"
+	"net/http"
+	"net/url"
+	"sync"
+)
+
+// DefaultMaxResults is the number of hits of queries that are not paginated, unless set by Options. It is the default
+// limit of from + size of the search API (index.max_result_window).
+const DefaultMaxResults = 10000
+
+// Options are the options of DB and EnsureIndex.
+type Options struct {
+	// URL is the base URL of the cluster, i.e. "http://localhost:9200".
+	URL string
+	// Index is the name of the index mirroring the resources.
+	Index string
+	// Client sends the requests, or http.DefaultClient when nil. TLS is configured with its transport.
+	Client *http.Client
+	// Header holds the headers added to every request, i.e. the "Authorization" header of basic authentication or of
+	// API keys.
+	Header http.Header
+	// Refresh makes the writes wait for the mirrored documents to become visible to searches (refresh=wait_for), so
+	// that clients query what they have just written, at the expense of the latency of writes.
+	Refresh bool
+	// MaxResults is the number of hits of queries that are not paginated, or DefaultMaxResults when not positive.
+	MaxResults int
+	// OnError, if not nil, is called with the errors of mirroring the writes. These errors do not fail the writes, as
+	// the resources are already written to the primary database; the documents are fixed by Reindex.
+	OnError func(err error)
+}
+
+// DB returns a db.DB implementation that mirrors the resources of the resource type written to the primary database
+// into an index of Elasticsearch or OpenSearch, which shall have been created by EnsureIndex, and uses the index as the
+// query backend, i.e. for substring filters on display names and emails, which most databases cannot serve with their
+// indexes. The primary database remains the source of truth.
+//
+// Insert, Replace and Delete write to the primary database, and then index, or delete, the document of the resource.
+// Get goes to the primary database. Query and Count are translated into the query DSL (see translate.ElasticCompiler)
+// and served by the search API, and the resources of the hits are then got from the primary database in the order of
+// the hits, leaving out those it no longer has. Since the index is refreshed periodically, resources just written may
+// not be found unless Options.Refresh is set, and since mirroring follows the writes, a document may briefly outlive
+// its resource, or predate it.
+//
+// Writes within a transaction (see WithTx) are mirrored once the transaction is committed, and not at all if it is
+// rolled back. The returned DB implements db.BatchDB, db.BulkWriteDB, whose writes are mirrored with the bulk API,
+// db.TxDB, which calls WithTx on the primary database, and db.ChangeStreamDB, which subscribes to the changes of the
+// primary database.
+func DB(resourceType *spec.ResourceType, primary db.DB, options Options) db.DB {
+	if options.MaxResults <= 0 {
+		options.MaxResults = DefaultMaxResults
+	}
+	return &elasticDB{
+		primary:  primary,
+		client:   newClient(options),
+		compiler: translate.ElasticCompiler(resourceType),
+		path:     "/" + url.PathEscape(options.Index),
+		options:  options,
+	}
+}
+
+// Reindex indexes the documents of all resources of the primary database of the DB returned by DB (see db.Walk), a page
+// at a time, and returns the number of documents indexed. It fills a new index, and fixes the documents whose writes
+// were not mirrored. Documents of the resources deleted other than through the DB are not removed, which requires to
+// recreate the index. An error of spec.ErrInternal is returned if the database is not returned by DB.
+func Reindex(ctx context.Context, database db.DB, pageSize int) (int, error) {
+	d, ok := database.(*elasticDB)
+	if !ok {
+		return 0, fmt.Errorf("%w: database does not mirror into elasticsearch", spec.ErrInternal)
+	}
+
+	indexed := 0
+	err := db.Walk(ctx, d.primary, "", pageSize, func(ctx context.Context, page []*prop.Resource) error {
+		ops := make([]operation, 0, len(page))
+		for _, resource := range page {
+			ops = append(ops, d.index(resource))
+		}
+		if err := d.bulk(ctx, ops); err != nil {
+			return err
+		}
+		indexed += len(page)
+		return nil
+	})
+	return indexed, err
+}
+
+type (
+	elasticDB struct {
+		primary  db.DB
+		client   *client
+		compiler translate.Elastic
+		path     string // of the index
+		options  Options
+	}
+	// operation is a write of a document, to be mirrored.
+	operation struct {
+		db  *elasticDB
+		id  string
+		doc map[string]interface{} // nil for deletion
+	}
+	// pending holds the operations of a transaction until it is committed.
+	pending struct {
+		sync.Mutex
+		ops []operation
+	}
+	pendingKey struct{}
+)
+
+func (d *elasticDB) Insert(ctx context.Context, resource *prop.Resource) error {
+	if err := d.primary.Insert(ctx, resource); err != nil {
+		return err
+	}
+	d.mirror(ctx, d.index(resource))
+	return nil
+}
+
+func (d *elasticDB) Count(ctx context.Context, filter string) (int, error) {
+	search, err := d.compiler.Compile(filter, nil, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	var resp struct {
+		Count int `json:"count"`
+	}
+	if _, err := d.client.do(ctx, http.MethodPost, d.path+"/_count", map[string]interface{}{"query": search.Query}, &resp); err != nil {
+		return 0, err
+	}
+	return resp.Count, nil
+}
+
+func (d *elasticDB) Get(ctx context.Context, id string, projection *crud.Projection) (*prop.Resource, error) {
+	return d.primary.Get(ctx, id, projection)
+}
+
+func (d *elasticDB) GetMany(ctx context.Context, ids []string, projection *crud.Projection) ([]*prop.Resource, error) {
+	return db.GetMany(ctx, d.primary, ids, projection)
+}
+
+func (d *elasticDB) Replace(ctx context.Context, ref *prop.Resource, replacement *prop.Resource) error {
+	if err := d.primary.Replace(ctx, ref, replacement); err != nil {
+		return err
+	}
+	d.mirror(ctx, d.index(replacement))
+	return nil
+}
+
+func (d *elasticDB) Delete(ctx context.Context, resource *prop.Resource) error {
+	if err := d.primary.Delete(ctx, resource); err != nil {
+		return err
+	}
+	d.mirror(ctx, operation{db: d, id: resource.IdOrEmpty()})
+	return nil
+}
+
+func (d *elasticDB) Query(ctx context.Context, filter string, sort *crud.Sort, pagination *crud.Pagination, projection *crud.Projection) ([]*prop.Resource, error) {
+	search, err := d.compiler.Compile(filter, sort, pagination)
+	if err != nil {
+		return nil, err
+	}
+
+	body := search.Body()
+	if search.Size < 0 {
+		body["size"] = d.options.MaxResults
+	}
+	body["_source"] = false
+
+	var resp struct {
+		Hits struct {
+			Hits []struct {
+				ID string `json:"_id"`
+			} `json:"hits"`
+		} `json:"hits"`
+	}
+	if _, err := d.client.do(ctx, http.MethodPost, d.path+"/_search", body, &resp); err != nil {
+		return nil, err
+	}
+
+	ids := make([]string, 0, len(resp.Hits.Hits))
+	for _, hit := range resp.Hits.Hits {
+		ids = append(ids, hit.ID)
+	}
+	resources, err := db.GetMany(ctx, d.primary, ids, projection)
+	if err != nil {
+		return nil, err
+	}
+	return db.SortByIDs(resources, ids), nil
+}
+
+func (d *elasticDB) InsertMany(ctx context.Context, resources []*prop.Resource) []error {
+	errs := db.InsertMany(ctx, d.primary, resources)
+	ops := make([]operation, 0, len(resources))
+	for i, resource := range resources {
+		if errs[i] == nil {
+			ops = append(ops, d.index(resource))
+		}
+	}
+	d.mirror(ctx, ops...)
+	return errs
+}
+
+func (d *elasticDB) ReplaceMany(ctx context.Context, replacements []db.Replacement) []error {
+	errs := db.ReplaceMany(ctx, d.primary, replacements)
+	ops := make([]operation, 0, len(replacements))
+	for i, replacement := range replacements {
+		if errs[i] == nil {
+			ops = append(ops, d.index(replacement.Replacement))
+		}
+	}
+	d.mirror(ctx, ops...)
+	return errs
+}
+
+func (d *elasticDB) DeleteMany(ctx context.Context, resources []*prop.Resource) []error {
+	errs := db.DeleteMany(ctx, d.primary, resources)
+	ops := make([]operation, 0, len(resources))
+	for i, resource := range resources {
+		if errs[i] == nil {
+			ops = append(ops, operation{db: d, id: resource.IdOrEmpty()})
+		}
+	}
+	d.mirror(ctx, ops...)
+	return errs
+}
+
+// WithTx calls fn in a transaction of the primary database, and mirrors the writes of the transaction once fn returns
+// without error. Mirroring is left to the outermost transaction, when nested.
+func (d *elasticDB) WithTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	if _, ok := ctx.Value(pendingKey{}).(*pending); ok {
+		return db.WithTx(ctx, d.primary, fn)
+	}
+
+	p := new(pending)
+	if err := db.WithTx(context.WithValue(ctx, pendingKey{}, p), d.primary, fn); err != nil {
+		return err
+	}
+	apply(ctx, p.ops)
+	return nil
+}
+
+func (d *elasticDB) Subscribe(ctx context.Context, fn func(ctx context.Context, change *db.Change) error) error {
+	return db.Subscribe(ctx, d.primary, fn)
+}
+
+// Returns the operation indexing the document of the resource.
+func (d *elasticDB) index(resource *prop.Resource) operation {
+	return operation{db: d, id: resource.IdOrEmpty(), doc: documentOf(resource)}
+}
+
+// Mirrors the operations, or holds them until the transaction of the context, if any, is committed.
+func (d *elasticDB) mirror(ctx context.Context, ops ...operation) {
+	if len(ops) == 0 {
+		return
+	}
+	if p, ok := ctx.Value(pendingKey{}).(*pending); ok {
+		p.Lock()
+		p.ops = append(p.ops, ops...)
+		p.Unlock()
+		return
+	}
+	apply(ctx, ops)
+}
+
+// Sends the operations to the databases they belong to, which may be several when transactions span resource types,
+// and passes the errors to the OnError of the database.
+func apply(ctx context.Context, ops []operation) {
+	var (
+		order = make([]*elasticDB, 0, 1)
+		byDB  = make(map[*elasticDB][]operation)
+	)
+	for _, op := range ops {
+		if _, ok := byDB[op.db]; !ok {
+			order = append(order, op.db)
+		}
+		byDB[op.db] = append(byDB[op.db], op)
+	}
+	for _, d := range order {
+		var err error
+		if ops := byDB[d]; len(ops) == 1 {
+			err = d.write(ctx, ops[0])
+		} else {
+			err = d.bulk(ctx, ops)
+		}
+		if err != nil && d.options.OnError != nil {
+			d.options.OnError(err)
+		}
+	}
+}
+
+// Sends the operation with the document API. Deleting a document that is not indexed is not an error.
+func (d *elasticDB) write(ctx context.Context, op operation) error {
+	path := d.path + "/_doc/" + url.PathEscape(op.id) + d.refresh()
+	if op.doc == nil {
+		_, err := d.client.do(ctx, http.MethodDelete, path, nil, nil, http.StatusNotFound)
+		return err
+	}
+	_, err := d.client.do(ctx, http.MethodPut, path, op.doc, nil)
+	return err
+}
+
+// Sends the operations with the bulk API, and returns an error of spec.ErrInternal describing the first operation that
+// failed, if any. Deleting a document that is not indexed is not an error.
+func (d *elasticDB) bulk(ctx context.Context, ops []operation) error {
+	if len(ops) == 0 {
+		return nil
+	}
+
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	for _, op := range ops {
+		action := "index"
+		if op.doc == nil {
+			action = "delete"
+		}
+		if err := encoder.Encode(map[string]interface{}{action: map[string]interface{}{"_id": op.id}}); err != nil {
+			return fmt.Errorf("%w: %v", spec.ErrInternal, err)
+		}
+		if op.doc != nil {
+			if err := encoder.Encode(op.doc); err != nil {
+				return fmt.Errorf("%w: %v", spec.ErrInternal, err)
+			}
+		}
+	}
+
+	var resp struct {
+		Errors bool `json:"errors"`
+		Items  []map[string]struct {
+			ID     string `json:"_id"`
+			Status int    `json:"status"`
+			Cause  *struct {
+				Type   string `json:"type"`
+				Reason string `json:"reason"`
+			} `json:"error"`
+		} `json:"items"`
+	}
+	if _, err := d.client.do(ctx, http.MethodPost, d.path+"/_bulk"+d.refresh(), buf.Bytes(), &resp); err != nil {
+		return err
+	}
+	if !resp.Errors {
+		return nil
+	}
+	for _, item := range resp.Items {
+		for action, result := range item {
+			if result.Status < 300 || (action == "delete" && result.Status == http.StatusNotFound) {
+				continue
+			}
+			if result.Cause != nil {
+				return fmt.Errorf("%w: %s of document '%s' responded %d: %s: %s", spec.ErrInternal, action, result.ID,
+					result.Status, result.Cause.Type, result.Cause.Reason)
+			}
+			return fmt.Errorf("%w: %s of document '%s' responded %d", spec.ErrInternal, action, result.ID, result.Status)
+		}
+	}
+	return nil
+}
+
+// Returns the query string of writes.
+func (d *elasticDB) refresh() string {
+	if d.options.Refresh {
+		return "?refresh=wait_for"
+	}
+	return ""
+}
+
+var (
+	_ db.BatchDB        = (*elasticDB)(nil)
+	_ db.BulkWriteDB    = (*elasticDB)(nil)
+	_ db.TxDB           = (*elasticDB)(nil)
+	_ db.ChangeStreamDB = (*elasticDB)(nil)
+)
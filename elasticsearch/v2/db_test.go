@@ -0,0 +1,364 @@
+package v2
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/imulab/go-scim/pkg/v2/crud"
+	"github.com/imulab/go-scim/pkg/v2/db"
+	scimjson "github.com/imulab/go-scim/pkg/v2/json"
+	"github.com/imulab/go-scim/pkg/v2/prop"
+	"github.com/imulab/go-scim/pkg/v2/spec"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestElasticDatabase(t *testing.T) {
+	s := new(ElasticDatabaseTestSuite)
+	suite.Run(t, s)
+}
+
+type ElasticDatabaseTestSuite struct {
+	suite.Suite
+	resourceType *spec.ResourceType
+}
+
+func (s *ElasticDatabaseTestSuite) TestDocument() {
+	doc := documentOf(s.user(`{
+		"schemas": ["urn:ietf:params:scim:schemas:core:2.0:User", "urn:ietf:params:scim:schemas:extension:enterprise:2.0:User"],
+		"id": "user001",
+		"userName": "foo",
+		"password": "s3cret",
+		"emails": [{"value": "foo@bar.com", "primary": true}],
+		"urn:ietf:params:scim:schemas:extension:enterprise:2.0:User": {"employeeNumber": "42"}
+	}`))
+	raw, err := json.Marshal(doc)
+	require.Nil(s.T(), err)
+	assert.JSONEq(s.T(), `{
+		"schemas": ["urn:ietf:params:scim:schemas:core:2.0:User", "urn:ietf:params:scim:schemas:extension:enterprise:2.0:User"],
+		"id": "user001",
+		"userName": "foo",
+		"emails": [{"value": "foo@bar.com", "primary": true}],
+		"urn:ietf:params:scim:schemas:extension:enterprise:2.0:User": {"employeeNumber": "42"}
+	}`, string(raw))
+}
+
+func (s *ElasticDatabaseTestSuite) TestMapping() {
+	properties := Mapping(s.resourceType)["mappings"].(map[string]interface{})["properties"].(map[string]interface{})
+	assert.Equal(s.T(), map[string]interface{}{"type": "keyword", "ignore_above": 8191}, properties["id"])
+	assert.Equal(s.T(), map[string]interface{}{"type": "keyword", "ignore_above": 8191, "normalizer": lowercaseNormalizer}, properties["userName"])
+	assert.Equal(s.T(), map[string]interface{}{"type": "boolean"}, properties["active"])
+	assert.NotContains(s.T(), properties, "password")
+
+	emails := properties["emails"].(map[string]interface{})["properties"].(map[string]interface{})
+	assert.Equal(s.T(), map[string]interface{}{"type": "keyword", "ignore_above": 8191, "normalizer": lowercaseNormalizer}, emails["value"])
+
+	meta := properties["meta"].(map[string]interface{})["properties"].(map[string]interface{})
+	assert.Equal(s.T(), "date", meta["lastModified"].(map[string]interface{})["type"])
+}
+
+func (s *ElasticDatabaseTestSuite) TestEnsureIndex() {
+	server := newFakeServer(func(r *http.Request) (int, string) {
+		if r.URL.Path == "/users" {
+			return http.StatusBadRequest, `{"error": {"type": "resource_already_exists_exception", "reason": "index [users] already exists"}}`
+		}
+		return http.StatusOK, `{"acknowledged": true}`
+	})
+	defer server.Close()
+
+	require.Nil(s.T(), EnsureIndex(context.Background(), s.resourceType, Options{URL: server.URL, Index: "users"}))
+	requests := server.requests()
+	require.Len(s.T(), requests, 2)
+	assert.Equal(s.T(), "PUT /users", requests[0].line)
+	assert.Contains(s.T(), requests[0].body, `"normalizer":{"scim_lowercase"`)
+	assert.Equal(s.T(), "PUT /users/_mapping", requests[1].line)
+	assert.Contains(s.T(), requests[1].body, `"dynamic":false`)
+
+	// other errors are returned
+	failing := newFakeServer(func(r *http.Request) (int, string) {
+		return http.StatusBadRequest, `{"error": {"type": "mapper_parsing_exception", "reason": "failed to parse mapping"}}`
+	})
+	defer failing.Close()
+	err := EnsureIndex(context.Background(), s.resourceType, Options{URL: failing.URL, Index: "users"})
+	assert.True(s.T(), errors.Is(err, spec.ErrInternal))
+	assert.Contains(s.T(), err.Error(), "mapper_parsing_exception")
+}
+
+func (s *ElasticDatabaseTestSuite) TestMirror() {
+	server := newFakeServer(nil)
+	defer server.Close()
+	database := DB(s.resourceType, db.Memory(), Options{URL: server.URL, Index: "users", Refresh: true})
+	ctx := context.Background()
+
+	foo := s.user(`{"schemas": ["urn:ietf:params:scim:schemas:core:2.0:User"], "id": "user001", "userName": "foo", "meta": {"version": "1"}}`)
+	require.Nil(s.T(), database.Insert(ctx, foo))
+	bar := s.user(`{"schemas": ["urn:ietf:params:scim:schemas:core:2.0:User"], "id": "user001", "userName": "bar", "meta": {"version": "2"}}`)
+	require.Nil(s.T(), database.Replace(ctx, foo, bar))
+	require.Nil(s.T(), database.Delete(ctx, bar))
+
+	// writes failing on the primary database are not mirrored
+	assert.True(s.T(), errors.Is(database.Delete(ctx, bar), spec.ErrNotFound))
+
+	requests := server.requests()
+	require.Len(s.T(), requests, 3)
+	assert.Equal(s.T(), "PUT /users/_doc/user001?refresh=wait_for", requests[0].line)
+	assert.JSONEq(s.T(), `{"schemas": ["urn:ietf:params:scim:schemas:core:2.0:User"], "id": "user001", "userName": "foo", "meta": {"version": "1"}}`, requests[0].body)
+	assert.Equal(s.T(), "PUT /users/_doc/user001?refresh=wait_for", requests[1].line)
+	assert.Contains(s.T(), requests[1].body, `"userName":"bar"`)
+	assert.Equal(s.T(), "DELETE /users/_doc/user001?refresh=wait_for", requests[2].line)
+}
+
+func (s *ElasticDatabaseTestSuite) TestMirrorError() {
+	server := newFakeServer(func(r *http.Request) (int, string) {
+		return http.StatusServiceUnavailable, `{"error": {"type": "cluster_block_exception", "reason": "blocked"}}`
+	})
+	defer server.Close()
+
+	var errs []error
+	primary := db.Memory()
+	database := DB(s.resourceType, primary, Options{URL: server.URL, Index: "users", OnError: func(err error) {
+		errs = append(errs, err)
+	}})
+
+	require.Nil(s.T(), database.Insert(context.Background(), s.user(`{"schemas": ["urn:ietf:params:scim:schemas:core:2.0:User"], "id": "user001", "userName": "foo"}`)))
+	_, err := primary.Get(context.Background(), "user001", nil)
+	assert.Nil(s.T(), err)
+	require.Len(s.T(), errs, 1)
+	assert.True(s.T(), errors.Is(errs[0], spec.ErrInternal))
+	assert.Contains(s.T(), errs[0].Error(), "cluster_block_exception")
+}
+
+func (s *ElasticDatabaseTestSuite) TestQuery() {
+	server := newFakeServer(func(r *http.Request) (int, string) {
+		switch r.URL.Path {
+		case "/users/_search":
+			return http.StatusOK, `{"hits": {"hits": [{"_id": "user002"}, {"_id": "gone"}, {"_id": "user001"}]}}`
+		case "/users/_count":
+			return http.StatusOK, `{"count": 3}`
+		default:
+			return http.StatusOK, `{}`
+		}
+	})
+	defer server.Close()
+	database := DB(s.resourceType, db.Memory(), Options{URL: server.URL, Index: "users"})
+	ctx := context.Background()
+
+	for _, raw := range []string{
+		`{"schemas": ["urn:ietf:params:scim:schemas:core:2.0:User"], "id": "user001", "userName": "alice", "emails": [{"value": "alice@foo.com"}]}`,
+		`{"schemas": ["urn:ietf:params:scim:schemas:core:2.0:User"], "id": "user002", "userName": "bob", "emails": [{"value": "bob@foo.com"}]}`,
+	} {
+		require.Nil(s.T(), database.Insert(ctx, s.user(raw)))
+	}
+
+	results, err := database.Query(ctx, `emails.value ew "@FOO.com"`, nil, nil, nil)
+	require.Nil(s.T(), err)
+	require.Len(s.T(), results, 2)
+	assert.Equal(s.T(), "user002", results[0].IdOrEmpty())
+	assert.Equal(s.T(), "user001", results[1].IdOrEmpty())
+
+	results, err = database.Query(ctx, `userName co "o"`, &crud.Sort{By: "userName"}, &crud.Pagination{StartIndex: 1, Count: 10}, nil)
+	require.Nil(s.T(), err)
+	assert.Len(s.T(), results, 2)
+
+	n, err := database.Count(ctx, `userName sw "A"`)
+	require.Nil(s.T(), err)
+	assert.Equal(s.T(), 3, n)
+
+	_, err = database.Query(ctx, `foo eq "bar"`, nil, nil, nil)
+	assert.True(s.T(), errors.Is(err, spec.ErrInvalidFilter))
+
+	requests := server.requests()
+	require.Len(s.T(), requests, 5)
+	assert.Equal(s.T(), "POST /users/_search", requests[2].line)
+	assert.JSONEq(s.T(), `{
+		"query": {"bool": {"filter": {"wildcard": {"emails.value": {"value": "*@foo.com"}}}}},
+		"size": 10000,
+		"_source": false
+	}`, requests[2].body)
+	assert.JSONEq(s.T(), `{
+		"query": {"bool": {"filter": {"wildcard": {"userName": {"value": "*o*"}}}}},
+		"sort": [{"userName": {"order": "asc", "missing": "_last"}}, {"id": {"order": "asc"}}],
+		"from": 0,
+		"size": 10,
+		"_source": false
+	}`, requests[3].body)
+	assert.Equal(s.T(), "POST /users/_count", requests[4].line)
+	assert.JSONEq(s.T(), `{"query": {"bool": {"filter": {"prefix": {"userName": {"value": "a"}}}}}}`, requests[4].body)
+}
+
+func (s *ElasticDatabaseTestSuite) TestTransaction() {
+	server := newFakeServer(func(r *http.Request) (int, string) {
+		if r.URL.Path == "/users/_bulk" {
+			return http.StatusOK, `{"errors": true, "items": [{"index": {"_id": "user001", "status": 201}}, {"delete": {"_id": "user002", "status": 404}}]}`
+		}
+		return http.StatusOK, `{}`
+	})
+	defer server.Close()
+
+	var errs []error
+	database := DB(s.resourceType, db.Memory(), Options{URL: server.URL, Index: "users", OnError: func(err error) {
+		errs = append(errs, err)
+	}})
+	ctx := context.Background()
+	bar := s.user(`{"schemas": ["urn:ietf:params:scim:schemas:core:2.0:User"], "id": "user002", "userName": "bar"}`)
+
+	err := db.WithTx(ctx, database, func(ctx context.Context) error {
+		require.Nil(s.T(), database.Insert(ctx, s.user(`{"schemas": ["urn:ietf:params:scim:schemas:core:2.0:User"], "id": "user001", "userName": "foo"}`)))
+		require.Nil(s.T(), database.Insert(ctx, bar))
+		require.Nil(s.T(), database.Delete(ctx, bar))
+		assert.Empty(s.T(), server.requests())
+		return nil
+	})
+	require.Nil(s.T(), err)
+
+	requests := server.requests()
+	require.Len(s.T(), requests, 1)
+	assert.Equal(s.T(), "POST /users/_bulk", requests[0].line)
+	lines := strings.Split(strings.TrimSpace(requests[0].body), "\n")
+	require.Len(s.T(), lines, 5)
+	assert.JSONEq(s.T(), `{"index": {"_id": "user001"}}`, lines[0])
+	assert.JSONEq(s.T(), `{"index": {"_id": "user002"}}`, lines[2])
+	assert.JSONEq(s.T(), `{"delete": {"_id": "user002"}}`, lines[4])
+	// deleting a document not indexed is not an error
+	assert.Empty(s.T(), errs)
+
+	// writes of transactions rolled back are not mirrored
+	rollback := errors.New("rollback")
+	err = db.WithTx(ctx, database, func(ctx context.Context) error {
+		_ = database.Delete(ctx, bar)
+		return rollback
+	})
+	assert.Equal(s.T(), rollback, err)
+	assert.Len(s.T(), server.requests(), 1)
+}
+
+func (s *ElasticDatabaseTestSuite) TestReindex() {
+	server := newFakeServer(func(r *http.Request) (int, string) {
+		return http.StatusOK, `{"errors": true, "items": [{"index": {"_id": "user001", "status": 201}}, {"index": {"_id": "user002", "status": 400, "error": {"type": "mapper_parsing_exception", "reason": "failed to parse"}}}]}`
+	})
+	defer server.Close()
+
+	primary := db.Memory()
+	for _, raw := range []string{
+		`{"schemas": ["urn:ietf:params:scim:schemas:core:2.0:User"], "id": "user001", "userName": "foo"}`,
+		`{"schemas": ["urn:ietf:params:scim:schemas:core:2.0:User"], "id": "user002", "userName": "bar"}`,
+	} {
+		require.Nil(s.T(), primary.Insert(context.Background(), s.user(raw)))
+	}
+
+	database := DB(s.resourceType, primary, Options{URL: server.URL, Index: "users"})
+	n, err := Reindex(context.Background(), database, 10)
+	assert.Equal(s.T(), 0, n)
+	assert.True(s.T(), errors.Is(err, spec.ErrInternal))
+	assert.Contains(s.T(), err.Error(), "index of document 'user002' responded 400: mapper_parsing_exception")
+
+	requests := server.requests()
+	require.Len(s.T(), requests, 1)
+	assert.Equal(s.T(), "POST /users/_bulk", requests[0].line)
+	assert.Len(s.T(), strings.Split(strings.TrimSpace(requests[0].body), "\n"), 4)
+
+	_, err = Reindex(context.Background(), primary, 10)
+	assert.True(s.T(), errors.Is(err, spec.ErrInternal))
+}
+
+func (s *ElasticDatabaseTestSuite) user(raw string) *prop.Resource {
+	resource := prop.NewResource(s.resourceType)
+	require.Nil(s.T(), scimjson.Deserialize([]byte(raw), resource))
+	return resource
+}
+
+func (s *ElasticDatabaseTestSuite) SetupSuite() {
+	for _, each := range []struct {
+		filepath  string
+		structure interface{}
+		post      func(parsed interface{})
+	}{
+		{
+			filepath:  "../../public/schemas/core_schema.json",
+			structure: new(spec.Schema),
+			post: func(parsed interface{}) {
+				spec.Schemas().Register(parsed.(*spec.Schema))
+			},
+		},
+		{
+			filepath:  "../../public/schemas/user_schema.json",
+			structure: new(spec.Schema),
+			post: func(parsed interface{}) {
+				spec.Schemas().Register(parsed.(*spec.Schema))
+			},
+		},
+		{
+			filepath:  "../../public/schemas/user_enterprise_extension_schema.json",
+			structure: new(spec.Schema),
+			post: func(parsed interface{}) {
+				spec.Schemas().Register(parsed.(*spec.Schema))
+			},
+		},
+		{
+			filepath:  "../../public/resource_types/user_resource_type.json",
+			structure: new(spec.ResourceType),
+			post: func(parsed interface{}) {
+				s.resourceType = parsed.(*spec.ResourceType)
+				crud.Register(s.resourceType)
+			},
+		},
+	} {
+		f, err := os.Open(each.filepath)
+		require.Nil(s.T(), err)
+
+		raw, err := ioutil.ReadAll(f)
+		require.Nil(s.T(), err)
+
+		err = json.Unmarshal(raw, each.structure)
+		require.Nil(s.T(), err)
+
+		if each.post != nil {
+			each.post(each.structure)
+		}
+	}
+}
+
+// fakeServer records the requests, and responds with the respond function, or with an empty object when it is nil.
+type fakeServer struct {
+	*httptest.Server
+	mu       sync.Mutex
+	recorded []recordedRequest
+}
+
+type recordedRequest struct {
+	line string // method and request URI
+	body string
+}
+
+func newFakeServer(respond func(r *http.Request) (int, string)) *fakeServer {
+	f := new(fakeServer)
+	f.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		f.mu.Lock()
+		f.recorded = append(f.recorded, recordedRequest{line: r.Method + " " + r.URL.RequestURI(), body: string(body)})
+		f.mu.Unlock()
+
+		status, response := http.StatusOK, `{}`
+		if respond != nil {
+			status, response = respond(r)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte(response))
+	}))
+	return f
+}
+
+func (f *fakeServer) requests() []recordedRequest {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]recordedRequest{}, f.recorded...)
+}
@@ -0,0 +1,4 @@
+// This package provides a db.DB implementation that mirrors the resources of another database into an index of
+// Elasticsearch or OpenSearch, and serves filters, sort and pagination with the search API, while the other database
+// remains the source of truth of the resources returned.
+package v2
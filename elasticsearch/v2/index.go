@@ -0,0 +1,108 @@
+package v2
+
+import (
+	"context"
+	"fmt"
+	"github.com/imulab/go-scim/pkg/v2/prop"
+	"github.com/imulab/go-scim/pkg/v2/spec"
+	"net/http"
+	"net/url"
+)
+
+// Name of the normalizer that lowers the values of strings that are not caseExact.
+const lowercaseNormalizer = "scim_lowercase"
+
+// Mapping returns the body of the request creating the index of the resource type, i.e. "PUT /<index>", which defines
+// the lower case normalizer and maps every attribute of the resource type, except those never returned, to a field
+// named as returned by translate.ElasticField. Strings, references and binaries are keyword fields, normalized to lower
+// case for strings that are not caseExact; dateTime attributes are date fields; complex attributes, whether multiValued
+// or not, are object fields. Dynamic mapping is turned off, so that the documents are not mapped otherwise.
+func Mapping(resourceType *spec.ResourceType) map[string]interface{} {
+	return map[string]interface{}{
+		"settings": map[string]interface{}{
+			"analysis": map[string]interface{}{
+				"normalizer": map[string]interface{}{
+					lowercaseNormalizer: map[string]interface{}{"type": "custom", "filter": []string{"lowercase"}},
+				},
+			},
+		},
+		"mappings": mappingsOf(resourceType),
+	}
+}
+
+func mappingsOf(resourceType *spec.ResourceType) map[string]interface{} {
+	return map[string]interface{}{
+		"dynamic":    false,
+		"properties": propertiesOf(resourceType.SuperAttribute(true)),
+	}
+}
+
+func propertiesOf(attr *spec.Attribute) map[string]interface{} {
+	properties := make(map[string]interface{})
+	_ = attr.ForEachSubAttribute(func(sub *spec.Attribute) error {
+		if sub.Returned() != spec.ReturnedNever {
+			properties[sub.Name()] = fieldOf(sub)
+		}
+		return nil
+	})
+	return properties
+}
+
+func fieldOf(attr *spec.Attribute) map[string]interface{} {
+	switch attr.Type() {
+	case spec.TypeComplex:
+		return map[string]interface{}{"properties": propertiesOf(attr)}
+	case spec.TypeInteger:
+		return map[string]interface{}{"type": "long"}
+	case spec.TypeDecimal:
+		return map[string]interface{}{"type": "double"}
+	case spec.TypeBoolean:
+		return map[string]interface{}{"type": "boolean"}
+	case spec.TypeDateTime:
+		return map[string]interface{}{"type": "date", "format": "strict_date_optional_time||epoch_millis"}
+	default:
+		// Values too long to be indexed as a term, i.e. certificates, are left out of the index, rather than failing
+		// the document.
+		field := map[string]interface{}{"type": "keyword", "ignore_above": 8191}
+		if attr.Type() == spec.TypeString && !attr.CaseExact() {
+			field["normalizer"] = lowercaseNormalizer
+		}
+		return field
+	}
+}
+
+// EnsureIndex creates the index of the resource type with the Mapping, unless it already exists, in which case the
+// fields missing from its mapping are added, so that it can be called every time the application starts. Only the URL,
+// Client and Header of the options are used. Fields already mapped otherwise, i.e. after an attribute became caseExact,
+// fail with an error of spec.ErrInternal; such indexes shall be recreated, and filled with Reindex.
+func EnsureIndex(ctx context.Context, resourceType *spec.ResourceType, options Options) error {
+	var (
+		c    = newClient(options)
+		path = "/" + url.PathEscape(options.Index)
+		resp errorResponse
+	)
+	status, err := c.do(ctx, http.MethodPut, path, Mapping(resourceType), &resp, http.StatusBadRequest)
+	if err != nil {
+		return err
+	}
+	if status < 400 {
+		return nil
+	}
+	if resp.Error.Type != "resource_already_exists_exception" {
+		return fmt.Errorf("%w: PUT %s responded %d: %s: %s", spec.ErrInternal, path, status, resp.Error.Type, resp.Error.Reason)
+	}
+
+	_, err = c.do(ctx, http.MethodPut, path+"/_mapping", mappingsOf(resourceType), nil)
+	return err
+}
+
+// Returns the document of the resource to be indexed, which holds all assigned attributes except those never returned.
+func documentOf(resource *prop.Resource) map[string]interface{} {
+	doc, _ := prop.DocumentFunc(resource.RootProperty(), func(attr *spec.Attribute) bool {
+		return attr.Returned() != spec.ReturnedNever
+	}).(map[string]interface{})
+	if doc == nil {
+		doc = map[string]interface{}{}
+	}
+	return doc
+}
@@ -0,0 +1,5 @@
+// This package mounts the SCIM handlers, i.e. the one of handlerutil.NewServer, on a Fiber router, with the middleware
+// of Fiber, and adapts the net/http middleware of the core module, i.e. that of the oauth package, into Fiber
+// middleware. As Fiber is built on fasthttp instead of net/http, the requests are converted for the handlers, which
+// read nothing of the Fiber context but its user context (see fiber.Ctx.UserContext).
+package v2
@@ -0,0 +1,163 @@
+package v2
+
+import (
+	"bytes"
+	"context"
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/utils"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Options configures Mount.
+type Options struct {
+	// Middleware are called, in order, before the SCIM handler, i.e. to authenticate the requests.
+	Middleware []fiber.Handler
+	// Context, if not nil, returns the context of the request handed to the SCIM handler, so that it carries what the
+	// middleware have resolved into the Fiber context, i.e. the tenant of a path parameter of the prefix (see
+	// tenant.With). Otherwise, the user context of the Fiber context is handed, which carries what the middleware
+	// adapted with Middleware have put into the context of the request.
+	Context func(c *fiber.Ctx) context.Context
+}
+
+// Mount registers the handler on the router under the prefix, i.e. "/scim/v2", for all methods, so that the handler of
+// handlerutil.NewServer serves /scim/v2/Users. The handler is called with the path relative to the prefix, which may
+// have path parameters, i.e. "/tenants/:tenant/scim/v2", and be relative to a group. The request handed to the handler
+// is a copy of the fasthttp request, hence remains valid after the handler has returned, i.e. for asynchronous
+// operations.
+func Mount(router fiber.Router, prefix string, handler http.Handler, options Options) {
+	group := router.Group(strings.TrimSuffix(prefix, "/"), options.Middleware...)
+	serve := func(c *fiber.Ctx) error {
+		path := utils.CopyString(c.Params("*"))
+		// Fiber routes the escaped path, unless configured otherwise, and does not unescape the wildcard.
+		if !c.App().Config().UnescapePath {
+			if unescaped, err := url.PathUnescape(path); err == nil {
+				path = unescaped
+			}
+		}
+
+		r, err := request(c)
+		if err != nil {
+			return err
+		}
+		r = withPath(r, path)
+		if options.Context != nil {
+			r = r.WithContext(options.Context(c))
+		}
+		handler.ServeHTTP(&responseWriter{c: c}, r)
+		return nil
+	}
+	group.All("/", serve)
+	group.All("/*", serve)
+}
+
+// Middleware returns Fiber middleware which calls the net/http middleware, i.e. oauth.Middleware, with the request, and
+// the rest of the handlers as its next handler. The context of the request the middleware passes on, i.e. with the
+// principal in it, becomes the user context of the Fiber context; but the response writer it passes on is discarded,
+// so that middleware that wrap the response, i.e. handlerutil.Compress, must wrap the SCIM handler instead. The
+// response of requests the middleware answers by itself, without calling its next handler, is written to the Fiber
+// context.
+func Middleware(middleware func(next http.Handler) http.Handler) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		r, err := request(c)
+		if err != nil {
+			return err
+		}
+
+		rw := &responseWriter{c: c}
+		middleware(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+			rw.copyHeader()
+			c.SetUserContext(r.Context())
+			err = c.Next()
+		})).ServeHTTP(rw, r)
+		return err
+	}
+}
+
+// Returns a net/http copy of the request of the Fiber context, with its user context. Unlike the conversion of
+// fasthttpadaptor, nothing of the copy refers to the memory of fasthttp, which is reused once the handler returns.
+func request(c *fiber.Ctx) (*http.Request, error) {
+	requestURI := string(c.Request().RequestURI())
+	u, err := url.ParseRequestURI(requestURI)
+	if err != nil {
+		return nil, err
+	}
+
+	body := append([]byte(nil), c.Request().Body()...)
+	r := &http.Request{
+		Method:        string(c.Request().Header.Method()),
+		URL:           u,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        make(http.Header),
+		Body:          ioutil.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Host:          string(c.Request().Host()),
+		RemoteAddr:    c.Context().RemoteAddr().String(),
+		RequestURI:    requestURI,
+		TLS:           c.Context().TLSConnectionState(),
+	}
+	c.Request().Header.VisitAll(func(key, value []byte) {
+		r.Header.Add(string(key), string(value))
+	})
+	return r.WithContext(c.UserContext()), nil
+}
+
+// Returns a shallow copy of the request, whose URL has the path.
+func withPath(r *http.Request, path string) *http.Request {
+	u := *r.URL
+	u.Path = "/" + strings.TrimPrefix(path, "/")
+	u.RawPath = ""
+
+	copied := new(http.Request)
+	*copied = *r
+	copied.URL = &u
+	return copied
+}
+
+// responseWriter writes the response to the Fiber context.
+type responseWriter struct {
+	c           *fiber.Ctx
+	header      http.Header
+	wroteHeader bool
+}
+
+func (w *responseWriter) Header() http.Header {
+	if w.header == nil {
+		w.header = make(http.Header)
+	}
+	return w.header
+}
+
+func (w *responseWriter) WriteHeader(statusCode int) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+	w.copyHeader()
+	w.c.Status(statusCode)
+}
+
+func (w *responseWriter) Write(p []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.c.Write(p)
+}
+
+// Copies the header to the response of the Fiber context.
+func (w *responseWriter) copyHeader() {
+	for key, values := range w.header {
+		w.c.Response().Header.Del(key)
+		for _, value := range values {
+			w.c.Response().Header.Add(key, value)
+		}
+	}
+}
+
+var (
+	_ http.ResponseWriter = (*responseWriter)(nil)
+)
@@ -0,0 +1,184 @@
+package v2
+
+import (
+	"context"
+	"github.com/gofiber/fiber/v2"
+	"github.com/imulab/go-scim/pkg/v2/handlerutil"
+	"github.com/imulab/go-scim/pkg/v2/oauth"
+	"github.com/imulab/go-scim/pkg/v2/spec"
+	"github.com/imulab/go-scim/pkg/v2/tenant"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMount(t *testing.T) {
+	// reports the path and the context it is called with
+	report := http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		rw.Header().Set("X-Path", r.URL.Path)
+		rw.Header().Set("X-Tenant", tenant.From(r.Context()))
+		if principal := oauth.From(r.Context()); principal != nil {
+			rw.Header().Set("X-Subject", principal.Subject)
+		}
+		rw.WriteHeader(http.StatusNoContent)
+	})
+	authenticated := Middleware(func(next http.Handler) http.Handler {
+		return oauth.Middleware(oauth.Options{
+			Verifier: oauth.NewStaticTokens(&oauth.StaticToken{Token: "s3cret", Subject: "idp"}),
+		}, next)
+	})
+
+	tests := []struct {
+		name    string
+		mount   func(app *fiber.App)
+		request func() *http.Request
+		expect  func(t *testing.T, resp *http.Response)
+	}{
+		{
+			name: "path relative to the prefix",
+			mount: func(app *fiber.App) {
+				Mount(app, "/scim/v2/", report, Options{})
+			},
+			request: func() *http.Request {
+				return httptest.NewRequest(http.MethodDelete, "/scim/v2/Users/foo", nil)
+			},
+			expect: func(t *testing.T, resp *http.Response) {
+				assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+				assert.Equal(t, "/Users/foo", resp.Header.Get("X-Path"))
+			},
+		},
+		{
+			name: "prefix itself",
+			mount: func(app *fiber.App) {
+				Mount(app, "/scim", report, Options{})
+			},
+			request: func() *http.Request {
+				return httptest.NewRequest(http.MethodGet, "/scim", nil)
+			},
+			expect: func(t *testing.T, resp *http.Response) {
+				assert.Equal(t, "/", resp.Header.Get("X-Path"))
+			},
+		},
+		{
+			name: "escaped path",
+			mount: func(app *fiber.App) {
+				Mount(app, "/scim", report, Options{})
+			},
+			request: func() *http.Request {
+				return httptest.NewRequest(http.MethodGet, "/scim/Users/a%2Fb", nil)
+			},
+			expect: func(t *testing.T, resp *http.Response) {
+				assert.Equal(t, "/Users/a/b", resp.Header.Get("X-Path"))
+			},
+		},
+		{
+			name: "prefix relative to a group",
+			mount: func(app *fiber.App) {
+				Mount(app.Group("/api"), "/scim", report, Options{})
+			},
+			request: func() *http.Request {
+				return httptest.NewRequest(http.MethodGet, "/api/scim/Users", nil)
+			},
+			expect: func(t *testing.T, resp *http.Response) {
+				assert.Equal(t, "/Users", resp.Header.Get("X-Path"))
+			},
+		},
+		{
+			name: "context of path parameter",
+			mount: func(app *fiber.App) {
+				Mount(app, "/tenants/:tenant/scim", report, Options{
+					Context: func(c *fiber.Ctx) context.Context {
+						return tenant.With(c.UserContext(), c.Params("tenant"))
+					},
+				})
+			},
+			request: func() *http.Request {
+				return httptest.NewRequest(http.MethodGet, "/tenants/acme/scim/Groups", nil)
+			},
+			expect: func(t *testing.T, resp *http.Response) {
+				assert.Equal(t, "/Groups", resp.Header.Get("X-Path"))
+				assert.Equal(t, "acme", resp.Header.Get("X-Tenant"))
+			},
+		},
+		{
+			name: "authenticated by net/http middleware",
+			mount: func(app *fiber.App) {
+				Mount(app, "/scim", report, Options{Middleware: []fiber.Handler{authenticated}})
+			},
+			request: func() *http.Request {
+				r := httptest.NewRequest(http.MethodGet, "/scim/Users", nil)
+				r.Header.Set("Authorization", "Bearer s3cret")
+				return r
+			},
+			expect: func(t *testing.T, resp *http.Response) {
+				assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+				assert.Equal(t, "idp", resp.Header.Get("X-Subject"))
+			},
+		},
+		{
+			name: "rejected by net/http middleware",
+			mount: func(app *fiber.App) {
+				Mount(app, "/scim", report, Options{Middleware: []fiber.Handler{authenticated}})
+			},
+			request: func() *http.Request {
+				return httptest.NewRequest(http.MethodGet, "/scim/Users", nil)
+			},
+			expect: func(t *testing.T, resp *http.Response) {
+				assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+				assert.Empty(t, resp.Header.Get("X-Path"))
+			},
+		},
+		{
+			name: "request and response body",
+			mount: func(app *fiber.App) {
+				Mount(app, "/scim", http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+					raw, _ := ioutil.ReadAll(r.Body)
+					rw.Header().Set("Content-Type", r.Header.Get("Content-Type"))
+					rw.WriteHeader(http.StatusCreated)
+					_, _ = rw.Write(raw)
+				}), Options{})
+			},
+			request: func() *http.Request {
+				r := httptest.NewRequest(http.MethodPost, "/scim/Users", strings.NewReader(`{"userName":"foo"}`))
+				r.Header.Set("Content-Type", spec.ApplicationScimJson)
+				return r
+			},
+			expect: func(t *testing.T, resp *http.Response) {
+				assert.Equal(t, http.StatusCreated, resp.StatusCode)
+				assert.Equal(t, spec.ApplicationScimJson, resp.Header.Get("Content-Type"))
+				raw, err := ioutil.ReadAll(resp.Body)
+				require.Nil(t, err)
+				assert.JSONEq(t, `{"userName":"foo"}`, string(raw))
+			},
+		},
+		{
+			name: "SCIM server",
+			mount: func(app *fiber.App) {
+				Mount(app, "/scim/v2", handlerutil.NewServer(handlerutil.ServerOptions{
+					ServiceProviderConfig: new(spec.ServiceProviderConfig),
+				}), Options{})
+			},
+			request: func() *http.Request {
+				return httptest.NewRequest(http.MethodGet, "/scim/v2/ServiceProviderConfig", nil)
+			},
+			expect: func(t *testing.T, resp *http.Response) {
+				assert.Equal(t, http.StatusOK, resp.StatusCode)
+				assert.Equal(t, spec.ApplicationScimJson, resp.Header.Get("Content-Type"))
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			app := fiber.New()
+			test.mount(app)
+			resp, err := app.Test(test.request())
+			require.Nil(t, err)
+			test.expect(t, resp)
+		})
+	}
+}
@@ -0,0 +1,3 @@
+// This package mounts the SCIM handlers, i.e. the one of handlerutil.NewServer, on a Gin router, with the middleware of
+// Gin, and adapts the net/http middleware of the core module, i.e. that of the oauth package, into Gin middleware.
+package v2
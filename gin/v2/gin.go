@@ -0,0 +1,64 @@
+package v2
+
+import (
+	"context"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"strings"
+)
+
+// Options configures Mount.
+type Options struct {
+	// Middleware are called, in order, before the SCIM handler, i.e. to authenticate the requests.
+	Middleware []gin.HandlerFunc
+	// Context, if not nil, returns the context of the request handed to the SCIM handler, so that it carries what the
+	// middleware have resolved into the Gin context, i.e. the tenant of a path parameter of the prefix (see tenant.With).
+	// Otherwise, the context of the request is handed as is.
+	Context func(c *gin.Context) context.Context
+}
+
+// Mount registers the handler on the router under the prefix, i.e. "/scim/v2", for all methods, so that the handler of
+// handlerutil.NewServer serves /scim/v2/Users. The handler is called with the path relative to the prefix, which may
+// have path parameters, i.e. "/tenants/:tenant/scim/v2", and be relative to a router group.
+func Mount(router gin.IRouter, prefix string, handler http.Handler, options Options) {
+	group := router.Group(strings.TrimSuffix(prefix, "/"), options.Middleware...)
+	serve := func(c *gin.Context) {
+		r := withPath(c.Request, c.Param("scimPath"))
+		if options.Context != nil {
+			r = r.WithContext(options.Context(c))
+		}
+		handler.ServeHTTP(c.Writer, r)
+	}
+	group.Any("/*scimPath", serve)
+}
+
+// Middleware returns Gin middleware which calls the net/http middleware, i.e. oauth.Middleware, with the request, and
+// the rest of the handlers as its next handler. Requests the middleware answers by itself, without calling its next
+// handler, are aborted. The request the middleware passes on, i.e. with the principal in its context, replaces that of
+// the Gin context; but the response writer it passes on is discarded, so that middleware that wrap the response, i.e.
+// handlerutil.Compress, must wrap the SCIM handler instead.
+func Middleware(middleware func(next http.Handler) http.Handler) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		next := false
+		middleware(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+			next = true
+			c.Request = r
+			c.Next()
+		})).ServeHTTP(c.Writer, c.Request)
+		if !next {
+			c.Abort()
+		}
+	}
+}
+
+// Returns a shallow copy of the request, whose URL has the path.
+func withPath(r *http.Request, path string) *http.Request {
+	u := *r.URL
+	u.Path = "/" + strings.TrimPrefix(path, "/")
+	u.RawPath = ""
+
+	copied := new(http.Request)
+	*copied = *r
+	copied.URL = &u
+	return copied
+}
@@ -0,0 +1,136 @@
+package v2
+
+import (
+	"context"
+	"github.com/gin-gonic/gin"
+	"github.com/imulab/go-scim/pkg/v2/handlerutil"
+	"github.com/imulab/go-scim/pkg/v2/oauth"
+	"github.com/imulab/go-scim/pkg/v2/spec"
+	"github.com/imulab/go-scim/pkg/v2/tenant"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestMount(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	// reports the path and the context it is called with
+	report := http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		rw.Header().Set("X-Path", r.URL.Path)
+		rw.Header().Set("X-Tenant", tenant.From(r.Context()))
+		if principal := oauth.From(r.Context()); principal != nil {
+			rw.Header().Set("X-Subject", principal.Subject)
+		}
+		rw.WriteHeader(http.StatusNoContent)
+	})
+	authenticated := Middleware(func(next http.Handler) http.Handler {
+		return oauth.Middleware(oauth.Options{
+			Verifier: oauth.NewStaticTokens(&oauth.StaticToken{Token: "s3cret", Subject: "idp"}),
+		}, next)
+	})
+
+	tests := []struct {
+		name    string
+		mount   func(engine *gin.Engine)
+		request func() *http.Request
+		expect  func(t *testing.T, rr *httptest.ResponseRecorder)
+	}{
+		{
+			name: "path relative to the prefix",
+			mount: func(engine *gin.Engine) {
+				Mount(engine, "/scim/v2/", report, Options{})
+			},
+			request: func() *http.Request {
+				return httptest.NewRequest(http.MethodDelete, "/scim/v2/Users/foo", nil)
+			},
+			expect: func(t *testing.T, rr *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusNoContent, rr.Code)
+				assert.Equal(t, "/Users/foo", rr.Header().Get("X-Path"))
+			},
+		},
+		{
+			name: "prefix relative to a group",
+			mount: func(engine *gin.Engine) {
+				Mount(engine.Group("/api"), "/scim", report, Options{})
+			},
+			request: func() *http.Request {
+				return httptest.NewRequest(http.MethodGet, "/api/scim/Users", nil)
+			},
+			expect: func(t *testing.T, rr *httptest.ResponseRecorder) {
+				assert.Equal(t, "/Users", rr.Header().Get("X-Path"))
+			},
+		},
+		{
+			name: "context of path parameter",
+			mount: func(engine *gin.Engine) {
+				Mount(engine, "/tenants/:tenant/scim", report, Options{
+					Context: func(c *gin.Context) context.Context {
+						return tenant.With(c.Request.Context(), c.Param("tenant"))
+					},
+				})
+			},
+			request: func() *http.Request {
+				return httptest.NewRequest(http.MethodGet, "/tenants/acme/scim/Groups", nil)
+			},
+			expect: func(t *testing.T, rr *httptest.ResponseRecorder) {
+				assert.Equal(t, "/Groups", rr.Header().Get("X-Path"))
+				assert.Equal(t, "acme", rr.Header().Get("X-Tenant"))
+			},
+		},
+		{
+			name: "authenticated by net/http middleware",
+			mount: func(engine *gin.Engine) {
+				Mount(engine, "/scim", report, Options{Middleware: []gin.HandlerFunc{authenticated}})
+			},
+			request: func() *http.Request {
+				r := httptest.NewRequest(http.MethodGet, "/scim/Users", nil)
+				r.Header.Set("Authorization", "Bearer s3cret")
+				return r
+			},
+			expect: func(t *testing.T, rr *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusNoContent, rr.Code)
+				assert.Equal(t, "idp", rr.Header().Get("X-Subject"))
+			},
+		},
+		{
+			name: "rejected by net/http middleware",
+			mount: func(engine *gin.Engine) {
+				Mount(engine, "/scim", report, Options{Middleware: []gin.HandlerFunc{authenticated}})
+			},
+			request: func() *http.Request {
+				return httptest.NewRequest(http.MethodGet, "/scim/Users", nil)
+			},
+			expect: func(t *testing.T, rr *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusUnauthorized, rr.Code)
+				assert.Empty(t, rr.Header().Get("X-Path"))
+			},
+		},
+		{
+			name: "SCIM server",
+			mount: func(engine *gin.Engine) {
+				Mount(engine, "/scim/v2", handlerutil.NewServer(handlerutil.ServerOptions{
+					ServiceProviderConfig: new(spec.ServiceProviderConfig),
+				}), Options{})
+			},
+			request: func() *http.Request {
+				return httptest.NewRequest(http.MethodGet, "/scim/v2/ServiceProviderConfig", nil)
+			},
+			expect: func(t *testing.T, rr *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusOK, rr.Code)
+				assert.Equal(t, spec.ApplicationScimJson, rr.Header().Get("Content-Type"))
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			engine := gin.New()
+			test.mount(engine)
+			rr := httptest.NewRecorder()
+			engine.ServeHTTP(rr, test.request())
+			test.expect(t, rr)
+		})
+	}
+}
@@ -0,0 +1,11 @@
+module github.com/imulab/go-scim/gin/v2
+
+go 1.13
+
+require (
+	github.com/gin-gonic/gin v1.7.7
+	github.com/imulab/go-scim/pkg/v2 v2.0.0
+	github.com/stretchr/testify v1.7.0
+)
+
+replace github.com/imulab/go-scim/pkg/v2 => ../../pkg/v2
@@ -8,7 +8,6 @@ require (
 	github.com/google/go-cmp v0.4.0 // indirect
 	github.com/imulab/go-scim/mongo/v2 v2.0.0
 	github.com/imulab/go-scim/pkg/v2 v2.2.0
-	github.com/julienschmidt/httprouter v1.3.0
 	github.com/opencontainers/runc v1.0.0-rc9 // indirect
 	github.com/ory/dockertest v3.3.5+incompatible
 	github.com/rs/zerolog v1.17.2
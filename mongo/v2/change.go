@@ -0,0 +1,78 @@
+package v2
+
+import (
+	"context"
+	"fmt"
+	"github.com/imulab/go-scim/pkg/v2/db"
+	"github.com/imulab/go-scim/pkg/v2/spec"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"time"
+)
+
+// Subscribe watches the change stream of the collection, and implements db.ChangeStreamDB. Change streams are only
+// available on replica sets and sharded clusters, and notify the changes once they are committed to the majority of
+// the replica set. The stream ends with an error of spec.ErrInternal when the collection is dropped or renamed.
+//
+// The resource of inserts is the one inserted, but that of updates is looked up when the change is read from the
+// stream, which may reflect a later change, or be nil if the resource was deleted since. As the document of a deleted
+// resource is gone, and the change of its deletion is only identified by the MongoDB internal id, the id and version of
+// the changes of deletions are empty; subscribers can only tell that some resource was deleted.
+//
+// The driver resumes the stream once after a network error, so that no change is missed, and the changes are notified
+// at most once, unless the subscription is started again.
+func (d *mongoDB) Subscribe(ctx context.Context, fn func(ctx context.Context, change *db.Change) error) error {
+	stream, err := d.coll.Watch(ctx, mongo.Pipeline{}, options.ChangeStream().SetFullDocument(options.UpdateLookup))
+	if err != nil {
+		return fmt.Errorf("%w: failed to watch changes: %v", spec.ErrInternal, err)
+	}
+	defer func() {
+		_ = stream.Close(context.Background())
+	}()
+
+	for stream.Next(ctx) {
+		var event struct {
+			OperationType string              `bson:"operationType"`
+			FullDocument  bson.Raw            `bson:"fullDocument"`
+			ClusterTime   primitive.Timestamp `bson:"clusterTime"`
+		}
+		if err := stream.Decode(&event); err != nil {
+			return fmt.Errorf("%w: failed to decode change: %v", spec.ErrInternal, err)
+		}
+
+		change := &db.Change{Time: time.Unix(int64(event.ClusterTime.T), 0)}
+		switch event.OperationType {
+		case "insert":
+			change.Type = db.ChangeInsert
+		case "update", "replace":
+			change.Type = db.ChangeUpdate
+		case "delete":
+			change.Type = db.ChangeDelete
+		case "drop", "rename", "dropDatabase", "invalidate":
+			return fmt.Errorf("%w: change stream ended by '%s' of the collection", spec.ErrInternal, event.OperationType)
+		default:
+			continue
+		}
+
+		if change.Type != db.ChangeDelete && len(event.FullDocument) > 0 {
+			w := newResourceUnmarshaler(d.resourceType)
+			if err := w.UnmarshalBSON(event.FullDocument); err != nil {
+				return err
+			}
+			change.Resource = w.Resource()
+			change.ID = change.Resource.IdOrEmpty()
+			change.Version = change.Resource.MetaVersionOrEmpty()
+		}
+
+		if err := fn(ctx, change); err != nil {
+			return err
+		}
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return fmt.Errorf("%w: change stream failed: %v", spec.ErrInternal, stream.Err())
+}
@@ -0,0 +1,226 @@
+package v2
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/imulab/go-scim/pkg/v2/crud"
+	"github.com/imulab/go-scim/pkg/v2/prop"
+	"github.com/imulab/go-scim/pkg/v2/spec"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"strings"
+)
+
+// QueryCursor queries a page of resources after the cursor, and implements db.CursorDB. Instead of skipping the
+// resources of the previous pages, the position of the cursor is added to the filter, so that MongoDB can seek the
+// page using an index on the sort attributes, and the cost of a page does not grow with its depth.
+//
+// The resources are sorted by id when the sort parameter is absent. Only singular attributes outside of multiValued
+// attributes can be sorted by, otherwise an error of spec.ErrInvalidSyntax is returned, because MongoDB sorts arrays
+// by their smallest or largest element, which the cursor cannot record. Resources without a value for a sort attribute
+// are placed first in ascending order, and last in descending order, as MongoDB sorts null before any other value.
+//
+// When the projection includes a list of attributes, the sort attributes and id are always included as well, so that
+// the cursor to the next page can be created from the last resource.
+func (d *mongoDB) QueryCursor(ctx context.Context, filter string, sort *crud.Sort, pagination *crud.CursorPagination, projection *crud.Projection) ([]*prop.Resource, string, error) {
+	if sort == nil || len(sort.By) == 0 {
+		sort = &crud.Sort{By: "id"}
+	}
+
+	keys, attrs, err := d.cursorKeys(sort)
+	if err != nil {
+		return nil, "", err
+	}
+
+	opt := options.Find()
+	tf := bson.D{}
+	if len(strings.TrimSpace(filter)) > 0 {
+		var collation *options.Collation
+		if tf, collation, err = d.mongoFilter(filter); err != nil {
+			return nil, "", err
+		}
+		if collation != nil {
+			opt.SetCollation(collation)
+		}
+	}
+
+	if pagination != nil && len(pagination.Cursor) > 0 {
+		cursor, err := crud.ParseCursor(pagination.Cursor)
+		if err != nil {
+			return nil, "", err
+		}
+		seek, err := d.seekFilter(keys, attrs, cursor)
+		if err != nil {
+			return nil, "", err
+		}
+		tf = bson.D{{Key: mongoAnd, Value: bson.A{tf, seek}}}
+	}
+
+	// cursorKeys rejects the keys that would need fields added to sort by
+	sorts, _, err := d.mongoSort(sort)
+	if err != nil {
+		return nil, "", err
+	}
+	opt.SetSort(sorts)
+
+	if pagination != nil && pagination.Count > 0 {
+		// one more to tell whether there is a next page
+		opt.SetLimit(int64(pagination.Count) + 1)
+	}
+	if !d.opt.ignoreProjection && projection != nil {
+		if len(projection.Attributes) > 0 {
+			included := append([]string{"id"}, projection.Attributes...)
+			for _, key := range keys {
+				included = append(included, key.By)
+			}
+			projection = &crud.Projection{Attributes: included}
+		}
+		opt.SetProjection(d.mongoProjection(projection))
+	}
+
+	results, err := d.find(ctx, tf, opt)
+	if err != nil {
+		return nil, "", err
+	}
+	if pagination == nil || pagination.Count <= 0 || len(results) <= pagination.Count {
+		return results, "", nil
+	}
+
+	results = results[:pagination.Count]
+	next, err := crud.NewCursor(results[len(results)-1], *sort)
+	if err != nil {
+		return nil, "", err
+	}
+	return results, next.String(), nil
+}
+
+// Returns the sort keys, along with the attribute of each key. An error of spec.ErrInvalidSyntax is returned if any
+// key is not a singular attribute outside of multiValued attributes.
+func (d *mongoDB) cursorKeys(sort *crud.Sort) ([]crud.SortKey, []*spec.Attribute, error) {
+	keys, err := sort.Keys()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	attrs := make([]*spec.Attribute, 0, len(keys))
+	for _, key := range keys {
+		path := d.attributesFor(key.By)
+		if len(path) == 0 {
+			return nil, nil, fmt.Errorf("%w: invalid sortBy target '%s'", spec.ErrInvalidPath, key.By)
+		}
+		for _, each := range path {
+			if each.MultiValued() {
+				return nil, nil, fmt.Errorf("%w: cannot sort by multiValued attribute '%s' with cursor", spec.ErrInvalidSyntax, key.By)
+			}
+		}
+		attr := path[len(path)-1]
+		if attr.Type() == spec.TypeComplex {
+			return nil, nil, fmt.Errorf("%w: cannot sort by complex attribute '%s' with cursor", spec.ErrInvalidSyntax, key.By)
+		}
+		attrs = append(attrs, attr)
+	}
+	return keys, attrs, nil
+}
+
+// Returns the MongoDB filter of the resources positioned after the cursor, in the order of mongoSort, which is
+//
+//	{$or: [after(k1), {k1 = v1, after(k2)}, ..., {k1 = v1, k2 = v2, ..., id > cursor.ID}]}
+//
+// An error of spec.ErrInvalidCursor is returned if the cursor does not match the sort keys.
+func (d *mongoDB) seekFilter(keys []crud.SortKey, attrs []*spec.Attribute, cursor *crud.Cursor) (bson.D, error) {
+	if len(cursor.Values) != len(keys) {
+		return nil, fmt.Errorf("%w: cursor does not match the sort order", spec.ErrInvalidCursor)
+	}
+
+	var (
+		branches = bson.A{}
+		equals   = bson.A{}
+	)
+	for k, key := range keys {
+		var (
+			path = d.mongoPathOf(attrs[k])
+			v    interface{}
+			err  error
+		)
+		if cursor.Values[k] != nil {
+			if v, err = d.cursorValue(attrs[k], cursor.Values[k]); err != nil {
+				return nil, err
+			}
+		}
+
+		if after := seekAfter(path, v, key.Order); after != nil {
+			branches = append(branches, seekAll(append(append(bson.A{}, equals...), after)))
+		}
+
+		if v == nil {
+			equals = append(equals, bson.D{{Key: path, Value: primitive.Null{}}})
+		} else {
+			equals = append(equals, bson.D{{Key: path, Value: v}})
+		}
+	}
+
+	idPath := d.mongoPathFor("id")
+	branches = append(branches, seekAll(append(equals, bson.D{{Key: idPath, Value: bson.D{{Key: mongoGt, Value: cursor.ID}}}})))
+
+	return bson.D{{Key: mongoOr, Value: branches}}, nil
+}
+
+// Returns the criterion of the documents after the value of the path in the order, or nil if there are none. Null
+// values come before any other value in ascending order.
+func seekAfter(path string, v interface{}, order crud.SortOrder) bson.D {
+	switch {
+	case order == crud.SortDesc && v == nil:
+		return nil
+	case order == crud.SortDesc:
+		return bson.D{{Key: mongoOr, Value: bson.A{
+			bson.D{{Key: path, Value: bson.D{{Key: mongoLt, Value: v}}}},
+			bson.D{{Key: path, Value: primitive.Null{}}},
+		}}}
+	case v == nil:
+		return bson.D{{Key: path, Value: nullCriteria}}
+	default:
+		return bson.D{{Key: path, Value: bson.D{{Key: mongoGt, Value: v}}}}
+	}
+}
+
+func seekAll(criteria bson.A) bson.D {
+	if len(criteria) == 1 {
+		return criteria[0].(bson.D)
+	}
+	return bson.D{{Key: mongoAnd, Value: criteria}}
+}
+
+// Convert the sort value recorded in the cursor to the value persisted in MongoDB for the attribute.
+func (d *mongoDB) cursorValue(attr *spec.Attribute, value interface{}) (interface{}, error) {
+	switch attr.Type() {
+	case spec.TypeString, spec.TypeReference, spec.TypeBinary:
+		if s, ok := value.(string); ok {
+			return s, nil
+		}
+	case spec.TypeDateTime:
+		if s, ok := value.(string); ok {
+			if t, err := spec.ParseDateTime(s); err == nil {
+				return primitive.NewDateTimeFromTime(t), nil
+			}
+		}
+	case spec.TypeBoolean:
+		if b, ok := value.(bool); ok {
+			return b, nil
+		}
+	case spec.TypeInteger:
+		if n, ok := value.(json.Number); ok {
+			if i64, err := n.Int64(); err == nil {
+				return i64, nil
+			}
+		}
+	case spec.TypeDecimal:
+		if n, ok := value.(json.Number); ok {
+			if f64, err := n.Float64(); err == nil {
+				return f64, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("%w: cursor does not match the sort order", spec.ErrInvalidCursor)
+}
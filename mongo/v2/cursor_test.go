@@ -0,0 +1,252 @@
+package v2
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/imulab/go-scim/pkg/v2/crud"
+	"github.com/imulab/go-scim/pkg/v2/spec"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"go.mongodb.org/mongo-driver/bson"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestCursor(t *testing.T) {
+	s := new(CursorTestSuite)
+	suite.Run(t, s)
+}
+
+type CursorTestSuite struct {
+	suite.Suite
+	resourceType *spec.ResourceType
+}
+
+func (s *CursorTestSuite) TestSeekFilter() {
+	tests := []struct {
+		name   string
+		sort   crud.Sort
+		cursor *crud.Cursor
+		expect func(t *testing.T, extJson string, err error)
+	}{
+		{
+			name:   "ascending",
+			sort:   crud.Sort{By: "userName"},
+			cursor: &crud.Cursor{Values: []interface{}{"bob"}, ID: "user002"},
+			expect: func(t *testing.T, extJson string, err error) {
+				assert.Nil(t, err)
+				assert.JSONEq(t, `{"$or":[{"userName":{"$gt":"bob"}},{"$and":[{"userName":"bob"},{"id":{"$gt":"user002"}}]}]}`, extJson)
+			},
+		},
+		{
+			name:   "ascending after null",
+			sort:   crud.Sort{By: "userName", Order: crud.SortAsc},
+			cursor: &crud.Cursor{Values: []interface{}{nil}, ID: "user002"},
+			expect: func(t *testing.T, extJson string, err error) {
+				assert.Nil(t, err)
+				assert.JSONEq(t, `{"$or":[{"userName":{"$ne":null}},{"$and":[{"userName":null},{"id":{"$gt":"user002"}}]}]}`, extJson)
+			},
+		},
+		{
+			name:   "descending after null",
+			sort:   crud.Sort{By: "userName", Order: crud.SortDesc},
+			cursor: &crud.Cursor{Values: []interface{}{nil}, ID: "user002"},
+			expect: func(t *testing.T, extJson string, err error) {
+				assert.Nil(t, err)
+				assert.JSONEq(t, `{"$or":[{"$and":[{"userName":null},{"id":{"$gt":"user002"}}]}]}`, extJson)
+			},
+		},
+		{
+			name:   "multiple keys",
+			sort:   crud.Sort{By: "active,meta.created", Order: "descending,ascending"},
+			cursor: &crud.Cursor{Values: []interface{}{true, "2020-01-01T00:00:00Z"}, ID: "user002"},
+			expect: func(t *testing.T, extJson string, err error) {
+				assert.Nil(t, err)
+				assert.JSONEq(t, `{"$or":[
+					{"$or":[{"active":{"$lt":true}},{"active":null}]},
+					{"$and":[{"active":true},{"meta.created":{"$gt":{"$date":{"$numberLong":"1577836800000"}}}}]},
+					{"$and":[{"active":true},{"meta.created":{"$date":{"$numberLong":"1577836800000"}}},{"id":{"$gt":"user002"}}]}
+				]}`, extJson)
+			},
+		},
+		{
+			name:   "cursor of another sort order",
+			sort:   crud.Sort{By: "userName,active"},
+			cursor: &crud.Cursor{Values: []interface{}{"bob"}, ID: "user002"},
+			expect: func(t *testing.T, extJson string, err error) {
+				assert.True(t, errors.Is(err, spec.ErrInvalidCursor))
+			},
+		},
+		{
+			name:   "cursor value of another type",
+			sort:   crud.Sort{By: "active"},
+			cursor: &crud.Cursor{Values: []interface{}{json.Number("1")}, ID: "user002"},
+			expect: func(t *testing.T, extJson string, err error) {
+				assert.True(t, errors.Is(err, spec.ErrInvalidCursor))
+			},
+		},
+	}
+
+	d := s.database()
+	for _, test := range tests {
+		s.T().Run(test.name, func(t *testing.T) {
+			keys, attrs, err := d.cursorKeys(&test.sort)
+			require.Nil(t, err)
+			v, err := d.seekFilter(keys, attrs, test.cursor)
+			if err != nil {
+				test.expect(t, "", err)
+				return
+			}
+			raw, err := bson.MarshalExtJSON(v, true, false)
+			require.Nil(t, err)
+			test.expect(t, string(raw), nil)
+		})
+	}
+}
+
+func (s *CursorTestSuite) TestCursorKeys() {
+	d := s.database()
+
+	_, attrs, err := d.cursorKeys(&crud.Sort{By: "urn:ietf:params:scim:schemas:core:2.0:User:name.familyName"})
+	assert.Nil(s.T(), err)
+	require.Len(s.T(), attrs, 1)
+	assert.Equal(s.T(), "name.familyName", attrs[0].Path())
+
+	_, _, err = d.cursorKeys(&crud.Sort{By: "emails.value"})
+	assert.True(s.T(), errors.Is(err, spec.ErrInvalidSyntax))
+
+	_, _, err = d.cursorKeys(&crud.Sort{By: "name"})
+	assert.True(s.T(), errors.Is(err, spec.ErrInvalidSyntax))
+
+	_, _, err = d.cursorKeys(&crud.Sort{By: "foo"})
+	assert.True(s.T(), errors.Is(err, spec.ErrInvalidPath))
+}
+
+func (s *CursorTestSuite) TestMongoSort() {
+	d := s.database()
+
+	tests := []struct {
+		name   string
+		sort   *crud.Sort
+		expect func(t *testing.T, sorts string, fields string, err error)
+	}{
+		{
+			name: "singular attribute",
+			sort: &crud.Sort{By: "userName", Order: crud.SortDesc},
+			expect: func(t *testing.T, sorts string, fields string, err error) {
+				assert.Nil(t, err)
+				assert.JSONEq(t, `{"userName":-1,"id":1}`, sorts)
+				assert.JSONEq(t, `{}`, fields)
+			},
+		},
+		{
+			name: "attribute within multiValued attribute",
+			sort: &crud.Sort{By: "emails.value"},
+			expect: func(t *testing.T, sorts string, fields string, err error) {
+				assert.Nil(t, err)
+				assert.JSONEq(t, `{"_sort_0.value":1,"id":1}`, sorts)
+				assert.JSONEq(t, `{"_sort_0":{"$arrayElemAt":[{"$concatArrays":[
+					{"$filter":{"input":{"$ifNull":["$emails",[]]},"cond":{"$eq":["$$this.primary",true]}}},
+					{"$ifNull":["$emails",[]]}
+				]},0]}}`, fields)
+			},
+		},
+		{
+			name: "multiValued complex attribute sorts by value",
+			sort: &crud.Sort{By: "userName,phoneNumbers", Order: "ascending,descending"},
+			expect: func(t *testing.T, sorts string, fields string, err error) {
+				assert.Nil(t, err)
+				assert.JSONEq(t, `{"userName":1,"_sort_0.value":-1,"id":1}`, sorts)
+				assert.Contains(t, fields, "$phoneNumbers")
+			},
+		},
+		{
+			name: "multiValued attribute without primary sorts by first element",
+			sort: &crud.Sort{By: "schemas"},
+			expect: func(t *testing.T, sorts string, fields string, err error) {
+				assert.Nil(t, err)
+				assert.JSONEq(t, `{"_sort_0":1,"id":1}`, sorts)
+				assert.JSONEq(t, `{"_sort_0":{"$arrayElemAt":[{"$ifNull":["$schemas",[]]},0]}}`, fields)
+			},
+		},
+	}
+
+	for _, test := range tests {
+		s.T().Run(test.name, func(t *testing.T) {
+			sorts, fields, err := d.mongoSort(test.sort)
+			if err != nil {
+				test.expect(t, "", "", err)
+				return
+			}
+			rawSorts, err := bson.MarshalExtJSON(sorts, false, false)
+			require.Nil(t, err)
+			rawFields, err := bson.MarshalExtJSON(fields, false, false)
+			require.Nil(t, err)
+			test.expect(t, string(rawSorts), string(rawFields), nil)
+		})
+	}
+}
+
+// Returns the database without a collection, for the methods that do not reach MongoDB.
+func (s *CursorTestSuite) database() *mongoDB {
+	return &mongoDB{
+		resourceType:  s.resourceType,
+		superAttr:     s.resourceType.SuperAttribute(true),
+		t:             newTransformer(s.resourceType),
+		opt:           Options(),
+		uniqueIndexes: map[string]string{},
+	}
+}
+
+func (s *CursorTestSuite) SetupSuite() {
+	for _, each := range []struct {
+		filepath  string
+		structure interface{}
+		post      func(parsed interface{})
+	}{
+		{
+			filepath:  "../../public/schemas/core_schema.json",
+			structure: new(spec.Schema),
+			post: func(parsed interface{}) {
+				spec.Schemas().Register(parsed.(*spec.Schema))
+			},
+		},
+		{
+			filepath:  "../../public/schemas/user_schema.json",
+			structure: new(spec.Schema),
+			post: func(parsed interface{}) {
+				spec.Schemas().Register(parsed.(*spec.Schema))
+			},
+		},
+		{
+			filepath:  "../../public/schemas/user_enterprise_extension_schema.json",
+			structure: new(spec.Schema),
+			post: func(parsed interface{}) {
+				spec.Schemas().Register(parsed.(*spec.Schema))
+			},
+		},
+		{
+			filepath:  "../../public/resource_types/user_resource_type.json",
+			structure: new(spec.ResourceType),
+			post: func(parsed interface{}) {
+				s.resourceType = parsed.(*spec.ResourceType)
+				crud.Register(s.resourceType)
+			},
+		},
+	} {
+		f, err := os.Open(each.filepath)
+		require.Nil(s.T(), err)
+
+		raw, err := ioutil.ReadAll(f)
+		require.Nil(s.T(), err)
+
+		err = json.Unmarshal(raw, each.structure)
+		require.Nil(s.T(), err)
+
+		if each.post != nil {
+			each.post(each.structure)
+		}
+	}
+}
@@ -3,6 +3,7 @@ package v2
 import (
 	"context"
 	"fmt"
+	"github.com/imulab/go-scim/pkg/v2/annotation"
 	"github.com/imulab/go-scim/pkg/v2/crud"
 	"github.com/imulab/go-scim/pkg/v2/crud/expr"
 	"github.com/imulab/go-scim/pkg/v2/db"
@@ -11,7 +12,7 @@ import (
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
-	"strconv"
+	"strings"
 )
 
 // Create a db.DB implementation that persists data in MongoDB. This implementation supports one-to-one correspondence
@@ -19,7 +20,8 @@ import (
 //
 // The database will attempt to create MongoDB indexes on attributes whose uniqueness is global or server, or that has
 // been annotated with "@MongoIndex". For unique attributes, a unique MongoDB index will be created, otherwise, it is
-// just an ordinary index. Any index creation error are treated as non-error and simply ignored.
+// just an ordinary index. Any index creation error are treated as non-error and simply ignored. Insert and Replace
+// return an error of spec.ErrUniqueness when a unique index is violated.
 //
 // This implementation has limited capability of correctly performing field projection according to the specification.
 // It dumbly treats the *crud.Projection parameter as it is without performing any sanitation. As a result, if any
@@ -35,9 +37,10 @@ import (
 // If so desired, use Options().IgnoreProjection() to ignore projection altogether and return a complete version of
 // the result every time.
 //
-// This implementation also has limited capability to correctly performing sorting according to the specification. The
-// control is not as fine grained as in crud.SeekSortTarget. It can sort on singular type, but may fail if asked to sort
-// on multiValued type, or a singular type within a multiValued type.
+// Sorting follows crud.SeekSortTarget: when sorting on a multiValued type, or a singular type within a multiValued type,
+// resources are sorted by the element whose primary attribute is true, or the first element. Such queries are carried
+// out by an aggregation adding the element to sort by to the documents, which cannot use an index to sort. Sorting on
+// a singular type within more than one multiValued type is not supported.
 //
 // This implementation do not directly use the SCIM attribute path to persist into MongoDB. Instead, it uses a concept
 // of MongoDB persistence paths (or mongo paths). These mongo paths are introduced to provide an alternative name to
@@ -56,13 +59,19 @@ import (
 // provided a resource as argument which was fetched from the database, hence, the resource by the id must have existed.
 // The only reason that id and version failed to match would then because another process modified the resource concurrently.
 // Therefore, conflict seems to be a reasonable error code.
+//
+// The calls with a context carrying a transaction of the client of the collection are part of the transaction (see
+// Transaction), and the returned DB implements db.TxDB, whose WithTx starts such a transaction with the default
+// options, which the databases of other collections of the client take part in. It also implements db.ChangeStreamDB,
+// by watching the change stream of the collection (see Subscribe).
 func DB(resourceType *spec.ResourceType, coll *mongo.Collection, opt *DBOptions) db.DB {
 	d := &mongoDB{
-		resourceType: resourceType,
-		superAttr:    resourceType.SuperAttribute(true),
-		coll:         coll,
-		t:            newTransformer(resourceType),
-		opt:          opt,
+		resourceType:  resourceType,
+		superAttr:     resourceType.SuperAttribute(true),
+		coll:          coll,
+		t:             newTransformer(resourceType),
+		opt:           opt,
+		uniqueIndexes: map[string]string{},
 	}
 	d.ensureIndex()
 	return d
@@ -74,23 +83,49 @@ type mongoDB struct {
 	coll         *mongo.Collection
 	t            *transformer
 	opt          *DBOptions
+	// scim paths of the attributes of the unique indexes, by index name
+	uniqueIndexes map[string]string
 }
 
 func (d *mongoDB) Insert(ctx context.Context, resource *prop.Resource) error {
 	_, err := d.coll.InsertOne(ctx, newBsonAdapter(resource), options.InsertOne())
 	if err != nil {
-		return fmt.Errorf("%w: %v", spec.ErrInternal, err)
+		return d.errWrite(err)
 	}
 	return nil
 }
 
+// InsertMany inserts the resources in one unordered bulk insert, so that the resources violating a unique index do not
+// prevent the others from being inserted, and implements db.BulkWriteDB.
+func (d *mongoDB) InsertMany(ctx context.Context, resources []*prop.Resource) []error {
+	if len(resources) == 0 {
+		return []error{}
+	}
+	docs := make([]interface{}, 0, len(resources))
+	for _, resource := range resources {
+		docs = append(docs, newBsonAdapter(resource))
+	}
+	_, err := d.coll.InsertMany(ctx, docs, options.InsertMany().SetOrdered(false))
+	return d.errWriteMany(len(resources), err)
+}
+
 func (d *mongoDB) Count(ctx context.Context, filter string) (int, error) {
-	tf, err := d.mongoFilter(filter)
-	if err != nil {
-		return 0, err
+	opt := options.Count()
+	tf := bson.D{}
+	if len(strings.TrimSpace(filter)) > 0 {
+		var (
+			collation *options.Collation
+			err       error
+		)
+		if tf, collation, err = d.mongoFilter(filter); err != nil {
+			return 0, err
+		}
+		if collation != nil {
+			opt.SetCollation(collation)
+		}
 	}
 
-	n, err := d.coll.CountDocuments(ctx, tf, options.Count())
+	n, err := d.coll.CountDocuments(ctx, tf, opt)
 	if err != nil {
 		return 0, fmt.Errorf("%w: %v", spec.ErrInternal, err)
 	}
@@ -104,7 +139,7 @@ func (d *mongoDB) Get(ctx context.Context, id string, projection *crud.Projectio
 		opt = opt.SetProjection(d.mongoProjection(projection))
 	}
 
-	tf, err := d.mongoFilter(fmt.Sprintf("id eq %s", strconv.Quote(id)))
+	tf, _, err := d.mongoFilter(crud.Filter().Eq("id", id).String())
 	if err != nil {
 		return nil, err
 	}
@@ -125,12 +160,137 @@ func (d *mongoDB) Get(ctx context.Context, id string, projection *crud.Projectio
 	return w.Resource(), nil
 }
 
+// GetMany gets the resources by their ids in one query, and implements db.BatchDB.
+func (d *mongoDB) GetMany(ctx context.Context, ids []string, projection *crud.Projection) ([]*prop.Resource, error) {
+	opt := options.Find()
+	if !d.opt.ignoreProjection && projection != nil {
+		opt = opt.SetProjection(d.mongoProjection(projection))
+	}
+
+	idAttr := d.superAttr.SubAttributeForName("id")
+	idName := idAttr.Name()
+	if md, ok := metadataHub[idAttr.ID()]; ok {
+		idName = md.MongoName
+	}
+
+	cursor, err := d.coll.Find(ctx, bson.D{{Key: idName, Value: bson.D{{Key: mongoIn, Value: ids}}}}, opt)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", spec.ErrInternal, err)
+	}
+
+	defer func() {
+		_ = cursor.Close(ctx)
+	}()
+
+	results := make([]*prop.Resource, 0, len(ids))
+	for cursor.Next(ctx) {
+		w := newResourceUnmarshaler(d.resourceType)
+		if err := cursor.Decode(w); err != nil {
+			return nil, err
+		}
+		results = append(results, w.Resource())
+	}
+	if err := cursor.Err(); err != nil {
+		return nil, err
+	}
+
+	return db.SortByIDs(results, ids), nil
+}
+
+// CountElements counts the elements of the multiValued attribute in the database, without loading the document, and
+// implements db.ElementDB.
+func (d *mongoDB) CountElements(ctx context.Context, id string, attribute string) (int, error) {
+	tf, mp, err := d.elementsFilter(id, attribute)
+	if err != nil {
+		return 0, err
+	}
+
+	cursor, err := d.coll.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: tf}},
+		{{Key: "$project", Value: bson.D{{Key: "n", Value: bson.D{{Key: "$size", Value: bson.D{
+			{Key: "$ifNull", Value: bson.A{"$" + mp, bson.A{}}},
+		}}}}}}},
+	})
+	if err != nil {
+		return 0, fmt.Errorf("%w: %v", spec.ErrInternal, err)
+	}
+	defer func() {
+		_ = cursor.Close(ctx)
+	}()
+
+	if !cursor.Next(ctx) {
+		if err := cursor.Err(); err != nil {
+			return 0, fmt.Errorf("%w: %v", spec.ErrInternal, err)
+		}
+		return 0, fmt.Errorf("%w: resource not found by id '%s'", spec.ErrNotFound, id)
+	}
+	var result struct {
+		N int `bson:"n"`
+	}
+	if err := cursor.Decode(&result); err != nil {
+		return 0, fmt.Errorf("%w: %v", spec.ErrInternal, err)
+	}
+	return result.N, nil
+}
+
+// GetElements loads the page of the elements of the multiValued attribute only, with the $slice projection, and
+// implements db.ElementDB.
+func (d *mongoDB) GetElements(ctx context.Context, id string, attribute string, pagination *crud.Pagination) ([]interface{}, error) {
+	tf, mp, err := d.elementsFilter(id, attribute)
+	if err != nil {
+		return nil, err
+	}
+
+	projection := bson.D{{Key: d.mongoPathFor("id"), Value: 1}}
+	switch {
+	case pagination == nil:
+		projection = append(projection, bson.E{Key: mp, Value: 1})
+	case pagination.Count > 0:
+		skip, limit := d.mongoPagination(pagination)
+		if skip < 0 {
+			skip = 0
+		}
+		projection = append(projection, bson.E{Key: mp, Value: bson.D{{Key: "$slice", Value: bson.A{skip, limit}}}})
+	}
+
+	sr := d.coll.FindOne(ctx, tf, options.FindOne().SetProjection(projection))
+	if err := sr.Err(); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, fmt.Errorf("%w: resource not found by id '%s'", spec.ErrNotFound, id)
+		}
+		return nil, fmt.Errorf("%w: %v", spec.ErrInternal, err)
+	}
+
+	w := newResourceUnmarshaler(d.resourceType)
+	if err := sr.Decode(w); err != nil {
+		return nil, err
+	}
+	property, err := w.Resource().RootProperty().ChildAtIndex(attribute)
+	if err != nil {
+		return nil, err
+	}
+	return db.PageElements(property, nil), nil
+}
+
+// Returns the filter matching the resource by id, and the mongo path of the multiValued attribute.
+func (d *mongoDB) elementsFilter(id string, attribute string) (bson.D, string, error) {
+	attr := d.superAttr.SubAttributeForName(attribute)
+	if attr == nil || !attr.MultiValued() {
+		return nil, "", fmt.Errorf("%w: '%s' is not a multiValued attribute", spec.ErrInvalidPath, attribute)
+	}
+	tf, _, err := d.mongoFilter(crud.Filter().Eq("id", id).String())
+	if err != nil {
+		return nil, "", err
+	}
+	return tf, d.mongoPathOf(attr), nil
+}
+
 func (d *mongoDB) Replace(ctx context.Context, ref *prop.Resource, resource *prop.Resource) error {
 	var (
 		id      = ref.IdOrEmpty()
 		version = ref.MetaVersionOrEmpty()
 	)
-	tf, err := d.mongoFilter(fmt.Sprintf("(id eq %s) and (meta.version eq %s)", strconv.Quote(id), strconv.Quote(version)))
+	tf, _, err := d.mongoFilter(crud.Filter().Eq("id", id).Eq("meta.version", version).String())
 	if err != nil {
 		return err
 	}
@@ -140,7 +300,7 @@ func (d *mongoDB) Replace(ctx context.Context, ref *prop.Resource, resource *pro
 		if err == mongo.ErrNoDocuments {
 			return d.errNotFoundOrModified(id)
 		}
-		return err
+		return d.errWrite(err)
 	}
 
 	return nil
@@ -151,7 +311,7 @@ func (d *mongoDB) Delete(ctx context.Context, resource *prop.Resource) error {
 		id      = resource.IdOrEmpty()
 		version = resource.MetaVersionOrEmpty()
 	)
-	tf, err := d.mongoFilter(fmt.Sprintf("(id eq %s) and (meta.version eq %s)", strconv.Quote(id), strconv.Quote(version)))
+	tf, _, err := d.mongoFilter(crud.Filter().Eq("id", id).Eq("meta.version", version).String())
 	if err != nil {
 		return err
 	}
@@ -168,15 +328,27 @@ func (d *mongoDB) Delete(ctx context.Context, resource *prop.Resource) error {
 }
 
 func (d *mongoDB) Query(ctx context.Context, filter string, sort *crud.Sort, pagination *crud.Pagination, projection *crud.Projection) ([]*prop.Resource, error) {
-	opt := options.Find()
-
-	tf, err := d.mongoFilter(filter)
+	tf, collation, err := d.mongoFilter(filter)
 	if err != nil {
 		return nil, err
 	}
 
+	var sorts, fields bson.D
 	if sort != nil {
-		opt.SetSort(d.mongoSort(sort))
+		if sorts, fields, err = d.mongoSort(sort); err != nil {
+			return nil, err
+		}
+	}
+	if len(fields) > 0 {
+		return d.aggregate(ctx, tf, collation, fields, sorts, pagination, projection)
+	}
+
+	opt := options.Find()
+	if collation != nil {
+		opt.SetCollation(collation)
+	}
+	if sort != nil {
+		opt.SetSort(sorts)
 	}
 	if pagination != nil {
 		skip, limit := d.mongoPagination(pagination)
@@ -187,11 +359,69 @@ func (d *mongoDB) Query(ctx context.Context, filter string, sort *crud.Sort, pag
 		opt.SetProjection(d.mongoProjection(projection))
 	}
 
+	return d.find(ctx, tf, opt)
+}
+
+// Returns the resources of the documents matching the MongoDB filter, with the fields added to them for sorting (see
+// mongoSort), which are projected out of the documents again.
+func (d *mongoDB) aggregate(
+	ctx context.Context,
+	tf bson.D,
+	collation *options.Collation,
+	fields bson.D,
+	sorts bson.D,
+	pagination *crud.Pagination,
+	projection *crud.Projection,
+) ([]*prop.Resource, error) {
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: tf}},
+		{{Key: "$addFields", Value: fields}},
+		{{Key: "$sort", Value: sorts}},
+	}
+	if pagination != nil {
+		skip, limit := d.mongoPagination(pagination)
+		if skip > 0 {
+			pipeline = append(pipeline, bson.D{{Key: "$skip", Value: skip}})
+		}
+		if limit > 0 {
+			pipeline = append(pipeline, bson.D{{Key: "$limit", Value: limit}})
+		}
+	}
+
+	// included attributes leave the added fields out already, otherwise they are excluded along
+	project := bson.D{}
+	if !d.opt.ignoreProjection && projection != nil {
+		project = d.mongoProjection(projection)
+	}
+	if len(project) == 0 || project[0].Value == 0 {
+		for _, field := range fields {
+			project = append(project, bson.E{Key: field.Key, Value: 0})
+		}
+	}
+	pipeline = append(pipeline, bson.D{{Key: "$project", Value: project}})
+
+	opt := options.Aggregate()
+	if collation != nil {
+		opt.SetCollation(collation)
+	}
+	cursor, err := d.coll.Aggregate(ctx, pipeline, opt)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", spec.ErrInternal, err)
+	}
+	return d.decode(ctx, cursor)
+}
+
+// Returns the resources of the documents matching the MongoDB filter.
+func (d *mongoDB) find(ctx context.Context, tf bson.D, opt *options.FindOptions) ([]*prop.Resource, error) {
 	cursor, err := d.coll.Find(ctx, tf, opt)
 	if err != nil {
 		return nil, fmt.Errorf("%w: %v", spec.ErrInternal, err)
 	}
+	return d.decode(ctx, cursor)
+}
 
+// Returns the resources of the documents of the cursor, which is closed afterwards.
+func (d *mongoDB) decode(ctx context.Context, cursor *mongo.Cursor) ([]*prop.Resource, error) {
 	defer func() {
 		_ = cursor.Close(ctx)
 	}()
@@ -221,10 +451,20 @@ func (d *mongoDB) Query(ctx context.Context, filter string, sort *crud.Sort, pag
 //
 // If this method is unable to find a path, or encounters any error, an empty string is returned.
 func (d *mongoDB) mongoPathFor(path string) string {
+	attrs := d.attributesFor(path)
+	if len(attrs) == 0 {
+		return ""
+	}
+	return d.mongoPathOf(attrs[len(attrs)-1])
+}
+
+// Traverse the attributes structure along the tokens in the given path and return the attributes traversed, from the
+// top level attribute to the target attribute, or nil if the path cannot be resolved.
+func (d *mongoDB) attributesFor(path string) []*spec.Attribute {
 	curAttr := d.superAttr
 	cursor, err := expr.CompilePath(path)
 	if err != nil {
-		return ""
+		return nil
 	}
 
 	// skip the first token in the path starts with the id of the resource type's default schema.
@@ -233,47 +473,153 @@ func (d *mongoDB) mongoPathFor(path string) string {
 		cursor = cursor.Next()
 	}
 	if cursor == nil {
-		return ""
+		return nil
 	}
 
+	var attrs []*spec.Attribute
 	for cursor != nil {
 		curAttr = curAttr.SubAttributeForName(cursor.Token())
 		if curAttr == nil {
-			return ""
+			return nil
 		}
+		attrs = append(attrs, curAttr)
 		cursor = cursor.Next()
 	}
 
-	mp := curAttr.Path()
-	if md, ok := metadataHub[curAttr.ID()]; ok {
-		mp = md.MongoPath
-	}
+	return attrs
+}
 
-	return mp
+// Returns the MongoDB persistence path of the attribute, which is the registered metadata's MongoPath if any, or the
+// attribute's path.
+func (d *mongoDB) mongoPathOf(attr *spec.Attribute) string {
+	if md, ok := metadataHub[attr.ID()]; ok {
+		return md.MongoPath
+	}
+	return attr.Path()
 }
 
 // Convert the crud.Sort structure to MongoDB driver compatible bson.D structure, so that it can be serialized by the
-// driver. The supplied sort parameter must not be nil. If the sort.By is empty, or sort.By cannot resolve its
-// corresponding MongoDB persistence path, sort is done on the internal "_id" field instead.
-func (d *mongoDB) mongoSort(sort *crud.Sort) bson.D {
-	var by string
-	{
-		if len(sort.By) > 0 {
-			by = d.mongoPathFor(sort.By)
+// driver. The supplied sort parameter must not be nil. Each sort key is converted to its corresponding MongoDB
+// persistence path, and keys that cannot be resolved are skipped. Ties are broken by the resource id, or the internal
+// "_id" field if the id cannot be resolved, so that the order is deterministic across pages.
+//
+// MongoDB sorts documents by the smallest (ascending) or the largest (descending) element when the sort path traverses
+// an array, which differs from the primary-or-first element rule applied by crud.SeekSortTarget. Hence, keys traversing
+// a multiValued attribute sort by a field added to the documents instead, holding the element whose primary attribute
+// is true, or the first element, of the attribute. These fields are returned as well, to be added by an $addFields
+// stage before sorting.
+func (d *mongoDB) mongoSort(sort *crud.Sort) (bson.D, bson.D, error) {
+	keys, err := sort.Keys()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var (
+		sorts  = bson.D{}
+		fields = bson.D{}
+		seen   = map[string]bool{}
+	)
+	for _, key := range keys {
+		by, field, err := d.mongoSortKey(key.By, len(fields))
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(by) == 0 || seen[by] {
+			continue
+		}
+		seen[by] = true
+		if field != nil {
+			fields = append(fields, *field)
+		}
+		switch key.Order {
+		case crud.SortDesc:
+			sorts = append(sorts, bson.E{Key: by, Value: -1})
+		default:
+			sorts = append(sorts, bson.E{Key: by, Value: 1})
+		}
+	}
+
+	tieBreaker := d.mongoPathFor("id")
+	if len(tieBreaker) == 0 {
+		tieBreaker = "_id"
+	}
+	if !seen[tieBreaker] {
+		sorts = append(sorts, bson.E{Key: tieBreaker, Value: 1})
+	}
+	return sorts, fields, nil
+}
+
+// Prefix of the fields added to the documents to sort by multiValued attributes, see mongoSort.
+const sortFieldPrefix = "_sort_"
+
+// Returns the path to sort by for the sortBy attribute, or an empty string if the attribute cannot be resolved. If it
+// traverses a multiValued attribute, the path is that of the n-th field added to the documents, which is returned as
+// well. Like crud.SeekSortTarget, a multiValued complex attribute is sorted by the "value" of its element. An error of
+// spec.ErrInvalidSyntax is returned if the attribute traverses more than one multiValued attribute.
+func (d *mongoDB) mongoSortKey(path string, n int) (string, *bson.E, error) {
+	attrs := d.attributesFor(path)
+	if len(attrs) == 0 {
+		return "", nil, nil
+	}
+
+	for i, attr := range attrs {
+		if !attr.MultiValued() {
+			continue
+		}
+
+		rest := attrs[i+1:]
+		if len(rest) == 0 && attr.Type() == spec.TypeComplex {
+			value := attr.SubAttributeForName("value")
+			if value == nil {
+				return "", nil, nil
+			}
+			rest = []*spec.Attribute{value}
 		}
-		if len(by) == 0 {
-			by = "_id"
+
+		field := bson.E{Key: fmt.Sprintf("%s%d", sortFieldPrefix, n), Value: d.primaryOrFirst(attr)}
+		by := field.Key
+		for _, each := range rest {
+			if each.MultiValued() {
+				return "", nil, fmt.Errorf("%w: cannot sort by nested multiValued attribute '%s'", spec.ErrInvalidSyntax, path)
+			}
+			by += "." + d.mongoNameOf(each)
 		}
+		return by, &field, nil
 	}
 
-	switch sort.Order {
-	case crud.SortAsc, crud.SortDefault:
-		return bson.D{{Key: by, Value: 1}}
-	case crud.SortDesc:
-		return bson.D{{Key: by, Value: -1}}
-	default:
-		panic("invalid sort order")
+	return d.mongoPathOf(attrs[len(attrs)-1]), nil, nil
+}
+
+// Returns the aggregation expression of the element of the multiValued attribute whose primary attribute is true, or
+// of the first element, which is missing if the attribute has no elements.
+func (d *mongoDB) primaryOrFirst(attr *spec.Attribute) bson.D {
+	elements := bson.D{{Key: "$ifNull", Value: bson.A{"$" + d.mongoPathOf(attr), bson.A{}}}}
+
+	primary := attr.FindSubAttribute(func(subAttr *spec.Attribute) bool {
+		_, ok := subAttr.Annotation(annotation.Primary)
+		return ok && subAttr.Type() == spec.TypeBoolean
+	})
+	if primary != nil {
+		// the primary elements come first, ahead of all elements
+		elements = bson.D{{Key: "$concatArrays", Value: bson.A{
+			bson.D{{Key: "$filter", Value: bson.D{
+				{Key: "input", Value: elements},
+				{Key: "cond", Value: bson.D{{Key: mongoEq, Value: bson.A{"$$this." + d.mongoNameOf(primary), true}}}},
+			}}},
+			elements,
+		}}}
 	}
+
+	return bson.D{{Key: "$arrayElemAt", Value: bson.A{elements, 0}}}
+}
+
+// Returns the MongoDB persistence name of the attribute, which is the registered metadata's MongoName if any, or the
+// attribute's name.
+func (d *mongoDB) mongoNameOf(attr *spec.Attribute) string {
+	if md, ok := metadataHub[attr.ID()]; ok {
+		return md.MongoName
+	}
+	return attr.Name()
 }
 
 // Convert crud.Pagination parameter to Mongo compatible option parameters. The supplied pagination parameter
@@ -301,7 +647,7 @@ func (d *mongoDB) mongoProjection(projection *crud.Projection) bson.D {
 
 	if len(projection.ExcludedAttributes) > 0 {
 		exclude := bson.D{}
-		for _, p := range projection.Attributes {
+		for _, p := range projection.ExcludedAttributes {
 			if mp := d.mongoPathFor(p); len(mp) > 0 {
 				exclude = append(exclude, bson.E{Key: mp, Value: 0})
 			}
@@ -313,17 +659,21 @@ func (d *mongoDB) mongoProjection(projection *crud.Projection) bson.D {
 }
 
 // Convert the SCIM filter to MongoDB driver compatible bson.D structure. This method uses transformer (see filter.go)
-// to transform the compiled abstract syntax tree of the filter to bson.D containing MongoDB filter directives.
-func (d *mongoDB) mongoFilter(filter string) (bson.D, error) {
+// to transform the compiled abstract syntax tree of the filter to bson.D containing MongoDB filter directives. When
+// Options().UseCollation() is set, the returned collation, if not nil, shall be used to execute the query.
+func (d *mongoDB) mongoFilter(filter string) (bson.D, *options.Collation, error) {
 	cf, err := expr.CompileFilter(filter)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
+	}
+	if d.opt.useCollation {
+		return TransformCompiledFilterWithCollation(cf, d.resourceType)
 	}
 	tf, err := d.t.transform(cf)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
-	return tf, nil
+	return tf, nil, nil
 }
 
 func (d *mongoDB) errNotFoundOrModified(id string) error {
@@ -337,6 +687,7 @@ func Options() *DBOptions {
 
 type DBOptions struct {
 	ignoreProjection bool
+	useCollation     bool
 }
 
 // Ask the database to ignore any projection parameters. This might be reasonable when the downstream services
@@ -346,6 +697,38 @@ func (opt *DBOptions) IgnoreProjection() *DBOptions {
 	return opt
 }
 
+// Ask the database to carry out case insensitive comparisons in filters using CaseInsensitiveCollation, instead of
+// case insensitive regular expressions, whenever possible (see TransformCompiledFilterWithCollation). This allows
+// queries to utilize indexes created with the same collation, which case insensitive regular expressions cannot.
+func (opt *DBOptions) UseCollation() *DBOptions {
+	opt.useCollation = true
+	return opt
+}
+
+// ReplaceMany replaces the resources one by one, since a bulk write of replacements does not report which of them
+// were not replaced because their version changed.
+func (d *mongoDB) ReplaceMany(ctx context.Context, replacements []db.Replacement) []error {
+	errs := make([]error, len(replacements))
+	for i, r := range replacements {
+		errs[i] = d.Replace(ctx, r.Ref, r.Replacement)
+	}
+	return errs
+}
+
+// DeleteMany deletes the resources one by one, for the same reason as ReplaceMany.
+func (d *mongoDB) DeleteMany(ctx context.Context, resources []*prop.Resource) []error {
+	errs := make([]error, len(resources))
+	for i, resource := range resources {
+		errs[i] = d.Delete(ctx, resource)
+	}
+	return errs
+}
+
 var (
-	_ db.DB = (*mongoDB)(nil)
+	_ db.CursorDB       = (*mongoDB)(nil)
+	_ db.BatchDB        = (*mongoDB)(nil)
+	_ db.ElementDB      = (*mongoDB)(nil)
+	_ db.TxDB           = (*mongoDB)(nil)
+	_ db.BulkWriteDB    = (*mongoDB)(nil)
+	_ db.ChangeStreamDB = (*mongoDB)(nil)
 )
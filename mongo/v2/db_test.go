@@ -3,6 +3,7 @@ package v2
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/imulab/go-scim/pkg/v2/crud"
 	"github.com/imulab/go-scim/pkg/v2/db"
@@ -489,6 +490,59 @@ func (s *MongoDatabaseTestSuite) TestQuery() {
 				assert.Equal(t, "user005", results[1].Navigator().Dot("userName").Current().Raw())
 			},
 		},
+		{
+			name:        "sort by primary or first email",
+			description: "MongoDB alone would sort user001 first, by its smallest email",
+			prepare: func(t *testing.T, database db.DB) {
+				for _, f := range []string{
+					`
+{
+  "schemas": ["urn:ietf:params:scim:schemas:core:2.0:User"],
+  "id": "user001",
+  "userName": "user001",
+  "emails": [{"value": "a@foo.com"}, {"value": "d@foo.com", "primary": true}]
+}
+`,
+					`
+{
+  "schemas": ["urn:ietf:params:scim:schemas:core:2.0:User"],
+  "id": "user002",
+  "userName": "user002",
+  "emails": [{"value": "c@foo.com"}, {"value": "b@foo.com"}]
+}
+`,
+					`
+{
+  "schemas": ["urn:ietf:params:scim:schemas:core:2.0:User"],
+  "id": "user003",
+  "userName": "user003"
+}
+`,
+				} {
+					r := prop.NewResource(s.resourceType)
+					assert.Nil(t, scimjson.Deserialize([]byte(f), r))
+					assert.Nil(t, database.Insert(context.Background(), r))
+				}
+			},
+			filter: "userName sw \"user\"",
+			sort: &crud.Sort{
+				By:    "emails.value",
+				Order: crud.SortAsc,
+			},
+			pagination: &crud.Pagination{
+				StartIndex: 2,
+				Count:      2,
+			},
+			projection: &crud.Projection{
+				Attributes: []string{"id", "emails"},
+			},
+			expect: func(t *testing.T, results []*prop.Resource, err error) {
+				assert.Nil(t, err)
+				require.Len(t, results, 2)
+				assert.Equal(t, "user002", results[0].IdOrEmpty())
+				assert.Equal(t, "user001", results[1].IdOrEmpty())
+			},
+		},
 	}
 
 	for _, test := range tests {
@@ -555,6 +609,45 @@ func (s *MongoDatabaseTestSuite) TestSaveGetDeleteCount() {
 	assert.Equal(s.T(), 0, n)
 }
 
+func (s *MongoDatabaseTestSuite) TestQueryCursor() {
+	client, err := s.newClient()
+	s.Require().Nil(err)
+	coll := client.Database(testMongoDatabaseName).Collection(s.T().Name())
+	database := DB(s.resourceType, coll, Options()).(db.CursorDB)
+
+	for _, each := range []string{
+		`{"schemas": ["urn:ietf:params:scim:schemas:core:2.0:User"], "id": "user001", "userName": "carol", "active": true}`,
+		`{"schemas": ["urn:ietf:params:scim:schemas:core:2.0:User"], "id": "user002", "userName": "alice", "active": true}`,
+		`{"schemas": ["urn:ietf:params:scim:schemas:core:2.0:User"], "id": "user003", "userName": "bob", "active": false}`,
+		`{"schemas": ["urn:ietf:params:scim:schemas:core:2.0:User"], "id": "user004", "userName": "dave", "active": true}`,
+	} {
+		resource := prop.NewResource(s.resourceType)
+		s.Require().Nil(scimjson.Deserialize([]byte(each), resource))
+		s.Require().Nil(database.Insert(context.Background(), resource))
+	}
+
+	var (
+		ids        []string
+		pagination = &crud.CursorPagination{Count: 2}
+		sort       = &crud.Sort{By: "userName"}
+	)
+	for {
+		results, next, err := database.QueryCursor(context.Background(), "active eq true", sort, pagination, nil)
+		s.Require().Nil(err)
+		for _, each := range results {
+			ids = append(ids, each.IdOrEmpty())
+		}
+		if len(next) == 0 {
+			break
+		}
+		pagination.Cursor = next
+	}
+	assert.Equal(s.T(), []string{"user002", "user001", "user004"}, ids)
+
+	_, _, err = database.QueryCursor(context.Background(), "", nil, &crud.CursorPagination{Cursor: "malformed"}, nil)
+	assert.True(s.T(), errors.Is(err, spec.ErrInvalidCursor))
+}
+
 // connect to MongoDB docker container before the suite
 func (s *MongoDatabaseTestSuite) SetupSuite() {
 	s.parseResourceType()
@@ -6,9 +6,10 @@ import (
 	"github.com/imulab/go-scim/pkg/v2/spec"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"regexp"
 	"strconv"
 	"strings"
-	"time"
 )
 
 // Contrary to the main theme in this package, the methods in this file transforms SCIM filter to an
@@ -37,6 +38,30 @@ func TransformCompiledFilter(root *expr.Expression, resourceType *spec.ResourceT
 	return newTransformer(resourceType).transform(root)
 }
 
+// CaseInsensitiveCollation is the collation under which comparisons of strings are case insensitive.
+var CaseInsensitiveCollation = &options.Collation{Locale: "en", Strength: 2}
+
+// Compile and transform a compiled SCIM filter to bson.D, along with the collation to execute the query with. When
+// every string comparison (eq, ne, gt, ge, lt, le) in the filter targets an attribute that is not caseExact, these
+// comparisons are expressed as plain operators to be executed under CaseInsensitiveCollation, which, unlike case
+// insensitive regular expressions, is able to utilize indexes created with the same collation. Otherwise, the returned
+// collation is nil and case insensitive comparisons are expressed as regular expressions, as in TransformCompiledFilter.
+// Note sw, ew, co and re are always expressed as regular expressions, which are not affected by collation.
+func TransformCompiledFilterWithCollation(root *expr.Expression, resourceType *spec.ResourceType) (bson.D, *options.Collation, error) {
+	t := newTransformer(resourceType)
+	if !t.collationApplicable(t.superAttr, root) {
+		tf, err := t.transform(root)
+		return tf, nil, err
+	}
+
+	t.collation = true
+	tf, err := t.transform(root)
+	if err != nil {
+		return nil, nil, err
+	}
+	return tf, CaseInsensitiveCollation, nil
+}
+
 func newTransformer(resourceType *spec.ResourceType) *transformer {
 	return &transformer{
 		superAttr: resourceType.SuperAttribute(true),
@@ -45,6 +70,58 @@ func newTransformer(resourceType *spec.ResourceType) *transformer {
 
 type transformer struct {
 	superAttr *spec.Attribute
+	// when true, case insensitive string comparisons are carried out by collation instead of regular expressions
+	collation bool
+}
+
+// Returns true if collation can be used to carry out case insensitive comparisons in the filter, that is, the filter
+// contains at least one case insensitive comparison, and no case sensitive string comparisons, which would otherwise
+// become case insensitive as well under the collation.
+func (t *transformer) collationApplicable(superAttr *spec.Attribute, root *expr.Expression) bool {
+	var insensitive, sensitive bool
+	var visit func(node *expr.Expression)
+	visit = func(node *expr.Expression) {
+		if node == nil {
+			return
+		}
+		switch node.Token() {
+		case expr.And, expr.Or, expr.Not:
+			visit(node.Left())
+			visit(node.Right())
+			return
+		case expr.Pr, expr.Sw, expr.Ew, expr.Co, expr.Re:
+			return
+		}
+
+		attr := t.targetAttribute(superAttr, node.Left())
+		switch {
+		case attr == nil:
+			sensitive = true // unknown attribute, play safe; transform will report the error anyway.
+		case attr.Type() == spec.TypeString || attr.Type() == spec.TypeReference || attr.Type() == spec.TypeBinary:
+			if t.caseInsensitive(attr) {
+				insensitive = true
+			} else {
+				sensitive = true
+			}
+		}
+	}
+	visit(root)
+	return insensitive && !sensitive
+}
+
+// Returns the attribute targeted by the path, or nil if the path cannot be resolved.
+func (t *transformer) targetAttribute(superAttr *spec.Attribute, path *expr.Expression) *spec.Attribute {
+	cursor := superAttr
+	for path != nil {
+		if cursor.MultiValued() {
+			cursor = cursor.DeriveElementAttribute()
+		}
+		if cursor = cursor.SubAttributeForName(path.Token()); cursor == nil {
+			return nil
+		}
+		path = path.Next()
+	}
+	return cursor
 }
 
 // Transform the filter which is represented by the root to bsonx.Val.
@@ -186,69 +263,73 @@ func (t *transformer) rearrangeForPr(doc bson.D) bson.D {
 	return bson.D{{Key: mongoAnd, Value: newCriterion}}
 }
 
-func (t *transformer) eqValue(attr *spec.Attribute, value *expr.Expression) interface{} {
-	if attr.Type() != spec.TypeString && attr.CaseExact() {
-		return bson.D{
-			{Key: mongoEq, Value: unquote(value.Token())},
-		}
-	} else {
+// Returns true if the attribute holds string values that shall be compared case insensitively.
+func (t *transformer) caseInsensitive(attr *spec.Attribute) bool {
+	return attr.Type() == spec.TypeString && !attr.CaseExact()
+}
+
+func (t *transformer) eqValue(attr *spec.Attribute, value *expr.Expression) (interface{}, error) {
+	if t.caseInsensitive(attr) && !t.collation {
 		return primitive.Regex{
-			Pattern: fmt.Sprintf("^%s$", unquote(value.Token())),
+			Pattern: fmt.Sprintf("^%s$", regexp.QuoteMeta(unquote(value.Token()))),
 			Options: "i",
-		}
+		}, nil
+	}
+
+	v, err := t.parseValue(value.Token(), attr)
+	if err != nil {
+		return nil, err
 	}
+	return bson.D{
+		{Key: mongoEq, Value: v},
+	}, nil
 }
 
-func (t *transformer) neValue(attr *spec.Attribute, value *expr.Expression) interface{} {
-	if attr.Type() != spec.TypeString || attr.CaseExact() {
+func (t *transformer) neValue(attr *spec.Attribute, value *expr.Expression) (interface{}, error) {
+	if t.caseInsensitive(attr) && !t.collation {
 		return bson.D{
-			{Key: mongoNe, Value: unquote(value.Token())},
-		}
-	} else {
-		return primitive.Regex{
-			Pattern: fmt.Sprintf("^((?!%s$).)", unquote(value.Token())),
-			Options: "i",
-		}
+			{Key: mongoNotOp, Value: primitive.Regex{
+				Pattern: fmt.Sprintf("^%s$", regexp.QuoteMeta(unquote(value.Token()))),
+				Options: "i",
+			}},
+		}, nil
 	}
-}
 
-func (t *transformer) swValue(attr *spec.Attribute, value *expr.Expression) primitive.Regex {
-	if attr.CaseExact() {
-		return primitive.Regex{
-			Pattern: fmt.Sprintf("^%s", unquote(value.Token())),
-		}
-	} else {
-		return primitive.Regex{
-			Pattern: fmt.Sprintf("^%s", unquote(value.Token())),
-			Options: "i",
-		}
+	v, err := t.parseValue(value.Token(), attr)
+	if err != nil {
+		return nil, err
 	}
+	return bson.D{
+		{Key: mongoNe, Value: v},
+	}, nil
 }
 
-func (t *transformer) ewValue(attr *spec.Attribute, value *expr.Expression) primitive.Regex {
-	if attr.CaseExact() {
-		return primitive.Regex{
-			Pattern: fmt.Sprintf("%s$", unquote(value.Token())),
-		}
-	} else {
-		return primitive.Regex{
-			Pattern: fmt.Sprintf("%s$", unquote(value.Token())),
-			Options: "i",
-		}
+// Returns the regular expression for the pattern. Regular expressions are not subject to collation, hence case
+// insensitivity is always expressed using the "i" option.
+func (t *transformer) regex(attr *spec.Attribute, pattern string) (primitive.Regex, error) {
+	if attr.Type() != spec.TypeString && attr.Type() != spec.TypeReference {
+		return primitive.Regex{}, fmt.Errorf("%w: operator cannot be applied to non-string attribute '%s'", spec.ErrInvalidFilter, attr.Path())
+	}
+	if t.caseInsensitive(attr) {
+		return primitive.Regex{Pattern: pattern, Options: "i"}, nil
 	}
+	return primitive.Regex{Pattern: pattern}, nil
 }
 
-func (t *transformer) coValue(attr *spec.Attribute, value *expr.Expression) primitive.Regex {
-	if attr.CaseExact() {
-		return primitive.Regex{
-			Pattern: unquote(value.Token()),
-		}
-	} else {
-		return primitive.Regex{
-			Pattern: "unquote(value.Token())",
-			Options: "i",
-		}
-	}
+func (t *transformer) swValue(attr *spec.Attribute, value *expr.Expression) (primitive.Regex, error) {
+	return t.regex(attr, fmt.Sprintf("^%s", regexp.QuoteMeta(unquote(value.Token()))))
+}
+
+func (t *transformer) ewValue(attr *spec.Attribute, value *expr.Expression) (primitive.Regex, error) {
+	return t.regex(attr, fmt.Sprintf("%s$", regexp.QuoteMeta(unquote(value.Token()))))
+}
+
+func (t *transformer) coValue(attr *spec.Attribute, value *expr.Expression) (primitive.Regex, error) {
+	return t.regex(attr, regexp.QuoteMeta(unquote(value.Token())))
+}
+
+func (t *transformer) reValue(attr *spec.Attribute, value *expr.Expression) (primitive.Regex, error) {
+	return t.regex(attr, unquote(value.Token()))
 }
 
 func (t *transformer) gtValue(attr *spec.Attribute, value *expr.Expression) (bson.D, error) {
@@ -310,15 +391,17 @@ func (t *transformer) prDoc(attr *spec.Attribute) bson.D {
 func (t *transformer) transformValue(attr *spec.Attribute, op *expr.Expression, value *expr.Expression) (interface{}, error) {
 	switch op.Token() {
 	case expr.Eq:
-		return t.eqValue(attr, value), nil
+		return t.eqValue(attr, value)
 	case expr.Ne:
-		return t.neValue(attr, value), nil
+		return t.neValue(attr, value)
 	case expr.Sw:
-		return t.swValue(attr, value), nil
+		return t.swValue(attr, value)
 	case expr.Ew:
-		return t.ewValue(attr, value), nil
+		return t.ewValue(attr, value)
 	case expr.Co:
-		return t.coValue(attr, value), nil
+		return t.coValue(attr, value)
+	case expr.Re:
+		return t.reValue(attr, value)
 	case expr.Gt:
 		return t.gtValue(attr, value)
 	case expr.Ge:
@@ -348,7 +431,7 @@ func (t transformer) parseValue(raw string, attr *spec.Attribute) (interface{},
 	case spec.TypeString, spec.TypeReference, spec.TypeBinary:
 		return unquote(raw), nil
 	case spec.TypeDateTime:
-		parsed, err := time.Parse(spec.ISO8601, unquote(raw))
+		parsed, err := spec.ParseDateTime(unquote(raw))
 		if err != nil {
 			return nil, t.errIncompatibleValue(attr)
 		}
@@ -377,7 +460,7 @@ func (t transformer) parseValue(raw string, attr *spec.Attribute) (interface{},
 }
 
 func unquote(raw string) string {
-	uq, err := strconv.Unquote(raw)
+	uq, err := expr.Unquote(raw)
 	if err != nil {
 		return raw
 	}
@@ -401,6 +484,7 @@ const (
 	mongoAnd          = "$and"
 	mongoOr           = "$or"
 	mongoNot          = "$nor"
+	mongoNotOp        = "$not"
 	mongoElementMatch = "$elemMatch"
 	mongoEq           = "$eq"
 	mongoNe           = "$ne"
@@ -410,4 +494,5 @@ const (
 	mongoLe           = "$lte"
 	mongoExists       = "$exists"
 	mongoSize         = "$size"
+	mongoIn           = "$in"
 )
@@ -2,11 +2,13 @@ package v2
 
 import (
 	"encoding/json"
+	"github.com/imulab/go-scim/pkg/v2/crud/expr"
 	"github.com/imulab/go-scim/pkg/v2/spec"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"github.com/stretchr/testify/suite"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
 	"io/ioutil"
 	"os"
 	"testing"
@@ -78,7 +80,7 @@ func (s *TransformFilterTestSuite) TestTransform() {
 			filter: "emails.value eq \"foo@bar.com\"",
 			expect: func(t *testing.T, extJson string, err error) {
 				assert.Nil(t, err)
-				expect := `{"emails":{"$elemMatch":{"value":{"$regularExpression":{"pattern":"^foo@bar.com$","options":"i"}}}}}`
+				expect := `{"emails":{"$elemMatch":{"value":{"$regularExpression":{"pattern":"^foo@bar\\.com$","options":"i"}}}}}`
 				assert.JSONEq(t, expect, extJson)
 			},
 		},
@@ -87,7 +89,7 @@ func (s *TransformFilterTestSuite) TestTransform() {
 			filter: "userName ne \"imulab\"",
 			expect: func(t *testing.T, extJson string, err error) {
 				assert.Nil(t, err)
-				expect := `{"userName":{"$regularExpression":{"pattern":"^((?!imulab$).)","options":"i"}}}`
+				expect := `{"userName":{"$not":{"$regularExpression":{"pattern":"^imulab$","options":"i"}}}}`
 				assert.JSONEq(t, expect, extJson)
 			},
 		},
@@ -96,7 +98,7 @@ func (s *TransformFilterTestSuite) TestTransform() {
 			filter: "name.familyName ne \"Q\"",
 			expect: func(t *testing.T, extJson string, err error) {
 				assert.Nil(t, err)
-				expect := `{"name.familyName":{"$regularExpression":{"pattern":"^((?!Q$).)","options":"i"}}}`
+				expect := `{"name.familyName":{"$not":{"$regularExpression":{"pattern":"^Q$","options":"i"}}}}`
 				assert.JSONEq(t, expect, extJson)
 			},
 		},
@@ -114,7 +116,7 @@ func (s *TransformFilterTestSuite) TestTransform() {
 			filter: "emails.value ne \"foo@bar.com\"",
 			expect: func(t *testing.T, extJson string, err error) {
 				assert.Nil(t, err)
-				expect := `{"emails":{"$elemMatch":{"value":{"$regularExpression":{"pattern":"^((?!foo@bar.com$).)","options":"i"}}}}}`
+				expect := `{"emails":{"$elemMatch":{"value":{"$not":{"$regularExpression":{"pattern":"^foo@bar\\.com$","options":"i"}}}}}}`
 				assert.JSONEq(t, expect, extJson)
 			},
 		},
@@ -136,6 +138,51 @@ func (s *TransformFilterTestSuite) TestTransform() {
 				assert.JSONEq(t, expect, extJson)
 			},
 		},
+		{
+			name:   "caseExact eq",
+			filter: "id eq \"foobar\"",
+			expect: func(t *testing.T, extJson string, err error) {
+				assert.Nil(t, err)
+				expect := `{"id":{"$eq":"foobar"}}`
+				assert.JSONEq(t, expect, extJson)
+			},
+		},
+		{
+			name:   "boolean eq",
+			filter: "active eq true",
+			expect: func(t *testing.T, extJson string, err error) {
+				assert.Nil(t, err)
+				expect := `{"active":{"$eq":true}}`
+				assert.JSONEq(t, expect, extJson)
+			},
+		},
+		{
+			name:   "boolean ne",
+			filter: "active ne true",
+			expect: func(t *testing.T, extJson string, err error) {
+				assert.Nil(t, err)
+				expect := `{"active":{"$ne":true}}`
+				assert.JSONEq(t, expect, extJson)
+			},
+		},
+		{
+			name:   "sw escapes regular expression",
+			filter: "userName sw \"a.b*\"",
+			expect: func(t *testing.T, extJson string, err error) {
+				assert.Nil(t, err)
+				expect := `{"userName":{"$regularExpression":{"pattern":"^a\\.b\\*","options":"i"}}}`
+				assert.JSONEq(t, expect, extJson)
+			},
+		},
+		{
+			name:   "caseExact co",
+			filter: "id co \"foo\"",
+			expect: func(t *testing.T, extJson string, err error) {
+				assert.Nil(t, err)
+				expect := `{"id":{"$regularExpression":{"pattern":"foo","options":""}}}`
+				assert.JSONEq(t, expect, extJson)
+			},
+		},
 	}
 
 	for _, test := range tests {
@@ -149,6 +196,74 @@ func (s *TransformFilterTestSuite) TestTransform() {
 	}
 }
 
+func (s *TransformFilterTestSuite) TestTransformRegex() {
+	expr.EnableRegexOperator(true)
+	defer expr.EnableRegexOperator(false)
+
+	v, err := TransformFilter(`userName re "^[a-z]+\\.dev$"`, s.resourceType)
+	require.Nil(s.T(), err)
+	raw, err := bson.MarshalExtJSON(v, true, false)
+	require.Nil(s.T(), err)
+	assert.JSONEq(s.T(), `{"userName":{"$regularExpression":{"pattern":"^[a-z]+\\.dev$","options":"i"}}}`, string(raw))
+}
+
+func (s *TransformFilterTestSuite) TestTransformWithCollation() {
+	tests := []struct {
+		name   string
+		filter string
+		expect func(t *testing.T, extJson string, collation *options.Collation, err error)
+	}{
+		{
+			name:   "case insensitive eq uses collation",
+			filter: "userName eq \"imulab\"",
+			expect: func(t *testing.T, extJson string, collation *options.Collation, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, CaseInsensitiveCollation, collation)
+				assert.JSONEq(t, `{"userName":{"$eq":"imulab"}}`, extJson)
+			},
+		},
+		{
+			name:   "case insensitive ne uses collation",
+			filter: "(name.familyName ne \"Q\") and (active eq true)",
+			expect: func(t *testing.T, extJson string, collation *options.Collation, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, CaseInsensitiveCollation, collation)
+				assert.JSONEq(t, `{"$and":[{"name.familyName":{"$ne":"Q"}},{"active":{"$eq":true}}]}`, extJson)
+			},
+		},
+		{
+			name:   "caseExact comparison disables collation",
+			filter: "(userName eq \"imulab\") or (id eq \"foobar\")",
+			expect: func(t *testing.T, extJson string, collation *options.Collation, err error) {
+				assert.Nil(t, err)
+				assert.Nil(t, collation)
+				assert.JSONEq(t, `{"$or":[{"userName":{"$regularExpression":{"pattern":"^imulab$","options":"i"}}},{"id":{"$eq":"foobar"}}]}`, extJson)
+			},
+		},
+		{
+			name:   "no string comparison needs no collation",
+			filter: "(userName sw \"im\") and (active eq true)",
+			expect: func(t *testing.T, extJson string, collation *options.Collation, err error) {
+				assert.Nil(t, err)
+				assert.Nil(t, collation)
+				assert.JSONEq(t, `{"$and":[{"userName":{"$regularExpression":{"pattern":"^im","options":"i"}}},{"active":{"$eq":true}}]}`, extJson)
+			},
+		},
+	}
+
+	for _, test := range tests {
+		s.T().Run(test.name, func(t *testing.T) {
+			cf, err := expr.CompileFilter(test.filter)
+			require.Nil(t, err)
+			v, collation, err := TransformCompiledFilterWithCollation(cf, s.resourceType)
+			assert.Nil(t, err)
+			raw, err := bson.MarshalExtJSON(v, true, false)
+			assert.Nil(t, err)
+			test.expect(t, string(raw), collation, err)
+		})
+	}
+}
+
 func (s *TransformFilterTestSuite) SetupSuite() {
 	for _, each := range []struct {
 		filepath  string
@@ -169,6 +284,13 @@ func (s *TransformFilterTestSuite) SetupSuite() {
 				spec.Schemas().Register(parsed.(*spec.Schema))
 			},
 		},
+		{
+			filepath:  "../../public/schemas/user_enterprise_extension_schema.json",
+			structure: new(spec.Schema),
+			post: func(parsed interface{}) {
+				spec.Schemas().Register(parsed.(*spec.Schema))
+			},
+		},
 		{
 			filepath:  "../../public/resource_types/user_resource_type.json",
 			structure: new(spec.ResourceType),
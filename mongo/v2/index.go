@@ -16,6 +16,9 @@ const (
 	AnnotationMongoIndex = "@MongoIndex"
 )
 
+// Error code of MongoDB when a write violates a unique index.
+const duplicateKeyCode = 11000
+
 func (d *mongoDB) ensureIndex() {
 	d.superAttr.DFS(func(a *spec.Attribute) {
 		if a.Uniqueness() == spec.UniquenessNone {
@@ -34,7 +37,8 @@ func (d *mongoDB) ensureIndex() {
 			Keys:    bson.D{{Key: path, Value: 1}},
 			Options: options.Index(),
 		}
-		if a.Uniqueness() == spec.UniquenessServer || a.Uniqueness() == spec.UniquenessGlobal {
+		unique := a.Uniqueness() == spec.UniquenessServer || a.Uniqueness() == spec.UniquenessGlobal
+		if unique {
 			idm.Options.SetUnique(true)
 		}
 		if name := fmt.Sprintf("idx_%s", strings.Replace(path, ".", "_", -1)); len(name) < 127 {
@@ -43,6 +47,9 @@ func (d *mongoDB) ensureIndex() {
 			// constraint without checking for server version. If the formed name is greater than 127 bytes, we will
 			// just let MongoDB choose a random name.
 			idm.Options.SetName(name)
+			if unique {
+				d.uniqueIndexes[name] = a.Path()
+			}
 		}
 
 		_, err := d.coll.Indexes().CreateOne(context.Background(), idm, options.CreateIndexes())
@@ -56,3 +63,56 @@ func (d *mongoDB) ensureIndex() {
 		return
 	})
 }
+
+// Returns an error of spec.ErrUniqueness if err reports a violation of a unique index, naming the attribute of the
+// index if it was created by ensureIndex; otherwise, returns an error of spec.ErrInternal. Unique indexes prevent
+// duplicates from concurrent writes, which the uniqueness check of filter.ValidationFilter cannot.
+func (d *mongoDB) errWrite(err error) error {
+	var message string
+	switch e := err.(type) {
+	case mongo.WriteException:
+		for _, we := range e.WriteErrors {
+			if we.Code == duplicateKeyCode {
+				message = we.Message
+			}
+		}
+	case mongo.CommandError:
+		if e.Code == duplicateKeyCode {
+			message = e.Message
+		}
+	}
+	if len(message) == 0 {
+		return fmt.Errorf("%w: %v", spec.ErrInternal, err)
+	}
+
+	for name, path := range d.uniqueIndexes {
+		if strings.Contains(message, "index: "+name+" ") {
+			return fmt.Errorf("%w: value of '%s' is not unique", spec.ErrUniqueness, path)
+		}
+	}
+	return fmt.Errorf("%w: %s", spec.ErrUniqueness, message)
+}
+
+// Returns the errors of the n resources of an unordered InsertMany (see errWrite). The write errors are reported for
+// the resources at their index; other errors, i.e. of the write concern, are reported for every resource, as it is
+// unknown which were written.
+func (d *mongoDB) errWriteMany(n int, err error) []error {
+	errs := make([]error, n)
+	if err == nil {
+		return errs
+	}
+
+	e, ok := err.(mongo.BulkWriteException)
+	if !ok || e.WriteConcernError != nil {
+		for i := range errs {
+			errs[i] = d.errWrite(err)
+		}
+		return errs
+	}
+	for _, we := range e.WriteErrors {
+		if we.Index >= 0 && we.Index < n {
+			errs[we.Index] = d.errWrite(mongo.WriteException{WriteErrors: mongo.WriteErrors{we.WriteError}})
+		}
+	}
+	return errs
+}
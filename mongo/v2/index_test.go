@@ -0,0 +1,76 @@
+package v2
+
+import (
+	"errors"
+	"github.com/imulab/go-scim/pkg/v2/spec"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/mongo"
+	"testing"
+)
+
+func TestErrWrite(t *testing.T) {
+	d := &mongoDB{uniqueIndexes: map[string]string{"idx_userName": "userName"}}
+
+	tests := []struct {
+		name   string
+		err    error
+		expect func(t *testing.T, err error)
+	}{
+		{
+			name: "duplicate key on insert",
+			err: mongo.WriteException{WriteErrors: mongo.WriteErrors{{
+				Code:    11000,
+				Message: `E11000 duplicate key error collection: scim.User index: idx_userName dup key: { userName: "foo" }`,
+			}}},
+			expect: func(t *testing.T, err error) {
+				assert.True(t, errors.Is(err, spec.ErrUniqueness))
+				assert.Contains(t, err.Error(), "'userName'")
+			},
+		},
+		{
+			name: "duplicate key on replace",
+			err: mongo.CommandError{
+				Code:    11000,
+				Message: `E11000 duplicate key error collection: scim.User index: idx_userName dup key: { userName: "foo" }`,
+			},
+			expect: func(t *testing.T, err error) {
+				assert.True(t, errors.Is(err, spec.ErrUniqueness))
+				assert.Contains(t, err.Error(), "'userName'")
+			},
+		},
+		{
+			name: "other error",
+			err:  mongo.CommandError{Code: 2, Message: "bad value"},
+			expect: func(t *testing.T, err error) {
+				assert.True(t, errors.Is(err, spec.ErrInternal))
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			test.expect(t, d.errWrite(test.err))
+		})
+	}
+}
+
+func TestErrWriteMany(t *testing.T) {
+	d := &mongoDB{uniqueIndexes: map[string]string{"idx_userName": "userName"}}
+
+	errs := d.errWriteMany(3, mongo.BulkWriteException{WriteErrors: []mongo.BulkWriteError{{
+		WriteError: mongo.WriteError{
+			Index:   1,
+			Code:    11000,
+			Message: `E11000 duplicate key error collection: scim.User index: idx_userName dup key: { userName: "foo" }`,
+		},
+	}}})
+	assert.Nil(t, errs[0])
+	assert.True(t, errors.Is(errs[1], spec.ErrUniqueness))
+	assert.Nil(t, errs[2])
+
+	errs = d.errWriteMany(2, mongo.CommandError{Code: 2, Message: "bad value"})
+	assert.True(t, errors.Is(errs[0], spec.ErrInternal))
+	assert.True(t, errors.Is(errs[1], spec.ErrInternal))
+
+	assert.Equal(t, []error{nil, nil}, d.errWriteMany(2, nil))
+}
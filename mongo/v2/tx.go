@@ -0,0 +1,67 @@
+package v2
+
+import (
+	"context"
+	"fmt"
+	"github.com/imulab/go-scim/pkg/v2/spec"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Label of the errors of transactions aborted because of concurrent transactions, which may succeed when retried.
+const transientTransactionError = "TransientTransactionError"
+
+// Transaction calls fn with a context carrying a session of the client, in which a transaction is started with the
+// options, which may be nil for the defaults. The calls of the databases on the collections of the client with this
+// context (see DB) are part of the transaction, which is committed when fn returns nil, and aborted when it returns an
+// error or panics. When the context already carries a transaction of the client, fn joins it instead, and it is up to
+// the outermost call to commit or abort.
+//
+// MongoDB only supports transactions on replica sets and sharded clusters. Transactions aborted because of concurrent
+// transactions fail with an error of spec.ErrConflict, and may be retried. Unlike mongo.Session.WithTransaction, fn is
+// called only once.
+func Transaction(ctx context.Context, client *mongo.Client, opts *options.TransactionOptions, fn func(ctx context.Context) error) error {
+	if c, ok := ctx.Value(txKey{}).(*mongo.Client); ok && c == client {
+		return fn(ctx)
+	}
+
+	return client.UseSession(ctx, func(sc mongo.SessionContext) (err error) {
+		var txOpts []*options.TransactionOptions
+		if opts != nil {
+			txOpts = append(txOpts, opts)
+		}
+		if err = sc.StartTransaction(txOpts...); err != nil {
+			return errTransaction(err)
+		}
+
+		defer func() {
+			if r := recover(); r != nil {
+				_ = sc.AbortTransaction(context.Background())
+				panic(r)
+			}
+		}()
+
+		if err = fn(context.WithValue(sc, txKey{}, client)); err != nil {
+			_ = sc.AbortTransaction(context.Background())
+			return err
+		}
+		if err = sc.CommitTransaction(sc); err != nil {
+			return errTransaction(err)
+		}
+		return nil
+	})
+}
+
+type txKey struct{}
+
+// WithTx calls fn in a transaction of the client of the collection, and implements db.TxDB (see Transaction).
+func (d *mongoDB) WithTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	return Transaction(ctx, d.coll.Database().Client(), nil, fn)
+}
+
+func errTransaction(err error) error {
+	if e, ok := err.(mongo.CommandError); ok && e.HasErrorLabel(transientTransactionError) {
+		return fmt.Errorf("%w: %s", spec.ErrConflict, e.Error())
+	}
+	return fmt.Errorf("%w: %v", spec.ErrInternal, err)
+}
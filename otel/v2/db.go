@@ -0,0 +1,147 @@
+package v2
+
+import (
+	"context"
+	"fmt"
+	"github.com/imulab/go-scim/pkg/v2/crud"
+	"github.com/imulab/go-scim/pkg/v2/db"
+	"github.com/imulab/go-scim/pkg/v2/prop"
+	"github.com/imulab/go-scim/pkg/v2/spec"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Attribute of the database spans carrying the SCIM filter of count and query calls.
+const queryFilterKey = attribute.Key("scim.db.filter")
+
+// DB returns a db.DB that creates a span for every call to the database of the resource type, named after the
+// operation, i.e. scim.db.insert, scim.db.get and scim.db.query_cursor. The spans of count and query calls carry their
+// SCIM filter in the scim.db.filter attribute. The context of the span is passed on to the database, so that spans
+// created by the database, i.e. by the instrumentation of its driver, are children of it.
+//
+// The returned DB also implements db.CursorDB, returning an error of spec.ErrInvalidSyntax if the database does not,
+// db.BatchDB, db.ElementDB, db.BulkWriteDB, and db.TxDB, which calls db.WithTx on the database. Transactions have spans
+// of their own, named scim.db.transaction, whose children are the spans of the calls within. The spans of bulk writes
+// record the errors of the resources that failed. It implements db.ChangeStreamDB as well, by calling db.Subscribe on
+// the database; subscriptions have no spans, as they last until their context is done.
+func (t *Tracing) DB(resourceType *spec.ResourceType, database db.DB) db.CursorDB {
+	return &tracingDB{tracing: t, resourceType: resourceType.ID(), database: database}
+}
+
+type tracingDB struct {
+	tracing      *Tracing
+	resourceType string
+	database     db.DB
+}
+
+func (d *tracingDB) start(ctx context.Context, operation string, attributes ...attribute.KeyValue) (context.Context, trace.Span) {
+	attributes = append(attributes, resourceTypeKey.String(d.resourceType), operationKey.String(operation))
+	return d.tracing.start(ctx, "scim.db."+operation, attributes...)
+}
+
+func (d *tracingDB) Insert(ctx context.Context, resource *prop.Resource) (err error) {
+	ctx, span := d.start(ctx, "insert")
+	err = d.database.Insert(ctx, resource)
+	end(span, err)
+	return
+}
+
+func (d *tracingDB) Count(ctx context.Context, filter string) (n int, err error) {
+	ctx, span := d.start(ctx, "count", queryFilterKey.String(filter))
+	n, err = d.database.Count(ctx, filter)
+	end(span, err)
+	return
+}
+
+func (d *tracingDB) Get(ctx context.Context, id string, projection *crud.Projection) (resource *prop.Resource, err error) {
+	ctx, span := d.start(ctx, "get")
+	resource, err = d.database.Get(ctx, id, projection)
+	end(span, err)
+	return
+}
+
+func (d *tracingDB) GetMany(ctx context.Context, ids []string, projection *crud.Projection) (resources []*prop.Resource, err error) {
+	ctx, span := d.start(ctx, "get_many")
+	resources, err = db.GetMany(ctx, d.database, ids, projection)
+	end(span, err)
+	return
+}
+
+func (d *tracingDB) CountElements(ctx context.Context, id string, name string) (n int, err error) {
+	ctx, span := d.start(ctx, "count_elements")
+	n, err = db.CountElements(ctx, d.database, id, name)
+	end(span, err)
+	return
+}
+
+func (d *tracingDB) GetElements(ctx context.Context, id string, name string, pagination *crud.Pagination) (elements []interface{}, err error) {
+	ctx, span := d.start(ctx, "get_elements")
+	elements, err = db.GetElements(ctx, d.database, id, name, pagination)
+	end(span, err)
+	return
+}
+
+func (d *tracingDB) Replace(ctx context.Context, ref *prop.Resource, replacement *prop.Resource) (err error) {
+	ctx, span := d.start(ctx, "replace")
+	err = d.database.Replace(ctx, ref, replacement)
+	end(span, err)
+	return
+}
+
+func (d *tracingDB) Delete(ctx context.Context, resource *prop.Resource) (err error) {
+	ctx, span := d.start(ctx, "delete")
+	err = d.database.Delete(ctx, resource)
+	end(span, err)
+	return
+}
+
+func (d *tracingDB) InsertMany(ctx context.Context, resources []*prop.Resource) (errs []error) {
+	ctx, span := d.start(ctx, "insert_many")
+	errs = db.InsertMany(ctx, d.database, resources)
+	end(span, db.BulkError(errs))
+	return
+}
+
+func (d *tracingDB) ReplaceMany(ctx context.Context, replacements []db.Replacement) (errs []error) {
+	ctx, span := d.start(ctx, "replace_many")
+	errs = db.ReplaceMany(ctx, d.database, replacements)
+	end(span, db.BulkError(errs))
+	return
+}
+
+func (d *tracingDB) DeleteMany(ctx context.Context, resources []*prop.Resource) (errs []error) {
+	ctx, span := d.start(ctx, "delete_many")
+	errs = db.DeleteMany(ctx, d.database, resources)
+	end(span, db.BulkError(errs))
+	return
+}
+
+func (d *tracingDB) Query(ctx context.Context, filter string, sort *crud.Sort, pagination *crud.Pagination, projection *crud.Projection) (resources []*prop.Resource, err error) {
+	ctx, span := d.start(ctx, "query", queryFilterKey.String(filter))
+	resources, err = d.database.Query(ctx, filter, sort, pagination, projection)
+	end(span, err)
+	return
+}
+
+func (d *tracingDB) QueryCursor(ctx context.Context, filter string, sort *crud.Sort, pagination *crud.CursorPagination, projection *crud.Projection) (resources []*prop.Resource, next string, err error) {
+	cursorDB, ok := d.database.(db.CursorDB)
+	if !ok {
+		return nil, "", fmt.Errorf("%w: cursor pagination is not supported", spec.ErrInvalidSyntax)
+	}
+
+	ctx, span := d.start(ctx, "query_cursor", queryFilterKey.String(filter))
+	resources, next, err = cursorDB.QueryCursor(ctx, filter, sort, pagination, projection)
+	end(span, err)
+	return
+}
+
+func (d *tracingDB) WithTx(ctx context.Context, fn func(ctx context.Context) error) (err error) {
+	ctx, span := d.start(ctx, "transaction")
+	err = db.WithTx(ctx, d.database, fn)
+	end(span, err)
+	return
+}
+
+func (d *tracingDB) Subscribe(ctx context.Context, fn func(ctx context.Context, change *db.Change) error) error {
+	return db.Subscribe(ctx, d.database, fn)
+}
@@ -0,0 +1,4 @@
+// This package provides optional tracing of the request pipeline with OpenTelemetry, i.e. a span for each HTTP
+// request, service call, filter and database call, together with the deserialization, patching, in-memory filter
+// evaluation and serialization stages reported by the core module (see the trace package of the core module).
+package v2
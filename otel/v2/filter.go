@@ -0,0 +1,33 @@
+package v2
+
+import (
+	"context"
+	"github.com/imulab/go-scim/pkg/v2/prop"
+	"github.com/imulab/go-scim/pkg/v2/service/filter"
+)
+
+// Filter returns a filter.ByResource that creates a span named scim.filter for every call to the filter, which carries
+// the name, i.e. validation, in the scim.filter attribute.
+func (t *Tracing) Filter(name string, f filter.ByResource) filter.ByResource {
+	return &tracingFilter{tracing: t, name: name, filter: f}
+}
+
+type tracingFilter struct {
+	tracing *Tracing
+	name    string
+	filter  filter.ByResource
+}
+
+func (f *tracingFilter) Filter(ctx context.Context, resource *prop.Resource) (err error) {
+	ctx, span := f.tracing.start(ctx, "scim.filter", filterKey.String(f.name))
+	err = f.filter.Filter(ctx, resource)
+	end(span, err)
+	return
+}
+
+func (f *tracingFilter) FilterRef(ctx context.Context, resource *prop.Resource, ref *prop.Resource) (err error) {
+	ctx, span := f.tracing.start(ctx, "scim.filter", filterKey.String(f.name))
+	err = f.filter.FilterRef(ctx, resource, ref)
+	end(span, err)
+	return
+}
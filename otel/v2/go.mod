@@ -0,0 +1,13 @@
+module github.com/imulab/go-scim/otel/v2
+
+go 1.15
+
+require (
+	github.com/imulab/go-scim/pkg/v2 v2.0.0
+	github.com/stretchr/testify v1.7.0
+	go.opentelemetry.io/otel v1.0.0
+	go.opentelemetry.io/otel/sdk v1.0.0
+	go.opentelemetry.io/otel/trace v1.0.0
+)
+
+replace github.com/imulab/go-scim/pkg/v2 => ../../pkg/v2
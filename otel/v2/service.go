@@ -0,0 +1,34 @@
+package v2
+
+import (
+	"context"
+	"github.com/imulab/go-scim/pkg/v2/service"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Interceptor returns an Interceptor that creates a span for every call to the services it wraps (see
+// service.Interceptors), named after the operation, i.e. scim.service.create. The span carries the resource type and
+// operation in the scim.resource_type and scim.operation attributes, and is the parent of the spans created by the
+// service, i.e. by the filters and the database. It should be the first of the interceptors, so that the others are
+// accounted for.
+func (t *Tracing) Interceptor() service.Interceptor {
+	return &tracingInterceptor{tracing: t}
+}
+
+type tracingInterceptor struct {
+	tracing *Tracing
+}
+
+func (i *tracingInterceptor) Before(ctx context.Context, inv *service.Invocation) (context.Context, error) {
+	resourceType := ""
+	if inv.ResourceType != nil {
+		resourceType = inv.ResourceType.ID()
+	}
+	ctx, _ = i.tracing.start(ctx, "scim.service."+inv.Operation, resourceTypeKey.String(resourceType), operationKey.String(inv.Operation))
+	return ctx, nil
+}
+
+func (i *tracingInterceptor) After(ctx context.Context, _ *service.Invocation, err error) error {
+	end(trace.SpanFromContext(ctx), err)
+	return err
+}
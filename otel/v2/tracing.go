@@ -0,0 +1,92 @@
+package v2
+
+import (
+	"context"
+	"errors"
+	"github.com/imulab/go-scim/pkg/v2/spec"
+	scimtrace "github.com/imulab/go-scim/pkg/v2/trace"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Name of the instrumentation, as reported to the tracer provider.
+const instrumentationName = "github.com/imulab/go-scim/otel/v2"
+
+// Attributes of the spans.
+const (
+	resourceTypeKey = attribute.Key("scim.resource_type")
+	operationKey    = attribute.Key("scim.operation")
+	scimTypeKey     = attribute.Key("scim.type")
+	filterKey       = attribute.Key("scim.filter")
+)
+
+// Tracing creates the spans of the request pipeline. Every span is a child of the span carried by the context of the
+// call, so that the spans of a request form a single trace, starting at the span of the HTTP request (see Handler),
+// whose context is extracted from the incoming headers.
+//
+// Spans of failed calls have the error status and record the error, together with its scimType in the scim.type
+// attribute, or "internal" for errors other than spec.Error.
+type Tracing struct {
+	tracer     trace.Tracer
+	propagator propagation.TextMapPropagator
+}
+
+// New creates the tracing with the tracers of the provider, i.e. otel.GetTracerProvider(), and the propagator of the
+// incoming trace context, i.e. propagation.TraceContext{}.
+func New(provider trace.TracerProvider, propagator propagation.TextMapPropagator) *Tracing {
+	return &Tracing{
+		tracer:     provider.Tracer(instrumentationName),
+		propagator: propagator,
+	}
+}
+
+// Install starts reporting the stages of the request pipeline that cannot be decorated, i.e. the deserialization of
+// payloads and the evaluation of filters in memory, by all the services and databases of the process (see
+// scimtrace.SetTracer). The stages are reported as children of the spans of the decorated components.
+func (t *Tracing) Install() {
+	scimtrace.SetTracer(stageTracer{tracer: t.tracer})
+}
+
+// Starts a span as a child of the span carried by the context.
+func (t *Tracing) start(ctx context.Context, name string, attributes ...attribute.KeyValue) (context.Context, trace.Span) {
+	return t.tracer.Start(ctx, name, trace.WithAttributes(attributes...))
+}
+
+// Adapts the tracer to scimtrace.Tracer.
+type stageTracer struct {
+	tracer trace.Tracer
+}
+
+func (t stageTracer) Start(ctx context.Context, name string) (context.Context, scimtrace.Span) {
+	ctx, span := t.tracer.Start(ctx, name)
+	return ctx, stageSpan{span: span}
+}
+
+type stageSpan struct {
+	span trace.Span
+}
+
+func (s stageSpan) End(err error) {
+	end(s.span, err)
+}
+
+// Ends the span, which failed with the error, if not nil.
+func end(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		span.SetAttributes(scimTypeKey.String(scimType(err)))
+	}
+	span.End()
+}
+
+// Returns the scimType of the error.
+func scimType(err error) string {
+	var scimErr *spec.Error
+	if errors.As(err, &scimErr) {
+		return scimErr.Type
+	}
+	return spec.ErrInternal.Type
+}
@@ -0,0 +1,170 @@
+package v2
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/imulab/go-scim/pkg/v2/crud"
+	"github.com/imulab/go-scim/pkg/v2/db"
+	"github.com/imulab/go-scim/pkg/v2/handlerutil"
+	"github.com/imulab/go-scim/pkg/v2/prop"
+	"github.com/imulab/go-scim/pkg/v2/service"
+	"github.com/imulab/go-scim/pkg/v2/service/filter"
+	"github.com/imulab/go-scim/pkg/v2/spec"
+	scimtrace "github.com/imulab/go-scim/pkg/v2/trace"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestTracing(t *testing.T) {
+	s := new(TracingTestSuite)
+	suite.Run(t, s)
+}
+
+type TracingTestSuite struct {
+	suite.Suite
+	resourceType *spec.ResourceType
+}
+
+func (s *TracingTestSuite) TestPatch() {
+	var (
+		recorder = tracetest.NewSpanRecorder()
+		tracing  = New(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)), propagation.TraceContext{})
+		config   = new(spec.ServiceProviderConfig)
+	)
+	tracing.Install()
+	defer scimtrace.SetTracer(nil)
+
+	database := tracing.DB(s.resourceType, db.Memory())
+	resource := prop.NewResource(s.resourceType)
+	require.Nil(s.T(), resource.Navigator().Replace(map[string]interface{}{
+		"schemas":  []interface{}{"urn:ietf:params:scim:schemas:core:2.0:User"},
+		"id":       "foo",
+		"userName": "foo",
+		"emails":   []interface{}{map[string]interface{}{"value": "foo@example.com"}},
+	}).Error())
+	require.Nil(s.T(), database.Insert(context.Background(), resource))
+
+	config.Patch.Supported = true
+	patch := service.Interceptors(tracing.Interceptor()).Patch(s.resourceType, service.PatchService(config, database, nil, []filter.ByResource{
+		tracing.Filter("validation", filter.ByPropertyToByResource(filter.ValidationFilter(database))),
+		filter.MetaFilter(),
+	}))
+	handler := tracing.Handler("/Users/:id", http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		resp, err := patch.Do(r.Context(), &service.PatchRequest{ResourceID: "foo", PayloadSource: r.Body})
+		if err != nil {
+			_ = handlerutil.WriteError(rw, err)
+			return
+		}
+		_ = handlerutil.WriteResourceToResponseContext(r.Context(), rw, resp.Resource)
+	}))
+
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	req := httptest.NewRequest(http.MethodPatch, "/Users/foo", strings.NewReader(`{
+		"schemas": ["urn:ietf:params:scim:api:messages:2.0:PatchOp"],
+		"Operations": [{"op": "replace", "path": "userName", "value": "bar"}]
+	}`))
+	req.Header.Set("traceparent", fmt.Sprintf("00-%s-00f067aa0ba902b7-01", traceID))
+	rw := httptest.NewRecorder()
+	handler.ServeHTTP(rw, req)
+	assert.Equal(s.T(), http.StatusOK, rw.Code)
+
+	spans := map[string]sdktrace.ReadOnlySpan{}
+	for _, span := range recorder.Ended() {
+		spans[span.Name()] = span
+	}
+	for child, parent := range map[string]string{
+		"scim.service.patch":  "PATCH /Users/:id",
+		scimtrace.Deserialize: "scim.service.patch",
+		"scim.db.get":         "scim.service.patch",
+		scimtrace.Patch:       "scim.service.patch",
+		"scim.filter":         "scim.service.patch",
+		"scim.db.count":       "scim.filter",
+		scimtrace.Evaluate:    "scim.db.count",
+		"scim.db.replace":     "scim.service.patch",
+		scimtrace.Serialize:   "PATCH /Users/:id",
+	} {
+		if assert.Contains(s.T(), spans, child) && assert.Contains(s.T(), spans, parent) {
+			assert.Equal(s.T(), spans[parent].SpanContext().SpanID(), spans[child].Parent().SpanID(), child)
+			assert.Equal(s.T(), traceID, spans[child].SpanContext().TraceID().String(), child)
+		}
+	}
+}
+
+func (s *TracingTestSuite) TestError() {
+	var (
+		recorder = tracetest.NewSpanRecorder()
+		tracing  = New(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)), propagation.TraceContext{})
+	)
+
+	_, err := tracing.DB(s.resourceType, db.Memory()).Get(context.Background(), "missing", nil)
+	assert.NotNil(s.T(), err)
+
+	require.Len(s.T(), recorder.Ended(), 1)
+	span := recorder.Ended()[0]
+	assert.Equal(s.T(), "scim.db.get", span.Name())
+	assert.Equal(s.T(), codes.Error, span.Status().Code)
+	assert.Contains(s.T(), span.Attributes(), scimTypeKey.String(spec.ErrNotFound.Type))
+}
+
+func (s *TracingTestSuite) SetupSuite() {
+	for _, each := range []struct {
+		filepath  string
+		structure interface{}
+		post      func(parsed interface{})
+	}{
+		{
+			filepath:  "../../public/schemas/core_schema.json",
+			structure: new(spec.Schema),
+			post: func(parsed interface{}) {
+				spec.Schemas().Register(parsed.(*spec.Schema))
+			},
+		},
+		{
+			filepath:  "../../public/schemas/user_schema.json",
+			structure: new(spec.Schema),
+			post: func(parsed interface{}) {
+				spec.Schemas().Register(parsed.(*spec.Schema))
+			},
+		},
+		{
+			filepath:  "../../public/schemas/user_enterprise_extension_schema.json",
+			structure: new(spec.Schema),
+			post: func(parsed interface{}) {
+				spec.Schemas().Register(parsed.(*spec.Schema))
+			},
+		},
+		{
+			filepath:  "../../public/resource_types/user_resource_type.json",
+			structure: new(spec.ResourceType),
+			post: func(parsed interface{}) {
+				s.resourceType = parsed.(*spec.ResourceType)
+				crud.Register(s.resourceType)
+			},
+		},
+	} {
+		f, err := os.Open(each.filepath)
+		require.Nil(s.T(), err)
+
+		raw, err := ioutil.ReadAll(f)
+		require.Nil(s.T(), err)
+
+		err = json.Unmarshal(raw, each.structure)
+		require.Nil(s.T(), err)
+
+		if each.post != nil {
+			each.post(each.structure)
+		}
+	}
+}
@@ -40,6 +40,10 @@ const (
 	// a integer parameter named "cost". This will determine the strength of the bCrypt hashing. If omitted, default
 	// cost is 10. The value replacement does not trigger event propagation, it is strictly local.
 	BCrypt = "@BCrypt"
+	// @Password annotates a string property holding a password. The value of the property will be checked against the
+	// password policy and hashed by the password hasher of the PasswordFilter, replacing the original value. Like
+	// @BCrypt, the value replacement does not trigger event propagation.
+	Password = "@Password"
 	// @ReadOnly annotates a readOnly property and indicates how filters should handle its value. Two options are
 	// available. The first a boolean named "reset": if true, filters shall delete the property value; The second
 	// is a boolean named "copy": if true, filters shall copy value from the reference property, if available.
@@ -48,4 +52,9 @@ const (
 	// canonicalValues. The defined values will be treated as strings and compared with respect to the caseExact
 	// setting.
 	Enum = "@Enum"
+	// @ExpiresAt annotates a singular dateTime attribute holding the time at which the resource expires, i.e. of
+	// invitations or pending users. Expired resources are hidden and purged by the database returned by db.Expiring.
+	// The annotation takes an optional parameter named "ttl", a duration like "72h", after which the resources expire
+	// when created without a value (see filter.ExpiryFilter).
+	ExpiresAt = "@ExpiresAt"
 )
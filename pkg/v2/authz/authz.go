@@ -0,0 +1,247 @@
+// This package restricts the attributes that callers may read and write, according to their scopes. The transport
+// resolves the Access of the caller with a Policy, and places it in the request context (see With). The Access is then
+// consulted when resources are serialized, to leave out the attributes the caller may not read (see ReadOption), by
+// QueryGuard, as resources are queried, to reject filters and sorting by attributes it may not read, and by
+// WriteFilter, as resources are created, replaced and patched, to reject or revert the modification of the attributes
+// it may not write. Requests without Access in their context are not restricted.
+package authz
+
+import (
+	"context"
+	"fmt"
+	"github.com/imulab/go-scim/pkg/v2/crud/expr"
+	scimjson "github.com/imulab/go-scim/pkg/v2/json"
+	"github.com/imulab/go-scim/pkg/v2/spec"
+	"strings"
+)
+
+// All is the path granting all attributes of the resource type in a Rule.
+const All = "*"
+
+// Rule grants the callers of a scope the access to attributes of a resource type. Attributes are named by their path,
+// i.e. "name.givenName" or "urn:ietf:params:scim:schemas:extension:enterprise:2.0:User:department", or All. Granting an
+// attribute grants all its sub attributes.
+type Rule struct {
+	Scope        string   `json:"scope"`        // scope of the callers the rule applies to, or empty for all callers
+	ResourceType string   `json:"resourceType"` // id of the resource type, i.e. "User"
+	Read         []string `json:"read"`         // paths of the attributes that may be read
+	Write        []string `json:"write"`        // paths of the attributes that may be written
+}
+
+// NewPolicy returns a Policy of the rules. An error of spec.ErrInvalidPath is returned if a rule names an attribute
+// that the resource type does not have, and one of spec.ErrNotFound if the resource type is none of resourceTypes.
+func NewPolicy(resourceTypes []*spec.ResourceType, rules ...*Rule) (*Policy, error) {
+	byID := map[string]*spec.ResourceType{}
+	for _, resourceType := range resourceTypes {
+		byID[resourceType.ID()] = resourceType
+	}
+
+	p := &Policy{}
+	for _, rule := range rules {
+		resourceType, ok := byID[rule.ResourceType]
+		if !ok {
+			return nil, fmt.Errorf("%w: resource type '%s' of rule is unknown", spec.ErrNotFound, rule.ResourceType)
+		}
+		read, err := resolve(resourceType, rule.Read)
+		if err != nil {
+			return nil, err
+		}
+		write, err := resolve(resourceType, rule.Write)
+		if err != nil {
+			return nil, err
+		}
+		p.rules = append(p.rules, &compiledRule{scope: rule.Scope, resourceType: rule.ResourceType, read: read, write: write})
+	}
+	return p, nil
+}
+
+// Policy computes the Access of callers from their scopes.
+type Policy struct {
+	rules []*compiledRule
+}
+
+type compiledRule struct {
+	scope        string
+	resourceType string
+	read         *grant
+	write        *grant
+}
+
+// Access returns the access granted by the rules of the scopes, and by rules without scope.
+func (p *Policy) Access(scopes ...string) *Access {
+	a := &Access{read: map[string]*grant{}, write: map[string]*grant{}}
+	for _, rule := range p.rules {
+		if len(rule.scope) > 0 && !contains(scopes, rule.scope) {
+			continue
+		}
+		a.read[rule.resourceType] = a.read[rule.resourceType].merge(rule.read)
+		a.write[rule.resourceType] = a.write[rule.resourceType].merge(rule.write)
+	}
+	return a
+}
+
+// Access is the access of a caller to the attributes of the resource types. Attributes of resource types the caller
+// was granted nothing of may neither be read nor be written.
+type Access struct {
+	read  map[string]*grant
+	write map[string]*grant
+}
+
+// Readable returns true if the caller may read the attribute of the resource type, or some of its sub attributes.
+// The common attributes id, externalId and meta, are always readable, so that resources can be identified and
+// versioned by every caller. A nil Access reads every attribute.
+func (a *Access) Readable(resourceType *spec.ResourceType, attr *spec.Attribute) bool {
+	if a == nil || isCommon(attr) {
+		return true
+	}
+	if g := a.read[resourceType.ID()]; g != nil {
+		return g.covers(attr) || g.coversSome(attr)
+	}
+	return false
+}
+
+// Writable returns true if the caller may write the attribute of the resource type. Complex attributes that are not
+// multiValued are also writable if some of their sub attributes are, which are then to be checked one by one, whereas
+// multiValued attributes must be granted as a whole, so that elements can be added and removed. The schemas attribute
+// is always writable, so that resources can be created. A nil Access writes every attribute.
+func (a *Access) Writable(resourceType *spec.ResourceType, attr *spec.Attribute) bool {
+	if a == nil || id(attr) == "schemas" {
+		return true
+	}
+	if g := a.write[resourceType.ID()]; g != nil {
+		return g.covers(attr) || (!attr.MultiValued() && g.coversSome(attr))
+	}
+	return false
+}
+
+// Queryable returns true if the caller may filter or sort the resources of the resource type by the attribute, which
+// would otherwise tell its values from which resources match, or how they are ordered. Unlike Readable, the attribute
+// must be readable as a whole, and attributes that are never returned, i.e. password, are never queryable. The common
+// attributes are always queryable. A nil Access queries every attribute.
+func (a *Access) Queryable(resourceType *spec.ResourceType, attr *spec.Attribute) bool {
+	if a == nil || isCommon(attr) {
+		return true
+	}
+	if attr.Returned() == spec.ReturnedNever {
+		return false
+	}
+	if g := a.read[resourceType.ID()]; g != nil {
+		return g.covers(attr)
+	}
+	return false
+}
+
+// ReadOption returns the serialization option to leave out the attributes of the resource type the caller may not
+// read (see Readable).
+func (a *Access) ReadOption(resourceType *spec.ResourceType) scimjson.Options {
+	return scimjson.Readable(func(attr *spec.Attribute) bool {
+		return a.Readable(resourceType, attr)
+	})
+}
+
+type accessKey struct{}
+
+// With returns a copy of the context carrying the access of the caller.
+func With(ctx context.Context, access *Access) context.Context {
+	return context.WithValue(ctx, accessKey{}, access)
+}
+
+// From returns the access of the caller carried by the context, or nil if there is none, in which case the caller is
+// not restricted.
+func From(ctx context.Context) *Access {
+	access, _ := ctx.Value(accessKey{}).(*Access)
+	return access
+}
+
+// Set of attributes, identified by their ids.
+type grant struct {
+	all bool
+	ids []string
+}
+
+func (g *grant) merge(other *grant) *grant {
+	if g == nil {
+		return &grant{all: other.all, ids: append([]string{}, other.ids...)}
+	}
+	return &grant{all: g.all || other.all, ids: append(append([]string{}, g.ids...), other.ids...)}
+}
+
+// Returns true if the attribute, or one of its parents, was granted.
+func (g *grant) covers(attr *spec.Attribute) bool {
+	if g.all {
+		return true
+	}
+	id := id(attr)
+	for _, each := range g.ids {
+		if id == each || strings.HasPrefix(id, each+".") || strings.HasPrefix(id, each+":") {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns true if some of the sub attributes of the attribute were granted.
+func (g *grant) coversSome(attr *spec.Attribute) bool {
+	id := id(attr)
+	for _, each := range g.ids {
+		if strings.HasPrefix(each, id+".") || strings.HasPrefix(each, id+":") {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the lower cased id of the attribute, that of the multiValued attribute for its element attributes.
+func id(attr *spec.Attribute) string {
+	return strings.ToLower(strings.TrimSuffix(attr.ID(), "$elem"))
+}
+
+func isCommon(attr *spec.Attribute) bool {
+	switch id := id(attr); {
+	case id == "id", id == "externalid", id == "meta", strings.HasPrefix(id, "meta."):
+		return true
+	default:
+		return false
+	}
+}
+
+func resolve(resourceType *spec.ResourceType, paths []string) (*grant, error) {
+	g := &grant{}
+	root := resourceType.SuperAttribute(true)
+	for _, path := range paths {
+		if path == All {
+			g.all = true
+			continue
+		}
+
+		head, err := expr.CompilePath(path)
+		if err != nil {
+			return nil, err
+		}
+		if head.IsPath() && strings.ToLower(head.Token()) == strings.ToLower(resourceType.Schema().ID()) {
+			head = head.Next()
+		}
+
+		attr := root
+		for cursor := head; cursor != nil && attr != nil; cursor = cursor.Next() {
+			if cursor.IsRootOfFilter() {
+				return nil, fmt.Errorf("%w: path '%s' of rule shall not have a filter", spec.ErrInvalidPath, path)
+			}
+			attr = attr.SubAttributeForName(cursor.Token())
+		}
+		if attr == nil || attr == root {
+			return nil, fmt.Errorf("%w: path '%s' of rule is invalid", spec.ErrInvalidPath, path)
+		}
+		g.ids = append(g.ids, id(attr))
+	}
+	return g, nil
+}
+
+func contains(values []string, value string) bool {
+	for _, each := range values {
+		if each == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,273 @@
+package authz
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/imulab/go-scim/pkg/v2/crud"
+	scimjson "github.com/imulab/go-scim/pkg/v2/json"
+	"github.com/imulab/go-scim/pkg/v2/prop"
+	"github.com/imulab/go-scim/pkg/v2/service/filter"
+	"github.com/imulab/go-scim/pkg/v2/spec"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestAuthz(t *testing.T) {
+	s := new(AuthzTestSuite)
+	suite.Run(t, s)
+}
+
+type AuthzTestSuite struct {
+	suite.Suite
+	resourceType *spec.ResourceType
+	policy       *Policy
+}
+
+func (s *AuthzTestSuite) TestNewPolicy() {
+	_, err := NewPolicy([]*spec.ResourceType{s.resourceType}, &Rule{ResourceType: "User", Read: []string{"foo.bar"}})
+	assert.True(s.T(), errors.Is(err, spec.ErrInvalidPath))
+
+	_, err = NewPolicy([]*spec.ResourceType{s.resourceType}, &Rule{ResourceType: "User", Write: []string{`emails[type eq "work"]`}})
+	assert.True(s.T(), errors.Is(err, spec.ErrInvalidPath))
+
+	_, err = NewPolicy([]*spec.ResourceType{s.resourceType}, &Rule{ResourceType: "Device", Read: []string{All}})
+	assert.True(s.T(), errors.Is(err, spec.ErrNotFound))
+}
+
+func (s *AuthzTestSuite) TestRead() {
+	tests := []struct {
+		name   string
+		access *Access
+		expect string
+	}{
+		{
+			name:   "granted attributes and sub attributes",
+			access: s.policy.Access("hr"),
+			expect: `{
+				"schemas": ["urn:ietf:params:scim:schemas:core:2.0:User", "urn:ietf:params:scim:schemas:extension:enterprise:2.0:User"],
+				"id": "foo",
+				"meta": {"resourceType": "User", "version": "W/\"1\""},
+				"userName": "foo",
+				"name": {"givenName": "Foo"},
+				"emails": [{"value": "foo@example.com"}],
+				"urn:ietf:params:scim:schemas:extension:enterprise:2.0:User": {"department": "R&D"}
+			}`,
+		},
+		{
+			name:   "merged rules of all scopes",
+			access: s.policy.Access("hr", "admin"),
+			expect: `{
+				"schemas": ["urn:ietf:params:scim:schemas:core:2.0:User", "urn:ietf:params:scim:schemas:extension:enterprise:2.0:User"],
+				"id": "foo",
+				"meta": {"resourceType": "User", "version": "W/\"1\""},
+				"userName": "foo",
+				"name": {"givenName": "Foo", "familyName": "Bar"},
+				"emails": [{"value": "foo@example.com", "type": "work"}],
+				"urn:ietf:params:scim:schemas:extension:enterprise:2.0:User": {"department": "R&D", "employeeNumber": "42"}
+			}`,
+		},
+		{
+			name:   "nothing granted",
+			access: s.policy.Access("other"),
+			expect: `{
+				"schemas": ["urn:ietf:params:scim:schemas:core:2.0:User", "urn:ietf:params:scim:schemas:extension:enterprise:2.0:User"],
+				"id": "foo",
+				"meta": {"resourceType": "User", "version": "W/\"1\""}
+			}`,
+		},
+	}
+
+	for _, test := range tests {
+		s.T().Run(test.name, func(t *testing.T) {
+			raw, err := scimjson.Serialize(s.user(), test.access.ReadOption(s.resourceType))
+			require.Nil(t, err)
+			assert.JSONEq(t, test.expect, string(raw))
+		})
+	}
+}
+
+func (s *AuthzTestSuite) TestWrite() {
+	tests := []struct {
+		name   string
+		access *Access
+		strip  bool
+		modify map[string]interface{}
+		create bool
+		expect func(t *testing.T, resource *prop.Resource, err error)
+	}{
+		{
+			name:   "granted attribute is modified",
+			access: s.policy.Access("hr"),
+			modify: map[string]interface{}{
+				"urn:ietf:params:scim:schemas:extension:enterprise:2.0:User": map[string]interface{}{"department": "Sales"},
+			},
+			expect: func(t *testing.T, resource *prop.Resource, err error) {
+				assert.Nil(t, err)
+			},
+		},
+		{
+			name:   "modification of attribute not granted is rejected",
+			access: s.policy.Access("hr"),
+			modify: map[string]interface{}{"password": "s3cret"},
+			expect: func(t *testing.T, resource *prop.Resource, err error) {
+				assert.True(t, errors.Is(err, spec.ErrForbidden))
+			},
+		},
+		{
+			name:   "modification of attribute not granted is reverted",
+			access: s.policy.Access("hr"),
+			strip:  true,
+			modify: map[string]interface{}{
+				"userName": "bar",
+				"urn:ietf:params:scim:schemas:extension:enterprise:2.0:User": map[string]interface{}{"department": "Sales"},
+			},
+			expect: func(t *testing.T, resource *prop.Resource, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, "foo", resource.Navigator().Dot("userName").Current().Raw())
+				assert.Equal(t, "Sales", resource.Navigator().Dot("urn:ietf:params:scim:schemas:extension:enterprise:2.0:User").Dot("department").Current().Raw())
+			},
+		},
+		{
+			name:   "multiValued attribute is only writable as a whole",
+			access: s.policy.Access("hr"),
+			modify: map[string]interface{}{
+				"emails": []interface{}{map[string]interface{}{"value": "bar@example.com", "type": "work"}},
+			},
+			expect: func(t *testing.T, resource *prop.Resource, err error) {
+				assert.True(t, errors.Is(err, spec.ErrForbidden))
+			},
+		},
+		{
+			name:   "attribute not granted is stripped on creation",
+			access: s.policy.Access("hr"),
+			strip:  true,
+			create: true,
+			expect: func(t *testing.T, resource *prop.Resource, err error) {
+				assert.Nil(t, err)
+				assert.True(t, resource.Navigator().Dot("userName").Current().IsUnassigned())
+				assert.True(t, resource.Navigator().Dot("name").Current().IsUnassigned())
+				assert.Equal(t, "R&D", resource.Navigator().Dot("urn:ietf:params:scim:schemas:extension:enterprise:2.0:User").Dot("department").Current().Raw())
+			},
+		},
+		{
+			name:   "caller without access is not restricted",
+			access: nil,
+			create: true,
+			expect: func(t *testing.T, resource *prop.Resource, err error) {
+				assert.Nil(t, err)
+			},
+		},
+	}
+
+	for _, test := range tests {
+		s.T().Run(test.name, func(t *testing.T) {
+			ctx := context.Background()
+			if test.access != nil {
+				ctx = With(ctx, test.access)
+			}
+			f := filter.ByPropertyToByResource(WriteFilter(test.strip))
+
+			var (
+				resource = s.user()
+				err      error
+			)
+			if test.create {
+				err = f.Filter(ctx, resource)
+			} else {
+				ref := resource.Clone()
+				require.False(t, resource.Navigator().Replace(test.modify).HasError())
+				err = f.FilterRef(ctx, resource, ref)
+			}
+			test.expect(t, resource, err)
+		})
+	}
+}
+
+func (s *AuthzTestSuite) user() *prop.Resource {
+	r := prop.NewResource(s.resourceType)
+	require.False(s.T(), r.Navigator().Replace(map[string]interface{}{
+		"schemas":  []interface{}{"urn:ietf:params:scim:schemas:core:2.0:User", "urn:ietf:params:scim:schemas:extension:enterprise:2.0:User"},
+		"id":       "foo",
+		"meta":     map[string]interface{}{"resourceType": "User", "version": "W/\"1\""},
+		"userName": "foo",
+		"name":     map[string]interface{}{"givenName": "Foo", "familyName": "Bar"},
+		"emails":   []interface{}{map[string]interface{}{"value": "foo@example.com", "type": "work"}},
+		"urn:ietf:params:scim:schemas:extension:enterprise:2.0:User": map[string]interface{}{
+			"department":     "R&D",
+			"employeeNumber": "42",
+		},
+	}).HasError())
+	return r
+}
+
+func (s *AuthzTestSuite) SetupSuite() {
+	for _, each := range []struct {
+		filepath  string
+		structure interface{}
+		post      func(parsed interface{})
+	}{
+		{
+			filepath:  "../../../public/schemas/core_schema.json",
+			structure: new(spec.Schema),
+			post: func(parsed interface{}) {
+				spec.Schemas().Register(parsed.(*spec.Schema))
+			},
+		},
+		{
+			filepath:  "../../../public/schemas/user_schema.json",
+			structure: new(spec.Schema),
+			post: func(parsed interface{}) {
+				spec.Schemas().Register(parsed.(*spec.Schema))
+			},
+		},
+		{
+			filepath:  "../../../public/schemas/user_enterprise_extension_schema.json",
+			structure: new(spec.Schema),
+			post: func(parsed interface{}) {
+				spec.Schemas().Register(parsed.(*spec.Schema))
+			},
+		},
+		{
+			filepath:  "../../../public/resource_types/user_resource_type.json",
+			structure: new(spec.ResourceType),
+			post: func(parsed interface{}) {
+				s.resourceType = parsed.(*spec.ResourceType)
+				crud.Register(s.resourceType)
+			},
+		},
+	} {
+		f, err := os.Open(each.filepath)
+		require.Nil(s.T(), err)
+
+		raw, err := ioutil.ReadAll(f)
+		require.Nil(s.T(), err)
+
+		err = json.Unmarshal(raw, each.structure)
+		require.Nil(s.T(), err)
+
+		if each.post != nil {
+			each.post(each.structure)
+		}
+	}
+
+	var err error
+	s.policy, err = NewPolicy([]*spec.ResourceType{s.resourceType},
+		&Rule{
+			Scope:        "hr",
+			ResourceType: "User",
+			Read:         []string{"userName", "name.givenName", "emails.value", "urn:ietf:params:scim:schemas:extension:enterprise:2.0:User:department"},
+			Write:        []string{"urn:ietf:params:scim:schemas:extension:enterprise:2.0:User:department", "emails.value"},
+		},
+		&Rule{
+			Scope:        "admin",
+			ResourceType: "User",
+			Read:         []string{All},
+		},
+	)
+	require.Nil(s.T(), err)
+}
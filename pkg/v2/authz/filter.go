@@ -0,0 +1,80 @@
+package authz
+
+import (
+	"context"
+	"fmt"
+	"github.com/imulab/go-scim/pkg/v2/prop"
+	"github.com/imulab/go-scim/pkg/v2/service/filter"
+	"github.com/imulab/go-scim/pkg/v2/spec"
+)
+
+// WriteFilter returns a ByProperty filter that checks the properties assigned on creation, or modified on replace and
+// patch, against the Access of the caller carried by the context (see Access.Writable). The modification of a property
+// the caller may not write is rejected with an error of spec.ErrForbidden, or, if strip is true, it is reverted, so
+// that the rest of the request still applies: the property is deleted on creation, and is restored to the value of the
+// reference otherwise. Properties of readOnly attributes are left to ReadOnlyFilter.
+//
+// The filter shall run before the filters that modify properties on behalf of the server, i.e. before PasswordFilter,
+// which hashes the password.
+func WriteFilter(strip bool) filter.ByProperty {
+	return writeFilter{strip: strip}
+}
+
+type writeFilter struct {
+	strip bool
+}
+
+func (f writeFilter) Supports(attribute *spec.Attribute) bool {
+	return attribute.Mutability() != spec.MutabilityReadOnly
+}
+
+func (f writeFilter) Filter(ctx context.Context, resourceType *spec.ResourceType, nav prop.Navigator) error {
+	if nav.HasError() {
+		return nav.Error()
+	}
+
+	if nav.Current().IsUnassigned() || From(ctx).Writable(resourceType, nav.Current().Attribute()) {
+		return nil
+	}
+
+	if f.strip {
+		return nav.Delete().Error()
+	}
+	return f.forbidden(nav.Current())
+}
+
+func (f writeFilter) FilterRef(ctx context.Context, resourceType *spec.ResourceType, nav prop.Navigator, refNav prop.Navigator) error {
+	if nav.HasError() {
+		return nav.Error()
+	}
+
+	if From(ctx).Writable(resourceType, nav.Current().Attribute()) {
+		return nil
+	}
+
+	var ref prop.Property
+	if refNav != nil && !filter.IsOutOfSync(refNav.Current()) {
+		ref = refNav.Current()
+	}
+	if ref == nil || ref.IsUnassigned() {
+		if nav.Current().IsUnassigned() {
+			return nil
+		}
+		if f.strip {
+			return nav.Delete().Error()
+		}
+		return f.forbidden(nav.Current())
+	}
+
+	if nav.Current().Hash() == ref.Hash() {
+		return nil
+	}
+	if f.strip {
+		return nav.Replace(ref.Raw()).Error()
+	}
+	return f.forbidden(nav.Current())
+}
+
+func (f writeFilter) forbidden(property prop.Property) error {
+	return fmt.Errorf("%w: '%s' may not be written", spec.ErrForbidden, property.Attribute().Path())
+}
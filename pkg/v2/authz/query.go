@@ -0,0 +1,114 @@
+package authz
+
+import (
+	"context"
+	"fmt"
+	"github.com/imulab/go-scim/pkg/v2/crud/expr"
+	"github.com/imulab/go-scim/pkg/v2/service"
+	"github.com/imulab/go-scim/pkg/v2/spec"
+	"strings"
+)
+
+// QueryGuard returns a service.QueryGuard that checks the attributes the filter and sortBy of the query requests of the
+// resource type compare against the Access of the caller carried by the context (see Access.Queryable). Requests
+// filtering or sorting by an attribute the caller may not read are rejected with an error of spec.ErrForbidden, before
+// the database is queried. Attributes the resource type does not define are left to the database, as root queries pass
+// them on to every resource type.
+//
+// The guard applies to the search service and root queries too, as they are carried out by the query services of the
+// resource types (see service.QueryServiceWithGuard and service.QueryGuards).
+func QueryGuard(resourceType *spec.ResourceType) service.QueryGuard {
+	return &queryGuard{resourceType: resourceType, root: resourceType.SuperAttribute(true)}
+}
+
+type queryGuard struct {
+	resourceType *spec.ResourceType
+	root         *spec.Attribute
+}
+
+func (g *queryGuard) Check(ctx context.Context, req *service.QueryRequest) error {
+	access := From(ctx)
+	if access == nil {
+		return nil
+	}
+
+	if len(req.Filter) > 0 {
+		filter, err := expr.CompileFilter(req.Filter)
+		if err != nil {
+			return err
+		}
+		if attr := g.deniedInFilter(access, g.root, filter); attr != nil {
+			return fmt.Errorf("%w: resources may not be filtered by '%s'", spec.ErrForbidden, attr.Path())
+		}
+	}
+
+	if req.Sort != nil {
+		keys, err := req.Sort.Keys()
+		if err != nil {
+			return err
+		}
+		for _, key := range keys {
+			path, err := expr.CompilePath(key.By)
+			if err != nil {
+				return err
+			}
+			if attr := g.deniedInPath(access, g.root, path); attr != nil {
+				return fmt.Errorf("%w: resources may not be sorted by '%s'", spec.ErrForbidden, attr.Path())
+			}
+		}
+	}
+
+	return nil
+}
+
+// Returns the first attribute compared by the filter, relative to the base attribute, which the caller may not query,
+// or nil if there is none.
+func (g *queryGuard) deniedInFilter(access *Access, base *spec.Attribute, filter *expr.Expression) *spec.Attribute {
+	if filter == nil {
+		return nil
+	}
+	switch filter.Kind() {
+	case expr.KindLogicalOperator:
+		if attr := g.deniedInFilter(access, base, filter.Left()); attr != nil {
+			return attr
+		}
+		return g.deniedInFilter(access, base, filter.Right())
+	case expr.KindRelationalOperator:
+		return g.deniedInPath(access, base, filter.Left())
+	default:
+		return nil
+	}
+}
+
+// Returns the attribute of the path, or the first one of its nested filters, relative to the base attribute, which the
+// caller may not query, or nil if there is none.
+func (g *queryGuard) deniedInPath(access *Access, base *spec.Attribute, path *expr.Expression) *spec.Attribute {
+	if base == g.root && path != nil && path.IsPath() && strings.ToLower(path.Token()) == strings.ToLower(g.resourceType.Schema().ID()) {
+		path = path.Next()
+	}
+
+	attr := base
+	for cursor := path; cursor != nil; cursor = cursor.Next() {
+		if cursor.IsRootOfFilter() {
+			if denied := g.deniedInFilter(access, attr, cursor); denied != nil {
+				return denied
+			}
+			continue
+		}
+		if attr.MultiValued() {
+			attr = attr.DeriveElementAttribute()
+		}
+		if attr = attr.SubAttributeForName(cursor.Token()); attr == nil {
+			return nil
+		}
+	}
+
+	if attr == base || access.Queryable(g.resourceType, attr) {
+		return nil
+	}
+	return attr
+}
+
+var (
+	_ service.QueryGuard = (*queryGuard)(nil)
+)
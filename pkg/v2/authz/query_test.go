@@ -0,0 +1,143 @@
+package authz
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/imulab/go-scim/pkg/v2/crud"
+	"github.com/imulab/go-scim/pkg/v2/db"
+	"github.com/imulab/go-scim/pkg/v2/service"
+	"github.com/imulab/go-scim/pkg/v2/spec"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func (s *AuthzTestSuite) TestQueryGuard() {
+	database := db.Memory()
+	require.Nil(s.T(), database.Insert(context.TODO(), s.user()))
+
+	config := new(spec.ServiceProviderConfig)
+	require.Nil(s.T(), json.Unmarshal([]byte(`{"filter": {"supported": true}, "sort": {"supported": true}}`), config))
+	query := service.QueryServiceWithGuard(config, database, QueryGuard(s.resourceType))
+	root := service.RootQueryService(config, query)
+
+	tests := []struct {
+		name    string
+		access  *Access
+		query   service.Query
+		request *service.QueryRequest
+		expect  func(t *testing.T, resp *service.QueryResponse, err error)
+	}{
+		{
+			name:    "filter by readable attributes",
+			access:  s.policy.Access("hr"),
+			request: &service.QueryRequest{Filter: `userName eq "foo" and emails.value co "example" and meta.version pr`},
+			expect: func(t *testing.T, resp *service.QueryResponse, err error) {
+				require.Nil(t, err)
+				assert.Equal(t, 1, resp.TotalResults)
+			},
+		},
+		{
+			name:    "filter by attribute of extension",
+			access:  s.policy.Access("hr"),
+			request: &service.QueryRequest{Filter: `urn:ietf:params:scim:schemas:extension:enterprise:2.0:User:employeeNumber sw "4"`},
+			expect: func(t *testing.T, resp *service.QueryResponse, err error) {
+				assert.True(t, errors.Is(err, spec.ErrForbidden))
+				assert.Contains(t, err.Error(), "employeeNumber")
+			},
+		},
+		{
+			name:    "filter by sub attribute",
+			access:  s.policy.Access("hr"),
+			request: &service.QueryRequest{Filter: `userName eq "foo" or not (name.familyName eq "Bar")`},
+			expect: func(t *testing.T, resp *service.QueryResponse, err error) {
+				assert.True(t, errors.Is(err, spec.ErrForbidden))
+				assert.Contains(t, err.Error(), "name.familyName")
+			},
+		},
+		{
+			name:    "filter by complex attribute partially readable",
+			access:  s.policy.Access("hr"),
+			request: &service.QueryRequest{Filter: `name pr`},
+			expect: func(t *testing.T, resp *service.QueryResponse, err error) {
+				assert.True(t, errors.Is(err, spec.ErrForbidden))
+			},
+		},
+		{
+			name:    "filter by sub attribute of multiValued attribute",
+			access:  s.policy.Access("hr"),
+			request: &service.QueryRequest{Filter: `emails.type eq "work"`},
+			expect: func(t *testing.T, resp *service.QueryResponse, err error) {
+				assert.True(t, errors.Is(err, spec.ErrForbidden))
+				assert.Contains(t, err.Error(), "emails.type")
+			},
+		},
+		{
+			name:    "filter by attribute never returned",
+			access:  s.policy.Access("admin"),
+			request: &service.QueryRequest{Filter: `password sw "s"`},
+			expect: func(t *testing.T, resp *service.QueryResponse, err error) {
+				assert.True(t, errors.Is(err, spec.ErrForbidden))
+			},
+		},
+		{
+			name:    "sort by attribute",
+			access:  s.policy.Access("hr"),
+			request: &service.QueryRequest{Sort: &crud.Sort{By: "userName,urn:ietf:params:scim:schemas:extension:enterprise:2.0:User:employeeNumber"}},
+			expect: func(t *testing.T, resp *service.QueryResponse, err error) {
+				assert.True(t, errors.Is(err, spec.ErrForbidden))
+				assert.Contains(t, err.Error(), "sorted by")
+			},
+		},
+		{
+			name:    "sort by readable attribute",
+			access:  s.policy.Access("hr"),
+			request: &service.QueryRequest{Sort: &crud.Sort{By: "name.givenName"}},
+			expect: func(t *testing.T, resp *service.QueryResponse, err error) {
+				assert.Nil(t, err)
+			},
+		},
+		{
+			name:    "root query",
+			access:  s.policy.Access("hr"),
+			query:   root,
+			request: &service.QueryRequest{Filter: `urn:ietf:params:scim:schemas:extension:enterprise:2.0:User:employeeNumber eq "42"`},
+			expect: func(t *testing.T, resp *service.QueryResponse, err error) {
+				assert.True(t, errors.Is(err, spec.ErrForbidden))
+			},
+		},
+		{
+			name:    "all granted",
+			access:  s.policy.Access("admin"),
+			request: &service.QueryRequest{Filter: `urn:ietf:params:scim:schemas:extension:enterprise:2.0:User:employeeNumber eq "42"`},
+			expect: func(t *testing.T, resp *service.QueryResponse, err error) {
+				require.Nil(t, err)
+				assert.Equal(t, 1, resp.TotalResults)
+			},
+		},
+		{
+			name:    "no access",
+			request: &service.QueryRequest{Filter: `urn:ietf:params:scim:schemas:extension:enterprise:2.0:User:employeeNumber eq "42"`},
+			expect: func(t *testing.T, resp *service.QueryResponse, err error) {
+				require.Nil(t, err)
+				assert.Equal(t, 1, resp.TotalResults)
+			},
+		},
+	}
+
+	for _, test := range tests {
+		s.T().Run(test.name, func(t *testing.T) {
+			ctx := context.TODO()
+			if test.access != nil {
+				ctx = With(ctx, test.access)
+			}
+			q := test.query
+			if q == nil {
+				q = query
+			}
+			resp, err := q.Do(ctx, test.request)
+			test.expect(t, resp, err)
+		})
+	}
+}
@@ -0,0 +1,57 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"github.com/imulab/go-scim/pkg/v2/spec"
+	"net/http"
+)
+
+// Authorizer authorizes the requests of the client to the service provider, i.e. by setting their Authorization
+// header. Errors returned stop the request from being sent, and are returned to the caller as is.
+type Authorizer interface {
+	Authorize(r *http.Request) error
+}
+
+// AuthorizerFunc is the function adapter of Authorizer.
+type AuthorizerFunc func(r *http.Request) error
+
+func (f AuthorizerFunc) Authorize(r *http.Request) error {
+	return f(r)
+}
+
+// BearerToken returns an Authorizer that sends the static token as a bearer token (RFC 6750), i.e. a long lived token
+// issued by the service provider.
+func BearerToken(token string) Authorizer {
+	return AuthorizerFunc(func(r *http.Request) error {
+		r.Header.Set("Authorization", "Bearer "+token)
+		return nil
+	})
+}
+
+// BearerTokenSource returns an Authorizer that sends the token returned by the source, with the context of the request,
+// as a bearer token, i.e. an access token of the client credentials grant, which the source caches and refreshes as it
+// expires, like an oauth2.TokenSource. Errors of the source are returned as errors of spec.ErrUnauthorized.
+func BearerTokenSource(source func(ctx context.Context) (string, error)) Authorizer {
+	return AuthorizerFunc(func(r *http.Request) error {
+		token, err := source(r.Context())
+		if err != nil {
+			return fmt.Errorf("%w: failed to obtain bearer token: %s", spec.ErrUnauthorized, err.Error())
+		}
+		r.Header.Set("Authorization", "Bearer "+token)
+		return nil
+	})
+}
+
+// BasicAuth returns an Authorizer that sends the username and password with the basic authentication scheme (RFC
+// 7617).
+func BasicAuth(username string, password string) Authorizer {
+	return AuthorizerFunc(func(r *http.Request) error {
+		r.SetBasicAuth(username, password)
+		return nil
+	})
+}
+
+var (
+	_ Authorizer = (AuthorizerFunc)(nil)
+)
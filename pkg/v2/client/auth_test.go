@@ -0,0 +1,67 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"github.com/imulab/go-scim/pkg/v2/spec"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAuthorizer(t *testing.T) {
+	tests := []struct {
+		name       string
+		authorizer Authorizer
+		expect     func(t *testing.T, r *http.Request, err error)
+	}{
+		{
+			name:       "bearer token",
+			authorizer: BearerToken("s3cret"),
+			expect: func(t *testing.T, r *http.Request, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, "Bearer s3cret", r.Header.Get("Authorization"))
+			},
+		},
+		{
+			name: "bearer token source",
+			authorizer: BearerTokenSource(func(ctx context.Context) (string, error) {
+				return "fresh", nil
+			}),
+			expect: func(t *testing.T, r *http.Request, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, "Bearer fresh", r.Header.Get("Authorization"))
+			},
+		},
+		{
+			name: "bearer token source failure",
+			authorizer: BearerTokenSource(func(ctx context.Context) (string, error) {
+				return "", errors.New("token endpoint is down")
+			}),
+			expect: func(t *testing.T, r *http.Request, err error) {
+				assert.True(t, errors.Is(err, spec.ErrUnauthorized))
+				assert.Empty(t, r.Header.Get("Authorization"))
+			},
+		},
+		{
+			name:       "basic auth",
+			authorizer: BasicAuth("foo", "bar"),
+			expect: func(t *testing.T, r *http.Request, err error) {
+				assert.Nil(t, err)
+				username, password, ok := r.BasicAuth()
+				assert.True(t, ok)
+				assert.Equal(t, "foo", username)
+				assert.Equal(t, "bar", password)
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/Users", nil)
+			err := test.authorizer.Authorize(r)
+			test.expect(t, r, err)
+		})
+	}
+}
@@ -0,0 +1,151 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	scimjson "github.com/imulab/go-scim/pkg/v2/json"
+	"github.com/imulab/go-scim/pkg/v2/prop"
+	"github.com/imulab/go-scim/pkg/v2/service"
+	"github.com/imulab/go-scim/pkg/v2/spec"
+	"net/http"
+	"strings"
+)
+
+// BulkRequest is a bulk request (RFC 7644 section 3.7).
+type BulkRequest struct {
+	// FailOnErrors, if positive, is the number of failed operations after which the service provider stops processing
+	// the rest.
+	FailOnErrors int
+	Operations   []*BulkOperation
+}
+
+// BulkOperation is an operation of a bulk request. The data is the resource of POST and PUT operations, and the patch
+// operations of PATCH operations, which are sent as a patch request.
+type BulkOperation struct {
+	Method  string
+	BulkID  string // identifies the resource created by the POST operation, to be referred to as "bulkId:<bulkId>"
+	Version string // version the resource has to be of, if not empty
+	Path    string // i.e. "/Users", or "/Users/2819c223"
+	Data    interface{}
+}
+
+// BulkCreate returns a bulk operation creating the resource at the endpoint of its resource type, which the other
+// operations may refer to as "bulkId:<bulkId>".
+func BulkCreate(bulkID string, resource *prop.Resource) *BulkOperation {
+	return &BulkOperation{Method: http.MethodPost, BulkID: bulkID, Path: resource.ResourceType().Endpoint(), Data: resource}
+}
+
+// BulkReplace returns a bulk operation replacing the resource of its id with the resource, if it is of the version of
+// the resource, if any.
+func BulkReplace(resource *prop.Resource) *BulkOperation {
+	return &BulkOperation{
+		Method:  http.MethodPut,
+		Version: resource.MetaVersionOrEmpty(),
+		Path:    location(resource.ResourceType(), resource.IdOrEmpty()),
+		Data:    resource,
+	}
+}
+
+// BulkPatch returns a bulk operation patching the resource of the resource type and id, which may be
+// "bulkId:<bulkId>", with the patch operations.
+func BulkPatch(resourceType *spec.ResourceType, id string, operations ...*PatchOperation) *BulkOperation {
+	return &BulkOperation{Method: http.MethodPatch, Path: location(resourceType, id), Data: operations}
+}
+
+// BulkDelete returns a bulk operation deleting the resource of the resource type and id.
+func BulkDelete(resourceType *spec.ResourceType, id string) *BulkOperation {
+	return &BulkOperation{Method: http.MethodDelete, Path: location(resourceType, id)}
+}
+
+// Bulk sends the bulk request, and returns the outcome of each operation processed as its service.BulkResult, whose
+// Err is the error of the failed operation, like the responses of the other requests, and whose Resource is nil.
+func (c *Client) Bulk(ctx context.Context, req *BulkRequest, options ...RequestOption) (*service.BulkResponse, error) {
+	body, err := bulkPayload(req)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.do(ctx, http.MethodPost, "/Bulk", body, options)
+	if err != nil {
+		return nil, err
+	}
+
+	payload := new(struct {
+		Operations []struct {
+			Location string        `json:"location"`
+			Method   string        `json:"method"`
+			BulkID   string        `json:"bulkId"`
+			Version  string        `json:"version"`
+			Status   status        `json:"status"`
+			Response *errorPayload `json:"response"`
+		} `json:"Operations"`
+	})
+	if err := scimjson.Unmarshal(resp.body, payload); err != nil {
+		return nil, fmt.Errorf("%w: failed to decode bulk response: %s", spec.ErrInvalidSyntax, err.Error())
+	}
+
+	bulkResponse := &service.BulkResponse{Results: make([]*service.BulkResult, 0, len(payload.Operations))}
+	for _, each := range payload.Operations {
+		result := &service.BulkResult{
+			Method:   each.Method,
+			BulkID:   each.BulkID,
+			Version:  each.Version,
+			Location: each.Location,
+			Status:   int(each.Status),
+		}
+		if result.Status >= http.StatusBadRequest {
+			if each.Response == nil || each.Response.Status == 0 {
+				each.Response = &errorPayload{Status: each.Status}
+			}
+			result.Err = errorFromPayload(each.Response)
+		}
+		bulkResponse.Results = append(bulkResponse.Results, result)
+	}
+	return bulkResponse, nil
+}
+
+// Returns the JSON payload of the bulk request. Unlike service.BulkPayload, empty fields are left out, as some service
+// providers reject them.
+func bulkPayload(req *BulkRequest) ([]byte, error) {
+	type operation struct {
+		Method  string          `json:"method"`
+		BulkID  string          `json:"bulkId,omitempty"`
+		Version string          `json:"version,omitempty"`
+		Path    string          `json:"path"`
+		Data    json.RawMessage `json:"data,omitempty"`
+	}
+	payload := struct {
+		Schemas      []string     `json:"schemas"`
+		FailOnErrors int          `json:"failOnErrors,omitempty"`
+		Operations   []*operation `json:"Operations"`
+	}{
+		Schemas:      []string{service.BulkRequestSchema},
+		FailOnErrors: req.FailOnErrors,
+		Operations:   make([]*operation, 0, len(req.Operations)),
+	}
+	for _, each := range req.Operations {
+		op := &operation{
+			Method:  strings.ToUpper(each.Method),
+			BulkID:  each.BulkID,
+			Version: each.Version,
+			Path:    each.Path,
+		}
+
+		var err error
+		switch data := each.Data.(type) {
+		case nil:
+		case *prop.Resource:
+			op.Data, err = scimjson.Serialize(data, scimjson.Payload())
+		case []*PatchOperation:
+			op.Data, err = patchPayload(data)
+		default:
+			op.Data, err = scimjson.Marshal(data)
+		}
+		if err != nil {
+			return nil, err
+		}
+		payload.Operations = append(payload.Operations, op)
+	}
+	return scimjson.Marshal(payload)
+}
@@ -0,0 +1,62 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"github.com/imulab/go-scim/pkg/v2/spec"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+)
+
+func (s *ClientTestSuite) TestBulk() {
+	ctx := context.TODO()
+
+	user, err := s.client.NewUser(map[string]interface{}{
+		"userName": "foo",
+		"emails":   []interface{}{map[string]interface{}{"value": "foo@example.com"}},
+	})
+	require.Nil(s.T(), err)
+	group, err := s.client.NewGroup(map[string]interface{}{
+		"displayName": "admins",
+		"members":     []interface{}{map[string]interface{}{"value": "bulkId:foo"}},
+	})
+	require.Nil(s.T(), err)
+
+	resp, err := s.client.Bulk(ctx, &BulkRequest{
+		Operations: []*BulkOperation{
+			BulkCreate("admins", group),
+			BulkCreate("foo", user),
+			BulkPatch(s.userType, "bulkId:foo", Replace("displayName", "Foo")),
+			BulkDelete(s.groupType, "unknown"),
+		},
+	})
+	require.Nil(s.T(), err)
+	require.Len(s.T(), resp.Results, 4)
+
+	byBulkID := map[string]string{}
+	for _, result := range resp.Results[:2] {
+		assert.Equal(s.T(), http.MethodPost, result.Method)
+		assert.Equal(s.T(), http.StatusCreated, result.Status)
+		assert.Nil(s.T(), result.Err)
+		assert.NotEmpty(s.T(), result.Location)
+		byBulkID[result.BulkID] = result.Location
+	}
+	assert.Equal(s.T(), http.StatusOK, resp.Results[2].Status)
+	assert.Equal(s.T(), http.StatusNotFound, resp.Results[3].Status)
+	assert.True(s.T(), errors.Is(resp.Results[3].Err, spec.ErrNotFound))
+
+	it, err := s.client.QueryUsers(&Query{Filter: `userName eq "foo"`})
+	require.Nil(s.T(), err)
+	created, ok, err := it.Next(ctx)
+	require.Nil(s.T(), err)
+	require.True(s.T(), ok)
+	assert.Equal(s.T(), "Foo", created.Navigator().Dot("displayName").Current().Raw())
+	assert.Contains(s.T(), byBulkID["foo"], created.IdOrEmpty())
+
+	// the group created first refers to the user created after it
+	admins, ok, err := s.client.Query(s.groupType, &Query{Filter: `displayName eq "admins"`}).Next(ctx)
+	require.Nil(s.T(), err)
+	require.True(s.T(), ok)
+	assert.Equal(s.T(), created.IdOrEmpty(), admins.Navigator().Dot("members").At(0).Dot("value").Current().Raw())
+}
@@ -0,0 +1,255 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/imulab/go-scim/pkg/v2/prop"
+	"github.com/imulab/go-scim/pkg/v2/spec"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Options configures the Client returned by New.
+type Options struct {
+	// BaseURL is the root of the SCIM endpoints of the service provider, i.e. "https://example.com/scim/v2". Required.
+	BaseURL string
+	// ResourceTypes are the resource types of the service provider, whose endpoints the requests are sent to, and which
+	// describe the resources sent and received. The User and Group methods expect resource types of id "User" and
+	// "Group" respectively.
+	ResourceTypes []*spec.ResourceType
+	// HTTPClient sends the requests, if not nil. Otherwise, http.DefaultClient is used.
+	HTTPClient *http.Client
+	// Authorizer, if not nil, authorizes every request, i.e. with a bearer token (see BearerToken).
+	Authorizer Authorizer
+	// Header, if not nil, is added to every request, i.e. for the User-Agent header.
+	Header http.Header
+	// Retry, if not nil, retries the requests that failed transiently (see Retry). Otherwise, every request is sent
+	// once.
+	Retry *Retry
+}
+
+// New returns a Client of the service provider at the base URL of the options. An error of spec.ErrInvalidValue is
+// returned if the base URL is not an absolute URL.
+func New(options Options) (*Client, error) {
+	base, err := url.Parse(strings.TrimSuffix(options.BaseURL, "/"))
+	if err != nil || !base.IsAbs() {
+		return nil, fmt.Errorf("%w: base URL '%s' is not an absolute URL", spec.ErrInvalidValue, options.BaseURL)
+	}
+
+	c := &Client{
+		options:       options,
+		base:          base,
+		httpClient:    options.HTTPClient,
+		retry:         Retry{Attempts: 1},
+		resourceTypes: map[string]*spec.ResourceType{},
+	}
+	if options.Retry != nil {
+		c.retry = options.Retry.withDefaults()
+	}
+	if c.httpClient == nil {
+		c.httpClient = http.DefaultClient
+	}
+	for _, resourceType := range options.ResourceTypes {
+		c.resourceTypes[resourceType.ID()] = resourceType
+	}
+	return c, nil
+}
+
+// Client sends requests to a SCIM service provider. It is safe for concurrent use.
+type Client struct {
+	options       Options
+	base          *url.URL
+	httpClient    *http.Client
+	retry         Retry
+	resourceTypes map[string]*spec.ResourceType
+}
+
+// ResourceType returns the resource type of the id among those of the options, or an error of spec.ErrNotFound.
+func (c *Client) ResourceType(id string) (*spec.ResourceType, error) {
+	resourceType, ok := c.resourceTypes[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: resource type '%s' is not known to the client", spec.ErrNotFound, id)
+	}
+	return resourceType, nil
+}
+
+// NewResource returns a new resource of the resource type, assigned with the data, i.e. map[string]interface{}{
+// "userName": "foo"}, like prop.Navigator.Replace does. When the data has no schemas, the schemas are those of the
+// resource type, and of the extensions present in the data. Any error of the assignment is returned.
+func (c *Client) NewResource(resourceType string, data map[string]interface{}) (*prop.Resource, error) {
+	rt, err := c.ResourceType(resourceType)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, ok := data["schemas"]; !ok {
+		schemas := []interface{}{rt.Schema().ID()}
+		_ = rt.ForEachExtension(func(extension *spec.Schema, _ bool) error {
+			if _, ok := data[extension.ID()]; ok {
+				schemas = append(schemas, extension.ID())
+			}
+			return nil
+		})
+		withSchemas := map[string]interface{}{"schemas": schemas}
+		for k, v := range data {
+			withSchemas[k] = v
+		}
+		data = withSchemas
+	}
+
+	resource := prop.NewResource(rt)
+	if err := resource.Navigator().Replace(data).Error(); err != nil {
+		return nil, err
+	}
+	return resource, nil
+}
+
+// RequestOption modifies a request before it is sent, i.e. to add a header.
+type RequestOption func(r *http.Request)
+
+// Attributes returns a RequestOption to only return the attributes, and those returned by default, like the attributes
+// parameter does.
+func Attributes(attributes ...string) RequestOption {
+	return queryParam("attributes", strings.Join(attributes, ","))
+}
+
+// ExcludedAttributes returns a RequestOption to not return the attributes, like the excludedAttributes parameter does.
+func ExcludedAttributes(attributes ...string) RequestOption {
+	return queryParam("excludedAttributes", strings.Join(attributes, ","))
+}
+
+// IfMatch returns a RequestOption to only replace, patch or delete the resource if it is of the version, or of any
+// version for "*", with an If-Match header. It overrides the version of the resource that Replace sends by itself.
+func IfMatch(version string) RequestOption {
+	return Header("If-Match", version)
+}
+
+// IfNoneMatch returns a RequestOption to only get the resource if it is not of the version, with an If-None-Match
+// header, in which case ErrNotModified is returned instead.
+func IfNoneMatch(version string) RequestOption {
+	return Header("If-None-Match", version)
+}
+
+// DryRun returns a RequestOption to only validate the resource, but not persist it, with a Dry-Run header, if the
+// service provider supports it.
+func DryRun() RequestOption {
+	return Header("Dry-Run", "true")
+}
+
+// IdempotencyKey returns a RequestOption to deduplicate retries of the create request with an Idempotency-Key header,
+// if the service provider supports it.
+func IdempotencyKey(key string) RequestOption {
+	return Header("Idempotency-Key", key)
+}
+
+// Header returns a RequestOption to set the header of the request.
+func Header(key string, value string) RequestOption {
+	return func(r *http.Request) {
+		r.Header.Set(key, value)
+	}
+}
+
+func queryParam(key string, value string) RequestOption {
+	return func(r *http.Request) {
+		if len(value) == 0 {
+			return
+		}
+		q := r.URL.Query()
+		q.Set(key, value)
+		r.URL.RawQuery = q.Encode()
+	}
+}
+
+// response is a response read in full.
+type response struct {
+	status int
+	header http.Header
+	body   []byte
+}
+
+// Sends the request to the path relative to the base URL, which is escaped already, with the body, if not nil, and
+// returns the response read in full. Responses of status 400 or above are returned as errors (see errorFromResponse).
+// Failed requests are retried according to the Retry of the options, if any, by sending them anew, hence authorizing
+// them anew too.
+func (c *Client) do(ctx context.Context, method string, path string, body []byte, options []RequestOption) (*response, error) {
+	backoff := c.retry.Backoff
+	for attempt := 1; ; attempt++ {
+		r, err := c.newRequest(ctx, method, path, body, options)
+		if err != nil {
+			return nil, err
+		}
+
+		resp, err := c.send(r)
+		if err == nil && resp.status < http.StatusBadRequest {
+			return resp, nil
+		}
+		if err == nil {
+			err = errorFromResponse(resp.status, resp.body)
+		}
+
+		delay, ok := c.retry.delay(r, resp, attempt, backoff)
+		if !ok {
+			return nil, err
+		}
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, err
+		case <-timer.C:
+		}
+		backoff *= 2
+	}
+}
+
+// Sends the request, and returns the response read in full, of any status. Errors are those of the transport, in which
+// case there is no response.
+func (c *Client) send(r *http.Request) (*response, error) {
+	resp, err := c.httpClient.Do(r)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to send request %s %s: %s", spec.ErrInternal, r.Method, r.URL.Path, err.Error())
+	}
+	defer resp.Body.Close()
+
+	raw, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to read response of %s %s: %s", spec.ErrInternal, r.Method, r.URL.Path, err.Error())
+	}
+	return &response{status: resp.StatusCode, header: resp.Header, body: raw}, nil
+}
+
+func (c *Client) newRequest(ctx context.Context, method string, path string, body []byte, options []RequestOption) (*http.Request, error) {
+	r, err := http.NewRequestWithContext(ctx, method, c.base.String()+"/"+strings.TrimPrefix(path, "/"), nil)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid request %s %s", spec.ErrInvalidValue, method, path)
+	}
+	if body != nil {
+		r.Body = ioutil.NopCloser(bytes.NewReader(body))
+		r.ContentLength = int64(len(body))
+		r.GetBody = func() (io.ReadCloser, error) {
+			return ioutil.NopCloser(bytes.NewReader(body)), nil
+		}
+		r.Header.Set("Content-Type", spec.ApplicationScimJson)
+	}
+	r.Header.Set("Accept", spec.ApplicationScimJson+", application/json")
+	for key, values := range c.options.Header {
+		for _, value := range values {
+			r.Header.Add(key, value)
+		}
+	}
+	for _, option := range options {
+		option(r)
+	}
+
+	if c.options.Authorizer != nil {
+		if err := c.options.Authorizer.Authorize(r); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
@@ -0,0 +1,320 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/imulab/go-scim/pkg/v2/crud"
+	"github.com/imulab/go-scim/pkg/v2/db"
+	"github.com/imulab/go-scim/pkg/v2/handlerutil"
+	"github.com/imulab/go-scim/pkg/v2/oauth"
+	"github.com/imulab/go-scim/pkg/v2/service"
+	"github.com/imulab/go-scim/pkg/v2/service/filter"
+	"github.com/imulab/go-scim/pkg/v2/spec"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClient(t *testing.T) {
+	s := new(ClientTestSuite)
+	suite.Run(t, s)
+}
+
+type ClientTestSuite struct {
+	suite.Suite
+	config    *spec.ServiceProviderConfig
+	userType  *spec.ResourceType
+	groupType *spec.ResourceType
+	server    *httptest.Server
+	client    *Client
+}
+
+func (s *ClientTestSuite) TestUserLifecycle() {
+	ctx := context.TODO()
+
+	user, err := s.client.NewUser(map[string]interface{}{
+		"userName": "foo",
+		"password": "s3cret",
+		"emails":   []interface{}{map[string]interface{}{"value": "foo@example.com"}},
+		"urn:ietf:params:scim:schemas:extension:enterprise:2.0:User": map[string]interface{}{
+			"employeeNumber": "42",
+		},
+	})
+	require.Nil(s.T(), err)
+
+	created, err := s.client.CreateUser(ctx, user)
+	require.Nil(s.T(), err)
+	id := created.IdOrEmpty()
+	assert.NotEmpty(s.T(), id)
+	assert.NotEmpty(s.T(), created.MetaVersionOrEmpty())
+	userName, err := created.Navigator().Dot("userName").Current().Raw(), created.Navigator().Error()
+	require.Nil(s.T(), err)
+	assert.Equal(s.T(), "foo", userName)
+
+	got, err := s.client.GetUser(ctx, id, Attributes("userName"))
+	require.Nil(s.T(), err)
+	assert.Equal(s.T(), id, got.IdOrEmpty())
+	assert.True(s.T(), got.Navigator().Dot("emails").Current().IsUnassigned())
+
+	_, err = s.client.GetUser(ctx, id, IfNoneMatch(created.MetaVersionOrEmpty()))
+	assert.True(s.T(), errors.Is(err, ErrNotModified))
+
+	patched, err := s.client.PatchUser(ctx, id, []*PatchOperation{
+		Replace("displayName", "Foo"),
+		Add("emails", []interface{}{map[string]interface{}{"value": "foo@home.com"}}),
+	}, IfMatch(created.MetaVersionOrEmpty()))
+	require.Nil(s.T(), err)
+	require.NotNil(s.T(), patched)
+	assert.Equal(s.T(), "Foo", patched.Navigator().Dot("displayName").Current().Raw())
+	assert.Len(s.T(), patched.Navigator().Dot("emails").Current().Raw(), 2)
+	assert.NotEqual(s.T(), created.MetaVersionOrEmpty(), patched.MetaVersionOrEmpty())
+
+	// the resource read before the patch is stale
+	_, err = s.client.ReplaceUser(ctx, created)
+	assert.True(s.T(), errors.Is(err, spec.ErrConflict))
+
+	require.Nil(s.T(), patched.Navigator().Dot("displayName").Replace("Bar").Error())
+	replaced, err := s.client.ReplaceUser(ctx, patched)
+	require.Nil(s.T(), err)
+	require.NotNil(s.T(), replaced)
+	assert.Equal(s.T(), "Bar", replaced.Navigator().Dot("displayName").Current().Raw())
+
+	unchanged, err := s.client.ReplaceUser(ctx, replaced)
+	assert.Nil(s.T(), err)
+	assert.Nil(s.T(), unchanged)
+
+	require.Nil(s.T(), s.client.DeleteUser(ctx, id))
+
+	_, err = s.client.GetUser(ctx, id)
+	assert.True(s.T(), errors.Is(err, spec.ErrNotFound))
+}
+
+func (s *ClientTestSuite) TestErrors() {
+	ctx := context.TODO()
+
+	user, err := s.client.NewUser(map[string]interface{}{
+		"userName": "foo",
+		"emails":   []interface{}{map[string]interface{}{"value": "foo@example.com"}},
+	})
+	require.Nil(s.T(), err)
+	created, err := s.client.CreateUser(ctx, user)
+	require.Nil(s.T(), err)
+
+	unauthorized, err := New(Options{BaseURL: s.server.URL + "/scim/v2", ResourceTypes: []*spec.ResourceType{s.userType}})
+	require.Nil(s.T(), err)
+
+	tests := []struct {
+		name   string
+		call   func() error
+		expect error
+	}{
+		{
+			name: "duplicate user",
+			call: func() error {
+				_, err := s.client.CreateUser(ctx, user)
+				return err
+			},
+			expect: spec.ErrUniqueness,
+		},
+		{
+			name: "invalid user",
+			call: func() error {
+				_, err := s.client.PatchUser(ctx, created.IdOrEmpty(), []*PatchOperation{Replace("userName", 42)})
+				return err
+			},
+			expect: spec.ErrInvalidSyntax,
+		},
+		{
+			name: "group as user",
+			call: func() error {
+				group, err := s.client.NewGroup(map[string]interface{}{"displayName": "foo"})
+				require.Nil(s.T(), err)
+				_, err = s.client.CreateUser(ctx, group)
+				return err
+			},
+			expect: spec.ErrInvalidValue,
+		},
+		{
+			name: "replace without id",
+			call: func() error {
+				_, err := s.client.ReplaceUser(ctx, user)
+				return err
+			},
+			expect: spec.ErrInvalidValue,
+		},
+		{
+			name: "resource type unknown to the client",
+			call: func() error {
+				_, err := unauthorized.GetGroup(ctx, "foo")
+				return err
+			},
+			expect: spec.ErrNotFound,
+		},
+		{
+			name: "not found",
+			call: func() error {
+				return s.client.DeleteUser(ctx, "foo")
+			},
+			expect: spec.ErrNotFound,
+		},
+		{
+			name: "not authorized",
+			call: func() error {
+				_, err := unauthorized.GetUser(ctx, "foo")
+				return err
+			},
+			expect: spec.ErrUnauthorized,
+		},
+	}
+
+	for _, test := range tests {
+		s.T().Run(test.name, func(t *testing.T) {
+			err := test.call()
+			assert.True(t, errors.Is(err, test.expect), "unexpected error: %v", err)
+		})
+	}
+}
+
+func (s *ClientTestSuite) TestNew() {
+	for _, baseURL := range []string{"", "/scim/v2", "://example.com"} {
+		_, err := New(Options{BaseURL: baseURL})
+		assert.True(s.T(), errors.Is(err, spec.ErrInvalidValue), baseURL)
+	}
+}
+
+func (s *ClientTestSuite) SetupTest() {
+	userDB := db.Memory()
+	groupDB := db.Memory()
+	filters := func(database db.DB) []filter.ByResource {
+		return []filter.ByResource{
+			filter.ByPropertyToByResource(
+				filter.ReadOnlyFilter(),
+				filter.UUIDFilter(),
+				filter.BCryptFilter(),
+			),
+			filter.MetaFilter(),
+			filter.ByPropertyToByResource(filter.ValidationFilter(database)),
+		}
+	}
+	endpoint := func(resourceType *spec.ResourceType, database db.DB) *handlerutil.Endpoint {
+		return &handlerutil.Endpoint{
+			ResourceType: resourceType,
+			Create:       service.CreateService(resourceType, database, filters(database)),
+			Get:          service.GetService(database),
+			Query:        service.QueryService(s.config, database),
+			Replace:      service.ReplaceService(s.config, resourceType, database, filters(database)),
+			Patch:        service.PatchService(s.config, database, nil, filters(database)),
+			Delete:       service.DeleteService(s.config, database),
+		}
+	}
+	users, groups := endpoint(s.userType, userDB), endpoint(s.groupType, groupDB)
+	bulkEndpoint := func(endpoint *handlerutil.Endpoint) *service.BulkEndpoint {
+		return &service.BulkEndpoint{
+			ResourceType: endpoint.ResourceType,
+			Create:       endpoint.Create,
+			Replace:      endpoint.Replace,
+			Patch:        endpoint.Patch,
+			Delete:       endpoint.Delete,
+		}
+	}
+
+	mux := http.NewServeMux()
+	handlerutil.Mount(mux, "/scim/v2", oauth.Middleware(oauth.Options{
+		Verifier: oauth.NewStaticTokens(&oauth.StaticToken{Token: "s3cret", Subject: "test"}),
+	}, handlerutil.NewServer(handlerutil.ServerOptions{
+		ServiceProviderConfig: s.config,
+		Endpoints:             []*handlerutil.Endpoint{users, groups},
+		Bulk:                  service.BulkService(s.config, bulkEndpoint(users), bulkEndpoint(groups)),
+		Search:                service.RootQueryService(s.config, users.Query, groups.Query),
+	})))
+	s.server = httptest.NewServer(mux)
+
+	var err error
+	s.client, err = New(Options{
+		BaseURL:       s.server.URL + "/scim/v2/",
+		ResourceTypes: []*spec.ResourceType{s.userType, s.groupType},
+		Authorizer:    BearerToken("s3cret"),
+	})
+	require.Nil(s.T(), err)
+}
+
+func (s *ClientTestSuite) TearDownTest() {
+	s.server.Close()
+}
+
+func (s *ClientTestSuite) SetupSuite() {
+	for _, each := range []struct {
+		filepath  string
+		structure interface{}
+		post      func(parsed interface{})
+	}{
+		{
+			filepath:  "../../../public/schemas/core_schema.json",
+			structure: new(spec.Schema),
+			post: func(parsed interface{}) {
+				spec.Schemas().Register(parsed.(*spec.Schema))
+			},
+		},
+		{
+			filepath:  "../../../public/schemas/user_schema.json",
+			structure: new(spec.Schema),
+			post: func(parsed interface{}) {
+				spec.Schemas().Register(parsed.(*spec.Schema))
+			},
+		},
+		{
+			filepath:  "../../../public/schemas/user_enterprise_extension_schema.json",
+			structure: new(spec.Schema),
+			post: func(parsed interface{}) {
+				spec.Schemas().Register(parsed.(*spec.Schema))
+			},
+		},
+		{
+			filepath:  "../../../public/schemas/group_schema.json",
+			structure: new(spec.Schema),
+			post: func(parsed interface{}) {
+				spec.Schemas().Register(parsed.(*spec.Schema))
+			},
+		},
+		{
+			filepath:  "../../../public/resource_types/user_resource_type.json",
+			structure: new(spec.ResourceType),
+			post: func(parsed interface{}) {
+				s.userType = parsed.(*spec.ResourceType)
+				crud.Register(s.userType)
+			},
+		},
+		{
+			filepath:  "../../../public/resource_types/group_resource_type.json",
+			structure: new(spec.ResourceType),
+			post: func(parsed interface{}) {
+				s.groupType = parsed.(*spec.ResourceType)
+				crud.Register(s.groupType)
+			},
+		},
+	} {
+		raw, err := ioutil.ReadFile(each.filepath)
+		require.Nil(s.T(), err)
+
+		err = json.Unmarshal(raw, each.structure)
+		require.Nil(s.T(), err)
+
+		if each.post != nil {
+			each.post(each.structure)
+		}
+	}
+
+	s.config = new(spec.ServiceProviderConfig)
+	require.Nil(s.T(), json.Unmarshal([]byte(`{
+		"patch": {"supported": true},
+		"bulk": {"supported": true, "maxOperations": 10, "maxPayloadSize": 1048576},
+		"filter": {"supported": true, "maxResults": 100},
+		"sort": {"supported": true},
+		"etag": {"supported": true}
+	}`), s.config))
+}
@@ -0,0 +1,11 @@
+// This package implements a client of SCIM service providers (RFC 7644), for services that provision resources to
+// downstream servers, i.e. another directory, instead of, or in addition to, serving them.
+//
+// The resources are described by the same resource types and schemas that describe those of the server, and are sent
+// and received as prop.Resource, so that they are constructed, navigated and serialized like any other resource. The
+// client creates, reads, replaces, patches and deletes them, queries them with iterators which walk through the pages
+// of results, and sends bulk requests. The versions of the resources are sent as If-Match and If-None-Match headers,
+// and errors answered by the service provider are returned as errors wrapping the matching error prototypes of the spec
+// package, so that errors.Is works like it does on the server. Requests are authorized by a pluggable Authorizer, and
+// requests which failed transiently are retried with backoff, honoring Retry-After, if configured (see Retry).
+package client
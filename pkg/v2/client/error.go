@@ -0,0 +1,137 @@
+package client
+
+import (
+	"errors"
+	scimjson "github.com/imulab/go-scim/pkg/v2/json"
+	"github.com/imulab/go-scim/pkg/v2/spec"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// ErrNotModified is returned by the requests with IfNoneMatch, when the resource is of the version given, and the
+// service provider answered with status 304.
+var ErrNotModified = errors.New("resource is not modified")
+
+// errorPayload is the payload of the error responses (RFC 7644 section 3.12). The status is a string by the RFC, while
+// many service providers, including the handlers of this module, render it as a number, hence both are accepted.
+type errorPayload struct {
+	Status   status `json:"status"`
+	ScimType string `json:"scimType"`
+	Detail   string `json:"detail"`
+}
+
+// status is the HTTP status of the error and bulk responses, rendered as a string or a number.
+type status int
+
+func (s *status) UnmarshalJSON(raw []byte) error {
+	value, err := strconv.Atoi(strings.Trim(string(raw), `"`))
+	if err != nil {
+		return err
+	}
+	*s = status(value)
+	return nil
+}
+
+// Returns the error of the response of the status, whose body is an error payload, if any. The error wraps the error
+// prototype of the spec package matching the scimType and status of the payload, or, when the payload has no
+// scimType, which is optional, the status alone; otherwise, it wraps a *spec.Error of the status and scimType.
+func errorFromResponse(statusCode int, body []byte) error {
+	payload := new(errorPayload)
+	if err := scimjson.Unmarshal(body, payload); err != nil || payload.Status == 0 {
+		payload = &errorPayload{Status: status(statusCode), Detail: strings.TrimSpace(string(body))}
+	}
+	return errorFromPayload(payload)
+}
+
+func errorFromPayload(payload *errorPayload) error {
+	for _, each := range []*spec.Error{
+		spec.ErrInvalidFilter,
+		spec.ErrTooMany,
+		spec.ErrUniqueness,
+		spec.ErrMutability,
+		spec.ErrInvalidSyntax,
+		spec.ErrInvalidPath,
+		spec.ErrNoTarget,
+		spec.ErrInvalidValue,
+		spec.ErrNotFound,
+		spec.ErrSensitive,
+		spec.ErrConflict,
+		spec.ErrInvalidCursor,
+		spec.ErrPayloadTooLarge,
+		spec.ErrUnauthorized,
+		spec.ErrForbidden,
+		spec.ErrQuotaExceeded,
+		spec.ErrTooManyRequests,
+		spec.ErrNotImplemented,
+		spec.ErrMethodNotAllowed,
+		spec.ErrUnsupportedMediaType,
+		spec.ErrNotAcceptable,
+		spec.ErrInvalidVersion,
+		spec.ErrInternal,
+	} {
+		if each.Type == payload.ScimType && each.Status == int(payload.Status) {
+			return &responseError{cause: each, detail: payload.Detail}
+		}
+	}
+
+	if len(payload.ScimType) == 0 {
+		var cause *spec.Error
+		switch int(payload.Status) {
+		case http.StatusUnauthorized:
+			cause = spec.ErrUnauthorized
+		case http.StatusForbidden:
+			cause = spec.ErrForbidden
+		case http.StatusNotFound:
+			cause = spec.ErrNotFound
+		case http.StatusMethodNotAllowed:
+			cause = spec.ErrMethodNotAllowed
+		case http.StatusNotAcceptable:
+			cause = spec.ErrNotAcceptable
+		case http.StatusConflict:
+			cause = spec.ErrUniqueness
+		case http.StatusPreconditionFailed:
+			cause = spec.ErrConflict
+		case http.StatusRequestEntityTooLarge:
+			cause = spec.ErrPayloadTooLarge
+		case http.StatusUnsupportedMediaType:
+			cause = spec.ErrUnsupportedMediaType
+		case http.StatusTooManyRequests:
+			cause = spec.ErrTooManyRequests
+		case http.StatusInternalServerError:
+			cause = spec.ErrInternal
+		case http.StatusNotImplemented:
+			cause = spec.ErrNotImplemented
+		}
+		if cause != nil {
+			return &responseError{cause: cause, detail: payload.Detail}
+		}
+	}
+
+	return &responseError{
+		cause:  &spec.Error{Status: int(payload.Status), Type: payload.ScimType},
+		detail: payload.Detail,
+	}
+}
+
+// responseError is an error answered by the service provider. It keeps the detail of the response as its message,
+// which the handlers of this module prefix with the scimType already, while unwrapping to the spec error.
+type responseError struct {
+	cause  *spec.Error
+	detail string
+}
+
+func (e *responseError) Error() string {
+	if len(e.detail) == 0 {
+		return e.cause.Error()
+	}
+	return e.detail
+}
+
+func (e *responseError) Unwrap() error {
+	return e.cause
+}
+
+var (
+	_ error = (*responseError)(nil)
+)
@@ -0,0 +1,75 @@
+package client
+
+import (
+	"errors"
+	"github.com/imulab/go-scim/pkg/v2/spec"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"testing"
+)
+
+func TestErrorFromResponse(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		body   string
+		expect *spec.Error
+		detail string
+	}{
+		{
+			name:   "numeric status",
+			status: http.StatusConflict,
+			body:   `{"schemas": ["urn:ietf:params:scim:api:messages:2.0:Error"], "status": 409, "scimType": "uniqueness", "detail": "uniqueness: userName is taken"}`,
+			expect: spec.ErrUniqueness,
+			detail: "uniqueness: userName is taken",
+		},
+		{
+			name:   "string status",
+			status: http.StatusBadRequest,
+			body:   `{"schemas": ["urn:ietf:params:scim:api:messages:2.0:Error"], "status": "400", "scimType": "invalidFilter", "detail": "bad filter"}`,
+			expect: spec.ErrInvalidFilter,
+			detail: "bad filter",
+		},
+		{
+			name:   "no scimType",
+			status: http.StatusNotFound,
+			body:   `{"schemas": ["urn:ietf:params:scim:api:messages:2.0:Error"], "status": "404", "detail": "no such user"}`,
+			expect: spec.ErrNotFound,
+			detail: "no such user",
+		},
+		{
+			name:   "rate limited",
+			status: http.StatusTooManyRequests,
+			body:   `{"schemas": ["urn:ietf:params:scim:api:messages:2.0:Error"], "status": "429", "scimType": "tooManyRequests", "detail": "slow down"}`,
+			expect: spec.ErrTooManyRequests,
+			detail: "slow down",
+		},
+		{
+			name:   "not an error payload",
+			status: http.StatusUnauthorized,
+			body:   "Unauthorized\n",
+			expect: spec.ErrUnauthorized,
+			detail: "Unauthorized",
+		},
+		{
+			name:   "unknown scimType",
+			status: http.StatusBadRequest,
+			body:   `{"status": "400", "scimType": "custom", "detail": "custom error"}`,
+			expect: &spec.Error{Status: 400, Type: "custom"},
+			detail: "custom error",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := errorFromResponse(test.status, []byte(test.body))
+			assert.Equal(t, test.detail, err.Error())
+
+			var scimErr *spec.Error
+			if assert.True(t, errors.As(err, &scimErr)) {
+				assert.Equal(t, test.expect.Status, scimErr.Status)
+				assert.Equal(t, test.expect.Type, scimErr.Type)
+			}
+		})
+	}
+}
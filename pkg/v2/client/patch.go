@@ -0,0 +1,43 @@
+package client
+
+import (
+	scimjson "github.com/imulab/go-scim/pkg/v2/json"
+)
+
+// Schema of the patch request message
+const patchOpSchema = "urn:ietf:params:scim:api:messages:2.0:PatchOp"
+
+// PatchOperation is an operation of a patch request (RFC 7644 section 3.5.2). The value is marshaled to JSON as is,
+// hence shall be what the path points to, i.e. a string for "displayName", or a map[string]interface{} of the sub
+// attributes for "name", or a []interface{} of such for "emails".
+type PatchOperation struct {
+	Op    string      `json:"op"`
+	Path  string      `json:"path,omitempty"`
+	Value interface{} `json:"value,omitempty"`
+}
+
+// Add returns a patch operation adding the value at the path, or to the resource if path is empty.
+func Add(path string, value interface{}) *PatchOperation {
+	return &PatchOperation{Op: "add", Path: path, Value: value}
+}
+
+// Replace returns a patch operation replacing the value at the path, or the attributes of the value if path is empty.
+func Replace(path string, value interface{}) *PatchOperation {
+	return &PatchOperation{Op: "replace", Path: path, Value: value}
+}
+
+// Remove returns a patch operation removing the value at the path, i.e. `members[value eq "2819c223"]`.
+func Remove(path string) *PatchOperation {
+	return &PatchOperation{Op: "remove", Path: path}
+}
+
+// Returns the JSON payload of the patch request of the operations.
+func patchPayload(operations []*PatchOperation) ([]byte, error) {
+	return scimjson.Marshal(struct {
+		Schemas    []string          `json:"schemas"`
+		Operations []*PatchOperation `json:"Operations"`
+	}{
+		Schemas:    []string{patchOpSchema},
+		Operations: operations,
+	})
+}
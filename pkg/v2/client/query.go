@@ -0,0 +1,235 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"github.com/imulab/go-scim/pkg/v2/handlerutil"
+	scimjson "github.com/imulab/go-scim/pkg/v2/json"
+	"github.com/imulab/go-scim/pkg/v2/prop"
+	"github.com/imulab/go-scim/pkg/v2/service"
+	"github.com/imulab/go-scim/pkg/v2/spec"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Query carries the parameters of a query (RFC 7644 section 3.4.2). The zero value queries all resources, in pages of
+// the size the service provider defaults to.
+type Query struct {
+	Filter             string
+	SortBy             string
+	SortOrder          string // "ascending" or "descending"
+	Attributes         []string
+	ExcludedAttributes []string
+	// StartIndex is the 1-based index of the first result, for index based pagination. Defaults to 1.
+	StartIndex int
+	// Count is the maximum number of results per page, if positive.
+	Count int
+	// Cursor, if not nil, requests cursor based pagination (see draft-ietf-scim-cursor-pagination), starting from the
+	// page of the cursor, or the first page if it is empty. StartIndex is ignored.
+	Cursor *string
+	// Post sends the query as a POST to the .search endpoint, instead of a GET with query parameters, so that the filter
+	// is not part of the URL (see RFC 7644 section 3.4.3).
+	Post bool
+}
+
+// ListResponse is a page of the results of a query.
+type ListResponse struct {
+	TotalResults int
+	StartIndex   int
+	ItemsPerPage int
+	NextCursor   string // cursor of the next page, empty on the last page, or without cursor based pagination
+	Resources    []*prop.Resource
+}
+
+// List returns the page of the query on the endpoint of the resource type; or, when the resource type is nil, across all
+// endpoints with a POST to the .search endpoint at the root. The resources of queries across all endpoints are
+// decoded with the resource types of the options whose schema they list.
+func (c *Client) List(ctx context.Context, resourceType *spec.ResourceType, query *Query, options ...RequestOption) (*ListResponse, error) {
+	if query == nil {
+		query = new(Query)
+	}
+
+	var (
+		resp *response
+		err  error
+	)
+	switch {
+	case resourceType == nil:
+		resp, err = c.search(ctx, "/.search", query, options)
+	case query.Post:
+		resp, err = c.search(ctx, resourceType.Endpoint()+"/.search", query, options)
+	default:
+		resp, err = c.do(ctx, http.MethodGet, resourceType.Endpoint()+"?"+query.values().Encode(), nil, options)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	rendering := new(handlerutil.SearchResultRendering)
+	if err := scimjson.Unmarshal(resp.body, rendering); err != nil {
+		return nil, fmt.Errorf("%w: failed to decode list response: %s", spec.ErrInvalidSyntax, err.Error())
+	}
+
+	list := &ListResponse{
+		TotalResults: rendering.TotalResults,
+		StartIndex:   rendering.StartIndex,
+		ItemsPerPage: rendering.ItemsPerPage,
+		NextCursor:   rendering.NextCursor,
+		Resources:    make([]*prop.Resource, 0, len(rendering.Resources)),
+	}
+	for _, raw := range rendering.Resources {
+		rt := resourceType
+		if rt == nil {
+			if rt, err = c.resourceTypeOf(raw); err != nil {
+				return nil, err
+			}
+		}
+		resource, err := decodeResource(rt, raw)
+		if err != nil {
+			return nil, err
+		}
+		list.Resources = append(list.Resources, resource)
+	}
+	return list, nil
+}
+
+// Query returns an Iterator over the results of the query, like List does, which requests the pages that follow as the
+// resources of the previous page are exhausted.
+func (c *Client) Query(resourceType *spec.ResourceType, query *Query, options ...RequestOption) *Iterator {
+	q := Query{}
+	if query != nil {
+		q = *query
+	}
+	return &Iterator{
+		client:       c,
+		resourceType: resourceType,
+		query:        q,
+		options:      options,
+	}
+}
+
+// Iterator iterates the results of a query, page by page. It is not safe for concurrent use.
+type Iterator struct {
+	client       *Client
+	resourceType *spec.ResourceType
+	query        Query
+	options      []RequestOption
+	page         []*prop.Resource
+	totalResults int
+	done         bool
+}
+
+// Next returns the next resource and true; or nil and false when the results are exhausted. Errors of the requests
+// are returned as is, in which case Next may be called again to retry the page.
+func (it *Iterator) Next(ctx context.Context) (resource *prop.Resource, ok bool, err error) {
+	for len(it.page) == 0 {
+		if it.done {
+			return nil, false, nil
+		}
+		if err = it.fetch(ctx); err != nil {
+			return nil, false, err
+		}
+	}
+
+	resource, it.page = it.page[0], it.page[1:]
+	return resource, true, nil
+}
+
+// TotalResults returns the total number of results of the query, as reported by the last page requested.
+func (it *Iterator) TotalResults() int {
+	return it.totalResults
+}
+
+// Requests the page of the query, and advances the query to the page that follows, if any.
+func (it *Iterator) fetch(ctx context.Context) error {
+	list, err := it.client.List(ctx, it.resourceType, &it.query, it.options...)
+	if err != nil {
+		return err
+	}
+
+	it.page = list.Resources
+	it.totalResults = list.TotalResults
+	switch {
+	case len(list.Resources) == 0:
+		it.done = true
+	case it.query.Cursor != nil:
+		next := list.NextCursor
+		it.query.Cursor = &next
+		it.done = len(next) == 0
+	default:
+		startIndex := list.StartIndex
+		if startIndex < 1 {
+			startIndex = 1
+		}
+		it.query.StartIndex = startIndex + len(list.Resources)
+		it.done = it.query.StartIndex > list.TotalResults
+	}
+	return nil
+}
+
+// Sends the query as a search request to the path.
+func (c *Client) search(ctx context.Context, path string, query *Query, options []RequestOption) (*response, error) {
+	payload := &service.SearchPayload{
+		Schemas:            []string{service.SearchRequestSchema},
+		Attributes:         query.Attributes,
+		ExcludedAttributes: query.ExcludedAttributes,
+		Filter:             query.Filter,
+		SortBy:             query.SortBy,
+		SortOrder:          query.SortOrder,
+		Count:              query.Count,
+		Cursor:             query.Cursor,
+	}
+	if query.Cursor == nil {
+		payload.StartIndex = query.StartIndex
+	}
+
+	body, err := scimjson.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	return c.do(ctx, http.MethodPost, path, body, options)
+}
+
+// Returns the query parameters of the query.
+func (q *Query) values() url.Values {
+	values := url.Values{}
+	set := func(key string, value string) {
+		if len(value) > 0 {
+			values.Set(key, value)
+		}
+	}
+	set("filter", q.Filter)
+	set("sortBy", q.SortBy)
+	set("sortOrder", q.SortOrder)
+	set("attributes", strings.Join(q.Attributes, ","))
+	set("excludedAttributes", strings.Join(q.ExcludedAttributes, ","))
+	if q.Count > 0 {
+		values.Set("count", strconv.Itoa(q.Count))
+	}
+	if q.Cursor != nil {
+		values.Set("cursor", *q.Cursor)
+	} else if q.StartIndex > 0 {
+		values.Set("startIndex", strconv.Itoa(q.StartIndex))
+	}
+	return values
+}
+
+// Returns the resource type, among those of the options, whose schema is listed by the schemas of the raw resource.
+func (c *Client) resourceTypeOf(raw []byte) (*spec.ResourceType, error) {
+	var resource struct {
+		Schemas []string `json:"schemas"`
+	}
+	if err := scimjson.Unmarshal(raw, &resource); err != nil {
+		return nil, fmt.Errorf("%w: failed to decode list response resource: %s", spec.ErrInvalidSyntax, err.Error())
+	}
+	for _, resourceType := range c.options.ResourceTypes {
+		for _, schema := range resource.Schemas {
+			if schema == resourceType.Schema().ID() {
+				return resourceType, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("%w: no resource type of schemas %v is known to the client", spec.ErrInvalidSyntax, resource.Schemas)
+}
@@ -0,0 +1,147 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"github.com/imulab/go-scim/pkg/v2/spec"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func (s *ClientTestSuite) TestQuery() {
+	ctx := context.TODO()
+
+	for i := 0; i < 5; i++ {
+		user, err := s.client.NewUser(map[string]interface{}{
+			"userName": fmt.Sprintf("user%d", i),
+			"emails":   []interface{}{map[string]interface{}{"value": fmt.Sprintf("user%d@example.com", i)}},
+		})
+		require.Nil(s.T(), err)
+		_, err = s.client.CreateUser(ctx, user)
+		require.Nil(s.T(), err)
+	}
+	group, err := s.client.NewGroup(map[string]interface{}{"displayName": "admins"})
+	require.Nil(s.T(), err)
+	_, err = s.client.CreateGroup(ctx, group)
+	require.Nil(s.T(), err)
+
+	drain := func(t *testing.T, it *Iterator) (names []string) {
+		for {
+			resource, ok, err := it.Next(ctx)
+			require.Nil(t, err)
+			if !ok {
+				return
+			}
+			switch resource.ResourceType().ID() {
+			case UserResourceType:
+				names = append(names, resource.Navigator().Dot("userName").Current().Raw().(string))
+			case GroupResourceType:
+				names = append(names, resource.Navigator().Dot("displayName").Current().Raw().(string))
+			}
+		}
+	}
+
+	tests := []struct {
+		name   string
+		query  func() (*Iterator, error)
+		expect []string
+	}{
+		{
+			name: "all pages",
+			query: func() (*Iterator, error) {
+				return s.client.QueryUsers(&Query{SortBy: "userName", Count: 2})
+			},
+			expect: []string{"user0", "user1", "user2", "user3", "user4"},
+		},
+		{
+			name: "pages from the start index",
+			query: func() (*Iterator, error) {
+				return s.client.QueryUsers(&Query{SortBy: "userName", SortOrder: "descending", StartIndex: 3, Count: 2})
+			},
+			expect: []string{"user2", "user1", "user0"},
+		},
+		{
+			name: "filter",
+			query: func() (*Iterator, error) {
+				return s.client.QueryUsers(&Query{Filter: `userName eq "user3" or userName eq "user1"`, SortBy: "userName"})
+			},
+			expect: []string{"user1", "user3"},
+		},
+		{
+			name: "search",
+			query: func() (*Iterator, error) {
+				return s.client.QueryUsers(&Query{Filter: `userName sw "user"`, SortBy: "userName", Count: 3, Post: true})
+			},
+			expect: []string{"user0", "user1", "user2", "user3", "user4"},
+		},
+		{
+			name: "no results",
+			query: func() (*Iterator, error) {
+				return s.client.QueryGroups(&Query{Filter: `displayName eq "users"`})
+			},
+		},
+		{
+			name: "all endpoints",
+			query: func() (*Iterator, error) {
+				return s.client.Query(nil, &Query{Count: 4}), nil
+			},
+			expect: []string{"user0", "user1", "user2", "user3", "user4", "admins"},
+		},
+	}
+
+	for _, test := range tests {
+		s.T().Run(test.name, func(t *testing.T) {
+			it, err := test.query()
+			require.Nil(t, err)
+			assert.ElementsMatch(t, test.expect, drain(t, it))
+
+			_, ok, err := it.Next(ctx)
+			assert.Nil(t, err)
+			assert.False(t, ok)
+		})
+	}
+
+	list, err := s.client.List(ctx, s.userType, &Query{Count: 2, SortBy: "userName"})
+	require.Nil(s.T(), err)
+	assert.Equal(s.T(), 5, list.TotalResults)
+	assert.Equal(s.T(), 1, list.StartIndex)
+	assert.Len(s.T(), list.Resources, 2)
+}
+
+func (s *ClientTestSuite) TestQueryWithCursor() {
+	t := s.T()
+
+	pages := map[string]string{
+		"":   `{"totalResults": 3, "itemsPerPage": 2, "nextCursor": "p2", "Resources": [{"id": "a", "userName": "a"}, {"id": "b", "userName": "b"}]}`,
+		"p2": `{"totalResults": 3, "itemsPerPage": 1, "Resources": [{"id": "c", "userName": "c"}]}`,
+	}
+	var requested []string
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		cursor := r.URL.Query().Get("cursor")
+		requested = append(requested, cursor)
+		rw.Header().Set("Content-Type", spec.ApplicationScimJson)
+		_, _ = rw.Write([]byte(pages[cursor]))
+	}))
+	defer server.Close()
+
+	c, err := New(Options{BaseURL: server.URL, ResourceTypes: []*spec.ResourceType{s.userType}})
+	require.Nil(t, err)
+
+	first := ""
+	it := c.Query(s.userType, &Query{Cursor: &first, Count: 2})
+	var ids []string
+	for {
+		resource, ok, err := it.Next(context.TODO())
+		require.Nil(t, err)
+		if !ok {
+			break
+		}
+		ids = append(ids, resource.IdOrEmpty())
+	}
+	assert.Equal(t, []string{"a", "b", "c"}, ids)
+	assert.Equal(t, []string{"", "p2"}, requested)
+	assert.Equal(t, 3, it.TotalResults())
+}
@@ -0,0 +1,127 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	scimjson "github.com/imulab/go-scim/pkg/v2/json"
+	"github.com/imulab/go-scim/pkg/v2/prop"
+	"github.com/imulab/go-scim/pkg/v2/spec"
+	"net/http"
+	"net/url"
+)
+
+// Create creates the resource at the endpoint of its resource type, and returns the resource created, as answered by
+// the service provider. The resource is sent with all its assigned attributes, including those that are never
+// returned, such as password (see scimjson.Payload).
+func (c *Client) Create(ctx context.Context, resource *prop.Resource, options ...RequestOption) (*prop.Resource, error) {
+	body, err := scimjson.Serialize(resource, scimjson.Payload())
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.do(ctx, http.MethodPost, resource.ResourceType().Endpoint(), body, options)
+	if err != nil {
+		return nil, err
+	}
+	return c.resourceOf(resource.ResourceType(), resp)
+}
+
+// Get returns the resource of the resource type and id. With IfNoneMatch, ErrNotModified is returned if the resource
+// is of the version given.
+func (c *Client) Get(ctx context.Context, resourceType *spec.ResourceType, id string, options ...RequestOption) (*prop.Resource, error) {
+	resp, err := c.do(ctx, http.MethodGet, location(resourceType, id), nil, options)
+	if err != nil {
+		return nil, err
+	}
+	if resp.status == http.StatusNotModified {
+		return nil, ErrNotModified
+	}
+	return c.resourceOf(resourceType, resp)
+}
+
+// Replace replaces the resource of the id of the resource with the resource, and returns the replaced resource, as
+// answered by the service provider; or nil if the service provider answered that nothing changed, with status 204.
+// When the resource has a version, i.e. it was read from the service provider, the replacement is sent with an
+// If-Match header of it, so that it fails with an error of spec.ErrConflict if the resource was modified since; use
+// IfMatch to send another version, or "*" to replace it regardless. An error of spec.ErrInvalidValue is returned if
+// the resource has no id.
+func (c *Client) Replace(ctx context.Context, resource *prop.Resource, options ...RequestOption) (*prop.Resource, error) {
+	id := resource.IdOrEmpty()
+	if len(id) == 0 {
+		return nil, fmt.Errorf("%w: resource to replace has no id", spec.ErrInvalidValue)
+	}
+
+	body, err := scimjson.Serialize(resource, scimjson.Payload())
+	if err != nil {
+		return nil, err
+	}
+
+	if version := resource.MetaVersionOrEmpty(); len(version) > 0 {
+		options = append([]RequestOption{IfMatch(version)}, options...)
+	}
+	resp, err := c.do(ctx, http.MethodPut, location(resource.ResourceType(), id), body, options)
+	if err != nil {
+		return nil, err
+	}
+	if resp.status == http.StatusNoContent {
+		return nil, nil
+	}
+	return c.resourceOf(resource.ResourceType(), resp)
+}
+
+// Patch modifies the resource of the resource type and id with the patch operations, and returns the patched resource,
+// as answered by the service provider; or nil if the service provider answered with status 204, i.e. when nothing
+// changed. Use IfMatch to only patch the resource if it is of a version.
+func (c *Client) Patch(ctx context.Context, resourceType *spec.ResourceType, id string, operations []*PatchOperation, options ...RequestOption) (*prop.Resource, error) {
+	body, err := patchPayload(operations)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.do(ctx, http.MethodPatch, location(resourceType, id), body, options)
+	if err != nil {
+		return nil, err
+	}
+	if resp.status == http.StatusNoContent || len(resp.body) == 0 {
+		return nil, nil
+	}
+	return c.resourceOf(resourceType, resp)
+}
+
+// Delete deletes the resource of the resource type and id. Use IfMatch to only delete the resource if it is of a
+// version.
+func (c *Client) Delete(ctx context.Context, resourceType *spec.ResourceType, id string, options ...RequestOption) error {
+	_, err := c.do(ctx, http.MethodDelete, location(resourceType, id), nil, options)
+	return err
+}
+
+// Returns the resource of the resource type in the body of the response. When the resource has no version, the version
+// is that of the ETag header, if any, so that it can be sent back with the requests that follow.
+func (c *Client) resourceOf(resourceType *spec.ResourceType, resp *response) (*prop.Resource, error) {
+	resource, err := decodeResource(resourceType, resp.body)
+	if err != nil {
+		return nil, err
+	}
+
+	if etag := resp.header.Get("ETag"); len(etag) > 0 && len(resource.MetaVersionOrEmpty()) == 0 {
+		if err := resource.Navigator().Dot("meta").Dot("version").Replace(etag).Error(); err != nil {
+			return nil, err
+		}
+	}
+	return resource, nil
+}
+
+// Returns the resource of the resource type decoded from the raw JSON. An error of spec.ErrInvalidSyntax is returned if
+// the JSON is not a resource the resource type describes, i.e. because it has attributes unknown to the client.
+func decodeResource(resourceType *spec.ResourceType, raw []byte) (*prop.Resource, error) {
+	resource := prop.NewResource(resourceType)
+	if err := scimjson.Deserialize(raw, resource); err != nil {
+		return nil, fmt.Errorf("%w: failed to decode response resource of type '%s': %s", spec.ErrInvalidSyntax, resourceType.ID(), err.Error())
+	}
+	return resource, nil
+}
+
+// Returns the escaped path of the resource of the resource type and id, relative to the base URL.
+func location(resourceType *spec.ResourceType, id string) string {
+	return resourceType.Endpoint() + "/" + url.PathEscape(id)
+}
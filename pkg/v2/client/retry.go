@@ -0,0 +1,110 @@
+package client
+
+import (
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Retry tunes the retries of the requests of the client. Zero values use the defaults.
+//
+// Requests are retried when the service provider answers with status 429 (too many requests) or 503 (service
+// unavailable), which it does without processing them, whatever their method. The other transient failures, that is
+// errors of the transport, i.e. the connection being reset, and responses of status 502 and 504 from a gateway, may
+// occur once the request has been processed, hence only idempotent requests are retried upon them: GET, PUT and DELETE
+// requests, POST requests to a .search endpoint, and POST requests with an IdempotencyKey, which the service provider
+// deduplicates. Creations without a key, patches, which may add values more than once, and bulk requests are not.
+// Note that a retried replacement or deletion that was processed already may fail with spec.ErrConflict, because of its
+// If-Match, or spec.ErrNotFound, respectively.
+type Retry struct {
+	// Attempts is the maximum number of attempts of a request, including the first one. Defaults to 3.
+	Attempts int
+	// Backoff is the maximum delay before the second attempt, doubled for every attempt after. The actual delay is
+	// random up to the maximum, so that clients failing at once do not retry at once. Defaults to 100 milliseconds.
+	Backoff time.Duration
+	// MaxDelay is the maximum delay before any attempt. The delay given by the Retry-After header of responses of
+	// status 429 or 503 is honored instead of the backoff, unless it exceeds MaxDelay, in which case the request is not
+	// retried, and the error is returned right away. Defaults to 30 seconds.
+	MaxDelay time.Duration
+}
+
+func (r Retry) withDefaults() Retry {
+	if r.Attempts < 1 {
+		r.Attempts = 3
+	}
+	if r.Backoff <= 0 {
+		r.Backoff = 100 * time.Millisecond
+	}
+	if r.MaxDelay <= 0 {
+		r.MaxDelay = 30 * time.Second
+	}
+	return r
+}
+
+// Returns the delay before retrying the request that failed as the attempt, with the response, or without one upon
+// errors of the transport, and true; or false if the request shall not be retried.
+func (r Retry) delay(req *http.Request, resp *response, attempt int, backoff time.Duration) (time.Duration, bool) {
+	if attempt >= r.Attempts || req.Context().Err() != nil {
+		return 0, false
+	}
+
+	if resp == nil {
+		return r.jitter(backoff), idempotent(req)
+	}
+
+	switch resp.status {
+	case http.StatusTooManyRequests, http.StatusServiceUnavailable:
+		if delay, ok := retryAfter(resp.header.Get("Retry-After")); ok {
+			return delay, delay <= r.MaxDelay
+		}
+		return r.jitter(backoff), true
+	case http.StatusBadGateway, http.StatusGatewayTimeout:
+		return r.jitter(backoff), idempotent(req)
+	default:
+		return 0, false
+	}
+}
+
+// Returns a random delay up to the backoff, capped to MaxDelay.
+func (r Retry) jitter(backoff time.Duration) time.Duration {
+	if backoff > r.MaxDelay {
+		backoff = r.MaxDelay
+	}
+	return time.Duration(rand.Int63n(int64(backoff)) + 1)
+}
+
+// Returns true if the request may be sent more than once with the same effect as once.
+func idempotent(req *http.Request) bool {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodPut, http.MethodDelete:
+		return true
+	case http.MethodPost:
+		return strings.HasSuffix(req.URL.Path, "/.search") || len(req.Header.Get("Idempotency-Key")) > 0
+	default:
+		return false
+	}
+}
+
+// Returns the delay of the Retry-After header, in seconds or as a HTTP date, and true; or false if there is no valid
+// header. Dates in the past are no delay.
+func retryAfter(header string) (time.Duration, bool) {
+	header = strings.TrimSpace(header)
+	if len(header) == 0 {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(header); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+	if date, err := http.ParseTime(header); err == nil {
+		if delay := time.Until(date); delay > 0 {
+			return delay, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
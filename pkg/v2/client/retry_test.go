@@ -0,0 +1,300 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"github.com/imulab/go-scim/pkg/v2/spec"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func (s *ClientTestSuite) TestRetry() {
+	t := s.T()
+	tests := []struct {
+		name     string
+		failures int
+		fail     func(rw http.ResponseWriter, r *http.Request)
+		call     func(c *Client) error
+		expect   func(t *testing.T, attempts int32, err error)
+	}{
+		{
+			name:     "too many requests is retried for any method",
+			failures: 2,
+			fail: func(rw http.ResponseWriter, r *http.Request) {
+				rw.Header().Set("Retry-After", "0")
+				rw.WriteHeader(http.StatusTooManyRequests)
+			},
+			call: func(c *Client) error {
+				_, err := c.PatchUser(context.TODO(), "foo", []*PatchOperation{Replace("displayName", "Foo")})
+				return err
+			},
+			expect: func(t *testing.T, attempts int32, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, int32(3), attempts)
+			},
+		},
+		{
+			name:     "unavailable is retried until the attempts are exhausted",
+			failures: 5,
+			fail: func(rw http.ResponseWriter, r *http.Request) {
+				rw.WriteHeader(http.StatusServiceUnavailable)
+			},
+			call: func(c *Client) error {
+				_, err := c.GetUser(context.TODO(), "foo")
+				return err
+			},
+			expect: func(t *testing.T, attempts int32, err error) {
+				assert.NotNil(t, err)
+				assert.Equal(t, int32(3), attempts)
+				var scimErr *spec.Error
+				require.True(t, errors.As(err, &scimErr))
+				assert.Equal(t, http.StatusServiceUnavailable, scimErr.Status)
+			},
+		},
+		{
+			name:     "retry after beyond the maximum delay is not waited for",
+			failures: 1,
+			fail: func(rw http.ResponseWriter, r *http.Request) {
+				rw.Header().Set("Retry-After", "3600")
+				rw.WriteHeader(http.StatusTooManyRequests)
+			},
+			call: func(c *Client) error {
+				_, err := c.GetUser(context.TODO(), "foo")
+				return err
+			},
+			expect: func(t *testing.T, attempts int32, err error) {
+				assert.NotNil(t, err)
+				assert.Equal(t, int32(1), attempts)
+			},
+		},
+		{
+			name:     "gateway timeout is retried for idempotent requests",
+			failures: 1,
+			fail: func(rw http.ResponseWriter, r *http.Request) {
+				rw.WriteHeader(http.StatusGatewayTimeout)
+			},
+			call: func(c *Client) error {
+				return c.DeleteUser(context.TODO(), "foo")
+			},
+			expect: func(t *testing.T, attempts int32, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, int32(2), attempts)
+			},
+		},
+		{
+			name:     "gateway timeout is not retried for patches",
+			failures: 1,
+			fail: func(rw http.ResponseWriter, r *http.Request) {
+				rw.WriteHeader(http.StatusGatewayTimeout)
+			},
+			call: func(c *Client) error {
+				_, err := c.PatchUser(context.TODO(), "foo", []*PatchOperation{Replace("displayName", "Foo")})
+				return err
+			},
+			expect: func(t *testing.T, attempts int32, err error) {
+				assert.NotNil(t, err)
+				assert.Equal(t, int32(1), attempts)
+			},
+		},
+		{
+			name:     "transport error is retried for creations with idempotency key",
+			failures: 1,
+			fail:     hangUp,
+			call: func(c *Client) error {
+				user, err := c.NewUser(map[string]interface{}{"userName": "foo"})
+				require.Nil(t, err)
+				_, err = c.CreateUser(context.TODO(), user, IdempotencyKey("c59c72e1"))
+				return err
+			},
+			expect: func(t *testing.T, attempts int32, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, int32(2), attempts)
+			},
+		},
+		{
+			name:     "transport error is not retried for creations without idempotency key",
+			failures: 1,
+			fail:     hangUp,
+			call: func(c *Client) error {
+				user, err := c.NewUser(map[string]interface{}{"userName": "foo"})
+				require.Nil(t, err)
+				_, err = c.CreateUser(context.TODO(), user)
+				return err
+			},
+			expect: func(t *testing.T, attempts int32, err error) {
+				assert.True(t, errors.Is(err, spec.ErrInternal))
+				assert.Equal(t, int32(1), attempts)
+			},
+		},
+		{
+			name:     "client errors are not retried",
+			failures: 1,
+			fail: func(rw http.ResponseWriter, r *http.Request) {
+				rw.WriteHeader(http.StatusNotFound)
+			},
+			call: func(c *Client) error {
+				_, err := c.GetUser(context.TODO(), "foo")
+				return err
+			},
+			expect: func(t *testing.T, attempts int32, err error) {
+				assert.True(t, errors.Is(err, spec.ErrNotFound))
+				assert.Equal(t, int32(1), attempts)
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var attempts int32
+			server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+				if int(atomic.AddInt32(&attempts, 1)) <= test.failures {
+					test.fail(rw, r)
+					return
+				}
+				if r.Method == http.MethodDelete {
+					rw.WriteHeader(http.StatusNoContent)
+					return
+				}
+				rw.Header().Set("Content-Type", spec.ApplicationScimJson)
+				_, _ = rw.Write([]byte(`{"schemas": ["urn:ietf:params:scim:schemas:core:2.0:User"], "id": "foo", "userName": "foo"}`))
+			}))
+			defer server.Close()
+
+			c, err := New(Options{
+				BaseURL:       server.URL,
+				ResourceTypes: []*spec.ResourceType{s.userType},
+				Retry:         &Retry{Backoff: time.Millisecond, MaxDelay: time.Second},
+			})
+			require.Nil(t, err)
+
+			err = test.call(c)
+			test.expect(t, atomic.LoadInt32(&attempts), err)
+		})
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	retry := Retry{Attempts: 3, Backoff: time.Second, MaxDelay: 10 * time.Second}
+	get := httptest.NewRequest(http.MethodGet, "/Users/foo", nil)
+	post := httptest.NewRequest(http.MethodPost, "/Users", nil)
+	search := httptest.NewRequest(http.MethodPost, "/Users/.search", nil)
+	withStatus := func(status int, retryAfter string) *response {
+		resp := &response{status: status, header: http.Header{}}
+		if len(retryAfter) > 0 {
+			resp.header.Set("Retry-After", retryAfter)
+		}
+		return resp
+	}
+
+	tests := []struct {
+		name    string
+		req     *http.Request
+		resp    *response
+		attempt int
+		backoff time.Duration
+		expect  func(t *testing.T, delay time.Duration, ok bool)
+	}{
+		{
+			name:    "retry after in seconds",
+			req:     post,
+			resp:    withStatus(http.StatusTooManyRequests, "7"),
+			attempt: 1,
+			backoff: time.Second,
+			expect: func(t *testing.T, delay time.Duration, ok bool) {
+				assert.True(t, ok)
+				assert.Equal(t, 7*time.Second, delay)
+			},
+		},
+		{
+			name:    "retry after as date",
+			req:     get,
+			resp:    withStatus(http.StatusServiceUnavailable, time.Now().Add(5*time.Second).UTC().Format(http.TimeFormat)),
+			attempt: 1,
+			backoff: time.Second,
+			expect: func(t *testing.T, delay time.Duration, ok bool) {
+				assert.True(t, ok)
+				assert.True(t, delay > 3*time.Second && delay <= 5*time.Second, delay.String())
+			},
+		},
+		{
+			name:    "jittered backoff without retry after",
+			req:     get,
+			resp:    withStatus(http.StatusServiceUnavailable, ""),
+			attempt: 2,
+			backoff: 2 * time.Second,
+			expect: func(t *testing.T, delay time.Duration, ok bool) {
+				assert.True(t, ok)
+				assert.True(t, delay > 0 && delay <= 2*time.Second, delay.String())
+			},
+		},
+		{
+			name:    "backoff capped to the maximum delay",
+			req:     get,
+			resp:    withStatus(http.StatusBadGateway, ""),
+			attempt: 2,
+			backoff: time.Minute,
+			expect: func(t *testing.T, delay time.Duration, ok bool) {
+				assert.True(t, ok)
+				assert.True(t, delay <= 10*time.Second, delay.String())
+			},
+		},
+		{
+			name:    "transport error of search",
+			req:     search,
+			attempt: 1,
+			backoff: time.Second,
+			expect: func(t *testing.T, delay time.Duration, ok bool) {
+				assert.True(t, ok)
+			},
+		},
+		{
+			name:    "transport error of creation",
+			req:     post,
+			attempt: 1,
+			backoff: time.Second,
+			expect: func(t *testing.T, delay time.Duration, ok bool) {
+				assert.False(t, ok)
+			},
+		},
+		{
+			name:    "attempts exhausted",
+			req:     get,
+			resp:    withStatus(http.StatusTooManyRequests, "1"),
+			attempt: 3,
+			backoff: time.Second,
+			expect: func(t *testing.T, delay time.Duration, ok bool) {
+				assert.False(t, ok)
+			},
+		},
+		{
+			name:    "internal error",
+			req:     get,
+			resp:    withStatus(http.StatusInternalServerError, ""),
+			attempt: 1,
+			backoff: time.Second,
+			expect: func(t *testing.T, delay time.Duration, ok bool) {
+				assert.False(t, ok)
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			delay, ok := retry.delay(test.req, test.resp, test.attempt, test.backoff)
+			test.expect(t, delay, ok)
+		})
+	}
+}
+
+// Closes the connection without response.
+func hangUp(rw http.ResponseWriter, _ *http.Request) {
+	conn, _, err := rw.(http.Hijacker).Hijack()
+	if err == nil {
+		_ = conn.Close()
+	}
+}
@@ -0,0 +1,141 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"github.com/imulab/go-scim/pkg/v2/prop"
+	"github.com/imulab/go-scim/pkg/v2/spec"
+)
+
+const (
+	// ID of the resource type of users, whose methods are those of the User suffix
+	UserResourceType = "User"
+	// ID of the resource type of groups, whose methods are those of the Group suffix
+	GroupResourceType = "Group"
+)
+
+// NewUser returns a new user assigned with the data, like NewResource does.
+func (c *Client) NewUser(data map[string]interface{}) (*prop.Resource, error) {
+	return c.NewResource(UserResourceType, data)
+}
+
+// CreateUser creates the user, like Create does. An error of spec.ErrInvalidValue is returned if the resource is not a
+// user.
+func (c *Client) CreateUser(ctx context.Context, user *prop.Resource, options ...RequestOption) (*prop.Resource, error) {
+	if err := expect(UserResourceType, user); err != nil {
+		return nil, err
+	}
+	return c.Create(ctx, user, options...)
+}
+
+// GetUser returns the user of the id, like Get does.
+func (c *Client) GetUser(ctx context.Context, id string, options ...RequestOption) (*prop.Resource, error) {
+	resourceType, err := c.ResourceType(UserResourceType)
+	if err != nil {
+		return nil, err
+	}
+	return c.Get(ctx, resourceType, id, options...)
+}
+
+// ReplaceUser replaces the user, like Replace does. An error of spec.ErrInvalidValue is returned if the resource is not
+// a user.
+func (c *Client) ReplaceUser(ctx context.Context, user *prop.Resource, options ...RequestOption) (*prop.Resource, error) {
+	if err := expect(UserResourceType, user); err != nil {
+		return nil, err
+	}
+	return c.Replace(ctx, user, options...)
+}
+
+// PatchUser patches the user of the id, like Patch does.
+func (c *Client) PatchUser(ctx context.Context, id string, operations []*PatchOperation, options ...RequestOption) (*prop.Resource, error) {
+	resourceType, err := c.ResourceType(UserResourceType)
+	if err != nil {
+		return nil, err
+	}
+	return c.Patch(ctx, resourceType, id, operations, options...)
+}
+
+// DeleteUser deletes the user of the id, like Delete does.
+func (c *Client) DeleteUser(ctx context.Context, id string, options ...RequestOption) error {
+	resourceType, err := c.ResourceType(UserResourceType)
+	if err != nil {
+		return err
+	}
+	return c.Delete(ctx, resourceType, id, options...)
+}
+
+// QueryUsers returns an Iterator over the users matching the query, like Query does.
+func (c *Client) QueryUsers(query *Query, options ...RequestOption) (*Iterator, error) {
+	resourceType, err := c.ResourceType(UserResourceType)
+	if err != nil {
+		return nil, err
+	}
+	return c.Query(resourceType, query, options...), nil
+}
+
+// NewGroup returns a new group assigned with the data, like NewResource does.
+func (c *Client) NewGroup(data map[string]interface{}) (*prop.Resource, error) {
+	return c.NewResource(GroupResourceType, data)
+}
+
+// CreateGroup creates the group, like Create does. An error of spec.ErrInvalidValue is returned if the resource is not
+// a group.
+func (c *Client) CreateGroup(ctx context.Context, group *prop.Resource, options ...RequestOption) (*prop.Resource, error) {
+	if err := expect(GroupResourceType, group); err != nil {
+		return nil, err
+	}
+	return c.Create(ctx, group, options...)
+}
+
+// GetGroup returns the group of the id, like Get does.
+func (c *Client) GetGroup(ctx context.Context, id string, options ...RequestOption) (*prop.Resource, error) {
+	resourceType, err := c.ResourceType(GroupResourceType)
+	if err != nil {
+		return nil, err
+	}
+	return c.Get(ctx, resourceType, id, options...)
+}
+
+// ReplaceGroup replaces the group, like Replace does. An error of spec.ErrInvalidValue is returned if the resource is
+// not a group.
+func (c *Client) ReplaceGroup(ctx context.Context, group *prop.Resource, options ...RequestOption) (*prop.Resource, error) {
+	if err := expect(GroupResourceType, group); err != nil {
+		return nil, err
+	}
+	return c.Replace(ctx, group, options...)
+}
+
+// PatchGroup patches the group of the id, like Patch does, i.e. to add members with Add("members", ...).
+func (c *Client) PatchGroup(ctx context.Context, id string, operations []*PatchOperation, options ...RequestOption) (*prop.Resource, error) {
+	resourceType, err := c.ResourceType(GroupResourceType)
+	if err != nil {
+		return nil, err
+	}
+	return c.Patch(ctx, resourceType, id, operations, options...)
+}
+
+// DeleteGroup deletes the group of the id, like Delete does.
+func (c *Client) DeleteGroup(ctx context.Context, id string, options ...RequestOption) error {
+	resourceType, err := c.ResourceType(GroupResourceType)
+	if err != nil {
+		return err
+	}
+	return c.Delete(ctx, resourceType, id, options...)
+}
+
+// QueryGroups returns an Iterator over the groups matching the query, like Query does.
+func (c *Client) QueryGroups(query *Query, options ...RequestOption) (*Iterator, error) {
+	resourceType, err := c.ResourceType(GroupResourceType)
+	if err != nil {
+		return nil, err
+	}
+	return c.Query(resourceType, query, options...), nil
+}
+
+// Returns an error of spec.ErrInvalidValue if the resource is not of the resource type of the id.
+func expect(resourceType string, resource *prop.Resource) error {
+	if resource.ResourceType().ID() != resourceType {
+		return fmt.Errorf("%w: expect resource of type '%s', got '%s'", spec.ErrInvalidValue, resourceType, resource.ResourceType().ID())
+	}
+	return nil
+}
@@ -0,0 +1,270 @@
+package consistency
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/imulab/go-scim/pkg/v2/db"
+	"github.com/imulab/go-scim/pkg/v2/groupsync"
+	"github.com/imulab/go-scim/pkg/v2/prop"
+	"github.com/imulab/go-scim/pkg/v2/service/filter"
+	"github.com/imulab/go-scim/pkg/v2/spec"
+	"sort"
+	"strings"
+)
+
+const (
+	// DefaultPageSize is the number of resources queried at once by Check, unless set by Options.
+	DefaultPageSize = 100
+	// DefaultProgressInterval is the number of resources between reports of progress, unless set by Options.
+	DefaultProgressInterval = 1000
+)
+
+// Kinds of Discrepancy.
+const (
+	KindInvalid = "invalid" // the resource fails the filters
+	KindGroups  = "groups"  // the "groups" of the user differ from the memberships of the groups
+)
+
+// Discrepancy of a stored resource, as reported by Check.
+type Discrepancy struct {
+	ID       string // id of the resource
+	Kind     string // KindInvalid or KindGroups
+	Err      error  // error of the filters, or describing the difference of the "groups"
+	Repaired bool   // whether the resource was replaced with its repaired version
+}
+
+// Summary of a check, as returned by Check and reported to the Progress function of the options.
+type Summary struct {
+	Checked   int      // number of resources checked
+	Invalid   int      // number of resources that failed the filters
+	Drifted   int      // number of users whose "groups" were out of sync
+	Repaired  int      // number of users whose "groups" were repaired
+	Reindexed []string // paths of the indexes rebuilt
+}
+
+// Options are the options of Check.
+type Options struct {
+	// Filters are the filters every resource is re-validated with, i.e. the filter.ValidationFilter bridged by
+	// filter.ByPropertyToByResourceCollectingErrors, so that all violations of a resource are reported at once. The
+	// filters are applied to a copy of the resource, and errors of clients (i.e. of a spec.Error of status 4xx) are
+	// reported as KindInvalid, while other errors abort the check.
+	Filters []filter.ByResource
+	// Groups, if not nil, recomputes the "groups" of every resource, which shall be a User, from the memberships of the
+	// groups, and reports the users whose stored "groups" differ as KindGroups. Since the groups of every user are
+	// searched, including the nested ones, this is the most expensive part of the check.
+	Groups *groupsync.SyncService
+	// Repair replaces the users whose "groups" differ with the recomputed "groups", after their meta is updated with
+	// the Meta filter. Users that are modified concurrently are only reported, as they are synchronized by the writer.
+	Repair bool
+	// Meta is the filter that updates the meta of the repaired users, or filter.MetaFilter when nil.
+	Meta filter.ByResource
+	// Reindex drops and creates again every secondary index of the database before the resources are walked, if it is
+	// a db.IndexedDB (see Reindex).
+	Reindex bool
+	// PageSize is the number of resources queried from the database at once, or DefaultPageSize when not positive.
+	PageSize int
+	// Report, if not nil, is called with every discrepancy found, in the order of the resources walked.
+	Report func(d Discrepancy)
+	// Progress, if not nil, is called every ProgressInterval resources checked, and once when the check is done.
+	Progress func(s Summary)
+	// ProgressInterval is the number of resources between calls of Progress, or DefaultProgressInterval when not
+	// positive.
+	ProgressInterval int
+}
+
+// Check walks all resources of the database (see db.Walk), checks them according to the options, reporting every
+// discrepancy to the Report function, and returns the summary of the check, which is complete unless there is an
+// error. Discrepancies do not stop the check; an error is only returned if the check cannot go on, i.e. when the
+// database fails, or when the context is done.
+//
+// Resources that cannot be read with the current schemas at all, i.e. because the type of a stored value no longer
+// matches its attribute, fail the queries of the walk, and hence the check, with the error of the database.
+func Check(ctx context.Context, database db.DB, options Options) (Summary, error) {
+	c := &checker{Options: options, database: database}
+	if c.Meta == nil {
+		c.Meta = filter.MetaFilter()
+	}
+	if c.PageSize <= 0 {
+		c.PageSize = DefaultPageSize
+	}
+	if c.ProgressInterval <= 0 {
+		c.ProgressInterval = DefaultProgressInterval
+	}
+
+	if c.Reindex {
+		reindexed, err := Reindex(database)
+		if err != nil {
+			return c.summary, err
+		}
+		c.summary.Reindexed = reindexed
+	}
+
+	if err := db.Walk(ctx, database, "", c.PageSize, func(ctx context.Context, page []*prop.Resource) error {
+		for _, resource := range page {
+			if err := c.check(ctx, resource); err != nil {
+				return err
+			}
+		}
+		return nil
+	}); err != nil {
+		return c.summary, err
+	}
+
+	if c.Progress != nil {
+		c.Progress(c.summary)
+	}
+	return c.summary, nil
+}
+
+// Reindex drops and creates again every secondary index of the database, if it is a db.IndexedDB, so that indexes
+// built with a former definition of their attributes, i.e. before an attribute became caseExact, are built again from
+// the stored resources, and returns the paths of the indexes. Databases that are not db.IndexedDB maintain their
+// indexes themselves, or have them created with their schema; nothing is done for them.
+func Reindex(database db.DB) ([]string, error) {
+	indexedDB, ok := database.(db.IndexedDB)
+	if !ok {
+		return nil, nil
+	}
+
+	paths := indexedDB.Indexes()
+	for _, path := range paths {
+		if err := indexedDB.DropIndex(path); err != nil {
+			return nil, err
+		}
+		if err := indexedDB.CreateIndex(path); err != nil {
+			return nil, err
+		}
+	}
+	return paths, nil
+}
+
+type checker struct {
+	Options
+	database db.DB
+	summary  Summary
+	last     int // checked when progress was last reported
+}
+
+func (c *checker) check(ctx context.Context, resource *prop.Resource) error {
+	if err := c.validate(ctx, resource); err != nil {
+		return err
+	}
+	if c.Groups != nil {
+		if err := c.syncGroups(ctx, resource); err != nil {
+			return err
+		}
+	}
+
+	c.summary.Checked++
+	if c.Progress != nil && c.summary.Checked-c.last >= c.ProgressInterval {
+		c.last = c.summary.Checked
+		c.Progress(c.summary)
+	}
+	return nil
+}
+
+// Applies the filters to a copy of the resource, and reports the errors of clients as KindInvalid.
+func (c *checker) validate(ctx context.Context, resource *prop.Resource) error {
+	if len(c.Filters) == 0 {
+		return nil
+	}
+
+	copied := resource.Clone()
+	for _, f := range c.Filters {
+		if err := f.Filter(ctx, copied); err != nil {
+			var scimErr *spec.Error
+			if !errors.As(err, &scimErr) || scimErr.Status >= 500 {
+				return err
+			}
+			c.summary.Invalid++
+			c.report(Discrepancy{ID: resource.IdOrEmpty(), Kind: KindInvalid, Err: err})
+			return nil
+		}
+	}
+	return nil
+}
+
+// Recomputes the groups of the user, and reports them as KindGroups if they differ from the stored ones, replacing the
+// user if repairing.
+func (c *checker) syncGroups(ctx context.Context, user *prop.Resource) error {
+	synced := user.Clone()
+	if err := c.Groups.SyncGroupPropertyForUser(ctx, synced); err != nil {
+		return err
+	}
+
+	missing, extra := differenceOfGroups(groupsOf(user), groupsOf(synced))
+	if len(missing) == 0 && len(extra) == 0 {
+		return nil
+	}
+
+	c.summary.Drifted++
+	d := Discrepancy{
+		ID:   user.IdOrEmpty(),
+		Kind: KindGroups,
+		Err: fmt.Errorf("%w: 'groups' is missing [%s] and has extra [%s]", spec.ErrInvalidValue,
+			strings.Join(missing, ", "), strings.Join(extra, ", ")),
+	}
+
+	if c.Repair {
+		if err := c.Meta.FilterRef(ctx, synced, user); err != nil {
+			return err
+		}
+		switch err := c.database.Replace(ctx, user, synced); {
+		case err == nil:
+			c.summary.Repaired++
+			d.Repaired = true
+		case !errors.Is(err, spec.ErrConflict):
+			return err
+		}
+	}
+
+	c.report(d)
+	return nil
+}
+
+func (c *checker) report(d Discrepancy) {
+	if c.Report != nil {
+		c.Report(d)
+	}
+}
+
+// Returns the "groups" of the user as the group id with the type of membership, i.e. "g1 (direct)".
+func groupsOf(user *prop.Resource) map[string]struct{} {
+	groups := map[string]struct{}{}
+	nav := user.Navigator().Dot("groups")
+	if nav.HasError() {
+		return groups
+	}
+	_ = nav.Current().ForEachChild(func(_ int, child prop.Property) error {
+		var value, typ string
+		if p, err := child.ChildAtIndex("value"); err == nil {
+			value, _ = p.Raw().(string)
+		}
+		if p, err := child.ChildAtIndex("type"); err == nil {
+			typ, _ = p.Raw().(string)
+		}
+		if len(value) > 0 {
+			groups[fmt.Sprintf("%s (%s)", value, typ)] = struct{}{}
+		}
+		return nil
+	})
+	return groups
+}
+
+// Returns the sorted groups that are expected but not stored, and those stored but not expected.
+func differenceOfGroups(stored map[string]struct{}, expected map[string]struct{}) (missing []string, extra []string) {
+	for group := range expected {
+		if _, ok := stored[group]; !ok {
+			missing = append(missing, group)
+		}
+	}
+	for group := range stored {
+		if _, ok := expected[group]; !ok {
+			extra = append(extra, group)
+		}
+	}
+	sort.Strings(missing)
+	sort.Strings(extra)
+	return
+}
@@ -0,0 +1,242 @@
+package consistency
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/imulab/go-scim/pkg/v2/crud"
+	"github.com/imulab/go-scim/pkg/v2/db"
+	"github.com/imulab/go-scim/pkg/v2/groupsync"
+	"github.com/imulab/go-scim/pkg/v2/prop"
+	"github.com/imulab/go-scim/pkg/v2/service/filter"
+	"github.com/imulab/go-scim/pkg/v2/spec"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestCheck(t *testing.T) {
+	s := new(CheckTestSuite)
+	suite.Run(t, s)
+}
+
+type CheckTestSuite struct {
+	suite.Suite
+	userResourceType  *spec.ResourceType
+	groupResourceType *spec.ResourceType
+}
+
+func (s *CheckTestSuite) TestValidate() {
+	database := db.Memory()
+	s.insert(database, s.userResourceType, map[string]interface{}{
+		"schemas":  []interface{}{"urn:ietf:params:scim:schemas:core:2.0:User"},
+		"id":       "user001",
+		"userName": "user001",
+		"emails":   []interface{}{map[string]interface{}{"value": "user001@foo.com"}},
+	})
+	// stored before userName and emails were required
+	s.insert(database, s.userResourceType, map[string]interface{}{
+		"schemas": []interface{}{"urn:ietf:params:scim:schemas:core:2.0:User"},
+		"id":      "user002",
+	})
+
+	var discrepancies []Discrepancy
+	summary, err := Check(context.TODO(), database, Options{
+		Filters: []filter.ByResource{
+			filter.ByPropertyToByResourceCollectingErrors(filter.ValidationFilter(database)),
+		},
+		Report: func(d Discrepancy) { discrepancies = append(discrepancies, d) },
+	})
+	require.Nil(s.T(), err)
+	assert.Equal(s.T(), Summary{Checked: 2, Invalid: 1}, summary)
+
+	require.Len(s.T(), discrepancies, 1)
+	assert.Equal(s.T(), "user002", discrepancies[0].ID)
+	assert.Equal(s.T(), KindInvalid, discrepancies[0].Kind)
+	assert.True(s.T(), errors.Is(discrepancies[0].Err, spec.ErrInvalidValue))
+	assert.Contains(s.T(), discrepancies[0].Err.Error(), "'userName' is required")
+	assert.Contains(s.T(), discrepancies[0].Err.Error(), "'emails' is required")
+	assert.False(s.T(), discrepancies[0].Repaired)
+
+	// the stored resource is not modified by the filters
+	stored, err := database.Get(context.TODO(), "user002", nil)
+	require.Nil(s.T(), err)
+	assert.True(s.T(), stored.Navigator().Dot("userName").Current().IsUnassigned())
+}
+
+func (s *CheckTestSuite) TestGroups() {
+	groupDB := db.Memory()
+	s.insert(groupDB, s.groupResourceType, map[string]interface{}{
+		"schemas":     []interface{}{"urn:ietf:params:scim:schemas:core:2.0:Group"},
+		"id":          "g1",
+		"displayName": "g1",
+		"members":     []interface{}{map[string]interface{}{"value": "user001"}},
+	})
+	s.insert(groupDB, s.groupResourceType, map[string]interface{}{
+		"schemas":     []interface{}{"urn:ietf:params:scim:schemas:core:2.0:Group"},
+		"id":          "g2",
+		"displayName": "g2",
+		"members":     []interface{}{map[string]interface{}{"value": "g1"}},
+	})
+
+	tests := []struct {
+		name   string
+		repair bool
+	}{
+		{name: "report"},
+		{name: "repair", repair: true},
+	}
+	for _, test := range tests {
+		s.T().Run(test.name, func(t *testing.T) {
+			userDB := db.Memory()
+			s.insert(userDB, s.userResourceType, map[string]interface{}{
+				"schemas": []interface{}{"urn:ietf:params:scim:schemas:core:2.0:User"},
+				"id":      "user001",
+				"groups":  []interface{}{map[string]interface{}{"value": "g1", "type": "direct"}},
+				"meta":    map[string]interface{}{"version": "v1"},
+			})
+			s.insert(userDB, s.userResourceType, map[string]interface{}{
+				"schemas": []interface{}{"urn:ietf:params:scim:schemas:core:2.0:User"},
+				"id":      "user002",
+				"groups":  []interface{}{map[string]interface{}{"value": "g2", "type": "direct"}},
+				"meta":    map[string]interface{}{"version": "v1"},
+			})
+
+			var discrepancies []Discrepancy
+			summary, err := Check(context.TODO(), userDB, Options{
+				Groups: groupsync.NewSyncService(groupDB),
+				Repair: test.repair,
+				Report: func(d Discrepancy) { discrepancies = append(discrepancies, d) },
+			})
+			require.Nil(t, err)
+
+			expect := Summary{Checked: 2, Drifted: 2}
+			if test.repair {
+				expect.Repaired = 2
+			}
+			assert.Equal(t, expect, summary)
+
+			require.Len(t, discrepancies, 2)
+			assert.Equal(t, "user001", discrepancies[0].ID)
+			assert.Equal(t, KindGroups, discrepancies[0].Kind)
+			assert.Equal(t, "invalidValue: 'groups' is missing [g2 (indirect)] and has extra []", discrepancies[0].Err.Error())
+			assert.Equal(t, test.repair, discrepancies[0].Repaired)
+			assert.Equal(t, "user002", discrepancies[1].ID)
+			assert.Equal(t, "invalidValue: 'groups' is missing [] and has extra [g2 (direct)]", discrepancies[1].Err.Error())
+
+			user, err := userDB.Get(context.TODO(), "user001", nil)
+			require.Nil(t, err)
+			if test.repair {
+				assert.Equal(t, 2, user.Navigator().Dot("groups").Current().CountChildren())
+				assert.NotEqual(t, "v1", user.MetaVersionOrEmpty())
+			} else {
+				assert.Equal(t, 1, user.Navigator().Dot("groups").Current().CountChildren())
+				assert.Equal(t, "v1", user.MetaVersionOrEmpty())
+			}
+		})
+	}
+}
+
+func (s *CheckTestSuite) TestReindex() {
+	database, err := db.MemoryWithIndexes(s.userResourceType, "userName", "emails.value")
+	require.Nil(s.T(), err)
+	s.insert(database, s.userResourceType, map[string]interface{}{
+		"schemas":  []interface{}{"urn:ietf:params:scim:schemas:core:2.0:User"},
+		"id":       "user001",
+		"userName": "user001",
+	})
+
+	var reports []Summary
+	summary, err := Check(context.TODO(), database, Options{
+		Reindex:  true,
+		Progress: func(summary Summary) { reports = append(reports, summary) },
+	})
+	require.Nil(s.T(), err)
+	assert.Equal(s.T(), []string{"emails.value", "userName"}, summary.Reindexed)
+	assert.Equal(s.T(), 1, summary.Checked)
+	assert.Equal(s.T(), []Summary{summary}, reports)
+
+	results, err := database.Query(context.TODO(), `userName eq "USER001"`, nil, nil, nil)
+	require.Nil(s.T(), err)
+	assert.Len(s.T(), results, 1)
+
+	// databases without secondary indexes are not reindexed
+	reindexed, err := Reindex(db.Memory())
+	assert.Nil(s.T(), err)
+	assert.Empty(s.T(), reindexed)
+}
+
+func (s *CheckTestSuite) insert(database db.DB, resourceType *spec.ResourceType, data map[string]interface{}) {
+	r := prop.NewResource(resourceType)
+	require.Nil(s.T(), r.Navigator().Replace(data).Error())
+	require.Nil(s.T(), database.Insert(context.TODO(), r))
+}
+
+func (s *CheckTestSuite) SetupSuite() {
+	for _, each := range []struct {
+		filepath  string
+		structure interface{}
+		post      func(parsed interface{})
+	}{
+		{
+			filepath:  "../../../public/schemas/core_schema.json",
+			structure: new(spec.Schema),
+			post: func(parsed interface{}) {
+				spec.Schemas().Register(parsed.(*spec.Schema))
+			},
+		},
+		{
+			filepath:  "../../../public/schemas/user_schema.json",
+			structure: new(spec.Schema),
+			post: func(parsed interface{}) {
+				spec.Schemas().Register(parsed.(*spec.Schema))
+			},
+		},
+		{
+			filepath:  "../../../public/schemas/user_enterprise_extension_schema.json",
+			structure: new(spec.Schema),
+			post: func(parsed interface{}) {
+				spec.Schemas().Register(parsed.(*spec.Schema))
+			},
+		},
+		{
+			filepath:  "../../../public/schemas/group_schema.json",
+			structure: new(spec.Schema),
+			post: func(parsed interface{}) {
+				spec.Schemas().Register(parsed.(*spec.Schema))
+			},
+		},
+		{
+			filepath:  "../../../public/resource_types/user_resource_type.json",
+			structure: new(spec.ResourceType),
+			post: func(parsed interface{}) {
+				s.userResourceType = parsed.(*spec.ResourceType)
+				crud.Register(s.userResourceType)
+			},
+		},
+		{
+			filepath:  "../../../public/resource_types/group_resource_type.json",
+			structure: new(spec.ResourceType),
+			post: func(parsed interface{}) {
+				s.groupResourceType = parsed.(*spec.ResourceType)
+				crud.Register(s.groupResourceType)
+			},
+		},
+	} {
+		f, err := os.Open(each.filepath)
+		require.Nil(s.T(), err)
+
+		raw, err := ioutil.ReadAll(f)
+		require.Nil(s.T(), err)
+
+		err = json.Unmarshal(raw, each.structure)
+		require.Nil(s.T(), err)
+
+		if each.post != nil {
+			each.post(each.structure)
+		}
+	}
+}
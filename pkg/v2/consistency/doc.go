@@ -0,0 +1,9 @@
+// This package checks the resources stored in a database for consistency with the current state of the server, i.e.
+// after the schemas were changed, or after resources were written to the database directly, bypassing the services.
+//
+// Check walks all resources of a database, re-validates them with the filters the services would apply (usually the
+// filter.ValidationFilter), recomputes the "groups" of User resources from the memberships of the groups (see
+// groupsync.SyncService), and reports every discrepancy found. It can also rebuild the secondary indexes of the
+// database, and repair the "groups" that are out of sync. Invalid resources are only reported, since fixing them
+// requires a decision that only an administrator can make.
+package consistency
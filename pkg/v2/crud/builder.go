@@ -0,0 +1,239 @@
+package crud
+
+import (
+	"fmt"
+	"github.com/imulab/go-scim/pkg/v2/crud/expr"
+	"github.com/imulab/go-scim/pkg/v2/spec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Filter returns a new FilterBuilder to build SCIM filters programmatically, so that callers do not need to concatenate
+// filter strings and escape values by hand. For instance:
+//
+//	crud.Filter().Eq("userName", name).And(crud.Filter().Pr("emails").Or(crud.Filter().Eq("active", true)))
+//
+// builds the filter:
+//
+//	(userName eq "imulab") and ((emails pr) or (active eq true))
+//
+// Calling a relational method (i.e. Eq, Sw) on a builder that already holds a filter combines the two using "and".
+// Values are rendered according to their Go type: strings and []byte are quoted and escaped, time.Time is formatted as
+// a quoted ISO8601 dateTime, booleans and numbers are rendered as they are. Any other type results in an error of
+// spec.ErrInvalidFilter when the filter is built.
+func Filter() *FilterBuilder {
+	return &FilterBuilder{}
+}
+
+// FilterBuilder builds SCIM filters. See Filter.
+type FilterBuilder struct {
+	filter string
+	err    error
+}
+
+// Eq adds the predicate "path eq value".
+func (b *FilterBuilder) Eq(path string, value interface{}) *FilterBuilder {
+	return b.relational(path, expr.Eq, value)
+}
+
+// Ne adds the predicate "path ne value".
+func (b *FilterBuilder) Ne(path string, value interface{}) *FilterBuilder {
+	return b.relational(path, expr.Ne, value)
+}
+
+// Sw adds the predicate "path sw value".
+func (b *FilterBuilder) Sw(path string, value interface{}) *FilterBuilder {
+	return b.relational(path, expr.Sw, value)
+}
+
+// Ew adds the predicate "path ew value".
+func (b *FilterBuilder) Ew(path string, value interface{}) *FilterBuilder {
+	return b.relational(path, expr.Ew, value)
+}
+
+// Co adds the predicate "path co value".
+func (b *FilterBuilder) Co(path string, value interface{}) *FilterBuilder {
+	return b.relational(path, expr.Co, value)
+}
+
+// Re adds the predicate "path re pattern". The non-standard regex operator must be enabled by
+// expr.EnableRegexOperator for the filter to compile.
+func (b *FilterBuilder) Re(path string, pattern string) *FilterBuilder {
+	return b.relational(path, expr.Re, pattern)
+}
+
+// Gt adds the predicate "path gt value".
+func (b *FilterBuilder) Gt(path string, value interface{}) *FilterBuilder {
+	return b.relational(path, expr.Gt, value)
+}
+
+// Ge adds the predicate "path ge value".
+func (b *FilterBuilder) Ge(path string, value interface{}) *FilterBuilder {
+	return b.relational(path, expr.Ge, value)
+}
+
+// Lt adds the predicate "path lt value".
+func (b *FilterBuilder) Lt(path string, value interface{}) *FilterBuilder {
+	return b.relational(path, expr.Lt, value)
+}
+
+// Le adds the predicate "path le value".
+func (b *FilterBuilder) Le(path string, value interface{}) *FilterBuilder {
+	return b.relational(path, expr.Le, value)
+}
+
+// Pr adds the predicate "path pr".
+func (b *FilterBuilder) Pr(path string) *FilterBuilder {
+	if err := b.checkPath(path); err != nil {
+		return b.fail(err)
+	}
+	return b.and(path + " " + expr.Pr)
+}
+
+// And combines the current filter with the other filters using "and".
+func (b *FilterBuilder) And(others ...*FilterBuilder) *FilterBuilder {
+	return b.logical(expr.And, others)
+}
+
+// Or combines the current filter with the other filters using "or".
+func (b *FilterBuilder) Or(others ...*FilterBuilder) *FilterBuilder {
+	return b.logical(expr.Or, others)
+}
+
+// Not negates the current filter.
+func (b *FilterBuilder) Not() *FilterBuilder {
+	if b.err != nil {
+		return b
+	}
+	if len(b.filter) == 0 {
+		return b.fail(fmt.Errorf("%w: nothing to negate", spec.ErrInvalidFilter))
+	}
+	b.filter = expr.Not + " (" + b.filter + ")"
+	return b
+}
+
+// String returns the filter built so far. It returns an empty string if any error has occurred.
+func (b *FilterBuilder) String() string {
+	if b.err != nil {
+		return ""
+	}
+	return b.filter
+}
+
+// Build compiles the filter and returns its abstract syntax tree along with its string form, or any error occurred
+// during the building process.
+func (b *FilterBuilder) Build() (*expr.Expression, string, error) {
+	if b.err != nil {
+		return nil, "", b.err
+	}
+	if len(b.filter) == 0 {
+		return nil, "", fmt.Errorf("%w: empty filter", spec.ErrInvalidFilter)
+	}
+	root, err := expr.CompileFilter(b.filter)
+	if err != nil {
+		return nil, "", err
+	}
+	return root, b.filter, nil
+}
+
+// BuildFor is Build, but also validates the filter against the resource type using ValidateFilter.
+func (b *FilterBuilder) BuildFor(resourceType *spec.ResourceType) (*expr.Expression, string, error) {
+	root, filter, err := b.Build()
+	if err != nil {
+		return nil, "", err
+	}
+	if err := ValidateFilter(root, resourceType); err != nil {
+		return nil, "", err
+	}
+	return root, filter, nil
+}
+
+func (b *FilterBuilder) relational(path string, op string, value interface{}) *FilterBuilder {
+	if err := b.checkPath(path); err != nil {
+		return b.fail(err)
+	}
+	literal, err := formatFilterValue(value)
+	if err != nil {
+		return b.fail(err)
+	}
+	return b.and(path + " " + op + " " + literal)
+}
+
+func (b *FilterBuilder) logical(op string, others []*FilterBuilder) *FilterBuilder {
+	if b.err != nil {
+		return b
+	}
+	for _, other := range others {
+		if other == nil {
+			continue
+		}
+		if other.err != nil {
+			return b.fail(other.err)
+		}
+		if len(other.filter) == 0 {
+			continue
+		}
+		if len(b.filter) == 0 {
+			b.filter = other.filter
+		} else {
+			b.filter = "(" + b.filter + ") " + op + " (" + other.filter + ")"
+		}
+	}
+	return b
+}
+
+func (b *FilterBuilder) and(predicate string) *FilterBuilder {
+	if b.err != nil {
+		return b
+	}
+	if len(b.filter) == 0 {
+		b.filter = predicate
+	} else {
+		b.filter = "(" + b.filter + ") " + expr.And + " (" + predicate + ")"
+	}
+	return b
+}
+
+func (b *FilterBuilder) fail(err error) *FilterBuilder {
+	if b.err == nil {
+		b.err = err
+	}
+	return b
+}
+
+func (b *FilterBuilder) checkPath(path string) error {
+	if len(path) == 0 {
+		return fmt.Errorf("%w: empty path in filter", spec.ErrInvalidFilter)
+	}
+	if strings.ContainsAny(path, " ()[]\"") {
+		return fmt.Errorf("%w: invalid path '%s' in filter", spec.ErrInvalidFilter, path)
+	}
+	return nil
+}
+
+// Render the value as a filter literal.
+func formatFilterValue(value interface{}) (string, error) {
+	switch v := value.(type) {
+	case string:
+		return expr.Quote(v), nil
+	case []byte:
+		return expr.Quote(string(v)), nil
+	case time.Time:
+		return expr.Quote(v.Format(spec.ISO8601)), nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case int:
+		return strconv.FormatInt(int64(v), 10), nil
+	case int32:
+		return strconv.FormatInt(int64(v), 10), nil
+	case int64:
+		return strconv.FormatInt(v, 10), nil
+	case float32:
+		return strconv.FormatFloat(float64(v), 'f', -1, 32), nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	default:
+		return "", fmt.Errorf("%w: unsupported value of type %T in filter", spec.ErrInvalidFilter, value)
+	}
+}
@@ -0,0 +1,181 @@
+package crud
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/imulab/go-scim/pkg/v2/spec"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestFilterBuilder(t *testing.T) {
+	s := new(FilterBuilderTestSuite)
+	suite.Run(t, s)
+}
+
+type FilterBuilderTestSuite struct {
+	suite.Suite
+	resourceType *spec.ResourceType
+}
+
+func (s *FilterBuilderTestSuite) TestBuild() {
+	tests := []struct {
+		name    string
+		builder func() *FilterBuilder
+		expect  func(t *testing.T, filter string, err error)
+	}{
+		{
+			name: "single predicate",
+			builder: func() *FilterBuilder {
+				return Filter().Eq("userName", "imulab")
+			},
+			expect: func(t *testing.T, filter string, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, `userName eq "imulab"`, filter)
+			},
+		},
+		{
+			name: "value is escaped",
+			builder: func() *FilterBuilder {
+				return Filter().Eq("displayName", "foo\" and userName pr \\\n")
+			},
+			expect: func(t *testing.T, filter string, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, `displayName eq "foo\" and userName pr \\\n"`, filter)
+			},
+		},
+		{
+			name: "typed values",
+			builder: func() *FilterBuilder {
+				return Filter().Eq("active", true).Gt("meta.lastModified", time.Date(2019, 12, 20, 4, 40, 0, 0, time.UTC))
+			},
+			expect: func(t *testing.T, filter string, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, `(active eq true) and (meta.lastModified gt "2019-12-20T04:40:00")`, filter)
+			},
+		},
+		{
+			name: "logical combination",
+			builder: func() *FilterBuilder {
+				return Filter().Sw("userName", "im").And(
+					Filter().Pr("emails").Or(Filter().Co("title", "dev")),
+					Filter().Eq("active", false).Not(),
+				)
+			},
+			expect: func(t *testing.T, filter string, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, `((userName sw "im") and ((emails pr) or (title co "dev"))) and (not (active eq false))`, filter)
+			},
+		},
+		{
+			name: "unsupported value",
+			builder: func() *FilterBuilder {
+				return Filter().Eq("userName", struct{}{})
+			},
+			expect: func(t *testing.T, filter string, err error) {
+				assert.Equal(t, spec.ErrInvalidFilter, errors.Unwrap(err))
+			},
+		},
+		{
+			name: "invalid path",
+			builder: func() *FilterBuilder {
+				return Filter().Pr("userName or id")
+			},
+			expect: func(t *testing.T, filter string, err error) {
+				assert.Equal(t, spec.ErrInvalidFilter, errors.Unwrap(err))
+			},
+		},
+		{
+			name: "error in nested builder",
+			builder: func() *FilterBuilder {
+				return Filter().Pr("id").Or(Filter().Not())
+			},
+			expect: func(t *testing.T, filter string, err error) {
+				assert.Equal(t, spec.ErrInvalidFilter, errors.Unwrap(err))
+			},
+		},
+		{
+			name: "empty filter",
+			builder: func() *FilterBuilder {
+				return Filter()
+			},
+			expect: func(t *testing.T, filter string, err error) {
+				assert.Equal(t, spec.ErrInvalidFilter, errors.Unwrap(err))
+			},
+		},
+	}
+
+	for _, test := range tests {
+		s.T().Run(test.name, func(t *testing.T) {
+			root, filter, err := test.builder().Build()
+			if err == nil {
+				assert.NotNil(t, root)
+			}
+			test.expect(t, filter, err)
+		})
+	}
+}
+
+func (s *FilterBuilderTestSuite) TestBuildFor() {
+	_, _, err := Filter().Eq("userName", "imulab").BuildFor(s.resourceType)
+	assert.Nil(s.T(), err)
+
+	_, _, err = Filter().Gt("active", true).BuildFor(s.resourceType)
+	assert.Equal(s.T(), spec.ErrInvalidFilter, errors.Unwrap(err))
+}
+
+func (s *FilterBuilderTestSuite) SetupSuite() {
+	for _, each := range []struct {
+		filepath  string
+		structure interface{}
+		post      func(parsed interface{})
+	}{
+		{
+			filepath:  "../../../public/schemas/core_schema.json",
+			structure: new(spec.Schema),
+			post: func(parsed interface{}) {
+				spec.Schemas().Register(parsed.(*spec.Schema))
+			},
+		},
+		{
+			filepath:  "../../../public/schemas/user_schema.json",
+			structure: new(spec.Schema),
+			post: func(parsed interface{}) {
+				spec.Schemas().Register(parsed.(*spec.Schema))
+			},
+		},
+		{
+			filepath:  "../../../public/schemas/user_enterprise_extension_schema.json",
+			structure: new(spec.Schema),
+			post: func(parsed interface{}) {
+				spec.Schemas().Register(parsed.(*spec.Schema))
+			},
+		},
+		{
+			filepath:  "../../../public/resource_types/user_resource_type.json",
+			structure: new(spec.ResourceType),
+			post: func(parsed interface{}) {
+				s.resourceType = parsed.(*spec.ResourceType)
+				Register(s.resourceType)
+			},
+		},
+	} {
+		f, err := os.Open(each.filepath)
+		require.Nil(s.T(), err)
+
+		raw, err := ioutil.ReadAll(f)
+		require.Nil(s.T(), err)
+
+		err = json.Unmarshal(raw, each.structure)
+		require.Nil(s.T(), err)
+
+		if each.post != nil {
+			each.post(each.structure)
+		}
+	}
+}
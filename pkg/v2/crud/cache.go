@@ -0,0 +1,115 @@
+package crud
+
+import (
+	"container/list"
+	"github.com/imulab/go-scim/pkg/v2/crud/expr"
+	"github.com/imulab/go-scim/pkg/v2/prop"
+	"github.com/imulab/go-scim/pkg/v2/spec"
+	"sync"
+)
+
+// DefaultFilterCacheSize is the size of FilterCache used when a non-positive size is requested.
+const DefaultFilterCacheSize = 1024
+
+// NewFilterCache returns a FilterCache that holds at most size compiled filters. When the cache is full, the least
+// recently used filter is evicted. If size is not positive, DefaultFilterCacheSize is used.
+func NewFilterCache(size int) *FilterCache {
+	if size <= 0 {
+		size = DefaultFilterCacheSize
+	}
+	return &FilterCache{
+		size:  size,
+		order: list.New(),
+		items: make(map[filterCacheKey]*list.Element, size),
+	}
+}
+
+// FilterCache is a least recently used cache of compiled and validated filters, keyed by the resource type and the
+// filter string. Identity providers tend to send the same few filters (i.e. userName eq "...") over and over again,
+// which makes it worthwhile to skip compilation and validation for the filters already seen. FilterCache is safe for
+// concurrent use.
+//
+// The cached expressions are shared among callers and must be treated as read only.
+type FilterCache struct {
+	mu    sync.Mutex
+	size  int
+	order *list.List
+	items map[filterCacheKey]*list.Element
+}
+
+type filterCacheKey struct {
+	resourceType string
+	filter       string
+}
+
+type filterCacheEntry struct {
+	key  filterCacheKey
+	root *expr.Expression
+}
+
+// Compile returns the root of the compiled filter, which has been validated against the resource type using
+// ValidateFilter. Filters that failed to compile or validate are not cached.
+func (c *FilterCache) Compile(filter string, resourceType *spec.ResourceType) (*expr.Expression, error) {
+	key := filterCacheKey{resourceType: resourceType.ID(), filter: filter}
+	if root, ok := c.get(key); ok {
+		return root, nil
+	}
+
+	root, err := expr.CompileFilter(filter)
+	if err != nil {
+		return nil, err
+	}
+	if err := ValidateFilter(root, resourceType); err != nil {
+		return nil, err
+	}
+
+	c.put(key, root)
+	return root, nil
+}
+
+// Evaluate the resource with the given SCIM filter, which is compiled using this cache. This is the cached version
+// of Evaluate.
+func (c *FilterCache) Evaluate(resource *prop.Resource, filter string) (bool, error) {
+	root, err := c.Compile(filter, resource.ResourceType())
+	if err != nil {
+		return false, err
+	}
+	return EvaluateExpressionOnProperty(resource.RootProperty(), root)
+}
+
+// Len returns the number of filters currently in the cache.
+func (c *FilterCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
+
+func (c *FilterCache) get(key filterCacheKey) (*expr.Expression, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+	c.order.MoveToFront(elem)
+	return elem.Value.(*filterCacheEntry).root, true
+}
+
+func (c *FilterCache) put(key filterCacheKey, root *expr.Expression) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// another goroutine may have compiled the same filter in the meantime
+	if elem, ok := c.items[key]; ok {
+		c.order.MoveToFront(elem)
+		return
+	}
+
+	c.items[key] = c.order.PushFront(&filterCacheEntry{key: key, root: root})
+	for c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.items, oldest.Value.(*filterCacheEntry).key)
+	}
+}
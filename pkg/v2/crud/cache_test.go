@@ -0,0 +1,139 @@
+package crud
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/imulab/go-scim/pkg/v2/spec"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"io/ioutil"
+	"os"
+	"sync"
+	"testing"
+)
+
+func TestFilterCache(t *testing.T) {
+	s := new(FilterCacheTestSuite)
+	suite.Run(t, s)
+}
+
+type FilterCacheTestSuite struct {
+	suite.Suite
+	resourceType *spec.ResourceType
+}
+
+func (s *FilterCacheTestSuite) TestCompile() {
+	cache := NewFilterCache(2)
+
+	first, err := cache.Compile(`userName eq "imulab"`, s.resourceType)
+	assert.Nil(s.T(), err)
+	second, err := cache.Compile(`userName eq "imulab"`, s.resourceType)
+	assert.Nil(s.T(), err)
+	assert.True(s.T(), first == second)
+	assert.Equal(s.T(), 1, cache.Len())
+}
+
+func (s *FilterCacheTestSuite) TestInvalidFilterIsNotCached() {
+	cache := NewFilterCache(2)
+
+	_, err := cache.Compile(`userName eq`, s.resourceType)
+	assert.NotNil(s.T(), err)
+
+	_, err = cache.Compile(`active gt true`, s.resourceType)
+	assert.Equal(s.T(), spec.ErrInvalidFilter, errors.Unwrap(err))
+
+	assert.Equal(s.T(), 0, cache.Len())
+}
+
+func (s *FilterCacheTestSuite) TestEviction() {
+	cache := NewFilterCache(2)
+
+	a, err := cache.Compile(`userName eq "a"`, s.resourceType)
+	require.Nil(s.T(), err)
+	_, err = cache.Compile(`userName eq "b"`, s.resourceType)
+	require.Nil(s.T(), err)
+
+	// use "a" so that "b" becomes the least recently used
+	_, err = cache.Compile(`userName eq "a"`, s.resourceType)
+	require.Nil(s.T(), err)
+	_, err = cache.Compile(`userName eq "c"`, s.resourceType)
+	require.Nil(s.T(), err)
+	assert.Equal(s.T(), 2, cache.Len())
+
+	again, err := cache.Compile(`userName eq "a"`, s.resourceType)
+	require.Nil(s.T(), err)
+	assert.True(s.T(), a == again)
+	assert.Equal(s.T(), 2, cache.Len())
+}
+
+func (s *FilterCacheTestSuite) TestConcurrentUse() {
+	cache := NewFilterCache(8)
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				_, err := cache.Compile(fmt.Sprintf(`userName eq "%d"`, (i+j)%12), s.resourceType)
+				assert.Nil(s.T(), err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	assert.Equal(s.T(), 8, cache.Len())
+}
+
+func (s *FilterCacheTestSuite) SetupSuite() {
+	for _, each := range []struct {
+		filepath  string
+		structure interface{}
+		post      func(parsed interface{})
+	}{
+		{
+			filepath:  "../../../public/schemas/core_schema.json",
+			structure: new(spec.Schema),
+			post: func(parsed interface{}) {
+				spec.Schemas().Register(parsed.(*spec.Schema))
+			},
+		},
+		{
+			filepath:  "../../../public/schemas/user_schema.json",
+			structure: new(spec.Schema),
+			post: func(parsed interface{}) {
+				spec.Schemas().Register(parsed.(*spec.Schema))
+			},
+		},
+		{
+			filepath:  "../../../public/schemas/user_enterprise_extension_schema.json",
+			structure: new(spec.Schema),
+			post: func(parsed interface{}) {
+				spec.Schemas().Register(parsed.(*spec.Schema))
+			},
+		},
+		{
+			filepath:  "../../../public/resource_types/user_resource_type.json",
+			structure: new(spec.ResourceType),
+			post: func(parsed interface{}) {
+				s.resourceType = parsed.(*spec.ResourceType)
+				Register(s.resourceType)
+			},
+		},
+	} {
+		f, err := os.Open(each.filepath)
+		require.Nil(s.T(), err)
+
+		raw, err := ioutil.ReadAll(f)
+		require.Nil(s.T(), err)
+
+		err = json.Unmarshal(raw, each.structure)
+		require.Nil(s.T(), err)
+
+		if each.post != nil {
+			each.post(each.structure)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package crud
+
+import (
+	"github.com/imulab/go-scim/pkg/v2/spec"
+	"strings"
+	"sync/atomic"
+	"unicode"
+)
+
+// Collation decides how string and reference values are compared by the in-memory filter evaluator when the target
+// attribute is not caseExact. Values are compared by their collation keys: two values are considered equal if their
+// keys are equal, and "sw", "ew" and "co" operate on the keys as well. Attributes that are caseExact are always
+// compared as they are, regardless of the collation.
+type Collation interface {
+	// Key returns the collation key of the value.
+	Key(value string) string
+}
+
+var (
+	// LowerCaseCollation compares values by their lower case form (see strings.ToLower). This is the default
+	// collation, and is consistent with how string properties are hashed and compared in package prop.
+	LowerCaseCollation Collation = collationFunc(strings.ToLower)
+	// FoldCaseCollation compares values under Unicode simple case folding (see unicode.SimpleFold), so that all
+	// case variants of a rune are considered equal, i.e. "ſ" (long s), "s" and "S".
+	FoldCaseCollation Collation = collationFunc(foldCase)
+)
+
+// UseCollation sets the collation used by the filter evaluator to compare values of attributes that are not
+// caseExact. A nil collation resets to LowerCaseCollation. It is intended to be called once during initialization.
+func UseCollation(c Collation) {
+	if c == nil {
+		c = LowerCaseCollation
+	}
+	collation.Store(collationHolder{c})
+}
+
+// CollationKey returns the key that the filter evaluator compares the text value of the attribute by: the key of the
+// collation in use (see UseCollation) if the attribute is not caseExact, or the value as is otherwise. It allows
+// indexes of text values to be consistent with the evaluation of filters.
+func CollationKey(attr *spec.Attribute, value string) string {
+	if attr.CaseExact() {
+		return value
+	}
+	return currentCollation().Key(value)
+}
+
+var collation atomic.Value
+
+// atomic.Value requires values of the same concrete type.
+type collationHolder struct {
+	Collation
+}
+
+func currentCollation() Collation {
+	if h, ok := collation.Load().(collationHolder); ok {
+		return h.Collation
+	}
+	return LowerCaseCollation
+}
+
+type collationFunc func(value string) string
+
+func (f collationFunc) Key(value string) string {
+	return f(value)
+}
+
+// Maps every rune to the smallest rune in its case folding orbit.
+func foldCase(value string) string {
+	return strings.Map(func(r rune) rune {
+		min := r
+		for f := unicode.SimpleFold(r); f != r; f = unicode.SimpleFold(f) {
+			if f < min {
+				min = f
+			}
+		}
+		return min
+	}, value)
+}
@@ -0,0 +1,166 @@
+package crud
+
+import (
+	"encoding/json"
+	"github.com/imulab/go-scim/pkg/v2/prop"
+	"github.com/imulab/go-scim/pkg/v2/spec"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestCollation(t *testing.T) {
+	s := new(CollationTestSuite)
+	suite.Run(t, s)
+}
+
+type CollationTestSuite struct {
+	suite.Suite
+	resourceType *spec.ResourceType
+}
+
+func (s *CollationTestSuite) TestCaseExact() {
+	r := s.newUser("Imulab", "AbC-123")
+
+	for _, each := range []struct {
+		filter string
+		expect bool
+	}{
+		// userName is not caseExact
+		{filter: `userName eq "imulab"`, expect: true},
+		{filter: `userName eq "IMULAB"`, expect: true},
+		{filter: `userName ne "imulab"`, expect: false},
+		{filter: `userName sw "IMU"`, expect: true},
+		{filter: `userName ew "LAB"`, expect: true},
+		{filter: `userName co "mUl"`, expect: true},
+		// externalId is caseExact
+		{filter: `externalId eq "AbC-123"`, expect: true},
+		{filter: `externalId eq "abc-123"`, expect: false},
+		{filter: `externalId ne "abc-123"`, expect: true},
+		{filter: `externalId sw "AbC"`, expect: true},
+		{filter: `externalId sw "abc"`, expect: false},
+		{filter: `externalId ew "C-123"`, expect: true},
+		{filter: `externalId ew "c-123"`, expect: false},
+		{filter: `externalId co "bC"`, expect: true},
+		{filter: `externalId co "BC"`, expect: false},
+		// profileUrl is a reference that is not caseExact
+		{filter: `profileUrl eq "HTTPS://EXAMPLE.COM/imulab"`, expect: true},
+		{filter: `profileUrl sw "https://Example.com"`, expect: true},
+	} {
+		result, err := Evaluate(r, each.filter)
+		assert.Nil(s.T(), err, each.filter)
+		assert.Equal(s.T(), each.expect, result, each.filter)
+	}
+}
+
+func (s *CollationTestSuite) TestUniqueness() {
+	users := []*prop.Resource{
+		s.newUser("Imulab", "AbC-123"),
+		s.newUser("someone", "abc-123"),
+	}
+
+	count := func(filter string) int {
+		n := 0
+		for _, u := range users {
+			ok, err := Evaluate(u, filter)
+			require.Nil(s.T(), err, filter)
+			if ok {
+				n++
+			}
+		}
+		return n
+	}
+
+	// a mixed-case userName collides with an existing one, whereas externalIds differing only in case do not.
+	assert.Equal(s.T(), 1, count(`userName eq "IMULAB"`))
+	assert.Equal(s.T(), 1, count(`externalId eq "AbC-123"`))
+	assert.Equal(s.T(), 1, count(`externalId eq "abc-123"`))
+	assert.Equal(s.T(), 0, count(`externalId eq "ABC-123"`))
+}
+
+func (s *CollationTestSuite) TestUseCollation() {
+	r := s.newUser("Straße", "AbC-123")
+
+	UseCollation(FoldCaseCollation)
+	defer UseCollation(nil)
+
+	for _, each := range []struct {
+		filter string
+		expect bool
+	}{
+		{filter: `userName eq "STRAßE"`, expect: true},
+		{filter: `userName co "ſ"`, expect: true}, // long s folds to s
+		{filter: `externalId eq "abc-123"`, expect: false},
+	} {
+		result, err := Evaluate(r, each.filter)
+		assert.Nil(s.T(), err, each.filter)
+		assert.Equal(s.T(), each.expect, result, each.filter)
+	}
+
+	UseCollation(nil)
+	result, err := Evaluate(r, `userName co "ſ"`)
+	assert.Nil(s.T(), err)
+	assert.False(s.T(), result)
+}
+
+func (s *CollationTestSuite) newUser(userName string, externalId string) *prop.Resource {
+	r := prop.NewResource(s.resourceType)
+	assert.False(s.T(), r.Navigator().Dot("userName").Replace(userName).HasError())
+	assert.False(s.T(), r.Navigator().Dot("externalId").Replace(externalId).HasError())
+	assert.False(s.T(), r.Navigator().Dot("profileUrl").Replace("https://example.com/imulab").HasError())
+	return r
+}
+
+func (s *CollationTestSuite) SetupSuite() {
+	for _, each := range []struct {
+		filepath  string
+		structure interface{}
+		post      func(parsed interface{})
+	}{
+		{
+			filepath:  "../../../public/schemas/core_schema.json",
+			structure: new(spec.Schema),
+			post: func(parsed interface{}) {
+				spec.Schemas().Register(parsed.(*spec.Schema))
+			},
+		},
+		{
+			filepath:  "../../../public/schemas/user_schema.json",
+			structure: new(spec.Schema),
+			post: func(parsed interface{}) {
+				spec.Schemas().Register(parsed.(*spec.Schema))
+			},
+		},
+		{
+			filepath:  "../../../public/schemas/user_enterprise_extension_schema.json",
+			structure: new(spec.Schema),
+			post: func(parsed interface{}) {
+				spec.Schemas().Register(parsed.(*spec.Schema))
+			},
+		},
+		{
+			filepath:  "../../../public/resource_types/user_resource_type.json",
+			structure: new(spec.ResourceType),
+			post: func(parsed interface{}) {
+				s.resourceType = parsed.(*spec.ResourceType)
+				Register(s.resourceType)
+			},
+		},
+	} {
+		f, err := os.Open(each.filepath)
+		require.Nil(s.T(), err)
+
+		raw, err := ioutil.ReadAll(f)
+		require.Nil(s.T(), err)
+
+		err = json.Unmarshal(raw, each.structure)
+		require.Nil(s.T(), err)
+
+		if each.post != nil {
+			each.post(each.structure)
+		}
+	}
+}
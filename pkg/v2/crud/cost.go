@@ -0,0 +1,141 @@
+package crud
+
+import (
+	"fmt"
+	"github.com/imulab/go-scim/pkg/v2/crud/expr"
+	"github.com/imulab/go-scim/pkg/v2/spec"
+	"strings"
+)
+
+// Relative costs of evaluating a single relational term of a filter.
+const (
+	// CostIndexed is the cost of a term that can be answered by looking up an index.
+	CostIndexed = 1
+	// CostScan is the cost of a term that can only be answered by scanning, and evaluating, all resources.
+	CostScan = 100
+)
+
+// IndexedFunc reports whether the attribute is indexed by the database, so that terms on the attribute can be
+// answered without scanning all resources.
+type IndexedFunc func(attr *spec.Attribute) bool
+
+// IndexedByUniqueness is the default IndexedFunc. It regards the id attribute, and attributes whose uniqueness is
+// server or global, as indexed, as databases typically maintain indexes to enforce uniqueness.
+func IndexedByUniqueness(attr *spec.Attribute) bool {
+	return attr.ID() == "id" || attr.Uniqueness() != spec.UniquenessNone
+}
+
+// Cost is the estimated cost of evaluating a SCIM filter. See EstimateCost.
+type Cost struct {
+	// Score is the relative cost of the filter, measured in CostIndexed and CostScan.
+	Score int
+	// Scan is true if the filter cannot be answered without scanning all resources.
+	Scan bool
+	// Unindexed is the number of terms on attributes that are not indexed.
+	Unindexed int
+	// LeadingWildcards is the number of "co" and "ew" terms, which cannot make use of an index.
+	LeadingWildcards int
+	// Disjunctions is the number of "or" operators, each of which fans out to both of its operands.
+	Disjunctions int
+	// Reasons describes the terms that caused a scan, in the order they are found in the filter.
+	Reasons []string
+}
+
+// EstimateCost estimates the cost of evaluating the SCIM filter against resources of the resource type, so that
+// expensive filters can be rejected or deprioritized before the database scans the whole dataset. The filter is
+// validated (see ValidateFilter) before estimation. A nil indexed function defaults to IndexedByUniqueness.
+//
+// The estimate is computed bottom up: a relational term costs CostIndexed if its attribute is indexed and the
+// operator can use an index, or CostScan otherwise; "co" and "ew" (leading wildcard), "ne", "re" and "not" always
+// scan. An "and" costs as much as its cheaper operand, as the other operand only narrows down the candidates; an "or"
+// costs the sum of its operands, and scans if either operand scans.
+func EstimateCost(filter string, resourceType *spec.ResourceType, indexed IndexedFunc) (*Cost, error) {
+	cf, err := expr.CompileFilter(filter)
+	if err != nil {
+		return nil, err
+	}
+	if err := ValidateFilter(cf, resourceType); err != nil {
+		return nil, err
+	}
+	if indexed == nil {
+		indexed = IndexedByUniqueness
+	}
+
+	e := costEstimator{
+		validator: newFilterValidator(resourceType),
+		indexed:   indexed,
+		cost:      new(Cost),
+	}
+	score, scan, err := e.estimate(cf)
+	if err != nil {
+		return nil, err
+	}
+	e.cost.Score, e.cost.Scan = score, scan
+	return e.cost, nil
+}
+
+type costEstimator struct {
+	validator filterValidator
+	indexed   IndexedFunc
+	cost      *Cost
+}
+
+func (e costEstimator) estimate(root *expr.Expression) (score int, scan bool, err error) {
+	switch root.Token() {
+	case expr.And:
+		ls, lScan, err := e.estimate(root.Left())
+		if err != nil {
+			return 0, false, err
+		}
+		rs, rScan, err := e.estimate(root.Right())
+		if err != nil {
+			return 0, false, err
+		}
+		if ls > rs {
+			ls = rs
+		}
+		return ls, lScan && rScan, nil
+	case expr.Or:
+		e.cost.Disjunctions++
+		ls, lScan, err := e.estimate(root.Left())
+		if err != nil {
+			return 0, false, err
+		}
+		rs, rScan, err := e.estimate(root.Right())
+		if err != nil {
+			return 0, false, err
+		}
+		return ls + rs, lScan || rScan, nil
+	case expr.Not:
+		if _, _, err := e.estimate(root.Left()); err != nil {
+			return 0, false, err
+		}
+		e.cost.Reasons = append(e.cost.Reasons, fmt.Sprintf("negation of '%s'", root.Left().String()))
+		return CostScan, true, nil
+	}
+
+	attr, err := e.validator.resolve(root)
+	if err != nil {
+		return 0, false, err
+	}
+
+	if !e.indexed(attr) {
+		e.cost.Unindexed++
+		e.cost.Reasons = append(e.cost.Reasons, fmt.Sprintf("attribute '%s' is not indexed", attr.Path()))
+		scan = true
+	}
+	switch strings.ToLower(root.Token()) {
+	case expr.Co, expr.Ew:
+		e.cost.LeadingWildcards++
+		e.cost.Reasons = append(e.cost.Reasons, fmt.Sprintf("leading wildcard in '%s'", root.String()))
+		scan = true
+	case expr.Ne, expr.Re:
+		e.cost.Reasons = append(e.cost.Reasons, fmt.Sprintf("operator in '%s' cannot use an index", root.String()))
+		scan = true
+	}
+
+	if scan {
+		return CostScan, true, nil
+	}
+	return CostIndexed, false, nil
+}
@@ -0,0 +1,173 @@
+package crud
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/imulab/go-scim/pkg/v2/spec"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestCost(t *testing.T) {
+	s := new(CostTestSuite)
+	suite.Run(t, s)
+}
+
+type CostTestSuite struct {
+	suite.Suite
+	resourceType *spec.ResourceType
+}
+
+func (s *CostTestSuite) TestEstimateCost() {
+	tests := []struct {
+		name    string
+		filter  string
+		indexed IndexedFunc
+		expect  func(t *testing.T, cost *Cost, err error)
+	}{
+		{
+			name:   "indexed equality",
+			filter: `userName eq "foo"`,
+			expect: func(t *testing.T, cost *Cost, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, CostIndexed, cost.Score)
+				assert.False(t, cost.Scan)
+				assert.Empty(t, cost.Reasons)
+			},
+		},
+		{
+			name:   "unindexed attribute",
+			filter: `displayName eq "foo"`,
+			expect: func(t *testing.T, cost *Cost, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, CostScan, cost.Score)
+				assert.True(t, cost.Scan)
+				assert.Equal(t, 1, cost.Unindexed)
+				assert.Len(t, cost.Reasons, 1)
+			},
+		},
+		{
+			name:   "leading wildcard",
+			filter: `userName co "foo" or userName ew "bar"`,
+			expect: func(t *testing.T, cost *Cost, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, 2*CostScan, cost.Score)
+				assert.True(t, cost.Scan)
+				assert.Equal(t, 2, cost.LeadingWildcards)
+				assert.Equal(t, 1, cost.Disjunctions)
+			},
+		},
+		{
+			name:   "leading wildcard narrowed by indexed term",
+			filter: `id eq "1" and displayName co "foo"`,
+			expect: func(t *testing.T, cost *Cost, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, CostIndexed, cost.Score)
+				assert.False(t, cost.Scan)
+				assert.Equal(t, 1, cost.LeadingWildcards)
+				assert.Equal(t, 1, cost.Unindexed)
+			},
+		},
+		{
+			name:   "disjunction fan out",
+			filter: `userName eq "a" or userName eq "b" or id eq "c"`,
+			expect: func(t *testing.T, cost *Cost, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, 3*CostIndexed, cost.Score)
+				assert.False(t, cost.Scan)
+				assert.Equal(t, 2, cost.Disjunctions)
+			},
+		},
+		{
+			name:   "negation",
+			filter: `not (userName eq "foo")`,
+			expect: func(t *testing.T, cost *Cost, err error) {
+				assert.Nil(t, err)
+				assert.True(t, cost.Scan)
+				assert.Equal(t, CostScan, cost.Score)
+			},
+		},
+		{
+			name:   "custom indexed function",
+			filter: `name.familyName eq "foo" and emails.value sw "foo"`,
+			indexed: func(attr *spec.Attribute) bool {
+				return attr.Path() == "emails.value"
+			},
+			expect: func(t *testing.T, cost *Cost, err error) {
+				assert.Nil(t, err)
+				assert.False(t, cost.Scan)
+				assert.Equal(t, CostIndexed, cost.Score)
+			},
+		},
+		{
+			name:   "undefined attribute",
+			filter: `foo eq "bar"`,
+			expect: func(t *testing.T, cost *Cost, err error) {
+				assert.NotNil(t, err)
+				assert.True(t, errors.Is(err, spec.ErrInvalidFilter))
+			},
+		},
+	}
+
+	for _, test := range tests {
+		s.T().Run(test.name, func(t *testing.T) {
+			cost, err := EstimateCost(test.filter, s.resourceType, test.indexed)
+			test.expect(t, cost, err)
+		})
+	}
+}
+
+func (s *CostTestSuite) SetupSuite() {
+	for _, each := range []struct {
+		filepath  string
+		structure interface{}
+		post      func(parsed interface{})
+	}{
+		{
+			filepath:  "../../../public/schemas/core_schema.json",
+			structure: new(spec.Schema),
+			post: func(parsed interface{}) {
+				spec.Schemas().Register(parsed.(*spec.Schema))
+			},
+		},
+		{
+			filepath:  "../../../public/schemas/user_schema.json",
+			structure: new(spec.Schema),
+			post: func(parsed interface{}) {
+				spec.Schemas().Register(parsed.(*spec.Schema))
+			},
+		},
+		{
+			filepath:  "../../../public/schemas/user_enterprise_extension_schema.json",
+			structure: new(spec.Schema),
+			post: func(parsed interface{}) {
+				spec.Schemas().Register(parsed.(*spec.Schema))
+			},
+		},
+		{
+			filepath:  "../../../public/resource_types/user_resource_type.json",
+			structure: new(spec.ResourceType),
+			post: func(parsed interface{}) {
+				s.resourceType = parsed.(*spec.ResourceType)
+				Register(s.resourceType)
+			},
+		},
+	} {
+		f, err := os.Open(each.filepath)
+		require.Nil(s.T(), err)
+
+		raw, err := ioutil.ReadAll(f)
+		require.Nil(s.T(), err)
+
+		err = json.Unmarshal(raw, each.structure)
+		require.Nil(s.T(), err)
+
+		if each.post != nil {
+			each.post(each.structure)
+		}
+	}
+}
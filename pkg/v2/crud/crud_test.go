@@ -430,6 +430,33 @@ func (s *CrudTestSuite) TestDelete() {
 				}, r.Navigator().Dot("emails").Current().Raw())
 			},
 		},
+		{
+			name: "delete multiple multiValued property elements with filter",
+			getResource: func(t *testing.T) *prop.Resource {
+				r := prop.NewResource(s.resourceType)
+				assert.False(t, r.Navigator().Dot("emails").Add([]interface{}{
+					map[string]interface{}{
+						"value": "foo",
+					},
+					map[string]interface{}{
+						"value": "bar",
+					},
+					map[string]interface{}{
+						"value": "foobar",
+					},
+				}).HasError())
+				return r
+			},
+			path: `emails[value sw "foo"]`,
+			expect: func(t *testing.T, r *prop.Resource, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, []interface{}{
+					map[string]interface{}{
+						"value": "bar",
+					},
+				}, r.Navigator().Dot("emails").Current().Raw())
+			},
+		},
 		{
 			name: "delete empty path yields error",
 			getResource: func(t *testing.T) *prop.Resource {
@@ -575,6 +602,13 @@ const (
           }
         }
       ]
+    },
+    {
+      "id": "lastLogin",
+      "name": "lastLogin",
+      "type": "dateTime",
+      "_index": 101,
+      "_path": "lastLogin"
     }
   ]
 }
@@ -0,0 +1,160 @@
+package crud
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"github.com/imulab/go-scim/pkg/v2/prop"
+	"github.com/imulab/go-scim/pkg/v2/spec"
+	"sort"
+)
+
+// Cursor marks a position in a sorted list of resources, for cursor based pagination (see
+// draft-ietf-scim-cursor-pagination). It records the sort key values and the id of the last resource on a page, so
+// that the next page starts right after it, regardless of resources inserted or deleted in the meantime. This keeps
+// the cost of fetching a page independent of how deep the page is, unlike startIndex based pagination.
+//
+// A Cursor is handed to clients in its opaque string form (see Cursor.String and ParseCursor), and is only valid for
+// the same sort option it was created with.
+type Cursor struct {
+	Values []interface{} `json:"v"`
+	ID     string        `json:"id"`
+}
+
+// NewCursor returns the Cursor positioned after the resource, for resources sorted by the sort option.
+func NewCursor(resource *prop.Resource, sort Sort) (*Cursor, error) {
+	_, paths, err := sort.compile()
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Cursor{Values: make([]interface{}, len(paths)), ID: resource.IdOrEmpty()}
+	for k, target := range seekSortTargets(resource, paths) {
+		if target != nil {
+			c.Values[k] = target.Raw()
+		}
+	}
+	return c, nil
+}
+
+// ParseCursor parses the opaque string form of the Cursor. An error of spec.ErrInvalidCursor is returned if the
+// cursor is malformed.
+func ParseCursor(cursor string) (*Cursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed cursor", spec.ErrInvalidCursor)
+	}
+
+	c := new(Cursor)
+	d := json.NewDecoder(bytes.NewReader(raw))
+	d.UseNumber()
+	if err := d.Decode(c); err != nil || len(c.ID) == 0 {
+		return nil, fmt.Errorf("%w: malformed cursor", spec.ErrInvalidCursor)
+	}
+	return c, nil
+}
+
+// String returns the opaque string form of the Cursor, which is safe to be used in URL query parameters.
+func (c *Cursor) String() string {
+	raw, err := json.Marshal(c)
+	if err != nil {
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+// After returns the resources positioned after the cursor. The resources must have been sorted by this sort option
+// (see Sort.Sort), and the cursor must have been created using the same sort option, otherwise an error of
+// spec.ErrInvalidCursor is returned.
+func (s Sort) After(resources []*prop.Resource, cursor *Cursor) ([]*prop.Resource, error) {
+	keys, paths, err := s.compile()
+	if err != nil {
+		return nil, err
+	}
+	if len(cursor.Values) != len(keys) {
+		return nil, fmt.Errorf("%w: cursor does not match the sort order", spec.ErrInvalidCursor)
+	}
+
+	var invalid error
+	i := sort.Search(len(resources), func(i int) bool {
+		targets := seekSortTargets(resources[i], paths)
+		for k, key := range keys {
+			c, err := compareSortTargetWithValue(targets[k], cursor.Values[k])
+			if err != nil {
+				invalid = err
+				return true
+			}
+			if c == 0 {
+				continue
+			}
+			if key.Order == SortDesc {
+				return c < 0
+			}
+			return c > 0
+		}
+		return resources[i].IdOrEmpty() > cursor.ID
+	})
+	if invalid != nil {
+		return nil, invalid
+	}
+	return resources[i:], nil
+}
+
+// Compare the sort target with the sort value recorded in a cursor, in the same manner as compareSortTargets.
+func compareSortTargetWithValue(target prop.Property, value interface{}) (int, error) {
+	switch {
+	case target == nil && value == nil:
+		return 0, nil
+	case target == nil:
+		return 1, nil
+	case value == nil:
+		return -1, nil
+	}
+
+	value, err := cursorValue(target.Attribute(), value)
+	if err != nil {
+		return 0, err
+	}
+
+	lt, ok := target.(prop.LtCapable)
+	if !ok {
+		return 0, nil
+	}
+	if lt.LessThan(value) {
+		return -1, nil
+	}
+	if gt, ok := target.(prop.GtCapable); ok && gt.GreaterThan(value) {
+		return 1, nil
+	}
+	return 0, nil
+}
+
+// Convert the decoded sort value of the cursor back to the type of the attribute.
+func cursorValue(attr *spec.Attribute, value interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case json.Number:
+		switch attr.Type() {
+		case spec.TypeInteger:
+			if i64, err := v.Int64(); err == nil {
+				return i64, nil
+			}
+		case spec.TypeDecimal:
+			if f64, err := v.Float64(); err == nil {
+				return f64, nil
+			}
+		}
+	case string:
+		switch attr.Type() {
+		case spec.TypeString, spec.TypeReference, spec.TypeDateTime, spec.TypeBinary:
+			return v, nil
+		}
+	case bool:
+		if attr.Type() == spec.TypeBoolean {
+			return v, nil
+		}
+	case int64, float64:
+		return v, nil
+	}
+	return nil, fmt.Errorf("%w: cursor does not match the sort order", spec.ErrInvalidCursor)
+}
@@ -8,14 +8,20 @@ import (
 	"github.com/imulab/go-scim/pkg/v2/spec"
 	"strconv"
 	"strings"
+	"sync/atomic"
+	"time"
 )
 
-// Evaluate the resource with the given SCIM filter and return the boolean result or an error.
+// Evaluate the resource with the given SCIM filter and return the boolean result or an error. The filter is validated
+// against the resource type of the resource before evaluation (see ValidateFilter).
 func Evaluate(resource *prop.Resource, filter string) (bool, error) {
 	cf, err := expr.CompileFilter(filter)
 	if err != nil {
 		return false, err
 	}
+	if err := ValidateFilter(cf, resource.ResourceType()); err != nil {
+		return false, err
+	}
 	return evaluator{
 		base:   resource.RootProperty(),
 		filter: cf,
@@ -35,7 +41,37 @@ type evaluator struct {
 }
 
 func (v evaluator) evaluate() (bool, error) {
-	return v.evalAny(v.base, v.filter)
+	observe := currentEvaluateObserver()
+	if observe == nil {
+		return v.evalAny(v.base, v.filter)
+	}
+
+	start := time.Now()
+	ok, err := v.evalAny(v.base, v.filter)
+	observe(time.Since(start), err)
+	return ok, err
+}
+
+// SetEvaluateObserver sets the function notified of the time spent evaluating a compiled filter against a resource or
+// property, i.e. by Evaluate or FilterCache.Evaluate, and of the error returned, if any, i.e. to export metrics. The
+// time spent compiling filters is observed separately (see expr.SetCompileObserver). It is intended to be called once
+// during initialization. A nil function removes the observer.
+func SetEvaluateObserver(f func(d time.Duration, err error)) {
+	evaluateObserver.Store(evaluateObserverHolder{f})
+}
+
+var evaluateObserver atomic.Value
+
+// atomic.Value requires values of the same concrete type.
+type evaluateObserverHolder struct {
+	f func(d time.Duration, err error)
+}
+
+func currentEvaluateObserver() func(d time.Duration, err error) {
+	if h, ok := evaluateObserver.Load().(evaluateObserverHolder); ok {
+		return h.f
+	}
+	return nil
 }
 
 func (v evaluator) evalAny(p prop.Property, op *expr.Expression) (bool, error) {
@@ -96,6 +132,8 @@ func (v evaluator) evalAny(p prop.Property, op *expr.Expression) (bool, error) {
 			r, fe = v.evalEw(nav.Current(), op)
 		case expr.Co:
 			r, fe = v.evalCo(nav.Current(), op)
+		case expr.Re:
+			r, fe = v.evalRe(nav.Current(), op)
 		case expr.Gt:
 			r, fe = v.evalGt(nav.Current(), op)
 		case expr.Ge:
@@ -144,6 +182,11 @@ func (v evaluator) evalEq(target prop.Property, eq *expr.Expression) (bool, erro
 		return false, err
 	}
 
+	if isText(target.Attribute()) {
+		return v.compareText(target, value.(string), func(s, value string) bool {
+			return s == value
+		}), nil
+	}
 	return eqTarget.EqualsTo(value), nil
 }
 
@@ -168,6 +211,8 @@ func (v evaluator) evalSw(target prop.Property, sw *expr.Expression) (bool, erro
 
 	if str, ok := value.(string); !ok {
 		return false, spec.ErrInvalidValue
+	} else if isText(target.Attribute()) {
+		return v.compareText(target, str, strings.HasPrefix), nil
 	} else {
 		return swTarget.StartsWith(str), nil
 	}
@@ -186,6 +231,8 @@ func (v evaluator) evalEw(target prop.Property, ew *expr.Expression) (bool, erro
 
 	if str, ok := value.(string); !ok {
 		return false, spec.ErrInvalidValue
+	} else if isText(target.Attribute()) {
+		return v.compareText(target, str, strings.HasSuffix), nil
 	} else {
 		return ewTarget.EndsWith(str), nil
 	}
@@ -204,11 +251,31 @@ func (v evaluator) evalCo(target prop.Property, co *expr.Expression) (bool, erro
 
 	if str, ok := value.(string); !ok {
 		return false, spec.ErrInvalidValue
+	} else if isText(target.Attribute()) {
+		return v.compareText(target, str, strings.Contains), nil
 	} else {
 		return coTarget.Contains(str), nil
 	}
 }
 
+func (v evaluator) evalRe(target prop.Property, re *expr.Expression) (bool, error) {
+	switch target.Attribute().Type() {
+	case spec.TypeString, spec.TypeReference:
+	default:
+		return false, nil
+	}
+
+	regex := re.Regexp(target.Attribute().CaseExact())
+	if regex == nil {
+		return false, fmt.Errorf("%w: pattern %s of operator 're' is not compiled", spec.ErrInvalidFilter, re.Right().Token())
+	}
+
+	if target.IsUnassigned() {
+		return false, nil
+	}
+	return regex.MatchString(target.Raw().(string)), nil
+}
+
 func (v evaluator) evalGt(target prop.Property, gt *expr.Expression) (bool, error) {
 	gtTarget, ok := target.(prop.GtCapable)
 	if !ok {
@@ -302,16 +369,54 @@ func (v evaluator) evalNot(p prop.Property, not *expr.Expression) (bool, error)
 	}
 }
 
+// Compare the value of the string or reference property (or any of its elements, if multiValued) with the value using
+// the match function. Unless the attribute is caseExact, both values are converted to their keys of the configured
+// collation (see UseCollation) beforehand.
+func (v evaluator) compareText(target prop.Property, value string, match func(s, value string) bool) bool {
+	if target.Attribute().MultiValued() {
+		found := false
+		_ = target.ForEachChild(func(_ int, child prop.Property) error {
+			found = found || v.compareText(child, value, match)
+			return nil
+		})
+		return found
+	}
+	if target.IsUnassigned() {
+		return false
+	}
+	s, ok := target.Raw().(string)
+	if !ok {
+		return false
+	}
+	if !target.Attribute().CaseExact() {
+		c := currentCollation()
+		s, value = c.Key(s), c.Key(value)
+	}
+	return match(s, value)
+}
+
+// Returns true if the attribute holds textual values subject to caseExact.
+func isText(attr *spec.Attribute) bool {
+	return attr.Type() == spec.TypeString || attr.Type() == spec.TypeReference
+}
+
 // Take the raw string presentation of a value and normalize it to corresponding types according to the attribute.
 func (v evaluator) normalize(attr *spec.Attribute, token string) (interface{}, error) {
 	switch attr.Type() {
-	case spec.TypeString, spec.TypeDateTime, spec.TypeBinary, spec.TypeReference:
-		if strings.HasPrefix(token, "\"") && strings.HasSuffix(token, "\"") {
-			token = strings.TrimPrefix(token, "\"")
-			token = strings.TrimSuffix(token, "\"")
-			return token, nil
+	case spec.TypeString, spec.TypeBinary, spec.TypeReference:
+		if s, err := expr.Unquote(token); err != nil {
+			return nil, spec.ErrInvalidValue
 		} else {
+			return s, nil
+		}
+	case spec.TypeDateTime:
+		// Parse here so that offsets and fractional seconds are normalized before comparison.
+		if s, err := expr.Unquote(token); err != nil {
 			return nil, spec.ErrInvalidValue
+		} else if t, err := spec.ParseDateTime(s); err != nil {
+			return nil, spec.ErrInvalidValue
+		} else {
+			return t, nil
 		}
 	case spec.TypeInteger:
 		if i64, err := strconv.ParseInt(token, 10, 64); err != nil {
@@ -2,7 +2,9 @@ package crud
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"github.com/imulab/go-scim/pkg/v2/crud/expr"
 	"github.com/imulab/go-scim/pkg/v2/prop"
 	"github.com/imulab/go-scim/pkg/v2/spec"
 	"github.com/stretchr/testify/assert"
@@ -42,6 +44,19 @@ func (s *EvaluateTestSuite) TestEvaluate() {
 				assert.True(t, result)
 			},
 		},
+		{
+			name: `[id eq "foo\"bar"] evaluates to true against {"id":"foo\"bar"}`,
+			getResource: func(t *testing.T) *prop.Resource {
+				r := prop.NewResource(s.resourceType)
+				assert.False(t, r.Navigator().Dot("id").Replace(`foo"bar`).HasError())
+				return r
+			},
+			filter: fmt.Sprintf("id eq %s", expr.Quote(`foo"bar`)),
+			expect: func(t *testing.T, result bool, err error) {
+				assert.Nil(t, err)
+				assert.True(t, result)
+			},
+		},
 		{
 			name: `[id ne "foobar"] evaluates to false against {"id":"foobar"}`,
 			getResource: func(t *testing.T) *prop.Resource {
@@ -227,6 +242,63 @@ func (s *EvaluateTestSuite) TestEvaluate() {
 
 // Prepares a core schema with 'schemas', 'id', 'meta'('version', 'location') attributes, and a main schema
 // with 'emails'('value', 'primary') attributes. Aggregate the two schemas in the test resource type.
+func (s *EvaluateTestSuite) TestEvaluateRegex() {
+	expr.EnableRegexOperator(true)
+	defer expr.EnableRegexOperator(false)
+
+	r := prop.NewResource(s.resourceType)
+	assert.False(s.T(), r.Navigator().Dot("id").Replace("foo123").HasError())
+	assert.False(s.T(), r.Navigator().Dot("emails").Add(map[string]interface{}{"value": "Foo@Bar.com"}).HasError())
+
+	for _, each := range []struct {
+		filter string
+		expect bool
+	}{
+		{filter: `id re "^foo[0-9]+$"`, expect: true},
+		{filter: `id re "^FOO"`, expect: true}, // id is not caseExact in the test schema
+		{filter: `id re "bar"`, expect: false},
+		{filter: `emails.value re "^foo@bar\\.com$"`, expect: true},
+		{filter: `emails.value re "^bar"`, expect: false},
+	} {
+		result, err := Evaluate(r, each.filter)
+		assert.Nil(s.T(), err, each.filter)
+		assert.Equal(s.T(), each.expect, result, each.filter)
+	}
+
+	_, err := Evaluate(r, `id re "(unclosed"`)
+	assert.Equal(s.T(), spec.ErrInvalidFilter, errors.Unwrap(err))
+}
+
+func (s *EvaluateTestSuite) TestEvaluateDateTime() {
+	r := prop.NewResource(s.resourceType)
+	assert.False(s.T(), r.Navigator().Dot("lastLogin").Replace("2024-01-01T00:00:00.500Z").HasError())
+
+	for _, each := range []struct {
+		filter string
+		expect bool
+	}{
+		{filter: `lastLogin eq "2024-01-01T00:00:00.5"`, expect: true},
+		{filter: `lastLogin eq "2024-01-01T02:00:00.500+02:00"`, expect: true},
+		{filter: `lastLogin eq "2023-12-31T19:00:00.5-05:00"`, expect: true},
+		{filter: `lastLogin eq "2024-01-01T00:00:00Z"`, expect: false},
+		{filter: `lastLogin gt "2024-01-01T00:00:00+02:00"`, expect: true},
+		{filter: `lastLogin gt "2024-01-01T01:00:00+02:00"`, expect: true},
+		{filter: `lastLogin gt "2024-01-01T02:00:00+02:00"`, expect: true},
+		{filter: `lastLogin gt "2024-01-01T02:00:00.501+02:00"`, expect: false},
+		{filter: `lastLogin ge "2023-12-31T19:00:00.500-05:00"`, expect: true},
+		{filter: `lastLogin lt "2023-12-31T19:00:01-05:00"`, expect: true},
+		{filter: `lastLogin lt "2024-01-01T00:00:00.499Z"`, expect: false},
+		{filter: `lastLogin le "2024-01-01T00:00:00.500Z"`, expect: true},
+	} {
+		result, err := Evaluate(r, each.filter)
+		assert.Nil(s.T(), err, each.filter)
+		assert.Equal(s.T(), each.expect, result, each.filter)
+	}
+
+	_, err := Evaluate(r, `lastLogin gt "2024-01-01 00:00:00"`)
+	assert.Equal(s.T(), spec.ErrInvalidFilter, errors.Unwrap(err))
+}
+
 func (s *EvaluateTestSuite) SetupSuite() {
 	core := new(spec.Schema)
 	require.Nil(s.T(), json.Unmarshal([]byte(testCoreSchema), core))
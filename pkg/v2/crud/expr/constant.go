@@ -17,4 +17,6 @@ const (
 	Ge         = "ge"
 	Lt         = "lt"
 	Le         = "le"
+	// Re is the non-standard regular expression match operator, which must be enabled by EnableRegexOperator.
+	Re = "re"
 )
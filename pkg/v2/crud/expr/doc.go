@@ -1,3 +1,4 @@
 // This package implements compilers for SCIM path and SCIM filters, and defines the basic data structure for their
-// representation in memory.
+// representation in memory. External packages may analyze or translate the compiled expressions by inspecting the
+// Kind of each node and traversing the structure with Walk or Inspect, and render them back to strings with String.
 package expr
@@ -2,34 +2,69 @@ package expr
 
 import "strings"
 
+// Kinds of Expression nodes. A compiled SCIM path is a linked list of KindPath nodes, which may contain the root of a
+// filter. A compiled SCIM filter is a binary tree whose inner nodes are operators and whose leaf nodes are paths and
+// literals. Grouping (parenthesis) only affects the shape of the tree and does not produce nodes of its own; nodes of
+// KindParenthesis only appear temporarily during compilation.
 const (
-	path exprType = iota
-	logicalOp
-	relationalOp
-	literal
-	parenthesis
+	// KindPath is a segment of a SCIM path, i.e. "emails" or "value" in "emails.value".
+	KindPath Kind = iota
+	// KindLogicalOperator is one of the logical operators "and", "or" and "not". Binary operators have both left and
+	// right children; the "not" operator only has the left child.
+	KindLogicalOperator
+	// KindRelationalOperator is one of the relational operators such as "eq" and "pr". The left child is the head of
+	// the path the operator is applied to; the right child is the literal it compares against, or nil for "pr".
+	KindRelationalOperator
+	// KindLiteral is a value literal in the filter. Its Token is the raw text, i.e. string literals retain their quotes.
+	KindLiteral
+	// KindParenthesis is a left or right parenthesis.
+	KindParenthesis
 )
 
 type (
-	// type of expression
-	exprType int
+	// Kind is the kind of an Expression node.
+	Kind int
 	// Expression is the basic data structure that composes SCIM filters and SCIM paths. It doubles as a node in a
 	// single linked list when acting as a segment in SCIM paths, and a node in a binary tree when acting as a token
 	// in SCIM filters.
 	Expression struct {
 		token string
-		typ   exprType
+		typ   Kind
 		next  *Expression
 		left  *Expression
 		right *Expression
+		regex *regexes // compiled pattern of the "re" operator
 	}
 )
 
+// String returns the name of the Kind.
+func (k Kind) String() string {
+	switch k {
+	case KindPath:
+		return "path"
+	case KindLogicalOperator:
+		return "logicalOperator"
+	case KindRelationalOperator:
+		return "relationalOperator"
+	case KindLiteral:
+		return "literal"
+	case KindParenthesis:
+		return "parenthesis"
+	default:
+		return "unknown"
+	}
+}
+
 // Token returns the string representation of this Expression.
 func (e *Expression) Token() string {
 	return e.token
 }
 
+// Kind returns the kind of this Expression.
+func (e *Expression) Kind() Kind {
+	return e.typ
+}
+
 // Next returns the next Expression in the linked list, or nil if this Expression is the tail.
 func (e *Expression) Next() *Expression {
 	return e.next
@@ -47,7 +82,7 @@ func (e *Expression) Right() *Expression {
 
 // IsPath returns tree if this Expression represents a segment of a SCIM path.
 func (e *Expression) IsPath() bool {
-	return e.typ == path
+	return e.typ == KindPath
 }
 
 // IsOperator returns true if this Expression holds a SCIM filter operator (either logical or relational).
@@ -57,12 +92,12 @@ func (e *Expression) IsOperator() bool {
 
 // IsLogicalOperator returns true if this Expression holds a SCIM logical filter operator.
 func (e *Expression) IsLogicalOperator() bool {
-	return e.typ == logicalOp
+	return e.typ == KindLogicalOperator
 }
 
 // IsRelationalOperator returns true if this Expression holds a SCIM relational filter operator.
 func (e *Expression) IsRelationalOperator() bool {
-	return e.typ == relationalOp
+	return e.typ == KindRelationalOperator
 }
 
 // IsRootOfFilter returns true if this Expression, while being on the linked list, is also an operator. This indicates
@@ -74,22 +109,22 @@ func (e *Expression) IsRootOfFilter() bool {
 
 // IsLiteral returns true if this Expression represents a literal.
 func (e *Expression) IsLiteral() bool {
-	return e.typ == literal
+	return e.typ == KindLiteral
 }
 
 // IsParenthesis returns true if this Expression is a parenthesis
 func (e *Expression) IsParenthesis() bool {
-	return e.typ == parenthesis
+	return e.typ == KindParenthesis
 }
 
 // IsLeftParenthesis returns true if this Expression is a left parenthesis
 func (e *Expression) IsLeftParenthesis() bool {
-	return e.typ == parenthesis && e.token == LeftParen
+	return e.typ == KindParenthesis && e.token == LeftParen
 }
 
 // IsRightParenthesis returns true if this Expression is a right parenthesis
 func (e *Expression) IsRightParenthesis() bool {
-	return e.typ == parenthesis && e.token == RightParen
+	return e.typ == KindParenthesis && e.token == RightParen
 }
 
 // ContainsFilter returns true if the remaining of the path whose first node is represented
@@ -124,17 +159,18 @@ func (e *Expression) Walk(cb func(expression *Expression), marker *Expression, d
 	}
 }
 
+// Operators are case insensitive, and are always stored in lower case.
 func newOperator(op string) *Expression {
-	switch strings.ToLower(op) {
+	switch op = strings.ToLower(op); op {
 	case And, Or, Not:
 		return &Expression{
 			token: op,
-			typ:   logicalOp,
+			typ:   KindLogicalOperator,
 		}
-	case Eq, Ne, Sw, Ew, Co, Gt, Ge, Lt, Le, Pr:
+	case Eq, Ne, Sw, Ew, Co, Re, Gt, Ge, Lt, Le, Pr:
 		return &Expression{
 			token: op,
-			typ:   relationalOp,
+			typ:   KindRelationalOperator,
 		}
 	default:
 		panic("not an operator")
@@ -144,20 +180,20 @@ func newOperator(op string) *Expression {
 func newPath(pathName string) *Expression {
 	return &Expression{
 		token: pathName,
-		typ:   path,
+		typ:   KindPath,
 	}
 }
 
 func newLiteral(value string) *Expression {
 	return &Expression{
 		token: value,
-		typ:   literal,
+		typ:   KindLiteral,
 	}
 }
 
 func newParenthesis(paren string) *Expression {
 	return &Expression{
 		token: paren,
-		typ:   parenthesis,
+		typ:   KindParenthesis,
 	}
 }
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"github.com/imulab/go-scim/pkg/v2/spec"
 	"strings"
+	"time"
 )
 
 // CompileFilter compiles the given SCIM filter and return the root of the abstract syntax tree, or any error.
@@ -19,7 +20,25 @@ import (
 //	                     /  \
 //	                primary true
 //
+// When limits are in place (see SetLimits), filters exceeding the limits are rejected with spec.ErrInvalidFilter.
 func CompileFilter(filter string) (*Expression, error) {
+	observe := currentCompileObserver()
+	if observe == nil {
+		return compileFilter(filter)
+	}
+
+	start := time.Now()
+	root, err := compileFilter(filter)
+	observe(time.Since(start), err)
+	return root, err
+}
+
+func compileFilter(filter string) (*Expression, error) {
+	limits := currentLimits()
+	if limits.MaxLength > 0 && len(filter) > limits.MaxLength {
+		return nil, fmt.Errorf("%w: filter exceeds the maximum length of %d", spec.ErrInvalidFilter, limits.MaxLength)
+	}
+
 	compiler := &filterCompiler{
 		scan:    &filterScanner{},
 		data:    append(copyOf(filter), 0, 0),
@@ -75,7 +94,8 @@ func CompileFilter(filter string) (*Expression, error) {
 			minPriority := opPriority(step.token)
 			for {
 				popped := compiler.popOperatorIf(func(top *Expression) bool {
-					return opPriority(top.token) >= minPriority
+					// never pop beyond the enclosing left parenthesis
+					return top.IsOperator() && opPriority(top.token) >= minPriority
 				})
 				if popped != nil {
 					// ignore error. we are sure it won't err
@@ -91,11 +111,15 @@ func CompileFilter(filter string) (*Expression, error) {
 		}
 	}
 
-	// pop all remaining operators
+	// pop all remaining operators, none of which may be a left parenthesis left open
 	for len(compiler.opStack) > 0 {
-		_ = compiler.pushBuildResult(compiler.popOperatorIf(func(top *Expression) bool {
+		popped := compiler.popOperatorIf(func(top *Expression) bool {
 			return true
-		}))
+		})
+		if popped.IsLeftParenthesis() {
+			return nil, fmt.Errorf("%w: mismatched parenthesis", spec.ErrInvalidFilter)
+		}
+		_ = compiler.pushBuildResult(popped)
 	}
 
 	// assertion check
@@ -107,6 +131,13 @@ func CompileFilter(filter string) (*Expression, error) {
 	root := compiler.rsStack[0]
 	compiler.rsStack = nil
 
+	if limits.MaxDepth > 0 && depthExceeds(root, limits.MaxDepth) {
+		return nil, fmt.Errorf("%w: filter exceeds the maximum depth of %d", spec.ErrInvalidFilter, limits.MaxDepth)
+	}
+	if err := compileRegexes(root); err != nil {
+		return nil, err
+	}
+
 	return root, nil
 }
 
@@ -117,7 +148,7 @@ var (
 		switch strings.ToLower(op) {
 		case And, Or, Not:
 			return 50
-		case Eq, Ne, Sw, Ew, Co, Pr, Gt, Ge, Lt, Le:
+		case Eq, Ne, Sw, Ew, Co, Re, Pr, Gt, Ge, Lt, Le:
 			return 100
 		default:
 			panic("not an operator")
@@ -128,7 +159,7 @@ var (
 		switch strings.ToLower(op) {
 		case Not:
 			return false
-		case And, Or, Eq, Ne, Sw, Ew, Co, Pr, Gt, Ge, Lt, Le:
+		case And, Or, Eq, Ne, Sw, Ew, Co, Re, Pr, Gt, Ge, Lt, Le:
 			return true
 		default:
 			panic("not an operator")
@@ -139,7 +170,7 @@ var (
 		switch op {
 		case Not, Pr:
 			return 1
-		case And, Or, Eq, Ne, Sw, Ew, Co, Gt, Ge, Lt, Le:
+		case And, Or, Eq, Ne, Sw, Ew, Co, Re, Gt, Ge, Lt, Le:
 			return 2
 		default:
 			panic("not an operator")
@@ -630,6 +661,13 @@ func (fs *filterScanner) stateBeginOp(scan *filterScanner, c byte) int {
 		// sw
 		scan.step = fs.stateOpS
 		return scanFilterBeginOp
+	case 'r', 'R':
+		// re, when enabled
+		if !regexOperatorEnabled() {
+			return fs.error(c, "regex operator 're' is not enabled")
+		}
+		scan.step = fs.stateOpR
+		return scanFilterBeginOp
 	}
 
 	return fs.error(c, "invalid character in operator")
@@ -929,6 +967,28 @@ func (fs *filterScanner) stateOpSw(scan *filterScanner, c byte) int {
 	return fs.errInvalidOperator(c)
 }
 
+// Intermediate state in operator where last character was 'r' (case insensitive). The current character should be
+// 'e' (case insensitive) to lead to re relational operator.
+func (fs *filterScanner) stateOpR(scan *filterScanner, c byte) int {
+	if c == 'e' || c == 'E' {
+		scan.step = fs.stateOpRe
+		return scanFilterContinue
+	}
+
+	return fs.errInvalidOperator(c)
+}
+
+// Intermediate state in operator where last two characters were 'r' and 'e' (case insensitive). The current character
+// must end the operator with space.
+func (fs *filterScanner) stateOpRe(scan *filterScanner, c byte) int {
+	if c == ' ' {
+		scan.step = fs.stateBeginLiteral
+		return scanFilterEndOp
+	}
+
+	return fs.errInvalidOperator(c)
+}
+
 // Intermediate state at the start of a literal. We distinguish between string and non-string literal.
 func (fs *filterScanner) stateBeginLiteral(scan *filterScanner, c byte) int {
 	switch c {
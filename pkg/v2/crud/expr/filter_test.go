@@ -1,7 +1,10 @@
 package expr
 
 import (
+	"errors"
+	"github.com/imulab/go-scim/pkg/v2/spec"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"github.com/stretchr/testify/suite"
 	"testing"
 )
@@ -113,6 +116,25 @@ func (s *FilterTestSuite) TestFilterCompiler() {
 				assert.Equal(t, step, trail[2].typ)
 			},
 		},
+		{
+			name:   "logical operator inside parenthesis",
+			filter: "(username eq \"foo\" or age gt 10) and name pr",
+			assert: func(t *testing.T, trail []expect, err error) {
+				assert.Nil(t, err)
+				assert.Len(t, trail, 10)
+
+				assert.Equal(t, And, trail[0].value)
+				assert.Equal(t, Or, trail[1].value)
+				assert.Equal(t, Eq, trail[2].value)
+				assert.Equal(t, "username", trail[3].value)
+				assert.Equal(t, "\"foo\"", trail[4].value)
+				assert.Equal(t, Gt, trail[5].value)
+				assert.Equal(t, "age", trail[6].value)
+				assert.Equal(t, "10", trail[7].value)
+				assert.Equal(t, Pr, trail[8].value)
+				assert.Equal(t, "name", trail[9].value)
+			},
+		},
 		{
 			name:   "composite filter",
 			filter: "(username eq \"foo\") and (age gt 10)",
@@ -166,6 +188,34 @@ func (s *FilterTestSuite) TestFilterCompiler() {
 	}
 }
 
+func (s *FilterTestSuite) TestFilterParenthesis() {
+	tests := []struct {
+		filter string
+		expect string // the compiled filter, or empty if the filter is invalid
+	}{
+		{filter: `(a eq 1 or b eq 2) and c pr`, expect: `(a eq 1 or b eq 2) and c pr`},
+		{filter: `(a eq 1 and b eq 2 or c pr)`, expect: `(a eq 1 and b eq 2) or c pr`},
+		{filter: `(a pr or b pr) and (c pr or d pr)`, expect: `(a pr or b pr) and (c pr or d pr)`},
+		{filter: `not (a pr or b pr) and c pr`, expect: `not (a pr or b pr) and c pr`},
+		{filter: `((a pr or b pr) and c pr) or d pr`, expect: `((a pr or b pr) and c pr) or d pr`},
+		{filter: `(a pr`},
+		{filter: `((a pr or b pr)`},
+		{filter: `a pr)`},
+	}
+
+	for _, test := range tests {
+		s.T().Run(test.filter, func(t *testing.T) {
+			root, err := CompileFilter(test.filter)
+			if len(test.expect) == 0 {
+				assert.Equal(t, spec.ErrInvalidFilter, errors.Unwrap(err))
+				return
+			}
+			require.Nil(t, err)
+			assert.Equal(t, test.expect, root.String())
+		})
+	}
+}
+
 func (s *FilterTestSuite) TestFilterScanner() {
 	type signals struct {
 		event   int
@@ -0,0 +1,55 @@
+package expr
+
+import "sync/atomic"
+
+// Limits restricts the size of SCIM filters accepted by CompileFilter, so that pathological filters supplied by clients
+// cannot exhaust resources of the server, i.e. the stack of the recursive evaluation. A limit that is not positive is
+// not enforced.
+type Limits struct {
+	// MaxLength is the maximum number of bytes in the filter.
+	MaxLength int
+	// MaxDepth is the maximum depth of the operators in the compiled filter. For instance, the depth of
+	// "userName eq "foo"" is 1, and the depth of "not (userName pr and active eq true)" is 3.
+	MaxDepth int
+}
+
+// SetLimits puts the limits in place for all subsequent filter compilations. It is intended to be called once during
+// initialization. By default, no limits are enforced. Call SetLimits with a zero Limits to remove the limits.
+func SetLimits(l Limits) {
+	limits.Store(l)
+}
+
+var limits atomic.Value
+
+func init() {
+	limits.Store(Limits{})
+}
+
+func currentLimits() Limits {
+	return limits.Load().(Limits)
+}
+
+// Returns true if operators in the filter tree are nested deeper than max. The tree is traversed iteratively, so that
+// the check itself does not recurse as deep as the tree.
+func depthExceeds(root *Expression, max int) bool {
+	type frame struct {
+		e     *Expression
+		depth int
+	}
+
+	stack := []frame{{e: root, depth: 1}}
+	for len(stack) > 0 {
+		top := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		if top.depth > max {
+			return true
+		}
+		for _, child := range []*Expression{top.e.left, top.e.right} {
+			if child != nil && child.IsOperator() {
+				stack = append(stack, frame{e: child, depth: top.depth + 1})
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,68 @@
+package expr
+
+import (
+	"errors"
+	"github.com/imulab/go-scim/pkg/v2/spec"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+func TestLimits(t *testing.T) {
+	defer SetLimits(Limits{})
+
+	tests := []struct {
+		name   string
+		limits Limits
+		filter string
+		expect func(t *testing.T, err error)
+	}{
+		{
+			name:   "within limits",
+			limits: Limits{MaxLength: 64, MaxDepth: 3},
+			filter: `not (userName pr and active eq true)`,
+			expect: func(t *testing.T, err error) {
+				assert.Nil(t, err)
+			},
+		},
+		{
+			name:   "exceeds length",
+			limits: Limits{MaxLength: 16},
+			filter: `userName eq "imulab"`,
+			expect: func(t *testing.T, err error) {
+				assert.Equal(t, spec.ErrInvalidFilter, errors.Unwrap(err))
+			},
+		},
+		{
+			name:   "exceeds depth",
+			limits: Limits{MaxDepth: 2},
+			filter: `not (userName pr and active eq true)`,
+			expect: func(t *testing.T, err error) {
+				assert.Equal(t, spec.ErrInvalidFilter, errors.Unwrap(err))
+			},
+		},
+		{
+			name:   "long chain of operators",
+			limits: Limits{MaxDepth: 32},
+			filter: strings.Repeat("(", 100) + "userName pr" + strings.Repeat(")", 100) + strings.Repeat(" and id pr", 40),
+			expect: func(t *testing.T, err error) {
+				assert.Equal(t, spec.ErrInvalidFilter, errors.Unwrap(err))
+			},
+		},
+		{
+			name:   "no limits",
+			filter: strings.Repeat("not (", 100) + "userName pr" + strings.Repeat(")", 100),
+			expect: func(t *testing.T, err error) {
+				assert.Nil(t, err)
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			SetLimits(test.limits)
+			_, err := CompileFilter(test.filter)
+			test.expect(t, err)
+		})
+	}
+}
@@ -0,0 +1,177 @@
+package expr
+
+import (
+	"fmt"
+	"github.com/imulab/go-scim/pkg/v2/spec"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Normalize returns the canonical form of the compiled SCIM filter, so that filters differing only in notation
+// compile to structurally identical trees. This is useful when filters are used as cache keys, or recorded in audit
+// logs. The given filter is not modified. The canonical form is obtained by:
+//
+//   - replacing attribute paths with their schema-canonical casing, and removing the optional main schema URN prefix;
+//   - lowercasing operators, and rewriting literals in their canonical notation (i.e. TRUE to true);
+//   - removing double negations, and pushing negations towards the relational operators using De Morgan's laws, where
+//     "not (a eq b)" is further simplified to "a ne b" (and vice versa) when the path is singular;
+//   - flattening nested "and" and "or" operators of the same kind, removing duplicate operands, sorting the operands
+//     in a deterministic order and re-assembling them as a left leaning tree.
+//
+// An error of spec.ErrInvalidFilter is returned when the filter refers to attributes not defined by the resource type,
+// or contains nested filters in its attribute paths.
+func Normalize(filter *Expression, resourceType *spec.ResourceType) (*Expression, error) {
+	if filter == nil {
+		return nil, fmt.Errorf("%w: empty filter", spec.ErrInvalidFilter)
+	}
+	return normalizer{
+		resourceType: resourceType,
+		superAttr:    resourceType.SuperAttribute(true),
+	}.normalize(filter, false)
+}
+
+type normalizer struct {
+	resourceType *spec.ResourceType
+	superAttr    *spec.Attribute
+}
+
+// Normalize the filter rooted at e. When negate is true, returns the normalized form of "not e".
+func (n normalizer) normalize(e *Expression, negate bool) (*Expression, error) {
+	switch op := strings.ToLower(e.token); op {
+	case Not:
+		return n.normalize(e.left, !negate)
+	case And, Or:
+		if negate {
+			// De Morgan: not (a and b) = (not a) or (not b); not (a or b) = (not a) and (not b)
+			if op == And {
+				op = Or
+			} else {
+				op = And
+			}
+		}
+		operands := make([]*Expression, 0, 2)
+		for _, child := range []*Expression{e.left, e.right} {
+			c, err := n.normalize(child, negate)
+			if err != nil {
+				return nil, err
+			}
+			operands = flattenInto(operands, c, op)
+		}
+		return assemble(op, operands), nil
+	default:
+		return n.normalizeRelational(e, negate)
+	}
+}
+
+func (n normalizer) normalizeRelational(e *Expression, negate bool) (*Expression, error) {
+	path, attr, singular, err := n.normalizePath(e.left)
+	if err != nil {
+		return nil, err
+	}
+
+	rel := &Expression{
+		token: strings.ToLower(e.token),
+		typ:   KindRelationalOperator,
+		left:  path,
+		regex: e.regex,
+	}
+	if e.right != nil {
+		rel.right = newLiteral(canonicalLiteral(e.right.token, attr))
+	}
+
+	if !negate {
+		return rel, nil
+	}
+	// For multiValued paths, "not (emails.value eq x)" means no email is x, whereas "emails.value ne x" means some
+	// email is not x, hence the operator can only be flipped for singular paths.
+	switch {
+	case singular && rel.token == Eq:
+		rel.token = Ne
+		return rel, nil
+	case singular && rel.token == Ne:
+		rel.token = Eq
+		return rel, nil
+	default:
+		return &Expression{token: Not, typ: KindLogicalOperator, left: rel}, nil
+	}
+}
+
+// Returns a copy of the path with canonical segment names, along with the target attribute, and whether the path
+// is free of multiValued attributes.
+func (n normalizer) normalizePath(path *Expression) (*Expression, *spec.Attribute, bool, error) {
+	if path != nil && path.IsPath() && strings.ToLower(path.token) == strings.ToLower(n.resourceType.Schema().ID()) {
+		path = path.next
+	}
+	if path == nil {
+		return nil, nil, false, fmt.Errorf("%w: missing attribute path", spec.ErrInvalidFilter)
+	}
+
+	var (
+		head     = &Expression{}
+		tail     = head
+		cursor   = n.superAttr
+		singular = true
+	)
+	for ; path != nil; path = path.next {
+		if path.IsRootOfFilter() {
+			return nil, nil, false, fmt.Errorf("%w: nested filter is not supported", spec.ErrInvalidFilter)
+		}
+		if cursor.MultiValued() {
+			cursor = cursor.DeriveElementAttribute()
+		}
+		if cursor = cursor.SubAttributeForName(path.token); cursor == nil {
+			return nil, nil, false, fmt.Errorf("%w: no attribute for '%s'", spec.ErrInvalidFilter, path.token)
+		}
+		if cursor.MultiValued() {
+			singular = false
+		}
+		tail.next = newPath(cursor.Name())
+		tail = tail.next
+	}
+	return head.next, cursor, singular, nil
+}
+
+// Returns the literal in its canonical notation for the attribute type, or the literal itself if it does not parse.
+func canonicalLiteral(literal string, attr *spec.Attribute) string {
+	switch attr.Type() {
+	case spec.TypeBoolean:
+		if b, err := strconv.ParseBool(literal); err == nil {
+			return strconv.FormatBool(b)
+		}
+	case spec.TypeString, spec.TypeReference, spec.TypeBinary, spec.TypeDateTime:
+		if s, err := Unquote(literal); err == nil {
+			return Quote(s)
+		}
+	}
+	return literal
+}
+
+// Append the operand to the list, or its operands if it is a logical operator of the same kind.
+func flattenInto(operands []*Expression, e *Expression, op string) []*Expression {
+	if e.typ == KindLogicalOperator && e.token == op {
+		operands = flattenInto(operands, e.left, op)
+		return flattenInto(operands, e.right, op)
+	}
+	return append(operands, e)
+}
+
+// Sort and de-duplicate the operands, and assemble them into a left leaning tree using the logical operator.
+func assemble(op string, operands []*Expression) *Expression {
+	keys := make(map[*Expression]string, len(operands))
+	for _, each := range operands {
+		keys[each] = each.String()
+	}
+	sort.SliceStable(operands, func(i, j int) bool {
+		return keys[operands[i]] < keys[operands[j]]
+	})
+
+	root := operands[0]
+	for i := 1; i < len(operands); i++ {
+		if keys[operands[i]] == keys[operands[i-1]] {
+			continue
+		}
+		root = &Expression{token: op, typ: KindLogicalOperator, left: root, right: operands[i]}
+	}
+	return root
+}
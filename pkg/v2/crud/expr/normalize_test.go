@@ -0,0 +1,197 @@
+package expr
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/imulab/go-scim/pkg/v2/spec"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestNormalize(t *testing.T) {
+	s := new(NormalizeTestSuite)
+	suite.Run(t, s)
+}
+
+type NormalizeTestSuite struct {
+	suite.Suite
+	resourceType *spec.ResourceType
+}
+
+func (s *NormalizeTestSuite) TestNormalize() {
+	tests := []struct {
+		name   string
+		filter string
+		expect func(t *testing.T, normalized *Expression, err error)
+	}{
+		{
+			name:   "canonical casing",
+			filter: `USERNAME EQ "imulab"`,
+			expect: func(t *testing.T, normalized *Expression, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, `userName eq "imulab"`, normalized.String())
+			},
+		},
+		{
+			name:   "main schema urn prefix is removed",
+			filter: `urn:ietf:params:scim:schemas:core:2.0:User:name.FamilyName sw "Q"`,
+			expect: func(t *testing.T, normalized *Expression, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, `name.familyName sw "Q"`, normalized.String())
+			},
+		},
+		{
+			name:   "extension attribute",
+			filter: `URN:IETF:PARAMS:SCIM:SCHEMAS:EXTENSION:ENTERPRISE:2.0:USER:EMPLOYEENUMBER pr`,
+			expect: func(t *testing.T, normalized *Expression, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, `urn:ietf:params:scim:schemas:extension:enterprise:2.0:User:employeeNumber pr`, normalized.String())
+			},
+		},
+		{
+			name:   "canonical literal",
+			filter: `active eq TRUE`,
+			expect: func(t *testing.T, normalized *Expression, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, `active eq true`, normalized.String())
+			},
+		},
+		{
+			name:   "double negation",
+			filter: `not (not (userName pr))`,
+			expect: func(t *testing.T, normalized *Expression, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, `userName pr`, normalized.String())
+			},
+		},
+		{
+			name:   "negated singular equality",
+			filter: `not (userName eq "foo")`,
+			expect: func(t *testing.T, normalized *Expression, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, `userName ne "foo"`, normalized.String())
+			},
+		},
+		{
+			name:   "negated multiValued equality is retained",
+			filter: `not (emails.value eq "foo@bar.com")`,
+			expect: func(t *testing.T, normalized *Expression, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, `not (emails.value eq "foo@bar.com")`, normalized.String())
+			},
+		},
+		{
+			name:   "de morgan",
+			filter: `not (userName pr and active eq true)`,
+			expect: func(t *testing.T, normalized *Expression, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, `active ne true or not (userName pr)`, normalized.String())
+			},
+		},
+		{
+			name:   "commutative operands are ordered",
+			filter: `userName pr and active eq true`,
+			expect: func(t *testing.T, normalized *Expression, err error) {
+				assert.Nil(t, err)
+				other, err := CompileFilter(`active eq true and userName pr`)
+				require.Nil(t, err)
+				otherNormalized, err := Normalize(other, s.resourceType)
+				require.Nil(t, err)
+				assert.Equal(t, otherNormalized.String(), normalized.String())
+			},
+		},
+		{
+			name:   "nested grouping is flattened",
+			filter: `(title pr or (userName pr or nickName pr)) or title pr`,
+			expect: func(t *testing.T, normalized *Expression, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, `nickName pr or title pr or userName pr`, normalized.String())
+			},
+		},
+		{
+			name:   "unknown attribute",
+			filter: `foo eq "bar"`,
+			expect: func(t *testing.T, normalized *Expression, err error) {
+				assert.Equal(t, spec.ErrInvalidFilter, errors.Unwrap(err))
+			},
+		},
+	}
+
+	for _, test := range tests {
+		s.T().Run(test.name, func(t *testing.T) {
+			root, err := CompileFilter(test.filter)
+			require.Nil(t, err)
+			normalized, err := Normalize(root, s.resourceType)
+			test.expect(t, normalized, err)
+		})
+	}
+}
+
+func (s *NormalizeTestSuite) TestNormalizeDoesNotModifyFilter() {
+	root, err := CompileFilter(`not (USERNAME eq "foo")`)
+	require.Nil(s.T(), err)
+	before := root.String()
+
+	_, err = Normalize(root, s.resourceType)
+	assert.Nil(s.T(), err)
+	assert.Equal(s.T(), before, root.String())
+}
+
+func (s *NormalizeTestSuite) SetupSuite() {
+	for _, each := range []struct {
+		filepath  string
+		structure interface{}
+		post      func(parsed interface{})
+	}{
+		{
+			filepath:  "../../../../public/schemas/core_schema.json",
+			structure: new(spec.Schema),
+			post: func(parsed interface{}) {
+				spec.Schemas().Register(parsed.(*spec.Schema))
+			},
+		},
+		{
+			filepath:  "../../../../public/schemas/user_schema.json",
+			structure: new(spec.Schema),
+			post: func(parsed interface{}) {
+				spec.Schemas().Register(parsed.(*spec.Schema))
+			},
+		},
+		{
+			filepath:  "../../../../public/schemas/user_enterprise_extension_schema.json",
+			structure: new(spec.Schema),
+			post: func(parsed interface{}) {
+				spec.Schemas().Register(parsed.(*spec.Schema))
+			},
+		},
+		{
+			filepath:  "../../../../public/resource_types/user_resource_type.json",
+			structure: new(spec.ResourceType),
+			post: func(parsed interface{}) {
+				s.resourceType = parsed.(*spec.ResourceType)
+				RegisterURN(s.resourceType.Schema().ID())
+				_ = s.resourceType.ForEachExtension(func(extension *spec.Schema, required bool) error {
+					RegisterURN(extension.ID())
+					return nil
+				})
+			},
+		},
+	} {
+		f, err := os.Open(each.filepath)
+		require.Nil(s.T(), err)
+
+		raw, err := ioutil.ReadAll(f)
+		require.Nil(s.T(), err)
+
+		err = json.Unmarshal(raw, each.structure)
+		require.Nil(s.T(), err)
+
+		if each.post != nil {
+			each.post(each.structure)
+		}
+	}
+}
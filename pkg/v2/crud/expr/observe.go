@@ -0,0 +1,27 @@
+package expr
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// SetCompileObserver sets the function notified of the time spent by every call to CompileFilter, and of the error
+// returned, if any, i.e. to export metrics. It is intended to be called once during initialization. A nil function
+// removes the observer.
+func SetCompileObserver(f func(d time.Duration, err error)) {
+	compileObserver.Store(compileObserverHolder{f})
+}
+
+var compileObserver atomic.Value
+
+// atomic.Value requires values of the same concrete type.
+type compileObserverHolder struct {
+	f func(d time.Duration, err error)
+}
+
+func currentCompileObserver() func(d time.Duration, err error) {
+	if h, ok := compileObserver.Load().(compileObserverHolder); ok {
+		return h.f
+	}
+	return nil
+}
@@ -99,12 +99,12 @@ func (c *pathCompiler) scanStep() (*Expression, error) {
 		c.scanOne() // scan ahead to assist the next
 		return &Expression{
 			token: string(c.data[start:end]),
-			typ:   path,
+			typ:   KindPath,
 		}, nil
 	case scanPathBeginFilter:
 		return &Expression{
 			token: string(c.data[start:end]),
-			typ:   path,
+			typ:   KindPath,
 		}, nil
 	default:
 		return nil, c.errCompile()
@@ -115,6 +115,60 @@ func (s *PathTestSuite) TestPathCompiler() {
 				assert.Equal(t, step, trail[4].typ)
 			},
 		},
+		{
+			name: "path with logical filter",
+			path: `emails[type eq "work" and primary pr].value`,
+			assert: func(t *testing.T, trail []expect, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, []expect{
+					{value: "emails", typ: step},
+					{value: And, typ: operator},
+					{value: Eq, typ: operator},
+					{value: "type", typ: step},
+					{value: `"work"`, typ: literal},
+					{value: Pr, typ: operator},
+					{value: "primary", typ: step},
+					{value: "value", typ: step},
+				}, trail)
+			},
+		},
+		{
+			name: "path with negated filter",
+			path: `addresses[not (type eq "home")]`,
+			assert: func(t *testing.T, trail []expect, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, []expect{
+					{value: "addresses", typ: step},
+					{value: Not, typ: operator},
+					{value: Eq, typ: operator},
+					{value: "type", typ: step},
+					{value: `"home"`, typ: literal},
+				}, trail)
+			},
+		},
+		{
+			name: "path with grouped filter",
+			path: `emails[type eq "work" or (type eq "home" and not (primary eq true))].display`,
+			assert: func(t *testing.T, trail []expect, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, []expect{
+					{value: "emails", typ: step},
+					{value: Or, typ: operator},
+					{value: Eq, typ: operator},
+					{value: "type", typ: step},
+					{value: `"work"`, typ: literal},
+					{value: And, typ: operator},
+					{value: Eq, typ: operator},
+					{value: "type", typ: step},
+					{value: `"home"`, typ: literal},
+					{value: Not, typ: operator},
+					{value: Eq, typ: operator},
+					{value: "primary", typ: step},
+					{value: "true", typ: literal},
+					{value: "display", typ: step},
+				}, trail)
+			},
+		},
 	}
 
 	for _, test := range tests {
@@ -0,0 +1,66 @@
+package expr
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/imulab/go-scim/pkg/v2/spec"
+	"strings"
+)
+
+// Quote returns the value as a string literal that can be safely embedded in a SCIM filter. Double quotes, backslashes
+// and control characters are escaped according to JSON string syntax, which is the syntax of string literals in
+// SCIM filters. Other unicode characters are retained as they are. For instance, a user supplied value of
+//
+//	foo" or userName pr or "
+//
+// is quoted as
+//
+//	"foo\" or userName pr or \""
+//
+// which, when embedded in a filter, remains a single string literal instead of altering the filter.
+func Quote(value string) string {
+	var sb strings.Builder
+	sb.Grow(len(value) + 2)
+	sb.WriteByte('"')
+	for _, r := range value {
+		switch r {
+		case '"', '\\':
+			sb.WriteByte('\\')
+			sb.WriteRune(r)
+		case '\n':
+			sb.WriteString(`\n`)
+		case '\r':
+			sb.WriteString(`\r`)
+		case '\t':
+			sb.WriteString(`\t`)
+		default:
+			if r < 0x20 {
+				sb.WriteString(fmt.Sprintf(`\u%04x`, r))
+			} else {
+				sb.WriteRune(r)
+			}
+		}
+	}
+	sb.WriteByte('"')
+	return sb.String()
+}
+
+// Unquote interprets the string literal in a SCIM filter and returns the string value it represents. The literal must
+// be enclosed in double quotes, and may contain any escape sequences defined by JSON string syntax. An error of
+// spec.ErrInvalidFilter is returned if the literal is not a valid string literal.
+func Unquote(literal string) (string, error) {
+	if len(literal) < 2 || literal[0] != '"' || literal[len(literal)-1] != '"' {
+		return "", fmt.Errorf("%w: %s is not a string literal", spec.ErrInvalidFilter, literal)
+	}
+
+	// fast path: nothing to unescape
+	if !strings.ContainsAny(literal[1:len(literal)-1], `\"`) {
+		return literal[1 : len(literal)-1], nil
+	}
+
+	var value string
+	if err := json.Unmarshal([]byte(literal), &value); err != nil {
+		return "", fmt.Errorf("%w: %s is not a valid string literal", spec.ErrInvalidFilter, literal)
+	}
+	return value, nil
+}
@@ -0,0 +1,66 @@
+package expr
+
+import (
+	"errors"
+	"github.com/imulab/go-scim/pkg/v2/spec"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestQuote(t *testing.T) {
+	tests := []struct {
+		name   string
+		value  string
+		expect string
+	}{
+		{
+			name:   "plain",
+			value:  "foo",
+			expect: `"foo"`,
+		},
+		{
+			name:   "quotes and backslashes",
+			value:  `foo" or userName pr or "\`,
+			expect: `"foo\" or userName pr or \"\\"`,
+		},
+		{
+			name:   "control characters",
+			value:  "a\nb\tc\x01",
+			expect: `"a\nb\tc\u0001"`,
+		},
+		{
+			name:   "unicode is retained",
+			value:  "José 李",
+			expect: `"José 李"`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			quoted := Quote(test.value)
+			assert.Equal(t, test.expect, quoted)
+
+			// embedded value must remain a single literal
+			root, err := CompileFilter("userName eq " + quoted)
+			require.Nil(t, err)
+			assert.Equal(t, Eq, root.Token())
+			assert.Equal(t, quoted, root.Right().Token())
+
+			unquoted, err := Unquote(root.Right().Token())
+			assert.Nil(t, err)
+			assert.Equal(t, test.value, unquoted)
+		})
+	}
+}
+
+func TestUnquote(t *testing.T) {
+	s, err := Unquote(`"café \/ \"x\""`)
+	assert.Nil(t, err)
+	assert.Equal(t, `café / "x"`, s)
+
+	for _, bad := range []string{`foo`, `"foo`, `"`, `"foo\"`, `"\x"`} {
+		_, err := Unquote(bad)
+		assert.Equal(t, spec.ErrInvalidFilter, errors.Unwrap(err), bad)
+	}
+}
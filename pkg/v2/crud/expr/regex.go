@@ -0,0 +1,79 @@
+package expr
+
+import (
+	"fmt"
+	"github.com/imulab/go-scim/pkg/v2/spec"
+	"regexp"
+	"sync/atomic"
+)
+
+// EnableRegexOperator enables or disables the non-standard "re" operator, which matches string attributes against a
+// regular expression in RE2 syntax (see package regexp), i.e.
+//
+//	userName re "^[a-z]+\\.[a-z]+@example\\.com$"
+//
+// The operator is not defined by RFC7644 and is disabled by default, in which case filters containing it are rejected
+// by CompileFilter with spec.ErrInvalidFilter. It is intended to be called once during initialization.
+func EnableRegexOperator(enabled bool) {
+	if enabled {
+		atomic.StoreInt32(&regexOperator, 1)
+	} else {
+		atomic.StoreInt32(&regexOperator, 0)
+	}
+}
+
+var regexOperator int32
+
+func regexOperatorEnabled() bool {
+	return atomic.LoadInt32(&regexOperator) == 1
+}
+
+// Regexp returns the regular expression of the "re" operator, matching case insensitively unless caseExact. It is
+// compiled once by CompileFilter, which rejects invalid patterns with spec.ErrInvalidFilter, so that it is not
+// compiled again for every resource evaluated. It returns nil for
+// other expressions.
+func (e *Expression) Regexp(caseExact bool) *regexp.Regexp {
+	switch {
+	case e.regex == nil:
+		return nil
+	case caseExact:
+		return e.regex.exact
+	default:
+		return e.regex.fold
+	}
+}
+
+// regexes are the compiled pattern of the "re" operator, case sensitive and insensitive, as the case sensitivity
+// follows the attribute it is applied to, which is only known against the resource type.
+type regexes struct {
+	exact *regexp.Regexp
+	fold  *regexp.Regexp
+}
+
+// Compiles the patterns of the "re" operators in the filter tree, which must be valid regular expressions in string
+// literals. Like depthExceeds, the tree is traversed iteratively.
+func compileRegexes(root *Expression) error {
+	stack := []*Expression{root}
+	for len(stack) > 0 {
+		top := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		if top.token == Re && top.right != nil && top.right.IsLiteral() {
+			pattern, err := Unquote(top.right.token)
+			if err != nil {
+				return err
+			}
+			exact, err := regexp.Compile(pattern)
+			if err != nil {
+				return fmt.Errorf("%w: value '%s' is not a valid regular expression", spec.ErrInvalidFilter, top.right.token)
+			}
+			top.regex = &regexes{exact: exact, fold: regexp.MustCompile("(?i)" + pattern)}
+		}
+		for _, child := range []*Expression{top.left, top.right} {
+			if child != nil && child.IsOperator() {
+				stack = append(stack, child)
+			}
+		}
+	}
+	return nil
+}
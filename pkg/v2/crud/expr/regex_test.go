@@ -0,0 +1,43 @@
+package expr
+
+import (
+	"errors"
+	"github.com/imulab/go-scim/pkg/v2/spec"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestRegexOperator(t *testing.T) {
+	defer EnableRegexOperator(false)
+
+	EnableRegexOperator(false)
+	_, err := CompileFilter(`userName re "^foo"`)
+	assert.Equal(t, spec.ErrInvalidFilter, errors.Unwrap(err))
+
+	EnableRegexOperator(true)
+	root, err := CompileFilter(`userName RE "^foo" and id pr`)
+	require.Nil(t, err)
+	assert.Equal(t, And, root.Token())
+	assert.Equal(t, Re, root.Left().Token())
+	assert.Equal(t, KindRelationalOperator, root.Left().Kind())
+	assert.Equal(t, "userName", root.Left().Left().Token())
+	assert.Equal(t, `"^foo"`, root.Left().Right().Token())
+}
+
+func TestRegexOperatorPattern(t *testing.T) {
+	EnableRegexOperator(true)
+	defer EnableRegexOperator(false)
+
+	root, err := CompileFilter(`not (id pr or userName re "^foo")`)
+	require.Nil(t, err)
+	re := root.Left().Right()
+	require.NotNil(t, re.Regexp(true))
+	assert.True(t, re.Regexp(true).MatchString("foobar"))
+	assert.False(t, re.Regexp(true).MatchString("FOOBAR"))
+	assert.True(t, re.Regexp(false).MatchString("FOOBAR"))
+	assert.Nil(t, root.Left().Left().Regexp(true))
+
+	_, err = CompileFilter(`userName re "(unclosed"`)
+	assert.Equal(t, spec.ErrInvalidFilter, errors.Unwrap(err))
+}
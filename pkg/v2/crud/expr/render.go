@@ -0,0 +1,109 @@
+package expr
+
+import "strings"
+
+// String renders the SCIM path or SCIM filter rooted at this Expression back to its string form, so that compiling
+// the result again produces an identical tree. For path segments, the rest of the path is rendered as well; for
+// operators, the filter tree beneath is rendered. The output is normalized in that:
+//
+//   - operators are rendered in lower case, separated from their operands by a single space;
+//   - parentheses are only added where they are needed to retain the grouping (see needsParenthesis), and after "not";
+//   - string literals are re-quoted using Quote, and true, false and null are rendered in lower case;
+//   - segments following a schema URN are delimited by colon, and filters in paths are enclosed in brackets, i.e.
+//     emails[type eq "work"].value.
+//
+// String does not consult any schema. To also canonicalize attribute names, use Normalize before rendering.
+func (e *Expression) String() string {
+	if e == nil {
+		return ""
+	}
+	var sb strings.Builder
+	if e.typ == KindPath {
+		renderPath(&sb, e)
+	} else {
+		renderFilter(&sb, e)
+	}
+	return sb.String()
+}
+
+func renderPath(sb *strings.Builder, head *Expression) {
+	for p := head; p != nil; p = p.next {
+		if p.IsRootOfFilter() {
+			sb.WriteString("[")
+			renderFilter(sb, p)
+			sb.WriteString("]")
+		} else {
+			if p != head {
+				sb.WriteString(".")
+			}
+			sb.WriteString(p.token)
+		}
+		// schema URN segments are delimited by colon, i.e. urn:ietf:params:scim:schemas:extension:enterprise:2.0:User:employeeNumber
+		if p.next != nil && !p.IsRootOfFilter() && strings.HasPrefix(strings.ToLower(p.token), "urn:") {
+			sb.WriteString(":")
+			renderPath(sb, p.next)
+			return
+		}
+	}
+}
+
+func renderFilter(sb *strings.Builder, e *Expression) {
+	switch e.typ {
+	case KindLogicalOperator:
+		if e.token == Not {
+			sb.WriteString(Not + " (")
+			renderFilter(sb, e.left)
+			sb.WriteString(")")
+			return
+		}
+		renderOperand(sb, e.left, needsParenthesis(e, e.left, false))
+		sb.WriteString(" " + e.token + " ")
+		renderOperand(sb, e.right, needsParenthesis(e, e.right, true))
+	case KindRelationalOperator:
+		renderPath(sb, e.left)
+		sb.WriteString(" " + e.token)
+		if e.right != nil {
+			sb.WriteString(" " + renderLiteral(e.right.token))
+		}
+	case KindPath:
+		renderPath(sb, e)
+	default:
+		sb.WriteString(renderLiteral(e.token))
+	}
+}
+
+func renderOperand(sb *strings.Builder, operand *Expression, parenthesis bool) {
+	if parenthesis {
+		sb.WriteString("(")
+	}
+	renderFilter(sb, operand)
+	if parenthesis {
+		sb.WriteString(")")
+	}
+}
+
+// Returns true if the operand of the binary logical operator must be parenthesized to retain the shape of the tree.
+// The right operand is parenthesized if it is a binary logical operator, as compilation is left associative. The left
+// operand is parenthesized if it is a different binary logical operator: although this package treats "and" and "or"
+// with equal priority, RFC7644 gives "and" precedence over "or", and the output should mean the same to both.
+func needsParenthesis(parent *Expression, operand *Expression, right bool) bool {
+	if operand.typ != KindLogicalOperator || operand.token == Not {
+		return false
+	}
+	return right || operand.token != parent.token
+}
+
+func renderLiteral(literal string) string {
+	if strings.HasPrefix(literal, "\"") {
+		if s, err := Unquote(literal); err == nil {
+			return Quote(s)
+		}
+		return literal
+	}
+	switch lower := strings.ToLower(literal); lower {
+	case "true", "false", "null":
+		return lower
+	default:
+		return literal
+	}
+}
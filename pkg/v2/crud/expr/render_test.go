@@ -0,0 +1,68 @@
+package expr
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestExpressionString(t *testing.T) {
+	RegisterURN("urn:ietf:params:scim:schemas:extension:enterprise:2.0:User")
+
+	tests := []struct {
+		name   string
+		path   bool
+		input  string
+		expect string
+	}{
+		{name: "simple path", path: true, input: "userName", expect: "userName"},
+		{name: "dotted path", path: true, input: "name.familyName", expect: "name.familyName"},
+		{
+			name:   "urn path",
+			path:   true,
+			input:  "urn:ietf:params:scim:schemas:extension:enterprise:2.0:User:manager.value",
+			expect: "urn:ietf:params:scim:schemas:extension:enterprise:2.0:User:manager.value",
+		},
+		{
+			name:   "path with filter",
+			path:   true,
+			input:  `emails[type eq "work" and primary eq TRUE].value`,
+			expect: `emails[type eq "work" and primary eq true].value`,
+		},
+		{name: "presence", input: "title pr", expect: "title pr"},
+		{name: "operators in lower case", input: `userName EQ "imulab"`, expect: `userName eq "imulab"`},
+		{name: "escaped string", input: `userName eq "foo\"barA"`, expect: `userName eq "foo\"barA"`},
+		{name: "numbers", input: "age gt 18 and score le 9.5", expect: "age gt 18 and score le 9.5"},
+		{name: "same operator chain", input: "a pr and b pr and c pr", expect: "a pr and b pr and c pr"},
+		{name: "right grouping", input: "a pr and (b pr and c pr)", expect: "a pr and (b pr and c pr)"},
+		{name: "mixed operators", input: "(a pr or b pr) and c pr", expect: "(a pr or b pr) and c pr"},
+		{name: "redundant parenthesis", input: "((a pr)) and ((b pr))", expect: "a pr and b pr"},
+		{name: "not", input: "not (a pr) or not(b pr and c pr)", expect: "not (a pr) or not (b pr and c pr)"},
+		{
+			name:   "urn in filter",
+			input:  `urn:ietf:params:scim:schemas:extension:enterprise:2.0:User:employeeNumber sw "1"`,
+			expect: `urn:ietf:params:scim:schemas:extension:enterprise:2.0:User:employeeNumber sw "1"`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			compile := CompileFilter
+			if test.path {
+				compile = CompilePath
+			}
+
+			root, err := compile(test.input)
+			require.Nil(t, err)
+			assert.Equal(t, test.expect, root.String())
+
+			// the rendered string compiles to the same tree as the expected string, and renders to itself
+			again, err := compile(root.String())
+			require.Nil(t, err)
+			expected, err := compile(test.expect)
+			require.Nil(t, err)
+			assert.Equal(t, expected, again)
+			assert.Equal(t, test.expect, again.String())
+		})
+	}
+}
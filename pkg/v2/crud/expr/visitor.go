@@ -0,0 +1,62 @@
+package expr
+
+// Visitor visits the nodes of a compiled SCIM path or SCIM filter in Walk. The Visit method is invoked for each node
+// encountered by Walk. If the result visitor w is not nil, Walk visits each of the children of the node with the
+// visitor w, followed by a call of w.Visit(nil).
+//
+// The children of an operator are its left and right operands. For relational operators, the left operand is the head
+// of the path linked list, and the right operand is the literal (absent for "pr"). The children of a path segment are
+// the rest of the path, or, in case of a filtered path such as emails[type eq "work"].value, the filter root followed
+// by the rest of the path.
+type Visitor interface {
+	Visit(e *Expression) (w Visitor)
+}
+
+// Walk traverses the compiled SCIM path or SCIM filter in depth-first order: it starts by calling v.Visit(e); e must
+// not be nil. If the visitor w returned by v.Visit(e) is not nil, Walk is invoked recursively with visitor w for each
+// of the non-nil children of e, followed by a call of w.Visit(nil).
+//
+// Unlike the Walk method on Expression, which invokes a callback on every node in pre-order, this function lets the
+// visitor prune sub trees and observe when a sub tree has been completed, which is what translators and analyzers
+// need to keep track of their context.
+func Walk(v Visitor, e *Expression) {
+	if v = v.Visit(e); v == nil {
+		return
+	}
+
+	switch e.typ {
+	case KindLogicalOperator, KindRelationalOperator:
+		if e.left != nil {
+			Walk(v, e.left)
+		}
+		if e.right != nil {
+			Walk(v, e.right)
+		}
+		// A filter root situated inside a path (i.e. emails[type eq "work"].value) continues to the rest of the path.
+		if e.next != nil {
+			Walk(v, e.next)
+		}
+	case KindPath:
+		if e.next != nil {
+			Walk(v, e.next)
+		}
+	}
+
+	v.Visit(nil)
+}
+
+// Inspect traverses the compiled SCIM path or SCIM filter in depth-first order: it starts by calling f(e); e must not
+// be nil. If f returns true, Inspect invokes f recursively for each of the non-nil children of e, followed by a call
+// of f(nil).
+func Inspect(e *Expression, f func(e *Expression) bool) {
+	Walk(inspector(f), e)
+}
+
+type inspector func(e *Expression) bool
+
+func (f inspector) Visit(e *Expression) Visitor {
+	if f(e) {
+		return f
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+package expr
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"strings"
+	"testing"
+)
+
+func TestWalk(t *testing.T) {
+	RegisterURN("urn:ietf:params:scim:schemas:core:2.0:User")
+
+	tests := []struct {
+		name    string
+		compile func() (*Expression, error)
+		expect  string
+	}{
+		{
+			name: "relational filter",
+			compile: func() (*Expression, error) {
+				return CompileFilter(`name.familyName eq "Qiu"`)
+			},
+			expect: `relationalOperator:eq(path:name(path:familyName()) literal:"Qiu"())`,
+		},
+		{
+			name: "logical filter",
+			compile: func() (*Expression, error) {
+				return CompileFilter(`not (userName pr) and active eq true`)
+			},
+			expect: `logicalOperator:and(logicalOperator:not(relationalOperator:pr(path:userName())) relationalOperator:eq(path:active() literal:true()))`,
+		},
+		{
+			name: "path with filter",
+			compile: func() (*Expression, error) {
+				return CompilePath(`emails[type eq "work"].value`)
+			},
+			expect: `path:emails(relationalOperator:eq(path:type() literal:"work"() path:value()))`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			root, err := test.compile()
+			require.Nil(t, err)
+
+			p := &printer{}
+			Walk(p, root)
+			assert.Equal(t, test.expect, p.String())
+		})
+	}
+}
+
+func TestInspect(t *testing.T) {
+	root, err := CompileFilter(`(userName eq "foo" or emails.value ew "@foo.com") and active eq true`)
+	require.Nil(t, err)
+
+	var paths []string
+	Inspect(root, func(e *Expression) bool {
+		if e == nil {
+			return false
+		}
+		if e.Kind() == KindLogicalOperator && e.Token() == Or {
+			// prune the or branch
+			return false
+		}
+		if e.Kind() == KindPath {
+			paths = append(paths, e.Token())
+		}
+		return true
+	})
+	assert.Equal(t, []string{"active"}, paths)
+}
+
+// printer prints the visited nodes in the form of kind:token(children...).
+type printer struct {
+	strings.Builder
+	siblings []bool
+}
+
+func (p *printer) Visit(e *Expression) Visitor {
+	if e == nil {
+		p.WriteString(")")
+		p.siblings = p.siblings[:len(p.siblings)-1]
+		return nil
+	}
+	if n := len(p.siblings); n > 0 {
+		if p.siblings[n-1] {
+			p.WriteString(" ")
+		}
+		p.siblings[n-1] = true
+	}
+	p.WriteString(e.Kind().String() + ":" + e.Token() + "(")
+	p.siblings = append(p.siblings, false)
+	return p
+}
@@ -0,0 +1,213 @@
+package crud
+
+import (
+	"fmt"
+	"github.com/imulab/go-scim/pkg/v2/crud/expr"
+	"github.com/imulab/go-scim/pkg/v2/prop"
+	"github.com/imulab/go-scim/pkg/v2/spec"
+	"strings"
+)
+
+// ErrNotProjected is returned by EvaluateProjected when the result of the filter depends on attributes that were not
+// loaded under the projection. It wraps spec.ErrInternal, as it indicates the database has loaded too narrow a
+// resource to post-filter. Callers may use errors.Is to detect it and load the complete resource instead.
+var ErrNotProjected = fmt.Errorf("%w: projection does not load the attributes in filter", spec.ErrInternal)
+
+// Loads returns true if the attribute is loaded when a resource of the resource type is loaded with this projection,
+// as opposed to being left out by the projection. A nil projection, or one without attributes and excludedAttributes,
+// loads all attributes. An attribute is loaded if it, or any of its parent, is included in attributes, or if none of
+// it, its parents and its sub-attributes is included in excludedAttributes. Projected paths not defined in the resource
+// type are ignored.
+//
+// Note that a complex attribute is not regarded as loaded when only some of its sub-attributes are loaded, because
+// its absence in the loaded resource does not mean it is unassigned.
+func (p *Projection) Loads(attr *spec.Attribute, resourceType *spec.ResourceType) bool {
+	if p == nil {
+		return true
+	}
+	if len(p.Attributes) > 0 {
+		for _, each := range p.attributes(p.Attributes, resourceType) {
+			if isSelfOrAncestor(each, attr) {
+				return true
+			}
+		}
+		return false
+	}
+	return !overlapsAny(attr, p.attributes(p.ExcludedAttributes, resourceType))
+}
+
+// Covering returns a projection that, in addition to what this projection loads, also loads every attribute in the
+// SCIM filter, so that resources loaded with the returned projection can be post-filtered by EvaluateProjected. This
+// projection is not modified. A nil projection results in nil, as it loads all attributes already.
+func (p *Projection) Covering(filter string, resourceType *spec.ResourceType) (*Projection, error) {
+	attrs, err := filterAttributes(filter, resourceType)
+	if err != nil {
+		return nil, err
+	}
+	if p == nil {
+		return nil, nil
+	}
+
+	covering := &Projection{}
+	if len(p.Attributes) > 0 {
+		covering.Attributes = append(covering.Attributes, p.Attributes...)
+		for _, attr := range attrs {
+			if !p.Loads(attr, resourceType) {
+				covering.Attributes = append(covering.Attributes, attr.Path())
+			}
+		}
+		return covering, nil
+	}
+
+	v := newFilterValidator(resourceType)
+	for _, excluded := range p.ExcludedAttributes {
+		if head, err := expr.CompilePath(excluded); err == nil {
+			if each, err := v.resolvePath(head); err == nil && overlapsAny(each, attrs) {
+				continue
+			}
+		}
+		covering.ExcludedAttributes = append(covering.ExcludedAttributes, excluded)
+	}
+	return covering, nil
+}
+
+// EvaluateProjected is Evaluate for resources loaded with the projection, which may not carry all their attributes.
+// Unlike Evaluate, which treats attributes left out by the projection as unassigned, it only evaluates the terms on
+// attributes loaded with the projection (see Projection.Loads). The result is returned as long as it can be decided
+// from those terms, i.e. "userName eq "foo" or title pr" is true when userName matches regardless of title. Otherwise,
+// an error of ErrNotProjected is returned.
+func EvaluateProjected(resource *prop.Resource, filter string, projection *Projection) (bool, error) {
+	cf, err := expr.CompileFilter(filter)
+	if err != nil {
+		return false, err
+	}
+	if err := ValidateFilter(cf, resource.ResourceType()); err != nil {
+		return false, err
+	}
+
+	r, known, err := projectedEvaluator{
+		evaluator:  evaluator{base: resource.RootProperty(), filter: cf},
+		validator:  newFilterValidator(resource.ResourceType()),
+		projection: projection,
+	}.evaluate(cf)
+	if err != nil {
+		return false, err
+	}
+	if !known {
+		return false, fmt.Errorf("%w: cannot evaluate '%s'", ErrNotProjected, filter)
+	}
+	return r, nil
+}
+
+// Evaluates the filter under three valued logic, where terms on attributes not loaded are unknown.
+type projectedEvaluator struct {
+	evaluator  evaluator
+	validator  filterValidator
+	projection *Projection
+}
+
+func (v projectedEvaluator) evaluate(op *expr.Expression) (result bool, known bool, err error) {
+	switch op.Token() {
+	case expr.And, expr.Or:
+		// "and" is decided by any false operand, and "or" by any true operand.
+		decisive := op.Token() == expr.Or
+		l, lKnown, err := v.evaluate(op.Left())
+		if err != nil {
+			return false, false, err
+		} else if lKnown && l == decisive {
+			return decisive, true, nil
+		}
+		r, rKnown, err := v.evaluate(op.Right())
+		if err != nil {
+			return false, false, err
+		} else if rKnown && r == decisive {
+			return decisive, true, nil
+		}
+		return !decisive, lKnown && rKnown, nil
+	case expr.Not:
+		r, known, err := v.evaluate(op.Left())
+		return !r, known, err
+	}
+
+	attr, err := v.validator.resolve(op)
+	if err != nil {
+		return false, false, err
+	}
+	if !v.projection.Loads(attr, v.validator.resourceType) {
+		return false, false, nil
+	}
+	r, err := v.evaluator.evalAny(v.evaluator.base, op)
+	return r, true, err
+}
+
+// Resolves the attributes of the projected paths, skipping paths that cannot be resolved.
+func (p *Projection) attributes(paths []string, resourceType *spec.ResourceType) []*spec.Attribute {
+	v := newFilterValidator(resourceType)
+	attrs := make([]*spec.Attribute, 0, len(paths))
+	for _, path := range paths {
+		head, err := expr.CompilePath(path)
+		if err != nil {
+			continue
+		}
+		if attr, err := v.resolvePath(head); err == nil {
+			attrs = append(attrs, attr)
+		}
+	}
+	return attrs
+}
+
+// Returns the attributes targeted by the relational operators in the filter.
+func filterAttributes(filter string, resourceType *spec.ResourceType) ([]*spec.Attribute, error) {
+	cf, err := expr.CompileFilter(filter)
+	if err != nil {
+		return nil, err
+	}
+	if err := ValidateFilter(cf, resourceType); err != nil {
+		return nil, err
+	}
+
+	var (
+		v     = newFilterValidator(resourceType)
+		attrs = make([]*spec.Attribute, 0)
+		visit func(op *expr.Expression) error
+	)
+	visit = func(op *expr.Expression) error {
+		if op.IsLogicalOperator() {
+			if err := visit(op.Left()); err != nil {
+				return err
+			}
+			if op.Right() != nil {
+				return visit(op.Right())
+			}
+			return nil
+		}
+		attr, err := v.resolve(op)
+		if err != nil {
+			return err
+		}
+		attrs = append(attrs, attr)
+		return nil
+	}
+	if err := visit(cf); err != nil {
+		return nil, err
+	}
+	return attrs, nil
+}
+
+// Returns true if ancestor is the attribute itself, or one of its parents.
+func isSelfOrAncestor(ancestor *spec.Attribute, attr *spec.Attribute) bool {
+	if ancestor.ID() == attr.ID() {
+		return true
+	}
+	return strings.HasPrefix(attr.ID(), ancestor.ID()+".") || strings.HasPrefix(attr.ID(), ancestor.ID()+":")
+}
+
+// Returns true if the attribute is the same as, a parent of, or a child of any of the other attributes.
+func overlapsAny(attr *spec.Attribute, others []*spec.Attribute) bool {
+	for _, other := range others {
+		if isSelfOrAncestor(attr, other) || isSelfOrAncestor(other, attr) {
+			return true
+		}
+	}
+	return false
+}
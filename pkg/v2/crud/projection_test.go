@@ -0,0 +1,177 @@
+package crud
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/imulab/go-scim/pkg/v2/crud/expr"
+	"github.com/imulab/go-scim/pkg/v2/prop"
+	"github.com/imulab/go-scim/pkg/v2/spec"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestProjection(t *testing.T) {
+	s := new(ProjectionTestSuite)
+	suite.Run(t, s)
+}
+
+type ProjectionTestSuite struct {
+	suite.Suite
+	resourceType *spec.ResourceType
+}
+
+func (s *ProjectionTestSuite) TestLoads() {
+	attr := func(path string) *spec.Attribute {
+		head, err := expr.CompilePath(path)
+		require.Nil(s.T(), err)
+		a, err := newFilterValidator(s.resourceType).resolvePath(head)
+		require.Nil(s.T(), err)
+		return a
+	}
+
+	tests := []struct {
+		name       string
+		projection *Projection
+		loaded     []string
+		notLoaded  []string
+	}{
+		{
+			name:       "nil projection",
+			projection: nil,
+			loaded:     []string{"userName", "name.givenName", "emails.value"},
+		},
+		{
+			name:       "attributes",
+			projection: &Projection{Attributes: []string{"userName", "name", "emails.value", "urn:ietf:params:scim:schemas:core:2.0:User:title"}},
+			loaded:     []string{"userName", "name", "name.givenName", "emails.value", "title"},
+			notLoaded:  []string{"emails", "emails.type", "displayName", "id"},
+		},
+		{
+			name:       "excluded attributes",
+			projection: &Projection{ExcludedAttributes: []string{"name.givenName", "emails", "urn:ietf:params:scim:schemas:extension:enterprise:2.0:User:manager"}},
+			loaded:     []string{"userName", "name.familyName", "urn:ietf:params:scim:schemas:extension:enterprise:2.0:User:employeeNumber"},
+			notLoaded:  []string{"name", "name.givenName", "emails", "emails.value", "urn:ietf:params:scim:schemas:extension:enterprise:2.0:User:manager.value"},
+		},
+	}
+
+	for _, test := range tests {
+		s.T().Run(test.name, func(t *testing.T) {
+			for _, path := range test.loaded {
+				assert.True(t, test.projection.Loads(attr(path), s.resourceType), path)
+			}
+			for _, path := range test.notLoaded {
+				assert.False(t, test.projection.Loads(attr(path), s.resourceType), path)
+			}
+		})
+	}
+}
+
+func (s *ProjectionTestSuite) TestCovering() {
+	covering, err := (&Projection{Attributes: []string{"id", "name"}}).Covering(`userName eq "foo" or name.givenName pr`, s.resourceType)
+	assert.Nil(s.T(), err)
+	assert.Equal(s.T(), []string{"id", "name", "userName"}, covering.Attributes)
+
+	covering, err = (&Projection{ExcludedAttributes: []string{"name", "emails.type", "title"}}).Covering(`name.givenName pr and emails pr`, s.resourceType)
+	assert.Nil(s.T(), err)
+	assert.Equal(s.T(), []string{"title"}, covering.ExcludedAttributes)
+
+	covering, err = (*Projection)(nil).Covering(`userName pr`, s.resourceType)
+	assert.Nil(s.T(), err)
+	assert.Nil(s.T(), covering)
+
+	_, err = (&Projection{Attributes: []string{"id"}}).Covering(`foo pr`, s.resourceType)
+	assert.True(s.T(), errors.Is(err, spec.ErrInvalidFilter))
+}
+
+func (s *ProjectionTestSuite) TestEvaluateProjected() {
+	r := prop.NewResource(s.resourceType)
+	require.Nil(s.T(), r.Navigator().Replace(map[string]interface{}{
+		"id":       "foo",
+		"userName": "foo",
+	}).Error())
+	projection := &Projection{Attributes: []string{"id", "userName"}}
+
+	for _, each := range []struct {
+		filter string
+		expect bool
+		err    error
+	}{
+		{filter: `userName eq "foo"`, expect: true},
+		{filter: `userName eq "foo" or title pr`, expect: true},
+		{filter: `title pr or userName eq "foo"`, expect: true},
+		{filter: `userName eq "bar" and title pr`, expect: false},
+		{filter: `not (userName eq "bar" and title pr)`, expect: true},
+		{filter: `userName eq "foo" and title pr`, err: ErrNotProjected},
+		{filter: `userName eq "bar" or title pr`, err: ErrNotProjected},
+		{filter: `not (title pr)`, err: ErrNotProjected},
+	} {
+		result, err := EvaluateProjected(r, each.filter, projection)
+		if each.err != nil {
+			assert.True(s.T(), errors.Is(err, each.err), each.filter)
+			assert.True(s.T(), errors.Is(err, spec.ErrInternal), each.filter)
+			continue
+		}
+		assert.Nil(s.T(), err, each.filter)
+		assert.Equal(s.T(), each.expect, result, each.filter)
+	}
+
+	// title not loaded, but unassigned under a nil projection
+	result, err := EvaluateProjected(r, `userName eq "foo" and not (title pr)`, nil)
+	assert.Nil(s.T(), err)
+	assert.True(s.T(), result)
+}
+
+func (s *ProjectionTestSuite) SetupSuite() {
+	for _, each := range []struct {
+		filepath  string
+		structure interface{}
+		post      func(parsed interface{})
+	}{
+		{
+			filepath:  "../../../public/schemas/core_schema.json",
+			structure: new(spec.Schema),
+			post: func(parsed interface{}) {
+				spec.Schemas().Register(parsed.(*spec.Schema))
+			},
+		},
+		{
+			filepath:  "../../../public/schemas/user_schema.json",
+			structure: new(spec.Schema),
+			post: func(parsed interface{}) {
+				spec.Schemas().Register(parsed.(*spec.Schema))
+			},
+		},
+		{
+			filepath:  "../../../public/schemas/user_enterprise_extension_schema.json",
+			structure: new(spec.Schema),
+			post: func(parsed interface{}) {
+				spec.Schemas().Register(parsed.(*spec.Schema))
+			},
+		},
+		{
+			filepath:  "../../../public/resource_types/user_resource_type.json",
+			structure: new(spec.ResourceType),
+			post: func(parsed interface{}) {
+				s.resourceType = parsed.(*spec.ResourceType)
+				Register(s.resourceType)
+			},
+		},
+	} {
+		f, err := os.Open(each.filepath)
+		require.Nil(s.T(), err)
+
+		raw, err := ioutil.ReadAll(f)
+		require.Nil(s.T(), err)
+
+		err = json.Unmarshal(raw, each.structure)
+		require.Nil(s.T(), err)
+
+		if each.post != nil {
+			each.post(each.structure)
+		}
+	}
+}
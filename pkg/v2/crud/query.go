@@ -1,9 +1,12 @@
 package crud
 
 import (
+	"fmt"
 	"github.com/imulab/go-scim/pkg/v2/crud/expr"
 	"github.com/imulab/go-scim/pkg/v2/prop"
+	"github.com/imulab/go-scim/pkg/v2/spec"
 	"sort"
+	"strings"
 )
 
 // Order for sorting
@@ -32,84 +35,171 @@ type (
 		StartIndex int // 1-based start index
 		Count      int
 	}
+	// Option to paginate using cursors, as an alternative to Pagination. See Cursor.
+	CursorPagination struct {
+		Cursor string // opaque cursor returned as nextCursor by the previous page, or empty for the first page
+		Count  int    // maximum number of resources in the page, or all remaining resources when not positive
+	}
 )
 
-// Sort the given list of resources according to the sort options.
-func (s Sort) Sort(resources []*prop.Resource) error {
-	if len(resources) <= 1 {
-		return nil
-	} else if len(s.By) == 0 {
-		return nil
+// SortKey is one of the attributes to sort by, along with its order. See Sort.Keys.
+type SortKey struct {
+	By    string
+	Order SortOrder
+}
+
+// Keys returns the sort keys described by the sort option. Multiple attributes can be specified in By as a comma
+// separated list (i.e. name.familyName,name.givenName), in which case resources are ordered by the first attribute,
+// then by the second attribute among those with equal first attributes, and so on. Order can be a single order that
+// applies to all attributes, or a comma separated list of orders with one order for each attribute (i.e.
+// ascending,descending). An error of spec.ErrInvalidSyntax is returned if the orders do not match the attributes, or
+// if any order is invalid. Empty By results in no keys.
+func (s Sort) Keys() ([]SortKey, error) {
+	if len(strings.TrimSpace(s.By)) == 0 {
+		return nil, nil
+	}
+
+	paths := strings.Split(s.By, ",")
+	orders := strings.Split(string(s.Order), ",")
+	if len(orders) != 1 && len(orders) != len(paths) {
+		return nil, fmt.Errorf("%w: %d sortOrder for %d sortBy attributes", spec.ErrInvalidSyntax, len(orders), len(paths))
+	}
+
+	keys := make([]SortKey, 0, len(paths))
+	for i, path := range paths {
+		key := SortKey{By: strings.TrimSpace(path)}
+		if len(orders) == 1 {
+			key.Order = SortOrder(strings.TrimSpace(orders[0]))
+		} else {
+			key.Order = SortOrder(strings.TrimSpace(orders[i]))
+		}
+		if len(key.By) == 0 {
+			return nil, fmt.Errorf("%w: empty attribute in sortBy '%s'", spec.ErrInvalidSyntax, s.By)
+		}
+		switch key.Order {
+		case SortDefault, SortAsc, SortDesc:
+		default:
+			return nil, fmt.Errorf("%w: invalid sortOrder '%s'", spec.ErrInvalidSyntax, key.Order)
+		}
+		keys = append(keys, key)
 	}
+	return keys, nil
+}
 
-	head, err := expr.CompilePath(s.By)
+// Sort the given list of resources according to the sort options. The sort is stable, and resources that compare
+// equal on all sort keys are ordered by their id, so that the order is deterministic across pages. In ascending order,
+// resources without a value for the sort attribute are placed last; in descending order, they are placed first.
+func (s Sort) Sort(resources []*prop.Resource) error {
+	keys, paths, err := s.compile()
 	if err != nil {
 		return err
 	}
+	if len(resources) <= 1 || len(keys) == 0 {
+		return nil
+	}
+
+	// Seek the sort targets once per resource and key, rather than once per comparison.
+	rows := make([]sortRow, len(resources))
+	for i, r := range resources {
+		rows[i] = sortRow{resource: r, targets: seekSortTargets(r, paths)}
+	}
 
-	sort.Sort(&sortWrapper{
-		resources: resources,
-		by:        head,
-		dir:       s.Order,
+	sort.SliceStable(rows, func(i, j int) bool {
+		for k, key := range keys {
+			c := compareSortTargets(rows[i].targets[k], rows[j].targets[k])
+			if c == 0 {
+				continue
+			}
+			if key.Order == SortDesc {
+				return c > 0
+			}
+			return c < 0
+		}
+		return rows[i].resource.IdOrEmpty() < rows[j].resource.IdOrEmpty()
 	})
-	return nil
-}
 
-type sortWrapper struct {
-	by        *expr.Expression
-	dir       SortOrder
-	resources []*prop.Resource
+	for i := range rows {
+		resources[i] = rows[i].resource
+	}
+	return nil
 }
 
-func (s *sortWrapper) Len() int {
-	return len(s.resources)
+// Page returns the page of the given list of resources, which starts at the 1-based StartIndex and holds at most Count
+// resources. A StartIndex less than 1 is treated as 1, and the page is empty when it starts beyond the resources, or
+// when Count is not positive.
+func (p Pagination) Page(resources []*prop.Resource) []*prop.Resource {
+	lb := p.StartIndex - 1
+	if lb < 0 {
+		lb = 0
+	}
+	if lb > len(resources) {
+		lb = len(resources)
+	}
+	ub := lb
+	if p.Count > 0 {
+		ub += p.Count
+	}
+	if ub > len(resources) {
+		ub = len(resources)
+	}
+	return resources[lb:ub]
 }
 
-func (s *sortWrapper) Less(i, j int) bool {
-	var (
-		a   prop.Property
-		b   prop.Property
-		err error
-	)
-
-	a, err = SeekSortTarget(s.resources[i], s.by)
+// Returns the sort keys, along with their compiled paths.
+func (s Sort) compile() ([]SortKey, []*expr.Expression, error) {
+	keys, err := s.Keys()
 	if err != nil {
-		switch s.dir {
-		case SortDefault, SortAsc:
-			return false
-		case SortDesc:
-			return true
-		default:
-			panic("invalid sortOrder")
-		}
+		return nil, nil, err
 	}
 
-	b, err = SeekSortTarget(s.resources[j], s.by)
-	if err != nil {
-		switch s.dir {
-		case SortDefault, SortAsc:
-			return true
-		case SortDesc:
-			return false
-		default:
-			panic("invalid sortOrder")
+	paths := make([]*expr.Expression, 0, len(keys))
+	for _, key := range keys {
+		head, err := expr.CompilePath(key.By)
+		if err != nil {
+			return nil, nil, err
 		}
+		paths = append(paths, head)
 	}
+	return keys, paths, nil
+}
 
-	if ltCapable, ok := a.(prop.LtCapable); !ok {
-		return false
-	} else {
-		switch s.dir {
-		case SortDefault, SortAsc:
-			return ltCapable.LessThan(b.Raw())
-		case SortDesc:
-			return !ltCapable.LessThan(b.Raw())
-		default:
-			panic("invalid sortOrder")
+// Returns the sort target of the resource for each of the paths, or nil if the target is absent.
+func seekSortTargets(resource *prop.Resource, paths []*expr.Expression) []prop.Property {
+	targets := make([]prop.Property, len(paths))
+	for k, head := range paths {
+		if target, err := SeekSortTarget(resource, head); err == nil && !target.IsUnassigned() {
+			targets[k] = target
 		}
 	}
+	return targets
+}
+
+type sortRow struct {
+	resource *prop.Resource
+	targets  []prop.Property
 }
 
-func (s *sortWrapper) Swap(i, j int) {
-	s.resources[i], s.resources[j] = s.resources[j], s.resources[i]
+// Compare the two sort targets, returning a negative number if a comes before b in ascending order, a positive number
+// if a comes after b, or zero if they are equal or incomparable. Absent targets come after present ones.
+func compareSortTargets(a, b prop.Property) int {
+	switch {
+	case a == nil && b == nil:
+		return 0
+	case a == nil:
+		return 1
+	case b == nil:
+		return -1
+	}
+
+	lt, ok := a.(prop.LtCapable)
+	if !ok {
+		return 0
+	}
+	if lt.LessThan(b.Raw()) {
+		return -1
+	}
+	if gt, ok := a.(prop.GtCapable); ok && gt.GreaterThan(b.Raw()) {
+		return 1
+	}
+	return 0
 }
@@ -0,0 +1,313 @@
+package crud
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/imulab/go-scim/pkg/v2/prop"
+	"github.com/imulab/go-scim/pkg/v2/spec"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestSort(t *testing.T) {
+	s := new(SortTestSuite)
+	suite.Run(t, s)
+}
+
+type SortTestSuite struct {
+	suite.Suite
+	resourceType *spec.ResourceType
+}
+
+func (s *SortTestSuite) TestKeys() {
+	tests := []struct {
+		name   string
+		sort   Sort
+		expect func(t *testing.T, keys []SortKey, err error)
+	}{
+		{
+			name: "empty sortBy",
+			sort: Sort{Order: SortDesc},
+			expect: func(t *testing.T, keys []SortKey, err error) {
+				assert.Nil(t, err)
+				assert.Empty(t, keys)
+			},
+		},
+		{
+			name: "single order applies to all attributes",
+			sort: Sort{By: "name.familyName, name.givenName", Order: SortDesc},
+			expect: func(t *testing.T, keys []SortKey, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, []SortKey{
+					{By: "name.familyName", Order: SortDesc},
+					{By: "name.givenName", Order: SortDesc},
+				}, keys)
+			},
+		},
+		{
+			name: "one order per attribute",
+			sort: Sort{By: "name.familyName,name.givenName", Order: "descending,"},
+			expect: func(t *testing.T, keys []SortKey, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, []SortKey{
+					{By: "name.familyName", Order: SortDesc},
+					{By: "name.givenName", Order: SortDefault},
+				}, keys)
+			},
+		},
+		{
+			name: "mismatched orders",
+			sort: Sort{By: "a,b,c", Order: "ascending,descending"},
+			expect: func(t *testing.T, keys []SortKey, err error) {
+				assert.Equal(t, spec.ErrInvalidSyntax, errors.Unwrap(err))
+			},
+		},
+		{
+			name: "invalid order",
+			sort: Sort{By: "a,b", Order: "ascending,upwards"},
+			expect: func(t *testing.T, keys []SortKey, err error) {
+				assert.Equal(t, spec.ErrInvalidSyntax, errors.Unwrap(err))
+			},
+		},
+		{
+			name: "empty attribute",
+			sort: Sort{By: "a,,b"},
+			expect: func(t *testing.T, keys []SortKey, err error) {
+				assert.Equal(t, spec.ErrInvalidSyntax, errors.Unwrap(err))
+			},
+		},
+	}
+
+	for _, test := range tests {
+		s.T().Run(test.name, func(t *testing.T) {
+			keys, err := test.sort.Keys()
+			test.expect(t, keys, err)
+		})
+	}
+}
+
+func (s *SortTestSuite) TestSort() {
+	tests := []struct {
+		name   string
+		sort   Sort
+		expect []string
+	}{
+		{
+			name:   "single attribute breaks ties by id",
+			sort:   Sort{By: "name.familyName"},
+			expect: []string{"1", "3", "4", "2", "5"},
+		},
+		{
+			name:   "single attribute descending breaks ties by id ascending",
+			sort:   Sort{By: "name.familyName", Order: SortDesc},
+			expect: []string{"5", "2", "1", "3", "4"},
+		},
+		{
+			name:   "multiple attributes",
+			sort:   Sort{By: "name.familyName,name.givenName"},
+			expect: []string{"3", "4", "1", "2", "5"},
+		},
+		{
+			name:   "multiple attributes with per attribute order",
+			sort:   Sort{By: "name.familyName,name.givenName", Order: "ascending,descending"},
+			expect: []string{"1", "3", "4", "2", "5"},
+		},
+		{
+			name:   "multiValued complex sub attribute uses primary or first element",
+			sort:   Sort{By: "emails.value"},
+			expect: []string{"2", "3", "4", "1", "5"},
+		},
+		{
+			name:   "multiValued complex attribute uses value of primary or first element",
+			sort:   Sort{By: "emails", Order: SortDesc},
+			expect: []string{"5", "1", "4", "3", "2"},
+		},
+		{
+			name:   "main schema urn prefix",
+			sort:   Sort{By: "urn:ietf:params:scim:schemas:core:2.0:User:emails.value"},
+			expect: []string{"2", "3", "4", "1", "5"},
+		},
+		{
+			name:   "case insensitive attribute",
+			sort:   Sort{By: "userName"},
+			expect: []string{"4", "3", "2", "1", "5"},
+		},
+	}
+
+	for _, test := range tests {
+		s.T().Run(test.name, func(t *testing.T) {
+			resources := []*prop.Resource{
+				s.newUser(t, "5", "eve", "", ""),
+				s.newUser(t, "3", "Bob", "Adams", "Alice"),
+				s.newUser(t, "1", "Dan", "Adams", "Bob"),
+				s.newUser(t, "4", "alice", "Adams", "Alice"),
+				s.newUser(t, "2", "carol", "Brown", "Carol"),
+			}
+			s.addEmails(t, resources[1], "d@x.com", map[string]interface{}{"value": "b@x.com", "primary": true})
+			s.addEmails(t, resources[2], "e@x.com", map[string]interface{}{"value": "a@x.com"})
+			s.addEmails(t, resources[3], "c@x.com")
+			s.addEmails(t, resources[4], "A@x.com", map[string]interface{}{"value": "z@x.com", "primary": false})
+			assert.Nil(t, test.sort.Sort(resources))
+
+			ids := make([]string, 0, len(resources))
+			for _, r := range resources {
+				ids = append(ids, r.IdOrEmpty())
+			}
+			assert.Equal(t, test.expect, ids)
+		})
+	}
+}
+
+func (s *SortTestSuite) TestAfter() {
+	resources := []*prop.Resource{
+		s.newUser(s.T(), "5", "eve", "", ""),
+		s.newUser(s.T(), "3", "Bob", "Adams", "Alice"),
+		s.newUser(s.T(), "1", "Dan", "Adams", "Bob"),
+		s.newUser(s.T(), "4", "alice", "Adams", "Alice"),
+		s.newUser(s.T(), "2", "carol", "Brown", "Carol"),
+	}
+	ids := func(resources []*prop.Resource) []string {
+		ids := make([]string, 0, len(resources))
+		for _, r := range resources {
+			ids = append(ids, r.IdOrEmpty())
+		}
+		return ids
+	}
+
+	for _, sort := range []Sort{
+		{By: "name.familyName,name.givenName"},
+		{By: "name.familyName", Order: SortDesc},
+		{By: "userName"},
+		{By: "id", Order: SortDesc},
+	} {
+		require.Nil(s.T(), sort.Sort(resources))
+		sorted := append([]*prop.Resource{}, resources...)
+
+		for i, r := range sorted {
+			cursor, err := NewCursor(r, sort)
+			require.Nil(s.T(), err)
+
+			// round trip through the opaque form
+			parsed, err := ParseCursor(cursor.String())
+			require.Nil(s.T(), err)
+
+			after, err := sort.After(sorted, parsed)
+			assert.Nil(s.T(), err)
+			assert.Equal(s.T(), ids(sorted[i+1:]), ids(after), sort.By)
+		}
+	}
+
+	_, err := ParseCursor("not a cursor")
+	assert.Equal(s.T(), spec.ErrInvalidCursor, errors.Unwrap(err))
+
+	cursor, err := NewCursor(resources[0], Sort{By: "userName"})
+	require.Nil(s.T(), err)
+	_, err = Sort{By: "userName,id"}.After(resources, cursor)
+	assert.Equal(s.T(), spec.ErrInvalidCursor, errors.Unwrap(err))
+}
+
+func (s *SortTestSuite) TestPage() {
+	resources := []*prop.Resource{
+		s.newUser(s.T(), "1", "alice", "", ""),
+		s.newUser(s.T(), "2", "bob", "", ""),
+		s.newUser(s.T(), "3", "carol", "", ""),
+	}
+
+	tests := []struct {
+		name       string
+		pagination Pagination
+		expect     []string
+	}{
+		{name: "first page", pagination: Pagination{StartIndex: 1, Count: 2}, expect: []string{"1", "2"}},
+		{name: "last page", pagination: Pagination{StartIndex: 3, Count: 2}, expect: []string{"3"}},
+		{name: "start index less than 1", pagination: Pagination{StartIndex: 0, Count: 1}, expect: []string{"1"}},
+		{name: "start index beyond resources", pagination: Pagination{StartIndex: 5, Count: 2}, expect: []string{}},
+		{name: "zero count", pagination: Pagination{StartIndex: 1}, expect: []string{}},
+	}
+
+	for _, test := range tests {
+		s.T().Run(test.name, func(t *testing.T) {
+			ids := []string{}
+			for _, r := range test.pagination.Page(resources) {
+				ids = append(ids, r.IdOrEmpty())
+			}
+			assert.Equal(t, test.expect, ids)
+		})
+	}
+}
+
+func (s *SortTestSuite) newUser(t *testing.T, id string, userName string, familyName string, givenName string) *prop.Resource {
+	r := prop.NewResource(s.resourceType)
+	assert.False(t, r.Navigator().Dot("id").Replace(id).HasError())
+	assert.False(t, r.Navigator().Dot("userName").Replace(userName).HasError())
+	if len(familyName) > 0 {
+		assert.False(t, r.Navigator().Dot("name").Dot("familyName").Replace(familyName).HasError())
+	}
+	if len(givenName) > 0 {
+		assert.False(t, r.Navigator().Dot("name").Dot("givenName").Replace(givenName).HasError())
+	}
+	return r
+}
+
+func (s *SortTestSuite) addEmails(t *testing.T, r *prop.Resource, first string, others ...map[string]interface{}) {
+	emails := []interface{}{map[string]interface{}{"value": first}}
+	for _, other := range others {
+		emails = append(emails, other)
+	}
+	assert.False(t, r.Navigator().Dot("emails").Add(emails).HasError())
+}
+
+func (s *SortTestSuite) SetupSuite() {
+	for _, each := range []struct {
+		filepath  string
+		structure interface{}
+		post      func(parsed interface{})
+	}{
+		{
+			filepath:  "../../../public/schemas/core_schema.json",
+			structure: new(spec.Schema),
+			post: func(parsed interface{}) {
+				spec.Schemas().Register(parsed.(*spec.Schema))
+			},
+		},
+		{
+			filepath:  "../../../public/schemas/user_schema.json",
+			structure: new(spec.Schema),
+			post: func(parsed interface{}) {
+				spec.Schemas().Register(parsed.(*spec.Schema))
+			},
+		},
+		{
+			filepath:  "../../../public/schemas/user_enterprise_extension_schema.json",
+			structure: new(spec.Schema),
+			post: func(parsed interface{}) {
+				spec.Schemas().Register(parsed.(*spec.Schema))
+			},
+		},
+		{
+			filepath:  "../../../public/resource_types/user_resource_type.json",
+			structure: new(spec.ResourceType),
+			post: func(parsed interface{}) {
+				s.resourceType = parsed.(*spec.ResourceType)
+				Register(s.resourceType)
+			},
+		},
+	} {
+		f, err := os.Open(each.filepath)
+		require.Nil(s.T(), err)
+
+		raw, err := ioutil.ReadAll(f)
+		require.Nil(s.T(), err)
+
+		err = json.Unmarshal(raw, each.structure)
+		require.Nil(s.T(), err)
+
+		if each.post != nil {
+			each.post(each.structure)
+		}
+	}
+}
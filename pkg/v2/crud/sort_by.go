@@ -5,6 +5,7 @@ import (
 	"github.com/imulab/go-scim/pkg/v2/crud/expr"
 	"github.com/imulab/go-scim/pkg/v2/prop"
 	"github.com/imulab/go-scim/pkg/v2/spec"
+	"strings"
 )
 
 // Find the actual sort target inferred by the sortBy parameter. 'resource' points to the Resource whose value is being
@@ -74,12 +75,23 @@ import (
 // 	}
 // The value "urn:ietf:params:scim:schemas:core:2.0:User" will be used to sort the resource because it is the first element.
 //
-// Other sortBy parameters that does not fall into the above three categories are considered to be invalid.
+// Fourth, if the sortBy parameter refers to a multiValued complex type with a "value" sub attribute, the sort target
+// will be the "value" of the element selected as in the second case. For instance, sortBy=emails is treated the same
+// as sortBy=emails.value.
+//
+// The sortBy parameter may be prefixed with the URN of the main schema (i.e.
+// urn:ietf:params:scim:schemas:core:2.0:User:emails.value). Other sortBy parameters that does not fall into the above
+// categories are considered to be invalid.
 //
 func SeekSortTarget(resource *prop.Resource, by *expr.Expression) (prop.Property, error) {
 	if by.ContainsFilter() {
 		return nil, fmt.Errorf("%w: sortBy attribute cannot contain filter", spec.ErrInvalidPath)
 	}
+	if by.IsPath() && strings.ToLower(by.Token()) == strings.ToLower(resource.ResourceType().Schema().ID()) {
+		if by = by.Next(); by == nil {
+			return nil, fmt.Errorf("%w: invalid sortBy target", spec.ErrInvalidPath)
+		}
+	}
 
 	var candidates []prop.Property
 	if err := primaryOrFirstTraverse(resource.RootProperty(), by, func(nav prop.Navigator) error {
@@ -93,17 +105,43 @@ func SeekSortTarget(resource *prop.Resource, by *expr.Expression) (prop.Property
 		return nil, fmt.Errorf("%w: cannot determine sortBy candidate (%d candidate)", spec.ErrInvalidPath, len(candidates))
 	}
 
-	if candidates[0].Attribute().Type() == spec.TypeComplex {
-		return nil, fmt.Errorf("%w: invalid sortBy target", spec.ErrInvalidPath)
+	candidate := candidates[0]
+	if candidate.Attribute().Type() == spec.TypeComplex {
+		if !candidate.Attribute().MultiValued() || candidate.Attribute().SubAttributeForName("value") == nil {
+			return nil, fmt.Errorf("%w: invalid sortBy target", spec.ErrInvalidPath)
+		}
+		return seekValueOfPrimaryOrFirst(candidate)
 	}
 
-	if !candidates[0].Attribute().MultiValued() {
-		return candidates[0], nil
+	if !candidate.Attribute().MultiValued() {
+		return candidate, nil
 	}
 
-	if p, err := candidates[0].ChildAtIndex(0); err != nil {
+	if p, err := candidate.ChildAtIndex(0); err != nil {
 		return nil, fmt.Errorf("%w: cannot determine sortBy candidate (no candidate)", spec.ErrNoTarget)
 	} else {
 		return p, nil
 	}
 }
+
+// Returns the "value" sub property of the element whose primary attribute is true, or the first element.
+func seekValueOfPrimaryOrFirst(multiValuedComplex prop.Property) (prop.Property, error) {
+	selector := primaryOrFirstStrategy(multiValuedComplex)
+
+	var element prop.Property
+	_ = multiValuedComplex.ForEachChild(func(index int, child prop.Property) error {
+		if element == nil && selector(index, child) {
+			element = child
+		}
+		return nil
+	})
+	if element == nil {
+		return nil, fmt.Errorf("%w: cannot determine sortBy candidate (no candidate)", spec.ErrNoTarget)
+	}
+
+	value, err := element.ChildAtIndex("value")
+	if err != nil || value == nil {
+		return nil, fmt.Errorf("%w: cannot determine sortBy candidate (no value)", spec.ErrNoTarget)
+	}
+	return value, nil
+}
@@ -115,7 +115,7 @@ func (s *SeekSortByTargetTestSuite) TestSeekSortTarget() {
 			},
 		},
 		{
-			name: "invalid target",
+			name: "multiValued complex target returns value of true-primary",
 			getResource: func(t *testing.T) *prop.Resource {
 				r := prop.NewResource(s.resourceType)
 				assert.False(t, r.Navigator().Dot("emails").Add([]interface{}{
@@ -130,6 +130,52 @@ func (s *SeekSortByTargetTestSuite) TestSeekSortTarget() {
 				return r
 			},
 			sortBy: "emails",
+			expect: func(t *testing.T, target prop.Property, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, "emails.value", target.Attribute().ID())
+				assert.Equal(t, "bar", target.Raw())
+			},
+		},
+		{
+			name: "multiValued complex target with no true-primary returns value of first",
+			getResource: func(t *testing.T) *prop.Resource {
+				r := prop.NewResource(s.resourceType)
+				assert.False(t, r.Navigator().Dot("emails").Add([]interface{}{
+					map[string]interface{}{
+						"value": "foo",
+					},
+					map[string]interface{}{
+						"value": "bar",
+					},
+				}).HasError())
+				return r
+			},
+			sortBy: "emails",
+			expect: func(t *testing.T, target prop.Property, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, "emails.value", target.Attribute().ID())
+				assert.Equal(t, "foo", target.Raw())
+			},
+		},
+		{
+			name: "empty multiValued complex target",
+			getResource: func(t *testing.T) *prop.Resource {
+				return prop.NewResource(s.resourceType)
+			},
+			sortBy: "emails",
+			expect: func(t *testing.T, target prop.Property, err error) {
+				assert.NotNil(t, err)
+				assert.Equal(t, spec.ErrNoTarget, errors.Unwrap(err))
+			},
+		},
+		{
+			name: "invalid target",
+			getResource: func(t *testing.T) *prop.Resource {
+				r := prop.NewResource(s.resourceType)
+				assert.False(t, r.Navigator().Dot("meta").Dot("version").Replace("v1").HasError())
+				return r
+			},
+			sortBy: "meta",
 			expect: func(t *testing.T, target prop.Property, err error) {
 				assert.NotNil(t, err)
 				assert.Equal(t, spec.ErrInvalidPath, errors.Unwrap(err))
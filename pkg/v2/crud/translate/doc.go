@@ -0,0 +1,4 @@
+// This package implements translators from SCIM queries (filter, sort and pagination) to the native query language of
+// databases, so that db.DB implementations can push queries down to the database instead of scanning and evaluating
+// resources in memory.
+package translate
@@ -0,0 +1,294 @@
+package translate
+
+import (
+	"fmt"
+	"github.com/imulab/go-scim/pkg/v2/crud"
+	"github.com/imulab/go-scim/pkg/v2/crud/expr"
+	"github.com/imulab/go-scim/pkg/v2/spec"
+	"strings"
+	"time"
+)
+
+// ElasticCompiler returns a compiler of SCIM queries into the query DSL of Elasticsearch and OpenSearch, for the
+// resource type. The indexed documents are assumed to nest the attribute values in the same way as the SCIM JSON
+// representation, with the fields named as returned by ElasticField, and string attributes, as well as reference and
+// binary attributes, mapped as keyword fields. The fields of strings that are not caseExact shall be normalized to
+// lower case, i.e. by a normalizer with the lowercase filter, as values in the filter are lowered for them.
+func ElasticCompiler(resourceType *spec.ResourceType) Elastic {
+	return &elasticCompiler{
+		resourceType: resourceType,
+		superAttr:    resourceType.SuperAttribute(true),
+	}
+}
+
+// ElasticField returns the name of the field of the attribute in the indexed documents, which is the names of the
+// attributes in the path joined by dots, i.e. "emails.value", or "urn:ietf:params:scim:schemas:extension:enterprise:2.0:User.employeeNumber".
+// Dots within the URN of a schema extension are taken as separators of object fields by Elasticsearch, in the mapping
+// as well as in the documents and queries alike, so that the field can be referred to by the name all the same.
+func ElasticField(path []*spec.Attribute) string {
+	names := make([]string, 0, len(path))
+	for _, attr := range path {
+		names = append(names, attr.Name())
+	}
+	return strings.Join(names, ".")
+}
+
+type (
+	// Elastic compiles SCIM queries into the request body of the search API of Elasticsearch and OpenSearch.
+	Elastic interface {
+		// Compile compiles the filter, sort and pagination options into a search. Empty filter matches all documents,
+		// nil sort leaves the order to the relevance and nil pagination leaves the number of hits to the caller.
+		Compile(filter string, sort *crud.Sort, pagination *crud.Pagination) (*ElasticSearch, error)
+		// CompileExpression is the same as Compile, except that the filter has already been compiled. It allows
+		// the caller to pre-compile frequently used filters.
+		CompileExpression(root *expr.Expression, sort *crud.Sort, pagination *crud.Pagination) (*ElasticSearch, error)
+	}
+	// ElasticSearch is the result of compilation into the query DSL.
+	ElasticSearch struct {
+		// Query is the query clause, which is evaluated in filter context, so that documents are not scored.
+		Query map[string]interface{}
+		// Sort is the sort clause, or empty if not sorted.
+		Sort []interface{}
+		// From is the 0-based offset of the first hit.
+		From int
+		// Size is the number of hits, or negative if not paginated.
+		Size int
+	}
+)
+
+// Body returns the request body of the search API, i.e. for "POST /<index>/_search".
+func (s *ElasticSearch) Body() map[string]interface{} {
+	body := map[string]interface{}{"query": s.Query}
+	if len(s.Sort) > 0 {
+		body["sort"] = s.Sort
+	}
+	if s.Size >= 0 {
+		body["from"] = s.From
+		body["size"] = s.Size
+	}
+	return body
+}
+
+type elasticCompiler struct {
+	resourceType *spec.ResourceType
+	superAttr    *spec.Attribute
+}
+
+func (c *elasticCompiler) Compile(filter string, sort *crud.Sort, pagination *crud.Pagination) (*ElasticSearch, error) {
+	var root *expr.Expression
+	if len(filter) > 0 {
+		var err error
+		if root, err = expr.CompileFilter(filter); err != nil {
+			return nil, err
+		}
+	}
+	return c.CompileExpression(root, sort, pagination)
+}
+
+func (c *elasticCompiler) CompileExpression(root *expr.Expression, sort *crud.Sort, pagination *crud.Pagination) (*ElasticSearch, error) {
+	search := &ElasticSearch{
+		Query: map[string]interface{}{"match_all": map[string]interface{}{}},
+		Size:  -1,
+	}
+
+	if root != nil {
+		query, err := c.query(root)
+		if err != nil {
+			return nil, err
+		}
+		search.Query = map[string]interface{}{"bool": map[string]interface{}{"filter": query}}
+	}
+
+	if sort != nil && len(sort.By) > 0 {
+		terms, err := c.sort(sort)
+		if err != nil {
+			return nil, err
+		}
+		search.Sort = terms
+	}
+
+	if pagination != nil {
+		startIndex := pagination.StartIndex
+		if startIndex < 1 {
+			startIndex = 1
+		}
+		search.From = startIndex - 1
+		search.Size = pagination.Count
+	}
+
+	return search, nil
+}
+
+func (c *elasticCompiler) query(root *expr.Expression) (map[string]interface{}, error) {
+	switch strings.ToLower(root.Token()) {
+	case expr.And, expr.Or:
+		left, err := c.query(root.Left())
+		if err != nil {
+			return nil, err
+		}
+		right, err := c.query(root.Right())
+		if err != nil {
+			return nil, err
+		}
+		if strings.ToLower(root.Token()) == expr.And {
+			return boolQuery("filter", left, right), nil
+		}
+		query := boolQuery("should", left, right)
+		query["bool"].(map[string]interface{})["minimum_should_match"] = 1
+		return query, nil
+	case expr.Not:
+		left, err := c.query(root.Left())
+		if err != nil {
+			return nil, err
+		}
+		return boolQuery("must_not", left), nil
+	default:
+		return c.relational(root)
+	}
+}
+
+func (c *elasticCompiler) relational(op *expr.Expression) (map[string]interface{}, error) {
+	attrs, err := resolve(c.resourceType, c.superAttr, op.Left())
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		target   = attrs[len(attrs)-1]
+		field    = ElasticField(attrs)
+		operator = strings.ToLower(op.Token())
+	)
+
+	if operator == expr.Pr {
+		exists := map[string]interface{}{"exists": map[string]interface{}{"field": field}}
+		if target.Type() == spec.TypeString && !multiValued(attrs) {
+			return boolQuery("filter", exists, boolQuery("must_not", termQuery(field, ""))), nil
+		}
+		return exists, nil
+	}
+
+	if target.Type() == spec.TypeComplex {
+		return nil, fmt.Errorf("%w: operator '%s' cannot be applied to complex attribute '%s'", spec.ErrInvalidFilter, op.Token(), target.Path())
+	}
+
+	value, err := parseValue(op.Right().Token(), target)
+	if err != nil {
+		return nil, err
+	}
+	switch v := value.(type) {
+	case string:
+		if target.Type() == spec.TypeString && !target.CaseExact() {
+			value = strings.ToLower(v)
+		}
+	case time.Time:
+		value = v.UTC().Format(time.RFC3339Nano)
+	}
+
+	switch operator {
+	case expr.Eq:
+		return termQuery(field, value), nil
+	case expr.Ne:
+		// Unassigned attributes are not equal to any value, and neither are multiValued attributes none of whose
+		// values are equal.
+		return boolQuery("must_not", termQuery(field, value)), nil
+	case expr.Sw, expr.Ew, expr.Co:
+		if target.Type() != spec.TypeString && target.Type() != spec.TypeReference {
+			return nil, fmt.Errorf("%w: operator '%s' cannot be applied to non-string attribute '%s'", spec.ErrInvalidFilter, op.Token(), target.Path())
+		}
+		s := value.(string)
+		switch operator {
+		case expr.Sw:
+			return map[string]interface{}{"prefix": map[string]interface{}{field: map[string]interface{}{"value": s}}}, nil
+		case expr.Ew:
+			return wildcardQuery(field, "*"+escapeWildcard(s)), nil
+		default:
+			return wildcardQuery(field, "*"+escapeWildcard(s)+"*"), nil
+		}
+	case expr.Gt, expr.Ge, expr.Lt, expr.Le:
+		if target.Type() == spec.TypeBoolean || target.Type() == spec.TypeBinary {
+			return nil, fmt.Errorf("%w: operator '%s' cannot be applied to attribute '%s'", spec.ErrInvalidFilter, op.Token(), target.Path())
+		}
+		bound := map[string]string{expr.Gt: "gt", expr.Ge: "gte", expr.Lt: "lt", expr.Le: "lte"}[operator]
+		return map[string]interface{}{"range": map[string]interface{}{field: map[string]interface{}{bound: value}}}, nil
+	default:
+		return nil, fmt.Errorf("%w: unsupported operator '%s'", spec.ErrInvalidFilter, op.Token())
+	}
+}
+
+func (c *elasticCompiler) sort(sort *crud.Sort) ([]interface{}, error) {
+	keys, err := sort.Keys()
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		terms    = make([]interface{}, 0, len(keys)+1)
+		sortedId = false
+	)
+	for _, key := range keys {
+		head, err := expr.CompilePath(key.By)
+		if err != nil {
+			return nil, err
+		}
+
+		attrs, err := resolve(c.resourceType, c.superAttr, head)
+		if err != nil {
+			return nil, fmt.Errorf("%w: invalid sortBy '%s'", spec.ErrInvalidSyntax, key.By)
+		}
+		target := attrs[len(attrs)-1]
+		if multiValued(attrs) || target.Type() == spec.TypeComplex {
+			return nil, fmt.Errorf("%w: cannot sort by '%s'", spec.ErrInvalidSyntax, target.Path())
+		}
+		if target.ID() == "id" {
+			sortedId = true
+		}
+
+		// Documents without the sort attribute value are placed last in ascending order, and first in descending
+		// order, consistent with the in memory sort.
+		order, missing := "asc", "_last"
+		if key.Order == crud.SortDesc {
+			order, missing = "desc", "_first"
+		}
+		terms = append(terms, map[string]interface{}{
+			ElasticField(attrs): map[string]interface{}{"order": order, "missing": missing},
+		})
+	}
+
+	// Break ties by id, so that the order is deterministic across pages.
+	if !sortedId {
+		if idAttr := c.superAttr.SubAttributeForName("id"); idAttr != nil {
+			terms = append(terms, map[string]interface{}{
+				ElasticField([]*spec.Attribute{idAttr}): map[string]interface{}{"order": "asc"},
+			})
+		}
+	}
+
+	return terms, nil
+}
+
+// Returns true if any attribute in the path is multiValued.
+func multiValued(path []*spec.Attribute) bool {
+	for _, attr := range path {
+		if attr.MultiValued() {
+			return true
+		}
+	}
+	return false
+}
+
+func boolQuery(occur string, queries ...interface{}) map[string]interface{} {
+	return map[string]interface{}{"bool": map[string]interface{}{occur: queries}}
+}
+
+func termQuery(field string, value interface{}) map[string]interface{} {
+	return map[string]interface{}{"term": map[string]interface{}{field: map[string]interface{}{"value": value}}}
+}
+
+func wildcardQuery(field string, pattern string) map[string]interface{} {
+	return map[string]interface{}{"wildcard": map[string]interface{}{field: map[string]interface{}{"value": pattern}}}
+}
+
+// Escape the wildcards of the wildcard query in the value, using backslash as the escape character.
+func escapeWildcard(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `*`, `\*`, `?`, `\?`).Replace(value)
+}
@@ -0,0 +1,227 @@
+package translate
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/imulab/go-scim/pkg/v2/crud"
+	"github.com/imulab/go-scim/pkg/v2/spec"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestElastic(t *testing.T) {
+	s := new(ElasticTestSuite)
+	suite.Run(t, s)
+}
+
+type ElasticTestSuite struct {
+	suite.Suite
+	resourceType *spec.ResourceType
+}
+
+func (s *ElasticTestSuite) TestCompile() {
+	tests := []struct {
+		name       string
+		filter     string
+		sort       *crud.Sort
+		pagination *crud.Pagination
+		expect     func(t *testing.T, body string, err error)
+	}{
+		{
+			name: "empty query",
+			expect: func(t *testing.T, body string, err error) {
+				assert.Nil(t, err)
+				assert.JSONEq(t, `{"query":{"match_all":{}}}`, body)
+			},
+		},
+		{
+			name:   "case insensitive equality",
+			filter: `userName eq "IMULAB"`,
+			expect: func(t *testing.T, body string, err error) {
+				assert.Nil(t, err)
+				assert.JSONEq(t, `{"query":{"bool":{"filter":{"term":{"userName":{"value":"imulab"}}}}}}`, body)
+			},
+		},
+		{
+			name:   "case exact equality",
+			filter: `id eq "3cc032F5"`,
+			expect: func(t *testing.T, body string, err error) {
+				assert.Nil(t, err)
+				assert.JSONEq(t, `{"query":{"bool":{"filter":{"term":{"id":{"value":"3cc032F5"}}}}}}`, body)
+			},
+		},
+		{
+			name:   "substring operators",
+			filter: `displayName co "Qiu" or name.familyName sw "Q*" or emails.value ew "@foo.com"`,
+			expect: func(t *testing.T, body string, err error) {
+				assert.Nil(t, err)
+				assert.JSONEq(t, `{"query":{"bool":{"filter":{"bool":{"minimum_should_match":1,"should":[
+					{"bool":{"minimum_should_match":1,"should":[
+						{"wildcard":{"displayName":{"value":"*qiu*"}}},
+						{"prefix":{"name.familyName":{"value":"q*"}}}
+					]}},
+					{"wildcard":{"emails.value":{"value":"*@foo.com"}}}
+				]}}}}}`, body)
+			},
+		},
+		{
+			name:   "wildcards are escaped",
+			filter: `displayName co "a*b?c\\"`,
+			expect: func(t *testing.T, body string, err error) {
+				assert.Nil(t, err)
+				assert.JSONEq(t, `{"query":{"bool":{"filter":{"wildcard":{"displayName":{"value":"*a\\*b\\?c\\\\*"}}}}}}`, body)
+			},
+		},
+		{
+			name:   "logical operators",
+			filter: `not (active eq true) and userName pr and emails pr`,
+			expect: func(t *testing.T, body string, err error) {
+				assert.Nil(t, err)
+				assert.JSONEq(t, `{"query":{"bool":{"filter":{"bool":{"filter":[
+					{"bool":{"filter":[
+						{"bool":{"must_not":[{"term":{"active":{"value":true}}}]}},
+						{"bool":{"filter":[
+							{"exists":{"field":"userName"}},
+							{"bool":{"must_not":[{"term":{"userName":{"value":""}}}]}}
+						]}}
+					]}},
+					{"exists":{"field":"emails"}}
+				]}}}}}`, body)
+			},
+		},
+		{
+			name:   "not equal and range",
+			filter: `urn:ietf:params:scim:schemas:extension:enterprise:2.0:User:employeeNumber ne "A1" and meta.lastModified ge "2019-11-20T13:09:00"`,
+			expect: func(t *testing.T, body string, err error) {
+				assert.Nil(t, err)
+				assert.JSONEq(t, `{"query":{"bool":{"filter":{"bool":{"filter":[
+					{"bool":{"must_not":[{"term":{"urn:ietf:params:scim:schemas:extension:enterprise:2.0:User.employeeNumber":{"value":"a1"}}}]}},
+					{"range":{"meta.lastModified":{"gte":"2019-11-20T13:09:00Z"}}}
+				]}}}}}`, body)
+			},
+		},
+		{
+			name:       "sort and pagination",
+			filter:     `urn:ietf:params:scim:schemas:core:2.0:User:userName sw "a"`,
+			sort:       &crud.Sort{By: "name.familyName, userName", Order: "descending,ascending"},
+			pagination: &crud.Pagination{StartIndex: 11, Count: 10},
+			expect: func(t *testing.T, body string, err error) {
+				assert.Nil(t, err)
+				assert.JSONEq(t, `{
+					"query":{"bool":{"filter":{"prefix":{"userName":{"value":"a"}}}}},
+					"sort":[
+						{"name.familyName":{"order":"desc","missing":"_first"}},
+						{"userName":{"order":"asc","missing":"_last"}},
+						{"id":{"order":"asc"}}
+					],
+					"from":10,
+					"size":10
+				}`, body)
+			},
+		},
+		{
+			name: "sort by id does not repeat the tie breaker",
+			sort: &crud.Sort{By: "id"},
+			expect: func(t *testing.T, body string, err error) {
+				assert.Nil(t, err)
+				assert.JSONEq(t, `{"query":{"match_all":{}},"sort":[{"id":{"order":"asc","missing":"_last"}}]}`, body)
+			},
+		},
+		{
+			name: "sort by multiValued attribute",
+			sort: &crud.Sort{By: "emails.value"},
+			expect: func(t *testing.T, body string, err error) {
+				assert.Equal(t, spec.ErrInvalidSyntax, errors.Unwrap(err))
+			},
+		},
+		{
+			name:   "unknown attribute",
+			filter: `foo eq "bar"`,
+			expect: func(t *testing.T, body string, err error) {
+				assert.Equal(t, spec.ErrInvalidFilter, errors.Unwrap(err))
+			},
+		},
+		{
+			name:   "incompatible value",
+			filter: `active eq "true"`,
+			expect: func(t *testing.T, body string, err error) {
+				assert.Equal(t, spec.ErrInvalidFilter, errors.Unwrap(err))
+			},
+		},
+		{
+			name:   "substring on boolean",
+			filter: `active sw true`,
+			expect: func(t *testing.T, body string, err error) {
+				assert.Equal(t, spec.ErrInvalidFilter, errors.Unwrap(err))
+			},
+		},
+	}
+
+	for _, test := range tests {
+		s.T().Run(test.name, func(t *testing.T) {
+			search, err := ElasticCompiler(s.resourceType).Compile(test.filter, test.sort, test.pagination)
+			var body string
+			if err == nil {
+				raw, err := json.Marshal(search.Body())
+				require.Nil(t, err)
+				body = string(raw)
+			}
+			test.expect(t, body, err)
+		})
+	}
+}
+
+func (s *ElasticTestSuite) SetupSuite() {
+	for _, each := range []struct {
+		filepath  string
+		structure interface{}
+		post      func(parsed interface{})
+	}{
+		{
+			filepath:  "../../../../public/schemas/core_schema.json",
+			structure: new(spec.Schema),
+			post: func(parsed interface{}) {
+				spec.Schemas().Register(parsed.(*spec.Schema))
+			},
+		},
+		{
+			filepath:  "../../../../public/schemas/user_schema.json",
+			structure: new(spec.Schema),
+			post: func(parsed interface{}) {
+				spec.Schemas().Register(parsed.(*spec.Schema))
+			},
+		},
+		{
+			filepath:  "../../../../public/schemas/user_enterprise_extension_schema.json",
+			structure: new(spec.Schema),
+			post: func(parsed interface{}) {
+				spec.Schemas().Register(parsed.(*spec.Schema))
+			},
+		},
+		{
+			filepath:  "../../../../public/resource_types/user_resource_type.json",
+			structure: new(spec.ResourceType),
+			post: func(parsed interface{}) {
+				s.resourceType = parsed.(*spec.ResourceType)
+				crud.Register(s.resourceType)
+			},
+		},
+	} {
+		f, err := os.Open(each.filepath)
+		require.Nil(s.T(), err)
+
+		raw, err := ioutil.ReadAll(f)
+		require.Nil(s.T(), err)
+
+		err = json.Unmarshal(raw, each.structure)
+		require.Nil(s.T(), err)
+
+		if each.post != nil {
+			each.post(each.structure)
+		}
+	}
+}
@@ -0,0 +1,218 @@
+package translate
+
+import (
+	"github.com/imulab/go-scim/pkg/v2/spec"
+	"strings"
+	"time"
+)
+
+// Column is the SQL rendering of a SCIM attribute.
+type Column struct {
+	// Expr is the SQL expression that evaluates to the attribute value. If From is not empty, Expr is evaluated in
+	// the context of From, and typically refers to the element of a multiValued attribute.
+	Expr string
+	// From, if not empty, is a set returning SQL fragment which Expr is evaluated against, i.e.
+	// "jsonb_array_elements(data->'emails') AS elem". Predicates on the column are wrapped as
+	// "EXISTS (SELECT 1 FROM <From> WHERE <predicate>)", so that the predicate is satisfied as long as any element
+	// satisfies it. This matches the semantics of filter evaluation on multiValued attributes.
+	From string
+	// Containment, if not empty, is the JSONB column storing the resource, against which equality predicates on the
+	// attribute are expressed as "<Containment> @> <document>" instead, where document nests the value along the path
+	// of the attribute. Containment is satisfied by any matching element of multiValued attributes, and can utilize GIN
+	// indexes on the column. It only applies to attributes whose values compare exactly, hence not to case insensitive
+	// strings and dateTime, whose JSON representation may differ from the value in the filter.
+	Containment string
+	// Convert, if not nil, converts the values in the filter before they are bound as parameters, when the column does
+	// not store the attribute values as their Go types, which are string, bool, int64, float64 and time.Time.
+	Convert func(value interface{}) interface{}
+}
+
+// Returns the value converted by Convert, if any.
+func (c Column) convert(value interface{}) interface{} {
+	if c.Convert == nil {
+		return value
+	}
+	return c.Convert(value)
+}
+
+// Mapping maps SCIM attributes to SQL columns. The path contains the attributes from the top level attribute down to
+// the target attribute. For instance, for emails.value, the path is [emails, value]; for employeeNumber in the
+// enterprise user extension, the path is [urn:ietf:params:scim:schemas:extension:enterprise:2.0:User, employeeNumber].
+// The last attribute in the path is the target attribute. Column returns false if the attribute is not mapped.
+type Mapping interface {
+	Column(path []*spec.Attribute) (column Column, ok bool)
+}
+
+// MappingFunc is the function adapter of Mapping.
+type MappingFunc func(path []*spec.Attribute) (Column, bool)
+
+func (f MappingFunc) Column(path []*spec.Attribute) (Column, bool) {
+	return f(path)
+}
+
+// Columns returns a Mapping that maps attributes to columns according to the given map. The key of the map is the
+// path of the target attribute as reported by spec.Attribute.Path (i.e. userName, name.familyName, emails.value,
+// urn:ietf:params:scim:schemas:extension:enterprise:2.0:User:employeeNumber) and is matched case insensitively.
+// The value of the map is the SQL expression of the column.
+func Columns(columns map[string]string) Mapping {
+	lowered := make(map[string]string, len(columns))
+	for k, v := range columns {
+		lowered[strings.ToLower(k)] = v
+	}
+	return MappingFunc(func(path []*spec.Attribute) (Column, bool) {
+		if len(path) == 0 {
+			return Column{}, false
+		}
+		expr, ok := lowered[strings.ToLower(path[len(path)-1].Path())]
+		return Column{Expr: expr}, ok
+	})
+}
+
+// JSONB returns a Mapping that maps every attribute into the PostgreSQL JSONB column, assuming the column stores the
+// resource in its SCIM JSON representation. Values are cast to the SQL type corresponding to the attribute type, and
+// multiValued attributes are expanded using jsonb_array_elements.
+func JSONB(column string) Mapping {
+	return MappingFunc(func(path []*spec.Attribute) (Column, bool) {
+		if len(path) == 0 {
+			return Column{}, false
+		}
+
+		var (
+			target = path[len(path)-1]
+			base   = column
+			col    Column
+		)
+		for i, attr := range path {
+			last := i == len(path)-1
+			switch {
+			case attr.MultiValued():
+				if attr.Type() == spec.TypeComplex {
+					col.From = "jsonb_array_elements(" + base + "->" + quoteLiteral(attr.Name()) + ") AS elem"
+				} else {
+					col.From = "jsonb_array_elements_text(" + base + "->" + quoteLiteral(attr.Name()) + ") AS elem"
+				}
+				base = "elem"
+				if last {
+					col.Expr = castJSONB(base, target)
+				}
+			case last && attr.Type() != spec.TypeComplex:
+				col.Expr = castJSONB(base+"->>"+quoteLiteral(attr.Name()), target)
+			default:
+				base = base + "->" + quoteLiteral(attr.Name())
+				if last {
+					col.Expr = base
+				}
+			}
+		}
+		return col, true
+	})
+}
+
+// JSONBContainment is the same as JSONB, except that equality predicates are expressed as containment of the column
+// whenever possible (see Column.Containment), so that they can utilize GIN indexes, i.e. created as
+// "CREATE INDEX ON users USING GIN (data jsonb_path_ops)".
+func JSONBContainment(column string) Mapping {
+	jsonb := JSONB(column)
+	return MappingFunc(func(path []*spec.Attribute) (Column, bool) {
+		col, ok := jsonb.Column(path)
+		if ok {
+			col.Containment = column
+		}
+		return col, ok
+	})
+}
+
+// JSON1 returns a Mapping that maps every attribute into the SQLite JSON column, using the functions of the JSON1
+// extension and assuming the column stores the resource in its SCIM JSON representation. multiValued attributes are
+// expanded using json_each. dateTime values are compared as Julian day numbers (see JulianDay), as their textual
+// representation may carry different offsets. Note SQLite compares ASCII case insensitively in LIKE by default, which
+// shall be turned off by "PRAGMA case_sensitive_like = ON" for substring filters on caseExact attributes.
+func JSON1(column string) Mapping {
+	return MappingFunc(func(path []*spec.Attribute) (Column, bool) {
+		if len(path) == 0 {
+			return Column{}, false
+		}
+
+		var (
+			target   = path[len(path)-1]
+			base     = column
+			jsonPath = "$"
+			col      Column
+		)
+		for i, attr := range path {
+			last := i == len(path)-1
+			jsonPath = jsonPath + "." + quoteJSONKey(attr.Name())
+			switch {
+			case attr.MultiValued():
+				col.From = "json_each(" + base + ", " + quoteLiteral(jsonPath) + ") AS elem"
+				base, jsonPath = "elem.value", "$"
+				if last {
+					col.Expr = castJSON1(base, target)
+				}
+			case last:
+				col.Expr = castJSON1("json_extract("+base+", "+quoteLiteral(jsonPath)+")", target)
+			}
+		}
+		if target.Type() == spec.TypeDateTime {
+			col.Convert = convertJulianDay
+		}
+		return col, true
+	})
+}
+
+// JulianDay returns the Julian day number of the time, which is the number SQLite uses to compare times, i.e. as
+// returned by julianday('2020-01-01T00:00:00Z').
+func JulianDay(t time.Time) float64 {
+	return float64(t.UnixNano())/float64(24*time.Hour) + 2440587.5
+}
+
+// Chain returns a Mapping that consults the mappings in order and returns the first mapped column. It can be used to
+// map some attributes to dedicated columns, and resort to a JSONB column for the rest.
+func Chain(mappings ...Mapping) Mapping {
+	return MappingFunc(func(path []*spec.Attribute) (Column, bool) {
+		for _, m := range mappings {
+			if col, ok := m.Column(path); ok {
+				return col, true
+			}
+		}
+		return Column{}, false
+	})
+}
+
+func castJSONB(expr string, attr *spec.Attribute) string {
+	switch attr.Type() {
+	case spec.TypeInteger:
+		return "(" + expr + ")::bigint"
+	case spec.TypeDecimal:
+		return "(" + expr + ")::numeric"
+	case spec.TypeBoolean:
+		return "(" + expr + ")::boolean"
+	case spec.TypeDateTime:
+		return "(" + expr + ")::timestamptz"
+	default:
+		return expr
+	}
+}
+
+func castJSON1(expr string, attr *spec.Attribute) string {
+	if attr.Type() == spec.TypeDateTime {
+		return "julianday(" + expr + ")"
+	}
+	return expr
+}
+
+func convertJulianDay(value interface{}) interface{} {
+	if t, ok := value.(time.Time); ok {
+		return JulianDay(t)
+	}
+	return value
+}
+
+// Quote the key in JSON paths of SQLite, i.e. $."name"."familyName", so that keys may contain dots.
+func quoteJSONKey(key string) string {
+	return `"` + strings.Replace(key, `"`, `\"`, -1) + `"`
+}
+
+func quoteLiteral(s string) string {
+	return "'" + strings.Replace(s, "'", "''", -1) + "'"
+}
@@ -0,0 +1,440 @@
+package translate
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/imulab/go-scim/pkg/v2/crud"
+	"github.com/imulab/go-scim/pkg/v2/crud/expr"
+	"github.com/imulab/go-scim/pkg/v2/spec"
+	"strconv"
+	"strings"
+)
+
+// Placeholder renders the bind parameter placeholder for the parameter at the 1-based index.
+type Placeholder func(index int) string
+
+// Placeholder styles of common databases.
+var (
+	// Question renders placeholders as "?", used by MySQL and SQLite.
+	Question Placeholder = func(_ int) string { return "?" }
+	// Dollar renders placeholders as "$1", "$2", etc, used by PostgreSQL.
+	Dollar Placeholder = func(index int) string { return "$" + strconv.Itoa(index) }
+)
+
+// SQLCompiler returns a SQL compiler for the resource type. Attributes are resolved into columns using the mapping,
+// and bind parameters are rendered using the placeholder.
+func SQLCompiler(resourceType *spec.ResourceType, mapping Mapping, placeholder Placeholder) SQL {
+	return &sqlCompiler{
+		resourceType: resourceType,
+		superAttr:    resourceType.SuperAttribute(true),
+		mapping:      mapping,
+		placeholder:  placeholder,
+	}
+}
+
+type (
+	// SQL compiles SCIM queries into parameterized SQL clauses.
+	SQL interface {
+		// Compile compiles the filter, sort and pagination options into SQL clauses. Empty filter, nil sort or nil
+		// pagination results in the corresponding clause being empty.
+		Compile(filter string, sort *crud.Sort, pagination *crud.Pagination) (*SQLClause, error)
+		// CompileExpression is the same as Compile, except that the filter has already been compiled. It allows
+		// the caller to pre-compile frequently used filters.
+		CompileExpression(root *expr.Expression, sort *crud.Sort, pagination *crud.Pagination) (*SQLClause, error)
+	}
+	// SQLClause is the result of SQL compilation. Clauses do not include the leading keyword, so that they can be
+	// composed into a larger statement. Placeholders are numbered in the order of Where, OrderBy and Limit, and Args
+	// holds the bind parameters in the same order.
+	SQLClause struct {
+		Where   string
+		OrderBy string
+		Limit   string
+		Args    []interface{}
+	}
+)
+
+// String renders the clauses with leading keywords, suitable to be appended to a SELECT statement.
+func (c *SQLClause) String() string {
+	var sb strings.Builder
+	if len(c.Where) > 0 {
+		sb.WriteString(" WHERE ")
+		sb.WriteString(c.Where)
+	}
+	if len(c.OrderBy) > 0 {
+		sb.WriteString(" ORDER BY ")
+		sb.WriteString(c.OrderBy)
+	}
+	if len(c.Limit) > 0 {
+		sb.WriteString(" ")
+		sb.WriteString(c.Limit)
+	}
+	return sb.String()
+}
+
+type sqlCompiler struct {
+	resourceType *spec.ResourceType
+	superAttr    *spec.Attribute
+	mapping      Mapping
+	placeholder  Placeholder
+}
+
+func (c *sqlCompiler) Compile(filter string, sort *crud.Sort, pagination *crud.Pagination) (*SQLClause, error) {
+	var root *expr.Expression
+	if len(filter) > 0 {
+		var err error
+		if root, err = expr.CompileFilter(filter); err != nil {
+			return nil, err
+		}
+	}
+	return c.CompileExpression(root, sort, pagination)
+}
+
+func (c *sqlCompiler) CompileExpression(root *expr.Expression, sort *crud.Sort, pagination *crud.Pagination) (*SQLClause, error) {
+	clause := &SQLClause{Args: []interface{}{}}
+
+	if root != nil {
+		where, err := c.where(clause, root)
+		if err != nil {
+			return nil, err
+		}
+		clause.Where = where
+	}
+
+	if sort != nil && len(sort.By) > 0 {
+		orderBy, err := c.orderBy(sort)
+		if err != nil {
+			return nil, err
+		}
+		clause.OrderBy = orderBy
+	}
+
+	if pagination != nil {
+		startIndex := pagination.StartIndex
+		if startIndex < 1 {
+			startIndex = 1
+		}
+		limit := c.bind(clause, pagination.Count)
+		offset := c.bind(clause, startIndex-1)
+		clause.Limit = "LIMIT " + limit + " OFFSET " + offset
+	}
+
+	return clause, nil
+}
+
+func (c *sqlCompiler) where(clause *SQLClause, root *expr.Expression) (string, error) {
+	switch strings.ToLower(root.Token()) {
+	case expr.And, expr.Or:
+		left, err := c.where(clause, root.Left())
+		if err != nil {
+			return "", err
+		}
+		right, err := c.where(clause, root.Right())
+		if err != nil {
+			return "", err
+		}
+		return "(" + left + " " + strings.ToUpper(root.Token()) + " " + right + ")", nil
+	case expr.Not:
+		left, err := c.where(clause, root.Left())
+		if err != nil {
+			return "", err
+		}
+		// Unlike NOT, IS NOT TRUE holds for unassigned attributes, whose comparisons are NULL, as with crud.Evaluate.
+		return "(" + left + ") IS NOT TRUE", nil
+	default:
+		return c.relational(clause, root)
+	}
+}
+
+func (c *sqlCompiler) relational(clause *SQLClause, op *expr.Expression) (string, error) {
+	attrs, err := resolve(c.resourceType, c.superAttr, op.Left())
+	if err != nil {
+		return "", err
+	}
+	target := attrs[len(attrs)-1]
+
+	col, ok := c.mapping.Column(attrs)
+	if !ok {
+		return "", fmt.Errorf("%w: attribute '%s' is not mapped to a column", spec.ErrInvalidFilter, target.Path())
+	}
+
+	if len(col.Containment) > 0 && strings.ToLower(op.Token()) == expr.Eq && containable(target) {
+		value, err := parseValue(op.Right().Token(), target)
+		if err != nil {
+			return "", err
+		}
+		document, err := json.Marshal(containmentDocument(attrs, value))
+		if err != nil {
+			return "", fmt.Errorf("%w: %v", spec.ErrInternal, err)
+		}
+		return col.Containment + " @> " + c.bind(clause, string(document)) + "::jsonb", nil
+	}
+
+	predicate, err := c.predicate(clause, target, col, op)
+	if err != nil {
+		return "", err
+	}
+
+	if len(col.From) > 0 {
+		return "EXISTS (SELECT 1 FROM " + col.From + " WHERE " + predicate + ")", nil
+	}
+	return predicate, nil
+}
+
+func (c *sqlCompiler) predicate(clause *SQLClause, attr *spec.Attribute, col Column, op *expr.Expression) (string, error) {
+	operator := strings.ToLower(op.Token())
+
+	if operator == expr.Pr {
+		if attr.Type() == spec.TypeString && !attr.MultiValued() && len(col.From) == 0 {
+			return "(" + col.Expr + " IS NOT NULL AND " + col.Expr + " <> '')", nil
+		}
+		return col.Expr + " IS NOT NULL", nil
+	}
+
+	if attr.Type() == spec.TypeComplex {
+		return "", fmt.Errorf("%w: operator '%s' cannot be applied to complex attribute '%s'", spec.ErrInvalidFilter, op.Token(), attr.Path())
+	}
+
+	value, err := parseValue(op.Right().Token(), attr)
+	if err != nil {
+		return "", err
+	}
+
+	var (
+		lhs       = col.Expr
+		rhs       string
+		caseFold  = caseInsensitive(attr)
+		likeMatch bool
+	)
+	switch operator {
+	case expr.Sw, expr.Ew, expr.Co:
+		if attr.Type() != spec.TypeString && attr.Type() != spec.TypeReference {
+			return "", fmt.Errorf("%w: operator '%s' cannot be applied to non-string attribute '%s'", spec.ErrInvalidFilter, op.Token(), attr.Path())
+		}
+		pattern := escapeLike(value.(string))
+		switch operator {
+		case expr.Sw:
+			pattern = pattern + "%"
+		case expr.Ew:
+			pattern = "%" + pattern
+		case expr.Co:
+			pattern = "%" + pattern + "%"
+		}
+		rhs = c.bind(clause, pattern)
+		likeMatch = true
+	case expr.Gt, expr.Ge, expr.Lt, expr.Le:
+		if attr.Type() == spec.TypeBoolean || attr.Type() == spec.TypeBinary {
+			return "", fmt.Errorf("%w: operator '%s' cannot be applied to attribute '%s'", spec.ErrInvalidFilter, op.Token(), attr.Path())
+		}
+		rhs = c.bind(clause, col.convert(value))
+	default:
+		rhs = c.bind(clause, col.convert(value))
+	}
+
+	if caseFold {
+		lhs = "LOWER(" + lhs + ")"
+		rhs = "LOWER(" + rhs + ")"
+	}
+
+	switch operator {
+	case expr.Eq:
+		return lhs + " = " + rhs, nil
+	case expr.Ne:
+		if len(col.From) > 0 {
+			return lhs + " <> " + rhs, nil
+		}
+		// Unassigned attributes are not equal to any value.
+		return "(" + col.Expr + " IS NULL OR " + lhs + " <> " + rhs + ")", nil
+	case expr.Gt:
+		return lhs + " > " + rhs, nil
+	case expr.Ge:
+		return lhs + " >= " + rhs, nil
+	case expr.Lt:
+		return lhs + " < " + rhs, nil
+	case expr.Le:
+		return lhs + " <= " + rhs, nil
+	default:
+		if !likeMatch {
+			return "", fmt.Errorf("%w: unsupported operator '%s'", spec.ErrInvalidFilter, op.Token())
+		}
+		return lhs + " LIKE " + rhs + ` ESCAPE '\'`, nil
+	}
+}
+
+func (c *sqlCompiler) orderBy(sort *crud.Sort) (string, error) {
+	keys, err := sort.Keys()
+	if err != nil {
+		return "", err
+	}
+
+	var (
+		terms    = make([]string, 0, len(keys)+1)
+		sortedId = false
+	)
+	for _, key := range keys {
+		head, err := expr.CompilePath(key.By)
+		if err != nil {
+			return "", err
+		}
+
+		attrs, err := resolve(c.resourceType, c.superAttr, head)
+		if err != nil {
+			return "", fmt.Errorf("%w: invalid sortBy '%s'", spec.ErrInvalidSyntax, key.By)
+		}
+		target := attrs[len(attrs)-1]
+
+		col, ok := c.mapping.Column(attrs)
+		if !ok {
+			return "", fmt.Errorf("%w: sortBy attribute '%s' is not mapped to a column", spec.ErrInvalidSyntax, target.Path())
+		} else if len(col.From) > 0 || target.Type() == spec.TypeComplex {
+			return "", fmt.Errorf("%w: cannot sort by '%s'", spec.ErrInvalidSyntax, target.Path())
+		}
+		if target.ID() == "id" {
+			sortedId = true
+		}
+
+		sortKey := col.Expr
+		if caseInsensitive(target) {
+			sortKey = "LOWER(" + sortKey + ")"
+		}
+
+		// Resources without the sort attribute value are placed last in ascending order, and first in descending
+		// order. This is consistent with the in memory sort, and does not rely on the non-portable NULLS FIRST/LAST.
+		switch key.Order {
+		case crud.SortDefault, crud.SortAsc:
+			terms = append(terms, "CASE WHEN "+col.Expr+" IS NULL THEN 1 ELSE 0 END ASC, "+sortKey+" ASC")
+		case crud.SortDesc:
+			terms = append(terms, "CASE WHEN "+col.Expr+" IS NULL THEN 1 ELSE 0 END DESC, "+sortKey+" DESC")
+		}
+	}
+
+	// Break ties by id, if mapped, so that the order is deterministic across pages.
+	if !sortedId {
+		if idAttr := c.superAttr.SubAttributeForName("id"); idAttr != nil {
+			if col, ok := c.mapping.Column([]*spec.Attribute{idAttr}); ok && len(col.From) == 0 {
+				terms = append(terms, col.Expr+" ASC")
+			}
+		}
+	}
+
+	return strings.Join(terms, ", "), nil
+}
+
+// Resolve the path into the chain of attributes from the top level attribute to the target attribute. The URN
+// namespace of the main schema is skipped, as its attributes are top level attributes.
+func resolve(resourceType *spec.ResourceType, superAttr *spec.Attribute, path *expr.Expression) ([]*spec.Attribute, error) {
+	if path != nil && path.IsPath() && strings.ToLower(path.Token()) == strings.ToLower(resourceType.Schema().ID()) {
+		path = path.Next()
+	}
+	if path == nil {
+		return nil, fmt.Errorf("%w: empty path", spec.ErrInvalidFilter)
+	}
+
+	var (
+		cursor = superAttr
+		attrs  = make([]*spec.Attribute, 0)
+	)
+	for path != nil {
+		if path.IsRootOfFilter() {
+			return nil, fmt.Errorf("%w: nested filter is not supported", spec.ErrInvalidFilter)
+		}
+		if cursor.MultiValued() {
+			cursor = cursor.DeriveElementAttribute()
+		}
+		cursor = cursor.SubAttributeForName(path.Token())
+		if cursor == nil {
+			return nil, fmt.Errorf("%w: no attribute for '%s'", spec.ErrInvalidFilter, path.Token())
+		}
+		attrs = append(attrs, cursor)
+		path = path.Next()
+	}
+	return attrs, nil
+}
+
+func (c *sqlCompiler) bind(clause *SQLClause, value interface{}) string {
+	clause.Args = append(clause.Args, value)
+	return c.placeholder(len(clause.Args))
+}
+
+// Parse the literal to the Go type corresponding to the attribute type. multiValued attributes are treated as their
+// elements.
+func parseValue(raw string, attr *spec.Attribute) (interface{}, error) {
+	switch attr.Type() {
+	case spec.TypeString, spec.TypeReference, spec.TypeBinary:
+		s, err := expr.Unquote(raw)
+		if err != nil {
+			return nil, errIncompatibleValue(attr)
+		}
+		return s, nil
+	case spec.TypeDateTime:
+		s, err := expr.Unquote(raw)
+		if err != nil {
+			return nil, errIncompatibleValue(attr)
+		}
+		t, err := spec.ParseDateTime(s)
+		if err != nil {
+			return nil, errIncompatibleValue(attr)
+		}
+		return t, nil
+	case spec.TypeBoolean:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return nil, errIncompatibleValue(attr)
+		}
+		return b, nil
+	case spec.TypeInteger:
+		i, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return nil, errIncompatibleValue(attr)
+		}
+		return i, nil
+	case spec.TypeDecimal:
+		f, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return nil, errIncompatibleValue(attr)
+		}
+		return f, nil
+	default:
+		return nil, errIncompatibleValue(attr)
+	}
+}
+
+func errIncompatibleValue(attr *spec.Attribute) error {
+	return fmt.Errorf("%w: value in filter incompatible with '%s'", spec.ErrInvalidFilter, attr.Path())
+}
+
+// Returns true if the attribute holds textual values that compare regardless of case, as in crud.Evaluate, that is,
+// strings and references that are not caseExact.
+func caseInsensitive(attr *spec.Attribute) bool {
+	return (attr.Type() == spec.TypeString || attr.Type() == spec.TypeReference) && !attr.CaseExact()
+}
+
+// Returns true if equality on the attribute can be expressed as JSONB containment, that is, its values compare exactly
+// and are represented in JSON as they are parsed from the filter.
+func containable(attr *spec.Attribute) bool {
+	switch attr.Type() {
+	case spec.TypeString, spec.TypeReference:
+		return attr.CaseExact()
+	case spec.TypeBinary, spec.TypeBoolean, spec.TypeInteger, spec.TypeDecimal:
+		return true
+	default:
+		return false
+	}
+}
+
+// Returns the JSON document that nests the value along the path of attributes, i.e. {"emails":[{"value":"foo"}]} for
+// emails.value, which a resource contains if any of its emails has the value.
+func containmentDocument(path []*spec.Attribute, value interface{}) interface{} {
+	document := value
+	for i := len(path) - 1; i >= 0; i-- {
+		if path[i].MultiValued() {
+			document = []interface{}{document}
+		}
+		document = map[string]interface{}{path[i].Name(): document}
+	}
+	return document
+}
+
+// Escape LIKE wildcards in the value, using backslash as the escape character.
+func escapeLike(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(value)
+}
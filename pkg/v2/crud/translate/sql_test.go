@@ -0,0 +1,496 @@
+package translate
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/imulab/go-scim/pkg/v2/crud"
+	"github.com/imulab/go-scim/pkg/v2/spec"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestSQL(t *testing.T) {
+	s := new(SQLTestSuite)
+	suite.Run(t, s)
+}
+
+type SQLTestSuite struct {
+	suite.Suite
+	resourceType *spec.ResourceType
+}
+
+func (s *SQLTestSuite) TestCompileWithColumns() {
+	mapping := Columns(map[string]string{
+		"id":                "id",
+		"userName":          "user_name",
+		"name.familyName":   "family_name",
+		"active":            "active",
+		"meta.lastModified": "last_modified",
+		"emails.value":      "email",
+		"ims.value":         "im",
+		"x509Certificates":  "cert",
+		"profileUrl":        "profile_url",
+		"urn:ietf:params:scim:schemas:extension:enterprise:2.0:User:employeeNumber": "employee_number",
+	})
+
+	tests := []struct {
+		name       string
+		filter     string
+		sort       *crud.Sort
+		pagination *crud.Pagination
+		expect     func(t *testing.T, clause *SQLClause, err error)
+	}{
+		{
+			name:   "case insensitive equality",
+			filter: `userName eq "imulab"`,
+			expect: func(t *testing.T, clause *SQLClause, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, "LOWER(user_name) = LOWER($1)", clause.Where)
+				assert.Equal(t, []interface{}{"imulab"}, clause.Args)
+			},
+		},
+		{
+			name:   "case exact equality",
+			filter: `id eq "3cc032f5"`,
+			expect: func(t *testing.T, clause *SQLClause, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, "id = $1", clause.Where)
+				assert.Equal(t, []interface{}{"3cc032f5"}, clause.Args)
+			},
+		},
+		{
+			name:   "case insensitive reference",
+			filter: `profileUrl eq "https://Foo.com/imulab"`,
+			sort:   &crud.Sort{By: "profileUrl"},
+			expect: func(t *testing.T, clause *SQLClause, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, "LOWER(profile_url) = LOWER($1)", clause.Where)
+				assert.Equal(t, "CASE WHEN profile_url IS NULL THEN 1 ELSE 0 END ASC, LOWER(profile_url) ASC, id ASC", clause.OrderBy)
+			},
+		},
+		{
+			name:   "logical operators",
+			filter: `(name.familyName sw "Q_" or active eq true) and id pr`,
+			expect: func(t *testing.T, clause *SQLClause, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, `((LOWER(family_name) LIKE LOWER($1) ESCAPE '\' OR active = $2) AND (id IS NOT NULL AND id <> ''))`, clause.Where)
+				assert.Equal(t, []interface{}{`Q\_%`, true}, clause.Args)
+			},
+		},
+		{
+			name:   "not operator",
+			filter: `not (active eq true)`,
+			expect: func(t *testing.T, clause *SQLClause, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, "(active = $1) IS NOT TRUE", clause.Where)
+			},
+		},
+		{
+			name:   "not equal includes unassigned",
+			filter: `urn:ietf:params:scim:schemas:extension:enterprise:2.0:User:employeeNumber ne "123"`,
+			expect: func(t *testing.T, clause *SQLClause, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, "(employee_number IS NULL OR LOWER(employee_number) <> LOWER($1))", clause.Where)
+			},
+		},
+		{
+			name:   "date time comparison",
+			filter: `meta.lastModified gt "2019-11-20T13:09:00"`,
+			expect: func(t *testing.T, clause *SQLClause, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, "last_modified > $1", clause.Where)
+				expect, _ := time.Parse(spec.ISO8601, "2019-11-20T13:09:00")
+				assert.Equal(t, []interface{}{expect}, clause.Args)
+			},
+		},
+		{
+			name:   "main schema urn prefix",
+			filter: `urn:ietf:params:scim:schemas:core:2.0:User:userName co "lab"`,
+			expect: func(t *testing.T, clause *SQLClause, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, `LOWER(user_name) LIKE LOWER($1) ESCAPE '\'`, clause.Where)
+				assert.Equal(t, []interface{}{"%lab%"}, clause.Args)
+			},
+		},
+		{
+			name:       "sort and pagination",
+			filter:     `emails.value ew "@foo.com"`,
+			sort:       &crud.Sort{By: "userName", Order: crud.SortDesc},
+			pagination: &crud.Pagination{StartIndex: 11, Count: 10},
+			expect: func(t *testing.T, clause *SQLClause, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, `LOWER(email) LIKE LOWER($1) ESCAPE '\'`, clause.Where)
+				assert.Equal(t, "CASE WHEN user_name IS NULL THEN 1 ELSE 0 END DESC, LOWER(user_name) DESC, id ASC", clause.OrderBy)
+				assert.Equal(t, "LIMIT $2 OFFSET $3", clause.Limit)
+				assert.Equal(t, []interface{}{"%@foo.com", 10, 10}, clause.Args)
+				assert.Equal(t, ` WHERE LOWER(email) LIKE LOWER($1) ESCAPE '\' ORDER BY CASE WHEN user_name IS NULL THEN 1 ELSE 0 END DESC, LOWER(user_name) DESC, id ASC LIMIT $2 OFFSET $3`, clause.String())
+			},
+		},
+		{
+			name: "sort by multiple attributes",
+			sort: &crud.Sort{By: "name.familyName, userName", Order: "descending,ascending"},
+			expect: func(t *testing.T, clause *SQLClause, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, "CASE WHEN family_name IS NULL THEN 1 ELSE 0 END DESC, LOWER(family_name) DESC, "+
+					"CASE WHEN user_name IS NULL THEN 1 ELSE 0 END ASC, LOWER(user_name) ASC, id ASC", clause.OrderBy)
+			},
+		},
+		{
+			name: "sort by id does not repeat the tie breaker",
+			sort: &crud.Sort{By: "id"},
+			expect: func(t *testing.T, clause *SQLClause, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, "CASE WHEN id IS NULL THEN 1 ELSE 0 END ASC, id ASC", clause.OrderBy)
+			},
+		},
+		{
+			name: "mismatched sort orders",
+			sort: &crud.Sort{By: "name.familyName,userName,id", Order: "descending,ascending"},
+			expect: func(t *testing.T, clause *SQLClause, err error) {
+				assert.Equal(t, spec.ErrInvalidSyntax, errors.Unwrap(err))
+			},
+		},
+		{
+			name: "empty query",
+			expect: func(t *testing.T, clause *SQLClause, err error) {
+				assert.Nil(t, err)
+				assert.Empty(t, clause.String())
+				assert.Empty(t, clause.Args)
+			},
+		},
+		{
+			name:   "unmapped attribute",
+			filter: `displayName eq "foo"`,
+			expect: func(t *testing.T, clause *SQLClause, err error) {
+				assert.Equal(t, spec.ErrInvalidFilter, errors.Unwrap(err))
+			},
+		},
+		{
+			name:   "unknown attribute",
+			filter: `foo eq "bar"`,
+			expect: func(t *testing.T, clause *SQLClause, err error) {
+				assert.Equal(t, spec.ErrInvalidFilter, errors.Unwrap(err))
+			},
+		},
+		{
+			name:   "incompatible value",
+			filter: `active eq "true"`,
+			expect: func(t *testing.T, clause *SQLClause, err error) {
+				assert.Equal(t, spec.ErrInvalidFilter, errors.Unwrap(err))
+			},
+		},
+		{
+			name:   "substring on boolean",
+			filter: `active sw true`,
+			expect: func(t *testing.T, clause *SQLClause, err error) {
+				assert.Equal(t, spec.ErrInvalidFilter, errors.Unwrap(err))
+			},
+		},
+		{
+			name:   "sort by unmapped attribute",
+			filter: `id pr`,
+			sort:   &crud.Sort{By: "displayName"},
+			expect: func(t *testing.T, clause *SQLClause, err error) {
+				assert.Equal(t, spec.ErrInvalidSyntax, errors.Unwrap(err))
+			},
+		},
+	}
+
+	for _, test := range tests {
+		s.T().Run(test.name, func(t *testing.T) {
+			clause, err := SQLCompiler(s.resourceType, mapping, Dollar).Compile(test.filter, test.sort, test.pagination)
+			test.expect(t, clause, err)
+		})
+	}
+}
+
+func (s *SQLTestSuite) TestCompileWithJSONB() {
+	mapping := Chain(Columns(map[string]string{"id": "id"}), JSONB("data"))
+
+	tests := []struct {
+		name   string
+		filter string
+		sort   *crud.Sort
+		expect func(t *testing.T, clause *SQLClause, err error)
+	}{
+		{
+			name:   "dedicated column takes precedence",
+			filter: `id eq "foo"`,
+			expect: func(t *testing.T, clause *SQLClause, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, "id = ?", clause.Where)
+			},
+		},
+		{
+			name:   "singular nested attribute",
+			filter: `name.familyName eq "Qiu"`,
+			expect: func(t *testing.T, clause *SQLClause, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, "LOWER(data->'name'->>'familyName') = LOWER(?)", clause.Where)
+			},
+		},
+		{
+			name:   "typed attribute is cast",
+			filter: `active eq true`,
+			expect: func(t *testing.T, clause *SQLClause, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, "(data->>'active')::boolean = ?", clause.Where)
+			},
+		},
+		{
+			name:   "multiValued complex attribute",
+			filter: `emails.value co "foo"`,
+			expect: func(t *testing.T, clause *SQLClause, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, `EXISTS (SELECT 1 FROM jsonb_array_elements(data->'emails') AS elem WHERE LOWER(elem->>'value') LIKE LOWER(?) ESCAPE '\')`, clause.Where)
+			},
+		},
+		{
+			name:   "multiValued simple attribute",
+			filter: `schemas eq "urn:ietf:params:scim:schemas:core:2.0:User"`,
+			expect: func(t *testing.T, clause *SQLClause, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, `EXISTS (SELECT 1 FROM jsonb_array_elements_text(data->'schemas') AS elem WHERE elem = ?)`, clause.Where)
+			},
+		},
+		{
+			name:   "multiValued attribute present",
+			filter: `emails pr`,
+			expect: func(t *testing.T, clause *SQLClause, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, `EXISTS (SELECT 1 FROM jsonb_array_elements(data->'emails') AS elem WHERE elem IS NOT NULL)`, clause.Where)
+			},
+		},
+		{
+			name:   "extension attribute",
+			filter: `urn:ietf:params:scim:schemas:extension:enterprise:2.0:User:manager.value eq "foo"`,
+			expect: func(t *testing.T, clause *SQLClause, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, `LOWER(data->'urn:ietf:params:scim:schemas:extension:enterprise:2.0:User'->'manager'->>'value') = LOWER(?)`, clause.Where)
+			},
+		},
+		{
+			name:   "sort by multiValued attribute",
+			filter: `id pr`,
+			sort:   &crud.Sort{By: "emails.value"},
+			expect: func(t *testing.T, clause *SQLClause, err error) {
+				assert.Equal(t, spec.ErrInvalidSyntax, errors.Unwrap(err))
+			},
+		},
+	}
+
+	for _, test := range tests {
+		s.T().Run(test.name, func(t *testing.T) {
+			clause, err := SQLCompiler(s.resourceType, mapping, Question).Compile(test.filter, test.sort, nil)
+			test.expect(t, clause, err)
+		})
+	}
+}
+
+func (s *SQLTestSuite) TestCompileWithJSONBContainment() {
+	mapping := Chain(Columns(map[string]string{"id": "id"}), JSONBContainment("data"))
+
+	tests := []struct {
+		name   string
+		filter string
+		expect func(t *testing.T, clause *SQLClause, err error)
+	}{
+		{
+			name:   "dedicated column takes precedence",
+			filter: `id eq "foo"`,
+			expect: func(t *testing.T, clause *SQLClause, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, "id = $1", clause.Where)
+			},
+		},
+		{
+			name:   "typed attribute",
+			filter: `active eq true`,
+			expect: func(t *testing.T, clause *SQLClause, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, "data @> $1::jsonb", clause.Where)
+				assert.Equal(t, []interface{}{`{"active":true}`}, clause.Args)
+			},
+		},
+		{
+			name:   "multiValued simple attribute",
+			filter: `schemas eq "urn:ietf:params:scim:schemas:core:2.0:User"`,
+			expect: func(t *testing.T, clause *SQLClause, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, "data @> $1::jsonb", clause.Where)
+				assert.Equal(t, []interface{}{`{"schemas":["urn:ietf:params:scim:schemas:core:2.0:User"]}`}, clause.Args)
+			},
+		},
+		{
+			name:   "multiValued complex attribute",
+			filter: `x509Certificates.value eq "Zm9v" and emails.primary eq true`,
+			expect: func(t *testing.T, clause *SQLClause, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, "(data @> $1::jsonb AND data @> $2::jsonb)", clause.Where)
+				assert.Equal(t, []interface{}{`{"x509Certificates":[{"value":"Zm9v"}]}`, `{"emails":[{"primary":true}]}`}, clause.Args)
+			},
+		},
+		{
+			name:   "case insensitive attribute is compared",
+			filter: `emails.value eq "foo@bar.com"`,
+			expect: func(t *testing.T, clause *SQLClause, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, "EXISTS (SELECT 1 FROM jsonb_array_elements(data->'emails') AS elem WHERE LOWER(elem->>'value') = LOWER($1))", clause.Where)
+			},
+		},
+		{
+			name:   "case insensitive reference is compared",
+			filter: `profileUrl eq "https://Foo.com/imulab"`,
+			expect: func(t *testing.T, clause *SQLClause, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, "LOWER(data->>'profileUrl') = LOWER($1)", clause.Where)
+			},
+		},
+		{
+			name:   "other operators are compared",
+			filter: `active ne true`,
+			expect: func(t *testing.T, clause *SQLClause, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, "((data->>'active')::boolean IS NULL OR (data->>'active')::boolean <> $1)", clause.Where)
+			},
+		},
+		{
+			name:   "incompatible value",
+			filter: `active eq "foo"`,
+			expect: func(t *testing.T, clause *SQLClause, err error) {
+				assert.True(t, errors.Is(err, spec.ErrInvalidFilter))
+			},
+		},
+	}
+
+	for _, test := range tests {
+		s.T().Run(test.name, func(t *testing.T) {
+			clause, err := SQLCompiler(s.resourceType, mapping, Dollar).Compile(test.filter, nil, nil)
+			test.expect(t, clause, err)
+		})
+	}
+}
+
+func (s *SQLTestSuite) TestCompileWithJSON1() {
+	mapping := Chain(Columns(map[string]string{"id": "id"}), JSON1("doc"))
+
+	tests := []struct {
+		name   string
+		filter string
+		sort   *crud.Sort
+		expect func(t *testing.T, clause *SQLClause, err error)
+	}{
+		{
+			name:   "singular nested attribute",
+			filter: `name.familyName eq "Qiu"`,
+			expect: func(t *testing.T, clause *SQLClause, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, `LOWER(json_extract(doc, '$."name"."familyName"')) = LOWER(?)`, clause.Where)
+			},
+		},
+		{
+			name:   "date time is compared as julian day",
+			filter: `meta.lastModified gt "2020-01-01T00:00:00Z"`,
+			expect: func(t *testing.T, clause *SQLClause, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, `julianday(json_extract(doc, '$."meta"."lastModified"')) > ?`, clause.Where)
+				assert.Equal(t, []interface{}{2458849.5}, clause.Args)
+			},
+		},
+		{
+			name:   "multiValued complex attribute",
+			filter: `emails.value co "foo"`,
+			expect: func(t *testing.T, clause *SQLClause, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, `EXISTS (SELECT 1 FROM json_each(doc, '$."emails"') AS elem WHERE LOWER(json_extract(elem.value, '$."value"')) LIKE LOWER(?) ESCAPE '\')`, clause.Where)
+			},
+		},
+		{
+			name:   "multiValued simple attribute",
+			filter: `schemas eq "urn:ietf:params:scim:schemas:core:2.0:User"`,
+			expect: func(t *testing.T, clause *SQLClause, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, `EXISTS (SELECT 1 FROM json_each(doc, '$."schemas"') AS elem WHERE elem.value = ?)`, clause.Where)
+			},
+		},
+		{
+			name:   "extension attribute",
+			filter: `urn:ietf:params:scim:schemas:extension:enterprise:2.0:User:employeeNumber eq "42"`,
+			expect: func(t *testing.T, clause *SQLClause, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, `LOWER(json_extract(doc, '$."urn:ietf:params:scim:schemas:extension:enterprise:2.0:User"."employeeNumber"')) = LOWER(?)`, clause.Where)
+			},
+		},
+		{
+			name: "sort",
+			sort: &crud.Sort{By: "meta.created", Order: crud.SortDesc},
+			expect: func(t *testing.T, clause *SQLClause, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, `CASE WHEN julianday(json_extract(doc, '$."meta"."created"')) IS NULL THEN 1 ELSE 0 END DESC, julianday(json_extract(doc, '$."meta"."created"')) DESC, id ASC`, clause.OrderBy)
+			},
+		},
+	}
+
+	for _, test := range tests {
+		s.T().Run(test.name, func(t *testing.T) {
+			clause, err := SQLCompiler(s.resourceType, mapping, Question).Compile(test.filter, test.sort, nil)
+			test.expect(t, clause, err)
+		})
+	}
+}
+
+func (s *SQLTestSuite) SetupSuite() {
+	for _, each := range []struct {
+		filepath  string
+		structure interface{}
+		post      func(parsed interface{})
+	}{
+		{
+			filepath:  "../../../../public/schemas/core_schema.json",
+			structure: new(spec.Schema),
+			post: func(parsed interface{}) {
+				spec.Schemas().Register(parsed.(*spec.Schema))
+			},
+		},
+		{
+			filepath:  "../../../../public/schemas/user_schema.json",
+			structure: new(spec.Schema),
+			post: func(parsed interface{}) {
+				spec.Schemas().Register(parsed.(*spec.Schema))
+			},
+		},
+		{
+			filepath:  "../../../../public/schemas/user_enterprise_extension_schema.json",
+			structure: new(spec.Schema),
+			post: func(parsed interface{}) {
+				spec.Schemas().Register(parsed.(*spec.Schema))
+			},
+		},
+		{
+			filepath:  "../../../../public/resource_types/user_resource_type.json",
+			structure: new(spec.ResourceType),
+			post: func(parsed interface{}) {
+				s.resourceType = parsed.(*spec.ResourceType)
+				crud.Register(s.resourceType)
+			},
+		},
+	} {
+		f, err := os.Open(each.filepath)
+		require.Nil(s.T(), err)
+
+		raw, err := ioutil.ReadAll(f)
+		require.Nil(s.T(), err)
+
+		err = json.Unmarshal(raw, each.structure)
+		require.Nil(s.T(), err)
+
+		if each.post != nil {
+			each.post(each.structure)
+		}
+	}
+}
@@ -62,38 +62,54 @@ func (t traverser) traverseNext(query *expr.Expression) error {
 func (t traverser) traverseSelectedElements(query *expr.Expression) error {
 	selector := t.elementStrategy(t.nav.Current())
 
-	return t.nav.Current().ForEachChild(func(index int, child prop.Property) error {
-		if !selector(index, child) { // skip elements not satisfied by strategy
-			return nil
+	var selected []prop.Property
+	_ = t.nav.Current().ForEachChild(func(index int, child prop.Property) error {
+		if selector(index, child) {
+			selected = append(selected, child)
 		}
+		return nil
+	})
 
-		t.nav.At(index)
-		if err := t.nav.Error(); err != nil {
+	return t.traverseElements(selected, query)
+}
+
+func (t traverser) traverseQualifiedElements(filter *expr.Expression) error {
+	var qualified []prop.Property
+	if err := t.nav.ForEachChild(func(index int, child prop.Property) error {
+		r, err := evaluator{base: child, filter: filter}.evaluate()
+		if err != nil {
 			return err
+		} else if r {
+			qualified = append(qualified, child)
 		}
-		defer t.nav.Retract()
+		return nil
+	}); err != nil {
+		return err
+	}
 
-		return t.traverse(query)
-	})
+	return t.traverseElements(qualified, filter.Next())
 }
 
-func (t traverser) traverseQualifiedElements(filter *expr.Expression) error {
-	return t.nav.ForEachChild(func(index int, child prop.Property) error {
-		t.nav.At(index)
+// Traverse into each of the elements. Elements are collected before traversal and located again by identity, because
+// modifications made by the callback (i.e. deleting an element of an auto compacted property) may shift the index of
+// the remaining elements.
+func (t traverser) traverseElements(elements []prop.Property, query *expr.Expression) error {
+	for _, elem := range elements {
+		target := elem
+		t.nav.Where(func(child prop.Property) bool {
+			return child == target
+		})
 		if err := t.nav.Error(); err != nil {
 			return err
 		}
-		defer t.nav.Retract()
 
-		r, err := evaluator{base: t.nav.Current(), filter: filter}.evaluate()
+		err := t.traverse(query)
+		t.nav.Retract()
 		if err != nil {
 			return err
-		} else if !r {
-			return nil
 		}
-
-		return t.traverse(filter.Next())
-	})
+	}
+	return nil
 }
 
 type elementStrategy func(multiValuedComplex prop.Property) func(index int, child prop.Property) bool
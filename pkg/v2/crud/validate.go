@@ -0,0 +1,163 @@
+package crud
+
+import (
+	"fmt"
+	"github.com/imulab/go-scim/pkg/v2/crud/expr"
+	"github.com/imulab/go-scim/pkg/v2/spec"
+	"strconv"
+	"strings"
+)
+
+// ValidateFilter validates the compiled filter against the resource type. It verifies that every attribute path in
+// the filter is defined by the resource type, that the operators are applicable to the type of the attributes they
+// are applied to (i.e. gt cannot be applied to boolean attributes, sw cannot be applied to integer attributes), and
+// that the literals can be parsed as the type of the attributes they are compared with. Any violation is reported
+// as spec.ErrInvalidFilter, along with the offending segment of the filter.
+//
+// The main schema URN prefix in attribute paths is optional. Paths containing nested filters (i.e. emails[type eq
+// "work"].value) are rejected, as they are not supported in filters.
+func ValidateFilter(filter *expr.Expression, resourceType *spec.ResourceType) error {
+	if filter == nil {
+		return fmt.Errorf("%w: empty filter", spec.ErrInvalidFilter)
+	}
+	return newFilterValidator(resourceType).validate(filter)
+}
+
+type filterValidator struct {
+	resourceType *spec.ResourceType
+	superAttr    *spec.Attribute
+}
+
+func newFilterValidator(resourceType *spec.ResourceType) filterValidator {
+	return filterValidator{
+		resourceType: resourceType,
+		superAttr:    resourceType.SuperAttribute(true),
+	}
+}
+
+func (v filterValidator) validate(root *expr.Expression) error {
+	switch root.Kind() {
+	case expr.KindLogicalOperator:
+		if err := v.validate(root.Left()); err != nil {
+			return err
+		}
+		if root.Right() == nil {
+			return nil
+		}
+		return v.validate(root.Right())
+	case expr.KindRelationalOperator:
+		return v.validateRelational(root)
+	default:
+		return fmt.Errorf("%w: unexpected '%s' in filter, expecting an operator", spec.ErrInvalidFilter, root.Token())
+	}
+}
+
+func (v filterValidator) validateRelational(op *expr.Expression) error {
+	cursor, err := v.resolve(op)
+	if err != nil {
+		return err
+	}
+
+	if !v.isApplicable(op.Token(), cursor) {
+		return fmt.Errorf("%w: operator '%s' cannot be applied to %s attribute '%s'", spec.ErrInvalidFilter,
+			op.Token(), cursor.Type().String(), cursor.Path())
+	}
+
+	if strings.ToLower(op.Token()) == expr.Pr {
+		return nil
+	}
+	if op.Right() == nil {
+		return fmt.Errorf("%w: missing value for operator '%s' on attribute '%s'", spec.ErrInvalidFilter, op.Token(), cursor.Path())
+	}
+	if !v.isParsable(op.Right().Token(), cursor) {
+		return fmt.Errorf("%w: value '%s' is incompatible with %s attribute '%s'", spec.ErrInvalidFilter,
+			op.Right().Token(), cursor.Type().String(), cursor.Path())
+	}
+	return nil
+}
+
+// Resolves the attribute targeted by the relational operator. The main schema URN prefix is optional.
+func (v filterValidator) resolve(op *expr.Expression) (*spec.Attribute, error) {
+	if op.Left() == nil {
+		return nil, fmt.Errorf("%w: missing attribute path for operator '%s'", spec.ErrInvalidFilter, op.Token())
+	}
+	return v.resolvePath(op.Left())
+}
+
+// Resolves the attribute targeted by the attribute path. The main schema URN prefix is optional.
+func (v filterValidator) resolvePath(path *expr.Expression) (*spec.Attribute, error) {
+	if path != nil && path.IsPath() && strings.ToLower(path.Token()) == strings.ToLower(v.resourceType.Schema().ID()) {
+		path = path.Next()
+	}
+	if path == nil {
+		return nil, fmt.Errorf("%w: missing attribute path", spec.ErrInvalidFilter)
+	}
+
+	var (
+		cursor = v.superAttr
+		walked = make([]string, 0)
+	)
+	for ; path != nil; path = path.Next() {
+		if path.IsRootOfFilter() {
+			return nil, fmt.Errorf("%w: nested filter after '%s' is not supported", spec.ErrInvalidFilter, strings.Join(walked, "."))
+		}
+		walked = append(walked, path.Token())
+		if cursor.MultiValued() {
+			cursor = cursor.DeriveElementAttribute()
+		}
+		if cursor = cursor.SubAttributeForName(path.Token()); cursor == nil {
+			return nil, fmt.Errorf("%w: attribute '%s' is not defined in resource type '%s'", spec.ErrInvalidFilter,
+				strings.Join(walked, "."), v.resourceType.Name())
+		}
+	}
+	return cursor, nil
+}
+
+// Returns true if the operator can be applied to the attribute. This follows the capabilities of the properties
+// (see prop.EqCapable and alike). MultiValued attributes are treated as their elements, except for the pr operator.
+func (v filterValidator) isApplicable(op string, attr *spec.Attribute) bool {
+	switch strings.ToLower(op) {
+	case expr.Pr:
+		return true
+	case expr.Eq, expr.Ne:
+		return attr.Type() != spec.TypeComplex
+	case expr.Sw, expr.Ew, expr.Co, expr.Re:
+		return attr.Type() == spec.TypeString || attr.Type() == spec.TypeReference
+	case expr.Gt, expr.Ge, expr.Lt, expr.Le:
+		switch attr.Type() {
+		case spec.TypeString, spec.TypeDateTime, spec.TypeInteger, spec.TypeDecimal:
+			return true
+		default:
+			return false
+		}
+	default:
+		return false
+	}
+}
+
+// Returns true if the literal can be parsed as the type of the attribute.
+func (v filterValidator) isParsable(literal string, attr *spec.Attribute) bool {
+	switch attr.Type() {
+	case spec.TypeString, spec.TypeReference, spec.TypeBinary:
+		_, err := expr.Unquote(literal)
+		return err == nil
+	case spec.TypeDateTime:
+		s, err := expr.Unquote(literal)
+		if err != nil {
+			return false
+		}
+		_, err = spec.ParseDateTime(s)
+		return err == nil
+	case spec.TypeBoolean:
+		_, err := strconv.ParseBool(literal)
+		return err == nil
+	case spec.TypeInteger:
+		_, err := strconv.ParseInt(literal, 10, 64)
+		return err == nil
+	case spec.TypeDecimal:
+		_, err := strconv.ParseFloat(literal, 64)
+		return err == nil
+	default:
+		return false
+	}
+}
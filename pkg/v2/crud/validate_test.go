@@ -0,0 +1,180 @@
+package crud
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/imulab/go-scim/pkg/v2/crud/expr"
+	"github.com/imulab/go-scim/pkg/v2/spec"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestValidateFilter(t *testing.T) {
+	s := new(ValidateFilterTestSuite)
+	suite.Run(t, s)
+}
+
+type ValidateFilterTestSuite struct {
+	suite.Suite
+	resourceType *spec.ResourceType
+}
+
+func (s *ValidateFilterTestSuite) TestValidateFilter() {
+	tests := []struct {
+		name   string
+		filter string
+		expect func(t *testing.T, err error)
+	}{
+		{
+			name:   "valid filter",
+			filter: `(userName eq "imulab" or emails.value ew "@foo.com") and not (active eq false) and meta.lastModified gt "2019-12-20T04:40:00"`,
+			expect: func(t *testing.T, err error) {
+				assert.Nil(t, err)
+			},
+		},
+		{
+			name:   "main schema urn prefix",
+			filter: `urn:ietf:params:scim:schemas:core:2.0:User:userName sw "im"`,
+			expect: func(t *testing.T, err error) {
+				assert.Nil(t, err)
+			},
+		},
+		{
+			name:   "extension attribute",
+			filter: `urn:ietf:params:scim:schemas:extension:enterprise:2.0:User:manager.value eq "foo"`,
+			expect: func(t *testing.T, err error) {
+				assert.Nil(t, err)
+			},
+		},
+		{
+			name:   "pr on complex",
+			filter: `name pr`,
+			expect: func(t *testing.T, err error) {
+				assert.Nil(t, err)
+			},
+		},
+		{
+			name:   "unknown attribute",
+			filter: `name.nickName eq "foo"`,
+			expect: func(t *testing.T, err error) {
+				assert.Equal(t, spec.ErrInvalidFilter, errors.Unwrap(err))
+				assert.Contains(t, err.Error(), "'name.nickName'")
+			},
+		},
+		{
+			name:   "gt on boolean",
+			filter: `active gt true`,
+			expect: func(t *testing.T, err error) {
+				assert.Equal(t, spec.ErrInvalidFilter, errors.Unwrap(err))
+				assert.Contains(t, err.Error(), "'gt'")
+			},
+		},
+		{
+			name:   "sw on dateTime",
+			filter: `meta.created sw "2019"`,
+			expect: func(t *testing.T, err error) {
+				assert.Equal(t, spec.ErrInvalidFilter, errors.Unwrap(err))
+			},
+		},
+		{
+			name:   "eq on complex",
+			filter: `name eq "foo"`,
+			expect: func(t *testing.T, err error) {
+				assert.Equal(t, spec.ErrInvalidFilter, errors.Unwrap(err))
+			},
+		},
+		{
+			name:   "unquoted string",
+			filter: `userName eq 123`,
+			expect: func(t *testing.T, err error) {
+				assert.Equal(t, spec.ErrInvalidFilter, errors.Unwrap(err))
+				assert.Contains(t, err.Error(), "'123'")
+			},
+		},
+		{
+			name:   "quoted boolean",
+			filter: `active eq "true"`,
+			expect: func(t *testing.T, err error) {
+				assert.Equal(t, spec.ErrInvalidFilter, errors.Unwrap(err))
+			},
+		},
+		{
+			name:   "malformed dateTime",
+			filter: `meta.created gt "yesterday"`,
+			expect: func(t *testing.T, err error) {
+				assert.Equal(t, spec.ErrInvalidFilter, errors.Unwrap(err))
+			},
+		},
+		{
+			name:   "invalid right hand side of logical operator",
+			filter: `userName pr and foo pr`,
+			expect: func(t *testing.T, err error) {
+				assert.Equal(t, spec.ErrInvalidFilter, errors.Unwrap(err))
+				assert.Contains(t, err.Error(), "'foo'")
+			},
+		},
+	}
+
+	for _, test := range tests {
+		s.T().Run(test.name, func(t *testing.T) {
+			root, err := expr.CompileFilter(test.filter)
+			require.Nil(t, err)
+			test.expect(t, ValidateFilter(root, s.resourceType))
+		})
+	}
+}
+
+func (s *ValidateFilterTestSuite) SetupSuite() {
+	for _, each := range []struct {
+		filepath  string
+		structure interface{}
+		post      func(parsed interface{})
+	}{
+		{
+			filepath:  "../../../public/schemas/core_schema.json",
+			structure: new(spec.Schema),
+			post: func(parsed interface{}) {
+				spec.Schemas().Register(parsed.(*spec.Schema))
+			},
+		},
+		{
+			filepath:  "../../../public/schemas/user_schema.json",
+			structure: new(spec.Schema),
+			post: func(parsed interface{}) {
+				spec.Schemas().Register(parsed.(*spec.Schema))
+			},
+		},
+		{
+			filepath:  "../../../public/schemas/user_enterprise_extension_schema.json",
+			structure: new(spec.Schema),
+			post: func(parsed interface{}) {
+				spec.Schemas().Register(parsed.(*spec.Schema))
+			},
+		},
+		{
+			filepath:  "../../../public/resource_types/user_resource_type.json",
+			structure: new(spec.ResourceType),
+			post: func(parsed interface{}) {
+				s.resourceType = parsed.(*spec.ResourceType)
+				Register(s.resourceType)
+			},
+		},
+	} {
+		f, err := os.Open(each.filepath)
+		require.Nil(s.T(), err)
+
+		raw, err := ioutil.ReadAll(f)
+		require.Nil(s.T(), err)
+
+		err = json.Unmarshal(raw, each.structure)
+		require.Nil(s.T(), err)
+
+		if each.post != nil {
+			each.post(each.structure)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package db
+
+import (
+	"context"
+	"github.com/imulab/go-scim/pkg/v2/prop"
+	"github.com/imulab/go-scim/pkg/v2/spec"
+)
+
+// BulkWriteDB is implemented by DB that can write many resources in fewer round trips than calling Insert, Replace or
+// Delete for every resource, i.e. for bulk requests and imports. The writes are not atomic (see TxDB for that): every
+// resource is written or fails on its own, with the same errors as the methods writing a single resource, i.e.
+// spec.ErrUniqueness or spec.ErrConflict. The errors are returned in a slice of the length and in the order of the
+// resources, with nil for the resources written; an error that fails the whole batch, i.e. of the connection, is
+// reported for every resource.
+type BulkWriteDB interface {
+	DB
+	// InsertMany inserts the resources, like Insert.
+	InsertMany(ctx context.Context, resources []*prop.Resource) []error
+	// ReplaceMany replaces the reference resources with the replacement resources, like Replace.
+	ReplaceMany(ctx context.Context, replacements []Replacement) []error
+	// DeleteMany deletes the resources, like Delete.
+	DeleteMany(ctx context.Context, resources []*prop.Resource) []error
+}
+
+// Replacement is the pair of the reference and the replacement resource of a replace (see DB.Replace).
+type Replacement struct {
+	Ref         *prop.Resource
+	Replacement *prop.Resource
+}
+
+// InsertMany inserts the resources into the database, in fewer round trips if it is a BulkWriteDB, or by calling Insert
+// for every resource otherwise, and returns the error of every resource (see BulkWriteDB).
+func InsertMany(ctx context.Context, database DB, resources []*prop.Resource) []error {
+	if len(resources) == 0 {
+		return []error{}
+	}
+	if bulkDB, ok := database.(BulkWriteDB); ok {
+		return bulkDB.InsertMany(ctx, resources)
+	}
+
+	errs := make([]error, len(resources))
+	for i, resource := range resources {
+		errs[i] = database.Insert(ctx, resource)
+	}
+	return errs
+}
+
+// ReplaceMany replaces the resources in the database, in fewer round trips if it is a BulkWriteDB, or by calling
+// Replace for every replacement otherwise, and returns the error of every replacement (see BulkWriteDB).
+func ReplaceMany(ctx context.Context, database DB, replacements []Replacement) []error {
+	if len(replacements) == 0 {
+		return []error{}
+	}
+	if bulkDB, ok := database.(BulkWriteDB); ok {
+		return bulkDB.ReplaceMany(ctx, replacements)
+	}
+
+	errs := make([]error, len(replacements))
+	for i, r := range replacements {
+		errs[i] = database.Replace(ctx, r.Ref, r.Replacement)
+	}
+	return errs
+}
+
+// DeleteMany deletes the resources from the database, in fewer round trips if it is a BulkWriteDB, or by calling Delete
+// for every resource otherwise, and returns the error of every resource (see BulkWriteDB).
+func DeleteMany(ctx context.Context, database DB, resources []*prop.Resource) []error {
+	if len(resources) == 0 {
+		return []error{}
+	}
+	if bulkDB, ok := database.(BulkWriteDB); ok {
+		return bulkDB.DeleteMany(ctx, resources)
+	}
+
+	errs := make([]error, len(resources))
+	for i, resource := range resources {
+		errs[i] = database.Delete(ctx, resource)
+	}
+	return errs
+}
+
+// BulkError returns nil if all the resources of a bulk write were written, or the errors of those that were not as
+// spec.Errors otherwise, unless there is only one, which is returned as is (see spec.Errors.AsError).
+func BulkError(errs []error) error {
+	var failed spec.Errors
+	for _, err := range errs {
+		if err != nil {
+			failed = append(failed, err)
+		}
+	}
+	return failed.AsError()
+}
+
+// Returns the error for every one of n resources, as the error of a BulkWriteDB failing the whole batch.
+func errorsOf(n int, err error) []error {
+	errs := make([]error, n)
+	for i := range errs {
+		errs[i] = err
+	}
+	return errs
+}
@@ -0,0 +1,558 @@
+package db
+
+import (
+	"container/list"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/imulab/go-scim/pkg/v2/crud"
+	"github.com/imulab/go-scim/pkg/v2/crud/expr"
+	scimjson "github.com/imulab/go-scim/pkg/v2/json"
+	"github.com/imulab/go-scim/pkg/v2/prop"
+	"github.com/imulab/go-scim/pkg/v2/spec"
+	"github.com/imulab/go-scim/pkg/v2/tenant"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Cache is a key value store with expiration, which holds the resources and query results cached by Cached.
+// Implementations shall be safe for concurrent use. LRUCache is the in-process implementation; caches shared by many
+// instances of the server, i.e. Redis, are provided by modules of their own.
+type Cache interface {
+	// Get returns the value of the key, or false if the key is absent or has expired.
+	Get(ctx context.Context, key string) (value []byte, ok bool, err error)
+	// Set the value of the key, which expires after ttl, or never if ttl is not positive.
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	// Delete the keys. Absent keys are not an error.
+	Delete(ctx context.Context, keys ...string) error
+}
+
+// DefaultLRUCacheSize is the size of LRUCache used when a non-positive size is requested.
+const DefaultLRUCacheSize = 10000
+
+// LRUCache returns an in-process Cache that holds at most size entries. When the cache is full, the least recently
+// used entry is evicted. If size is not positive, DefaultLRUCacheSize is used.
+func LRUCache(size int) Cache {
+	if size <= 0 {
+		size = DefaultLRUCacheSize
+	}
+	return &lruCache{
+		size:  size,
+		order: list.New(),
+		items: make(map[string]*list.Element, size),
+	}
+}
+
+type lruCache struct {
+	mu    sync.Mutex
+	size  int
+	order *list.List
+	items map[string]*list.Element
+}
+
+type lruCacheEntry struct {
+	key     string
+	value   []byte
+	expires time.Time // zero if the entry never expires
+}
+
+func (c *lruCache) Get(_ context.Context, key string) ([]byte, bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.items[key]
+	if !ok {
+		return nil, false, nil
+	}
+	entry := elem.Value.(*lruCacheEntry)
+	if !entry.expires.IsZero() && time.Now().After(entry.expires) {
+		c.order.Remove(elem)
+		delete(c.items, key)
+		return nil, false, nil
+	}
+	c.order.MoveToFront(elem)
+	return entry.value, true, nil
+}
+
+func (c *lruCache) Set(_ context.Context, key string, value []byte, ttl time.Duration) error {
+	entry := &lruCacheEntry{key: key, value: value}
+	if ttl > 0 {
+		entry.expires = time.Now().Add(ttl)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.items[key]; ok {
+		elem.Value = entry
+		c.order.MoveToFront(elem)
+		return nil
+	}
+	c.items[key] = c.order.PushFront(entry)
+	if c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.items, oldest.Value.(*lruCacheEntry).key)
+	}
+	return nil
+}
+
+func (c *lruCache) Delete(_ context.Context, keys ...string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, key := range keys {
+		if elem, ok := c.items[key]; ok {
+			c.order.Remove(elem)
+			delete(c.items, key)
+		}
+	}
+	return nil
+}
+
+// CacheOptions tune the caching of Cached. Zero values use the defaults.
+type CacheOptions struct {
+	// Prefix of the keys of the entries, so that the resource types, and applications, sharing a cache are apart.
+	// Defaults to "scim:" followed by the id of the resource type and a colon.
+	Prefix string
+	// TTL of the entries, which bounds how long the cache may serve resources modified other than through the
+	// decorator, i.e. by another instance of the server with an in-process cache. Defaults to 5 minutes.
+	TTL time.Duration
+	// Queries reports whether the results of Query and Count with the compiled filter are cached. Defaults to
+	// filters of a single eq comparison, i.e. userName eq "bob", which are the lookups identity providers issue before
+	// provisioning, and the uniqueness checks issue on every write.
+	Queries func(root *expr.Expression) bool
+}
+
+// Cached returns a DB that caches the resources of the given database, and the results of common queries, in the
+// cache. Get is read-through: resources are loaded into the cache when missed. Insert and Replace are write-through:
+// the written resources are stored in the cache once the database succeeds. Delete removes the resource from the
+// cache. GetMany is served from the cache for the resources hit, and from the database for the rest.
+//
+// The results of Query and Count with the filters accepted by CacheOptions.Queries are cached as well, Query by the
+// ids of the resources, along with sort and pagination. Caching a query result would be invalidated by any write
+// through the decorator, as the written resource may enter or leave it; to avoid deleting query results one by one,
+// their keys carry a generation that is replaced upon every write, so that the results of earlier generations are no
+// longer hit, and are left to expire. QueryCursor is not cached.
+//
+// Resources and query results are only cached when no projection is given, as implementations may honor the
+// projection and return partial resources. Cached resources serve requests with projections, which implementations
+// may ignore anyway. Resources are cached as JSON documents of all their attributes, and every hit is a new resource
+// restored from the document, so that callers may modify it. Keys are scoped by the tenant carried by the context
+// (see tenant.Scope).
+//
+// Reads that fail in the cache fall back to the database. Writes that succeed in the database but fail to update the
+// cache return an error of spec.ErrInternal, as the cache may then serve the stale resource until it expires. A read
+// through racing with a write may still put the stale resource in the cache, which the TTL bounds as well.
+//
+// The returned DB also implements CursorDB, returning an error of spec.ErrInvalidSyntax if the given database does
+// not, BatchDB, ElementDB, which pages through the elements of the cached resources, or of the given database, and
+// TxDB, which calls WithTx on the given database. Within a transaction, nothing is put in the cache,
+// and the resources written are only removed from it, along with the query results, once the transaction ends, as
+// they may be rolled back.
+//
+// The returned DB implements ChangeStreamDB as well, if the given database does (see Subscribe). Its Subscribe removes
+// every resource changed from the cache, and replaces the generation of the query results, before fn is called, so
+// that the instances of the server keeping caches of their own, i.e. LRUCache, stop serving the resources changed by
+// the others as soon as they are notified, rather than when they expire. fn may be nil when subscribing only for that.
+func Cached(resourceType *spec.ResourceType, database DB, cache Cache, options CacheOptions) DB {
+	if len(options.Prefix) == 0 {
+		options.Prefix = "scim:" + resourceType.ID() + ":"
+	}
+	if options.TTL <= 0 {
+		options.TTL = 5 * time.Minute
+	}
+	if options.Queries == nil {
+		options.Queries = func(root *expr.Expression) bool {
+			return root != nil && strings.ToLower(root.Token()) == expr.Eq && root.IsRelationalOperator()
+		}
+	}
+	return &cachedDB{
+		resourceType: resourceType,
+		database:     database,
+		cache:        cache,
+		options:      options,
+		filters:      crud.NewFilterCache(0),
+	}
+}
+
+type cachedDB struct {
+	resourceType *spec.ResourceType
+	database     DB
+	cache        Cache
+	options      CacheOptions
+	filters      *crud.FilterCache
+}
+
+// cachedQuery is the cached result of Query, or Count.
+type cachedQuery struct {
+	IDs   []string `json:"ids,omitempty"`
+	Count int      `json:"count,omitempty"`
+}
+
+func (d *cachedDB) Insert(ctx context.Context, resource *prop.Resource) error {
+	if err := d.database.Insert(ctx, resource); err != nil {
+		return err
+	}
+	return d.written(ctx, resource.IdOrEmpty(), resource)
+}
+
+func (d *cachedDB) Count(ctx context.Context, filter string) (int, error) {
+	key, ok := d.queryKey(ctx, "count", filter, nil, nil)
+	if ok {
+		var cached cachedQuery
+		if d.getJSON(ctx, key, &cached) {
+			return cached.Count, nil
+		}
+	}
+
+	n, err := d.database.Count(ctx, filter)
+	if err != nil {
+		return 0, err
+	}
+	if ok {
+		d.setJSON(ctx, key, &cachedQuery{Count: n})
+	}
+	return n, nil
+}
+
+func (d *cachedDB) Get(ctx context.Context, id string, projection *crud.Projection) (*prop.Resource, error) {
+	if resource := d.getResource(ctx, id); resource != nil {
+		return resource, nil
+	}
+
+	resource, err := d.database.Get(ctx, id, projection)
+	if err != nil {
+		return nil, err
+	}
+	if projection == nil {
+		d.setResource(ctx, resource)
+	}
+	return resource, nil
+}
+
+func (d *cachedDB) GetMany(ctx context.Context, ids []string, projection *crud.Projection) ([]*prop.Resource, error) {
+	ids = distinct(ids)
+
+	var (
+		resources = make([]*prop.Resource, 0, len(ids))
+		missed    = make([]string, 0)
+	)
+	for _, id := range ids {
+		if resource := d.getResource(ctx, id); resource != nil {
+			resources = append(resources, resource)
+		} else {
+			missed = append(missed, id)
+		}
+	}
+	if len(missed) == 0 {
+		return resources, nil
+	}
+
+	loaded, err := GetMany(ctx, d.database, missed, projection)
+	if err != nil {
+		return nil, err
+	}
+	if projection == nil {
+		for _, resource := range loaded {
+			d.setResource(ctx, resource)
+		}
+	}
+	return SortByIDs(append(resources, loaded...), ids), nil
+}
+
+func (d *cachedDB) CountElements(ctx context.Context, id string, attribute string) (int, error) {
+	if resource := d.getResource(ctx, id); resource != nil {
+		property, err := elementsOf(resource, attribute)
+		if err != nil {
+			return 0, err
+		}
+		return property.CountChildren(), nil
+	}
+	return CountElements(ctx, d.database, id, attribute)
+}
+
+func (d *cachedDB) GetElements(ctx context.Context, id string, attribute string, pagination *crud.Pagination) ([]interface{}, error) {
+	if resource := d.getResource(ctx, id); resource != nil {
+		property, err := elementsOf(resource, attribute)
+		if err != nil {
+			return nil, err
+		}
+		return PageElements(property, pagination), nil
+	}
+	return GetElements(ctx, d.database, id, attribute, pagination)
+}
+
+func (d *cachedDB) Replace(ctx context.Context, ref *prop.Resource, replacement *prop.Resource) error {
+	if err := d.database.Replace(ctx, ref, replacement); err != nil {
+		// The stored resource may not be what the cache holds, i.e. after a conflict.
+		_ = d.cache.Delete(ctx, d.resourceKey(ctx, ref.IdOrEmpty()))
+		return err
+	}
+	return d.written(ctx, ref.IdOrEmpty(), replacement)
+}
+
+func (d *cachedDB) Delete(ctx context.Context, resource *prop.Resource) error {
+	if err := d.database.Delete(ctx, resource); err != nil {
+		_ = d.cache.Delete(ctx, d.resourceKey(ctx, resource.IdOrEmpty()))
+		return err
+	}
+	return d.written(ctx, resource.IdOrEmpty(), nil)
+}
+
+func (d *cachedDB) Query(ctx context.Context, filter string, sort *crud.Sort, pagination *crud.Pagination, projection *crud.Projection) ([]*prop.Resource, error) {
+	key, ok := "", false
+	if projection == nil {
+		key, ok = d.queryKey(ctx, "query", filter, sort, pagination)
+	}
+	if ok {
+		var cached cachedQuery
+		if d.getJSON(ctx, key, &cached) {
+			resources, err := d.GetMany(ctx, cached.IDs, nil)
+			if err == nil && len(resources) == len(cached.IDs) {
+				return resources, nil
+			}
+			// Resources of the result are gone, which a write through the decorator would have invalidated.
+		}
+	}
+
+	resources, err := d.database.Query(ctx, filter, sort, pagination, projection)
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		ids := make([]string, 0, len(resources))
+		for _, resource := range resources {
+			ids = append(ids, resource.IdOrEmpty())
+			d.setResource(ctx, resource)
+		}
+		d.setJSON(ctx, key, &cachedQuery{IDs: ids})
+	}
+	return resources, nil
+}
+
+func (d *cachedDB) QueryCursor(ctx context.Context, filter string, sort *crud.Sort, pagination *crud.CursorPagination, projection *crud.Projection) ([]*prop.Resource, string, error) {
+	cursorDB, ok := d.database.(CursorDB)
+	if !ok {
+		return nil, "", fmt.Errorf("%w: cursor pagination is not supported", spec.ErrInvalidSyntax)
+	}
+	return cursorDB.QueryCursor(ctx, filter, sort, pagination, projection)
+}
+
+func (d *cachedDB) WithTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	if _, ok := ctx.Value(cachedTxKey{d}).(*cachedTx); ok {
+		return WithTx(ctx, d.database, fn)
+	}
+
+	tx := &cachedTx{ids: make(map[string]struct{})}
+	err := WithTx(ctx, d.database, func(ctx context.Context) error {
+		return fn(context.WithValue(ctx, cachedTxKey{d}, tx))
+	})
+
+	// Whether committed or not, the resources written in the transaction may no longer be what the cache holds.
+	if ids := tx.written(); len(ids) > 0 {
+		keys := make([]string, 0, len(ids)+1)
+		for _, id := range ids {
+			keys = append(keys, d.resourceKey(ctx, id))
+		}
+		cacheErr := d.cache.Delete(ctx, keys...)
+		if cacheErr == nil {
+			cacheErr = d.cache.Set(ctx, d.generationKey(ctx), []byte(newGeneration()), 0)
+		}
+		if cacheErr != nil && err == nil {
+			return fmt.Errorf("%w: transaction was committed, but the cache was not updated: %v", spec.ErrInternal, cacheErr)
+		}
+	}
+	return err
+}
+
+func (d *cachedDB) Subscribe(ctx context.Context, fn func(ctx context.Context, change *Change) error) error {
+	return Subscribe(ctx, d.database, func(ctx context.Context, change *Change) error {
+		err := d.cache.Delete(ctx, d.resourceKey(ctx, change.ID))
+		if err == nil {
+			err = d.cache.Set(ctx, d.generationKey(ctx), []byte(newGeneration()), 0)
+		}
+		if err != nil {
+			return fmt.Errorf("%w: resource '%s' was changed, but the cache was not updated: %v", spec.ErrInternal, change.ID, err)
+		}
+		if fn == nil {
+			return nil
+		}
+		return fn(ctx, change)
+	})
+}
+
+// Updates the cache after the resource by id was written to the database: stores the resource, or deletes it if nil,
+// and replaces the generation of the cached query results. Within a transaction, the id is recorded instead.
+func (d *cachedDB) written(ctx context.Context, id string, resource *prop.Resource) error {
+	if tx, ok := ctx.Value(cachedTxKey{d}).(*cachedTx); ok {
+		tx.record(id)
+		return nil
+	}
+
+	var err error
+	if resource != nil {
+		var doc []byte
+		if doc, err = marshalResource(resource); err == nil {
+			err = d.cache.Set(ctx, d.resourceKey(ctx, id), doc, d.options.TTL)
+		}
+	} else {
+		err = d.cache.Delete(ctx, d.resourceKey(ctx, id))
+	}
+	if err == nil {
+		err = d.cache.Set(ctx, d.generationKey(ctx), []byte(newGeneration()), 0)
+	}
+	if err != nil {
+		_ = d.cache.Delete(ctx, d.resourceKey(ctx, id))
+		return fmt.Errorf("%w: resource '%s' was written, but the cache was not updated: %v", spec.ErrInternal, id, err)
+	}
+	return nil
+}
+
+func (d *cachedDB) resourceKey(ctx context.Context, id string) string {
+	return tenant.Scope(ctx, d.options.Prefix+"resource:"+id)
+}
+
+func (d *cachedDB) generationKey(ctx context.Context) string {
+	return tenant.Scope(ctx, d.options.Prefix+"generation")
+}
+
+// Returns the key of the cached result of the query of the current generation, or false if the query is not cached.
+func (d *cachedDB) queryKey(ctx context.Context, kind string, filter string, sort *crud.Sort, pagination *crud.Pagination) (string, bool) {
+	if _, ok := ctx.Value(cachedTxKey{d}).(*cachedTx); ok {
+		return "", false
+	}
+	if len(strings.TrimSpace(filter)) == 0 {
+		return "", false
+	}
+	root, err := d.filters.Compile(filter, d.resourceType)
+	if err != nil || !d.options.Queries(root) {
+		return "", false
+	}
+
+	generation, ok, err := d.cache.Get(ctx, d.generationKey(ctx))
+	if err != nil {
+		return "", false
+	}
+	if !ok {
+		generation = []byte(newGeneration())
+		if err := d.cache.Set(ctx, d.generationKey(ctx), generation, 0); err != nil {
+			return "", false
+		}
+	}
+
+	var b strings.Builder
+	b.WriteString(d.options.Prefix + kind + ":" + string(generation) + ":" + filter)
+	if sort != nil {
+		b.WriteString("|sort:" + sort.By + ":" + string(sort.Order))
+	}
+	if pagination != nil {
+		b.WriteString("|page:" + strconv.Itoa(pagination.StartIndex) + ":" + strconv.Itoa(pagination.Count))
+	}
+	return tenant.Scope(ctx, b.String()), true
+}
+
+// Returns the cached resource by id, or nil if it is not cached, or was written in the transaction of the context.
+func (d *cachedDB) getResource(ctx context.Context, id string) *prop.Resource {
+	if tx, ok := ctx.Value(cachedTxKey{d}).(*cachedTx); ok && tx.has(id) {
+		return nil
+	}
+	doc, ok, err := d.cache.Get(ctx, d.resourceKey(ctx, id))
+	if err != nil || !ok {
+		return nil
+	}
+	resource := prop.NewResource(d.resourceType)
+	if err := scimjson.Deserialize(doc, resource); err != nil {
+		return nil
+	}
+	return resource
+}
+
+// Caches the resource loaded from the database, ignoring failures, as the database is consulted upon misses anyway.
+// Resources loaded within a transaction are not cached, as they may be rolled back.
+func (d *cachedDB) setResource(ctx context.Context, resource *prop.Resource) {
+	if _, ok := ctx.Value(cachedTxKey{d}).(*cachedTx); ok {
+		return
+	}
+	if doc, err := marshalResource(resource); err == nil {
+		_ = d.cache.Set(ctx, d.resourceKey(ctx, resource.IdOrEmpty()), doc, d.options.TTL)
+	}
+}
+
+func (d *cachedDB) getJSON(ctx context.Context, key string, v interface{}) bool {
+	raw, ok, err := d.cache.Get(ctx, key)
+	if err != nil || !ok {
+		return false
+	}
+	return json.Unmarshal(raw, v) == nil
+}
+
+func (d *cachedDB) setJSON(ctx context.Context, key string, v interface{}) {
+	if raw, err := json.Marshal(v); err == nil {
+		_ = d.cache.Set(ctx, key, raw, d.options.TTL)
+	}
+}
+
+type cachedTxKey struct {
+	d *cachedDB
+}
+
+// cachedTx records the ids of the resources written in a transaction.
+type cachedTx struct {
+	mu  sync.Mutex
+	ids map[string]struct{}
+}
+
+func (t *cachedTx) record(id string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.ids[id] = struct{}{}
+}
+
+func (t *cachedTx) has(id string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	_, ok := t.ids[id]
+	return ok
+}
+
+func (t *cachedTx) written() []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	ids := make([]string, 0, len(t.ids))
+	for id := range t.ids {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// Returns a random generation of cached query results.
+func newGeneration() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return strconv.FormatInt(time.Now().UnixNano(), 36)
+	}
+	return hex.EncodeToString(b)
+}
+
+// Returns the JSON document of all assigned attributes of the resource, unlike the JSON serialization for clients,
+// so that the resource can be restored as it is.
+func marshalResource(resource *prop.Resource) ([]byte, error) {
+	raw, err := json.Marshal(prop.Document(resource.RootProperty()))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", spec.ErrInternal, err)
+	}
+	return raw, nil
+}
+
+var (
+	_ CursorDB       = (*cachedDB)(nil)
+	_ BatchDB        = (*cachedDB)(nil)
+	_ ElementDB      = (*cachedDB)(nil)
+	_ TxDB           = (*cachedDB)(nil)
+	_ ChangeStreamDB = (*cachedDB)(nil)
+)
@@ -0,0 +1,62 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"github.com/imulab/go-scim/pkg/v2/prop"
+	"github.com/imulab/go-scim/pkg/v2/spec"
+	"time"
+)
+
+// Types of Change.
+const (
+	ChangeInsert = "insert"
+	ChangeUpdate = "update" // replaced or patched, or soft deleted (see SoftDelete)
+	ChangeDelete = "delete"
+)
+
+// Change of a resource in the database, as notified to the subscribers of a ChangeStreamDB.
+type Change struct {
+	Type     string         // ChangeInsert, ChangeUpdate or ChangeDelete
+	ID       string         // id of the resource, or empty if unknown, i.e. for some databases after the deletion
+	Version  string         // meta.version of the resource after the change, or before the deletion, or empty if unknown
+	Resource *prop.Resource // resource after the change, if the database provides it; always nil for deletions
+	Time     time.Time      // time of the change, as told by the database
+}
+
+// ChangeStreamDB is implemented by DB that notify the changes made to the resources, by this process or any other,
+// i.e. other instances of the server, or tools writing to the database directly. Subscribers can then keep derived
+// state in sync with the database, i.e. relay events to an outbox (see event.ChangeEvents), or invalidate caches (see
+// Cached).
+type ChangeStreamDB interface {
+	DB
+	// Subscribe calls fn for every change made to the resources from the time of the call, in the order the changes
+	// were made, until the context is done, fn returns an error, or the stream of changes fails, and returns the error.
+	// Changes made in a transaction are only notified once it is committed. Implementations document whether changes
+	// may be missed, i.e. while reconnecting, or notified more than once; subscribers shall tolerate both.
+	Subscribe(ctx context.Context, fn func(ctx context.Context, change *Change) error) error
+}
+
+// Subscribe to the changes of the database if it is a ChangeStreamDB (see ChangeStreamDB.Subscribe), or returns an
+// error of spec.ErrInternal otherwise, as the changes made by others cannot be observed without the database.
+func Subscribe(ctx context.Context, database DB, fn func(ctx context.Context, change *Change) error) error {
+	if changeDB, ok := database.(ChangeStreamDB); ok {
+		return changeDB.Subscribe(ctx, fn)
+	}
+	return fmt.Errorf("%w: database does not support change streams", spec.ErrInternal)
+}
+
+// Returns the change of the resource written by the operation, whose resource is a clone for inserts and updates, so
+// that subscribers may modify it.
+func changeOf(changeType string, resource *prop.Resource) *Change {
+	c := &Change{
+		Type:    changeType,
+		ID:      resource.IdOrEmpty(),
+		Version: resource.MetaVersionOrEmpty(),
+		Time:    time.Now(),
+	}
+	if changeType != ChangeDelete {
+		c.Resource = resource.Clone()
+	}
+	return c
+}
@@ -2,27 +2,150 @@ package db
 
 import (
 	"context"
+	"errors"
 	"github.com/imulab/go-scim/pkg/v2/crud"
 	"github.com/imulab/go-scim/pkg/v2/prop"
+	"github.com/imulab/go-scim/pkg/v2/spec"
+	"strings"
 )
 
 // DB is the abstraction for the database that provides the persistence and look up capabilities.
 type DB interface {
-	// Insert the given resource into the database, or return any error.
+	// Insert the given resource into the database, or return any error. Databases enforcing unique indexes return an
+	// error of spec.ErrUniqueness when the resource violates one, here and in Replace.
 	Insert(ctx context.Context, resource *prop.Resource) error
-	// Count the number of resources that meets the given SCIM filter.
+	// Count the number of resources that meets the given SCIM filter. An empty filter counts all resources, which
+	// implementations shall do without evaluating every resource, i.e. from the size of the collection. Services use
+	// Count rather than Query for the totalResults of queries and for count=0 requests, so that implementations
+	// evaluating filters shall do so without reading and deserializing the matching resources where they can.
 	Count(ctx context.Context, filter string) (int, error)
 	// Get a resource by its id. The projection parameter specifies the attributes to be included or excluded from the
 	// response. Implementations may elect to ignore this parameter in case caller services need all the attributes for
 	// additional processing.
 	Get(ctx context.Context, id string, projection *crud.Projection) (*prop.Resource, error)
 	// Replace overwrites an existing reference resource with the content of the replacement resource. The reference
-	// and the replacement resource are supposed to have the same id.
+	// and the replacement resource are supposed to have the same id. Replace is a compare-and-swap: if the reference
+	// carries a meta.version, the resource is only replaced when the stored resource still carries the same version,
+	// and an error of spec.ErrConflict is returned otherwise. This makes the pre conditions (i.e. If-Match) checked by
+	// services against the reference race-free; ReplaceIfMatch builds upon it to enforce an expected version.
 	Replace(ctx context.Context, ref *prop.Resource, replacement *prop.Resource) error
-	// Delete a resource
+	// Delete a resource. Like Replace, if the resource carries a meta.version, it is only deleted when the stored
+	// resource still carries the same version, and an error of spec.ErrConflict is returned otherwise (see
+	// DeleteIfMatch).
 	Delete(ctx context.Context, resource *prop.Resource) error
-	// Query resources. The projection parameter specifies the attributes to be included or excluded from the
-	// response. Implementations may elect to ignore this parameter in case caller services need all the attributes for
-	// additional processing.
+	// Query resources meeting the given SCIM filter, sorted by the sort parameter and paginated by the pagination
+	// parameter, all of which implementations are expected to push down to the backend where it can do the work, so
+	// that only the requested page is read. Databases evaluating queries in memory use SortAndPage instead.
+	//
+	// A nil sort, or one with an empty By, leaves the order to the implementation, which shall nevertheless be stable
+	// across calls, so that the pages of the same query do not overlap; otherwise, resources are sorted by the sort
+	// keys (see crud.Sort.Keys), with ties broken by id. A nil pagination returns all the resources meeting the
+	// filter; otherwise, the page of sorted resources that starts at the 1-based StartIndex and holds at most Count
+	// resources is returned (see crud.Pagination.Page), which is empty when it starts beyond the resources.
+	//
+	// The projection parameter specifies the attributes to be included or excluded from the response. Implementations
+	// may elect to ignore this parameter in case caller services need all the attributes for additional processing,
+	// as services apply the projection again when rendering resources. Implementations that post-filter resources
+	// loaded with the projection shall load them with the projection returned by Projection.Covering, and evaluate
+	// them with crud.EvaluateProjected.
 	Query(ctx context.Context, filter string, sort *crud.Sort, pagination *crud.Pagination, projection *crud.Projection) ([]*prop.Resource, error)
 }
+
+// CursorDB is implemented by DB that supports cursor based pagination (see crud.Cursor), as an alternative to
+// startIndex based pagination which degrades as the offset grows.
+type CursorDB interface {
+	DB
+	// QueryCursor queries a page of resources starting after the cursor of the pagination parameter, and returns the
+	// cursor to the next page in its opaque string form, or an empty string if there are no more resources. The
+	// resources are sorted by the sort parameter, with ties broken by id. An error of spec.ErrInvalidCursor is
+	// returned if the cursor is malformed, or does not match the sort parameter.
+	QueryCursor(ctx context.Context, filter string, sort *crud.Sort, pagination *crud.CursorPagination, projection *crud.Projection) (resources []*prop.Resource, nextCursor string, err error)
+}
+
+// BatchDB is implemented by DB that can get many resources by id in one round trip, as an alternative to calling Get
+// for every id.
+type BatchDB interface {
+	DB
+	// GetMany gets the resources by their ids. The resources are returned in the order of the ids, and ids that do not
+	// match a resource are left out, rather than reported as an error. Like Get, implementations may elect to ignore
+	// the projection parameter.
+	GetMany(ctx context.Context, ids []string, projection *crud.Projection) ([]*prop.Resource, error)
+}
+
+// GetMany gets the resources by their ids from the database, in one round trip if it is a BatchDB, or by calling Get
+// for every id otherwise. The resources are returned in the order of the ids, with duplicated ids and ids that do not
+// match a resource left out.
+func GetMany(ctx context.Context, database DB, ids []string, projection *crud.Projection) ([]*prop.Resource, error) {
+	ids = distinct(ids)
+	if len(ids) == 0 {
+		return []*prop.Resource{}, nil
+	}
+	if batchDB, ok := database.(BatchDB); ok {
+		return batchDB.GetMany(ctx, ids, projection)
+	}
+
+	resources := make([]*prop.Resource, 0, len(ids))
+	for _, id := range ids {
+		resource, err := database.Get(ctx, id, projection)
+		if err != nil {
+			if errors.Is(err, spec.ErrNotFound) {
+				continue
+			}
+			return nil, err
+		}
+		if resource != nil {
+			resources = append(resources, resource)
+		}
+	}
+	return resources, nil
+}
+
+// SortAndPage sorts the resources meeting the filter of a query, and returns the page of them requested by the
+// pagination, as DB.Query does, for the databases that cannot sort and paginate in their backend and evaluate queries
+// in memory instead. When paginated without sort, the resources are sorted by id, so that pages are stable across
+// calls; without pagination, all resources are returned. The resources are sorted in place.
+func SortAndPage(resources []*prop.Resource, sort *crud.Sort, pagination *crud.Pagination) ([]*prop.Resource, error) {
+	if sort == nil || len(strings.TrimSpace(sort.By)) == 0 {
+		if pagination == nil {
+			return resources, nil
+		}
+		sort = &crud.Sort{By: "id"}
+	}
+	if err := sort.Sort(resources); err != nil {
+		return nil, err
+	}
+	if pagination != nil {
+		resources = pagination.Page(resources)
+	}
+	return resources, nil
+}
+
+// SortByIDs sorts the resources in the order of the ids, i.e. for implementations of BatchDB whose database returns
+// the resources in another order. Resources whose id is not among the ids are left out.
+func SortByIDs(resources []*prop.Resource, ids []string) []*prop.Resource {
+	byId := make(map[string]*prop.Resource, len(resources))
+	for _, resource := range resources {
+		byId[resource.IdOrEmpty()] = resource
+	}
+	sorted := make([]*prop.Resource, 0, len(resources))
+	for _, id := range ids {
+		if resource, ok := byId[id]; ok {
+			sorted = append(sorted, resource)
+			delete(byId, id)
+		}
+	}
+	return sorted
+}
+
+func distinct(ids []string) []string {
+	seen := make(map[string]struct{}, len(ids))
+	result := make([]string, 0, len(ids))
+	for _, id := range ids {
+		if _, ok := seen[id]; ok || len(id) == 0 {
+			continue
+		}
+		seen[id] = struct{}{}
+		result = append(result, id)
+	}
+	return result
+}
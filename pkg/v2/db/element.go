@@ -0,0 +1,99 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"github.com/imulab/go-scim/pkg/v2/crud"
+	"github.com/imulab/go-scim/pkg/v2/prop"
+	"github.com/imulab/go-scim/pkg/v2/spec"
+)
+
+// ElementDB is implemented by DB that can count and page through the elements of a multiValued attribute of a
+// resource without loading the resource, i.e. the members of groups with hundreds of thousands of members.
+type ElementDB interface {
+	DB
+	// CountElements returns the number of elements of the multiValued attribute, named by attribute at the top level
+	// of the resource by id, i.e. "members", or an error of spec.ErrNotFound if there is no such resource.
+	CountElements(ctx context.Context, id string, attribute string) (int, error)
+	// GetElements returns the page of the elements of the multiValued attribute of the resource by id, in their stored
+	// order, as their raw values (see prop.Property.Raw). The page starts at the 1-based StartIndex of the pagination
+	// and holds at most Count elements (see crud.Pagination.Page); a nil pagination returns all the elements. An error
+	// of spec.ErrNotFound is returned if there is no such resource.
+	GetElements(ctx context.Context, id string, attribute string, pagination *crud.Pagination) ([]interface{}, error)
+}
+
+// CountElements counts the elements of the multiValued attribute of the resource by id, without loading the resource
+// if the database is an ElementDB, or from the resource loaded with the attribute only otherwise.
+func CountElements(ctx context.Context, database DB, id string, attribute string) (int, error) {
+	if elementDB, ok := database.(ElementDB); ok {
+		return elementDB.CountElements(ctx, id, attribute)
+	}
+
+	property, err := getElements(ctx, database, id, attribute)
+	if err != nil {
+		return 0, err
+	}
+	return property.CountChildren(), nil
+}
+
+// GetElements gets the page of the elements of the multiValued attribute of the resource by id, without loading the
+// resource if the database is an ElementDB, or from the resource loaded with the attribute only otherwise.
+func GetElements(ctx context.Context, database DB, id string, attribute string, pagination *crud.Pagination) ([]interface{}, error) {
+	if elementDB, ok := database.(ElementDB); ok {
+		return elementDB.GetElements(ctx, id, attribute, pagination)
+	}
+
+	property, err := getElements(ctx, database, id, attribute)
+	if err != nil {
+		return nil, err
+	}
+	return PageElements(property, pagination), nil
+}
+
+// PageElements returns the page of the raw values of the elements of the multiValued property, as ElementDB.GetElements
+// does, for the databases that load the whole property.
+func PageElements(property prop.Property, pagination *crud.Pagination) []interface{} {
+	start, end := 0, property.CountChildren()
+	if pagination != nil {
+		if start = pagination.StartIndex - 1; start < 0 {
+			start = 0
+		} else if start > end {
+			start = end
+		}
+		if start+pagination.Count < end {
+			end = start
+			if pagination.Count > 0 {
+				end += pagination.Count
+			}
+		}
+	}
+
+	elements := make([]interface{}, 0, end-start)
+	_ = property.ForEachChild(func(index int, child prop.Property) error {
+		if index >= start && index < end {
+			elements = append(elements, child.Raw())
+		}
+		return nil
+	})
+	return elements
+}
+
+func getElements(ctx context.Context, database DB, id string, attribute string) (prop.Property, error) {
+	resource, err := database.Get(ctx, id, &crud.Projection{Attributes: []string{attribute}})
+	if err != nil {
+		return nil, err
+	}
+	return elementsOf(resource, attribute)
+}
+
+// Returns the multiValued property of the resource named by attribute.
+func elementsOf(resource *prop.Resource, attribute string) (prop.Property, error) {
+	property, err := resource.RootProperty().ChildAtIndex(attribute)
+	if err != nil {
+		return nil, err
+	}
+	if property == nil || !property.Attribute().MultiValued() {
+		return nil, fmt.Errorf("%w: '%s' is not a multiValued attribute", spec.ErrInvalidPath, attribute)
+	}
+	return property, nil
+}
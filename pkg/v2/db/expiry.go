@@ -0,0 +1,254 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/imulab/go-scim/pkg/v2/annotation"
+	"github.com/imulab/go-scim/pkg/v2/crud"
+	"github.com/imulab/go-scim/pkg/v2/prop"
+	"github.com/imulab/go-scim/pkg/v2/spec"
+	"time"
+)
+
+// DefaultPurgeBatch is the number of expired resources deleted at once by PurgeExpired, unless set by ExpiryOptions.
+const DefaultPurgeBatch = 100
+
+// ExpiryDB is implemented by DB whose resources expire, i.e. the one returned by Expiring, or databases expiring
+// resources natively, so that expired resources can be purged in the background (see PurgeExpiredEvery).
+type ExpiryDB interface {
+	DB
+	// PurgeExpired permanently deletes the resources that have expired, and returns the number of resources deleted.
+	PurgeExpired(ctx context.Context) (int, error)
+}
+
+// PurgeExpired calls PurgeExpired on the database if it is an ExpiryDB, or returns an error of spec.ErrInternal
+// otherwise.
+func PurgeExpired(ctx context.Context, database DB) (int, error) {
+	if expiryDB, ok := database.(ExpiryDB); ok {
+		return expiryDB.PurgeExpired(ctx)
+	}
+	return 0, fmt.Errorf("%w: database does not support expiration", spec.ErrInternal)
+}
+
+// PurgeExpiredEvery calls PurgeExpired at every interval until the context is done. Errors of PurgeExpired are passed
+// to onError, which may be nil, and the resources not purged are retried at the next interval.
+func PurgeExpiredEvery(ctx context.Context, database DB, interval time.Duration, onError func(err error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := PurgeExpired(ctx, database); err != nil && onError != nil {
+				onError(err)
+			}
+		}
+	}
+}
+
+// ExpiryOptions are the options of Expiring.
+type ExpiryOptions struct {
+	// LazyPurge deletes the expired resources found by Get and GetMany, rather than leaving them to PurgeExpired.
+	LazyPurge bool
+	// PurgeBatch is the number of expired resources queried and deleted at once by PurgeExpired, or
+	// DefaultPurgeBatch when not positive.
+	PurgeBatch int
+}
+
+// Expiring returns a DB that hides the expired resources of the resource type from the given database, which are the
+// resources whose attribute annotated with @ExpiresAt holds a time that has passed. Get reports expired resources as
+// not found, GetMany leaves them out, and so do Count, Query and QueryCursor, unless the filter compares the annotated
+// attribute explicitly, in which case the filter is passed on as is. Resources without a value never expire. Writes
+// are passed on as is. An error of spec.ErrInternal is returned if no singular dateTime attribute, outside of
+// multiValued attributes, is annotated with @ExpiresAt.
+//
+// Expired resources remain stored until they are purged, either lazily when found by Get and GetMany, or periodically
+// by PurgeExpired (see PurgeExpiredEvery), which the returned DB implements as ExpiryDB. QueryCursor returns an error
+// of spec.ErrInvalidSyntax if the given database is not a CursorDB. The returned DB also implements BatchDB, TxDB, by
+// calling WithTx on the given database, and ChangeStreamDB, by calling Subscribe on the given database, which notifies
+// purges as deletions, since expiring alone is not a change.
+//
+// Get and GetMany ignore the projection, so that the annotated attribute is always loaded to tell expired resources
+// apart.
+func Expiring(resourceType *spec.ResourceType, database DB, options ExpiryOptions) (DB, error) {
+	attrs := expiryAttributesOf(resourceType.SuperAttribute(true))
+	if len(attrs) == 0 {
+		return nil, fmt.Errorf("%w: no attribute of resource type '%s' is annotated with %s",
+			spec.ErrInternal, resourceType.Name(), annotation.ExpiresAt)
+	}
+	if options.PurgeBatch <= 0 {
+		options.PurgeBatch = DefaultPurgeBatch
+	}
+	return &expiringDB{DB: database, attrs: attrs, path: attrs[len(attrs)-1].Path(), options: options}, nil
+}
+
+// Returns the attributes from the top level attribute to the singular dateTime attribute annotated with @ExpiresAt,
+// outside of multiValued attributes, or nil if there is none.
+func expiryAttributesOf(attr *spec.Attribute) (found []*spec.Attribute) {
+	_ = attr.ForEachSubAttribute(func(sub *spec.Attribute) error {
+		switch {
+		case len(found) > 0 || sub.MultiValued():
+		case sub.Type() == spec.TypeComplex:
+			if below := expiryAttributesOf(sub); len(below) > 0 {
+				found = append([]*spec.Attribute{sub}, below...)
+			}
+		case sub.Type() == spec.TypeDateTime:
+			if _, ok := sub.Annotation(annotation.ExpiresAt); ok {
+				found = []*spec.Attribute{sub}
+			}
+		}
+		return nil
+	})
+	return
+}
+
+type expiringDB struct {
+	DB
+	attrs   []*spec.Attribute // from the top level attribute to the annotated attribute
+	path    string            // of the annotated attribute
+	options ExpiryOptions
+}
+
+func (d *expiringDB) Get(ctx context.Context, id string, _ *crud.Projection) (*prop.Resource, error) {
+	resource, err := d.DB.Get(ctx, id, nil)
+	if err != nil {
+		return nil, err
+	}
+	if d.expired(resource) {
+		d.purgeLazily(ctx, resource)
+		return nil, fmt.Errorf("%w: resource not found by id", spec.ErrNotFound)
+	}
+	return resource, nil
+}
+
+func (d *expiringDB) GetMany(ctx context.Context, ids []string, _ *crud.Projection) ([]*prop.Resource, error) {
+	resources, err := GetMany(ctx, d.DB, ids, nil)
+	if err != nil {
+		return nil, err
+	}
+	visible := resources[:0]
+	for _, resource := range resources {
+		if d.expired(resource) {
+			d.purgeLazily(ctx, resource)
+			continue
+		}
+		visible = append(visible, resource)
+	}
+	return visible, nil
+}
+
+func (d *expiringDB) Count(ctx context.Context, filter string) (int, error) {
+	filter, err := d.filter(filter)
+	if err != nil {
+		return 0, err
+	}
+	return d.DB.Count(ctx, filter)
+}
+
+func (d *expiringDB) Query(ctx context.Context, filter string, sort *crud.Sort, pagination *crud.Pagination, projection *crud.Projection) ([]*prop.Resource, error) {
+	filter, err := d.filter(filter)
+	if err != nil {
+		return nil, err
+	}
+	return d.DB.Query(ctx, filter, sort, pagination, projection)
+}
+
+func (d *expiringDB) QueryCursor(ctx context.Context, filter string, sort *crud.Sort, pagination *crud.CursorPagination, projection *crud.Projection) ([]*prop.Resource, string, error) {
+	cursorDB, ok := d.DB.(CursorDB)
+	if !ok {
+		return nil, "", fmt.Errorf("%w: cursor pagination is not supported", spec.ErrInvalidSyntax)
+	}
+
+	filter, err := d.filter(filter)
+	if err != nil {
+		return nil, "", err
+	}
+	return cursorDB.QueryCursor(ctx, filter, sort, pagination, projection)
+}
+
+func (d *expiringDB) WithTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	return WithTx(ctx, d.DB, fn)
+}
+
+func (d *expiringDB) Subscribe(ctx context.Context, fn func(ctx context.Context, change *Change) error) error {
+	return Subscribe(ctx, d.DB, fn)
+}
+
+// PurgeExpired queries the expired resources from the given database, a batch at a time, and deletes them, until no
+// more are found, and implements ExpiryDB. Resources modified since they were queried are left to the next purge, as
+// they may no longer expire.
+func (d *expiringDB) PurgeExpired(ctx context.Context) (int, error) {
+	purged := 0
+	for {
+		if err := ctx.Err(); err != nil {
+			return purged, err
+		}
+
+		expired, err := d.DB.Query(ctx, d.expiredFilter(), &crud.Sort{By: "id"}, &crud.Pagination{StartIndex: 1, Count: d.options.PurgeBatch}, nil)
+		if err != nil {
+			return purged, err
+		}
+
+		deleted := 0
+		for _, err := range DeleteMany(ctx, d.DB, expired) {
+			switch {
+			case err == nil:
+				deleted++
+			case !errors.Is(err, spec.ErrConflict) && !errors.Is(err, spec.ErrNotFound):
+				return purged + deleted, err
+			}
+		}
+		purged += deleted
+
+		if len(expired) < d.options.PurgeBatch || deleted == 0 {
+			return purged, nil
+		}
+	}
+}
+
+// Deletes the expired resource, if purging lazily. Errors are ignored, as the resource is purged later anyway.
+func (d *expiringDB) purgeLazily(ctx context.Context, resource *prop.Resource) {
+	if d.options.LazyPurge {
+		_ = d.DB.Delete(ctx, resource)
+	}
+}
+
+// Returns true if the resource holds a time of expiry that has passed.
+func (d *expiringDB) expired(resource *prop.Resource) bool {
+	nav := resource.Navigator()
+	for _, attr := range d.attrs {
+		if nav.Dot(attr.Name()).HasError() {
+			return false
+		}
+	}
+	if nav.Current().IsUnassigned() {
+		return false
+	}
+	s, ok := nav.Current().Raw().(string)
+	if !ok {
+		return false
+	}
+	t, err := spec.ParseDateTime(s)
+	return err == nil && !t.After(time.Now())
+}
+
+// Returns the filter of the resources that have expired.
+func (d *expiringDB) expiredFilter() string {
+	return fmt.Sprintf("%s le \"%s\"", d.path, time.Now().UTC().Format(spec.ISO8601))
+}
+
+// Returns the filter that additionally excludes expired resources, unless it mentions the annotated attribute.
+func (d *expiringDB) filter(filter string) (string, error) {
+	return excluding(filter, d.path, fmt.Sprintf("not (%s)", d.expiredFilter()))
+}
+
+var (
+	_ CursorDB       = (*expiringDB)(nil)
+	_ BatchDB        = (*expiringDB)(nil)
+	_ TxDB           = (*expiringDB)(nil)
+	_ ChangeStreamDB = (*expiringDB)(nil)
+	_ ExpiryDB       = (*expiringDB)(nil)
+)
@@ -0,0 +1,66 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/imulab/go-scim/pkg/v2/spec"
+	"github.com/imulab/go-scim/pkg/v2/tenant"
+	"sync"
+	"time"
+)
+
+// ChangeRecord is an entry in the append-only change history of a resource.
+type ChangeRecord struct {
+	ResourceID   string          `json:"resourceId"`
+	ResourceType string          `json:"resourceType"`
+	Operation    string          `json:"operation"`         // operation that changed the resource, i.e. create, replace, patch, delete
+	Version      string          `json:"version,omitempty"` // meta.version of the resource after the change, if any
+	Actor        string          `json:"actor,omitempty"`   // id of the subject that made the change, if known
+	Time         time.Time       `json:"time"`
+	Patch        json.RawMessage `json:"patch,omitempty"`   // payload of the PATCH request, for patch operations
+	Changed      []string        `json:"changed,omitempty"` // paths of the attributes changed, for replace and patch operations
+}
+
+// HistoryDB stores the change history of resources.
+type HistoryDB interface {
+	// Append the change record to the history of its resource. Records are never modified once appended.
+	Append(ctx context.Context, record *ChangeRecord) error
+	// History returns the change records of the resource in the order they were appended, or an empty list if the
+	// resource has no history.
+	History(ctx context.Context, resourceID string) ([]*ChangeRecord, error)
+}
+
+// MemoryHistory returns a memory implementation of HistoryDB, which keeps the history of different tenants apart (see
+// tenant.Scope). Like Memory, it is only intended for testing and showcasing purposes.
+func MemoryHistory() HistoryDB {
+	return &memoryHistoryDB{records: make(map[string][]*ChangeRecord)}
+}
+
+type memoryHistoryDB struct {
+	sync.RWMutex
+	records map[string][]*ChangeRecord
+}
+
+func (m *memoryHistoryDB) Append(ctx context.Context, record *ChangeRecord) error {
+	if len(record.ResourceID) == 0 {
+		return fmt.Errorf("%w: empty resource id in change record", spec.ErrInternal)
+	}
+
+	m.Lock()
+	defer m.Unlock()
+
+	key := tenant.Scope(ctx, record.ResourceID)
+	m.records[key] = append(m.records[key], record)
+	return nil
+}
+
+func (m *memoryHistoryDB) History(ctx context.Context, resourceID string) ([]*ChangeRecord, error) {
+	m.RLock()
+	defer m.RUnlock()
+
+	key := tenant.Scope(ctx, resourceID)
+	records := make([]*ChangeRecord, len(m.records[key]))
+	copy(records, m.records[key])
+	return records, nil
+}
@@ -0,0 +1,80 @@
+package db
+
+import (
+	"context"
+	"github.com/imulab/go-scim/pkg/v2/tenant"
+	"sync"
+	"time"
+)
+
+// KeyDB is a small keyed store to remember the ids of resources created with an idempotency key, so that retried
+// requests can be answered with the resource originally created.
+type KeyDB interface {
+	// Claim claims the key for a request about to create a resource, along with the fingerprint of its payload, if the
+	// key is not yet known, in which case claimed is true. Otherwise, the id associated with the key is returned, which
+	// is empty if the request that claimed the key has not yet completed, along with the fingerprint it was claimed with,
+	// so that requests reusing the key with another payload can be told apart from retries.
+	Claim(ctx context.Context, key string, fingerprint string) (id string, claimedWith string, claimed bool, err error)
+	// Complete associates the id of the created resource with the claimed key.
+	Complete(ctx context.Context, key string, id string) error
+	// Release forgets the claimed key, when the request that claimed it failed to create the resource.
+	Release(ctx context.Context, key string) error
+}
+
+// MemoryKeys returns a memory implementation of KeyDB, which forgets keys after the given time to live, or never if the
+// time to live is not positive. Keys of different tenants are kept apart (see tenant.Scope). Like Memory, it is only
+// intended for testing and showcasing purposes.
+func MemoryKeys(ttl time.Duration) KeyDB {
+	return &memoryKeyDB{ttl: ttl, keys: make(map[string]memoryKey)}
+}
+
+type memoryKey struct {
+	id          string
+	fingerprint string
+	expires     time.Time
+}
+
+type memoryKeyDB struct {
+	sync.Mutex
+	ttl  time.Duration
+	keys map[string]memoryKey
+}
+
+func (m *memoryKeyDB) Claim(ctx context.Context, key string, fingerprint string) (string, string, bool, error) {
+	m.Lock()
+	defer m.Unlock()
+
+	key = tenant.Scope(ctx, key)
+	now := time.Now()
+	if k, ok := m.keys[key]; ok && (k.expires.IsZero() || now.Before(k.expires)) {
+		return k.id, k.fingerprint, false, nil
+	}
+
+	m.keys[key] = m.newKey("", fingerprint, now)
+	return "", "", true, nil
+}
+
+func (m *memoryKeyDB) Complete(ctx context.Context, key string, id string) error {
+	m.Lock()
+	defer m.Unlock()
+
+	key = tenant.Scope(ctx, key)
+	m.keys[key] = m.newKey(id, m.keys[key].fingerprint, time.Now())
+	return nil
+}
+
+func (m *memoryKeyDB) Release(ctx context.Context, key string) error {
+	m.Lock()
+	defer m.Unlock()
+
+	delete(m.keys, tenant.Scope(ctx, key))
+	return nil
+}
+
+func (m *memoryKeyDB) newKey(id string, fingerprint string, now time.Time) memoryKey {
+	k := memoryKey{id: id, fingerprint: fingerprint}
+	if m.ttl > 0 {
+		k.expires = now.Add(m.ttl)
+	}
+	return k
+}
@@ -0,0 +1,189 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"github.com/imulab/go-scim/pkg/v2/crud"
+	"github.com/imulab/go-scim/pkg/v2/prop"
+	"github.com/imulab/go-scim/pkg/v2/spec"
+	"time"
+)
+
+// Observation of a call to a database, as passed to the observer of Instrumented.
+type Observation struct {
+	// ResourceType is the id of the resource type of the database.
+	ResourceType string
+	// Method is the method called, in snake case, i.e. insert, get_many and query_cursor, or transaction for WithTx.
+	Method string
+	// Duration is the latency of the call, which includes the calls within, for transactions.
+	Duration time.Duration
+	// Err is the error of the call, or nil. Bulk writes report db.BulkError of the errors of the resources.
+	Err error
+	// Size is the number of resources read by get, get_many, query and query_cursor, counted by count, or written by
+	// the writes, which excludes the resources that failed. It is zero for transactions.
+	Size int
+}
+
+// Instrumented returns a DB that passes an Observation of every call to the database to the observer, i.e. to export
+// the latency, error rate and result size of each method as metrics, so that regressions of the database can be told
+// apart from those of the services, whatever the implementation of the database is. The observer is called by the
+// goroutine of the call, after it returns, and shall be cheap.
+//
+// The returned DB also implements CursorDB, returning an error of spec.ErrInvalidSyntax if the database does not,
+// BatchDB, ElementDB, BulkWriteDB, and TxDB, which calls WithTx on the database. Bulk writes are observed once for the batch. It
+// implements ChangeStreamDB as well, by calling Subscribe on the database; subscriptions are not observed, as they last
+// until their context is done.
+func Instrumented(resourceType *spec.ResourceType, database DB, observer func(o Observation)) DB {
+	return &instrumentedDB{DB: database, resourceType: resourceType.ID(), observer: observer}
+}
+
+type instrumentedDB struct {
+	DB
+	resourceType string
+	observer     func(o Observation)
+}
+
+func (d *instrumentedDB) observe(method string, start time.Time, err error, size int) {
+	d.observer(Observation{
+		ResourceType: d.resourceType,
+		Method:       method,
+		Duration:     time.Since(start),
+		Err:          err,
+		Size:         size,
+	})
+}
+
+func (d *instrumentedDB) Insert(ctx context.Context, resource *prop.Resource) (err error) {
+	start := time.Now()
+	err = d.DB.Insert(ctx, resource)
+	d.observe("insert", start, err, one(err))
+	return
+}
+
+func (d *instrumentedDB) Count(ctx context.Context, filter string) (n int, err error) {
+	start := time.Now()
+	n, err = d.DB.Count(ctx, filter)
+	d.observe("count", start, err, n)
+	return
+}
+
+func (d *instrumentedDB) Get(ctx context.Context, id string, projection *crud.Projection) (resource *prop.Resource, err error) {
+	start := time.Now()
+	resource, err = d.DB.Get(ctx, id, projection)
+	d.observe("get", start, err, one(err))
+	return
+}
+
+func (d *instrumentedDB) GetMany(ctx context.Context, ids []string, projection *crud.Projection) (resources []*prop.Resource, err error) {
+	start := time.Now()
+	resources, err = GetMany(ctx, d.DB, ids, projection)
+	d.observe("get_many", start, err, len(resources))
+	return
+}
+
+func (d *instrumentedDB) CountElements(ctx context.Context, id string, attribute string) (n int, err error) {
+	start := time.Now()
+	n, err = CountElements(ctx, d.DB, id, attribute)
+	d.observe("count_elements", start, err, n)
+	return
+}
+
+func (d *instrumentedDB) GetElements(ctx context.Context, id string, attribute string, pagination *crud.Pagination) (elements []interface{}, err error) {
+	start := time.Now()
+	elements, err = GetElements(ctx, d.DB, id, attribute, pagination)
+	d.observe("get_elements", start, err, len(elements))
+	return
+}
+
+func (d *instrumentedDB) Replace(ctx context.Context, ref *prop.Resource, replacement *prop.Resource) (err error) {
+	start := time.Now()
+	err = d.DB.Replace(ctx, ref, replacement)
+	d.observe("replace", start, err, one(err))
+	return
+}
+
+func (d *instrumentedDB) Delete(ctx context.Context, resource *prop.Resource) (err error) {
+	start := time.Now()
+	err = d.DB.Delete(ctx, resource)
+	d.observe("delete", start, err, one(err))
+	return
+}
+
+func (d *instrumentedDB) InsertMany(ctx context.Context, resources []*prop.Resource) (errs []error) {
+	start := time.Now()
+	errs = InsertMany(ctx, d.DB, resources)
+	d.observe("insert_many", start, BulkError(errs), writtenMany(errs))
+	return
+}
+
+func (d *instrumentedDB) ReplaceMany(ctx context.Context, replacements []Replacement) (errs []error) {
+	start := time.Now()
+	errs = ReplaceMany(ctx, d.DB, replacements)
+	d.observe("replace_many", start, BulkError(errs), writtenMany(errs))
+	return
+}
+
+func (d *instrumentedDB) DeleteMany(ctx context.Context, resources []*prop.Resource) (errs []error) {
+	start := time.Now()
+	errs = DeleteMany(ctx, d.DB, resources)
+	d.observe("delete_many", start, BulkError(errs), writtenMany(errs))
+	return
+}
+
+func (d *instrumentedDB) Query(ctx context.Context, filter string, sort *crud.Sort, pagination *crud.Pagination, projection *crud.Projection) (resources []*prop.Resource, err error) {
+	start := time.Now()
+	resources, err = d.DB.Query(ctx, filter, sort, pagination, projection)
+	d.observe("query", start, err, len(resources))
+	return
+}
+
+func (d *instrumentedDB) QueryCursor(ctx context.Context, filter string, sort *crud.Sort, pagination *crud.CursorPagination, projection *crud.Projection) (resources []*prop.Resource, next string, err error) {
+	cursorDB, ok := d.DB.(CursorDB)
+	if !ok {
+		return nil, "", fmt.Errorf("%w: cursor pagination is not supported", spec.ErrInvalidSyntax)
+	}
+
+	start := time.Now()
+	resources, next, err = cursorDB.QueryCursor(ctx, filter, sort, pagination, projection)
+	d.observe("query_cursor", start, err, len(resources))
+	return
+}
+
+func (d *instrumentedDB) WithTx(ctx context.Context, fn func(ctx context.Context) error) (err error) {
+	start := time.Now()
+	err = WithTx(ctx, d.DB, fn)
+	d.observe("transaction", start, err, 0)
+	return
+}
+
+func (d *instrumentedDB) Subscribe(ctx context.Context, fn func(ctx context.Context, change *Change) error) error {
+	return Subscribe(ctx, d.DB, fn)
+}
+
+// Returns the size of a call on a single resource.
+func one(err error) int {
+	if err != nil {
+		return 0
+	}
+	return 1
+}
+
+// Returns the size of a bulk write.
+func writtenMany(errs []error) int {
+	n := 0
+	for _, err := range errs {
+		if err == nil {
+			n++
+		}
+	}
+	return n
+}
+
+var (
+	_ CursorDB       = (*instrumentedDB)(nil)
+	_ BatchDB        = (*instrumentedDB)(nil)
+	_ ElementDB      = (*instrumentedDB)(nil)
+	_ BulkWriteDB    = (*instrumentedDB)(nil)
+	_ TxDB           = (*instrumentedDB)(nil)
+	_ ChangeStreamDB = (*instrumentedDB)(nil)
+)
@@ -6,6 +6,7 @@ import (
 	"github.com/imulab/go-scim/pkg/v2/crud"
 	"github.com/imulab/go-scim/pkg/v2/prop"
 	"github.com/imulab/go-scim/pkg/v2/spec"
+	"github.com/imulab/go-scim/pkg/v2/trace"
 	"sync"
 )
 
@@ -13,108 +14,453 @@ import (
 // it does allow for concurrent access through the use of RWMutex, it does not support high throughput usage.
 // Hence, it is only intended for testing and showcasing purposes. This implementation also ignores all the field projection
 // parameters that it always returned the full resource regardless of the request to include or exclude attributes.
+//
+// The returned DB implements TxDB. A transaction holds the lock of the database until it is committed or rolled back,
+// so that transactions are serialized with all other operations, and is rolled back by restoring the resources it
+// modified. Operations of other databases do not take part in the transaction. It also implements BulkWriteDB, which
+// writes all resources under the lock held once, and ChangeStreamDB, which notifies the changes made through the
+// returned DB, those made in transactions once committed. See MemoryWithIndexes for a memory implementation with
+// secondary indexes.
 func Memory() DB {
 	db := memoryDB{
 		RWMutex: sync.RWMutex{},
 		db:      make(map[string]*prop.Resource),
+		filters: crud.NewFilterCache(0),
 	}
 	return &db
 }
 
 type memoryDB struct {
 	sync.RWMutex
-	db map[string]*prop.Resource
+	db           map[string]*prop.Resource
+	filters      *crud.FilterCache
+	resourceType *spec.ResourceType      // nil unless created with MemoryWithIndexes
+	indexes      map[string]*memoryIndex // by id of the indexed attribute
+	subscribers  map[*memorySubscriber]struct{}
+	log          *memoryLog // nil unless created with PersistentMemory
 }
 
-func (m *memoryDB) Insert(_ context.Context, resource *prop.Resource) error {
-	id := resource.IdOrEmpty()
-	if len(id) == 0 {
-		return fmt.Errorf("%w: empty id", spec.ErrInternal)
+func (m *memoryDB) Insert(ctx context.Context, resource *prop.Resource) error {
+	defer m.lock(ctx)()
+	return m.insert(ctx, resource)
+}
+
+func (m *memoryDB) InsertMany(ctx context.Context, resources []*prop.Resource) []error {
+	defer m.lock(ctx)()
+
+	errs := make([]error, len(resources))
+	for i, resource := range resources {
+		errs[i] = m.insert(ctx, resource)
 	}
+	return errs
+}
 
-	if _, ok := m.db[id]; ok {
-		return fmt.Errorf("%w: id exists", spec.ErrInvalidValue)
+func (m *memoryDB) Get(ctx context.Context, id string, _ *crud.Projection) (*prop.Resource, error) {
+	defer m.rlock(ctx)()
+
+	r, ok := m.db[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: resource not found by id", spec.ErrNotFound)
 	}
+	// Callers may modify the resource before replacing it, which must not affect the stored version until then.
+	return r.Clone(), nil
+}
 
-	m.Lock()
-	defer m.Unlock()
-	m.db[id] = resource
+func (m *memoryDB) GetMany(ctx context.Context, ids []string, _ *crud.Projection) ([]*prop.Resource, error) {
+	defer m.rlock(ctx)()
 
-	return nil
+	resources := make([]*prop.Resource, 0, len(ids))
+	for _, id := range distinct(ids) {
+		if r, ok := m.db[id]; ok {
+			resources = append(resources, r.Clone())
+		}
+	}
+	return resources, nil
+}
+
+// CountElements counts the elements of the stored resource, without cloning it, and implements ElementDB.
+func (m *memoryDB) CountElements(ctx context.Context, id string, attribute string) (int, error) {
+	defer m.rlock(ctx)()
+
+	property, err := m.elements(id, attribute)
+	if err != nil {
+		return 0, err
+	}
+	return property.CountChildren(), nil
+}
+
+// GetElements gets the page of the elements of the stored resource, without cloning it, and implements ElementDB.
+func (m *memoryDB) GetElements(ctx context.Context, id string, attribute string, pagination *crud.Pagination) ([]interface{}, error) {
+	defer m.rlock(ctx)()
+
+	property, err := m.elements(id, attribute)
+	if err != nil {
+		return nil, err
+	}
+	return PageElements(property, pagination), nil
 }
 
-func (m *memoryDB) Get(_ context.Context, id string, _ *crud.Projection) (*prop.Resource, error) {
+func (m *memoryDB) elements(id string, attribute string) (prop.Property, error) {
 	r, ok := m.db[id]
 	if !ok {
 		return nil, fmt.Errorf("%w: resource not found by id", spec.ErrNotFound)
 	}
-	return r, nil
+	return elementsOf(r, attribute)
 }
 
-func (m *memoryDB) Count(_ context.Context, filter string) (int, error) {
+func (m *memoryDB) Count(ctx context.Context, filter string) (int, error) {
+	defer m.rlock(ctx)()
+
 	if len(filter) == 0 {
 		return len(m.db), nil
 	}
 
-	n := 0
-	for _, r := range m.db {
-		ok, _ := crud.Evaluate(r, filter)
-		if ok {
-			n++
-		}
+	return len(m.evaluate(ctx, filter)), nil
+}
+
+func (m *memoryDB) Replace(ctx context.Context, ref *prop.Resource, replacement *prop.Resource) error {
+	defer m.lock(ctx)()
+	return m.replace(ctx, ref, replacement)
+}
+
+func (m *memoryDB) ReplaceMany(ctx context.Context, replacements []Replacement) []error {
+	defer m.lock(ctx)()
+
+	errs := make([]error, len(replacements))
+	for i, r := range replacements {
+		errs[i] = m.replace(ctx, r.Ref, r.Replacement)
 	}
-	return n, nil
+	return errs
 }
 
-func (m *memoryDB) Replace(_ context.Context, ref *prop.Resource, replacement *prop.Resource) error {
-	id := ref.IdOrEmpty()
-	_, ok := m.db[id]
-	if !ok {
-		return fmt.Errorf("%w: resource not found by id", spec.ErrNotFound)
+func (m *memoryDB) Delete(ctx context.Context, resource *prop.Resource) error {
+	defer m.lock(ctx)()
+	return m.remove(ctx, resource)
+}
+
+func (m *memoryDB) DeleteMany(ctx context.Context, resources []*prop.Resource) []error {
+	defer m.lock(ctx)()
+
+	errs := make([]error, len(resources))
+	for i, resource := range resources {
+		errs[i] = m.remove(ctx, resource)
+	}
+	return errs
+}
+
+// Inserts the resource. Caller must hold the lock.
+func (m *memoryDB) insert(ctx context.Context, resource *prop.Resource) error {
+	id := resource.IdOrEmpty()
+	if len(id) == 0 {
+		return fmt.Errorf("%w: empty id", spec.ErrInternal)
+	}
+	if _, ok := m.db[id]; ok {
+		return fmt.Errorf("%w: id exists", spec.ErrInvalidValue)
 	}
 
-	version := ref.MetaVersionOrEmpty()
-	if len(version) > 0 && m.db[id].MetaVersionOrEmpty() != version {
-		return spec.ErrConflict
+	change := changeOf(ChangeInsert, resource)
+	if err := m.persist(ctx, change); err != nil {
+		return err
+	}
+	m.journal(ctx, id)
+	m.put(id, resource)
+	m.notify(ctx, change)
+	return nil
+}
+
+// Replaces the reference resource with the replacement. Caller must hold the lock.
+func (m *memoryDB) replace(ctx context.Context, ref *prop.Resource, replacement *prop.Resource) error {
+	id := ref.IdOrEmpty()
+	if err := m.compare(id, ref.MetaVersionOrEmpty()); err != nil {
+		return err
 	}
 
-	m.db[id] = replacement
+	change := changeOf(ChangeUpdate, replacement)
+	if err := m.persist(ctx, change); err != nil {
+		return err
+	}
+	m.journal(ctx, id)
+	m.put(id, replacement)
+	m.notify(ctx, change)
 	return nil
 }
 
-func (m *memoryDB) Delete(_ context.Context, resource *prop.Resource) error {
-	delete(m.db, resource.IdOrEmpty())
+// Deletes the resource. Caller must hold the lock.
+func (m *memoryDB) remove(ctx context.Context, resource *prop.Resource) error {
+	id := resource.IdOrEmpty()
+	if err := m.compare(id, resource.MetaVersionOrEmpty()); err != nil {
+		return err
+	}
+
+	change := changeOf(ChangeDelete, m.db[id])
+	if err := m.persist(ctx, change); err != nil {
+		return err
+	}
+	m.journal(ctx, id)
+	m.notify(ctx, change)
+	m.del(id)
 	return nil
 }
 
-func (m *memoryDB) Query(_ context.Context, filter string, sort *crud.Sort, pagination *crud.Pagination, _ *crud.Projection) ([]*prop.Resource, error) {
+// Returns the resources matching the filter, evaluating only the resources looked up from the indexes, if the filter
+// can be served by them. Caller must hold the lock.
+func (m *memoryDB) evaluate(ctx context.Context, filter string) []*prop.Resource {
+	_, end := trace.Start(ctx, trace.Evaluate)
+	defer end(nil)
+
 	var candidates = make([]*prop.Resource, 0)
+	if ids, ok := m.lookup(filter); ok {
+		for id := range ids {
+			if r, ok := m.db[id]; ok {
+				if ok, _ := m.filters.Evaluate(r, filter); ok {
+					candidates = append(candidates, r)
+				}
+			}
+		}
+		return candidates
+	}
 	for _, r := range m.db {
-		if ok, _ := crud.Evaluate(r, filter); ok {
+		if ok, _ := m.filters.Evaluate(r, filter); ok {
 			candidates = append(candidates, r)
 		}
 	}
+	return candidates
+}
+
+// Checks that the resource by id exists, and still carries the version, if any. Caller must hold the lock.
+func (m *memoryDB) compare(id string, version string) error {
+	stored, ok := m.db[id]
+	if !ok {
+		return fmt.Errorf("%w: resource not found by id", spec.ErrNotFound)
+	}
+	if len(version) > 0 && stored.MetaVersionOrEmpty() != version {
+		return fmt.Errorf("%w: resource by id '%s' was modified since by another request", spec.ErrConflict, id)
+	}
+	return nil
+}
+
+func (m *memoryDB) QueryCursor(ctx context.Context, filter string, sort *crud.Sort, pagination *crud.CursorPagination, _ *crud.Projection) ([]*prop.Resource, string, error) {
+	defer m.rlock(ctx)()
+
+	if sort == nil || len(sort.By) == 0 {
+		sort = &crud.Sort{By: "id"}
+	}
+
+	var candidates = m.evaluate(ctx, filter)
+	if err := sort.Sort(candidates); err != nil {
+		return nil, "", err
+	}
+
+	if pagination != nil && len(pagination.Cursor) > 0 {
+		cursor, err := crud.ParseCursor(pagination.Cursor)
+		if err != nil {
+			return nil, "", err
+		}
+		if candidates, err = sort.After(candidates, cursor); err != nil {
+			return nil, "", err
+		}
+	}
+
+	if pagination == nil || pagination.Count <= 0 || len(candidates) <= pagination.Count {
+		return candidates, "", nil
+	}
+
+	candidates = candidates[:pagination.Count]
+	next, err := crud.NewCursor(candidates[len(candidates)-1], *sort)
+	if err != nil {
+		return nil, "", err
+	}
+	return candidates, next.String(), nil
+}
+
+func (m *memoryDB) Query(ctx context.Context, filter string, sort *crud.Sort, pagination *crud.Pagination, _ *crud.Projection) ([]*prop.Resource, error) {
+	defer m.rlock(ctx)()
+
+	var candidates = m.evaluate(ctx, filter)
 	if len(candidates) == 0 {
 		return []*prop.Resource{}, nil
 	}
 
-	if sort != nil {
-		if err := sort.Sort(candidates); err != nil {
-			return nil, err
+	return SortAndPage(candidates, sort, pagination)
+}
+
+func (m *memoryDB) WithTx(ctx context.Context, fn func(ctx context.Context) error) (err error) {
+	if _, ok := ctx.Value(memoryTxKey{m}).(*memoryTx); ok {
+		return fn(ctx)
+	}
+
+	m.Lock()
+	defer m.Unlock()
+
+	tx := &memoryTx{undo: make(map[string]*prop.Resource)}
+	defer func() {
+		if r := recover(); r != nil {
+			tx.rollback(m)
+			panic(r)
 		}
+	}()
+
+	if err = fn(context.WithValue(ctx, memoryTxKey{m}, tx)); err != nil {
+		tx.rollback(m)
+		return
+	}
+	if m.log != nil {
+		if err = m.log.append(tx.changes...); err != nil {
+			tx.rollback(m)
+			return
+		}
+	}
+	for _, change := range tx.changes {
+		m.publish(change)
+	}
+	return
+}
+
+func (m *memoryDB) Subscribe(ctx context.Context, fn func(ctx context.Context, change *Change) error) error {
+	s := &memorySubscriber{signal: make(chan struct{}, 1)}
+
+	m.Lock()
+	if m.subscribers == nil {
+		m.subscribers = make(map[*memorySubscriber]struct{})
 	}
+	m.subscribers[s] = struct{}{}
+	m.Unlock()
+
+	defer func() {
+		m.Lock()
+		delete(m.subscribers, s)
+		m.Unlock()
+	}()
 
-	if pagination != nil {
-		lb := pagination.StartIndex - 1
-		if lb < 0 {
-			lb = 0
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-s.signal:
 		}
-		ub := pagination.StartIndex + pagination.Count - 1
-		if ub > len(candidates) {
-			ub = len(candidates)
+		for _, change := range s.drain() {
+			if err := fn(ctx, change); err != nil {
+				return err
+			}
 		}
-		candidates = candidates[lb:ub]
 	}
+}
+
+// Acquires the lock of the database, unless the context carries a transaction of the database, which holds it
+// already, and returns the function to release it.
+func (m *memoryDB) lock(ctx context.Context) func() {
+	if _, ok := ctx.Value(memoryTxKey{m}).(*memoryTx); ok {
+		return func() {}
+	}
+	m.Lock()
+	return m.Unlock
+}
+
+// Like lock, but acquires the read lock.
+func (m *memoryDB) rlock(ctx context.Context) func() {
+	if _, ok := ctx.Value(memoryTxKey{m}).(*memoryTx); ok {
+		return func() {}
+	}
+	m.RLock()
+	return m.RUnlock
+}
+
+// Records the resource by id before it is modified, if the context carries a transaction of the database, so that it
+// can be restored upon rollback. Caller must hold the lock.
+func (m *memoryDB) journal(ctx context.Context, id string) {
+	tx, ok := ctx.Value(memoryTxKey{m}).(*memoryTx)
+	if !ok {
+		return
+	}
+	if _, recorded := tx.undo[id]; !recorded {
+		tx.undo[id] = m.db[id] // nil if absent
+	}
+}
+
+// Appends the change to the log, if persistent, unless the context carries a transaction of the database, whose
+// changes are appended when it is committed. Caller must hold the lock.
+func (m *memoryDB) persist(ctx context.Context, change *Change) error {
+	if m.log == nil {
+		return nil
+	}
+	if _, ok := ctx.Value(memoryTxKey{m}).(*memoryTx); ok {
+		return nil
+	}
+	return m.log.append(change)
+}
+
+// Notifies the subscribers of the change, or records it to be notified when the transaction carried by the context,
+// if any, is committed. Caller must hold the lock.
+func (m *memoryDB) notify(ctx context.Context, change *Change) {
+	if tx, ok := ctx.Value(memoryTxKey{m}).(*memoryTx); ok {
+		tx.changes = append(tx.changes, change)
+		return
+	}
+	m.publish(change)
+}
+
+// Queues the change for every subscriber. Caller must hold the lock.
+func (m *memoryDB) publish(change *Change) {
+	for s := range m.subscribers {
+		s.push(change)
+	}
+}
+
+// memorySubscriber queues the changes for Subscribe, which calls its function without holding the lock of the
+// database, so that the function may call the database.
+type memorySubscriber struct {
+	sync.Mutex
+	changes []*Change
+	signal  chan struct{}
+}
+
+func (s *memorySubscriber) push(change *Change) {
+	s.Lock()
+	s.changes = append(s.changes, change)
+	s.Unlock()
+
+	select {
+	case s.signal <- struct{}{}:
+	default:
+	}
+}
+
+func (s *memorySubscriber) drain() []*Change {
+	s.Lock()
+	defer s.Unlock()
+
+	changes := s.changes
+	s.changes = nil
+	return changes
+}
+
+type memoryTxKey struct {
+	m *memoryDB
+}
 
-	return candidates, nil
+// memoryTx records the resources modified in a transaction, as they were before the transaction, and the changes to
+// notify once it is committed.
+type memoryTx struct {
+	undo    map[string]*prop.Resource
+	changes []*Change
 }
+
+// Restores the resources modified in the transaction. Caller must hold the lock.
+func (t *memoryTx) rollback(m *memoryDB) {
+	for id, resource := range t.undo {
+		if resource == nil {
+			m.del(id)
+		} else {
+			m.put(id, resource)
+		}
+	}
+}
+
+var (
+	_ CursorDB       = (*memoryDB)(nil)
+	_ ElementDB      = (*memoryDB)(nil)
+	_ TxDB           = (*memoryDB)(nil)
+	_ BulkWriteDB    = (*memoryDB)(nil)
+	_ IndexedDB      = (*memoryDB)(nil)
+	_ ChangeStreamDB = (*memoryDB)(nil)
+)
@@ -0,0 +1,443 @@
+package db
+
+import (
+	"fmt"
+	"github.com/imulab/go-scim/pkg/v2/crud"
+	"github.com/imulab/go-scim/pkg/v2/crud/expr"
+	"github.com/imulab/go-scim/pkg/v2/prop"
+	"github.com/imulab/go-scim/pkg/v2/spec"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// IndexedDB is implemented by DB whose secondary indexes can be managed at runtime, i.e. the memory implementation
+// returned by MemoryWithIndexes.
+type IndexedDB interface {
+	DB
+	// CreateIndex builds an index of the values of the attribute at the path from the stored resources, which is then
+	// maintained upon every write. Creating an index that exists has no effect. An error of spec.ErrInvalidPath is
+	// returned if the path does not name a simple attribute of the resource type.
+	CreateIndex(path string) error
+	// DropIndex drops the index of the attribute at the path, if there is one.
+	DropIndex(path string) error
+	// Indexes returns the paths of the attributes that are indexed, in ascending order.
+	Indexes() []string
+}
+
+// MemoryWithIndexes returns a memory implementation of DB like Memory, which maintains secondary indexes of the values
+// of the attributes at the paths, i.e. userName, externalId, emails.value or members.value, of the resources of the
+// resource type. The attributes can be singular or multiValued, or sub attributes of multiValued attributes, in which
+// case all their values are indexed. The returned DB also implements IndexedDB to create and drop indexes later.
+//
+// Filters consisting of comparisons on indexed attributes, combined with and or or, are served by looking up the
+// indexes, after which only the candidates are evaluated with the filter, rather than every resource. The indexes
+// serve eq comparisons on attributes of all types, sw comparisons on string and reference attributes, and gt, ge, lt
+// and le comparisons on dateTime, integer and decimal attributes. Text values of attributes that are not caseExact
+// are indexed by their collation key (see crud.CollationKey), hence the collation shall not change afterwards.
+func MemoryWithIndexes(resourceType *spec.ResourceType, paths ...string) (DB, error) {
+	m := &memoryDB{
+		RWMutex:      sync.RWMutex{},
+		db:           make(map[string]*prop.Resource),
+		filters:      crud.NewFilterCache(0),
+		resourceType: resourceType,
+		indexes:      make(map[string]*memoryIndex),
+	}
+	for _, path := range paths {
+		if err := m.CreateIndex(path); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+func (m *memoryDB) CreateIndex(path string) error {
+	if m.resourceType == nil {
+		return fmt.Errorf("%w: indexes require the resource type, see MemoryWithIndexes", spec.ErrInternal)
+	}
+	attrs, err := m.attributesOf(path)
+	if err != nil {
+		return err
+	}
+
+	m.Lock()
+	defer m.Unlock()
+
+	attr := attrs[len(attrs)-1]
+	if _, ok := m.indexes[attr.ID()]; ok {
+		return nil
+	}
+	i := &memoryIndex{
+		path:  path,
+		attrs: attrs,
+		ids:   make(map[string]map[string]struct{}),
+	}
+	for _, resource := range m.db {
+		i.add(resource)
+	}
+	m.indexes[attr.ID()] = i
+	return nil
+}
+
+func (m *memoryDB) DropIndex(path string) error {
+	if m.resourceType == nil {
+		return nil
+	}
+	attrs, err := m.attributesOf(path)
+	if err != nil {
+		return err
+	}
+
+	m.Lock()
+	defer m.Unlock()
+
+	delete(m.indexes, attrs[len(attrs)-1].ID())
+	return nil
+}
+
+func (m *memoryDB) Indexes() []string {
+	m.RLock()
+	defer m.RUnlock()
+
+	paths := make([]string, 0, len(m.indexes))
+	for _, i := range m.indexes {
+		paths = append(paths, i.path)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// Returns the attributes from the top level attribute to the simple attribute at the path.
+func (m *memoryDB) attributesOf(path string) ([]*spec.Attribute, error) {
+	head, err := expr.CompilePath(path)
+	if err != nil {
+		return nil, err
+	}
+	attrs := m.attributesOfPath(head)
+	if len(attrs) == 0 || attrs[len(attrs)-1].Type() == spec.TypeComplex {
+		return nil, fmt.Errorf("%w: '%s' is not a simple attribute of %s", spec.ErrInvalidPath, path, m.resourceType.Name())
+	}
+	return attrs, nil
+}
+
+// Returns the attributes from the top level attribute to the attribute at the compiled path, or nil if there is none.
+func (m *memoryDB) attributesOfPath(head *expr.Expression) []*spec.Attribute {
+	if head == nil || head.ContainsFilter() {
+		return nil
+	}
+
+	cursor := head
+	if strings.EqualFold(cursor.Token(), m.resourceType.Schema().ID()) {
+		cursor = cursor.Next()
+	}
+
+	var (
+		attrs []*spec.Attribute
+		attr  = m.resourceType.SuperAttribute(true)
+	)
+	for ; cursor != nil; cursor = cursor.Next() {
+		if attr = attr.SubAttributeForName(cursor.Token()); attr == nil {
+			return nil
+		}
+		attrs = append(attrs, attr)
+	}
+	return attrs
+}
+
+// Sets the resource by its id, and updates the indexes. Caller must hold the lock.
+func (m *memoryDB) put(id string, resource *prop.Resource) {
+	if stored, ok := m.db[id]; ok {
+		for _, i := range m.indexes {
+			i.remove(stored)
+		}
+	}
+	m.db[id] = resource
+	for _, i := range m.indexes {
+		i.add(resource)
+	}
+}
+
+// Removes the resource by its id, and updates the indexes. Caller must hold the lock.
+func (m *memoryDB) del(id string) {
+	if stored, ok := m.db[id]; ok {
+		for _, i := range m.indexes {
+			i.remove(stored)
+		}
+	}
+	delete(m.db, id)
+}
+
+// Returns the ids of the resources that may match the filter by looking up the indexes, or false if the filter cannot
+// be served by the indexes. The filter must still be evaluated on the resources of the ids, as the indexes may return
+// more resources than those matched. Caller must hold the lock.
+func (m *memoryDB) lookup(filter string) (map[string]struct{}, bool) {
+	if len(m.indexes) == 0 {
+		return nil, false
+	}
+	root, err := m.filters.Compile(filter, m.resourceType)
+	if err != nil {
+		return nil, false
+	}
+	return m.lookupIDs(root)
+}
+
+func (m *memoryDB) lookupIDs(root *expr.Expression) (map[string]struct{}, bool) {
+	if root == nil {
+		return nil, false
+	}
+
+	switch strings.ToLower(root.Token()) {
+	case expr.And:
+		left, leftOk := m.lookupIDs(root.Left())
+		right, rightOk := m.lookupIDs(root.Right())
+		switch {
+		case leftOk && rightOk:
+			for id := range left {
+				if _, ok := right[id]; !ok {
+					delete(left, id)
+				}
+			}
+			return left, true
+		case leftOk:
+			return left, true
+		default:
+			return right, rightOk
+		}
+	case expr.Or:
+		left, leftOk := m.lookupIDs(root.Left())
+		if !leftOk {
+			return nil, false
+		}
+		right, rightOk := m.lookupIDs(root.Right())
+		if !rightOk {
+			return nil, false
+		}
+		for id := range right {
+			left[id] = struct{}{}
+		}
+		return left, true
+	case expr.Eq, expr.Sw, expr.Gt, expr.Ge, expr.Lt, expr.Le:
+		if !root.IsRelationalOperator() {
+			return nil, false
+		}
+		attrs := m.attributesOfPath(root.Left())
+		if len(attrs) == 0 {
+			return nil, false
+		}
+		i, ok := m.indexes[attrs[len(attrs)-1].ID()]
+		if !ok {
+			return nil, false
+		}
+		return i.lookup(strings.ToLower(root.Token()), root.Right().Token())
+	default:
+		return nil, false
+	}
+}
+
+// memoryIndex of the values of an attribute, by their keys (see memoryIndex.key). The keys are also kept in ascending
+// order, which is the order of the values for the comparisons the index serves beyond eq.
+type memoryIndex struct {
+	path  string
+	attrs []*spec.Attribute // from the top level attribute to the indexed attribute
+	ids   map[string]map[string]struct{}
+	keys  []string
+}
+
+func (i *memoryIndex) add(resource *prop.Resource) {
+	id := resource.IdOrEmpty()
+	for _, key := range i.keysOf(resource) {
+		ids, ok := i.ids[key]
+		if !ok {
+			ids = make(map[string]struct{})
+			i.ids[key] = ids
+
+			at := sort.SearchStrings(i.keys, key)
+			i.keys = append(i.keys, "")
+			copy(i.keys[at+1:], i.keys[at:])
+			i.keys[at] = key
+		}
+		ids[id] = struct{}{}
+	}
+}
+
+func (i *memoryIndex) remove(resource *prop.Resource) {
+	id := resource.IdOrEmpty()
+	for _, key := range i.keysOf(resource) {
+		ids, ok := i.ids[key]
+		if !ok {
+			continue
+		}
+		delete(ids, id)
+		if len(ids) == 0 {
+			delete(i.ids, key)
+			at := sort.SearchStrings(i.keys, key)
+			i.keys = append(i.keys[:at], i.keys[at+1:]...)
+		}
+	}
+}
+
+// Returns the distinct keys of the values of the attribute in the resource.
+func (i *memoryIndex) keysOf(resource *prop.Resource) []string {
+	seen := make(map[string]struct{})
+	var keys []string
+
+	var collect func(p prop.Property, attrs []*spec.Attribute)
+	collect = func(p prop.Property, attrs []*spec.Attribute) {
+		if p == nil {
+			return
+		}
+		if p.Attribute().MultiValued() {
+			_ = p.ForEachChild(func(_ int, child prop.Property) error {
+				collect(child, attrs)
+				return nil
+			})
+			return
+		}
+		if len(attrs) == 0 {
+			if p.IsUnassigned() {
+				return
+			}
+			if key, ok := i.key(p.Raw()); ok {
+				if _, dup := seen[key]; !dup {
+					seen[key] = struct{}{}
+					keys = append(keys, key)
+				}
+			}
+			return
+		}
+		next := attrs[0]
+		collect(p.FindChild(func(child prop.Property) bool {
+			return child.Attribute().ID() == next.ID()
+		}), attrs[1:])
+	}
+
+	top := i.attrs[0]
+	collect(resource.RootProperty().FindChild(func(child prop.Property) bool {
+		return child.Attribute().ID() == top.ID()
+	}), i.attrs[1:])
+	return keys
+}
+
+// Returns the key of the value of the attribute, whose ascending order is the order of the values for the
+// attribute types whose comparisons beyond eq are served (see memoryIndex.ordered). Keys of text values are their
+// collation keys, keys of dateTime values are their UTC form of fixed width, and keys of numbers are the hexadecimal
+// forms of their bits with the sign flipped.
+func (i *memoryIndex) key(value interface{}) (string, bool) {
+	attr := i.attrs[len(i.attrs)-1]
+	switch v := value.(type) {
+	case string:
+		switch attr.Type() {
+		case spec.TypeString, spec.TypeReference:
+			return crud.CollationKey(attr, v), true
+		case spec.TypeDateTime:
+			t, err := spec.ParseDateTime(v)
+			if err != nil {
+				return "", false
+			}
+			return t.UTC().Format("2006-01-02T15:04:05.000000000"), true
+		default:
+			return v, true
+		}
+	case int64:
+		return fmt.Sprintf("%016x", uint64(v)^(1<<63)), true
+	case float64:
+		if math.IsNaN(v) {
+			return "", false
+		}
+		if v == 0 {
+			v = 0 // -0 equals 0
+		}
+		bits := math.Float64bits(v)
+		if v < 0 {
+			bits = ^bits
+		} else {
+			bits ^= 1 << 63
+		}
+		return fmt.Sprintf("%016x", bits), true
+	case bool:
+		return strconv.FormatBool(v), true
+	default:
+		return "", false
+	}
+}
+
+// Returns the key of the literal of a comparison on the attribute, or false if it is not a value of the attribute.
+func (i *memoryIndex) keyOfLiteral(literal string) (string, bool) {
+	switch i.attrs[len(i.attrs)-1].Type() {
+	case spec.TypeString, spec.TypeReference, spec.TypeBinary, spec.TypeDateTime:
+		s, err := expr.Unquote(literal)
+		if err != nil {
+			return "", false
+		}
+		return i.key(s)
+	case spec.TypeInteger:
+		i64, err := strconv.ParseInt(literal, 10, 64)
+		if err != nil {
+			return "", false
+		}
+		return i.key(i64)
+	case spec.TypeDecimal:
+		f64, err := strconv.ParseFloat(literal, 64)
+		if err != nil {
+			return "", false
+		}
+		return i.key(f64)
+	case spec.TypeBoolean:
+		b, err := strconv.ParseBool(literal)
+		if err != nil {
+			return "", false
+		}
+		return i.key(b)
+	default:
+		return "", false
+	}
+}
+
+// Returns true if the order of the keys is the order of the values for the comparison operator.
+func (i *memoryIndex) ordered(op string) bool {
+	switch i.attrs[len(i.attrs)-1].Type() {
+	case spec.TypeString, spec.TypeReference:
+		return op == expr.Sw
+	case spec.TypeDateTime, spec.TypeInteger, spec.TypeDecimal:
+		return op != expr.Sw
+	default:
+		return false
+	}
+}
+
+// Returns the ids of the resources with a value meeting the comparison with the literal, or false if the comparison
+// is not served by the index.
+func (i *memoryIndex) lookup(op string, literal string) (map[string]struct{}, bool) {
+	key, ok := i.keyOfLiteral(literal)
+	if !ok || (op != expr.Eq && !i.ordered(op)) {
+		return nil, false
+	}
+
+	var keys []string
+	switch op {
+	case expr.Eq:
+		keys = []string{key}
+	case expr.Sw:
+		for at := sort.SearchStrings(i.keys, key); at < len(i.keys) && strings.HasPrefix(i.keys[at], key); at++ {
+			keys = append(keys, i.keys[at])
+		}
+	case expr.Gt:
+		keys = i.keys[sort.Search(len(i.keys), func(at int) bool { return i.keys[at] > key }):]
+	case expr.Ge:
+		keys = i.keys[sort.SearchStrings(i.keys, key):]
+	case expr.Lt:
+		keys = i.keys[:sort.SearchStrings(i.keys, key)]
+	case expr.Le:
+		keys = i.keys[:sort.Search(len(i.keys), func(at int) bool { return i.keys[at] > key })]
+	}
+
+	ids := make(map[string]struct{})
+	for _, k := range keys {
+		for id := range i.ids[k] {
+			ids[id] = struct{}{}
+		}
+	}
+	return ids, true
+}
@@ -0,0 +1,382 @@
+package db
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	scimjson "github.com/imulab/go-scim/pkg/v2/json"
+	"github.com/imulab/go-scim/pkg/v2/prop"
+	"github.com/imulab/go-scim/pkg/v2/spec"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Files of PersistentMemory in the directory of PersistenceOptions.
+const (
+	SnapshotFile = "snapshot.ndjson"
+	LogFile      = "log.ndjson"
+)
+
+// SnapshotDB is implemented by DB that keep their resources in memory and persist them on disk, i.e. the one returned
+// by PersistentMemory, so that snapshots can be taken in the background (see SnapshotEvery).
+type SnapshotDB interface {
+	DB
+	// Snapshot writes all resources to the snapshot, replacing the previous one, and empties the log of the writes,
+	// which are now part of the snapshot.
+	Snapshot(ctx context.Context) error
+	// Close closes the log, after which writes fail with an error of spec.ErrInternal.
+	Close() error
+}
+
+// Snapshot calls Snapshot on the database if it is a SnapshotDB, or returns an error of spec.ErrInternal otherwise.
+func Snapshot(ctx context.Context, database DB) error {
+	if snapshotDB, ok := database.(SnapshotDB); ok {
+		return snapshotDB.Snapshot(ctx)
+	}
+	return fmt.Errorf("%w: database does not support snapshots", spec.ErrInternal)
+}
+
+// SnapshotEvery calls Snapshot at every interval until the context is done. Errors of Snapshot are passed to onError,
+// which may be nil; the log keeps the writes until the next snapshot succeeds.
+func SnapshotEvery(ctx context.Context, database DB, interval time.Duration, onError func(err error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := Snapshot(ctx, database); err != nil && onError != nil {
+				onError(err)
+			}
+		}
+	}
+}
+
+// PersistenceOptions are the options of PersistentMemory.
+type PersistenceOptions struct {
+	// Dir is the directory of the snapshot and the log, which is created if missing. Every database shall have a
+	// directory of its own.
+	Dir string
+	// Sync flushes the log to the disk upon every write before the write returns, so that no acknowledged write is lost
+	// when the machine fails, at the expense of the latency of writes. Without Sync, writes survive the failures of the
+	// process, but the latest ones may be lost with the machine.
+	Sync bool
+	// Indexes are the paths of the attributes to index, as in MemoryWithIndexes.
+	Indexes []string
+}
+
+// PersistentMemory returns a memory implementation of DB like MemoryWithIndexes, which persists the resources of the
+// resource type in the directory of the options, so that they survive restarts. It makes the zero-dependency mode of
+// the memory implementation usable for small deployments, with the same limits on throughput and size, since all
+// resources are kept in memory as well.
+//
+// Every write is appended to a log of JSON lines before it is applied in memory, and writes within a transaction are
+// appended all at once when it is committed; a write whose append fails returns an error of spec.ErrInternal, and is
+// not applied. Snapshots of all resources, which empty the log, shall be taken periodically so that the log does not
+// grow forever (see SnapshotEvery). Writes wait for snapshots to complete. Upon creation, the resources are restored
+// from the latest snapshot and the log, if any; a last line of the log that was partially written, i.e. when the
+// process failed during the append, is discarded, while other lines that cannot be read fail the creation with an error
+// of spec.ErrInternal.
+//
+// The returned DB implements SnapshotDB, in addition to the interfaces of the memory implementation. It shall be closed
+// once no longer used. Resources are stored as JSON documents of all their attributes, including those never returned,
+// hence the directory shall be protected accordingly.
+func PersistentMemory(resourceType *spec.ResourceType, options PersistenceOptions) (DB, error) {
+	database, err := MemoryWithIndexes(resourceType, options.Indexes...)
+	if err != nil {
+		return nil, err
+	}
+	m := database.(*memoryDB)
+
+	if err := os.MkdirAll(options.Dir, 0700); err != nil {
+		return nil, errPersistence(err)
+	}
+	if err := m.restoreSnapshot(filepath.Join(options.Dir, SnapshotFile)); err != nil {
+		return nil, err
+	}
+	file, err := m.restoreLog(filepath.Join(options.Dir, LogFile))
+	if err != nil {
+		return nil, err
+	}
+
+	m.log = &memoryLog{dir: options.Dir, file: file, sync: options.Sync}
+	return &persistentMemoryDB{memoryDB: m}, nil
+}
+
+// persistentMemoryDB is the memory implementation whose log is opened, and which implements SnapshotDB on top.
+type persistentMemoryDB struct {
+	*memoryDB
+}
+
+func (p *persistentMemoryDB) Snapshot(ctx context.Context) error {
+	m := p.memoryDB
+	if _, ok := ctx.Value(memoryTxKey{m}).(*memoryTx); ok {
+		return fmt.Errorf("%w: cannot snapshot within a transaction", spec.ErrInternal)
+	}
+	m.Lock()
+	defer m.Unlock()
+
+	if m.log.file == nil {
+		return fmt.Errorf("%w: database is closed", spec.ErrInternal)
+	}
+
+	var (
+		path = filepath.Join(m.log.dir, SnapshotFile)
+		temp = path + ".tmp"
+	)
+	file, err := os.OpenFile(temp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return errPersistence(err)
+	}
+	out := bufio.NewWriter(file)
+	for _, resource := range m.db {
+		raw, err := marshalResource(resource)
+		if err == nil {
+			_, err = out.Write(append(raw, '\n'))
+		}
+		if err != nil {
+			_ = file.Close()
+			return errPersistence(err)
+		}
+	}
+	if err := out.Flush(); err != nil {
+		_ = file.Close()
+		return errPersistence(err)
+	}
+	if err := file.Sync(); err != nil {
+		_ = file.Close()
+		return errPersistence(err)
+	}
+	if err := file.Close(); err != nil {
+		return errPersistence(err)
+	}
+
+	// Once renamed, the snapshot includes the writes of the log, which is emptied. Should the process fail before, the
+	// writes are restored from the log again, which is harmless as they set the resources to the state they are in. The
+	// rename must reach the disk before the log is emptied, lest the machine fails with neither holding the writes.
+	if err := os.Rename(temp, path); err != nil {
+		return errPersistence(err)
+	}
+	if err := syncDir(m.log.dir); err != nil {
+		return errPersistence(err)
+	}
+	if err := m.log.file.Truncate(0); err != nil {
+		return errPersistence(err)
+	}
+	if err := m.log.file.Sync(); err != nil {
+		return errPersistence(err)
+	}
+	return nil
+}
+
+// Flushes the entries of the directory, such as a file renamed into it, to the disk.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	if err := d.Sync(); err != nil {
+		_ = d.Close()
+		return err
+	}
+	return d.Close()
+}
+
+func (p *persistentMemoryDB) Close() error {
+	m := p.memoryDB
+	m.Lock()
+	defer m.Unlock()
+
+	if m.log.file == nil {
+		return nil
+	}
+	err := m.log.file.Close()
+	m.log.file = nil
+	if err != nil {
+		return errPersistence(err)
+	}
+	return nil
+}
+
+// memoryLog appends the changes of the memory implementation to the log file.
+type memoryLog struct {
+	dir  string
+	file *os.File // nil once closed
+	sync bool
+}
+
+// logRecord is a line of the log.
+type logRecord struct {
+	Type     string          `json:"type"` // ChangeInsert, ChangeUpdate or ChangeDelete
+	ID       string          `json:"id"`
+	Resource json.RawMessage `json:"resource,omitempty"` // document of all attributes, unless deleted
+}
+
+// Appends the changes to the log in a single write. Caller must hold the lock.
+func (l *memoryLog) append(changes ...*Change) error {
+	if len(changes) == 0 {
+		return nil
+	}
+	if l.file == nil {
+		return fmt.Errorf("%w: database is closed", spec.ErrInternal)
+	}
+
+	var buf bytes.Buffer
+	for _, change := range changes {
+		record := logRecord{Type: change.Type, ID: change.ID}
+		if change.Resource != nil {
+			doc, err := marshalResource(change.Resource)
+			if err != nil {
+				return err
+			}
+			record.Resource = doc
+		}
+		raw, err := json.Marshal(record)
+		if err != nil {
+			return errPersistence(err)
+		}
+		buf.Write(raw)
+		buf.WriteByte('\n')
+	}
+
+	info, err := l.file.Stat()
+	if err != nil {
+		return errPersistence(err)
+	}
+	if _, err := l.file.Write(buf.Bytes()); err != nil {
+		// Discard what was partially written, so that later appends do not follow a broken line.
+		_ = l.file.Truncate(info.Size())
+		return errPersistence(err)
+	}
+	if l.sync {
+		if err := l.file.Sync(); err != nil {
+			return errPersistence(err)
+		}
+	}
+	return nil
+}
+
+// Puts the resources of the snapshot at the path, if it exists.
+func (m *memoryDB) restoreSnapshot(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return errPersistence(err)
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+
+	return readLines(file, func(n int, line []byte, complete bool) error {
+		if !complete {
+			return fmt.Errorf("%w: snapshot '%s' is truncated at line %d", spec.ErrInternal, path, n)
+		}
+		resource, err := m.restoreResource(line)
+		if err != nil {
+			return fmt.Errorf("%w: snapshot '%s' is corrupt at line %d", spec.ErrInternal, path, n)
+		}
+		m.put(resource.IdOrEmpty(), resource)
+		return nil
+	})
+}
+
+// Applies the writes of the log at the path, discarding a last line partially written, and returns the log opened for
+// appending, which is created if missing.
+func (m *memoryDB) restoreLog(path string) (*os.File, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, errPersistence(err)
+	}
+
+	var valid int64 // size of the complete lines
+	err = readLines(file, func(n int, line []byte, complete bool) error {
+		if !complete {
+			return nil
+		}
+		var record logRecord
+		if err := json.Unmarshal(line, &record); err != nil {
+			return fmt.Errorf("%w: log '%s' is corrupt at line %d", spec.ErrInternal, path, n)
+		}
+		switch record.Type {
+		case ChangeInsert, ChangeUpdate:
+			resource, err := m.restoreResource(record.Resource)
+			if err != nil {
+				return fmt.Errorf("%w: log '%s' is corrupt at line %d", spec.ErrInternal, path, n)
+			}
+			m.put(record.ID, resource)
+		case ChangeDelete:
+			m.del(record.ID)
+		default:
+			return fmt.Errorf("%w: log '%s' is corrupt at line %d", spec.ErrInternal, path, n)
+		}
+		valid += int64(len(line)) + 1
+		return nil
+	})
+	if err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+	if err := file.Truncate(valid); err != nil {
+		_ = file.Close()
+		return nil, errPersistence(err)
+	}
+	return file, nil
+}
+
+// Returns the resource of the JSON document.
+func (m *memoryDB) restoreResource(doc []byte) (*prop.Resource, error) {
+	resource := prop.NewResource(m.resourceType)
+	if err := scimjson.Deserialize(doc, resource); err != nil {
+		return nil, err
+	}
+	if len(resource.IdOrEmpty()) == 0 {
+		return nil, fmt.Errorf("%w: empty id", spec.ErrInternal)
+	}
+	return resource, nil
+}
+
+// Calls fn with every line of the reader, numbered from 1, without the newline, and whether it ended with the
+// newline, which only the last line may not.
+func readLines(r io.Reader, fn func(n int, line []byte, complete bool) error) error {
+	reader := bufio.NewReader(r)
+	for n := 1; ; n++ {
+		line, err := reader.ReadBytes('\n')
+		if len(line) > 0 {
+			complete := line[len(line)-1] == '\n'
+			if complete {
+				line = line[:len(line)-1]
+			}
+			if err := fn(n, line, complete); err != nil {
+				return err
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return errPersistence(err)
+		}
+	}
+}
+
+func errPersistence(err error) error {
+	return fmt.Errorf("%w: %v", spec.ErrInternal, err)
+}
+
+var (
+	_ SnapshotDB     = (*persistentMemoryDB)(nil)
+	_ CursorDB       = (*persistentMemoryDB)(nil)
+	_ ElementDB      = (*persistentMemoryDB)(nil)
+	_ TxDB           = (*persistentMemoryDB)(nil)
+	_ BulkWriteDB    = (*persistentMemoryDB)(nil)
+	_ IndexedDB      = (*persistentMemoryDB)(nil)
+	_ ChangeStreamDB = (*persistentMemoryDB)(nil)
+)
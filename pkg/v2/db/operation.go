@@ -0,0 +1,74 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"github.com/imulab/go-scim/pkg/v2/spec"
+	"github.com/imulab/go-scim/pkg/v2/tenant"
+	"sync"
+	"time"
+)
+
+// Status of asynchronous operations.
+const (
+	OperationPending   = "pending"
+	OperationRunning   = "running"
+	OperationSucceeded = "succeeded"
+	OperationFailed    = "failed"
+)
+
+// Operation is the status of an asynchronous create, replace or delete of a resource.
+type Operation struct {
+	ID           string    `json:"id"`
+	Method       string    `json:"method"` // operation on the resource, i.e. create, replace, delete
+	ResourceType string    `json:"resourceType"`
+	ResourceID   string    `json:"resourceId,omitempty"` // id of the resource, once known
+	Status       string    `json:"status"`
+	Location     string    `json:"location,omitempty"` // meta.location of the resulting resource, if succeeded
+	Version      string    `json:"version,omitempty"`  // meta.version of the resulting resource, if succeeded
+	Err          error     `json:"-"`                  // cause of the failure, if failed
+	Created      time.Time `json:"created"`
+	LastModified time.Time `json:"lastModified"`
+}
+
+// OperationDB stores the status of asynchronous operations.
+type OperationDB interface {
+	// Put inserts the operation, or replaces the operation by the same id.
+	Put(ctx context.Context, operation *Operation) error
+	// Get returns the operation by its id, or an error of spec.ErrNotFound.
+	Get(ctx context.Context, id string) (*Operation, error)
+}
+
+// MemoryOperations returns a memory implementation of OperationDB, which keeps the operations of different tenants
+// apart (see tenant.Scope). Like Memory, it is only intended for testing and showcasing purposes.
+func MemoryOperations() OperationDB {
+	return &memoryOperationDB{operations: make(map[string]Operation)}
+}
+
+type memoryOperationDB struct {
+	sync.RWMutex
+	operations map[string]Operation
+}
+
+func (m *memoryOperationDB) Put(ctx context.Context, operation *Operation) error {
+	if len(operation.ID) == 0 {
+		return fmt.Errorf("%w: empty operation id", spec.ErrInternal)
+	}
+
+	m.Lock()
+	defer m.Unlock()
+
+	m.operations[tenant.Scope(ctx, operation.ID)] = *operation
+	return nil
+}
+
+func (m *memoryOperationDB) Get(ctx context.Context, id string) (*Operation, error) {
+	m.RLock()
+	defer m.RUnlock()
+
+	operation, ok := m.operations[tenant.Scope(ctx, id)]
+	if !ok {
+		return nil, fmt.Errorf("%w: operation not found by id", spec.ErrNotFound)
+	}
+	return &operation, nil
+}
@@ -0,0 +1,216 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/imulab/go-scim/pkg/v2/crud"
+	"github.com/imulab/go-scim/pkg/v2/prop"
+	"github.com/imulab/go-scim/pkg/v2/spec"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ReplicaOptions are the options of Replicated.
+type ReplicaOptions struct {
+	// StickyFor is how long the reads with a sticky context (see Sticky) go to the primary after a write with the
+	// context, which shall exceed the replication lag of the replicas; with zero, they go to the primary for the
+	// lifetime of the context once it wrote.
+	StickyFor time.Duration
+	// Fallback retries the reads that fail on a replica with an error of spec.ErrInternal on the primary, so that an
+	// unavailable replica does not fail the reads.
+	Fallback bool
+}
+
+// Replicated returns a DB that writes to the primary database, and reads from the replicas, i.e. databases on the
+// read replicas of the primary, so that read heavy traffic like the reconciliations of identity providers scales with
+// the replicas. Get, GetMany, Query, QueryCursor and Count go to the replicas in turn; Insert, Replace, Delete and the
+// bulk writes go to the primary. With no replicas, all calls go to the primary.
+//
+// Since replicas lag behind the primary, a resource just written may not be found, or be stale, when read back from a
+// replica. Reads that rely on their own writes, i.e. of a reconciliation that creates then patches a user, go to the
+// primary when their context is sticky (see Sticky) and wrote before. Calls within a transaction (see WithTx) always go
+// to the primary, whose transaction the replicas cannot see.
+//
+// The returned DB also implements CursorDB, returning an error of spec.ErrInvalidSyntax if the database read from does
+// not, BatchDB, ElementDB, BulkWriteDB, TxDB, which calls WithTx on the primary, and ChangeStreamDB, which subscribes to the
+// changes of the primary.
+func Replicated(primary DB, replicas []DB, options ReplicaOptions) DB {
+	return &replicatedDB{primary: primary, replicas: replicas, options: options}
+}
+
+// Sticky returns a context for a unit of work, i.e. a request or a reconciliation, whose reads go to the primary after
+// it wrote through a DB returned by Replicated, so that the work reads its own writes (see ReplicaOptions.StickyFor).
+// The contexts derived from it share the stickiness; a context that is sticky already is returned as it is.
+func Sticky(ctx context.Context) context.Context {
+	if _, ok := ctx.Value(stickyKey{}).(*stickiness); ok {
+		return ctx
+	}
+	return context.WithValue(ctx, stickyKey{}, new(stickiness))
+}
+
+type (
+	stickyKey  struct{}
+	primaryKey struct{}
+)
+
+// stickiness records the time of the last write with a sticky context.
+type stickiness struct {
+	sync.Mutex
+	written time.Time
+}
+
+type replicatedDB struct {
+	primary  DB
+	replicas []DB
+	options  ReplicaOptions
+	next     uint32 // of the replica to read from
+}
+
+// Returns the database to read from with the context, and whether it is a replica.
+func (d *replicatedDB) reader(ctx context.Context) (DB, bool) {
+	if len(d.replicas) == 0 || ctx.Value(primaryKey{}) != nil {
+		return d.primary, false
+	}
+	if s, ok := ctx.Value(stickyKey{}).(*stickiness); ok {
+		s.Lock()
+		written := s.written
+		s.Unlock()
+		if !written.IsZero() && (d.options.StickyFor <= 0 || time.Since(written) < d.options.StickyFor) {
+			return d.primary, false
+		}
+	}
+	i := atomic.AddUint32(&d.next, 1)
+	return d.replicas[int(i%uint32(len(d.replicas)))], true
+}
+
+// Calls fn with the database to read from, and again with the primary if it fails on a replica with an error of
+// spec.ErrInternal, when falling back.
+func (d *replicatedDB) read(ctx context.Context, fn func(database DB) error) error {
+	database, replica := d.reader(ctx)
+	err := fn(database)
+	if err != nil && replica && d.options.Fallback && errors.Is(err, spec.ErrInternal) {
+		err = fn(d.primary)
+	}
+	return err
+}
+
+// Records the write with the context, if it is sticky.
+func (d *replicatedDB) wrote(ctx context.Context) {
+	if s, ok := ctx.Value(stickyKey{}).(*stickiness); ok {
+		s.Lock()
+		s.written = time.Now()
+		s.Unlock()
+	}
+}
+
+func (d *replicatedDB) Insert(ctx context.Context, resource *prop.Resource) error {
+	defer d.wrote(ctx)
+	return d.primary.Insert(ctx, resource)
+}
+
+func (d *replicatedDB) Count(ctx context.Context, filter string) (n int, err error) {
+	err = d.read(ctx, func(database DB) (err error) {
+		n, err = database.Count(ctx, filter)
+		return
+	})
+	return
+}
+
+func (d *replicatedDB) Get(ctx context.Context, id string, projection *crud.Projection) (resource *prop.Resource, err error) {
+	err = d.read(ctx, func(database DB) (err error) {
+		resource, err = database.Get(ctx, id, projection)
+		return
+	})
+	return
+}
+
+func (d *replicatedDB) GetMany(ctx context.Context, ids []string, projection *crud.Projection) (resources []*prop.Resource, err error) {
+	err = d.read(ctx, func(database DB) (err error) {
+		resources, err = GetMany(ctx, database, ids, projection)
+		return
+	})
+	return
+}
+
+func (d *replicatedDB) CountElements(ctx context.Context, id string, attribute string) (n int, err error) {
+	err = d.read(ctx, func(database DB) (err error) {
+		n, err = CountElements(ctx, database, id, attribute)
+		return
+	})
+	return
+}
+
+func (d *replicatedDB) GetElements(ctx context.Context, id string, attribute string, pagination *crud.Pagination) (elements []interface{}, err error) {
+	err = d.read(ctx, func(database DB) (err error) {
+		elements, err = GetElements(ctx, database, id, attribute, pagination)
+		return
+	})
+	return
+}
+
+func (d *replicatedDB) Replace(ctx context.Context, ref *prop.Resource, replacement *prop.Resource) error {
+	defer d.wrote(ctx)
+	return d.primary.Replace(ctx, ref, replacement)
+}
+
+func (d *replicatedDB) Delete(ctx context.Context, resource *prop.Resource) error {
+	defer d.wrote(ctx)
+	return d.primary.Delete(ctx, resource)
+}
+
+func (d *replicatedDB) InsertMany(ctx context.Context, resources []*prop.Resource) []error {
+	defer d.wrote(ctx)
+	return InsertMany(ctx, d.primary, resources)
+}
+
+func (d *replicatedDB) ReplaceMany(ctx context.Context, replacements []Replacement) []error {
+	defer d.wrote(ctx)
+	return ReplaceMany(ctx, d.primary, replacements)
+}
+
+func (d *replicatedDB) DeleteMany(ctx context.Context, resources []*prop.Resource) []error {
+	defer d.wrote(ctx)
+	return DeleteMany(ctx, d.primary, resources)
+}
+
+func (d *replicatedDB) Query(ctx context.Context, filter string, sort *crud.Sort, pagination *crud.Pagination, projection *crud.Projection) (resources []*prop.Resource, err error) {
+	err = d.read(ctx, func(database DB) (err error) {
+		resources, err = database.Query(ctx, filter, sort, pagination, projection)
+		return
+	})
+	return
+}
+
+func (d *replicatedDB) QueryCursor(ctx context.Context, filter string, sort *crud.Sort, pagination *crud.CursorPagination, projection *crud.Projection) (resources []*prop.Resource, next string, err error) {
+	err = d.read(ctx, func(database DB) (err error) {
+		cursorDB, ok := database.(CursorDB)
+		if !ok {
+			return fmt.Errorf("%w: cursor pagination is not supported", spec.ErrInvalidSyntax)
+		}
+		resources, next, err = cursorDB.QueryCursor(ctx, filter, sort, pagination, projection)
+		return
+	})
+	return
+}
+
+func (d *replicatedDB) WithTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	defer d.wrote(ctx)
+	return WithTx(ctx, d.primary, func(ctx context.Context) error {
+		return fn(context.WithValue(ctx, primaryKey{}, true))
+	})
+}
+
+func (d *replicatedDB) Subscribe(ctx context.Context, fn func(ctx context.Context, change *Change) error) error {
+	return Subscribe(ctx, d.primary, fn)
+}
+
+var (
+	_ CursorDB       = (*replicatedDB)(nil)
+	_ BatchDB        = (*replicatedDB)(nil)
+	_ ElementDB      = (*replicatedDB)(nil)
+	_ BulkWriteDB    = (*replicatedDB)(nil)
+	_ TxDB           = (*replicatedDB)(nil)
+	_ ChangeStreamDB = (*replicatedDB)(nil)
+)
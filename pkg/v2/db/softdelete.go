@@ -0,0 +1,124 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"github.com/imulab/go-scim/pkg/v2/crud"
+	"github.com/imulab/go-scim/pkg/v2/crud/expr"
+	"github.com/imulab/go-scim/pkg/v2/prop"
+	"github.com/imulab/go-scim/pkg/v2/spec"
+	"strings"
+)
+
+// notDeleted is the filter that excludes resources tombstoned with meta.deleted.
+const notDeleted = "not (meta.deleted pr)"
+
+// SoftDelete returns a DB that hides the resources soft deleted from the given database, which carry a meta.deleted
+// timestamp (see service.SoftDeleteService). Get reports soft deleted resources as not found, GetMany leaves them out,
+// and so do Count, Query and QueryCursor, unless the filter mentions meta.deleted explicitly (i.e. "meta.deleted pr"),
+// in which case the filter is passed on as is. Insert, Replace and Delete are passed on as is, hence Delete permanently deletes
+// the resource. QueryCursor returns an error of spec.ErrInvalidSyntax if the given database is not a CursorDB. The
+// returned DB also implements TxDB, by calling WithTx on the given database, and ChangeStreamDB, by calling Subscribe on
+// the given database, which notifies soft deletes as updates.
+//
+// Get and GetMany ignore the projection, so that meta.deleted is always loaded to tell soft deleted resources apart.
+func SoftDelete(database DB) CursorDB {
+	return &softDeleteDB{DB: database}
+}
+
+type softDeleteDB struct {
+	DB
+}
+
+func (d *softDeleteDB) Get(ctx context.Context, id string, _ *crud.Projection) (*prop.Resource, error) {
+	resource, err := d.DB.Get(ctx, id, nil)
+	if err != nil {
+		return nil, err
+	}
+	if len(resource.MetaDeletedOrEmpty()) > 0 {
+		return nil, fmt.Errorf("%w: resource not found by id", spec.ErrNotFound)
+	}
+	return resource, nil
+}
+
+func (d *softDeleteDB) GetMany(ctx context.Context, ids []string, _ *crud.Projection) ([]*prop.Resource, error) {
+	resources, err := GetMany(ctx, d.DB, ids, nil)
+	if err != nil {
+		return nil, err
+	}
+	visible := resources[:0]
+	for _, resource := range resources {
+		if len(resource.MetaDeletedOrEmpty()) == 0 {
+			visible = append(visible, resource)
+		}
+	}
+	return visible, nil
+}
+
+func (d *softDeleteDB) Count(ctx context.Context, filter string) (int, error) {
+	filter, err := d.filter(filter)
+	if err != nil {
+		return 0, err
+	}
+	return d.DB.Count(ctx, filter)
+}
+
+func (d *softDeleteDB) Query(ctx context.Context, filter string, sort *crud.Sort, pagination *crud.Pagination, projection *crud.Projection) ([]*prop.Resource, error) {
+	filter, err := d.filter(filter)
+	if err != nil {
+		return nil, err
+	}
+	return d.DB.Query(ctx, filter, sort, pagination, projection)
+}
+
+func (d *softDeleteDB) QueryCursor(ctx context.Context, filter string, sort *crud.Sort, pagination *crud.CursorPagination, projection *crud.Projection) ([]*prop.Resource, string, error) {
+	cursorDB, ok := d.DB.(CursorDB)
+	if !ok {
+		return nil, "", fmt.Errorf("%w: cursor pagination is not supported", spec.ErrInvalidSyntax)
+	}
+
+	filter, err := d.filter(filter)
+	if err != nil {
+		return nil, "", err
+	}
+	return cursorDB.QueryCursor(ctx, filter, sort, pagination, projection)
+}
+
+func (d *softDeleteDB) WithTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	return WithTx(ctx, d.DB, fn)
+}
+
+func (d *softDeleteDB) Subscribe(ctx context.Context, fn func(ctx context.Context, change *Change) error) error {
+	return Subscribe(ctx, d.DB, fn)
+}
+
+// Returns the filter that additionally excludes soft deleted resources, unless it mentions meta.deleted.
+func (d *softDeleteDB) filter(filter string) (string, error) {
+	return excluding(filter, "meta.deleted", notDeleted)
+}
+
+// Returns the filter combined with the exclusion, unless it compares the attribute at the path, in which case the
+// filter is returned as is, so that the excluded resources can still be queried explicitly.
+func excluding(filter string, path string, exclusion string) (string, error) {
+	if len(strings.TrimSpace(filter)) == 0 {
+		return exclusion, nil
+	}
+
+	root, err := expr.CompileFilter(filter)
+	if err != nil {
+		return "", err
+	}
+
+	mentioned := false
+	expr.Inspect(root, func(e *expr.Expression) bool {
+		if e != nil && e.IsRelationalOperator() && e.Left() != nil && strings.EqualFold(e.Left().String(), path) {
+			mentioned = true
+		}
+		return !mentioned
+	})
+	if mentioned {
+		return filter, nil
+	}
+
+	return fmt.Sprintf("(%s) and %s", filter, exclusion), nil
+}
@@ -0,0 +1,221 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"github.com/imulab/go-scim/pkg/v2/crud"
+	"github.com/imulab/go-scim/pkg/v2/prop"
+	"github.com/imulab/go-scim/pkg/v2/spec"
+	"github.com/imulab/go-scim/pkg/v2/tenant"
+	"sync"
+)
+
+// TenantDB returns a DB that keeps the resources of every tenant in a database of its own, opened with the open
+// function the first time the tenant is seen, and selected by the tenant carried by the context (see tenant.With).
+// Since the resources of different tenants never meet, the uniqueness of attributes, as checked by the services or
+// enforced by unique indexes, is scoped to the tenant as well. Calls without a tenant in the context fail with an
+// error of spec.ErrInternal. The database of a tenant is opened once, without holding up the calls of other tenants,
+// and opened again on the next call if the open function failed.
+//
+// The returned DB also implements CursorDB, returning an error of spec.ErrInvalidSyntax if the database of the tenant
+// does not, BatchDB, ElementDB, BulkWriteDB, TxDB, which calls WithTx on the database of the tenant, and
+// ChangeStreamDB, which subscribes to the changes of the database of the tenant.
+func TenantDB(open func(ctx context.Context, tenant string) (DB, error)) DB {
+	return &tenantDB{
+		open:      open,
+		databases: make(map[string]DB),
+		opening:   make(map[string]*sync.Mutex),
+	}
+}
+
+type tenantDB struct {
+	sync.RWMutex
+	open      func(ctx context.Context, tenant string) (DB, error)
+	databases map[string]DB
+	// opening guards the open function per tenant, so that the database of a tenant is opened once at a time
+	opening map[string]*sync.Mutex
+}
+
+func (t *tenantDB) database(ctx context.Context) (DB, error) {
+	id, err := tenant.Require(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if database, ok := t.lookup(id); ok {
+		return database, nil
+	}
+
+	t.Lock()
+	guard, ok := t.opening[id]
+	if !ok {
+		guard = new(sync.Mutex)
+		t.opening[id] = guard
+	}
+	t.Unlock()
+
+	guard.Lock()
+	defer guard.Unlock()
+
+	// opened by another call while this one was waiting
+	if database, ok := t.lookup(id); ok {
+		return database, nil
+	}
+	database, err := t.open(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	t.Lock()
+	t.databases[id] = database
+	t.Unlock()
+	return database, nil
+}
+
+func (t *tenantDB) lookup(id string) (DB, bool) {
+	t.RLock()
+	defer t.RUnlock()
+	database, ok := t.databases[id]
+	return database, ok
+}
+
+func (t *tenantDB) Insert(ctx context.Context, resource *prop.Resource) error {
+	database, err := t.database(ctx)
+	if err != nil {
+		return err
+	}
+	return database.Insert(ctx, resource)
+}
+
+func (t *tenantDB) Count(ctx context.Context, filter string) (int, error) {
+	database, err := t.database(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return database.Count(ctx, filter)
+}
+
+func (t *tenantDB) Get(ctx context.Context, id string, projection *crud.Projection) (*prop.Resource, error) {
+	database, err := t.database(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return database.Get(ctx, id, projection)
+}
+
+func (t *tenantDB) GetMany(ctx context.Context, ids []string, projection *crud.Projection) ([]*prop.Resource, error) {
+	database, err := t.database(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return GetMany(ctx, database, ids, projection)
+}
+
+func (t *tenantDB) CountElements(ctx context.Context, id string, attribute string) (int, error) {
+	database, err := t.database(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return CountElements(ctx, database, id, attribute)
+}
+
+func (t *tenantDB) GetElements(
+	ctx context.Context,
+	id string,
+	attribute string,
+	pagination *crud.Pagination,
+) ([]interface{}, error) {
+	database, err := t.database(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return GetElements(ctx, database, id, attribute, pagination)
+}
+
+func (t *tenantDB) Replace(ctx context.Context, ref *prop.Resource, replacement *prop.Resource) error {
+	database, err := t.database(ctx)
+	if err != nil {
+		return err
+	}
+	return database.Replace(ctx, ref, replacement)
+}
+
+func (t *tenantDB) Delete(ctx context.Context, resource *prop.Resource) error {
+	database, err := t.database(ctx)
+	if err != nil {
+		return err
+	}
+	return database.Delete(ctx, resource)
+}
+
+func (t *tenantDB) InsertMany(ctx context.Context, resources []*prop.Resource) []error {
+	database, err := t.database(ctx)
+	if err != nil {
+		return errorsOf(len(resources), err)
+	}
+	return InsertMany(ctx, database, resources)
+}
+
+func (t *tenantDB) ReplaceMany(ctx context.Context, replacements []Replacement) []error {
+	database, err := t.database(ctx)
+	if err != nil {
+		return errorsOf(len(replacements), err)
+	}
+	return ReplaceMany(ctx, database, replacements)
+}
+
+func (t *tenantDB) DeleteMany(ctx context.Context, resources []*prop.Resource) []error {
+	database, err := t.database(ctx)
+	if err != nil {
+		return errorsOf(len(resources), err)
+	}
+	return DeleteMany(ctx, database, resources)
+}
+
+func (t *tenantDB) Query(
+	ctx context.Context,
+	filter string,
+	sort *crud.Sort,
+	pagination *crud.Pagination,
+	projection *crud.Projection,
+) ([]*prop.Resource, error) {
+	database, err := t.database(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return database.Query(ctx, filter, sort, pagination, projection)
+}
+
+func (t *tenantDB) QueryCursor(
+	ctx context.Context,
+	filter string,
+	sort *crud.Sort,
+	pagination *crud.CursorPagination,
+	projection *crud.Projection,
+) ([]*prop.Resource, string, error) {
+	database, err := t.database(ctx)
+	if err != nil {
+		return nil, "", err
+	}
+	cursorDB, ok := database.(CursorDB)
+	if !ok {
+		return nil, "", fmt.Errorf("%w: cursor pagination is not supported", spec.ErrInvalidSyntax)
+	}
+	return cursorDB.QueryCursor(ctx, filter, sort, pagination, projection)
+}
+
+func (t *tenantDB) WithTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	database, err := t.database(ctx)
+	if err != nil {
+		return err
+	}
+	return WithTx(ctx, database, fn)
+}
+
+func (t *tenantDB) Subscribe(ctx context.Context, fn func(ctx context.Context, change *Change) error) error {
+	database, err := t.database(ctx)
+	if err != nil {
+		return err
+	}
+	return Subscribe(ctx, database, fn)
+}
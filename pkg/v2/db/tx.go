@@ -0,0 +1,34 @@
+package db
+
+import (
+	"context"
+)
+
+// TxDB is implemented by DB that can execute many operations atomically, so that operations spanning many resources,
+// i.e. bulk requests, the removal of references to deleted resources and the synchronization of group members, are
+// either applied as a whole or not at all.
+type TxDB interface {
+	DB
+	// WithTx calls fn with a context carrying a transaction of the database. The operations of the database called
+	// with this context are part of the transaction, which is committed when fn returns nil, and rolled back when it
+	// returns an error or panics; the error of fn is returned as is. When the context already carries a transaction of
+	// the database, fn joins it instead, and it is up to the outermost call to commit or roll back. Transactions that
+	// cannot be committed because of concurrent transactions fail with an error of spec.ErrConflict, and may be
+	// retried.
+	//
+	// Implementations document the operations of other databases that take part in the transaction, i.e. those of SQL
+	// databases sharing the connection.
+	WithTx(ctx context.Context, fn func(ctx context.Context) error) error
+}
+
+// WithTx calls fn in a transaction of the database if it is a TxDB (see TxDB.WithTx). Otherwise, fn is called with the
+// context as is, and its operations are applied one by one as they are executed: when fn fails midway, the operations
+// already executed stay applied, which is the best the databases without transactions, i.e. DynamoDB, can do. The
+// decorators of this package (i.e. SoftDelete, TenantDB and Cached) implement TxDB by calling WithTx on the database
+// they decorate, and are hence only atomic when it is.
+func WithTx(ctx context.Context, database DB, fn func(ctx context.Context) error) error {
+	if txDB, ok := database.(TxDB); ok {
+		return txDB.WithTx(ctx, fn)
+	}
+	return fn(ctx)
+}
@@ -0,0 +1,81 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/imulab/go-scim/pkg/v2/prop"
+	"github.com/imulab/go-scim/pkg/v2/spec"
+)
+
+// AnyVersion is the expected version that matches any version of an existing resource, as the asterisk of an If-Match
+// header does.
+const AnyVersion = "*"
+
+// ConflictError is the error of MatchVersion, ReplaceIfMatch and DeleteIfMatch when the resource is not of the expected
+// version. It is an error of spec.ErrConflict, so that errors.Is and the responses of handlers treat it as such, while
+// callers in need of the details, i.e. to report the current version to clients, can get it with errors.As.
+type ConflictError struct {
+	ID       string // id of the resource
+	Expected string // version the resource was expected to be of
+	Actual   string // version of the resource, or empty if the stored resource was concurrently modified to an unknown version
+}
+
+func (e *ConflictError) Error() string {
+	if len(e.Actual) == 0 {
+		return fmt.Sprintf("%s: resource '%s' was modified and is no longer of version '%s'", spec.ErrConflict.Error(), e.ID, e.Expected)
+	}
+	return fmt.Sprintf("%s: resource '%s' is of version '%s', not '%s'", spec.ErrConflict.Error(), e.ID, e.Actual, e.Expected)
+}
+
+// Unwrap returns spec.ErrConflict.
+func (e *ConflictError) Unwrap() error {
+	return spec.ErrConflict
+}
+
+// MatchVersion returns a *ConflictError if the resource is not of the expected version, or nil if it is, or when the
+// version is AnyVersion. Versions are compared as is, i.e. W/"1" does not match "1".
+func MatchVersion(resource *prop.Resource, version string) error {
+	actual := resource.MetaVersionOrEmpty()
+	if version == AnyVersion || version == actual {
+		return nil
+	}
+	return &ConflictError{ID: resource.IdOrEmpty(), Expected: version, Actual: actual}
+}
+
+// ReplaceIfMatch replaces the reference resource with the replacement resource in the database only if the reference
+// is of the expected version (see MatchVersion), and the stored resource has not been modified since the reference was
+// read. Since DB.Replace is a compare-and-swap on the version of the reference, the version is checked atomically with
+// the replacement in every implementation, and an If-Match pre condition is enforced without the race of checking the
+// version of a resource read beforehand. Both mismatches fail with a *ConflictError.
+func ReplaceIfMatch(ctx context.Context, database DB, ref *prop.Resource, replacement *prop.Resource, version string) error {
+	if err := MatchVersion(ref, version); err != nil {
+		return err
+	}
+	return errIfModified(database.Replace(ctx, ref, replacement), ref, version)
+}
+
+// DeleteIfMatch deletes the resource from the database only if it is of the expected version (see MatchVersion), and
+// the stored resource has not been modified since it was read. Like ReplaceIfMatch, both mismatches fail with a
+// *ConflictError.
+func DeleteIfMatch(ctx context.Context, database DB, resource *prop.Resource, version string) error {
+	if err := MatchVersion(resource, version); err != nil {
+		return err
+	}
+	return errIfModified(database.Delete(ctx, resource), resource, version)
+}
+
+// Returns a *ConflictError in place of the error of spec.ErrConflict of the compare-and-swap, or the error as is.
+func errIfModified(err error, ref *prop.Resource, version string) error {
+	if err == nil || !errors.Is(err, spec.ErrConflict) {
+		return err
+	}
+	var conflictErr *ConflictError
+	if errors.As(err, &conflictErr) {
+		return err
+	}
+	if version == AnyVersion {
+		version = ref.MetaVersionOrEmpty()
+	}
+	return &ConflictError{ID: ref.IdOrEmpty(), Expected: version}
+}
@@ -0,0 +1,55 @@
+package db
+
+import (
+	"context"
+	"github.com/imulab/go-scim/pkg/v2/crud"
+	"github.com/imulab/go-scim/pkg/v2/prop"
+)
+
+// Walk calls fn with every page of at most size resources, which shall be positive, of the database matching the
+// filter, or of all resources when the filter is empty, until there are no more pages, fn returns an error, or the
+// context is done, and returns the error. The pages are queried with the cursors of QueryCursor if the database is a
+// CursorDB, so that writes in the meantime, i.e. by fn, do not cause resources to be skipped or walked twice, or
+// ordered by id with Query otherwise.
+func Walk(ctx context.Context, database DB, filter string, size int, fn func(ctx context.Context, page []*prop.Resource) error) error {
+	if len(filter) == 0 {
+		filter = "id pr"
+	}
+
+	var (
+		cursorDB, withCursor = database.(CursorDB)
+		cursor               string
+		start                = 1
+	)
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		var (
+			page []*prop.Resource
+			more bool
+			err  error
+		)
+		if withCursor {
+			page, cursor, err = cursorDB.QueryCursor(ctx, filter, nil, &crud.CursorPagination{Cursor: cursor, Count: size}, nil)
+			more = len(cursor) > 0
+		} else {
+			page, err = database.Query(ctx, filter, &crud.Sort{By: "id"}, &crud.Pagination{StartIndex: start, Count: size}, nil)
+			start += len(page)
+			more = len(page) == size
+		}
+		if err != nil {
+			return err
+		}
+
+		if len(page) > 0 {
+			if err := fn(ctx, page); err != nil {
+				return err
+			}
+		}
+		if !more {
+			return nil
+		}
+	}
+}
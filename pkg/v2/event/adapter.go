@@ -0,0 +1,70 @@
+package event
+
+import (
+	"context"
+)
+
+// The adapters below publish events, encoded with Marshal, to message brokers through minimal interfaces of their
+// clients, so that this module does not depend on any particular client library. The clients are easily adapted to
+// these interfaces, if they do not implement them already.
+
+// KafkaProducer produces messages to Kafka topics, i.e. a thin wrapper around segmentio/kafka-go Writer or
+// confluent-kafka-go Producer, which returns once the message is acknowledged by the brokers.
+type KafkaProducer interface {
+	Produce(ctx context.Context, topic string, key []byte, value []byte) error
+}
+
+// KafkaSink returns a Sink that produces the events to the Kafka topic. Messages are keyed by the tenant and id of the
+// resource, so that the events of a resource are kept in order within their partition.
+func KafkaSink(producer KafkaProducer, topic string) Sink {
+	return SinkFunc(func(ctx context.Context, event *Event) error {
+		value, err := Marshal(event)
+		if err != nil {
+			return err
+		}
+		return producer.Produce(ctx, topic, []byte(partitionKey(event)), value)
+	})
+}
+
+// NATSPublisher publishes messages to NATS subjects. It is implemented by *nats.Conn of nats-io/nats.go.
+type NATSPublisher interface {
+	Publish(subject string, data []byte) error
+}
+
+// NATSSink returns a Sink that publishes the events to the NATS subject suffixed by the resource type, i.e.
+// "scim.events.User" for subject "scim.events", so that consumers may subscribe to resource types of interest.
+func NATSSink(publisher NATSPublisher, subject string) Sink {
+	return SinkFunc(func(_ context.Context, event *Event) error {
+		data, err := Marshal(event)
+		if err != nil {
+			return err
+		}
+		return publisher.Publish(subject+"."+event.ResourceType, data)
+	})
+}
+
+// SQSSender sends messages to Amazon SQS queues, i.e. a thin wrapper around SendMessage of aws-sdk-go. The group id is
+// the MessageGroupId of FIFO queues, and the deduplication id the MessageDeduplicationId; both may be ignored for
+// standard queues.
+type SQSSender interface {
+	SendMessage(ctx context.Context, queueURL string, body string, groupID string, deduplicationID string) error
+}
+
+// SQSSink returns a Sink that sends the events to the SQS queue. For FIFO queues, events are grouped by the tenant and
+// id of the resource, so that the events of a resource are kept in order, and deduplicated by their id.
+func SQSSink(sender SQSSender, queueURL string) Sink {
+	return SinkFunc(func(ctx context.Context, event *Event) error {
+		body, err := Marshal(event)
+		if err != nil {
+			return err
+		}
+		return sender.SendMessage(ctx, queueURL, string(body), partitionKey(event), event.ID)
+	})
+}
+
+func partitionKey(event *Event) string {
+	if len(event.Tenant) > 0 {
+		return event.Tenant + "/" + event.ResourceID
+	}
+	return event.ResourceID
+}
@@ -0,0 +1,55 @@
+package event
+
+import (
+	"context"
+	"github.com/imulab/go-scim/pkg/v2/db"
+	"github.com/imulab/go-scim/pkg/v2/spec"
+	"github.com/imulab/go-scim/pkg/v2/tenant"
+	"github.com/satori/go.uuid"
+)
+
+// ChangeEvents returns the function to subscribe to the changes of a db.ChangeStreamDB of the resource type with (see
+// db.Subscribe), which publishes an event for every change to the sink, usually an Outbox. Unlike the events of
+// service.EventInterceptor, these cover the changes made by any process writing to the database, and only those
+// committed. Inserts are published as the create operation, updates as replace, since patches are stored as
+// replacements, and deletes as delete; Diff is never set.
+//
+// Events of changes with a version are identified by the tenant, id, type and version of the change, so that consumers
+// discard the changes notified more than once (see db.ChangeStreamDB). The tenant is that of the context the changes
+// are subscribed with.
+func ChangeEvents(resourceType *spec.ResourceType, sink Sink) func(ctx context.Context, change *db.Change) error {
+	return func(ctx context.Context, change *db.Change) error {
+		e := &Event{
+			ID:           uuid.NewV4().String(),
+			Tenant:       tenant.From(ctx),
+			ResourceType: resourceType.ID(),
+			ResourceID:   change.ID,
+			Endpoint:     resourceType.Endpoint(),
+			Version:      change.Version,
+			Time:         change.Time.UTC(),
+		}
+		if len(change.Version) > 0 {
+			e.ID = partitionKey(e) + ":" + change.Type + ":" + change.Version
+		}
+
+		switch change.Type {
+		case db.ChangeInsert:
+			e.Operation = "create"
+		case db.ChangeUpdate:
+			e.Operation = "replace"
+		case db.ChangeDelete:
+			e.Operation = "delete"
+			e.Version = ""
+		}
+
+		if change.Resource != nil {
+			if nav := change.Resource.Navigator().Dot("active"); !nav.HasError() {
+				if active, ok := nav.Current().Raw().(bool); ok {
+					e.Active = &active
+				}
+			}
+		}
+
+		return sink.Publish(ctx, e)
+	}
+}
@@ -0,0 +1,125 @@
+package event
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/imulab/go-scim/pkg/v2/db"
+	"github.com/imulab/go-scim/pkg/v2/prop"
+	"github.com/imulab/go-scim/pkg/v2/spec"
+	"github.com/imulab/go-scim/pkg/v2/tenant"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"testing"
+	"time"
+)
+
+func TestChangeEvents(t *testing.T) {
+	var (
+		resourceType = userResourceType(t)
+		database     = db.Memory()
+		events       = make(chan *Event, 10)
+		done         = make(chan error, 1)
+	)
+	ctx, cancel := context.WithCancel(tenant.With(context.Background(), "acme"))
+	defer cancel()
+	go func() {
+		done <- db.Subscribe(ctx, database, ChangeEvents(resourceType, ChannelSink(events)))
+	}()
+
+	user := func(id string, version string, active bool) *prop.Resource {
+		r := prop.NewResource(resourceType)
+		require.Nil(t, r.Navigator().Replace(map[string]interface{}{
+			"id":       id,
+			"userName": id,
+			"active":   active,
+			"meta":     map[string]interface{}{"version": version},
+		}).Error())
+		return r
+	}
+
+	// wait for the subscription, by writing until the first change is notified
+	for i := 0; ; i++ {
+		require.Nil(t, database.Insert(ctx, user(fmt.Sprintf("probe%d", i), "v1", true)))
+		select {
+		case <-events:
+		case <-time.After(10 * time.Millisecond):
+			continue
+		}
+		break
+	}
+
+	v1 := user("user001", "v1", true)
+	require.Nil(t, database.Insert(ctx, v1))
+	assert.NotNil(t, db.WithTx(ctx, database, func(ctx context.Context) error {
+		if err := database.Replace(ctx, v1, user("user001", "v2", false)); err != nil {
+			return err
+		}
+		return errors.New("rollback")
+	}))
+	v3 := user("user001", "v3", false)
+	require.Nil(t, db.WithTx(ctx, database, func(ctx context.Context) error {
+		return database.Replace(ctx, v1, v3)
+	}))
+	require.Nil(t, database.Delete(ctx, v3))
+
+	next := func() *Event {
+		select {
+		case e := <-events:
+			return e
+		case <-time.After(time.Second):
+			require.Fail(t, "no event")
+			return nil
+		}
+	}
+
+	created := next()
+	assert.Equal(t, "acme/user001:insert:v1", created.ID)
+	assert.Equal(t, "acme", created.Tenant)
+	assert.Equal(t, "User", created.ResourceType)
+	assert.Equal(t, "/Users", created.Endpoint)
+	assert.Equal(t, "create", created.Operation)
+	assert.Equal(t, "v1", created.Version)
+	require.NotNil(t, created.Active)
+	assert.True(t, *created.Active)
+
+	// changes rolled back are not notified
+	replaced := next()
+	assert.Equal(t, "acme/user001:update:v3", replaced.ID)
+	assert.Equal(t, "replace", replaced.Operation)
+	assert.Equal(t, "v3", replaced.Version)
+	require.NotNil(t, replaced.Active)
+	assert.False(t, *replaced.Active)
+
+	deleted := next()
+	assert.Equal(t, "acme/user001:delete:v3", deleted.ID)
+	assert.Equal(t, "delete", deleted.Operation)
+	assert.Empty(t, deleted.Version)
+	assert.Nil(t, deleted.Active)
+
+	cancel()
+	assert.Equal(t, context.Canceled, <-done)
+	assert.Empty(t, events)
+}
+
+func userResourceType(t *testing.T) *spec.ResourceType {
+	for _, path := range []string{
+		"../../../public/schemas/core_schema.json",
+		"../../../public/schemas/user_schema.json",
+		"../../../public/schemas/user_enterprise_extension_schema.json",
+	} {
+		raw, err := ioutil.ReadFile(path)
+		require.Nil(t, err)
+		schema := new(spec.Schema)
+		require.Nil(t, json.Unmarshal(raw, schema))
+		spec.Schemas().Register(schema)
+	}
+
+	raw, err := ioutil.ReadFile("../../../public/resource_types/user_resource_type.json")
+	require.Nil(t, err)
+	resourceType := new(spec.ResourceType)
+	require.Nil(t, json.Unmarshal(raw, resourceType))
+	return resourceType
+}
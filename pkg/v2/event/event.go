@@ -0,0 +1,57 @@
+// This package defines the events emitted for the changes made to resources, and the sinks they are published to, so
+// that downstream systems can be kept in sync. Events are usually emitted by service.EventInterceptor, either straight
+// to a sink, or to an Outbox from which they are relayed to the sink (see Relay), or from the changes notified by the
+// databases (see ChangeEvents). Besides message brokers, events can be delivered to webhooks (see WebhookSink), and as
+// Security Event Tokens (see SETIssuer).
+package event
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+)
+
+// Event describes a change successfully made to a resource.
+type Event struct {
+	ID           string    `json:"id"` // unique id of the event, so that consumers can discard events delivered twice
+	Tenant       string    `json:"tenant,omitempty"`
+	ResourceType string    `json:"resourceType"`
+	ResourceID   string    `json:"resourceId"`
+	Endpoint     string    `json:"endpoint"`          // endpoint of the resource type, i.e. /Users
+	Operation    string    `json:"operation"`         // operation that changed the resource, i.e. create, replace, patch, delete
+	Version      string    `json:"version,omitempty"` // meta.version of the resource after the change, if any
+	Diff         []string  `json:"diff,omitempty"`    // paths of the attributes changed, for replace and patch operations
+	Active       *bool     `json:"active,omitempty"`  // value of the active attribute after the change, for resources having one
+	Time         time.Time `json:"time"`
+}
+
+// Sink receives the events published.
+type Sink interface {
+	// Publish the event. Once Publish has returned without error, the event is considered delivered.
+	Publish(ctx context.Context, event *Event) error
+}
+
+// SinkFunc adapts a function to Sink.
+type SinkFunc func(ctx context.Context, event *Event) error
+
+func (f SinkFunc) Publish(ctx context.Context, event *Event) error {
+	return f(ctx, event)
+}
+
+// ChannelSink returns a Sink that sends the events to the channel, blocking until the channel accepts the event or the
+// context is done, in which case the error of the context is returned.
+func ChannelSink(ch chan<- *Event) Sink {
+	return SinkFunc(func(ctx context.Context, event *Event) error {
+		select {
+		case ch <- event:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	})
+}
+
+// Marshal returns the JSON encoding of the event, as published by the message broker adapters.
+func Marshal(event *Event) ([]byte, error) {
+	return json.Marshal(event)
+}
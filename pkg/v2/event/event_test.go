@@ -0,0 +1,126 @@
+package event
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestChannelSink(t *testing.T) {
+	ch := make(chan *Event, 1)
+	sink := ChannelSink(ch)
+
+	assert.Nil(t, sink.Publish(context.Background(), &Event{ID: "1"}))
+	assert.Equal(t, "1", (<-ch).ID)
+
+	// blocks on the full channel until the context is done
+	assert.Nil(t, sink.Publish(context.Background(), &Event{ID: "2"}))
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.Equal(t, context.Canceled, sink.Publish(ctx, &Event{ID: "3"}))
+}
+
+func TestAdapters(t *testing.T) {
+	e := &Event{ID: "1", Tenant: "acme", ResourceType: "User", ResourceID: "foo", Operation: "create"}
+
+	t.Run("kafka", func(t *testing.T) {
+		producer := &testProducer{}
+		require.Nil(t, KafkaSink(producer, "scim").Publish(context.Background(), e))
+		assert.Equal(t, "scim", producer.topic)
+		assert.Equal(t, "acme/foo", string(producer.key))
+		assertEvent(t, e, producer.value)
+	})
+
+	t.Run("nats", func(t *testing.T) {
+		publisher := &testPublisher{}
+		require.Nil(t, NATSSink(publisher, "scim.events").Publish(context.Background(), e))
+		assert.Equal(t, "scim.events.User", publisher.subject)
+		assertEvent(t, e, publisher.data)
+	})
+
+	t.Run("sqs", func(t *testing.T) {
+		sender := &testSender{}
+		require.Nil(t, SQSSink(sender, "https://sqs/queue").Publish(context.Background(), e))
+		assert.Equal(t, "https://sqs/queue", sender.queueURL)
+		assert.Equal(t, "acme/foo", sender.groupID)
+		assert.Equal(t, "1", sender.deduplicationID)
+		assertEvent(t, e, []byte(sender.body))
+	})
+}
+
+func TestRelay(t *testing.T) {
+	var (
+		ctx      = context.Background()
+		outbox   = MemoryOutbox()
+		received []string
+		failing  = true
+		sink     = SinkFunc(func(_ context.Context, event *Event) error {
+			if failing && event.ID == "2" {
+				return errors.New("unavailable")
+			}
+			received = append(received, event.ID)
+			return nil
+		})
+	)
+	for _, id := range []string{"1", "2", "3"} {
+		require.Nil(t, outbox.Publish(ctx, &Event{ID: id}))
+	}
+
+	n, err := Relay(ctx, outbox, sink, 2)
+	assert.NotNil(t, err)
+	assert.Equal(t, 1, n)
+	pending, err := outbox.Pending(ctx, 10)
+	require.Nil(t, err)
+	assert.Len(t, pending, 2)
+
+	failing = false
+	n, err = Relay(ctx, outbox, sink, 2)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, n)
+	assert.Equal(t, []string{"1", "2", "3"}, received)
+	pending, err = outbox.Pending(ctx, 10)
+	require.Nil(t, err)
+	assert.Empty(t, pending)
+}
+
+func assertEvent(t *testing.T, expect *Event, raw []byte) {
+	actual := new(Event)
+	require.Nil(t, json.Unmarshal(raw, actual))
+	assert.Equal(t, expect, actual)
+}
+
+type testProducer struct {
+	topic string
+	key   []byte
+	value []byte
+}
+
+func (p *testProducer) Produce(_ context.Context, topic string, key []byte, value []byte) error {
+	p.topic, p.key, p.value = topic, key, value
+	return nil
+}
+
+type testPublisher struct {
+	subject string
+	data    []byte
+}
+
+func (p *testPublisher) Publish(subject string, data []byte) error {
+	p.subject, p.data = subject, data
+	return nil
+}
+
+type testSender struct {
+	queueURL        string
+	body            string
+	groupID         string
+	deduplicationID string
+}
+
+func (s *testSender) SendMessage(_ context.Context, queueURL string, body string, groupID string, deduplicationID string) error {
+	s.queueURL, s.body, s.groupID, s.deduplicationID = queueURL, body, groupID, deduplicationID
+	return nil
+}
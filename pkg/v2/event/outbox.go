@@ -0,0 +1,115 @@
+package event
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Outbox stores events until they are relayed to a sink (see Relay), so that events survive failures of the sink, and
+// may be stored along with the change of the resource, by databases able to do so. As a Sink, it appends the events
+// published to it.
+type Outbox interface {
+	Sink
+	// Pending returns at most max events not yet acknowledged, oldest first.
+	Pending(ctx context.Context, max int) ([]*Event, error)
+	// Ack removes the events with the ids from the outbox, once they are delivered.
+	Ack(ctx context.Context, ids ...string) error
+}
+
+// MemoryOutbox returns a memory implementation of Outbox. Like db.Memory, it is only intended for testing and
+// showcasing purposes, as events are lost when the process exits.
+func MemoryOutbox() Outbox {
+	return &memoryOutbox{}
+}
+
+type memoryOutbox struct {
+	sync.Mutex
+	events []*Event
+}
+
+func (m *memoryOutbox) Publish(_ context.Context, event *Event) error {
+	m.Lock()
+	defer m.Unlock()
+
+	m.events = append(m.events, event)
+	return nil
+}
+
+func (m *memoryOutbox) Pending(_ context.Context, max int) ([]*Event, error) {
+	m.Lock()
+	defer m.Unlock()
+
+	if max > len(m.events) {
+		max = len(m.events)
+	}
+	events := make([]*Event, max)
+	copy(events, m.events)
+	return events, nil
+}
+
+func (m *memoryOutbox) Ack(_ context.Context, ids ...string) error {
+	m.Lock()
+	defer m.Unlock()
+
+	acked := make(map[string]struct{}, len(ids))
+	for _, id := range ids {
+		acked[id] = struct{}{}
+	}
+	remaining := m.events[:0]
+	for _, event := range m.events {
+		if _, ok := acked[event.ID]; !ok {
+			remaining = append(remaining, event)
+		}
+	}
+	for i := len(remaining); i < len(m.events); i++ {
+		m.events[i] = nil
+	}
+	m.events = remaining
+	return nil
+}
+
+// Relay publishes the events pending in the outbox to the sink, oldest first and batch at a time, until the outbox is
+// drained or the sink fails, and returns the number of events delivered. Delivered events are acknowledged, hence
+// removed from the outbox. Since an event may be delivered but not acknowledged, i.e. when the process exits in
+// between, events are delivered at least once, and consumers may discard duplicates by their id.
+func Relay(ctx context.Context, outbox Outbox, sink Sink, batch int) (int, error) {
+	if batch < 1 {
+		batch = 100
+	}
+
+	delivered := 0
+	for {
+		events, err := outbox.Pending(ctx, batch)
+		if err != nil || len(events) == 0 {
+			return delivered, err
+		}
+		for _, event := range events {
+			if err := sink.Publish(ctx, event); err != nil {
+				return delivered, err
+			}
+			if err := outbox.Ack(ctx, event.ID); err != nil {
+				return delivered, err
+			}
+			delivered++
+		}
+	}
+}
+
+// RelayEvery calls Relay at every interval until the context is done. Errors of Relay are passed to onError, which may
+// be nil, and the events not delivered are retried at the next interval.
+func RelayEvery(ctx context.Context, outbox Outbox, sink Sink, interval time.Duration, onError func(err error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := Relay(ctx, outbox, sink, 0); err != nil && onError != nil {
+				onError(err)
+			}
+		}
+	}
+}
@@ -0,0 +1,182 @@
+package event
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Types of the Security Event Tokens issued for the events, as defined by the SCIM events draft
+// (draft-ietf-scim-events).
+const (
+	SETTypeCreate     = "urn:ietf:params:SCIM:event:prov:create:notice"
+	SETTypeReplace    = "urn:ietf:params:SCIM:event:prov:put:notice"
+	SETTypePatch      = "urn:ietf:params:SCIM:event:prov:patch:notice"
+	SETTypeDelete     = "urn:ietf:params:SCIM:event:prov:delete"
+	SETTypeActivate   = "urn:ietf:params:SCIM:event:misc:activate"
+	SETTypeDeactivate = "urn:ietf:params:SCIM:event:misc:deactivate"
+)
+
+// Media type of Security Event Tokens.
+const SETContentType = "application/secevent+jwt"
+
+// SETSigner signs Security Event Tokens as JSON Web Signatures.
+type SETSigner interface {
+	// Algorithm is the JWS algorithm of the signatures, i.e. RS256.
+	Algorithm() string
+	// KeyID is the id of the key, so that relying parties can select the key to verify the signatures with, or empty.
+	KeyID() string
+	// Sign returns the signature of the JWS signing input.
+	Sign(input []byte) ([]byte, error)
+}
+
+// RS256Signer returns a SETSigner using RSASSA-PKCS1-v1_5 with SHA-256.
+func RS256Signer(key *rsa.PrivateKey, keyID string) SETSigner {
+	return &setSigner{alg: "RS256", kid: keyID, sign: func(digest []byte) ([]byte, error) {
+		return rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest)
+	}}
+}
+
+// ES256Signer returns a SETSigner using ECDSA with the P-256 curve and SHA-256, or an error if the key is of another
+// curve, whose signatures would be of another size.
+func ES256Signer(key *ecdsa.PrivateKey, keyID string) (SETSigner, error) {
+	if key.Curve != elliptic.P256() {
+		return nil, fmt.Errorf("ES256 requires a key of the P-256 curve, not %s", key.Curve.Params().Name)
+	}
+	return &setSigner{alg: "ES256", kid: keyID, sign: func(digest []byte) ([]byte, error) {
+		r, s, err := ecdsa.Sign(rand.Reader, key, digest)
+		if err != nil {
+			return nil, err
+		}
+		// JWS signatures are the concatenation of R and S, each padded to the size of the curve.
+		signature := make([]byte, 64)
+		rb, sb := r.Bytes(), s.Bytes()
+		copy(signature[32-len(rb):32], rb)
+		copy(signature[64-len(sb):], sb)
+		return signature, nil
+	}}, nil
+}
+
+// HS256Signer returns a SETSigner using HMAC with SHA-256, for relying parties sharing the secret.
+func HS256Signer(secret []byte, keyID string) SETSigner {
+	return &setSigner{alg: "HS256", kid: keyID, mac: func(input []byte) []byte {
+		m := hmac.New(sha256.New, secret)
+		m.Write(input)
+		return m.Sum(nil)
+	}}
+}
+
+type setSigner struct {
+	alg  string
+	kid  string
+	sign func(digest []byte) ([]byte, error)
+	mac  func(input []byte) []byte
+}
+
+func (s *setSigner) Algorithm() string {
+	return s.alg
+}
+
+func (s *setSigner) KeyID() string {
+	return s.kid
+}
+
+func (s *setSigner) Sign(input []byte) ([]byte, error) {
+	if s.mac != nil {
+		return s.mac(input), nil
+	}
+	digest := sha256.Sum256(input)
+	return s.sign(digest[:])
+}
+
+// SETIssuer issues signed Security Event Tokens (RFC 8417) for events.
+type SETIssuer struct {
+	// Issuer is the iss claim, usually the base URL of the server.
+	Issuer string
+	// Audience is the aud claim, identifying the relying parties.
+	Audience []string
+	// Signer signs the tokens.
+	Signer SETSigner
+}
+
+// Token returns the signed Security Event Token for the event, whose jti is the id of the event. The token carries
+// the provisioning event of the operation, with the attributes changed for replace and patch operations, so that i.e.
+// changes to the members of a Group are notified by the members attribute. For replace and patch operations changing
+// the active attribute, the token also carries the activate or deactivate event. The subject is identified by its
+// SCIM location in the sub_id claim, i.e. {"format":"scim","uri":"/Users/<id>"}.
+func (i *SETIssuer) Token(event *Event) (string, error) {
+	events := make(map[string]interface{})
+	switch event.Operation {
+	case "create":
+		events[SETTypeCreate] = map[string]interface{}{}
+	case "replace", "patch":
+		typ := SETTypeReplace
+		if event.Operation == "patch" {
+			typ = SETTypePatch
+		}
+		events[typ] = map[string]interface{}{"attributes": event.Diff}
+		if event.Active != nil && contains(event.Diff, "active") {
+			if *event.Active {
+				events[SETTypeActivate] = map[string]interface{}{}
+			} else {
+				events[SETTypeDeactivate] = map[string]interface{}{}
+			}
+		}
+	case "delete":
+		events[SETTypeDelete] = map[string]interface{}{}
+	default:
+		return "", fmt.Errorf("no security event for operation '%s'", event.Operation)
+	}
+
+	claims := map[string]interface{}{
+		"iss":    i.Issuer,
+		"iat":    issuedAt(event).Unix(),
+		"jti":    event.ID,
+		"events": events,
+		"sub_id": map[string]interface{}{
+			"format": "scim",
+			"uri":    event.Endpoint + "/" + event.ResourceID,
+		},
+	}
+	if len(i.Audience) > 0 {
+		claims["aud"] = i.Audience
+	}
+	if len(event.Tenant) > 0 {
+		claims["tenant"] = event.Tenant
+	}
+
+	header := map[string]interface{}{"alg": i.Signer.Algorithm(), "typ": "secevent+jwt"}
+	if kid := i.Signer.KeyID(); len(kid) > 0 {
+		header["kid"] = kid
+	}
+
+	headerJSON, err := json.Marshal(header)
+	if err != nil {
+		return "", err
+	}
+	claimsJSON, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	input := base64.RawURLEncoding.EncodeToString(headerJSON) + "." + base64.RawURLEncoding.EncodeToString(claimsJSON)
+	signature, err := i.Signer.Sign([]byte(input))
+	if err != nil {
+		return "", err
+	}
+	return input + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+func issuedAt(event *Event) time.Time {
+	if event.Time.IsZero() {
+		return time.Now()
+	}
+	return event.Time
+}
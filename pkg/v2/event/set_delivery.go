@@ -0,0 +1,147 @@
+package event
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// SETPushSink returns a Sink that delivers Security Event Tokens for the events to the endpoint of the receiver with
+// push based delivery (RFC 8935). The authorization, if not empty, is sent as the Authorization header, i.e.
+// "Bearer <token>". Events are delivered when the receiver responds with 202; otherwise the error reported by the
+// receiver is returned, so that the event is retried when relayed from an Outbox (see Relay).
+func SETPushSink(issuer *SETIssuer, endpoint string, authorization string, client *http.Client) Sink {
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	return SinkFunc(func(ctx context.Context, event *Event) error {
+		token, err := issuer.Token(event)
+		if err != nil {
+			return err
+		}
+
+		req, err := http.NewRequest(http.MethodPost, endpoint, strings.NewReader(token))
+		if err != nil {
+			return err
+		}
+		req = req.WithContext(ctx)
+		req.Header.Set("Content-Type", SETContentType)
+		req.Header.Set("Accept", "application/json")
+		if len(authorization) > 0 {
+			req.Header.Set("Authorization", authorization)
+		}
+
+		resp, err := client.Do(req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		body, _ := ioutil.ReadAll(resp.Body)
+
+		if resp.StatusCode != http.StatusAccepted {
+			setErr := new(setError)
+			_ = json.Unmarshal(body, setErr)
+			return fmt.Errorf("receiver %s rejected security event %s with status %d: %s %s", endpoint, event.ID,
+				resp.StatusCode, setErr.Err, setErr.Description)
+		}
+		return nil
+	})
+}
+
+// Default maximum number of Security Event Tokens returned to a poll request not specifying maxEvents.
+const defaultMaxEvents = 100
+
+// SETPollHandler returns a http.Handler serving poll based delivery (RFC 8936) of Security Event Tokens for the events
+// pending in the outbox. Events are removed from the outbox once the receiver acknowledges them, or reports an error
+// for them, which is passed to onError, if not nil. Requests are always answered immediately, as allowed by the RFC,
+// hence receivers long polling poll again right away. The handler must be mounted behind the authentication of the
+// receivers, and the outbox must not be relayed to other sinks.
+func SETPollHandler(issuer *SETIssuer, outbox Outbox, onError func(ctx context.Context, jti string, err string, description string)) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			rw.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		poll := new(setPollRequest)
+		if err := json.NewDecoder(r.Body).Decode(poll); err != nil {
+			writeSETPollError(rw, http.StatusBadRequest, "invalid_request", "malformed poll request")
+			return
+		}
+
+		ctx := r.Context()
+		acked := append([]string{}, poll.Ack...)
+		for jti, setErr := range poll.SetErrs {
+			if onError != nil {
+				onError(ctx, jti, setErr.Err, setErr.Description)
+			}
+			acked = append(acked, jti)
+		}
+		if len(acked) > 0 {
+			if err := outbox.Ack(ctx, acked...); err != nil {
+				writeSETPollError(rw, http.StatusInternalServerError, "internal", "failed to acknowledge events")
+				return
+			}
+		}
+
+		max := defaultMaxEvents
+		if poll.MaxEvents != nil {
+			max = *poll.MaxEvents
+		}
+		resp := setPollResponse{Sets: make(map[string]string)}
+		if max > 0 {
+			events, err := outbox.Pending(ctx, max+1)
+			if err != nil {
+				writeSETPollError(rw, http.StatusInternalServerError, "internal", "failed to read events")
+				return
+			}
+			if len(events) > max {
+				events, resp.MoreAvailable = events[:max], true
+			}
+			for _, event := range events {
+				token, err := issuer.Token(event)
+				if err != nil {
+					writeSETPollError(rw, http.StatusInternalServerError, "internal", "failed to issue security event")
+					return
+				}
+				resp.Sets[event.ID] = token
+			}
+		}
+
+		raw, err := json.Marshal(resp)
+		if err != nil {
+			rw.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		rw.Header().Set("Content-Type", "application/json")
+		_, _ = rw.Write(raw)
+	})
+}
+
+type setPollRequest struct {
+	Ack               []string            `json:"ack"`
+	SetErrs           map[string]setError `json:"setErrs"`
+	MaxEvents         *int                `json:"maxEvents"`
+	ReturnImmediately bool                `json:"returnImmediately"`
+}
+
+type setPollResponse struct {
+	Sets          map[string]string `json:"sets"`
+	MoreAvailable bool              `json:"moreAvailable,omitempty"`
+}
+
+type setError struct {
+	Err         string `json:"err"`
+	Description string `json:"description"`
+}
+
+func writeSETPollError(rw http.ResponseWriter, status int, err string, description string) {
+	raw, _ := json.Marshal(setError{Err: err, Description: description})
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(status)
+	_, _ = rw.Write(raw)
+}
@@ -0,0 +1,216 @@
+package event
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestSETIssuer(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.Nil(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.Nil(t, err)
+	ecSigner, err := ES256Signer(ecKey, "")
+	require.Nil(t, err)
+	inactive := false
+
+	tests := []struct {
+		name   string
+		signer SETSigner
+		verify func(t *testing.T, input []byte, signature []byte)
+		event  *Event
+		expect func(t *testing.T, claims map[string]interface{})
+	}{
+		{
+			name:   "user created",
+			signer: RS256Signer(rsaKey, "rsa-1"),
+			verify: func(t *testing.T, input []byte, signature []byte) {
+				digest := sha256.Sum256(input)
+				assert.Nil(t, rsa.VerifyPKCS1v15(&rsaKey.PublicKey, crypto.SHA256, digest[:], signature))
+			},
+			event: &Event{ID: "1", Tenant: "acme", ResourceType: "User", Endpoint: "/Users", ResourceID: "foo", Operation: "create"},
+			expect: func(t *testing.T, claims map[string]interface{}) {
+				assert.Equal(t, "1", claims["jti"])
+				assert.Equal(t, "acme", claims["tenant"])
+				assert.Equal(t, map[string]interface{}{"format": "scim", "uri": "/Users/foo"}, claims["sub_id"])
+				assert.Equal(t, map[string]interface{}{SETTypeCreate: map[string]interface{}{}}, claims["events"])
+			},
+		},
+		{
+			name:   "user deactivated",
+			signer: ecSigner,
+			verify: func(t *testing.T, input []byte, signature []byte) {
+				require.Len(t, signature, 64)
+				digest := sha256.Sum256(input)
+				r, s := new(big.Int).SetBytes(signature[:32]), new(big.Int).SetBytes(signature[32:])
+				assert.True(t, ecdsa.Verify(&ecKey.PublicKey, digest[:], r, s))
+			},
+			event: &Event{ID: "2", ResourceType: "User", Endpoint: "/Users", ResourceID: "foo", Operation: "patch",
+				Diff: []string{"active"}, Active: &inactive},
+			expect: func(t *testing.T, claims map[string]interface{}) {
+				assert.Nil(t, claims["tenant"])
+				assert.Equal(t, map[string]interface{}{
+					SETTypePatch:      map[string]interface{}{"attributes": []interface{}{"active"}},
+					SETTypeDeactivate: map[string]interface{}{},
+				}, claims["events"])
+			},
+		},
+		{
+			name:   "group membership changed",
+			signer: HS256Signer([]byte("s3cr3t"), "hmac-1"),
+			verify: func(t *testing.T, input []byte, signature []byte) {
+				m := hmac.New(sha256.New, []byte("s3cr3t"))
+				m.Write(input)
+				assert.True(t, hmac.Equal(m.Sum(nil), signature))
+			},
+			event: &Event{ID: "3", ResourceType: "Group", Endpoint: "/Groups", ResourceID: "bar", Operation: "replace",
+				Diff: []string{"members"}},
+			expect: func(t *testing.T, claims map[string]interface{}) {
+				assert.Equal(t, map[string]interface{}{"format": "scim", "uri": "/Groups/bar"}, claims["sub_id"])
+				assert.Equal(t, map[string]interface{}{
+					SETTypeReplace: map[string]interface{}{"attributes": []interface{}{"members"}},
+				}, claims["events"])
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			issuer := &SETIssuer{Issuer: "https://scim.example.com", Audience: []string{"https://rp.example.com"}, Signer: test.signer}
+			token, err := issuer.Token(test.event)
+			require.Nil(t, err)
+
+			header, claims, input, signature := parseSET(t, token)
+			assert.Equal(t, test.signer.Algorithm(), header["alg"])
+			assert.Equal(t, "secevent+jwt", header["typ"])
+			if kid := test.signer.KeyID(); len(kid) > 0 {
+				assert.Equal(t, kid, header["kid"])
+			} else {
+				assert.Nil(t, header["kid"])
+			}
+			test.verify(t, input, signature)
+
+			assert.Equal(t, "https://scim.example.com", claims["iss"])
+			assert.Equal(t, []interface{}{"https://rp.example.com"}, claims["aud"])
+			assert.NotNil(t, claims["iat"])
+			test.expect(t, claims)
+		})
+	}
+}
+
+func TestES256Signer(t *testing.T) {
+	for _, curve := range []elliptic.Curve{elliptic.P384(), elliptic.P521()} {
+		key, err := ecdsa.GenerateKey(curve, rand.Reader)
+		require.Nil(t, err)
+		_, err = ES256Signer(key, "")
+		assert.NotNil(t, err, curve.Params().Name)
+	}
+}
+
+func TestSETPushSink(t *testing.T) {
+	var received []string
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, SETContentType, r.Header.Get("Content-Type"))
+		if r.Header.Get("Authorization") != "Bearer t0ken" {
+			rw.WriteHeader(http.StatusBadRequest)
+			_, _ = rw.Write([]byte(`{"err":"authentication_failed","description":"bad token"}`))
+			return
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		received = append(received, string(body))
+		rw.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	issuer := &SETIssuer{Issuer: "https://scim.example.com", Signer: HS256Signer([]byte("s3cr3t"), "")}
+	e := &Event{ID: "1", ResourceType: "User", Endpoint: "/Users", ResourceID: "foo", Operation: "delete"}
+
+	assert.Nil(t, SETPushSink(issuer, server.URL, "Bearer t0ken", nil).Publish(context.Background(), e))
+	require.Len(t, received, 1)
+	_, claims, _, _ := parseSET(t, received[0])
+	assert.Equal(t, "1", claims["jti"])
+
+	err := SETPushSink(issuer, server.URL, "Bearer other", nil).Publish(context.Background(), e)
+	require.NotNil(t, err)
+	assert.Contains(t, err.Error(), "authentication_failed")
+}
+
+func TestSETPollHandler(t *testing.T) {
+	var (
+		ctx     = context.Background()
+		outbox  = MemoryOutbox()
+		issuer  = &SETIssuer{Issuer: "https://scim.example.com", Signer: HS256Signer([]byte("s3cr3t"), "")}
+		errored []string
+		handler = SETPollHandler(issuer, outbox, func(_ context.Context, jti string, err string, _ string) {
+			errored = append(errored, jti+":"+err)
+		})
+	)
+	for _, id := range []string{"1", "2", "3"} {
+		require.Nil(t, outbox.Publish(ctx, &Event{ID: id, ResourceType: "User", Endpoint: "/Users", ResourceID: "foo", Operation: "create"}))
+	}
+
+	poll := func(body string) map[string]interface{} {
+		rw := httptest.NewRecorder()
+		handler.ServeHTTP(rw, httptest.NewRequest(http.MethodPost, "/Events", strings.NewReader(body)))
+		require.Equal(t, http.StatusOK, rw.Code)
+		resp := make(map[string]interface{})
+		require.Nil(t, json.Unmarshal(rw.Body.Bytes(), &resp))
+		return resp
+	}
+
+	resp := poll(`{"maxEvents": 2, "returnImmediately": true}`)
+	assert.Len(t, resp["sets"], 2)
+	assert.Contains(t, resp["sets"], "1")
+	assert.Contains(t, resp["sets"], "2")
+	assert.Equal(t, true, resp["moreAvailable"])
+
+	resp = poll(`{"ack": ["1"], "setErrs": {"2": {"err": "invalid_key", "description": "unknown key"}}, "returnImmediately": true}`)
+	assert.Len(t, resp["sets"], 1)
+	assert.Contains(t, resp["sets"], "3")
+	assert.Nil(t, resp["moreAvailable"])
+	assert.Equal(t, []string{"2:invalid_key"}, errored)
+
+	resp = poll(`{"ack": ["3"], "maxEvents": 0}`)
+	assert.Empty(t, resp["sets"])
+	pending, err := outbox.Pending(ctx, 10)
+	require.Nil(t, err)
+	assert.Empty(t, pending)
+
+	rw := httptest.NewRecorder()
+	handler.ServeHTTP(rw, httptest.NewRequest(http.MethodPost, "/Events", strings.NewReader(`{`)))
+	assert.Equal(t, http.StatusBadRequest, rw.Code)
+}
+
+func parseSET(t *testing.T, token string) (header map[string]interface{}, claims map[string]interface{}, input []byte, signature []byte) {
+	parts := strings.Split(token, ".")
+	require.Len(t, parts, 3)
+
+	decode := func(part string, v interface{}) {
+		raw, err := base64.RawURLEncoding.DecodeString(part)
+		require.Nil(t, err)
+		require.Nil(t, json.NewDecoder(bytes.NewReader(raw)).Decode(v))
+	}
+	decode(parts[0], &header)
+	decode(parts[1], &claims)
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	require.Nil(t, err)
+	return header, claims, []byte(parts[0] + "." + parts[1]), signature
+}
@@ -0,0 +1,176 @@
+package event
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Headers of the webhook requests.
+const (
+	WebhookEventHeader     = "X-Scim-Event"     // id of the event
+	WebhookTimestampHeader = "X-Scim-Timestamp" // unix time in seconds at which the request was signed
+	WebhookSignatureHeader = "X-Scim-Signature" // sha256=<hex of the HMAC-SHA256 of "<timestamp>.<body>">
+)
+
+// Webhook is a URL notified of events by POST requests with the event as JSON body.
+type Webhook struct {
+	// URL to POST events to.
+	URL string
+	// Secret to sign the requests with, if not empty, so that the receiver can verify the requests originate from
+	// the server, and were not replayed long after (see VerifyWebhook).
+	Secret string
+	// ResourceTypes are the ids of the resource types whose events are sent, i.e. User, or all if empty.
+	ResourceTypes []string
+	// Operations are the operations whose events are sent, i.e. create, or all if empty.
+	Operations []string
+}
+
+func (w *Webhook) accepts(event *Event) bool {
+	return (len(w.ResourceTypes) == 0 || contains(w.ResourceTypes, event.ResourceType)) &&
+		(len(w.Operations) == 0 || contains(w.Operations, event.Operation))
+}
+
+// WebhookOptions tune the delivery of webhooks. Zero values use the defaults.
+type WebhookOptions struct {
+	// Client to send the requests with. Defaults to a client with a timeout of 10 seconds.
+	Client *http.Client
+	// Attempts is the maximum number of attempts to deliver an event to a webhook. Defaults to 5.
+	Attempts int
+	// Backoff is the delay before the second attempt, doubled for every attempt after. Defaults to 1 second.
+	Backoff time.Duration
+	// DeadLetter, if not nil, is called with the events that could not be delivered to the webhook in as many
+	// attempts, i.e. to store them for inspection and manual redelivery. Otherwise, the error of the last attempt is
+	// returned.
+	DeadLetter func(ctx context.Context, webhook *Webhook, event *Event, err error)
+}
+
+// WebhookSink returns a Sink that POSTs the events to the webhooks accepting them, one after the other. Responses of
+// status 2xx are considered delivered; the delivery of other responses or failed requests is retried with exponential
+// backoff, and, when retries are exhausted, the event is dead-lettered. Since deliveries block Publish, the sink is
+// better relayed to from an Outbox (see RelayEvery) than published to by the services directly.
+//
+// Publish returns the errors of the webhooks where the event was neither delivered nor dead-lettered, or the error of
+// the context, if it is done while waiting for the next attempt.
+func WebhookSink(webhooks []*Webhook, options WebhookOptions) Sink {
+	if options.Client == nil {
+		options.Client = &http.Client{Timeout: 10 * time.Second}
+	}
+	if options.Attempts < 1 {
+		options.Attempts = 5
+	}
+	if options.Backoff <= 0 {
+		options.Backoff = time.Second
+	}
+	return &webhookSink{webhooks: webhooks, options: options}
+}
+
+type webhookSink struct {
+	webhooks []*Webhook
+	options  WebhookOptions
+}
+
+func (s *webhookSink) Publish(ctx context.Context, event *Event) error {
+	body, err := Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	for _, webhook := range s.webhooks {
+		if !webhook.accepts(event) {
+			continue
+		}
+		if err := s.deliver(ctx, webhook, event, body); err != nil {
+			if ctx.Err() != nil || s.options.DeadLetter == nil {
+				return err
+			}
+			s.options.DeadLetter(ctx, webhook, event, err)
+		}
+	}
+	return nil
+}
+
+func (s *webhookSink) deliver(ctx context.Context, webhook *Webhook, event *Event, body []byte) error {
+	backoff := s.options.Backoff
+	for attempt := 1; ; attempt++ {
+		err := s.post(ctx, webhook, event, body)
+		if err == nil || attempt == s.options.Attempts {
+			return err
+		}
+
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+		backoff *= 2
+	}
+}
+
+func (s *webhookSink) post(ctx context.Context, webhook *Webhook, event *Event, body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, webhook.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(WebhookEventHeader, event.ID)
+	if len(webhook.Secret) > 0 {
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+		req.Header.Set(WebhookTimestampHeader, timestamp)
+		req.Header.Set(WebhookSignatureHeader, "sha256="+signWebhook(webhook.Secret, timestamp, body))
+	}
+
+	resp, err := s.options.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(ioutil.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook %s responded with status %d", webhook.URL, resp.StatusCode)
+	}
+	return nil
+}
+
+// VerifyWebhook reports whether the signature of a webhook request, as found in the WebhookSignatureHeader, was made
+// with the secret over the body and timestamp, as found in the WebhookTimestampHeader, and the timestamp is no older
+// than maxAge, if positive. It is provided for receivers written in Go.
+func VerifyWebhook(secret string, timestamp string, signature string, body []byte, maxAge time.Duration) bool {
+	if maxAge > 0 {
+		signed, err := strconv.ParseInt(timestamp, 10, 64)
+		if err != nil || time.Since(time.Unix(signed, 0)) > maxAge {
+			return false
+		}
+	}
+	expected := "sha256=" + signWebhook(secret, timestamp, body)
+	return hmac.Equal([]byte(expected), []byte(signature))
+}
+
+func signWebhook(secret string, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func contains(values []string, value string) bool {
+	for _, each := range values {
+		if each == value {
+			return true
+		}
+	}
+	return false
+}
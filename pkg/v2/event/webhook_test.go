@@ -0,0 +1,92 @@
+package event
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestWebhookSink(t *testing.T) {
+	var (
+		mu        sync.Mutex
+		requests  = make(map[string]int)
+		verified  = make(map[string]bool)
+		failFirst = 2
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		body, _ := ioutil.ReadAll(r.Body)
+		requests[r.URL.Path]++
+		verified[r.URL.Path] = VerifyWebhook("s3cr3t", r.Header.Get(WebhookTimestampHeader),
+			r.Header.Get(WebhookSignatureHeader), body, time.Minute)
+
+		switch r.URL.Path {
+		case "/flaky":
+			if requests[r.URL.Path] <= failFirst {
+				rw.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+		case "/down":
+			rw.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		rw.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	var deadLettered []string
+	sink := WebhookSink([]*Webhook{
+		{URL: server.URL + "/users", Secret: "s3cr3t", ResourceTypes: []string{"User"}},
+		{URL: server.URL + "/groups", Secret: "s3cr3t", ResourceTypes: []string{"Group"}},
+		{URL: server.URL + "/deletes", Operations: []string{"delete"}},
+		{URL: server.URL + "/flaky", Secret: "s3cr3t"},
+		{URL: server.URL + "/down", Secret: "s3cr3t"},
+	}, WebhookOptions{
+		Attempts: 3,
+		Backoff:  time.Millisecond,
+		DeadLetter: func(_ context.Context, webhook *Webhook, event *Event, err error) {
+			assert.NotNil(t, err)
+			deadLettered = append(deadLettered, webhook.URL)
+		},
+	})
+
+	require.Nil(t, sink.Publish(context.Background(), &Event{ID: "1", ResourceType: "User", ResourceID: "foo", Operation: "create"}))
+
+	assert.Equal(t, 1, requests["/users"])
+	assert.True(t, verified["/users"])
+	assert.Equal(t, 0, requests["/groups"])
+	assert.Equal(t, 0, requests["/deletes"])
+	assert.Equal(t, 3, requests["/flaky"])
+	assert.True(t, verified["/flaky"])
+	assert.Equal(t, 3, requests["/down"])
+	assert.Equal(t, []string{server.URL + "/down"}, deadLettered)
+}
+
+func TestWebhookSinkWithoutDeadLetter(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		rw.WriteHeader(http.StatusBadGateway)
+	}))
+	defer server.Close()
+
+	sink := WebhookSink([]*Webhook{{URL: server.URL}}, WebhookOptions{Attempts: 2, Backoff: time.Millisecond})
+	assert.NotNil(t, sink.Publish(context.Background(), &Event{ID: "1", ResourceType: "User"}))
+}
+
+func TestVerifyWebhook(t *testing.T) {
+	body := []byte(`{"id":"1"}`)
+	now := "1600000000"
+	signature := "sha256=" + signWebhook("s3cr3t", now, body)
+
+	assert.True(t, VerifyWebhook("s3cr3t", now, signature, body, 0))
+	assert.False(t, VerifyWebhook("other", now, signature, body, 0))
+	assert.False(t, VerifyWebhook("s3cr3t", now, signature, []byte(`{"id":"2"}`), 0))
+	assert.False(t, VerifyWebhook("s3cr3t", now, signature, body, time.Minute))
+}
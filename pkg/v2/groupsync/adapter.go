@@ -0,0 +1,210 @@
+package groupsync
+
+import (
+	"context"
+	"github.com/imulab/go-scim/pkg/v2/event"
+)
+
+// The adapters below publish messages, encoded with Marshal, to message brokers, and receive them from the brokers,
+// through minimal interfaces of their clients, as the adapters of the event package do, so that this module does not
+// depend on any particular client library.
+
+// KafkaPublisher returns a Publisher that produces the messages to the Kafka topic. Messages are keyed by the tenant and
+// id of the member, so that the messages of a member are kept in order within their partition.
+func KafkaPublisher(producer event.KafkaProducer, topic string) Publisher {
+	return PublisherFunc(func(ctx context.Context, message *Message) error {
+		value, err := Marshal(message)
+		if err != nil {
+			return err
+		}
+		return producer.Produce(ctx, topic, []byte(message.key()), value)
+	})
+}
+
+// KafkaConsumer fetches the messages of a Kafka topic for a consumer group, i.e. a thin wrapper around FetchMessage and
+// CommitMessages of segmentio/kafka-go Reader. Fetch returns the value of the next message, and the function committing
+// its offset.
+type KafkaConsumer interface {
+	Fetch(ctx context.Context) (value []byte, commit func(ctx context.Context) error, err error)
+}
+
+// KafkaReceiver returns a Receiver that fetches the messages from Kafka, and commits their offset once acknowledged.
+// Since Kafka does not deliver messages again on its own, a message that is not acknowledged is received again, before
+// the messages after it, so that no offset is committed past it.
+func KafkaReceiver(consumer KafkaConsumer) Receiver {
+	return &kafkaReceiver{consumer: consumer}
+}
+
+type kafkaReceiver struct {
+	consumer KafkaConsumer
+	pending  *kafkaDelivery
+}
+
+func (r *kafkaReceiver) Receive(ctx context.Context) (Delivery, error) {
+	if d := r.pending; d != nil {
+		r.pending = nil
+		return d, nil
+	}
+	value, commit, err := r.consumer.Fetch(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &kafkaDelivery{receiver: r, value: value, commit: commit}, nil
+}
+
+type kafkaDelivery struct {
+	receiver *kafkaReceiver
+	value    []byte
+	commit   func(ctx context.Context) error
+}
+
+func (d *kafkaDelivery) Body() []byte {
+	return d.value
+}
+
+func (d *kafkaDelivery) Ack(ctx context.Context) error {
+	return d.commit(ctx)
+}
+
+func (d *kafkaDelivery) Nack(_ context.Context) error {
+	d.receiver.pending = d
+	return nil
+}
+
+// JetStreamProducer publishes messages to NATS JetStream, i.e. a thin wrapper around Publish of nats-io/nats.go
+// jetstream, with the message id set to the Nats-Msg-Id header, which JetStream uses to discard messages published twice.
+// It returns once the message is acknowledged by the stream.
+type JetStreamProducer interface {
+	Publish(ctx context.Context, subject string, data []byte, msgID string) error
+}
+
+// JetStreamPublisher returns a Publisher that publishes the messages to the JetStream subject, with their id as message
+// id.
+func JetStreamPublisher(producer JetStreamProducer, subject string) Publisher {
+	return PublisherFunc(func(ctx context.Context, message *Message) error {
+		data, err := Marshal(message)
+		if err != nil {
+			return err
+		}
+		return producer.Publish(ctx, subject, data, message.ID)
+	})
+}
+
+// JetStreamMessage is a message delivered by JetStream. It is implemented by jetstream.Msg of nats-io/nats.go.
+type JetStreamMessage interface {
+	Data() []byte
+	Ack() error
+	Nak() error
+}
+
+// JetStreamConsumer returns the messages of a durable JetStream consumer with explicit acknowledgements, i.e. a thin
+// wrapper around Next of nats-io/nats.go jetstream.Consumer.
+type JetStreamConsumer interface {
+	Next(ctx context.Context) (JetStreamMessage, error)
+}
+
+// JetStreamReceiver returns a Receiver that receives the messages from the JetStream consumer, acknowledging them with
+// Ack, or Nak, which has JetStream deliver them again.
+func JetStreamReceiver(consumer JetStreamConsumer) Receiver {
+	return &jetStreamReceiver{consumer: consumer}
+}
+
+type jetStreamReceiver struct {
+	consumer JetStreamConsumer
+}
+
+func (r *jetStreamReceiver) Receive(ctx context.Context) (Delivery, error) {
+	msg, err := r.consumer.Next(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &jetStreamDelivery{msg: msg}, nil
+}
+
+type jetStreamDelivery struct {
+	msg JetStreamMessage
+}
+
+func (d *jetStreamDelivery) Body() []byte {
+	return d.msg.Data()
+}
+
+func (d *jetStreamDelivery) Ack(_ context.Context) error {
+	return d.msg.Ack()
+}
+
+func (d *jetStreamDelivery) Nack(_ context.Context) error {
+	return d.msg.Nak()
+}
+
+// SQSPublisher returns a Publisher that sends the messages to the SQS queue. For FIFO queues, messages are grouped by
+// the tenant and id of the member, so that the messages of a member are kept in order, and deduplicated by their id.
+func SQSPublisher(sender event.SQSSender, queueURL string) Publisher {
+	return PublisherFunc(func(ctx context.Context, message *Message) error {
+		body, err := Marshal(message)
+		if err != nil {
+			return err
+		}
+		return sender.SendMessage(ctx, queueURL, string(body), message.key(), message.ID)
+	})
+}
+
+// SQSMessage is a message received from an SQS queue.
+type SQSMessage struct {
+	Body          string
+	ReceiptHandle string
+}
+
+// SQSConsumer receives and deletes the messages of SQS queues, i.e. a thin wrapper around ReceiveMessage, with long
+// polling, and DeleteMessage of aws-sdk-go.
+type SQSConsumer interface {
+	// ReceiveMessages returns up to max messages of the queue, or none once the wait time of long polling elapsed.
+	ReceiveMessages(ctx context.Context, queueURL string, max int) ([]SQSMessage, error)
+	DeleteMessage(ctx context.Context, queueURL string, receiptHandle string) error
+}
+
+// SQSReceiver returns a Receiver that receives the messages from the SQS queue, up to ten at a time, and deletes them
+// once acknowledged. Messages that are not acknowledged are delivered again by SQS once their visibility timeout
+// expired.
+func SQSReceiver(consumer SQSConsumer, queueURL string) Receiver {
+	return &sqsReceiver{consumer: consumer, queueURL: queueURL}
+}
+
+type sqsReceiver struct {
+	consumer SQSConsumer
+	queueURL string
+	buffer   []SQSMessage
+}
+
+func (r *sqsReceiver) Receive(ctx context.Context) (Delivery, error) {
+	for len(r.buffer) == 0 {
+		messages, err := r.consumer.ReceiveMessages(ctx, r.queueURL, 10)
+		if err != nil {
+			return nil, err
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		r.buffer = messages
+	}
+	message := r.buffer[0]
+	r.buffer = r.buffer[1:]
+	return &sqsDelivery{receiver: r, message: message}, nil
+}
+
+type sqsDelivery struct {
+	receiver *sqsReceiver
+	message  SQSMessage
+}
+
+func (d *sqsDelivery) Body() []byte {
+	return []byte(d.message.Body)
+}
+
+func (d *sqsDelivery) Ack(ctx context.Context) error {
+	return d.receiver.consumer.DeleteMessage(ctx, d.receiver.queueURL, d.message.ReceiptHandle)
+}
+
+func (d *sqsDelivery) Nack(_ context.Context) error {
+	return nil
+}
@@ -0,0 +1,204 @@
+package groupsync
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestPublishers(t *testing.T) {
+	m := &Message{ID: "1", Tenant: "acme", GroupID: "g1", MemberID: "u1"}
+
+	t.Run("kafka", func(t *testing.T) {
+		producer := &testProducer{}
+		require.Nil(t, KafkaPublisher(producer, "group_sync").Publish(context.Background(), m))
+		assert.Equal(t, "group_sync", producer.topic)
+		assert.Equal(t, "acme/u1", string(producer.key))
+		assertMessage(t, m, producer.value)
+	})
+
+	t.Run("jetstream", func(t *testing.T) {
+		producer := &testJetStreamProducer{}
+		require.Nil(t, JetStreamPublisher(producer, "scim.group_sync").Publish(context.Background(), m))
+		assert.Equal(t, "scim.group_sync", producer.subject)
+		assert.Equal(t, "1", producer.msgID)
+		assertMessage(t, m, producer.data)
+	})
+
+	t.Run("sqs", func(t *testing.T) {
+		sender := &testSender{}
+		require.Nil(t, SQSPublisher(sender, "https://sqs/queue").Publish(context.Background(), m))
+		assert.Equal(t, "https://sqs/queue", sender.queueURL)
+		assert.Equal(t, "acme/u1", sender.groupID)
+		assert.Equal(t, "1", sender.deduplicationID)
+		assertMessage(t, m, []byte(sender.body))
+	})
+}
+
+func TestReceivers(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("kafka", func(t *testing.T) {
+		consumer := &testKafkaConsumer{values: []string{"1", "2"}}
+		receiver := KafkaReceiver(consumer)
+
+		d, err := receiver.Receive(ctx)
+		require.Nil(t, err)
+		assert.Equal(t, "1", string(d.Body()))
+		require.Nil(t, d.Nack(ctx))
+
+		// received again before the next message
+		d, err = receiver.Receive(ctx)
+		require.Nil(t, err)
+		assert.Equal(t, "1", string(d.Body()))
+		require.Nil(t, d.Ack(ctx))
+		d, err = receiver.Receive(ctx)
+		require.Nil(t, err)
+		assert.Equal(t, "2", string(d.Body()))
+		require.Nil(t, d.Ack(ctx))
+		assert.Equal(t, []string{"1", "2"}, consumer.committed)
+
+		_, err = receiver.Receive(ctx)
+		assert.NotNil(t, err)
+	})
+
+	t.Run("jetstream", func(t *testing.T) {
+		msg := &testJetStreamMessage{data: "1"}
+		receiver := JetStreamReceiver(testJetStreamConsumer{msg})
+
+		d, err := receiver.Receive(ctx)
+		require.Nil(t, err)
+		assert.Equal(t, "1", string(d.Body()))
+		require.Nil(t, d.Nack(ctx))
+		require.Nil(t, d.Ack(ctx))
+		assert.Equal(t, []string{"nak", "ack"}, msg.acks)
+	})
+
+	t.Run("sqs", func(t *testing.T) {
+		consumer := &testSQSConsumer{batches: [][]SQSMessage{
+			{},
+			{{Body: "1", ReceiptHandle: "h1"}, {Body: "2", ReceiptHandle: "h2"}},
+		}}
+		receiver := SQSReceiver(consumer, "https://sqs/queue")
+
+		// empty batches of long polling are skipped
+		d, err := receiver.Receive(ctx)
+		require.Nil(t, err)
+		assert.Equal(t, "1", string(d.Body()))
+		require.Nil(t, d.Nack(ctx))
+		d, err = receiver.Receive(ctx)
+		require.Nil(t, err)
+		assert.Equal(t, "2", string(d.Body()))
+		require.Nil(t, d.Ack(ctx))
+		assert.Equal(t, []string{"h2"}, consumer.deleted)
+		assert.Equal(t, 10, consumer.max)
+	})
+}
+
+func assertMessage(t *testing.T, expect *Message, raw []byte) {
+	actual := new(Message)
+	require.Nil(t, json.Unmarshal(raw, actual))
+	assert.Equal(t, expect, actual)
+}
+
+type testProducer struct {
+	topic string
+	key   []byte
+	value []byte
+}
+
+func (p *testProducer) Produce(_ context.Context, topic string, key []byte, value []byte) error {
+	p.topic, p.key, p.value = topic, key, value
+	return nil
+}
+
+type testJetStreamProducer struct {
+	subject string
+	data    []byte
+	msgID   string
+}
+
+func (p *testJetStreamProducer) Publish(_ context.Context, subject string, data []byte, msgID string) error {
+	p.subject, p.data, p.msgID = subject, data, msgID
+	return nil
+}
+
+type testSender struct {
+	queueURL        string
+	body            string
+	groupID         string
+	deduplicationID string
+}
+
+func (s *testSender) SendMessage(_ context.Context, queueURL string, body string, groupID string, deduplicationID string) error {
+	s.queueURL, s.body, s.groupID, s.deduplicationID = queueURL, body, groupID, deduplicationID
+	return nil
+}
+
+type testKafkaConsumer struct {
+	values    []string
+	committed []string
+}
+
+func (c *testKafkaConsumer) Fetch(_ context.Context) ([]byte, func(ctx context.Context) error, error) {
+	if len(c.values) == 0 {
+		return nil, nil, errors.New("no more messages")
+	}
+	value := c.values[0]
+	c.values = c.values[1:]
+	return []byte(value), func(_ context.Context) error {
+		c.committed = append(c.committed, value)
+		return nil
+	}, nil
+}
+
+type testJetStreamMessage struct {
+	data string
+	acks []string
+}
+
+func (m *testJetStreamMessage) Data() []byte {
+	return []byte(m.data)
+}
+
+func (m *testJetStreamMessage) Ack() error {
+	m.acks = append(m.acks, "ack")
+	return nil
+}
+
+func (m *testJetStreamMessage) Nak() error {
+	m.acks = append(m.acks, "nak")
+	return nil
+}
+
+type testJetStreamConsumer struct {
+	msg JetStreamMessage
+}
+
+func (c testJetStreamConsumer) Next(_ context.Context) (JetStreamMessage, error) {
+	return c.msg, nil
+}
+
+type testSQSConsumer struct {
+	batches [][]SQSMessage
+	deleted []string
+	max     int
+}
+
+func (c *testSQSConsumer) ReceiveMessages(_ context.Context, _ string, max int) ([]SQSMessage, error) {
+	c.max = max
+	if len(c.batches) == 0 {
+		return nil, errors.New("no more messages")
+	}
+	batch := c.batches[0]
+	c.batches = c.batches[1:]
+	return batch, nil
+}
+
+func (c *testSQSConsumer) DeleteMessage(_ context.Context, _ string, receiptHandle string) error {
+	c.deleted = append(c.deleted, receiptHandle)
+	return nil
+}
@@ -0,0 +1,126 @@
+package groupsync
+
+import (
+	"context"
+	"errors"
+	"github.com/imulab/go-scim/pkg/v2/db"
+	"github.com/imulab/go-scim/pkg/v2/prop"
+	"github.com/imulab/go-scim/pkg/v2/spec"
+	"github.com/imulab/go-scim/pkg/v2/tenant"
+)
+
+// RefFilter filters a resource with reference to its state before a change. It is implemented by the ByResource
+// filters of the service/filter package, i.e. filter.MetaFilter.
+type RefFilter interface {
+	FilterRef(ctx context.Context, resource *prop.Resource, ref *prop.Resource) error
+}
+
+// ApplierOptions are the options of NewApplier.
+type ApplierOptions struct {
+	// Filters are applied to the users whose "groups" changed, before they are replaced, i.e. filter.MetaFilter to
+	// update their meta.
+	Filters []RefFilter
+	// Publisher, if not nil, publishes a message for every member of the group that is the member of a message, as the
+	// "groups" of the members of a group change with those of the group. Otherwise, the members are applied in turn by
+	// the same call to Apply, which may take long for large groups.
+	Publisher Publisher
+}
+
+// NewApplier returns an Applier that replaces the users of the database with their "groups" synchronized by the sync
+// service.
+func NewApplier(userDB db.DB, groups *SyncService, options ApplierOptions) *Applier {
+	return &Applier{userDB: userDB, groups: groups, options: options}
+}
+
+// Applier applies messages (see Message) to the users.
+type Applier struct {
+	userDB  db.DB
+	groups  *SyncService
+	options ApplierOptions
+}
+
+// Apply synchronizes the "groups" of the member of the message, if it is a user (see SyncService), and replaces the user
+// if it changed. If the member is a group, the members of the group are applied in turn, or published (see
+// ApplierOptions), up to the maximum depth of the sync service, and except those already expanded through the groups
+// of the message, or the group itself. Members that are neither, i.e. deleted since, are ignored.
+//
+// Applying a message more than once has no effect, as the state of the users only depends on the current state of the
+// groups; the users are only replaced if their "groups" changed, unless they were deleted meanwhile. An error is
+// returned if the message could not be applied, i.e. due to a concurrent change to the user (see spec.ErrConflict), in
+// which case it shall be applied again.
+func (a *Applier) Apply(ctx context.Context, message *Message) error {
+	if len(message.Tenant) > 0 {
+		ctx = tenant.With(ctx, message.Tenant)
+	}
+	return a.apply(ctx, message)
+}
+
+func (a *Applier) apply(ctx context.Context, message *Message) error {
+	user, err := a.userDB.Get(ctx, message.MemberID, nil)
+	if err == nil {
+		return a.sync(ctx, user)
+	}
+	if !errors.Is(err, spec.ErrNotFound) {
+		return err
+	}
+
+	group, err := a.groups.groupDB.Get(ctx, message.MemberID, nil)
+	if err != nil {
+		if errors.Is(err, spec.ErrNotFound) {
+			return nil
+		}
+		return err
+	}
+	if len(message.Via) >= a.groups.maxDepth() {
+		return nil
+	}
+
+	expanded := map[string]struct{}{message.GroupID: {}, message.MemberID: {}}
+	for _, id := range message.Via {
+		expanded[id] = struct{}{}
+	}
+	for member := range memberIds(group) {
+		if _, ok := expanded[member]; ok {
+			continue
+		}
+		if a.options.Publisher != nil {
+			err = a.options.Publisher.Publish(ctx, message.expand(member))
+		} else {
+			err = a.apply(ctx, message.expand(member))
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (a *Applier) sync(ctx context.Context, user *prop.Resource) error {
+	ref := user.Clone()
+	if err := a.groups.SyncGroupPropertyForUser(ctx, user); err != nil {
+		return err
+	}
+	if user.Hash() == ref.Hash() {
+		return nil
+	}
+	for _, f := range a.options.Filters {
+		if err := f.FilterRef(ctx, user, ref); err != nil {
+			return err
+		}
+	}
+	if err := a.userDB.Replace(ctx, ref, user); err != nil && !errors.Is(err, spec.ErrNotFound) {
+		return err
+	}
+	// the user was deleted since, hence has no groups to synchronize
+	return nil
+}
+
+// Returns the ids of the members of the group.
+func memberIds(group *prop.Resource) map[string]struct{} {
+	ids := map[string]struct{}{}
+	_ = forEachMember(group, func(_ prop.Navigator, id string) error {
+		ids[id] = struct{}{}
+		return nil
+	})
+	return ids
+}
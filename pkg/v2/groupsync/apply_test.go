@@ -0,0 +1,438 @@
+package groupsync
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/imulab/go-scim/pkg/v2/crud"
+	"github.com/imulab/go-scim/pkg/v2/db"
+	"github.com/imulab/go-scim/pkg/v2/prop"
+	"github.com/imulab/go-scim/pkg/v2/spec"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"io/ioutil"
+	"os"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestApplier(t *testing.T) {
+	s := new(ApplierTestSuite)
+	suite.Run(t, s)
+}
+
+type ApplierTestSuite struct {
+	suite.Suite
+	userResourceType  *spec.ResourceType
+	groupResourceType *spec.ResourceType
+}
+
+// Returns the user and group databases, where u1 is a member of g1, which is a member of g2 along with u2, and g3 has
+// g2 and itself as members.
+func (s *ApplierTestSuite) databases(t *testing.T) (db.DB, db.DB) {
+	userDB, groupDB := db.Memory(), db.Memory()
+	for _, id := range []string{"u1", "u2", "u3"} {
+		u := prop.NewResource(s.userResourceType)
+		require.False(t, u.Navigator().Replace(map[string]interface{}{
+			"schemas":  []interface{}{"urn:ietf:params:scim:schemas:core:2.0:User"},
+			"id":       id,
+			"userName": id,
+		}).HasError())
+		require.Nil(t, userDB.Insert(context.Background(), u))
+	}
+	for id, members := range map[string][]string{
+		"g1": {"u1"},
+		"g2": {"g1", "u2"},
+		"g3": {"g2", "g3"},
+	} {
+		var values []interface{}
+		for _, member := range members {
+			values = append(values, map[string]interface{}{"value": member})
+		}
+		g := prop.NewResource(s.groupResourceType)
+		require.False(t, g.Navigator().Replace(map[string]interface{}{
+			"schemas":     []interface{}{"urn:ietf:params:scim:schemas:core:2.0:Group"},
+			"id":          id,
+			"displayName": id,
+			"members":     values,
+		}).HasError())
+		require.Nil(t, groupDB.Insert(context.Background(), g))
+	}
+	return userDB, groupDB
+}
+
+// Returns the ids of the groups of the user.
+func (s *ApplierTestSuite) groupsOf(t *testing.T, userDB db.DB, id string) []string {
+	user, err := userDB.Get(context.Background(), id, nil)
+	require.Nil(t, err)
+	var groups []string
+	_ = user.Navigator().Dot("groups").ForEachChild(func(_ int, child prop.Property) error {
+		value, _ := child.ChildAtIndex("value")
+		groups = append(groups, value.Raw().(string))
+		return nil
+	})
+	sort.Strings(groups)
+	return groups
+}
+
+func (s *ApplierTestSuite) TestApply() {
+	userDB, groupDB := s.databases(s.T())
+	replaced := 0
+	applier := NewApplier(userDB, NewSyncService(groupDB), ApplierOptions{
+		Filters: []RefFilter{refFilterFunc(func(_ context.Context, _ *prop.Resource, _ *prop.Resource) error {
+			replaced++
+			return nil
+		})},
+	})
+
+	require.Nil(s.T(), applier.Apply(context.Background(), &Message{ID: "1", GroupID: "g1", MemberID: "u1"}))
+	assert.Equal(s.T(), []string{"g1", "g2", "g3"}, s.groupsOf(s.T(), userDB, "u1"))
+	assert.Equal(s.T(), 1, replaced)
+
+	// applying again has no effect
+	require.Nil(s.T(), applier.Apply(context.Background(), &Message{ID: "1", GroupID: "g1", MemberID: "u1"}))
+	assert.Equal(s.T(), 1, replaced)
+
+	// members that are neither users nor groups are ignored
+	assert.Nil(s.T(), applier.Apply(context.Background(), &Message{ID: "2", GroupID: "g1", MemberID: "deleted"}))
+
+	// members of groups are applied in turn, except the groups expanded already
+	require.Nil(s.T(), applier.Apply(context.Background(), &Message{ID: "3", GroupID: "g3", MemberID: "g2"}))
+	assert.Equal(s.T(), []string{"g2", "g3"}, s.groupsOf(s.T(), userDB, "u2"))
+	assert.Equal(s.T(), 2, replaced)
+	assert.Empty(s.T(), s.groupsOf(s.T(), userDB, "u3"))
+
+	// errors are returned, so that the message is applied again
+	userDB, groupDB = s.databases(s.T())
+	failing := NewApplier(userDB, NewSyncService(groupDB), ApplierOptions{
+		Filters: []RefFilter{refFilterFunc(func(_ context.Context, _ *prop.Resource, _ *prop.Resource) error {
+			return spec.ErrConflict
+		})},
+	})
+	assert.True(s.T(), errors.Is(failing.Apply(context.Background(), &Message{ID: "4", GroupID: "g3", MemberID: "g2"}), spec.ErrConflict))
+
+	// users deleted while they are synchronized are ignored
+	deleting := NewApplier(userDB, NewSyncService(groupDB), ApplierOptions{
+		Filters: []RefFilter{refFilterFunc(func(ctx context.Context, _ *prop.Resource, ref *prop.Resource) error {
+			return userDB.Delete(ctx, ref)
+		})},
+	})
+	assert.Nil(s.T(), deleting.Apply(context.Background(), &Message{ID: "5", GroupID: "g1", MemberID: "u1"}))
+}
+
+func (s *ApplierTestSuite) TestApplyPublishing() {
+	userDB, groupDB := s.databases(s.T())
+	var published []*Message
+	applier := NewApplier(userDB, NewSyncService(groupDB), ApplierOptions{
+		Publisher: PublisherFunc(func(_ context.Context, message *Message) error {
+			published = append(published, message)
+			return nil
+		}),
+	})
+
+	require.Nil(s.T(), applier.Apply(context.Background(), &Message{ID: "1", Tenant: "acme", GroupID: "g3", MemberID: "g2"}))
+	require.Len(s.T(), published, 2)
+	sort.Slice(published, func(i, j int) bool {
+		return published[i].MemberID < published[j].MemberID
+	})
+	for i, member := range []string{"g1", "u2"} {
+		assert.Equal(s.T(), member, published[i].MemberID)
+		assert.Equal(s.T(), "g3", published[i].GroupID)
+		assert.Equal(s.T(), "acme", published[i].Tenant)
+		assert.Equal(s.T(), []string{"g2"}, published[i].Via)
+		assert.NotEmpty(s.T(), published[i].ID)
+	}
+	// users are not applied until the published messages are
+	assert.Empty(s.T(), s.groupsOf(s.T(), userDB, "u2"))
+
+	// ids are derived from the message expanded
+	again := published
+	published = nil
+	require.Nil(s.T(), applier.Apply(context.Background(), &Message{ID: "1", Tenant: "acme", GroupID: "g3", MemberID: "g2"}))
+	sort.Slice(published, func(i, j int) bool {
+		return published[i].MemberID < published[j].MemberID
+	})
+	assert.Equal(s.T(), again[0].ID, published[0].ID)
+	assert.NotEqual(s.T(), published[0].ID, published[1].ID)
+
+	// expansion stops at the maximum depth
+	published = nil
+	shallow := NewApplier(userDB, NewSyncServiceWithOptions(groupDB, SyncOptions{MaxDepth: 1}), ApplierOptions{
+		Publisher: applier.options.Publisher,
+	})
+	require.Nil(s.T(), shallow.Apply(context.Background(), &Message{ID: "2", GroupID: "g3", MemberID: "g1", Via: []string{"g2"}}))
+	assert.Empty(s.T(), published)
+}
+
+func (s *ApplierTestSuite) TestMessages() {
+	before, after := prop.NewResource(s.groupResourceType), prop.NewResource(s.groupResourceType)
+	require.False(s.T(), before.Navigator().Replace(map[string]interface{}{
+		"id":      "g1",
+		"members": []interface{}{map[string]interface{}{"value": "u1"}, map[string]interface{}{"value": "u2"}},
+	}).HasError())
+	require.False(s.T(), after.Navigator().Replace(map[string]interface{}{
+		"id":      "g1",
+		"members": []interface{}{map[string]interface{}{"value": "u2"}, map[string]interface{}{"value": "u3"}},
+	}).HasError())
+
+	messages := Messages(context.Background(), after, Compare(before, after))
+	require.Len(s.T(), messages, 2)
+	var members []string
+	for _, message := range messages {
+		assert.Equal(s.T(), "g1", message.GroupID)
+		assert.NotEmpty(s.T(), message.ID)
+		members = append(members, message.MemberID)
+	}
+	sort.Strings(members)
+	assert.Equal(s.T(), []string{"u1", "u3"}, members)
+
+	raw, err := Marshal(messages[0])
+	require.Nil(s.T(), err)
+	decoded := new(Message)
+	require.Nil(s.T(), json.Unmarshal(raw, decoded))
+	assert.True(s.T(), messages[0].Time.Equal(decoded.Time))
+	decoded.Time = messages[0].Time
+	assert.Equal(s.T(), messages[0], decoded)
+}
+
+func (s *ApplierTestSuite) TestConsume() {
+	userDB, groupDB := s.databases(s.T())
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// a malformed message, then a message that fails once
+	attempts := 0
+	applier := NewApplier(userDB, NewSyncService(groupDB), ApplierOptions{
+		Filters: []RefFilter{refFilterFunc(func(_ context.Context, _ *prop.Resource, _ *prop.Resource) error {
+			if attempts++; attempts == 1 {
+				return spec.ErrConflict
+			}
+			return nil
+		})},
+	})
+	receiver := &fakeReceiver{bodies: []string{`{`, `{"id":"1","group_id":"g1","member_id":"u1"}`}, done: cancel}
+
+	var errs []error
+	Consume(ctx, receiver, applier, func(err error) {
+		errs = append(errs, err)
+	})
+	require.Len(s.T(), errs, 2)
+	assert.True(s.T(), errors.Is(errs[0], spec.ErrInvalidSyntax))
+	assert.True(s.T(), errors.Is(errs[1], spec.ErrConflict))
+	assert.Equal(s.T(), []string{"ack", "nack", "ack"}, receiver.acks)
+	assert.Equal(s.T(), []string{"g1", "g2", "g3"}, s.groupsOf(s.T(), userDB, "u1"))
+}
+
+func (s *ApplierTestSuite) TestConsumeWithOptions() {
+	userDB, groupDB := s.databases(s.T())
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// u1 fails twice, u2 always fails, and u3 has no groups
+	attempts := map[string]int{}
+	applier := NewApplier(userDB, NewSyncService(groupDB), ApplierOptions{
+		Filters: []RefFilter{refFilterFunc(func(_ context.Context, user *prop.Resource, _ *prop.Resource) error {
+			id := user.IdOrEmpty()
+			if attempts[id]++; id == "u2" || attempts[id] <= 2 {
+				return spec.ErrConflict
+			}
+			return nil
+		})},
+	})
+	receiver := &fakeReceiver{
+		bodies: []string{
+			`{"id":"1","group_id":"g1","member_id":"u1","time":"` + time.Now().Add(-time.Minute).Format(time.RFC3339Nano) + `"}`,
+			`{"id":"2","group_id":"g2","member_id":"u2"}`,
+			`not json`,
+			`{"id":"3","group_id":"g2","member_id":"u3"}`,
+		},
+		done: cancel,
+	}
+
+	var (
+		deadLetters    []string
+		observations   []Observation
+		failDeadLetter = true
+	)
+	ConsumeWithOptions(ctx, receiver, applier, ConsumeOptions{
+		Retry: RetryPolicy{MaxAttempts: 3, InitialInterval: time.Millisecond, Multiplier: 2},
+		DeadLetter: func(_ context.Context, body []byte, err error) error {
+			// the first dead letter fails, so that the message is delivered again
+			if failDeadLetter {
+				failDeadLetter = false
+				return errors.New("unavailable")
+			}
+			deadLetters = append(deadLetters, string(body))
+			return nil
+		},
+		Observer: func(o Observation) {
+			observations = append(observations, o)
+		},
+	})
+
+	assert.Equal(s.T(), []string{"g1", "g2", "g3"}, s.groupsOf(s.T(), userDB, "u1"))
+	assert.Equal(s.T(), 3, attempts["u1"])
+	assert.Equal(s.T(), 6, attempts["u2"])
+	assert.Equal(s.T(), []string{"ack", "nack", "ack", "ack", "ack"}, receiver.acks)
+	assert.Equal(s.T(), []string{receiver.delivered[1], "not json"}, deadLetters)
+
+	require.Len(s.T(), observations, 5)
+	for i, expect := range []struct {
+		outcome  string
+		attempts int
+		err      error
+	}{
+		{outcome: OutcomeApplied, attempts: 3},
+		{outcome: OutcomeFailed, attempts: 3, err: spec.ErrConflict},
+		{outcome: OutcomeDeadLettered, attempts: 3, err: spec.ErrConflict},
+		{outcome: OutcomeDeadLettered, attempts: 0, err: spec.ErrInvalidSyntax},
+		{outcome: OutcomeApplied, attempts: 1},
+	} {
+		assert.Equal(s.T(), expect.outcome, observations[i].Outcome, i)
+		assert.Equal(s.T(), expect.attempts, observations[i].Attempts, i)
+		if expect.err == nil {
+			assert.Nil(s.T(), observations[i].Err, i)
+		} else {
+			assert.True(s.T(), errors.Is(observations[i].Err, expect.err), i)
+		}
+	}
+	assert.True(s.T(), observations[0].Lag >= time.Minute)
+	assert.Equal(s.T(), time.Duration(0), observations[1].Lag)
+	assert.Nil(s.T(), observations[3].Message)
+}
+
+func TestRetryPolicy(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 5, InitialInterval: 100 * time.Millisecond, Multiplier: 3, MaxInterval: time.Second}
+	for attempt, expect := range map[int]time.Duration{
+		1: 100 * time.Millisecond,
+		2: 300 * time.Millisecond,
+		3: 900 * time.Millisecond,
+		4: time.Second,
+		9: time.Second,
+	} {
+		assert.Equal(t, expect, policy.Interval(attempt), attempt)
+	}
+	assert.Equal(t, 200*time.Millisecond, DefaultRetryPolicy.Interval(2))
+	assert.Equal(t, 100*time.Millisecond, RetryPolicy{InitialInterval: 100 * time.Millisecond}.Interval(3))
+
+	assert.True(t, policy.retry(4, errors.New("boom")))
+	assert.False(t, policy.retry(5, errors.New("boom")))
+	policy.Retryable = func(err error) bool {
+		return errors.Is(err, spec.ErrConflict)
+	}
+	assert.True(t, policy.retry(1, spec.ErrConflict))
+	assert.False(t, policy.retry(1, spec.ErrInvalidValue))
+}
+
+type refFilterFunc func(ctx context.Context, resource *prop.Resource, ref *prop.Resource) error
+
+func (f refFilterFunc) FilterRef(ctx context.Context, resource *prop.Resource, ref *prop.Resource) error {
+	return f(ctx, resource, ref)
+}
+
+// fakeReceiver delivers the bodies, delivering again those not acknowledged, and calls done once all are acknowledged.
+type fakeReceiver struct {
+	bodies    []string
+	delivered []string
+	acks      []string
+	done      func()
+}
+
+func (r *fakeReceiver) Receive(ctx context.Context) (Delivery, error) {
+	if len(r.bodies) == 0 {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	r.delivered = append(r.delivered, r.bodies[0])
+	return &fakeDelivery{receiver: r, body: r.bodies[0]}, nil
+}
+
+type fakeDelivery struct {
+	receiver *fakeReceiver
+	body     string
+}
+
+func (d *fakeDelivery) Body() []byte {
+	return []byte(d.body)
+}
+
+func (d *fakeDelivery) Ack(_ context.Context) error {
+	d.receiver.acks = append(d.receiver.acks, "ack")
+	if d.receiver.bodies = d.receiver.bodies[1:]; len(d.receiver.bodies) == 0 {
+		d.receiver.done()
+	}
+	return nil
+}
+
+func (d *fakeDelivery) Nack(_ context.Context) error {
+	d.receiver.acks = append(d.receiver.acks, "nack")
+	return nil
+}
+
+func (s *ApplierTestSuite) SetupSuite() {
+	for _, each := range []struct {
+		filepath  string
+		structure interface{}
+		post      func(parsed interface{})
+	}{
+		{
+			filepath:  "../../../public/schemas/core_schema.json",
+			structure: new(spec.Schema),
+			post: func(parsed interface{}) {
+				spec.Schemas().Register(parsed.(*spec.Schema))
+			},
+		},
+		{
+			filepath:  "../../../public/schemas/user_schema.json",
+			structure: new(spec.Schema),
+			post: func(parsed interface{}) {
+				spec.Schemas().Register(parsed.(*spec.Schema))
+			},
+		},
+		{
+			filepath:  "../../../public/schemas/user_enterprise_extension_schema.json",
+			structure: new(spec.Schema),
+			post: func(parsed interface{}) {
+				spec.Schemas().Register(parsed.(*spec.Schema))
+			},
+		},
+		{
+			filepath:  "../../../public/schemas/group_schema.json",
+			structure: new(spec.Schema),
+			post: func(parsed interface{}) {
+				spec.Schemas().Register(parsed.(*spec.Schema))
+			},
+		},
+		{
+			filepath:  "../../../public/resource_types/user_resource_type.json",
+			structure: new(spec.ResourceType),
+			post: func(parsed interface{}) {
+				s.userResourceType = parsed.(*spec.ResourceType)
+				crud.Register(s.userResourceType)
+			},
+		},
+		{
+			filepath:  "../../../public/resource_types/group_resource_type.json",
+			structure: new(spec.ResourceType),
+			post: func(parsed interface{}) {
+				s.groupResourceType = parsed.(*spec.ResourceType)
+				crud.Register(s.groupResourceType)
+			},
+		},
+	} {
+		f, err := os.Open(each.filepath)
+		require.Nil(s.T(), err)
+
+		raw, err := ioutil.ReadAll(f)
+		require.Nil(s.T(), err)
+
+		err = json.Unmarshal(raw, each.structure)
+		require.Nil(s.T(), err)
+
+		if each.post != nil {
+			each.post(each.structure)
+		}
+	}
+}
@@ -0,0 +1,226 @@
+package groupsync
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/imulab/go-scim/pkg/v2/spec"
+	"time"
+)
+
+// Delivery of a message by a broker.
+type Delivery interface {
+	// Body returns the message, as encoded by Marshal.
+	Body() []byte
+	// Ack acknowledges that the message was applied, so that it is not delivered again.
+	Ack(ctx context.Context) error
+	// Nack reports that the message could not be applied, so that it is delivered again, now or later.
+	Nack(ctx context.Context) error
+}
+
+// Receiver receives the messages from a broker. Receivers are not safe for concurrent use, and shall be consumed by a
+// single goroutine.
+type Receiver interface {
+	// Receive blocks until a message is delivered, or the context is done.
+	Receive(ctx context.Context) (Delivery, error)
+}
+
+// RetryPolicy is the policy of ConsumeWithOptions to apply again the messages that failed, waiting for an exponentially
+// increasing interval between the attempts.
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of attempts to apply a message, including the first. Messages are not applied
+	// again unless it is greater than 1.
+	MaxAttempts int
+	// InitialInterval is the interval after the first attempt.
+	InitialInterval time.Duration
+	// Multiplier multiplies the interval after every attempt. Values less than 1 are taken as 1.
+	Multiplier float64
+	// MaxInterval caps the interval, if positive.
+	MaxInterval time.Duration
+	// Retryable, if not nil, returns whether the message that failed with the error may be applied again. Otherwise,
+	// all errors are retried.
+	Retryable func(err error) bool
+}
+
+// DefaultRetryPolicy attempts to apply the messages five times, waiting 100ms, 200ms, 400ms and 800ms in between.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts:     5,
+	InitialInterval: 100 * time.Millisecond,
+	Multiplier:      2,
+	MaxInterval:     10 * time.Second,
+}
+
+// Interval returns the interval to wait after the attempt, counted from 1.
+func (p RetryPolicy) Interval(attempt int) time.Duration {
+	multiplier := p.Multiplier
+	if multiplier < 1 {
+		multiplier = 1
+	}
+	interval := float64(p.InitialInterval)
+	for i := 1; i < attempt; i++ {
+		interval *= multiplier
+		if p.MaxInterval > 0 && interval >= float64(p.MaxInterval) {
+			return p.MaxInterval
+		}
+	}
+	if p.MaxInterval > 0 && interval > float64(p.MaxInterval) {
+		return p.MaxInterval
+	}
+	return time.Duration(interval)
+}
+
+func (p RetryPolicy) retry(attempt int, err error) bool {
+	return attempt < p.MaxAttempts && (p.Retryable == nil || p.Retryable(err))
+}
+
+// Outcomes of the messages consumed, see Observation.
+const (
+	OutcomeApplied      = "applied"
+	OutcomeFailed       = "failed"
+	OutcomeDeadLettered = "dead_lettered"
+	OutcomeDropped      = "dropped"
+)
+
+// Observation of a message consumed, as passed to the observer of ConsumeOptions, i.e. to export metrics.
+type Observation struct {
+	// Message is the message, or nil if it could not be decoded.
+	Message *Message
+	// Outcome is OutcomeApplied, OutcomeFailed if the message was not acknowledged, to be delivered again,
+	// OutcomeDeadLettered, or OutcomeDropped if it could not be decoded and was not dead lettered.
+	Outcome string
+	// Attempts is the number of attempts to apply the message, which is zero if it could not be decoded.
+	Attempts int
+	// Err is the error of the last attempt, or nil if the message was applied.
+	Err error
+	// Lag is the time from the change of the membership (see Message) to the outcome, or zero if unknown.
+	Lag time.Duration
+}
+
+// ConsumeOptions are the options of ConsumeWithOptions.
+type ConsumeOptions struct {
+	// Retry is the policy to apply again the messages that failed, before they are dead lettered or not acknowledged.
+	// The zero value does not retry.
+	Retry RetryPolicy
+	// DeadLetter, if not nil, is called with the body of the messages that failed all their attempts, or that could not
+	// be decoded, and the error, i.e. to publish them to a dead letter queue and alert. Messages are acknowledged once
+	// DeadLetter returns without error, and not acknowledged otherwise, to be delivered again.
+	DeadLetter func(ctx context.Context, body []byte, err error) error
+	// OnError, if not nil, is called with the errors of the receiver, the applier, the dead letter and the
+	// acknowledgements.
+	OnError func(err error)
+	// Observer, if not nil, is called with the Observation of every message consumed. It shall be cheap.
+	Observer func(o Observation)
+}
+
+// Consume is ConsumeWithOptions without retries nor dead letter: messages that could not be applied are not
+// acknowledged, so that the broker delivers them again.
+func Consume(ctx context.Context, receiver Receiver, applier *Applier, onError func(err error)) {
+	ConsumeWithOptions(ctx, receiver, applier, ConsumeOptions{OnError: onError})
+}
+
+// ConsumeWithOptions receives the messages from the receiver and applies them with the applier, until the context is
+// done. Messages are acknowledged once applied. Messages that failed are applied again according to the retry policy of
+// the options, then dead lettered, or not acknowledged so that they are delivered again, hence applied at least once.
+// Messages that cannot be decoded are dead lettered with an error of spec.ErrInvalidSyntax, or dropped, i.e.
+// acknowledged, without dead letter, as they never could be applied.
+//
+// ConsumeWithOptions waits a second after an error of the receiver before it receives again, so that it does not spin
+// while the broker is down.
+func ConsumeWithOptions(ctx context.Context, receiver Receiver, applier *Applier, options ConsumeOptions) {
+	c := &consumer{applier: applier, options: options}
+	for {
+		delivery, err := receiver.Receive(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			c.report(err)
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(time.Second):
+			}
+			continue
+		}
+		c.consume(ctx, delivery)
+	}
+}
+
+type consumer struct {
+	applier *Applier
+	options ConsumeOptions
+}
+
+func (c *consumer) consume(ctx context.Context, delivery Delivery) {
+	o := Observation{}
+	defer func() {
+		if c.options.Observer != nil {
+			if o.Message != nil && !o.Message.Time.IsZero() {
+				o.Lag = time.Since(o.Message.Time)
+			}
+			c.options.Observer(o)
+		}
+	}()
+
+	message := new(Message)
+	if err := json.Unmarshal(delivery.Body(), message); err != nil {
+		o.Err = fmt.Errorf("%w: malformed group sync message: %v", spec.ErrInvalidSyntax, err)
+		c.report(o.Err)
+	} else {
+		o.Message = message
+		o.Err = c.apply(ctx, message, &o.Attempts)
+	}
+
+	switch {
+	case o.Err == nil:
+		o.Outcome = OutcomeApplied
+		c.report(delivery.Ack(ctx))
+	case c.deadLetter(ctx, delivery.Body(), o.Err):
+		o.Outcome = OutcomeDeadLettered
+		c.report(delivery.Ack(ctx))
+	case o.Message == nil:
+		o.Outcome = OutcomeDropped
+		c.report(delivery.Ack(ctx))
+	default:
+		o.Outcome = OutcomeFailed
+		c.report(delivery.Nack(ctx))
+	}
+}
+
+// Applies the message according to the retry policy, counting the attempts, and returns the error of the last attempt.
+func (c *consumer) apply(ctx context.Context, message *Message, attempts *int) error {
+	for {
+		*attempts++
+		err := c.applier.Apply(ctx, message)
+		if err == nil {
+			return nil
+		}
+		c.report(fmt.Errorf("failed to apply group sync message '%s' of member '%s' (attempt %d): %w", message.ID, message.MemberID, *attempts, err))
+		if !c.options.Retry.retry(*attempts, err) {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(c.options.Retry.Interval(*attempts)):
+		}
+	}
+}
+
+// Dead letters the body, and returns whether it was.
+func (c *consumer) deadLetter(ctx context.Context, body []byte, err error) bool {
+	if c.options.DeadLetter == nil {
+		return false
+	}
+	if err := c.options.DeadLetter(ctx, body, err); err != nil {
+		c.report(err)
+		return false
+	}
+	return true
+}
+
+func (c *consumer) report(err error) {
+	if err != nil && c.options.OnError != nil {
+		c.options.OnError(err)
+	}
+}
@@ -1,7 +1,9 @@
 package groupsync
 
 import (
+	"encoding/json"
 	"github.com/imulab/go-scim/pkg/v2/prop"
+	"sort"
 )
 
 const (
@@ -14,21 +16,25 @@ const (
 // of before and after should be non-nil. When before is nil, all members
 // of the after resource are considered to have just joined; when after
 // is nil, all members of the before resource are considered to have just left.
+//
+// Members that stayed in the group but whose "$ref", "display" or "type" were modified are reported as changed. The
+// diff also carries the id and displayName of the group, after the modification, or before it when after is nil, so
+// that those consuming the diff do not need to look the group up.
 func Compare(before *prop.Resource, after *prop.Resource) *Diff {
 	if before == nil && after == nil {
 		panic("at least one of before and after should be non-nil")
 	}
 
 	var (
-		beforeIds = map[string]struct{}{}
-		afterIds  = map[string]struct{}{}
+		beforeMembers = map[string]Member{}
+		afterMembers  = map[string]Member{}
 	)
 	for _, t := range []struct {
 		resource  *prop.Resource
-		collector map[string]struct{}
+		collector map[string]Member
 	}{
-		{resource: before, collector: beforeIds},
-		{resource: after, collector: afterIds},
+		{resource: before, collector: beforeMembers},
+		{resource: after, collector: afterMembers},
 	} {
 		if t.resource == nil {
 			continue
@@ -36,46 +42,115 @@ func Compare(before *prop.Resource, after *prop.Resource) *Diff {
 
 		members, _ := t.resource.RootProperty().ChildAtIndex(fieldMembers)
 		_ = members.ForEachChild(func(index int, child prop.Property) error {
-			value, _ := child.ChildAtIndex(fieldValue)
-			if value != nil && !value.IsUnassigned() {
-				t.collector[value.Raw().(string)] = struct{}{}
+			if member, ok := memberFrom(child); ok {
+				t.collector[member.Value] = member
 			}
 			return nil
 		})
 	}
 
-	diff := new(Diff)
-	for k := range beforeIds {
-		if _, ok := afterIds[k]; !ok {
-			diff.addLeft(k)
+	group := after
+	if group == nil {
+		group = before
+	}
+	diff := &Diff{groupID: group.IdOrEmpty()}
+	diff.groupDisplay, _ = stringOf(group.RootProperty(), "displayName")
+	for k, member := range beforeMembers {
+		if _, ok := afterMembers[k]; !ok {
+			diff.addLeft(member)
 		}
 	}
-	for k := range afterIds {
-		if _, ok := beforeIds[k]; !ok {
-			diff.addJoined(k)
+	for k, member := range afterMembers {
+		previous, ok := beforeMembers[k]
+		if !ok {
+			diff.addJoined(member)
+		} else if previous != member {
+			diff.addChanged(previous, member)
 		}
 	}
 	return diff
 }
 
+// Member is a member of a group, as an element of the "members" of the group.
+type Member struct {
+	// Value is the id of the member, a user or a group.
+	Value string `json:"value"`
+	// Ref is the "$ref" of the member, if any.
+	Ref string `json:"$ref,omitempty"`
+	// Display is the "display" of the member, if any.
+	Display string `json:"display,omitempty"`
+	// Type is the "type" of the member, if the schema of the group has one and it is set, i.e. "User" or "Group".
+	Type string `json:"type,omitempty"`
+}
+
+// MemberChange is the change of a member that stayed in a group.
+type MemberChange struct {
+	Before Member `json:"before"`
+	After  Member `json:"after"`
+}
+
+// Returns the member of the element of "members", unless it has no value.
+func memberFrom(element prop.Property) (Member, bool) {
+	var member Member
+	member.Value, _ = stringOf(element, fieldValue)
+	if len(member.Value) == 0 {
+		return member, false
+	}
+	member.Ref, _ = stringOf(element, "$ref")
+	member.Display, _ = stringOf(element, "display")
+	member.Type, _ = stringOf(element, "type")
+	return member, true
+}
+
+// Returns the string value of the named sub property, if any.
+func stringOf(property prop.Property, name string) (string, bool) {
+	child, err := property.ChildAtIndex(name)
+	if err != nil || child == nil {
+		return "", false
+	}
+	s, ok := child.Raw().(string)
+	return s, ok
+}
+
 // Diff reports the difference between the members of two group resources.
 type Diff struct {
-	joined map[string]struct{}
-	left   map[string]struct{}
+	groupID      string
+	groupDisplay string
+	joined       map[string]Member
+	left         map[string]Member
+	changed      map[string]MemberChange
 }
 
-func (d *Diff) addJoined(id string) {
+func (d *Diff) addJoined(member Member) {
 	if d.joined == nil {
-		d.joined = map[string]struct{}{}
+		d.joined = map[string]Member{}
 	}
-	d.joined[id] = struct{}{}
+	d.joined[member.Value] = member
 }
 
-func (d *Diff) addLeft(id string) {
+func (d *Diff) addLeft(member Member) {
 	if d.left == nil {
-		d.left = map[string]struct{}{}
+		d.left = map[string]Member{}
+	}
+	d.left[member.Value] = member
+}
+
+func (d *Diff) addChanged(before Member, after Member) {
+	if d.changed == nil {
+		d.changed = map[string]MemberChange{}
 	}
-	d.left[id] = struct{}{}
+	d.changed[after.Value] = MemberChange{Before: before, After: after}
+}
+
+// GroupID returns the id of the group.
+func (d *Diff) GroupID() string {
+	return d.groupID
+}
+
+// GroupDisplayName returns the displayName of the group, after the modification, or before it if the group was
+// deleted.
+func (d *Diff) GroupDisplayName() string {
+	return d.groupDisplay
 }
 
 // ForEachJoined iterates all member ids that joined the group and invoke the callback.
@@ -92,6 +167,30 @@ func (d *Diff) ForEachLeft(callback func(id string)) {
 	}
 }
 
+// ForEachJoinedMember iterates all members that joined the group, as they are after the modification, and invoke the
+// callback.
+func (d *Diff) ForEachJoinedMember(callback func(member Member)) {
+	for _, member := range d.joined {
+		callback(member)
+	}
+}
+
+// ForEachLeftMember iterates all members that left the group, as they were before the modification, and invoke the
+// callback.
+func (d *Diff) ForEachLeftMember(callback func(member Member)) {
+	for _, member := range d.left {
+		callback(member)
+	}
+}
+
+// ForEachChanged iterates all members that stayed in the group, but whose "$ref", "display" or "type" changed, and
+// invoke the callback.
+func (d *Diff) ForEachChanged(callback func(change MemberChange)) {
+	for _, change := range d.changed {
+		callback(change)
+	}
+}
+
 // CountJoined returns the total number of new members that joined the group.
 func (d *Diff) CountJoined() int {
 	return len(d.joined)
@@ -101,3 +200,42 @@ func (d *Diff) CountJoined() int {
 func (d *Diff) CountLeft() int {
 	return len(d.left)
 }
+
+// CountChanged returns the total number of members that stayed in the group, but changed.
+func (d *Diff) CountChanged() int {
+	return len(d.changed)
+}
+
+// MarshalJSON encodes the diff, with the members that joined, left and changed ordered by their values:
+//
+//	{
+//	  "group": {"id": "e9e30dba", "displayName": "Engineering"},
+//	  "joined": [{"value": "2819c223", "$ref": "/Users/2819c223", "display": "Babs Jensen"}],
+//	  "left": [],
+//	  "changed": []
+//	}
+func (d *Diff) MarshalJSON() ([]byte, error) {
+	members := func(m map[string]Member) []Member {
+		list := make([]Member, 0, len(m))
+		for _, member := range m {
+			list = append(list, member)
+		}
+		sort.Slice(list, func(i, j int) bool { return list[i].Value < list[j].Value })
+		return list
+	}
+	changed := make([]MemberChange, 0, len(d.changed))
+	for _, change := range d.changed {
+		changed = append(changed, change)
+	}
+	sort.Slice(changed, func(i, j int) bool { return changed[i].After.Value < changed[j].After.Value })
+
+	return json.Marshal(map[string]interface{}{
+		"group": map[string]interface{}{
+			"id":          d.groupID,
+			"displayName": d.groupDisplay,
+		},
+		"joined":  members(d.joined),
+		"left":    members(d.left),
+		"changed": changed,
+	})
+}
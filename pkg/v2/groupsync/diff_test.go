@@ -1,6 +1,7 @@
 package groupsync
 
 import (
+	"context"
 	"encoding/json"
 	"github.com/imulab/go-scim/pkg/v2/prop"
 	"github.com/imulab/go-scim/pkg/v2/spec"
@@ -164,6 +165,54 @@ func (s *CompareTestSuite) TestCompare() {
 				assert.True(t, m1Left)
 			},
 		},
+		{
+			name: "someone renamed",
+			getBefore: func(t *testing.T) *prop.Resource {
+				r := prop.NewResource(s.resourceType)
+				assert.False(t, r.Navigator().Replace(map[string]interface{}{
+					"schemas":     []interface{}{"urn:ietf:params:scim:schemas:core:2.0:Group"},
+					"id":          "foobar",
+					"displayName": "Engineering",
+					"members": []interface{}{
+						map[string]interface{}{
+							"value":   "m1",
+							"$ref":    "/Users/m1",
+							"display": "m1",
+						},
+					},
+				}).HasError())
+				return r
+			},
+			getAfter: func(t *testing.T) *prop.Resource {
+				r := prop.NewResource(s.resourceType)
+				assert.False(t, r.Navigator().Replace(map[string]interface{}{
+					"schemas":     []interface{}{"urn:ietf:params:scim:schemas:core:2.0:Group"},
+					"id":          "foobar",
+					"displayName": "R&D",
+					"members": []interface{}{
+						map[string]interface{}{
+							"value":   "m1",
+							"$ref":    "/Users/m1",
+							"display": "Babs",
+						},
+					},
+				}).HasError())
+				return r
+			},
+			expect: func(t *testing.T, diff *Diff) {
+				assert.Equal(t, 0, diff.CountLeft())
+				assert.Equal(t, 0, diff.CountJoined())
+				assert.Equal(t, 1, diff.CountChanged())
+				assert.Equal(t, "foobar", diff.GroupID())
+				assert.Equal(t, "R&D", diff.GroupDisplayName())
+				diff.ForEachChanged(func(change MemberChange) {
+					assert.Equal(t, MemberChange{
+						Before: Member{Value: "m1", Ref: "/Users/m1", Display: "m1"},
+						After:  Member{Value: "m1", Ref: "/Users/m1", Display: "Babs"},
+					}, change)
+				})
+			},
+		},
 	}
 
 	for _, test := range tests {
@@ -176,6 +225,56 @@ func (s *CompareTestSuite) TestCompare() {
 	}
 }
 
+func (s *CompareTestSuite) TestDiffOutput() {
+	group := func(name string, members ...interface{}) *prop.Resource {
+		r := prop.NewResource(s.resourceType)
+		require.False(s.T(), r.Navigator().Replace(map[string]interface{}{
+			"schemas":     []interface{}{"urn:ietf:params:scim:schemas:core:2.0:Group"},
+			"id":          "g1",
+			"displayName": name,
+			"members":     members,
+		}).HasError())
+		return r
+	}
+	before := group("Engineering",
+		map[string]interface{}{"value": "u1", "$ref": "/Users/u1", "display": "Foo"},
+		map[string]interface{}{"value": "u2", "display": "Bar"},
+	)
+	after := group("Engineering",
+		map[string]interface{}{"value": "u2", "$ref": "/Users/u2", "display": "Bar"},
+		map[string]interface{}{"value": "u3", "$ref": "/Users/u3", "display": "Baz"},
+	)
+	diff := Compare(before, after)
+
+	raw, err := json.Marshal(diff)
+	require.Nil(s.T(), err)
+	assert.JSONEq(s.T(), `{
+		"group": {"id": "g1", "displayName": "Engineering"},
+		"joined": [{"value": "u3", "$ref": "/Users/u3", "display": "Baz"}],
+		"left": [{"value": "u1", "$ref": "/Users/u1", "display": "Foo"}],
+		"changed": [{
+			"before": {"value": "u2", "display": "Bar"},
+			"after": {"value": "u2", "$ref": "/Users/u2", "display": "Bar"}
+		}]
+	}`, string(raw))
+
+	messages := Messages(context.Background(), after, diff)
+	require.Len(s.T(), messages, 2)
+	for _, message := range messages {
+		assert.Equal(s.T(), "Engineering", message.GroupDisplay)
+		switch message.MemberID {
+		case "u3":
+			assert.Equal(s.T(), EventJoined, message.Event)
+			assert.Equal(s.T(), &Member{Value: "u3", Ref: "/Users/u3", Display: "Baz"}, message.Member)
+		case "u1":
+			assert.Equal(s.T(), EventLeft, message.Event)
+			assert.Equal(s.T(), &Member{Value: "u1", Ref: "/Users/u1", Display: "Foo"}, message.Member)
+		default:
+			s.T().Errorf("unexpected message for member '%s'", message.MemberID)
+		}
+	}
+}
+
 func (s *CompareTestSuite) SetupSuite() {
 	for _, each := range []struct {
 		filepath  string
@@ -3,4 +3,13 @@
 // The "groups" attribute of the User resource is a readOnly attribute, which shall be updated according to the change
 // of "members" in Group resources. This package provides mere utilities that may be helpful, it does not assume a
 // certain way to resolve this issue.
+//
+// The membership changes of groups (see Compare) can be published as messages (see Messages) to Kafka, NATS JetStream
+// or Amazon SQS, and applied to the users by workers consuming them (see Consume and Applier), at least once. The
+// "groups" of users can also be computed when they are written (see filter.UserGroupsFilter), or returned (see
+// SyncService.SyncGroupPropertyForUsers).
+//
+// The members of dynamic groups are the users matching a filter stored with the group (see Dynamic), rather than the
+// users added to it: they are materialized as the groups are written (see filter.DynamicGroupFilter), and updated
+// incrementally from the change stream of the users, or computed as the groups are returned.
 package groupsync
@@ -0,0 +1,243 @@
+package groupsync
+
+import (
+	"context"
+	"errors"
+	"github.com/imulab/go-scim/pkg/v2/crud"
+	"github.com/imulab/go-scim/pkg/v2/db"
+	"github.com/imulab/go-scim/pkg/v2/prop"
+	"github.com/imulab/go-scim/pkg/v2/spec"
+)
+
+// DynamicSchema is the id of the schema extension of dynamic groups, whose "filter" is a SCIM filter over the users
+// that are the members of the group, i.e. 'department eq "Engineering" and active eq true'.
+const DynamicSchema = "urn:imulab:scim:schemas:extension:dynamic:2.0:Group"
+
+// Attempts to replace a materialized group modified concurrently, before giving up on the change.
+const dynamicAttempts = 3
+
+// DynamicOptions are the options of NewDynamic.
+type DynamicOptions struct {
+	// Filters are applied to the dynamic groups whose members changed, before they are replaced, i.e.
+	// filter.MetaFilter to update their meta.
+	Filters []RefFilter
+	// Publisher, if not nil, publishes a message for every user that joined or left a dynamic group whose members are
+	// materialized (see Messages), so that their "groups" are synchronized.
+	Publisher Publisher
+}
+
+// NewDynamic returns a Dynamic that evaluates the filters of the dynamic groups of the group database over the users of
+// the user database, which are of the user resource type.
+func NewDynamic(userType *spec.ResourceType, userDB db.DB, groupDB db.DB, options DynamicOptions) *Dynamic {
+	return &Dynamic{
+		userType: userType,
+		userDB:   userDB,
+		groupDB:  groupDB,
+		options:  options,
+		filters:  crud.NewFilterCache(0),
+	}
+}
+
+// Dynamic computes the members of dynamic groups: groups of a resource type extended with DynamicSchema, whose members
+// are the users matching the filter of the group, rather than the users added to the group. The members can be
+// evaluated on demand, when the groups are returned to clients (see Compute), or materialized, stored with the groups
+// when they are written, and maintained incrementally as users change (see Apply). Groups without a filter are static.
+type Dynamic struct {
+	userType *spec.ResourceType
+	userDB   db.DB
+	groupDB  db.DB
+	options  DynamicOptions
+	filters  *crud.FilterCache
+}
+
+// FilterOf returns the filter of the dynamic group, or an empty string if the group is static.
+func FilterOf(group *prop.Resource) string {
+	nav := group.Navigator().Dot(DynamicSchema).Dot("filter")
+	if nav.HasError() {
+		return ""
+	}
+	filter, _ := nav.Current().Raw().(string)
+	return filter
+}
+
+// Validate returns an error of spec.ErrInvalidFilter if the filter cannot be evaluated over the users.
+func (d *Dynamic) Validate(filter string) error {
+	_, err := d.filters.Compile(filter, d.userType)
+	return err
+}
+
+// Members returns the members of the dynamic group, as raw values of the elements of "members": one for every user
+// matching the filter of the group, with its "value", "$ref" and "display" (see Hydrator), in the order the users are
+// returned by the user database. Static groups have no members computed, and nil is returned.
+func (d *Dynamic) Members(ctx context.Context, group *prop.Resource) ([]interface{}, error) {
+	filter := FilterOf(group)
+	if len(filter) == 0 {
+		return nil, nil
+	}
+	if err := d.Validate(filter); err != nil {
+		return nil, err
+	}
+
+	users, err := d.userDB.Query(ctx, filter, nil, nil, &crud.Projection{
+		Attributes: []string{"id", "meta.location", "displayName", "userName"},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	members := make([]interface{}, 0, len(users))
+	for _, user := range users {
+		if len(user.IdOrEmpty()) > 0 {
+			members = append(members, memberOf(user))
+		}
+	}
+	return members, nil
+}
+
+// Compute replaces the "members" of the dynamic groups with the users matching their filters (see Members), i.e.
+// before the groups are returned to clients, or when they are written. Static groups are left unchanged. This method
+// does not save or replace the computed groups with the database.
+func (d *Dynamic) Compute(ctx context.Context, groups ...*prop.Resource) error {
+	for _, group := range groups {
+		if len(FilterOf(group)) == 0 {
+			continue
+		}
+
+		members, err := d.Members(ctx, group)
+		if err != nil {
+			return err
+		}
+
+		nav := group.Navigator().Dot("members")
+		if len(members) == 0 {
+			nav.Delete()
+		} else {
+			nav.Replace(members)
+		}
+		if err := nav.Error(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Apply applies the change of a user to the members of every dynamic group stored in the group database: the user is
+// added to the groups whose filter it now matches, and removed from those whose filter it no longer matches, or from
+// all of them once deleted. Groups whose members did not change are not replaced. It is meant to be subscribed to the
+// changes of the user database (see db.Subscribe), so that the members stored with the groups are kept up to date as
+// users are created, modified and deleted by any process:
+//
+//	err := db.Subscribe(ctx, userDB, dynamic.Apply)
+//
+// Changes notified more than once are applied once, as the user is already a member, or not. Groups whose filter
+// cannot be evaluated, i.e. referring to attributes since removed from the schema, are left unchanged.
+func (d *Dynamic) Apply(ctx context.Context, change *db.Change) error {
+	if len(change.ID) == 0 {
+		return nil
+	}
+
+	user := change.Resource
+	if user == nil && change.Type != db.ChangeDelete {
+		var err error
+		if user, err = d.userDB.Get(ctx, change.ID, nil); err != nil && !errors.Is(err, spec.ErrNotFound) {
+			return err
+		}
+	}
+
+	groups, err := d.groupDB.Query(ctx, DynamicSchema+":filter pr", nil, nil, nil)
+	if err != nil {
+		return err
+	}
+
+	for _, group := range groups {
+		member := false
+		if user != nil {
+			if member, err = d.filters.Evaluate(user, FilterOf(group)); err != nil {
+				continue
+			}
+		}
+		if err := d.update(ctx, group, change.ID, user, member); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Adds or removes the user by id as a member of the group, and replaces the group if its members changed. The group is
+// read again when it was modified concurrently.
+func (d *Dynamic) update(ctx context.Context, group *prop.Resource, id string, user *prop.Resource, member bool) error {
+	var ref *prop.Resource
+	for attempt := 1; ; attempt++ {
+		_, isMember := memberIds(group)[id]
+		if isMember == member {
+			return nil
+		}
+
+		ref = group.Clone()
+		nav := group.Navigator().Dot("members")
+		if member {
+			nav.Add([]interface{}{memberOf(user)})
+		} else {
+			nav.Where(func(child prop.Property) bool {
+				value, err := child.ChildAtIndex("value")
+				return err == nil && value != nil && value.Raw() == id
+			}).Delete()
+		}
+		if err := nav.Error(); err != nil {
+			return err
+		}
+
+		for _, f := range d.options.Filters {
+			if err := f.FilterRef(ctx, group, ref); err != nil {
+				return err
+			}
+		}
+
+		err := d.groupDB.Replace(ctx, ref, group)
+		if err == nil {
+			break
+		}
+		if errors.Is(err, spec.ErrNotFound) {
+			return nil
+		}
+		if !errors.Is(err, spec.ErrConflict) || attempt == dynamicAttempts {
+			return err
+		}
+
+		if group, err = d.groupDB.Get(ctx, ref.IdOrEmpty(), nil); err != nil {
+			if errors.Is(err, spec.ErrNotFound) {
+				return nil
+			}
+			return err
+		}
+		if len(FilterOf(group)) == 0 {
+			return nil
+		}
+		if user != nil {
+			if member, err = d.filters.Evaluate(user, FilterOf(group)); err != nil {
+				return nil
+			}
+		}
+	}
+
+	if d.options.Publisher != nil {
+		for _, message := range Messages(ctx, group, Compare(ref, group)) {
+			if err := d.options.Publisher.Publish(ctx, message); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Returns the raw value of the element of "members" for the user.
+func memberOf(user *prop.Resource) map[string]interface{} {
+	member := map[string]interface{}{"value": user.IdOrEmpty()}
+	if location := user.MetaLocationOrEmpty(); len(location) > 0 {
+		member["$ref"] = location
+	}
+	if display := displayOf(user); display != nil {
+		member["display"] = display
+	}
+	return member
+}
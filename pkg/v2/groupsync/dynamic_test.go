@@ -0,0 +1,313 @@
+package groupsync
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/imulab/go-scim/pkg/v2/crud"
+	"github.com/imulab/go-scim/pkg/v2/db"
+	"github.com/imulab/go-scim/pkg/v2/prop"
+	"github.com/imulab/go-scim/pkg/v2/spec"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+const engineering = `urn:ietf:params:scim:schemas:extension:enterprise:2.0:User:department eq "Engineering" and active eq true`
+
+func TestDynamic(t *testing.T) {
+	s := new(DynamicTestSuite)
+	suite.Run(t, s)
+}
+
+type DynamicTestSuite struct {
+	suite.Suite
+	userResourceType  *spec.ResourceType
+	groupResourceType *spec.ResourceType
+}
+
+func (s *DynamicTestSuite) TestCompute() {
+	userDB := db.Memory()
+	for _, user := range []*prop.Resource{
+		s.user("u1", "foo", "Engineering", true),
+		s.user("u2", "bar", "Engineering", false),
+		s.user("u3", "baz", "Sales", true),
+	} {
+		require.Nil(s.T(), userDB.Insert(context.Background(), user))
+	}
+	dynamic := NewDynamic(s.userResourceType, userDB, db.Memory(), DynamicOptions{})
+
+	tests := []struct {
+		name   string
+		group  *prop.Resource
+		expect func(t *testing.T, group *prop.Resource, err error)
+	}{
+		{
+			name:  "dynamic group",
+			group: s.group("g1", engineering, "u3"),
+			expect: func(t *testing.T, group *prop.Resource, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, []interface{}{
+					map[string]interface{}{"value": "u1", "$ref": "/Users/u1", "display": "foo"},
+				}, group.Navigator().Dot("members").Current().Raw())
+			},
+		},
+		{
+			name:  "dynamic group without members",
+			group: s.group("g1", `userName eq "nobody"`, "u3"),
+			expect: func(t *testing.T, group *prop.Resource, err error) {
+				assert.Nil(t, err)
+				assert.True(t, group.Navigator().Dot("members").Current().IsUnassigned())
+			},
+		},
+		{
+			name:  "static group",
+			group: s.group("g1", "", "u3"),
+			expect: func(t *testing.T, group *prop.Resource, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, map[string]struct{}{"u3": {}}, memberIds(group))
+			},
+		},
+		{
+			name:  "invalid filter",
+			group: s.group("g1", `department eq`, "u3"),
+			expect: func(t *testing.T, _ *prop.Resource, err error) {
+				assert.True(t, errors.Is(err, spec.ErrInvalidFilter))
+			},
+		},
+		{
+			name:  "filter on unknown attributes",
+			group: s.group("g1", `members pr`, "u3"),
+			expect: func(t *testing.T, _ *prop.Resource, err error) {
+				assert.True(t, errors.Is(err, spec.ErrInvalidFilter))
+			},
+		},
+	}
+
+	for _, test := range tests {
+		s.T().Run(test.name, func(t *testing.T) {
+			err := dynamic.Compute(context.Background(), test.group)
+			test.expect(t, test.group, err)
+		})
+	}
+}
+
+func (s *DynamicTestSuite) TestApply() {
+	var (
+		userDB    = db.Memory()
+		groupDB   = db.Memory()
+		published []string
+		dynamic   = NewDynamic(s.userResourceType, userDB, groupDB, DynamicOptions{
+			Publisher: PublisherFunc(func(_ context.Context, message *Message) error {
+				assert.Equal(s.T(), "g1", message.GroupID)
+				published = append(published, message.MemberID)
+				return nil
+			}),
+		})
+	)
+	for _, group := range []*prop.Resource{
+		s.group("g1", engineering),
+		s.group("g2", "", "u1"),
+	} {
+		require.Nil(s.T(), groupDB.Insert(context.Background(), group))
+	}
+	members := func(t *testing.T, id string) map[string]struct{} {
+		group, err := groupDB.Get(context.Background(), id, nil)
+		require.Nil(t, err)
+		return memberIds(group)
+	}
+
+	tests := []struct {
+		name      string
+		change    *db.Change
+		members   map[string]struct{}
+		published []string
+	}{
+		{
+			name:      "user created",
+			change:    &db.Change{Type: db.ChangeInsert, ID: "u1", Resource: s.user("u1", "foo", "Engineering", true)},
+			members:   map[string]struct{}{"u1": {}},
+			published: []string{"u1"},
+		},
+		{
+			name:    "change applied again",
+			change:  &db.Change{Type: db.ChangeUpdate, ID: "u1", Resource: s.user("u1", "foo", "Engineering", true)},
+			members: map[string]struct{}{"u1": {}},
+		},
+		{
+			name:    "user not matching created",
+			change:  &db.Change{Type: db.ChangeInsert, ID: "u2", Resource: s.user("u2", "bar", "Sales", true)},
+			members: map[string]struct{}{"u1": {}},
+		},
+		{
+			name:      "user updated to match",
+			change:    &db.Change{Type: db.ChangeUpdate, ID: "u2", Resource: s.user("u2", "bar", "Engineering", true)},
+			members:   map[string]struct{}{"u1": {}, "u2": {}},
+			published: []string{"u2"},
+		},
+		{
+			name:      "user updated to no longer match",
+			change:    &db.Change{Type: db.ChangeUpdate, ID: "u1", Resource: s.user("u1", "foo", "Engineering", false)},
+			members:   map[string]struct{}{"u2": {}},
+			published: []string{"u1"},
+		},
+		{
+			name:      "user deleted",
+			change:    &db.Change{Type: db.ChangeDelete, ID: "u2"},
+			members:   map[string]struct{}{},
+			published: []string{"u2"},
+		},
+	}
+
+	for _, test := range tests {
+		s.T().Run(test.name, func(t *testing.T) {
+			published = nil
+			require.Nil(t, dynamic.Apply(context.Background(), test.change))
+			assert.Equal(t, test.members, members(t, "g1"))
+			assert.Equal(t, test.published, published)
+
+			// static groups are left alone
+			assert.Equal(t, map[string]struct{}{"u1": {}}, members(t, "g2"))
+		})
+	}
+}
+
+func (s *DynamicTestSuite) TestApplyWithoutResource() {
+	var (
+		userDB  = db.Memory()
+		groupDB = db.Memory()
+		dynamic = NewDynamic(s.userResourceType, userDB, groupDB, DynamicOptions{})
+	)
+	require.Nil(s.T(), groupDB.Insert(context.Background(), s.group("g1", engineering, "u1")))
+	require.Nil(s.T(), userDB.Insert(context.Background(), s.user("u2", "bar", "Engineering", true)))
+
+	// the user is read from the database when the change does not carry it, and removed once it is gone
+	for _, change := range []*db.Change{
+		{Type: db.ChangeInsert, ID: "u2"},
+		{Type: db.ChangeUpdate, ID: "u1"},
+	} {
+		require.Nil(s.T(), dynamic.Apply(context.Background(), change))
+	}
+
+	group, err := groupDB.Get(context.Background(), "g1", nil)
+	require.Nil(s.T(), err)
+	assert.Equal(s.T(), map[string]struct{}{"u2": {}}, memberIds(group))
+}
+
+func (s *DynamicTestSuite) user(id string, userName string, department string, active bool) *prop.Resource {
+	user := prop.NewResource(s.userResourceType)
+	require.False(s.T(), user.Navigator().Replace(map[string]interface{}{
+		"schemas": []interface{}{
+			"urn:ietf:params:scim:schemas:core:2.0:User",
+			"urn:ietf:params:scim:schemas:extension:enterprise:2.0:User",
+		},
+		"id":       id,
+		"userName": userName,
+		"active":   active,
+		"meta":     map[string]interface{}{"location": "/Users/" + id},
+		"urn:ietf:params:scim:schemas:extension:enterprise:2.0:User": map[string]interface{}{
+			"department": department,
+		},
+	}).HasError())
+	return user
+}
+
+func (s *DynamicTestSuite) group(id string, filter string, members ...string) *prop.Resource {
+	data := map[string]interface{}{
+		"schemas":     []interface{}{"urn:ietf:params:scim:schemas:core:2.0:Group"},
+		"id":          id,
+		"displayName": id,
+		"meta":        map[string]interface{}{"location": "/Groups/" + id, "version": "v1"},
+	}
+	if len(filter) > 0 {
+		data["schemas"] = append(data["schemas"].([]interface{}), DynamicSchema)
+		data[DynamicSchema] = map[string]interface{}{"filter": filter}
+	}
+	var elements []interface{}
+	for _, member := range members {
+		elements = append(elements, map[string]interface{}{"value": member})
+	}
+	if len(elements) > 0 {
+		data["members"] = elements
+	}
+
+	group := prop.NewResource(s.groupResourceType)
+	require.False(s.T(), group.Navigator().Replace(data).HasError())
+	return group
+}
+
+func (s *DynamicTestSuite) SetupSuite() {
+	for _, each := range []struct {
+		filepath  string
+		structure interface{}
+		post      func(parsed interface{})
+	}{
+		{
+			filepath:  "../../../public/schemas/core_schema.json",
+			structure: new(spec.Schema),
+			post: func(parsed interface{}) {
+				spec.Schemas().Register(parsed.(*spec.Schema))
+			},
+		},
+		{
+			filepath:  "../../../public/schemas/user_schema.json",
+			structure: new(spec.Schema),
+			post: func(parsed interface{}) {
+				spec.Schemas().Register(parsed.(*spec.Schema))
+			},
+		},
+		{
+			filepath:  "../../../public/schemas/user_enterprise_extension_schema.json",
+			structure: new(spec.Schema),
+			post: func(parsed interface{}) {
+				spec.Schemas().Register(parsed.(*spec.Schema))
+			},
+		},
+		{
+			filepath:  "../../../public/schemas/group_schema.json",
+			structure: new(spec.Schema),
+			post: func(parsed interface{}) {
+				spec.Schemas().Register(parsed.(*spec.Schema))
+			},
+		},
+		{
+			filepath:  "../../../public/schemas/group_dynamic_extension_schema.json",
+			structure: new(spec.Schema),
+			post: func(parsed interface{}) {
+				spec.Schemas().Register(parsed.(*spec.Schema))
+			},
+		},
+		{
+			filepath:  "../../../public/resource_types/user_resource_type.json",
+			structure: new(spec.ResourceType),
+			post: func(parsed interface{}) {
+				s.userResourceType = parsed.(*spec.ResourceType)
+				crud.Register(s.userResourceType)
+			},
+		},
+		{
+			filepath:  "../../../public/resource_types/dynamic_group_resource_type.json",
+			structure: new(spec.ResourceType),
+			post: func(parsed interface{}) {
+				s.groupResourceType = parsed.(*spec.ResourceType)
+				crud.Register(s.groupResourceType)
+			},
+		},
+	} {
+		f, err := os.Open(each.filepath)
+		require.Nil(s.T(), err)
+
+		raw, err := ioutil.ReadAll(f)
+		require.Nil(s.T(), err)
+
+		err = json.Unmarshal(raw, each.structure)
+		require.Nil(s.T(), err)
+
+		if each.post != nil {
+			each.post(each.structure)
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package groupsync
+
+import (
+	"context"
+	"github.com/imulab/go-scim/pkg/v2/crud"
+	"github.com/imulab/go-scim/pkg/v2/db"
+	"github.com/imulab/go-scim/pkg/v2/prop"
+)
+
+// NewHydrator returns a new Hydrator, which looks up the members in the user and group databases.
+func NewHydrator(userDB db.DB, groupDB db.DB) *Hydrator {
+	return &Hydrator{userDB: userDB, groupDB: groupDB}
+}
+
+// Hydrator fills in the "display" and "$ref" sub attributes of the "members" of Group resources with the current
+// state of the member resources, i.e. before the groups are returned to clients.
+type Hydrator struct {
+	userDB  db.DB
+	groupDB db.DB
+}
+
+// Hydrate sets the "display" of every member of the groups to the displayName of the member, or to the userName of
+// User members without one, and its "$ref" to the meta.location of the member. The members of all groups are looked up
+// at once (see db.GetMany): first among the users, then among the groups for the remaining members. Members that are
+// neither are left unchanged. This method does not save or replace the hydrated groups with the database.
+func (h *Hydrator) Hydrate(ctx context.Context, groups ...*prop.Resource) error {
+	var ids []string
+	for _, group := range groups {
+		if err := forEachMember(group, func(nav prop.Navigator, id string) error {
+			ids = append(ids, id)
+			return nil
+		}); err != nil {
+			return err
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	members, err := h.lookup(ctx, ids)
+	if err != nil {
+		return err
+	}
+
+	for _, group := range groups {
+		if err := forEachMember(group, func(nav prop.Navigator, id string) error {
+			member, ok := members[id]
+			if !ok {
+				return nil
+			}
+			if display := displayOf(member); display != nil {
+				if nav.Dot("display").Replace(display).HasError() {
+					return nav.Error()
+				}
+				nav.Retract()
+			}
+			if location := member.MetaLocationOrEmpty(); len(location) > 0 {
+				if nav.Dot("$ref").Replace(location).HasError() {
+					return nav.Error()
+				}
+				nav.Retract()
+			}
+			return nil
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Returns the member resources by id, looking up the users first, then the groups.
+func (h *Hydrator) lookup(ctx context.Context, ids []string) (map[string]*prop.Resource, error) {
+	members := make(map[string]*prop.Resource, len(ids))
+
+	users, err := db.GetMany(ctx, h.userDB, ids, &crud.Projection{
+		Attributes: []string{"id", "meta.location", "displayName", "userName"},
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, user := range users {
+		members[user.IdOrEmpty()] = user
+	}
+
+	var remaining []string
+	for _, id := range ids {
+		if _, ok := members[id]; !ok {
+			remaining = append(remaining, id)
+		}
+	}
+	if len(remaining) == 0 {
+		return members, nil
+	}
+
+	groups, err := db.GetMany(ctx, h.groupDB, remaining, &crud.Projection{
+		Attributes: []string{"id", "meta.location", "displayName"},
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, group := range groups {
+		members[group.IdOrEmpty()] = group
+	}
+	return members, nil
+}
+
+// Calls the callback with the navigator focused on every member of the group that has a value.
+func forEachMember(group *prop.Resource, callback func(nav prop.Navigator, id string) error) error {
+	nav := group.Navigator().Dot("members")
+	if nav.HasError() {
+		return nav.Error()
+	}
+
+	for i := 0; i < nav.Current().CountChildren(); i++ {
+		if nav.At(i).HasError() {
+			return nav.Error()
+		}
+		value := nav.Dot("value")
+		if value.HasError() {
+			return nav.Error()
+		}
+		id, _ := value.Current().Raw().(string)
+		nav.Retract()
+
+		if len(id) > 0 {
+			if err := callback(nav, id); err != nil {
+				return err
+			}
+		}
+		nav.Retract()
+	}
+	return nil
+}
+
+func displayOf(member *prop.Resource) interface{} {
+	for _, name := range []string{"displayName", "userName"} {
+		nav := member.Navigator().Dot(name)
+		if nav.HasError() {
+			continue
+		}
+		if display := nav.Current().Raw(); display != nil {
+			return display
+		}
+	}
+	return nil
+}
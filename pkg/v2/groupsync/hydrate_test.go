@@ -0,0 +1,173 @@
+package groupsync
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/imulab/go-scim/pkg/v2/crud"
+	"github.com/imulab/go-scim/pkg/v2/db"
+	"github.com/imulab/go-scim/pkg/v2/prop"
+	"github.com/imulab/go-scim/pkg/v2/spec"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestHydrator(t *testing.T) {
+	s := new(HydratorTestSuite)
+	suite.Run(t, s)
+}
+
+type HydratorTestSuite struct {
+	suite.Suite
+	userResourceType  *spec.ResourceType
+	groupResourceType *spec.ResourceType
+}
+
+// Counts the calls to Get and GetMany of the database.
+type countingDB struct {
+	db.DB
+	gets     int
+	getManys int
+}
+
+func (d *countingDB) Get(ctx context.Context, id string, projection *crud.Projection) (*prop.Resource, error) {
+	d.gets++
+	return d.DB.Get(ctx, id, projection)
+}
+
+func (d *countingDB) GetMany(ctx context.Context, ids []string, projection *crud.Projection) ([]*prop.Resource, error) {
+	d.getManys++
+	return db.GetMany(ctx, d.DB, ids, projection)
+}
+
+func (s *HydratorTestSuite) TestHydrate() {
+	var (
+		userDB  = &countingDB{DB: db.Memory()}
+		groupDB = &countingDB{DB: db.Memory()}
+	)
+	for _, data := range []map[string]interface{}{
+		{"id": "u1", "userName": "foo", "displayName": "Foo", "meta": map[string]interface{}{"location": "/Users/u1"}},
+		{"id": "u2", "userName": "bar", "meta": map[string]interface{}{"location": "/Users/u2"}},
+	} {
+		data["schemas"] = []interface{}{"urn:ietf:params:scim:schemas:core:2.0:User"}
+		user := prop.NewResource(s.userResourceType)
+		require.False(s.T(), user.Navigator().Replace(data).HasError())
+		require.Nil(s.T(), userDB.Insert(context.Background(), user))
+	}
+
+	var groups []*prop.Resource
+	for _, data := range []map[string]interface{}{
+		{
+			"id":          "g1",
+			"displayName": "Staff",
+			"meta":        map[string]interface{}{"location": "/Groups/g1"},
+			"members": []interface{}{
+				map[string]interface{}{"value": "u1", "display": "stale"},
+				map[string]interface{}{"value": "g2"},
+				map[string]interface{}{"value": "missing", "display": "gone"},
+			},
+		},
+		{
+			"id":          "g2",
+			"displayName": "Engineering",
+			"meta":        map[string]interface{}{"location": "/Groups/g2"},
+			"members": []interface{}{
+				map[string]interface{}{"value": "u1"},
+				map[string]interface{}{"value": "u2"},
+			},
+		},
+	} {
+		data["schemas"] = []interface{}{"urn:ietf:params:scim:schemas:core:2.0:Group"}
+		group := prop.NewResource(s.groupResourceType)
+		require.False(s.T(), group.Navigator().Replace(data).HasError())
+		require.Nil(s.T(), groupDB.Insert(context.Background(), group))
+		groups = append(groups, group)
+	}
+
+	err := NewHydrator(userDB, groupDB).Hydrate(context.Background(), groups...)
+	require.Nil(s.T(), err)
+
+	// one lookup for all the members of all the groups
+	assert.Equal(s.T(), 0, userDB.gets+groupDB.gets)
+	assert.Equal(s.T(), 1, userDB.getManys)
+	assert.Equal(s.T(), 1, groupDB.getManys)
+
+	assert.Equal(s.T(), []interface{}{
+		map[string]interface{}{"value": "u1", "$ref": "/Users/u1", "display": "Foo"},
+		map[string]interface{}{"value": "g2", "$ref": "/Groups/g2", "display": "Engineering"},
+		map[string]interface{}{"value": "missing", "display": "gone"},
+	}, groups[0].Navigator().Dot("members").Current().Raw())
+	assert.Equal(s.T(), []interface{}{
+		map[string]interface{}{"value": "u1", "$ref": "/Users/u1", "display": "Foo"},
+		map[string]interface{}{"value": "u2", "$ref": "/Users/u2", "display": "bar"},
+	}, groups[1].Navigator().Dot("members").Current().Raw())
+}
+
+func (s *HydratorTestSuite) SetupSuite() {
+	for _, each := range []struct {
+		filepath  string
+		structure interface{}
+		post      func(parsed interface{})
+	}{
+		{
+			filepath:  "../../../public/schemas/core_schema.json",
+			structure: new(spec.Schema),
+			post: func(parsed interface{}) {
+				spec.Schemas().Register(parsed.(*spec.Schema))
+			},
+		},
+		{
+			filepath:  "../../../public/schemas/user_schema.json",
+			structure: new(spec.Schema),
+			post: func(parsed interface{}) {
+				spec.Schemas().Register(parsed.(*spec.Schema))
+			},
+		},
+		{
+			filepath:  "../../../public/schemas/user_enterprise_extension_schema.json",
+			structure: new(spec.Schema),
+			post: func(parsed interface{}) {
+				spec.Schemas().Register(parsed.(*spec.Schema))
+			},
+		},
+		{
+			filepath:  "../../../public/schemas/group_schema.json",
+			structure: new(spec.Schema),
+			post: func(parsed interface{}) {
+				spec.Schemas().Register(parsed.(*spec.Schema))
+			},
+		},
+		{
+			filepath:  "../../../public/resource_types/user_resource_type.json",
+			structure: new(spec.ResourceType),
+			post: func(parsed interface{}) {
+				s.userResourceType = parsed.(*spec.ResourceType)
+				crud.Register(s.userResourceType)
+			},
+		},
+		{
+			filepath:  "../../../public/resource_types/group_resource_type.json",
+			structure: new(spec.ResourceType),
+			post: func(parsed interface{}) {
+				s.groupResourceType = parsed.(*spec.ResourceType)
+				crud.Register(s.groupResourceType)
+			},
+		},
+	} {
+		f, err := os.Open(each.filepath)
+		require.Nil(s.T(), err)
+
+		raw, err := ioutil.ReadAll(f)
+		require.Nil(s.T(), err)
+
+		err = json.Unmarshal(raw, each.structure)
+		require.Nil(s.T(), err)
+
+		if each.post != nil {
+			each.post(each.structure)
+		}
+	}
+}
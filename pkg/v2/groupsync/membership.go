@@ -0,0 +1,149 @@
+package groupsync
+
+import (
+	"context"
+	"github.com/imulab/go-scim/pkg/v2/crud"
+	"github.com/imulab/go-scim/pkg/v2/prop"
+)
+
+// DefaultMaxDepth is the maximum depth of the memberships resolved by a SyncService created with NewSyncService.
+const DefaultMaxDepth = 16
+
+// Membership of a member in a group, either direct, or indirect through the groups that are members of the group.
+type Membership struct {
+	// Group is the group, with its id, meta.location and displayName only.
+	Group *prop.Resource
+	// Depth is 1 for the groups the member is a direct member of, 2 for the groups those groups are direct members of,
+	// and so on. When the member is a member of a group through several paths, it is the depth of the shortest.
+	Depth int
+	// Via is the id of the direct member of the group through which the member is a member: the member itself when
+	// direct, or the id of a group of the previous depth otherwise.
+	Via string
+}
+
+// Direct returns true if the member is a direct member of the group.
+func (m *Membership) Direct() bool {
+	return m.Depth == 1
+}
+
+// Type returns the type of the membership, as the "type" sub attribute of User.groups: "direct" or "indirect".
+func (m *Membership) Type() string {
+	if m.Direct() {
+		return "direct"
+	}
+	return "indirect"
+}
+
+// Memberships resolves the groups of which the member, a user or a group, is a member, directly or indirectly, up to
+// the maximum depth of the service. Memberships are returned by increasing depth, and every group appears once.
+//
+// Groups containing, directly or indirectly, themselves do not loop the resolution, as every group is resolved once;
+// the cycles found among the groups resolved are reported to the OnCycle option of the service, if any, as the ids of
+// the groups of the cycle, from a group back to itself, where every group is a direct member of the next, i.e. [g1 g2 g1]
+// when g1 is a member of g2, which is a member of g1.
+//
+// The group database is searched once for every group resolved. The ctx context can be used to set a timeline or cancel
+// the resolution, which is respected before every search.
+func (s *SyncService) Memberships(ctx context.Context, member string) ([]*Membership, error) {
+	var (
+		memberships []*Membership
+		resolved    = map[string]struct{}{member: {}}
+		edges       = map[string][]string{} // ids of the groups of which every member resolved is a direct member
+		frontier    = []string{member}
+	)
+
+	for depth := 1; depth <= s.maxDepth() && len(frontier) > 0; depth++ {
+		var next []string
+		for _, via := range frontier {
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			default:
+			}
+
+			groups, err := s.searchGroupsForMember(ctx, via)
+			if err != nil {
+				return nil, err
+			}
+			for _, group := range groups {
+				id := group.IdOrEmpty()
+				if len(id) == 0 {
+					continue
+				}
+				edges[via] = append(edges[via], id)
+				if _, ok := resolved[id]; ok {
+					continue
+				}
+				resolved[id] = struct{}{}
+				memberships = append(memberships, &Membership{Group: group, Depth: depth, Via: via})
+				next = append(next, id)
+			}
+		}
+		frontier = next
+	}
+
+	if s.options.OnCycle != nil {
+		forEachCycle(member, edges, s.options.OnCycle)
+	}
+	return memberships, nil
+}
+
+// Calls fn with the cycles closed by the edges visited from the member in depth first order.
+func forEachCycle(member string, edges map[string][]string, fn func(cycle []string)) {
+	const (
+		visiting = iota + 1
+		visited
+	)
+	var (
+		state = map[string]int{}
+		path  []string
+		visit func(id string)
+	)
+	visit = func(id string) {
+		state[id] = visiting
+		path = append(path, id)
+		for _, group := range edges[id] {
+			switch state[group] {
+			case visiting:
+				for i := len(path) - 1; i >= 0; i-- {
+					if path[i] == group {
+						cycle := append(append([]string{}, path[i:]...), group)
+						fn(cycle)
+						break
+					}
+				}
+			case visited:
+			default:
+				visit(group)
+			}
+		}
+		path = path[:len(path)-1]
+		state[id] = visited
+	}
+	visit(member)
+}
+
+// EffectiveGroups resolves the memberships of every member (see Memberships), i.e. to compute the "groups" of many users
+// at once. Groups resolved for a member are resolved again for the next, hence the group database shall be cheap to
+// search by "members.value".
+func (s *SyncService) EffectiveGroups(ctx context.Context, members ...string) (map[string][]*Membership, error) {
+	effective := make(map[string][]*Membership, len(members))
+	for _, member := range members {
+		if _, ok := effective[member]; ok {
+			continue
+		}
+		memberships, err := s.Memberships(ctx, member)
+		if err != nil {
+			return nil, err
+		}
+		effective[member] = memberships
+	}
+	return effective, nil
+}
+
+func (s *SyncService) searchGroupsForMember(ctx context.Context, member string) ([]*prop.Resource, error) {
+	filter := crud.Filter().Eq("members.value", member)
+	return s.groupDB.Query(ctx, filter.String(), nil, nil, &crud.Projection{
+		Attributes: []string{"id", "meta.location", "displayName"},
+	})
+}
@@ -0,0 +1,116 @@
+package groupsync
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/imulab/go-scim/pkg/v2/prop"
+	"github.com/imulab/go-scim/pkg/v2/tenant"
+	"github.com/satori/go.uuid"
+	"time"
+)
+
+// Message asks for the "groups" of a member of a group to be synchronized, after the member joined or left the group,
+// so that group sync can be carried out by workers consuming the messages from a broker (see Consume). The message only
+// identifies the member: its application resolves the memberships from the current state of the groups (see Applier),
+// hence messages may be applied more than once, and in any order.
+type Message struct {
+	// ID is the unique id of the message, which brokers supporting it use to discard messages published twice.
+	ID string `json:"id"`
+	// Tenant is the tenant of the group, if any (see tenant.From).
+	Tenant string `json:"tenant,omitempty"`
+	// GroupID is the id of the group the member joined or left.
+	GroupID string `json:"group_id"`
+	// MemberID is the id of the member, a user or a group.
+	MemberID string `json:"member_id"`
+	// Event is whether the member "joined" or "left" the group, according to the diff the message was published for.
+	// The application of the message does not depend on it, as messages may be applied in any order.
+	Event string `json:"event,omitempty"`
+	// GroupDisplay is the displayName of the group, at the time of the change.
+	GroupDisplay string `json:"group_display,omitempty"`
+	// Member is the member that joined the group, or left it, as it was in the group at the time of the change, with
+	// its "$ref", "display" and "type", so that consumers do not need to look it up. It is not set on messages
+	// expanded to the members of the member (see Via).
+	Member *Member `json:"member,omitempty"`
+	// Via are the ids of the groups whose members were expanded into this message, from the member of the first
+	// message, when the members of groups that joined or left the group are synchronized in turn.
+	Via []string `json:"via,omitempty"`
+	// Time is when the membership changed, from which the lag of group sync is measured.
+	Time time.Time `json:"time"`
+}
+
+// Events of messages
+const (
+	EventJoined = "joined"
+	EventLeft   = "left"
+)
+
+// Messages returns a message for every member that joined or left the group, according to the diff (see Compare), for
+// the tenant carried by the context, if any.
+func Messages(ctx context.Context, group *prop.Resource, diff *Diff) []*Message {
+	var (
+		messages []*Message
+		now      = time.Now()
+	)
+	display := diff.GroupDisplayName()
+	if len(display) == 0 {
+		display, _ = stringOf(group.RootProperty(), "displayName")
+	}
+	add := func(event string) func(member Member) {
+		return func(member Member) {
+			messages = append(messages, &Message{
+				ID:           uuid.NewV4().String(),
+				Tenant:       tenant.From(ctx),
+				GroupID:      group.IdOrEmpty(),
+				MemberID:     member.Value,
+				Event:        event,
+				GroupDisplay: display,
+				Member:       &member,
+				Time:         now,
+			})
+		}
+	}
+	diff.ForEachJoinedMember(add(EventJoined))
+	diff.ForEachLeftMember(add(EventLeft))
+	return messages
+}
+
+// expand returns the message for the member of the group which is the member of this message. Its id is derived from
+// the id of this message, so that the messages expanded again from a message delivered twice can be discarded too.
+func (m *Message) expand(member string) *Message {
+	return &Message{
+		ID:           uuid.NewV5(uuid.NamespaceOID, m.ID+"/"+member).String(),
+		Tenant:       m.Tenant,
+		GroupID:      m.GroupID,
+		MemberID:     member,
+		Event:        m.Event,
+		GroupDisplay: m.GroupDisplay,
+		Via:          append(append([]string{}, m.Via...), m.MemberID),
+		Time:         m.Time,
+	}
+}
+
+// key returns the key of the message, by which messages are ordered by the brokers supporting it.
+func (m *Message) key() string {
+	if len(m.Tenant) > 0 {
+		return m.Tenant + "/" + m.MemberID
+	}
+	return m.MemberID
+}
+
+// Marshal returns the JSON encoding of the message, as published by the message broker adapters.
+func Marshal(message *Message) ([]byte, error) {
+	return json.Marshal(message)
+}
+
+// Publisher publishes messages to a broker.
+type Publisher interface {
+	// Publish the message. Once Publish has returned without error, the message shall be delivered at least once.
+	Publish(ctx context.Context, message *Message) error
+}
+
+// PublisherFunc adapts a function to Publisher.
+type PublisherFunc func(ctx context.Context, message *Message) error
+
+func (f PublisherFunc) Publish(ctx context.Context, message *Message) error {
+	return f(ctx, message)
+}
@@ -2,31 +2,89 @@ package groupsync
 
 import (
 	"context"
-	"fmt"
-	"github.com/imulab/go-scim/pkg/v2/crud"
 	"github.com/imulab/go-scim/pkg/v2/db"
 	"github.com/imulab/go-scim/pkg/v2/prop"
-	"strconv"
 )
 
-// NewSyncService returns a new SyncService.
+// NewSyncService returns a new SyncService, which resolves memberships up to DefaultMaxDepth.
 func NewSyncService(groupDB db.DB) *SyncService {
-	s := SyncService{groupDB: groupDB}
+	return NewSyncServiceWithOptions(groupDB, SyncOptions{})
+}
+
+// NewSyncServiceWithOptions returns a new SyncService with the options.
+func NewSyncServiceWithOptions(groupDB db.DB, options SyncOptions) *SyncService {
+	s := SyncService{groupDB: groupDB, options: options}
 	return &s
 }
 
+// SyncOptions are the options of NewSyncServiceWithOptions.
+type SyncOptions struct {
+	// MaxDepth is the maximum depth of the memberships resolved (see Membership): 1 resolves the direct memberships
+	// only. Groups nested deeper are left out. Zero means DefaultMaxDepth.
+	MaxDepth int
+	// OnCycle, if not nil, is called with the groups of every cycle found while resolving memberships (see Memberships),
+	// i.e. to log them, so that they are fixed.
+	OnCycle func(cycle []string)
+}
+
 // SyncService synchronizes the user resource's "groups" property.
 type SyncService struct {
 	groupDB db.DB
+	options SyncOptions
+}
+
+func (s *SyncService) maxDepth() int {
+	if s.options.MaxDepth > 0 {
+		return s.options.MaxDepth
+	}
+	return DefaultMaxDepth
 }
 
 // SyncGroupPropertyForUser updates the user's "groups" property, according to the latest state in Group resources. This
 // method does not save or replace the updated resource with the database. It is up to the caller to do so.
 //
-// Due to nested membership, this method may search the group database multiple times, which may turn out to be a lengthy
-// process. The ctx context can be used to set a timeline or cancel the processing, this method will respect that at
-// appropriate intervals.
+// The property has an element for every group resolved by Memberships, whose "type" is "direct" or "indirect", in the
+// order of their depth. Due to nested membership, this method may search the group database multiple times, which may
+// turn out to be a lengthy process. The ctx context can be used to set a timeline or cancel the processing, this method
+// will respect that at appropriate intervals.
 func (s *SyncService) SyncGroupPropertyForUser(ctx context.Context, user *prop.Resource) error {
+	memberships, err := s.Memberships(ctx, user.IdOrEmpty())
+	if err != nil {
+		return err
+	}
+	return s.setGroupProperty(user, memberships)
+}
+
+// SyncGroupPropertyForUsers updates the "groups" property of every user like SyncGroupPropertyForUser, i.e. to compute
+// it for the users returned to clients (see EffectiveGroups). Users without id are left unchanged. This method does
+// not save or replace the updated resources with the database.
+func (s *SyncService) SyncGroupPropertyForUsers(ctx context.Context, users ...*prop.Resource) error {
+	var ids []string
+	for _, user := range users {
+		if id := user.IdOrEmpty(); len(id) > 0 {
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	effective, err := s.EffectiveGroups(ctx, ids...)
+	if err != nil {
+		return err
+	}
+	for _, user := range users {
+		if id := user.IdOrEmpty(); len(id) > 0 {
+			if err := s.setGroupProperty(user, effective[id]); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Replaces the "groups" property of the user with an element for every membership.
+func (s *SyncService) setGroupProperty(user *prop.Resource, memberships []*Membership) error {
 	groupNav := user.Navigator().Dot("groups")
 	if groupNav.HasError() {
 		return groupNav.Error()
@@ -37,85 +95,33 @@ func (s *SyncService) SyncGroupPropertyForUser(ctx context.Context, user *prop.R
 		return groupNav.Error()
 	}
 
-	// task definition and queue
-	type task struct {
-		member string
-		direct bool
-	}
-	tasks := []task{
-		{member: user.IdOrEmpty(), direct: true},
-	}
-
-	// map to record the completed group ids, so we don't fall into cycles
-	completed := map[string]struct{}{}
-
-	for len(tasks) > 0 {
-		// check if context was closed
-		select {
-		case <-ctx.Done():
-			return ctx.Err()
-		default:
-		}
-
-		// pop first task
-		t := tasks[0]
-		tasks = tasks[1:]
+	for _, membership := range memberships {
+		// create new group element and modify the value
+		if err := func() error {
+			index := groupNav.Current().(interface {
+				AppendElement() int
+			}).AppendElement()
 
-		groups, err := s.searchGroupsForMember(ctx, t.member)
-		if err != nil {
-			return err
-		}
-		for _, group := range groups {
-			// create new group element and modify the value
-			if err := func() error {
-				index := groupNav.Current().(interface {
-					AppendElement() int
-				}).AppendElement()
-
-				if groupNav.At(index); groupNav.HasError() {
-					return groupNav.Error()
-				}
-				defer groupNav.Retract()
-
-				return groupNav.Replace(s.formulateGroupElementData(group, t.direct)).Error()
-			}(); err != nil {
-				return err
+			if groupNav.At(index); groupNav.HasError() {
+				return groupNav.Error()
 			}
+			defer groupNav.Retract()
 
-			// submit new indirect tasks if not processed before
-			groupId := group.IdOrEmpty()
-			if _, processed := completed[groupId]; !processed {
-				tasks = append(tasks, task{
-					member: groupId,
-					direct: false,
-				})
-			}
+			return groupNav.Replace(s.formulateGroupElementData(membership)).Error()
+		}(); err != nil {
+			return err
 		}
-
-		// mark this task as completed
-		completed[t.member] = struct{}{}
 	}
 
 	return nil
 }
 
-func (s *SyncService) formulateGroupElementData(group *prop.Resource, direct bool) map[string]interface{} {
-	data := map[string]interface{}{
+func (s *SyncService) formulateGroupElementData(membership *Membership) map[string]interface{} {
+	group := membership.Group
+	return map[string]interface{}{
 		"value":   group.IdOrEmpty(),
 		"$ref":    group.MetaLocationOrEmpty(),
 		"display": group.Navigator().Dot("displayName").Current().Raw(),
+		"type":    membership.Type(),
 	}
-	if direct {
-		data["type"] = "direct"
-	} else {
-		data["type"] = "indirect"
-	}
-	return data
-}
-
-func (s *SyncService) searchGroupsForMember(ctx context.Context, member string) ([]*prop.Resource, error) {
-	filter := fmt.Sprintf("members.value eq %s", strconv.Quote(member))
-	return s.groupDB.Query(ctx, filter, nil, nil, &crud.Projection{
-		Attributes: []string{"id", "meta.location", "displayName"},
-	})
 }
@@ -3,6 +3,7 @@ package groupsync
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"github.com/imulab/go-scim/pkg/v2/crud"
 	"github.com/imulab/go-scim/pkg/v2/db"
 	"github.com/imulab/go-scim/pkg/v2/prop"
@@ -117,6 +118,182 @@ func (s *SyncServiceTestSuite) TestSyncGroupPropertyForUser() {
 	}
 }
 
+func (s *SyncServiceTestSuite) TestMemberships() {
+	// u1 is a direct member of g1 and g3, g1 of g2, g2 of g3, g3 of g1 and g4, and g4 of itself
+	getGroupDB := func(t *testing.T) db.DB {
+		database := db.Memory()
+		for id, members := range map[string][]string{
+			"g1": {"u1", "g3"},
+			"g2": {"g1"},
+			"g3": {"g2", "u1"},
+			"g4": {"g3", "g4"},
+		} {
+			var values []interface{}
+			for _, member := range members {
+				values = append(values, map[string]interface{}{"value": member})
+			}
+			g := prop.NewResource(s.groupResourceType)
+			require.False(t, g.Navigator().Replace(map[string]interface{}{
+				"schemas":     []interface{}{"urn:ietf:params:scim:schemas:core:2.0:Group"},
+				"id":          id,
+				"displayName": id,
+				"members":     values,
+			}).HasError())
+			require.Nil(t, database.Insert(context.Background(), g))
+		}
+		return database
+	}
+	summarize := func(memberships []*Membership) map[string]string {
+		summary := map[string]string{}
+		for _, m := range memberships {
+			summary[m.Group.IdOrEmpty()] = fmt.Sprintf("%s:%d:%s", m.Type(), m.Depth, m.Via)
+		}
+		return summary
+	}
+
+	tests := []struct {
+		name   string
+		member string
+		depth  int
+		expect func(t *testing.T, memberships []*Membership, cycles [][]string)
+	}{
+		{
+			name:   "direct and indirect memberships",
+			member: "u1",
+			expect: func(t *testing.T, memberships []*Membership, cycles [][]string) {
+				assert.Equal(t, map[string]string{
+					"g1": "direct:1:u1",
+					"g3": "direct:1:u1",
+					"g2": "indirect:2:g1",
+					"g4": "indirect:2:g3",
+				}, summarize(memberships))
+				assert.True(t, memberships[0].Direct())
+				assert.False(t, memberships[3].Direct())
+				assert.Len(t, cycles, 2)
+				assert.Contains(t, cycles, []string{"g1", "g2", "g3", "g1"})
+				assert.Contains(t, cycles, []string{"g4", "g4"})
+			},
+		},
+		{
+			name:   "depth limit",
+			member: "u1",
+			depth:  1,
+			expect: func(t *testing.T, memberships []*Membership, cycles [][]string) {
+				assert.Equal(t, map[string]string{
+					"g1": "direct:1:u1",
+					"g3": "direct:1:u1",
+				}, summarize(memberships))
+				assert.Empty(t, cycles)
+			},
+		},
+		{
+			name:   "memberships of a group in a cycle",
+			member: "g1",
+			expect: func(t *testing.T, memberships []*Membership, cycles [][]string) {
+				assert.Equal(t, map[string]string{
+					"g2": "direct:1:g1",
+					"g3": "indirect:2:g2",
+					"g4": "indirect:3:g3",
+				}, summarize(memberships))
+				assert.Len(t, cycles, 2)
+				assert.Contains(t, cycles, []string{"g1", "g2", "g3", "g1"})
+				assert.Contains(t, cycles, []string{"g4", "g4"})
+			},
+		},
+		{
+			name:   "no memberships",
+			member: "u2",
+			expect: func(t *testing.T, memberships []*Membership, cycles [][]string) {
+				assert.Empty(t, memberships)
+				assert.Empty(t, cycles)
+			},
+		},
+	}
+
+	for _, test := range tests {
+		s.T().Run(test.name, func(t *testing.T) {
+			var cycles [][]string
+			service := NewSyncServiceWithOptions(getGroupDB(t), SyncOptions{
+				MaxDepth: test.depth,
+				OnCycle: func(cycle []string) {
+					cycles = append(cycles, rotate(cycle))
+				},
+			})
+			memberships, err := service.Memberships(context.Background(), test.member)
+			require.Nil(t, err)
+			test.expect(t, memberships, cycles)
+		})
+	}
+}
+
+// Rotates the cycle to start with its least id, as it is reported from the group visited first.
+func rotate(cycle []string) []string {
+	least := 0
+	for i, id := range cycle {
+		if id < cycle[least] {
+			least = i
+		}
+	}
+	rotated := append(append([]string{}, cycle[least:len(cycle)-1]...), cycle[:least]...)
+	return append(rotated, rotated[0])
+}
+
+func (s *SyncServiceTestSuite) TestSyncGroupPropertyForUserIndirect() {
+	database := db.Memory()
+	for _, data := range []map[string]interface{}{
+		{"id": "g1", "displayName": "Engineering", "members": []interface{}{map[string]interface{}{"value": "u1"}}},
+		{"id": "g2", "displayName": "Staff", "members": []interface{}{map[string]interface{}{"value": "g1"}}},
+	} {
+		data["schemas"] = []interface{}{"urn:ietf:params:scim:schemas:core:2.0:Group"}
+		data["meta"] = map[string]interface{}{"location": "/Groups/" + data["id"].(string)}
+		g := prop.NewResource(s.groupResourceType)
+		require.False(s.T(), g.Navigator().Replace(data).HasError())
+		require.Nil(s.T(), database.Insert(context.Background(), g))
+	}
+
+	user := prop.NewResource(s.userResourceType)
+	require.False(s.T(), user.Navigator().Replace(map[string]interface{}{
+		"schemas": []interface{}{"urn:ietf:params:scim:schemas:core:2.0:User"},
+		"id":      "u1",
+	}).HasError())
+
+	// twice, as the property is replaced
+	for i := 0; i < 2; i++ {
+		require.Nil(s.T(), NewSyncService(database).SyncGroupPropertyForUser(context.Background(), user))
+	}
+	assert.Equal(s.T(), []interface{}{
+		map[string]interface{}{"value": "g1", "$ref": "/Groups/g1", "display": "Engineering", "type": "direct"},
+		map[string]interface{}{"value": "g2", "$ref": "/Groups/g2", "display": "Staff", "type": "indirect"},
+	}, user.Navigator().Dot("groups").Current().Raw())
+
+	effective, err := NewSyncService(database).EffectiveGroups(context.Background(), "u1", "u2", "g1")
+	require.Nil(s.T(), err)
+	assert.Len(s.T(), effective, 3)
+	assert.Len(s.T(), effective["u1"], 2)
+	assert.Empty(s.T(), effective["u2"])
+	assert.Len(s.T(), effective["g1"], 1)
+
+	// many users at once, with stale groups replaced
+	users := make([]*prop.Resource, 0, 2)
+	for _, id := range []string{"u1", "u2"} {
+		u := prop.NewResource(s.userResourceType)
+		require.False(s.T(), u.Navigator().Replace(map[string]interface{}{
+			"schemas": []interface{}{"urn:ietf:params:scim:schemas:core:2.0:User"},
+			"id":      id,
+			"groups":  []interface{}{map[string]interface{}{"value": "stale"}},
+		}).HasError())
+		users = append(users, u)
+	}
+	require.Nil(s.T(), NewSyncService(database).SyncGroupPropertyForUsers(context.Background(), users...))
+	assert.Equal(s.T(), user.Navigator().Dot("groups").Current().Raw(), users[0].Navigator().Dot("groups").Current().Raw())
+	assert.True(s.T(), users[1].Navigator().Dot("groups").Current().IsUnassigned())
+
+	// direct only
+	service := NewSyncServiceWithOptions(database, SyncOptions{MaxDepth: 1})
+	require.Nil(s.T(), service.SyncGroupPropertyForUser(context.Background(), user))
+	assert.Equal(s.T(), 1, user.Navigator().Dot("groups").Current().CountChildren())
+}
+
 func (s *SyncServiceTestSuite) SetupSuite() {
 	for _, each := range []struct {
 		filepath  string
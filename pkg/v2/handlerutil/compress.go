@@ -0,0 +1,182 @@
+package handlerutil
+
+import (
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"github.com/imulab/go-scim/pkg/v2/spec"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// CompressOptions configures Compress.
+type CompressOptions struct {
+	// Level of the gzip compression of the responses, from gzip.BestSpeed to gzip.BestCompression. Zero, or any level
+	// out of range, is gzip.DefaultCompression.
+	Level int
+}
+
+// Compress returns a http.Handler which decompresses the gzip encoded request bodies, and gzip encodes the responses of
+// the clients that accept it, around the next handler. Request bodies of other encodings are answered with an error of
+// spec.ErrUnsupportedMediaType (415), and those which are not valid gzip with an error of spec.ErrInvalidSyntax. The
+// responses without content, or already encoded by the next handler, are left as they are.
+func Compress(options CompressOptions, next http.Handler) http.Handler {
+	level := options.Level
+	if level < gzip.HuffmanOnly || level > gzip.BestCompression {
+		level = gzip.DefaultCompression
+	}
+	return &compressor{
+		next: next,
+		writers: sync.Pool{New: func() interface{} {
+			w, _ := gzip.NewWriterLevel(ioutil.Discard, level)
+			return w
+		}},
+	}
+}
+
+type compressor struct {
+	next    http.Handler
+	writers sync.Pool
+}
+
+func (c *compressor) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	if err := c.decompress(r); err != nil {
+		_ = WriteError(rw, err)
+		return
+	}
+
+	rw.Header().Add("Vary", "Accept-Encoding")
+	if r.Method == http.MethodHead || quality(r.Header.Get("Accept-Encoding"), func(coding string) int {
+		switch coding {
+		case "gzip", "x-gzip":
+			return 2
+		case "*":
+			return 1
+		default:
+			return 0
+		}
+	}) == 0 {
+		c.next.ServeHTTP(rw, r)
+		return
+	}
+
+	w := &gzipWriter{ResponseWriter: rw, pool: &c.writers}
+	defer w.close()
+	c.next.ServeHTTP(w, r)
+}
+
+// Replaces the body of gzip encoded requests with its decompressed content.
+func (c *compressor) decompress(r *http.Request) error {
+	switch encoding := strings.ToLower(strings.TrimSpace(r.Header.Get("Content-Encoding"))); encoding {
+	case "", "identity":
+		return nil
+	case "gzip", "x-gzip":
+		if r.Body == nil || r.Body == http.NoBody {
+			return nil
+		}
+	default:
+		return fmt.Errorf("%w: Content-Encoding '%s' is not supported, must be 'gzip'", spec.ErrUnsupportedMediaType, encoding)
+	}
+
+	gz, err := gzip.NewReader(r.Body)
+	if err != nil {
+		return gzipError(err)
+	}
+	r.Body = &gzipBody{Reader: gz, body: r.Body}
+	r.ContentLength = -1
+	r.Header.Del("Content-Encoding")
+	r.Header.Del("Content-Length")
+	return nil
+}
+
+// Returns the error of decompressing a request body. Errors of the body, i.e. of spec.ErrPayloadTooLarge from
+// LimitBody, are returned as they are; others are reported as errors of spec.ErrInvalidSyntax.
+func gzipError(err error) error {
+	var scimErr *spec.Error
+	if errors.As(err, &scimErr) {
+		return err
+	}
+	return fmt.Errorf("%w: request body is not valid gzip", spec.ErrInvalidSyntax)
+}
+
+// gzipBody is the decompressed body of a gzip encoded request.
+type gzipBody struct {
+	*gzip.Reader
+	body io.ReadCloser
+}
+
+func (b *gzipBody) Read(p []byte) (int, error) {
+	n, err := b.Reader.Read(p)
+	if err != nil && err != io.EOF {
+		err = gzipError(err)
+	}
+	return n, err
+}
+
+func (b *gzipBody) Close() error {
+	_ = b.Reader.Close()
+	return b.body.Close()
+}
+
+// gzipWriter is a http.ResponseWriter which gzip encodes the response, unless it has no content or is already encoded.
+type gzipWriter struct {
+	http.ResponseWriter
+	pool        *sync.Pool
+	gz          *gzip.Writer
+	wroteHeader bool
+}
+
+func (w *gzipWriter) WriteHeader(status int) {
+	if w.wroteHeader || status < 200 {
+		w.ResponseWriter.WriteHeader(status)
+		return
+	}
+	w.wroteHeader = true
+
+	h := w.Header()
+	if status != http.StatusNoContent && status != http.StatusNotModified && len(h.Get("Content-Encoding")) == 0 {
+		h.Set("Content-Encoding", "gzip")
+		h.Del("Content-Length")
+		w.gz = w.pool.Get().(*gzip.Writer)
+		w.gz.Reset(w.ResponseWriter)
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *gzipWriter) Write(p []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.gz == nil {
+		return w.ResponseWriter.Write(p)
+	}
+	return w.gz.Write(p)
+}
+
+func (w *gzipWriter) Flush() {
+	if w.gz != nil {
+		_ = w.gz.Flush()
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Writes the rest of the compressed response, and returns the gzip writer to the pool.
+func (w *gzipWriter) close() {
+	if w.gz == nil {
+		return
+	}
+	_ = w.gz.Close()
+	w.gz.Reset(ioutil.Discard)
+	w.pool.Put(w.gz)
+	w.gz = nil
+}
+
+var (
+	_ http.Handler = (*compressor)(nil)
+	_ http.Flusher = (*gzipWriter)(nil)
+)
@@ -0,0 +1,154 @@
+package handlerutil
+
+import (
+	"bytes"
+	"compress/gzip"
+	"github.com/imulab/go-scim/pkg/v2/spec"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCompress(t *testing.T) {
+	payload := `{"schemas":["urn:ietf:params:scim:schemas:core:2.0:User"],"userName":"foo"}`
+	gzipped := func(t *testing.T, s string) []byte {
+		buf := new(bytes.Buffer)
+		gz := gzip.NewWriter(buf)
+		_, err := gz.Write([]byte(s))
+		require.Nil(t, err)
+		require.Nil(t, gz.Close())
+		return buf.Bytes()
+	}
+
+	// echoes the request body, or answers with no content if there is none
+	next := http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		raw, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			_ = WriteError(rw, err)
+			return
+		}
+		if len(raw) == 0 {
+			rw.WriteHeader(http.StatusNoContent)
+			return
+		}
+		rw.Header().Set("Content-Type", spec.ApplicationScimJson)
+		rw.WriteHeader(http.StatusOK)
+		_, _ = rw.Write(raw)
+	})
+
+	tests := []struct {
+		name    string
+		handler http.Handler
+		request func(t *testing.T) *http.Request
+		expect  func(t *testing.T, rr *httptest.ResponseRecorder)
+	}{
+		{
+			name: "gzip request and response",
+			request: func(t *testing.T) *http.Request {
+				r := httptest.NewRequest(http.MethodPost, "/Users", bytes.NewReader(gzipped(t, payload)))
+				r.Header.Set("Content-Encoding", "gzip")
+				r.Header.Set("Accept-Encoding", "deflate, gzip;q=0.8")
+				return r
+			},
+			expect: func(t *testing.T, rr *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusOK, rr.Code)
+				assert.Equal(t, "gzip", rr.Header().Get("Content-Encoding"))
+				assert.Equal(t, "Accept-Encoding", rr.Header().Get("Vary"))
+				gz, err := gzip.NewReader(rr.Body)
+				require.Nil(t, err)
+				raw, err := ioutil.ReadAll(gz)
+				require.Nil(t, err)
+				assert.Equal(t, payload, string(raw))
+			},
+		},
+		{
+			name: "identity response",
+			request: func(t *testing.T) *http.Request {
+				return httptest.NewRequest(http.MethodPost, "/Users", strings.NewReader(payload))
+			},
+			expect: func(t *testing.T, rr *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusOK, rr.Code)
+				assert.Empty(t, rr.Header().Get("Content-Encoding"))
+				assert.Equal(t, payload, rr.Body.String())
+			},
+		},
+		{
+			name: "gzip refused",
+			request: func(t *testing.T) *http.Request {
+				r := httptest.NewRequest(http.MethodPost, "/Users", strings.NewReader(payload))
+				r.Header.Set("Accept-Encoding", "*, gzip;q=0")
+				return r
+			},
+			expect: func(t *testing.T, rr *httptest.ResponseRecorder) {
+				assert.Empty(t, rr.Header().Get("Content-Encoding"))
+				assert.Equal(t, payload, rr.Body.String())
+			},
+		},
+		{
+			name: "no content",
+			request: func(t *testing.T) *http.Request {
+				r := httptest.NewRequest(http.MethodDelete, "/Users/foo", nil)
+				r.Header.Set("Accept-Encoding", "gzip")
+				return r
+			},
+			expect: func(t *testing.T, rr *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusNoContent, rr.Code)
+				assert.Empty(t, rr.Header().Get("Content-Encoding"))
+				assert.Empty(t, rr.Body.Bytes())
+			},
+		},
+		{
+			name: "corrupt gzip request",
+			request: func(t *testing.T) *http.Request {
+				raw := gzipped(t, payload)
+				raw[len(raw)-5] ^= 0xff
+				r := httptest.NewRequest(http.MethodPost, "/Users", bytes.NewReader(raw))
+				r.Header.Set("Content-Encoding", "gzip")
+				return r
+			},
+			expect: func(t *testing.T, rr *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusBadRequest, rr.Code)
+				assert.Contains(t, rr.Body.String(), spec.ErrInvalidSyntax.Type)
+			},
+		},
+		{
+			name: "other encoding",
+			request: func(t *testing.T) *http.Request {
+				r := httptest.NewRequest(http.MethodPost, "/Users", strings.NewReader(payload))
+				r.Header.Set("Content-Encoding", "br")
+				return r
+			},
+			expect: func(t *testing.T, rr *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusUnsupportedMediaType, rr.Code)
+			},
+		},
+		{
+			name:    "decompressed request over limit",
+			handler: Compress(CompressOptions{}, LimitBody(1024, next)),
+			request: func(t *testing.T) *http.Request {
+				r := httptest.NewRequest(http.MethodPost, "/Users", bytes.NewReader(gzipped(t, strings.Repeat(" ", 1<<20))))
+				r.Header.Set("Content-Encoding", "gzip")
+				return r
+			},
+			expect: func(t *testing.T, rr *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusRequestEntityTooLarge, rr.Code)
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			handler := test.handler
+			if handler == nil {
+				handler = Compress(CompressOptions{Level: gzip.BestSpeed}, next)
+			}
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, test.request(t))
+			test.expect(t, rr)
+		})
+	}
+}
@@ -0,0 +1,198 @@
+package handlerutil
+
+import (
+	"fmt"
+	"github.com/imulab/go-scim/pkg/v2/spec"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const applicationJson = "application/json"
+
+// ContentOptions configures NegotiateContent.
+type ContentOptions struct {
+	// Strict, if true, only accepts application/scim+json: request bodies must declare it as their Content-Type, and
+	// clients must accept it. Otherwise, application/json is accepted too, as RFC 7644 section 3.1 recommends: request
+	// bodies may be of either, or declare no Content-Type at all, and clients that only accept application/json are
+	// answered with it.
+	Strict bool
+}
+
+// NegotiateContent returns a http.Handler which enforces the SCIM media type on the requests before calling the next
+// handler. Requests whose body is not of an accepted media type, or not encoded in UTF-8, are answered with an error
+// of spec.ErrUnsupportedMediaType (415); and requests whose Accept or Accept-Charset headers accept none of the media
+// types served, or not UTF-8, with an error of spec.ErrNotAcceptable (406). Responses of application/scim+json are
+// served as application/json to the clients which prefer it, unless strict.
+func NegotiateContent(options ContentOptions, next http.Handler) http.Handler {
+	return &negotiator{options: options, next: next}
+}
+
+type negotiator struct {
+	options ContentOptions
+	next    http.Handler
+}
+
+func (n *negotiator) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	if err := n.checkContentType(r); err != nil {
+		_ = WriteError(rw, err)
+		return
+	}
+
+	mediaType, err := n.negotiate(r)
+	if err != nil {
+		_ = WriteError(rw, err)
+		return
+	}
+
+	if mediaType != spec.ApplicationScimJson {
+		rw = &contentTypeWriter{ResponseWriter: rw, mediaType: mediaType}
+	}
+	n.next.ServeHTTP(rw, r)
+}
+
+// Returns an error if the request has a body that is not of the accepted media types, or not encoded in UTF-8.
+func (n *negotiator) checkContentType(r *http.Request) error {
+	if r.Body == nil || r.Body == http.NoBody || r.ContentLength == 0 {
+		return nil
+	}
+
+	contentType := r.Header.Get("Content-Type")
+	if len(contentType) == 0 {
+		if n.options.Strict {
+			return fmt.Errorf("%w: Content-Type is required, must be '%s'", spec.ErrUnsupportedMediaType, spec.ApplicationScimJson)
+		}
+		return nil
+	}
+
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return fmt.Errorf("%w: Content-Type '%s' is malformed", spec.ErrUnsupportedMediaType, contentType)
+	}
+	if mediaType != spec.ApplicationScimJson && (n.options.Strict || mediaType != applicationJson) {
+		return fmt.Errorf("%w: Content-Type '%s' is not supported", spec.ErrUnsupportedMediaType, mediaType)
+	}
+	if charset, ok := params["charset"]; ok && !strings.EqualFold(charset, "utf-8") {
+		return fmt.Errorf("%w: charset '%s' is not supported, must be 'utf-8'", spec.ErrUnsupportedMediaType, charset)
+	}
+	return nil
+}
+
+// Returns the media type of the response the client prefers, or an error if it accepts none of them.
+func (n *negotiator) negotiate(r *http.Request) (string, error) {
+	if accept := r.Header.Get("Accept-Charset"); len(accept) > 0 {
+		if quality(accept, func(charset string) int {
+			switch {
+			case strings.EqualFold(charset, "utf-8"):
+				return 2
+			case charset == "*":
+				return 1
+			default:
+				return 0
+			}
+		}) == 0 {
+			return "", fmt.Errorf("%w: Accept-Charset does not accept 'utf-8'", spec.ErrNotAcceptable)
+		}
+	}
+
+	accept := r.Header.Get("Accept")
+	if len(accept) == 0 {
+		return spec.ApplicationScimJson, nil
+	}
+
+	scimQ := quality(accept, mediaRange(spec.ApplicationScimJson))
+	jsonQ := quality(accept, mediaRange(applicationJson))
+	switch {
+	case scimQ > 0 && (scimQ >= jsonQ || n.options.Strict):
+		return spec.ApplicationScimJson, nil
+	case jsonQ > 0 && !n.options.Strict:
+		return applicationJson, nil
+	default:
+		return "", fmt.Errorf("%w: Accept does not accept '%s'", spec.ErrNotAcceptable, spec.ApplicationScimJson)
+	}
+}
+
+// Returns a function which returns how specifically the range of an Accept header matches the media type: 3 if
+// exactly, 2 if only its type, 1 if the range is "*/*", and 0 if it does not match.
+func mediaRange(mediaType string) func(string) int {
+	return func(r string) int {
+		switch {
+		case strings.EqualFold(r, mediaType):
+			return 3
+		case strings.EqualFold(r, mediaType[:strings.IndexByte(mediaType, '/')]+"/*"):
+			return 2
+		case r == "*/*":
+			return 1
+		default:
+			return 0
+		}
+	}
+}
+
+// Returns the quality value, in (0, 1], of the element of the Accept header which most specifically matches, according
+// to match, or 0 if none matches (see RFC 7231 section 5.3).
+func quality(header string, match func(string) int) float64 {
+	var (
+		q           float64
+		specificity int
+	)
+	for _, element := range strings.Split(header, ",") {
+		// charsets are not media types, but parse likewise
+		value, params, err := mime.ParseMediaType(element)
+		if err != nil {
+			continue
+		}
+
+		s := match(value)
+		if s == 0 || s < specificity {
+			continue
+		}
+
+		elementQ := 1.0
+		if raw, ok := params["q"]; ok {
+			if elementQ, err = strconv.ParseFloat(raw, 64); err != nil {
+				continue
+			}
+		}
+		if s > specificity || elementQ > q {
+			q, specificity = elementQ, s
+		}
+	}
+	return q
+}
+
+// contentTypeWriter is a http.ResponseWriter which serves responses of application/scim+json as the media type.
+type contentTypeWriter struct {
+	http.ResponseWriter
+	mediaType   string
+	wroteHeader bool
+}
+
+func (w *contentTypeWriter) WriteHeader(status int) {
+	if !w.wroteHeader {
+		w.wroteHeader = true
+		if w.Header().Get("Content-Type") == spec.ApplicationScimJson {
+			w.Header().Set("Content-Type", w.mediaType)
+		}
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *contentTypeWriter) Write(p []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+func (w *contentTypeWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+var (
+	_ http.Handler = (*negotiator)(nil)
+	_ http.Flusher = (*contentTypeWriter)(nil)
+)
@@ -0,0 +1,208 @@
+package handlerutil
+
+import (
+	"github.com/imulab/go-scim/pkg/v2/spec"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestNegotiateContent(t *testing.T) {
+	next := http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		rw.Header().Set("Content-Type", spec.ApplicationScimJson)
+		rw.WriteHeader(http.StatusOK)
+		_, _ = rw.Write([]byte(`{}`))
+	})
+
+	tests := []struct {
+		name    string
+		options ContentOptions
+		method  string
+		headers map[string]string
+		expect  func(t *testing.T, rr *httptest.ResponseRecorder)
+	}{
+		{
+			name:   "scim body",
+			method: http.MethodPost,
+			headers: map[string]string{
+				"Content-Type": "application/scim+json; charset=UTF-8",
+			},
+			expect: func(t *testing.T, rr *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusOK, rr.Code)
+				assert.Equal(t, spec.ApplicationScimJson, rr.Header().Get("Content-Type"))
+			},
+		},
+		{
+			name:   "json body",
+			method: http.MethodPost,
+			headers: map[string]string{
+				"Content-Type": "application/json",
+			},
+			expect: func(t *testing.T, rr *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusOK, rr.Code)
+			},
+		},
+		{
+			name:    "json body when strict",
+			options: ContentOptions{Strict: true},
+			method:  http.MethodPost,
+			headers: map[string]string{
+				"Content-Type": "application/json",
+			},
+			expect: func(t *testing.T, rr *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusUnsupportedMediaType, rr.Code)
+				assert.Contains(t, rr.Body.String(), spec.ErrUnsupportedMediaType.Type)
+			},
+		},
+		{
+			name:   "body without content type",
+			method: http.MethodPatch,
+			expect: func(t *testing.T, rr *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusOK, rr.Code)
+			},
+		},
+		{
+			name:    "body without content type when strict",
+			options: ContentOptions{Strict: true},
+			method:  http.MethodPatch,
+			expect: func(t *testing.T, rr *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusUnsupportedMediaType, rr.Code)
+			},
+		},
+		{
+			name:   "xml body",
+			method: http.MethodPut,
+			headers: map[string]string{
+				"Content-Type": "application/xml",
+			},
+			expect: func(t *testing.T, rr *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusUnsupportedMediaType, rr.Code)
+			},
+		},
+		{
+			name:   "body of other charset",
+			method: http.MethodPut,
+			headers: map[string]string{
+				"Content-Type": "application/scim+json; charset=ISO-8859-1",
+			},
+			expect: func(t *testing.T, rr *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusUnsupportedMediaType, rr.Code)
+			},
+		},
+		{
+			name:   "accepts scim",
+			method: http.MethodGet,
+			headers: map[string]string{
+				"Accept": "application/scim+json, application/json;q=0.9",
+			},
+			expect: func(t *testing.T, rr *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusOK, rr.Code)
+				assert.Equal(t, spec.ApplicationScimJson, rr.Header().Get("Content-Type"))
+			},
+		},
+		{
+			name:   "prefers json",
+			method: http.MethodGet,
+			headers: map[string]string{
+				"Accept": "application/json, */*;q=0.1",
+			},
+			expect: func(t *testing.T, rr *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusOK, rr.Code)
+				assert.Equal(t, "application/json", rr.Header().Get("Content-Type"))
+			},
+		},
+		{
+			name:    "prefers json when strict",
+			options: ContentOptions{Strict: true},
+			method:  http.MethodGet,
+			headers: map[string]string{
+				"Accept": "application/json, */*;q=0.1",
+			},
+			expect: func(t *testing.T, rr *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusOK, rr.Code)
+				assert.Equal(t, spec.ApplicationScimJson, rr.Header().Get("Content-Type"))
+			},
+		},
+		{
+			name:    "accepts only json when strict",
+			options: ContentOptions{Strict: true},
+			method:  http.MethodGet,
+			headers: map[string]string{
+				"Accept": "application/json",
+			},
+			expect: func(t *testing.T, rr *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusNotAcceptable, rr.Code)
+			},
+		},
+		{
+			name:   "accepts any",
+			method: http.MethodGet,
+			headers: map[string]string{
+				"Accept": "*/*",
+			},
+			expect: func(t *testing.T, rr *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusOK, rr.Code)
+				assert.Equal(t, spec.ApplicationScimJson, rr.Header().Get("Content-Type"))
+			},
+		},
+		{
+			name:   "refuses scim explicitly",
+			method: http.MethodGet,
+			headers: map[string]string{
+				"Accept": "application/*, application/scim+json;q=0",
+			},
+			expect: func(t *testing.T, rr *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusOK, rr.Code)
+				assert.Equal(t, "application/json", rr.Header().Get("Content-Type"))
+			},
+		},
+		{
+			name:   "accepts xml",
+			method: http.MethodGet,
+			headers: map[string]string{
+				"Accept": "application/xml, text/*",
+			},
+			expect: func(t *testing.T, rr *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusNotAcceptable, rr.Code)
+				assert.Contains(t, rr.Body.String(), spec.ErrNotAcceptable.Type)
+			},
+		},
+		{
+			name:   "accepts utf-8",
+			method: http.MethodGet,
+			headers: map[string]string{
+				"Accept-Charset": "iso-8859-1, utf-8;q=0.5",
+			},
+			expect: func(t *testing.T, rr *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusOK, rr.Code)
+			},
+		},
+		{
+			name:   "refuses utf-8",
+			method: http.MethodGet,
+			headers: map[string]string{
+				"Accept-Charset": "iso-8859-1, *;q=0",
+			},
+			expect: func(t *testing.T, rr *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusNotAcceptable, rr.Code)
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := httptest.NewRequest(test.method, "/Users", nil)
+			if test.method != http.MethodGet {
+				r = httptest.NewRequest(test.method, "/Users", strings.NewReader(`{}`))
+			}
+			for k, v := range test.headers {
+				r.Header.Set(k, v)
+			}
+			rr := httptest.NewRecorder()
+			NegotiateContent(test.options, next).ServeHTTP(rr, r)
+			test.expect(t, rr)
+		})
+	}
+}
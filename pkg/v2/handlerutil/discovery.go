@@ -0,0 +1,113 @@
+package handlerutil
+
+import (
+	"encoding/json"
+	"fmt"
+	scimjson "github.com/imulab/go-scim/pkg/v2/json"
+	"github.com/imulab/go-scim/pkg/v2/service"
+	"github.com/imulab/go-scim/pkg/v2/spec"
+	"net/http"
+	"sort"
+)
+
+// ServiceProviderConfigSchema is the schema of the service provider config, see RFC 7643 section 5.
+const ServiceProviderConfigSchema = "urn:ietf:params:scim:schemas:core:2.0:ServiceProviderConfig"
+
+// discovery serves the discovery endpoints of RFC 7644 section 4: /ServiceProviderConfig, /ResourceTypes and /Schemas.
+// Everything is rendered upon request, so that the responses reflect the service provider config as it is, and the
+// schemas registered to spec.Schemas by then, extensions included.
+type discovery struct {
+	config        *spec.ServiceProviderConfig
+	resourceTypes []*spec.ResourceType
+}
+
+// Writes the response of the discovery endpoint of the path segments, or returns the error to write instead. As
+// filtering is not supported by the discovery endpoints, requests with one are rejected with an error of
+// spec.ErrForbidden, as RFC 7644 section 4 recommends, so that clients cannot mistake the response for the resources
+// matching the filter.
+func (d *discovery) serve(rw http.ResponseWriter, r *http.Request, segments []string) error {
+	if len(r.URL.Query().Get(paramFilter)) > 0 {
+		return fmt.Errorf("%w: filter is not supported on '%s'", spec.ErrForbidden, r.URL.Path)
+	}
+
+	switch segments[0] {
+	case "ServiceProviderConfig":
+		return d.serviceProviderConfig(rw)
+	case "ResourceTypes":
+		var resources []scimjson.Serializable
+		for _, resourceType := range d.resourceTypes {
+			if len(segments) == 1 || resourceType.ID() == segments[1] {
+				resources = append(resources, scimjson.ResourceTypeToSerializable(resourceType))
+			}
+		}
+		return d.write(rw, segments, resources, "resource type")
+	default:
+		var schemas []*spec.Schema
+		_ = spec.Schemas().ForEachSchema(func(schema *spec.Schema) error {
+			if schema.ID() != spec.CoreSchemaId && (len(segments) == 1 || schema.ID() == segments[1]) {
+				schemas = append(schemas, schema)
+			}
+			return nil
+		})
+		sort.Slice(schemas, func(i, j int) bool { return schemas[i].ID() < schemas[j].ID() })
+
+		var resources []scimjson.Serializable
+		for _, schema := range schemas {
+			resources = append(resources, scimjson.SchemaToSerializable(schema))
+		}
+		return d.write(rw, segments, resources, "schema")
+	}
+}
+
+// Writes the service provider config, along with its meta, which spec.ServiceProviderConfig does not carry.
+func (d *discovery) serviceProviderConfig(rw http.ResponseWriter) error {
+	if d.config == nil {
+		return fmt.Errorf("%w: service provider config is not available", spec.ErrNotImplemented)
+	}
+
+	config := *d.config
+	if len(config.Schemas) == 0 {
+		config.Schemas = []string{ServiceProviderConfigSchema}
+	}
+	raw, err := json.Marshal(struct {
+		*spec.ServiceProviderConfig
+		Meta map[string]string `json:"meta"`
+	}{
+		ServiceProviderConfig: &config,
+		Meta: map[string]string{
+			"resourceType": "ServiceProviderConfig",
+			"location":     "/ServiceProviderConfig",
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	rw.Header().Set("Content-Type", spec.ApplicationScimJson)
+	_, _ = rw.Write(raw)
+	return nil
+}
+
+// Writes the resources as a list response, or the only resource when the path segments carry its id.
+func (d *discovery) write(rw http.ResponseWriter, segments []string, resources []scimjson.Serializable, kind string) error {
+	if len(segments) == 1 {
+		_ = WriteSearchResultToResponse(rw, &service.QueryResponse{
+			TotalResults: len(resources),
+			StartIndex:   1,
+			ItemsPerPage: len(resources),
+			Resources:    append([]scimjson.Serializable{}, resources...),
+		})
+		return nil
+	}
+
+	if len(resources) == 0 {
+		return fmt.Errorf("%w: %s '%s' is not found", spec.ErrNotFound, kind, segments[1])
+	}
+	raw, err := scimjson.Serialize(resources[0])
+	if err != nil {
+		return err
+	}
+	rw.Header().Set("Content-Type", spec.ApplicationScimJson)
+	_, _ = rw.Write(raw)
+	return nil
+}
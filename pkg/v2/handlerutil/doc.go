@@ -3,4 +3,9 @@
 // Although service is the only entry point into the functions of this module and the implementation of HTTP handlers
 // are left completely to the developer, this package still provides utilities that assumes usage of Go's native HTTP
 // stack, which proves to be the common scenario. This will make HTTP handler implementation even easier.
+//
+// For those who do not need to tailor the handlers, NewServer assembles the services into a http.Handler serving all the
+// standard SCIM endpoints, which Mount registers on a http.ServeMux under a prefix. NegotiateContent enforces the SCIM
+// media type on the requests of any http.Handler, strictly or not, as the deployment requires; Compress gzip encodes the
+// requests and responses, and LimitBody limits the size of the request bodies.
 package handlerutil
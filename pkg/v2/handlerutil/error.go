@@ -0,0 +1,56 @@
+package handlerutil
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/imulab/go-scim/pkg/v2/spec"
+	"sync"
+)
+
+// ErrorMapper maps an error which does not wrap a *spec.Error, i.e. of a custom type or a third party library, to the
+// *spec.Error it is reported as, or returns nil if the error is not one it knows.
+type ErrorMapper func(err error) *spec.Error
+
+var (
+	errorMappers   []ErrorMapper
+	errorMappersMu sync.RWMutex
+)
+
+// RegisterErrorMapper registers the mapper of errors, which MapError consults, in the order of registration, for the
+// errors which do not wrap a *spec.Error. Mappers are usually registered at startup, before any error is written.
+func RegisterErrorMapper(mapper ErrorMapper) {
+	errorMappersMu.Lock()
+	errorMappers = append(errorMappers, mapper)
+	errorMappersMu.Unlock()
+}
+
+// MapError returns the *spec.Error the error is reported as, whose status and scimType are those of the response:
+//
+//  1. the *spec.Error the error wraps, however deep (see errors.As), or is itself;
+//  2. what the first of the registered mappers that knows the error maps it to (see RegisterErrorMapper);
+//  3. spec.ErrInvalidSyntax for the errors of encoding/json parsing malformed JSON;
+//  4. spec.ErrInternal otherwise.
+func MapError(err error) *spec.Error {
+	var scimErr *spec.Error
+	if errors.As(err, &scimErr) {
+		return scimErr
+	}
+
+	errorMappersMu.RLock()
+	mappers := errorMappers
+	errorMappersMu.RUnlock()
+	for _, mapper := range mappers {
+		if mapped := mapper(err); mapped != nil {
+			return mapped
+		}
+	}
+
+	var (
+		syntaxErr *json.SyntaxError
+		typeErr   *json.UnmarshalTypeError
+	)
+	if errors.As(err, &syntaxErr) || errors.As(err, &typeErr) {
+		return spec.ErrInvalidSyntax
+	}
+	return spec.ErrInternal
+}
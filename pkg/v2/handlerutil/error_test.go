@@ -0,0 +1,86 @@
+package handlerutil
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/imulab/go-scim/pkg/v2/spec"
+	"github.com/stretchr/testify/assert"
+	"net/http/httptest"
+	"testing"
+)
+
+type quotaError struct {
+	tenant string
+}
+
+func (e *quotaError) Error() string {
+	return fmt.Sprintf("tenant %s has no resources left", e.tenant)
+}
+
+func TestMapError(t *testing.T) {
+	RegisterErrorMapper(func(err error) *spec.Error {
+		var qe *quotaError
+		if errors.As(err, &qe) {
+			return spec.ErrQuotaExceeded
+		}
+		return nil
+	})
+
+	tests := []struct {
+		name   string
+		err    error
+		expect *spec.Error
+	}{
+		{
+			name:   "error prototype",
+			err:    spec.ErrNotFound,
+			expect: spec.ErrNotFound,
+		},
+		{
+			name:   "wrapped error prototype",
+			err:    fmt.Errorf("%w: version 1.1 is not supported", spec.ErrInvalidVersion),
+			expect: spec.ErrInvalidVersion,
+		},
+		{
+			name:   "deeply wrapped error prototype",
+			err:    fmt.Errorf("failed to replace: %w", fmt.Errorf("%w: 'id' is read only", spec.ErrMutability)),
+			expect: spec.ErrMutability,
+		},
+		{
+			name:   "multiple errors",
+			err:    spec.Errors{fmt.Errorf("%w: too many", spec.ErrTooMany), spec.ErrSensitive},
+			expect: spec.ErrTooMany,
+		},
+		{
+			name:   "mapped error",
+			err:    fmt.Errorf("failed to create: %w", &quotaError{tenant: "acme"}),
+			expect: spec.ErrQuotaExceeded,
+		},
+		{
+			name:   "json syntax error",
+			err:    json.Unmarshal([]byte(`{"userName":`), new(map[string]interface{})),
+			expect: spec.ErrInvalidSyntax,
+		},
+		{
+			name:   "arbitrary error",
+			err:    errors.New("connection refused"),
+			expect: spec.ErrInternal,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.expect, MapError(test.err))
+
+			rw := httptest.NewRecorder()
+			assert.Nil(t, WriteError(rw, test.err))
+			assert.Equal(t, test.expect.Status, rw.Code)
+
+			var rendering ErrorRendering
+			assert.Nil(t, json.Unmarshal(rw.Body.Bytes(), &rendering))
+			assert.Equal(t, test.expect.Type, rendering.ScimType)
+			assert.Equal(t, test.err.Error(), rendering.Detail)
+		})
+	}
+}
@@ -0,0 +1,59 @@
+package handlerutil
+
+import (
+	"fmt"
+	"github.com/imulab/go-scim/pkg/v2/spec"
+	"io"
+	"net/http"
+)
+
+// LimitBody returns a http.Handler which limits the size of the request bodies to max bytes before calling the next
+// handler. Requests whose Content-Length exceeds the limit are answered with an error of spec.ErrPayloadTooLarge (413)
+// right away. The bodies of others fail to be read past the limit with an error of spec.ErrPayloadTooLarge, which the
+// services report as it is. To limit the size of decompressed bodies, call it within Compress, not around it.
+func LimitBody(max int64, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if r.ContentLength > max {
+			_ = WriteError(rw, errPayloadTooLarge(max))
+			return
+		}
+		if r.Body != nil && r.Body != http.NoBody {
+			r.Body = &limitedBody{ReadCloser: r.Body, max: max, remaining: max}
+		}
+		next.ServeHTTP(rw, r)
+	})
+}
+
+func errPayloadTooLarge(max int64) error {
+	return fmt.Errorf("%w: request body exceeds %d bytes", spec.ErrPayloadTooLarge, max)
+}
+
+// limitedBody is a request body which fails to be read past max bytes.
+type limitedBody struct {
+	io.ReadCloser
+	max       int64
+	remaining int64
+	exceeded  bool
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	if b.exceeded {
+		return 0, errPayloadTooLarge(b.max)
+	}
+	if len(p) == 0 {
+		return 0, nil
+	}
+
+	// read one more byte than remains, to tell a body of exactly max bytes from a larger one
+	if int64(len(p)) > b.remaining+1 {
+		p = p[:b.remaining+1]
+	}
+	n, err := b.ReadCloser.Read(p)
+	if int64(n) <= b.remaining {
+		b.remaining -= int64(n)
+		return n, err
+	}
+
+	n, b.remaining, b.exceeded = int(b.remaining), 0, true
+	return n, errPayloadTooLarge(b.max)
+}
@@ -0,0 +1,74 @@
+package handlerutil
+
+import (
+	"bytes"
+	"github.com/imulab/go-scim/pkg/v2/service"
+	"github.com/imulab/go-scim/pkg/v2/spec"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestLimitBody(t *testing.T) {
+	payload := `{"schemas":["urn:ietf:params:scim:api:messages:2.0:SearchRequest"],"filter":"userName eq \"foo\""}`
+	next := http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if _, err := service.ParseSearchPayload(r.Body); err != nil {
+			_ = WriteError(rw, err)
+			return
+		}
+		rw.WriteHeader(http.StatusOK)
+	})
+
+	tests := []struct {
+		name   string
+		max    int64
+		body   func() *http.Request
+		expect func(t *testing.T, rr *httptest.ResponseRecorder)
+	}{
+		{
+			name: "body within limit",
+			max:  int64(len(payload)),
+			body: func() *http.Request {
+				return httptest.NewRequest(http.MethodPost, "/.search", strings.NewReader(payload))
+			},
+			expect: func(t *testing.T, rr *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusOK, rr.Code)
+			},
+		},
+		{
+			name: "content length over limit",
+			max:  int64(len(payload)) - 1,
+			body: func() *http.Request {
+				return httptest.NewRequest(http.MethodPost, "/.search", strings.NewReader(payload))
+			},
+			expect: func(t *testing.T, rr *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusRequestEntityTooLarge, rr.Code)
+				assert.Contains(t, rr.Body.String(), spec.ErrPayloadTooLarge.Type)
+			},
+		},
+		{
+			name: "chunked body over limit",
+			max:  int64(len(payload)) - 1,
+			body: func() *http.Request {
+				r := httptest.NewRequest(http.MethodPost, "/.search", ioutil.NopCloser(bytes.NewBufferString(payload)))
+				r.ContentLength = -1
+				return r
+			},
+			expect: func(t *testing.T, rr *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusRequestEntityTooLarge, rr.Code)
+				assert.Contains(t, rr.Body.String(), "request body exceeds")
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			LimitBody(test.max, next).ServeHTTP(rr, test.body())
+			test.expect(t, rr)
+		})
+	}
+}
@@ -2,6 +2,7 @@ package handlerutil
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/imulab/go-scim/pkg/v2/crud"
 	"github.com/imulab/go-scim/pkg/v2/prop"
@@ -18,6 +19,7 @@ const (
 	paramSortOrder          = "sortOrder"
 	paramStartIndex         = "startIndex"
 	paramCount              = "count"
+	paramCursor             = "cursor"
 	paramAttributes         = "attributes"
 	paramExcludedAttributes = "excludedAttributes"
 )
@@ -45,9 +47,14 @@ func GetRequestProjection(request *http.Request) (projection *crud.Projection, e
 }
 
 // CreateRequest returns a parsed *service.CreateRequest directly from *http.Request, and a closer function which should
-// be called after resource processing is done (preferably using defer).
+// be called after resource processing is done (preferably using defer). The Idempotency-Key header, if any, is
+// carried as the idempotency key of the request.
 func CreateRequest(request *http.Request) (cr *service.CreateRequest, closer func()) {
-	cr = &service.CreateRequest{PayloadSource: request.Body}
+	cr = &service.CreateRequest{
+		PayloadSource:  request.Body,
+		IdempotencyKey: request.Header.Get("Idempotency-Key"),
+		DryRun:         DryRun(request),
+	}
 	closer = func() {
 		_ = request.Body.Close()
 	}
@@ -70,7 +77,21 @@ func QueryRequestFromGet(request *http.Request) (qr *service.QueryRequest, err e
 		}
 	}
 
-	if startIndexValue, countValue := request.URL.Query().Get(paramStartIndex), request.URL.Query().Get(paramCount); len(startIndexValue) > 0 || len(countValue) > 0 {
+	// An empty cursor parameter requests the first page using cursor pagination.
+	if cursors, ok := request.URL.Query()[paramCursor]; ok {
+		if len(request.URL.Query().Get(paramStartIndex)) > 0 {
+			err = fmt.Errorf("%w: only one of startIndex and cursor may be specified", spec.ErrInvalidSyntax)
+			return
+		}
+		qr.Cursor = &crud.CursorPagination{Cursor: cursors[0]}
+		if countValue := request.URL.Query().Get(paramCount); len(countValue) > 0 {
+			qr.Cursor.Count, err = strconv.Atoi(countValue)
+			if err != nil || qr.Cursor.Count < 0 {
+				err = fmt.Errorf("%w: parameter count must be a non-negative integer", spec.ErrInvalidSyntax)
+				return
+			}
+		}
+	} else if startIndexValue, countValue := request.URL.Query().Get(paramStartIndex), request.URL.Query().Get(paramCount); len(startIndexValue) > 0 || len(countValue) > 0 {
 
 		qr.Pagination = &crud.Pagination{}
 
@@ -106,55 +127,14 @@ func QueryRequestFromGet(request *http.Request) (qr *service.QueryRequest, err e
 // QueryRequestFromPost returns a parsed *service.QueryRequest from *http.Request using HTTP POST method, a closer function
 // to be invoked when the search is finished, and any error during the parsing.
 func QueryRequestFromPost(request *http.Request) (qr *service.QueryRequest, closer func(), err error) {
-	wip := new(struct {
-		Schemas            []string `json:"schemas"`
-		Attributes         []string `json:"attributes"`
-		ExcludedAttributes []string `json:"excludedAttributes"`
-		Filter             string   `json:"filter"`
-		SortBy             string   `json:"sortBy"`
-		SortOrder          string   `json:"sortOrder"`
-		StartIndex         int      `json:"startIndex"`
-		Count              int      `json:"count"`
-	})
-	if err = json.NewDecoder(request.Body).Decode(wip); err != nil {
+	payload, err := service.ParseSearchPayload(request.Body)
+	if err != nil {
 		return
 	}
 	closer = func() {
 		_ = request.Body.Close()
 	}
-
-	if len(wip.Schemas) != 1 || wip.Schemas[0] != "urn:ietf:params:scim:api:messages:2.0:SearchRequest" {
-		err = fmt.Errorf("%w: invalid schema for search request", spec.ErrInvalidSyntax)
-		return
-	}
-	qr = &service.QueryRequest{
-		Filter: wip.Filter,
-	}
-
-	if len(wip.SortBy) > 0 {
-		qr.Sort = &crud.Sort{
-			By:    wip.SortBy,
-			Order: crud.SortOrder(wip.SortOrder), // validate it later
-		}
-	}
-
-	if len(wip.Attributes) > 0 || len(wip.ExcludedAttributes) > 0 {
-		qr.Projection = &crud.Projection{
-			Attributes:         wip.Attributes,
-			ExcludedAttributes: wip.ExcludedAttributes,
-		}
-	}
-
-	if wip.StartIndex > 0 || wip.Count > 0 {
-		if wip.StartIndex == 0 {
-			wip.StartIndex = 1
-		}
-		qr.Pagination = &crud.Pagination{
-			StartIndex: wip.StartIndex,
-			Count:      wip.Count,
-		}
-	}
-
+	qr, err = payload.QueryRequest()
 	return
 }
 
@@ -166,6 +146,8 @@ func ReplaceRequest(request *http.Request) (rr func(resourceId string) *service.
 			ResourceID:    resourceId,
 			PayloadSource: request.Body,
 			MatchCriteria: MatchCriteria(request),
+			Version:       Version(request),
+			DryRun:        DryRun(request),
 		}
 	}
 	closer = func() {
@@ -182,6 +164,8 @@ func PatchRequest(request *http.Request) (pr func(resourceId string) *service.Pa
 			ResourceID:    resourceId,
 			MatchCriteria: MatchCriteria(request),
 			PayloadSource: request.Body,
+			Version:       Version(request),
+			DryRun:        DryRun(request),
 		}
 	}
 	closer = func() {
@@ -196,8 +180,80 @@ func DeleteRequest(request *http.Request) func(resourceId string) *service.Delet
 		return &service.DeleteRequest{
 			ResourceID:    resourceId,
 			MatchCriteria: MatchCriteria(request),
+			Version:       Version(request),
+		}
+	}
+}
+
+// MembersRequestFromGet returns a parsed *service.MembersRequest for the members of the group by resourceId, from the
+// startIndex and count parameters of the *http.Request using HTTP GET method, and any error during parsing. Without
+// count, the default page size of the members service applies.
+func MembersRequestFromGet(request *http.Request, resourceId string) (mr *service.MembersRequest, err error) {
+	mr = &service.MembersRequest{ResourceID: resourceId, StartIndex: 1, Count: -1}
+
+	if startIndexValue := request.URL.Query().Get(paramStartIndex); len(startIndexValue) > 0 {
+		mr.StartIndex, err = strconv.Atoi(startIndexValue)
+		if err != nil || mr.StartIndex < 1 {
+			err = fmt.Errorf("%w: parameter startIndex must be a 1-based integer", spec.ErrInvalidSyntax)
+			return
+		}
+	}
+
+	if countValue := request.URL.Query().Get(paramCount); len(countValue) > 0 {
+		mr.Count, err = strconv.Atoi(countValue)
+		if err != nil || mr.Count < 0 {
+			err = fmt.Errorf("%w: parameter count must be a non-negative integer", spec.ErrInvalidSyntax)
+			return
 		}
 	}
+
+	return
+}
+
+// MembershipRequestFromPatch returns a parsed *service.MembershipRequest for the group by resourceId, from the body of
+// the *http.Request using HTTP PATCH method, and any error during parsing. The body lists the values of the members to
+// add and to remove, i.e. {"add": ["2819c223"], "remove": ["902c246b"]}. It does not close the body.
+func MembershipRequestFromPatch(request *http.Request, resourceId string) (mr *service.MembershipRequest, err error) {
+	var payload struct {
+		Add    []string `json:"add"`
+		Remove []string `json:"remove"`
+	}
+	if err = json.NewDecoder(request.Body).Decode(&payload); err != nil {
+		// errors of the body, i.e. of spec.ErrPayloadTooLarge from LimitBody, are reported as they are
+		var scimErr *spec.Error
+		if !errors.As(err, &scimErr) {
+			err = fmt.Errorf("%w: membership payload must list the values of the members to add and remove", spec.ErrInvalidSyntax)
+		}
+		return
+	}
+
+	mr = &service.MembershipRequest{
+		ResourceID:    resourceId,
+		MatchCriteria: MatchCriteria(request),
+		Version:       Version(request),
+		Add:           payload.Add,
+		Remove:        payload.Remove,
+		DryRun:        DryRun(request),
+	}
+	return
+}
+
+// DryRun returns true if the request asks to only validate the resource without persisting it, by the Dry-Run header
+// of value "true".
+func DryRun(request *http.Request) bool {
+	return strings.EqualFold(request.Header.Get("Dry-Run"), "true")
+}
+
+// Version returns the version that the resource to replace, patch or delete has to be of, from an If-Match header with
+// a single version or an asterisk (*), i.e. db.AnyVersion. The services check it atomically with the modification (see
+// db.ReplaceIfMatch), which MatchCriteria, checked against the resource read beforehand, cannot do by itself. It returns
+// an empty string when there is no such header, or when it lists many versions, which only MatchCriteria checks.
+func Version(request *http.Request) string {
+	ifMatch := strings.TrimSpace(request.Header.Get("If-Match"))
+	if strings.Contains(ifMatch, ",") {
+		return ""
+	}
+	return ifMatch
 }
 
 // MatchCriteria returns a function to be supplied as the match criteria argument in replace, patch and delete requests.
@@ -241,3 +297,24 @@ func MatchCriteria(request *http.Request) func(resource *prop.Resource) bool {
 		return true
 	}
 }
+
+// NotModified returns true if the If-None-Match header of the conditional HTTP GET request matches the version of the
+// resource, in which case the caller should respond with 304 Not Modified instead of the resource. The header supports
+// asterisk (*) and comma delimited resource versions, which are compared with the weak comparison function, i.e.
+// W/"1" matches "1". A resource without version never matches.
+func NotModified(request *http.Request, resource *prop.Resource) bool {
+	ifNoneMatch := strings.TrimSpace(request.Header.Get("If-None-Match"))
+	version := resource.MetaVersionOrEmpty()
+	if len(ifNoneMatch) == 0 || len(version) == 0 {
+		return false
+	}
+	if ifNoneMatch == "*" {
+		return true
+	}
+	for _, eachVersion := range strings.Split(ifNoneMatch, ",") {
+		if strings.TrimPrefix(strings.TrimSpace(eachVersion), "W/") == strings.TrimPrefix(version, "W/") {
+			return true
+		}
+	}
+	return false
+}
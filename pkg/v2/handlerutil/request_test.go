@@ -1,11 +1,15 @@
 package handlerutil
 
 import (
+	"encoding/json"
 	"errors"
 	"github.com/imulab/go-scim/pkg/v2/crud"
+	"github.com/imulab/go-scim/pkg/v2/prop"
 	"github.com/imulab/go-scim/pkg/v2/service"
 	"github.com/imulab/go-scim/pkg/v2/spec"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
@@ -137,6 +141,52 @@ func TestQueryRequestFromGet(t *testing.T) {
 				assert.Equal(t, 3, qr.Pagination.Count)
 			},
 		},
+		{
+			name: "query with empty cursor",
+			requestFunc: func() *http.Request {
+				r := httptest.NewRequest(http.MethodGet, "/", nil)
+				r.URL.RawQuery = url.Values{
+					paramCursor: []string{""},
+					paramCount:  []string{"3"},
+				}.Encode()
+				return r
+			},
+			expect: func(t *testing.T, qr *service.QueryRequest, err error) {
+				assert.Nil(t, err)
+				assert.Nil(t, qr.Pagination)
+				assert.Equal(t, "", qr.Cursor.Cursor)
+				assert.Equal(t, 3, qr.Cursor.Count)
+			},
+		},
+		{
+			name: "query with cursor",
+			requestFunc: func() *http.Request {
+				r := httptest.NewRequest(http.MethodGet, "/", nil)
+				r.URL.RawQuery = url.Values{
+					paramCursor: []string{"eyJpZCI6IjEifQ"},
+				}.Encode()
+				return r
+			},
+			expect: func(t *testing.T, qr *service.QueryRequest, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, "eyJpZCI6IjEifQ", qr.Cursor.Cursor)
+				assert.Equal(t, 0, qr.Cursor.Count)
+			},
+		},
+		{
+			name: "query with both cursor and startIndex",
+			requestFunc: func() *http.Request {
+				r := httptest.NewRequest(http.MethodGet, "/", nil)
+				r.URL.RawQuery = url.Values{
+					paramCursor:     []string{""},
+					paramStartIndex: []string{"2"},
+				}.Encode()
+				return r
+			},
+			expect: func(t *testing.T, qr *service.QueryRequest, err error) {
+				assert.NotNil(t, err)
+			},
+		},
 	}
 
 	for _, test := range tests {
@@ -181,6 +231,27 @@ func TestQueryRequestFromPost(t *testing.T) {
 				assert.Equal(t, []string{"id", "meta", "userName"}, qr.Projection.Attributes)
 			},
 		},
+		{
+			name: "cursor",
+			requestFunc: func() *http.Request {
+				return httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`
+{
+  "schemas": [
+    "urn:ietf:params:scim:api:messages:2.0:SearchRequest"
+  ],
+  "filter": "id pr",
+  "cursor": "",
+  "count": 3
+}
+`))
+			},
+			expect: func(t *testing.T, qr *service.QueryRequest, err error) {
+				assert.Nil(t, err)
+				assert.Nil(t, qr.Pagination)
+				assert.Equal(t, "", qr.Cursor.Cursor)
+				assert.Equal(t, 3, qr.Cursor.Count)
+			},
+		},
 	}
 
 	for _, test := range tests {
@@ -191,3 +262,210 @@ func TestQueryRequestFromPost(t *testing.T) {
 		})
 	}
 }
+
+func TestNotModified(t *testing.T) {
+	for _, filepath := range []string{
+		"../../../public/schemas/core_schema.json",
+		"../../../public/schemas/user_schema.json",
+		"../../../public/schemas/user_enterprise_extension_schema.json",
+	} {
+		raw, err := ioutil.ReadFile(filepath)
+		require.Nil(t, err)
+		schema := new(spec.Schema)
+		require.Nil(t, json.Unmarshal(raw, schema))
+		spec.Schemas().Register(schema)
+	}
+	raw, err := ioutil.ReadFile("../../../public/resource_types/user_resource_type.json")
+	require.Nil(t, err)
+	resourceType := new(spec.ResourceType)
+	require.Nil(t, json.Unmarshal(raw, resourceType))
+
+	resourceOf := func(version string) *prop.Resource {
+		r := prop.NewResource(resourceType)
+		data := map[string]interface{}{"id": "foo", "userName": "foo"}
+		if len(version) > 0 {
+			data["meta"] = map[string]interface{}{"version": version}
+		}
+		require.Nil(t, r.Navigator().Replace(data).Error())
+		return r
+	}
+
+	tests := []struct {
+		name        string
+		ifNoneMatch string
+		version     string
+		expect      bool
+	}{
+		{name: "no header", version: `W/"1"`, expect: false},
+		{name: "matching version", ifNoneMatch: `W/"1"`, version: `W/"1"`, expect: true},
+		{name: "matching one of versions", ifNoneMatch: `W/"2", W/"1"`, version: `W/"1"`, expect: true},
+		{name: "weak comparison", ifNoneMatch: `"1"`, version: `W/"1"`, expect: true},
+		{name: "different version", ifNoneMatch: `W/"2"`, version: `W/"1"`, expect: false},
+		{name: "asterisk", ifNoneMatch: "*", version: `W/"1"`, expect: true},
+		{name: "resource without version", ifNoneMatch: "*", expect: false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/Users/foo", nil)
+			if len(test.ifNoneMatch) > 0 {
+				req.Header.Set("If-None-Match", test.ifNoneMatch)
+			}
+			assert.Equal(t, test.expect, NotModified(req, resourceOf(test.version)))
+		})
+	}
+}
+
+func TestDryRun(t *testing.T) {
+	tests := []struct {
+		name   string
+		dryRun string
+		expect bool
+	}{
+		{name: "no header", expect: false},
+		{name: "true", dryRun: "true", expect: true},
+		{name: "case insensitive", dryRun: "TRUE", expect: true},
+		{name: "false", dryRun: "false", expect: false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/Users", nil)
+			if len(test.dryRun) > 0 {
+				req.Header.Set("Dry-Run", test.dryRun)
+			}
+			assert.Equal(t, test.expect, DryRun(req))
+			cr, _ := CreateRequest(req)
+			assert.Equal(t, test.expect, cr.DryRun)
+		})
+	}
+}
+
+func TestVersion(t *testing.T) {
+	tests := []struct {
+		name    string
+		ifMatch string
+		expect  string
+	}{
+		{name: "no header", expect: ""},
+		{name: "single version", ifMatch: ` W/"1" `, expect: `W/"1"`},
+		{name: "asterisk", ifMatch: "*", expect: "*"},
+		{name: "many versions", ifMatch: `W/"1", W/"2"`, expect: ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodDelete, "/Users/foo", nil)
+			if len(test.ifMatch) > 0 {
+				req.Header.Set("If-Match", test.ifMatch)
+			}
+			assert.Equal(t, test.expect, Version(req))
+			assert.Equal(t, test.expect, DeleteRequest(req)("foo").Version)
+		})
+	}
+}
+
+func TestMembersRequestFromGet(t *testing.T) {
+	tests := []struct {
+		name   string
+		query  url.Values
+		expect func(t *testing.T, mr *service.MembersRequest, err error)
+	}{
+		{
+			name: "default",
+			expect: func(t *testing.T, mr *service.MembersRequest, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, &service.MembersRequest{ResourceID: "g1", StartIndex: 1, Count: -1}, mr)
+			},
+		},
+		{
+			name:  "page",
+			query: url.Values{paramStartIndex: []string{"101"}, paramCount: []string{"100"}},
+			expect: func(t *testing.T, mr *service.MembersRequest, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, &service.MembersRequest{ResourceID: "g1", StartIndex: 101, Count: 100}, mr)
+			},
+		},
+		{
+			name:  "count only",
+			query: url.Values{paramCount: []string{"0"}},
+			expect: func(t *testing.T, mr *service.MembersRequest, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, 0, mr.Count)
+			},
+		},
+		{
+			name:  "invalid start index",
+			query: url.Values{paramStartIndex: []string{"0"}},
+			expect: func(t *testing.T, _ *service.MembersRequest, err error) {
+				assert.True(t, errors.Is(err, spec.ErrInvalidSyntax))
+			},
+		},
+		{
+			name:  "invalid count",
+			query: url.Values{paramCount: []string{"-1"}},
+			expect: func(t *testing.T, _ *service.MembersRequest, err error) {
+				assert.True(t, errors.Is(err, spec.ErrInvalidSyntax))
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/Groups/g1/members", nil)
+			r.URL.RawQuery = test.query.Encode()
+			mr, err := MembersRequestFromGet(r, "g1")
+			test.expect(t, mr, err)
+		})
+	}
+}
+
+func TestMembershipRequestFromPatch(t *testing.T) {
+	tests := []struct {
+		name   string
+		body   string
+		header http.Header
+		expect func(t *testing.T, mr *service.MembershipRequest, err error)
+	}{
+		{
+			name: "add and remove",
+			body: `{"add": ["u1", "u2"], "remove": ["u3"]}`,
+			expect: func(t *testing.T, mr *service.MembershipRequest, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, "g1", mr.ResourceID)
+				assert.Equal(t, []string{"u1", "u2"}, mr.Add)
+				assert.Equal(t, []string{"u3"}, mr.Remove)
+				assert.False(t, mr.DryRun)
+			},
+		},
+		{
+			name:   "dry run with version",
+			body:   `{"remove": ["u3"]}`,
+			header: http.Header{"If-Match": []string{`W/"1"`}, "Dry-Run": []string{"true"}},
+			expect: func(t *testing.T, mr *service.MembershipRequest, err error) {
+				assert.Nil(t, err)
+				assert.Empty(t, mr.Add)
+				assert.Equal(t, `W/"1"`, mr.Version)
+				assert.True(t, mr.DryRun)
+			},
+		},
+		{
+			name: "invalid payload",
+			body: `{"add": "u1"}`,
+			expect: func(t *testing.T, _ *service.MembershipRequest, err error) {
+				assert.True(t, errors.Is(err, spec.ErrInvalidSyntax))
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPatch, "/Groups/g1/members", strings.NewReader(test.body))
+			for k, v := range test.header {
+				r.Header[k] = v
+			}
+			mr, err := MembershipRequestFromPatch(r, "g1")
+			test.expect(t, mr, err)
+		})
+	}
+}
@@ -1,13 +1,17 @@
 package handlerutil
 
 import (
+	"context"
 	"encoding/json"
-	"errors"
+	"github.com/imulab/go-scim/pkg/v2/authz"
+	"github.com/imulab/go-scim/pkg/v2/db"
 	scimjson "github.com/imulab/go-scim/pkg/v2/json"
 	"github.com/imulab/go-scim/pkg/v2/prop"
 	"github.com/imulab/go-scim/pkg/v2/service"
 	"github.com/imulab/go-scim/pkg/v2/spec"
+	"github.com/imulab/go-scim/pkg/v2/trace"
 	"net/http"
+	"strconv"
 )
 
 // WriteResourceToResponse writes the given resource to http.ResponseWriter, respecting the attributes or excludedAttributes
@@ -17,7 +21,16 @@ import (
 // resource's meta.version field, if any. This method does not set response status, which should be set before calling
 // this method.
 func WriteResourceToResponse(rw http.ResponseWriter, resource *prop.Resource, options ...scimjson.Options) error {
-	raw, jsonErr := scimjson.Serialize(resource, options...)
+	return WriteResourceToResponseContext(context.Background(), rw, resource, options...)
+}
+
+// WriteResourceToResponseContext is WriteResourceToResponse, reporting the serialization of the resource as a span
+// of the request context (see trace.Serialize), and leaving out the attributes the caller may not read, if the context
+// carries its access (see authz.From).
+func WriteResourceToResponseContext(ctx context.Context, rw http.ResponseWriter, resource *prop.Resource, options ...scimjson.Options) error {
+	_, end := trace.Start(ctx, trace.Serialize)
+	raw, jsonErr := scimjson.Serialize(resource, readable(ctx, resource, options)...)
+	end(jsonErr)
 	if jsonErr != nil {
 		return jsonErr
 	}
@@ -34,59 +47,164 @@ func WriteResourceToResponse(rw http.ResponseWriter, resource *prop.Resource, op
 	return writeErr
 }
 
+// WriteNotModifiedToResponse writes the 304 Not Modified response to a conditional HTTP GET request of the resource
+// (see NotModified). The response has no body, but carries the ETag header of the resource's meta.version field.
+func WriteNotModifiedToResponse(rw http.ResponseWriter, resource *prop.Resource) {
+	if version := resource.MetaVersionOrEmpty(); len(version) > 0 {
+		rw.Header().Set("ETag", version)
+	}
+	rw.WriteHeader(http.StatusNotModified)
+}
+
 // WriteSearchResultToResponse writes the search result to http.ResponseWrite, respecting the attribute or excludedAttributes
 // specified through options. Any error during the process will be returned.
 // This method also sets Content-Type header to application/scim+json. This method does not set response status, which should
 // be set before calling this method.
 func WriteSearchResultToResponse(rw http.ResponseWriter, searchResult *service.QueryResponse, options ...scimjson.Options) error {
+	return WriteSearchResultToResponseContext(context.Background(), rw, searchResult, options...)
+}
+
+// WriteSearchResultToResponseContext is WriteSearchResultToResponse, reporting the serialization of the search result
+// as a span of the request context (see trace.Serialize), and leaving out the attributes the caller may not read, like
+// WriteResourceToResponseContext.
+func WriteSearchResultToResponseContext(ctx context.Context, rw http.ResponseWriter, searchResult *service.QueryResponse, options ...scimjson.Options) (err error) {
+	_, end := trace.Start(ctx, trace.Serialize)
+	defer func() { end(err) }()
+
 	render := SearchResultRendering{
 		Schemas:      []string{"urn:ietf:params:scim:api:messages:2.0:ListResponse"},
 		TotalResults: searchResult.TotalResults,
 		StartIndex:   searchResult.StartIndex,
 		ItemsPerPage: searchResult.ItemsPerPage,
+		NextCursor:   searchResult.NextCursor,
 		Resources:    []json.RawMessage{},
 	}
 
 	for _, resource := range searchResult.Resources {
-		raw, err := scimjson.Serialize(resource, options...)
+		raw, err := scimjson.Serialize(resource, readable(ctx, resource, options)...)
 		if err != nil {
 			return err
 		}
 		render.Resources = append(render.Resources, raw)
 	}
 
+	raw, err := scimjson.Marshal(render)
+	if err != nil {
+		return err
+	}
+
 	rw.Header().Set("Content-Type", spec.ApplicationScimJson)
-	return json.NewEncoder(rw).Encode(render)
+	_, err = rw.Write(raw)
+	return err
 }
 
-// WriteError writes the error to the http.ResponseWriter. Any error during the process will be returned.
-// If the cause of the error (determined using errors.Unwrap) is a *spec.Error, the cause status and scimType will be
-// used together with the error's message as detail. If the cause is not a *spec.Error, spec.ErrInternal is used instead.
-// This method also writes the http status with the error's defined status, and set Content-Type header to application/scim+json.
-func WriteError(rw http.ResponseWriter, err error) error {
-	var errMsg = struct {
-		Schemas  []string `json:"schemas"`
-		Status   int      `json:"status"`
-		ScimType string   `json:"scimType"`
-		Detail   string   `json:"detail"`
-	}{
-		Schemas: []string{"urn:ietf:params:scim:api:messages:2.0:Error"},
-		Detail:  err.Error(),
+// Returns the options with the one to leave out the attributes the caller may not read, if the context carries its
+// access.
+func readable(ctx context.Context, serializable scimjson.Serializable, options []scimjson.Options) []scimjson.Options {
+	access := authz.From(ctx)
+	resource, ok := serializable.(*prop.Resource)
+	if access == nil || !ok {
+		return options
+	}
+	return append(append([]scimjson.Options{}, options...), access.ReadOption(resource.ResourceType()))
+}
+
+// WriteHistoryToResponse writes the change history of a resource to http.ResponseWriter, as a list response whose
+// Resources are the change records, oldest first. Any error during the process will be returned. This method also sets
+// Content-Type header to application/scim+json. This method does not set response status, which should be set before
+// calling this method.
+func WriteHistoryToResponse(rw http.ResponseWriter, history *service.HistoryResponse) error {
+	render := SearchResultRendering{
+		Schemas:      []string{"urn:ietf:params:scim:api:messages:2.0:ListResponse"},
+		TotalResults: len(history.Records),
+		StartIndex:   1,
+		ItemsPerPage: len(history.Records),
+		Resources:    []json.RawMessage{},
+	}
+
+	for _, record := range history.Records {
+		raw, err := scimjson.Marshal(record)
+		if err != nil {
+			return err
+		}
+		render.Resources = append(render.Resources, raw)
+	}
+
+	raw, err := scimjson.Marshal(render)
+	if err != nil {
+		return err
+	}
+
+	rw.Header().Set("Content-Type", spec.ApplicationScimJson)
+	_, err = rw.Write(raw)
+	return err
+}
+
+// WriteMembersToResponse writes the page of the members of a group to http.ResponseWriter, as a list response whose
+// Resources are the members. Any error during the process will be returned. This method also sets Content-Type header
+// to application/scim+json. This method does not set response status, which should be set before calling this method.
+func WriteMembersToResponse(rw http.ResponseWriter, members *service.MembersResponse) error {
+	render := SearchResultRendering{
+		Schemas:      []string{"urn:ietf:params:scim:api:messages:2.0:ListResponse"},
+		TotalResults: members.TotalResults,
+		StartIndex:   members.StartIndex,
+		ItemsPerPage: members.ItemsPerPage,
+		Resources:    []json.RawMessage{},
+	}
+
+	for _, member := range members.Members {
+		raw, err := scimjson.Marshal(member)
+		if err != nil {
+			return err
+		}
+		render.Resources = append(render.Resources, raw)
 	}
 
-	cause := errors.Unwrap(err)
-	if scimError, ok := cause.(*spec.Error); ok {
-		errMsg.Status = scimError.Status
-		errMsg.ScimType = scimError.Type
-	} else {
-		errMsg.Status = spec.ErrInternal.Status
-		errMsg.ScimType = spec.ErrInternal.Type
+	raw, err := scimjson.Marshal(render)
+	if err != nil {
+		return err
 	}
 
+	rw.Header().Set("Content-Type", spec.ApplicationScimJson)
+	_, err = rw.Write(raw)
+	return err
+}
+
+// WriteOperationToResponse writes the status of an asynchronous operation to http.ResponseWriter. The error of a
+// failed operation is rendered as its response, in the same way as WriteError. Any error during the process will be
+// returned. This method also sets Content-Type header to application/scim+json. This method does not set response
+// status, which should be set before calling this method.
+func WriteOperationToResponse(rw http.ResponseWriter, operation *db.Operation) error {
+	render := OperationRendering{
+		Schemas:   []string{service.OperationSchema},
+		Operation: operation,
+	}
+	if operation.Err != nil {
+		render.Response = newErrorRendering(operation.Err)
+	}
+
+	raw, err := scimjson.Marshal(render)
+	if err != nil {
+		return err
+	}
+
+	rw.Header().Set("Content-Type", spec.ApplicationScimJson)
+	_, err = rw.Write(raw)
+	return err
+}
+
+// WriteError writes the error to the http.ResponseWriter. Any error during the process will be returned.
+// The status and scimType are those of the *spec.Error the error is mapped to (see MapError), usually the one it wraps,
+// together with the error's message as detail. Errors which are not mapped are reported as spec.ErrInternal.
+// Each error of a spec.Errors is additionally rendered in the errors field (see ErrorRendering).
+// This method also writes the http status with the error's defined status, and set Content-Type header to application/scim+json.
+func WriteError(rw http.ResponseWriter, err error) error {
+	errMsg := newErrorRendering(err)
+
 	rw.Header().Set("Content-Type", spec.ApplicationScimJson)
 	rw.WriteHeader(errMsg.Status)
 
-	raw, jsonErr := json.Marshal(errMsg)
+	raw, jsonErr := scimjson.Marshal(errMsg)
 	if jsonErr != nil {
 		return jsonErr
 	}
@@ -95,6 +213,82 @@ func WriteError(rw http.ResponseWriter, err error) error {
 	return writeErr
 }
 
+// WriteBulkResponseToResponse writes the bulk response to http.ResponseWriter. The error of each failed operation is
+// rendered as its response, in the same way as WriteError. Any error during the process will be returned. This method
+// also sets Content-Type header to application/scim+json. This method does not set response status, which should be
+// set before calling this method.
+func WriteBulkResponseToResponse(rw http.ResponseWriter, bulkResponse *service.BulkResponse) error {
+	render := BulkResponseRendering{
+		Schemas:    []string{service.BulkResponseSchema},
+		Operations: []BulkResultRendering{},
+	}
+	for _, result := range bulkResponse.Results {
+		each := BulkResultRendering{
+			Location: result.Location,
+			Method:   result.Method,
+			BulkID:   result.BulkID,
+			Version:  result.Version,
+			Status:   strconv.Itoa(result.Status),
+		}
+		if result.Err != nil {
+			// the status of errors known to the registered mappers only is not known to the service
+			each.Response = newErrorRendering(result.Err)
+			each.Status = strconv.Itoa(each.Response.Status)
+		}
+		render.Operations = append(render.Operations, each)
+	}
+
+	raw, err := scimjson.Marshal(render)
+	if err != nil {
+		return err
+	}
+
+	rw.Header().Set("Content-Type", spec.ApplicationScimJson)
+	_, err = rw.Write(raw)
+	return err
+}
+
+// ErrorRendering is the JSON rendering structure for errors. When the error is a spec.Errors of multiple errors, the
+// status and scimType are those of the first error, and each error is also rendered in Errors, so that clients may
+// report all of them at once.
+type ErrorRendering struct {
+	Schemas  []string               `json:"schemas"`
+	Status   int                    `json:"status"`
+	ScimType string                 `json:"scimType"`
+	Detail   string                 `json:"detail"`
+	Errors   []ErrorDetailRendering `json:"errors,omitempty"`
+}
+
+// ErrorDetailRendering is the JSON rendering structure for each of multiple errors.
+type ErrorDetailRendering struct {
+	Status   int    `json:"status"`
+	ScimType string `json:"scimType"`
+	Detail   string `json:"detail"`
+}
+
+func newErrorRendering(err error) *ErrorRendering {
+	errMsg := &ErrorRendering{
+		Schemas: []string{"urn:ietf:params:scim:api:messages:2.0:Error"},
+		Detail:  err.Error(),
+	}
+	errMsg.Status, errMsg.ScimType = errorStatus(err)
+
+	if errs, ok := err.(spec.Errors); ok && len(errs) > 1 {
+		for _, each := range errs {
+			detail := ErrorDetailRendering{Detail: each.Error()}
+			detail.Status, detail.ScimType = errorStatus(each)
+			errMsg.Errors = append(errMsg.Errors, detail)
+		}
+	}
+	return errMsg
+}
+
+// Returns the status and scimType of the error, those of the *spec.Error it is mapped to (see MapError).
+func errorStatus(err error) (int, string) {
+	scimErr := MapError(err)
+	return scimErr.Status, scimErr.Type
+}
+
 // SearchResultRendering is the JSON rendering structure for search results. This is very similar to
 // service.QueryResponse except that resources are pre-rendered to adapt for objects serialized using
 // scim json mechanism or go's json mechanism.
@@ -103,5 +297,30 @@ type SearchResultRendering struct {
 	TotalResults int               `json:"totalResults"`
 	StartIndex   int               `json:"startIndex"`
 	ItemsPerPage int               `json:"itemsPerPage"`
+	NextCursor   string            `json:"nextCursor,omitempty"`
 	Resources    []json.RawMessage `json:"Resources,omitempty"`
 }
+
+// BulkResponseRendering is the JSON rendering structure for bulk responses.
+type BulkResponseRendering struct {
+	Schemas    []string              `json:"schemas"`
+	Operations []BulkResultRendering `json:"Operations"`
+}
+
+// BulkResultRendering is the JSON rendering structure for the outcome of a single bulk operation. The status is
+// rendered as a string, as in the examples of RFC7644 section 3.7.
+type BulkResultRendering struct {
+	Location string          `json:"location,omitempty"`
+	Method   string          `json:"method"`
+	BulkID   string          `json:"bulkId,omitempty"`
+	Version  string          `json:"version,omitempty"`
+	Status   string          `json:"status"`
+	Response *ErrorRendering `json:"response,omitempty"`
+}
+
+// OperationRendering is the JSON rendering structure for the status of asynchronous operations.
+type OperationRendering struct {
+	Schemas []string `json:"schemas"`
+	*db.Operation
+	Response *ErrorRendering `json:"response,omitempty"`
+}
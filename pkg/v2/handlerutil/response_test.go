@@ -3,10 +3,13 @@ package handlerutil
 import (
 	"errors"
 	"fmt"
+	"github.com/imulab/go-scim/pkg/v2/db"
+	"github.com/imulab/go-scim/pkg/v2/service"
 	"github.com/imulab/go-scim/pkg/v2/spec"
 	"github.com/stretchr/testify/assert"
 	"net/http/httptest"
 	"testing"
+	"time"
 )
 
 func TestWriteError(t *testing.T) {
@@ -44,6 +47,37 @@ func TestWriteError(t *testing.T) {
   "scimType":"internal",
   "detail":"something was wrong"
 }
+`, string(raw))
+			},
+		},
+		{
+			name: "multiple errors",
+			err: spec.Errors{
+				fmt.Errorf("%w: 'userName' is required", spec.ErrInvalidValue),
+				fmt.Errorf("%w: 'userName' is not unique", spec.ErrUniqueness),
+			},
+			expect: func(t *testing.T, raw []byte) {
+				assert.JSONEq(t, `
+{
+  "schemas":[
+    "urn:ietf:params:scim:api:messages:2.0:Error"
+  ],
+  "status":400,
+  "scimType":"invalidValue",
+  "detail":"invalidValue: 'userName' is required; uniqueness: 'userName' is not unique",
+  "errors":[
+    {
+      "status":400,
+      "scimType":"invalidValue",
+      "detail":"invalidValue: 'userName' is required"
+    },
+    {
+      "status":409,
+      "scimType":"uniqueness",
+      "detail":"uniqueness: 'userName' is not unique"
+    }
+  ]
+}
 `, string(raw))
 			},
 		},
@@ -57,3 +91,150 @@ func TestWriteError(t *testing.T) {
 		})
 	}
 }
+
+func TestWriteBulkResponseToResponse(t *testing.T) {
+	rw := httptest.NewRecorder()
+	err := WriteBulkResponseToResponse(rw, &service.BulkResponse{
+		Results: []*service.BulkResult{
+			{
+				Method:   "POST",
+				BulkID:   "qwerty",
+				Version:  `W/"1"`,
+				Location: "https://example.com/v2/Users/92b725cd",
+				Status:   201,
+			},
+			{
+				Method: "DELETE",
+				Status: 404,
+				Err:    fmt.Errorf("%w: resource not found by id", spec.ErrNotFound),
+			},
+		},
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, spec.ApplicationScimJson, rw.Header().Get("Content-Type"))
+	assert.JSONEq(t, `
+{
+  "schemas": ["urn:ietf:params:scim:api:messages:2.0:BulkResponse"],
+  "Operations": [
+    {
+      "location": "https://example.com/v2/Users/92b725cd",
+      "method": "POST",
+      "bulkId": "qwerty",
+      "version": "W/\"1\"",
+      "status": "201"
+    },
+    {
+      "method": "DELETE",
+      "status": "404",
+      "response": {
+        "schemas": ["urn:ietf:params:scim:api:messages:2.0:Error"],
+        "status": 404,
+        "scimType": "notFound",
+        "detail": "notFound: resource not found by id"
+      }
+    }
+  ]
+}
+`, rw.Body.String())
+}
+
+func TestWriteHistoryToResponse(t *testing.T) {
+	rw := httptest.NewRecorder()
+	err := WriteHistoryToResponse(rw, &service.HistoryResponse{
+		Records: []*db.ChangeRecord{
+			{
+				ResourceID:   "92b725cd",
+				ResourceType: "User",
+				Operation:    "patch",
+				Version:      `W/"2"`,
+				Actor:        "admin",
+				Time:         time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC),
+				Patch:        []byte(`{"Operations":[{"op":"add","path":"displayName","value":"Foo"}]}`),
+				Changed:      []string{"displayName"},
+			},
+		},
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, spec.ApplicationScimJson, rw.Header().Get("Content-Type"))
+	assert.JSONEq(t, `
+{
+  "schemas": ["urn:ietf:params:scim:api:messages:2.0:ListResponse"],
+  "totalResults": 1,
+  "startIndex": 1,
+  "itemsPerPage": 1,
+  "Resources": [
+    {
+      "resourceId": "92b725cd",
+      "resourceType": "User",
+      "operation": "patch",
+      "version": "W/\"2\"",
+      "actor": "admin",
+      "time": "2020-01-02T03:04:05Z",
+      "patch": {"Operations":[{"op":"add","path":"displayName","value":"Foo"}]},
+      "changed": ["displayName"]
+    }
+  ]
+}
+`, rw.Body.String())
+}
+
+func TestWriteMembersToResponse(t *testing.T) {
+	rw := httptest.NewRecorder()
+	err := WriteMembersToResponse(rw, &service.MembersResponse{
+		TotalResults: 3,
+		StartIndex:   2,
+		ItemsPerPage: 2,
+		Members: []interface{}{
+			map[string]interface{}{"value": "u2", "$ref": "/Users/u2", "display": "Bob"},
+			map[string]interface{}{"value": "g1", "type": "Group"},
+		},
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, spec.ApplicationScimJson, rw.Header().Get("Content-Type"))
+	assert.JSONEq(t, `
+{
+  "schemas": ["urn:ietf:params:scim:api:messages:2.0:ListResponse"],
+  "totalResults": 3,
+  "startIndex": 2,
+  "itemsPerPage": 2,
+  "Resources": [
+    {"value": "u2", "$ref": "/Users/u2", "display": "Bob"},
+    {"value": "g1", "type": "Group"}
+  ]
+}
+`, rw.Body.String())
+}
+
+func TestWriteOperationToResponse(t *testing.T) {
+	rw := httptest.NewRecorder()
+	err := WriteOperationToResponse(rw, &db.Operation{
+		ID:           "ab2c295c",
+		Method:       "replace",
+		ResourceType: "User",
+		ResourceID:   "92b725cd",
+		Status:       db.OperationFailed,
+		Err:          fmt.Errorf("%w: resource not found by id", spec.ErrNotFound),
+		Created:      time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC),
+		LastModified: time.Date(2020, 1, 2, 3, 4, 6, 0, time.UTC),
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, spec.ApplicationScimJson, rw.Header().Get("Content-Type"))
+	assert.JSONEq(t, `
+{
+  "schemas": ["urn:imulab:scim:api:messages:2.0:Operation"],
+  "id": "ab2c295c",
+  "method": "replace",
+  "resourceType": "User",
+  "resourceId": "92b725cd",
+  "status": "failed",
+  "created": "2020-01-02T03:04:05Z",
+  "lastModified": "2020-01-02T03:04:06Z",
+  "response": {
+    "schemas": ["urn:ietf:params:scim:api:messages:2.0:Error"],
+    "status": 404,
+    "scimType": "notFound",
+    "detail": "notFound: resource not found by id"
+  }
+}
+`, rw.Body.String())
+}
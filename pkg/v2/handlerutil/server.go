@@ -0,0 +1,569 @@
+package handlerutil
+
+import (
+	"fmt"
+	"github.com/imulab/go-scim/pkg/v2/authz"
+	"github.com/imulab/go-scim/pkg/v2/crud"
+	scimjson "github.com/imulab/go-scim/pkg/v2/json"
+	"github.com/imulab/go-scim/pkg/v2/prop"
+	"github.com/imulab/go-scim/pkg/v2/service"
+	"github.com/imulab/go-scim/pkg/v2/spec"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+type (
+	// ServerOptions configures the http.Handler returned by NewServer.
+	ServerOptions struct {
+		// ServiceProviderConfig is served on /ServiceProviderConfig.
+		ServiceProviderConfig *spec.ServiceProviderConfig
+		// Endpoints are the resource types served, each on its endpoint, i.e. /Users. Their resource types are served
+		// on /ResourceTypes, in order.
+		Endpoints []*Endpoint
+		// Me serves /Me, if not nil.
+		Me service.Me
+		// Bulk serves /Bulk, if not nil.
+		Bulk service.Bulk
+		// Search serves /.search, the search across all endpoints, if not nil (see service.RootQueryService).
+		Search service.Query
+		// Operations serves /Operations/{id}, the status of the operations accepted by the Async services of the
+		// endpoints, if not nil.
+		Operations service.OperationStatus
+		// OnError, if not nil, is called with the errors of the services before they are written to the response, i.e.
+		// to log them.
+		OnError func(r *http.Request, err error)
+	}
+	// Endpoint is a resource type served by NewServer, and the services of its resources. Each service may be nil, in
+	// which case the requests it would serve are answered with an error of spec.ErrNotImplemented. If Async is not
+	// nil, resources are created, replaced and deleted by it rather than by Create, Replace and Delete.
+	Endpoint struct {
+		ResourceType *spec.ResourceType
+		Create       service.Create
+		Get          service.Get
+		Query        service.Query
+		Replace      service.Replace
+		Patch        service.Patch
+		Delete       service.Delete
+		Async        service.Async
+		Members      service.Members
+		Membership   service.Membership
+		History      service.History
+	}
+)
+
+// NewServer returns a http.Handler serving the standard SCIM endpoints, relative to the root of the handler:
+//
+//	/ServiceProviderConfig              GET
+//	/ResourceTypes, /ResourceTypes/{id} GET
+//	/Schemas, /Schemas/{id}             GET
+//	/Me                                 GET, PUT, PATCH
+//	/Bulk                               POST
+//	/.search                            POST
+//	/{endpoint}                         GET (query), POST (create)
+//	/{endpoint}/.search                 POST
+//	/{endpoint}/{id}                    GET, PUT, PATCH, DELETE
+//	/{endpoint}/{id}/members            GET (members), PATCH (membership)
+//	/{endpoint}/{id}/history            GET
+//	/Operations/{id}                    GET
+//
+// Resources are written like WriteResourceToResponseContext, hence with their Location and ETag headers, and created
+// resources with status 201. Replacements and patches that changed nothing are answered with status 204, as are
+// deletions. Operations accepted by the Async service of an endpoint are answered with status 202, along with their
+// status endpoint in the Location header. The members of a resource are only listed to callers that may read the
+// members attribute (see authz.From). The discovery endpoints serve the resource types of the endpoints, and the schemas registered to
+// spec.Schemas, except the core schema, rejecting filters with an error of spec.ErrForbidden (see RFC 7644 section 4).
+// Unknown paths are answered with an error of spec.ErrNotFound, and methods not supported by the path with an error of
+// spec.ErrMethodNotAllowed, along with the Allow header. Use Mount to serve the handler under a prefix, i.e. "/v2".
+func NewServer(options ServerOptions) http.Handler {
+	s := &server{
+		options:   options,
+		endpoints: map[string]*Endpoint{},
+		discovery: &discovery{config: options.ServiceProviderConfig},
+	}
+	for _, endpoint := range options.Endpoints {
+		s.endpoints[strings.Trim(endpoint.ResourceType.Endpoint(), "/")] = endpoint
+		s.discovery.resourceTypes = append(s.discovery.resourceTypes, endpoint.ResourceType)
+	}
+	return s
+}
+
+// Mount registers the handler on the mux under the prefix, i.e. "/v2", stripping the prefix from the path of the
+// requests, so that the handler of NewServer serves /v2/Users.
+func Mount(mux *http.ServeMux, prefix string, handler http.Handler) {
+	prefix = strings.TrimSuffix(prefix, "/")
+	if len(prefix) == 0 {
+		mux.Handle("/", handler)
+		return
+	}
+	stripped := http.StripPrefix(prefix, handler)
+	mux.Handle(prefix, stripped)
+	mux.Handle(prefix+"/", stripped)
+}
+
+type server struct {
+	options   ServerOptions
+	endpoints map[string]*Endpoint
+	discovery *discovery
+}
+
+func (s *server) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	var segments []string
+	if path := strings.Trim(r.URL.Path, "/"); len(path) > 0 {
+		segments = strings.Split(path, "/")
+	}
+
+	switch {
+	case len(segments) == 0 || len(segments) > 3:
+	case segments[0] == "ServiceProviderConfig" && len(segments) == 1,
+		segments[0] == "ResourceTypes" && len(segments) <= 2,
+		segments[0] == "Schemas" && len(segments) <= 2:
+		if s.allow(rw, r, http.MethodGet) {
+			if err := s.discovery.serve(rw, r, segments); err != nil {
+				s.writeError(rw, r, err)
+			}
+		}
+		return
+	case segments[0] == "Me" && len(segments) == 1:
+		if s.allow(rw, r, http.MethodGet, http.MethodPut, http.MethodPatch) {
+			s.me(rw, r)
+		}
+		return
+	case segments[0] == "Bulk" && len(segments) == 1:
+		if s.allow(rw, r, http.MethodPost) {
+			s.bulk(rw, r)
+		}
+		return
+	case segments[0] == ".search" && len(segments) == 1:
+		if s.allow(rw, r, http.MethodPost) {
+			s.search(rw, r, s.options.Search)
+		}
+		return
+	case segments[0] == "Operations" && len(segments) == 2:
+		if s.allow(rw, r, http.MethodGet) {
+			s.operation(rw, r, segments[1])
+		}
+		return
+	default:
+		endpoint, ok := s.endpoints[segments[0]]
+		if !ok {
+			break
+		}
+		switch {
+		case len(segments) == 1:
+			if s.allow(rw, r, http.MethodGet, http.MethodPost) {
+				if r.Method == http.MethodPost {
+					s.create(rw, r, endpoint)
+				} else {
+					s.search(rw, r, endpoint.Query)
+				}
+			}
+		case segments[1] == ".search" && len(segments) == 2:
+			if s.allow(rw, r, http.MethodPost) {
+				s.search(rw, r, endpoint.Query)
+			}
+		case len(segments) == 2:
+			if s.allow(rw, r, http.MethodGet, http.MethodPut, http.MethodPatch, http.MethodDelete) {
+				s.resource(rw, r, endpoint, segments[1])
+			}
+		case segments[2] == "members":
+			if s.allow(rw, r, http.MethodGet, http.MethodPatch) {
+				if r.Method == http.MethodPatch {
+					s.membership(rw, r, endpoint, segments[1])
+				} else {
+					s.members(rw, r, endpoint, segments[1])
+				}
+			}
+		case segments[2] == "history":
+			if s.allow(rw, r, http.MethodGet) {
+				s.history(rw, r, endpoint, segments[1])
+			}
+		default:
+			s.writeError(rw, r, fmt.Errorf("%w: no endpoint at '%s'", spec.ErrNotFound, r.URL.Path))
+		}
+		return
+	}
+
+	s.writeError(rw, r, fmt.Errorf("%w: no endpoint at '%s'", spec.ErrNotFound, r.URL.Path))
+}
+
+// Returns true if the method of the request is one of the methods. Otherwise, the error of spec.ErrMethodNotAllowed is
+// written, with the methods in the Allow header.
+func (s *server) allow(rw http.ResponseWriter, r *http.Request, methods ...string) bool {
+	for _, method := range methods {
+		if r.Method == method {
+			return true
+		}
+	}
+	rw.Header().Set("Allow", strings.Join(methods, ", "))
+	s.writeError(rw, r, fmt.Errorf("%w: method %s is not allowed on '%s'", spec.ErrMethodNotAllowed, r.Method, r.URL.Path))
+	return false
+}
+
+func (s *server) create(rw http.ResponseWriter, r *http.Request, endpoint *Endpoint) {
+	if endpoint.Async != nil {
+		cr, closer := CreateRequest(r)
+		defer closer()
+		resp, err := endpoint.Async.Create(r.Context(), cr)
+		s.accepted(rw, r, resp, err)
+		return
+	}
+	if endpoint.Create == nil {
+		s.notImplemented(rw, r)
+		return
+	}
+
+	cr, closer := CreateRequest(r)
+	defer closer()
+
+	resp, err := endpoint.Create.Do(r.Context(), cr)
+	if err != nil {
+		s.writeError(rw, r, err)
+		return
+	}
+
+	if resp.DryRun {
+		rw.Header().Set("Dry-Run", "true")
+		_ = WriteResourceToResponseContext(r.Context(), rw, resp.Resource)
+		return
+	}
+
+	if resp.Replayed {
+		rw.Header().Set("Idempotent-Replayed", "true")
+	}
+	s.writeResource(rw, r, http.StatusCreated, resp.Resource, nil)
+}
+
+func (s *server) resource(rw http.ResponseWriter, r *http.Request, endpoint *Endpoint, id string) {
+	switch r.Method {
+	case http.MethodGet:
+		if endpoint.Get == nil {
+			s.notImplemented(rw, r)
+			return
+		}
+		s.get(rw, r, func(projection *crud.Projection) (*service.GetResponse, error) {
+			return endpoint.Get.Do(r.Context(), &service.GetRequest{ResourceID: id, Projection: projection})
+		})
+	case http.MethodPut:
+		if endpoint.Async != nil {
+			reqFunc, closer := ReplaceRequest(r)
+			defer closer()
+			resp, err := endpoint.Async.Replace(r.Context(), reqFunc(id))
+			s.accepted(rw, r, resp, err)
+			return
+		}
+		if endpoint.Replace == nil {
+			s.notImplemented(rw, r)
+			return
+		}
+		reqFunc, closer := ReplaceRequest(r)
+		defer closer()
+		resp, err := endpoint.Replace.Do(r.Context(), reqFunc(id))
+		s.modified(rw, r, resp, err)
+	case http.MethodPatch:
+		if endpoint.Patch == nil {
+			s.notImplemented(rw, r)
+			return
+		}
+		reqFunc, closer := PatchRequest(r)
+		defer closer()
+		resp, err := endpoint.Patch.Do(r.Context(), reqFunc(id))
+		s.modified(rw, r, resp, err)
+	case http.MethodDelete:
+		if endpoint.Async != nil {
+			resp, err := endpoint.Async.Delete(r.Context(), DeleteRequest(r)(id))
+			s.accepted(rw, r, resp, err)
+			return
+		}
+		if endpoint.Delete == nil {
+			s.notImplemented(rw, r)
+			return
+		}
+		if _, err := endpoint.Delete.Do(r.Context(), DeleteRequest(r)(id)); err != nil {
+			s.writeError(rw, r, err)
+			return
+		}
+		rw.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func (s *server) members(rw http.ResponseWriter, r *http.Request, endpoint *Endpoint, id string) {
+	if endpoint.Members == nil {
+		s.notImplemented(rw, r)
+		return
+	}
+
+	members := endpoint.ResourceType.SuperAttribute(true).SubAttributeForName("members")
+	if members != nil && !authz.From(r.Context()).Readable(endpoint.ResourceType, members) {
+		s.writeError(rw, r, fmt.Errorf("%w: 'members' may not be read", spec.ErrForbidden))
+		return
+	}
+
+	req, err := MembersRequestFromGet(r, id)
+	if err != nil {
+		s.writeError(rw, r, err)
+		return
+	}
+
+	resp, err := endpoint.Members.Do(r.Context(), req)
+	if err != nil {
+		s.writeError(rw, r, err)
+		return
+	}
+
+	_ = WriteMembersToResponse(&statusWriter{ResponseWriter: rw, status: http.StatusOK}, resp)
+}
+
+func (s *server) membership(rw http.ResponseWriter, r *http.Request, endpoint *Endpoint, id string) {
+	defer func() {
+		_ = r.Body.Close()
+	}()
+
+	if endpoint.Membership == nil {
+		s.notImplemented(rw, r)
+		return
+	}
+
+	req, err := MembershipRequestFromPatch(r, id)
+	if err != nil {
+		s.writeError(rw, r, err)
+		return
+	}
+
+	resp, err := endpoint.Membership.Do(r.Context(), req)
+	s.modified(rw, r, resp, err)
+}
+
+func (s *server) history(rw http.ResponseWriter, r *http.Request, endpoint *Endpoint, id string) {
+	if endpoint.History == nil {
+		s.notImplemented(rw, r)
+		return
+	}
+
+	resp, err := endpoint.History.Do(r.Context(), &service.HistoryRequest{ResourceID: id})
+	if err != nil {
+		s.writeError(rw, r, err)
+		return
+	}
+
+	_ = WriteHistoryToResponse(&statusWriter{ResponseWriter: rw, status: http.StatusOK}, resp)
+}
+
+func (s *server) operation(rw http.ResponseWriter, r *http.Request, id string) {
+	if s.options.Operations == nil {
+		s.notImplemented(rw, r)
+		return
+	}
+
+	resp, err := s.options.Operations.Do(r.Context(), &service.OperationRequest{OperationID: id})
+	if err != nil {
+		s.writeError(rw, r, err)
+		return
+	}
+
+	_ = WriteOperationToResponse(&statusWriter{ResponseWriter: rw, status: http.StatusOK}, resp.Operation)
+}
+
+// Writes the operation accepted by the Async service of an endpoint, along with its status endpoint in the Location
+// header, under the prefix the handler is served under.
+func (s *server) accepted(rw http.ResponseWriter, r *http.Request, resp *service.AsyncResponse, err error) {
+	if err != nil {
+		s.writeError(rw, r, err)
+		return
+	}
+
+	rw.Header().Set("Location", prefixOf(r)+"/Operations/"+resp.Operation.ID)
+	_ = WriteOperationToResponse(&statusWriter{ResponseWriter: rw, status: http.StatusAccepted}, resp.Operation)
+}
+
+// Returns the prefix the handler is served under, i.e. "/scim/v2", which Mount and the adapters of routers strip from
+// the path of the request, as what the path of the original request URI has in front of the path of the request.
+func prefixOf(r *http.Request) string {
+	original, err := url.ParseRequestURI(r.RequestURI)
+	if err != nil {
+		return ""
+	}
+	prefix := strings.TrimSuffix(original.EscapedPath(), r.URL.EscapedPath())
+	if len(prefix) == len(original.EscapedPath()) {
+		return ""
+	}
+	return strings.TrimSuffix(prefix, "/")
+}
+
+func (s *server) me(rw http.ResponseWriter, r *http.Request) {
+	if s.options.Me == nil {
+		s.notImplemented(rw, r)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		s.get(rw, r, func(projection *crud.Projection) (*service.GetResponse, error) {
+			return s.options.Me.Get(r.Context(), &service.GetRequest{Projection: projection})
+		})
+	case http.MethodPut:
+		reqFunc, closer := ReplaceRequest(r)
+		defer closer()
+		resp, err := s.options.Me.Replace(r.Context(), reqFunc(""))
+		s.modified(rw, r, resp, err)
+	case http.MethodPatch:
+		reqFunc, closer := PatchRequest(r)
+		defer closer()
+		resp, err := s.options.Me.Patch(r.Context(), reqFunc(""))
+		s.modified(rw, r, resp, err)
+	}
+}
+
+// Gets the resource with the projection of the request, answering conditional requests with 304 Not Modified.
+func (s *server) get(rw http.ResponseWriter, r *http.Request, get func(projection *crud.Projection) (*service.GetResponse, error)) {
+	projection, err := GetRequestProjection(r)
+	if err != nil {
+		s.writeError(rw, r, err)
+		return
+	}
+
+	resp, err := get(projection)
+	if err != nil {
+		s.writeError(rw, r, err)
+		return
+	}
+
+	if NotModified(r, resp.Resource) {
+		WriteNotModifiedToResponse(rw, resp.Resource)
+		return
+	}
+	s.writeResource(rw, r, http.StatusOK, resp.Resource, projection)
+}
+
+// Writes the response of a replacement or a patch, which is either a *service.ReplaceResponse or a
+// *service.PatchResponse.
+func (s *server) modified(rw http.ResponseWriter, r *http.Request, resp interface{}, err error) {
+	if err != nil {
+		s.writeError(rw, r, err)
+		return
+	}
+
+	var (
+		modified bool
+		dryRun   bool
+		resource *prop.Resource
+	)
+	switch resp := resp.(type) {
+	case *service.ReplaceResponse:
+		modified, dryRun, resource = resp.Replaced, resp.DryRun, resp.Resource
+	case *service.PatchResponse:
+		modified, dryRun, resource = resp.Patched, resp.DryRun, resp.Resource
+	}
+
+	if !modified {
+		rw.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if dryRun {
+		rw.Header().Set("Dry-Run", "true")
+	}
+	s.writeResource(rw, r, http.StatusOK, resource, nil)
+}
+
+func (s *server) bulk(rw http.ResponseWriter, r *http.Request) {
+	defer func() {
+		_ = r.Body.Close()
+	}()
+
+	if s.options.Bulk == nil {
+		s.notImplemented(rw, r)
+		return
+	}
+
+	resp, err := s.options.Bulk.Do(r.Context(), &service.BulkRequest{PayloadSource: r.Body})
+	if err != nil {
+		s.writeError(rw, r, err)
+		return
+	}
+
+	rw.Header().Set("Content-Type", spec.ApplicationScimJson)
+	rw.WriteHeader(http.StatusOK)
+	_ = WriteBulkResponseToResponse(rw, resp)
+}
+
+// Searches with the query parameters on GET, or the SearchRequest payload on POST.
+func (s *server) search(rw http.ResponseWriter, r *http.Request, query service.Query) {
+	if query == nil {
+		s.notImplemented(rw, r)
+		return
+	}
+
+	var (
+		req    *service.QueryRequest
+		err    error
+		closer func()
+	)
+	if r.Method == http.MethodGet {
+		req, err = QueryRequestFromGet(r)
+	} else {
+		req, closer, err = QueryRequestFromPost(r)
+	}
+	if closer != nil {
+		defer closer()
+	}
+	if err != nil {
+		s.writeError(rw, r, err)
+		return
+	}
+
+	resp, err := query.Do(r.Context(), req)
+	if err != nil {
+		s.writeError(rw, r, err)
+		return
+	}
+
+	_ = WriteSearchResultToResponseContext(r.Context(), rw, resp, projectionOptions(resp.Projection)...)
+}
+
+// Writes the resource with the status and the projection. The status is only written along with the body, after
+// WriteResourceToResponseContext has set the Location and ETag headers, which would otherwise be left out.
+func (s *server) writeResource(rw http.ResponseWriter, r *http.Request, status int, resource *prop.Resource, projection *crud.Projection) {
+	if err := WriteResourceToResponseContext(r.Context(), &statusWriter{ResponseWriter: rw, status: status}, resource, projectionOptions(projection)...); err != nil {
+		s.writeError(rw, r, err)
+	}
+}
+
+func (s *server) notImplemented(rw http.ResponseWriter, r *http.Request) {
+	s.writeError(rw, r, fmt.Errorf("%w: %s is not supported on '%s'", spec.ErrNotImplemented, r.Method, r.URL.Path))
+}
+
+func (s *server) writeError(rw http.ResponseWriter, r *http.Request, err error) {
+	if s.options.OnError != nil {
+		s.options.OnError(r, err)
+	}
+	_ = WriteError(rw, err)
+}
+
+// Returns the serialization options that apply the projection.
+func projectionOptions(projection *crud.Projection) []scimjson.Options {
+	var options []scimjson.Options
+	if projection != nil {
+		if len(projection.Attributes) > 0 {
+			options = append(options, scimjson.Include(projection.Attributes...))
+		}
+		if len(projection.ExcludedAttributes) > 0 {
+			options = append(options, scimjson.Exclude(projection.ExcludedAttributes...))
+		}
+	}
+	return options
+}
+
+// statusWriter is a http.ResponseWriter which writes the status right before the body.
+type statusWriter struct {
+	http.ResponseWriter
+	status  int
+	written bool
+}
+
+func (w *statusWriter) Write(p []byte) (int, error) {
+	if !w.written {
+		w.written = true
+		w.ResponseWriter.WriteHeader(w.status)
+	}
+	return w.ResponseWriter.Write(p)
+}
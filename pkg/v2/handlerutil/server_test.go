@@ -0,0 +1,547 @@
+package handlerutil
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/imulab/go-scim/pkg/v2/crud"
+	"github.com/imulab/go-scim/pkg/v2/db"
+	"github.com/imulab/go-scim/pkg/v2/service"
+	"github.com/imulab/go-scim/pkg/v2/service/filter"
+	"github.com/imulab/go-scim/pkg/v2/spec"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestServer(t *testing.T) {
+	s := new(ServerTestSuite)
+	suite.Run(t, s)
+}
+
+type ServerTestSuite struct {
+	suite.Suite
+	config       *spec.ServiceProviderConfig
+	resourceType *spec.ResourceType
+}
+
+func (s *ServerTestSuite) TestServeHTTP() {
+	memoryDB := db.Memory()
+	filters := []filter.ByResource{
+		filter.ByPropertyToByResource(
+			filter.ReadOnlyFilter(),
+			filter.UUIDFilter(),
+		),
+		filter.MetaFilter(),
+		filter.ByPropertyToByResource(filter.ValidationFilter(memoryDB)),
+	}
+	mux := http.NewServeMux()
+	Mount(mux, "/v2", NewServer(ServerOptions{
+		ServiceProviderConfig: s.config,
+		Endpoints: []*Endpoint{
+			{
+				ResourceType: s.resourceType,
+				Create:       service.CreateService(s.resourceType, memoryDB, filters),
+				Get:          service.GetService(memoryDB),
+				Query:        service.QueryService(s.config, memoryDB),
+				Replace:      service.ReplaceService(s.config, s.resourceType, memoryDB, filters),
+				Patch:        service.PatchService(s.config, memoryDB, nil, filters),
+				Delete:       service.DeleteService(s.config, memoryDB),
+			},
+		},
+	}))
+
+	var location string
+	tests := []struct {
+		name   string
+		method string
+		path   func() string
+		body   string
+		expect func(t *testing.T, rr *httptest.ResponseRecorder)
+	}{
+		{
+			name:   "create user",
+			method: http.MethodPost,
+			path:   func() string { return "/v2/Users" },
+			body:   `{"schemas": ["urn:ietf:params:scim:schemas:core:2.0:User"], "userName": "foo", "emails": [{"value": "foo@example.com"}]}`,
+			expect: func(t *testing.T, rr *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusCreated, rr.Code)
+				assert.Equal(t, spec.ApplicationScimJson, rr.Header().Get("Content-Type"))
+				assert.True(t, strings.HasPrefix(rr.Header().Get("Location"), "/Users/"))
+				assert.NotEmpty(t, rr.Header().Get("ETag"))
+				location = rr.Header().Get("Location")
+			},
+		},
+		{
+			name:   "create duplicate user",
+			method: http.MethodPost,
+			path:   func() string { return "/v2/Users" },
+			body:   `{"schemas": ["urn:ietf:params:scim:schemas:core:2.0:User"], "userName": "foo", "emails": [{"value": "foo@example.com"}]}`,
+			expect: func(t *testing.T, rr *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusConflict, rr.Code)
+				assert.Equal(t, spec.ApplicationScimJson, rr.Header().Get("Content-Type"))
+			},
+		},
+		{
+			name:   "get user",
+			method: http.MethodGet,
+			path:   func() string { return "/v2" + location + "?attributes=userName" },
+			expect: func(t *testing.T, rr *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusOK, rr.Code)
+				assert.Equal(t, location, rr.Header().Get("Location"))
+				assert.Contains(t, rr.Body.String(), `"userName":"foo"`)
+			},
+		},
+		{
+			name:   "query users",
+			method: http.MethodGet,
+			path:   func() string { return `/v2/Users?filter=userName%20eq%20%22foo%22` },
+			expect: func(t *testing.T, rr *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusOK, rr.Code)
+				assert.Contains(t, rr.Body.String(), `"totalResults":1`)
+			},
+		},
+		{
+			name:   "search users",
+			method: http.MethodPost,
+			path:   func() string { return "/v2/Users/.search" },
+			body:   `{"schemas": ["urn:ietf:params:scim:api:messages:2.0:SearchRequest"], "filter": "userName eq \"bar\""}`,
+			expect: func(t *testing.T, rr *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusOK, rr.Code)
+				assert.Contains(t, rr.Body.String(), `"totalResults":0`)
+			},
+		},
+		{
+			name:   "patch user",
+			method: http.MethodPatch,
+			path:   func() string { return "/v2" + location },
+			body:   `{"schemas": ["urn:ietf:params:scim:api:messages:2.0:PatchOp"], "Operations": [{"op": "add", "path": "displayName", "value": "Foo"}]}`,
+			expect: func(t *testing.T, rr *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusOK, rr.Code)
+				assert.Contains(t, rr.Body.String(), `"displayName":"Foo"`)
+			},
+		},
+		{
+			name:   "patch user without change",
+			method: http.MethodPatch,
+			path:   func() string { return "/v2" + location },
+			body:   `{"schemas": ["urn:ietf:params:scim:api:messages:2.0:PatchOp"], "Operations": [{"op": "add", "path": "displayName", "value": "Foo"}]}`,
+			expect: func(t *testing.T, rr *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusNoContent, rr.Code)
+			},
+		},
+		{
+			name:   "replace user",
+			method: http.MethodPut,
+			path:   func() string { return "/v2" + location },
+			body:   `{"schemas": ["urn:ietf:params:scim:schemas:core:2.0:User"], "userName": "bar", "emails": [{"value": "bar@example.com"}]}`,
+			expect: func(t *testing.T, rr *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusOK, rr.Code)
+				assert.Contains(t, rr.Body.String(), `"userName":"bar"`)
+			},
+		},
+		{
+			name:   "delete user",
+			method: http.MethodDelete,
+			path:   func() string { return "/v2" + location },
+			expect: func(t *testing.T, rr *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusNoContent, rr.Code)
+			},
+		},
+		{
+			name:   "get deleted user",
+			method: http.MethodGet,
+			path:   func() string { return "/v2" + location },
+			expect: func(t *testing.T, rr *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusNotFound, rr.Code)
+				assert.Equal(t, spec.ApplicationScimJson, rr.Header().Get("Content-Type"))
+			},
+		},
+		{
+			name:   "method not allowed",
+			method: http.MethodDelete,
+			path:   func() string { return "/v2/Users" },
+			expect: func(t *testing.T, rr *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusMethodNotAllowed, rr.Code)
+				assert.Equal(t, "GET, POST", rr.Header().Get("Allow"))
+				assert.Contains(t, rr.Body.String(), `"scimType":"methodNotAllowed"`)
+			},
+		},
+		{
+			name:   "unknown endpoint",
+			method: http.MethodGet,
+			path:   func() string { return "/v2/Devices" },
+			expect: func(t *testing.T, rr *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusNotFound, rr.Code)
+				assert.Contains(t, rr.Body.String(), `"scimType":"notFound"`)
+			},
+		},
+		{
+			name:   "endpoint not configured",
+			method: http.MethodGet,
+			path:   func() string { return "/v2/Me" },
+			expect: func(t *testing.T, rr *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusNotImplemented, rr.Code)
+			},
+		},
+	}
+
+	for _, test := range tests {
+		s.T().Run(test.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			mux.ServeHTTP(rr, httptest.NewRequest(test.method, test.path(), strings.NewReader(test.body)))
+			test.expect(t, rr)
+		})
+	}
+}
+
+func (s *ServerTestSuite) TestDiscovery() {
+	handler := NewServer(ServerOptions{
+		ServiceProviderConfig: s.config,
+		Endpoints:             []*Endpoint{{ResourceType: s.resourceType}},
+	})
+
+	// schemas registered after the handler is created are served too
+	raw, err := ioutil.ReadFile("../../../public/schemas/group_schema.json")
+	require.Nil(s.T(), err)
+	schema := new(spec.Schema)
+	require.Nil(s.T(), json.Unmarshal(raw, schema))
+	spec.Schemas().Register(schema)
+
+	tests := []struct {
+		name   string
+		path   string
+		expect func(t *testing.T, rr *httptest.ResponseRecorder)
+	}{
+		{
+			name: "get service provider config",
+			path: "/ServiceProviderConfig",
+			expect: func(t *testing.T, rr *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusOK, rr.Code)
+				assert.Equal(t, spec.ApplicationScimJson, rr.Header().Get("Content-Type"))
+				assert.Contains(t, rr.Body.String(), `"documentationUri":"https://github.com/imulab/go-scim"`)
+				assert.Contains(t, rr.Body.String(), `"meta":{"location":"/ServiceProviderConfig","resourceType":"ServiceProviderConfig"}`)
+			},
+		},
+		{
+			name: "get resource types",
+			path: "/ResourceTypes",
+			expect: func(t *testing.T, rr *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusOK, rr.Code)
+				assert.Contains(t, rr.Body.String(), `"totalResults":1`)
+				assert.Contains(t, rr.Body.String(), `"endpoint":"/Users"`)
+			},
+		},
+		{
+			name: "get resource type",
+			path: "/ResourceTypes/User",
+			expect: func(t *testing.T, rr *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusOK, rr.Code)
+				assert.Contains(t, rr.Body.String(), `"endpoint":"/Users"`)
+				assert.Contains(t, rr.Body.String(), `"schemaExtensions":[{"schema":"urn:ietf:params:scim:schemas:extension:enterprise:2.0:User"`)
+			},
+		},
+		{
+			name: "get unknown resource type",
+			path: "/ResourceTypes/Group",
+			expect: func(t *testing.T, rr *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusNotFound, rr.Code)
+				assert.Equal(t, spec.ApplicationScimJson, rr.Header().Get("Content-Type"))
+			},
+		},
+		{
+			name: "get schemas",
+			path: "/Schemas",
+			expect: func(t *testing.T, rr *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusOK, rr.Code)
+				assert.Contains(t, rr.Body.String(), `"totalResults":3`)
+				assert.NotContains(t, rr.Body.String(), `"id":"`+spec.CoreSchemaId+`"`)
+				assert.Contains(t, rr.Body.String(), `"id":"urn:ietf:params:scim:schemas:extension:enterprise:2.0:User"`)
+				assert.Contains(t, rr.Body.String(), `"id":"urn:ietf:params:scim:schemas:core:2.0:Group"`)
+			},
+		},
+		{
+			name: "get schema",
+			path: "/Schemas/urn:ietf:params:scim:schemas:core:2.0:User",
+			expect: func(t *testing.T, rr *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusOK, rr.Code)
+				assert.Equal(t, spec.ApplicationScimJson, rr.Header().Get("Content-Type"))
+				assert.Contains(t, rr.Body.String(), `"name":"User"`)
+			},
+		},
+		{
+			name: "get core schema",
+			path: "/Schemas/" + spec.CoreSchemaId,
+			expect: func(t *testing.T, rr *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusNotFound, rr.Code)
+			},
+		},
+		{
+			name: "filter schemas",
+			path: `/Schemas?filter=name%20eq%20%22User%22`,
+			expect: func(t *testing.T, rr *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusForbidden, rr.Code)
+				assert.Contains(t, rr.Body.String(), `"scimType":"forbidden"`)
+			},
+		},
+		{
+			name: "filter resource types",
+			path: `/ResourceTypes?filter=name%20eq%20%22User%22`,
+			expect: func(t *testing.T, rr *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusForbidden, rr.Code)
+			},
+		},
+	}
+
+	for _, test := range tests {
+		s.T().Run(test.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, test.path, nil))
+			test.expect(t, rr)
+		})
+	}
+}
+
+func (s *ServerTestSuite) TestSubResources() {
+	groupResourceType := s.loadGroups()
+	var (
+		users      = db.Memory()
+		groups     = db.Memory()
+		history    = db.MemoryHistory()
+		operations = db.MemoryOperations()
+		filters    = []filter.ByResource{
+			filter.ByPropertyToByResource(filter.UUIDFilter()),
+			filter.MetaFilter(),
+		}
+	)
+	handler := NewServer(ServerOptions{
+		ServiceProviderConfig: s.config,
+		Endpoints: []*Endpoint{
+			{
+				ResourceType: s.resourceType,
+				Async: service.AsyncService(s.resourceType,
+					service.CreateService(s.resourceType, users, filters),
+					service.ReplaceService(s.config, s.resourceType, users, filters),
+					service.DeleteService(s.config, users),
+					operations,
+					inlineQueue{},
+				),
+				History: service.HistoryService(history),
+			},
+			{
+				ResourceType: groupResourceType,
+				Create:       service.CreateService(groupResourceType, groups, filters),
+				Members:      service.MembersService(s.config, groups),
+				Membership:   service.MembershipService(s.config, groups, nil, filters),
+			},
+		},
+		Operations: service.OperationService(operations),
+	})
+
+	var operation, group string
+	tests := []struct {
+		name   string
+		method string
+		path   func() string
+		body   string
+		expect func(t *testing.T, rr *httptest.ResponseRecorder)
+	}{
+		{
+			name:   "create user asynchronously",
+			method: http.MethodPost,
+			path:   func() string { return "/Users" },
+			body:   `{"schemas": ["urn:ietf:params:scim:schemas:core:2.0:User"], "userName": "foo"}`,
+			expect: func(t *testing.T, rr *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusAccepted, rr.Code)
+				assert.Equal(t, spec.ApplicationScimJson, rr.Header().Get("Content-Type"))
+				assert.True(t, strings.HasPrefix(rr.Header().Get("Location"), "/Operations/"))
+				operation = rr.Header().Get("Location")
+			},
+		},
+		{
+			name:   "get operation",
+			method: http.MethodGet,
+			path:   func() string { return operation },
+			expect: func(t *testing.T, rr *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusOK, rr.Code)
+				assert.Equal(t, spec.ApplicationScimJson, rr.Header().Get("Content-Type"))
+				assert.Contains(t, rr.Body.String(), `"status":"succeeded"`)
+			},
+		},
+		{
+			name:   "get history",
+			method: http.MethodGet,
+			path: func() string {
+				require.Nil(s.T(), history.Append(context.Background(), &db.ChangeRecord{ResourceID: "foo", Operation: "create"}))
+				return "/Users/foo/history"
+			},
+			expect: func(t *testing.T, rr *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusOK, rr.Code)
+				assert.Equal(t, spec.ApplicationScimJson, rr.Header().Get("Content-Type"))
+				assert.Contains(t, rr.Body.String(), `"totalResults":1`)
+			},
+		},
+		{
+			name:   "create group",
+			method: http.MethodPost,
+			path:   func() string { return "/Groups" },
+			body:   `{"schemas": ["urn:ietf:params:scim:schemas:core:2.0:Group"], "displayName": "foo", "members": [{"value": "a"}]}`,
+			expect: func(t *testing.T, rr *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusCreated, rr.Code)
+				group = rr.Header().Get("Location")
+			},
+		},
+		{
+			name:   "add members",
+			method: http.MethodPatch,
+			path:   func() string { return group + "/members" },
+			body:   `{"add": ["b"]}`,
+			expect: func(t *testing.T, rr *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusOK, rr.Code)
+				assert.Contains(t, rr.Body.String(), `"value":"b"`)
+			},
+		},
+		{
+			name:   "get members",
+			method: http.MethodGet,
+			path:   func() string { return group + "/members?count=1" },
+			expect: func(t *testing.T, rr *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusOK, rr.Code)
+				assert.Equal(t, spec.ApplicationScimJson, rr.Header().Get("Content-Type"))
+				assert.Contains(t, rr.Body.String(), `"totalResults":2`)
+				assert.Contains(t, rr.Body.String(), `"itemsPerPage":1`)
+			},
+		},
+		{
+			name:   "members not configured",
+			method: http.MethodGet,
+			path:   func() string { return "/Users/foo/members" },
+			expect: func(t *testing.T, rr *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusNotImplemented, rr.Code)
+			},
+		},
+		{
+			name:   "method not allowed on members",
+			method: http.MethodDelete,
+			path:   func() string { return group + "/members" },
+			expect: func(t *testing.T, rr *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusMethodNotAllowed, rr.Code)
+				assert.Equal(t, "GET, PATCH", rr.Header().Get("Allow"))
+			},
+		},
+		{
+			name:   "unknown sub resource",
+			method: http.MethodGet,
+			path:   func() string { return "/Users/foo/bar" },
+			expect: func(t *testing.T, rr *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusNotFound, rr.Code)
+			},
+		},
+	}
+
+	for _, test := range tests {
+		s.T().Run(test.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, httptest.NewRequest(test.method, test.path(), strings.NewReader(test.body)))
+			test.expect(t, rr)
+		})
+	}
+
+	s.T().Run("create user asynchronously under a prefix", func(t *testing.T) {
+		mux := http.NewServeMux()
+		Mount(mux, "/scim/v2", handler)
+
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/scim/v2/Users", strings.NewReader(`{"schemas": ["urn:ietf:params:scim:schemas:core:2.0:User"], "userName": "bar"}`)))
+		assert.Equal(t, http.StatusAccepted, rr.Code)
+		location := rr.Header().Get("Location")
+		assert.True(t, strings.HasPrefix(location, "/scim/v2/Operations/"))
+
+		rr = httptest.NewRecorder()
+		mux.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, location, nil))
+		assert.Equal(t, http.StatusOK, rr.Code)
+	})
+}
+
+// Registers the group schema and resource type, which are only served by some of the tests.
+func (s *ServerTestSuite) loadGroups() *spec.ResourceType {
+	raw, err := ioutil.ReadFile("../../../public/schemas/group_schema.json")
+	require.Nil(s.T(), err)
+	schema := new(spec.Schema)
+	require.Nil(s.T(), json.Unmarshal(raw, schema))
+	spec.Schemas().Register(schema)
+
+	raw, err = ioutil.ReadFile("../../../public/resource_types/group_resource_type.json")
+	require.Nil(s.T(), err)
+	resourceType := new(spec.ResourceType)
+	require.Nil(s.T(), json.Unmarshal(raw, resourceType))
+	crud.Register(resourceType)
+	return resourceType
+}
+
+// inlineQueue executes jobs as soon as they are enqueued.
+type inlineQueue struct{}
+
+func (inlineQueue) Enqueue(ctx context.Context, job service.Job) error {
+	job(ctx)
+	return nil
+}
+
+func (s *ServerTestSuite) SetupSuite() {
+	for _, each := range []struct {
+		filepath  string
+		structure interface{}
+		post      func(parsed interface{})
+	}{
+		{
+			filepath:  "../../../public/schemas/core_schema.json",
+			structure: new(spec.Schema),
+			post: func(parsed interface{}) {
+				spec.Schemas().Register(parsed.(*spec.Schema))
+			},
+		},
+		{
+			filepath:  "../../../public/schemas/user_schema.json",
+			structure: new(spec.Schema),
+			post: func(parsed interface{}) {
+				spec.Schemas().Register(parsed.(*spec.Schema))
+			},
+		},
+		{
+			filepath:  "../../../public/schemas/user_enterprise_extension_schema.json",
+			structure: new(spec.Schema),
+			post: func(parsed interface{}) {
+				spec.Schemas().Register(parsed.(*spec.Schema))
+			},
+		},
+		{
+			filepath:  "../../../public/resource_types/user_resource_type.json",
+			structure: new(spec.ResourceType),
+			post: func(parsed interface{}) {
+				s.resourceType = parsed.(*spec.ResourceType)
+				crud.Register(s.resourceType)
+			},
+		},
+		{
+			filepath:  "../../../public/service_provider_config.json",
+			structure: new(spec.ServiceProviderConfig),
+			post: func(parsed interface{}) {
+				s.config = parsed.(*spec.ServiceProviderConfig)
+			},
+		},
+	} {
+		raw, err := ioutil.ReadFile(each.filepath)
+		require.Nil(s.T(), err)
+
+		err = json.Unmarshal(raw, each.structure)
+		require.Nil(s.T(), err)
+
+		if each.post != nil {
+			each.post(each.structure)
+		}
+	}
+}
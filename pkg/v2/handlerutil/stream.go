@@ -0,0 +1,157 @@
+package handlerutil
+
+import (
+	"fmt"
+	scimjson "github.com/imulab/go-scim/pkg/v2/json"
+	"github.com/imulab/go-scim/pkg/v2/spec"
+	"io"
+	"net/http"
+	"strconv"
+)
+
+// ResourceIterator provides resources one at a time to be streamed into a ListResponse. Next returns the next resource
+// and true; or nil and false when the sequence is exhausted. Any error returned aborts the stream.
+type ResourceIterator interface {
+	Next() (resource scimjson.Serializable, ok bool, err error)
+}
+
+// ResourceIteratorFunc is the function adapter of ResourceIterator.
+type ResourceIteratorFunc func() (scimjson.Serializable, bool, error)
+
+func (f ResourceIteratorFunc) Next() (scimjson.Serializable, bool, error) {
+	return f()
+}
+
+// ChannelIterator returns a ResourceIterator that receives resources from the channel until it is closed.
+func ChannelIterator(ch <-chan scimjson.Serializable) ResourceIterator {
+	return ResourceIteratorFunc(func() (scimjson.Serializable, bool, error) {
+		resource, ok := <-ch
+		return resource, ok, nil
+	})
+}
+
+// NewListResponseWriter returns a ListResponseWriter that writes a ListResponse to the writer. The totalResults and
+// startIndex are known upfront while itemsPerPage is computed from the number of resources written. The options are
+// applied to each resource individually.
+func NewListResponseWriter(w io.Writer, totalResults int, startIndex int, options ...scimjson.Options) *ListResponseWriter {
+	return &ListResponseWriter{
+		w:            w,
+		totalResults: totalResults,
+		startIndex:   startIndex,
+		options:      options,
+	}
+}
+
+// ListResponseWriter writes a ListResponse with its Resources array streamed element by element, so that the full
+// page of resources never has to be held in memory. Resources are written using Write and the response is terminated
+// using Close. Because the itemsPerPage field is only known after the last resource, it is written after Resources.
+//
+// Once the first byte is written, errors can no longer be reported through an error response. Callers should abandon
+// the response (i.e. close the connection) when Write or Close returns an error.
+type ListResponseWriter struct {
+	w            io.Writer
+	totalResults int
+	startIndex   int
+	options      []scimjson.Options
+	count        int
+	started      bool
+	closed       bool
+}
+
+// Write serializes the resource, subject to the options, and appends it to the Resources array.
+func (w *ListResponseWriter) Write(resource scimjson.Serializable) error {
+	if w.closed {
+		return fmt.Errorf("%w: list response writer is closed", spec.ErrInternal)
+	}
+
+	raw, err := scimjson.Serialize(resource, w.options...)
+	if err != nil {
+		return err
+	}
+
+	if err := w.begin(); err != nil {
+		return err
+	}
+	if w.count > 0 {
+		if _, err := w.w.Write([]byte{','}); err != nil {
+			return err
+		}
+	}
+	if _, err := w.w.Write(raw); err != nil {
+		return err
+	}
+	w.count++
+
+	if f, ok := w.w.(http.Flusher); ok {
+		f.Flush()
+	}
+	return nil
+}
+
+// Close terminates the Resources array and writes the remaining fields of the ListResponse. Close is idempotent.
+func (w *ListResponseWriter) Close() error {
+	if w.closed {
+		return nil
+	}
+	if err := w.begin(); err != nil {
+		return err
+	}
+	w.closed = true
+	_, err := io.WriteString(w.w, `],"itemsPerPage":`+strconv.Itoa(w.count)+`}`)
+	return err
+}
+
+// Count returns the number of resources written so far.
+func (w *ListResponseWriter) Count() int {
+	return w.count
+}
+
+func (w *ListResponseWriter) begin() error {
+	if w.started {
+		return nil
+	}
+	w.started = true
+	_, err := io.WriteString(w.w, `{"schemas":["urn:ietf:params:scim:api:messages:2.0:ListResponse"],`+
+		`"totalResults":`+strconv.Itoa(w.totalResults)+`,`+
+		`"startIndex":`+strconv.Itoa(w.startIndex)+`,`+
+		`"Resources":[`)
+	return err
+}
+
+// StreamSearchResultToResponse writes a ListResponse to http.ResponseWriter, streaming resources from the iterator one
+// by one and respecting the attributes or excludedAttributes specified through options. It is the streaming
+// counterpart of WriteSearchResultToResponse, suitable for piping resources directly from a database cursor.
+// The callback, if not nil, is invoked after each resource is written, which gives the caller a chance to perform
+// per resource bookkeeping or stop the stream by returning an error.
+// This method also sets Content-Type header to application/scim+json. This method does not set response status, which
+// should be set before calling this method. Any error during the process will be returned.
+func StreamSearchResultToResponse(
+	rw http.ResponseWriter,
+	totalResults int,
+	startIndex int,
+	iterator ResourceIterator,
+	callback func(resource scimjson.Serializable) error,
+	options ...scimjson.Options,
+) error {
+	rw.Header().Set("Content-Type", spec.ApplicationScimJson)
+
+	w := NewListResponseWriter(rw, totalResults, startIndex, options...)
+	for {
+		resource, ok, err := iterator.Next()
+		if err != nil {
+			return err
+		} else if !ok {
+			break
+		}
+
+		if err := w.Write(resource); err != nil {
+			return err
+		}
+		if callback != nil {
+			if err := callback(resource); err != nil {
+				return err
+			}
+		}
+	}
+	return w.Close()
+}
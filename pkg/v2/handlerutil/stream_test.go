@@ -0,0 +1,187 @@
+package handlerutil
+
+import (
+	"encoding/json"
+	"errors"
+	scimjson "github.com/imulab/go-scim/pkg/v2/json"
+	"github.com/imulab/go-scim/pkg/v2/prop"
+	"github.com/imulab/go-scim/pkg/v2/spec"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+func TestStreamSearchResult(t *testing.T) {
+	s := new(StreamSearchResultTestSuite)
+	suite.Run(t, s)
+}
+
+type StreamSearchResultTestSuite struct {
+	suite.Suite
+	resourceType *spec.ResourceType
+}
+
+func (s *StreamSearchResultTestSuite) TestStream() {
+	tests := []struct {
+		name     string
+		iterator func(t *testing.T) ResourceIterator
+		options  []scimjson.Options
+		expect   func(t *testing.T, raw []byte, err error)
+	}{
+		{
+			name: "stream from channel with projection",
+			iterator: func(t *testing.T) ResourceIterator {
+				ch := make(chan scimjson.Serializable, 2)
+				ch <- s.newUser(t, "a", "alice")
+				ch <- s.newUser(t, "b", "bob")
+				close(ch)
+				return ChannelIterator(ch)
+			},
+			options: []scimjson.Options{scimjson.Include("userName")},
+			expect: func(t *testing.T, raw []byte, err error) {
+				assert.Nil(t, err)
+				assert.JSONEq(t, `
+{
+  "schemas": ["urn:ietf:params:scim:api:messages:2.0:ListResponse"],
+  "totalResults": 10,
+  "startIndex": 1,
+  "itemsPerPage": 2,
+  "Resources": [
+    {"schemas": ["urn:ietf:params:scim:schemas:core:2.0:User"], "id": "a", "userName": "alice"},
+    {"schemas": ["urn:ietf:params:scim:schemas:core:2.0:User"], "id": "b", "userName": "bob"}
+  ]
+}
+`, string(raw))
+			},
+		},
+		{
+			name: "empty stream",
+			iterator: func(t *testing.T) ResourceIterator {
+				ch := make(chan scimjson.Serializable)
+				close(ch)
+				return ChannelIterator(ch)
+			},
+			expect: func(t *testing.T, raw []byte, err error) {
+				assert.Nil(t, err)
+				assert.JSONEq(t, `
+{
+  "schemas": ["urn:ietf:params:scim:api:messages:2.0:ListResponse"],
+  "totalResults": 10,
+  "startIndex": 1,
+  "itemsPerPage": 0,
+  "Resources": []
+}
+`, string(raw))
+			},
+		},
+		{
+			name: "iterator error aborts stream",
+			iterator: func(t *testing.T) ResourceIterator {
+				return ResourceIteratorFunc(func() (scimjson.Serializable, bool, error) {
+					return nil, false, spec.ErrInternal
+				})
+			},
+			expect: func(t *testing.T, raw []byte, err error) {
+				assert.Equal(t, spec.ErrInternal, err)
+			},
+		},
+	}
+
+	for _, test := range tests {
+		s.T().Run(test.name, func(t *testing.T) {
+			rw := httptest.NewRecorder()
+			err := StreamSearchResultToResponse(rw, 10, 1, test.iterator(t), nil, test.options...)
+			if err == nil {
+				assert.Equal(t, spec.ApplicationScimJson, rw.Header().Get("Content-Type"))
+			}
+			test.expect(t, rw.Body.Bytes(), err)
+		})
+	}
+}
+
+func (s *StreamSearchResultTestSuite) TestCallback() {
+	ch := make(chan scimjson.Serializable, 3)
+	ch <- s.newUser(s.T(), "a", "alice")
+	ch <- s.newUser(s.T(), "b", "bob")
+	ch <- s.newUser(s.T(), "c", "carl")
+	close(ch)
+
+	var (
+		seen    = 0
+		errStop = errors.New("stop")
+	)
+	err := StreamSearchResultToResponse(httptest.NewRecorder(), 3, 1, ChannelIterator(ch), func(resource scimjson.Serializable) error {
+		seen++
+		if seen == 2 {
+			return errStop
+		}
+		return nil
+	})
+	assert.Equal(s.T(), errStop, err)
+	assert.Equal(s.T(), 2, seen)
+}
+
+func (s *StreamSearchResultTestSuite) newUser(t *testing.T, id string, userName string) *prop.Resource {
+	r := prop.NewResource(s.resourceType)
+	require.False(t, r.Navigator().Replace(map[string]interface{}{
+		"schemas":  []interface{}{"urn:ietf:params:scim:schemas:core:2.0:User"},
+		"id":       id,
+		"userName": userName,
+		"active":   true,
+	}).HasError())
+	return r
+}
+
+func (s *StreamSearchResultTestSuite) SetupSuite() {
+	for _, each := range []struct {
+		filepath  string
+		structure interface{}
+		post      func(parsed interface{})
+	}{
+		{
+			filepath:  "../../../public/schemas/core_schema.json",
+			structure: new(spec.Schema),
+			post: func(parsed interface{}) {
+				spec.Schemas().Register(parsed.(*spec.Schema))
+			},
+		},
+		{
+			filepath:  "../../../public/schemas/user_schema.json",
+			structure: new(spec.Schema),
+			post: func(parsed interface{}) {
+				spec.Schemas().Register(parsed.(*spec.Schema))
+			},
+		},
+		{
+			filepath:  "../../../public/schemas/user_enterprise_extension_schema.json",
+			structure: new(spec.Schema),
+			post: func(parsed interface{}) {
+				spec.Schemas().Register(parsed.(*spec.Schema))
+			},
+		},
+		{
+			filepath:  "../../../public/resource_types/user_resource_type.json",
+			structure: new(spec.ResourceType),
+			post: func(parsed interface{}) {
+				s.resourceType = parsed.(*spec.ResourceType)
+			},
+		},
+	} {
+		f, err := os.Open(each.filepath)
+		require.Nil(s.T(), err)
+
+		raw, err := ioutil.ReadAll(f)
+		require.Nil(s.T(), err)
+
+		err = json.Unmarshal(raw, each.structure)
+		require.Nil(s.T(), err)
+
+		if each.post != nil {
+			each.post(each.structure)
+		}
+	}
+}
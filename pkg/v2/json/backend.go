@@ -0,0 +1,96 @@
+package json
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/imulab/go-scim/pkg/v2/spec"
+	"sync/atomic"
+)
+
+// Backend is the low level JSON implementation used to encode and decode plain Go values, such as request payloads,
+// search results and error messages. When a backend other than the default is in use, resources go through it as well:
+// Serialize renders the properties of the resource as plain Go values for the backend to encode, while Deserialize,
+// DeserializeProperty and DeserializeValue assign the plain Go values decoded by the backend to the properties, with
+// the same rules as the built-in parser. The default backend leaves resources to the built-in serializer and parser of
+// this package instead, which work on the properties directly and hence cost less than producing or consuming plain Go
+// values (see BenchmarkSerialize and BenchmarkDeserialize).
+//
+// The method set is compatible with the standard library, jsoniter's frozen configurations (i.e.
+// jsoniter.ConfigCompatibleWithStandardLibrary) and sonic's configurations (i.e. sonic.ConfigStd), so these can be
+// plugged in directly using UseBackend without any adapter:
+//
+//	json.UseBackend(jsoniter.ConfigCompatibleWithStandardLibrary)
+type Backend interface {
+	// Marshal returns the JSON encoding of v.
+	Marshal(v interface{}) ([]byte, error)
+	// Unmarshal parses the JSON encoded data and stores the result in the value pointed to by v.
+	Unmarshal(data []byte, v interface{}) error
+}
+
+// StdBackend returns the Backend implemented by the standard library encoding/json. This is the default backend.
+func StdBackend() Backend {
+	return stdBackend{}
+}
+
+// UseBackend replaces the Backend used by this module. It is intended to be called once during initialization, before
+// any requests are served. A nil backend restores the default.
+func UseBackend(b Backend) {
+	if b == nil {
+		b = stdBackend{}
+	}
+	backend.Store(backendHolder{b})
+}
+
+// Marshal encodes v using the current Backend.
+func Marshal(v interface{}) ([]byte, error) {
+	return currentBackend().Marshal(v)
+}
+
+// Unmarshal decodes data into v using the current Backend.
+func Unmarshal(data []byte, v interface{}) error {
+	return currentBackend().Unmarshal(data, v)
+}
+
+// The current backend, stored as backendHolder so that the concrete type stored is always the same.
+var backend atomic.Value
+
+type backendHolder struct {
+	Backend
+}
+
+func init() {
+	backend.Store(backendHolder{stdBackend{}})
+}
+
+func currentBackend() Backend {
+	return backend.Load().(backendHolder).Backend
+}
+
+// Reports whether b is the default backend, which leaves resources to the built-in serializer and parser.
+func isStdBackend(b Backend) bool {
+	_, ok := b.(stdBackend)
+	return ok
+}
+
+// Decode the JSON input into plain Go values using the backend. When the backend rejects the input, the built-in
+// scanner is used to locate the error, so that the error message remains consistent among backends.
+func decode(b Backend, data []byte) (interface{}, error) {
+	var value interface{}
+	if err := b.Unmarshal(data, &value); err != nil {
+		if err := checkValid(data, &scanner{}); err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("%w: invalid json: %s", spec.ErrInvalidSyntax, err.Error())
+	}
+	return value, nil
+}
+
+type stdBackend struct{}
+
+func (stdBackend) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (stdBackend) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
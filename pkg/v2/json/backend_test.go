@@ -0,0 +1,258 @@
+package json
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/imulab/go-scim/pkg/v2/prop"
+	"github.com/imulab/go-scim/pkg/v2/spec"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"testing"
+)
+
+func TestUseBackend(t *testing.T) {
+	defer UseBackend(nil)
+
+	b := &countingBackend{}
+	UseBackend(b)
+
+	raw, err := Marshal(map[string]interface{}{"foo": "bar"})
+	assert.Nil(t, err)
+	assert.JSONEq(t, `{"foo":"bar"}`, string(raw))
+	assert.Equal(t, 1, b.marshal)
+
+	var v map[string]interface{}
+	assert.Nil(t, Unmarshal(raw, &v))
+	assert.Equal(t, "bar", v["foo"])
+	assert.Equal(t, 1, b.unmarshal)
+
+	_, _ = DeserializeValue([]byte(`"foo"`), &spec.Attribute{}, false)
+	assert.Equal(t, 2, b.unmarshal)
+
+	UseBackend(nil)
+	_, _ = Marshal("foo")
+	assert.Equal(t, 1, b.marshal)
+}
+
+func TestResourceThroughBackend(t *testing.T) {
+	defer UseBackend(nil)
+
+	resource := benchmarkResource(t)
+	expect, err := Serialize(resource)
+	require.Nil(t, err)
+
+	b := &countingBackend{}
+	UseBackend(b)
+
+	raw, err := Serialize(resource)
+	require.Nil(t, err)
+	assert.Equal(t, 1, b.marshal)
+	assert.JSONEq(t, string(expect), string(raw))
+
+	raw, err = Serialize(resource, Include("userName", "emails.value"))
+	require.Nil(t, err)
+	assert.JSONEq(t, `{
+  "schemas": ["urn:ietf:params:scim:schemas:core:2.0:User"],
+  "id": "3cc032f5-2361-417f-9e2f-bc80adddf4a3",
+  "userName": "imulab",
+  "emails": [{"value": "imulab@foo.com"}, {"value": "imulab@bar.com"}]
+}`, string(raw))
+
+	decoded := prop.NewResource(resource.ResourceType())
+	require.Nil(t, Deserialize(expect, decoded))
+	assert.Equal(t, 1, b.unmarshal)
+	assert.True(t, resource.RootProperty().Matches(decoded.RootProperty()))
+
+	err = Deserialize([]byte(`{"userName": 1, "emails": [{"primary": "yes"}], "name": {"givenName": true}}`), prop.NewResource(resource.ResourceType()))
+	if assert.NotNil(t, err) {
+		assert.Len(t, err.(spec.Errors), 3)
+	}
+
+	err = Deserialize([]byte(`{"userName": {}}`), prop.NewResource(resource.ResourceType()))
+	assert.Equal(t, spec.ErrInvalidSyntax, errors.Unwrap(err))
+
+	err = Deserialize([]byte(`{"foo": "bar"}`), prop.NewResource(resource.ResourceType()))
+	assert.Equal(t, spec.ErrInvalidPath, errors.Unwrap(err))
+
+	property, err := DeserializeValue([]byte(`{"value": "imulab@foo.com"}`), resource.ResourceType().SuperAttribute(true).SubAttributeForName("emails"), true)
+	require.Nil(t, err)
+	assert.Equal(t, 1, property.CountChildren())
+}
+
+func TestInvalidJSON(t *testing.T) {
+	tests := []struct {
+		name   string
+		json   string
+		expect func(t *testing.T, err error)
+	}{
+		{
+			name: "valid json",
+			json: `{"userName": "foo", "emails": [{"value": "foo@bar.com", "primary": true, "display": null}]}`,
+			expect: func(t *testing.T, err error) {
+				assert.Nil(t, err)
+			},
+		},
+		{
+			name: "truncated json",
+			json: `{"userName": `,
+			expect: func(t *testing.T, err error) {
+				assert.Equal(t, spec.ErrInvalidSyntax, errors.Unwrap(err))
+			},
+		},
+		{
+			name: "invalid character",
+			json: `{"userName": foo}`,
+			expect: func(t *testing.T, err error) {
+				assert.Equal(t, spec.ErrInvalidSyntax, errors.Unwrap(err))
+			},
+		},
+		{
+			name: "trailing data",
+			json: `{"userName": "foo"} {}`,
+			expect: func(t *testing.T, err error) {
+				assert.Equal(t, spec.ErrInvalidSyntax, errors.Unwrap(err))
+			},
+		},
+		{
+			name: "invalid character after unknown attribute",
+			json: `{"foo": "bar", "userName": foo}`,
+			expect: func(t *testing.T, err error) {
+				assert.Equal(t, spec.ErrInvalidSyntax, errors.Unwrap(err))
+			},
+		},
+		{
+			name: "invalid character after value of the wrong type",
+			json: `{"userName": 1, "active": foo}`,
+			expect: func(t *testing.T, err error) {
+				assert.Equal(t, spec.ErrInvalidSyntax, errors.Unwrap(err))
+			},
+		},
+	}
+
+	resourceType := benchmarkResource(t).ResourceType()
+	for _, backend := range []Backend{nil, &countingBackend{}} {
+		UseBackend(backend)
+		for _, test := range tests {
+			t.Run(fmt.Sprintf("%s (%T)", test.name, backend), func(t *testing.T) {
+				test.expect(t, Deserialize([]byte(test.json), prop.NewResource(resourceType)))
+			})
+		}
+	}
+	UseBackend(nil)
+}
+
+type countingBackend struct {
+	marshal   int
+	unmarshal int
+}
+
+func (b *countingBackend) Marshal(v interface{}) ([]byte, error) {
+	b.marshal++
+	return json.Marshal(v)
+}
+
+func (b *countingBackend) Unmarshal(data []byte, v interface{}) error {
+	b.unmarshal++
+	return json.Unmarshal(data, v)
+}
+
+// BenchmarkSerialize compares Serialize with encoding the resource through the backend, which needs the resource as
+// plain Go values first (see prop.Document). Producing those values alone costs more than Serialize, hence no
+// backend could make up for it.
+func BenchmarkSerialize(b *testing.B) {
+	resource := benchmarkResource(b)
+
+	b.Run("Serialize", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			_, _ = Serialize(resource)
+		}
+	})
+	b.Run("Document", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			_ = prop.Document(resource.RootProperty())
+		}
+	})
+	b.Run("Document and backend", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			_, _ = Marshal(prop.Document(resource.RootProperty()))
+		}
+	})
+}
+
+// BenchmarkDeserialize compares Deserialize with decoding the resource through the backend into plain Go values, then
+// assigning them to the resource. Most of the time is spent creating the properties of the resource, which a backend
+// does not do, while decoding through the backend allocates the plain Go values on top.
+func BenchmarkDeserialize(b *testing.B) {
+	resource := benchmarkResource(b)
+	raw, err := Serialize(resource)
+	require.Nil(b, err)
+
+	b.Run("Deserialize", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			_ = Deserialize(raw, prop.NewResource(resource.ResourceType()))
+		}
+	})
+	b.Run("NewResource", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			_ = prop.NewResource(resource.ResourceType())
+		}
+	})
+	b.Run("Backend and Replace", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			var data map[string]interface{}
+			_ = Unmarshal(raw, &data)
+			_, _ = prop.NewResource(resource.ResourceType()).RootProperty().Replace(data)
+		}
+	})
+}
+
+func benchmarkResource(b testing.TB) *prop.Resource {
+	for _, path := range []string{
+		"../../../public/schemas/core_schema.json",
+		"../../../public/schemas/user_schema.json",
+		"../../../public/schemas/user_enterprise_extension_schema.json",
+	} {
+		raw, err := ioutil.ReadFile(path)
+		require.Nil(b, err)
+		schema := new(spec.Schema)
+		require.Nil(b, json.Unmarshal(raw, schema))
+		spec.Schemas().Register(schema)
+	}
+
+	raw, err := ioutil.ReadFile("../../../public/resource_types/user_resource_type.json")
+	require.Nil(b, err)
+	resourceType := new(spec.ResourceType)
+	require.Nil(b, json.Unmarshal(raw, resourceType))
+
+	resource := prop.NewResource(resourceType)
+	require.Nil(b, Deserialize([]byte(`
+{
+  "schemas": ["urn:ietf:params:scim:schemas:core:2.0:User"],
+  "id": "3cc032f5-2361-417f-9e2f-bc80adddf4a3",
+  "userName": "imulab",
+  "name": {
+    "formatted": "Mr. Weinan Qiu",
+    "familyName": "Qiu",
+    "givenName": "Weinan"
+  },
+  "displayName": "Weinan",
+  "active": true,
+  "emails": [
+    {"value": "imulab@foo.com", "type": "work", "primary": true},
+    {"value": "imulab@bar.com", "type": "home"}
+  ],
+  "phoneNumbers": [
+    {"value": "123-45678", "type": "work", "primary": true}
+  ]
+}
+`), resource))
+	return resource
+}
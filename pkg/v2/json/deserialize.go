@@ -1,6 +1,7 @@
 package json
 
 import (
+	"bytes"
 	"fmt"
 	"strconv"
 	"strings"
@@ -13,10 +14,20 @@ import (
 )
 
 // Deserialize is the entry point of JSON deserialization. Unmarshal the JSON input bytes into a pre-prepared unassigned
-// structure of Resource.
+// structure of Resource. The input is decoded by the current Backend when one other than the default is in use (see
+// UseBackend), and scanned in a single pass by the built-in parser otherwise.
+//
+// Values of the wrong type, such as a string for an integer attribute, do not stop the deserialization: the property is
+// left unassigned and the error is collected, so that all such errors are returned at once as spec.Errors. Errors in
+// the structure of the JSON input still stop the deserialization right away.
 func Deserialize(json []byte, resource *prop.Resource) error {
-	if err := checkValid(json, &scanner{}); err != nil {
-		return err
+	if b := currentBackend(); !isStdBackend(b) {
+		value, err := decode(b, json)
+		if err != nil {
+			return err
+		}
+		a := &assignState{navigator: resource.Navigator()}
+		return a.done(a.assignComplexProperty(value, false))
 	}
 
 	state := &deserializeState{
@@ -30,7 +41,7 @@ func Deserialize(json []byte, resource *prop.Resource) error {
 
 	// skip the first few spaces
 	state.scanWhile(scanSkipSpace)
-	return state.parseComplexProperty(false)
+	return state.end(state.parseComplexProperty(false))
 }
 
 // Entry point to deserialize a piece of JSON data into the given property. The JSON data is expected to be the content
@@ -39,7 +50,18 @@ func Deserialize(json []byte, resource *prop.Resource) error {
 //
 // The allowElementForArray option is provided to allow JSON array element values be provided for a multiValued property
 // so that it will be de-serialized as its element. The result will be a multiValued property containing a single element.
-func DeserializeProperty(json []byte, property prop.Property, allowElementForArray bool) error {
+//
+// Like Deserialize, values of the wrong type are collected and returned at once.
+func DeserializeProperty(json []byte, property prop.Property, allowElementForArray bool) (err error) {
+	if b := currentBackend(); !isStdBackend(b) {
+		value, err := decode(b, json)
+		if err != nil {
+			return err
+		}
+		a := &assignState{navigator: prop.Navigate(property)}
+		return a.done(a.assignProperty(value, allowElementForArray))
+	}
+
 	state := &deserializeState{
 		data:      json,
 		off:       0,
@@ -48,6 +70,9 @@ func DeserializeProperty(json []byte, property prop.Property, allowElementForArr
 		navigator: prop.Navigate(property),
 	}
 	state.scan.reset()
+	defer func() {
+		err = state.done(err)
+	}()
 
 	// Since this function is intended for bytes from json.RawMessage, it is not possible for it to precede with
 	// spaces. Hence, simply use scanNext to read in the first byte, then use stateBeginValue to forcibly set the
@@ -55,38 +80,49 @@ func DeserializeProperty(json []byte, property prop.Property, allowElementForArr
 	state.scanNext()
 	state.opCode = stateBeginValue(&state.scan, state.data[0])
 
-	if !property.Attribute().MultiValued() {
-		return state.parseSingleValuedProperty()
-	} else {
-		// Check the value is indeed a JSON array
-		if state.data[0] == '[' {
-			return state.parseMultiValuedProperty()
-		}
+	return state.parseProperty(allowElementForArray)
+}
 
-		// We may choose to allow callers to provide value that corresponds to multiValue element
-		// to be provided as a value for the multiValue property itself. If this feature is enabled,
-		// we will parse the value as the multiValued element and add it to the multiValued container.
-		if !allowElementForArray {
-			return state.errInvalidSyntax("expects JSON array")
-		}
+// DeserializeValue deserializes a raw JSON fragment, such as the value of a PATCH operation, against the given attribute
+// and returns a new property detached from any resource. Unlike DeserializeProperty, the fragment may be surrounded by
+// spaces, and is validated as a whole during deserialization, so that trailing data or an empty fragment is rejected.
+//
+// The fragment may be a scalar, an object or an array, so long as it is compatible with the attribute. When
+// allowElementForArray is true, a single element value is accepted for a multiValued attribute and results in a
+// multiValued property containing that single element.
+func DeserializeValue(json []byte, attribute *spec.Attribute, allowElementForArray bool) (prop.Property, error) {
+	json = bytes.TrimSpace(json)
+	if len(json) == 0 {
+		return nil, fmt.Errorf("%w: empty json value for '%s'", spec.ErrInvalidSyntax, attribute.Path())
+	}
 
-		if mv, ok := state.navigator.Current().(interface {
-			AppendElement() int
-		}); !ok {
-			return state.errInvalidSyntax("non-multiValued property at json array")
-		} else {
-			i := mv.AppendElement()
-			if i < 0 {
-				return fmt.Errorf("%w: failed to create property to host json array element", spec.ErrInternal)
-			}
-			state.navigator.At(i)
-			defer state.navigator.Retract()
-			if state.navigator.Error() != nil {
-				return state.navigator.Error()
-			}
-			return state.parseSingleValuedProperty()
+	property := prop.NewProperty(attribute)
+
+	if b := currentBackend(); !isStdBackend(b) {
+		value, err := decode(b, json)
+		if err != nil {
+			return nil, err
 		}
+		a := &assignState{navigator: prop.Navigate(property)}
+		if err := a.done(a.assignProperty(value, allowElementForArray)); err != nil {
+			return nil, err
+		}
+		return property, nil
 	}
+
+	state := &deserializeState{
+		data:      json,
+		off:       0,
+		opCode:    scanContinue,
+		scan:      scanner{},
+		navigator: prop.Navigate(property),
+	}
+	state.scan.reset()
+	state.scanWhile(scanSkipSpace)
+	if err := state.end(state.parseProperty(allowElementForArray)); err != nil {
+		return nil, err
+	}
+	return property, nil
 }
 
 // State of the deserialization process. In essence, a scanner is used to infer contextual information about what the
@@ -98,17 +134,87 @@ func DeserializeProperty(json []byte, property prop.Property, allowElementForArr
 // data of interest to the method, consume as much empty spaces or separators (i.e. scanObjectValue, scanArrayValue) as
 // possible so that the next parseXXX method invoked will not have to skip spaces as its first task.
 type deserializeState struct {
-	data      []byte
-	off       int // next read offset in data
-	opCode    int // last read result
-	scan      scanner
-	navigator prop.Navigator
+	data       []byte
+	off        int // next read offset in data
+	opCode     int // last read result
+	scan       scanner
+	navigator  prop.Navigator
+	violations spec.Errors // values of the wrong type, whose literal was skipped
 }
 
 func (d *deserializeState) errInvalidSyntax(msg string, args ...interface{}) error {
 	return fmt.Errorf("%w: %s (pos:%d)", spec.ErrInvalidSyntax, fmt.Sprintf(msg, args...), d.off)
 }
 
+// Records a value of the wrong type and carries on, leaving the current property as is. Only to be called after the
+// literal of the value was consumed, so that parsing may resume with the next value.
+func (d *deserializeState) violation(err error) error {
+	d.violations = append(d.violations, err)
+	return nil
+}
+
+// Returns the violations recorded, along with the error that stopped the deserialization, if any.
+func (d *deserializeState) done(err error) error {
+	if err != nil {
+		return append(d.violations, err).AsError()
+	}
+	return d.violations.AsError()
+}
+
+// Scans the rest of the input after a top level value was parsed, or the parsing stopped with err, and returns the
+// syntax error found by the scanner, if any, in favor of err and the violations. Since the parser expects valid JSON,
+// such an error explains whatever went wrong with the parsing, hence the input only needs to be scanned once.
+func (d *deserializeState) end(err error) error {
+	for d.opCode != scanError && d.off < len(d.data) {
+		d.scanNext()
+	}
+	if d.opCode != scanError {
+		d.opCode = d.scan.eof()
+	}
+	if d.scan.err != nil {
+		return d.scan.err
+	}
+	return d.done(err)
+}
+
+// Parses the value of the currently focused property, which is not necessarily a complex property. A single element
+// value is accepted for a multiValued property when allowElementForArray is true.
+func (d *deserializeState) parseProperty(allowElementForArray bool) error {
+	property := d.navigator.Current()
+	if !property.Attribute().MultiValued() {
+		return d.parseSingleValuedProperty()
+	}
+
+	// Check the value is indeed a JSON array
+	if d.opCode == scanBeginArray {
+		return d.parseMultiValuedProperty()
+	}
+
+	// We may choose to allow callers to provide value that corresponds to multiValue element
+	// to be provided as a value for the multiValue property itself. If this feature is enabled,
+	// we will parse the value as the multiValued element and add it to the multiValued container.
+	if !allowElementForArray {
+		return d.errInvalidSyntax("expects JSON array")
+	}
+
+	if mv, ok := property.(interface {
+		AppendElement() int
+	}); !ok {
+		return d.errInvalidSyntax("non-multiValued property at json array")
+	} else {
+		i := mv.AppendElement()
+		if i < 0 {
+			return fmt.Errorf("%w: failed to create property to host json array element", spec.ErrInternal)
+		}
+		d.navigator.At(i)
+		defer d.navigator.Retract()
+		if d.navigator.Error() != nil {
+			return d.navigator.Error()
+		}
+		return d.parseSingleValuedProperty()
+	}
+}
+
 // Parses the attribute/field name in a JSON object. This method expects a quoted string and skips through
 // as much empty spaces and colon (appears as scanObjectKey) after it as possible.
 func (d *deserializeState) parseFieldName() (string, error) {
@@ -119,6 +225,9 @@ func (d *deserializeState) parseFieldName() (string, error) {
 	start := d.off - 1 // position of the first double quote
 	d.scanWhile(scanContinue)
 	end := d.off - 1 // position of the character after the second double quote
+	if d.opCode == scanError {
+		return "", d.scan.err
+	}
 
 Skip:
 	for {
@@ -311,6 +420,10 @@ func (d *deserializeState) parseStringProperty() error {
 	d.scanWhile(scanContinue)
 	end := d.off - 1 // position of the character after the second double quote
 
+	if d.opCode == scanError {
+		return d.scan.err
+	}
+
 	if d.isNull(start, end) {
 		if _, err := d.navigator.Current().Delete(); err != nil {
 			return err
@@ -319,7 +432,7 @@ func (d *deserializeState) parseStringProperty() error {
 	}
 
 	if d.data[start] != '"' || d.data[end-1] != '"' {
-		return d.errInvalidSyntax("expects string literal value for '%s'", p.Attribute().Path())
+		return d.violation(d.errInvalidSyntax("expects string literal value for '%s'", p.Attribute().Path()))
 	}
 
 	v, ok := unquote(d.data[start:end])
@@ -352,6 +465,10 @@ func (d *deserializeState) parseIntegerProperty() error {
 	d.scanWhile(scanContinue)
 	end := d.off - 1 // position of the character after the end of the literal
 
+	if d.opCode == scanError {
+		return d.scan.err
+	}
+
 	if d.isNull(start, end) {
 		if _, err := d.navigator.Current().Delete(); err != nil {
 			return err
@@ -361,7 +478,7 @@ func (d *deserializeState) parseIntegerProperty() error {
 
 	val, err := strconv.ParseInt(string(d.data[start:end]), 10, 64)
 	if err != nil {
-		return d.errInvalidSyntax("expects integer value")
+		return d.violation(d.errInvalidSyntax("expects integer value for '%s'", p.Attribute().Path()))
 	}
 
 	if _, err := d.navigator.Current().Replace(val); err != nil {
@@ -389,6 +506,10 @@ func (d *deserializeState) parseBooleanProperty() error {
 	d.scanWhile(scanContinue)
 	end := d.off - 1 // position of the character after the end of the literal
 
+	if d.opCode == scanError {
+		return d.scan.err
+	}
+
 	if d.isNull(start, end) {
 		if _, err := d.navigator.Current().Delete(); err != nil {
 			return err
@@ -408,7 +529,7 @@ func (d *deserializeState) parseBooleanProperty() error {
 		if isHackingForMicrosoft, err := d.tryHackForMicrosoftADBooleanIssue(p, start, end); isHackingForMicrosoft {
 			return err
 		}
-		return d.errInvalidSyntax("expects boolean value")
+		return d.violation(d.errInvalidSyntax("expects boolean value for '%s'", p.Attribute().Path()))
 	}
 
 	return nil
@@ -432,6 +553,10 @@ func (d *deserializeState) parseDecimalProperty() error {
 	d.scanWhile(scanContinue)
 	end := d.off - 1 // position of the character after the end of the literal
 
+	if d.opCode == scanError {
+		return d.scan.err
+	}
+
 	if d.isNull(start, end) {
 		if _, err := d.navigator.Current().Delete(); err != nil {
 			return err
@@ -441,7 +566,7 @@ func (d *deserializeState) parseDecimalProperty() error {
 
 	val, err := strconv.ParseFloat(string(d.data[start:end]), 64)
 	if err != nil {
-		return d.errInvalidSyntax("expects decimal value")
+		return d.violation(d.errInvalidSyntax("expects decimal value for '%s'", p.Attribute().Path()))
 	}
 
 	if _, err := d.navigator.Current().Replace(val); err != nil {
@@ -462,6 +587,10 @@ func (d *deserializeState) parseNull() error {
 	d.scanWhile(scanContinue)
 	end := d.off - 1 // position of the character after the end of the literal
 
+	if d.opCode == scanError {
+		return d.scan.err
+	}
+
 	if !d.isNull(start, end) {
 		return d.errInvalidSyntax("expects null")
 	}
@@ -544,6 +673,7 @@ func (d *deserializeState) tryHackForMicrosoftADBooleanIssue(p prop.Property, st
 func (d *deserializeState) scanWhile(op int) {
 	s, data, i := &d.scan, d.data, d.off
 	for i < len(d.data) {
+		s.bytes = int64(i + 1)
 		newOp := s.step(s, data[i])
 		i++
 		if newOp != op {
@@ -561,6 +691,7 @@ func (d *deserializeState) scanWhile(op int) {
 func (d *deserializeState) scanNext() {
 	s, data, i := &d.scan, d.data, d.off
 	if i < len(data) {
+		s.bytes = int64(i + 1)
 		d.opCode = s.step(s, data[i])
 		d.off = i + 1
 	} else {
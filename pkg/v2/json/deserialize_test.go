@@ -2,6 +2,7 @@ package json
 
 import (
 	"encoding/json"
+	"errors"
 	"github.com/imulab/go-scim/pkg/v2/prop"
 	"github.com/imulab/go-scim/pkg/v2/spec"
 	"github.com/stretchr/testify/assert"
@@ -228,6 +229,30 @@ func (s *JsonDeserializeTestSuite) TestDeserializeResource() {
 				assert.Equal(t, true, resource.Navigator().Dot("active").Current().Raw())
 			},
 		},
+		{
+			name: "values of the wrong type are all reported",
+			json: `
+{
+  "schemas":[
+     "urn:ietf:params:scim:schemas:core:2.0:User"
+  ],
+  "id":"3cc032f5-2361-417f-9e2f-bc80adddf4a3",
+  "userName": 42,
+  "emails": [{"value": "imulab@foo.com", "primary": 1}],
+  "timezone":"Asia/Shanghai"
+}
+`,
+			expect: func(t *testing.T, resource *prop.Resource, err error) {
+				assert.True(t, errors.Is(err, spec.ErrInvalidSyntax))
+				errs, ok := err.(spec.Errors)
+				require.True(t, ok)
+				assert.Len(t, errs, 2)
+				assert.Contains(t, errs[0].Error(), "userName")
+				assert.Contains(t, errs[1].Error(), "emails.primary")
+				assert.True(t, resource.Navigator().Dot("userName").Current().IsUnassigned())
+				assert.Equal(t, "Asia/Shanghai", resource.Navigator().Dot("timezone").Current().Raw())
+			},
+		},
 	}
 
 	for _, test := range tests {
@@ -512,6 +537,135 @@ func (s *JsonDeserializeTestSuite) TestDeserializeProperty() {
 	}
 }
 
+func (s *JsonDeserializeTestSuite) TestDeserializeValue() {
+	tests := []struct {
+		name   string
+		attr   string
+		json   string
+		expect func(t *testing.T, property prop.Property, err error)
+	}{
+		{
+			name: "scalar surrounded by spaces",
+			attr: `
+{
+	"name": "userName",
+	"type": "string"
+}
+`,
+			json: `  "imulab" `,
+			expect: func(t *testing.T, property prop.Property, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, "imulab", property.Raw())
+			},
+		},
+		{
+			name: "object",
+			attr: `
+{
+	"name": "name",
+	"type": "complex",
+	"subAttributes": [
+		{
+			"name": "givenName",
+			"type": "string"
+		},
+		{
+			"name": "familyName",
+			"type": "string"
+		}
+	]
+}
+`,
+			json: `{"givenName": "Weinan", "familyName": "Qiu"}`,
+			expect: func(t *testing.T, property prop.Property, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, map[string]interface{}{
+					"givenName":  "Weinan",
+					"familyName": "Qiu",
+				}, property.Raw())
+			},
+		},
+		{
+			name: "array",
+			attr: `
+{
+	"name": "tags",
+	"type": "string",
+	"multiValued": true
+}
+`,
+			json: `["foo", "bar"]`,
+			expect: func(t *testing.T, property prop.Property, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, []interface{}{"foo", "bar"}, property.Raw())
+			},
+		},
+		{
+			name: "element for array",
+			attr: `
+{
+	"name": "tags",
+	"type": "string",
+	"multiValued": true
+}
+`,
+			json: `"foo"`,
+			expect: func(t *testing.T, property prop.Property, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, []interface{}{"foo"}, property.Raw())
+			},
+		},
+		{
+			name: "empty value",
+			attr: `
+{
+	"name": "userName",
+	"type": "string"
+}
+`,
+			json: ` `,
+			expect: func(t *testing.T, property prop.Property, err error) {
+				assert.Equal(t, spec.ErrInvalidSyntax, errors.Unwrap(err))
+			},
+		},
+		{
+			name: "trailing data",
+			attr: `
+{
+	"name": "userName",
+	"type": "string"
+}
+`,
+			json: `"foo" "bar"`,
+			expect: func(t *testing.T, property prop.Property, err error) {
+				assert.Equal(t, spec.ErrInvalidSyntax, errors.Unwrap(err))
+			},
+		},
+		{
+			name: "incompatible value",
+			attr: `
+{
+	"name": "active",
+	"type": "boolean"
+}
+`,
+			json: `"true"`,
+			expect: func(t *testing.T, property prop.Property, err error) {
+				assert.NotNil(t, err)
+			},
+		},
+	}
+
+	for _, test := range tests {
+		s.T().Run(test.name, func(t *testing.T) {
+			attr := new(spec.Attribute)
+			require.Nil(t, json.Unmarshal([]byte(test.attr), attr))
+			property, err := DeserializeValue([]byte(test.json), attr, true)
+			test.expect(t, property, err)
+		})
+	}
+}
+
 func (s *JsonDeserializeTestSuite) SetupSuite() {
 	for _, each := range []struct {
 		filepath  string
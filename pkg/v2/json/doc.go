@@ -1,2 +1,6 @@
 // This package implements direct JSON serializing and de-serializing for Property and Resource.
+//
+// Plain Go values used around resources, such as request payloads and error messages, are encoded and decoded through
+// a pluggable Backend, which defaults to the standard library. Resources go through a backend other than the default
+// one as well. See UseBackend.
 package json
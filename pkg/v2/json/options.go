@@ -1,6 +1,7 @@
 package json
 
 import (
+	"github.com/imulab/go-scim/pkg/v2/spec"
 	"strings"
 )
 
@@ -16,6 +17,28 @@ func Exclude(attributes ...string) Options {
 	return exclude{attributes: attributes}
 }
 
+// ContentVersion returns Options to render meta.version as the weak ETag computed from the content of the resource (see
+// prop.Resource.ContentVersion), regardless of the stored value, so that embedders do not have to maintain versions
+// manually. It has no effect on Serializable that does not provide a content version.
+func ContentVersion() Options {
+	return contentVersion{}
+}
+
+// Readable returns Options to only serialize the attributes for which readable returns true, i.e. those the caller
+// is authorized to read (see authz.Access). Properties of attributes that are not readable are left out along with their
+// sub properties, regardless of attributes and excludedAttributes, except for attributes of returned=always.
+func Readable(readable func(attr *spec.Attribute) bool) Options {
+	return readableOption{readable: readable}
+}
+
+// Payload returns Options to serialize the resource as the payload of a request to a service provider, i.e. by a
+// client, to which the return-ability rules do not apply: all assigned properties are serialized, including those of
+// write only attributes, such as password, while unassigned properties are left out, even those of attributes of
+// returned=always. Attributes and excludedAttributes still apply.
+func Payload() Options {
+	return payload{}
+}
+
 // JSON serialization options.
 type Options interface {
 	apply(s *serializer, serializable Serializable)
@@ -56,3 +79,27 @@ func (e exclude) apply(s *serializer, serializable Serializable) {
 		}
 	}
 }
+
+type contentVersion struct{}
+
+func (contentVersion) apply(s *serializer, serializable Serializable) {
+	if v, ok := serializable.(interface {
+		ContentVersion() string
+	}); ok {
+		s.version = v.ContentVersion()
+	}
+}
+
+type payload struct{}
+
+func (payload) apply(s *serializer, _ Serializable) {
+	s.payload = true
+}
+
+type readableOption struct {
+	readable func(attr *spec.Attribute) bool
+}
+
+func (r readableOption) apply(s *serializer, _ Serializable) {
+	s.readable = r.readable
+}
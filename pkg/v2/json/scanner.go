@@ -115,7 +115,7 @@ func (s *scanner) eof() int {
 		return scanEnd
 	}
 	if s.err == nil {
-		s.err = fmt.Errorf("%s: unexpected end of json at position %d", spec.ErrInvalidSyntax, s.bytes)
+		s.err = fmt.Errorf("%w: unexpected end of json at position %d", spec.ErrInvalidSyntax, s.bytes)
 	}
 	return scanError
 }
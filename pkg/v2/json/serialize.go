@@ -8,6 +8,8 @@ import (
 	"math"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"unicode/utf8"
 )
 
@@ -20,28 +22,77 @@ type Serializable interface {
 }
 
 // Serialize the given resource to JSON bytes. The serialization process subjects to the request attributes and
-// excludedAttributes from options, and the SCIM return-ability rules.
+// excludedAttributes from options, and the SCIM return-ability rules. The resource is encoded by the current Backend
+// when one other than the default is in use (see UseBackend), and written directly otherwise.
 func Serialize(serializable Serializable, options ...Options) ([]byte, error) {
-	s := serializer{
-		Buffer:   bytes.Buffer{},
-		includes: []string{},
-		excludes: []string{},
-		stack:    []*frame{},
-		scratch:  [64]byte{},
-	}
+	s := acquireSerializer()
+	defer releaseSerializer(s)
+
 	for _, opt := range options {
-		opt.apply(&s, serializable)
+		opt.apply(s, serializable)
 	}
 
 	if len(s.includes) > 0 && len(s.excludes) > 0 {
 		return nil, fmt.Errorf("%w: attributes and excludedAttributes are mutually exclusive", spec.ErrInvalidValue)
 	}
 
-	if err := serializable.Visit(&s); err != nil {
+	if b := currentBackend(); !isStdBackend(b) {
+		v := &valueSerializer{serializer: s}
+		if err := serializable.Visit(v); err != nil {
+			return nil, err
+		}
+		return b.Marshal(v.value)
+	}
+
+	if err := serializable.Visit(s); err != nil {
 		return nil, err
 	}
 
-	return s.Bytes(), nil
+	// The buffer goes back to the pool, hence the result must be copied out.
+	out := make([]byte, s.Len())
+	copy(out, s.Bytes())
+	return out, nil
+}
+
+// DefaultMaxPooledBufferSize is the default capacity limit, in bytes, of serializer buffers retained for reuse.
+const DefaultMaxPooledBufferSize = 64 * 1024
+
+// SetMaxPooledBufferSize caps the capacity of serializer buffers retained for reuse across Serialize calls. Buffers
+// grown beyond the cap while serializing an unusually large resource are discarded instead of being pooled, so that a
+// few large resources do not pin memory indefinitely. A non-positive size disables buffer pooling altogether.
+func SetMaxPooledBufferSize(size int) {
+	atomic.StoreInt64(&maxPooledBufferSize, int64(size))
+}
+
+var (
+	maxPooledBufferSize int64 = DefaultMaxPooledBufferSize
+	serializerPool            = sync.Pool{
+		New: func() interface{} {
+			return &serializer{
+				includes: []string{},
+				excludes: []string{},
+				stack:    make([]frame, 0, 8),
+			}
+		},
+	}
+)
+
+func acquireSerializer() *serializer {
+	return serializerPool.Get().(*serializer)
+}
+
+func releaseSerializer(s *serializer) {
+	if int64(s.Cap()) > atomic.LoadInt64(&maxPooledBufferSize) {
+		return
+	}
+	s.Reset()
+	s.includes = s.includes[:0]
+	s.excludes = s.excludes[:0]
+	s.stack = s.stack[:0]
+	s.version = ""
+	s.readable = nil
+	s.payload = false
+	serializerPool.Put(s)
 }
 
 const (
@@ -64,20 +115,41 @@ type (
 		bytes.Buffer
 		includes []string
 		excludes []string
-		stack    []*frame
+		stack    []frame
 		scratch  [64]byte
+		// computed meta.version to render in place of the stored value, if not empty
+		version string
+		// reports whether an attribute may be serialized, if not nil
+		readable func(attr *spec.Attribute) bool
+		// whether to serialize a request payload, regardless of return-ability
+		payload bool
 	}
 )
 
 func (s *serializer) ShouldVisit(property prop.Property) bool {
 	attr := property.Attribute()
 
+	// A computed meta.version is always available, and so is its container.
+	unassigned := property.IsUnassigned()
+	if len(s.version) > 0 && (attr.ID() == "meta" || attr.ID() == "meta.version") {
+		unassigned = false
+	}
+
+	// Payloads carry what is assigned, subject to attributes and excludedAttributes only.
+	if s.payload {
+		return !unassigned && s.selected(property)
+	}
+
 	// Write only properties are never returned. It is usually coupled
 	// with returned=never, but we will check it to make sure.
 	if attr.Mutability() == spec.MutabilityWriteOnly {
 		return false
 	}
 
+	if s.readable != nil && attr.Returned() != spec.ReturnedAlways && !s.readable(attr) {
+		return false
+	}
+
 	switch attr.Returned() {
 	case spec.ReturnedAlways:
 		return true
@@ -85,13 +157,13 @@ func (s *serializer) ShouldVisit(property prop.Property) bool {
 		return false
 	case spec.ReturnedDefault:
 		if len(s.includes) == 0 && len(s.excludes) == 0 {
-			return !property.IsUnassigned()
+			return !unassigned
 		} else {
 			test := strings.ToLower(property.Attribute().Path())
 			if len(s.includes) > 0 {
 				for _, include := range s.includes {
 					if include == test || strings.HasPrefix(include, test+".") || strings.HasPrefix(test, include+".") {
-						return !property.IsUnassigned()
+						return !unassigned
 					}
 				}
 				return false
@@ -101,7 +173,7 @@ func (s *serializer) ShouldVisit(property prop.Property) bool {
 						return false
 					}
 				}
-				return !property.IsUnassigned()
+				return !unassigned
 			} else {
 				panic("impossible: either includeFamily or excludeFamily")
 			}
@@ -122,6 +194,25 @@ func (s *serializer) ShouldVisit(property prop.Property) bool {
 	}
 }
 
+// Returns true if the property is selected by the attributes or excludedAttributes, if any.
+func (s *serializer) selected(property prop.Property) bool {
+	test := strings.ToLower(property.Attribute().Path())
+	if len(s.includes) > 0 {
+		for _, include := range s.includes {
+			if include == test || strings.HasPrefix(include, test+".") || strings.HasPrefix(test, include+".") {
+				return true
+			}
+		}
+		return false
+	}
+	for _, exclude := range s.excludes {
+		if exclude == test || strings.HasPrefix(test, exclude+".") {
+			return false
+		}
+	}
+	return true
+}
+
 func (s *serializer) Visit(property prop.Property) error {
 	if s.current().index > 0 {
 		_ = s.WriteByte(',')
@@ -135,6 +226,12 @@ func (s *serializer) Visit(property prop.Property) error {
 		return nil
 	}
 
+	if len(s.version) > 0 && property.Attribute().ID() == "meta.version" {
+		s.appendString(s.version)
+		s.current().index++
+		return nil
+	}
+
 	if property.IsUnassigned() {
 		s.appendNull()
 		return nil
@@ -311,7 +408,7 @@ func (s *serializer) appendBoolean(value bool) {
 }
 
 func (s *serializer) push(c container) {
-	s.stack = append(s.stack, &frame{
+	s.stack = append(s.stack, frame{
 		container: c,
 		index:     0,
 	})
@@ -328,5 +425,5 @@ func (s *serializer) current() *frame {
 	if len(s.stack) == 0 {
 		panic("stack is empty")
 	}
-	return s.stack[len(s.stack)-1]
+	return &s.stack[len(s.stack)-1]
 }
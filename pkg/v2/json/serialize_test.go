@@ -199,6 +199,149 @@ func (s *JsonSerializeTestSuite) TestSerialize() {
 	}
 }
 
+func (s *JsonSerializeTestSuite) TestSerializeWithContentVersion() {
+	tests := []struct {
+		name        string
+		getResource func(t *testing.T) *prop.Resource
+	}{
+		{
+			name: "stored version is overridden",
+			getResource: func(t *testing.T) *prop.Resource {
+				r := prop.NewResource(s.resourceType)
+				_, err := r.RootProperty().Replace(s.resourceData)
+				require.Nil(t, err)
+				return r
+			},
+		},
+		{
+			name: "version is rendered without meta",
+			getResource: func(t *testing.T) *prop.Resource {
+				r := prop.NewResource(s.resourceType)
+				require.False(t, r.Navigator().Replace(map[string]interface{}{
+					"id":       "3cc032f5-2361-417f-9e2f-bc80adddf4a3",
+					"userName": "imulab",
+				}).HasError())
+				return r
+			},
+		},
+	}
+
+	for _, test := range tests {
+		s.T().Run(test.name, func(t *testing.T) {
+			resource := test.getResource(t)
+
+			raw, err := Serialize(resource, ContentVersion())
+			require.Nil(t, err)
+
+			var rendered struct {
+				Meta struct {
+					Version string `json:"version"`
+				} `json:"meta"`
+			}
+			require.Nil(t, json.Unmarshal(raw, &rendered))
+			assert.Equal(t, resource.ContentVersion(), rendered.Meta.Version)
+		})
+	}
+}
+
+func (s *JsonSerializeTestSuite) TestSerializeAsPayload() {
+	tests := []struct {
+		name    string
+		options []Options
+		expect  func(t *testing.T, raw []byte, err error)
+	}{
+		{
+			name:    "write only and unassigned",
+			options: []Options{Payload()},
+			expect: func(t *testing.T, raw []byte, err error) {
+				assert.Nil(t, err)
+				expect := `
+{
+  "schemas": ["urn:ietf:params:scim:schemas:core:2.0:User"],
+  "userName": "imulab",
+  "password": "s3cret",
+  "emails": [{"value": "imulab@foo.com", "primary": true}]
+}
+`
+				assert.JSONEq(t, expect, string(raw))
+			},
+		},
+		{
+			name:    "excluded attributes",
+			options: []Options{Payload(), Exclude("emails.primary", "password")},
+			expect: func(t *testing.T, raw []byte, err error) {
+				assert.Nil(t, err)
+				expect := `
+{
+  "schemas": ["urn:ietf:params:scim:schemas:core:2.0:User"],
+  "userName": "imulab",
+  "emails": [{"value": "imulab@foo.com"}]
+}
+`
+				assert.JSONEq(t, expect, string(raw))
+			},
+		},
+	}
+
+	for _, test := range tests {
+		s.T().Run(test.name, func(t *testing.T) {
+			r := prop.NewResource(s.resourceType)
+			require.False(t, r.Navigator().Replace(map[string]interface{}{
+				"schemas":  []interface{}{"urn:ietf:params:scim:schemas:core:2.0:User"},
+				"userName": "imulab",
+				"password": "s3cret",
+				"emails": []interface{}{
+					map[string]interface{}{"value": "imulab@foo.com", "primary": true},
+				},
+			}).HasError())
+
+			raw, err := Serialize(r, test.options...)
+			test.expect(t, raw, err)
+		})
+	}
+}
+
+func (s *JsonSerializeTestSuite) TestSerializeWithPooledBuffers() {
+	tests := []struct {
+		name    string
+		maxSize int
+	}{
+		{
+			name:    "buffers retained",
+			maxSize: DefaultMaxPooledBufferSize,
+		},
+		{
+			name:    "buffers discarded",
+			maxSize: 0,
+		},
+	}
+
+	for _, test := range tests {
+		s.T().Run(test.name, func(t *testing.T) {
+			SetMaxPooledBufferSize(test.maxSize)
+			defer SetMaxPooledBufferSize(DefaultMaxPooledBufferSize)
+
+			r := prop.NewResource(s.resourceType)
+			_, err := r.RootProperty().Replace(s.resourceData)
+			require.Nil(t, err)
+
+			full, err := Serialize(r)
+			require.Nil(t, err)
+			expect := string(full)
+
+			// results handed out earlier must not be affected by later serializations reusing the buffer
+			partial, err := Serialize(r, Include("userName"))
+			require.Nil(t, err)
+			assert.Equal(t, expect, string(full))
+			assert.NotEqual(t, expect, string(partial))
+
+			again, err := Serialize(r)
+			require.Nil(t, err)
+			assert.Equal(t, expect, string(again))
+		})
+	}
+}
+
 func (s *JsonSerializeTestSuite) SetupSuite() {
 	for _, each := range []struct {
 		filepath  string
@@ -0,0 +1,294 @@
+package json
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/imulab/go-scim/pkg/v2/prop"
+	"github.com/imulab/go-scim/pkg/v2/spec"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Visitor to render the properties selected by the serializer as plain Go values, for a Backend other than the default
+// one to encode. Complex properties become map[string]interface{} and multiValued properties []interface{}, like the
+// values decoded by the backend.
+type valueSerializer struct {
+	*serializer
+	// the containers being rendered
+	stack []valueFrame
+	// name of the container property last visited, to be used once its children are done
+	name string
+	// the rendered value of the top level container
+	value interface{}
+}
+
+type valueFrame struct {
+	name   string
+	object map[string]interface{}
+	array  []interface{}
+}
+
+func (s *valueSerializer) Visit(property prop.Property) error {
+	attr := property.Attribute()
+	if attr.MultiValued() || attr.Type() == spec.TypeComplex {
+		s.name = attr.Name()
+		return nil
+	}
+
+	switch {
+	case len(s.version) > 0 && attr.ID() == "meta.version":
+		s.add(attr.Name(), s.version)
+	case property.IsUnassigned():
+		s.add(attr.Name(), nil)
+	default:
+		s.add(attr.Name(), property.Raw())
+	}
+	return nil
+}
+
+func (s *valueSerializer) BeginChildren(container prop.Property) {
+	switch {
+	case container.Attribute().MultiValued():
+		s.stack = append(s.stack, valueFrame{name: s.name, array: []interface{}{}})
+	case container.Attribute().Type() == spec.TypeComplex:
+		s.stack = append(s.stack, valueFrame{name: s.name, object: map[string]interface{}{}})
+	default:
+		panic("unknown container")
+	}
+}
+
+func (s *valueSerializer) EndChildren(container prop.Property) {
+	if len(s.stack) == 0 {
+		panic("cannot pop on empty stack")
+	}
+	f := s.stack[len(s.stack)-1]
+	s.stack = s.stack[:len(s.stack)-1]
+
+	var value interface{}
+	if container.Attribute().MultiValued() {
+		value = f.array
+	} else {
+		value = f.object
+	}
+
+	if len(s.stack) == 0 {
+		s.value = value
+	} else {
+		s.add(f.name, value)
+	}
+}
+
+// Adds the value to the current container: under name for an object, as the next element for an array.
+func (s *valueSerializer) add(name string, value interface{}) {
+	if len(s.stack) == 0 {
+		panic("stack is empty")
+	}
+	f := &s.stack[len(s.stack)-1]
+	if f.object != nil {
+		f.object[name] = value
+	} else {
+		f.array = append(f.array, value)
+	}
+}
+
+// State of assigning the plain Go values decoded by a Backend other than the default one to the properties. It follows
+// the rules of deserializeState: values of the wrong type are collected as violations, while values of the wrong
+// structure, such as an object for a string attribute, stop the assignment right away. The names of an object are
+// assigned in sorted order, so that the first error reported does not depend on the order of the map.
+type assignState struct {
+	navigator  prop.Navigator
+	violations spec.Errors
+}
+
+// Records a value of the wrong type and carries on, leaving the current property as is.
+func (a *assignState) violation(err error) error {
+	a.violations = append(a.violations, err)
+	return nil
+}
+
+// Returns the violations recorded, along with the error that stopped the assignment, if any.
+func (a *assignState) done(err error) error {
+	if err != nil {
+		return append(a.violations, err).AsError()
+	}
+	return a.violations.AsError()
+}
+
+// Assigns the value to the currently focused property, which is not necessarily a complex property. A single element
+// value is accepted for a multiValued property when allowElementForArray is true.
+func (a *assignState) assignProperty(value interface{}, allowElementForArray bool) error {
+	property := a.navigator.Current()
+	if !property.Attribute().MultiValued() {
+		return a.assignSingleValuedProperty(value)
+	}
+
+	if _, ok := value.([]interface{}); ok || !allowElementForArray {
+		return a.assignMultiValuedProperty(value)
+	}
+
+	return a.assignElement(value)
+}
+
+// Assigns the value to a complex property. The top level property does not correspond to any field name and hence
+// cannot be null, which is to be indicated by allowNull being false.
+func (a *assignState) assignComplexProperty(value interface{}, allowNull bool) error {
+	if value == nil && allowNull {
+		_, err := a.navigator.Current().Delete()
+		return err
+	}
+
+	object, ok := value.(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("%w: expects a json object", spec.ErrInvalidSyntax)
+	}
+
+	names := make([]string, 0, len(object))
+	for name := range object {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		p := a.navigator.Dot(name).Current()
+		if a.navigator.Error() != nil {
+			return a.navigator.Error()
+		}
+
+		var err error
+		if p.Attribute().MultiValued() {
+			err = a.assignMultiValuedProperty(object[name])
+		} else {
+			err = a.assignSingleValuedProperty(object[name])
+		}
+		if err != nil {
+			return err
+		}
+
+		a.navigator.Retract()
+	}
+
+	return nil
+}
+
+// Assigns the elements of a JSON array, or null, to a multiValued property.
+func (a *assignState) assignMultiValuedProperty(value interface{}) error {
+	if value == nil {
+		_, err := a.navigator.Current().Delete()
+		return err
+	}
+
+	elements, ok := value.([]interface{})
+	if !ok {
+		return fmt.Errorf("%w: expects JSON array for '%s'", spec.ErrInvalidSyntax, a.navigator.Current().Attribute().Path())
+	}
+
+	for _, element := range elements {
+		if err := a.assignElement(element); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Appends an element to the currently focused multiValued property and assigns the value to it.
+func (a *assignState) assignElement(value interface{}) error {
+	mv, ok := a.navigator.Current().(interface {
+		AppendElement() int
+	})
+	if !ok {
+		return fmt.Errorf("%w: non-multiValued property at json array", spec.ErrInvalidSyntax)
+	}
+
+	i := mv.AppendElement()
+	if i < 0 {
+		return fmt.Errorf("%w: failed to create property to host json array element", spec.ErrInternal)
+	}
+	a.navigator.At(i)
+	defer a.navigator.Retract()
+	if a.navigator.Error() != nil {
+		return a.navigator.Error()
+	}
+	return a.assignSingleValuedProperty(value)
+}
+
+// Assigns the value to a single valued property, or to an element of a multiValued property.
+func (a *assignState) assignSingleValuedProperty(value interface{}) error {
+	p := a.navigator.Current()
+	attr := p.Attribute()
+
+	if attr.Type() == spec.TypeComplex {
+		return a.assignComplexProperty(value, true)
+	}
+
+	switch value.(type) {
+	case nil:
+		_, err := p.Delete()
+		return err
+	case map[string]interface{}, []interface{}:
+		return fmt.Errorf("%w: expects json literal for '%s'", spec.ErrInvalidSyntax, attr.Path())
+	}
+
+	var (
+		v  interface{}
+		ok bool
+	)
+	switch attr.Type() {
+	case spec.TypeString, spec.TypeDateTime, spec.TypeBinary, spec.TypeReference:
+		v, ok = value.(string)
+	case spec.TypeInteger:
+		v, ok = integerValue(value)
+	case spec.TypeDecimal:
+		v, ok = decimalValue(value)
+	case spec.TypeBoolean:
+		v, ok = value.(bool)
+		// See tryHackForMicrosoftADBooleanIssue
+		if s, isString := value.(string); isString && strings.ToLower(attr.Path()) == "active" {
+			switch s {
+			case "True", "true":
+				v, ok = true, true
+			case "False", "false":
+				v, ok = false, true
+			}
+		}
+	default:
+		panic("invalid attribute type")
+	}
+	if !ok {
+		return a.violation(fmt.Errorf("%w: expects %s value for '%s'", spec.ErrInvalidSyntax, attr.Type().String(), attr.Path()))
+	}
+
+	_, err := p.Replace(v)
+	return err
+}
+
+// Returns the value as an int64, if it is a JSON number without fraction. Backends decode numbers as float64, or as
+// json.Number when configured to.
+func integerValue(value interface{}) (int64, bool) {
+	switch n := value.(type) {
+	case json.Number:
+		i, err := strconv.ParseInt(n.String(), 10, 64)
+		return i, err == nil
+	case float64:
+		if n != math.Trunc(n) || n < math.MinInt64 || n >= math.MaxInt64 {
+			return 0, false
+		}
+		return int64(n), true
+	default:
+		return 0, false
+	}
+}
+
+// Returns the value as a float64, if it is a JSON number.
+func decimalValue(value interface{}) (float64, bool) {
+	switch n := value.(type) {
+	case json.Number:
+		f, err := n.Float64()
+		return f, err == nil
+	case float64:
+		return n, true
+	default:
+		return 0, false
+	}
+}
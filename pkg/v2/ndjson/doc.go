@@ -0,0 +1,14 @@
+// This package exports resources of a resource type to newline delimited JSON (NDJSON), and imports them back, i.e. to
+// back up a database, or to migrate resources from one database implementation to another.
+//
+// An export starts with a header line, which names the resource type and the schemas of its resources, followed by one
+// line for every resource:
+//
+//	{"resourceType":"User","schema":"urn:ietf:params:scim:schemas:core:2.0:User","schemaExtensions":["..."]}
+//	{"schemas":["urn:ietf:params:scim:schemas:core:2.0:User"],"id":"...","userName":"...","meta":{...}}
+//
+// Unlike the JSON responses to clients, every resource line contains all assigned attributes, including those never
+// returned, like password, so that resources are restored as they were. Import checks the header against the resource
+// type, and either creates every resource through a create service, or inserts it into a database as it is. Resources
+// failing to import do not stop the import; they are counted and recorded in an error file instead.
+package ndjson
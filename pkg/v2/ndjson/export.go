@@ -0,0 +1,140 @@
+package ndjson
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/imulab/go-scim/pkg/v2/db"
+	"github.com/imulab/go-scim/pkg/v2/prop"
+	"github.com/imulab/go-scim/pkg/v2/spec"
+	"io"
+)
+
+const (
+	// DefaultPageSize is the number of resources queried at once by Export, unless set by ExportOptions.
+	DefaultPageSize = 100
+	// DefaultProgressInterval is the number of resources between reports of progress, unless set by the options.
+	DefaultProgressInterval = 1000
+)
+
+// Header is the first line of an export, which describes the resources of the following lines.
+type Header struct {
+	ResourceType     string   `json:"resourceType"`               // name of the resource type
+	Schema           string   `json:"schema"`                     // id of the main schema of the resource type
+	SchemaExtensions []string `json:"schemaExtensions,omitempty"` // ids of the schema extensions of the resource type
+}
+
+// HeaderOf returns the Header of the exports of resources of the resource type.
+func HeaderOf(resourceType *spec.ResourceType) Header {
+	h := Header{
+		ResourceType: resourceType.Name(),
+		Schema:       resourceType.Schema().ID(),
+	}
+	_ = resourceType.ForEachExtension(func(extension *spec.Schema, _ bool) error {
+		h.SchemaExtensions = append(h.SchemaExtensions, extension.ID())
+		return nil
+	})
+	return h
+}
+
+// Progress of an export or import, as reported to the Progress function of the options.
+type Progress struct {
+	Processed int // number of resources exported, or read from the import
+	Failed    int // number of resources that failed to import (see ImportOptions.Errors); always zero for exports
+}
+
+// ExportOptions are the options of Export.
+type ExportOptions struct {
+	// Filter of the resources to export, or empty to export all resources.
+	Filter string
+	// PageSize is the number of resources queried from the database at once, or DefaultPageSize when not positive.
+	PageSize int
+	// Progress, if not nil, is called every ProgressInterval resources exported, and once when the export is done.
+	Progress func(p Progress)
+	// ProgressInterval is the number of resources between calls of Progress, or DefaultProgressInterval when not
+	// positive.
+	ProgressInterval int
+}
+
+// Export writes the header of the resource type, and all resources of the database matching the filter of the
+// options, to the writer, and returns the progress of the export, which is complete unless there is an error. The
+// resources are streamed page by page (see db.Walk): with the cursors of QueryCursor if the database is a db.CursorDB,
+// so that writes in the meantime do not cause resources to be skipped or written twice, or ordered by id with Query
+// otherwise.
+func Export(ctx context.Context, w io.Writer, resourceType *spec.ResourceType, database db.DB, options ExportOptions) (Progress, error) {
+	var (
+		out      = bufio.NewWriter(w)
+		progress = newTracker(options.Progress, options.ProgressInterval)
+	)
+
+	if err := writeLine(out, HeaderOf(resourceType)); err != nil {
+		return progress.Progress, err
+	}
+
+	size := options.PageSize
+	if size <= 0 {
+		size = DefaultPageSize
+	}
+	if err := db.Walk(ctx, database, options.Filter, size, func(ctx context.Context, page []*prop.Resource) error {
+		for _, resource := range page {
+			if err := writeLine(out, prop.Document(resource.RootProperty())); err != nil {
+				return err
+			}
+			progress.processed(1)
+		}
+		return nil
+	}); err != nil {
+		return progress.Progress, err
+	}
+
+	if err := out.Flush(); err != nil {
+		return progress.Progress, fmt.Errorf("%w: %v", spec.ErrInternal, err)
+	}
+	progress.done()
+	return progress.Progress, nil
+}
+
+// Writes the JSON value and a newline.
+func writeLine(out *bufio.Writer, v interface{}) error {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("%w: %v", spec.ErrInternal, err)
+	}
+	if _, err := out.Write(raw); err != nil {
+		return fmt.Errorf("%w: %v", spec.ErrInternal, err)
+	}
+	if err := out.WriteByte('\n'); err != nil {
+		return fmt.Errorf("%w: %v", spec.ErrInternal, err)
+	}
+	return nil
+}
+
+// Tracks the progress, and reports it at the interval.
+type tracker struct {
+	Progress
+	report   func(p Progress)
+	interval int
+	last     int // processed when last reported
+}
+
+func newTracker(report func(p Progress), interval int) *tracker {
+	if interval <= 0 {
+		interval = DefaultProgressInterval
+	}
+	return &tracker{report: report, interval: interval}
+}
+
+func (t *tracker) processed(n int) {
+	t.Processed += n
+	if t.report != nil && t.Processed-t.last >= t.interval {
+		t.last = t.Processed
+		t.report(t.Progress)
+	}
+}
+
+func (t *tracker) done() {
+	if t.report != nil {
+		t.report(t.Progress)
+	}
+}
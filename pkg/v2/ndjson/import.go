@@ -0,0 +1,237 @@
+package ndjson
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/imulab/go-scim/pkg/v2/db"
+	scimjson "github.com/imulab/go-scim/pkg/v2/json"
+	"github.com/imulab/go-scim/pkg/v2/prop"
+	"github.com/imulab/go-scim/pkg/v2/service"
+	"github.com/imulab/go-scim/pkg/v2/service/filter"
+	"github.com/imulab/go-scim/pkg/v2/spec"
+	"io"
+)
+
+// DefaultBatchSize is the number of resources inserted into the database at once by Import, unless set by
+// ImportOptions.
+const DefaultBatchSize = 100
+
+// ImportOptions are the options of Import. Either Create or Database must be set.
+type ImportOptions struct {
+	// Create, if not nil, creates every resource through the create service, like the resources of create requests,
+	// subject to its filters and hooks, which usually assign new ids and meta, and hash passwords again. It suits
+	// imports from other systems rather than restores of exports.
+	Create service.Create
+	// Database, if Create is nil, is the database every resource is inserted into as it is, keeping its id and meta,
+	// after it passed the filters. Resources are inserted in batches (see db.InsertMany).
+	Database db.DB
+	// Filters are the filters every resource has to pass before it is inserted into the Database, i.e. the
+	// filter.ValidationFilter, or none to insert the resources as they are.
+	Filters []filter.ByResource
+	// BatchSize is the number of resources inserted into the Database at once, or DefaultBatchSize when not positive.
+	BatchSize int
+	// Errors, if not nil, is where the resources that failed to import are recorded, as NDJSON of the line number in
+	// the import, the error, and the resource as it was read:
+	//
+	//	{"line":3,"error":"invalidValue: ...","resource":{"schemas":["..."],"id":"..."}}
+	//
+	// Resources that fail to be inserted are recorded once their batch is inserted, hence the records are not
+	// necessarily in the order of the lines.
+	Errors io.Writer
+	// Progress, if not nil, is called every ProgressInterval resources read, and once when the import is done.
+	Progress func(p Progress)
+	// ProgressInterval is the number of resources between calls of Progress, or DefaultProgressInterval when not
+	// positive.
+	ProgressInterval int
+}
+
+// Import reads an export from the reader, and creates or inserts its resources of the resource type (see
+// ImportOptions), and returns the progress of the import. Resources that fail to be parsed, validated, or written do
+// not stop the import, but are counted as failed in the progress and recorded to the Errors of the options. An error
+// is only returned if the import cannot go on, i.e. when the header does not describe the resource type, when the
+// reader or the error file fails, or when the context is done.
+func Import(ctx context.Context, r io.Reader, resourceType *spec.ResourceType, options ImportOptions) (Progress, error) {
+	im := &importer{
+		ImportOptions: options,
+		resourceType:  resourceType,
+		progress:      newTracker(options.Progress, options.ProgressInterval),
+	}
+	if im.Create == nil && im.Database == nil {
+		return im.progress.Progress, fmt.Errorf("%w: import requires a create service or a database", spec.ErrInternal)
+	}
+	if im.BatchSize <= 0 {
+		im.BatchSize = DefaultBatchSize
+	}
+	if im.Errors != nil {
+		im.errors = bufio.NewWriter(im.Errors)
+	}
+
+	if err := im.run(ctx, bufio.NewReader(r)); err != nil {
+		return im.progress.Progress, err
+	}
+	im.progress.done()
+	return im.progress.Progress, nil
+}
+
+type importer struct {
+	ImportOptions
+	resourceType *spec.ResourceType
+	progress     *tracker
+	errors       *bufio.Writer
+	batch        []line
+}
+
+// Line of a resource in the import.
+type line struct {
+	number   int
+	raw      []byte
+	resource *prop.Resource
+}
+
+func (im *importer) run(ctx context.Context, in *bufio.Reader) error {
+	number, header := 0, false
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		raw, readErr := in.ReadBytes('\n')
+		if readErr != nil && readErr != io.EOF {
+			return fmt.Errorf("%w: failed to read import: %v", spec.ErrInternal, readErr)
+		}
+
+		number++
+		if raw = bytes.TrimSpace(raw); len(raw) > 0 {
+			var err error
+			if !header {
+				err, header = im.header(raw), true
+			} else {
+				err = im.importLine(ctx, line{number: number, raw: raw})
+			}
+			if err != nil {
+				return err
+			}
+		}
+
+		if readErr == io.EOF {
+			break
+		}
+	}
+
+	if !header {
+		return fmt.Errorf("%w: import has no header", spec.ErrInvalidSyntax)
+	}
+	if err := im.flush(ctx); err != nil {
+		return err
+	}
+	if im.errors != nil {
+		if err := im.errors.Flush(); err != nil {
+			return fmt.Errorf("%w: failed to write errors: %v", spec.ErrInternal, err)
+		}
+	}
+	return nil
+}
+
+// Checks that the header describes the resource type of the import.
+func (im *importer) header(raw []byte) error {
+	var h Header
+	if err := json.Unmarshal(raw, &h); err != nil || len(h.ResourceType) == 0 {
+		return fmt.Errorf("%w: invalid header of import", spec.ErrInvalidSyntax)
+	}
+
+	expect := HeaderOf(im.resourceType)
+	if h.ResourceType != expect.ResourceType || h.Schema != expect.Schema {
+		return fmt.Errorf("%w: import of resource type '%s' with schema '%s' is not of resource type '%s'",
+			spec.ErrInvalidValue, h.ResourceType, h.Schema, expect.ResourceType)
+	}
+	for _, extension := range h.SchemaExtensions {
+		known := false
+		for _, each := range expect.SchemaExtensions {
+			known = known || each == extension
+		}
+		if !known {
+			return fmt.Errorf("%w: schema extension '%s' of import is not an extension of resource type '%s'",
+				spec.ErrInvalidValue, extension, expect.ResourceType)
+		}
+	}
+	return nil
+}
+
+// Creates the resource of the line, or adds it to the batch to insert.
+func (im *importer) importLine(ctx context.Context, l line) error {
+	im.progress.processed(1)
+
+	if im.Create != nil {
+		_, err := im.Create.Do(ctx, &service.CreateRequest{PayloadSource: bytes.NewReader(l.raw)})
+		return im.failed(l, err)
+	}
+
+	l.resource = prop.NewResource(im.resourceType)
+	if err := scimjson.Deserialize(l.raw, l.resource); err != nil {
+		return im.failed(l, err)
+	}
+	for _, f := range im.Filters {
+		if err := f.Filter(ctx, l.resource); err != nil {
+			return im.failed(l, err)
+		}
+	}
+
+	im.batch = append(im.batch, l)
+	if len(im.batch) < im.BatchSize {
+		return nil
+	}
+	return im.flush(ctx)
+}
+
+// Inserts the resources of the batch into the database.
+func (im *importer) flush(ctx context.Context) error {
+	if len(im.batch) == 0 {
+		return nil
+	}
+
+	resources := make([]*prop.Resource, len(im.batch))
+	for i, l := range im.batch {
+		resources[i] = l.resource
+	}
+	for i, err := range db.InsertMany(ctx, im.Database, resources) {
+		if err := im.failed(im.batch[i], err); err != nil {
+			return err
+		}
+	}
+
+	im.batch = im.batch[:0]
+	return nil
+}
+
+// Counts and records the line as failed with the error, unless it is nil. Returns an error only if the error file
+// fails.
+func (im *importer) failed(l line, err error) error {
+	if err == nil {
+		return nil
+	}
+
+	im.progress.Failed++
+	if im.errors == nil {
+		return nil
+	}
+
+	resource := json.RawMessage(l.raw)
+	if !json.Valid(l.raw) {
+		resource, _ = json.Marshal(string(l.raw))
+	}
+	if err := writeLine(im.errors, struct {
+		Line     int             `json:"line"`
+		Error    string          `json:"error"`
+		Resource json.RawMessage `json:"resource"`
+	}{
+		Line:     l.number,
+		Error:    err.Error(),
+		Resource: resource,
+	}); err != nil {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,269 @@
+package ndjson
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/imulab/go-scim/pkg/v2/crud"
+	"github.com/imulab/go-scim/pkg/v2/db"
+	"github.com/imulab/go-scim/pkg/v2/prop"
+	"github.com/imulab/go-scim/pkg/v2/service"
+	"github.com/imulab/go-scim/pkg/v2/service/filter"
+	"github.com/imulab/go-scim/pkg/v2/spec"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestNDJSON(t *testing.T) {
+	s := new(NDJSONTestSuite)
+	suite.Run(t, s)
+}
+
+type NDJSONTestSuite struct {
+	suite.Suite
+	resourceType *spec.ResourceType
+}
+
+func (s *NDJSONTestSuite) TestExport() {
+	tests := []struct {
+		name     string
+		database func(database db.DB) db.DB
+	}{
+		{
+			name:     "with cursors",
+			database: func(database db.DB) db.DB { return database },
+		},
+		{
+			name:     "with pages",
+			database: func(database db.DB) db.DB { return pagedDB{DB: database} },
+		},
+	}
+
+	for _, test := range tests {
+		s.T().Run(test.name, func(t *testing.T) {
+			database := s.databaseOf(t, "user001", "user002", "user003", "user004", "user005")
+
+			var (
+				out     bytes.Buffer
+				reports []Progress
+			)
+			progress, err := Export(context.TODO(), &out, s.resourceType, test.database(database), ExportOptions{
+				PageSize:         2,
+				Progress:         func(p Progress) { reports = append(reports, p) },
+				ProgressInterval: 2,
+			})
+			require.Nil(t, err)
+			assert.Equal(t, Progress{Processed: 5}, progress)
+			assert.Equal(t, []Progress{{Processed: 2}, {Processed: 4}, {Processed: 5}}, reports)
+
+			lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+			require.Len(t, lines, 6)
+			assert.JSONEq(t, `{
+				"resourceType": "User",
+				"schema": "urn:ietf:params:scim:schemas:core:2.0:User",
+				"schemaExtensions": ["urn:ietf:params:scim:schemas:extension:enterprise:2.0:User"]
+			}`, lines[0])
+
+			var ids []string
+			for _, l := range lines[1:] {
+				var document map[string]interface{}
+				require.Nil(t, json.Unmarshal([]byte(l), &document))
+				ids = append(ids, document["id"].(string))
+				// attributes never returned to clients are exported too
+				assert.Equal(t, "s3cret", document["password"])
+			}
+			assert.ElementsMatch(t, []string{"user001", "user002", "user003", "user004", "user005"}, ids)
+		})
+	}
+}
+
+func (s *NDJSONTestSuite) TestExportWithFilter() {
+	var out bytes.Buffer
+	progress, err := Export(context.TODO(), &out, s.resourceType, s.databaseOf(s.T(), "user001", "user002"), ExportOptions{
+		Filter: `userName eq "user002"`,
+	})
+	require.Nil(s.T(), err)
+	assert.Equal(s.T(), 1, progress.Processed)
+	assert.Equal(s.T(), 2, strings.Count(out.String(), "\n"))
+	assert.Contains(s.T(), out.String(), `"id":"user002"`)
+}
+
+func (s *NDJSONTestSuite) TestImport() {
+	var export bytes.Buffer
+	_, err := Export(context.TODO(), &export, s.resourceType, s.databaseOf(s.T(), "user001", "user002", "user003"), ExportOptions{})
+	require.Nil(s.T(), err)
+
+	s.T().Run("into database", func(t *testing.T) {
+		database := db.Memory()
+		progress, err := Import(context.TODO(), bytes.NewReader(export.Bytes()), s.resourceType, ImportOptions{
+			Database:  database,
+			BatchSize: 2,
+		})
+		require.Nil(t, err)
+		assert.Equal(t, Progress{Processed: 3}, progress)
+
+		for _, id := range []string{"user001", "user002", "user003"} {
+			r, err := database.Get(context.TODO(), id, nil)
+			require.Nil(t, err)
+			assert.Equal(t, id, r.Navigator().Dot("userName").Current().Raw())
+			assert.Equal(t, "s3cret", r.Navigator().Dot("password").Current().Raw())
+			assert.Equal(t, "v1", r.MetaVersionOrEmpty())
+		}
+	})
+
+	s.T().Run("through create service", func(t *testing.T) {
+		database := db.Memory()
+		create := service.CreateService(s.resourceType, database, []filter.ByResource{
+			filter.ByPropertyToByResource(filter.ReadOnlyFilter(), filter.UUIDFilter()),
+			filter.MetaFilter(),
+		})
+		progress, err := Import(context.TODO(), bytes.NewReader(export.Bytes()), s.resourceType, ImportOptions{
+			Create: create,
+		})
+		require.Nil(t, err)
+		assert.Equal(t, Progress{Processed: 3}, progress)
+
+		n, err := database.Count(context.TODO(), "")
+		require.Nil(t, err)
+		assert.Equal(t, 3, n)
+		_, err = database.Get(context.TODO(), "user001", nil)
+		assert.True(t, errors.Is(err, spec.ErrNotFound))
+	})
+}
+
+func (s *NDJSONTestSuite) TestImportWithFailures() {
+	database := s.databaseOf(s.T(), "user001")
+	in := strings.Join([]string{
+		`{"resourceType":"User","schema":"urn:ietf:params:scim:schemas:core:2.0:User"}`,
+		`{"schemas":["urn:ietf:params:scim:schemas:core:2.0:User"],"id":"user001","userName":"user001","emails":[{"value":"user001@foo.com"}]}`,
+		``,
+		`{"schemas":["urn:ietf:params:scim:schemas:core:2.0:User"],"id":"user002","userName":"user002","emails":[{"value":"user002@foo.com"}]}`,
+		`not json`,
+		`{"schemas":["urn:ietf:params:scim:schemas:core:2.0:User"],"id":"user003","emails":[{"value":"user003@foo.com"}]}`,
+		`{"schemas":["urn:ietf:params:scim:schemas:core:2.0:User"],"id":"user004","userName":"user004","emails":[{"value":"user004@foo.com"}]}`,
+	}, "\n")
+
+	var errs bytes.Buffer
+	progress, err := Import(context.TODO(), strings.NewReader(in), s.resourceType, ImportOptions{
+		Database: database,
+		Filters: []filter.ByResource{
+			filter.ByPropertyToByResource(filter.ValidationFilter(database)),
+		},
+		Errors: &errs,
+	})
+	require.Nil(s.T(), err)
+	assert.Equal(s.T(), Progress{Processed: 5, Failed: 3}, progress)
+
+	n, err := database.Count(context.TODO(), "")
+	require.Nil(s.T(), err)
+	assert.Equal(s.T(), 3, n)
+
+	var lines []int
+	for _, l := range strings.Split(strings.TrimSpace(errs.String()), "\n") {
+		var record struct {
+			Line     int             `json:"line"`
+			Error    string          `json:"error"`
+			Resource json.RawMessage `json:"resource"`
+		}
+		require.Nil(s.T(), json.Unmarshal([]byte(l), &record))
+		assert.NotEmpty(s.T(), record.Error)
+		assert.NotEmpty(s.T(), record.Resource)
+		lines = append(lines, record.Line)
+	}
+	// user001 exists, line 5 is not a resource, and user003 has no userName
+	assert.ElementsMatch(s.T(), []int{2, 5, 6}, lines)
+}
+
+func (s *NDJSONTestSuite) TestImportWithInvalidHeader() {
+	for _, header := range []string{
+		``,
+		`not json`,
+		`{"resourceType":"Group","schema":"urn:ietf:params:scim:schemas:core:2.0:Group"}`,
+		`{"resourceType":"User","schema":"urn:ietf:params:scim:schemas:core:2.0:User","schemaExtensions":["urn:foo"]}`,
+	} {
+		_, err := Import(context.TODO(), strings.NewReader(header), s.resourceType, ImportOptions{Database: db.Memory()})
+		assert.NotNil(s.T(), err, header)
+	}
+}
+
+// Returns a memory database of users by the ids, which are also their userName.
+func (s *NDJSONTestSuite) databaseOf(t *testing.T, ids ...string) db.DB {
+	database := db.Memory()
+	for _, id := range ids {
+		r := prop.NewResource(s.resourceType)
+		require.Nil(t, r.Navigator().Replace(map[string]interface{}{
+			"schemas":  []interface{}{"urn:ietf:params:scim:schemas:core:2.0:User"},
+			"id":       id,
+			"userName": id,
+			"password": "s3cret",
+			"meta": map[string]interface{}{
+				"resourceType": "User",
+				"version":      "v1",
+			},
+		}).Error())
+		require.Nil(t, database.Insert(context.TODO(), r))
+	}
+	return database
+}
+
+func (s *NDJSONTestSuite) SetupSuite() {
+	for _, each := range []struct {
+		filepath  string
+		structure interface{}
+		post      func(parsed interface{})
+	}{
+		{
+			filepath:  "../../../public/schemas/core_schema.json",
+			structure: new(spec.Schema),
+			post: func(parsed interface{}) {
+				spec.Schemas().Register(parsed.(*spec.Schema))
+			},
+		},
+		{
+			filepath:  "../../../public/schemas/user_schema.json",
+			structure: new(spec.Schema),
+			post: func(parsed interface{}) {
+				spec.Schemas().Register(parsed.(*spec.Schema))
+			},
+		},
+		{
+			filepath:  "../../../public/schemas/user_enterprise_extension_schema.json",
+			structure: new(spec.Schema),
+			post: func(parsed interface{}) {
+				spec.Schemas().Register(parsed.(*spec.Schema))
+			},
+		},
+		{
+			filepath:  "../../../public/resource_types/user_resource_type.json",
+			structure: new(spec.ResourceType),
+			post: func(parsed interface{}) {
+				s.resourceType = parsed.(*spec.ResourceType)
+				crud.Register(s.resourceType)
+			},
+		},
+	} {
+		f, err := os.Open(each.filepath)
+		require.Nil(s.T(), err)
+
+		raw, err := ioutil.ReadAll(f)
+		require.Nil(s.T(), err)
+
+		err = json.Unmarshal(raw, each.structure)
+		require.Nil(s.T(), err)
+
+		if each.post != nil {
+			each.post(each.structure)
+		}
+	}
+}
+
+// pagedDB hides the cursors of the database, so that Export queries pages.
+type pagedDB struct {
+	db.DB
+}
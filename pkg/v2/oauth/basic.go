@@ -0,0 +1,130 @@
+package oauth
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"github.com/imulab/go-scim/pkg/v2/authz"
+	"github.com/imulab/go-scim/pkg/v2/spec"
+	"golang.org/x/crypto/bcrypt"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// CredentialStore authenticates the user names and passwords of HTTP Basic authentication (RFC 7617).
+type CredentialStore interface {
+	// Authenticate returns the principal of the user name, if the password is that of the user. Credentials that do
+	// not match are reported with an error of spec.ErrUnauthorized; failures to look them up, with an error of
+	// spec.ErrInternal.
+	Authenticate(ctx context.Context, username string, password string) (*Principal, error)
+}
+
+// BasicOptions configures BasicMiddleware.
+type BasicOptions struct {
+	// Credentials authenticates the user names and passwords.
+	Credentials CredentialStore
+	// Realm, if not empty, is advertised in the WWW-Authenticate header.
+	Realm string
+	// Scopes, if not empty, are required on all requests: callers lacking any of them are rejected with status 403.
+	Scopes []string
+	// Policy, if not nil, resolves the authz.Access of the scopes of the principal, which is placed in the request
+	// context (see authz.With).
+	Policy *authz.Policy
+}
+
+// BasicMiddleware returns a http.Handler which authenticates the requests with the user name and password of their
+// Authorization header before calling the next handler, with the principal in the request context, as Middleware does
+// with bearer tokens. The credentials are sent in the clear, so the endpoints must only be served over TLS.
+func BasicMiddleware(options BasicOptions, next http.Handler) http.Handler {
+	return &middleware{
+		scheme: "Basic",
+		authenticate: func(ctx context.Context, credentials string) (*Principal, error) {
+			raw, err := base64.StdEncoding.DecodeString(credentials)
+			if err != nil {
+				return nil, fmt.Errorf("%w: basic credentials are not base64 encoded", spec.ErrUnauthorized)
+			}
+			i := strings.IndexByte(string(raw), ':')
+			if i < 0 {
+				return nil, fmt.Errorf("%w: basic credentials lack the password", spec.ErrUnauthorized)
+			}
+			return options.Credentials.Authenticate(ctx, string(raw[:i]), string(raw[i+1:]))
+		},
+		realm:  options.Realm,
+		scopes: options.Scopes,
+		policy: options.Policy,
+		next:   next,
+	}
+}
+
+// Credential is the password of a user of BCryptCredentials, hashed with bcrypt.
+type Credential struct {
+	// PasswordHash is the bcrypt hash of the password, as bcrypt.GenerateFromPassword returns it.
+	PasswordHash string `json:"passwordHash"`
+	// Scopes are granted to the principal of the user.
+	Scopes []string `json:"scopes"`
+}
+
+// NewBCryptCredentials returns a CredentialStore of the users, keyed by user name, whose passwords are hashed with
+// bcrypt. The principals of the users have the user names as subjects.
+func NewBCryptCredentials(users map[string]*Credential) *BCryptCredentials {
+	s := new(BCryptCredentials)
+	s.Set(users)
+	return s
+}
+
+// BCryptCredentials is a CredentialStore of a set of users, whose passwords are hashed with bcrypt. The users may be
+// replaced with Set, i.e. to rotate their passwords.
+type BCryptCredentials struct {
+	mu    sync.RWMutex
+	users map[string]*Credential
+}
+
+// Set replaces the users. It is safe to call while users are being authenticated.
+func (s *BCryptCredentials) Set(users map[string]*Credential) {
+	copied := make(map[string]*Credential, len(users))
+	for username, credential := range users {
+		copied[username] = credential
+	}
+
+	s.mu.Lock()
+	s.users = copied
+	s.mu.Unlock()
+}
+
+func (s *BCryptCredentials) Authenticate(_ context.Context, username string, password string) (*Principal, error) {
+	s.mu.RLock()
+	credential, ok := s.users[username]
+	s.mu.RUnlock()
+
+	// Unknown users are compared against a dummy hash too, so that the time taken does not tell which users exist.
+	hash := unknownUserHash()
+	if ok {
+		hash = []byte(credential.PasswordHash)
+	}
+	if err := bcrypt.CompareHashAndPassword(hash, []byte(password)); err != nil || !ok {
+		return nil, fmt.Errorf("%w: user name or password is not valid", spec.ErrUnauthorized)
+	}
+
+	return &Principal{
+		Subject: username,
+		Scopes:  append([]string{}, credential.Scopes...),
+	}, nil
+}
+
+var (
+	dummyHash     []byte
+	dummyHashOnce sync.Once
+)
+
+// Returns a bcrypt hash of the default cost, which the passwords of unknown users are compared against.
+func unknownUserHash() []byte {
+	dummyHashOnce.Do(func() {
+		dummyHash, _ = bcrypt.GenerateFromPassword([]byte(strings.Repeat("x", 72)), bcrypt.DefaultCost)
+	})
+	return dummyHash
+}
+
+var (
+	_ CredentialStore = (*BCryptCredentials)(nil)
+)
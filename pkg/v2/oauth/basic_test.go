@@ -0,0 +1,113 @@
+package oauth
+
+import (
+	"github.com/imulab/go-scim/pkg/v2/spec"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestBasicMiddleware(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("s3cret"), bcrypt.MinCost)
+	require.Nil(t, err)
+	credentials := NewBCryptCredentials(map[string]*Credential{
+		"provisioner": {PasswordHash: string(hash), Scopes: []string{"scim"}},
+		"auditor":     {PasswordHash: string(hash)},
+	})
+
+	var principal *Principal
+	next := http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		principal = From(r.Context())
+		rw.WriteHeader(http.StatusOK)
+	})
+	handler := BasicMiddleware(BasicOptions{Credentials: credentials, Realm: "scim", Scopes: []string{"scim"}}, next)
+
+	tests := []struct {
+		name     string
+		username string
+		password string
+		header   string
+		expect   func(t *testing.T, rr *httptest.ResponseRecorder)
+	}{
+		{
+			name:     "valid credentials",
+			username: "provisioner",
+			password: "s3cret",
+			expect: func(t *testing.T, rr *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusOK, rr.Code)
+				assert.Equal(t, "provisioner", principal.Subject)
+				assert.Equal(t, []string{"scim"}, principal.Scopes)
+			},
+		},
+		{
+			name: "missing credentials",
+			expect: func(t *testing.T, rr *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusUnauthorized, rr.Code)
+				assert.Equal(t, `Basic realm="scim"`, rr.Header().Get("WWW-Authenticate"))
+				assert.Equal(t, "unauthorized: basic credentials are required", scimError(t, rr)["detail"])
+			},
+		},
+		{
+			name:     "wrong password",
+			username: "provisioner",
+			password: "guess",
+			expect: func(t *testing.T, rr *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusUnauthorized, rr.Code)
+				assert.Equal(t, `Basic realm="scim"`, rr.Header().Get("WWW-Authenticate"))
+				assert.Nil(t, principal)
+			},
+		},
+		{
+			name:     "unknown user",
+			username: "intruder",
+			password: "s3cret",
+			expect: func(t *testing.T, rr *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusUnauthorized, rr.Code)
+				assert.Equal(t, "unauthorized: user name or password is not valid", scimError(t, rr)["detail"])
+			},
+		},
+		{
+			name:   "malformed credentials",
+			header: "Basic not-base64",
+			expect: func(t *testing.T, rr *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusUnauthorized, rr.Code)
+			},
+		},
+		{
+			name:   "bearer token",
+			header: "Bearer 2YotnFZFEjr1zCsicMWpAA",
+			expect: func(t *testing.T, rr *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusBadRequest, rr.Code)
+				assert.Equal(t, `Basic realm="scim"`, rr.Header().Get("WWW-Authenticate"))
+			},
+		},
+		{
+			name:     "insufficient scope",
+			username: "auditor",
+			password: "s3cret",
+			expect: func(t *testing.T, rr *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusForbidden, rr.Code)
+				assert.Equal(t, spec.ErrForbidden.Type, scimError(t, rr)["scimType"])
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			principal = nil
+			r := httptest.NewRequest(http.MethodGet, "/Users", nil)
+			switch {
+			case len(test.header) > 0:
+				r.Header.Set("Authorization", test.header)
+			case len(test.username) > 0:
+				r.SetBasicAuth(test.username, test.password)
+			}
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, r)
+			test.expect(t, rr)
+		})
+	}
+}
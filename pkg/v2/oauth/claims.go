@@ -0,0 +1,89 @@
+package oauth
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/imulab/go-scim/pkg/v2/spec"
+	"strings"
+	"time"
+)
+
+// Validates the time claims of the token against now, tolerating the leeway, and its issuer and audience, if they are
+// expected. Missing time claims are not checked.
+func validateClaims(claims map[string]interface{}, issuer string, audience string, leeway time.Duration, now time.Time) error {
+	if exp, ok := timeClaim(claims, "exp"); ok && !now.Before(exp.Add(leeway)) {
+		return fmt.Errorf("%w: token has expired", spec.ErrUnauthorized)
+	}
+	if nbf, ok := timeClaim(claims, "nbf"); ok && now.Add(leeway).Before(nbf) {
+		return fmt.Errorf("%w: token is not valid yet", spec.ErrUnauthorized)
+	}
+	if len(issuer) > 0 {
+		if iss, _ := claims["iss"].(string); iss != issuer {
+			return fmt.Errorf("%w: token is not issued by '%s'", spec.ErrUnauthorized, issuer)
+		}
+	}
+	if len(audience) > 0 && !contains(stringsClaim(claims, "aud"), audience) {
+		return fmt.Errorf("%w: token is not intended for '%s'", spec.ErrUnauthorized, audience)
+	}
+	return nil
+}
+
+// Returns the principal of the claims of the token.
+func principalOf(claims map[string]interface{}) *Principal {
+	principal := &Principal{Claims: claims}
+	principal.Subject, _ = claims["sub"].(string)
+	if principal.ClientID, _ = claims["client_id"].(string); len(principal.ClientID) == 0 {
+		principal.ClientID, _ = claims["azp"].(string)
+	}
+	if scope, ok := claims["scope"].(string); ok {
+		principal.Scopes = strings.Fields(scope)
+	} else {
+		principal.Scopes = stringsClaim(claims, "scp")
+	}
+	return principal
+}
+
+// Returns the NumericDate claim, the number of seconds since the epoch, as time.
+func timeClaim(claims map[string]interface{}, name string) (time.Time, bool) {
+	var seconds float64
+	switch value := claims[name].(type) {
+	case json.Number:
+		f, err := value.Float64()
+		if err != nil {
+			return time.Time{}, false
+		}
+		seconds = f
+	case float64:
+		seconds = value
+	default:
+		return time.Time{}, false
+	}
+	return time.Unix(0, int64(seconds*float64(time.Second))), true
+}
+
+// Returns the claim that is either a string, or an array of strings, i.e. "aud".
+func stringsClaim(claims map[string]interface{}, name string) []string {
+	switch value := claims[name].(type) {
+	case string:
+		return strings.Fields(value)
+	case []interface{}:
+		var values []string
+		for _, each := range value {
+			if s, ok := each.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	default:
+		return nil
+	}
+}
+
+func contains(values []string, value string) bool {
+	for _, each := range values {
+		if each == value {
+			return true
+		}
+	}
+	return false
+}
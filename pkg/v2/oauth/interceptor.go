@@ -0,0 +1,70 @@
+package oauth
+
+import (
+	"context"
+	"fmt"
+	"github.com/imulab/go-scim/pkg/v2/service"
+	"github.com/imulab/go-scim/pkg/v2/spec"
+)
+
+// ScopeRule requires callers of the operations of a resource type to have one of the scopes.
+type ScopeRule struct {
+	ResourceType string   `json:"resourceType"` // id of the resource type, i.e. "User", or empty for all resource types
+	Operations   []string `json:"operations"`   // operations, i.e. service.OpCreate, or empty for all operations
+	Scopes       []string `json:"scopes"`       // scopes, one of which the caller must have
+}
+
+func (r *ScopeRule) applies(inv *service.Invocation) bool {
+	if len(r.ResourceType) > 0 && (inv.ResourceType == nil || inv.ResourceType.ID() != r.ResourceType) {
+		return false
+	}
+	if len(r.Operations) == 0 {
+		return true
+	}
+	for _, op := range r.Operations {
+		if op == inv.Operation {
+			return true
+		}
+	}
+	return false
+}
+
+// ScopeInterceptor returns a service.Interceptor which rejects the calls to the resource services by callers that do
+// not satisfy every rule applying to the call, with an error of spec.ErrForbidden, or with one of spec.ErrUnauthorized
+// if the context carries no principal (see Middleware). Calls no rule applies to are let through.
+func ScopeInterceptor(rules ...*ScopeRule) service.Interceptor {
+	return &scopeInterceptor{rules: rules}
+}
+
+type scopeInterceptor struct {
+	rules []*ScopeRule
+}
+
+func (i *scopeInterceptor) Before(ctx context.Context, inv *service.Invocation) (context.Context, error) {
+	principal := From(ctx)
+	for _, rule := range i.rules {
+		if !rule.applies(inv) {
+			continue
+		}
+		if principal == nil {
+			return ctx, fmt.Errorf("%w: caller is not authenticated", spec.ErrUnauthorized)
+		}
+		if !hasAnyScope(principal, rule.Scopes) {
+			return ctx, fmt.Errorf("%w: one of scopes %v is required to %s", spec.ErrForbidden, rule.Scopes, inv.Operation)
+		}
+	}
+	return ctx, nil
+}
+
+func (i *scopeInterceptor) After(_ context.Context, _ *service.Invocation, err error) error {
+	return err
+}
+
+func hasAnyScope(principal *Principal, scopes []string) bool {
+	for _, scope := range scopes {
+		if principal.HasScope(scope) {
+			return true
+		}
+	}
+	return false
+}
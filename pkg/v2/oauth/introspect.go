@@ -0,0 +1,80 @@
+package oauth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/imulab/go-scim/pkg/v2/spec"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// IntrospectionOptions configures the Verifier returned by NewIntrospectionVerifier.
+type IntrospectionOptions struct {
+	// Endpoint is the URL of the introspection endpoint of the authorization server.
+	Endpoint string
+	// ClientID and ClientSecret, if not empty, authenticate the service provider to the introspection endpoint with
+	// HTTP Basic authentication.
+	ClientID     string
+	ClientSecret string
+	// Audience, if not empty, must be the "aud" of the tokens, or one of them.
+	Audience string
+	// HTTPClient calls the introspection endpoint, http.DefaultClient if nil.
+	HTTPClient *http.Client
+}
+
+// NewIntrospectionVerifier returns a Verifier of opaque tokens, which asks the introspection endpoint of the
+// authorization server whether the tokens are active (RFC 7662). The claims of the principal are the members of the
+// introspection response, whose "scope" carries the scopes.
+func NewIntrospectionVerifier(options IntrospectionOptions) Verifier {
+	if options.HTTPClient == nil {
+		options.HTTPClient = http.DefaultClient
+	}
+	return &introspectionVerifier{options: options, now: time.Now}
+}
+
+type introspectionVerifier struct {
+	options IntrospectionOptions
+	now     func() time.Time
+}
+
+func (v *introspectionVerifier) Verify(ctx context.Context, token string) (*Principal, error) {
+	form := url.Values{"token": {token}, "token_type_hint": {"access_token"}}
+	req, err := http.NewRequest(http.MethodPost, v.options.Endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid introspection endpoint: %s", spec.ErrInternal, err.Error())
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if len(v.options.ClientID) > 0 {
+		req.SetBasicAuth(url.QueryEscape(v.options.ClientID), url.QueryEscape(v.options.ClientSecret))
+	}
+
+	resp, err := v.options.HTTPClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to introspect token: %s", spec.ErrInternal, err.Error())
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%w: failed to introspect token: status %d", spec.ErrInternal, resp.StatusCode)
+	}
+
+	var claims map[string]interface{}
+	decoder := json.NewDecoder(resp.Body)
+	decoder.UseNumber()
+	if err := decoder.Decode(&claims); err != nil {
+		return nil, fmt.Errorf("%w: failed to parse introspection response: %s", spec.ErrInternal, err.Error())
+	}
+
+	if active, _ := claims["active"].(bool); !active {
+		return nil, fmt.Errorf("%w: token is not active", spec.ErrUnauthorized)
+	}
+	if err := validateClaims(claims, "", v.options.Audience, 0, v.now()); err != nil {
+		return nil, err
+	}
+	return principalOf(claims), nil
+}
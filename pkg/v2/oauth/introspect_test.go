@@ -0,0 +1,97 @@
+package oauth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/imulab/go-scim/pkg/v2/spec"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestIntrospectionVerifier(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if id, secret, ok := r.BasicAuth(); !ok || id != "scim" || secret != "s3cret" {
+			rw.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.PostFormValue("token_type_hint") != "access_token" {
+			rw.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		response := map[string]interface{}{"active": false}
+		switch r.PostFormValue("token") {
+		case "active":
+			response = map[string]interface{}{
+				"active":    true,
+				"sub":       "2819c223",
+				"client_id": "provisioner",
+				"scope":     "scim.read",
+				"aud":       "https://scim.example.com",
+				"exp":       time.Now().Add(time.Hour).Unix(),
+			}
+		case "other audience":
+			response = map[string]interface{}{"active": true, "aud": "https://other.example.com"}
+		}
+		_ = json.NewEncoder(rw).Encode(response)
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name    string
+		options IntrospectionOptions
+		token   string
+		expect  func(t *testing.T, principal *Principal, err error)
+	}{
+		{
+			name:  "active token",
+			token: "active",
+			expect: func(t *testing.T, principal *Principal, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, "2819c223", principal.Subject)
+				assert.Equal(t, "provisioner", principal.ClientID)
+				assert.Equal(t, []string{"scim.read"}, principal.Scopes)
+				assert.Equal(t, true, principal.Claims["active"])
+			},
+		},
+		{
+			name:  "inactive token",
+			token: "revoked",
+			expect: func(t *testing.T, _ *Principal, err error) {
+				assert.True(t, errors.Is(err, spec.ErrUnauthorized))
+			},
+		},
+		{
+			name:  "token of other audience",
+			token: "other audience",
+			expect: func(t *testing.T, _ *Principal, err error) {
+				assert.True(t, errors.Is(err, spec.ErrUnauthorized))
+			},
+		},
+		{
+			name:    "rejected by introspection endpoint",
+			options: IntrospectionOptions{ClientID: "scim", ClientSecret: "wrong"},
+			token:   "active",
+			expect: func(t *testing.T, _ *Principal, err error) {
+				assert.True(t, errors.Is(err, spec.ErrInternal))
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			options := test.options
+			if len(options.ClientID) == 0 {
+				options = IntrospectionOptions{ClientID: "scim", ClientSecret: "s3cret", Audience: "https://scim.example.com"}
+			}
+			options.Endpoint = server.URL
+
+			principal, err := NewIntrospectionVerifier(options).Verify(context.Background(), test.token)
+			test.expect(t, principal, err)
+		})
+	}
+}
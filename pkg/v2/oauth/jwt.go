@@ -0,0 +1,305 @@
+package oauth
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"github.com/imulab/go-scim/pkg/v2/spec"
+	"hash"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultKeyCacheDuration = time.Hour
+	// keys are fetched again at most once per interval for tokens signed by unknown keys, i.e. after a key rotation
+	minKeyRefreshInterval = time.Minute
+)
+
+// JWTOptions configures the Verifier returned by NewJWTVerifier.
+type JWTOptions struct {
+	// JWKSURL is the URL of the JSON Web Key Set of the authorization server, i.e. its "jwks_uri" metadata.
+	JWKSURL string
+	// Issuer, if not empty, must be the "iss" claim of the tokens.
+	Issuer string
+	// Audience, if not empty, must be the "aud" claim, or one of them, of the tokens, i.e. the URL of the service
+	// provider.
+	Audience string
+	// Leeway tolerated when checking the "exp" and "nbf" claims, for the clock skew between the servers.
+	Leeway time.Duration
+	// KeyCacheDuration is how long the keys are used before they are fetched again, one hour if zero.
+	KeyCacheDuration time.Duration
+	// HTTPClient fetches the keys, http.DefaultClient if nil.
+	HTTPClient *http.Client
+}
+
+// NewJWTVerifier returns a Verifier of JWT tokens signed with one of the keys of the JSON Web Key Set at
+// JWTOptions.JWKSURL, with one of the RS256, RS384, RS512, PS256, PS384, PS512, ES256, ES384 or ES512 algorithms. The
+// keys are fetched upon the first verification, and cached (see JWTOptions.KeyCacheDuration). Tokens signed by a key
+// not cached have the keys fetched again, so that keys rotated by the authorization server are picked up. Tokens must
+// carry the "exp" claim. The scopes of the principal are those of the "scope" claim, delimited by spaces, or of the
+// "scp" claim, as some authorization servers issue.
+func NewJWTVerifier(options JWTOptions) Verifier {
+	if options.KeyCacheDuration == 0 {
+		options.KeyCacheDuration = defaultKeyCacheDuration
+	}
+	if options.HTTPClient == nil {
+		options.HTTPClient = http.DefaultClient
+	}
+	return &jwtVerifier{options: options, now: time.Now}
+}
+
+type jwtVerifier struct {
+	options JWTOptions
+	now     func() time.Time
+	mu      sync.Mutex
+	keys    map[string]*jsonWebKey
+	fetched time.Time
+}
+
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+	// parsed public key, *rsa.PublicKey or *ecdsa.PublicKey
+	key crypto.PublicKey
+}
+
+func (v *jwtVerifier) Verify(ctx context.Context, token string) (*Principal, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("%w: token is not a JWT", spec.ErrUnauthorized)
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, err
+	}
+
+	key, err := v.key(ctx, header.Kid)
+	if err != nil {
+		return nil, err
+	}
+	if len(key.Alg) > 0 && key.Alg != header.Alg {
+		return nil, fmt.Errorf("%w: token is not signed with the algorithm of its key", spec.ErrUnauthorized)
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("%w: signature of token is malformed", spec.ErrUnauthorized)
+	}
+	if err := verifySignature(header.Alg, key.key, []byte(parts[0]+"."+parts[1]), signature); err != nil {
+		return nil, err
+	}
+
+	var claims map[string]interface{}
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, err
+	}
+	if _, ok := claims["exp"]; !ok {
+		return nil, fmt.Errorf("%w: token does not expire", spec.ErrUnauthorized)
+	}
+	if err := validateClaims(claims, v.options.Issuer, v.options.Audience, v.options.Leeway, v.now()); err != nil {
+		return nil, err
+	}
+	return principalOf(claims), nil
+}
+
+// Returns the key of the key id, fetching the keys if they are not cached or no longer fresh, or if the key id is
+// unknown and the keys have not been fetched for a while, as the authorization server may have rotated them. The
+// only key is returned for tokens without key id.
+func (v *jwtVerifier) key(ctx context.Context, kid string) (*jsonWebKey, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if v.keys == nil || v.now().Sub(v.fetched) > v.options.KeyCacheDuration {
+		if err := v.fetch(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	key := v.lookup(kid)
+	if key == nil && v.now().Sub(v.fetched) > minKeyRefreshInterval {
+		if err := v.fetch(ctx); err != nil {
+			return nil, err
+		}
+		key = v.lookup(kid)
+	}
+	if key == nil {
+		return nil, fmt.Errorf("%w: token is not signed by a known key", spec.ErrUnauthorized)
+	}
+	return key, nil
+}
+
+func (v *jwtVerifier) lookup(kid string) *jsonWebKey {
+	if len(kid) == 0 && len(v.keys) == 1 {
+		for _, key := range v.keys {
+			return key
+		}
+	}
+	return v.keys[kid]
+}
+
+// Fetches the JSON Web Key Set, keeping the keys for signatures whose type is supported.
+func (v *jwtVerifier) fetch(ctx context.Context) error {
+	req, err := http.NewRequest(http.MethodGet, v.options.JWKSURL, nil)
+	if err != nil {
+		return fmt.Errorf("%w: invalid JWKS URL: %s", spec.ErrInternal, err.Error())
+	}
+	resp, err := v.options.HTTPClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return fmt.Errorf("%w: failed to fetch JWKS: %s", spec.ErrInternal, err.Error())
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%w: failed to fetch JWKS: status %d", spec.ErrInternal, resp.StatusCode)
+	}
+
+	var set struct {
+		Keys []*jsonWebKey `json:"keys"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&set); err != nil {
+		return fmt.Errorf("%w: failed to parse JWKS: %s", spec.ErrInternal, err.Error())
+	}
+
+	keys := map[string]*jsonWebKey{}
+	for _, key := range set.Keys {
+		if len(key.Use) > 0 && key.Use != "sig" {
+			continue
+		}
+		if key.key = key.publicKey(); key.key != nil {
+			keys[key.Kid] = key
+		}
+	}
+	v.keys = keys
+	v.fetched = v.now()
+	return nil
+}
+
+// Returns the parsed public key, or nil if the key type or curve is not supported, or if the key is malformed.
+func (k *jsonWebKey) publicKey() crypto.PublicKey {
+	switch k.Kty {
+	case "RSA":
+		n, e := decodeInt(k.N), decodeInt(k.E)
+		if n == nil || e == nil || !e.IsInt64() {
+			return nil
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil
+		}
+		x, y := decodeInt(k.X), decodeInt(k.Y)
+		if x == nil || y == nil || !curve.IsOnCurve(x, y) {
+			return nil
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}
+	default:
+		return nil
+	}
+}
+
+// Verifies the signature of the data with the key, by the algorithm. Algorithms other than those of RSA and ECDSA,
+// including "none", are not accepted.
+func verifySignature(alg string, key crypto.PublicKey, data []byte, signature []byte) error {
+	var (
+		h       crypto.Hash
+		newHash func() hash.Hash
+	)
+	if len(alg) == 5 {
+		switch alg[2:] {
+		case "256":
+			h, newHash = crypto.SHA256, sha256.New
+		case "384":
+			h, newHash = crypto.SHA384, sha512.New384
+		case "512":
+			h, newHash = crypto.SHA512, sha512.New
+		}
+	}
+	if newHash == nil {
+		return fmt.Errorf("%w: token is signed with unsupported algorithm '%s'", spec.ErrUnauthorized, alg)
+	}
+	digester := newHash()
+	digester.Write(data)
+	digest := digester.Sum(nil)
+
+	var valid bool
+	switch alg[:2] {
+	case "RS", "PS":
+		if key, ok := key.(*rsa.PublicKey); ok {
+			if alg[:2] == "RS" {
+				valid = rsa.VerifyPKCS1v15(key, h, digest, signature) == nil
+			} else {
+				valid = rsa.VerifyPSS(key, h, digest, signature, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash}) == nil
+			}
+		}
+	case "ES":
+		if key, ok := key.(*ecdsa.PublicKey); ok {
+			size := (key.Curve.Params().BitSize + 7) / 8
+			if len(signature) == 2*size {
+				r := new(big.Int).SetBytes(signature[:size])
+				s := new(big.Int).SetBytes(signature[size:])
+				valid = ecdsa.Verify(key, digest, r, s)
+			}
+		}
+	default:
+		return fmt.Errorf("%w: token is signed with unsupported algorithm '%s'", spec.ErrUnauthorized, alg)
+	}
+	if !valid {
+		return fmt.Errorf("%w: signature of token is not valid", spec.ErrUnauthorized)
+	}
+	return nil
+}
+
+// Decodes the base64url encoded JSON segment of the token into v, with numbers decoded as json.Number.
+func decodeSegment(segment string, v interface{}) error {
+	raw, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return fmt.Errorf("%w: token is malformed", spec.ErrUnauthorized)
+	}
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.UseNumber()
+	if err := decoder.Decode(v); err != nil {
+		return fmt.Errorf("%w: token is malformed", spec.ErrUnauthorized)
+	}
+	return nil
+}
+
+// Decodes the base64url encoded big-endian integer, as in JSON Web Keys, or returns nil.
+func decodeInt(s string) *big.Int {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil || len(raw) == 0 {
+		return nil
+	}
+	return new(big.Int).SetBytes(raw)
+}
@@ -0,0 +1,251 @@
+package oauth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"github.com/imulab/go-scim/pkg/v2/spec"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestJWTVerifier(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.Nil(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.Nil(t, err)
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.Nil(t, err)
+
+	var fetches int
+	jwks := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		fetches++
+		_ = json.NewEncoder(rw).Encode(map[string]interface{}{
+			"keys": []interface{}{
+				map[string]interface{}{
+					"kty": "RSA",
+					"kid": "rsa",
+					"use": "sig",
+					"n":   encodeInt(rsaKey.N),
+					"e":   encodeInt(big.NewInt(int64(rsaKey.E))),
+				},
+				map[string]interface{}{
+					"kty": "EC",
+					"kid": "ec",
+					"crv": "P-256",
+					"x":   encodeInt(ecKey.X),
+					"y":   encodeInt(ecKey.Y),
+				},
+				map[string]interface{}{
+					"kty": "RSA",
+					"kid": "enc",
+					"use": "enc",
+					"n":   encodeInt(otherKey.N),
+					"e":   encodeInt(big.NewInt(int64(otherKey.E))),
+				},
+			},
+		})
+	}))
+	defer jwks.Close()
+
+	verifier := NewJWTVerifier(JWTOptions{
+		JWKSURL:  jwks.URL,
+		Issuer:   "https://as.example.com",
+		Audience: "https://scim.example.com",
+	})
+	claims := func(overrides map[string]interface{}) map[string]interface{} {
+		c := map[string]interface{}{
+			"iss":       "https://as.example.com",
+			"aud":       []interface{}{"https://scim.example.com", "https://other.example.com"},
+			"sub":       "2819c223",
+			"client_id": "provisioner",
+			"scope":     "scim.read scim.write",
+			"exp":       time.Now().Add(time.Hour).Unix(),
+		}
+		for k, v := range overrides {
+			if v == nil {
+				delete(c, k)
+			} else {
+				c[k] = v
+			}
+		}
+		return c
+	}
+
+	tests := []struct {
+		name   string
+		token  func(t *testing.T) string
+		expect func(t *testing.T, principal *Principal, err error)
+	}{
+		{
+			name: "RS256",
+			token: func(t *testing.T) string {
+				return signRSA(t, rsaKey, "rsa", claims(nil))
+			},
+			expect: func(t *testing.T, principal *Principal, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, "2819c223", principal.Subject)
+				assert.Equal(t, "provisioner", principal.ClientID)
+				assert.Equal(t, []string{"scim.read", "scim.write"}, principal.Scopes)
+			},
+		},
+		{
+			name: "ES256",
+			token: func(t *testing.T) string {
+				return signEC(t, ecKey, "ec", claims(map[string]interface{}{"scope": nil, "scp": []interface{}{"scim.read"}}))
+			},
+			expect: func(t *testing.T, principal *Principal, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, []string{"scim.read"}, principal.Scopes)
+			},
+		},
+		{
+			name: "expired",
+			token: func(t *testing.T) string {
+				return signRSA(t, rsaKey, "rsa", claims(map[string]interface{}{"exp": time.Now().Add(-time.Minute).Unix()}))
+			},
+			expect: func(t *testing.T, _ *Principal, err error) {
+				assert.True(t, errors.Is(err, spec.ErrUnauthorized))
+			},
+		},
+		{
+			name: "without expiry",
+			token: func(t *testing.T) string {
+				return signRSA(t, rsaKey, "rsa", claims(map[string]interface{}{"exp": nil}))
+			},
+			expect: func(t *testing.T, _ *Principal, err error) {
+				assert.True(t, errors.Is(err, spec.ErrUnauthorized))
+			},
+		},
+		{
+			name: "not valid yet",
+			token: func(t *testing.T) string {
+				return signRSA(t, rsaKey, "rsa", claims(map[string]interface{}{"nbf": time.Now().Add(time.Minute).Unix()}))
+			},
+			expect: func(t *testing.T, _ *Principal, err error) {
+				assert.True(t, errors.Is(err, spec.ErrUnauthorized))
+			},
+		},
+		{
+			name: "other issuer",
+			token: func(t *testing.T) string {
+				return signRSA(t, rsaKey, "rsa", claims(map[string]interface{}{"iss": "https://evil.example.com"}))
+			},
+			expect: func(t *testing.T, _ *Principal, err error) {
+				assert.True(t, errors.Is(err, spec.ErrUnauthorized))
+			},
+		},
+		{
+			name: "other audience",
+			token: func(t *testing.T) string {
+				return signRSA(t, rsaKey, "rsa", claims(map[string]interface{}{"aud": "https://other.example.com"}))
+			},
+			expect: func(t *testing.T, _ *Principal, err error) {
+				assert.True(t, errors.Is(err, spec.ErrUnauthorized))
+			},
+		},
+		{
+			name: "signed by unknown key",
+			token: func(t *testing.T) string {
+				return signRSA(t, otherKey, "rsa", claims(nil))
+			},
+			expect: func(t *testing.T, _ *Principal, err error) {
+				assert.True(t, errors.Is(err, spec.ErrUnauthorized))
+			},
+		},
+		{
+			name: "signed by encryption key",
+			token: func(t *testing.T) string {
+				return signRSA(t, otherKey, "enc", claims(nil))
+			},
+			expect: func(t *testing.T, _ *Principal, err error) {
+				assert.True(t, errors.Is(err, spec.ErrUnauthorized))
+			},
+		},
+		{
+			name: "unsigned",
+			token: func(t *testing.T) string {
+				return encodeSegment(t, map[string]interface{}{"alg": "none", "kid": "rsa"}) + "." + encodeSegment(t, claims(nil)) + "."
+			},
+			expect: func(t *testing.T, _ *Principal, err error) {
+				assert.True(t, errors.Is(err, spec.ErrUnauthorized))
+			},
+		},
+		{
+			name: "opaque",
+			token: func(t *testing.T) string {
+				return "2YotnFZFEjr1zCsicMWpAA"
+			},
+			expect: func(t *testing.T, _ *Principal, err error) {
+				assert.True(t, errors.Is(err, spec.ErrUnauthorized))
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			principal, err := verifier.Verify(context.Background(), test.token(t))
+			test.expect(t, principal, err)
+		})
+	}
+
+	// keys are cached, and tokens of unknown keys fetch them again once in a while only
+	assert.Equal(t, 1, fetches)
+}
+
+func TestJWTVerifierWithoutKeys(t *testing.T) {
+	jwks := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		rw.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer jwks.Close()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.Nil(t, err)
+
+	_, err = NewJWTVerifier(JWTOptions{JWKSURL: jwks.URL}).Verify(context.Background(), signRSA(t, key, "rsa", map[string]interface{}{
+		"exp": time.Now().Add(time.Hour).Unix(),
+	}))
+	assert.True(t, errors.Is(err, spec.ErrInternal))
+}
+
+func signRSA(t *testing.T, key *rsa.PrivateKey, kid string, claims map[string]interface{}) string {
+	signed := encodeSegment(t, map[string]interface{}{"alg": "RS256", "kid": kid}) + "." + encodeSegment(t, claims)
+	digest := sha256.Sum256([]byte(signed))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	require.Nil(t, err)
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func signEC(t *testing.T, key *ecdsa.PrivateKey, kid string, claims map[string]interface{}) string {
+	signed := encodeSegment(t, map[string]interface{}{"alg": "ES256", "kid": kid}) + "." + encodeSegment(t, claims)
+	digest := sha256.Sum256([]byte(signed))
+	r, s, err := ecdsa.Sign(rand.Reader, key, digest[:])
+	require.Nil(t, err)
+	signature := make([]byte, 64)
+	rb, sb := r.Bytes(), s.Bytes()
+	copy(signature[32-len(rb):32], rb)
+	copy(signature[64-len(sb):], sb)
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func encodeSegment(t *testing.T, v interface{}) string {
+	raw, err := json.Marshal(v)
+	require.Nil(t, err)
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+func encodeInt(i *big.Int) string {
+	return base64.RawURLEncoding.EncodeToString(i.Bytes())
+}
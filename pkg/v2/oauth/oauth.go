@@ -0,0 +1,188 @@
+// This package authenticates the callers of the HTTP endpoints with OAuth 2.0 bearer tokens (RFC 6750). Middleware
+// reads the token from the Authorization header, and verifies it with a Verifier: either a JWT signed with a key of
+// the JSON Web Key Set of the authorization server (see NewJWTVerifier), or an opaque token, sent to the introspection
+// endpoint of the authorization server (see NewIntrospectionVerifier). The Principal the token was issued to is placed
+// in the request context (see With and From), along with the authz.Access of its scopes if a policy is configured, so
+// that the resource services can make authorization decisions, i.e. with ScopeInterceptor. Requests that are not
+// authenticated are answered with status 401, and those lacking the required scopes with status 403, both with the
+// WWW-Authenticate header of RFC 6750 section 3 and a SCIM error.
+//
+// For deployments whose identity provider only supports a shared secret, the static tokens of StaticTokens may be
+// verified instead, or the callers authenticated with HTTP Basic against a CredentialStore (see BasicMiddleware).
+package oauth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/imulab/go-scim/pkg/v2/authz"
+	"github.com/imulab/go-scim/pkg/v2/handlerutil"
+	"github.com/imulab/go-scim/pkg/v2/service"
+	"github.com/imulab/go-scim/pkg/v2/spec"
+	"net/http"
+	"strings"
+)
+
+// Principal is the caller a bearer token was issued to.
+type Principal struct {
+	// Subject is the "sub" claim of the token, usually the user on whose behalf the client calls, or the client itself.
+	Subject string
+	// ClientID is the id of the client the token was issued to, from the "client_id" or "azp" claim.
+	ClientID string
+	// Scopes granted to the token.
+	Scopes []string
+	// Claims of the token, or the introspection response of opaque tokens.
+	Claims map[string]interface{}
+}
+
+// HasScope returns true if the scope is granted to the principal.
+func (p *Principal) HasScope(scope string) bool {
+	return p != nil && contains(p.Scopes, scope)
+}
+
+// Verifier verifies bearer tokens, and returns the principal they were issued to. Tokens that are malformed, expired,
+// or otherwise not valid, are reported with an error of spec.ErrUnauthorized; failures to verify them, i.e. when the
+// authorization server could not be reached, with an error of spec.ErrInternal.
+type Verifier interface {
+	Verify(ctx context.Context, token string) (*Principal, error)
+}
+
+// VerifierFunc is an adapter to allow the use of ordinary functions as Verifier.
+type VerifierFunc func(ctx context.Context, token string) (*Principal, error)
+
+func (f VerifierFunc) Verify(ctx context.Context, token string) (*Principal, error) {
+	return f(ctx, token)
+}
+
+type principalKey struct{}
+
+// With returns a copy of the context carrying the principal.
+func With(ctx context.Context, principal *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, principal)
+}
+
+// From returns the principal carried by the context, or nil if there is none.
+func From(ctx context.Context) *Principal {
+	principal, _ := ctx.Value(principalKey{}).(*Principal)
+	return principal
+}
+
+// SubjectResolver returns a service.SubjectResolver which resolves the caller of /Me to the subject of the principal
+// carried by the context, for authorization servers whose subjects are the ids of the User resources.
+func SubjectResolver() service.SubjectResolver {
+	return service.SubjectResolverFunc(func(ctx context.Context) (string, error) {
+		principal := From(ctx)
+		if principal == nil || len(principal.Subject) == 0 {
+			return "", fmt.Errorf("%w: caller is not authenticated", spec.ErrUnauthorized)
+		}
+		return principal.Subject, nil
+	})
+}
+
+// Options configures Middleware.
+type Options struct {
+	// Verifier verifies the bearer tokens.
+	Verifier Verifier
+	// Realm, if not empty, is advertised in the WWW-Authenticate header.
+	Realm string
+	// Scopes, if not empty, are required on all requests: callers lacking any of them are rejected with status 403.
+	Scopes []string
+	// Policy, if not nil, resolves the authz.Access of the scopes of the principal, which is placed in the request
+	// context (see authz.With).
+	Policy *authz.Policy
+	// Optional, if true, lets requests without the Authorization header through, unauthenticated, so that the resource
+	// services decide. Requests with a token that is not valid are rejected still.
+	Optional bool
+}
+
+// Middleware returns a http.Handler which authenticates the requests with the bearer token of their Authorization
+// header before calling the next handler, with the principal in the request context. The token must be sent in the
+// Authorization header, as the query and form parameters of RFC 6750 are discouraged, and would end up in logs.
+func Middleware(options Options, next http.Handler) http.Handler {
+	return &middleware{
+		scheme:       "Bearer",
+		authenticate: options.Verifier.Verify,
+		realm:        options.Realm,
+		scopes:       options.Scopes,
+		policy:       options.Policy,
+		optional:     options.Optional,
+		next:         next,
+	}
+}
+
+// middleware authenticates the requests with the credentials of the scheme in their Authorization header.
+type middleware struct {
+	scheme       string
+	authenticate func(ctx context.Context, credentials string) (*Principal, error)
+	realm        string
+	scopes       []string
+	policy       *authz.Policy
+	optional     bool
+	next         http.Handler
+}
+
+func (m *middleware) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	header := r.Header.Get("Authorization")
+	if len(header) == 0 {
+		if m.optional {
+			m.next.ServeHTTP(rw, r)
+			return
+		}
+		m.challenge(rw, "", "")
+		_ = handlerutil.WriteError(rw, fmt.Errorf("%w: %s credentials are required", spec.ErrUnauthorized, strings.ToLower(m.scheme)))
+		return
+	}
+
+	fields := strings.Fields(header)
+	if len(fields) != 2 || !strings.EqualFold(fields[0], m.scheme) {
+		m.challenge(rw, "invalid_request", "")
+		_ = handlerutil.WriteError(rw, fmt.Errorf("%w: Authorization header is not of the %s scheme", spec.ErrInvalidSyntax, m.scheme))
+		return
+	}
+
+	principal, err := m.authenticate(r.Context(), fields[1])
+	if err != nil {
+		if errors.Is(err, spec.ErrUnauthorized) {
+			m.challenge(rw, "invalid_token", "")
+		}
+		_ = handlerutil.WriteError(rw, err)
+		return
+	}
+
+	for _, scope := range m.scopes {
+		if !principal.HasScope(scope) {
+			m.challenge(rw, "insufficient_scope", strings.Join(m.scopes, " "))
+			_ = handlerutil.WriteError(rw, fmt.Errorf("%w: scope '%s' is required", spec.ErrForbidden, scope))
+			return
+		}
+	}
+
+	ctx := With(r.Context(), principal)
+	if m.policy != nil {
+		ctx = authz.With(ctx, m.policy.Access(principal.Scopes...))
+	}
+	m.next.ServeHTTP(rw, r.WithContext(ctx))
+}
+
+// Sets the WWW-Authenticate header of the scheme. For the Bearer scheme, the header carries the error code and the
+// scopes required, if any, as in RFC 6750 section 3. The description is left to the SCIM error in the body.
+func (m *middleware) challenge(rw http.ResponseWriter, code string, scope string) {
+	var params []string
+	if len(m.realm) > 0 {
+		params = append(params, fmt.Sprintf(`realm="%s"`, m.realm))
+	}
+	if m.scheme == "Bearer" {
+		if len(code) > 0 {
+			params = append(params, fmt.Sprintf(`error="%s"`, code))
+		}
+		if len(scope) > 0 {
+			params = append(params, fmt.Sprintf(`scope="%s"`, scope))
+		}
+	}
+
+	challenge := m.scheme
+	if len(params) > 0 {
+		challenge += " " + strings.Join(params, ", ")
+	}
+	rw.Header().Set("WWW-Authenticate", challenge)
+}
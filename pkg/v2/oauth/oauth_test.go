@@ -0,0 +1,215 @@
+package oauth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/imulab/go-scim/pkg/v2/authz"
+	"github.com/imulab/go-scim/pkg/v2/service"
+	"github.com/imulab/go-scim/pkg/v2/spec"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestMiddleware(t *testing.T) {
+	verifier := VerifierFunc(func(_ context.Context, token string) (*Principal, error) {
+		switch token {
+		case "reader":
+			return &Principal{Subject: "2819c223", Scopes: []string{"scim"}}, nil
+		case "other":
+			return &Principal{Subject: "902c246b", Scopes: []string{"profile"}}, nil
+		case "unreachable":
+			return nil, fmt.Errorf("%w: failed to introspect token", spec.ErrInternal)
+		default:
+			return nil, fmt.Errorf("%w: token is not active", spec.ErrUnauthorized)
+		}
+	})
+	policy, err := authz.NewPolicy(nil)
+	require.Nil(t, err)
+
+	var principal *Principal
+	next := http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		principal = From(r.Context())
+		if principal != nil {
+			assert.NotNil(t, authz.From(r.Context()))
+		}
+		rw.WriteHeader(http.StatusOK)
+	})
+
+	tests := []struct {
+		name          string
+		options       Options
+		authorization string
+		expect        func(t *testing.T, rr *httptest.ResponseRecorder)
+	}{
+		{
+			name:          "valid token",
+			options:       Options{Scopes: []string{"scim"}, Policy: policy},
+			authorization: "Bearer reader",
+			expect: func(t *testing.T, rr *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusOK, rr.Code)
+				assert.Equal(t, "2819c223", principal.Subject)
+			},
+		},
+		{
+			name: "missing token",
+			expect: func(t *testing.T, rr *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusUnauthorized, rr.Code)
+				assert.Equal(t, `Bearer realm="scim"`, rr.Header().Get("WWW-Authenticate"))
+				assert.Equal(t, spec.ApplicationScimJson, rr.Header().Get("Content-Type"))
+				assert.Equal(t, float64(401), scimError(t, rr)["status"])
+			},
+		},
+		{
+			name:    "missing optional token",
+			options: Options{Optional: true},
+			expect: func(t *testing.T, rr *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusOK, rr.Code)
+				assert.Nil(t, principal)
+			},
+		},
+		{
+			name:          "invalid token",
+			authorization: "Bearer revoked",
+			expect: func(t *testing.T, rr *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusUnauthorized, rr.Code)
+				assert.Equal(t, `Bearer realm="scim", error="invalid_token"`, rr.Header().Get("WWW-Authenticate"))
+				assert.Equal(t, "unauthorized: token is not active", scimError(t, rr)["detail"])
+			},
+		},
+		{
+			name:          "other scheme",
+			authorization: "Basic dXNlcjpwYXNz",
+			expect: func(t *testing.T, rr *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusBadRequest, rr.Code)
+				assert.Equal(t, `Bearer realm="scim", error="invalid_request"`, rr.Header().Get("WWW-Authenticate"))
+			},
+		},
+		{
+			name:          "insufficient scope",
+			options:       Options{Scopes: []string{"scim"}},
+			authorization: "Bearer other",
+			expect: func(t *testing.T, rr *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusForbidden, rr.Code)
+				assert.Equal(t, `Bearer realm="scim", error="insufficient_scope", scope="scim"`, rr.Header().Get("WWW-Authenticate"))
+				assert.Equal(t, "forbidden", scimError(t, rr)["scimType"])
+			},
+		},
+		{
+			name:          "verification failure",
+			authorization: "Bearer unreachable",
+			expect: func(t *testing.T, rr *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusInternalServerError, rr.Code)
+				assert.Empty(t, rr.Header().Get("WWW-Authenticate"))
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			principal = nil
+			options := test.options
+			options.Verifier = verifier
+			options.Realm = "scim"
+
+			r := httptest.NewRequest(http.MethodGet, "/Users", nil)
+			if len(test.authorization) > 0 {
+				r.Header.Set("Authorization", test.authorization)
+			}
+			rr := httptest.NewRecorder()
+			Middleware(options, next).ServeHTTP(rr, r)
+			test.expect(t, rr)
+		})
+	}
+}
+
+func TestScopeInterceptor(t *testing.T) {
+	for _, filepath := range []string{
+		"../../../public/schemas/core_schema.json",
+		"../../../public/schemas/user_schema.json",
+		"../../../public/schemas/user_enterprise_extension_schema.json",
+	} {
+		raw, err := ioutil.ReadFile(filepath)
+		require.Nil(t, err)
+		schema := new(spec.Schema)
+		require.Nil(t, json.Unmarshal(raw, schema))
+		spec.Schemas().Register(schema)
+	}
+	raw, err := ioutil.ReadFile("../../../public/resource_types/user_resource_type.json")
+	require.Nil(t, err)
+	resourceType := new(spec.ResourceType)
+	require.Nil(t, json.Unmarshal(raw, resourceType))
+
+	interceptor := ScopeInterceptor(
+		&ScopeRule{Operations: []string{service.OpGet, service.OpQuery}, Scopes: []string{"scim.read", "scim.write"}},
+		&ScopeRule{ResourceType: "User", Operations: []string{service.OpCreate, service.OpDelete}, Scopes: []string{"scim.write"}},
+	)
+
+	tests := []struct {
+		name      string
+		principal *Principal
+		operation string
+		expect    func(t *testing.T, err error)
+	}{
+		{
+			name:      "reader reads",
+			principal: &Principal{Scopes: []string{"scim.read"}},
+			operation: service.OpGet,
+			expect: func(t *testing.T, err error) {
+				assert.Nil(t, err)
+			},
+		},
+		{
+			name:      "reader creates",
+			principal: &Principal{Scopes: []string{"scim.read"}},
+			operation: service.OpCreate,
+			expect: func(t *testing.T, err error) {
+				assert.True(t, errors.Is(err, spec.ErrForbidden))
+			},
+		},
+		{
+			name:      "writer creates",
+			principal: &Principal{Scopes: []string{"scim.write"}},
+			operation: service.OpCreate,
+			expect: func(t *testing.T, err error) {
+				assert.Nil(t, err)
+			},
+		},
+		{
+			name:      "anyone patches",
+			operation: service.OpPatch,
+			expect: func(t *testing.T, err error) {
+				assert.Nil(t, err)
+			},
+		},
+		{
+			name:      "anonymous queries",
+			operation: service.OpQuery,
+			expect: func(t *testing.T, err error) {
+				assert.True(t, errors.Is(err, spec.ErrUnauthorized))
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx := context.Background()
+			if test.principal != nil {
+				ctx = With(ctx, test.principal)
+			}
+			_, err := interceptor.Before(ctx, &service.Invocation{Operation: test.operation, ResourceType: resourceType})
+			test.expect(t, err)
+		})
+	}
+}
+
+func scimError(t *testing.T, rr *httptest.ResponseRecorder) map[string]interface{} {
+	var e map[string]interface{}
+	require.Nil(t, json.Unmarshal(rr.Body.Bytes(), &e))
+	return e
+}
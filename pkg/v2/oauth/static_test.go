@@ -0,0 +1,84 @@
+package oauth
+
+import (
+	"context"
+	"errors"
+	"github.com/imulab/go-scim/pkg/v2/spec"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestStaticTokens(t *testing.T) {
+	now := time.Now()
+	tokens := NewStaticTokens(
+		&StaticToken{Token: "current", Subject: "azure", Scopes: []string{"scim"}},
+		&StaticToken{Token: "previous", Subject: "azure", NotAfter: now.Add(time.Hour)},
+		&StaticToken{Token: "expired", NotAfter: now.Add(-time.Hour)},
+	)
+
+	tests := []struct {
+		name   string
+		rotate []*StaticToken
+		token  string
+		expect func(t *testing.T, principal *Principal, err error)
+	}{
+		{
+			name:  "current token",
+			token: "current",
+			expect: func(t *testing.T, principal *Principal, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, "azure", principal.Subject)
+				assert.Equal(t, []string{"scim"}, principal.Scopes)
+			},
+		},
+		{
+			name:  "token in grace period",
+			token: "previous",
+			expect: func(t *testing.T, principal *Principal, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, "azure", principal.Subject)
+			},
+		},
+		{
+			name:  "expired token",
+			token: "expired",
+			expect: func(t *testing.T, _ *Principal, err error) {
+				assert.True(t, errors.Is(err, spec.ErrUnauthorized))
+			},
+		},
+		{
+			name:  "unknown token",
+			token: "curren",
+			expect: func(t *testing.T, _ *Principal, err error) {
+				assert.True(t, errors.Is(err, spec.ErrUnauthorized))
+			},
+		},
+		{
+			name:   "token rotated out",
+			rotate: []*StaticToken{{Token: "next", Subject: "azure"}},
+			token:  "current",
+			expect: func(t *testing.T, _ *Principal, err error) {
+				assert.True(t, errors.Is(err, spec.ErrUnauthorized))
+			},
+		},
+		{
+			name:  "token rotated in",
+			token: "next",
+			expect: func(t *testing.T, principal *Principal, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, "azure", principal.Subject)
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if test.rotate != nil {
+				tokens.Set(test.rotate...)
+			}
+			principal, err := tokens.Verify(context.Background(), test.token)
+			test.expect(t, principal, err)
+		})
+	}
+}
@@ -0,0 +1,7 @@
+// This package generates the OpenAPI 3 document of a SCIM deployment from its resource types and their schemas, so
+// that client teams can generate SDKs against it. The document describes the standard SCIM endpoints of each resource
+// type, as served by handlerutil.NewServer, with the schema of its resources, including the schema extensions, and the
+// SCIM messages: list responses, search requests, patch operations, bulk requests and responses, and errors.
+//
+// Generate returns the document, to be written to a file, i.e. at build time; Handler serves it, i.e. on /openapi.json.
+package openapi
@@ -0,0 +1,146 @@
+package openapi
+
+import (
+	"github.com/imulab/go-scim/pkg/v2/service"
+)
+
+// Returns the schemas of the SCIM messages, keyed by component names.
+func messageSchemas() map[string]interface{} {
+	str := map[string]interface{}{"type": "string"}
+	integer := map[string]interface{}{"type": "integer"}
+	stringArray := map[string]interface{}{"type": "array", "items": str}
+	scimType := map[string]interface{}{
+		"type": "string",
+		"description": "Type of the error, i.e. one of RFC 7644 section 3.12: invalidFilter, tooMany, uniqueness, " +
+			"mutability, invalidSyntax, invalidPath, noTarget, invalidValue, invalidVers, sensitive",
+	}
+	messageSchemas := func(urn string) map[string]interface{} {
+		return map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "string", "enum": []interface{}{urn}}}
+	}
+	object := func(required []interface{}, properties map[string]interface{}) map[string]interface{} {
+		schema := map[string]interface{}{"type": "object", "properties": properties}
+		if len(required) > 0 {
+			schema["required"] = required
+		}
+		return schema
+	}
+
+	errorDetail := object([]interface{}{"status"}, map[string]interface{}{
+		"status":   integer,
+		"scimType": scimType,
+		"detail":   str,
+	})
+	errorMessage := object([]interface{}{"schemas", "status"}, map[string]interface{}{
+		"schemas":  messageSchemas("urn:ietf:params:scim:api:messages:2.0:Error"),
+		"status":   integer,
+		"scimType": scimType,
+		"detail":   str,
+		"errors":   map[string]interface{}{"type": "array", "items": errorDetail},
+	})
+
+	return map[string]interface{}{
+		"Error":        errorMessage,
+		"ListResponse": listResponseSchema(map[string]interface{}{"type": "object"}),
+		"SearchRequest": object([]interface{}{"schemas"}, map[string]interface{}{
+			"schemas":            messageSchemas(service.SearchRequestSchema),
+			"attributes":         stringArray,
+			"excludedAttributes": stringArray,
+			"filter":             str,
+			"sortBy":             str,
+			"sortOrder":          map[string]interface{}{"type": "string", "enum": []interface{}{"ascending", "descending"}},
+			"startIndex":         integer,
+			"count":              integer,
+			"cursor":             str,
+		}),
+		"PatchOp": object([]interface{}{"schemas", "Operations"}, map[string]interface{}{
+			"schemas": messageSchemas("urn:ietf:params:scim:api:messages:2.0:PatchOp"),
+			"Operations": map[string]interface{}{
+				"type": "array",
+				"items": object([]interface{}{"op"}, map[string]interface{}{
+					"op":    map[string]interface{}{"type": "string", "enum": []interface{}{"add", "remove", "replace"}},
+					"path":  str,
+					"value": map[string]interface{}{},
+				}),
+			},
+		}),
+		"BulkRequest": object([]interface{}{"schemas", "Operations"}, map[string]interface{}{
+			"schemas":      messageSchemas(service.BulkRequestSchema),
+			"failOnErrors": integer,
+			"Operations": map[string]interface{}{
+				"type": "array",
+				"items": object([]interface{}{"method", "path"}, map[string]interface{}{
+					"method":  map[string]interface{}{"type": "string", "enum": []interface{}{"POST", "PUT", "PATCH", "DELETE"}},
+					"bulkId":  str,
+					"version": str,
+					"path":    str,
+					"data":    map[string]interface{}{},
+				}),
+			},
+		}),
+		"BulkResponse": object([]interface{}{"schemas", "Operations"}, map[string]interface{}{
+			"schemas": messageSchemas(service.BulkResponseSchema),
+			"Operations": map[string]interface{}{
+				"type": "array",
+				"items": object([]interface{}{"method", "status"}, map[string]interface{}{
+					"location": str,
+					"method":   str,
+					"bulkId":   str,
+					"version":  str,
+					"status":   str,
+					"response": ref("schemas", "Error"),
+				}),
+			},
+		}),
+	}
+}
+
+// Returns the schema of the list responses of the resources of the schema.
+func listResponseSchema(resource map[string]interface{}) map[string]interface{} {
+	integer := map[string]interface{}{"type": "integer"}
+	return map[string]interface{}{
+		"type":     "object",
+		"required": []interface{}{"schemas", "totalResults"},
+		"properties": map[string]interface{}{
+			"schemas": map[string]interface{}{
+				"type":  "array",
+				"items": map[string]interface{}{"type": "string", "enum": []interface{}{"urn:ietf:params:scim:api:messages:2.0:ListResponse"}},
+			},
+			"totalResults": integer,
+			"startIndex":   integer,
+			"itemsPerPage": integer,
+			"nextCursor":   map[string]interface{}{"type": "string"},
+			"Resources":    map[string]interface{}{"type": "array", "items": resource},
+		},
+	}
+}
+
+// Returns the parameters of the operations, keyed by component names.
+func parameters() map[string]interface{} {
+	query := func(name string, description string, schema map[string]interface{}) map[string]interface{} {
+		return map[string]interface{}{"name": name, "in": "query", "description": description, "schema": schema}
+	}
+	header := func(name string, description string) map[string]interface{} {
+		return map[string]interface{}{"name": name, "in": "header", "description": description, "schema": map[string]interface{}{"type": "string"}}
+	}
+	str := map[string]interface{}{"type": "string"}
+	integer := map[string]interface{}{"type": "integer", "minimum": 0}
+
+	return map[string]interface{}{
+		"id": map[string]interface{}{
+			"name":     "id",
+			"in":       "path",
+			"required": true,
+			"schema":   str,
+		},
+		"filter":             query("filter", "SCIM filter of the resources, i.e. userName eq \"bjensen\"", str),
+		"sortBy":             query("sortBy", "Path of the attribute to sort the resources by", str),
+		"sortOrder":          query("sortOrder", "Order to sort the resources in", map[string]interface{}{"type": "string", "enum": []interface{}{"ascending", "descending"}}),
+		"startIndex":         query("startIndex", "1-based index of the first resource", map[string]interface{}{"type": "integer", "minimum": 1}),
+		"count":              query("count", "Maximum number of resources to return", integer),
+		"cursor":             query("cursor", "Cursor of the page of resources, as returned in nextCursor", str),
+		"attributes":         query("attributes", "Comma separated paths of the attributes to return", str),
+		"excludedAttributes": query("excludedAttributes", "Comma separated paths of the attributes not to return", str),
+		"If-Match":           header("If-Match", "Version the resource must be at, for the operation to proceed"),
+		"If-None-Match":      header("If-None-Match", "Version of the resource the client has, which is not returned again if current"),
+	}
+}
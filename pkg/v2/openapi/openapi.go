@@ -0,0 +1,290 @@
+package openapi
+
+import (
+	"encoding/json"
+	"github.com/imulab/go-scim/pkg/v2/spec"
+	"net/http"
+	"strings"
+)
+
+// Version of the OpenAPI specification the documents conform to.
+const Version = "3.0.3"
+
+// Options configures the document of Generate.
+type Options struct {
+	// Title and Version of the API, in the info of the document. Title defaults to "SCIM", and Version to "2.0".
+	Title   string
+	Version string
+	// Description of the API, in the info of the document, if not empty.
+	Description string
+	// ServerURL, if not empty, is the URL the endpoints are relative to, i.e. "https://scim.example.com/v2".
+	ServerURL string
+	// ResourceTypes are the resource types served, each on its endpoint.
+	ResourceTypes []*spec.ResourceType
+	// ServiceProviderConfig, if not nil, limits the operations to those it supports, i.e. PATCH and /Bulk, and its
+	// authentication schemes are the security schemes of the document. Otherwise, all operations are documented.
+	ServiceProviderConfig *spec.ServiceProviderConfig
+}
+
+// Generate returns the OpenAPI document of the resource types. The document is a JSON object, to be marshaled with
+// encoding/json.
+func Generate(options Options) map[string]interface{} {
+	g := &generator{
+		options:    options,
+		paths:      map[string]interface{}{},
+		schemas:    messageSchemas(),
+		parameters: parameters(),
+	}
+	g.discovery()
+	for _, resourceType := range options.ResourceTypes {
+		g.resourceType(resourceType)
+	}
+	if g.supports(func(config *spec.ServiceProviderConfig) bool { return config.Bulk.Supported }) {
+		g.bulk()
+	}
+	if g.supports(func(config *spec.ServiceProviderConfig) bool { return config.Filter.Supported }) {
+		g.paths["/.search"] = map[string]interface{}{
+			"post": g.operation("search", "Search resources of all resource types", nil, ref("schemas", "SearchRequest"),
+				map[string]interface{}{"200": g.content("Resources found", ref("schemas", "ListResponse"))}),
+		}
+	}
+
+	info := map[string]interface{}{
+		"title":   or(options.Title, "SCIM"),
+		"version": or(options.Version, "2.0"),
+	}
+	if len(options.Description) > 0 {
+		info["description"] = options.Description
+	}
+
+	components := map[string]interface{}{
+		"schemas":    g.schemas,
+		"parameters": g.parameters,
+		"responses": map[string]interface{}{
+			"Error": g.content("SCIM error", ref("schemas", "Error")),
+		},
+	}
+	document := map[string]interface{}{
+		"openapi":    Version,
+		"info":       info,
+		"paths":      g.paths,
+		"components": components,
+	}
+	if len(options.ServerURL) > 0 {
+		document["servers"] = []interface{}{map[string]interface{}{"url": options.ServerURL}}
+	}
+	if securitySchemes, security := g.security(); len(securitySchemes) > 0 {
+		components["securitySchemes"] = securitySchemes
+		document["security"] = security
+	}
+	return document
+}
+
+// Handler returns a http.Handler serving the OpenAPI document of Generate as JSON, i.e. on /openapi.json. The document
+// is generated on every request, so that it describes the schemas as they are registered.
+func Handler(options Options) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			rw.Header().Set("Allow", "GET, HEAD")
+			rw.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		raw, err := json.Marshal(Generate(options))
+		if err != nil {
+			rw.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		rw.Header().Set("Content-Type", "application/json")
+		rw.WriteHeader(http.StatusOK)
+		_, _ = rw.Write(raw)
+	})
+}
+
+type generator struct {
+	options    Options
+	paths      map[string]interface{}
+	schemas    map[string]interface{}
+	parameters map[string]interface{}
+}
+
+// Returns true if the service provider config supports the feature, or there is none.
+func (g *generator) supports(feature func(config *spec.ServiceProviderConfig) bool) bool {
+	return g.options.ServiceProviderConfig == nil || feature(g.options.ServiceProviderConfig)
+}
+
+// Adds the paths of the endpoint of the resource type, and the schemas of its resources.
+func (g *generator) resourceType(resourceType *spec.ResourceType) {
+	name := componentName(resourceType.Name())
+	resource := ref("schemas", name)
+	g.schemas[name] = resourceSchema(resourceType)
+	_ = resourceType.ForEachExtension(func(extension *spec.Schema, _ bool) error {
+		g.schemas[extensionName(extension)] = extensionSchema(extension)
+		return nil
+	})
+
+	list := name + "ListResponse"
+	g.schemas[list] = listResponseSchema(resource)
+
+	projection := []interface{}{ref("parameters", "attributes"), ref("parameters", "excludedAttributes")}
+	query := []interface{}{ref("parameters", "filter")}
+	if g.supports(func(config *spec.ServiceProviderConfig) bool { return config.Sort.Supported }) {
+		query = append(query, ref("parameters", "sortBy"), ref("parameters", "sortOrder"))
+	}
+	query = append(query, ref("parameters", "startIndex"), ref("parameters", "count"))
+	if g.supports(func(config *spec.ServiceProviderConfig) bool { return config.Pagination.Cursor }) {
+		query = append(query, ref("parameters", "cursor"))
+	}
+	query = append(query, projection...)
+
+	var matchCriteria []interface{}
+	if g.supports(func(config *spec.ServiceProviderConfig) bool { return config.ETag.Supported }) {
+		matchCriteria = []interface{}{ref("parameters", "If-Match")}
+	}
+
+	endpoint := "/" + strings.Trim(resourceType.Endpoint(), "/")
+	found := g.content(resourceType.Name()+" found", resource)
+	listed := map[string]interface{}{"200": g.content(resourceType.Name()+" resources found", ref("schemas", list))}
+	g.paths[endpoint] = map[string]interface{}{
+		"get": g.operation("query"+name, "Query "+resourceType.Name()+" resources", query, nil, listed),
+		"post": g.operation("create"+name, "Create a "+resourceType.Name(), projection, resource,
+			map[string]interface{}{"201": g.content(resourceType.Name()+" created", resource)}),
+	}
+	if g.supports(func(config *spec.ServiceProviderConfig) bool { return config.Filter.Supported }) {
+		g.paths[endpoint+"/.search"] = map[string]interface{}{
+			"post": g.operation("search"+name, "Search "+resourceType.Name()+" resources", nil, ref("schemas", "SearchRequest"), listed),
+		}
+	}
+
+	get := map[string]interface{}{"200": found}
+	if g.supports(func(config *spec.ServiceProviderConfig) bool { return config.ETag.Supported }) {
+		get["304"] = noContent(resourceType.Name() + " not modified")
+	}
+	modify := append(append([]interface{}{}, projection...), matchCriteria...)
+	item := map[string]interface{}{
+		"parameters": []interface{}{ref("parameters", "id")},
+		"get":        g.operation("get"+name, "Get a "+resourceType.Name(), g.withIfNoneMatch(projection), nil, get),
+		"put": g.operation("replace"+name, "Replace a "+resourceType.Name(), modify, resource, map[string]interface{}{
+			"200": g.content(resourceType.Name()+" replaced", resource),
+			"204": noContent("Nothing changed"),
+		}),
+		"delete": g.operation("delete"+name, "Delete a "+resourceType.Name(), matchCriteria, nil, map[string]interface{}{
+			"204": noContent(resourceType.Name() + " deleted"),
+		}),
+	}
+	if g.supports(func(config *spec.ServiceProviderConfig) bool { return config.Patch.Supported }) {
+		item["patch"] = g.operation("patch"+name, "Patch a "+resourceType.Name(), modify, ref("schemas", "PatchOp"), map[string]interface{}{
+			"200": g.content(resourceType.Name()+" patched", resource),
+			"204": noContent("Nothing changed"),
+		})
+	}
+	g.paths[endpoint+"/{id}"] = item
+}
+
+// Adds the discovery endpoints.
+func (g *generator) discovery() {
+	object := map[string]interface{}{"type": "object"}
+	g.paths["/ServiceProviderConfig"] = map[string]interface{}{
+		"get": g.operation("getServiceProviderConfig", "Get the service provider config", nil, nil,
+			map[string]interface{}{"200": g.content("Service provider config", object)}),
+	}
+	for _, discovery := range []string{"ResourceTypes", "Schemas"} {
+		g.paths["/"+discovery] = map[string]interface{}{
+			"get": g.operation("list"+discovery, "List the "+discovery, nil, nil,
+				map[string]interface{}{"200": g.content(discovery, ref("schemas", "ListResponse"))}),
+		}
+		g.paths["/"+discovery+"/{id}"] = map[string]interface{}{
+			"parameters": []interface{}{ref("parameters", "id")},
+			"get": g.operation("get"+strings.TrimSuffix(discovery, "s"), "Get one of the "+discovery, nil, nil,
+				map[string]interface{}{"200": g.content(strings.TrimSuffix(discovery, "s"), object)}),
+		}
+	}
+}
+
+// Adds the /Bulk endpoint.
+func (g *generator) bulk() {
+	g.paths["/Bulk"] = map[string]interface{}{
+		"post": g.operation("bulk", "Perform operations in bulk", nil, ref("schemas", "BulkRequest"),
+			map[string]interface{}{"200": g.content("Outcome of the operations", ref("schemas", "BulkResponse"))}),
+	}
+}
+
+// Returns the operation, whose errors are all the SCIM error response.
+func (g *generator) operation(id string, summary string, parameters []interface{}, requestBody interface{}, responses map[string]interface{}) map[string]interface{} {
+	responses["default"] = ref("responses", "Error")
+	op := map[string]interface{}{
+		"operationId": id,
+		"summary":     summary,
+		"responses":   responses,
+	}
+	if len(parameters) > 0 {
+		op["parameters"] = parameters
+	}
+	if requestBody != nil {
+		op["requestBody"] = map[string]interface{}{
+			"required": true,
+			"content":  scimContent(requestBody),
+		}
+	}
+	return op
+}
+
+// Returns the response of the description, whose content is of the schema.
+func (g *generator) content(description string, schema interface{}) map[string]interface{} {
+	return map[string]interface{}{
+		"description": description,
+		"content":     scimContent(schema),
+	}
+}
+
+func (g *generator) withIfNoneMatch(parameters []interface{}) []interface{} {
+	if !g.supports(func(config *spec.ServiceProviderConfig) bool { return config.ETag.Supported }) {
+		return parameters
+	}
+	return append(append([]interface{}{}, parameters...), ref("parameters", "If-None-Match"))
+}
+
+// Returns the security schemes of the authentication schemes of the service provider config, and the security
+// requirement of the document, satisfied by any of them.
+func (g *generator) security() (map[string]interface{}, []interface{}) {
+	if g.options.ServiceProviderConfig == nil {
+		return nil, nil
+	}
+
+	schemes := map[string]interface{}{}
+	var security []interface{}
+	for _, authScheme := range g.options.ServiceProviderConfig.AuthSchemes {
+		var scheme map[string]interface{}
+		switch strings.ToLower(authScheme.Type) {
+		case "oauthbearertoken", "oauth2":
+			scheme = map[string]interface{}{"type": "http", "scheme": "bearer"}
+		case "httpbasic":
+			scheme = map[string]interface{}{"type": "http", "scheme": "basic"}
+		default:
+			continue
+		}
+		if len(authScheme.Description) > 0 {
+			scheme["description"] = authScheme.Description
+		}
+		name := componentName(authScheme.Type)
+		schemes[name] = scheme
+		security = append(security, map[string]interface{}{name: []interface{}{}})
+	}
+	return schemes, security
+}
+
+func scimContent(schema interface{}) map[string]interface{} {
+	return map[string]interface{}{
+		spec.ApplicationScimJson: map[string]interface{}{"schema": schema},
+	}
+}
+
+func noContent(description string) map[string]interface{} {
+	return map[string]interface{}{"description": description}
+}
+
+func or(value string, defaultValue string) string {
+	if len(value) == 0 {
+		return defaultValue
+	}
+	return value
+}
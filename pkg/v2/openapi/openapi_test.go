@@ -0,0 +1,172 @@
+package openapi
+
+import (
+	"encoding/json"
+	"github.com/imulab/go-scim/pkg/v2/spec"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestOpenAPI(t *testing.T) {
+	s := new(OpenAPITestSuite)
+	suite.Run(t, s)
+}
+
+type OpenAPITestSuite struct {
+	suite.Suite
+	config        *spec.ServiceProviderConfig
+	resourceTypes []*spec.ResourceType
+}
+
+func (s *OpenAPITestSuite) SetupSuite() {
+	for _, each := range []struct {
+		filepath  string
+		structure interface{}
+		post      func(parsed interface{})
+	}{
+		{filepath: "../../../public/schemas/core_schema.json", structure: new(spec.Schema), post: s.registerSchema},
+		{filepath: "../../../public/schemas/user_schema.json", structure: new(spec.Schema), post: s.registerSchema},
+		{filepath: "../../../public/schemas/user_enterprise_extension_schema.json", structure: new(spec.Schema), post: s.registerSchema},
+		{filepath: "../../../public/schemas/group_schema.json", structure: new(spec.Schema), post: s.registerSchema},
+		{filepath: "../../../public/resource_types/user_resource_type.json", structure: new(spec.ResourceType), post: s.addResourceType},
+		{filepath: "../../../public/resource_types/group_resource_type.json", structure: new(spec.ResourceType), post: s.addResourceType},
+		{filepath: "../../../public/service_provider_config.json", structure: new(spec.ServiceProviderConfig), post: func(parsed interface{}) {
+			s.config = parsed.(*spec.ServiceProviderConfig)
+		}},
+	} {
+		raw, err := ioutil.ReadFile(each.filepath)
+		s.Require().Nil(err)
+		s.Require().Nil(json.Unmarshal(raw, each.structure))
+		each.post(each.structure)
+	}
+}
+
+func (s *OpenAPITestSuite) registerSchema(parsed interface{}) {
+	spec.Schemas().Register(parsed.(*spec.Schema))
+}
+
+func (s *OpenAPITestSuite) addResourceType(parsed interface{}) {
+	s.resourceTypes = append(s.resourceTypes, parsed.(*spec.ResourceType))
+}
+
+func (s *OpenAPITestSuite) TestGenerate() {
+	tests := []struct {
+		name    string
+		options func() Options
+		expect  func(t *testing.T, document map[string]interface{})
+	}{
+		{
+			name: "supported operations",
+			options: func() Options {
+				return Options{ServerURL: "https://scim.example.com/v2", ResourceTypes: s.resourceTypes, ServiceProviderConfig: s.config}
+			},
+			expect: func(t *testing.T, document map[string]interface{}) {
+				assert.Equal(t, "3.0.3", document["openapi"])
+				assert.Equal(t, "SCIM", lookup(t, document, "info", "title"))
+				assert.Equal(t, "https://scim.example.com/v2", document["servers"].([]interface{})[0].(map[string]interface{})["url"])
+
+				paths := document["paths"].(map[string]interface{})
+				for _, path := range []string{
+					"/ServiceProviderConfig", "/ResourceTypes", "/ResourceTypes/{id}", "/Schemas", "/Schemas/{id}", "/.search",
+					"/Users", "/Users/.search", "/Users/{id}", "/Groups", "/Groups/.search", "/Groups/{id}",
+				} {
+					assert.Contains(t, paths, path)
+				}
+				assert.NotContains(t, paths, "/Bulk")
+				assert.Contains(t, paths["/Users/{id}"], "patch")
+				assert.Equal(t, "createUser", lookup(t, document, "paths", "/Users", "post", "operationId"))
+				assert.Equal(t, "#/components/schemas/User",
+					lookup(t, document, "paths", "/Users", "post", "requestBody", "content", spec.ApplicationScimJson, "schema", "$ref"))
+				assert.Equal(t, "#/components/responses/Error", lookup(t, document, "paths", "/Users/{id}", "delete", "responses", "default", "$ref"))
+				assert.Contains(t, lookup(t, document, "paths", "/Users/{id}", "get", "responses"), "304")
+				assert.NotContains(t, document, "security")
+			},
+		},
+		{
+			name: "resource schemas",
+			options: func() Options {
+				return Options{ResourceTypes: s.resourceTypes, ServiceProviderConfig: s.config}
+			},
+			expect: func(t *testing.T, document map[string]interface{}) {
+				assert.Equal(t, true, lookup(t, document, "components", "schemas", "User", "properties", "id", "readOnly"))
+				assert.Equal(t, true, lookup(t, document, "components", "schemas", "User", "properties", "password", "writeOnly"))
+				assert.Equal(t, "array", lookup(t, document, "components", "schemas", "User", "properties", "emails", "type"))
+				assert.Equal(t, "object", lookup(t, document, "components", "schemas", "User", "properties", "emails", "items", "type"))
+				assert.Equal(t, "date-time", lookup(t, document, "components", "schemas", "User", "properties", "meta", "properties", "created", "format"))
+				assert.Contains(t, lookup(t, document, "components", "schemas", "User", "required"), "userName")
+				assert.NotContains(t, lookup(t, document, "components", "schemas", "User", "required"), "id")
+				assert.Equal(t, "#/components/schemas/EnterpriseUser", lookup(t, document, "components", "schemas", "User", "properties",
+					"urn:ietf:params:scim:schemas:extension:enterprise:2.0:User", "$ref"))
+				assert.Equal(t, "string", lookup(t, document, "components", "schemas", "EnterpriseUser", "properties", "employeeNumber", "type"))
+				assert.Equal(t, "#/components/schemas/Group", lookup(t, document, "components", "schemas", "GroupListResponse", "properties", "Resources", "items", "$ref"))
+				assert.Contains(t, lookup(t, document, "components", "schemas"), "Error")
+				assert.Contains(t, lookup(t, document, "components", "schemas"), "PatchOp")
+			},
+		},
+		{
+			name: "all operations and security schemes",
+			options: func() Options {
+				config := *s.config
+				config.Patch.Supported = false
+				config.Bulk.Supported = true
+				config.AuthSchemes = append(config.AuthSchemes, struct {
+					Type        string `json:"type"`
+					Name        string `json:"name"`
+					Description string `json:"description"`
+					SpecURI     string `json:"specUri"`
+					DocURI      string `json:"documentationUri"`
+				}{Type: "oauthbearertoken", Name: "OAuth Bearer Token"})
+				return Options{Title: "Acme", ResourceTypes: s.resourceTypes, ServiceProviderConfig: &config}
+			},
+			expect: func(t *testing.T, document map[string]interface{}) {
+				assert.Equal(t, "Acme", lookup(t, document, "info", "title"))
+				assert.Contains(t, document["paths"], "/Bulk")
+				assert.NotContains(t, lookup(t, document, "paths", "/Users/{id}"), "patch")
+				assert.Equal(t, "bearer", lookup(t, document, "components", "securitySchemes", "oauthbearertoken", "scheme"))
+				assert.Len(t, document["security"], 1)
+			},
+		},
+	}
+
+	for _, test := range tests {
+		s.T().Run(test.name, func(t *testing.T) {
+			// round trip through JSON, as the document is served
+			raw, err := json.Marshal(Generate(test.options()))
+			require.Nil(t, err)
+			var document map[string]interface{}
+			require.Nil(t, json.Unmarshal(raw, &document))
+			test.expect(t, document)
+		})
+	}
+}
+
+func (s *OpenAPITestSuite) TestHandler() {
+	handler := Handler(Options{ResourceTypes: s.resourceTypes, ServiceProviderConfig: s.config})
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/openapi.json", nil))
+	assert.Equal(s.T(), http.StatusOK, rr.Code)
+	assert.Equal(s.T(), "application/json", rr.Header().Get("Content-Type"))
+	assert.Contains(s.T(), rr.Body.String(), `"openapi":"3.0.3"`)
+
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/openapi.json", nil))
+	assert.Equal(s.T(), http.StatusMethodNotAllowed, rr.Code)
+}
+
+// Returns the value at the keys of the JSON document.
+func lookup(t *testing.T, document map[string]interface{}, keys ...string) interface{} {
+	var value interface{} = document
+	for _, key := range keys {
+		object, ok := value.(map[string]interface{})
+		require.True(t, ok, "no object at '%s'", key)
+		value, ok = object[key]
+		require.True(t, ok, "no value at '%s'", key)
+	}
+	return value
+}
@@ -0,0 +1,140 @@
+package openapi
+
+import (
+	"github.com/imulab/go-scim/pkg/v2/spec"
+	"regexp"
+)
+
+// Returns the JSON schema of the resources of the resource type: the core attributes, those of the main schema, and
+// the schema extensions as properties keyed by their ids, each a reference to the component of the extension.
+func resourceSchema(resourceType *spec.ResourceType) map[string]interface{} {
+	var attributes []*spec.Attribute
+	collect := func(attr *spec.Attribute) error {
+		attributes = append(attributes, attr)
+		return nil
+	}
+	if core, ok := spec.Schemas().Get(spec.CoreSchemaId); ok {
+		_ = core.ForEachAttribute(collect)
+	}
+	_ = resourceType.Schema().ForEachAttribute(collect)
+
+	schema := objectSchema(resourceType.Description(), attributes)
+	properties := schema["properties"].(map[string]interface{})
+	_ = resourceType.ForEachExtension(func(extension *spec.Schema, required bool) error {
+		properties[extension.ID()] = ref("schemas", extensionName(extension))
+		if required {
+			schema["required"] = append(requiredOf(schema), extension.ID())
+		}
+		return nil
+	})
+	return schema
+}
+
+// Returns the JSON schema of the attributes of the schema extension.
+func extensionSchema(extension *spec.Schema) map[string]interface{} {
+	var attributes []*spec.Attribute
+	_ = extension.ForEachAttribute(func(attr *spec.Attribute) error {
+		attributes = append(attributes, attr)
+		return nil
+	})
+	return objectSchema(extension.Description(), attributes)
+}
+
+// Returns the JSON schema of an object of the attributes. Required attributes which are read only are not required,
+// as they are assigned by the service provider.
+func objectSchema(description string, attributes []*spec.Attribute) map[string]interface{} {
+	properties := map[string]interface{}{}
+	var required []string
+	for _, attr := range attributes {
+		properties[attr.Name()] = attributeSchema(attr)
+		if attr.Required() && attr.Mutability() != spec.MutabilityReadOnly {
+			required = append(required, attr.Name())
+		}
+	}
+
+	schema := map[string]interface{}{
+		"type":       "object",
+		"properties": properties,
+	}
+	if len(description) > 0 {
+		schema["description"] = description
+	}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return schema
+}
+
+func requiredOf(schema map[string]interface{}) []string {
+	required, _ := schema["required"].([]string)
+	return required
+}
+
+// Returns the JSON schema of the attribute. Multi valued attributes are arrays of the schema of their elements.
+// Read only attributes are marked readOnly, and write only attributes, or those never returned, writeOnly, so that a
+// single schema describes both the requests and the responses.
+func attributeSchema(attr *spec.Attribute) map[string]interface{} {
+	schema := elementSchema(attr)
+	if attr.MultiValued() {
+		schema = map[string]interface{}{
+			"type":  "array",
+			"items": schema,
+		}
+	}
+
+	if len(attr.Description()) > 0 {
+		schema["description"] = attr.Description()
+	}
+	switch {
+	case attr.Mutability() == spec.MutabilityReadOnly:
+		schema["readOnly"] = true
+	case attr.Mutability() == spec.MutabilityWriteOnly, attr.Returned() == spec.ReturnedNever:
+		schema["writeOnly"] = true
+	}
+	return schema
+}
+
+// Returns the JSON schema of a single value of the attribute.
+func elementSchema(attr *spec.Attribute) map[string]interface{} {
+	switch attr.Type() {
+	case spec.TypeInteger:
+		return map[string]interface{}{"type": "integer"}
+	case spec.TypeDecimal:
+		return map[string]interface{}{"type": "number"}
+	case spec.TypeBoolean:
+		return map[string]interface{}{"type": "boolean"}
+	case spec.TypeDateTime:
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	case spec.TypeReference:
+		return map[string]interface{}{"type": "string", "format": "uri"}
+	case spec.TypeBinary:
+		return map[string]interface{}{"type": "string", "format": "byte"}
+	case spec.TypeComplex:
+		var subAttributes []*spec.Attribute
+		_ = attr.ForEachSubAttribute(func(subAttr *spec.Attribute) error {
+			subAttributes = append(subAttributes, subAttr)
+			return nil
+		})
+		return objectSchema("", subAttributes)
+	default:
+		return map[string]interface{}{"type": "string"}
+	}
+}
+
+var invalidComponentChars = regexp.MustCompile(`[^a-zA-Z0-9._-]+`)
+
+// Returns the name as the name of a component, which may only contain letters, digits, dots, dashes and underscores,
+// i.e. "EnterpriseUser" of "Enterprise User".
+func componentName(name string) string {
+	return invalidComponentChars.ReplaceAllString(name, "")
+}
+
+// Returns the name of the component of the schema extension, that of its name, or its id if it has none.
+func extensionName(extension *spec.Schema) string {
+	return componentName(or(extension.Name(), extension.ID()))
+}
+
+// Returns the reference to the component of the kind, i.e. "schemas".
+func ref(kind string, name string) map[string]interface{} {
+	return map[string]interface{}{"$ref": "#/components/" + kind + "/" + name}
+}
@@ -86,7 +86,7 @@ func (p *dateTimeProperty) Clone() Property {
 		subscribers: p.subscribers,
 	}
 	if p.value != nil {
-		v, _ := time.Parse(spec.ISO8601, p.Raw().(string))
+		v := *(p.value)
 		c.value = &v
 	}
 	return c
@@ -168,7 +168,7 @@ func (p *dateTimeProperty) mustToISO8601() string {
 }
 
 func (p *dateTimeProperty) fromISO8601(value string) (time.Time, error) {
-	t, err := time.Parse(spec.ISO8601, value)
+	t, err := spec.ParseDateTime(value)
 	if err != nil {
 		return time.Time{}, fmt.Errorf("%w, value for '%s' does not conform to ISO8601", spec.ErrInvalidValue, p.attr.Path())
 	}
@@ -210,13 +210,16 @@ func (p *dateTimeProperty) compareThisAndValue(value interface{}, comparator fun
 		return false
 	}
 
-	s, ok := value.(string)
-	if !ok {
-		return false
-	}
-
-	t, err := p.fromISO8601(s)
-	if err != nil {
+	var t time.Time
+	switch v := value.(type) {
+	case time.Time:
+		t = v
+	case string:
+		var err error
+		if t, err = p.fromISO8601(v); err != nil {
+			return false
+		}
+	default:
 		return false
 	}
 
@@ -352,6 +352,15 @@ func (s *DateTimePropertyTestSuite) TestReplace() {
 				assert.Equal(t, "2020-01-17T07:30:00", raw)
 			},
 		},
+		{
+			name:  "replace with offset normalizes to UTC",
+			prop:  NewDateTime(s.standardAttr),
+			value: "2020-01-16T09:30:00+02:00",
+			expect: func(t *testing.T, raw interface{}, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, "2020-01-16T07:30:00", raw)
+			},
+		},
 		{
 			name:  "replace incompatible value",
 			prop:  NewDateTime(s.standardAttr),
@@ -0,0 +1,43 @@
+package prop
+
+import "github.com/imulab/go-scim/pkg/v2/spec"
+
+// Document returns the JSON value of the property, or nil if it is unassigned, i.e. to be stored by databases as a
+// document, or encoded in other formats. Unassigned sub properties and elements are left out.
+func Document(property Property) interface{} {
+	return DocumentFunc(property, nil)
+}
+
+// DocumentFunc returns the JSON value of the property like Document, except that the sub properties whose attributes
+// are not included are left out as well, i.e. those never returned. A nil include includes all attributes.
+func DocumentFunc(property Property, include func(attr *spec.Attribute) bool) interface{} {
+	if property.IsUnassigned() {
+		return nil
+	}
+
+	switch {
+	case property.Attribute().MultiValued():
+		elements := make([]interface{}, 0, property.CountChildren())
+		_ = property.ForEachChild(func(_ int, child Property) error {
+			if value := DocumentFunc(child, include); value != nil {
+				elements = append(elements, value)
+			}
+			return nil
+		})
+		return elements
+	case property.Attribute().Type() == spec.TypeComplex:
+		values := make(map[string]interface{})
+		_ = property.ForEachChild(func(_ int, child Property) error {
+			if include != nil && !include(child.Attribute()) {
+				return nil
+			}
+			if value := DocumentFunc(child, include); value != nil {
+				values[child.Attribute().Name()] = value
+			}
+			return nil
+		})
+		return values
+	default:
+		return property.Raw()
+	}
+}
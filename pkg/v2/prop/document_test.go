@@ -0,0 +1,91 @@
+package prop
+
+import (
+	"encoding/json"
+	"github.com/imulab/go-scim/pkg/v2/spec"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestDocument(t *testing.T) {
+	attr := new(spec.Attribute)
+	require.Nil(t, json.Unmarshal([]byte(`
+{
+  "id": "urn:ietf:params:scim:schemas:core:2.0:User:root",
+  "name": "root",
+  "type": "complex",
+  "_path": "root",
+  "subAttributes": [
+    {
+      "id": "urn:ietf:params:scim:schemas:core:2.0:User:userName",
+      "name": "userName",
+      "type": "string",
+      "_path": "userName",
+      "_index": 0
+    },
+    {
+      "id": "urn:ietf:params:scim:schemas:core:2.0:User:password",
+      "name": "password",
+      "type": "string",
+      "returned": "never",
+      "_path": "password",
+      "_index": 1
+    },
+    {
+      "id": "urn:ietf:params:scim:schemas:core:2.0:User:nickName",
+      "name": "nickName",
+      "type": "string",
+      "_path": "nickName",
+      "_index": 2
+    },
+    {
+      "id": "urn:ietf:params:scim:schemas:core:2.0:User:emails",
+      "name": "emails",
+      "type": "complex",
+      "multiValued": true,
+      "_path": "emails",
+      "_index": 3,
+      "subAttributes": [
+        {
+          "id": "urn:ietf:params:scim:schemas:core:2.0:User:emails.value",
+          "name": "value",
+          "type": "string",
+          "_path": "emails.value",
+          "_index": 0
+        },
+        {
+          "id": "urn:ietf:params:scim:schemas:core:2.0:User:emails.type",
+          "name": "type",
+          "type": "string",
+          "_path": "emails.type",
+          "_index": 1
+        }
+      ]
+    }
+  ]
+}`), attr))
+
+	p := NewComplexOf(attr, map[string]interface{}{
+		"userName": "foo",
+		"password": "s3cret",
+		"emails": []interface{}{
+			map[string]interface{}{"value": "foo@example.com"},
+		},
+	})
+
+	assert.Equal(t, map[string]interface{}{
+		"userName": "foo",
+		"password": "s3cret",
+		"emails":   []interface{}{map[string]interface{}{"value": "foo@example.com"}},
+	}, Document(p))
+
+	assert.Equal(t, map[string]interface{}{
+		"userName": "foo",
+		"emails":   []interface{}{map[string]interface{}{"value": "foo@example.com"}},
+	}, DocumentFunc(p, func(attr *spec.Attribute) bool {
+		return attr.Returned() != spec.ReturnedNever
+	}))
+
+	assert.Nil(t, Document(NewComplex(attr)))
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"github.com/imulab/go-scim/pkg/v2/spec"
 	"hash/fnv"
+	"sort"
 )
 
 // NewMulti creates a new multiValued property associated with attribute. All sub attributes are created.
@@ -76,25 +77,18 @@ func (p *multiValuedProperty) Hash() uint64 {
 		return 0
 	}
 
-	var hashes []uint64
+	// SCIM array does not have orders. We keep the hash array sorted so that different multiValue properties
+	// containing the same elements in different orders can be recognized as the same, as they compute the same hash.
+	hashes := make([]uint64, 0, len(p.elements))
 	_ = p.ForEachChild(func(index int, child Property) error {
-		if child.IsUnassigned() {
-			return nil
-		}
-
-		// SCIM array does not have orders. We keep the hash array
-		// sorted so that different multiValue properties containing
-		// the same elements in different orders can be recognized as
-		// the same, as they compute the same hash. We use insertion
-		// sort here as we don't expect a large number of elements.
-		hashes = append(hashes, child.Hash())
-		for i := len(hashes) - 1; i > 0; i-- {
-			if hashes[i-1] > hashes[i] {
-				hashes[i-1], hashes[i] = hashes[i], hashes[i-1]
-			}
+		if !child.IsUnassigned() {
+			hashes = append(hashes, child.Hash())
 		}
 		return nil
 	})
+	sort.Slice(hashes, func(i, j int) bool {
+		return hashes[i] < hashes[j]
+	})
 
 	h := fnv.New64a()
 	for _, hash := range hashes {
@@ -168,16 +162,17 @@ func (p *multiValuedProperty) Add(value interface{}) (*Event, error) {
 		return nil, nil
 	}
 
-	// Add each candidate only if they do not match existing elements
+	// Add each candidate only if they do not match existing elements. Elements of the same attribute match when their
+	// hashes are equal, hence the hashes are computed once, instead of comparing every candidate to every element,
+	// which is prohibitive for attributes with thousands of elements, i.e. members of groups.
+	hashes := make(map[uint64]struct{}, len(p.elements)+len(toAdd))
+	for _, elem := range p.elements {
+		hashes[elem.Hash()] = struct{}{}
+	}
 	for _, eachToAdd := range toAdd {
-		match := false
-		for _, elem := range p.elements {
-			if elem.Matches(eachToAdd) {
-				match = true
-				break
-			}
-		}
-		if !match {
+		hash := eachToAdd.Hash()
+		if _, match := hashes[hash]; !match {
+			hashes[hash] = struct{}{}
 			p.elements = append(p.elements, eachToAdd)
 			p.dirty = true
 		}
@@ -315,18 +310,18 @@ func (p *multiValuedProperty) Compact() {
 		return
 	}
 
-	var i int
-	for i = len(p.elements) - 1; i >= 0; i-- {
-		if p.elements[i].IsUnassigned() {
-			if i == len(p.elements)-1 {
-				p.elements = p.elements[:i]
-			} else if i == 0 {
-				p.elements = p.elements[i+1:]
-			} else {
-				p.elements = append(p.elements[:i], p.elements[i+1:]...)
-			}
+	// Keep the assigned elements in place, in a single pass.
+	n := 0
+	for _, elem := range p.elements {
+		if !elem.IsUnassigned() {
+			p.elements[n] = elem
+			n++
 		}
 	}
+	for i := n; i < len(p.elements); i++ {
+		p.elements[i] = nil
+	}
+	p.elements = p.elements[:n]
 }
 
 var (
@@ -1,6 +1,11 @@
 package prop
 
-import "github.com/imulab/go-scim/pkg/v2/spec"
+import (
+	"encoding/binary"
+	"fmt"
+	"github.com/imulab/go-scim/pkg/v2/spec"
+	"hash/fnv"
+)
 
 // NewResource creates a resource prototype of the attributes defined in the resource type, along with the core SCIM attributes.
 func NewResource(resourceType *spec.ResourceType) *Resource {
@@ -37,6 +42,40 @@ func (r *Resource) Hash() uint64 {
 	return r.data.Hash()
 }
 
+// ContentHash returns the hash of this resource excluding the core meta attribute. Unlike Hash, the content hash does
+// not change when only meta attributes (i.e. meta.lastModified, meta.version) change, which makes it suitable to derive
+// a version from the resource content.
+func (r *Resource) ContentHash() uint64 {
+	h := fnv.New64a()
+	if err := r.data.ForEachChild(func(_ int, child Property) error {
+		if child.Attribute().ID() == "meta" {
+			return nil
+		}
+
+		if _, err := h.Write([]byte(child.Attribute().Name())); err != nil {
+			return err
+		}
+
+		if child.IsUnassigned() {
+			return nil
+		}
+
+		b := make([]byte, 8)
+		binary.LittleEndian.PutUint64(b, child.Hash())
+		_, err := h.Write(b)
+		return err
+	}); err != nil {
+		panic("error computing content hash")
+	}
+	return h.Sum64()
+}
+
+// ContentVersion returns a weak ETag derived from ContentHash, which can be used as meta.version. Resources with the
+// same content always have the same content version.
+func (r *Resource) ContentVersion() string {
+	return fmt.Sprintf("W/\"%x\"", r.ContentHash())
+}
+
 // Return a clone of this resource. The clone will contain properties that share the same instance of attribute and
 // subscribers with the original property before the clone, but retain separate instance of values.
 func (r *Resource) Clone() *Resource {
@@ -102,6 +141,29 @@ func (r *Resource) MetaLocationOrEmpty() string {
 	}
 }
 
+// MetaDeletedOrEmpty returns meta.deleted value of the resource, which is the time the resource was soft deleted. If in
+// any case, the meta.deleted value is not available (i.e. unassigned, not defined in the core schema), empty string is
+// returned.
+func (r *Resource) MetaDeletedOrEmpty() string {
+	meta, err := r.data.ChildAtIndex("meta")
+	if err != nil {
+		return ""
+	}
+
+	deleted, err := meta.ChildAtIndex("deleted")
+	if err != nil {
+		return ""
+	}
+
+	if deleted.IsUnassigned() {
+		return ""
+	} else if s, ok := deleted.Raw().(string); !ok {
+		return ""
+	} else {
+		return s
+	}
+}
+
 // MetaVersionOrEmpty returns meta.version value of the resource, defined in the core schema. If in any case, the
 // meta.version value is not available (i.e. unassigned, wrong type), empty string is returned.
 func (r *Resource) MetaVersionOrEmpty() string {
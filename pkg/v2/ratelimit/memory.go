@@ -0,0 +1,73 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// Buckets of the memory store are swept for those refilled at most once this often.
+const sweepInterval = time.Minute
+
+// Memory returns a Store keeping the buckets in process, which limits the requests to each instance of the server on
+// its own. Buckets which are full again are discarded, so that only those of the keys seen recently are held.
+func Memory() Store {
+	return &memoryStore{buckets: map[string]*bucket{}, now: time.Now}
+}
+
+type memoryStore struct {
+	sync.Mutex
+	buckets map[string]*bucket
+	swept   time.Time
+	now     func() time.Time
+}
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+	full    time.Time
+}
+
+func (s *memoryStore) Take(_ context.Context, key string, limit Limit) (time.Duration, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	now := s.now()
+	s.sweep(now)
+
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(limit.Burst), updated: now}
+		s.buckets[key] = b
+	}
+
+	b.tokens = math.Min(float64(limit.Burst), b.tokens+now.Sub(b.updated).Seconds()*limit.Rate)
+	b.updated = now
+
+	var wait time.Duration
+	if b.tokens >= 1 {
+		b.tokens--
+	} else {
+		wait = time.Duration(math.Ceil((1 - b.tokens) / limit.Rate * float64(time.Second)))
+	}
+	b.full = now.Add(time.Duration((float64(limit.Burst) - b.tokens) / limit.Rate * float64(time.Second)))
+	return wait, nil
+}
+
+// Discards the buckets which are full at the time, once every sweepInterval.
+func (s *memoryStore) sweep(now time.Time) {
+	if now.Sub(s.swept) < sweepInterval {
+		return
+	}
+	s.swept = now
+	for key, b := range s.buckets {
+		if !b.full.After(now) {
+			delete(s.buckets, key)
+		}
+	}
+}
+
+var (
+	_ Store = (*memoryStore)(nil)
+)
@@ -0,0 +1,51 @@
+package ratelimit
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestMemory(t *testing.T) {
+	now := time.Now()
+	store := Memory().(*memoryStore)
+	store.now = func() time.Time { return now }
+
+	ctx := context.Background()
+	limit := Limit{Rate: 2, Burst: 3}
+	take := func(key string) time.Duration {
+		wait, err := store.Take(ctx, key, limit)
+		require.Nil(t, err)
+		return wait
+	}
+
+	// the bucket is full at first
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, time.Duration(0), take("foo"))
+	}
+	assert.Equal(t, 500*time.Millisecond, take("foo"))
+	assert.Equal(t, time.Duration(0), take("bar"))
+
+	// refilled with one token after half a second
+	now = now.Add(250 * time.Millisecond)
+	assert.Equal(t, 250*time.Millisecond, take("foo"))
+	now = now.Add(250 * time.Millisecond)
+	assert.Equal(t, time.Duration(0), take("foo"))
+	assert.Equal(t, 500*time.Millisecond, take("foo"))
+
+	// refilled up to the burst only
+	now = now.Add(time.Hour)
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, time.Duration(0), take("foo"))
+	}
+	assert.NotEqual(t, time.Duration(0), take("foo"))
+
+	// full buckets are discarded
+	assert.Len(t, store.buckets, 1)
+	now = now.Add(2 * sweepInterval)
+	assert.Equal(t, time.Duration(0), take("baz"))
+	assert.Len(t, store.buckets, 1)
+	assert.Contains(t, store.buckets, "baz")
+}
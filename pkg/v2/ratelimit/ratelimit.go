@@ -0,0 +1,155 @@
+// This package limits the rate of requests callers may send, so that a misbehaving client, i.e. the reconciliation of
+// an identity provider stuck in a loop, cannot take down the directory for everyone else. The requests of each key, by
+// default the client of each tenant, take tokens from a bucket which refills at a steady rate; requests finding it
+// empty are answered with status 429 and a Retry-After header, which well-behaved clients wait for.
+//
+// The buckets are kept in a Store. Memory keeps them in process, which limits each instance of the server on its own;
+// the redis module provides one shared by all instances.
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"github.com/imulab/go-scim/pkg/v2/handlerutil"
+	"github.com/imulab/go-scim/pkg/v2/oauth"
+	"github.com/imulab/go-scim/pkg/v2/spec"
+	"github.com/imulab/go-scim/pkg/v2/tenant"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Limit is the rate of a token bucket: the bucket holds at most Burst tokens, is refilled with Rate tokens per second,
+// and every request takes one. A key may hence send Burst requests at once, and Rate requests per second on average.
+type Limit struct {
+	// Rate is the number of tokens added to the bucket per second, i.e. 0.5 for one request every two seconds. Keys
+	// whose rate is not positive are not limited.
+	Rate float64
+	// Burst is the capacity of the bucket. Defaults to Rate, rounded up, or 1, whichever is larger.
+	Burst int
+}
+
+func (l Limit) withDefaults() Limit {
+	if l.Burst <= 0 {
+		l.Burst = int(math.Ceil(l.Rate))
+		if l.Burst < 1 {
+			l.Burst = 1
+		}
+	}
+	return l
+}
+
+// Store keeps the token buckets of the keys. Buckets not seen before are full.
+type Store interface {
+	// Take takes a token from the bucket of the key, which follows the limit, and returns zero if there was one.
+	// Otherwise, the bucket is left empty, and the time until it holds a token again is returned.
+	Take(ctx context.Context, key string, limit Limit) (time.Duration, error)
+}
+
+// Options configures Middleware.
+type Options struct {
+	// Limit is the limit of every key, unless LimitOf is set.
+	Limit Limit
+	// LimitOf, if not nil, returns the limit of the key of the request instead, i.e. one following the plan of the
+	// tenant, or a Limit without rate to exempt the key.
+	LimitOf func(r *http.Request, key string) Limit
+	// Key returns the key whose bucket the request takes a token from. Requests without key are not limited. Defaults
+	// to ByClient.
+	Key func(r *http.Request) string
+	// Store keeps the buckets. Defaults to Memory.
+	Store Store
+	// OnError, if not nil, is called with the errors of the store, i.e. to log them. The requests are let through
+	// nevertheless, as an unavailable store shall not take down the directory either.
+	OnError func(r *http.Request, err error)
+}
+
+// Middleware returns a http.Handler which takes a token from the bucket of the key of every request before calling the
+// next handler. Requests finding the bucket empty are answered with an error of spec.ErrTooManyRequests (429), and the
+// Retry-After header in seconds, right away.
+//
+// To limit each client by the subject of its principal, call it within oauth.Middleware, and within the handler placing
+// the tenant in the request context, if any. As callers failing authentication are not limited then, another
+// Middleware keyed by ByAddress may be called around oauth.Middleware as well.
+func Middleware(options Options, next http.Handler) http.Handler {
+	m := &middleware{options: options, next: next}
+	if m.options.Key == nil {
+		m.options.Key = ByClient
+	}
+	if m.options.Store == nil {
+		m.options.Store = Memory()
+	}
+	return m
+}
+
+type middleware struct {
+	options Options
+	next    http.Handler
+}
+
+func (m *middleware) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	key := m.options.Key(r)
+	if len(key) == 0 {
+		m.next.ServeHTTP(rw, r)
+		return
+	}
+
+	limit := m.options.Limit
+	if m.options.LimitOf != nil {
+		limit = m.options.LimitOf(r, key)
+	}
+	if limit.Rate <= 0 {
+		m.next.ServeHTTP(rw, r)
+		return
+	}
+
+	wait, err := m.options.Store.Take(r.Context(), key, limit.withDefaults())
+	if err != nil {
+		if m.options.OnError != nil {
+			m.options.OnError(r, err)
+		}
+		m.next.ServeHTTP(rw, r)
+		return
+	}
+	if wait > 0 {
+		seconds := int(math.Ceil(wait.Seconds()))
+		rw.Header().Set("Retry-After", strconv.Itoa(seconds))
+		_ = handlerutil.WriteError(rw, fmt.Errorf("%w: rate limit of %g requests per second is exceeded, retry after %d seconds",
+			spec.ErrTooManyRequests, limit.Rate, seconds))
+		return
+	}
+
+	m.next.ServeHTTP(rw, r)
+}
+
+// ByClient keys the requests by the subject of the principal in their context (see oauth.From), or by the address of
+// the caller when there is none (see ByAddress), within the tenant of the context, if any. Each client of each tenant
+// hence has its own bucket.
+func ByClient(r *http.Request) string {
+	key := ByAddress(r)
+	if principal := oauth.From(r.Context()); principal != nil && len(principal.Subject) > 0 {
+		key = "sub:" + principal.Subject
+	}
+	return tenant.Scope(r.Context(), key)
+}
+
+// ByTenant keys the requests by the tenant of their context (see tenant.From), so that all the clients of a tenant
+// share its bucket. Requests without tenant are not limited.
+func ByTenant(r *http.Request) string {
+	return tenant.From(r.Context())
+}
+
+// ByAddress keys the requests by the IP address of the caller. Behind a proxy, this is the address of the proxy, unless
+// the RemoteAddr of the requests is set to that of the caller, i.e. by a middleware trusting X-Forwarded-For.
+func ByAddress(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "ip:" + host
+}
+
+var (
+	_ http.Handler = (*middleware)(nil)
+)
@@ -0,0 +1,170 @@
+package ratelimit
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/imulab/go-scim/pkg/v2/oauth"
+	"github.com/imulab/go-scim/pkg/v2/spec"
+	"github.com/imulab/go-scim/pkg/v2/tenant"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestMiddleware(t *testing.T) {
+	next := http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		rw.WriteHeader(http.StatusOK)
+	})
+	request := func(subject string, tenantID string) *http.Request {
+		r := httptest.NewRequest(http.MethodGet, "/Users", nil)
+		ctx := r.Context()
+		if len(subject) > 0 {
+			ctx = oauth.With(ctx, &oauth.Principal{Subject: subject})
+		}
+		if len(tenantID) > 0 {
+			ctx = tenant.With(ctx, tenantID)
+		}
+		return r.WithContext(ctx)
+	}
+	var reported error
+
+	tests := []struct {
+		name     string
+		options  Options
+		requests []*http.Request
+		expect   func(t *testing.T, responses []*httptest.ResponseRecorder)
+	}{
+		{
+			name:     "requests within burst",
+			options:  Options{Limit: Limit{Rate: 0.1, Burst: 2}},
+			requests: []*http.Request{request("foo", ""), request("foo", "")},
+			expect: func(t *testing.T, responses []*httptest.ResponseRecorder) {
+				for _, rr := range responses {
+					assert.Equal(t, http.StatusOK, rr.Code)
+				}
+			},
+		},
+		{
+			name:     "requests beyond burst",
+			options:  Options{Limit: Limit{Rate: 0.1, Burst: 1}},
+			requests: []*http.Request{request("foo", ""), request("foo", "")},
+			expect: func(t *testing.T, responses []*httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusOK, responses[0].Code)
+
+				rr := responses[1]
+				assert.Equal(t, http.StatusTooManyRequests, rr.Code)
+				assert.Equal(t, "10", rr.Header().Get("Retry-After"))
+				assert.Equal(t, spec.ApplicationScimJson, rr.Header().Get("Content-Type"))
+
+				var payload map[string]interface{}
+				require.Nil(t, json.Unmarshal(rr.Body.Bytes(), &payload))
+				assert.Equal(t, float64(http.StatusTooManyRequests), payload["status"])
+				assert.Equal(t, spec.ErrTooManyRequests.Type, payload["scimType"])
+				assert.Contains(t, payload["detail"], "retry after 10 seconds")
+			},
+		},
+		{
+			name:    "clients are limited apart",
+			options: Options{Limit: Limit{Rate: 0.1, Burst: 1}},
+			requests: []*http.Request{
+				request("foo", ""),
+				request("bar", ""),
+				request("foo", "acme"),
+				request("", ""),
+				request("foo", ""),
+			},
+			expect: func(t *testing.T, responses []*httptest.ResponseRecorder) {
+				for _, rr := range responses[:4] {
+					assert.Equal(t, http.StatusOK, rr.Code)
+				}
+				assert.Equal(t, http.StatusTooManyRequests, responses[4].Code)
+			},
+		},
+		{
+			name:     "clients of tenant share its bucket",
+			options:  Options{Limit: Limit{Rate: 0.1, Burst: 1}, Key: ByTenant},
+			requests: []*http.Request{request("foo", "acme"), request("bar", "acme"), request("foo", "")},
+			expect: func(t *testing.T, responses []*httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusOK, responses[0].Code)
+				assert.Equal(t, http.StatusTooManyRequests, responses[1].Code)
+				assert.Equal(t, http.StatusOK, responses[2].Code, "requests without tenant are not limited")
+			},
+		},
+		{
+			name: "limit of tenant",
+			options: Options{
+				LimitOf: func(r *http.Request, key string) Limit {
+					if tenant.From(r.Context()) == "acme" {
+						return Limit{}
+					}
+					return Limit{Rate: 0.1}
+				},
+			},
+			requests: []*http.Request{
+				request("foo", "acme"),
+				request("foo", "acme"),
+				request("foo", "other"),
+				request("foo", "other"),
+			},
+			expect: func(t *testing.T, responses []*httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusOK, responses[0].Code)
+				assert.Equal(t, http.StatusOK, responses[1].Code)
+				assert.Equal(t, http.StatusOK, responses[2].Code)
+				assert.Equal(t, http.StatusTooManyRequests, responses[3].Code)
+			},
+		},
+		{
+			name: "store failure lets requests through",
+			options: Options{
+				Limit: Limit{Rate: 0.1},
+				Store: storeFunc(func(ctx context.Context, key string, limit Limit) (time.Duration, error) {
+					return 0, fmt.Errorf("%w: store is unavailable", spec.ErrInternal)
+				}),
+				OnError: func(r *http.Request, err error) {
+					reported = err
+				},
+			},
+			requests: []*http.Request{request("foo", "")},
+			expect: func(t *testing.T, responses []*httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusOK, responses[0].Code)
+				assert.True(t, errors.Is(reported, spec.ErrInternal))
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			handler := Middleware(test.options, next)
+			var responses []*httptest.ResponseRecorder
+			for _, r := range test.requests {
+				rr := httptest.NewRecorder()
+				handler.ServeHTTP(rr, r)
+				responses = append(responses, rr)
+			}
+			test.expect(t, responses)
+		})
+	}
+}
+
+func TestKey(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/Users", nil)
+	r.RemoteAddr = "192.0.2.1:1234"
+	assert.Equal(t, "ip:192.0.2.1", ByAddress(r))
+	assert.Equal(t, "ip:192.0.2.1", ByClient(r))
+	assert.Empty(t, ByTenant(r))
+
+	r = r.WithContext(tenant.With(oauth.With(r.Context(), &oauth.Principal{Subject: "idp"}), "acme"))
+	assert.Equal(t, "acme/sub:idp", ByClient(r))
+	assert.Equal(t, "acme", ByTenant(r))
+}
+
+type storeFunc func(ctx context.Context, key string, limit Limit) (time.Duration, error)
+
+func (f storeFunc) Take(ctx context.Context, key string, limit Limit) (time.Duration, error) {
+	return f(ctx, key, limit)
+}
@@ -0,0 +1,292 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/imulab/go-scim/pkg/v2/db"
+	"github.com/imulab/go-scim/pkg/v2/prop"
+	"github.com/imulab/go-scim/pkg/v2/spec"
+	"github.com/satori/go.uuid"
+	"io"
+	"time"
+)
+
+// OperationSchema is the schema of the rendered status of asynchronous operations.
+const OperationSchema = "urn:imulab:scim:api:messages:2.0:Operation"
+
+// Job is a unit of work executed by a Queue.
+type Job func(ctx context.Context)
+
+// Queue executes jobs in the background. Enqueue shall not block until the job is executed, and shall return an error
+// if the job cannot be accepted.
+type Queue interface {
+	Enqueue(ctx context.Context, job Job) error
+}
+
+// WorkerQueue returns a Queue that executes jobs on the given number of goroutines, buffering up to capacity jobs
+// that are not yet executed. Enqueue returns an error of spec.ErrInternal when the buffer is full. The queue is in
+// memory, hence jobs not executed when the process exits are lost.
+func WorkerQueue(workers int, capacity int) Queue {
+	q := &workerQueue{jobs: make(chan queuedJob, capacity)}
+	for i := 0; i < workers; i++ {
+		go q.work()
+	}
+	return q
+}
+
+type queuedJob struct {
+	ctx context.Context
+	job Job
+}
+
+type workerQueue struct {
+	jobs chan queuedJob
+}
+
+func (q *workerQueue) Enqueue(ctx context.Context, job Job) error {
+	select {
+	case q.jobs <- queuedJob{ctx: ctx, job: job}:
+		return nil
+	default:
+		return fmt.Errorf("%w: job queue is full", spec.ErrInternal)
+	}
+}
+
+func (q *workerQueue) work() {
+	for each := range q.jobs {
+		each.job(each.ctx)
+	}
+}
+
+// AsyncService returns a service that creates, replaces and deletes resources of the resource type asynchronously. The
+// request is accepted with an operation of status db.OperationPending, and executed by the queue with the given
+// services, while the status of the operation is kept in the operations database, so that it can be polled with
+// OperationService. The request payload is read before the request is accepted, whereas it is parsed and validated
+// only when the operation is executed.
+//
+// Operations are executed with a context that carries the values of the request context, but which is never canceled,
+// since the request has been responded to by then. Dry run requests are rejected with an error of
+// spec.ErrInvalidSyntax, as there would be nothing left to poll for; they shall be sent to the services directly.
+func AsyncService(resourceType *spec.ResourceType, create Create, replace Replace, delete Delete, operations db.OperationDB, queue Queue) Async {
+	return &asyncService{
+		resourceType: resourceType,
+		create:       create,
+		replace:      replace,
+		delete:       delete,
+		operations:   operations,
+		queue:        queue,
+	}
+}
+
+type (
+	// Async resource service
+	Async interface {
+		Create(ctx context.Context, req *CreateRequest) (resp *AsyncResponse, err error)
+		Replace(ctx context.Context, req *ReplaceRequest) (resp *AsyncResponse, err error)
+		Delete(ctx context.Context, req *DeleteRequest) (resp *AsyncResponse, err error)
+	}
+	// Async resource response
+	AsyncResponse struct {
+		Operation *db.Operation // the accepted operation, of status db.OperationPending
+	}
+)
+
+type asyncService struct {
+	resourceType *spec.ResourceType
+	create       Create
+	replace      Replace
+	delete       Delete
+	operations   db.OperationDB
+	queue        Queue
+}
+
+func (s *asyncService) Create(ctx context.Context, req *CreateRequest) (resp *AsyncResponse, err error) {
+	if s.create == nil {
+		err = fmt.Errorf("%w: create is not supported", spec.ErrInvalidSyntax)
+		return
+	}
+	if req == nil || (req.PayloadSource == nil && req.Resource == nil) {
+		err = fmt.Errorf("%w: no payload for async create", spec.ErrInternal)
+		return
+	}
+	if req.DryRun {
+		err = fmt.Errorf("%w: dry run is not supported for async create", spec.ErrInvalidSyntax)
+		return
+	}
+	if err = bufferPayload(&req.PayloadSource); err != nil {
+		return
+	}
+	return s.accept(ctx, OpCreate, "", func(ctx context.Context) (*prop.Resource, error) {
+		resp, err := s.create.Do(ctx, req)
+		if err != nil {
+			return nil, err
+		}
+		return resp.Resource, nil
+	})
+}
+
+func (s *asyncService) Replace(ctx context.Context, req *ReplaceRequest) (resp *AsyncResponse, err error) {
+	if s.replace == nil {
+		err = fmt.Errorf("%w: replace is not supported", spec.ErrInvalidSyntax)
+		return
+	}
+	if req == nil || (req.PayloadSource == nil && req.Resource == nil) {
+		err = fmt.Errorf("%w: no payload for async replace", spec.ErrInternal)
+		return
+	}
+	if req.DryRun {
+		err = fmt.Errorf("%w: dry run is not supported for async replace", spec.ErrInvalidSyntax)
+		return
+	}
+	if err = bufferPayload(&req.PayloadSource); err != nil {
+		return
+	}
+	return s.accept(ctx, OpReplace, req.ResourceID, func(ctx context.Context) (*prop.Resource, error) {
+		resp, err := s.replace.Do(ctx, req)
+		if err != nil {
+			return nil, err
+		}
+		return resp.Resource, nil
+	})
+}
+
+func (s *asyncService) Delete(ctx context.Context, req *DeleteRequest) (resp *AsyncResponse, err error) {
+	if s.delete == nil {
+		err = fmt.Errorf("%w: delete is not supported", spec.ErrInvalidSyntax)
+		return
+	}
+	if req == nil {
+		err = fmt.Errorf("%w: no request for async delete", spec.ErrInternal)
+		return
+	}
+	return s.accept(ctx, OpDelete, req.ResourceID, func(ctx context.Context) (*prop.Resource, error) {
+		if _, err := s.delete.Do(ctx, req); err != nil {
+			return nil, err
+		}
+		return nil, nil
+	})
+}
+
+// Saves a pending operation and enqueues the job that executes the call function, which returns the resulting
+// resource, if any.
+func (s *asyncService) accept(ctx context.Context, method string, resourceID string, call func(ctx context.Context) (*prop.Resource, error)) (resp *AsyncResponse, err error) {
+	now := time.Now().UTC()
+	operation := &db.Operation{
+		ID:           uuid.NewV4().String(),
+		Method:       method,
+		ResourceType: s.resourceType.ID(),
+		ResourceID:   resourceID,
+		Status:       db.OperationPending,
+		Created:      now,
+		LastModified: now,
+	}
+	if err = s.operations.Put(ctx, operation); err != nil {
+		return
+	}
+
+	accepted := *operation
+	err = s.queue.Enqueue(detached{ctx}, func(ctx context.Context) {
+		s.execute(ctx, operation, call)
+	})
+	if err != nil {
+		operation.Status = db.OperationFailed
+		operation.Err = err
+		operation.LastModified = time.Now().UTC()
+		_ = s.operations.Put(ctx, operation)
+		return
+	}
+
+	resp = &AsyncResponse{Operation: &accepted}
+	return
+}
+
+func (s *asyncService) execute(ctx context.Context, operation *db.Operation, call func(ctx context.Context) (*prop.Resource, error)) {
+	operation.Status = db.OperationRunning
+	operation.LastModified = time.Now().UTC()
+	_ = s.operations.Put(ctx, operation)
+
+	resource, err := call(ctx)
+	if err != nil {
+		operation.Status = db.OperationFailed
+		operation.Err = err
+	} else {
+		operation.Status = db.OperationSucceeded
+		if resource != nil {
+			operation.ResourceID = resource.IdOrEmpty()
+			operation.Location = resource.MetaLocationOrEmpty()
+			operation.Version = resource.MetaVersionOrEmpty()
+		}
+	}
+	operation.LastModified = time.Now().UTC()
+	_ = s.operations.Put(ctx, operation)
+}
+
+// Reads the payload source, if any, into memory, as the original source, i.e. a HTTP request body, is usually gone by the time
+// the operation is executed.
+func bufferPayload(source *io.Reader) error {
+	if *source == nil {
+		return nil
+	}
+	raw, err := readPayload(*source)
+	if err != nil {
+		return err
+	}
+	*source = bytes.NewReader(raw)
+	return nil
+}
+
+// detached is a context that carries the values of the parent context, but is never canceled and has no deadline.
+type detached struct {
+	parent context.Context
+}
+
+func (d detached) Deadline() (deadline time.Time, ok bool) {
+	return
+}
+
+func (d detached) Done() <-chan struct{} {
+	return nil
+}
+
+func (d detached) Err() error {
+	return nil
+}
+
+func (d detached) Value(key interface{}) interface{} {
+	return d.parent.Value(key)
+}
+
+// OperationService returns a service to read the status of operations accepted by AsyncService.
+func OperationService(operations db.OperationDB) OperationStatus {
+	return &operationService{operations: operations}
+}
+
+type (
+	// Operation status service
+	OperationStatus interface {
+		Do(ctx context.Context, req *OperationRequest) (resp *OperationResponse, err error)
+	}
+	// Operation status request
+	OperationRequest struct {
+		OperationID string // id of the operation
+	}
+	// Operation status response
+	OperationResponse struct {
+		Operation *db.Operation // the operation
+	}
+)
+
+type operationService struct {
+	operations db.OperationDB
+}
+
+func (s *operationService) Do(ctx context.Context, req *OperationRequest) (resp *OperationResponse, err error) {
+	operation, err := s.operations.Get(ctx, req.OperationID)
+	if err != nil {
+		return
+	}
+
+	resp = &OperationResponse{Operation: operation}
+	return
+}
@@ -0,0 +1,196 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/imulab/go-scim/pkg/v2/crud"
+	"github.com/imulab/go-scim/pkg/v2/db"
+	"github.com/imulab/go-scim/pkg/v2/service/filter"
+	"github.com/imulab/go-scim/pkg/v2/spec"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAsync(t *testing.T) {
+	s := new(AsyncTestSuite)
+	suite.Run(t, s)
+}
+
+type AsyncTestSuite struct {
+	suite.Suite
+	config       *spec.ServiceProviderConfig
+	resourceType *spec.ResourceType
+}
+
+// inlineQueue executes jobs as soon as they are enqueued.
+type inlineQueue struct{}
+
+func (inlineQueue) Enqueue(ctx context.Context, job Job) error {
+	job(ctx)
+	return nil
+}
+
+type fullQueue struct{}
+
+func (fullQueue) Enqueue(_ context.Context, _ Job) error {
+	return errors.New("queue is full")
+}
+
+func (s *AsyncTestSuite) TestAsync() {
+	var (
+		database   = db.Memory()
+		operations = db.MemoryOperations()
+		async      = AsyncService(s.resourceType,
+			CreateService(s.resourceType, database, []filter.ByResource{
+				filter.ByPropertyToByResource(filter.UUIDFilter()),
+				filter.MetaFilter(),
+			}),
+			ReplaceService(s.config, s.resourceType, database, []filter.ByResource{
+				filter.ByPropertyToByResource(filter.ReadOnlyFilter()),
+				filter.MetaFilter(),
+			}),
+			DeleteService(s.config, database),
+			operations,
+			inlineQueue{},
+		)
+		status = OperationService(operations)
+	)
+
+	// accepted operations are pending, and are executed by the queue afterwards
+	resp, err := async.Create(context.TODO(), &CreateRequest{PayloadSource: strings.NewReader(`
+{
+  "schemas": ["urn:ietf:params:scim:schemas:core:2.0:User"],
+  "userName": "foo"
+}`)})
+	require.Nil(s.T(), err)
+	assert.Equal(s.T(), db.OperationPending, resp.Operation.Status)
+	assert.Equal(s.T(), OpCreate, resp.Operation.Method)
+	assert.Equal(s.T(), "User", resp.Operation.ResourceType)
+
+	created, err := status.Do(context.TODO(), &OperationRequest{OperationID: resp.Operation.ID})
+	require.Nil(s.T(), err)
+	assert.Equal(s.T(), db.OperationSucceeded, created.Operation.Status)
+	assert.NotEmpty(s.T(), created.Operation.ResourceID)
+	assert.NotEmpty(s.T(), created.Operation.Location)
+	assert.NotEmpty(s.T(), created.Operation.Version)
+	id := created.Operation.ResourceID
+
+	// failures are reported by the operation
+	resp, err = async.Replace(context.TODO(), &ReplaceRequest{ResourceID: id, PayloadSource: strings.NewReader(`{"schemas": [`)})
+	require.Nil(s.T(), err)
+	replaced, err := status.Do(context.TODO(), &OperationRequest{OperationID: resp.Operation.ID})
+	require.Nil(s.T(), err)
+	assert.Equal(s.T(), db.OperationFailed, replaced.Operation.Status)
+	assert.True(s.T(), errors.Is(replaced.Operation.Err, spec.ErrInvalidSyntax))
+
+	resp, err = async.Delete(context.TODO(), &DeleteRequest{ResourceID: id})
+	require.Nil(s.T(), err)
+	deleted, err := status.Do(context.TODO(), &OperationRequest{OperationID: resp.Operation.ID})
+	require.Nil(s.T(), err)
+	assert.Equal(s.T(), db.OperationSucceeded, deleted.Operation.Status)
+	assert.Equal(s.T(), id, deleted.Operation.ResourceID)
+	_, err = database.Get(context.TODO(), id, nil)
+	assert.True(s.T(), errors.Is(err, spec.ErrNotFound))
+
+	_, err = status.Do(context.TODO(), &OperationRequest{OperationID: "foo"})
+	assert.True(s.T(), errors.Is(err, spec.ErrNotFound))
+}
+
+func (s *AsyncTestSuite) TestQueueRejected() {
+	operations := db.MemoryOperations()
+	async := AsyncService(s.resourceType, nil, nil, DeleteService(s.config, db.Memory()), operations, fullQueue{})
+
+	_, err := async.Delete(context.TODO(), &DeleteRequest{ResourceID: "foo"})
+	assert.NotNil(s.T(), err)
+
+	_, err = async.Create(context.TODO(), &CreateRequest{PayloadSource: strings.NewReader(`{}`)})
+	assert.True(s.T(), errors.Is(err, spec.ErrInvalidSyntax))
+}
+
+func (s *AsyncTestSuite) TestWorkerQueue() {
+	var (
+		queue = WorkerQueue(1, 1)
+		done  = make(chan string, 1)
+	)
+
+	type key struct{}
+	ctx, cancel := context.WithCancel(context.WithValue(context.Background(), key{}, "foo"))
+	require.Nil(s.T(), queue.Enqueue(detached{ctx}, func(ctx context.Context) {
+		done <- ctx.Value(key{}).(string)
+	}))
+	cancel()
+
+	select {
+	case value := <-done:
+		assert.Equal(s.T(), "foo", value)
+	case <-time.After(time.Second):
+		s.T().Fatal("job was not executed")
+	}
+}
+
+func (s *AsyncTestSuite) SetupSuite() {
+	for _, each := range []struct {
+		filepath  string
+		structure interface{}
+		post      func(parsed interface{})
+	}{
+		{
+			filepath:  "../../../public/schemas/core_schema.json",
+			structure: new(spec.Schema),
+			post: func(parsed interface{}) {
+				spec.Schemas().Register(parsed.(*spec.Schema))
+			},
+		},
+		{
+			filepath:  "../../../public/schemas/user_schema.json",
+			structure: new(spec.Schema),
+			post: func(parsed interface{}) {
+				spec.Schemas().Register(parsed.(*spec.Schema))
+			},
+		},
+		{
+			filepath:  "../../../public/schemas/user_enterprise_extension_schema.json",
+			structure: new(spec.Schema),
+			post: func(parsed interface{}) {
+				spec.Schemas().Register(parsed.(*spec.Schema))
+			},
+		},
+		{
+			filepath:  "../../../public/resource_types/user_resource_type.json",
+			structure: new(spec.ResourceType),
+			post: func(parsed interface{}) {
+				s.resourceType = parsed.(*spec.ResourceType)
+				crud.Register(s.resourceType)
+			},
+		},
+	} {
+		f, err := os.Open(each.filepath)
+		require.Nil(s.T(), err)
+
+		raw, err := ioutil.ReadAll(f)
+		require.Nil(s.T(), err)
+
+		err = json.Unmarshal(raw, each.structure)
+		require.Nil(s.T(), err)
+
+		if each.post != nil {
+			each.post(each.structure)
+		}
+	}
+
+	s.config = new(spec.ServiceProviderConfig)
+	require.Nil(s.T(), json.Unmarshal([]byte(`
+{
+  "patch": {
+    "supported": true
+  }
+}
+`), s.config))
+}
@@ -0,0 +1,565 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/imulab/go-scim/pkg/v2/db"
+	scimjson "github.com/imulab/go-scim/pkg/v2/json"
+	"github.com/imulab/go-scim/pkg/v2/prop"
+	"github.com/imulab/go-scim/pkg/v2/spec"
+	"io"
+	"sort"
+	"strings"
+)
+
+const (
+	// Schema of the bulk request message
+	BulkRequestSchema = "urn:ietf:params:scim:api:messages:2.0:BulkRequest"
+	// Schema of the bulk response message
+	BulkResponseSchema = "urn:ietf:params:scim:api:messages:2.0:BulkResponse"
+	// Prefix of values and paths that refer to a resource created by a POST operation in the same bulk request.
+	bulkIdPrefix = "bulkId:"
+)
+
+// BulkService returns a bulk service (RFC7644 section 3.7). Each operation of the bulk request is executed by the
+// service of the endpoint it is addressed to, and the outcome of each executed operation is reported in the response.
+//
+// Operations may refer to the resources created by POST operations in the same request using "bulkId:<bulkId>", both in
+// the path (i.e. /Users/bulkId:qwerty) and in any string value of the data (i.e. the value of a group member). An
+// operation referring to a resource yet to be created is deferred until it is, so that operations can be listed in any
+// order. Operations whose references cannot be resolved, either because the referred operation does not exist, has
+// failed, or the references are circular, fail with spec.ErrInvalidValue.
+//
+// Processing stops once the number of failed operations reaches failOnErrors, if specified. The remaining operations
+// are not executed, and are not reported in the response.
+func BulkService(config *spec.ServiceProviderConfig, endpoints ...*BulkEndpoint) Bulk {
+	return &bulkService{
+		config:    config,
+		endpoints: endpoints,
+	}
+}
+
+// AtomicBulkService returns a bulk service that executes the bulk requests of the given bulk service in a transaction of
+// the database (see db.TxDB), so that their operations are applied as a whole, or not at all. When any operation fails,
+// the transaction is rolled back, and instead of the response, an error of the spec.Error of the failed operation is
+// returned. The operations on other databases only take part in the transaction if the database says so, i.e. SQL
+// databases sharing the connection, and the side effects of the services, i.e. events, are not rolled back.
+//
+// Bulk requests cannot be atomic when the database is not a db.TxDB, in which case the given bulk service is returned as
+// is, which reports the outcome of each operation.
+func AtomicBulkService(bulk Bulk, database db.DB) Bulk {
+	if _, ok := database.(db.TxDB); !ok {
+		return bulk
+	}
+	return &atomicBulkService{bulk: bulk, database: database}
+}
+
+type atomicBulkService struct {
+	bulk     Bulk
+	database db.DB
+}
+
+func (s *atomicBulkService) Do(ctx context.Context, req *BulkRequest) (resp *BulkResponse, err error) {
+	err = db.WithTx(ctx, s.database, func(ctx context.Context) error {
+		if resp, err = s.bulk.Do(ctx, req); err != nil {
+			return err
+		}
+		for _, result := range resp.Results {
+			if result.Err != nil {
+				return errBulkRolledBack(result)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		resp = nil
+	}
+	return
+}
+
+type (
+	// Bulk service
+	Bulk interface {
+		Do(ctx context.Context, req *BulkRequest) (resp *BulkResponse, err error)
+	}
+	// Services of the endpoint for a resource type. Bulk operations of a method whose service is nil are not supported.
+	BulkEndpoint struct {
+		ResourceType *spec.ResourceType // resource type served by the endpoint, whose endpoint is used to address operations
+		Create       Create             // service for POST operations
+		Replace      Replace            // service for PUT operations
+		Patch        Patch              // service for PATCH operations
+		Delete       Delete             // service for DELETE operations
+	}
+	// Bulk request
+	BulkRequest struct {
+		PayloadSource io.Reader // source to read the bulk request payload from
+	}
+	// Bulk response
+	BulkResponse struct {
+		Results []*BulkResult // outcome of the executed operations, in the order they appear in the request
+	}
+	// Outcome of a single bulk operation
+	BulkResult struct {
+		Method   string         // method of the operation
+		BulkID   string         // bulkId of the operation, if any
+		Version  string         // version of the resource after the operation, if any
+		Location string         // location of the resource, if known
+		Status   int            // HTTP status of the operation
+		Resource *prop.Resource // resource after the operation, if any
+		Err      error          // error of the failed operation
+	}
+	// Bulk request payload
+	BulkPayload struct {
+		Schemas      []string         `json:"schemas"`
+		FailOnErrors int              `json:"failOnErrors"`
+		Operations   []*BulkOperation `json:"Operations"`
+	}
+	// A single operation of the bulk request
+	BulkOperation struct {
+		Method  string          `json:"method"`
+		BulkID  string          `json:"bulkId"`
+		Version string          `json:"version"`
+		Path    string          `json:"path"`
+		Data    json.RawMessage `json:"data"`
+	}
+)
+
+type bulkService struct {
+	config    *spec.ServiceProviderConfig
+	endpoints []*BulkEndpoint
+}
+
+func (s *bulkService) Do(ctx context.Context, req *BulkRequest) (resp *BulkResponse, err error) {
+	if err = s.checkSupport(); err != nil {
+		return
+	}
+
+	payload, err := s.parseRequest(req)
+	if err != nil {
+		return
+	}
+
+	if err = payload.Validate(s.config); err != nil {
+		return
+	}
+
+	resp = &BulkResponse{Results: s.execute(ctx, payload)}
+	return
+}
+
+func (s *bulkService) checkSupport() error {
+	if !s.config.Bulk.Supported {
+		return fmt.Errorf("%w: bulk operation is not supported", spec.ErrNotImplemented)
+	}
+	return nil
+}
+
+func (s *bulkService) parseRequest(req *BulkRequest) (*BulkPayload, error) {
+	if req == nil || req.PayloadSource == nil {
+		return nil, fmt.Errorf("%w: no payload for bulk service", spec.ErrInternal)
+	}
+
+	source := req.PayloadSource
+	if max := s.config.Bulk.MaxPayload; max > 0 {
+		source = io.LimitReader(source, int64(max)+1)
+	}
+	raw, err := readPayload(source)
+	if err != nil {
+		return nil, err
+	}
+	if max := s.config.Bulk.MaxPayload; max > 0 && len(raw) > max {
+		return nil, fmt.Errorf("%w: bulk payload exceeds %d bytes", spec.ErrPayloadTooLarge, max)
+	}
+
+	payload := new(BulkPayload)
+	if err := scimjson.Unmarshal(raw, payload); err != nil {
+		return nil, err
+	}
+	return payload, nil
+}
+
+// Validate checks the message schema, the number of operations against the limit of the service provider, and the
+// required fields of each operation.
+func (p *BulkPayload) Validate(config *spec.ServiceProviderConfig) error {
+	if len(p.Schemas) != 1 || p.Schemas[0] != BulkRequestSchema {
+		return fmt.Errorf("%w: invalid bulk request schema", spec.ErrInvalidSyntax)
+	}
+	if max := config.Bulk.MaxOp; max > 0 && len(p.Operations) > max {
+		return fmt.Errorf("%w: bulk request contains more than %d operations", spec.ErrPayloadTooLarge, max)
+	}
+	if p.FailOnErrors < 0 {
+		return fmt.Errorf("%w: failOnErrors must not be negative", spec.ErrInvalidSyntax)
+	}
+
+	bulkIds := make(map[string]struct{})
+	for i, op := range p.Operations {
+		if op == nil {
+			return fmt.Errorf("%w: empty bulk operation at %d", spec.ErrInvalidSyntax, i)
+		}
+		switch strings.ToUpper(op.Method) {
+		case "POST":
+			if len(op.BulkID) == 0 {
+				return fmt.Errorf("%w: bulkId is required for POST operation at %d", spec.ErrInvalidSyntax, i)
+			}
+			if _, ok := bulkIds[op.BulkID]; ok {
+				return fmt.Errorf("%w: duplicate bulkId '%s'", spec.ErrInvalidSyntax, op.BulkID)
+			}
+			bulkIds[op.BulkID] = struct{}{}
+			fallthrough
+		case "PUT", "PATCH":
+			if len(op.Data) == 0 {
+				return fmt.Errorf("%w: no data for %s operation at %d", spec.ErrInvalidSyntax, op.Method, i)
+			}
+		case "DELETE":
+		default:
+			return fmt.Errorf("%w: invalid bulk operation method '%s' at %d", spec.ErrInvalidSyntax, op.Method, i)
+		}
+		if len(op.Path) == 0 {
+			return fmt.Errorf("%w: no path for bulk operation at %d", spec.ErrInvalidSyntax, i)
+		}
+	}
+	return nil
+}
+
+type bulkEntry struct {
+	index  int
+	op     *BulkOperation
+	refs   []string // bulkIds referred to by the operation
+	result *BulkResult
+}
+
+// Execute the operations, deferring those that refer to resources yet to be created.
+func (s *bulkService) execute(ctx context.Context, payload *BulkPayload) []*BulkResult {
+	var (
+		pending  = make([]*bulkEntry, 0, len(payload.Operations))
+		done     = make([]*bulkEntry, 0, len(payload.Operations))
+		created  = make(map[string]string) // bulkId to id of the created resource
+		posted   = make(map[string]bool)   // bulkIds of POST operations yet to be executed
+		failures = 0
+	)
+	for i, op := range payload.Operations {
+		pending = append(pending, &bulkEntry{index: i, op: op, refs: bulkReferences(op)})
+		if strings.ToUpper(op.Method) == "POST" {
+			posted[op.BulkID] = true
+		}
+	}
+
+	// Each pass executes the pending operations whose references are resolved, in request order. Once a pass makes no
+	// progress, the references of the remaining operations can never be resolved.
+	for len(pending) > 0 && (payload.FailOnErrors == 0 || failures < payload.FailOnErrors) {
+		var (
+			deferred = make([]*bulkEntry, 0)
+			progress = false
+		)
+		for _, entry := range pending {
+			if payload.FailOnErrors > 0 && failures >= payload.FailOnErrors {
+				break
+			}
+			if !resolvable(entry, created, posted) {
+				deferred = append(deferred, entry)
+				continue
+			}
+
+			progress = true
+			entry.result = s.executeOne(ctx, entry.op, created)
+			if entry.result.Err != nil {
+				failures++
+			} else if strings.ToUpper(entry.op.Method) == "POST" && entry.result.Resource != nil {
+				created[entry.op.BulkID] = entry.result.Resource.IdOrEmpty()
+			}
+			if strings.ToUpper(entry.op.Method) == "POST" {
+				delete(posted, entry.op.BulkID)
+			}
+			done = append(done, entry)
+		}
+		pending = deferred
+
+		if !progress {
+			for _, entry := range pending {
+				if payload.FailOnErrors > 0 && failures >= payload.FailOnErrors {
+					break
+				}
+				entry.result = s.failure(entry.op, fmt.Errorf("%w: cannot resolve bulkId references %s",
+					spec.ErrInvalidValue, strings.Join(entry.refs, ", ")))
+				failures++
+				done = append(done, entry)
+			}
+			break
+		}
+	}
+
+	sort.Slice(done, func(i, j int) bool {
+		return done[i].index < done[j].index
+	})
+	results := make([]*BulkResult, 0, len(done))
+	for _, entry := range done {
+		results = append(results, entry.result)
+	}
+	return results
+}
+
+// Returns true if every reference of the entry refers to a created resource. References to POST operations that
+// have failed, or do not exist, are reported as resolvable, so that the operation fails with the unresolved reference.
+func resolvable(entry *bulkEntry, created map[string]string, posted map[string]bool) bool {
+	for _, ref := range entry.refs {
+		if _, ok := created[ref]; ok {
+			continue
+		}
+		if posted[ref] {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *bulkService) executeOne(ctx context.Context, op *BulkOperation, created map[string]string) *BulkResult {
+	endpoint, id, err := s.route(op.Path, created)
+	if err != nil {
+		return s.failure(op, err)
+	}
+
+	var data []byte
+	if len(op.Data) > 0 {
+		if data, err = resolveBulkIds(op.Data, created); err != nil {
+			return s.failure(op, err)
+		}
+	}
+
+	method := strings.ToUpper(op.Method)
+	if (method == "POST") != (len(id) == 0) {
+		return s.failure(op, fmt.Errorf("%w: invalid path '%s' for %s operation", spec.ErrInvalidPath, op.Path, method))
+	}
+
+	result := &BulkResult{Method: method, BulkID: op.BulkID}
+	switch method {
+	case "POST":
+		if endpoint.Create == nil {
+			return s.failure(op, errBulkMethodNotSupported(method, op.Path))
+		}
+		resp, err := endpoint.Create.Do(ctx, &CreateRequest{PayloadSource: bytes.NewReader(data)})
+		if err != nil {
+			return s.failure(op, err)
+		}
+		result.Status = 201
+		result.Resource = resp.Resource
+	case "PUT":
+		if endpoint.Replace == nil {
+			return s.failure(op, errBulkMethodNotSupported(method, op.Path))
+		}
+		resp, err := endpoint.Replace.Do(ctx, &ReplaceRequest{
+			ResourceID:    id,
+			PayloadSource: bytes.NewReader(data),
+			Version:       op.Version,
+		})
+		if err != nil {
+			return s.failure(op, err)
+		}
+		result.Status = 200
+		result.Resource = resp.Resource
+		if !resp.Replaced {
+			result.Resource = resp.Ref
+		}
+	case "PATCH":
+		if endpoint.Patch == nil {
+			return s.failure(op, errBulkMethodNotSupported(method, op.Path))
+		}
+		resp, err := endpoint.Patch.Do(ctx, &PatchRequest{
+			ResourceID:    id,
+			PayloadSource: bytes.NewReader(data),
+			Version:       op.Version,
+		})
+		if err != nil {
+			return s.failure(op, err)
+		}
+		result.Status = 200
+		result.Resource = resp.Resource
+		if !resp.Patched {
+			result.Resource = resp.Ref
+		}
+	case "DELETE":
+		if endpoint.Delete == nil {
+			return s.failure(op, errBulkMethodNotSupported(method, op.Path))
+		}
+		resp, err := endpoint.Delete.Do(ctx, &DeleteRequest{
+			ResourceID: id,
+			Version:    op.Version,
+		})
+		if err != nil {
+			return s.failure(op, err)
+		}
+		result.Status = 204
+		if resp.Deleted != nil {
+			result.Location = resp.Deleted.MetaLocationOrEmpty()
+		}
+	}
+
+	if result.Resource != nil {
+		result.Location = result.Resource.MetaLocationOrEmpty()
+		result.Version = result.Resource.MetaVersionOrEmpty()
+	}
+	return result
+}
+
+func (s *bulkService) failure(op *BulkOperation, err error) *BulkResult {
+	result := &BulkResult{
+		Method: strings.ToUpper(op.Method),
+		BulkID: op.BulkID,
+		Status: spec.ErrInternal.Status,
+		Err:    err,
+	}
+	var scimErr *spec.Error
+	if errors.As(err, &scimErr) {
+		result.Status = scimErr.Status
+	}
+	return result
+}
+
+// Route the path of the operation to its endpoint, and returns the id of the resource in the path, if any.
+// References to created resources in the path are resolved.
+func (s *bulkService) route(path string, created map[string]string) (*BulkEndpoint, string, error) {
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	if len(segments) > 2 || len(segments[0]) == 0 {
+		return nil, "", fmt.Errorf("%w: invalid bulk operation path '%s'", spec.ErrInvalidPath, path)
+	}
+
+	var endpoint *BulkEndpoint
+	for _, each := range s.endpoints {
+		if strings.EqualFold(strings.Trim(each.ResourceType.Endpoint(), "/"), segments[0]) {
+			endpoint = each
+			break
+		}
+	}
+	if endpoint == nil {
+		return nil, "", fmt.Errorf("%w: no endpoint for bulk operation path '%s'", spec.ErrInvalidPath, path)
+	}
+
+	if len(segments) == 1 {
+		return endpoint, "", nil
+	}
+	id := segments[1]
+	if strings.HasPrefix(id, bulkIdPrefix) {
+		resolved, ok := created[strings.TrimPrefix(id, bulkIdPrefix)]
+		if !ok {
+			return nil, "", fmt.Errorf("%w: cannot resolve '%s'", spec.ErrInvalidValue, id)
+		}
+		id = resolved
+	}
+	if len(id) == 0 {
+		return nil, "", fmt.Errorf("%w: invalid bulk operation path '%s'", spec.ErrInvalidPath, path)
+	}
+	return endpoint, id, nil
+}
+
+// Returns the bulkIds referred to by the path and the data of the operation.
+func bulkReferences(op *BulkOperation) []string {
+	var (
+		refs = make([]string, 0)
+		seen = make(map[string]struct{})
+		add  = func(s string) {
+			if !strings.HasPrefix(s, bulkIdPrefix) {
+				return
+			}
+			ref := strings.TrimPrefix(s, bulkIdPrefix)
+			if _, ok := seen[ref]; !ok {
+				seen[ref] = struct{}{}
+				refs = append(refs, ref)
+			}
+		}
+	)
+
+	if segments := strings.Split(strings.Trim(op.Path, "/"), "/"); len(segments) == 2 {
+		add(segments[1])
+	}
+	if len(op.Data) > 0 {
+		if data, err := decodeBulkData(op.Data); err == nil {
+			walkStrings(data, func(s string) string {
+				add(s)
+				return s
+			})
+		}
+	}
+	return refs
+}
+
+// Replaces all "bulkId:<bulkId>" string values in the data with the id of the created resource.
+func resolveBulkIds(data json.RawMessage, created map[string]string) ([]byte, error) {
+	if !bytes.Contains(data, []byte(bulkIdPrefix)) {
+		return data, nil
+	}
+
+	parsed, err := decodeBulkData(data)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid data in bulk operation", spec.ErrInvalidSyntax)
+	}
+
+	var unresolved error
+	parsed = walkStrings(parsed, func(s string) string {
+		if !strings.HasPrefix(s, bulkIdPrefix) {
+			return s
+		}
+		if id, ok := created[strings.TrimPrefix(s, bulkIdPrefix)]; ok {
+			return id
+		}
+		if unresolved == nil {
+			unresolved = fmt.Errorf("%w: cannot resolve '%s'", spec.ErrInvalidValue, s)
+		}
+		return s
+	})
+	if unresolved != nil {
+		return nil, unresolved
+	}
+	return json.Marshal(parsed)
+}
+
+// Decodes the data of a bulk operation into plain values. Numbers are kept as json.Number, so that they are encoded back
+// as they were, rather than rounded to float64, which is lossy for large integers.
+func decodeBulkData(data []byte) (interface{}, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+	if _, err := decoder.Token(); err != io.EOF {
+		return nil, fmt.Errorf("%w: invalid data after top-level value", spec.ErrInvalidSyntax)
+	}
+	return value, nil
+}
+
+// Walks the parsed JSON value, replacing each string with the result of the function.
+func walkStrings(value interface{}, fn func(s string) string) interface{} {
+	switch v := value.(type) {
+	case string:
+		return fn(v)
+	case []interface{}:
+		for i := range v {
+			v[i] = walkStrings(v[i], fn)
+		}
+	case map[string]interface{}:
+		for k := range v {
+			v[k] = walkStrings(v[k], fn)
+		}
+	}
+	return value
+}
+
+// Returns the error of the atomic bulk request rolled back because of the failed operation, which is of the spec.Error of
+// the operation, or spec.ErrInternal if it has none.
+func errBulkRolledBack(failed *BulkResult) error {
+	scimErr := spec.ErrInternal
+	errors.As(failed.Err, &scimErr)
+
+	op := failed.Method
+	if len(failed.BulkID) > 0 {
+		op += " (bulkId '" + failed.BulkID + "')"
+	}
+	return fmt.Errorf("%w: bulk request was rolled back as the %s operation failed: %v", scimErr, op, failed.Err)
+}
+
+func errBulkMethodNotSupported(method string, path string) error {
+	return fmt.Errorf("%w: %s is not supported for '%s'", spec.ErrInvalidSyntax, method, path)
+}
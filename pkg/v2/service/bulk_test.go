@@ -0,0 +1,448 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/imulab/go-scim/pkg/v2/crud"
+	"github.com/imulab/go-scim/pkg/v2/db"
+	"github.com/imulab/go-scim/pkg/v2/prop"
+	"github.com/imulab/go-scim/pkg/v2/service/filter"
+	"github.com/imulab/go-scim/pkg/v2/spec"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestBulkService(t *testing.T) {
+	s := new(BulkServiceTestSuite)
+	suite.Run(t, s)
+}
+
+type BulkServiceTestSuite struct {
+	suite.Suite
+	userResourceType  *spec.ResourceType
+	groupResourceType *spec.ResourceType
+	config            *spec.ServiceProviderConfig
+}
+
+func (s *BulkServiceTestSuite) TestDo() {
+	tests := []struct {
+		name    string
+		payload string
+		expect  func(t *testing.T, resp *BulkResponse, err error, userDB db.DB, groupDB db.DB)
+	}{
+		{
+			name: "resolve bulkId references",
+			payload: `
+{
+	"schemas": ["urn:ietf:params:scim:api:messages:2.0:BulkRequest"],
+	"Operations": [
+		{
+			"method": "POST",
+			"path": "/Groups",
+			"bulkId": "ytrewq",
+			"data": {
+				"schemas": ["urn:ietf:params:scim:schemas:core:2.0:Group"],
+				"displayName": "Tour Guides",
+				"members": [{"value": "bulkId:qwerty"}]
+			}
+		},
+		{
+			"method": "POST",
+			"path": "/Users",
+			"bulkId": "qwerty",
+			"data": {
+				"schemas": ["urn:ietf:params:scim:schemas:core:2.0:User"],
+				"userName": "Alice"
+			}
+		},
+		{
+			"method": "PATCH",
+			"path": "/Users/bulkId:qwerty",
+			"data": {
+				"schemas": ["urn:ietf:params:scim:api:messages:2.0:PatchOp"],
+				"Operations": [{"op": "add", "path": "displayName", "value": "Alice"}]
+			}
+		}
+	]
+}`,
+			expect: func(t *testing.T, resp *BulkResponse, err error, userDB db.DB, groupDB db.DB) {
+				require.Nil(t, err)
+				require.Len(t, resp.Results, 3)
+				for _, result := range resp.Results {
+					assert.Nil(t, result.Err)
+				}
+
+				group, user := resp.Results[0], resp.Results[1]
+				assert.Equal(t, "POST", group.Method)
+				assert.Equal(t, "ytrewq", group.BulkID)
+				assert.Equal(t, 201, group.Status)
+				assert.NotEmpty(t, group.Location)
+				assert.NotEmpty(t, group.Version)
+				assert.Equal(t, 201, user.Status)
+				assert.Equal(t, 200, resp.Results[2].Status)
+
+				userID := user.Resource.IdOrEmpty()
+				members := group.Resource.Navigator().Dot("members").At(0).Dot("value").Current().Raw()
+				assert.Equal(t, userID, members)
+
+				stored, err := userDB.Get(context.TODO(), userID, nil)
+				require.Nil(t, err)
+				assert.Equal(t, "Alice", stored.Navigator().Dot("displayName").Current().Raw())
+			},
+		},
+		{
+			name: "fail on errors",
+			payload: `
+{
+	"schemas": ["urn:ietf:params:scim:api:messages:2.0:BulkRequest"],
+	"failOnErrors": 1,
+	"Operations": [
+		{
+			"method": "DELETE",
+			"path": "/Users/foo",
+			"version": "W/\"stale\""
+		},
+		{
+			"method": "DELETE",
+			"path": "/Users/bar"
+		}
+	]
+}`,
+			expect: func(t *testing.T, resp *BulkResponse, err error, userDB db.DB, groupDB db.DB) {
+				require.Nil(t, err)
+				require.Len(t, resp.Results, 1)
+				assert.Equal(t, spec.ErrConflict.Status, resp.Results[0].Status)
+				assert.NotNil(t, resp.Results[0].Err)
+
+				_, err = userDB.Get(context.TODO(), "bar", nil)
+				assert.Nil(t, err)
+			},
+		},
+		{
+			name: "unresolvable references",
+			payload: `
+{
+	"schemas": ["urn:ietf:params:scim:api:messages:2.0:BulkRequest"],
+	"Operations": [
+		{
+			"method": "POST",
+			"path": "/Groups",
+			"bulkId": "a",
+			"data": {
+				"schemas": ["urn:ietf:params:scim:schemas:core:2.0:Group"],
+				"displayName": "A",
+				"members": [{"value": "bulkId:b"}]
+			}
+		},
+		{
+			"method": "POST",
+			"path": "/Groups",
+			"bulkId": "b",
+			"data": {
+				"schemas": ["urn:ietf:params:scim:schemas:core:2.0:Group"],
+				"displayName": "B",
+				"members": [{"value": "bulkId:a"}]
+			}
+		},
+		{
+			"method": "DELETE",
+			"path": "/Users/bulkId:missing"
+		},
+		{
+			"method": "DELETE",
+			"path": "/Users/foo"
+		}
+	]
+}`,
+			expect: func(t *testing.T, resp *BulkResponse, err error, userDB db.DB, groupDB db.DB) {
+				require.Nil(t, err)
+				require.Len(t, resp.Results, 4)
+				assert.Equal(t, spec.ErrInvalidValue.Status, resp.Results[0].Status)
+				assert.Equal(t, spec.ErrInvalidValue.Status, resp.Results[1].Status)
+				assert.Equal(t, spec.ErrInvalidValue.Status, resp.Results[2].Status)
+				assert.Equal(t, 204, resp.Results[3].Status)
+
+				n, err := groupDB.Count(context.TODO(), "id pr")
+				assert.Nil(t, err)
+				assert.Equal(t, 0, n)
+			},
+		},
+		{
+			name: "too many operations",
+			payload: `
+{
+	"schemas": ["urn:ietf:params:scim:api:messages:2.0:BulkRequest"],
+	"Operations": [
+		{"method": "DELETE", "path": "/Users/1"},
+		{"method": "DELETE", "path": "/Users/2"},
+		{"method": "DELETE", "path": "/Users/3"},
+		{"method": "DELETE", "path": "/Users/4"},
+		{"method": "DELETE", "path": "/Users/5"}
+	]
+}`,
+			expect: func(t *testing.T, resp *BulkResponse, err error, userDB db.DB, groupDB db.DB) {
+				assert.Equal(t, spec.ErrPayloadTooLarge, unwrapSpecError(err))
+			},
+		},
+		{
+			name: "post without bulkId",
+			payload: `
+{
+	"schemas": ["urn:ietf:params:scim:api:messages:2.0:BulkRequest"],
+	"Operations": [
+		{"method": "POST", "path": "/Users", "data": {"userName": "foo"}}
+	]
+}`,
+			expect: func(t *testing.T, resp *BulkResponse, err error, userDB db.DB, groupDB db.DB) {
+				assert.Equal(t, spec.ErrInvalidSyntax, unwrapSpecError(err))
+			},
+		},
+		{
+			name: "unknown endpoint",
+			payload: `
+{
+	"schemas": ["urn:ietf:params:scim:api:messages:2.0:BulkRequest"],
+	"Operations": [
+		{"method": "DELETE", "path": "/Devices/foo"}
+	]
+}`,
+			expect: func(t *testing.T, resp *BulkResponse, err error, userDB db.DB, groupDB db.DB) {
+				require.Nil(t, err)
+				require.Len(t, resp.Results, 1)
+				assert.Equal(t, spec.ErrInvalidPath.Status, resp.Results[0].Status)
+			},
+		},
+	}
+
+	for _, test := range tests {
+		s.T().Run(test.name, func(t *testing.T) {
+			userDB, groupDB := db.Memory(), db.Memory()
+			for _, id := range []string{"foo", "bar"} {
+				user := prop.NewResource(s.userResourceType)
+				require.Nil(t, user.Navigator().Replace(map[string]interface{}{
+					"schemas":  []interface{}{"urn:ietf:params:scim:schemas:core:2.0:User"},
+					"id":       id,
+					"userName": id,
+					"meta":     map[string]interface{}{"version": "W/\"1\""},
+				}).Error())
+				require.Nil(t, userDB.Insert(context.TODO(), user))
+			}
+
+			bulk := BulkService(s.config, s.endpoint(s.userResourceType, userDB), s.endpoint(s.groupResourceType, groupDB))
+			resp, err := bulk.Do(context.TODO(), &BulkRequest{PayloadSource: strings.NewReader(test.payload)})
+			test.expect(t, resp, err, userDB, groupDB)
+		})
+	}
+}
+
+func (s *BulkServiceTestSuite) TestAtomic() {
+	userDB := db.Memory()
+	foo := prop.NewResource(s.userResourceType)
+	require.Nil(s.T(), foo.Navigator().Replace(map[string]interface{}{
+		"schemas":  []interface{}{"urn:ietf:params:scim:schemas:core:2.0:User"},
+		"id":       "foo",
+		"userName": "foo",
+		"meta":     map[string]interface{}{"version": "W/\"1\""},
+	}).Error())
+	require.Nil(s.T(), userDB.Insert(context.TODO(), foo))
+
+	bulk := AtomicBulkService(BulkService(s.config, s.endpoint(s.userResourceType, userDB)), userDB)
+	resp, err := bulk.Do(context.TODO(), &BulkRequest{PayloadSource: strings.NewReader(`
+{
+	"schemas": ["urn:ietf:params:scim:api:messages:2.0:BulkRequest"],
+	"Operations": [
+		{
+			"method": "POST",
+			"path": "/Users",
+			"bulkId": "qwerty",
+			"data": {"schemas": ["urn:ietf:params:scim:schemas:core:2.0:User"], "userName": "Alice"}
+		},
+		{"method": "DELETE", "path": "/Users/foo"},
+		{"method": "DELETE", "path": "/Users/missing"}
+	]
+}`)})
+	assert.Nil(s.T(), resp)
+	assert.Equal(s.T(), spec.ErrNotFound, unwrapSpecError(err))
+
+	n, err := userDB.Count(context.TODO(), "")
+	require.Nil(s.T(), err)
+	assert.Equal(s.T(), 1, n)
+	_, err = userDB.Get(context.TODO(), "foo", nil)
+	assert.Nil(s.T(), err)
+
+	resp, err = bulk.Do(context.TODO(), &BulkRequest{PayloadSource: strings.NewReader(`
+{
+	"schemas": ["urn:ietf:params:scim:api:messages:2.0:BulkRequest"],
+	"Operations": [{"method": "DELETE", "path": "/Users/foo"}]
+}`)})
+	require.Nil(s.T(), err)
+	require.Len(s.T(), resp.Results, 1)
+	_, err = userDB.Get(context.TODO(), "foo", nil)
+	assert.Equal(s.T(), spec.ErrNotFound, unwrapSpecError(err))
+
+	// Bulk requests on databases without transactions are not atomic.
+	plain := BulkService(s.config)
+	assert.Equal(s.T(), plain, AtomicBulkService(plain, db.NoOp()))
+}
+
+func (s *BulkServiceTestSuite) TestNotSupported() {
+	bulk := BulkService(new(spec.ServiceProviderConfig))
+	_, err := bulk.Do(context.TODO(), &BulkRequest{PayloadSource: strings.NewReader(`{}`)})
+	assert.NotNil(s.T(), err)
+}
+
+func (s *BulkServiceTestSuite) endpoint(resourceType *spec.ResourceType, database db.DB) *BulkEndpoint {
+	return &BulkEndpoint{
+		ResourceType: resourceType,
+		Create: CreateService(resourceType, database, []filter.ByResource{
+			filter.ByPropertyToByResource(
+				filter.ReadOnlyFilter(),
+				filter.UUIDFilter(),
+			),
+			filter.MetaFilter(),
+		}),
+		Patch: PatchService(s.config, database, nil, []filter.ByResource{
+			filter.ByPropertyToByResource(filter.ReadOnlyFilter()),
+			filter.MetaFilter(),
+		}),
+		Delete: DeleteService(s.config, database),
+	}
+}
+
+func TestResolveBulkIds(t *testing.T) {
+	tests := []struct {
+		name   string
+		data   string
+		expect func(t *testing.T, resolved []byte, err error)
+	}{
+		{
+			name: "numbers are kept",
+			data: `{"value": "bulkId:qwerty", "count": 12345678901234567891, "ratio": 0.1}`,
+			expect: func(t *testing.T, resolved []byte, err error) {
+				assert.Nil(t, err)
+				assert.JSONEq(t, `{"value": "92b725cd", "count": 12345678901234567891, "ratio": 0.1}`, string(resolved))
+				assert.Contains(t, string(resolved), "12345678901234567891")
+			},
+		},
+		{
+			name: "unresolved bulkId",
+			data: `{"value": "bulkId:ytrewq"}`,
+			expect: func(t *testing.T, resolved []byte, err error) {
+				assert.Equal(t, spec.ErrInvalidValue, errors.Unwrap(err))
+			},
+		},
+		{
+			name: "trailing data",
+			data: `{"value": "bulkId:qwerty"} {}`,
+			expect: func(t *testing.T, resolved []byte, err error) {
+				assert.Equal(t, spec.ErrInvalidSyntax, errors.Unwrap(err))
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			resolved, err := resolveBulkIds(json.RawMessage(test.data), map[string]string{"qwerty": "92b725cd"})
+			test.expect(t, resolved, err)
+		})
+	}
+}
+
+func unwrapSpecError(err error) error {
+	for err != nil {
+		if _, ok := err.(*spec.Error); ok {
+			return err
+		}
+		err = errors.Unwrap(err)
+	}
+	return nil
+}
+
+func (s *BulkServiceTestSuite) SetupSuite() {
+	for _, each := range []struct {
+		filepath  string
+		structure interface{}
+		post      func(parsed interface{})
+	}{
+		{
+			filepath:  "../../../public/schemas/core_schema.json",
+			structure: new(spec.Schema),
+			post: func(parsed interface{}) {
+				spec.Schemas().Register(parsed.(*spec.Schema))
+			},
+		},
+		{
+			filepath:  "../../../public/schemas/user_schema.json",
+			structure: new(spec.Schema),
+			post: func(parsed interface{}) {
+				spec.Schemas().Register(parsed.(*spec.Schema))
+			},
+		},
+		{
+			filepath:  "../../../public/schemas/user_enterprise_extension_schema.json",
+			structure: new(spec.Schema),
+			post: func(parsed interface{}) {
+				spec.Schemas().Register(parsed.(*spec.Schema))
+			},
+		},
+		{
+			filepath:  "../../../public/schemas/group_schema.json",
+			structure: new(spec.Schema),
+			post: func(parsed interface{}) {
+				spec.Schemas().Register(parsed.(*spec.Schema))
+			},
+		},
+		{
+			filepath:  "../../../public/resource_types/user_resource_type.json",
+			structure: new(spec.ResourceType),
+			post: func(parsed interface{}) {
+				s.userResourceType = parsed.(*spec.ResourceType)
+				crud.Register(s.userResourceType)
+			},
+		},
+		{
+			filepath:  "../../../public/resource_types/group_resource_type.json",
+			structure: new(spec.ResourceType),
+			post: func(parsed interface{}) {
+				s.groupResourceType = parsed.(*spec.ResourceType)
+				crud.Register(s.groupResourceType)
+			},
+		},
+	} {
+		f, err := os.Open(each.filepath)
+		require.Nil(s.T(), err)
+
+		raw, err := ioutil.ReadAll(f)
+		require.Nil(s.T(), err)
+
+		err = json.Unmarshal(raw, each.structure)
+		require.Nil(s.T(), err)
+
+		if each.post != nil {
+			each.post(each.structure)
+		}
+	}
+
+	s.config = new(spec.ServiceProviderConfig)
+	require.Nil(s.T(), json.Unmarshal([]byte(`
+{
+  "patch": {
+    "supported": true
+  },
+  "etag": {
+    "supported": true
+  },
+  "bulk": {
+    "supported": true,
+    "maxOperations": 4,
+    "maxPayloadSize": 1048576
+  }
+}
+`), s.config))
+}
@@ -0,0 +1,166 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"github.com/imulab/go-scim/pkg/v2/crud"
+	"github.com/imulab/go-scim/pkg/v2/db"
+	"github.com/imulab/go-scim/pkg/v2/prop"
+	"github.com/imulab/go-scim/pkg/v2/service/filter"
+	"github.com/imulab/go-scim/pkg/v2/spec"
+)
+
+// Path to the manager reference of the enterprise User extension.
+const managerPath = "urn:ietf:params:scim:schemas:extension:enterprise:2.0:User:manager"
+
+// Number of attempts to update a referencing resource that is concurrently modified.
+const cascadeAttempts = 3
+
+// Cascade is the policy of CascadeDeleteService to remove the references to deleted resources from other resources.
+type Cascade struct {
+	// Groups is the database of groups, whose members referencing the deleted resource are removed. If nil, group
+	// members are left as is.
+	Groups db.DB
+	// GroupFilters are run against the groups modified, before they are replaced in the database. Usually
+	// filter.MetaFilter, so that the version of the groups is bumped.
+	GroupFilters []filter.ByResource
+	// Users is the database of users, whose enterprise extension manager referencing the deleted resource is removed.
+	// If nil, manager references are left as is.
+	Users db.DB
+	// UserFilters are run against the users modified, before they are replaced in the database. Usually
+	// filter.MetaFilter.
+	UserFilters []filter.ByResource
+	// Queue, if not nil, executes the removal in the background instead of before the delete service returns.
+	Queue Queue
+	// Tx, if not nil, is the database whose transaction (see db.TxDB) spans the delete and the removal executed before
+	// the delete service returns, so that the resource is only deleted if the references to it are removed. Groups and
+	// Users shall take part in the transaction, i.e. be SQL databases sharing the connection with Tx.
+	Tx db.DB
+	// OnError, if not nil, is called with the errors of the removal executed in the background.
+	OnError func(ctx context.Context, deleted *prop.Resource, err error)
+}
+
+// CascadeDeleteService returns a delete resource service which, after the given delete service deleted the resource,
+// removes the references to it from other resources according to the cascade policy, so that i.e. deleted users no
+// longer linger in group membership lists. When the removal is executed synchronously, its error is returned to the
+// caller along with the response, as the resource was deleted nevertheless, unless the cascade policy has a Tx, in
+// which case the delete is rolled back along with the removal, and no response is returned.
+func CascadeDeleteService(delete Delete, cascade *Cascade) Delete {
+	return &cascadeDeleteService{delete: delete, cascade: cascade}
+}
+
+type cascadeDeleteService struct {
+	delete  Delete
+	cascade *Cascade
+}
+
+func (s *cascadeDeleteService) Do(ctx context.Context, req *DeleteRequest) (resp *DeleteResponse, err error) {
+	if s.cascade.Queue == nil && s.cascade.Tx != nil {
+		err = db.WithTx(ctx, s.cascade.Tx, func(ctx context.Context) error {
+			if resp, err = s.delete.Do(ctx, req); err != nil || resp == nil || resp.Deleted == nil {
+				return err
+			}
+			return s.removeReferences(ctx, resp.Deleted)
+		})
+		if err != nil {
+			resp = nil
+		}
+		return
+	}
+
+	resp, err = s.delete.Do(ctx, req)
+	if err != nil || resp == nil || resp.Deleted == nil {
+		return
+	}
+
+	deleted := resp.Deleted
+	if s.cascade.Queue == nil {
+		err = s.removeReferences(ctx, deleted)
+		return
+	}
+
+	err = s.cascade.Queue.Enqueue(detached{ctx}, func(ctx context.Context) {
+		if err := s.removeReferences(ctx, deleted); err != nil && s.cascade.OnError != nil {
+			s.cascade.OnError(ctx, deleted, err)
+		}
+	})
+	return
+}
+
+func (s *cascadeDeleteService) removeReferences(ctx context.Context, deleted *prop.Resource) error {
+	id := deleted.IdOrEmpty()
+	if s.cascade.Groups != nil {
+		err := removeReferences(ctx, s.cascade.Groups, s.cascade.GroupFilters,
+			crud.Filter().Eq("members.value", id).String(),
+			func(group *prop.Resource) error {
+				return crud.Delete(group, "members["+crud.Filter().Eq("value", id).String()+"]")
+			})
+		if err != nil {
+			return err
+		}
+	}
+	if s.cascade.Users != nil {
+		err := removeReferences(ctx, s.cascade.Users, s.cascade.UserFilters,
+			crud.Filter().Eq(managerPath+".value", id).String(),
+			func(user *prop.Resource) error {
+				return crud.Delete(user, managerPath)
+			})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Removes the references from the resources matching the filter, which are replaced in one bulk write (see
+// db.ReplaceMany), retrying resources concurrently modified one by one.
+func removeReferences(ctx context.Context, database db.DB, filters []filter.ByResource, query string, remove func(resource *prop.Resource) error) error {
+	resources, err := database.Query(ctx, query, nil, nil, nil)
+	if err != nil {
+		return err
+	}
+
+	replacements := make([]db.Replacement, 0, len(resources))
+	for _, resource := range resources {
+		replacement, err := referenceRemoved(ctx, filters, resource, remove)
+		if err != nil {
+			return err
+		}
+		replacements = append(replacements, db.Replacement{Ref: resource, Replacement: replacement})
+	}
+
+	for i, err := range db.ReplaceMany(ctx, database, replacements) {
+		for attempt := 2; err != nil && errors.Is(err, spec.ErrConflict) && attempt <= cascadeAttempts; attempt++ {
+			var resource *prop.Resource
+			if resource, err = database.Get(ctx, replacements[i].Ref.IdOrEmpty(), nil); err == nil {
+				err = removeReference(ctx, database, filters, resource, remove)
+			}
+		}
+		if err != nil && !errors.Is(err, spec.ErrNotFound) {
+			return err
+		}
+	}
+	return nil
+}
+
+func removeReference(ctx context.Context, database db.DB, filters []filter.ByResource, ref *prop.Resource, remove func(resource *prop.Resource) error) error {
+	resource, err := referenceRemoved(ctx, filters, ref, remove)
+	if err != nil {
+		return err
+	}
+	return database.Replace(ctx, ref, resource)
+}
+
+// Returns the replacement of the resource with the reference removed, after the filters were run against it.
+func referenceRemoved(ctx context.Context, filters []filter.ByResource, ref *prop.Resource, remove func(resource *prop.Resource) error) (*prop.Resource, error) {
+	resource := ref.Clone()
+	if err := remove(resource); err != nil {
+		return nil, err
+	}
+	for _, f := range filters {
+		if err := f.FilterRef(ctx, resource, ref); err != nil {
+			return nil, err
+		}
+	}
+	return resource, nil
+}
@@ -0,0 +1,279 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/imulab/go-scim/pkg/v2/crud"
+	"github.com/imulab/go-scim/pkg/v2/db"
+	"github.com/imulab/go-scim/pkg/v2/prop"
+	"github.com/imulab/go-scim/pkg/v2/service/filter"
+	"github.com/imulab/go-scim/pkg/v2/spec"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestCascade(t *testing.T) {
+	s := new(CascadeTestSuite)
+	suite.Run(t, s)
+}
+
+type CascadeTestSuite struct {
+	suite.Suite
+	config            *spec.ServiceProviderConfig
+	userResourceType  *spec.ResourceType
+	groupResourceType *spec.ResourceType
+}
+
+func (s *CascadeTestSuite) TestDelete() {
+	tests := []struct {
+		name  string
+		queue Queue
+	}{
+		{name: "synchronous"},
+		{name: "asynchronous", queue: inlineQueue{}},
+	}
+
+	for _, test := range tests {
+		s.T().Run(test.name, func(t *testing.T) {
+			var (
+				users  = db.Memory()
+				groups = db.Memory()
+			)
+			s.insert(t, users, s.userResourceType, map[string]interface{}{
+				"schemas":  []interface{}{"urn:ietf:params:scim:schemas:core:2.0:User"},
+				"id":       "u1",
+				"userName": "u1",
+				"meta":     map[string]interface{}{"version": "W/\"1\""},
+			})
+			s.insert(t, users, s.userResourceType, map[string]interface{}{
+				"schemas":  []interface{}{"urn:ietf:params:scim:schemas:core:2.0:User"},
+				"id":       "u2",
+				"userName": "u2",
+				"meta":     map[string]interface{}{"version": "W/\"1\""},
+				"urn:ietf:params:scim:schemas:extension:enterprise:2.0:User": map[string]interface{}{
+					"manager": map[string]interface{}{"value": "u1"},
+				},
+			})
+			s.insert(t, groups, s.groupResourceType, map[string]interface{}{
+				"schemas":     []interface{}{"urn:ietf:params:scim:schemas:core:2.0:Group"},
+				"id":          "g1",
+				"displayName": "g1",
+				"meta":        map[string]interface{}{"version": "W/\"1\""},
+				"members": []interface{}{
+					map[string]interface{}{"value": "u1"},
+					map[string]interface{}{"value": "u2"},
+				},
+			})
+
+			svc := CascadeDeleteService(DeleteService(s.config, users), &Cascade{
+				Groups:       groups,
+				GroupFilters: []filter.ByResource{filter.MetaFilter()},
+				Users:        users,
+				UserFilters:  []filter.ByResource{filter.MetaFilter()},
+				Queue:        test.queue,
+			})
+			_, err := svc.Do(context.TODO(), &DeleteRequest{ResourceID: "u1"})
+			require.Nil(t, err)
+
+			group, err := groups.Get(context.TODO(), "g1", nil)
+			require.Nil(t, err)
+			assert.Equal(t, 1, group.Navigator().Dot("members").Current().CountChildren())
+			assert.Equal(t, "u2", group.Navigator().Dot("members").At(0).Dot("value").Current().Raw())
+			assert.NotEqual(t, `W/"1"`, group.MetaVersionOrEmpty())
+
+			user, err := users.Get(context.TODO(), "u2", nil)
+			require.Nil(t, err)
+			manager := user.Navigator().Dot("urn:ietf:params:scim:schemas:extension:enterprise:2.0:User").Dot("manager").Current()
+			assert.True(t, manager.IsUnassigned())
+			assert.NotEqual(t, `W/"1"`, user.MetaVersionOrEmpty())
+		})
+	}
+}
+
+func (s *CascadeTestSuite) TestDeleteInTransaction() {
+	var (
+		users  = db.Memory()
+		groups = db.Memory()
+	)
+	s.insert(s.T(), users, s.userResourceType, map[string]interface{}{
+		"schemas":  []interface{}{"urn:ietf:params:scim:schemas:core:2.0:User"},
+		"id":       "u1",
+		"userName": "u1",
+		"meta":     map[string]interface{}{"version": "W/\"1\""},
+	})
+	s.insert(s.T(), users, s.userResourceType, map[string]interface{}{
+		"schemas":  []interface{}{"urn:ietf:params:scim:schemas:core:2.0:User"},
+		"id":       "u2",
+		"userName": "u2",
+		"meta":     map[string]interface{}{"version": "W/\"1\""},
+		"urn:ietf:params:scim:schemas:extension:enterprise:2.0:User": map[string]interface{}{
+			"manager": map[string]interface{}{"value": "u1"},
+		},
+	})
+
+	svc := CascadeDeleteService(DeleteService(s.config, users), &Cascade{
+		Groups:      groups,
+		Users:       users,
+		UserFilters: []filter.ByResource{failingFilter{}},
+		Tx:          users,
+	})
+	resp, err := svc.Do(context.TODO(), &DeleteRequest{ResourceID: "u1"})
+	assert.Nil(s.T(), resp)
+	assert.NotNil(s.T(), err)
+
+	// The delete was rolled back along with the removal.
+	_, err = users.Get(context.TODO(), "u1", nil)
+	assert.Nil(s.T(), err)
+}
+
+func (s *CascadeTestSuite) TestDeleteRetriesModified() {
+	var (
+		users  = db.Memory()
+		groups = db.Memory()
+	)
+	s.insert(s.T(), users, s.userResourceType, map[string]interface{}{
+		"schemas":  []interface{}{"urn:ietf:params:scim:schemas:core:2.0:User"},
+		"id":       "u1",
+		"userName": "u1",
+		"meta":     map[string]interface{}{"version": "W/\"1\""},
+	})
+	s.insert(s.T(), groups, s.groupResourceType, map[string]interface{}{
+		"schemas":     []interface{}{"urn:ietf:params:scim:schemas:core:2.0:Group"},
+		"id":          "g1",
+		"displayName": "g1",
+		"meta":        map[string]interface{}{"version": "W/\"2\""},
+		"members": []interface{}{
+			map[string]interface{}{"value": "u1"},
+		},
+	})
+
+	svc := CascadeDeleteService(DeleteService(s.config, users), &Cascade{
+		Groups:       &staleQueryDB{DB: groups, version: `W/"1"`},
+		GroupFilters: []filter.ByResource{filter.MetaFilter()},
+	})
+	_, err := svc.Do(context.TODO(), &DeleteRequest{ResourceID: "u1"})
+	require.Nil(s.T(), err)
+
+	// The group queried at a stale version is read again, and its members are removed.
+	group, err := groups.Get(context.TODO(), "g1", nil)
+	require.Nil(s.T(), err)
+	assert.Equal(s.T(), 0, group.Navigator().Dot("members").Current().CountChildren())
+}
+
+// staleQueryDB queries resources of the version, as if they were modified since being queried.
+type staleQueryDB struct {
+	db.DB
+	version string
+}
+
+func (d *staleQueryDB) Query(ctx context.Context, filter string, sort *crud.Sort, pagination *crud.Pagination, projection *crud.Projection) ([]*prop.Resource, error) {
+	resources, err := d.DB.Query(ctx, filter, sort, pagination, projection)
+	if err != nil {
+		return nil, err
+	}
+	stale := make([]*prop.Resource, 0, len(resources))
+	for _, resource := range resources {
+		resource = resource.Clone()
+		if err := resource.Navigator().Dot("meta").Dot("version").Replace(d.version).Error(); err != nil {
+			return nil, err
+		}
+		stale = append(stale, resource)
+	}
+	return stale, nil
+}
+
+// failingFilter fails every resource.
+type failingFilter struct{}
+
+func (failingFilter) Filter(_ context.Context, _ *prop.Resource) error {
+	return spec.ErrInternal
+}
+
+func (failingFilter) FilterRef(_ context.Context, _ *prop.Resource, _ *prop.Resource) error {
+	return spec.ErrInternal
+}
+
+func (s *CascadeTestSuite) insert(t *testing.T, database db.DB, resourceType *spec.ResourceType, data map[string]interface{}) {
+	resource := prop.NewResource(resourceType)
+	require.False(t, resource.Navigator().Replace(data).HasError())
+	require.Nil(t, database.Insert(context.TODO(), resource))
+}
+
+func (s *CascadeTestSuite) SetupSuite() {
+	for _, each := range []struct {
+		filepath  string
+		structure interface{}
+		post      func(parsed interface{})
+	}{
+		{
+			filepath:  "../../../public/schemas/core_schema.json",
+			structure: new(spec.Schema),
+			post: func(parsed interface{}) {
+				spec.Schemas().Register(parsed.(*spec.Schema))
+			},
+		},
+		{
+			filepath:  "../../../public/schemas/user_schema.json",
+			structure: new(spec.Schema),
+			post: func(parsed interface{}) {
+				spec.Schemas().Register(parsed.(*spec.Schema))
+			},
+		},
+		{
+			filepath:  "../../../public/schemas/user_enterprise_extension_schema.json",
+			structure: new(spec.Schema),
+			post: func(parsed interface{}) {
+				spec.Schemas().Register(parsed.(*spec.Schema))
+			},
+		},
+		{
+			filepath:  "../../../public/resource_types/user_resource_type.json",
+			structure: new(spec.ResourceType),
+			post: func(parsed interface{}) {
+				s.userResourceType = parsed.(*spec.ResourceType)
+				crud.Register(s.userResourceType)
+			},
+		},
+		{
+			filepath:  "../../../public/schemas/group_schema.json",
+			structure: new(spec.Schema),
+			post: func(parsed interface{}) {
+				spec.Schemas().Register(parsed.(*spec.Schema))
+			},
+		},
+		{
+			filepath:  "../../../public/resource_types/group_resource_type.json",
+			structure: new(spec.ResourceType),
+			post: func(parsed interface{}) {
+				s.groupResourceType = parsed.(*spec.ResourceType)
+				crud.Register(s.groupResourceType)
+			},
+		},
+	} {
+		f, err := os.Open(each.filepath)
+		require.Nil(s.T(), err)
+
+		raw, err := ioutil.ReadAll(f)
+		require.Nil(s.T(), err)
+
+		err = json.Unmarshal(raw, each.structure)
+		require.Nil(s.T(), err)
+
+		if each.post != nil {
+			each.post(each.structure)
+		}
+	}
+
+	s.config = new(spec.ServiceProviderConfig)
+	require.Nil(s.T(), json.Unmarshal([]byte(`
+{
+  "patch": {
+    "supported": true
+  }
+}
+`), s.config))
+}
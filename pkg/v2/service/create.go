@@ -8,11 +8,12 @@ import (
 	"github.com/imulab/go-scim/pkg/v2/prop"
 	"github.com/imulab/go-scim/pkg/v2/service/filter"
 	"github.com/imulab/go-scim/pkg/v2/spec"
+	"github.com/imulab/go-scim/pkg/v2/trace"
 	"io"
-	"io/ioutil"
 )
 
-// Create returns a create resource service.
+// Create returns a create resource service. Dry run requests are parsed and filtered, hence validated, like others, but
+// the resource is not inserted into the database, and the OnAfterCreate hook is not called.
 func CreateService(resourceType *spec.ResourceType, database db.DB, filters []filter.ByResource) Create {
 	return &createService{
 		resourceType: resourceType,
@@ -21,6 +22,17 @@ func CreateService(resourceType *spec.ResourceType, database db.DB, filters []fi
 	}
 }
 
+// CreateServiceWithHooks returns a create resource service like CreateService, except that the OnBeforeCreate and
+// OnAfterCreate hooks are called around the creation (see Hooks).
+func CreateServiceWithHooks(resourceType *spec.ResourceType, database db.DB, filters []filter.ByResource, hooks *Hooks) Create {
+	return &createService{
+		resourceType: resourceType,
+		filters:      filters,
+		database:     database,
+		hooks:        hooks,
+	}
+}
+
 type (
 	// Create resource service
 	Create interface {
@@ -28,11 +40,16 @@ type (
 	}
 	// Create resource request
 	CreateRequest struct {
-		PayloadSource io.Reader // reader source to read resource payload from
+		PayloadSource  io.Reader      // reader source to read resource payload from
+		Resource       *prop.Resource // resource to create instead of the payload, i.e. decoded from protobuf
+		IdempotencyKey string         // optional key to deduplicate retried requests, see IdempotentCreateService
+		DryRun         bool           // only validate the resource, running the filters, but do not persist it
 	}
 	// Create resource response
 	CreateResponse struct {
 		Resource *prop.Resource // the created resource
+		Replayed bool           // true if the resource was created by an earlier request with the same idempotency key
+		DryRun   bool           // true if the resource would have been created, but was not persisted
 	}
 )
 
@@ -40,40 +57,57 @@ type createService struct {
 	resourceType *spec.ResourceType
 	filters      []filter.ByResource
 	database     db.DB
+	hooks        *Hooks
 }
 
 func (s *createService) Do(ctx context.Context, req *CreateRequest) (resp *CreateResponse, err error) {
-	resource, err := s.parseResource(req)
+	resource, err := s.parseResource(ctx, req)
 	if err != nil {
 		return
 	}
 
+	if err = s.hooks.beforeCreate(ctx, resource); err != nil {
+		return
+	}
+
 	for _, f := range s.filters {
 		if err = f.Filter(ctx, resource); err != nil {
 			return
 		}
 	}
 
+	if req.DryRun {
+		resp = &CreateResponse{Resource: resource, DryRun: true}
+		return
+	}
+
 	if err = s.database.Insert(ctx, resource); err != nil {
 		return
 	}
 
 	resp = &CreateResponse{Resource: resource}
+	err = s.hooks.afterCreate(ctx, resource)
 	return
 }
 
-func (s *createService) parseResource(req *CreateRequest) (*prop.Resource, error) {
+func (s *createService) parseResource(ctx context.Context, req *CreateRequest) (*prop.Resource, error) {
+	if req != nil && req.Resource != nil {
+		return requestResource(s.resourceType, req.Resource)
+	}
 	if req == nil || req.PayloadSource == nil {
 		return nil, fmt.Errorf("%w: no payload for create service", spec.ErrInternal)
 	}
 
-	raw, err := ioutil.ReadAll(req.PayloadSource)
+	raw, err := readPayload(req.PayloadSource)
 	if err != nil {
-		return nil, fmt.Errorf("%w: failed to read request body", spec.ErrInternal)
+		return nil, err
 	}
 
 	resource := prop.NewResource(s.resourceType)
-	if err := json.Deserialize(raw, resource); err != nil {
+	_, end := trace.Start(ctx, trace.Deserialize)
+	err = json.Deserialize(raw, resource)
+	end(err)
+	if err != nil {
 		return nil, err
 	}
 
@@ -9,11 +9,13 @@ import (
 	"github.com/imulab/go-scim/pkg/v2/prop"
 	"github.com/imulab/go-scim/pkg/v2/service/filter"
 	"github.com/imulab/go-scim/pkg/v2/spec"
+	"github.com/imulab/go-scim/pkg/v2/tenant"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"github.com/stretchr/testify/suite"
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 )
@@ -163,6 +165,210 @@ func (s *CreateServiceTestSuite) TestDo() {
 	}
 }
 
+func (s *CreateServiceTestSuite) TestDoDryRun() {
+	database := db.Memory()
+	service := CreateService(s.resourceType, database, []filter.ByResource{
+		filter.ByPropertyToByResource(
+			filter.ReadOnlyFilter(),
+			filter.UUIDFilter(),
+		),
+		filter.MetaFilter(),
+		filter.ByPropertyToByResource(filter.ValidationFilter(database)),
+	})
+
+	resp, err := service.Do(context.TODO(), &CreateRequest{
+		PayloadSource: strings.NewReader(`{"schemas": ["urn:ietf:params:scim:schemas:core:2.0:User"], "userName": "foo", "emails": [{"value": "foo@bar.com"}]}`),
+		DryRun:        true,
+	})
+	require.Nil(s.T(), err)
+	assert.True(s.T(), resp.DryRun)
+	assert.NotEmpty(s.T(), resp.Resource.IdOrEmpty())
+	assert.NotEmpty(s.T(), resp.Resource.MetaVersionOrEmpty())
+
+	n, err := database.Count(context.TODO(), "")
+	assert.Nil(s.T(), err)
+	assert.Equal(s.T(), 0, n)
+
+	// validation still applies
+	_, err = service.Do(context.TODO(), &CreateRequest{
+		PayloadSource: strings.NewReader(`{"schemas": ["urn:ietf:params:scim:schemas:core:2.0:User"], "userName": "foo"}`),
+		DryRun:        true,
+	})
+	assert.True(s.T(), errors.Is(err, spec.ErrInvalidValue))
+}
+
+func (s *CreateServiceTestSuite) TestDoResource() {
+	database := db.Memory()
+	service := CreateService(s.resourceType, database, []filter.ByResource{
+		filter.ByPropertyToByResource(
+			filter.ReadOnlyFilter(),
+			filter.UUIDFilter(),
+		),
+		filter.MetaFilter(),
+		filter.ByPropertyToByResource(filter.ValidationFilter(database)),
+	})
+
+	resource := prop.NewResource(s.resourceType)
+	require.Nil(s.T(), resource.Navigator().Replace(map[string]interface{}{
+		"schemas":  []interface{}{"urn:ietf:params:scim:schemas:core:2.0:User"},
+		"userName": "foo",
+		"emails":   []interface{}{map[string]interface{}{"value": "foo@bar.com"}},
+	}).Error())
+
+	resp, err := service.Do(context.TODO(), &CreateRequest{Resource: resource})
+	require.Nil(s.T(), err)
+	assert.Equal(s.T(), resource, resp.Resource)
+	assert.NotEmpty(s.T(), resp.Resource.IdOrEmpty())
+
+	n, err := database.Count(context.TODO(), "")
+	assert.Nil(s.T(), err)
+	assert.Equal(s.T(), 1, n)
+
+	// resources of other resource types are rejected
+	other := new(spec.ResourceType)
+	require.Nil(s.T(), json.Unmarshal([]byte(`{"id": "Other", "name": "Other", "endpoint": "/Others", "schema": "urn:ietf:params:scim:schemas:core:2.0:User"}`), other))
+	_, err = service.Do(context.TODO(), &CreateRequest{Resource: prop.NewResource(other)})
+	assert.True(s.T(), errors.Is(err, spec.ErrInvalidValue))
+}
+
+func (s *CreateServiceTestSuite) TestDoWithTenants() {
+	database := db.TenantDB(func(_ context.Context, _ string) (db.DB, error) {
+		return db.Memory(), nil
+	})
+	service := CreateService(s.resourceType, database, []filter.ByResource{
+		filter.ByPropertyToByResource(
+			filter.ReadOnlyFilter(),
+			filter.UUIDFilter(),
+		),
+		filter.MetaFilter(),
+		filter.ByPropertyToByResource(filter.ValidationFilter(database)),
+	})
+	create := func(ctx context.Context) (*CreateResponse, error) {
+		return service.Do(ctx, &CreateRequest{
+			PayloadSource: strings.NewReader(`{"schemas": ["urn:ietf:params:scim:schemas:core:2.0:User"], "userName": "foo", "emails": [{"value": "foo@bar.com"}]}`),
+		})
+	}
+
+	acme := tenant.With(context.TODO(), "acme")
+	resp, err := create(acme)
+	require.Nil(s.T(), err)
+
+	// userName is unique within the tenant only
+	_, err = create(acme)
+	assert.True(s.T(), errors.Is(err, spec.ErrUniqueness))
+	_, err = create(tenant.With(context.TODO(), "globex"))
+	assert.Nil(s.T(), err)
+
+	// resources of other tenants are invisible
+	_, err = database.Get(tenant.With(context.TODO(), "globex"), resp.Resource.IdOrEmpty(), nil)
+	assert.True(s.T(), errors.Is(err, spec.ErrNotFound))
+
+	_, err = create(context.TODO())
+	assert.True(s.T(), errors.Is(err, spec.ErrInternal))
+}
+
+func (s *CreateServiceTestSuite) TestDoPersisted() {
+	dir, err := ioutil.TempDir("", "scim")
+	require.Nil(s.T(), err)
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+
+	open := func() (db.DB, Create) {
+		database, err := db.PersistentMemory(s.resourceType, db.PersistenceOptions{Dir: dir, Indexes: []string{"userName"}})
+		require.Nil(s.T(), err)
+		return database, CreateService(s.resourceType, database, []filter.ByResource{
+			filter.ByPropertyToByResource(
+				filter.ReadOnlyFilter(),
+				filter.UUIDFilter(),
+				filter.BCryptFilter(),
+			),
+			filter.MetaFilter(),
+			filter.ByPropertyToByResource(filter.ValidationFilter(database)),
+		})
+	}
+	create := func(ctx context.Context, service Create, userName string) (*CreateResponse, error) {
+		return service.Do(ctx, &CreateRequest{
+			PayloadSource: strings.NewReader(`{"schemas": ["urn:ietf:params:scim:schemas:core:2.0:User"], "userName": "` + userName + `", "password": "s3cret", "emails": [{"value": "` + userName + `@bar.com"}]}`),
+		})
+	}
+
+	database, service := open()
+	foo, err := create(context.TODO(), service, "foo")
+	require.Nil(s.T(), err)
+	err = db.WithTx(context.TODO(), database, func(ctx context.Context) error {
+		if _, err := create(ctx, service, "bar"); err != nil {
+			return err
+		}
+		_, err := create(ctx, service, "rolled back")
+		require.Nil(s.T(), err)
+		return errors.New("rollback")
+	})
+	require.NotNil(s.T(), err)
+	_, err = create(context.TODO(), service, "bar")
+	require.Nil(s.T(), err)
+	require.Nil(s.T(), database.(db.SnapshotDB).Close())
+
+	// writes fail once closed
+	_, err = create(context.TODO(), service, "baz")
+	assert.True(s.T(), errors.Is(err, spec.ErrInternal))
+
+	// resources are restored from the log, including attributes never returned
+	database, service = open()
+	n, err := database.Count(context.TODO(), "")
+	require.Nil(s.T(), err)
+	assert.Equal(s.T(), 2, n)
+	restored, err := database.Get(context.TODO(), foo.Resource.IdOrEmpty(), nil)
+	require.Nil(s.T(), err)
+	assert.Equal(s.T(), foo.Resource.MetaVersionOrEmpty(), restored.MetaVersionOrEmpty())
+	assert.NotEmpty(s.T(), restored.Navigator().Dot("password").Current().Raw())
+	_, err = create(context.TODO(), service, "foo")
+	assert.True(s.T(), errors.Is(err, spec.ErrUniqueness))
+
+	// and from the snapshot, which empties the log
+	require.Nil(s.T(), db.Snapshot(context.TODO(), database))
+	info, err := os.Stat(filepath.Join(dir, db.LogFile))
+	require.Nil(s.T(), err)
+	assert.Equal(s.T(), int64(0), info.Size())
+	require.Nil(s.T(), database.Delete(context.TODO(), restored))
+	_, err = create(context.TODO(), service, "baz")
+	require.Nil(s.T(), err)
+	require.Nil(s.T(), database.(db.SnapshotDB).Close())
+
+	// a last line partially written is discarded
+	log, err := os.OpenFile(filepath.Join(dir, db.LogFile), os.O_WRONLY|os.O_APPEND, 0600)
+	require.Nil(s.T(), err)
+	_, err = log.WriteString(`{"type":"delete","id":"`)
+	require.Nil(s.T(), err)
+	require.Nil(s.T(), log.Close())
+
+	database, service = open()
+	for _, each := range []struct {
+		filter string
+		count  int
+	}{
+		{filter: `userName eq "foo"`, count: 0},
+		{filter: `userName eq "bar"`, count: 1},
+		{filter: `userName eq "baz"`, count: 1},
+	} {
+		n, err := database.Count(context.TODO(), each.filter)
+		require.Nil(s.T(), err)
+		assert.Equal(s.T(), each.count, n, each.filter)
+	}
+	_, err = create(context.TODO(), service, "foo")
+	require.Nil(s.T(), err)
+	require.Nil(s.T(), database.(db.SnapshotDB).Close())
+
+	// while other lines that cannot be read fail the restore
+	log, err = os.OpenFile(filepath.Join(dir, db.LogFile), os.O_WRONLY|os.O_APPEND, 0600)
+	require.Nil(s.T(), err)
+	_, err = log.WriteString("{\"type\":\n")
+	require.Nil(s.T(), err)
+	require.Nil(s.T(), log.Close())
+	_, err = db.PersistentMemory(s.resourceType, db.PersistenceOptions{Dir: dir})
+	assert.True(s.T(), errors.Is(err, spec.ErrInternal))
+}
+
 func (s *CreateServiceTestSuite) SetupSuite() {
 	for _, each := range []struct {
 		filepath  string
@@ -16,6 +16,16 @@ func DeleteService(config *spec.ServiceProviderConfig, database db.DB) Delete {
 	}
 }
 
+// DeleteServiceWithHooks returns a delete resource service like DeleteService, except that the OnBeforeDelete and
+// OnAfterDelete hooks are called around the deletion (see Hooks).
+func DeleteServiceWithHooks(config *spec.ServiceProviderConfig, database db.DB, hooks *Hooks) Delete {
+	return &deleteService{
+		Database: database,
+		Config:   config,
+		hooks:    hooks,
+	}
+}
+
 type (
 	// Delete resource service
 	Delete interface {
@@ -25,6 +35,7 @@ type (
 	DeleteRequest struct {
 		ResourceID    string                             // id of the resource to be deleted
 		MatchCriteria func(resource *prop.Resource) bool // extra criteria the resource has to meet in order to be deleted
+		Version       string                             // version the resource has to be of, i.e. from If-Match, or db.AnyVersion
 	}
 	// Delete resource response
 	DeleteResponse struct {
@@ -35,6 +46,7 @@ type (
 type deleteService struct {
 	Database db.DB
 	Config   *spec.ServiceProviderConfig
+	hooks    *Hooks
 }
 
 func (s *deleteService) Do(ctx context.Context, req *DeleteRequest) (resp *DeleteResponse, err error) {
@@ -50,11 +62,26 @@ func (s *deleteService) Do(ctx context.Context, req *DeleteRequest) (resp *Delet
 		}
 	}
 
-	err = s.Database.Delete(ctx, resource)
+	if s.Config.ETag.Supported && len(req.Version) > 0 {
+		if err = db.MatchVersion(resource, req.Version); err != nil {
+			return
+		}
+	}
+
+	if err = s.hooks.beforeDelete(ctx, resource); err != nil {
+		return
+	}
+
+	if s.Config.ETag.Supported && len(req.Version) > 0 {
+		err = db.DeleteIfMatch(ctx, s.Database, resource, req.Version)
+	} else {
+		err = s.Database.Delete(ctx, resource)
+	}
 	if err != nil {
 		return
 	}
 
 	resp = &DeleteResponse{Deleted: resource}
+	err = s.hooks.afterDelete(ctx, resource)
 	return
 }
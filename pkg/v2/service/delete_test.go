@@ -67,6 +67,77 @@ func (s *DeleteServiceTestSuite) TestDo() {
 				assert.Equal(t, spec.ErrNotFound, errors.Unwrap(err))
 			},
 		},
+		{
+			name: "delete of expected version",
+			setup: func(t *testing.T) Delete {
+				database := db.Memory()
+				err := database.Insert(context.TODO(), s.resourceOf(t, map[string]interface{}{
+					"id":   "foobar",
+					"meta": map[string]interface{}{"version": `W/"1"`},
+				}))
+				require.Nil(t, err)
+				return DeleteService(s.etagConfig(), database)
+			},
+			getRequest: func() *DeleteRequest {
+				return &DeleteRequest{
+					ResourceID: "foobar",
+					Version:    `W/"1"`,
+				}
+			},
+			expect: func(t *testing.T, err error) {
+				assert.Nil(t, err)
+			},
+		},
+		{
+			name: "delete of other version",
+			setup: func(t *testing.T) Delete {
+				database := db.Memory()
+				err := database.Insert(context.TODO(), s.resourceOf(t, map[string]interface{}{
+					"id":   "foobar",
+					"meta": map[string]interface{}{"version": `W/"2"`},
+				}))
+				require.Nil(t, err)
+				return DeleteService(s.etagConfig(), database)
+			},
+			getRequest: func() *DeleteRequest {
+				return &DeleteRequest{
+					ResourceID: "foobar",
+					Version:    `W/"1"`,
+				}
+			},
+			expect: func(t *testing.T, err error) {
+				assert.True(t, errors.Is(err, spec.ErrConflict))
+				var conflictErr *db.ConflictError
+				require.True(t, errors.As(err, &conflictErr))
+				assert.Equal(t, "foobar", conflictErr.ID)
+				assert.Equal(t, `W/"1"`, conflictErr.Expected)
+				assert.Equal(t, `W/"2"`, conflictErr.Actual)
+			},
+		},
+		{
+			name: "delete of resource modified since read",
+			setup: func(t *testing.T) Delete {
+				database := db.Memory()
+				err := database.Insert(context.TODO(), s.resourceOf(t, map[string]interface{}{
+					"id":   "foobar",
+					"meta": map[string]interface{}{"version": `W/"2"`},
+				}))
+				require.Nil(t, err)
+				return DeleteService(s.etagConfig(), &staleDB{DB: database, version: `W/"1"`})
+			},
+			getRequest: func() *DeleteRequest {
+				return &DeleteRequest{
+					ResourceID: "foobar",
+					Version:    `W/"1"`,
+				}
+			},
+			expect: func(t *testing.T, err error) {
+				var conflictErr *db.ConflictError
+				require.True(t, errors.As(err, &conflictErr))
+				assert.Equal(t, `W/"1"`, conflictErr.Expected)
+				assert.Empty(t, conflictErr.Actual)
+			},
+		},
 	}
 
 	for _, test := range tests {
@@ -78,6 +149,12 @@ func (s *DeleteServiceTestSuite) TestDo() {
 	}
 }
 
+func (s *DeleteServiceTestSuite) etagConfig() *spec.ServiceProviderConfig {
+	config := new(spec.ServiceProviderConfig)
+	config.ETag.Supported = true
+	return config
+}
+
 func (s *DeleteServiceTestSuite) resourceOf(t *testing.T, data interface{}) *prop.Resource {
 	r := prop.NewResource(s.resourceType)
 	require.Nil(t, r.Navigator().Replace(data).Error())
@@ -134,3 +211,20 @@ func (s *DeleteServiceTestSuite) SetupSuite() {
 		}
 	}
 }
+
+// staleDB returns resources of the version, as if they were read before being modified to their stored version.
+type staleDB struct {
+	db.DB
+	version string
+}
+
+func (d *staleDB) Get(ctx context.Context, id string, projection *crud.Projection) (*prop.Resource, error) {
+	resource, err := d.DB.Get(ctx, id, projection)
+	if err != nil {
+		return nil, err
+	}
+	if err := resource.Navigator().Dot("meta").Dot("version").Replace(d.version).Error(); err != nil {
+		return nil, err
+	}
+	return resource, nil
+}
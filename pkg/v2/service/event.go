@@ -0,0 +1,82 @@
+package service
+
+import (
+	"context"
+	"github.com/imulab/go-scim/pkg/v2/event"
+	"github.com/imulab/go-scim/pkg/v2/prop"
+	"github.com/imulab/go-scim/pkg/v2/tenant"
+	"github.com/satori/go.uuid"
+	"time"
+)
+
+// EventInterceptor returns an Interceptor that publishes an event to the sink for every resource created, replaced,
+// patched or deleted through the services it wraps (see Interceptors). Like HistoryInterceptor, calls that fail, that
+// do not change the resource, or that are dry runs, do not emit events.
+//
+// Events are published after the change is made to the database. Errors publishing the event are returned to the
+// caller, although the change has been made; to not lose events when the sink is unavailable, publish them to an
+// event.Outbox, and relay them to the sink with event.Relay.
+func EventInterceptor(sink event.Sink) Interceptor {
+	return &eventInterceptor{sink: sink}
+}
+
+type eventInterceptor struct {
+	sink event.Sink
+}
+
+func (i *eventInterceptor) Before(ctx context.Context, _ *Invocation) (context.Context, error) {
+	return ctx, nil
+}
+
+func (i *eventInterceptor) After(ctx context.Context, inv *Invocation, err error) error {
+	if err != nil {
+		return err
+	}
+
+	var (
+		resource *prop.Resource
+		e        = &event.Event{
+			ID:        uuid.NewV4().String(),
+			Tenant:    tenant.From(ctx),
+			Operation: inv.Operation,
+			Time:      time.Now().UTC(),
+		}
+	)
+	switch resp := inv.Response.(type) {
+	case *CreateResponse:
+		if resp.DryRun {
+			return nil
+		}
+		resource = resp.Resource
+	case *ReplaceResponse:
+		if !resp.Replaced || resp.DryRun {
+			return nil
+		}
+		resource = resp.Resource
+		e.Diff = ChangedPaths(resp.Ref, resp.Resource)
+	case *PatchResponse:
+		if !resp.Patched || resp.DryRun {
+			return nil
+		}
+		resource = resp.Resource
+		e.Diff = ChangedPaths(resp.Ref, resp.Resource)
+	case *DeleteResponse:
+		resource = resp.Deleted
+	default:
+		return nil
+	}
+
+	e.ResourceID = resource.IdOrEmpty()
+	e.ResourceType = resource.ResourceType().ID()
+	e.Endpoint = resource.ResourceType().Endpoint()
+	if inv.Operation != OpDelete {
+		e.Version = resource.MetaVersionOrEmpty()
+		if nav := resource.Navigator().Dot("active"); !nav.HasError() {
+			if active, ok := nav.Current().Raw().(bool); ok {
+				e.Active = &active
+			}
+		}
+	}
+
+	return i.sink.Publish(ctx, e)
+}
@@ -0,0 +1,179 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/imulab/go-scim/pkg/v2/crud"
+	"github.com/imulab/go-scim/pkg/v2/db"
+	"github.com/imulab/go-scim/pkg/v2/event"
+	"github.com/imulab/go-scim/pkg/v2/service/filter"
+	"github.com/imulab/go-scim/pkg/v2/spec"
+	"github.com/imulab/go-scim/pkg/v2/tenant"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestEvent(t *testing.T) {
+	s := new(EventTestSuite)
+	suite.Run(t, s)
+}
+
+type EventTestSuite struct {
+	suite.Suite
+	config       *spec.ServiceProviderConfig
+	resourceType *spec.ResourceType
+}
+
+func (s *EventTestSuite) TestEvent() {
+	var (
+		ctx      = tenant.With(context.TODO(), "acme")
+		database = db.Memory()
+		outbox   = event.MemoryOutbox()
+		chain    = Interceptors(EventInterceptor(outbox))
+		create   = chain.Create(s.resourceType, CreateService(s.resourceType, database, []filter.ByResource{
+			filter.ByPropertyToByResource(filter.UUIDFilter()),
+			filter.MetaFilter(),
+		}))
+		replace = chain.Replace(s.resourceType, ReplaceService(s.config, s.resourceType, database, []filter.ByResource{
+			filter.ByPropertyToByResource(filter.ReadOnlyFilter()),
+			filter.MetaFilter(),
+		}))
+		patch = chain.Patch(s.resourceType, PatchService(s.config, database, nil, []filter.ByResource{
+			filter.MetaFilter(),
+		}))
+		del = chain.Delete(s.resourceType, DeleteService(s.config, database))
+	)
+
+	created, err := create.Do(ctx, &CreateRequest{PayloadSource: strings.NewReader(`
+{
+  "schemas": ["urn:ietf:params:scim:schemas:core:2.0:User"],
+  "userName": "foo"
+}`)})
+	require.Nil(s.T(), err)
+	id := created.Resource.IdOrEmpty()
+
+	// a dry run emits no event
+	_, err = create.Do(ctx, &CreateRequest{DryRun: true, PayloadSource: strings.NewReader(`
+{
+  "schemas": ["urn:ietf:params:scim:schemas:core:2.0:User"],
+  "userName": "bar"
+}`)})
+	require.Nil(s.T(), err)
+
+	_, err = replace.Do(ctx, &ReplaceRequest{ResourceID: id, PayloadSource: strings.NewReader(`
+{
+  "schemas": ["urn:ietf:params:scim:schemas:core:2.0:User"],
+  "userName": "foo",
+  "name": {
+    "givenName": "Foo"
+  }
+}`)})
+	require.Nil(s.T(), err)
+
+	patchPayload := `{"schemas":["urn:ietf:params:scim:api:messages:2.0:PatchOp"],"Operations":[{"op":"add","path":"displayName","value":"Foo"}]}`
+	_, err = patch.Do(ctx, &PatchRequest{ResourceID: id, PayloadSource: strings.NewReader(patchPayload)})
+	require.Nil(s.T(), err)
+
+	// a patch that changes nothing emits no event
+	_, err = patch.Do(ctx, &PatchRequest{ResourceID: id, PayloadSource: strings.NewReader(patchPayload)})
+	require.Nil(s.T(), err)
+
+	_, err = del.Do(ctx, &DeleteRequest{ResourceID: id})
+	require.Nil(s.T(), err)
+
+	ch := make(chan *event.Event, 10)
+	n, err := event.Relay(ctx, outbox, event.ChannelSink(ch), 0)
+	require.Nil(s.T(), err)
+	require.Equal(s.T(), 4, n)
+	close(ch)
+
+	var events []*event.Event
+	for e := range ch {
+		events = append(events, e)
+	}
+	var operations []string
+	for _, e := range events {
+		operations = append(operations, e.Operation)
+		assert.NotEmpty(s.T(), e.ID)
+		assert.Equal(s.T(), "acme", e.Tenant)
+		assert.Equal(s.T(), id, e.ResourceID)
+		assert.Equal(s.T(), "User", e.ResourceType)
+		assert.Equal(s.T(), "/Users", e.Endpoint)
+	}
+	assert.Equal(s.T(), []string{OpCreate, OpReplace, OpPatch, OpDelete}, operations)
+
+	assert.Equal(s.T(), created.Resource.MetaVersionOrEmpty(), events[0].Version)
+	assert.Contains(s.T(), events[1].Diff, "name.givenName")
+	assert.NotContains(s.T(), events[1].Diff, "userName")
+	assert.Contains(s.T(), events[2].Diff, "displayName")
+	assert.Empty(s.T(), events[3].Version)
+
+	pending, err := outbox.Pending(ctx, 10)
+	assert.Nil(s.T(), err)
+	assert.Empty(s.T(), pending)
+}
+
+func (s *EventTestSuite) SetupSuite() {
+	for _, each := range []struct {
+		filepath  string
+		structure interface{}
+		post      func(parsed interface{})
+	}{
+		{
+			filepath:  "../../../public/schemas/core_schema.json",
+			structure: new(spec.Schema),
+			post: func(parsed interface{}) {
+				spec.Schemas().Register(parsed.(*spec.Schema))
+			},
+		},
+		{
+			filepath:  "../../../public/schemas/user_schema.json",
+			structure: new(spec.Schema),
+			post: func(parsed interface{}) {
+				spec.Schemas().Register(parsed.(*spec.Schema))
+			},
+		},
+		{
+			filepath:  "../../../public/schemas/user_enterprise_extension_schema.json",
+			structure: new(spec.Schema),
+			post: func(parsed interface{}) {
+				spec.Schemas().Register(parsed.(*spec.Schema))
+			},
+		},
+		{
+			filepath:  "../../../public/resource_types/user_resource_type.json",
+			structure: new(spec.ResourceType),
+			post: func(parsed interface{}) {
+				s.resourceType = parsed.(*spec.ResourceType)
+				crud.Register(s.resourceType)
+			},
+		},
+	} {
+		f, err := os.Open(each.filepath)
+		require.Nil(s.T(), err)
+
+		raw, err := ioutil.ReadAll(f)
+		require.Nil(s.T(), err)
+
+		err = json.Unmarshal(raw, each.structure)
+		require.Nil(s.T(), err)
+
+		if each.post != nil {
+			each.post(each.structure)
+		}
+	}
+
+	s.config = new(spec.ServiceProviderConfig)
+	require.Nil(s.T(), json.Unmarshal([]byte(`
+{
+  "patch": {
+    "supported": true
+  }
+}
+`), s.config))
+}
@@ -76,10 +76,8 @@ func (f bCryptPropertyFilter) bCryptAndReplace(nav prop.Navigator) error {
 		panic("unsupported type")
 	}
 
-	var cost int
-	params, _ := attr.Annotation(annotation.BCrypt)
-	cost, err := strconv.Atoi(fmt.Sprintf("%v", params["cost"]))
-	if err != nil || cost < 1 {
+	cost := bcryptCost(attr)
+	if cost < 1 {
 		cost = 10
 	}
 
@@ -101,3 +99,16 @@ func (f bCryptPropertyFilter) bCryptAndReplace(nav prop.Navigator) error {
 	_, err = nav.Current().Replace(replacement)
 	return err
 }
+
+// bcryptCost returns the cost of the @BCrypt annotation of the attribute, or 0 if it is not set or not positive.
+func bcryptCost(attr *spec.Attribute) int {
+	params, ok := attr.Annotation(annotation.BCrypt)
+	if !ok {
+		return 0
+	}
+	cost, err := strconv.Atoi(fmt.Sprintf("%v", params["cost"]))
+	if err != nil || cost < 1 {
+		return 0
+	}
+	return cost
+}
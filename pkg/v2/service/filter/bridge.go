@@ -2,7 +2,9 @@ package filter
 
 import (
 	"context"
+	"errors"
 	"github.com/imulab/go-scim/pkg/v2/prop"
+	"github.com/imulab/go-scim/pkg/v2/spec"
 )
 
 // ByPropertyToByResource returns a ByResource that iterates each property in the resource using a DFS visitor
@@ -23,3 +25,75 @@ func (f bridgeResourceFilter) Filter(ctx context.Context, resource *prop.Resourc
 func (f bridgeResourceFilter) FilterRef(ctx context.Context, resource *prop.Resource, ref *prop.Resource) error {
 	return VisitWithRef(ctx, resource, ref, f.byPropertyFilters...)
 }
+
+// ByPropertyToByResourceCollectingErrors returns a ByResource like ByPropertyToByResource, except that it does not stop
+// at the first property failing a filter with an error of the client (i.e. a spec.Error of status 4xx), but visits all
+// properties and returns all such errors as spec.Errors, so that, for instance, all validation violations of a resource
+// are reported at once. The remaining filters of a failed property are skipped. Other errors abort the visit as usual.
+func ByPropertyToByResourceCollectingErrors(filters ...ByProperty) ByResource {
+	return collectingResourceFilter{byPropertyFilters: filters}
+}
+
+type collectingResourceFilter struct {
+	byPropertyFilters []ByProperty
+}
+
+func (f collectingResourceFilter) Filter(ctx context.Context, resource *prop.Resource) error {
+	c := &collectingPropertyFilter{filters: f.byPropertyFilters}
+	if err := Visit(ctx, resource, c); err != nil {
+		return err
+	}
+	return c.errs.AsError()
+}
+
+func (f collectingResourceFilter) FilterRef(ctx context.Context, resource *prop.Resource, ref *prop.Resource) error {
+	c := &collectingPropertyFilter{filters: f.byPropertyFilters}
+	if err := VisitWithRef(ctx, resource, ref, c); err != nil {
+		return err
+	}
+	return c.errs.AsError()
+}
+
+// collectingPropertyFilter runs the filters on a property, collecting client errors.
+type collectingPropertyFilter struct {
+	filters []ByProperty
+	errs    spec.Errors
+}
+
+func (c *collectingPropertyFilter) Supports(attribute *spec.Attribute) bool {
+	for _, filter := range c.filters {
+		if filter.Supports(attribute) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *collectingPropertyFilter) Filter(ctx context.Context, resourceType *spec.ResourceType, nav prop.Navigator) error {
+	return c.each(nav, func(filter ByProperty) error {
+		return filter.Filter(ctx, resourceType, nav)
+	})
+}
+
+func (c *collectingPropertyFilter) FilterRef(ctx context.Context, resourceType *spec.ResourceType, nav prop.Navigator, refNav prop.Navigator) error {
+	return c.each(nav, func(filter ByProperty) error {
+		return filter.FilterRef(ctx, resourceType, nav, refNav)
+	})
+}
+
+func (c *collectingPropertyFilter) each(nav prop.Navigator, run func(filter ByProperty) error) error {
+	for _, filter := range c.filters {
+		if !filter.Supports(nav.Current().Attribute()) {
+			continue
+		}
+		if err := run(filter); err != nil {
+			var scimErr *spec.Error
+			if errors.As(err, &scimErr) && scimErr.Status < 500 {
+				c.errs = append(c.errs, err)
+				return nil
+			}
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+package filter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/imulab/go-scim/pkg/v2/annotation"
+	"github.com/imulab/go-scim/pkg/v2/crud"
+	"github.com/imulab/go-scim/pkg/v2/db"
+	"github.com/imulab/go-scim/pkg/v2/prop"
+	"github.com/imulab/go-scim/pkg/v2/spec"
+	"regexp"
+)
+
+// ClientIDFormat is the default format of ids supplied by clients for ClientIDFilter: up to 128 characters that can
+// be used in the resource URL without escaping.
+var ClientIDFormat = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._~-]{0,127}$`)
+
+// ClientIDFilter returns a ByProperty filter that validates the value supplied by the client for the string property
+// annotated with @UUID, i.e. the id, when a resource is created. The value must match the format, or ClientIDFormat
+// when format is nil, must not be the reserved keyword "bulkId" (RFC 7643 Section 3.1), and must not be the id of a
+// resource in the database already. Otherwise, an error of spec.ErrInvalidValue, or of spec.ErrUniqueness, is returned.
+// Unassigned properties are left to UUIDFilter, and the property is not checked when there is a reference, as the id
+// cannot be changed.
+//
+// By default, ids supplied by clients are reset by ReadOnlyFilter. Use ReadOnlyFilterRetainingClientID instead, and
+// this filter before UUIDFilter, to honor them, i.e. to migrate resources from another system preserving their ids.
+func ClientIDFilter(database db.DB, format *regexp.Regexp) ByProperty {
+	if format == nil {
+		format = ClientIDFormat
+	}
+	return &clientIDPropertyFilter{database: database, format: format}
+}
+
+type clientIDPropertyFilter struct {
+	database db.DB
+	format   *regexp.Regexp
+}
+
+func (f *clientIDPropertyFilter) Supports(attribute *spec.Attribute) bool {
+	_, ok := attribute.Annotation(annotation.UUID)
+	if !ok {
+		return false
+	}
+	return !attribute.MultiValued() && attribute.Type() == spec.TypeString
+}
+
+func (f *clientIDPropertyFilter) Filter(ctx context.Context, _ *spec.ResourceType, nav prop.Navigator) error {
+	if nav.HasError() {
+		return nav.Error()
+	}
+
+	if nav.Current().IsUnassigned() {
+		return nil
+	}
+
+	id, _ := nav.Current().Raw().(string)
+	if id == "bulkId" || !f.format.MatchString(id) {
+		return fmt.Errorf("%w: '%s' is not a valid value of '%s'", spec.ErrInvalidValue, id, nav.Current().Attribute().Path())
+	}
+
+	_, err := f.database.Get(ctx, id, &crud.Projection{Attributes: []string{"id"}})
+	switch {
+	case err == nil:
+		return fmt.Errorf("%w: a resource of id '%s' already exists", spec.ErrUniqueness, id)
+	case errors.Is(err, spec.ErrNotFound):
+		return nil
+	default:
+		return err
+	}
+}
+
+func (f *clientIDPropertyFilter) FilterRef(_ context.Context, _ *spec.ResourceType, _ prop.Navigator, _ prop.Navigator) error {
+	return nil
+}
@@ -0,0 +1,108 @@
+package filter
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/imulab/go-scim/pkg/v2/crud"
+	"github.com/imulab/go-scim/pkg/v2/db"
+	"github.com/imulab/go-scim/pkg/v2/prop"
+	"github.com/imulab/go-scim/pkg/v2/spec"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestClientIDFilter(t *testing.T) {
+	attr := new(spec.Attribute)
+	require.Nil(t, json.Unmarshal([]byte(`
+{
+  "id": "id",
+  "name": "id",
+  "type": "string",
+  "mutability": "readOnly",
+  "_annotations": {
+    "@ReadOnly": {
+      "reset": true,
+      "copy": true
+    },
+    "@UUID": {}
+  }
+}
+`), attr))
+
+	tests := []struct {
+		name   string
+		id     interface{}
+		expect func(t *testing.T, p prop.Property, err error)
+	}{
+		{
+			name: "unassigned property is left to uuid filter",
+			id:   nil,
+			expect: func(t *testing.T, p prop.Property, err error) {
+				assert.Nil(t, err)
+				assert.True(t, p.IsUnassigned())
+			},
+		},
+		{
+			name: "valid id is retained",
+			id:   "legacy-00042",
+			expect: func(t *testing.T, p prop.Property, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, "legacy-00042", p.Raw())
+			},
+		},
+		{
+			name: "id of invalid format fails",
+			id:   "legacy/00042",
+			expect: func(t *testing.T, p prop.Property, err error) {
+				assert.True(t, errors.Is(err, spec.ErrInvalidValue))
+			},
+		},
+		{
+			name: "reserved keyword fails",
+			id:   "bulkId",
+			expect: func(t *testing.T, p prop.Property, err error) {
+				assert.True(t, errors.Is(err, spec.ErrInvalidValue))
+			},
+		},
+		{
+			name: "existing id fails",
+			id:   "taken",
+			expect: func(t *testing.T, p prop.Property, err error) {
+				assert.True(t, errors.Is(err, spec.ErrUniqueness))
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			filter := ClientIDFilter(&clientIDTestDatabase{ids: map[string]bool{"taken": true}}, nil)
+			property := prop.NewProperty(attr)
+			if test.id != nil {
+				_, err := property.Replace(test.id)
+				require.Nil(t, err)
+			}
+			assert.True(t, filter.Supports(property.Attribute()))
+
+			nav := prop.Navigate(property)
+			err := ReadOnlyFilterRetainingClientID().Filter(context.Background(), nil, nav)
+			require.Nil(t, err)
+			err = filter.Filter(context.Background(), nil, nav)
+			test.expect(t, property, err)
+		})
+	}
+}
+
+type clientIDTestDatabase struct {
+	db.DB
+	ids map[string]bool
+}
+
+func (d *clientIDTestDatabase) Get(_ context.Context, id string, _ *crud.Projection) (*prop.Resource, error) {
+	if !d.ids[id] {
+		return nil, fmt.Errorf("%w: resource not found by id '%s'", spec.ErrNotFound, id)
+	}
+	return nil, nil
+}
@@ -0,0 +1,98 @@
+package filter
+
+import (
+	"context"
+	"fmt"
+	"github.com/imulab/go-scim/pkg/v2/groupsync"
+	"github.com/imulab/go-scim/pkg/v2/prop"
+	"github.com/imulab/go-scim/pkg/v2/spec"
+	"strings"
+)
+
+// GroupCycleFilter returns a ByResource filter that rejects, with an error of spec.ErrInvalidValue, the groups whose new
+// members would make them members of themselves: a group having itself as a member, or a group having as a member
+// another group of which it is already a member, directly or indirectly. Such cycles have no meaningful membership, and
+// would otherwise be left to those resolving the memberships of users to cope with.
+//
+// The memberships of the group are resolved by the sync service (see groupsync.SyncService), hence cycles nested deeper
+// than its maximum depth are not detected. The filter only searches the group database when members are added, i.e.
+// not when a group is replaced with the members it already had. Concurrent requests adding groups to each other may
+// still create a cycle, as they are checked against the state of the database before either is saved.
+func GroupCycleFilter(groups *groupsync.SyncService) ByResource {
+	return &groupCycleFilter{groups: groups}
+}
+
+type groupCycleFilter struct {
+	groups *groupsync.SyncService
+}
+
+func (f *groupCycleFilter) Filter(ctx context.Context, resource *prop.Resource) error {
+	return f.check(ctx, resource, nil)
+}
+
+func (f *groupCycleFilter) FilterRef(ctx context.Context, resource *prop.Resource, ref *prop.Resource) error {
+	return f.check(ctx, resource, ref)
+}
+
+func (f *groupCycleFilter) check(ctx context.Context, resource *prop.Resource, ref *prop.Resource) error {
+	id := resource.IdOrEmpty()
+	if len(id) == 0 {
+		return nil
+	}
+
+	added := memberIds(resource)
+	if ref != nil {
+		for member := range memberIds(ref) {
+			delete(added, member)
+		}
+	}
+	if len(added) == 0 {
+		return nil
+	}
+	if _, ok := added[id]; ok {
+		return fmt.Errorf("%w: group '%s' cannot be a member of itself", spec.ErrInvalidValue, id)
+	}
+
+	memberships, err := f.groups.Memberships(ctx, id)
+	if err != nil {
+		return err
+	}
+	via := make(map[string]string, len(memberships))
+	for _, m := range memberships {
+		via[m.Group.IdOrEmpty()] = m.Via
+	}
+	for _, m := range memberships {
+		member := m.Group.IdOrEmpty()
+		if _, ok := added[member]; !ok {
+			continue
+		}
+		// the groups from this group up to the member, each a direct member of the next
+		path := []string{member}
+		for current := m.Via; current != id; current = via[current] {
+			path = append([]string{current}, path...)
+		}
+		path = append([]string{id}, path...)
+		return fmt.Errorf("%w: group '%s' cannot have '%s' as a member, as it is a member of '%s' (%s)",
+			spec.ErrInvalidValue, id, member, member, strings.Join(path, " -> "))
+	}
+	return nil
+}
+
+// Returns the values of the "members" of the resource, or none if it has no such attribute.
+func memberIds(resource *prop.Resource) map[string]struct{} {
+	ids := map[string]struct{}{}
+	members, err := resource.RootProperty().ChildAtIndex("members")
+	if err != nil || members == nil {
+		return ids
+	}
+	_ = members.ForEachChild(func(_ int, child prop.Property) error {
+		value, _ := child.ChildAtIndex("value")
+		if value != nil {
+			if id, ok := value.Raw().(string); ok && len(id) > 0 {
+				ids[id] = struct{}{}
+			}
+		}
+		return nil
+	})
+	return ids
+}
@@ -0,0 +1,172 @@
+package filter
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/imulab/go-scim/pkg/v2/crud"
+	"github.com/imulab/go-scim/pkg/v2/db"
+	"github.com/imulab/go-scim/pkg/v2/groupsync"
+	"github.com/imulab/go-scim/pkg/v2/prop"
+	"github.com/imulab/go-scim/pkg/v2/spec"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestGroupCycleFilter(t *testing.T) {
+	s := new(GroupCycleFilterTestSuite)
+	suite.Run(t, s)
+}
+
+type GroupCycleFilterTestSuite struct {
+	suite.Suite
+	resourceType *spec.ResourceType
+}
+
+func (s *GroupCycleFilterTestSuite) TestFilter() {
+	// g1 is a member of g2, which is a member of g3
+	database := db.Memory()
+	for _, group := range []*prop.Resource{
+		s.group("g1", "u1"),
+		s.group("g2", "g1", "u2"),
+		s.group("g3", "g2"),
+	} {
+		require.Nil(s.T(), database.Insert(context.Background(), group))
+	}
+
+	tests := []struct {
+		name     string
+		resource *prop.Resource
+		ref      *prop.Resource
+		expect   func(t *testing.T, err error)
+	}{
+		{
+			name:     "create with new members",
+			resource: s.group("g4", "g1", "u1"),
+			expect: func(t *testing.T, err error) {
+				assert.Nil(t, err)
+			},
+		},
+		{
+			name:     "create with itself as member",
+			resource: s.group("g4", "g4"),
+			expect: func(t *testing.T, err error) {
+				assert.True(t, errors.Is(err, spec.ErrInvalidValue))
+				assert.Contains(t, err.Error(), "cannot be a member of itself")
+			},
+		},
+		{
+			name:     "add a group of which it is a direct member",
+			resource: s.group("g1", "u1", "g2"),
+			ref:      s.group("g1", "u1"),
+			expect: func(t *testing.T, err error) {
+				assert.True(t, errors.Is(err, spec.ErrInvalidValue))
+				assert.Contains(t, err.Error(), "(g1 -> g2)")
+			},
+		},
+		{
+			name:     "add a group of which it is an indirect member",
+			resource: s.group("g1", "u1", "g3"),
+			ref:      s.group("g1", "u1"),
+			expect: func(t *testing.T, err error) {
+				assert.True(t, errors.Is(err, spec.ErrInvalidValue))
+				assert.Contains(t, err.Error(), "group 'g1' cannot have 'g3' as a member")
+				assert.Contains(t, err.Error(), "(g1 -> g2 -> g3)")
+			},
+		},
+		{
+			name:     "add a group of which it is not a member",
+			resource: s.group("g3", "g2", "g1"),
+			ref:      s.group("g3", "g2"),
+			expect: func(t *testing.T, err error) {
+				assert.Nil(t, err)
+			},
+		},
+		{
+			name:     "remove members",
+			resource: s.group("g2"),
+			ref:      s.group("g2", "g1", "u2"),
+			expect: func(t *testing.T, err error) {
+				assert.Nil(t, err)
+			},
+		},
+	}
+
+	for _, test := range tests {
+		s.T().Run(test.name, func(t *testing.T) {
+			f := GroupCycleFilter(groupsync.NewSyncService(database))
+			var err error
+			if test.ref == nil {
+				err = f.Filter(context.Background(), test.resource)
+			} else {
+				err = f.FilterRef(context.Background(), test.resource, test.ref)
+			}
+			test.expect(t, err)
+		})
+	}
+}
+
+func (s *GroupCycleFilterTestSuite) group(id string, members ...string) *prop.Resource {
+	var values []interface{}
+	for _, member := range members {
+		values = append(values, map[string]interface{}{"value": member})
+	}
+	r := prop.NewResource(s.resourceType)
+	data := map[string]interface{}{
+		"id":          id,
+		"displayName": id,
+	}
+	if len(values) > 0 {
+		data["members"] = values
+	}
+	require.False(s.T(), r.Navigator().Replace(data).HasError())
+	return r
+}
+
+func (s *GroupCycleFilterTestSuite) SetupSuite() {
+	for _, each := range []struct {
+		filepath  string
+		structure interface{}
+		post      func(parsed interface{})
+	}{
+		{
+			filepath:  "../../../../public/schemas/core_schema.json",
+			structure: new(spec.Schema),
+			post: func(parsed interface{}) {
+				spec.Schemas().Register(parsed.(*spec.Schema))
+			},
+		},
+		{
+			filepath:  "../../../../public/schemas/group_schema.json",
+			structure: new(spec.Schema),
+			post: func(parsed interface{}) {
+				spec.Schemas().Register(parsed.(*spec.Schema))
+			},
+		},
+		{
+			filepath:  "../../../../public/resource_types/group_resource_type.json",
+			structure: new(spec.ResourceType),
+			post: func(parsed interface{}) {
+				s.resourceType = parsed.(*spec.ResourceType)
+				crud.Register(s.resourceType)
+			},
+		},
+	} {
+		f, err := os.Open(each.filepath)
+		require.Nil(s.T(), err)
+
+		raw, err := ioutil.ReadAll(f)
+		require.Nil(s.T(), err)
+
+		err = json.Unmarshal(raw, each.structure)
+		require.Nil(s.T(), err)
+
+		if each.post != nil {
+			each.post(each.structure)
+		}
+	}
+}
@@ -0,0 +1,30 @@
+package filter
+
+import (
+	"context"
+	"github.com/imulab/go-scim/pkg/v2/groupsync"
+	"github.com/imulab/go-scim/pkg/v2/prop"
+)
+
+// DynamicGroupFilter returns a ByResource filter that materializes the "members" of dynamic groups (see
+// groupsync.Dynamic) as they are written: the filter of the group is validated against the users, or rejected with an
+// error of spec.ErrInvalidFilter, and the members written by the client, if any, are replaced with the users matching
+// the filter. Static groups are left unchanged.
+//
+// The filter shall run before the filters depending on the members, i.e. GroupCycleFilter. The members stored are
+// kept up to date as users change by groupsync.Dynamic, subscribed to the changes of the user database.
+func DynamicGroupFilter(dynamic *groupsync.Dynamic) ByResource {
+	return &dynamicGroupFilter{dynamic: dynamic}
+}
+
+type dynamicGroupFilter struct {
+	dynamic *groupsync.Dynamic
+}
+
+func (f *dynamicGroupFilter) Filter(ctx context.Context, resource *prop.Resource) error {
+	return f.dynamic.Compute(ctx, resource)
+}
+
+func (f *dynamicGroupFilter) FilterRef(ctx context.Context, resource *prop.Resource, _ *prop.Resource) error {
+	return f.dynamic.Compute(ctx, resource)
+}
@@ -0,0 +1,195 @@
+package filter
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/imulab/go-scim/pkg/v2/crud"
+	"github.com/imulab/go-scim/pkg/v2/db"
+	"github.com/imulab/go-scim/pkg/v2/groupsync"
+	"github.com/imulab/go-scim/pkg/v2/prop"
+	"github.com/imulab/go-scim/pkg/v2/spec"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestDynamicGroupFilter(t *testing.T) {
+	s := new(DynamicGroupFilterTestSuite)
+	suite.Run(t, s)
+}
+
+type DynamicGroupFilterTestSuite struct {
+	suite.Suite
+	userResourceType  *spec.ResourceType
+	groupResourceType *spec.ResourceType
+}
+
+func (s *DynamicGroupFilterTestSuite) TestFilter() {
+	userDB := db.Memory()
+	for _, data := range []map[string]interface{}{
+		{"id": "u1", "userName": "foo", "active": true},
+		{"id": "u2", "userName": "bar", "active": false},
+	} {
+		user := prop.NewResource(s.userResourceType)
+		require.False(s.T(), user.Navigator().Replace(data).HasError())
+		require.Nil(s.T(), userDB.Insert(context.Background(), user))
+	}
+	f := DynamicGroupFilter(groupsync.NewDynamic(s.userResourceType, userDB, db.Memory(), groupsync.DynamicOptions{}))
+
+	tests := []struct {
+		name     string
+		resource *prop.Resource
+		ref      *prop.Resource
+		expect   func(t *testing.T, resource *prop.Resource, err error)
+	}{
+		{
+			name:     "create dynamic group",
+			resource: s.group("active eq true"),
+			expect: func(t *testing.T, resource *prop.Resource, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, []interface{}{
+					map[string]interface{}{"value": "u1", "display": "foo"},
+				}, resource.Navigator().Dot("members").Current().Raw())
+			},
+		},
+		{
+			name:     "update dynamic group with members written by the client",
+			resource: s.group("active eq false", "u1", "u3"),
+			ref:      s.group("active eq true", "u1"),
+			expect: func(t *testing.T, resource *prop.Resource, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, []interface{}{
+					map[string]interface{}{"value": "u2", "display": "bar"},
+				}, resource.Navigator().Dot("members").Current().Raw())
+			},
+		},
+		{
+			name:     "create dynamic group with invalid filter",
+			resource: s.group("active eq"),
+			expect: func(t *testing.T, _ *prop.Resource, err error) {
+				assert.True(t, errors.Is(err, spec.ErrInvalidFilter))
+			},
+		},
+		{
+			name:     "update static group",
+			resource: s.group("", "u3"),
+			ref:      s.group("active eq true", "u1"),
+			expect: func(t *testing.T, resource *prop.Resource, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, []interface{}{
+					map[string]interface{}{"value": "u3"},
+				}, resource.Navigator().Dot("members").Current().Raw())
+			},
+		},
+	}
+
+	for _, test := range tests {
+		s.T().Run(test.name, func(t *testing.T) {
+			var err error
+			if test.ref == nil {
+				err = f.Filter(context.Background(), test.resource)
+			} else {
+				err = f.FilterRef(context.Background(), test.resource, test.ref)
+			}
+			test.expect(t, test.resource, err)
+		})
+	}
+}
+
+func (s *DynamicGroupFilterTestSuite) group(filter string, members ...string) *prop.Resource {
+	data := map[string]interface{}{
+		"id":          "g1",
+		"displayName": "Active",
+	}
+	if len(filter) > 0 {
+		data[groupsync.DynamicSchema] = map[string]interface{}{"filter": filter}
+	}
+	var elements []interface{}
+	for _, member := range members {
+		elements = append(elements, map[string]interface{}{"value": member})
+	}
+	if len(elements) > 0 {
+		data["members"] = elements
+	}
+
+	r := prop.NewResource(s.groupResourceType)
+	require.False(s.T(), r.Navigator().Replace(data).HasError())
+	return r
+}
+
+func (s *DynamicGroupFilterTestSuite) SetupSuite() {
+	for _, each := range []struct {
+		filepath  string
+		structure interface{}
+		post      func(parsed interface{})
+	}{
+		{
+			filepath:  "../../../../public/schemas/core_schema.json",
+			structure: new(spec.Schema),
+			post: func(parsed interface{}) {
+				spec.Schemas().Register(parsed.(*spec.Schema))
+			},
+		},
+		{
+			filepath:  "../../../../public/schemas/user_schema.json",
+			structure: new(spec.Schema),
+			post: func(parsed interface{}) {
+				spec.Schemas().Register(parsed.(*spec.Schema))
+			},
+		},
+		{
+			filepath:  "../../../../public/schemas/user_enterprise_extension_schema.json",
+			structure: new(spec.Schema),
+			post: func(parsed interface{}) {
+				spec.Schemas().Register(parsed.(*spec.Schema))
+			},
+		},
+		{
+			filepath:  "../../../../public/schemas/group_schema.json",
+			structure: new(spec.Schema),
+			post: func(parsed interface{}) {
+				spec.Schemas().Register(parsed.(*spec.Schema))
+			},
+		},
+		{
+			filepath:  "../../../../public/schemas/group_dynamic_extension_schema.json",
+			structure: new(spec.Schema),
+			post: func(parsed interface{}) {
+				spec.Schemas().Register(parsed.(*spec.Schema))
+			},
+		},
+		{
+			filepath:  "../../../../public/resource_types/user_resource_type.json",
+			structure: new(spec.ResourceType),
+			post: func(parsed interface{}) {
+				s.userResourceType = parsed.(*spec.ResourceType)
+				crud.Register(s.userResourceType)
+			},
+		},
+		{
+			filepath:  "../../../../public/resource_types/dynamic_group_resource_type.json",
+			structure: new(spec.ResourceType),
+			post: func(parsed interface{}) {
+				s.groupResourceType = parsed.(*spec.ResourceType)
+				crud.Register(s.groupResourceType)
+			},
+		},
+	} {
+		f, err := os.Open(each.filepath)
+		require.Nil(s.T(), err)
+
+		raw, err := ioutil.ReadAll(f)
+		require.Nil(s.T(), err)
+
+		err = json.Unmarshal(raw, each.structure)
+		require.Nil(s.T(), err)
+
+		if each.post != nil {
+			each.post(each.structure)
+		}
+	}
+}
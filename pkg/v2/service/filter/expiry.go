@@ -0,0 +1,67 @@
+package filter
+
+import (
+	"context"
+	"fmt"
+	"github.com/imulab/go-scim/pkg/v2/annotation"
+	"github.com/imulab/go-scim/pkg/v2/prop"
+	"github.com/imulab/go-scim/pkg/v2/spec"
+	"time"
+)
+
+// ExpiryFilter returns a ByProperty filter that assigns the time of expiry to the singular dateTime properties whose
+// attribute is annotated with @ExpiresAt and a "ttl" parameter, i.e. {"ttl": "72h"}. The time of expiry is the time the
+// filter runs plus the ttl, and is only assigned when the property is unassigned, hence when created without a value,
+// or when the value was removed on replace, which renews the resource. Attributes annotated without a ttl, or with a
+// ttl that is not a positive duration, are left alone. Expired resources are hidden by db.Expiring.
+func ExpiryFilter() ByProperty {
+	return expiryPropertyFilter{}
+}
+
+type expiryPropertyFilter struct{}
+
+func (f expiryPropertyFilter) Supports(attribute *spec.Attribute) bool {
+	if attribute.MultiValued() || attribute.Type() != spec.TypeDateTime {
+		return false
+	}
+	_, ok := f.ttlOf(attribute)
+	return ok
+}
+
+func (f expiryPropertyFilter) Filter(_ context.Context, _ *spec.ResourceType, nav prop.Navigator) error {
+	return f.assign(nav)
+}
+
+func (f expiryPropertyFilter) FilterRef(_ context.Context, _ *spec.ResourceType, nav prop.Navigator, _ prop.Navigator) error {
+	return f.assign(nav)
+}
+
+func (f expiryPropertyFilter) assign(nav prop.Navigator) error {
+	if nav.HasError() {
+		return nav.Error()
+	}
+
+	if !nav.Current().IsUnassigned() {
+		return nil
+	}
+
+	ttl, ok := f.ttlOf(nav.Current().Attribute())
+	if !ok {
+		return fmt.Errorf("%w: no ttl for '%s'", spec.ErrInternal, nav.Current().Attribute().Path())
+	}
+	return nav.Replace(time.Now().Add(ttl).UTC().Format(spec.ISO8601)).Error()
+}
+
+// Returns the ttl parameter of the @ExpiresAt annotation of the attribute, if it is a positive duration.
+func (f expiryPropertyFilter) ttlOf(attribute *spec.Attribute) (time.Duration, bool) {
+	params, ok := attribute.Annotation(annotation.ExpiresAt)
+	if !ok {
+		return 0, false
+	}
+	raw, ok := params["ttl"].(string)
+	if !ok {
+		return 0, false
+	}
+	ttl, err := time.ParseDuration(raw)
+	return ttl, err == nil && ttl > 0
+}
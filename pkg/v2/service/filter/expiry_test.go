@@ -0,0 +1,56 @@
+package filter
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/imulab/go-scim/pkg/v2/prop"
+	"github.com/imulab/go-scim/pkg/v2/spec"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestExpiryFilter(t *testing.T) {
+	attributeOf := func(t *testing.T, annotations string) *spec.Attribute {
+		attr := new(spec.Attribute)
+		require.Nil(t, json.Unmarshal([]byte(`
+{
+  "id": "expiresAt",
+  "name": "expiresAt",
+  "type": "dateTime",
+  "_annotations": `+annotations+`
+}
+`), attr))
+		return attr
+	}
+
+	t.Run("unassigned property gets the time of expiry", func(t *testing.T) {
+		filter := ExpiryFilter()
+		property := prop.NewProperty(attributeOf(t, `{"@ExpiresAt": {"ttl": "72h"}}`))
+		require.True(t, filter.Supports(property.Attribute()))
+
+		before := time.Now().Add(72 * time.Hour).Truncate(time.Second)
+		require.Nil(t, filter.Filter(context.Background(), nil, prop.Navigate(property)))
+		expiresAt, err := spec.ParseDateTime(property.Raw().(string))
+		require.Nil(t, err)
+		assert.False(t, expiresAt.Before(before))
+		assert.False(t, expiresAt.After(time.Now().Add(72*time.Hour)))
+	})
+
+	t.Run("assigned property keeps its time of expiry", func(t *testing.T) {
+		filter := ExpiryFilter()
+		property := prop.NewProperty(attributeOf(t, `{"@ExpiresAt": {"ttl": "72h"}}`))
+		_, err := property.Replace("2020-01-01T00:00:00")
+		require.Nil(t, err)
+
+		require.Nil(t, filter.FilterRef(context.Background(), nil, prop.Navigate(property), prop.Navigate(property)))
+		assert.Equal(t, "2020-01-01T00:00:00", property.Raw())
+	})
+
+	t.Run("attributes without a valid ttl are not supported", func(t *testing.T) {
+		for _, annotations := range []string{`{"@ExpiresAt": {}}`, `{"@ExpiresAt": {"ttl": "-1h"}}`, `{"@ExpiresAt": {"ttl": "soon"}}`, `{}`} {
+			assert.False(t, ExpiryFilter().Supports(attributeOf(t, annotations)), annotations)
+		}
+	})
+}
@@ -0,0 +1,63 @@
+package filter
+
+import (
+	"context"
+	"fmt"
+	"github.com/imulab/go-scim/pkg/v2/groupsync"
+	"github.com/imulab/go-scim/pkg/v2/prop"
+	"github.com/imulab/go-scim/pkg/v2/spec"
+)
+
+// UserGroupsFilter returns a ByResource filter that keeps the "groups" of users maintained by the server, as the
+// readOnly attribute is derived from the "members" of groups (RFC 7643 section 4.1.2). It rejects, with an error of
+// spec.ErrMutability, the users whose "groups" were written by the client: created with any, or patched to differ from
+// the reference. Values supplied to a replacement are ignored instead, as the replace service carries over readOnly
+// values (RFC 7644 section 3.5.1). The "groups" of accepted users are then synchronized by the sync service, direct and
+// indirect, with their "$ref" and "display" (see groupsync.SyncService).
+//
+// The filter shall run before ReadOnlyFilter, which would otherwise reset or copy the values written by the client. It
+// shall not be given to groupsync.Applier, whose changes to "groups" it would reject.
+func UserGroupsFilter(groups *groupsync.SyncService) ByResource {
+	return &userGroupsFilter{groups: groups}
+}
+
+type userGroupsFilter struct {
+	groups *groupsync.SyncService
+}
+
+func (f *userGroupsFilter) Filter(ctx context.Context, resource *prop.Resource) error {
+	nav := resource.Navigator().Dot("groups")
+	if nav.HasError() {
+		return nil
+	}
+	if !nav.Current().IsUnassigned() {
+		return f.rejected()
+	}
+	return f.sync(ctx, resource)
+}
+
+func (f *userGroupsFilter) FilterRef(ctx context.Context, resource *prop.Resource, ref *prop.Resource) error {
+	nav := resource.Navigator().Dot("groups")
+	if nav.HasError() {
+		return nil
+	}
+	refNav := ref.Navigator().Dot("groups")
+	if refNav.HasError() {
+		return nil
+	}
+	if nav.Current().IsUnassigned() != refNav.Current().IsUnassigned() || nav.Current().Hash() != refNav.Current().Hash() {
+		return f.rejected()
+	}
+	return f.sync(ctx, resource)
+}
+
+func (f *userGroupsFilter) sync(ctx context.Context, resource *prop.Resource) error {
+	if len(resource.IdOrEmpty()) == 0 {
+		return nil
+	}
+	return f.groups.SyncGroupPropertyForUser(ctx, resource)
+}
+
+func (f *userGroupsFilter) rejected() error {
+	return fmt.Errorf("%w: 'groups' is readOnly, and maintained by the server from the members of groups", spec.ErrMutability)
+}
@@ -0,0 +1,197 @@
+package filter
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/imulab/go-scim/pkg/v2/crud"
+	"github.com/imulab/go-scim/pkg/v2/db"
+	"github.com/imulab/go-scim/pkg/v2/groupsync"
+	"github.com/imulab/go-scim/pkg/v2/prop"
+	"github.com/imulab/go-scim/pkg/v2/spec"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestUserGroupsFilter(t *testing.T) {
+	s := new(UserGroupsFilterTestSuite)
+	suite.Run(t, s)
+}
+
+type UserGroupsFilterTestSuite struct {
+	suite.Suite
+	userResourceType  *spec.ResourceType
+	groupResourceType *spec.ResourceType
+}
+
+func (s *UserGroupsFilterTestSuite) TestFilter() {
+	// u1 is a member of g1, which is a member of g2
+	database := db.Memory()
+	for _, data := range []map[string]interface{}{
+		{"id": "g1", "displayName": "Engineering", "members": []interface{}{map[string]interface{}{"value": "u1"}}},
+		{"id": "g2", "displayName": "Staff", "members": []interface{}{map[string]interface{}{"value": "g1"}}},
+	} {
+		data["meta"] = map[string]interface{}{"location": "/Groups/" + data["id"].(string)}
+		g := prop.NewResource(s.groupResourceType)
+		require.False(s.T(), g.Navigator().Replace(data).HasError())
+		require.Nil(s.T(), database.Insert(context.Background(), g))
+	}
+	synced := []interface{}{
+		map[string]interface{}{"value": "g1", "$ref": "/Groups/g1", "display": "Engineering", "type": "direct"},
+		map[string]interface{}{"value": "g2", "$ref": "/Groups/g2", "display": "Staff", "type": "indirect"},
+	}
+
+	tests := []struct {
+		name     string
+		resource *prop.Resource
+		ref      *prop.Resource
+		expect   func(t *testing.T, resource *prop.Resource, err error)
+	}{
+		{
+			name:     "create without groups",
+			resource: s.user("u1", nil),
+			expect: func(t *testing.T, resource *prop.Resource, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, synced, resource.Navigator().Dot("groups").Current().Raw())
+			},
+		},
+		{
+			name:     "create with groups",
+			resource: s.user("u1", []interface{}{map[string]interface{}{"value": "g3"}}),
+			expect: func(t *testing.T, _ *prop.Resource, err error) {
+				assert.True(t, errors.Is(err, spec.ErrMutability))
+			},
+		},
+		{
+			name:     "create without id",
+			resource: s.user("", nil),
+			expect: func(t *testing.T, resource *prop.Resource, err error) {
+				assert.Nil(t, err)
+				assert.True(t, resource.Navigator().Dot("groups").Current().IsUnassigned())
+			},
+		},
+		{
+			name:     "update with stale groups",
+			resource: s.user("u1", []interface{}{map[string]interface{}{"value": "g1"}}),
+			ref:      s.user("u1", []interface{}{map[string]interface{}{"value": "g1"}}),
+			expect: func(t *testing.T, resource *prop.Resource, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, synced, resource.Navigator().Dot("groups").Current().Raw())
+			},
+		},
+		{
+			name:     "update adding groups",
+			resource: s.user("u1", []interface{}{map[string]interface{}{"value": "g3"}}),
+			ref:      s.user("u1", nil),
+			expect: func(t *testing.T, _ *prop.Resource, err error) {
+				assert.True(t, errors.Is(err, spec.ErrMutability))
+			},
+		},
+		{
+			name:     "update removing groups",
+			resource: s.user("u1", nil),
+			ref:      s.user("u1", synced),
+			expect: func(t *testing.T, _ *prop.Resource, err error) {
+				assert.True(t, errors.Is(err, spec.ErrMutability))
+			},
+		},
+	}
+
+	for _, test := range tests {
+		s.T().Run(test.name, func(t *testing.T) {
+			f := UserGroupsFilter(groupsync.NewSyncService(database))
+			var err error
+			if test.ref == nil {
+				err = f.Filter(context.Background(), test.resource)
+			} else {
+				err = f.FilterRef(context.Background(), test.resource, test.ref)
+			}
+			test.expect(t, test.resource, err)
+		})
+	}
+}
+
+func (s *UserGroupsFilterTestSuite) user(id string, groups []interface{}) *prop.Resource {
+	r := prop.NewResource(s.userResourceType)
+	data := map[string]interface{}{
+		"userName": "user",
+	}
+	if len(id) > 0 {
+		data["id"] = id
+	}
+	if len(groups) > 0 {
+		data["groups"] = groups
+	}
+	require.False(s.T(), r.Navigator().Replace(data).HasError())
+	return r
+}
+
+func (s *UserGroupsFilterTestSuite) SetupSuite() {
+	for _, each := range []struct {
+		filepath  string
+		structure interface{}
+		post      func(parsed interface{})
+	}{
+		{
+			filepath:  "../../../../public/schemas/core_schema.json",
+			structure: new(spec.Schema),
+			post: func(parsed interface{}) {
+				spec.Schemas().Register(parsed.(*spec.Schema))
+			},
+		},
+		{
+			filepath:  "../../../../public/schemas/user_schema.json",
+			structure: new(spec.Schema),
+			post: func(parsed interface{}) {
+				spec.Schemas().Register(parsed.(*spec.Schema))
+			},
+		},
+		{
+			filepath:  "../../../../public/schemas/user_enterprise_extension_schema.json",
+			structure: new(spec.Schema),
+			post: func(parsed interface{}) {
+				spec.Schemas().Register(parsed.(*spec.Schema))
+			},
+		},
+		{
+			filepath:  "../../../../public/schemas/group_schema.json",
+			structure: new(spec.Schema),
+			post: func(parsed interface{}) {
+				spec.Schemas().Register(parsed.(*spec.Schema))
+			},
+		},
+		{
+			filepath:  "../../../../public/resource_types/user_resource_type.json",
+			structure: new(spec.ResourceType),
+			post: func(parsed interface{}) {
+				s.userResourceType = parsed.(*spec.ResourceType)
+				crud.Register(s.userResourceType)
+			},
+		},
+		{
+			filepath:  "../../../../public/resource_types/group_resource_type.json",
+			structure: new(spec.ResourceType),
+			post: func(parsed interface{}) {
+				s.groupResourceType = parsed.(*spec.ResourceType)
+				crud.Register(s.groupResourceType)
+			},
+		},
+	} {
+		f, err := os.Open(each.filepath)
+		require.Nil(s.T(), err)
+
+		raw, err := ioutil.ReadAll(f)
+		require.Nil(s.T(), err)
+
+		err = json.Unmarshal(raw, each.structure)
+		require.Nil(s.T(), err)
+
+		if each.post != nil {
+			each.post(each.structure)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package filter
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+	"golang.org/x/crypto/pbkdf2"
+	"golang.org/x/crypto/scrypt"
+)
+
+// Length in bytes of the random salt generated by the hashers.
+const saltLength = 16
+
+// PasswordHasher hashes passwords before they are stored, see PasswordFilter.
+type PasswordHasher interface {
+	// Hash returns the encoded hash of the password, which replaces the password. The encoding shall carry everything
+	// needed to verify a password against it later, i.e. algorithm, parameters and salt.
+	Hash(ctx context.Context, password string) (string, error)
+}
+
+// PasswordHasherFunc adapts a function to PasswordHasher, so that hashing can be delegated, i.e. to an external key
+// management service.
+type PasswordHasherFunc func(ctx context.Context, password string) (string, error)
+
+func (f PasswordHasherFunc) Hash(ctx context.Context, password string) (string, error) {
+	return f(ctx, password)
+}
+
+// BCryptHasher returns a PasswordHasher using the BCrypt algorithm with the given cost. If cost is not positive, the
+// default cost of 10 is used. PasswordFilter hashes the attributes annotated with @BCrypt with the cost of the
+// annotation instead, if it is set.
+func BCryptHasher(cost int) PasswordHasher {
+	if cost < 1 {
+		cost = 10
+	}
+	return bcryptHasher{cost: cost}
+}
+
+type bcryptHasher struct {
+	cost int
+}
+
+func (h bcryptHasher) Hash(_ context.Context, password string) (string, error) {
+	hashed, err := bcrypt.GenerateFromPassword([]byte(password), h.cost)
+	if err != nil {
+		return "", err
+	}
+	return string(hashed), nil
+}
+
+// Argon2idHasher returns a PasswordHasher using the Argon2id algorithm with the given number of passes, memory in KiB,
+// degree of parallelism and key length in bytes. The hash is encoded in the PHC string format, i.e.
+// $argon2id$v=19$m=65536,t=1,p=4$<salt>$<key>.
+func Argon2idHasher(time uint32, memory uint32, threads uint8, keyLen uint32) PasswordHasher {
+	return PasswordHasherFunc(func(_ context.Context, password string) (string, error) {
+		salt, err := newSalt()
+		if err != nil {
+			return "", err
+		}
+		key := argon2.IDKey([]byte(password), salt, time, memory, threads, keyLen)
+		return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version, memory, time, threads,
+			encodeHash(salt), encodeHash(key)), nil
+	})
+}
+
+// ScryptHasher returns a PasswordHasher using the scrypt algorithm with the given CPU/memory cost, which must be a
+// power of two, block size, parallelization and key length in bytes. The hash is encoded in the PHC string format,
+// i.e. $scrypt$ln=15,r=8,p=1$<salt>$<key>, where ln is the base 2 logarithm of the cost.
+func ScryptHasher(n int, r int, p int, keyLen int) PasswordHasher {
+	return PasswordHasherFunc(func(_ context.Context, password string) (string, error) {
+		salt, err := newSalt()
+		if err != nil {
+			return "", err
+		}
+		key, err := scrypt.Key([]byte(password), salt, n, r, p, keyLen)
+		if err != nil {
+			return "", err
+		}
+		ln := 0
+		for c := n; c > 1; c >>= 1 {
+			ln++
+		}
+		return fmt.Sprintf("$scrypt$ln=%d,r=%d,p=%d$%s$%s", ln, r, p, encodeHash(salt), encodeHash(key)), nil
+	})
+}
+
+// PBKDF2Hasher returns a PasswordHasher using the PBKDF2 algorithm with HMAC-SHA256, the given number of iterations and
+// key length in bytes. The hash is encoded in the PHC string format, i.e. $pbkdf2-sha256$i=600000$<salt>$<key>.
+func PBKDF2Hasher(iterations int, keyLen int) PasswordHasher {
+	return PasswordHasherFunc(func(_ context.Context, password string) (string, error) {
+		salt, err := newSalt()
+		if err != nil {
+			return "", err
+		}
+		key := pbkdf2.Key([]byte(password), salt, iterations, keyLen, sha256.New)
+		return fmt.Sprintf("$pbkdf2-sha256$i=%d$%s$%s", iterations, encodeHash(salt), encodeHash(key)), nil
+	})
+}
+
+func newSalt() ([]byte, error) {
+	salt := make([]byte, saltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	return salt, nil
+}
+
+func encodeHash(b []byte) string {
+	return base64.RawStdEncoding.EncodeToString(b)
+}
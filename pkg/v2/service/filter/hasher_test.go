@@ -0,0 +1,62 @@
+package filter
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/bcrypt"
+	"regexp"
+	"testing"
+)
+
+func TestPasswordHasher(t *testing.T) {
+	tests := []struct {
+		name   string
+		hasher PasswordHasher
+		expect func(t *testing.T, hashed string)
+	}{
+		{
+			name:   "bcrypt",
+			hasher: BCryptHasher(5),
+			expect: func(t *testing.T, hashed string) {
+				assert.Nil(t, bcrypt.CompareHashAndPassword([]byte(hashed), []byte("s3cret")))
+				cost, err := bcrypt.Cost([]byte(hashed))
+				assert.Nil(t, err)
+				assert.Equal(t, 5, cost)
+			},
+		},
+		{
+			name:   "argon2id",
+			hasher: Argon2idHasher(1, 64*1024, 4, 32),
+			expect: func(t *testing.T, hashed string) {
+				assert.Regexp(t, regexp.MustCompile(`^\$argon2id\$v=19\$m=65536,t=1,p=4\$[A-Za-z0-9+/]{22}\$[A-Za-z0-9+/]{43}$`), hashed)
+			},
+		},
+		{
+			name:   "scrypt",
+			hasher: ScryptHasher(1<<10, 8, 1, 32),
+			expect: func(t *testing.T, hashed string) {
+				assert.Regexp(t, regexp.MustCompile(`^\$scrypt\$ln=10,r=8,p=1\$[A-Za-z0-9+/]{22}\$[A-Za-z0-9+/]{43}$`), hashed)
+			},
+		},
+		{
+			name:   "pbkdf2",
+			hasher: PBKDF2Hasher(1000, 32),
+			expect: func(t *testing.T, hashed string) {
+				assert.Regexp(t, regexp.MustCompile(`^\$pbkdf2-sha256\$i=1000\$[A-Za-z0-9+/]{22}\$[A-Za-z0-9+/]{43}$`), hashed)
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			hashed, err := test.hasher.Hash(context.Background(), "s3cret")
+			assert.Nil(t, err)
+			test.expect(t, hashed)
+
+			// salted, hence hashing again yields a different result
+			again, err := test.hasher.Hash(context.Background(), "s3cret")
+			assert.Nil(t, err)
+			assert.NotEqual(t, hashed, again)
+		})
+	}
+}
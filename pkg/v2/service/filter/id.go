@@ -0,0 +1,144 @@
+package filter
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"github.com/imulab/go-scim/pkg/v2/spec"
+	"github.com/satori/go.uuid"
+	"strconv"
+	"sync"
+	"time"
+)
+
+type (
+	// IDGenerator generates the ids of new resources, for IDFilter.
+	IDGenerator interface {
+		// NewID returns a new id for a resource of the resource type. The resource type may be nil when unknown.
+		NewID(ctx context.Context, resourceType *spec.ResourceType) (string, error)
+	}
+	// IDGeneratorFunc is the function adapter of IDGenerator.
+	IDGeneratorFunc func(ctx context.Context, resourceType *spec.ResourceType) (string, error)
+)
+
+func (f IDGeneratorFunc) NewID(ctx context.Context, resourceType *spec.ResourceType) (string, error) {
+	return f(ctx, resourceType)
+}
+
+// UUIDv4 returns an IDGenerator of random UUIDs, which is the default of UUIDFilter.
+func UUIDv4() IDGenerator {
+	return IDGeneratorFunc(func(_ context.Context, _ *spec.ResourceType) (string, error) {
+		return uuid.NewV4().String(), nil
+	})
+}
+
+// UUIDv7 returns an IDGenerator of version 7 UUIDs (RFC 9562), whose first 48 bits are the Unix time of creation in
+// milliseconds, followed by random bits, so that the ids sort by creation time to the millisecond, both as strings
+// and as bytes.
+func UUIDv7() IDGenerator {
+	return IDGeneratorFunc(func(_ context.Context, _ *spec.ResourceType) (string, error) {
+		var u uuid.UUID
+		if _, err := rand.Read(u[6:]); err != nil {
+			return "", fmt.Errorf("%w: failed to generate id", spec.ErrInternal)
+		}
+		putMillis(u[:6], time.Now())
+		u.SetVersion(7)
+		u.SetVariant(uuid.VariantRFC4122)
+		return u.String(), nil
+	})
+}
+
+// crockford is the alphabet of Crockford's base32, used by ULIDs.
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// ULID returns an IDGenerator of ULIDs (https://github.com/ulid/spec), which are 26 characters of Crockford's base32,
+// encoding the Unix time of creation in milliseconds followed by 80 random bits, so that the ids sort by creation time
+// to the millisecond.
+func ULID() IDGenerator {
+	return IDGeneratorFunc(func(_ context.Context, _ *spec.ResourceType) (string, error) {
+		var b [16]byte
+		if _, err := rand.Read(b[6:]); err != nil {
+			return "", fmt.Errorf("%w: failed to generate id", spec.ErrInternal)
+		}
+		putMillis(b[:6], time.Now())
+		hi, lo := binary.BigEndian.Uint64(b[:8]), binary.BigEndian.Uint64(b[8:])
+
+		// 128 bits in 26 characters of 5 bits, the first one holding the 3 highest bits.
+		var s [26]byte
+		for i := 25; i >= 0; i-- {
+			s[i] = crockford[lo&0x1f]
+			lo = lo>>5 | hi<<59
+			hi >>= 5
+		}
+		return string(s[:]), nil
+	})
+}
+
+// Epoch of the Snowflake ids, 2020-01-01T00:00:00Z in Unix milliseconds.
+const snowflakeEpoch = 1577836800000
+
+// Snowflake returns an IDGenerator of Snowflake ids: the decimal representation of a 63 bit integer made of the time of
+// creation in milliseconds since 2020 (41 bits), the node (10 bits) and a sequence number within the millisecond (12
+// bits). Ids are unique across generators of different nodes, and increase with time within the same node, but they
+// only sort by time as strings until they grow a digit. An error is returned if the node is not between 0 and 1023.
+func Snowflake(node int64) (IDGenerator, error) {
+	if node < 0 || node > 1023 {
+		return nil, fmt.Errorf("snowflake node must be between 0 and 1023, got %d", node)
+	}
+	return &snowflake{node: node}, nil
+}
+
+type snowflake struct {
+	sync.Mutex
+	node     int64
+	last     int64
+	sequence int64
+}
+
+func (s *snowflake) NewID(_ context.Context, _ *spec.ResourceType) (string, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	now := time.Now().UnixNano()/int64(time.Millisecond) - snowflakeEpoch
+	if now < s.last {
+		// the clock moved backwards: keep using the last time, as if it did not.
+		now = s.last
+	}
+	if now == s.last {
+		s.sequence = (s.sequence + 1) & 0xfff
+		if s.sequence == 0 {
+			// sequence exhausted within the millisecond: wait for the next one.
+			for now <= s.last {
+				time.Sleep(100 * time.Microsecond)
+				now = time.Now().UnixNano()/int64(time.Millisecond) - snowflakeEpoch
+			}
+		}
+	} else {
+		s.sequence = 0
+	}
+	s.last = now
+
+	return strconv.FormatInt(now<<22|s.node<<12|s.sequence, 10), nil
+}
+
+// PrefixedID returns an IDGenerator that prefixes the ids of the generator with prefix, i.e. "usr_", so that the ids
+// of different resource types can be told apart.
+func PrefixedID(prefix string, generator IDGenerator) IDGenerator {
+	return IDGeneratorFunc(func(ctx context.Context, resourceType *spec.ResourceType) (string, error) {
+		id, err := generator.NewID(ctx, resourceType)
+		if err != nil {
+			return "", err
+		}
+		return prefix + id, nil
+	})
+}
+
+// Writes the Unix time in milliseconds of t into the 6 bytes of b, in big endian.
+func putMillis(b []byte, t time.Time) {
+	ms := uint64(t.UnixNano() / int64(time.Millisecond))
+	for i := 5; i >= 0; i-- {
+		b[i] = byte(ms)
+		ms >>= 8
+	}
+}
@@ -0,0 +1,103 @@
+package filter
+
+import (
+	"context"
+	"github.com/satori/go.uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"regexp"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestIDGenerator(t *testing.T) {
+	snowflake, err := Snowflake(7)
+	require.Nil(t, err)
+
+	tests := []struct {
+		name      string
+		generator IDGenerator
+		sorted    bool
+		expect    func(t *testing.T, id string)
+	}{
+		{
+			name:      "uuid v4",
+			generator: UUIDv4(),
+			expect: func(t *testing.T, id string) {
+				u, err := uuid.FromString(id)
+				assert.Nil(t, err)
+				assert.Equal(t, byte(4), u.Version())
+			},
+		},
+		{
+			name:      "uuid v7",
+			generator: UUIDv7(),
+			sorted:    true,
+			expect: func(t *testing.T, id string) {
+				u, err := uuid.FromString(id)
+				assert.Nil(t, err)
+				assert.Equal(t, byte(7), u.Version())
+				assert.Equal(t, uuid.VariantRFC4122, u.Variant())
+			},
+		},
+		{
+			name:      "ulid",
+			generator: ULID(),
+			sorted:    true,
+			expect: func(t *testing.T, id string) {
+				assert.Regexp(t, regexp.MustCompile(`^[0-7][0-9A-HJKMNP-TV-Z]{25}$`), id)
+			},
+		},
+		{
+			name:      "snowflake",
+			generator: snowflake,
+			sorted:    true,
+			expect: func(t *testing.T, id string) {
+				assert.Regexp(t, regexp.MustCompile(`^[0-9]+$`), id)
+			},
+		},
+		{
+			name:      "prefixed",
+			generator: PrefixedID("usr_", ULID()),
+			sorted:    true,
+			expect: func(t *testing.T, id string) {
+				assert.Regexp(t, regexp.MustCompile(`^usr_[0-9A-Z]{26}$`), id)
+				assert.Regexp(t, ClientIDFormat, id)
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var ids []string
+			for i := 0; i < 3; i++ {
+				id, err := test.generator.NewID(context.Background(), nil)
+				require.Nil(t, err)
+				test.expect(t, id)
+				ids = append(ids, id)
+				time.Sleep(2 * time.Millisecond)
+			}
+			if test.sorted {
+				assert.True(t, sort.StringsAreSorted(ids))
+			}
+		})
+	}
+}
+
+func TestSnowflake(t *testing.T) {
+	_, err := Snowflake(1024)
+	assert.NotNil(t, err)
+
+	generator, err := Snowflake(0)
+	require.Nil(t, err)
+
+	// more ids than the sequence can hold in a millisecond
+	seen := map[string]bool{}
+	for i := 0; i < 5000; i++ {
+		id, err := generator.NewID(context.Background(), nil)
+		require.Nil(t, err)
+		assert.False(t, seen[id])
+		seen[id] = true
+	}
+}
@@ -12,12 +12,22 @@ import (
 	"time"
 )
 
-// MetaFilter returns a ByResource filter that assigns and updates the meta core attribute.
+// MetaFilter returns a ByResource filter that assigns and updates the meta core attribute. The meta.version assigned is
+// a random weak ETag generated every time the resource changes.
 func MetaFilter() ByResource {
 	return metaFilter{}
 }
 
-type metaFilter struct{}
+// ContentVersionMetaFilter returns a ByResource filter that behaves like MetaFilter, except that meta.version is computed
+// as a weak ETag from the content hash of the resource (see prop.Resource.ContentVersion). As a result, resources with
+// identical content always carry the same version, and the version can be re-computed from the content alone.
+func ContentVersionMetaFilter() ByResource {
+	return metaFilter{contentVersion: true}
+}
+
+type metaFilter struct {
+	contentVersion bool
+}
 
 func (f metaFilter) Filter(_ context.Context, resource *prop.Resource) error {
 	nav := resource.Navigator()
@@ -79,7 +89,7 @@ func (f metaFilter) assignCreatedTimeToNow(nav prop.Navigator) error {
 	}
 	defer nav.Retract()
 
-	return nav.Replace(time.Now().Format(spec.ISO8601)).Error()
+	return nav.Replace(time.Now().UTC().Format(spec.ISO8601)).Error()
 }
 
 func (f metaFilter) assignLastModifiedToNow(nav prop.Navigator) error {
@@ -88,7 +98,7 @@ func (f metaFilter) assignLastModifiedToNow(nav prop.Navigator) error {
 	}
 	defer nav.Retract()
 
-	return nav.Replace(time.Now().Format(spec.ISO8601)).Error()
+	return nav.Replace(time.Now().UTC().Format(spec.ISO8601)).Error()
 }
 
 func (f metaFilter) assignLocation(nav prop.Navigator, resource *prop.Resource) error {
@@ -117,6 +127,10 @@ func (f metaFilter) assignNewVersion(nav prop.Navigator, resource *prop.Resource
 		return fmt.Errorf("%w: empty id", spec.ErrInternal)
 	}
 
+	if f.contentVersion {
+		return nav.Replace(resource.ContentVersion()).Error()
+	}
+
 	ts := rand.Uint64()
 	tsBuf := make([]byte, 8)
 	binary.LittleEndian.PutUint64(tsBuf, ts)
@@ -167,6 +167,38 @@ func (s *MetaFilterTestSuite) TestMetaFilter() {
 	}
 }
 
+func (s *MetaFilterTestSuite) TestContentVersionMetaFilter() {
+	newUser := func(t *testing.T, lastModified string, userName string) *prop.Resource {
+		r := prop.NewResource(s.resourceType)
+		assert.False(t, r.Navigator().Replace(map[string]interface{}{
+			"id": "c37527a1-b60f-4e30-8fd9-162a1740bdb6",
+			"meta": map[string]interface{}{
+				"resourceType": "User",
+				"created":      "2020-01-19T15:15:00",
+				"lastModified": lastModified,
+				"version":      "W\"1\"",
+			},
+			"userName": userName,
+		}).HasError())
+		return r
+	}
+
+	filter := ContentVersionMetaFilter()
+
+	r1 := newUser(s.T(), "2020-01-19T15:15:00", "foobar")
+	assert.Nil(s.T(), filter.Filter(context.Background(), r1))
+	assert.Equal(s.T(), r1.ContentVersion(), r1.MetaVersionOrEmpty())
+
+	r2 := newUser(s.T(), "2020-02-20T16:16:00", "foobar")
+	assert.Nil(s.T(), filter.Filter(context.Background(), r2))
+	assert.Equal(s.T(), r1.MetaVersionOrEmpty(), r2.MetaVersionOrEmpty())
+
+	r3 := newUser(s.T(), "2020-01-19T15:15:00", "changed!!!")
+	assert.Nil(s.T(), filter.FilterRef(context.Background(), r3, r1))
+	assert.Equal(s.T(), r3.ContentVersion(), r3.MetaVersionOrEmpty())
+	assert.NotEqual(s.T(), r1.MetaVersionOrEmpty(), r3.MetaVersionOrEmpty())
+}
+
 func (s *MetaFilterTestSuite) SetupSuite() {
 	for _, each := range []struct {
 		filepath  string
@@ -0,0 +1,168 @@
+package filter
+
+import (
+	"context"
+	"fmt"
+	"github.com/imulab/go-scim/pkg/v2/annotation"
+	"github.com/imulab/go-scim/pkg/v2/prop"
+	"github.com/imulab/go-scim/pkg/v2/spec"
+	"math"
+	"unicode"
+	"unicode/utf8"
+)
+
+// PasswordFilter returns a ByProperty filter that checks passwords against the policy, and then hashes them with the
+// hasher, for singular string properties whose attribute is annotated with @Password, or with @BCrypt, so that it can
+// stand in for BCryptFilter on existing schemas. The policy may be nil, in which case passwords are only hashed. Like
+// BCryptFilter, the filter does nothing if the property is unassigned or has the same value with the reference
+// property, which is assumed to have been hashed already. When the hasher is a BCryptHasher, attributes annotated
+// with @BCrypt are hashed with the cost of the annotation, if it is set.
+func PasswordFilter(hasher PasswordHasher, policy *PasswordPolicy) ByProperty {
+	return passwordPropertyFilter{hasher: hasher, policy: policy}
+}
+
+type passwordPropertyFilter struct {
+	hasher PasswordHasher
+	policy *PasswordPolicy
+}
+
+func (f passwordPropertyFilter) Supports(attribute *spec.Attribute) bool {
+	_, password := attribute.Annotation(annotation.Password)
+	_, bCrypt := attribute.Annotation(annotation.BCrypt)
+	return (password || bCrypt) && !attribute.MultiValued() && attribute.Type() == spec.TypeString
+}
+
+func (f passwordPropertyFilter) Filter(ctx context.Context, _ *spec.ResourceType, nav prop.Navigator) error {
+	if nav.HasError() {
+		return nav.Error()
+	}
+
+	if nav.Current().IsUnassigned() {
+		return nil
+	}
+
+	return f.checkAndHash(ctx, nav)
+}
+
+func (f passwordPropertyFilter) FilterRef(ctx context.Context, _ *spec.ResourceType, nav prop.Navigator, refNav prop.Navigator) error {
+	if nav.HasError() {
+		return nav.Error()
+	}
+
+	if nav.Current().IsUnassigned() {
+		return nil
+	}
+
+	if refNav != nil && nav.Current().Raw() == refNav.Current().Raw() {
+		// Same as the hashed value from database, hence not a new password.
+		return nil
+	}
+
+	return f.checkAndHash(ctx, nav)
+}
+
+func (f passwordPropertyFilter) checkAndHash(ctx context.Context, nav prop.Navigator) error {
+	attr := nav.Current().Attribute()
+	password := nav.Current().Raw().(string)
+
+	if f.policy != nil {
+		if err := f.policy.Check(ctx, password); err != nil {
+			return err
+		}
+	}
+
+	hasher := f.hasher
+	if _, ok := hasher.(bcryptHasher); ok {
+		if cost := bcryptCost(attr); cost > 0 {
+			hasher = bcryptHasher{cost: cost}
+		}
+	}
+
+	hashed, err := hasher.Hash(ctx, password)
+	if err != nil {
+		return fmt.Errorf("%w: failed to hash attribute '%s'", spec.ErrInternal, attr.Path())
+	}
+
+	_, err = nav.Current().Replace(hashed)
+	return err
+}
+
+// PasswordPolicy is the set of rules that new passwords must satisfy. Zero values disable the corresponding rule.
+type PasswordPolicy struct {
+	// MinLength is the minimum number of characters of the password.
+	MinLength int
+	// MaxLength is the maximum number of characters of the password.
+	MaxLength int
+	// MinEntropy is the minimum entropy of the password in bits, as estimated by PasswordEntropy.
+	MinEntropy float64
+	// Breached, if not nil, reports whether the password is known to have been exposed in data breaches, i.e. by
+	// consulting the Have I Been Pwned range API. Errors are returned to the caller as is.
+	Breached func(ctx context.Context, password string) (bool, error)
+}
+
+// Check returns an error of spec.ErrInvalidValue if the password does not satisfy the policy. The password is never
+// included in the error.
+func (p *PasswordPolicy) Check(ctx context.Context, password string) error {
+	length := utf8.RuneCountInString(password)
+	if p.MinLength > 0 && length < p.MinLength {
+		return fmt.Errorf("%w: password must be at least %d characters long", spec.ErrInvalidValue, p.MinLength)
+	}
+	if p.MaxLength > 0 && length > p.MaxLength {
+		return fmt.Errorf("%w: password must be at most %d characters long", spec.ErrInvalidValue, p.MaxLength)
+	}
+	if p.MinEntropy > 0 && PasswordEntropy(password) < p.MinEntropy {
+		return fmt.Errorf("%w: password is too weak", spec.ErrInvalidValue)
+	}
+	if p.Breached != nil {
+		breached, err := p.Breached(ctx, password)
+		if err != nil {
+			return err
+		}
+		if breached {
+			return fmt.Errorf("%w: password has appeared in a data breach", spec.ErrInvalidValue)
+		}
+	}
+	return nil
+}
+
+// PasswordEntropy estimates the entropy of the password in bits, as the number of characters times the base 2
+// logarithm of the size of the character classes used, i.e. lower case letters, upper case letters, digits, symbols
+// and other characters. Repeated characters are only counted once, so that i.e. "aaaaaaaa" is not mistaken for strong.
+func PasswordEntropy(password string) float64 {
+	var (
+		pool     float64
+		classes  = make(map[string]struct{})
+		distinct = make(map[rune]struct{})
+	)
+	for _, r := range password {
+		distinct[r] = struct{}{}
+		switch {
+		case r < utf8.RuneSelf && unicode.IsLower(r):
+			classes["lower"] = struct{}{}
+		case r < utf8.RuneSelf && unicode.IsUpper(r):
+			classes["upper"] = struct{}{}
+		case r < utf8.RuneSelf && unicode.IsDigit(r):
+			classes["digit"] = struct{}{}
+		case r < utf8.RuneSelf:
+			classes["symbol"] = struct{}{}
+		default:
+			classes["other"] = struct{}{}
+		}
+	}
+	for class := range classes {
+		switch class {
+		case "lower", "upper":
+			pool += 26
+		case "digit":
+			pool += 10
+		case "symbol":
+			pool += 33
+		default:
+			pool += 100
+		}
+	}
+	if pool == 0 {
+		return 0
+	}
+	return float64(len(distinct)) * math.Log2(pool)
+}
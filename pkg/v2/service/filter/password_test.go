@@ -0,0 +1,236 @@
+package filter
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/imulab/go-scim/pkg/v2/prop"
+	"github.com/imulab/go-scim/pkg/v2/spec"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+	"testing"
+)
+
+func TestPasswordFilter(t *testing.T) {
+	attr := new(spec.Attribute)
+	require.Nil(t, json.Unmarshal([]byte(`
+{
+  "id": "password",
+  "name": "password",
+  "type": "string",
+  "_annotations": {
+    "@Password": {}
+  }
+}
+`), attr))
+
+	hasher := PasswordHasherFunc(func(_ context.Context, password string) (string, error) {
+		return "hashed:" + password, nil
+	})
+	policy := &PasswordPolicy{
+		MinLength:  8,
+		MaxLength:  64,
+		MinEntropy: 40,
+		Breached: func(_ context.Context, password string) (bool, error) {
+			return password == "Password123!", nil
+		},
+	}
+
+	tests := []struct {
+		name         string
+		getProperty  func() prop.Property
+		getReference func() prop.Property
+		expect       func(t *testing.T, p prop.Property, err error)
+	}{
+		{
+			name: "unassigned property does not hash",
+			getProperty: func() prop.Property {
+				return prop.NewProperty(attr)
+			},
+			getReference: func() prop.Property {
+				return nil
+			},
+			expect: func(t *testing.T, p prop.Property, err error) {
+				assert.Nil(t, err)
+				assert.True(t, p.IsUnassigned())
+			},
+		},
+		{
+			name: "password satisfying the policy is hashed",
+			getProperty: func() prop.Property {
+				p := prop.NewProperty(attr)
+				_, err := p.Replace("correct-Horse-battery")
+				assert.Nil(t, err)
+				return p
+			},
+			getReference: func() prop.Property {
+				return nil
+			},
+			expect: func(t *testing.T, p prop.Property, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, "hashed:correct-Horse-battery", p.Raw())
+			},
+		},
+		{
+			name: "short password is rejected",
+			getProperty: func() prop.Property {
+				p := prop.NewProperty(attr)
+				_, err := p.Replace("Ab1!")
+				assert.Nil(t, err)
+				return p
+			},
+			getReference: func() prop.Property {
+				return nil
+			},
+			expect: func(t *testing.T, p prop.Property, err error) {
+				assert.True(t, errors.Is(err, spec.ErrInvalidValue))
+				assert.Equal(t, "Ab1!", p.Raw())
+			},
+		},
+		{
+			name: "weak password is rejected",
+			getProperty: func() prop.Property {
+				p := prop.NewProperty(attr)
+				_, err := p.Replace("aaaaaaaaaaaa")
+				assert.Nil(t, err)
+				return p
+			},
+			getReference: func() prop.Property {
+				return nil
+			},
+			expect: func(t *testing.T, p prop.Property, err error) {
+				assert.True(t, errors.Is(err, spec.ErrInvalidValue))
+			},
+		},
+		{
+			name: "breached password is rejected",
+			getProperty: func() prop.Property {
+				p := prop.NewProperty(attr)
+				_, err := p.Replace("Password123!")
+				assert.Nil(t, err)
+				return p
+			},
+			getReference: func() prop.Property {
+				return nil
+			},
+			expect: func(t *testing.T, p prop.Property, err error) {
+				assert.True(t, errors.Is(err, spec.ErrInvalidValue))
+			},
+		},
+		{
+			name: "same value as reference is neither checked nor hashed",
+			getProperty: func() prop.Property {
+				p := prop.NewProperty(attr)
+				_, err := p.Replace("hashed:x")
+				assert.Nil(t, err)
+				return p
+			},
+			getReference: func() prop.Property {
+				p := prop.NewProperty(attr)
+				_, err := p.Replace("hashed:x")
+				assert.Nil(t, err)
+				return p
+			},
+			expect: func(t *testing.T, p prop.Property, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, "hashed:x", p.Raw())
+			},
+		},
+		{
+			name: "different value as reference is checked and hashed",
+			getProperty: func() prop.Property {
+				p := prop.NewProperty(attr)
+				_, err := p.Replace("correct-Horse-battery")
+				assert.Nil(t, err)
+				return p
+			},
+			getReference: func() prop.Property {
+				p := prop.NewProperty(attr)
+				_, err := p.Replace("hashed:x")
+				assert.Nil(t, err)
+				return p
+			},
+			expect: func(t *testing.T, p prop.Property, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, "hashed:correct-Horse-battery", p.Raw())
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			filter := PasswordFilter(hasher, policy)
+
+			property := test.getProperty()
+			reference := test.getReference()
+			assert.True(t, filter.Supports(property.Attribute()))
+
+			var err error
+			if reference == nil {
+				err = filter.Filter(context.Background(),
+					nil, prop.Navigate(property))
+			} else {
+				err = filter.FilterRef(context.Background(),
+					nil, prop.Navigate(property), prop.Navigate(reference))
+			}
+
+			test.expect(t, property, err)
+		})
+	}
+}
+
+func TestPasswordFilterBCryptCost(t *testing.T) {
+	attr := new(spec.Attribute)
+	require.Nil(t, json.Unmarshal([]byte(`
+{
+  "id": "password",
+  "name": "password",
+  "type": "string",
+  "_annotations": {
+    "@BCrypt": {
+      "cost": 5
+    }
+  }
+}
+`), attr))
+
+	tests := []struct {
+		name   string
+		hasher PasswordHasher
+		expect int
+	}{
+		{
+			name:   "cost of annotation takes precedence",
+			hasher: BCryptHasher(4),
+			expect: 5,
+		},
+		{
+			name: "other hashers ignore the annotation",
+			hasher: PasswordHasherFunc(func(_ context.Context, password string) (string, error) {
+				hashed, err := bcrypt.GenerateFromPassword([]byte(password), 4)
+				return string(hashed), err
+			}),
+			expect: 4,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			p := prop.NewProperty(attr)
+			_, err := p.Replace("correct-Horse-battery")
+			require.Nil(t, err)
+
+			require.Nil(t, PasswordFilter(test.hasher, nil).Filter(context.Background(), nil, prop.Navigate(p)))
+			cost, err := bcrypt.Cost([]byte(p.Raw().(string)))
+			assert.Nil(t, err)
+			assert.Equal(t, test.expect, cost)
+		})
+	}
+}
+
+func TestPasswordEntropy(t *testing.T) {
+	assert.Equal(t, float64(0), PasswordEntropy(""))
+	assert.True(t, PasswordEntropy("aaaaaaaaaaaa") < PasswordEntropy("abcdefgh"))
+	assert.True(t, PasswordEntropy("abcdefgh") < PasswordEntropy("aBcD3f!h"))
+}
@@ -0,0 +1,91 @@
+package filter
+
+import (
+	"context"
+	"fmt"
+	"github.com/imulab/go-scim/pkg/v2/db"
+	"github.com/imulab/go-scim/pkg/v2/prop"
+	"github.com/imulab/go-scim/pkg/v2/spec"
+)
+
+// Quota limits the resources of a resource type kept by a tenant. Limits that are not positive are not enforced.
+type Quota struct {
+	// MaxResources is the maximum number of resources in the database.
+	MaxResources int
+	// MaxMembers is the maximum number of values of the "members" attribute of a resource, i.e. of a Group.
+	MaxMembers int
+}
+
+// QuotaFunc returns the quota of the tenant carried by the context (see tenant.From), or nil if the tenant has no
+// quota.
+type QuotaFunc func(ctx context.Context) *Quota
+
+// StaticQuota returns a QuotaFunc that returns the same quota for every tenant.
+func StaticQuota(quota *Quota) QuotaFunc {
+	return func(_ context.Context) *Quota {
+		return quota
+	}
+}
+
+// QuotaFilter returns a ByResource filter that enforces the quota of the tenant, returning an error of
+// spec.ErrQuotaExceeded when a resource is created while the database already holds MaxResources resources, or when
+// a resource is created, replaced or patched to more than MaxMembers members. The resources in the database are
+// counted with an empty filter (see db.DB), hence the database shall be scoped to the tenant, i.e. by db.TenantDB.
+//
+// The count is subject to races between concurrent requests, which may exceed MaxResources by the number of requests
+// creating resources at once.
+func QuotaFilter(database db.DB, quota QuotaFunc) ByResource {
+	return &quotaFilter{database: database, quota: quota}
+}
+
+type quotaFilter struct {
+	database db.DB
+	quota    QuotaFunc
+}
+
+func (f *quotaFilter) Filter(ctx context.Context, resource *prop.Resource) error {
+	quota := f.quota(ctx)
+	if quota == nil {
+		return nil
+	}
+
+	if err := f.checkMembers(quota, resource); err != nil {
+		return err
+	}
+
+	if quota.MaxResources > 0 {
+		n, err := f.database.Count(ctx, "")
+		if err != nil {
+			return err
+		}
+		if n >= quota.MaxResources {
+			return fmt.Errorf("%w: the limit of %d %s resources is reached", spec.ErrQuotaExceeded, quota.MaxResources, resource.ResourceType().Name())
+		}
+	}
+
+	return nil
+}
+
+func (f *quotaFilter) FilterRef(ctx context.Context, resource *prop.Resource, _ *prop.Resource) error {
+	quota := f.quota(ctx)
+	if quota == nil {
+		return nil
+	}
+	return f.checkMembers(quota, resource)
+}
+
+func (f *quotaFilter) checkMembers(quota *Quota, resource *prop.Resource) error {
+	if quota.MaxMembers <= 0 {
+		return nil
+	}
+
+	nav := resource.Navigator().Dot("members")
+	if nav.HasError() {
+		// resource type without members
+		return nil
+	}
+	if n := nav.Current().CountChildren(); n > quota.MaxMembers {
+		return fmt.Errorf("%w: %d members exceed the limit of %d", spec.ErrQuotaExceeded, n, quota.MaxMembers)
+	}
+	return nil
+}
@@ -0,0 +1,182 @@
+package filter
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/imulab/go-scim/pkg/v2/crud"
+	"github.com/imulab/go-scim/pkg/v2/db"
+	"github.com/imulab/go-scim/pkg/v2/prop"
+	"github.com/imulab/go-scim/pkg/v2/spec"
+	"github.com/imulab/go-scim/pkg/v2/tenant"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestQuotaFilter(t *testing.T) {
+	s := new(QuotaFilterTestSuite)
+	suite.Run(t, s)
+}
+
+type QuotaFilterTestSuite struct {
+	suite.Suite
+	resourceType *spec.ResourceType
+}
+
+func (s *QuotaFilterTestSuite) TestQuotaFilter() {
+	database := db.Memory()
+	for i := 0; i < 2; i++ {
+		require.Nil(s.T(), database.Insert(context.Background(), s.group(fmt.Sprintf("existing-%d", i), 0)))
+	}
+
+	tests := []struct {
+		name     string
+		quota    *Quota
+		resource *prop.Resource
+		ref      *prop.Resource
+		expect   func(t *testing.T, err error)
+	}{
+		{
+			name:     "no quota",
+			quota:    nil,
+			resource: s.group("new", 5),
+			expect: func(t *testing.T, err error) {
+				assert.Nil(t, err)
+			},
+		},
+		{
+			name:     "create within quota",
+			quota:    &Quota{MaxResources: 3, MaxMembers: 5},
+			resource: s.group("new", 5),
+			expect: func(t *testing.T, err error) {
+				assert.Nil(t, err)
+			},
+		},
+		{
+			name:     "create beyond max resources",
+			quota:    &Quota{MaxResources: 2},
+			resource: s.group("new", 0),
+			expect: func(t *testing.T, err error) {
+				assert.True(t, errors.Is(err, spec.ErrQuotaExceeded))
+			},
+		},
+		{
+			name:     "create beyond max members",
+			quota:    &Quota{MaxMembers: 4},
+			resource: s.group("new", 5),
+			expect: func(t *testing.T, err error) {
+				assert.True(t, errors.Is(err, spec.ErrQuotaExceeded))
+			},
+		},
+		{
+			name:     "replace does not count resources",
+			quota:    &Quota{MaxResources: 2},
+			resource: s.group("existing-0", 1),
+			ref:      s.group("existing-0", 0),
+			expect: func(t *testing.T, err error) {
+				assert.Nil(t, err)
+			},
+		},
+		{
+			name:     "replace beyond max members",
+			quota:    &Quota{MaxMembers: 4},
+			resource: s.group("existing-0", 5),
+			ref:      s.group("existing-0", 4),
+			expect: func(t *testing.T, err error) {
+				assert.True(t, errors.Is(err, spec.ErrQuotaExceeded))
+			},
+		},
+	}
+
+	for _, test := range tests {
+		s.T().Run(test.name, func(t *testing.T) {
+			f := QuotaFilter(database, StaticQuota(test.quota))
+			var err error
+			if test.ref == nil {
+				err = f.Filter(context.Background(), test.resource)
+			} else {
+				err = f.FilterRef(context.Background(), test.resource, test.ref)
+			}
+			test.expect(t, err)
+		})
+	}
+}
+
+func (s *QuotaFilterTestSuite) TestQuotaOfTenant() {
+	quotas := map[string]*Quota{"small": {MaxResources: 1}}
+	database := db.TenantDB(func(_ context.Context, _ string) (db.DB, error) {
+		return db.Memory(), nil
+	})
+	f := QuotaFilter(database, func(ctx context.Context) *Quota {
+		return quotas[tenant.From(ctx)]
+	})
+	require.Nil(s.T(), database.Insert(tenant.With(context.Background(), "small"), s.group("first", 0)))
+	assert.True(s.T(), errors.Is(f.Filter(tenant.With(context.Background(), "small"), s.group("second", 0)), spec.ErrQuotaExceeded))
+	assert.Nil(s.T(), f.Filter(tenant.With(context.Background(), "large"), s.group("second", 0)))
+}
+
+func (s *QuotaFilterTestSuite) group(id string, members int) *prop.Resource {
+	var values []interface{}
+	for i := 0; i < members; i++ {
+		values = append(values, map[string]interface{}{"value": fmt.Sprintf("member-%d", i)})
+	}
+	r := prop.NewResource(s.resourceType)
+	data := map[string]interface{}{
+		"id":          id,
+		"displayName": id,
+	}
+	if len(values) > 0 {
+		data["members"] = values
+	}
+	require.False(s.T(), r.Navigator().Replace(data).HasError())
+	return r
+}
+
+func (s *QuotaFilterTestSuite) SetupSuite() {
+	for _, each := range []struct {
+		filepath  string
+		structure interface{}
+		post      func(parsed interface{})
+	}{
+		{
+			filepath:  "../../../../public/schemas/core_schema.json",
+			structure: new(spec.Schema),
+			post: func(parsed interface{}) {
+				spec.Schemas().Register(parsed.(*spec.Schema))
+			},
+		},
+		{
+			filepath:  "../../../../public/schemas/group_schema.json",
+			structure: new(spec.Schema),
+			post: func(parsed interface{}) {
+				spec.Schemas().Register(parsed.(*spec.Schema))
+			},
+		},
+		{
+			filepath:  "../../../../public/resource_types/group_resource_type.json",
+			structure: new(spec.ResourceType),
+			post: func(parsed interface{}) {
+				s.resourceType = parsed.(*spec.ResourceType)
+				crud.Register(s.resourceType)
+			},
+		},
+	} {
+		f, err := os.Open(each.filepath)
+		require.Nil(s.T(), err)
+
+		raw, err := ioutil.ReadAll(f)
+		require.Nil(s.T(), err)
+
+		err = json.Unmarshal(raw, each.structure)
+		require.Nil(s.T(), err)
+
+		if each.post != nil {
+			each.post(each.structure)
+		}
+	}
+}
@@ -0,0 +1,231 @@
+package filter
+
+import (
+	"context"
+	"fmt"
+	"github.com/imulab/go-scim/pkg/v2/crud"
+	"github.com/imulab/go-scim/pkg/v2/db"
+	"github.com/imulab/go-scim/pkg/v2/prop"
+	"github.com/imulab/go-scim/pkg/v2/spec"
+	"strings"
+)
+
+// ReferenceTarget is a resource type the members of groups may refer to, and the database of its resources.
+type ReferenceTarget struct {
+	ResourceType *spec.ResourceType
+	Database     db.DB
+}
+
+// MemberReferenceFilter returns a ByResource filter that resolves the members added to groups against the resources
+// they refer to: the resources of the targets whose resource type is one of the referenceTypes of "members.$ref", or of
+// all targets if it has none. The "$ref" of resolved members is set to the meta.location of the resource, and their
+// "display", if missing, to its displayName, or the userName of users without one. A "$ref" written by the client has
+// to refer to the resource identified by "value", under the endpoint of a target, i.e. "/Users/2819c223".
+//
+// Members that do not refer to an existing resource are rejected with an error of spec.ErrInvalidValue, unless
+// allowUnresolved, in which case they are kept as written, i.e. members managed by an external system. Only the members
+// added are resolved (see FilterRef), so that groups whose members have since been deleted can still be modified.
+func MemberReferenceFilter(targets []ReferenceTarget, allowUnresolved bool) ByResource {
+	return &memberReferenceFilter{targets: targets, allowUnresolved: allowUnresolved}
+}
+
+type memberReferenceFilter struct {
+	targets         []ReferenceTarget
+	allowUnresolved bool
+}
+
+// A member to resolve, at index of "members", against the candidate targets.
+type unresolvedMember struct {
+	index      int
+	id         string
+	candidates []int
+}
+
+func (f *memberReferenceFilter) Filter(ctx context.Context, resource *prop.Resource) error {
+	return f.resolve(ctx, resource, nil)
+}
+
+func (f *memberReferenceFilter) FilterRef(ctx context.Context, resource *prop.Resource, ref *prop.Resource) error {
+	return f.resolve(ctx, resource, ref)
+}
+
+func (f *memberReferenceFilter) resolve(ctx context.Context, resource *prop.Resource, ref *prop.Resource) error {
+	nav := resource.Navigator().Dot("members")
+	if nav.HasError() {
+		return nil
+	}
+	members := nav.Current()
+	targets := f.targetsOf(members.Attribute().SubAttributeForName("$ref"))
+
+	var existing map[string]struct{}
+	if ref != nil {
+		existing = memberIds(ref)
+	}
+
+	var (
+		unresolved []*unresolvedMember
+		ids        = make([][]string, len(f.targets))
+	)
+	for i := 0; i < members.CountChildren(); i++ {
+		element, err := members.ChildAtIndex(i)
+		if err != nil || element == nil {
+			continue
+		}
+		id := stringOf(element, "value")
+		if len(id) == 0 {
+			continue
+		}
+		if _, ok := existing[id]; ok {
+			continue
+		}
+
+		candidates, err := f.candidates(targets, id, stringOf(element, "$ref"))
+		if err != nil {
+			return err
+		}
+		for _, candidate := range candidates {
+			ids[candidate] = append(ids[candidate], id)
+		}
+		unresolved = append(unresolved, &unresolvedMember{index: i, id: id, candidates: candidates})
+	}
+	if len(unresolved) == 0 {
+		return nil
+	}
+
+	found, err := f.lookup(ctx, ids)
+	if err != nil {
+		return err
+	}
+
+	for _, member := range unresolved {
+		var target *prop.Resource
+		for _, candidate := range member.candidates {
+			if target = found[candidate][member.id]; target != nil {
+				break
+			}
+		}
+		if target == nil {
+			if f.allowUnresolved {
+				continue
+			}
+			return fmt.Errorf("%w: member '%s' does not refer to an existing %s", spec.ErrInvalidValue, member.id, f.describe(member.candidates))
+		}
+
+		if nav.At(member.index).HasError() {
+			return nav.Error()
+		}
+		if location := target.MetaLocationOrEmpty(); len(location) > 0 {
+			if nav.Dot("$ref").Replace(location).HasError() {
+				return nav.Error()
+			}
+			nav.Retract()
+		}
+		if display := nav.Dot("display"); !display.HasError() && display.Current().IsUnassigned() {
+			if name := displayNameOf(target); len(name) > 0 && display.Replace(name).HasError() {
+				return nav.Error()
+			}
+		}
+		nav.Retract()
+		nav.Retract()
+	}
+	return nil
+}
+
+// Returns the indexes of the targets the member may refer to: the target whose endpoint the "$ref" of the member refers
+// to, if any, or all the targets otherwise.
+func (f *memberReferenceFilter) candidates(targets []int, id string, ref string) ([]int, error) {
+	if len(ref) == 0 {
+		return targets, nil
+	}
+
+	for _, i := range targets {
+		prefix := strings.TrimSuffix(f.targets[i].ResourceType.Endpoint(), "/") + "/"
+		at := strings.LastIndex(ref, prefix)
+		if at < 0 {
+			continue
+		}
+		refId := strings.TrimSuffix(ref[at+len(prefix):], "/")
+		if strings.Contains(refId, "/") {
+			continue
+		}
+		if refId != id {
+			return nil, fmt.Errorf("%w: $ref '%s' of member '%s' refers to another resource", spec.ErrInvalidValue, ref, id)
+		}
+		return []int{i}, nil
+	}
+
+	if f.allowUnresolved {
+		return nil, nil
+	}
+	return nil, fmt.Errorf("%w: $ref '%s' of member '%s' does not refer to a %s", spec.ErrInvalidValue, ref, id, f.describe(targets))
+}
+
+// Returns the indexes of the targets of the reference types of the attribute, or of all the targets if it has none.
+func (f *memberReferenceFilter) targetsOf(attr *spec.Attribute) []int {
+	var targets []int
+	for i, target := range f.targets {
+		if attr == nil || attr.CountReferenceTypes() == 0 || attr.ExistsReferenceType(func(referenceType string) bool {
+			return strings.EqualFold(referenceType, target.ResourceType.Name())
+		}) {
+			targets = append(targets, i)
+		}
+	}
+	return targets
+}
+
+// Returns the resources found by id, for every target, looking up the ids of each target at once (see db.GetMany).
+func (f *memberReferenceFilter) lookup(ctx context.Context, ids [][]string) ([]map[string]*prop.Resource, error) {
+	found := make([]map[string]*prop.Resource, len(f.targets))
+	for i, target := range f.targets {
+		found[i] = map[string]*prop.Resource{}
+		if len(ids[i]) == 0 {
+			continue
+		}
+
+		resources, err := db.GetMany(ctx, target.Database, ids[i], &crud.Projection{
+			Attributes: []string{"id", "meta.location", "displayName", "userName"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		for _, resource := range resources {
+			found[i][resource.IdOrEmpty()] = resource
+		}
+	}
+	return found, nil
+}
+
+// Returns the names of the resource types of the targets, i.e. "User or Group".
+func (f *memberReferenceFilter) describe(targets []int) string {
+	if len(targets) == 0 {
+		return "resource"
+	}
+	names := make([]string, 0, len(targets))
+	for _, i := range targets {
+		names = append(names, f.targets[i].ResourceType.Name())
+	}
+	return strings.Join(names, " or ")
+}
+
+func stringOf(element prop.Property, name string) string {
+	child, err := element.ChildAtIndex(name)
+	if err != nil || child == nil {
+		return ""
+	}
+	s, _ := child.Raw().(string)
+	return s
+}
+
+// Returns the displayName of the resource, or the userName of users without one.
+func displayNameOf(resource *prop.Resource) string {
+	for _, name := range []string{"displayName", "userName"} {
+		nav := resource.Navigator().Dot(name)
+		if nav.HasError() {
+			continue
+		}
+		if display, ok := nav.Current().Raw().(string); ok && len(display) > 0 {
+			return display
+		}
+	}
+	return ""
+}
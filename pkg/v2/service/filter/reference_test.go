@@ -0,0 +1,252 @@
+package filter
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/imulab/go-scim/pkg/v2/crud"
+	"github.com/imulab/go-scim/pkg/v2/db"
+	"github.com/imulab/go-scim/pkg/v2/prop"
+	"github.com/imulab/go-scim/pkg/v2/spec"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestMemberReferenceFilter(t *testing.T) {
+	s := new(MemberReferenceFilterTestSuite)
+	suite.Run(t, s)
+}
+
+type MemberReferenceFilterTestSuite struct {
+	suite.Suite
+	userResourceType  *spec.ResourceType
+	groupResourceType *spec.ResourceType
+}
+
+func (s *MemberReferenceFilterTestSuite) TestFilter() {
+	var (
+		userDB  = db.Memory()
+		groupDB = db.Memory()
+	)
+	for _, data := range []map[string]interface{}{
+		{"id": "u1", "userName": "foo", "displayName": "Foo"},
+		{"id": "u2", "userName": "bar"},
+	} {
+		data["meta"] = map[string]interface{}{"location": "https://scim.example.com/v2/Users/" + data["id"].(string)}
+		user := prop.NewResource(s.userResourceType)
+		require.False(s.T(), user.Navigator().Replace(data).HasError())
+		require.Nil(s.T(), userDB.Insert(context.Background(), user))
+	}
+	g2 := s.group("g2", nil)
+	require.False(s.T(), g2.Navigator().Dot("meta").Dot("location").Replace("https://scim.example.com/v2/Groups/g2").HasError())
+	require.Nil(s.T(), groupDB.Insert(context.Background(), g2))
+	targets := []ReferenceTarget{
+		{ResourceType: s.userResourceType, Database: userDB},
+		{ResourceType: s.groupResourceType, Database: groupDB},
+	}
+
+	tests := []struct {
+		name            string
+		resource        *prop.Resource
+		ref             *prop.Resource
+		allowUnresolved bool
+		expect          func(t *testing.T, resource *prop.Resource, err error)
+	}{
+		{
+			name: "create with users and groups",
+			resource: s.group("g1", []interface{}{
+				map[string]interface{}{"value": "u1"},
+				map[string]interface{}{"value": "u2", "display": "Bar"},
+				map[string]interface{}{"value": "g2"},
+			}),
+			expect: func(t *testing.T, resource *prop.Resource, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, []interface{}{
+					map[string]interface{}{"value": "u1", "$ref": "https://scim.example.com/v2/Users/u1", "display": "Foo"},
+					map[string]interface{}{"value": "u2", "$ref": "https://scim.example.com/v2/Users/u2", "display": "Bar"},
+					map[string]interface{}{"value": "g2", "$ref": "https://scim.example.com/v2/Groups/g2", "display": "g2"},
+				}, resource.Navigator().Dot("members").Current().Raw())
+			},
+		},
+		{
+			name: "create with dangling member",
+			resource: s.group("g1", []interface{}{
+				map[string]interface{}{"value": "u1"},
+				map[string]interface{}{"value": "u3"},
+			}),
+			expect: func(t *testing.T, _ *prop.Resource, err error) {
+				assert.True(t, errors.Is(err, spec.ErrInvalidValue))
+			},
+		},
+		{
+			name: "create with $ref to the other resource type",
+			resource: s.group("g1", []interface{}{
+				map[string]interface{}{"value": "u1", "$ref": "/Groups/u1"},
+			}),
+			expect: func(t *testing.T, _ *prop.Resource, err error) {
+				assert.True(t, errors.Is(err, spec.ErrInvalidValue))
+			},
+		},
+		{
+			name: "create with $ref to another resource",
+			resource: s.group("g1", []interface{}{
+				map[string]interface{}{"value": "u1", "$ref": "/Users/u2"},
+			}),
+			expect: func(t *testing.T, _ *prop.Resource, err error) {
+				assert.True(t, errors.Is(err, spec.ErrInvalidValue))
+			},
+		},
+		{
+			name: "create with $ref outside of the endpoints",
+			resource: s.group("g1", []interface{}{
+				map[string]interface{}{"value": "x1", "$ref": "https://hr.example.com/people/x1"},
+			}),
+			expect: func(t *testing.T, _ *prop.Resource, err error) {
+				assert.True(t, errors.Is(err, spec.ErrInvalidValue))
+			},
+		},
+		{
+			name: "create with externally managed members allowed",
+			resource: s.group("g1", []interface{}{
+				map[string]interface{}{"value": "u1"},
+				map[string]interface{}{"value": "u3", "display": "External"},
+				map[string]interface{}{"value": "x1", "$ref": "https://hr.example.com/people/x1"},
+			}),
+			allowUnresolved: true,
+			expect: func(t *testing.T, resource *prop.Resource, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, []interface{}{
+					map[string]interface{}{"value": "u1", "$ref": "https://scim.example.com/v2/Users/u1", "display": "Foo"},
+					map[string]interface{}{"value": "u3", "display": "External"},
+					map[string]interface{}{"value": "x1", "$ref": "https://hr.example.com/people/x1"},
+				}, resource.Navigator().Dot("members").Current().Raw())
+			},
+		},
+		{
+			name: "update keeping dangling member",
+			resource: s.group("g1", []interface{}{
+				map[string]interface{}{"value": "u3"},
+				map[string]interface{}{"value": "u2", "$ref": "/Users/u2"},
+			}),
+			ref: s.group("g1", []interface{}{
+				map[string]interface{}{"value": "u3"},
+			}),
+			expect: func(t *testing.T, resource *prop.Resource, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, []interface{}{
+					map[string]interface{}{"value": "u3"},
+					map[string]interface{}{"value": "u2", "$ref": "https://scim.example.com/v2/Users/u2", "display": "bar"},
+				}, resource.Navigator().Dot("members").Current().Raw())
+			},
+		},
+		{
+			name: "update adding dangling member",
+			resource: s.group("g1", []interface{}{
+				map[string]interface{}{"value": "u1"},
+				map[string]interface{}{"value": "u3"},
+			}),
+			ref: s.group("g1", []interface{}{
+				map[string]interface{}{"value": "u1"},
+			}),
+			expect: func(t *testing.T, _ *prop.Resource, err error) {
+				assert.True(t, errors.Is(err, spec.ErrInvalidValue))
+			},
+		},
+	}
+
+	for _, test := range tests {
+		s.T().Run(test.name, func(t *testing.T) {
+			f := MemberReferenceFilter(targets, test.allowUnresolved)
+			var err error
+			if test.ref == nil {
+				err = f.Filter(context.Background(), test.resource)
+			} else {
+				err = f.FilterRef(context.Background(), test.resource, test.ref)
+			}
+			test.expect(t, test.resource, err)
+		})
+	}
+}
+
+func (s *MemberReferenceFilterTestSuite) group(id string, members []interface{}) *prop.Resource {
+	r := prop.NewResource(s.groupResourceType)
+	data := map[string]interface{}{
+		"id":          id,
+		"displayName": id,
+	}
+	if len(members) > 0 {
+		data["members"] = members
+	}
+	require.False(s.T(), r.Navigator().Replace(data).HasError())
+	return r
+}
+
+func (s *MemberReferenceFilterTestSuite) SetupSuite() {
+	for _, each := range []struct {
+		filepath  string
+		structure interface{}
+		post      func(parsed interface{})
+	}{
+		{
+			filepath:  "../../../../public/schemas/core_schema.json",
+			structure: new(spec.Schema),
+			post: func(parsed interface{}) {
+				spec.Schemas().Register(parsed.(*spec.Schema))
+			},
+		},
+		{
+			filepath:  "../../../../public/schemas/user_schema.json",
+			structure: new(spec.Schema),
+			post: func(parsed interface{}) {
+				spec.Schemas().Register(parsed.(*spec.Schema))
+			},
+		},
+		{
+			filepath:  "../../../../public/schemas/user_enterprise_extension_schema.json",
+			structure: new(spec.Schema),
+			post: func(parsed interface{}) {
+				spec.Schemas().Register(parsed.(*spec.Schema))
+			},
+		},
+		{
+			filepath:  "../../../../public/schemas/group_schema.json",
+			structure: new(spec.Schema),
+			post: func(parsed interface{}) {
+				spec.Schemas().Register(parsed.(*spec.Schema))
+			},
+		},
+		{
+			filepath:  "../../../../public/resource_types/user_resource_type.json",
+			structure: new(spec.ResourceType),
+			post: func(parsed interface{}) {
+				s.userResourceType = parsed.(*spec.ResourceType)
+				crud.Register(s.userResourceType)
+			},
+		},
+		{
+			filepath:  "../../../../public/resource_types/group_resource_type.json",
+			structure: new(spec.ResourceType),
+			post: func(parsed interface{}) {
+				s.groupResourceType = parsed.(*spec.ResourceType)
+				crud.Register(s.groupResourceType)
+			},
+		},
+	} {
+		f, err := os.Open(each.filepath)
+		require.Nil(s.T(), err)
+
+		raw, err := ioutil.ReadAll(f)
+		require.Nil(s.T(), err)
+
+		err = json.Unmarshal(raw, each.structure)
+		require.Nil(s.T(), err)
+
+		if each.post != nil {
+			each.post(each.structure)
+		}
+	}
+}
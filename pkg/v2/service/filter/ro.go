@@ -16,7 +16,16 @@ func ReadOnlyFilter() ByProperty {
 	return readOnlyPropertyFilter{}
 }
 
-type readOnlyPropertyFilter struct{}
+// ReadOnlyFilterRetainingClientID returns a ByProperty filter like ReadOnlyFilter, except that the value of the
+// property annotated with @UUID, i.e. the id, is not reset when there is no reference, so that the id supplied by
+// the client is retained on creation. It is meant to be used with ClientIDFilter, which validates such ids.
+func ReadOnlyFilterRetainingClientID() ByProperty {
+	return readOnlyPropertyFilter{retainClientID: true}
+}
+
+type readOnlyPropertyFilter struct {
+	retainClientID bool
+}
 
 func (f readOnlyPropertyFilter) Supports(attribute *spec.Attribute) bool {
 	if _, ok := attribute.Annotation(annotation.ReadOnly); !ok {
@@ -30,6 +39,10 @@ func (f readOnlyPropertyFilter) Filter(_ context.Context, _ *spec.ResourceType,
 		return nav.Error()
 	}
 
+	if _, ok := nav.Current().Attribute().Annotation(annotation.UUID); ok && f.retainClientID {
+		return nil
+	}
+
 	if err := f.tryReset(nav); err != nil {
 		return err
 	}
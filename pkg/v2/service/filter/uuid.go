@@ -5,17 +5,24 @@ import (
 	"github.com/imulab/go-scim/pkg/v2/annotation"
 	"github.com/imulab/go-scim/pkg/v2/prop"
 	"github.com/imulab/go-scim/pkg/v2/spec"
-	"github.com/satori/go.uuid"
 )
 
 // UUIDFilter returns a ByProperty filter that generates a UUID for string property that is annotated with @UUID. The
 // generation only happens when the target property is currently unassigned. The generated value will trigger event
 // propagation.
 func UUIDFilter() ByProperty {
-	return uuidPropertyFilter{}
+	return IDFilter(UUIDv4())
 }
 
-type uuidPropertyFilter struct{}
+// IDFilter returns a ByProperty filter like UUIDFilter, except that the values are generated by the generator, i.e.
+// UUIDv7 or ULID, so that the ids sort by creation time.
+func IDFilter(generator IDGenerator) ByProperty {
+	return uuidPropertyFilter{generator: generator}
+}
+
+type uuidPropertyFilter struct {
+	generator IDGenerator
+}
 
 func (f uuidPropertyFilter) Supports(attribute *spec.Attribute) bool {
 	_, ok := attribute.Annotation(annotation.UUID)
@@ -25,7 +32,7 @@ func (f uuidPropertyFilter) Supports(attribute *spec.Attribute) bool {
 	return !attribute.MultiValued() && attribute.Type() == spec.TypeString
 }
 
-func (f uuidPropertyFilter) Filter(_ context.Context, _ *spec.ResourceType, nav prop.Navigator) error {
+func (f uuidPropertyFilter) Filter(ctx context.Context, resourceType *spec.ResourceType, nav prop.Navigator) error {
 	if nav.HasError() {
 		return nav.Error()
 	}
@@ -34,7 +41,12 @@ func (f uuidPropertyFilter) Filter(_ context.Context, _ *spec.ResourceType, nav
 		return nil
 	}
 
-	return nav.Replace(uuid.NewV4().String()).Error()
+	id, err := f.generator.NewID(ctx, resourceType)
+	if err != nil {
+		return err
+	}
+
+	return nav.Replace(id).Error()
 }
 
 func (f uuidPropertyFilter) FilterRef(_ context.Context, _ *spec.ResourceType, _ prop.Navigator, _ prop.Navigator) error {
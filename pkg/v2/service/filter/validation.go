@@ -3,10 +3,10 @@ package filter
 import (
 	"context"
 	"fmt"
-	"strconv"
 	"strings"
 
 	"github.com/imulab/go-scim/pkg/v2/annotation"
+	"github.com/imulab/go-scim/pkg/v2/crud"
 	"github.com/imulab/go-scim/pkg/v2/db"
 	"github.com/imulab/go-scim/pkg/v2/prop"
 	"github.com/imulab/go-scim/pkg/v2/spec"
@@ -35,8 +35,19 @@ func ValidationFilter(database db.DB) ByProperty {
 	return &validationPropertyFilter{database: database}
 }
 
+// ValidationFilterWithUniqueness returns a ByProperty like ValidationFilter, except that the attributes at the given
+// paths are checked for uniqueness as if they were uniqueness=server, regardless of their schema definition. This is
+// useful to enforce unique values of attributes like externalId, whose uniqueness is none in the standard schemas.
+//
+// The uniqueness check is subject to races between concurrent requests. Databases may avoid them with unique
+// indexes, returning an error of spec.ErrUniqueness from Insert and Replace (see db.DB).
+func ValidationFilterWithUniqueness(database db.DB, paths ...string) ByProperty {
+	return &validationPropertyFilter{database: database, uniquePaths: paths}
+}
+
 type validationPropertyFilter struct {
-	database db.DB
+	database    db.DB
+	uniquePaths []string
 }
 
 func (f *validationPropertyFilter) Supports(_ *spec.Attribute) bool {
@@ -144,7 +155,9 @@ func (f *validationPropertyFilter) validateUniqueness(ctx context.Context, nav p
 	property := nav.Current()
 	switch property.Attribute().Uniqueness() {
 	case spec.UniquenessNone, spec.UniquenessGlobal:
-		return nil
+		if !f.isUniquePath(property.Attribute()) {
+			return nil
+		}
 	}
 
 	if property.IsUnassigned() {
@@ -162,12 +175,8 @@ func (f *validationPropertyFilter) validateUniqueness(ctx context.Context, nav p
 
 	// We may run into problem where the uniqueness=server attribute is 'id' itself. However, as of
 	// now, 'id' is defined as uniqueness=global by assigning a UUID to it.
-	filter := fmt.Sprintf("(id ne %s) and (%s eq %s)",
-		strconv.Quote(id),
-		property.Attribute().Path(),
-		strconv.Quote(fmt.Sprintf("%v", property.Raw())),
-	)
-	n, err := f.database.Count(ctx, filter)
+	filter := crud.Filter().Ne("id", id).Eq(property.Attribute().Path(), property.Raw())
+	n, err := f.database.Count(ctx, filter.String())
 	if err != nil {
 		return err
 	} else if n > 0 {
@@ -176,3 +185,12 @@ func (f *validationPropertyFilter) validateUniqueness(ctx context.Context, nav p
 
 	return nil
 }
+
+func (f *validationPropertyFilter) isUniquePath(attr *spec.Attribute) bool {
+	for _, path := range f.uniquePaths {
+		if strings.EqualFold(path, attr.Path()) {
+			return true
+		}
+	}
+	return false
+}
@@ -65,6 +65,7 @@ func TestValidationFilter(t *testing.T) {
 	tests := []struct {
 		name         string
 		attrJson     string
+		uniquePaths  []string
 		getProperty  func(t *testing.T, attr *spec.Attribute) prop.Navigator
 		getReference func(t *testing.T, attr *spec.Attribute) prop.Navigator
 		getDB        func() db.DB
@@ -205,6 +206,55 @@ func TestValidationFilter(t *testing.T) {
 				assert.Equal(t, spec.ErrUniqueness, errors.Unwrap(err))
 			},
 		},
+		{
+			name:        "non-unique value fails check when declared unique",
+			attrJson:    `{}`,
+			uniquePaths: []string{"externalId"},
+			getProperty: func(t *testing.T, _ *spec.Attribute) prop.Navigator {
+				resourceType := getResourceType()
+				nav := prop.NewResource(resourceType).Navigator()
+				assert.False(t, nav.Replace(map[string]interface{}{
+					"id":         "return_1_please",
+					"externalId": "foobar",
+				}).HasError())
+
+				return nav.Dot("externalId")
+			},
+			getReference: func(t *testing.T, attr *spec.Attribute) prop.Navigator {
+				return nil
+			},
+			getDB: func() db.DB {
+				return &uniquenessTestMockDatabase{}
+			},
+			expect: func(t *testing.T, err error) {
+				assert.NotNil(t, err)
+				assert.Equal(t, spec.ErrUniqueness, errors.Unwrap(err))
+				assert.Contains(t, err.Error(), "'externalId'")
+			},
+		},
+		{
+			name:     "non-unique value passes check when not unique",
+			attrJson: `{}`,
+			getProperty: func(t *testing.T, _ *spec.Attribute) prop.Navigator {
+				resourceType := getResourceType()
+				nav := prop.NewResource(resourceType).Navigator()
+				assert.False(t, nav.Replace(map[string]interface{}{
+					"id":         "return_1_please",
+					"externalId": "foobar",
+				}).HasError())
+
+				return nav.Dot("externalId")
+			},
+			getReference: func(t *testing.T, attr *spec.Attribute) prop.Navigator {
+				return nil
+			},
+			getDB: func() db.DB {
+				return &uniquenessTestMockDatabase{}
+			},
+			expect: func(t *testing.T, err error) {
+				assert.Nil(t, err)
+			},
+		},
 		{
 			name:     "unique value passes check",
 			attrJson: `{}`,
@@ -235,7 +285,7 @@ func TestValidationFilter(t *testing.T) {
 			attr := new(spec.Attribute)
 			assert.Nil(t, json.Unmarshal([]byte(test.attrJson), attr))
 
-			filter := ValidationFilter(test.getDB())
+			filter := ValidationFilterWithUniqueness(test.getDB(), test.uniquePaths...)
 			property := test.getProperty(t, attr)
 			reference := test.getReference(t, attr)
 
@@ -291,3 +341,75 @@ func (d *uniquenessTestMockDatabase) Delete(_ context.Context, _ *prop.Resource)
 func (d *uniquenessTestMockDatabase) Query(_ context.Context, _ string, _ *crud.Sort, _ *crud.Pagination, _ *crud.Projection) ([]*prop.Resource, error) {
 	return []*prop.Resource{}, nil
 }
+
+func TestValidationFilterCollectingErrors(t *testing.T) {
+	var resourceType *spec.ResourceType
+	{
+		for _, each := range []struct {
+			filepath  string
+			structure interface{}
+			post      func(parsed interface{})
+		}{
+			{
+				filepath:  "../../../../public/schemas/core_schema.json",
+				structure: new(spec.Schema),
+				post: func(parsed interface{}) {
+					spec.Schemas().Register(parsed.(*spec.Schema))
+				},
+			},
+			{
+				filepath:  "../../../../public/schemas/user_schema.json",
+				structure: new(spec.Schema),
+				post: func(parsed interface{}) {
+					spec.Schemas().Register(parsed.(*spec.Schema))
+				},
+			},
+			{
+				filepath:  "../../../../public/schemas/user_enterprise_extension_schema.json",
+				structure: new(spec.Schema),
+				post: func(parsed interface{}) {
+					spec.Schemas().Register(parsed.(*spec.Schema))
+				},
+			},
+			{
+				filepath:  "../../../../public/resource_types/user_resource_type.json",
+				structure: new(spec.ResourceType),
+				post: func(parsed interface{}) {
+					resourceType = parsed.(*spec.ResourceType)
+				},
+			},
+		} {
+			f, err := os.Open(each.filepath)
+			require.Nil(t, err)
+			raw, err := ioutil.ReadAll(f)
+			require.Nil(t, err)
+			err = json.Unmarshal(raw, each.structure)
+			require.Nil(t, err)
+			if each.post != nil {
+				each.post(each.structure)
+			}
+		}
+	}
+
+	// userName and emails are both required
+	resource := prop.NewResource(resourceType)
+	require.False(t, resource.Navigator().Replace(map[string]interface{}{
+		"schemas": []interface{}{"urn:ietf:params:scim:schemas:core:2.0:User"},
+		"id":      "foo",
+	}).HasError())
+
+	err := ByPropertyToByResource(ValidationFilter(db.Memory())).Filter(context.Background(), resource)
+	assert.NotNil(t, err)
+	assert.True(t, errors.Is(err, spec.ErrInvalidValue))
+	_, ok := err.(spec.Errors)
+	assert.False(t, ok)
+
+	err = ByPropertyToByResourceCollectingErrors(ValidationFilter(db.Memory())).Filter(context.Background(), resource)
+	assert.NotNil(t, err)
+	assert.True(t, errors.Is(err, spec.ErrInvalidValue))
+	errs, ok := err.(spec.Errors)
+	require.True(t, ok)
+	assert.Len(t, errs, 2)
+	assert.Contains(t, errs[0].Error(), "userName")
+	assert.Contains(t, errs[1].Error(), "emails")
+}
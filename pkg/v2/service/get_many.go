@@ -0,0 +1,55 @@
+package service
+
+import (
+	"context"
+	"github.com/imulab/go-scim/pkg/v2/crud"
+	"github.com/imulab/go-scim/pkg/v2/db"
+	"github.com/imulab/go-scim/pkg/v2/prop"
+)
+
+// GetManyService returns a service to get many resources by id in one call, in one round trip to the database if it
+// implements db.BatchDB (see db.GetMany).
+func GetManyService(database db.DB) GetMany {
+	return &getManyService{database: database}
+}
+
+type (
+	// Get many resources service
+	GetMany interface {
+		Do(ctx context.Context, req *GetManyRequest) (resp *GetManyResponse, err error)
+	}
+	// Get many resources request
+	GetManyRequest struct {
+		ResourceIDs []string         // ids of the resources to get
+		Projection  *crud.Projection // field projection to be considered when fetching resources
+	}
+	// Get many resources response
+	GetManyResponse struct {
+		Resources []*prop.Resource // resources got from database, in the order of the ids
+		Missing   []string         // ids that did not match a resource
+	}
+)
+
+type getManyService struct {
+	database db.DB
+}
+
+func (s *getManyService) Do(ctx context.Context, req *GetManyRequest) (resp *GetManyResponse, err error) {
+	resources, err := db.GetMany(ctx, s.database, req.ResourceIDs, req.Projection)
+	if err != nil {
+		return
+	}
+
+	found := make(map[string]struct{}, len(resources))
+	for _, resource := range resources {
+		found[resource.IdOrEmpty()] = struct{}{}
+	}
+	resp = &GetManyResponse{Resources: resources, Missing: []string{}}
+	for _, id := range req.ResourceIDs {
+		if _, ok := found[id]; !ok {
+			found[id] = struct{}{}
+			resp.Missing = append(resp.Missing, id)
+		}
+	}
+	return
+}
@@ -0,0 +1,141 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/imulab/go-scim/pkg/v2/crud"
+	"github.com/imulab/go-scim/pkg/v2/db"
+	"github.com/imulab/go-scim/pkg/v2/prop"
+	"github.com/imulab/go-scim/pkg/v2/spec"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestGetManyService(t *testing.T) {
+	s := new(GetManyServiceTestSuite)
+	suite.Run(t, s)
+}
+
+type GetManyServiceTestSuite struct {
+	suite.Suite
+	resourceType *spec.ResourceType
+}
+
+// Hides the GetMany of the memory database, so that db.GetMany falls back to Get.
+type getOnlyDB struct {
+	db.DB
+}
+
+func (s *GetManyServiceTestSuite) TestDo() {
+	tests := []struct {
+		name    string
+		wrap    func(database db.DB) db.DB
+		ids     []string
+		expect  []string
+		missing []string
+	}{
+		{
+			name:    "batch database",
+			wrap:    func(database db.DB) db.DB { return database },
+			ids:     []string{"c", "missing", "a", "c"},
+			expect:  []string{"c", "a"},
+			missing: []string{"missing"},
+		},
+		{
+			name:    "database without batch support",
+			wrap:    func(database db.DB) db.DB { return getOnlyDB{DB: database} },
+			ids:     []string{"b", "a", "missing"},
+			expect:  []string{"b", "a"},
+			missing: []string{"missing"},
+		},
+		{
+			name:    "no ids",
+			wrap:    func(database db.DB) db.DB { return database },
+			ids:     nil,
+			expect:  []string{},
+			missing: []string{},
+		},
+	}
+
+	for _, test := range tests {
+		s.T().Run(test.name, func(t *testing.T) {
+			database := db.Memory()
+			for _, id := range []string{"a", "b", "c"} {
+				require.Nil(t, database.Insert(context.TODO(), s.resourceOf(t, map[string]interface{}{
+					"id": id,
+				})))
+			}
+
+			resp, err := GetManyService(test.wrap(database)).Do(context.Background(), &GetManyRequest{ResourceIDs: test.ids})
+			require.Nil(t, err)
+
+			ids := make([]string, 0)
+			for _, resource := range resp.Resources {
+				ids = append(ids, resource.IdOrEmpty())
+			}
+			assert.Equal(t, test.expect, ids)
+			assert.Equal(t, test.missing, resp.Missing)
+		})
+	}
+}
+
+func (s *GetManyServiceTestSuite) resourceOf(t *testing.T, data interface{}) *prop.Resource {
+	r := prop.NewResource(s.resourceType)
+	require.Nil(t, r.Navigator().Replace(data).Error())
+	return r
+}
+
+func (s *GetManyServiceTestSuite) SetupSuite() {
+	for _, each := range []struct {
+		filepath  string
+		structure interface{}
+		post      func(parsed interface{})
+	}{
+		{
+			filepath:  "../../../public/schemas/core_schema.json",
+			structure: new(spec.Schema),
+			post: func(parsed interface{}) {
+				spec.Schemas().Register(parsed.(*spec.Schema))
+			},
+		},
+		{
+			filepath:  "../../../public/schemas/user_schema.json",
+			structure: new(spec.Schema),
+			post: func(parsed interface{}) {
+				spec.Schemas().Register(parsed.(*spec.Schema))
+			},
+		},
+		{
+			filepath:  "../../../public/schemas/user_enterprise_extension_schema.json",
+			structure: new(spec.Schema),
+			post: func(parsed interface{}) {
+				spec.Schemas().Register(parsed.(*spec.Schema))
+			},
+		},
+		{
+			filepath:  "../../../public/resource_types/user_resource_type.json",
+			structure: new(spec.ResourceType),
+			post: func(parsed interface{}) {
+				s.resourceType = parsed.(*spec.ResourceType)
+				crud.Register(s.resourceType)
+			},
+		},
+	} {
+		f, err := os.Open(each.filepath)
+		require.Nil(s.T(), err)
+
+		raw, err := ioutil.ReadAll(f)
+		require.Nil(s.T(), err)
+
+		err = json.Unmarshal(raw, each.structure)
+		require.Nil(s.T(), err)
+
+		if each.post != nil {
+			each.post(each.structure)
+		}
+	}
+}
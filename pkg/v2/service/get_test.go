@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"github.com/imulab/go-scim/pkg/v2/crud"
 	"github.com/imulab/go-scim/pkg/v2/db"
 	"github.com/imulab/go-scim/pkg/v2/prop"
@@ -14,6 +15,7 @@ import (
 	"io/ioutil"
 	"os"
 	"testing"
+	"time"
 )
 
 func TestGetService(t *testing.T) {
@@ -79,12 +81,59 @@ func (s *GetServiceTestSuite) TestDo() {
 	}
 }
 
+func (s *GetServiceTestSuite) TestDoWithReplicas() {
+	var (
+		primary  = db.Memory()
+		replica  = db.Memory() // lagging behind, never receives the writes
+		database = db.Replicated(primary, []db.DB{replica}, db.ReplicaOptions{})
+		service  = GetService(database)
+	)
+
+	require.Nil(s.T(), database.Insert(context.Background(), s.resourceOf(s.T(), map[string]interface{}{"id": "user001"})))
+	_, err := service.Do(context.Background(), &GetRequest{ResourceID: "user001"})
+	assert.True(s.T(), errors.Is(err, spec.ErrNotFound), "read from the replica")
+
+	ctx := db.Sticky(context.Background())
+	_, err = service.Do(ctx, &GetRequest{ResourceID: "user001"})
+	assert.True(s.T(), errors.Is(err, spec.ErrNotFound), "read from the replica, as the context did not write")
+	require.Nil(s.T(), database.Insert(ctx, s.resourceOf(s.T(), map[string]interface{}{"id": "user002"})))
+	resp, err := service.Do(db.Sticky(ctx), &GetRequest{ResourceID: "user001"})
+	require.Nil(s.T(), err, "read from the primary after the context wrote")
+	assert.Equal(s.T(), "user001", resp.Resource.IdOrEmpty())
+
+	require.Nil(s.T(), db.WithTx(context.Background(), database, func(ctx context.Context) error {
+		_, err := service.Do(ctx, &GetRequest{ResourceID: "user002"})
+		return err
+	}), "read from the primary within transactions")
+
+	stale := db.Replicated(primary, []db.DB{replica}, db.ReplicaOptions{StickyFor: time.Nanosecond})
+	ctx = db.Sticky(context.Background())
+	require.Nil(s.T(), stale.Insert(ctx, s.resourceOf(s.T(), map[string]interface{}{"id": "user003"})))
+	time.Sleep(time.Millisecond)
+	_, err = GetService(stale).Do(ctx, &GetRequest{ResourceID: "user003"})
+	assert.True(s.T(), errors.Is(err, spec.ErrNotFound), "read from the replica once the stickiness expired")
+
+	broken := db.Replicated(primary, []db.DB{unavailableDB{}}, db.ReplicaOptions{Fallback: true})
+	resp, err = GetService(broken).Do(context.Background(), &GetRequest{ResourceID: "user001"})
+	require.Nil(s.T(), err, "read from the primary when the replica fails")
+	assert.Equal(s.T(), "user001", resp.Resource.IdOrEmpty())
+}
+
 func (s *GetServiceTestSuite) resourceOf(t *testing.T, data interface{}) *prop.Resource {
 	r := prop.NewResource(s.resourceType)
 	require.Nil(t, r.Navigator().Replace(data).Error())
 	return r
 }
 
+// unavailableDB fails every read, like a database whose server is down.
+type unavailableDB struct {
+	db.DB
+}
+
+func (unavailableDB) Get(_ context.Context, _ string, _ *crud.Projection) (*prop.Resource, error) {
+	return nil, fmt.Errorf("%w: connection refused", spec.ErrInternal)
+}
+
 func (s *GetServiceTestSuite) SetupSuite() {
 	for _, each := range []struct {
 		filepath  string
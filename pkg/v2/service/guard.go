@@ -0,0 +1,72 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"github.com/imulab/go-scim/pkg/v2/crud"
+	"github.com/imulab/go-scim/pkg/v2/spec"
+	"strings"
+)
+
+// QueryGuard is consulted by the query service with the validated query request before the database is queried. A
+// non-nil error rejects the request and is returned to the caller as is.
+type QueryGuard interface {
+	Check(ctx context.Context, req *QueryRequest) error
+}
+
+// CostGuard is a QueryGuard that estimates the cost of the filter (see crud.EstimateCost) and rejects queries that are
+// too expensive, before they reach the database.
+type CostGuard struct {
+	// ResourceType of the resources being queried. Required.
+	ResourceType *spec.ResourceType
+	// Indexed reports whether an attribute is indexed by the database. Defaults to crud.IndexedByUniqueness.
+	Indexed crud.IndexedFunc
+	// RejectScan rejects filters that require scanning all resources with spec.ErrInvalidFilter.
+	RejectScan bool
+	// MaxScore rejects filters whose score exceeds it with spec.ErrTooMany. Not positive disables the check.
+	MaxScore int
+	// Observe is called with the estimated cost of queries that were not rejected, so that deployments may
+	// deprioritize expensive queries, i.e. by routing them to a read replica or a smaller worker pool. A non-nil
+	// error rejects the query. Optional.
+	Observe func(ctx context.Context, req *QueryRequest, cost *crud.Cost) error
+}
+
+func (g *CostGuard) Check(ctx context.Context, req *QueryRequest) error {
+	cost, err := crud.EstimateCost(req.Filter, g.ResourceType, g.Indexed)
+	if err != nil {
+		return err
+	}
+
+	if g.RejectScan && cost.Scan {
+		return fmt.Errorf("%w: filter requires a full scan (%s)", spec.ErrInvalidFilter, strings.Join(cost.Reasons, "; "))
+	}
+	if g.MaxScore > 0 && cost.Score > g.MaxScore {
+		return fmt.Errorf("%w: filter cost %d exceeds the limit of %d", spec.ErrTooMany, cost.Score, g.MaxScore)
+	}
+
+	if g.Observe != nil {
+		return g.Observe(ctx, req, cost)
+	}
+	return nil
+}
+
+// QueryGuards returns a QueryGuard that consults the guards in order, and rejects the request with the first error.
+func QueryGuards(guards ...QueryGuard) QueryGuard {
+	return queryGuards(guards)
+}
+
+type queryGuards []QueryGuard
+
+func (g queryGuards) Check(ctx context.Context, req *QueryRequest) error {
+	for _, guard := range g {
+		if err := guard.Check(ctx, req); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+var (
+	_ QueryGuard = (*CostGuard)(nil)
+	_ QueryGuard = (queryGuards)(nil)
+)
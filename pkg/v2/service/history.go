@@ -0,0 +1,173 @@
+package service
+
+import (
+	"context"
+	"github.com/imulab/go-scim/pkg/v2/db"
+	"github.com/imulab/go-scim/pkg/v2/prop"
+	"github.com/imulab/go-scim/pkg/v2/spec"
+	"time"
+)
+
+// HistoryInterceptor returns an Interceptor that appends a change record to the history for every resource created,
+// replaced, patched or deleted through the services it wraps (see Interceptors). Calls that fail, that do not change
+// the resource, or that are dry runs, are not recorded. The actor of the change is resolved with the resolver, which
+// may be nil. Errors appending to the history are returned to the caller, although the change has been made.
+//
+// The payloads of patches are recorded redacted with the redactor of their resource type, or with a Redactor of no
+// extra paths for resource types without one, so that values of returned=never and writeOnly attributes, i.e. password,
+// are never stored, nor served by HistoryService.
+func HistoryInterceptor(history db.HistoryDB, resolver SubjectResolver, redactors ...*Redactor) Interceptor {
+	i := &historyInterceptor{history: history, resolver: resolver, redactors: map[string]*Redactor{}}
+	for _, each := range redactors {
+		i.redactors[each.resourceType.ID()] = each
+	}
+	return i
+}
+
+type historyInterceptor struct {
+	history   db.HistoryDB
+	resolver  SubjectResolver
+	redactors map[string]*Redactor
+}
+
+func (i *historyInterceptor) Before(ctx context.Context, inv *Invocation) (context.Context, error) {
+	// Buffer the payload while the service has not consumed it, so that it can be recorded afterwards.
+	if inv.Operation == OpPatch {
+		if _, err := inv.Payload(); err != nil {
+			return ctx, err
+		}
+	}
+	return ctx, nil
+}
+
+func (i *historyInterceptor) After(ctx context.Context, inv *Invocation, err error) error {
+	if err != nil {
+		return err
+	}
+
+	var (
+		resource *prop.Resource
+		record   = &db.ChangeRecord{Operation: inv.Operation, Time: time.Now().UTC()}
+	)
+	switch resp := inv.Response.(type) {
+	case *CreateResponse:
+		if resp.DryRun {
+			return nil
+		}
+		resource = resp.Resource
+	case *ReplaceResponse:
+		if !resp.Replaced || resp.DryRun {
+			return nil
+		}
+		resource = resp.Resource
+		record.Changed = ChangedPaths(resp.Ref, resp.Resource)
+	case *PatchResponse:
+		if !resp.Patched || resp.DryRun {
+			return nil
+		}
+		resource = resp.Resource
+		record.Changed = ChangedPaths(resp.Ref, resp.Resource)
+		if raw, _ := inv.Payload(); len(raw) > 0 {
+			record.Patch = i.redactor(resource.ResourceType()).Patch(raw)
+		}
+	case *DeleteResponse:
+		resource = resp.Deleted
+	default:
+		return nil
+	}
+
+	record.ResourceID = resource.IdOrEmpty()
+	record.ResourceType = resource.ResourceType().ID()
+	if inv.Operation != OpDelete {
+		record.Version = resource.MetaVersionOrEmpty()
+	}
+	if i.resolver != nil {
+		if actor, err := i.resolver.Resolve(ctx); err == nil {
+			record.Actor = actor
+		}
+	}
+
+	return i.history.Append(ctx, record)
+}
+
+// Returns the redactor of the resource type, creating one of no extra paths if there is none.
+func (i *historyInterceptor) redactor(resourceType *spec.ResourceType) *Redactor {
+	if r, ok := i.redactors[resourceType.ID()]; ok {
+		return r
+	}
+	r, _ := NewRedactor(resourceType)
+	return r
+}
+
+// ChangedPaths returns the paths of the attributes whose values differ between the two versions of a resource. Singular
+// complex attributes are compared by their sub attributes, whereas other attributes, including multiValued ones, are
+// compared as a whole.
+func ChangedPaths(before *prop.Resource, after *prop.Resource) []string {
+	changed := make([]string, 0)
+	compareChildren(before.RootProperty(), after.RootProperty(), &changed)
+	return changed
+}
+
+func compareChildren(before prop.Property, after prop.Property, changed *[]string) {
+	var (
+		beforeChildren = make([]prop.Property, 0, before.CountChildren())
+		afterChildren  = make([]prop.Property, 0, after.CountChildren())
+	)
+	_ = before.ForEachChild(func(_ int, child prop.Property) error {
+		beforeChildren = append(beforeChildren, child)
+		return nil
+	})
+	_ = after.ForEachChild(func(_ int, child prop.Property) error {
+		afterChildren = append(afterChildren, child)
+		return nil
+	})
+
+	for i, child := range afterChildren {
+		if i >= len(beforeChildren) {
+			*changed = append(*changed, child.Attribute().Path())
+			continue
+		}
+		attr := child.Attribute()
+		if !attr.MultiValued() && attr.Type() == spec.TypeComplex {
+			compareChildren(beforeChildren[i], child, changed)
+			continue
+		}
+		if beforeChildren[i].Hash() != child.Hash() {
+			*changed = append(*changed, attr.Path())
+		}
+	}
+}
+
+// HistoryService returns a service to read the change history of resources, as recorded by HistoryInterceptor.
+func HistoryService(history db.HistoryDB) History {
+	return &historyService{history: history}
+}
+
+type (
+	// Resource history service
+	History interface {
+		Do(ctx context.Context, req *HistoryRequest) (resp *HistoryResponse, err error)
+	}
+	// Resource history request
+	HistoryRequest struct {
+		ResourceID string // id of the resource
+	}
+	// Resource history response
+	HistoryResponse struct {
+		Records []*db.ChangeRecord // change records of the resource, oldest first
+	}
+)
+
+type historyService struct {
+	history db.HistoryDB
+}
+
+func (s *historyService) Do(ctx context.Context, req *HistoryRequest) (resp *HistoryResponse, err error) {
+	records, err := s.history.History(ctx, req.ResourceID)
+	if err != nil {
+		return
+	}
+
+	resp = &HistoryResponse{Records: records}
+	return
+}
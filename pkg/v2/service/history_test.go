@@ -0,0 +1,167 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/imulab/go-scim/pkg/v2/crud"
+	"github.com/imulab/go-scim/pkg/v2/db"
+	"github.com/imulab/go-scim/pkg/v2/service/filter"
+	"github.com/imulab/go-scim/pkg/v2/spec"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestHistory(t *testing.T) {
+	s := new(HistoryTestSuite)
+	suite.Run(t, s)
+}
+
+type HistoryTestSuite struct {
+	suite.Suite
+	config       *spec.ServiceProviderConfig
+	resourceType *spec.ResourceType
+}
+
+func (s *HistoryTestSuite) TestHistory() {
+	var (
+		database = db.Memory()
+		history  = db.MemoryHistory()
+		chain    = Interceptors(HistoryInterceptor(history, SubjectResolverFunc(func(ctx context.Context) (string, error) {
+			return "admin", nil
+		})))
+		create = chain.Create(s.resourceType, CreateService(s.resourceType, database, []filter.ByResource{
+			filter.ByPropertyToByResource(filter.UUIDFilter()),
+			filter.MetaFilter(),
+		}))
+		replace = chain.Replace(s.resourceType, ReplaceService(s.config, s.resourceType, database, []filter.ByResource{
+			filter.ByPropertyToByResource(filter.ReadOnlyFilter()),
+			filter.MetaFilter(),
+		}))
+		patch = chain.Patch(s.resourceType, PatchService(s.config, database, nil, []filter.ByResource{
+			filter.MetaFilter(),
+		}))
+		del = chain.Delete(s.resourceType, DeleteService(s.config, database))
+	)
+
+	created, err := create.Do(context.TODO(), &CreateRequest{PayloadSource: strings.NewReader(`
+{
+  "schemas": ["urn:ietf:params:scim:schemas:core:2.0:User"],
+  "userName": "foo"
+}`)})
+	require.Nil(s.T(), err)
+	id := created.Resource.IdOrEmpty()
+
+	_, err = replace.Do(context.TODO(), &ReplaceRequest{ResourceID: id, PayloadSource: strings.NewReader(`
+{
+  "schemas": ["urn:ietf:params:scim:schemas:core:2.0:User"],
+  "userName": "foo",
+  "name": {
+    "givenName": "Foo"
+  }
+}`)})
+	require.Nil(s.T(), err)
+
+	patchPayload := `{"schemas":["urn:ietf:params:scim:api:messages:2.0:PatchOp"],"Operations":[{"op":"add","path":"displayName","value":"Foo"}]}`
+	_, err = patch.Do(context.TODO(), &PatchRequest{ResourceID: id, PayloadSource: strings.NewReader(patchPayload)})
+	require.Nil(s.T(), err)
+
+	// a patch that changes nothing is not recorded
+	_, err = patch.Do(context.TODO(), &PatchRequest{ResourceID: id, PayloadSource: strings.NewReader(patchPayload)})
+	require.Nil(s.T(), err)
+
+	passwordPayload := `{"schemas":["urn:ietf:params:scim:api:messages:2.0:PatchOp"],"Operations":[{"op":"replace","path":"password","value":"s3cret"}]}`
+	_, err = patch.Do(context.TODO(), &PatchRequest{ResourceID: id, PayloadSource: strings.NewReader(passwordPayload)})
+	require.Nil(s.T(), err)
+
+	_, err = del.Do(context.TODO(), &DeleteRequest{ResourceID: id})
+	require.Nil(s.T(), err)
+
+	resp, err := HistoryService(history).Do(context.TODO(), &HistoryRequest{ResourceID: id})
+	require.Nil(s.T(), err)
+	require.Len(s.T(), resp.Records, 5)
+
+	var operations []string
+	for _, record := range resp.Records {
+		operations = append(operations, record.Operation)
+		assert.Equal(s.T(), id, record.ResourceID)
+		assert.Equal(s.T(), "User", record.ResourceType)
+		assert.Equal(s.T(), "admin", record.Actor)
+	}
+	assert.Equal(s.T(), []string{OpCreate, OpReplace, OpPatch, OpPatch, OpDelete}, operations)
+
+	assert.Equal(s.T(), created.Resource.MetaVersionOrEmpty(), resp.Records[0].Version)
+	assert.Contains(s.T(), resp.Records[1].Changed, "name.givenName")
+	assert.NotContains(s.T(), resp.Records[1].Changed, "userName")
+	assert.Contains(s.T(), resp.Records[2].Changed, "displayName")
+	assert.JSONEq(s.T(), patchPayload, string(resp.Records[2].Patch))
+	// the password patched is not recorded
+	assert.Contains(s.T(), resp.Records[3].Changed, "password")
+	assert.NotContains(s.T(), string(resp.Records[3].Patch), "s3cret")
+	assert.Contains(s.T(), string(resp.Records[3].Patch), Redacted)
+	assert.Empty(s.T(), resp.Records[4].Version)
+}
+
+func (s *HistoryTestSuite) SetupSuite() {
+	for _, each := range []struct {
+		filepath  string
+		structure interface{}
+		post      func(parsed interface{})
+	}{
+		{
+			filepath:  "../../../public/schemas/core_schema.json",
+			structure: new(spec.Schema),
+			post: func(parsed interface{}) {
+				spec.Schemas().Register(parsed.(*spec.Schema))
+			},
+		},
+		{
+			filepath:  "../../../public/schemas/user_schema.json",
+			structure: new(spec.Schema),
+			post: func(parsed interface{}) {
+				spec.Schemas().Register(parsed.(*spec.Schema))
+			},
+		},
+		{
+			filepath:  "../../../public/schemas/user_enterprise_extension_schema.json",
+			structure: new(spec.Schema),
+			post: func(parsed interface{}) {
+				spec.Schemas().Register(parsed.(*spec.Schema))
+			},
+		},
+		{
+			filepath:  "../../../public/resource_types/user_resource_type.json",
+			structure: new(spec.ResourceType),
+			post: func(parsed interface{}) {
+				s.resourceType = parsed.(*spec.ResourceType)
+				crud.Register(s.resourceType)
+			},
+		},
+	} {
+		f, err := os.Open(each.filepath)
+		require.Nil(s.T(), err)
+
+		raw, err := ioutil.ReadAll(f)
+		require.Nil(s.T(), err)
+
+		err = json.Unmarshal(raw, each.structure)
+		require.Nil(s.T(), err)
+
+		if each.post != nil {
+			each.post(each.structure)
+		}
+	}
+
+	s.config = new(spec.ServiceProviderConfig)
+	require.Nil(s.T(), json.Unmarshal([]byte(`
+{
+  "patch": {
+    "supported": true
+  }
+}
+`), s.config))
+}
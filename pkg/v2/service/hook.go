@@ -0,0 +1,95 @@
+package service
+
+import (
+	"context"
+	"github.com/imulab/go-scim/pkg/v2/prop"
+)
+
+// Hooks are typed hook points around the create, replace, patch and delete services, so that embedders may mutate the
+// incoming resource (i.e. assign default entitlements), or reject the operation, without forking the services. Hooks
+// are installed with the *WithHooks variant of the service constructors, i.e. CreateServiceWithHooks. Any hook may be
+// nil.
+//
+// The OnBefore hooks are called before the resource is persisted, and may mutate the resource. A non-nil error, which
+// should wrap one of the spec errors (i.e. spec.ErrMutability), rejects the operation and is returned as is. The
+// OnAfter hooks are called after the resource is persisted, and hence cannot undo the operation. Nevertheless, their
+// errors are returned to the caller, along with the response.
+type Hooks struct {
+	// OnBeforeCreate is called with the parsed resource, before the filters of the create service. Changes to the
+	// resource are hence subject to the filters, i.e. validation.
+	OnBeforeCreate func(ctx context.Context, resource *prop.Resource) error
+	// OnAfterCreate is called with the created resource.
+	OnAfterCreate func(ctx context.Context, resource *prop.Resource) error
+	// OnBeforeReplace is called with the parsed replacement and the resource to be replaced, before the filters of the
+	// replace service. The reference resource should not be modified.
+	OnBeforeReplace func(ctx context.Context, replacement *prop.Resource, ref *prop.Resource) error
+	// OnAfterReplace is called with the replaced resource and the resource before replacement. It is not called when
+	// the replacement did not change the resource.
+	OnAfterReplace func(ctx context.Context, replacement *prop.Resource, ref *prop.Resource) error
+	// OnBeforePatch is called with the resource after the patch operations are applied, and the resource before the
+	// patch, before the post filters of the patch service. The reference resource should not be modified.
+	OnBeforePatch func(ctx context.Context, resource *prop.Resource, ref *prop.Resource) error
+	// OnAfterPatch is called with the patched resource and the resource before the patch. It is not called when the
+	// patch did not change the resource.
+	OnAfterPatch func(ctx context.Context, resource *prop.Resource, ref *prop.Resource) error
+	// OnBeforeDelete is called with the resource to be deleted, after its pre conditions are met.
+	OnBeforeDelete func(ctx context.Context, resource *prop.Resource) error
+	// OnAfterDelete is called with the deleted resource.
+	OnAfterDelete func(ctx context.Context, resource *prop.Resource) error
+}
+
+func (h *Hooks) beforeCreate(ctx context.Context, resource *prop.Resource) error {
+	if h == nil || h.OnBeforeCreate == nil {
+		return nil
+	}
+	return h.OnBeforeCreate(ctx, resource)
+}
+
+func (h *Hooks) afterCreate(ctx context.Context, resource *prop.Resource) error {
+	if h == nil || h.OnAfterCreate == nil {
+		return nil
+	}
+	return h.OnAfterCreate(ctx, resource)
+}
+
+func (h *Hooks) beforeReplace(ctx context.Context, replacement *prop.Resource, ref *prop.Resource) error {
+	if h == nil || h.OnBeforeReplace == nil {
+		return nil
+	}
+	return h.OnBeforeReplace(ctx, replacement, ref)
+}
+
+func (h *Hooks) afterReplace(ctx context.Context, replacement *prop.Resource, ref *prop.Resource) error {
+	if h == nil || h.OnAfterReplace == nil {
+		return nil
+	}
+	return h.OnAfterReplace(ctx, replacement, ref)
+}
+
+func (h *Hooks) beforePatch(ctx context.Context, resource *prop.Resource, ref *prop.Resource) error {
+	if h == nil || h.OnBeforePatch == nil {
+		return nil
+	}
+	return h.OnBeforePatch(ctx, resource, ref)
+}
+
+func (h *Hooks) afterPatch(ctx context.Context, resource *prop.Resource, ref *prop.Resource) error {
+	if h == nil || h.OnAfterPatch == nil {
+		return nil
+	}
+	return h.OnAfterPatch(ctx, resource, ref)
+}
+
+func (h *Hooks) beforeDelete(ctx context.Context, resource *prop.Resource) error {
+	if h == nil || h.OnBeforeDelete == nil {
+		return nil
+	}
+	return h.OnBeforeDelete(ctx, resource)
+}
+
+func (h *Hooks) afterDelete(ctx context.Context, resource *prop.Resource) error {
+	if h == nil || h.OnAfterDelete == nil {
+		return nil
+	}
+	return h.OnAfterDelete(ctx, resource)
+}
@@ -0,0 +1,249 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/imulab/go-scim/pkg/v2/crud"
+	"github.com/imulab/go-scim/pkg/v2/db"
+	"github.com/imulab/go-scim/pkg/v2/prop"
+	"github.com/imulab/go-scim/pkg/v2/service/filter"
+	"github.com/imulab/go-scim/pkg/v2/spec"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestHooks(t *testing.T) {
+	s := new(HooksTestSuite)
+	suite.Run(t, s)
+}
+
+type HooksTestSuite struct {
+	suite.Suite
+	config       *spec.ServiceProviderConfig
+	resourceType *spec.ResourceType
+}
+
+func (s *HooksTestSuite) TestCreate() {
+	var created []string
+	hooks := &Hooks{
+		OnBeforeCreate: func(ctx context.Context, resource *prop.Resource) error {
+			if resource.Navigator().Dot("userName").Current().Raw() == "admin" {
+				return fmt.Errorf("%w: userName is reserved", spec.ErrUniqueness)
+			}
+			return resource.Navigator().Dot("entitlements").Add(map[string]interface{}{
+				"value": "basic",
+			}).Error()
+		},
+		OnAfterCreate: func(ctx context.Context, resource *prop.Resource) error {
+			created = append(created, resource.IdOrEmpty())
+			return nil
+		},
+	}
+
+	database := db.Memory()
+	svc := CreateServiceWithHooks(s.resourceType, database, []filter.ByResource{
+		filter.ByPropertyToByResource(filter.UUIDFilter()),
+		filter.MetaFilter(),
+		filter.ByPropertyToByResource(filter.ValidationFilter(database)),
+	}, hooks)
+
+	resp, err := svc.Do(context.TODO(), &CreateRequest{PayloadSource: strings.NewReader(`
+{
+  "schemas": ["urn:ietf:params:scim:schemas:core:2.0:User"],
+  "userName": "foo",
+  "emails": [{"value": "foo@example.com"}]
+}`)})
+	require.Nil(s.T(), err)
+	assert.Equal(s.T(), "basic", resp.Resource.Navigator().Dot("entitlements").At(0).Dot("value").Current().Raw())
+	assert.Equal(s.T(), []string{resp.Resource.IdOrEmpty()}, created)
+
+	_, err = svc.Do(context.TODO(), &CreateRequest{PayloadSource: strings.NewReader(`
+{
+  "schemas": ["urn:ietf:params:scim:schemas:core:2.0:User"],
+  "userName": "admin",
+  "emails": [{"value": "admin@example.com"}]
+}`)})
+	assert.True(s.T(), errors.Is(err, spec.ErrUniqueness))
+	assert.Len(s.T(), created, 1)
+	n, err := database.Count(context.TODO(), "")
+	assert.Nil(s.T(), err)
+	assert.Equal(s.T(), 1, n)
+}
+
+func (s *HooksTestSuite) TestReplace() {
+	var replaced int
+	hooks := &Hooks{
+		OnBeforeReplace: func(ctx context.Context, replacement *prop.Resource, ref *prop.Resource) error {
+			if replacement.Navigator().Dot("userName").Current().Raw() != ref.Navigator().Dot("userName").Current().Raw() {
+				return fmt.Errorf("%w: userName cannot be changed", spec.ErrMutability)
+			}
+			return nil
+		},
+		OnAfterReplace: func(ctx context.Context, replacement *prop.Resource, ref *prop.Resource) error {
+			replaced++
+			return nil
+		},
+	}
+
+	database := s.databaseWith("foo")
+	svc := ReplaceServiceWithHooks(s.config, s.resourceType, database, []filter.ByResource{
+		filter.MetaFilter(),
+	}, hooks)
+
+	_, err := svc.Do(context.TODO(), &ReplaceRequest{ResourceID: "foo", PayloadSource: strings.NewReader(`
+{
+  "schemas": ["urn:ietf:params:scim:schemas:core:2.0:User"],
+  "id": "foo",
+  "userName": "bar"
+}`)})
+	assert.True(s.T(), errors.Is(err, spec.ErrMutability))
+	assert.Equal(s.T(), 0, replaced)
+
+	resp, err := svc.Do(context.TODO(), &ReplaceRequest{ResourceID: "foo", PayloadSource: strings.NewReader(`
+{
+  "schemas": ["urn:ietf:params:scim:schemas:core:2.0:User"],
+  "id": "foo",
+  "userName": "foo",
+  "displayName": "Foo"
+}`)})
+	assert.Nil(s.T(), err)
+	assert.True(s.T(), resp.Replaced)
+	assert.Equal(s.T(), 1, replaced)
+}
+
+func (s *HooksTestSuite) TestPatch() {
+	hooks := &Hooks{
+		OnBeforePatch: func(ctx context.Context, resource *prop.Resource, ref *prop.Resource) error {
+			return resource.Navigator().Dot("nickName").Replace("patched").Error()
+		},
+	}
+
+	database := s.databaseWith("foo")
+	svc := PatchServiceWithHooks(s.config, database, nil, []filter.ByResource{
+		filter.MetaFilter(),
+	}, hooks)
+
+	resp, err := svc.Do(context.TODO(), &PatchRequest{ResourceID: "foo", PayloadSource: strings.NewReader(`
+{
+  "schemas": ["urn:ietf:params:scim:api:messages:2.0:PatchOp"],
+  "Operations": [
+    {
+      "op": "add",
+      "path": "displayName",
+      "value": "Foo"
+    }
+  ]
+}`)})
+	assert.Nil(s.T(), err)
+	assert.True(s.T(), resp.Patched)
+	assert.Equal(s.T(), "patched", resp.Resource.Navigator().Dot("nickName").Current().Raw())
+}
+
+func (s *HooksTestSuite) TestDelete() {
+	var deleted []string
+	hooks := &Hooks{
+		OnBeforeDelete: func(ctx context.Context, resource *prop.Resource) error {
+			if resource.IdOrEmpty() == "root" {
+				return fmt.Errorf("%w: root cannot be deleted", spec.ErrMutability)
+			}
+			return nil
+		},
+		OnAfterDelete: func(ctx context.Context, resource *prop.Resource) error {
+			deleted = append(deleted, resource.IdOrEmpty())
+			return nil
+		},
+	}
+
+	database := s.databaseWith("foo", "root")
+	svc := DeleteServiceWithHooks(s.config, database, hooks)
+
+	_, err := svc.Do(context.TODO(), &DeleteRequest{ResourceID: "root"})
+	assert.True(s.T(), errors.Is(err, spec.ErrMutability))
+	_, err = database.Get(context.TODO(), "root", nil)
+	assert.Nil(s.T(), err)
+
+	_, err = svc.Do(context.TODO(), &DeleteRequest{ResourceID: "foo"})
+	assert.Nil(s.T(), err)
+	assert.Equal(s.T(), []string{"foo"}, deleted)
+}
+
+func (s *HooksTestSuite) databaseWith(ids ...string) db.DB {
+	database := db.Memory()
+	for _, id := range ids {
+		r := prop.NewResource(s.resourceType)
+		require.Nil(s.T(), r.Navigator().Replace(map[string]interface{}{
+			"schemas":  []interface{}{"urn:ietf:params:scim:schemas:core:2.0:User"},
+			"id":       id,
+			"userName": id,
+		}).Error())
+		require.Nil(s.T(), database.Insert(context.TODO(), r))
+	}
+	return database
+}
+
+func (s *HooksTestSuite) SetupSuite() {
+	for _, each := range []struct {
+		filepath  string
+		structure interface{}
+		post      func(parsed interface{})
+	}{
+		{
+			filepath:  "../../../public/schemas/core_schema.json",
+			structure: new(spec.Schema),
+			post: func(parsed interface{}) {
+				spec.Schemas().Register(parsed.(*spec.Schema))
+			},
+		},
+		{
+			filepath:  "../../../public/schemas/user_schema.json",
+			structure: new(spec.Schema),
+			post: func(parsed interface{}) {
+				spec.Schemas().Register(parsed.(*spec.Schema))
+			},
+		},
+		{
+			filepath:  "../../../public/schemas/user_enterprise_extension_schema.json",
+			structure: new(spec.Schema),
+			post: func(parsed interface{}) {
+				spec.Schemas().Register(parsed.(*spec.Schema))
+			},
+		},
+		{
+			filepath:  "../../../public/resource_types/user_resource_type.json",
+			structure: new(spec.ResourceType),
+			post: func(parsed interface{}) {
+				s.resourceType = parsed.(*spec.ResourceType)
+				crud.Register(s.resourceType)
+			},
+		},
+	} {
+		f, err := os.Open(each.filepath)
+		require.Nil(s.T(), err)
+
+		raw, err := ioutil.ReadAll(f)
+		require.Nil(s.T(), err)
+
+		err = json.Unmarshal(raw, each.structure)
+		require.Nil(s.T(), err)
+
+		if each.post != nil {
+			each.post(each.structure)
+		}
+	}
+
+	s.config = new(spec.ServiceProviderConfig)
+	require.Nil(s.T(), json.Unmarshal([]byte(`
+{
+  "patch": {
+    "supported": true
+  }
+}
+`), s.config))
+}
@@ -0,0 +1,107 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/imulab/go-scim/pkg/v2/db"
+	"github.com/imulab/go-scim/pkg/v2/spec"
+	"strconv"
+)
+
+// IdempotentCreateService returns a create resource service that deduplicates requests carrying the same
+// CreateRequest.IdempotencyKey, so that a retried request is answered with the resource created by the original
+// request, marked as CreateResponse.Replayed, instead of creating a duplicate or failing uniqueness. The keys, which are
+// scoped to the resource type, and the ids of the resources created with them are kept in the keys database. Requests
+// without a key are passed on to the create service as is.
+//
+// A request whose key is claimed by another request still in progress fails with an error of spec.ErrUniqueness, and so
+// does a request reusing the key with another payload than the request that claimed it, as told by the fingerprint of
+// the payloads, instead of being answered with a resource it did not ask for. When the resource originally created has
+// since been deleted, the request fails with the error of getting it from the database, usually spec.ErrNotFound.
+//
+// Dry run requests are passed on to the create service as is, as they create nothing to be replayed.
+func IdempotentCreateService(resourceType *spec.ResourceType, create Create, database db.DB, keys db.KeyDB) Create {
+	return &idempotentCreateService{
+		resourceType: resourceType,
+		create:       create,
+		database:     database,
+		keys:         keys,
+	}
+}
+
+type idempotentCreateService struct {
+	resourceType *spec.ResourceType
+	create       Create
+	database     db.DB
+	keys         db.KeyDB
+}
+
+func (s *idempotentCreateService) Do(ctx context.Context, req *CreateRequest) (resp *CreateResponse, err error) {
+	if req == nil || len(req.IdempotencyKey) == 0 || req.DryRun {
+		return s.create.Do(ctx, req)
+	}
+
+	req, fingerprint, err := s.fingerprint(req)
+	if err != nil {
+		return
+	}
+
+	key := s.resourceType.ID() + "/" + req.IdempotencyKey
+	id, claimedWith, claimed, err := s.keys.Claim(ctx, key, fingerprint)
+	if err != nil {
+		return
+	}
+
+	if !claimed {
+		if claimedWith != fingerprint {
+			err = fmt.Errorf("%w: the idempotency key was used with another payload", spec.ErrUniqueness)
+			return
+		}
+		if len(id) == 0 {
+			err = fmt.Errorf("%w: a request with the same idempotency key is in progress", spec.ErrUniqueness)
+			return
+		}
+		resource, getErr := s.database.Get(ctx, id, nil)
+		if getErr != nil {
+			err = getErr
+			return
+		}
+		resp = &CreateResponse{Resource: resource, Replayed: true}
+		return
+	}
+
+	resp, err = s.create.Do(ctx, req)
+	if resp == nil || resp.Resource == nil {
+		_ = s.keys.Release(ctx, key)
+		return
+	}
+	if completeErr := s.keys.Complete(ctx, key, resp.Resource.IdOrEmpty()); completeErr != nil && err == nil {
+		err = completeErr
+	}
+	return
+}
+
+// Returns the fingerprint of the payload of the request, which is the SHA-256 of the payload, or the hash of the
+// resource given in place of a payload. As the payload is read to be fingerprinted, a copy of the request reading the
+// payload again is returned.
+func (s *idempotentCreateService) fingerprint(req *CreateRequest) (*CreateRequest, string, error) {
+	if req.Resource != nil {
+		return req, strconv.FormatUint(req.Resource.Hash(), 16), nil
+	}
+	if req.PayloadSource == nil {
+		return req, "", nil
+	}
+
+	raw, err := readPayload(req.PayloadSource)
+	if err != nil {
+		return nil, "", err
+	}
+	sum := sha256.Sum256(raw)
+
+	copied := *req
+	copied.PayloadSource = bytes.NewReader(raw)
+	return &copied, hex.EncodeToString(sum[:]), nil
+}
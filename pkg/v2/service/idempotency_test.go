@@ -0,0 +1,195 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"github.com/imulab/go-scim/pkg/v2/crud"
+	"github.com/imulab/go-scim/pkg/v2/db"
+	"github.com/imulab/go-scim/pkg/v2/service/filter"
+	"github.com/imulab/go-scim/pkg/v2/spec"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestIdempotency(t *testing.T) {
+	s := new(IdempotencyTestSuite)
+	suite.Run(t, s)
+}
+
+type IdempotencyTestSuite struct {
+	suite.Suite
+	config       *spec.ServiceProviderConfig
+	resourceType *spec.ResourceType
+}
+
+func (s *IdempotencyTestSuite) TestCreate() {
+	const payload = `
+{
+  "schemas": ["urn:ietf:params:scim:schemas:core:2.0:User"],
+  "userName": "foo"
+}`
+	var (
+		database = db.Memory()
+		keys     = db.MemoryKeys(time.Hour)
+		create   = IdempotentCreateService(s.resourceType, CreateService(s.resourceType, database, []filter.ByResource{
+			filter.ByPropertyToByResource(filter.UUIDFilter()),
+			filter.MetaFilter(),
+		}), database, keys)
+	)
+
+	first, err := create.Do(context.TODO(), &CreateRequest{PayloadSource: strings.NewReader(payload), IdempotencyKey: "abc"})
+	require.Nil(s.T(), err)
+	assert.False(s.T(), first.Replayed)
+
+	retried, err := create.Do(context.TODO(), &CreateRequest{PayloadSource: strings.NewReader(payload), IdempotencyKey: "abc"})
+	require.Nil(s.T(), err)
+	assert.True(s.T(), retried.Replayed)
+	assert.Equal(s.T(), first.Resource.IdOrEmpty(), retried.Resource.IdOrEmpty())
+
+	other, err := create.Do(context.TODO(), &CreateRequest{PayloadSource: strings.NewReader(payload), IdempotencyKey: "xyz"})
+	require.Nil(s.T(), err)
+	assert.False(s.T(), other.Replayed)
+	assert.NotEqual(s.T(), first.Resource.IdOrEmpty(), other.Resource.IdOrEmpty())
+
+	unkeyed, err := create.Do(context.TODO(), &CreateRequest{PayloadSource: strings.NewReader(payload)})
+	require.Nil(s.T(), err)
+	assert.False(s.T(), unkeyed.Replayed)
+
+	n, err := database.Count(context.TODO(), "")
+	require.Nil(s.T(), err)
+	assert.Equal(s.T(), 3, n)
+}
+
+func (s *IdempotencyTestSuite) TestCreateFailed() {
+	var (
+		database = db.Memory()
+		keys     = db.MemoryKeys(time.Hour)
+		create   = IdempotentCreateService(s.resourceType, CreateService(s.resourceType, database, []filter.ByResource{
+			filter.ByPropertyToByResource(filter.UUIDFilter()),
+			filter.MetaFilter(),
+		}), database, keys)
+	)
+
+	// failed requests release the key, so that it can be retried
+	_, err := create.Do(context.TODO(), &CreateRequest{PayloadSource: strings.NewReader(`{`), IdempotencyKey: "abc"})
+	assert.NotNil(s.T(), err)
+
+	resp, err := create.Do(context.TODO(), &CreateRequest{PayloadSource: strings.NewReader(`
+{
+  "schemas": ["urn:ietf:params:scim:schemas:core:2.0:User"],
+  "userName": "foo"
+}`), IdempotencyKey: "abc"})
+	require.Nil(s.T(), err)
+	assert.False(s.T(), resp.Replayed)
+}
+
+func (s *IdempotencyTestSuite) TestInProgress() {
+	sum := sha256.Sum256([]byte(`{}`))
+	keys := db.MemoryKeys(time.Hour)
+	_, _, claimed, err := keys.Claim(context.TODO(), "User/abc", hex.EncodeToString(sum[:]))
+	require.Nil(s.T(), err)
+	require.True(s.T(), claimed)
+
+	create := IdempotentCreateService(s.resourceType, CreateService(s.resourceType, db.Memory(), nil), db.Memory(), keys)
+	_, err = create.Do(context.TODO(), &CreateRequest{PayloadSource: strings.NewReader(`{}`), IdempotencyKey: "abc"})
+	assert.True(s.T(), errors.Is(err, spec.ErrUniqueness))
+	assert.Contains(s.T(), err.Error(), "in progress")
+}
+
+func (s *IdempotencyTestSuite) TestKeyReused() {
+	var (
+		database = db.Memory()
+		create   = IdempotentCreateService(s.resourceType, CreateService(s.resourceType, database, []filter.ByResource{
+			filter.ByPropertyToByResource(filter.UUIDFilter()),
+			filter.MetaFilter(),
+		}), database, db.MemoryKeys(time.Hour))
+	)
+
+	_, err := create.Do(context.TODO(), &CreateRequest{PayloadSource: strings.NewReader(`
+{
+  "schemas": ["urn:ietf:params:scim:schemas:core:2.0:User"],
+  "userName": "foo"
+}`), IdempotencyKey: "abc"})
+	require.Nil(s.T(), err)
+
+	_, err = create.Do(context.TODO(), &CreateRequest{PayloadSource: strings.NewReader(`
+{
+  "schemas": ["urn:ietf:params:scim:schemas:core:2.0:User"],
+  "userName": "bar"
+}`), IdempotencyKey: "abc"})
+	assert.True(s.T(), errors.Is(err, spec.ErrUniqueness))
+	assert.Contains(s.T(), err.Error(), "another payload")
+
+	n, err := database.Count(context.TODO(), "")
+	require.Nil(s.T(), err)
+	assert.Equal(s.T(), 1, n)
+}
+
+func (s *IdempotencyTestSuite) SetupSuite() {
+	for _, each := range []struct {
+		filepath  string
+		structure interface{}
+		post      func(parsed interface{})
+	}{
+		{
+			filepath:  "../../../public/schemas/core_schema.json",
+			structure: new(spec.Schema),
+			post: func(parsed interface{}) {
+				spec.Schemas().Register(parsed.(*spec.Schema))
+			},
+		},
+		{
+			filepath:  "../../../public/schemas/user_schema.json",
+			structure: new(spec.Schema),
+			post: func(parsed interface{}) {
+				spec.Schemas().Register(parsed.(*spec.Schema))
+			},
+		},
+		{
+			filepath:  "../../../public/schemas/user_enterprise_extension_schema.json",
+			structure: new(spec.Schema),
+			post: func(parsed interface{}) {
+				spec.Schemas().Register(parsed.(*spec.Schema))
+			},
+		},
+		{
+			filepath:  "../../../public/resource_types/user_resource_type.json",
+			structure: new(spec.ResourceType),
+			post: func(parsed interface{}) {
+				s.resourceType = parsed.(*spec.ResourceType)
+				crud.Register(s.resourceType)
+			},
+		},
+	} {
+		f, err := os.Open(each.filepath)
+		require.Nil(s.T(), err)
+
+		raw, err := ioutil.ReadAll(f)
+		require.Nil(s.T(), err)
+
+		err = json.Unmarshal(raw, each.structure)
+		require.Nil(s.T(), err)
+
+		if each.post != nil {
+			each.post(each.structure)
+		}
+	}
+
+	s.config = new(spec.ServiceProviderConfig)
+	require.Nil(s.T(), json.Unmarshal([]byte(`
+{
+  "patch": {
+    "supported": true
+  }
+}
+`), s.config))
+}
@@ -0,0 +1,275 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"github.com/imulab/go-scim/pkg/v2/json"
+	"github.com/imulab/go-scim/pkg/v2/prop"
+	"github.com/imulab/go-scim/pkg/v2/spec"
+	"io"
+)
+
+// Operations of the resource services, as reported by Invocation.
+const (
+	OpCreate  = "create"
+	OpGet     = "get"
+	OpGetMany = "get_many"
+	OpReplace = "replace"
+	OpPatch   = "patch"
+	OpDelete  = "delete"
+	OpQuery   = "query"
+)
+
+// Interceptor is notified before and after every call to the resource services wrapped by an InterceptorChain, so that
+// cross-cutting concerns like authorization, tenancy, auditing and metrics can be implemented once for all services.
+type Interceptor interface {
+	// Before is called before the service is called. The returned context, which is usually derived from ctx, is
+	// passed on to the next interceptors and the service. A non-nil error aborts the call, and is returned to the caller
+	// instead of calling the service.
+	Before(ctx context.Context, inv *Invocation) (context.Context, error)
+	// After is called after the service has returned, with the error returned by the service, or by the Before of
+	// the next interceptors. The response of the service, if any, is available in the invocation. The returned error,
+	// which is usually err itself, is returned to the caller.
+	After(ctx context.Context, inv *Invocation, err error) error
+}
+
+// Invocation describes a call to a resource service.
+type Invocation struct {
+	// Operation of the service, i.e. OpCreate.
+	Operation string
+	// ResourceType of the service.
+	ResourceType *spec.ResourceType
+	// Request to the service, i.e. *CreateRequest for OpCreate.
+	Request interface{}
+	// Response of the service, i.e. *CreateResponse for OpCreate. Only available in Interceptor.After, and
+	// only when the service has been called without error.
+	Response interface{}
+	// source of the request payload, if the request has one, or the resource given in place of it
+	payload  *io.Reader
+	resource *prop.Resource
+	raw      []byte
+}
+
+// Payload returns the raw payload of create, replace and patch requests, or nil for other requests. The payload is
+// read only once, and the request payload source is replaced, so that it can still be read by the service. Requests
+// with a resource in place of the payload have its JSON serialization, without the attributes never returned, as
+// payload.
+func (inv *Invocation) Payload() ([]byte, error) {
+	if inv.raw != nil {
+		return inv.raw, nil
+	}
+
+	switch {
+	case inv.resource != nil:
+		raw, err := json.Serialize(inv.resource)
+		if err != nil {
+			return nil, err
+		}
+		inv.raw = raw
+	case inv.payload != nil && *inv.payload != nil:
+		raw, err := readPayload(*inv.payload)
+		if err != nil {
+			return nil, err
+		}
+		inv.raw = raw
+		*inv.payload = bytes.NewReader(raw)
+	}
+	return inv.raw, nil
+}
+
+// Interceptors returns an InterceptorChain with the interceptors. The Before of the interceptors are called in the
+// given order, and the After in the reverse order. Interceptors whose Before was not called do not have their After
+// called, i.e. when an earlier interceptor has returned an error.
+func Interceptors(interceptors ...Interceptor) InterceptorChain {
+	return InterceptorChain{interceptors: interceptors}
+}
+
+// InterceptorChain wraps resource services so that every call to them goes through the interceptors. See Interceptors.
+type InterceptorChain struct {
+	interceptors []Interceptor
+}
+
+// Create returns the create service wrapped with the chain.
+func (c InterceptorChain) Create(resourceType *spec.ResourceType, svc Create) Create {
+	return &interceptedCreate{chain: c, resourceType: resourceType, svc: svc}
+}
+
+// Get returns the get service wrapped with the chain.
+func (c InterceptorChain) Get(resourceType *spec.ResourceType, svc Get) Get {
+	return &interceptedGet{chain: c, resourceType: resourceType, svc: svc}
+}
+
+// GetMany returns the get many service wrapped with the chain.
+func (c InterceptorChain) GetMany(resourceType *spec.ResourceType, svc GetMany) GetMany {
+	return &interceptedGetMany{chain: c, resourceType: resourceType, svc: svc}
+}
+
+// Replace returns the replace service wrapped with the chain.
+func (c InterceptorChain) Replace(resourceType *spec.ResourceType, svc Replace) Replace {
+	return &interceptedReplace{chain: c, resourceType: resourceType, svc: svc}
+}
+
+// Patch returns the patch service wrapped with the chain.
+func (c InterceptorChain) Patch(resourceType *spec.ResourceType, svc Patch) Patch {
+	return &interceptedPatch{chain: c, resourceType: resourceType, svc: svc}
+}
+
+// Membership returns the membership service wrapped with the chain. Changes of membership are patches of the groups,
+// hence they are intercepted as OpPatch invocations, with a *MembershipRequest, no payload, and a *PatchResponse.
+func (c InterceptorChain) Membership(resourceType *spec.ResourceType, svc Membership) Membership {
+	return &interceptedMembership{chain: c, resourceType: resourceType, svc: svc}
+}
+
+// Delete returns the delete service wrapped with the chain.
+func (c InterceptorChain) Delete(resourceType *spec.ResourceType, svc Delete) Delete {
+	return &interceptedDelete{chain: c, resourceType: resourceType, svc: svc}
+}
+
+// Query returns the query service wrapped with the chain.
+func (c InterceptorChain) Query(resourceType *spec.ResourceType, svc Query) Query {
+	return &interceptedQuery{chain: c, resourceType: resourceType, svc: svc}
+}
+
+// Calls the interceptors around the call function, which calls the service and returns its response.
+func (c InterceptorChain) intercept(ctx context.Context, inv *Invocation, call func(ctx context.Context) (interface{}, error)) (err error) {
+	// contexts returned by the Before of called interceptors, to be passed to their After
+	contexts := make([]context.Context, 0, len(c.interceptors))
+	defer func() {
+		for i := len(contexts) - 1; i >= 0; i-- {
+			err = c.interceptors[i].After(contexts[i], inv, err)
+		}
+	}()
+
+	for _, interceptor := range c.interceptors {
+		if ctx, err = interceptor.Before(ctx, inv); err != nil {
+			return
+		}
+		contexts = append(contexts, ctx)
+	}
+
+	var resp interface{}
+	if resp, err = call(ctx); err == nil {
+		inv.Response = resp
+	}
+	return
+}
+
+type interceptedCreate struct {
+	chain        InterceptorChain
+	resourceType *spec.ResourceType
+	svc          Create
+}
+
+func (s *interceptedCreate) Do(ctx context.Context, req *CreateRequest) (resp *CreateResponse, err error) {
+	inv := &Invocation{Operation: OpCreate, ResourceType: s.resourceType, Request: req, payload: &req.PayloadSource, resource: req.Resource}
+	err = s.chain.intercept(ctx, inv, func(ctx context.Context) (interface{}, error) {
+		return s.svc.Do(ctx, req)
+	})
+	resp, _ = inv.Response.(*CreateResponse)
+	return
+}
+
+type interceptedGet struct {
+	chain        InterceptorChain
+	resourceType *spec.ResourceType
+	svc          Get
+}
+
+func (s *interceptedGet) Do(ctx context.Context, req *GetRequest) (resp *GetResponse, err error) {
+	inv := &Invocation{Operation: OpGet, ResourceType: s.resourceType, Request: req}
+	err = s.chain.intercept(ctx, inv, func(ctx context.Context) (interface{}, error) {
+		return s.svc.Do(ctx, req)
+	})
+	resp, _ = inv.Response.(*GetResponse)
+	return
+}
+
+type interceptedGetMany struct {
+	chain        InterceptorChain
+	resourceType *spec.ResourceType
+	svc          GetMany
+}
+
+func (s *interceptedGetMany) Do(ctx context.Context, req *GetManyRequest) (resp *GetManyResponse, err error) {
+	inv := &Invocation{Operation: OpGetMany, ResourceType: s.resourceType, Request: req}
+	err = s.chain.intercept(ctx, inv, func(ctx context.Context) (interface{}, error) {
+		return s.svc.Do(ctx, req)
+	})
+	resp, _ = inv.Response.(*GetManyResponse)
+	return
+}
+
+type interceptedReplace struct {
+	chain        InterceptorChain
+	resourceType *spec.ResourceType
+	svc          Replace
+}
+
+func (s *interceptedReplace) Do(ctx context.Context, req *ReplaceRequest) (resp *ReplaceResponse, err error) {
+	inv := &Invocation{Operation: OpReplace, ResourceType: s.resourceType, Request: req, payload: &req.PayloadSource, resource: req.Resource}
+	err = s.chain.intercept(ctx, inv, func(ctx context.Context) (interface{}, error) {
+		return s.svc.Do(ctx, req)
+	})
+	resp, _ = inv.Response.(*ReplaceResponse)
+	return
+}
+
+type interceptedPatch struct {
+	chain        InterceptorChain
+	resourceType *spec.ResourceType
+	svc          Patch
+}
+
+func (s *interceptedPatch) Do(ctx context.Context, req *PatchRequest) (resp *PatchResponse, err error) {
+	inv := &Invocation{Operation: OpPatch, ResourceType: s.resourceType, Request: req, payload: &req.PayloadSource}
+	err = s.chain.intercept(ctx, inv, func(ctx context.Context) (interface{}, error) {
+		return s.svc.Do(ctx, req)
+	})
+	resp, _ = inv.Response.(*PatchResponse)
+	return
+}
+
+type interceptedMembership struct {
+	chain        InterceptorChain
+	resourceType *spec.ResourceType
+	svc          Membership
+}
+
+func (s *interceptedMembership) Do(ctx context.Context, req *MembershipRequest) (resp *PatchResponse, err error) {
+	inv := &Invocation{Operation: OpPatch, ResourceType: s.resourceType, Request: req}
+	err = s.chain.intercept(ctx, inv, func(ctx context.Context) (interface{}, error) {
+		return s.svc.Do(ctx, req)
+	})
+	resp, _ = inv.Response.(*PatchResponse)
+	return
+}
+
+type interceptedDelete struct {
+	chain        InterceptorChain
+	resourceType *spec.ResourceType
+	svc          Delete
+}
+
+func (s *interceptedDelete) Do(ctx context.Context, req *DeleteRequest) (resp *DeleteResponse, err error) {
+	inv := &Invocation{Operation: OpDelete, ResourceType: s.resourceType, Request: req}
+	err = s.chain.intercept(ctx, inv, func(ctx context.Context) (interface{}, error) {
+		return s.svc.Do(ctx, req)
+	})
+	resp, _ = inv.Response.(*DeleteResponse)
+	return
+}
+
+type interceptedQuery struct {
+	chain        InterceptorChain
+	resourceType *spec.ResourceType
+	svc          Query
+}
+
+func (s *interceptedQuery) Do(ctx context.Context, req *QueryRequest) (resp *QueryResponse, err error) {
+	inv := &Invocation{Operation: OpQuery, ResourceType: s.resourceType, Request: req}
+	err = s.chain.intercept(ctx, inv, func(ctx context.Context) (interface{}, error) {
+		return s.svc.Do(ctx, req)
+	})
+	resp, _ = inv.Response.(*QueryResponse)
+	return
+}
@@ -0,0 +1,211 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/imulab/go-scim/pkg/v2/crud"
+	"github.com/imulab/go-scim/pkg/v2/db"
+	"github.com/imulab/go-scim/pkg/v2/prop"
+	"github.com/imulab/go-scim/pkg/v2/service/filter"
+	"github.com/imulab/go-scim/pkg/v2/spec"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestInterceptorChain(t *testing.T) {
+	s := new(InterceptorChainTestSuite)
+	suite.Run(t, s)
+}
+
+type InterceptorChainTestSuite struct {
+	suite.Suite
+	config       *spec.ServiceProviderConfig
+	resourceType *spec.ResourceType
+}
+
+type recordingInterceptorKey struct{}
+
+// Records the calls to Before and After, and optionally rejects calls in Before.
+type recordingInterceptor struct {
+	name   string
+	calls  *[]string
+	reject error
+}
+
+func (i *recordingInterceptor) Before(ctx context.Context, inv *Invocation) (context.Context, error) {
+	*i.calls = append(*i.calls, fmt.Sprintf("%s.before(%s,%s)", i.name, inv.Operation, inv.ResourceType.ID()))
+	if i.reject != nil {
+		return ctx, i.reject
+	}
+	return context.WithValue(ctx, recordingInterceptorKey{}, i.name), nil
+}
+
+func (i *recordingInterceptor) After(ctx context.Context, inv *Invocation, err error) error {
+	*i.calls = append(*i.calls, fmt.Sprintf("%s.after(%v,%v,%v)", i.name, ctx.Value(recordingInterceptorKey{}), inv.Response != nil, err != nil))
+	return err
+}
+
+// Reads the payload in Before, and keeps it.
+type payloadInterceptor struct {
+	payload string
+}
+
+func (i *payloadInterceptor) Before(ctx context.Context, inv *Invocation) (context.Context, error) {
+	raw, err := inv.Payload()
+	i.payload = string(raw)
+	return ctx, err
+}
+
+func (i *payloadInterceptor) After(_ context.Context, _ *Invocation, err error) error {
+	return err
+}
+
+func (s *InterceptorChainTestSuite) TestCreate() {
+	var (
+		calls    []string
+		payload  = new(payloadInterceptor)
+		database = db.Memory()
+		svc      = Interceptors(
+			&recordingInterceptor{name: "a", calls: &calls},
+			payload,
+			&recordingInterceptor{name: "b", calls: &calls},
+		).Create(s.resourceType, CreateService(s.resourceType, database, []filter.ByResource{
+			filter.ByPropertyToByResource(filter.UUIDFilter()),
+			filter.MetaFilter(),
+		}))
+	)
+
+	body := `{"schemas":["urn:ietf:params:scim:schemas:core:2.0:User"],"userName":"foo"}`
+	resp, err := svc.Do(context.TODO(), &CreateRequest{PayloadSource: strings.NewReader(body)})
+	assert.Nil(s.T(), err)
+	require.NotNil(s.T(), resp)
+	assert.Equal(s.T(), "foo", resp.Resource.Navigator().Dot("userName").Current().Raw())
+	assert.Equal(s.T(), body, payload.payload)
+	assert.Equal(s.T(), []string{
+		"a.before(create,User)",
+		"b.before(create,User)",
+		"b.after(b,true,false)",
+		"a.after(a,true,false)",
+	}, calls)
+}
+
+func (s *InterceptorChainTestSuite) TestCreateResource() {
+	var (
+		payload  = new(payloadInterceptor)
+		database = db.Memory()
+		svc      = Interceptors(payload).Create(s.resourceType, CreateService(s.resourceType, database, []filter.ByResource{
+			filter.ByPropertyToByResource(filter.UUIDFilter()),
+			filter.MetaFilter(),
+		}))
+	)
+
+	resource := prop.NewResource(s.resourceType)
+	require.Nil(s.T(), resource.Navigator().Replace(map[string]interface{}{
+		"schemas":  []interface{}{"urn:ietf:params:scim:schemas:core:2.0:User"},
+		"userName": "foo",
+	}).Error())
+
+	resp, err := svc.Do(context.TODO(), &CreateRequest{Resource: resource})
+	assert.Nil(s.T(), err)
+	require.NotNil(s.T(), resp)
+	assert.Equal(s.T(), `{"schemas":["urn:ietf:params:scim:schemas:core:2.0:User"],"id":null,"userName":"foo"}`, payload.payload)
+}
+
+func (s *InterceptorChainTestSuite) TestReject() {
+	var (
+		calls    []string
+		database = db.Memory()
+		svc      = Interceptors(
+			&recordingInterceptor{name: "a", calls: &calls},
+			&recordingInterceptor{name: "b", calls: &calls, reject: fmt.Errorf("%w: not allowed", spec.ErrSensitive)},
+			&recordingInterceptor{name: "c", calls: &calls},
+		).Delete(s.resourceType, DeleteService(s.config, database))
+	)
+
+	resp, err := svc.Do(context.TODO(), &DeleteRequest{ResourceID: "foo"})
+	assert.Nil(s.T(), resp)
+	assert.True(s.T(), errors.Is(err, spec.ErrSensitive))
+	assert.Equal(s.T(), []string{
+		"a.before(delete,User)",
+		"b.before(delete,User)",
+		"a.after(a,false,true)",
+	}, calls)
+}
+
+func (s *InterceptorChainTestSuite) TestServiceError() {
+	var (
+		calls    []string
+		database = db.Memory()
+		svc      = Interceptors(
+			&recordingInterceptor{name: "a", calls: &calls},
+		).Get(s.resourceType, GetService(database))
+	)
+
+	resp, err := svc.Do(context.TODO(), &GetRequest{ResourceID: "foo"})
+	assert.Nil(s.T(), resp)
+	assert.True(s.T(), errors.Is(err, spec.ErrNotFound))
+	assert.Equal(s.T(), []string{
+		"a.before(get,User)",
+		"a.after(a,false,true)",
+	}, calls)
+}
+
+func (s *InterceptorChainTestSuite) SetupSuite() {
+	for _, each := range []struct {
+		filepath  string
+		structure interface{}
+		post      func(parsed interface{})
+	}{
+		{
+			filepath:  "../../../public/schemas/core_schema.json",
+			structure: new(spec.Schema),
+			post: func(parsed interface{}) {
+				spec.Schemas().Register(parsed.(*spec.Schema))
+			},
+		},
+		{
+			filepath:  "../../../public/schemas/user_schema.json",
+			structure: new(spec.Schema),
+			post: func(parsed interface{}) {
+				spec.Schemas().Register(parsed.(*spec.Schema))
+			},
+		},
+		{
+			filepath:  "../../../public/schemas/user_enterprise_extension_schema.json",
+			structure: new(spec.Schema),
+			post: func(parsed interface{}) {
+				spec.Schemas().Register(parsed.(*spec.Schema))
+			},
+		},
+		{
+			filepath:  "../../../public/resource_types/user_resource_type.json",
+			structure: new(spec.ResourceType),
+			post: func(parsed interface{}) {
+				s.resourceType = parsed.(*spec.ResourceType)
+				crud.Register(s.resourceType)
+			},
+		},
+	} {
+		f, err := os.Open(each.filepath)
+		require.Nil(s.T(), err)
+
+		raw, err := ioutil.ReadAll(f)
+		require.Nil(s.T(), err)
+
+		err = json.Unmarshal(raw, each.structure)
+		require.Nil(s.T(), err)
+
+		if each.post != nil {
+			each.post(each.structure)
+		}
+	}
+
+	s.config = new(spec.ServiceProviderConfig)
+}
@@ -0,0 +1,233 @@
+package jsonpatch
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/imulab/go-scim/pkg/v2/crud"
+	"github.com/imulab/go-scim/pkg/v2/crud/expr"
+	scimjson "github.com/imulab/go-scim/pkg/v2/json"
+	"github.com/imulab/go-scim/pkg/v2/prop"
+	"github.com/imulab/go-scim/pkg/v2/service"
+	"github.com/imulab/go-scim/pkg/v2/spec"
+)
+
+// FromPatchPayload converts the SCIM patch payload to JSON Patch operations against the current state of the resource.
+// The resource itself is not modified.
+//
+// Value filters in the SCIM path are evaluated against the resource, and one JSON Patch operation is produced for each
+// matching element. SCIM add on a multiValued attribute appends each element with the "-" index; SCIM add on a complex
+// attribute merges each assigned sub attribute. SCIM replace on an unassigned target becomes an add, and SCIM remove on
+// an unassigned target produces no operation at all, since JSON Patch requires the target to exist in both cases.
+func FromPatchPayload(resource *prop.Resource, payload *service.PatchPayload) ([]Operation, error) {
+	if err := payload.Validate(); err != nil {
+		return nil, err
+	}
+
+	var (
+		working    = resource.Clone()
+		operations = make([]Operation, 0)
+	)
+	for _, each := range payload.Operations {
+		converted, err := fromSCIM(working, each)
+		if err != nil {
+			return nil, err
+		}
+		if err := each.Apply(working); err != nil {
+			return nil, err
+		}
+		operations = append(operations, converted...)
+	}
+
+	return operations, nil
+}
+
+// match is a property reached by a SCIM path, along with its JSON Pointer reference tokens.
+type match struct {
+	tokens   []string
+	property prop.Property
+}
+
+func fromSCIM(resource *prop.Resource, op service.PatchOperation) ([]Operation, error) {
+	matches, err := resolvePath(resource, op.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	var operations []Operation
+	switch strings.ToLower(op.Op) {
+	case opAdd, opReplace:
+		for _, m := range matches {
+			value, err := scimjson.DeserializeValue(op.Value, m.property.Attribute(), strings.ToLower(op.Op) == opAdd)
+			if err != nil {
+				return nil, err
+			}
+
+			var converted []Operation
+			if strings.ToLower(op.Op) == opAdd {
+				converted, err = addOperations(m.tokens, m.property, value)
+			} else {
+				converted, err = replaceOperations(m.tokens, m.property, value)
+			}
+			if err != nil {
+				return nil, err
+			}
+			operations = append(operations, converted...)
+		}
+	case opRemove:
+		// Remove in reverse document order, so that removing an element does not shift the index of the elements
+		// still to be removed.
+		for i := len(matches) - 1; i >= 0; i-- {
+			if matches[i].property.IsUnassigned() {
+				continue
+			}
+			operations = append(operations, Operation{Op: opRemove, Path: formatPointer(matches[i].tokens)})
+		}
+	}
+
+	return operations, nil
+}
+
+func addOperations(tokens []string, current prop.Property, value prop.Property) ([]Operation, error) {
+	if value.IsUnassigned() {
+		return nil, nil
+	}
+
+	attr := current.Attribute()
+	switch {
+	case attr.MultiValued():
+		var operations []Operation
+		err := value.ForEachChild(func(_ int, elem prop.Property) error {
+			raw, err := encodeValue(elem)
+			if err != nil {
+				return err
+			}
+			operations = append(operations, Operation{
+				Op:    opAdd,
+				Path:  formatPointer(append(tokens[:len(tokens):len(tokens)], "-")),
+				Value: raw,
+			})
+			return nil
+		})
+		return operations, err
+	case attr.Type() == spec.TypeComplex && !current.IsUnassigned():
+		var operations []Operation
+		err := value.ForEachChild(func(index int, sub prop.Property) error {
+			currentSub, err := current.ChildAtIndex(sub.Attribute().Name())
+			if err != nil {
+				return err
+			}
+			converted, err := addOperations(append(tokens[:len(tokens):len(tokens)], sub.Attribute().Name()), currentSub, sub)
+			if err != nil {
+				return err
+			}
+			operations = append(operations, converted...)
+			return nil
+		})
+		return operations, err
+	default:
+		raw, err := encodeValue(value)
+		if err != nil {
+			return nil, err
+		}
+		return []Operation{{Op: opAdd, Path: formatPointer(tokens), Value: raw}}, nil
+	}
+}
+
+func replaceOperations(tokens []string, current prop.Property, value prop.Property) ([]Operation, error) {
+	// Replacing the resource root replaces each top level attribute supplied.
+	if len(tokens) == 0 {
+		var operations []Operation
+		err := value.ForEachChild(func(_ int, sub prop.Property) error {
+			if sub.IsUnassigned() {
+				return nil
+			}
+			currentSub, err := current.ChildAtIndex(sub.Attribute().Name())
+			if err != nil {
+				return err
+			}
+			converted, err := replaceOperations([]string{sub.Attribute().Name()}, currentSub, sub)
+			if err != nil {
+				return err
+			}
+			operations = append(operations, converted...)
+			return nil
+		})
+		return operations, err
+	}
+
+	raw, err := encodeValue(value)
+	if err != nil {
+		return nil, err
+	}
+	if current.IsUnassigned() {
+		return []Operation{{Op: opAdd, Path: formatPointer(tokens), Value: raw}}, nil
+	}
+	return []Operation{{Op: opReplace, Path: formatPointer(tokens), Value: raw}}, nil
+}
+
+// Resolve the SCIM path against the resource and return all matching properties in document order. An empty path
+// matches the resource root.
+func resolvePath(resource *prop.Resource, path string) ([]*match, error) {
+	if len(path) == 0 {
+		return []*match{{tokens: []string{}, property: resource.RootProperty()}}, nil
+	}
+
+	head, err := expr.CompilePath(path)
+	if err != nil {
+		return nil, err
+	}
+	if head.IsPath() && strings.ToLower(head.Token()) == strings.ToLower(resource.ResourceType().Schema().ID()) {
+		head = head.Next()
+	}
+
+	var matches []*match
+	if err := walk(resource.RootProperty(), head, []string{}, &matches); err != nil {
+		return nil, err
+	}
+	return matches, nil
+}
+
+func walk(current prop.Property, cursor *expr.Expression, tokens []string, matches *[]*match) error {
+	if cursor == nil {
+		*matches = append(*matches, &match{tokens: tokens, property: current})
+		return nil
+	}
+
+	if cursor.IsRootOfFilter() {
+		if !current.Attribute().MultiValued() {
+			return fmt.Errorf("%w: filter applied to singular attribute", spec.ErrInvalidFilter)
+		}
+		return current.ForEachChild(func(index int, elem prop.Property) error {
+			ok, err := crud.EvaluateExpressionOnProperty(elem, cursor)
+			if err != nil {
+				return err
+			} else if !ok {
+				return nil
+			}
+			return walk(elem, cursor.Next(), append(tokens[:len(tokens):len(tokens)], strconv.Itoa(index)), matches)
+		})
+	}
+
+	if current.Attribute().MultiValued() {
+		return current.ForEachChild(func(index int, elem prop.Property) error {
+			return walk(elem, cursor, append(tokens[:len(tokens):len(tokens)], strconv.Itoa(index)), matches)
+		})
+	}
+
+	child, err := current.ChildAtIndex(cursor.Token())
+	if err != nil {
+		return err
+	}
+	return walk(child, cursor.Next(), append(tokens[:len(tokens):len(tokens)], child.Attribute().Name()), matches)
+}
+
+func encodeValue(property prop.Property) (json.RawMessage, error) {
+	raw, err := json.Marshal(property.Raw())
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to encode value of '%s'", spec.ErrInternal, property.Attribute().Path())
+	}
+	return raw, nil
+}
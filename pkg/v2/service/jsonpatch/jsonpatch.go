@@ -0,0 +1,380 @@
+// This package converts between RFC 6902 JSON Patch documents and SCIM patch operations described in RFC 7644.
+//
+// JSON Patch addresses values by JSON Pointer, which indexes multiValued attributes by position, while SCIM addresses
+// values by path, which selects multiValued elements by value filter. Hence, both conversions work against the current
+// state of a resource: array indexes are converted to value selectors of the element at that index, and value filters
+// are converted to the indexes of the matching elements. Operations are applied to a working copy of the resource as
+// they are converted, so later operations see the effect of earlier ones, just like the patch service would.
+package jsonpatch
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/imulab/go-scim/pkg/v2/annotation"
+	scimjson "github.com/imulab/go-scim/pkg/v2/json"
+	"github.com/imulab/go-scim/pkg/v2/prop"
+	"github.com/imulab/go-scim/pkg/v2/service"
+	"github.com/imulab/go-scim/pkg/v2/spec"
+)
+
+// Operation is a single RFC 6902 JSON Patch operation.
+type Operation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	From  string          `json:"from,omitempty"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+const (
+	opAdd     = "add"
+	opRemove  = "remove"
+	opReplace = "replace"
+	opMove    = "move"
+	opCopy    = "copy"
+	opTest    = "test"
+
+	patchOpSchema = "urn:ietf:params:scim:api:messages:2.0:PatchOp"
+)
+
+// ToPatchPayload converts the JSON Patch operations to a SCIM patch payload against the current state of the resource.
+// The resource itself is not modified.
+//
+// add, remove and replace are converted to their SCIM counterparts. move is converted to a remove followed by an add;
+// copy is converted to an add. test is evaluated during conversion and produces no SCIM operation; a failed test
+// results in a conflict error. Elements of a multiValued complex attribute are selected by the values of their identity
+// sub attributes (or all assigned sub attributes, when none is annotated with @Identity). Elements of a multiValued
+// simple attribute cannot be selected by filter, hence operations on them are converted to a replace of the whole
+// attribute.
+func ToPatchPayload(resource *prop.Resource, operations []Operation) (*service.PatchPayload, error) {
+	payload := &service.PatchPayload{
+		Schemas:    []string{patchOpSchema},
+		Operations: []service.PatchOperation{},
+	}
+
+	working := resource.Clone()
+	for _, each := range operations {
+		converted, err := toSCIM(working, each)
+		if err != nil {
+			return nil, err
+		}
+		for _, op := range converted {
+			if err := op.Apply(working); err != nil {
+				return nil, err
+			}
+			payload.Operations = append(payload.Operations, op)
+		}
+	}
+
+	return payload, nil
+}
+
+func toSCIM(resource *prop.Resource, op Operation) ([]service.PatchOperation, error) {
+	switch strings.ToLower(op.Op) {
+	case opAdd:
+		t, err := resolvePointer(resource, op.Path)
+		if err != nil {
+			return nil, err
+		}
+		if len(op.Value) == 0 {
+			return nil, fmt.Errorf("%w: no value for add operation", spec.ErrInvalidSyntax)
+		}
+		if t.isElement() {
+			// SCIM does not order multiValued elements, an element insertion at any position is an append.
+			return []service.PatchOperation{{Op: opAdd, Path: t.multiPath, Value: op.Value}}, nil
+		}
+		return []service.PatchOperation{{Op: opAdd, Path: t.path, Value: op.Value}}, nil
+
+	case opReplace:
+		t, err := resolvePointer(resource, op.Path)
+		if err != nil {
+			return nil, err
+		}
+		if len(op.Value) == 0 {
+			return nil, fmt.Errorf("%w: no value for replace operation", spec.ErrInvalidSyntax)
+		}
+		if err := t.mustExist(op.Path); err != nil {
+			return nil, err
+		}
+		switch {
+		case t.isSimpleElement():
+			return t.replaceSimpleElements(op.Value)
+		case t.isElement():
+			return []service.PatchOperation{
+				{Op: opRemove, Path: t.path},
+				{Op: opAdd, Path: t.multiPath, Value: op.Value},
+			}, nil
+		default:
+			return []service.PatchOperation{{Op: opReplace, Path: t.path, Value: op.Value}}, nil
+		}
+
+	case opRemove:
+		t, err := resolvePointer(resource, op.Path)
+		if err != nil {
+			return nil, err
+		}
+		if len(t.path) == 0 {
+			return nil, fmt.Errorf("%w: cannot remove the resource root", spec.ErrInvalidPath)
+		}
+		if err := t.mustExist(op.Path); err != nil {
+			return nil, err
+		}
+		if t.isSimpleElement() {
+			return t.replaceSimpleElements(nil)
+		}
+		return []service.PatchOperation{{Op: opRemove, Path: t.path}}, nil
+
+	case opMove, opCopy:
+		from, err := resolvePointer(resource, op.From)
+		if err != nil {
+			return nil, err
+		}
+		if err := from.mustExist(op.From); err != nil {
+			return nil, err
+		}
+		value, err := json.Marshal(from.property.Raw())
+		if err != nil {
+			return nil, fmt.Errorf("%w: failed to encode value at '%s'", spec.ErrInternal, op.From)
+		}
+
+		var ops []Operation
+		if strings.ToLower(op.Op) == opMove {
+			if op.Path == op.From || strings.HasPrefix(op.Path, op.From+"/") {
+				return nil, fmt.Errorf("%w: cannot move '%s' into itself", spec.ErrInvalidPath, op.From)
+			}
+			ops = append(ops, Operation{Op: opRemove, Path: op.From})
+		}
+		ops = append(ops, Operation{Op: opAdd, Path: op.Path, Value: value})
+
+		// The add must be resolved after the remove has taken effect, hence convert and apply them one by one.
+		var converted []service.PatchOperation
+		working := resource.Clone()
+		for _, each := range ops {
+			scimOps, err := toSCIM(working, each)
+			if err != nil {
+				return nil, err
+			}
+			for _, scimOp := range scimOps {
+				if err := scimOp.Apply(working); err != nil {
+					return nil, err
+				}
+			}
+			converted = append(converted, scimOps...)
+		}
+		return converted, nil
+
+	case opTest:
+		t, err := resolvePointer(resource, op.Path)
+		if err != nil {
+			return nil, err
+		}
+		if err := t.mustExist(op.Path); err != nil {
+			return nil, err
+		}
+		expect, err := scimjson.DeserializeValue(op.Value, t.property.Attribute(), false)
+		if err != nil {
+			return nil, err
+		}
+		if !expect.Matches(t.property) {
+			return nil, fmt.Errorf("%w: test failed at '%s'", spec.ErrConflict, op.Path)
+		}
+		return nil, nil
+
+	default:
+		return nil, fmt.Errorf("%w: invalid json patch operation '%s'", spec.ErrInvalidSyntax, op.Op)
+	}
+}
+
+// target is the result of resolving a JSON Pointer against a resource.
+type target struct {
+	path      string        // SCIM path to the target
+	property  prop.Property // target property, nil if pointer ends with "-"
+	multi     prop.Property // containing multiValued property, if target is an element
+	multiPath string        // SCIM path to the containing multiValued property, if target is an element
+	index     int           // index of the element in the containing multiValued property, -1 if pointer ends with "-"
+}
+
+func (t *target) isElement() bool {
+	return t.multi != nil
+}
+
+func (t *target) isSimpleElement() bool {
+	return t.multi != nil && t.multi.Attribute().Type() != spec.TypeComplex
+}
+
+func (t *target) mustExist(pointer string) error {
+	if t.property == nil || t.property.IsUnassigned() {
+		return fmt.Errorf("%w: no value at '%s'", spec.ErrNoTarget, pointer)
+	}
+	return nil
+}
+
+// Replace the containing multiValued property with its current elements, where the targeted element is replaced
+// by the value, or removed when value is nil.
+func (t *target) replaceSimpleElements(value json.RawMessage) ([]service.PatchOperation, error) {
+	elements := make([]interface{}, 0, t.multi.CountChildren())
+	_ = t.multi.ForEachChild(func(index int, child prop.Property) error {
+		switch {
+		case index != t.index:
+			elements = append(elements, child.Raw())
+		case value != nil:
+			elements = append(elements, value)
+		}
+		return nil
+	})
+
+	if len(elements) == 0 {
+		return []service.PatchOperation{{Op: opRemove, Path: t.multiPath}}, nil
+	}
+
+	raw, err := json.Marshal(elements)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to encode value for '%s'", spec.ErrInternal, t.multiPath)
+	}
+	return []service.PatchOperation{{Op: opReplace, Path: t.multiPath, Value: raw}}, nil
+}
+
+// Resolve the JSON Pointer against the resource. The resulting SCIM path uses a value selector for multiValued complex
+// elements. Member names are matched against attribute names, and schema extensions are addressed by their URN.
+func resolvePointer(resource *prop.Resource, pointer string) (*target, error) {
+	tokens, err := parsePointer(pointer)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		t   = &target{property: resource.RootProperty(), index: -1}
+		cur = resource.RootProperty()
+		sb  strings.Builder
+	)
+	for i, token := range tokens {
+		attr := cur.Attribute()
+
+		if attr.MultiValued() {
+			if i == len(tokens)-1 {
+				t.multi, t.multiPath = cur, sb.String()
+			}
+			if token == "-" {
+				if i != len(tokens)-1 {
+					return nil, fmt.Errorf("%w: '-' must be the last segment of '%s'", spec.ErrInvalidPath, pointer)
+				}
+				t.property, t.path, t.index = nil, sb.String(), -1
+				return t, nil
+			}
+
+			index, err := strconv.Atoi(token)
+			if err != nil || index < 0 {
+				return nil, fmt.Errorf("%w: invalid array index '%s' in '%s'", spec.ErrInvalidPath, token, pointer)
+			}
+			elem, err := cur.ChildAtIndex(index)
+			if err != nil {
+				return nil, fmt.Errorf("%w: no element at '%s'", spec.ErrNoTarget, pointer)
+			}
+			t.index = index
+
+			if attr.Type() != spec.TypeComplex {
+				if i != len(tokens)-1 {
+					return nil, fmt.Errorf("%w: cannot descend into simple element in '%s'", spec.ErrInvalidPath, pointer)
+				}
+				t.property, t.path = elem, sb.String()
+				return t, nil
+			}
+
+			selector, err := elementSelector(elem)
+			if err != nil {
+				return nil, err
+			}
+			sb.WriteString("[" + selector + "]")
+			cur = elem
+			continue
+		}
+
+		if attr.Type() != spec.TypeComplex {
+			return nil, fmt.Errorf("%w: cannot descend into '%s' in '%s'", spec.ErrInvalidPath, attr.Path(), pointer)
+		}
+
+		child, err := cur.ChildAtIndex(token)
+		if err != nil {
+			return nil, fmt.Errorf("%w: no attribute named '%s' in '%s'", spec.ErrInvalidPath, token, pointer)
+		}
+		if sb.Len() > 0 {
+			if _, ok := attr.Annotation(annotation.SchemaExtensionRoot); ok {
+				sb.WriteString(":")
+			} else {
+				sb.WriteString(".")
+			}
+		}
+		sb.WriteString(child.Attribute().Name())
+		cur = child
+	}
+
+	t.property, t.path = cur, sb.String()
+	return t, nil
+}
+
+// Returns a filter that selects the element by the values of its identity sub properties. If no sub attribute is
+// annotated with @Identity, all assigned singular sub properties are used.
+func elementSelector(elem prop.Property) (string, error) {
+	var (
+		identities = map[string]struct{}{}
+		conditions []string
+	)
+	_ = elem.Attribute().ForEachSubAttribute(func(subAttribute *spec.Attribute) error {
+		if _, ok := subAttribute.Annotation(annotation.Identity); ok {
+			identities[subAttribute.Name()] = struct{}{}
+		}
+		return nil
+	})
+
+	_ = elem.ForEachChild(func(_ int, child prop.Property) error {
+		attr := child.Attribute()
+		if attr.MultiValued() || attr.Type() == spec.TypeComplex || child.IsUnassigned() {
+			return nil
+		}
+		if _, ok := identities[attr.Name()]; len(identities) > 0 && !ok {
+			return nil
+		}
+		conditions = append(conditions, fmt.Sprintf("%s eq %s", attr.Name(), filterLiteral(child)))
+		return nil
+	})
+
+	if len(conditions) == 0 {
+		return "", fmt.Errorf("%w: cannot select unassigned element of '%s'", spec.ErrNoTarget, elem.Attribute().Path())
+	}
+	return strings.Join(conditions, " and "), nil
+}
+
+// Render the value of the property as a filter literal. JSON encoding yields quoted and escaped strings, and bare
+// numbers and booleans, which are exactly the literal forms accepted by the filter compiler.
+func filterLiteral(property prop.Property) string {
+	raw, _ := json.Marshal(property.Raw())
+	return string(raw)
+}
+
+// Parse the JSON Pointer into reference tokens, with ~1 and ~0 unescaped.
+func parsePointer(pointer string) ([]string, error) {
+	if len(pointer) == 0 {
+		return []string{}, nil
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("%w: json pointer '%s' must start with '/'", spec.ErrInvalidPath, pointer)
+	}
+
+	tokens := strings.Split(pointer[1:], "/")
+	for i, token := range tokens {
+		tokens[i] = strings.Replace(strings.Replace(token, "~1", "/", -1), "~0", "~", -1)
+	}
+	return tokens, nil
+}
+
+// Format the reference tokens into a JSON Pointer, with ~ and / escaped.
+func formatPointer(tokens []string) string {
+	var sb strings.Builder
+	for _, token := range tokens {
+		sb.WriteString("/")
+		sb.WriteString(strings.Replace(strings.Replace(token, "~", "~0", -1), "/", "~1", -1))
+	}
+	return sb.String()
+}
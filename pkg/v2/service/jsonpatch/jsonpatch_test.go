@@ -0,0 +1,424 @@
+package jsonpatch
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/imulab/go-scim/pkg/v2/crud"
+	"github.com/imulab/go-scim/pkg/v2/prop"
+	"github.com/imulab/go-scim/pkg/v2/service"
+	"github.com/imulab/go-scim/pkg/v2/spec"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestJsonPatch(t *testing.T) {
+	s := new(JsonPatchTestSuite)
+	suite.Run(t, s)
+}
+
+type JsonPatchTestSuite struct {
+	suite.Suite
+	resourceType *spec.ResourceType
+}
+
+func (s *JsonPatchTestSuite) TestToPatchPayload() {
+	tests := []struct {
+		name       string
+		operations string
+		expect     func(t *testing.T, payload *service.PatchPayload, err error)
+		verify     func(t *testing.T, r *prop.Resource)
+	}{
+		{
+			name: "replace singular attribute",
+			operations: `[
+				{"op": "replace", "path": "/name/familyName", "value": "Q"}
+			]`,
+			expect: func(t *testing.T, payload *service.PatchPayload, err error) {
+				assert.Nil(t, err)
+				assert.Len(t, payload.Operations, 1)
+				assert.Equal(t, "replace", payload.Operations[0].Op)
+				assert.Equal(t, "name.familyName", payload.Operations[0].Path)
+			},
+			verify: func(t *testing.T, r *prop.Resource) {
+				assert.Equal(t, "Q", r.Navigator().Dot("name").Dot("familyName").Current().Raw())
+			},
+		},
+		{
+			name: "replace sub attribute of element by index",
+			operations: `[
+				{"op": "replace", "path": "/emails/1/value", "value": "imulab@baz.com"}
+			]`,
+			expect: func(t *testing.T, payload *service.PatchPayload, err error) {
+				assert.Nil(t, err)
+				assert.Len(t, payload.Operations, 1)
+				assert.Equal(t, `emails[value eq "imulab@bar.com" and type eq "home"].value`, payload.Operations[0].Path)
+			},
+			verify: func(t *testing.T, r *prop.Resource) {
+				assert.Equal(t, "imulab@foo.com", r.Navigator().Dot("emails").At(0).Dot("value").Current().Raw())
+				assert.Equal(t, "imulab@baz.com", r.Navigator().Dot("emails").At(1).Dot("value").Current().Raw())
+			},
+		},
+		{
+			name: "append element",
+			operations: `[
+				{"op": "add", "path": "/emails/-", "value": {"value": "imulab@baz.com", "type": "other"}}
+			]`,
+			expect: func(t *testing.T, payload *service.PatchPayload, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, "add", payload.Operations[0].Op)
+				assert.Equal(t, "emails", payload.Operations[0].Path)
+			},
+			verify: func(t *testing.T, r *prop.Resource) {
+				assert.Equal(t, 3, r.Navigator().Dot("emails").Current().CountChildren())
+			},
+		},
+		{
+			name: "remove element then refer to shifted index",
+			operations: `[
+				{"op": "remove", "path": "/emails/0"},
+				{"op": "replace", "path": "/emails/0/type", "value": "work"}
+			]`,
+			expect: func(t *testing.T, payload *service.PatchPayload, err error) {
+				assert.Nil(t, err)
+				assert.Len(t, payload.Operations, 2)
+				assert.Equal(t, `emails[value eq "imulab@foo.com" and type eq "work"]`, payload.Operations[0].Path)
+				assert.Equal(t, `emails[value eq "imulab@bar.com" and type eq "home"].type`, payload.Operations[1].Path)
+			},
+			verify: func(t *testing.T, r *prop.Resource) {
+				assert.Equal(t, 1, r.Navigator().Dot("emails").Current().CountChildren())
+				assert.Equal(t, "work", r.Navigator().Dot("emails").At(0).Dot("type").Current().Raw())
+			},
+		},
+		{
+			name: "remove simple element",
+			operations: `[
+				{"op": "remove", "path": "/schemas/1"}
+			]`,
+			expect: func(t *testing.T, payload *service.PatchPayload, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, "replace", payload.Operations[0].Op)
+				assert.Equal(t, "schemas", payload.Operations[0].Path)
+				assert.JSONEq(t, `["urn:ietf:params:scim:schemas:core:2.0:User"]`, string(payload.Operations[0].Value))
+			},
+		},
+		{
+			name: "extension attribute",
+			operations: `[
+				{"op": "add", "path": "/urn:ietf:params:scim:schemas:extension:enterprise:2.0:User/employeeNumber", "value": "123"}
+			]`,
+			expect: func(t *testing.T, payload *service.PatchPayload, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, "urn:ietf:params:scim:schemas:extension:enterprise:2.0:User:employeeNumber", payload.Operations[0].Path)
+			},
+			verify: func(t *testing.T, r *prop.Resource) {
+				assert.Equal(t, "123", r.Navigator().
+					Dot("urn:ietf:params:scim:schemas:extension:enterprise:2.0:User").
+					Dot("employeeNumber").Current().Raw())
+			},
+		},
+		{
+			name: "move",
+			operations: `[
+				{"op": "move", "from": "/name/givenName", "path": "/nickName"}
+			]`,
+			expect: func(t *testing.T, payload *service.PatchPayload, err error) {
+				assert.Nil(t, err)
+				assert.Len(t, payload.Operations, 2)
+			},
+			verify: func(t *testing.T, r *prop.Resource) {
+				assert.Equal(t, "Weinan", r.Navigator().Dot("nickName").Current().Raw())
+				assert.True(t, r.Navigator().Dot("name").Dot("givenName").Current().IsUnassigned())
+			},
+		},
+		{
+			name: "successful test",
+			operations: `[
+				{"op": "test", "path": "/userName", "value": "imulab"}
+			]`,
+			expect: func(t *testing.T, payload *service.PatchPayload, err error) {
+				assert.Nil(t, err)
+				assert.Len(t, payload.Operations, 0)
+			},
+		},
+		{
+			name: "failed test",
+			operations: `[
+				{"op": "test", "path": "/userName", "value": "foo"}
+			]`,
+			expect: func(t *testing.T, payload *service.PatchPayload, err error) {
+				assert.Equal(t, spec.ErrConflict, errors.Unwrap(err))
+			},
+		},
+		{
+			name: "index out of range",
+			operations: `[
+				{"op": "remove", "path": "/emails/5"}
+			]`,
+			expect: func(t *testing.T, payload *service.PatchPayload, err error) {
+				assert.Equal(t, spec.ErrNoTarget, errors.Unwrap(err))
+			},
+		},
+		{
+			name: "unknown attribute",
+			operations: `[
+				{"op": "replace", "path": "/foo", "value": "bar"}
+			]`,
+			expect: func(t *testing.T, payload *service.PatchPayload, err error) {
+				assert.Equal(t, spec.ErrInvalidPath, errors.Unwrap(err))
+			},
+		},
+	}
+
+	for _, test := range tests {
+		s.T().Run(test.name, func(t *testing.T) {
+			var operations []Operation
+			require.Nil(t, json.Unmarshal([]byte(test.operations), &operations))
+
+			r := s.resource(t)
+			payload, err := ToPatchPayload(r, operations)
+			test.expect(t, payload, err)
+			if err != nil {
+				return
+			}
+
+			// the original resource is not modified
+			assert.Equal(t, s.resource(t).Hash(), r.Hash())
+
+			assert.Nil(t, payload.Validate())
+			for _, op := range payload.Operations {
+				assert.Nil(t, op.Apply(r))
+			}
+			if test.verify != nil {
+				test.verify(t, r)
+			}
+		})
+	}
+}
+
+func (s *JsonPatchTestSuite) TestFromPatchPayload() {
+	tests := []struct {
+		name    string
+		payload string
+		expect  func(t *testing.T, operations []Operation, err error)
+	}{
+		{
+			name: "filtered sub attribute",
+			payload: `{
+				"schemas": ["urn:ietf:params:scim:api:messages:2.0:PatchOp"],
+				"Operations": [
+					{"op": "replace", "path": "emails[type eq \"home\"].value", "value": "imulab@baz.com"}
+				]
+			}`,
+			expect: func(t *testing.T, operations []Operation, err error) {
+				assert.Nil(t, err)
+				assert.Len(t, operations, 1)
+				assert.Equal(t, "replace", operations[0].Op)
+				assert.Equal(t, "/emails/1/value", operations[0].Path)
+				assert.JSONEq(t, `"imulab@baz.com"`, string(operations[0].Value))
+			},
+		},
+		{
+			name: "add to multiValued",
+			payload: `{
+				"schemas": ["urn:ietf:params:scim:api:messages:2.0:PatchOp"],
+				"Operations": [
+					{"op": "add", "path": "emails", "value": [{"value": "a@foo.com"}, {"value": "b@foo.com"}]}
+				]
+			}`,
+			expect: func(t *testing.T, operations []Operation, err error) {
+				assert.Nil(t, err)
+				assert.Len(t, operations, 2)
+				for _, op := range operations {
+					assert.Equal(t, "add", op.Op)
+					assert.Equal(t, "/emails/-", op.Path)
+				}
+			},
+		},
+		{
+			name: "add merges complex",
+			payload: `{
+				"schemas": ["urn:ietf:params:scim:api:messages:2.0:PatchOp"],
+				"Operations": [
+					{"op": "add", "value": {"name": {"middleName": "W"}, "nickName": "I"}}
+				]
+			}`,
+			expect: func(t *testing.T, operations []Operation, err error) {
+				assert.Nil(t, err)
+				assert.Len(t, operations, 2)
+				paths := []string{operations[0].Path, operations[1].Path}
+				assert.Contains(t, paths, "/name/middleName")
+				assert.Contains(t, paths, "/nickName")
+			},
+		},
+		{
+			name: "replace unassigned becomes add",
+			payload: `{
+				"schemas": ["urn:ietf:params:scim:api:messages:2.0:PatchOp"],
+				"Operations": [
+					{"op": "replace", "path": "nickName", "value": "I"}
+				]
+			}`,
+			expect: func(t *testing.T, operations []Operation, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, []Operation{{Op: "add", Path: "/nickName", Value: json.RawMessage(`"I"`)}}, operations)
+			},
+		},
+		{
+			name: "remove multiple elements in reverse order",
+			payload: `{
+				"schemas": ["urn:ietf:params:scim:api:messages:2.0:PatchOp"],
+				"Operations": [
+					{"op": "remove", "path": "emails[value ew \"com\"]"},
+					{"op": "remove", "path": "nickName"}
+				]
+			}`,
+			expect: func(t *testing.T, operations []Operation, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, []Operation{
+					{Op: "remove", Path: "/emails/1"},
+					{Op: "remove", Path: "/emails/0"},
+				}, operations)
+			},
+		},
+		{
+			name: "extension path",
+			payload: `{
+				"schemas": ["urn:ietf:params:scim:api:messages:2.0:PatchOp"],
+				"Operations": [
+					{"op": "add", "path": "urn:ietf:params:scim:schemas:extension:enterprise:2.0:User:employeeNumber", "value": "123"}
+				]
+			}`,
+			expect: func(t *testing.T, operations []Operation, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, "/urn:ietf:params:scim:schemas:extension:enterprise:2.0:User/employeeNumber", operations[0].Path)
+			},
+		},
+		{
+			name: "invalid path",
+			payload: `{
+				"schemas": ["urn:ietf:params:scim:api:messages:2.0:PatchOp"],
+				"Operations": [
+					{"op": "remove", "path": "foo"}
+				]
+			}`,
+			expect: func(t *testing.T, operations []Operation, err error) {
+				assert.Equal(t, spec.ErrInvalidPath, errors.Unwrap(err))
+			},
+		},
+	}
+
+	for _, test := range tests {
+		s.T().Run(test.name, func(t *testing.T) {
+			payload := new(service.PatchPayload)
+			require.Nil(t, json.Unmarshal([]byte(test.payload), payload))
+
+			operations, err := FromPatchPayload(s.resource(t), payload)
+			test.expect(t, operations, err)
+		})
+	}
+}
+
+func (s *JsonPatchTestSuite) TestRoundTrip() {
+	r := s.resource(s.T())
+	operations := []Operation{
+		{Op: "replace", Path: "/emails/1/type", Value: json.RawMessage(`"other"`)},
+		{Op: "add", Path: "/emails/-", Value: json.RawMessage(`{"value": "imulab@baz.com"}`)},
+		{Op: "remove", Path: "/name/givenName"},
+	}
+
+	payload, err := ToPatchPayload(r, operations)
+	require.Nil(s.T(), err)
+
+	converted, err := FromPatchPayload(r, payload)
+	require.Nil(s.T(), err)
+	assert.Equal(s.T(), []Operation{
+		{Op: "replace", Path: "/emails/1/type", Value: json.RawMessage(`"other"`)},
+		{Op: "add", Path: "/emails/-", Value: json.RawMessage(`{"value":"imulab@baz.com"}`)},
+		{Op: "remove", Path: "/name/givenName"},
+	}, converted)
+}
+
+func (s *JsonPatchTestSuite) resource(t *testing.T) *prop.Resource {
+	r := prop.NewResource(s.resourceType)
+	require.False(t, r.Navigator().Replace(map[string]interface{}{
+		"schemas": []interface{}{
+			"urn:ietf:params:scim:schemas:core:2.0:User",
+			"urn:ietf:params:scim:schemas:extension:enterprise:2.0:User",
+		},
+		"id":       "3cc032f5-2361-417f-9e2f-bc80adddf4a3",
+		"userName": "imulab",
+		"name": map[string]interface{}{
+			"familyName": "Qiu",
+			"givenName":  "Weinan",
+		},
+		"emails": []interface{}{
+			map[string]interface{}{
+				"value": "imulab@foo.com",
+				"type":  "work",
+			},
+			map[string]interface{}{
+				"value": "imulab@bar.com",
+				"type":  "home",
+			},
+		},
+		"urn:ietf:params:scim:schemas:extension:enterprise:2.0:User": map[string]interface{}{
+			"department": "Engineering",
+		},
+	}).HasError())
+	return r
+}
+
+func (s *JsonPatchTestSuite) SetupSuite() {
+	for _, each := range []struct {
+		filepath  string
+		structure interface{}
+		post      func(parsed interface{})
+	}{
+		{
+			filepath:  "../../../../public/schemas/core_schema.json",
+			structure: new(spec.Schema),
+			post: func(parsed interface{}) {
+				spec.Schemas().Register(parsed.(*spec.Schema))
+			},
+		},
+		{
+			filepath:  "../../../../public/schemas/user_schema.json",
+			structure: new(spec.Schema),
+			post: func(parsed interface{}) {
+				spec.Schemas().Register(parsed.(*spec.Schema))
+			},
+		},
+		{
+			filepath:  "../../../../public/schemas/user_enterprise_extension_schema.json",
+			structure: new(spec.Schema),
+			post: func(parsed interface{}) {
+				spec.Schemas().Register(parsed.(*spec.Schema))
+			},
+		},
+		{
+			filepath:  "../../../../public/resource_types/user_resource_type.json",
+			structure: new(spec.ResourceType),
+			post: func(parsed interface{}) {
+				s.resourceType = parsed.(*spec.ResourceType)
+				crud.Register(s.resourceType)
+			},
+		},
+	} {
+		f, err := os.Open(each.filepath)
+		require.Nil(s.T(), err)
+
+		raw, err := ioutil.ReadAll(f)
+		require.Nil(s.T(), err)
+
+		err = json.Unmarshal(raw, each.structure)
+		require.Nil(s.T(), err)
+
+		if each.post != nil {
+			each.post(each.structure)
+		}
+	}
+}
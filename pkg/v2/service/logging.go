@@ -0,0 +1,138 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/imulab/go-scim/pkg/v2/prop"
+	"github.com/imulab/go-scim/pkg/v2/spec"
+	"time"
+)
+
+// Stages of the calls to the resource services, as reported by LogEntry.
+const (
+	StageRequest  = "request"
+	StageResponse = "response"
+)
+
+type (
+	// Logger receives the log entries of the calls to the services wrapped by LoggingInterceptor, i.e. to write them
+	// with a structured logger.
+	Logger interface {
+		Log(ctx context.Context, entry *LogEntry)
+	}
+	// LoggerFunc is the function adapter of Logger.
+	LoggerFunc func(ctx context.Context, entry *LogEntry)
+	// LogEntry describes a stage of a call to a resource service. The payload has its sensitive attributes redacted
+	// (see Redactor), and can be logged safely.
+	LogEntry struct {
+		Stage        string          // StageRequest or StageResponse
+		Operation    string          // operation of the service, i.e. OpCreate
+		ResourceType string          // id of the resource type of the service
+		ResourceID   string          // id of the resource, if known
+		Payload      json.RawMessage // redacted payload of the request, or resource of the response, if any
+		Err          error           // error of the call, for StageResponse
+		Duration     time.Duration   // time spent in the call, for StageResponse
+	}
+)
+
+func (f LoggerFunc) Log(ctx context.Context, entry *LogEntry) {
+	f(ctx, entry)
+}
+
+// LoggingInterceptor returns an Interceptor that logs every call to the services it wraps (see Interceptors) with the
+// logger, once with the payload of the request before the call, and once with the resulting resource, or the error,
+// after the call. Payloads are redacted with the redactor of their resource type, or with a Redactor of no extra
+// paths for resource types without one, so that values of returned=never and writeOnly attributes are never logged.
+// Calls to query the resources are logged without payload.
+func LoggingInterceptor(logger Logger, redactors ...*Redactor) Interceptor {
+	i := &loggingInterceptor{logger: logger, redactors: map[string]*Redactor{}}
+	for _, each := range redactors {
+		i.redactors[each.resourceType.ID()] = each
+	}
+	return i
+}
+
+type loggingInterceptor struct {
+	logger    Logger
+	redactors map[string]*Redactor
+}
+
+type logStartKey struct{}
+
+func (i *loggingInterceptor) Before(ctx context.Context, inv *Invocation) (context.Context, error) {
+	entry := i.entry(StageRequest, inv)
+	switch req := inv.Request.(type) {
+	case *GetRequest:
+		entry.ResourceID = req.ResourceID
+	case *ReplaceRequest:
+		entry.ResourceID = req.ResourceID
+	case *PatchRequest:
+		entry.ResourceID = req.ResourceID
+	case *MembershipRequest:
+		entry.ResourceID = req.ResourceID
+	case *DeleteRequest:
+		entry.ResourceID = req.ResourceID
+	}
+
+	if raw, err := inv.Payload(); err != nil {
+		return ctx, err
+	} else if raw != nil && inv.ResourceType != nil {
+		redactor := i.redactor(inv.ResourceType)
+		if inv.Operation == OpPatch {
+			entry.Payload = redactor.Patch(raw)
+		} else {
+			entry.Payload = redactor.Resource(raw)
+		}
+	}
+
+	i.logger.Log(ctx, entry)
+	return context.WithValue(ctx, logStartKey{}, time.Now()), nil
+}
+
+func (i *loggingInterceptor) After(ctx context.Context, inv *Invocation, err error) error {
+	entry := i.entry(StageResponse, inv)
+	entry.Err = err
+	if start, ok := ctx.Value(logStartKey{}).(time.Time); ok {
+		entry.Duration = time.Since(start)
+	}
+
+	var resource *prop.Resource
+	switch resp := inv.Response.(type) {
+	case *CreateResponse:
+		resource = resp.Resource
+	case *GetResponse:
+		resource = resp.Resource
+	case *ReplaceResponse:
+		resource = resp.Resource
+	case *PatchResponse:
+		resource = resp.Resource
+	case *DeleteResponse:
+		if resp.Deleted != nil {
+			entry.ResourceID = resp.Deleted.IdOrEmpty()
+		}
+	}
+	if resource != nil && inv.ResourceType != nil {
+		entry.ResourceID = resource.IdOrEmpty()
+		entry.Payload = i.redactor(inv.ResourceType).Serialize(resource)
+	}
+
+	i.logger.Log(ctx, entry)
+	return err
+}
+
+func (i *loggingInterceptor) entry(stage string, inv *Invocation) *LogEntry {
+	entry := &LogEntry{Stage: stage, Operation: inv.Operation}
+	if inv.ResourceType != nil {
+		entry.ResourceType = inv.ResourceType.ID()
+	}
+	return entry
+}
+
+// Returns the redactor of the resource type, creating one of no extra paths if there is none.
+func (i *loggingInterceptor) redactor(resourceType *spec.ResourceType) *Redactor {
+	if r, ok := i.redactors[resourceType.ID()]; ok {
+		return r
+	}
+	r, _ := NewRedactor(resourceType)
+	return r
+}
@@ -0,0 +1,196 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/imulab/go-scim/pkg/v2/crud"
+	"github.com/imulab/go-scim/pkg/v2/db"
+	"github.com/imulab/go-scim/pkg/v2/service/filter"
+	"github.com/imulab/go-scim/pkg/v2/spec"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestLoggingInterceptor(t *testing.T) {
+	s := new(LoggingInterceptorTestSuite)
+	suite.Run(t, s)
+}
+
+type LoggingInterceptorTestSuite struct {
+	suite.Suite
+	resourceType *spec.ResourceType
+}
+
+func (s *LoggingInterceptorTestSuite) TestRedactResource() {
+	redactor, err := NewRedactor(s.resourceType, "emails.value", "urn:ietf:params:scim:schemas:extension:enterprise:2.0:User:employeeNumber")
+	require.Nil(s.T(), err)
+
+	tests := []struct {
+		name    string
+		payload string
+		expect  string
+	}{
+		{
+			name:    "password and configured paths are redacted",
+			payload: `{"userName":"foo","password":"s3cret","emails":[{"value":"foo@example.com","type":"work"}],"urn:ietf:params:scim:schemas:extension:enterprise:2.0:User":{"employeeNumber":"42","costCenter":"x"}}`,
+			expect:  `{"userName":"foo","password":"[REDACTED]","emails":[{"value":"[REDACTED]","type":"work"}],"urn:ietf:params:scim:schemas:extension:enterprise:2.0:User":{"employeeNumber":"[REDACTED]","costCenter":"x"}}`,
+		},
+		{
+			name:    "attribute names are case insensitive",
+			payload: `{"PASSWORD":"s3cret","Emails":[{"Value":"foo@example.com"}]}`,
+			expect:  `{"PASSWORD":"[REDACTED]","Emails":[{"Value":"[REDACTED]"}]}`,
+		},
+		{
+			name:    "unknown attributes are retained",
+			payload: `{"foo":{"password":"bar"},"active":true}`,
+			expect:  `{"foo":{"password":"bar"},"active":true}`,
+		},
+		{
+			name:    "invalid json is redacted as a whole",
+			payload: `{"password":`,
+			expect:  `"[REDACTED]"`,
+		},
+	}
+
+	for _, test := range tests {
+		s.T().Run(test.name, func(t *testing.T) {
+			assert.JSONEq(t, test.expect, string(redactor.Resource([]byte(test.payload))))
+		})
+	}
+}
+
+func (s *LoggingInterceptorTestSuite) TestRedactPatch() {
+	redactor, err := NewRedactor(s.resourceType, "emails")
+	require.Nil(s.T(), err)
+
+	raw := redactor.Patch([]byte(`{
+		"schemas": ["urn:ietf:params:scim:api:messages:2.0:PatchOp"],
+		"Operations": [
+			{"op": "replace", "path": "password", "value": "s3cret"},
+			{"op": "add", "path": "emails[type eq \"work\"]", "value": {"value": "foo@example.com"}},
+			{"op": "replace", "value": {"password": "s3cret", "displayName": "Foo"}},
+			{"op": "replace", "path": "userName", "value": "foo"},
+			{"op": "replace", "path": "unknown", "value": "bar"},
+			{"op": "remove", "path": "nickName"}
+		]
+	}`))
+	assert.JSONEq(s.T(), `{
+		"schemas": ["urn:ietf:params:scim:api:messages:2.0:PatchOp"],
+		"Operations": [
+			{"op": "replace", "path": "password", "value": "[REDACTED]"},
+			{"op": "add", "path": "emails[type eq \"work\"]", "value": "[REDACTED]"},
+			{"op": "replace", "value": {"password": "[REDACTED]", "displayName": "Foo"}},
+			{"op": "replace", "path": "userName", "value": "foo"},
+			{"op": "replace", "path": "unknown", "value": "[REDACTED]"},
+			{"op": "remove", "path": "nickName"}
+		]
+	}`, string(raw))
+}
+
+func (s *LoggingInterceptorTestSuite) TestInvalidPath() {
+	_, err := NewRedactor(s.resourceType, "foo.bar")
+	assert.True(s.T(), errors.Is(err, spec.ErrInvalidPath))
+}
+
+func (s *LoggingInterceptorTestSuite) TestInterceptor() {
+	var (
+		entries  []*LogEntry
+		database = db.Memory()
+		chain    = Interceptors(LoggingInterceptor(LoggerFunc(func(_ context.Context, entry *LogEntry) {
+			entries = append(entries, entry)
+		})))
+		create = chain.Create(s.resourceType, CreateService(s.resourceType, database, []filter.ByResource{
+			filter.ByPropertyToByResource(filter.UUIDFilter()),
+			filter.MetaFilter(),
+		}))
+	)
+
+	resp, err := create.Do(context.Background(), &CreateRequest{
+		PayloadSource: strings.NewReader(`{"schemas":["urn:ietf:params:scim:schemas:core:2.0:User"],"userName":"foo","password":"s3cret"}`),
+	})
+	require.Nil(s.T(), err)
+
+	// the password is still persisted
+	stored, err := database.Get(context.Background(), resp.Resource.IdOrEmpty(), nil)
+	require.Nil(s.T(), err)
+	assert.Equal(s.T(), "s3cret", stored.Navigator().Dot("password").Current().Raw())
+
+	require.Len(s.T(), entries, 2)
+	assert.Equal(s.T(), StageRequest, entries[0].Stage)
+	assert.Equal(s.T(), OpCreate, entries[0].Operation)
+	assert.Equal(s.T(), "User", entries[0].ResourceType)
+	assert.Contains(s.T(), string(entries[0].Payload), `"password":"[REDACTED]"`)
+	assert.NotContains(s.T(), string(entries[0].Payload), "s3cret")
+
+	assert.Equal(s.T(), StageResponse, entries[1].Stage)
+	assert.Equal(s.T(), resp.Resource.IdOrEmpty(), entries[1].ResourceID)
+	assert.Nil(s.T(), entries[1].Err)
+	assert.Contains(s.T(), string(entries[1].Payload), `"userName":"foo"`)
+	assert.NotContains(s.T(), string(entries[1].Payload), "s3cret")
+
+	entries = nil
+	_, err = chain.Get(s.resourceType, GetService(database)).Do(context.Background(), &GetRequest{ResourceID: "missing"})
+	assert.NotNil(s.T(), err)
+	require.Len(s.T(), entries, 2)
+	assert.Equal(s.T(), "missing", entries[0].ResourceID)
+	assert.Nil(s.T(), entries[0].Payload)
+	assert.True(s.T(), errors.Is(entries[1].Err, spec.ErrNotFound))
+	assert.Nil(s.T(), entries[1].Payload)
+}
+
+func (s *LoggingInterceptorTestSuite) SetupSuite() {
+	for _, each := range []struct {
+		filepath  string
+		structure interface{}
+		post      func(parsed interface{})
+	}{
+		{
+			filepath:  "../../../public/schemas/core_schema.json",
+			structure: new(spec.Schema),
+			post: func(parsed interface{}) {
+				spec.Schemas().Register(parsed.(*spec.Schema))
+			},
+		},
+		{
+			filepath:  "../../../public/schemas/user_schema.json",
+			structure: new(spec.Schema),
+			post: func(parsed interface{}) {
+				spec.Schemas().Register(parsed.(*spec.Schema))
+			},
+		},
+		{
+			filepath:  "../../../public/schemas/user_enterprise_extension_schema.json",
+			structure: new(spec.Schema),
+			post: func(parsed interface{}) {
+				spec.Schemas().Register(parsed.(*spec.Schema))
+			},
+		},
+		{
+			filepath:  "../../../public/resource_types/user_resource_type.json",
+			structure: new(spec.ResourceType),
+			post: func(parsed interface{}) {
+				s.resourceType = parsed.(*spec.ResourceType)
+				crud.Register(s.resourceType)
+			},
+		},
+	} {
+		f, err := os.Open(each.filepath)
+		require.Nil(s.T(), err)
+
+		raw, err := ioutil.ReadAll(f)
+		require.Nil(s.T(), err)
+
+		err = json.Unmarshal(raw, each.structure)
+		require.Nil(s.T(), err)
+
+		if each.post != nil {
+			each.post(each.structure)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"github.com/imulab/go-scim/pkg/v2/spec"
+)
+
+// MeService returns a service for the /Me endpoint (RFC7644 section 3.11), which is an alias of the User resource of
+// the authenticated subject. The subject is resolved from the request context by the resolver, and the request is
+// carried out by the get, replace and patch services of the User resource type, as if it was made to the resource
+// directly. Any of get, replace and patch may be nil, in which case the corresponding operation is not supported.
+func MeService(resolver SubjectResolver, get Get, replace Replace, patch Patch) Me {
+	return &meService{
+		resolver: resolver,
+		get:      get,
+		replace:  replace,
+		patch:    patch,
+	}
+}
+
+type (
+	// Me resource service. The ResourceID of the requests is ignored, and replaced by the id of the authenticated subject.
+	Me interface {
+		Get(ctx context.Context, req *GetRequest) (resp *GetResponse, err error)
+		Replace(ctx context.Context, req *ReplaceRequest) (resp *ReplaceResponse, err error)
+		Patch(ctx context.Context, req *PatchRequest) (resp *PatchResponse, err error)
+	}
+	// SubjectResolver maps the authenticated principal, usually placed in the request context by the authentication
+	// middleware, to the id of its User resource. Errors are returned to the caller as is, so implementations should
+	// wrap spec.ErrNotFound when the principal has no User resource.
+	SubjectResolver interface {
+		Resolve(ctx context.Context) (resourceID string, err error)
+	}
+	// SubjectResolverFunc is an adapter to allow the use of ordinary functions as SubjectResolver.
+	SubjectResolverFunc func(ctx context.Context) (resourceID string, err error)
+)
+
+func (f SubjectResolverFunc) Resolve(ctx context.Context) (string, error) {
+	return f(ctx)
+}
+
+type meService struct {
+	resolver SubjectResolver
+	get      Get
+	replace  Replace
+	patch    Patch
+}
+
+func (s *meService) Get(ctx context.Context, req *GetRequest) (resp *GetResponse, err error) {
+	if s.get == nil {
+		err = fmt.Errorf("%w: get is not supported on /Me", spec.ErrInvalidSyntax)
+		return
+	}
+
+	id, err := s.subject(ctx)
+	if err != nil {
+		return
+	}
+
+	return s.get.Do(ctx, &GetRequest{
+		ResourceID: id,
+		Projection: req.Projection,
+	})
+}
+
+func (s *meService) Replace(ctx context.Context, req *ReplaceRequest) (resp *ReplaceResponse, err error) {
+	if s.replace == nil {
+		err = fmt.Errorf("%w: replace is not supported on /Me", spec.ErrInvalidSyntax)
+		return
+	}
+
+	id, err := s.subject(ctx)
+	if err != nil {
+		return
+	}
+
+	return s.replace.Do(ctx, &ReplaceRequest{
+		ResourceID:    id,
+		PayloadSource: req.PayloadSource,
+		MatchCriteria: req.MatchCriteria,
+		Version:       req.Version,
+		DryRun:        req.DryRun,
+	})
+}
+
+func (s *meService) Patch(ctx context.Context, req *PatchRequest) (resp *PatchResponse, err error) {
+	if s.patch == nil {
+		err = fmt.Errorf("%w: patch is not supported on /Me", spec.ErrInvalidSyntax)
+		return
+	}
+
+	id, err := s.subject(ctx)
+	if err != nil {
+		return
+	}
+
+	return s.patch.Do(ctx, &PatchRequest{
+		ResourceID:    id,
+		MatchCriteria: req.MatchCriteria,
+		Version:       req.Version,
+		PayloadSource: req.PayloadSource,
+		DryRun:        req.DryRun,
+	})
+}
+
+// Returns the id of the authenticated subject, or an error of spec.ErrNotFound if there is no subject.
+func (s *meService) subject(ctx context.Context) (string, error) {
+	if s.resolver == nil {
+		return "", fmt.Errorf("%w: /Me is not supported without a subject resolver", spec.ErrInternal)
+	}
+
+	id, err := s.resolver.Resolve(ctx)
+	if err != nil {
+		return "", err
+	}
+	if len(id) == 0 {
+		return "", fmt.Errorf("%w: no resource for the authenticated subject", spec.ErrNotFound)
+	}
+	return id, nil
+}
@@ -0,0 +1,219 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/imulab/go-scim/pkg/v2/crud"
+	"github.com/imulab/go-scim/pkg/v2/db"
+	"github.com/imulab/go-scim/pkg/v2/prop"
+	"github.com/imulab/go-scim/pkg/v2/service/filter"
+	"github.com/imulab/go-scim/pkg/v2/spec"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestMeService(t *testing.T) {
+	s := new(MeServiceTestSuite)
+	suite.Run(t, s)
+}
+
+type MeServiceTestSuite struct {
+	suite.Suite
+	config       *spec.ServiceProviderConfig
+	resourceType *spec.ResourceType
+}
+
+type meTestSubjectKey struct{}
+
+func (s *MeServiceTestSuite) TestMe() {
+	tests := []struct {
+		name string
+		ctx  context.Context
+		do   func(t *testing.T, ctx context.Context, svc Me, database db.DB)
+	}{
+		{
+			name: "get",
+			ctx:  context.WithValue(context.TODO(), meTestSubjectKey{}, "bar"),
+			do: func(t *testing.T, ctx context.Context, svc Me, database db.DB) {
+				resp, err := svc.Get(ctx, &GetRequest{ResourceID: "foo"})
+				assert.Nil(t, err)
+				assert.Equal(t, "bar", resp.Resource.IdOrEmpty())
+			},
+		},
+		{
+			name: "replace",
+			ctx:  context.WithValue(context.TODO(), meTestSubjectKey{}, "bar"),
+			do: func(t *testing.T, ctx context.Context, svc Me, database db.DB) {
+				resp, err := svc.Replace(ctx, &ReplaceRequest{
+					PayloadSource: strings.NewReader(`
+{
+  "schemas": ["urn:ietf:params:scim:schemas:core:2.0:User"],
+  "id": "bar",
+  "userName": "bar",
+  "displayName": "Bar"
+}`),
+				})
+				assert.Nil(t, err)
+				assert.True(t, resp.Replaced)
+				assert.Equal(t, "bar", resp.Resource.IdOrEmpty())
+
+				r, err := database.Get(context.TODO(), "bar", nil)
+				require.Nil(t, err)
+				assert.Equal(t, "Bar", r.Navigator().Dot("displayName").Current().Raw())
+			},
+		},
+		{
+			name: "patch",
+			ctx:  context.WithValue(context.TODO(), meTestSubjectKey{}, "bar"),
+			do: func(t *testing.T, ctx context.Context, svc Me, database db.DB) {
+				resp, err := svc.Patch(ctx, &PatchRequest{
+					ResourceID: "foo",
+					PayloadSource: strings.NewReader(`
+{
+  "schemas": ["urn:ietf:params:scim:api:messages:2.0:PatchOp"],
+  "Operations": [
+    {
+      "op": "add",
+      "path": "displayName",
+      "value": "Bar"
+    }
+  ]
+}`),
+				})
+				assert.Nil(t, err)
+				assert.True(t, resp.Patched)
+
+				r, err := database.Get(context.TODO(), "bar", nil)
+				require.Nil(t, err)
+				assert.Equal(t, "Bar", r.Navigator().Dot("displayName").Current().Raw())
+				r, err = database.Get(context.TODO(), "foo", nil)
+				require.Nil(t, err)
+				assert.True(t, r.Navigator().Dot("displayName").Current().IsUnassigned())
+			},
+		},
+		{
+			name: "no subject",
+			ctx:  context.TODO(),
+			do: func(t *testing.T, ctx context.Context, svc Me, database db.DB) {
+				_, err := svc.Get(ctx, &GetRequest{})
+				assert.True(t, errors.Is(err, spec.ErrNotFound))
+			},
+		},
+		{
+			name: "subject without resource",
+			ctx:  context.WithValue(context.TODO(), meTestSubjectKey{}, "unknown"),
+			do: func(t *testing.T, ctx context.Context, svc Me, database db.DB) {
+				_, err := svc.Get(ctx, &GetRequest{})
+				assert.True(t, errors.Is(err, spec.ErrNotFound))
+			},
+		},
+	}
+
+	resolver := SubjectResolverFunc(func(ctx context.Context) (string, error) {
+		id, _ := ctx.Value(meTestSubjectKey{}).(string)
+		return id, nil
+	})
+
+	for _, test := range tests {
+		s.T().Run(test.name, func(t *testing.T) {
+			database := db.Memory()
+			for _, id := range []string{"foo", "bar"} {
+				r := prop.NewResource(s.resourceType)
+				require.Nil(t, r.Navigator().Replace(map[string]interface{}{
+					"schemas":  []interface{}{"urn:ietf:params:scim:schemas:core:2.0:User"},
+					"id":       id,
+					"userName": id,
+				}).Error())
+				require.Nil(t, database.Insert(context.TODO(), r))
+			}
+
+			svc := MeService(
+				resolver,
+				GetService(database),
+				ReplaceService(s.config, s.resourceType, database, []filter.ByResource{
+					filter.ByPropertyToByResource(filter.ReadOnlyFilter()),
+					filter.MetaFilter(),
+				}),
+				PatchService(s.config, database, nil, []filter.ByResource{
+					filter.MetaFilter(),
+				}),
+			)
+			test.do(t, test.ctx, svc, database)
+		})
+	}
+}
+
+func (s *MeServiceTestSuite) TestUnsupported() {
+	svc := MeService(SubjectResolverFunc(func(ctx context.Context) (string, error) {
+		return "", errors.New("should not be called")
+	}), nil, nil, nil)
+
+	_, err := svc.Patch(context.TODO(), &PatchRequest{})
+	assert.True(s.T(), errors.Is(err, spec.ErrInvalidSyntax))
+}
+
+func (s *MeServiceTestSuite) SetupSuite() {
+	for _, each := range []struct {
+		filepath  string
+		structure interface{}
+		post      func(parsed interface{})
+	}{
+		{
+			filepath:  "../../../public/schemas/core_schema.json",
+			structure: new(spec.Schema),
+			post: func(parsed interface{}) {
+				spec.Schemas().Register(parsed.(*spec.Schema))
+			},
+		},
+		{
+			filepath:  "../../../public/schemas/user_schema.json",
+			structure: new(spec.Schema),
+			post: func(parsed interface{}) {
+				spec.Schemas().Register(parsed.(*spec.Schema))
+			},
+		},
+		{
+			filepath:  "../../../public/schemas/user_enterprise_extension_schema.json",
+			structure: new(spec.Schema),
+			post: func(parsed interface{}) {
+				spec.Schemas().Register(parsed.(*spec.Schema))
+			},
+		},
+		{
+			filepath:  "../../../public/resource_types/user_resource_type.json",
+			structure: new(spec.ResourceType),
+			post: func(parsed interface{}) {
+				s.resourceType = parsed.(*spec.ResourceType)
+				crud.Register(s.resourceType)
+			},
+		},
+	} {
+		f, err := os.Open(each.filepath)
+		require.Nil(s.T(), err)
+
+		raw, err := ioutil.ReadAll(f)
+		require.Nil(s.T(), err)
+
+		err = json.Unmarshal(raw, each.structure)
+		require.Nil(s.T(), err)
+
+		if each.post != nil {
+			each.post(each.structure)
+		}
+	}
+
+	s.config = new(spec.ServiceProviderConfig)
+	require.Nil(s.T(), json.Unmarshal([]byte(`
+{
+  "patch": {
+    "supported": true
+  }
+}
+`), s.config))
+}
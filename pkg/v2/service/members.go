@@ -0,0 +1,84 @@
+package service
+
+import (
+	"context"
+	"github.com/imulab/go-scim/pkg/v2/crud"
+	"github.com/imulab/go-scim/pkg/v2/db"
+	"github.com/imulab/go-scim/pkg/v2/spec"
+	"math"
+)
+
+// MembersService returns a service that pages through the "members" of a group, loading the page of members only
+// when the database supports it (see db.GetElements), so that groups with hundreds of thousands of members can be
+// listed without loading and serializing every member, i.e. for a /Groups/{id}/members extension endpoint. The total
+// number of members is counted, likewise, without loading them (see db.CountElements).
+//
+// Pages hold defaultPageSize members of the service provider config by default, or all members if it is not set; a
+// count beyond maxPageSize, or filter.maxResults, is reduced to it.
+func MembersService(config *spec.ServiceProviderConfig, database db.DB) Members {
+	return &membersService{config: config, database: database}
+}
+
+type (
+	// Members service
+	Members interface {
+		Do(ctx context.Context, req *MembersRequest) (resp *MembersResponse, err error)
+	}
+	// Members request
+	MembersRequest struct {
+		ResourceID string // id of the group
+		StartIndex int    // 1-based index of the first member of the page, or 0 for the first
+		Count      int    // maximum number of members of the page, 0 to only count them, or negative for the default
+	}
+	// Members response
+	MembersResponse struct {
+		TotalResults int           // number of members of the group
+		StartIndex   int           // 1-based index of the first member of the page
+		ItemsPerPage int           // number of members of the page
+		Members      []interface{} // the members of the page, as raw values of the elements of "members"
+	}
+)
+
+type membersService struct {
+	config   *spec.ServiceProviderConfig
+	database db.DB
+}
+
+func (s *membersService) Do(ctx context.Context, req *MembersRequest) (resp *MembersResponse, err error) {
+	pagination := s.pagination(req)
+
+	resp = &MembersResponse{StartIndex: pagination.StartIndex, Members: []interface{}{}}
+	if resp.TotalResults, err = db.CountElements(ctx, s.database, req.ResourceID, membersAttribute); err != nil {
+		return
+	}
+	if pagination.Count == 0 || pagination.StartIndex > resp.TotalResults {
+		return
+	}
+
+	if resp.Members, err = db.GetElements(ctx, s.database, req.ResourceID, membersAttribute, pagination); err != nil {
+		return
+	}
+	resp.ItemsPerPage = len(resp.Members)
+	return
+}
+
+// Returns the pagination of the request, defaulted and clamped according to the service provider config.
+func (s *membersService) pagination(req *MembersRequest) *crud.Pagination {
+	pagination := &crud.Pagination{StartIndex: req.StartIndex, Count: req.Count}
+	if pagination.StartIndex <= 0 {
+		pagination.StartIndex = 1
+	}
+	if pagination.Count < 0 {
+		if pagination.Count = s.config.Pagination.DefaultPageSize; pagination.Count <= 0 {
+			pagination.Count = math.MaxInt32
+		}
+	}
+	for _, max := range []int{s.config.Pagination.MaxPageSize, s.config.Filter.MaxResults} {
+		if max > 0 {
+			pagination = clampCount(pagination, max)
+		}
+	}
+	return pagination
+}
+
+const membersAttribute = "members"
@@ -0,0 +1,206 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/imulab/go-scim/pkg/v2/crud"
+	"github.com/imulab/go-scim/pkg/v2/db"
+	"github.com/imulab/go-scim/pkg/v2/prop"
+	"github.com/imulab/go-scim/pkg/v2/spec"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestMembersService(t *testing.T) {
+	s := new(MembersServiceTestSuite)
+	suite.Run(t, s)
+}
+
+type MembersServiceTestSuite struct {
+	suite.Suite
+	resourceType *spec.ResourceType
+}
+
+func (s *MembersServiceTestSuite) TestDo() {
+	database := db.Memory()
+	var members []interface{}
+	for i := 1; i <= 5; i++ {
+		members = append(members, map[string]interface{}{"value": fmt.Sprintf("u%d", i)})
+	}
+	for id, data := range map[string]map[string]interface{}{
+		"g1": {"displayName": "Large", "members": members},
+		"g2": {"displayName": "Empty"},
+	} {
+		data["schemas"] = []interface{}{"urn:ietf:params:scim:schemas:core:2.0:Group"}
+		data["id"] = id
+		g := prop.NewResource(s.resourceType)
+		require.False(s.T(), g.Navigator().Replace(data).HasError())
+		require.Nil(s.T(), database.Insert(context.Background(), g))
+	}
+	values := func(resp *MembersResponse) []string {
+		var ids []string
+		for _, member := range resp.Members {
+			ids = append(ids, member.(map[string]interface{})["value"].(string))
+		}
+		return ids
+	}
+
+	tests := []struct {
+		name   string
+		config *spec.ServiceProviderConfig
+		req    *MembersRequest
+		expect func(t *testing.T, resp *MembersResponse, err error)
+	}{
+		{
+			name:   "all members",
+			config: &spec.ServiceProviderConfig{},
+			req:    &MembersRequest{ResourceID: "g1", Count: -1},
+			expect: func(t *testing.T, resp *MembersResponse, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, 5, resp.TotalResults)
+				assert.Equal(t, 1, resp.StartIndex)
+				assert.Equal(t, 5, resp.ItemsPerPage)
+				assert.Equal(t, []string{"u1", "u2", "u3", "u4", "u5"}, values(resp))
+			},
+		},
+		{
+			name:   "page",
+			config: &spec.ServiceProviderConfig{},
+			req:    &MembersRequest{ResourceID: "g1", StartIndex: 2, Count: 2},
+			expect: func(t *testing.T, resp *MembersResponse, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, 5, resp.TotalResults)
+				assert.Equal(t, 2, resp.StartIndex)
+				assert.Equal(t, []string{"u2", "u3"}, values(resp))
+			},
+		},
+		{
+			name: "default page size",
+			config: func() *spec.ServiceProviderConfig {
+				config := &spec.ServiceProviderConfig{}
+				config.Pagination.DefaultPageSize = 3
+				return config
+			}(),
+			req: &MembersRequest{ResourceID: "g1", StartIndex: 4, Count: -1},
+			expect: func(t *testing.T, resp *MembersResponse, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, []string{"u4", "u5"}, values(resp))
+			},
+		},
+		{
+			name: "count beyond max page size",
+			config: func() *spec.ServiceProviderConfig {
+				config := &spec.ServiceProviderConfig{}
+				config.Pagination.MaxPageSize = 2
+				return config
+			}(),
+			req: &MembersRequest{ResourceID: "g1", Count: 10},
+			expect: func(t *testing.T, resp *MembersResponse, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, 5, resp.TotalResults)
+				assert.Equal(t, []string{"u1", "u2"}, values(resp))
+			},
+		},
+		{
+			name:   "count only",
+			config: &spec.ServiceProviderConfig{},
+			req:    &MembersRequest{ResourceID: "g1"},
+			expect: func(t *testing.T, resp *MembersResponse, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, 5, resp.TotalResults)
+				assert.Empty(t, resp.Members)
+			},
+		},
+		{
+			name:   "beyond the members",
+			config: &spec.ServiceProviderConfig{},
+			req:    &MembersRequest{ResourceID: "g1", StartIndex: 6, Count: 2},
+			expect: func(t *testing.T, resp *MembersResponse, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, 5, resp.TotalResults)
+				assert.Empty(t, resp.Members)
+			},
+		},
+		{
+			name:   "no members",
+			config: &spec.ServiceProviderConfig{},
+			req:    &MembersRequest{ResourceID: "g2", Count: -1},
+			expect: func(t *testing.T, resp *MembersResponse, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, 0, resp.TotalResults)
+				assert.NotNil(t, resp.Members)
+				assert.Empty(t, resp.Members)
+			},
+		},
+		{
+			name:   "group not found",
+			config: &spec.ServiceProviderConfig{},
+			req:    &MembersRequest{ResourceID: "g3", Count: -1},
+			expect: func(t *testing.T, _ *MembersResponse, err error) {
+				assert.True(t, errors.Is(err, spec.ErrNotFound))
+			},
+		},
+	}
+
+	for _, test := range tests {
+		s.T().Run(test.name, func(t *testing.T) {
+			resp, err := MembersService(test.config, database).Do(context.Background(), test.req)
+			test.expect(t, resp, err)
+		})
+		// likewise with a database that loads the whole group
+		s.T().Run(test.name+" without element db", func(t *testing.T) {
+			resp, err := MembersService(test.config, struct{ db.DB }{database}).Do(context.Background(), test.req)
+			test.expect(t, resp, err)
+		})
+	}
+}
+
+func (s *MembersServiceTestSuite) SetupSuite() {
+	for _, each := range []struct {
+		filepath  string
+		structure interface{}
+		post      func(parsed interface{})
+	}{
+		{
+			filepath:  "../../../public/schemas/core_schema.json",
+			structure: new(spec.Schema),
+			post: func(parsed interface{}) {
+				spec.Schemas().Register(parsed.(*spec.Schema))
+			},
+		},
+		{
+			filepath:  "../../../public/schemas/group_schema.json",
+			structure: new(spec.Schema),
+			post: func(parsed interface{}) {
+				spec.Schemas().Register(parsed.(*spec.Schema))
+			},
+		},
+		{
+			filepath:  "../../../public/resource_types/group_resource_type.json",
+			structure: new(spec.ResourceType),
+			post: func(parsed interface{}) {
+				s.resourceType = parsed.(*spec.ResourceType)
+				crud.Register(s.resourceType)
+			},
+		},
+	} {
+		f, err := os.Open(each.filepath)
+		require.Nil(s.T(), err)
+
+		raw, err := ioutil.ReadAll(f)
+		require.Nil(s.T(), err)
+
+		err = json.Unmarshal(raw, each.structure)
+		require.Nil(s.T(), err)
+
+		if each.post != nil {
+			each.post(each.structure)
+		}
+	}
+}
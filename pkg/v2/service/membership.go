@@ -0,0 +1,326 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"github.com/imulab/go-scim/pkg/v2/annotation"
+	"github.com/imulab/go-scim/pkg/v2/crud"
+	"github.com/imulab/go-scim/pkg/v2/crud/expr"
+	"github.com/imulab/go-scim/pkg/v2/db"
+	"github.com/imulab/go-scim/pkg/v2/prop"
+	"github.com/imulab/go-scim/pkg/v2/service/filter"
+	"github.com/imulab/go-scim/pkg/v2/spec"
+	"github.com/imulab/go-scim/pkg/v2/trace"
+	"strings"
+)
+
+// MembershipService returns a service that adds and removes, in one operation, any number of members of a group by
+// their values, i.e. the ids of users and groups. The members are added and removed in a single pass over the members
+// of the group, and the group is filtered and saved once, as a patch would be (see PatchService): the response is a
+// patch response, so that the group is reported as patched once, with all members joined and left, by interceptors
+// (see InterceptorChain.Membership) and wrappers synchronizing the groups of users.
+//
+// Members that are already members are not added again, and members that are not members are not removed. When
+// the same member is both added and removed, the last of the operations applies, removals coming after additions.
+func MembershipService(
+	config *spec.ServiceProviderConfig,
+	database db.DB,
+	preFilters []filter.ByResource,
+	postFilters []filter.ByResource,
+) Membership {
+	return &membershipService{
+		patchService: &patchService{
+			preFilters:  preFilters,
+			postFilters: postFilters,
+			database:    database,
+			config:      config,
+		},
+	}
+}
+
+type (
+	// Membership service
+	Membership interface {
+		Do(ctx context.Context, req *MembershipRequest) (resp *PatchResponse, err error)
+	}
+	// Membership request
+	MembershipRequest struct {
+		ResourceID    string                             // id of the group
+		MatchCriteria func(resource *prop.Resource) bool // extra criteria to meet for the group to be patched
+		Version       string                             // version the group has to be of, i.e. from If-Match, or db.AnyVersion
+		Add           []string                           // values of the members to add
+		Remove        []string                           // values of the members to remove
+		DryRun        bool                               // only validate the patched group, running the filters, but do not persist it
+	}
+)
+
+type membershipService struct {
+	*patchService
+}
+
+func (s *membershipService) Do(ctx context.Context, req *MembershipRequest) (resp *PatchResponse, err error) {
+	if err = s.checkSupport(); err != nil {
+		return
+	}
+	if req == nil || len(req.Add)+len(req.Remove) == 0 {
+		err = fmt.Errorf("%w: no members to add or remove", spec.ErrInvalidSyntax)
+		return
+	}
+
+	return s.patch(ctx, &PatchRequest{
+		ResourceID:    req.ResourceID,
+		MatchCriteria: req.MatchCriteria,
+		Version:       req.Version,
+		DryRun:        req.DryRun,
+	}, func(ctx context.Context, resource *prop.Resource) (err error) {
+		_, end := trace.Start(ctx, trace.Patch)
+		defer func() { end(err) }()
+
+		batch := newElementBatch(resource.RootAttribute().SubAttributeForName(membersAttribute))
+		if batch == nil {
+			return fmt.Errorf("%w: '%s' has no members", spec.ErrInvalidPath, resource.ResourceType().Name())
+		}
+		for _, value := range req.Add {
+			batch.add(map[string]interface{}{batch.identity.Name(): value})
+		}
+		for _, value := range req.Remove {
+			batch.remove(value)
+		}
+		return batch.apply(resource)
+	})
+}
+
+// elementBatch adds and removes elements of a multiValued complex attribute, whose elements are identified by a single
+// string sub attribute annotated with @Identity, i.e. the "value" of "members". Unlike adding and removing elements
+// one by one, which scan the elements for every element added or removed, the batch is applied in a single pass over
+// the elements, so that thousands of members can be added to and removed from large groups.
+type elementBatch struct {
+	attr     *spec.Attribute
+	identity *spec.Attribute
+	removed  map[string]struct{} // keys of the existing elements to remove
+	added    []interface{}       // raw values of the elements to add, nil once removed by a later operation
+	addedAt  map[string]int      // index of the elements to add in added, by key
+}
+
+// Returns a batch for the elements of the attribute, or nil if the attribute does not have elements identified by a
+// single string sub attribute.
+func newElementBatch(attr *spec.Attribute) *elementBatch {
+	if attr == nil || !attr.MultiValued() || attr.Type() != spec.TypeComplex {
+		return nil
+	}
+
+	var identities []*spec.Attribute
+	_ = attr.ForEachSubAttribute(func(subAttribute *spec.Attribute) error {
+		if _, ok := subAttribute.Annotation(annotation.Identity); ok {
+			identities = append(identities, subAttribute)
+		}
+		return nil
+	})
+	if len(identities) != 1 || identities[0].Type() != spec.TypeString {
+		return nil
+	}
+
+	return &elementBatch{
+		attr:     attr,
+		identity: identities[0],
+		removed:  map[string]struct{}{},
+		addedAt:  map[string]int{},
+	}
+}
+
+// Adds the raw value of an element to the batch.
+func (b *elementBatch) add(element interface{}) {
+	value, ok := b.identityOf(element)
+	if !ok {
+		b.added = append(b.added, element)
+		return
+	}
+
+	key := crud.CollationKey(b.identity, value)
+	if _, ok := b.addedAt[key]; ok {
+		return
+	}
+	b.addedAt[key] = len(b.added)
+	b.added = append(b.added, element)
+}
+
+// Removes the element identified by value from the batch, whether it is an existing element, or an element added by
+// an earlier operation.
+func (b *elementBatch) remove(value string) {
+	key := crud.CollationKey(b.identity, value)
+	b.removed[key] = struct{}{}
+	if i, ok := b.addedAt[key]; ok {
+		b.added[i] = nil
+		delete(b.addedAt, key)
+	}
+}
+
+// Applies the batch to the resource: the elements to remove are deleted in a single pass, with the events of their
+// deletion propagated once, and the elements to add are then added at once.
+func (b *elementBatch) apply(resource *prop.Resource) error {
+	nav := resource.Navigator().Dot(b.attr.Name())
+	if err := nav.Error(); err != nil {
+		return err
+	}
+
+	if len(b.removed) > 0 {
+		var events *prop.Events
+		if err := nav.ForEachChild(func(_ int, child prop.Property) error {
+			identity, err := child.ChildAtIndex(b.identity.Name())
+			if err != nil || identity == nil || identity.IsUnassigned() {
+				return nil
+			}
+			if _, ok := b.removed[crud.CollationKey(b.identity, identity.Raw().(string))]; !ok {
+				return nil
+			}
+
+			ev, err := child.Delete()
+			if err != nil || ev == nil {
+				return err
+			}
+			elementEvents := ev.ToEvents()
+			if err := child.Notify(elementEvents); err != nil {
+				return err
+			}
+			if events == nil {
+				events = elementEvents
+				return nil
+			}
+			return elementEvents.ForEachEvent(func(ev *prop.Event) error {
+				events.Append(ev)
+				return nil
+			})
+		}); err != nil {
+			return err
+		}
+
+		// Propagate the events to the attribute, which compacts its elements once, and to the root, as the navigator
+		// would have done for every deletion.
+		if events != nil {
+			for _, property := range []prop.Property{nav.Current(), resource.RootProperty()} {
+				if err := property.Notify(events); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	added := make([]interface{}, 0, len(b.added))
+	for _, element := range b.added {
+		if element != nil {
+			added = append(added, element)
+		}
+	}
+	if len(added) > 0 {
+		return nav.Add(added).Error()
+	}
+	return nil
+}
+
+func (b *elementBatch) identityOf(element interface{}) (string, bool) {
+	m, ok := element.(map[string]interface{})
+	if !ok {
+		return "", false
+	}
+	for k, v := range m {
+		if strings.EqualFold(k, b.identity.Name()) {
+			value, ok := v.(string)
+			return value, ok
+		}
+	}
+	return "", false
+}
+
+// Returns the number of the operations, from the first, that are additions and removals of the elements of the same
+// attribute which can be applied as a batch by their identities (see elementBatch), along with the batch. The
+// operations are additions of elements to the attribute, i.e. "members", and removals of elements filtered by their
+// identity, i.e. 'members[value eq "2819c223"]', as identity providers send when synchronizing large groups.
+func batchOf(resource *prop.Resource, operations []PatchOperation) (*elementBatch, int, error) {
+	var (
+		batch *elementBatch
+		n     int
+	)
+	for _, op := range operations {
+		attr, value, ok := batchable(resource, &op)
+		if !ok || (batch != nil && attr != batch.attr) {
+			break
+		}
+		if batch == nil {
+			if batch = newElementBatch(attr); batch == nil {
+				break
+			}
+		}
+
+		if strings.ToLower(op.Op) == "remove" {
+			batch.remove(value)
+		} else {
+			raw, err := op.ParseValue(resource)
+			if err != nil {
+				return nil, 0, err
+			}
+			if elements, ok := raw.([]interface{}); ok {
+				for _, element := range elements {
+					if element != nil {
+						batch.add(element)
+					}
+				}
+			} else if raw != nil {
+				batch.add(raw)
+			}
+		}
+		n++
+	}
+	return batch, n, nil
+}
+
+// Returns the top level attribute of the operation, and the identity value to remove for removals, if the operation
+// may be batched.
+func batchable(resource *prop.Resource, op *PatchOperation) (attr *spec.Attribute, value string, ok bool) {
+	opType := strings.ToLower(op.Op)
+	if (opType != "add" && opType != "remove") || len(op.Path) == 0 {
+		return
+	}
+
+	head, err := expr.CompilePath(op.Path)
+	if err != nil {
+		return
+	}
+	if head.IsPath() && strings.ToLower(head.Token()) == strings.ToLower(resource.ResourceType().Schema().ID()) {
+		head = head.Next()
+	}
+	if head == nil || !head.IsPath() {
+		return
+	}
+	if attr = resource.RootAttribute().SubAttributeForName(head.Token()); attr == nil {
+		return
+	}
+
+	next := head.Next()
+	if opType == "add" {
+		return attr, "", next == nil
+	}
+
+	// removals have to be filtered by equality of the identity of the elements, i.e. members[value eq "2819c223"]
+	if next == nil || !next.IsRootOfFilter() || next.Token() != expr.Eq || next.Next() != nil {
+		return
+	}
+	if left := next.Left(); !left.IsPath() || left.Next() != nil || !isIdentityOf(attr, left.Token()) {
+		return
+	}
+	if !next.Right().IsLiteral() {
+		return
+	}
+	if value, err = expr.Unquote(next.Right().Token()); err != nil {
+		return
+	}
+	return attr, value, true
+}
+
+func isIdentityOf(attr *spec.Attribute, name string) bool {
+	subAttr := attr.SubAttributeForName(name)
+	if subAttr == nil {
+		return false
+	}
+	_, ok := subAttr.Annotation(annotation.Identity)
+	return ok
+}
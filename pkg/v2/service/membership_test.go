@@ -0,0 +1,290 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/imulab/go-scim/pkg/v2/crud"
+	"github.com/imulab/go-scim/pkg/v2/db"
+	"github.com/imulab/go-scim/pkg/v2/prop"
+	"github.com/imulab/go-scim/pkg/v2/service/filter"
+	"github.com/imulab/go-scim/pkg/v2/spec"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMembershipService(t *testing.T) {
+	s := new(MembershipServiceTestSuite)
+	suite.Run(t, s)
+}
+
+type MembershipServiceTestSuite struct {
+	suite.Suite
+	resourceType *spec.ResourceType
+	config       *spec.ServiceProviderConfig
+}
+
+func (s *MembershipServiceTestSuite) TestDo() {
+	tests := []struct {
+		name   string
+		req    *MembershipRequest
+		expect func(t *testing.T, resp *PatchResponse, err error)
+	}{
+		{
+			name: "add and remove members",
+			req:  &MembershipRequest{ResourceID: "g1", Add: []string{"u4", "u5", "u4"}, Remove: []string{"u1", "u3"}},
+			expect: func(t *testing.T, resp *PatchResponse, err error) {
+				assert.Nil(t, err)
+				assert.True(t, resp.Patched)
+				assert.Equal(t, []string{"u1", "u2", "u3"}, s.values(resp.Ref))
+				assert.Equal(t, []string{"u2", "u4", "u5"}, s.values(resp.Resource))
+				assert.NotEqual(t, resp.Ref.MetaVersionOrEmpty(), resp.Resource.MetaVersionOrEmpty())
+			},
+		},
+		{
+			name: "remove members case insensitively",
+			req:  &MembershipRequest{ResourceID: "g1", Remove: []string{"U2"}},
+			expect: func(t *testing.T, resp *PatchResponse, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, []string{"u1", "u3"}, s.values(resp.Resource))
+			},
+		},
+		{
+			name: "add and remove the same member",
+			req:  &MembershipRequest{ResourceID: "g1", Add: []string{"u4"}, Remove: []string{"u4"}},
+			expect: func(t *testing.T, resp *PatchResponse, err error) {
+				assert.Nil(t, err)
+				assert.False(t, resp.Patched)
+			},
+		},
+		{
+			name: "add existing and remove absent members",
+			req:  &MembershipRequest{ResourceID: "g1", Add: []string{"u1"}, Remove: []string{"u9"}},
+			expect: func(t *testing.T, resp *PatchResponse, err error) {
+				assert.Nil(t, err)
+				assert.False(t, resp.Patched)
+				assert.Equal(t, []string{"u1", "u2", "u3"}, s.values(resp.Resource))
+			},
+		},
+		{
+			name: "remove all members",
+			req:  &MembershipRequest{ResourceID: "g1", Remove: []string{"u1", "u2", "u3"}},
+			expect: func(t *testing.T, resp *PatchResponse, err error) {
+				assert.Nil(t, err)
+				assert.True(t, resp.Patched)
+				assert.Empty(t, s.values(resp.Resource))
+			},
+		},
+		{
+			name: "dry run",
+			req:  &MembershipRequest{ResourceID: "g1", Add: []string{"u4"}, DryRun: true},
+			expect: func(t *testing.T, resp *PatchResponse, err error) {
+				assert.Nil(t, err)
+				assert.True(t, resp.DryRun)
+				assert.Equal(t, []string{"u1", "u2", "u3", "u4"}, s.values(resp.Resource))
+			},
+		},
+		{
+			name: "no members",
+			req:  &MembershipRequest{ResourceID: "g1"},
+			expect: func(t *testing.T, _ *PatchResponse, err error) {
+				assert.True(t, errors.Is(err, spec.ErrInvalidSyntax))
+			},
+		},
+		{
+			name: "group not found",
+			req:  &MembershipRequest{ResourceID: "g2", Add: []string{"u4"}},
+			expect: func(t *testing.T, _ *PatchResponse, err error) {
+				assert.True(t, errors.Is(err, spec.ErrNotFound))
+			},
+		},
+	}
+
+	for _, test := range tests {
+		s.T().Run(test.name, func(t *testing.T) {
+			database := db.Memory()
+			require.Nil(t, database.Insert(context.Background(), s.group(t, "u1", "u2", "u3")))
+
+			resp, err := MembershipService(s.config, database, nil, []filter.ByResource{
+				filter.MetaFilter(),
+			}).Do(context.Background(), test.req)
+			test.expect(t, resp, err)
+
+			if err == nil && resp.Patched && !resp.DryRun {
+				saved, err := database.Get(context.Background(), "g1", nil)
+				require.Nil(t, err)
+				assert.Equal(t, s.values(resp.Resource), s.values(saved))
+			}
+		})
+	}
+}
+
+func (s *MembershipServiceTestSuite) TestRetry() {
+	database := &conflictingDB{DB: db.Memory(), conflicts: 1}
+	require.Nil(s.T(), database.DB.Insert(context.Background(), s.group(s.T(), "u1", "u2", "u3")))
+
+	membership := RetryMembershipOnConflict(MembershipService(s.config, database, nil, []filter.ByResource{
+		filter.MetaFilter(),
+	}), ConflictRetry{Backoff: time.Millisecond})
+	resp, err := membership.Do(context.Background(), &MembershipRequest{ResourceID: "g1", Add: []string{"u4"}})
+	require.Nil(s.T(), err)
+	assert.True(s.T(), resp.Patched)
+	assert.Equal(s.T(), 2, database.replaced)
+	// the concurrent modification is retained
+	assert.Equal(s.T(), "concurrent 1", resp.Resource.Navigator().Dot("displayName").Current().Raw())
+	assert.Equal(s.T(), []string{"u1", "u2", "u3", "u4"}, s.values(resp.Resource))
+}
+
+func (s *MembershipServiceTestSuite) TestPatch() {
+	// This is how identity providers tend to synchronize large groups: one operation per member.
+	var operations []string
+	for i := 1; i <= 1000; i++ {
+		operations = append(operations, fmt.Sprintf(`{"op": "add", "path": "members", "value": [{"value": "n%d"}]}`, i))
+	}
+	for i := 1; i <= 1000; i += 2 {
+		operations = append(operations, fmt.Sprintf(`{"op": "remove", "path": "members[value eq \"n%d\"]"}`, i))
+	}
+
+	tests := []struct {
+		name       string
+		operations []string
+		expect     []string
+	}{
+		{
+			name: "add and remove members",
+			operations: []string{
+				`{"op": "add", "path": "members", "value": [{"value": "u4"}, {"value": "u5"}]}`,
+				`{"op": "remove", "path": "members[value eq \"u1\"]"}`,
+				`{"op": "remove", "path": "urn:ietf:params:scim:schemas:core:2.0:Group:members[value eq \"u5\"]"}`,
+				`{"op": "add", "path": "members", "value": [{"value": "u3"}, {"value": "u1"}]}`,
+			},
+			expect: []string{"u2", "u3", "u4", "u1"},
+		},
+		{
+			name: "operations on other attributes in between",
+			operations: []string{
+				`{"op": "remove", "path": "members[value eq \"u1\"]"}`,
+				`{"op": "replace", "path": "displayName", "value": "Staff"}`,
+				`{"op": "remove", "path": "members[display eq \"u2\"]"}`,
+			},
+			expect: []string{"u3"},
+		},
+		{
+			name:       "thousands of members",
+			operations: operations,
+			expect: func() []string {
+				expect := []string{"u1", "u2", "u3"}
+				for i := 2; i <= 1000; i += 2 {
+					expect = append(expect, fmt.Sprintf("n%d", i))
+				}
+				return expect
+			}(),
+		},
+	}
+
+	for _, test := range tests {
+		s.T().Run(test.name, func(t *testing.T) {
+			database := db.Memory()
+			require.Nil(t, database.Insert(context.Background(), s.group(t, "u1", "u2", "u3")))
+
+			resp, err := PatchService(s.config, database, nil, []filter.ByResource{
+				filter.MetaFilter(),
+			}).Do(context.Background(), &PatchRequest{
+				ResourceID: "g1",
+				PayloadSource: strings.NewReader(fmt.Sprintf(`{
+					"schemas": ["urn:ietf:params:scim:api:messages:2.0:PatchOp"],
+					"Operations": [%s]
+				}`, strings.Join(test.operations, ","))),
+			})
+			require.Nil(t, err)
+			assert.True(t, resp.Patched)
+			assert.Equal(t, test.expect, s.values(resp.Resource))
+		})
+	}
+}
+
+func (s *MembershipServiceTestSuite) group(t *testing.T, members ...string) *prop.Resource {
+	var elements []interface{}
+	for _, member := range members {
+		elements = append(elements, map[string]interface{}{"value": member, "display": member})
+	}
+	r := prop.NewResource(s.resourceType)
+	require.False(t, r.Navigator().Replace(map[string]interface{}{
+		"schemas":     []interface{}{"urn:ietf:params:scim:schemas:core:2.0:Group"},
+		"id":          "g1",
+		"displayName": "Engineering",
+		"members":     elements,
+		"meta": map[string]interface{}{
+			"version": "v1",
+		},
+	}).HasError())
+	return r
+}
+
+func (s *MembershipServiceTestSuite) values(resource *prop.Resource) []string {
+	values := []string{}
+	_ = resource.Navigator().Dot("members").ForEachChild(func(_ int, child prop.Property) error {
+		value, _ := child.ChildAtIndex("value")
+		values = append(values, value.Raw().(string))
+		return nil
+	})
+	return values
+}
+
+func (s *MembershipServiceTestSuite) SetupSuite() {
+	for _, each := range []struct {
+		filepath  string
+		structure interface{}
+		post      func(parsed interface{})
+	}{
+		{
+			filepath:  "../../../public/schemas/core_schema.json",
+			structure: new(spec.Schema),
+			post: func(parsed interface{}) {
+				spec.Schemas().Register(parsed.(*spec.Schema))
+			},
+		},
+		{
+			filepath:  "../../../public/schemas/group_schema.json",
+			structure: new(spec.Schema),
+			post: func(parsed interface{}) {
+				spec.Schemas().Register(parsed.(*spec.Schema))
+			},
+		},
+		{
+			filepath:  "../../../public/resource_types/group_resource_type.json",
+			structure: new(spec.ResourceType),
+			post: func(parsed interface{}) {
+				s.resourceType = parsed.(*spec.ResourceType)
+				crud.Register(s.resourceType)
+			},
+		},
+		{
+			filepath:  "../../../public/service_provider_config.json",
+			structure: new(spec.ServiceProviderConfig),
+			post: func(parsed interface{}) {
+				s.config = parsed.(*spec.ServiceProviderConfig)
+			},
+		},
+	} {
+		f, err := os.Open(each.filepath)
+		require.Nil(s.T(), err)
+
+		raw, err := ioutil.ReadAll(f)
+		require.Nil(s.T(), err)
+
+		err = json.Unmarshal(raw, each.structure)
+		require.Nil(s.T(), err)
+
+		if each.post != nil {
+			each.post(each.structure)
+		}
+	}
+}
@@ -5,7 +5,6 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
-	"io/ioutil"
 	"strings"
 
 	"github.com/imulab/go-scim/pkg/v2/crud"
@@ -15,10 +14,15 @@ import (
 	"github.com/imulab/go-scim/pkg/v2/prop"
 	"github.com/imulab/go-scim/pkg/v2/service/filter"
 	"github.com/imulab/go-scim/pkg/v2/spec"
+	"github.com/imulab/go-scim/pkg/v2/trace"
 )
 
 // PatchService returns a patch resource service. preFilters will run after resource fetched from database and before
 // resource is patched. postFilters will run after resource has been patched and before resource is saved back to database.
+// If the patch operations do not effectively change the resource, postFilters are skipped and the resource is not saved,
+// so that its version is not bumped; the response then reports the resource as not patched. Dry run requests are
+// patched and filtered, hence validated, like others, but the resource is not saved, and the OnAfterPatch hook is not
+// called.
 func PatchService(
 	config *spec.ServiceProviderConfig,
 	database db.DB,
@@ -33,6 +37,24 @@ func PatchService(
 	}
 }
 
+// PatchServiceWithHooks returns a patch resource service like PatchService, except that the OnBeforePatch and
+// OnAfterPatch hooks are called around the patch (see Hooks).
+func PatchServiceWithHooks(
+	config *spec.ServiceProviderConfig,
+	database db.DB,
+	preFilters []filter.ByResource,
+	postFilters []filter.ByResource,
+	hooks *Hooks,
+) Patch {
+	return &patchService{
+		preFilters:  preFilters,
+		postFilters: postFilters,
+		database:    database,
+		config:      config,
+		hooks:       hooks,
+	}
+}
+
 type (
 	// Patch resource service
 	Patch interface {
@@ -53,13 +75,16 @@ type (
 	PatchRequest struct {
 		ResourceID    string                             // id of the resource to patch
 		MatchCriteria func(resource *prop.Resource) bool // extra criteria to meet for the resource to be patched
+		Version       string                             // version the resource has to be of, i.e. from If-Match, or db.AnyVersion
 		PayloadSource io.Reader                          // source to read the patch payload from
+		DryRun        bool                               // only validate the patched resource, running the filters, but do not persist it
 	}
 	// Patch resource response
 	PatchResponse struct {
 		Patched  bool           // true if the resource was patched; false if the resource was not patched but there was no error
 		Ref      *prop.Resource // reference resource (the before state)
-		Resource *prop.Resource // patched resource (the after state)
+		Resource *prop.Resource // patched resource (the after state), or the unchanged resource if not patched
+		DryRun   bool           // true if the resource would have been patched, but was not persisted
 	}
 )
 
@@ -68,6 +93,7 @@ type patchService struct {
 	postFilters []filter.ByResource
 	database    db.DB
 	config      *spec.ServiceProviderConfig
+	hooks       *Hooks
 }
 
 func (s *patchService) Do(ctx context.Context, req *PatchRequest) (resp *PatchResponse, err error) {
@@ -75,7 +101,7 @@ func (s *patchService) Do(ctx context.Context, req *PatchRequest) (resp *PatchRe
 		return
 	}
 
-	patch, err := s.parseRequest(req)
+	patch, err := s.parseRequest(ctx, req)
 	if err != nil {
 		return
 	}
@@ -83,6 +109,14 @@ func (s *patchService) Do(ctx context.Context, req *PatchRequest) (resp *PatchRe
 		return
 	}
 
+	return s.patch(ctx, req, func(ctx context.Context, resource *prop.Resource) error {
+		return s.apply(ctx, patch, resource)
+	})
+}
+
+// Patches the resource of the request with the apply function, which modifies the resource in place, then filters and
+// saves the resource if it is effectively changed.
+func (s *patchService) patch(ctx context.Context, req *PatchRequest, apply func(ctx context.Context, resource *prop.Resource) error) (resp *PatchResponse, err error) {
 	resource, err := s.database.Get(ctx, req.ResourceID, nil)
 	if err != nil {
 		return
@@ -95,6 +129,12 @@ func (s *patchService) Do(ctx context.Context, req *PatchRequest) (resp *PatchRe
 		}
 	}
 
+	if s.config.ETag.Supported && len(req.Version) > 0 {
+		if err = db.MatchVersion(resource, req.Version); err != nil {
+			return
+		}
+	}
+
 	// To save another database round trip, we use Clone to retain independent copy of the fetched resource.
 	// However, because the cloned instance share subscribers, it is better to work on the original instance.
 	// Hence, we assign reference to the clone, which will not be modified.
@@ -106,25 +146,23 @@ func (s *patchService) Do(ctx context.Context, req *PatchRequest) (resp *PatchRe
 		}
 	}
 
-	for _, patchOp := range patch.Operations {
-		switch strings.ToLower(patchOp.Op) {
-		case "add":
-			if valueToAdd, err := patchOp.ParseValue(resource); err != nil {
-				return nil, err
-			} else if err := crud.Add(resource, patchOp.Path, valueToAdd); err != nil {
-				return nil, err
-			}
-		case "replace":
-			if valueToReplace, err := patchOp.ParseValue(resource); err != nil {
-				return nil, err
-			} else if err := crud.Replace(resource, patchOp.Path, valueToReplace); err != nil {
-				return nil, err
-			}
-		case "remove":
-			if err := crud.Delete(resource, patchOp.Path); err != nil {
-				return nil, err
-			}
+	if err = apply(ctx, resource); err != nil {
+		return
+	}
+
+	if err = s.hooks.beforePatch(ctx, resource, ref); err != nil {
+		return
+	}
+
+	// Patches resulting in no effective change, i.e. identical patches re-sent by clients, are detected before the post
+	// filters, so that neither validation nor version bump takes place.
+	if resource.Hash() == ref.Hash() {
+		resp = &PatchResponse{
+			Patched:  false,
+			Ref:      ref,
+			Resource: ref,
 		}
+		return
 	}
 
 	for _, f := range s.postFilters {
@@ -139,13 +177,29 @@ func (s *patchService) Do(ctx context.Context, req *PatchRequest) (resp *PatchRe
 	)
 	if newVersion == oldVersion {
 		resp = &PatchResponse{
-			Patched: false,
-			Ref:     ref,
+			Patched:  false,
+			Ref:      ref,
+			Resource: ref,
 		}
 		return
 	}
 
-	if err = s.database.Replace(ctx, ref, resource); err != nil {
+	if req.DryRun {
+		resp = &PatchResponse{
+			Patched:  true,
+			Resource: resource,
+			Ref:      ref,
+			DryRun:   true,
+		}
+		return
+	}
+
+	if s.config.ETag.Supported && len(req.Version) > 0 {
+		err = db.ReplaceIfMatch(ctx, s.database, ref, resource, req.Version)
+	} else {
+		err = s.database.Replace(ctx, ref, resource)
+	}
+	if err != nil {
 		return
 	}
 
@@ -154,28 +208,62 @@ func (s *patchService) Do(ctx context.Context, req *PatchRequest) (resp *PatchRe
 		Resource: resource,
 		Ref:      ref,
 	}
+	err = s.hooks.afterPatch(ctx, resource, ref)
+	return
+}
+
+func (s *patchService) apply(ctx context.Context, patch *PatchPayload, resource *prop.Resource) (err error) {
+	_, end := trace.Start(ctx, trace.Patch)
+	defer func() { end(err) }()
+
+	// Runs of additions and removals of members, i.e. one removal per member leaving a large group, are applied as a
+	// batch, rather than scanning the members for every operation (see batchOf).
+	for i := 0; i < len(patch.Operations); {
+		var (
+			batch *elementBatch
+			n     int
+		)
+		if batch, n, err = batchOf(resource, patch.Operations[i:]); err != nil {
+			return
+		}
+		if batch != nil && n > 0 {
+			if err = batch.apply(resource); err != nil {
+				return
+			}
+			i += n
+			continue
+		}
+
+		if err = patch.Operations[i].Apply(resource); err != nil {
+			return
+		}
+		i++
+	}
 	return
 }
 
 func (s *patchService) checkSupport() error {
 	if !s.config.Patch.Supported {
-		return fmt.Errorf("%w: patch operation is not supported", spec.ErrInternal)
+		return fmt.Errorf("%w: patch operation is not supported", spec.ErrNotImplemented)
 	}
 	return nil
 }
 
-func (s *patchService) parseRequest(req *PatchRequest) (*PatchPayload, error) {
+func (s *patchService) parseRequest(ctx context.Context, req *PatchRequest) (*PatchPayload, error) {
 	if req == nil || req.PayloadSource == nil {
 		return nil, fmt.Errorf("%w: no payload for patch service", spec.ErrInternal)
 	}
 
-	raw, err := ioutil.ReadAll(req.PayloadSource)
+	raw, err := readPayload(req.PayloadSource)
 	if err != nil {
-		return nil, fmt.Errorf("%w: failed to read request body", spec.ErrInternal)
+		return nil, err
 	}
 
 	patch := new(PatchPayload)
-	if err := json.Unmarshal(raw, patch); err != nil {
+	_, end := trace.Start(ctx, trace.Deserialize)
+	err = scimjson.Unmarshal(raw, patch)
+	end(err)
+	if err != nil {
 		return nil, err
 	}
 
@@ -183,7 +271,7 @@ func (s *patchService) parseRequest(req *PatchRequest) (*PatchPayload, error) {
 }
 
 func (p *PatchPayload) Validate() error {
-	if len(p.Schemas) != 1 && p.Schemas[0] != "urn:ietf:params:scim:api:messages:2.0:PatchOp" {
+	if len(p.Schemas) != 1 || p.Schemas[0] != "urn:ietf:params:scim:api:messages:2.0:PatchOp" {
 		return fmt.Errorf("%w: invalid patch operation schema", spec.ErrInvalidSyntax)
 	}
 
@@ -211,36 +299,64 @@ func (p *PatchPayload) Validate() error {
 	return nil
 }
 
-func (o *PatchOperation) ParseValue(resource *prop.Resource) (interface{}, error) {
-	var (
-		head *expr.Expression
-		err  error
-	)
-	{
-		if len(o.Path) > 0 {
-			head, err = expr.CompilePath(o.Path)
-			if err != nil {
-				return nil, err
-			}
-			if head.IsPath() && head.Token() == resource.ResourceType().ID() {
-				head = head.Next()
-			}
+// Apply parses the value of the operation against the resource and applies the operation to the resource.
+func (o *PatchOperation) Apply(resource *prop.Resource) error {
+	switch strings.ToLower(o.Op) {
+	case "add":
+		if valueToAdd, err := o.ParseValue(resource); err != nil {
+			return err
+		} else if err := crud.Add(resource, o.Path, valueToAdd); err != nil {
+			return err
+		}
+	case "replace":
+		if valueToReplace, err := o.ParseValue(resource); err != nil {
+			return err
+		} else if err := crud.Replace(resource, o.Path, valueToReplace); err != nil {
+			return err
+		}
+	case "remove":
+		if err := crud.Delete(resource, o.Path); err != nil {
+			return err
 		}
 	}
+	return nil
+}
 
-	attr := o.getTargetAttribute(resource.RootAttribute(), head)
-	if attr == nil {
-		return nil, fmt.Errorf("%w: path '%s' is invalid", spec.ErrInvalidPath, o.Path)
+func (o *PatchOperation) ParseValue(resource *prop.Resource) (interface{}, error) {
+	attr, err := o.targetAttribute(resource.ResourceType(), resource.RootAttribute())
+	if err != nil {
+		return nil, err
 	}
 
-	p := prop.NewProperty(attr)
-	if err := scimjson.DeserializeProperty(o.Value, p, strings.ToLower(o.Op) == "add"); err != nil {
+	p, err := scimjson.DeserializeValue(o.Value, attr, strings.ToLower(o.Op) == "add")
+	if err != nil {
 		return nil, err
 	}
 
 	return p.Raw(), nil
 }
 
+// Returns the attribute targeted by the path of the operation, or the root attribute if there is no path.
+func (o *PatchOperation) targetAttribute(resourceType *spec.ResourceType, root *spec.Attribute) (*spec.Attribute, error) {
+	var head *expr.Expression
+	if len(o.Path) > 0 {
+		var err error
+		head, err = expr.CompilePath(o.Path)
+		if err != nil {
+			return nil, err
+		}
+		if head.IsPath() && strings.ToLower(head.Token()) == strings.ToLower(resourceType.Schema().ID()) {
+			head = head.Next()
+		}
+	}
+
+	attr := o.getTargetAttribute(root, head)
+	if attr == nil {
+		return nil, fmt.Errorf("%w: path '%s' is invalid", spec.ErrInvalidPath, o.Path)
+	}
+	return attr, nil
+}
+
 func (o *PatchOperation) getTargetAttribute(parentAttr *spec.Attribute, cursor *expr.Expression) *spec.Attribute {
 	if cursor == nil {
 		return parentAttr
@@ -251,6 +367,10 @@ func (o *PatchOperation) getTargetAttribute(parentAttr *spec.Attribute, cursor *
 	}
 
 	if cursor.IsRootOfFilter() {
+		// A path ending with a value filter (i.e. addresses[not (type eq "home")]) targets the matching elements.
+		if cursor.Next() == nil {
+			return parentAttr.DeriveElementAttribute()
+		}
 		return o.getTargetAttribute(parentAttr, cursor.Next())
 	}
 
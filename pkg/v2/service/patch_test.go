@@ -3,6 +3,7 @@ package service
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"github.com/imulab/go-scim/pkg/v2/crud"
 	"github.com/imulab/go-scim/pkg/v2/db"
 	"github.com/imulab/go-scim/pkg/v2/prop"
@@ -144,6 +145,66 @@ func (s *PatchServiceTestSuite) TestDo() {
 			expect: func(t *testing.T, resp *PatchResponse, err error) {
 				assert.Nil(t, err)
 				assert.False(t, resp.Patched)
+				assert.Equal(t, resp.Ref.MetaVersionOrEmpty(), resp.Resource.MetaVersionOrEmpty())
+			},
+		},
+		{
+			name: "re-sent identical patch to not persist",
+			setup: func(t *testing.T) Patch {
+				database := db.Memory()
+				err := database.Insert(context.TODO(), s.resourceOf(t, map[string]interface{}{
+					"schemas":  []interface{}{"urn:ietf:params:scim:schemas:core:2.0:User"},
+					"id":       "foo",
+					"userName": "foo",
+					"active":   true,
+					"emails": []interface{}{
+						map[string]interface{}{
+							"value": "foo@bar.com",
+							"type":  "work",
+						},
+					},
+					"meta": map[string]interface{}{
+						"version": "W/\"1\"",
+					},
+				}))
+				require.Nil(t, err)
+				return PatchService(s.config, database, nil, []filter.ByResource{
+					filter.ByPropertyToByResource(
+						filter.ReadOnlyFilter(),
+						filter.BCryptFilter(),
+					),
+					filter.ByPropertyToByResource(filter.ValidationFilter(database)),
+					filter.MetaFilter(),
+				})
+			},
+			getRequest: func() *PatchRequest {
+				return &PatchRequest{
+					ResourceID: "foo",
+					PayloadSource: strings.NewReader(`
+		{
+			"schemas": ["urn:ietf:params:scim:api:messages:2.0:PatchOp"],
+			"Operations": [
+				{
+					"op": "replace",
+					"value": {
+						"userName": "foo",
+						"active": true
+					}
+				},
+				{
+					"op": "replace",
+					"path": "emails[type eq \"work\"].value",
+					"value": "foo@bar.com"
+				}
+			]
+		}
+		`),
+				}
+			},
+			expect: func(t *testing.T, resp *PatchResponse, err error) {
+				assert.Nil(t, err)
+				assert.False(t, resp.Patched)
+				assert.Equal(t, "W/\"1\"", resp.Resource.MetaVersionOrEmpty())
 			},
 		},
 		{
@@ -317,6 +378,85 @@ func (s *PatchServiceTestSuite) TestDo() {
 				assert.Equal(t, "6546579", resp.Resource.Navigator().Dot("urn:ietf:params:scim:schemas:extension:enterprise:2.0:User").Dot("employeeNumber").Current().Raw())
 			},
 		},
+		{
+			name: "patch with logical value filters",
+			setup: func(t *testing.T) Patch {
+				database := db.Memory()
+				err := database.Insert(context.TODO(), s.resourceOf(t, map[string]interface{}{
+					"schemas":  []interface{}{"urn:ietf:params:scim:schemas:core:2.0:User"},
+					"id":       "foo",
+					"userName": "foo",
+					"emails": []interface{}{
+						map[string]interface{}{"value": "foo@bar.com", "type": "work", "primary": true},
+						map[string]interface{}{"value": "foo@work.com", "type": "work"},
+						map[string]interface{}{"value": "foo@home.com", "type": "home"},
+					},
+					"addresses": []interface{}{
+						map[string]interface{}{"type": "home", "locality": "Shanghai"},
+						map[string]interface{}{"type": "work", "locality": "Beijing"},
+						map[string]interface{}{"type": "other", "locality": "Shenzhen"},
+					},
+				}))
+				require.Nil(t, err)
+				return PatchService(s.config, database, nil, []filter.ByResource{
+					filter.ByPropertyToByResource(
+						filter.ReadOnlyFilter(),
+						filter.BCryptFilter(),
+					),
+					filter.ByPropertyToByResource(filter.ValidationFilter(database)),
+					filter.MetaFilter(),
+				})
+			},
+			getRequest: func() *PatchRequest {
+				return &PatchRequest{
+					ResourceID: "foo",
+					PayloadSource: strings.NewReader(`
+		{
+			"schemas": ["urn:ietf:params:scim:api:messages:2.0:PatchOp"],
+			"Operations": [
+				{
+					"op": "replace",
+					"path": "emails[type eq \"work\" and primary pr].value",
+					"value": "foobar@bar.com"
+				},
+				{
+					"op": "add",
+					"path": "urn:ietf:params:scim:schemas:core:2.0:User:emails[type eq \"home\" or value ew \"@work.com\"].display",
+					"value": "secondary"
+				},
+				{
+					"op": "replace",
+					"path": "addresses[not (type eq \"home\") and locality eq \"Beijing\"]",
+					"value": {"type": "work", "locality": "Hangzhou"}
+				},
+				{
+					"op": "remove",
+					"path": "addresses[not (type eq \"home\" or type eq \"work\")]"
+				}
+			]
+		}
+		`),
+				}
+			},
+			expect: func(t *testing.T, resp *PatchResponse, err error) {
+				assert.Nil(t, err)
+				assert.True(t, resp.Patched)
+
+				emails := resp.Resource.Navigator().Dot("emails")
+				assert.Equal(t, "foobar@bar.com", emails.At(0).Dot("value").Current().Raw())
+				emails.Retract().Retract()
+				assert.True(t, emails.At(0).Dot("display").Current().IsUnassigned())
+				emails.Retract().Retract()
+				assert.Equal(t, "secondary", emails.At(1).Dot("display").Current().Raw())
+				emails.Retract().Retract()
+				assert.Equal(t, "secondary", emails.At(2).Dot("display").Current().Raw())
+
+				assert.Equal(t, []interface{}{
+					map[string]interface{}{"type": "home", "locality": "Shanghai"},
+					map[string]interface{}{"type": "work", "locality": "Hangzhou"},
+				}, s.compactAddresses(resp.Resource))
+			},
+		},
 	}
 
 	for _, test := range tests {
@@ -328,6 +468,80 @@ func (s *PatchServiceTestSuite) TestDo() {
 	}
 }
 
+// Returns the type and locality of each address.
+func (s *PatchServiceTestSuite) TestDoDryRun() {
+	database := db.Memory()
+	require.Nil(s.T(), database.Insert(context.TODO(), s.resourceOf(s.T(), map[string]interface{}{
+		"schemas":  []interface{}{"urn:ietf:params:scim:schemas:core:2.0:User"},
+		"id":       "foo",
+		"userName": "foo",
+		"emails": []interface{}{
+			map[string]interface{}{"value": "foo@bar.com"},
+		},
+	})))
+	service := PatchService(s.config, database, nil, []filter.ByResource{
+		filter.ByPropertyToByResource(filter.ReadOnlyFilter()),
+		filter.ByPropertyToByResource(filter.ValidationFilter(database)),
+		filter.MetaFilter(),
+	})
+
+	resp, err := service.Do(context.TODO(), &PatchRequest{
+		ResourceID: "foo",
+		PayloadSource: strings.NewReader(`
+		{
+			"schemas": ["urn:ietf:params:scim:api:messages:2.0:PatchOp"],
+			"Operations": [{"op": "replace", "path": "userName", "value": "bar"}]
+		}
+		`),
+		DryRun: true,
+	})
+	require.Nil(s.T(), err)
+	assert.True(s.T(), resp.Patched)
+	assert.True(s.T(), resp.DryRun)
+	assert.Equal(s.T(), "bar", resp.Resource.Navigator().Dot("userName").Current().Raw())
+
+	stored, err := database.Get(context.TODO(), "foo", nil)
+	require.Nil(s.T(), err)
+	assert.Equal(s.T(), "foo", stored.Navigator().Dot("userName").Current().Raw())
+	assert.Equal(s.T(), resp.Ref.MetaVersionOrEmpty(), stored.MetaVersionOrEmpty())
+}
+
+func (s *PatchServiceTestSuite) TestDoNotSupported() {
+	database := db.Memory()
+	require.Nil(s.T(), database.Insert(context.TODO(), s.resourceOf(s.T(), map[string]interface{}{
+		"schemas":  []interface{}{"urn:ietf:params:scim:schemas:core:2.0:User"},
+		"id":       "foo",
+		"userName": "foo",
+	})))
+
+	_, err := PatchService(new(spec.ServiceProviderConfig), database, nil, nil).Do(context.TODO(), &PatchRequest{
+		ResourceID: "foo",
+		PayloadSource: strings.NewReader(`
+		{
+			"schemas": ["urn:ietf:params:scim:api:messages:2.0:PatchOp"],
+			"Operations": [{"op": "add", "path": "userName", "value": "bar"}]
+		}
+		`),
+	})
+	assert.True(s.T(), errors.Is(err, spec.ErrNotImplemented))
+
+	stored, err := database.Get(context.TODO(), "foo", nil)
+	require.Nil(s.T(), err)
+	assert.Equal(s.T(), "foo", stored.Navigator().Dot("userName").Current().Raw())
+}
+
+func (s *PatchServiceTestSuite) compactAddresses(resource *prop.Resource) []interface{} {
+	var addresses []interface{}
+	_ = resource.Navigator().Dot("addresses").Current().ForEachChild(func(index int, child prop.Property) error {
+		addresses = append(addresses, map[string]interface{}{
+			"type":     prop.Navigate(child).Dot("type").Current().Raw(),
+			"locality": prop.Navigate(child).Dot("locality").Current().Raw(),
+		})
+		return nil
+	})
+	return addresses
+}
+
 func (s *PatchServiceTestSuite) resourceOf(t *testing.T, data interface{}) *prop.Resource {
 	r := prop.NewResource(s.resourceType)
 	require.Nil(t, r.Navigator().Replace(data).Error())
@@ -0,0 +1,34 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"github.com/imulab/go-scim/pkg/v2/prop"
+	"github.com/imulab/go-scim/pkg/v2/spec"
+	"io"
+	"io/ioutil"
+)
+
+// Reads the payload from the source. Errors of the source which are SCIM errors, i.e. of spec.ErrPayloadTooLarge from a
+// request body whose size is limited, are returned as they are; others are reported as errors of spec.ErrInternal.
+func readPayload(source io.Reader) ([]byte, error) {
+	raw, err := ioutil.ReadAll(source)
+	if err != nil {
+		var scimErr *spec.Error
+		if errors.As(err, &scimErr) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("%w: failed to read request body", spec.ErrInternal)
+	}
+	return raw, nil
+}
+
+// Returns the resource given in place of a payload, i.e. decoded from protobuf, after checking that it is of the resource
+// type of the service. The resource is used, and modified, as is.
+func requestResource(resourceType *spec.ResourceType, resource *prop.Resource) (*prop.Resource, error) {
+	if resource.ResourceType().ID() != resourceType.ID() {
+		return nil, fmt.Errorf("%w: expect resource type '%s', got '%s'",
+			spec.ErrInvalidValue, resourceType.ID(), resource.ResourceType().ID())
+	}
+	return resource, nil
+}
@@ -11,7 +11,9 @@ import (
 )
 
 // QueryService returns a query resource service. This service is only capable of performing querying on a single type
-// of resource. This does not handle root query.
+// of resource. This does not handle root query. Filter, sort and pagination are checked against the features advertised
+// by the service provider config; a page count beyond filter.maxResults is reduced to it, while an unpaginated query
+// yielding more than maxResults resources is rejected with spec.ErrTooMany.
 func QueryService(config *spec.ServiceProviderConfig, database db.DB) Query {
 	return &queryService{
 		database: database,
@@ -19,6 +21,20 @@ func QueryService(config *spec.ServiceProviderConfig, database db.DB) Query {
 	}
 }
 
+// QueryServiceWithGuard returns a query resource service like QueryService, except that the guard is consulted with
+// the validated request before the database is queried, so that expensive queries can be rejected early (see
+// CostGuard).
+func QueryServiceWithGuard(config *spec.ServiceProviderConfig, database db.DB, guard QueryGuard) Query {
+	return &queryService{
+		database: database,
+		config:   config,
+		guard:    guard,
+	}
+}
+
+// Filter of query requests without one, which every resource meets.
+const defaultFilter = "id pr"
+
 type (
 	// Query resource service
 	Query interface {
@@ -29,13 +45,17 @@ type (
 		Filter     string
 		Sort       *crud.Sort
 		Pagination *crud.Pagination
+		Cursor     *crud.CursorPagination // cursor based alternative to Pagination, at most one can be specified
 		Projection *crud.Projection
+		// compiled form of Filter when the request is built by QueryRequestBuilder, only trusted while it renders to Filter
+		compiledFilter *expr.Expression
 	}
 	// Query resource response
 	QueryResponse struct {
 		TotalResults int
 		StartIndex   int
 		ItemsPerPage int
+		NextCursor   string // cursor to the next page, only set for cursor based pagination when more resources remain
 		Resources    []json.Serializable
 		Projection   *crud.Projection // included so that caller may render properly
 	}
@@ -44,6 +64,7 @@ type (
 type queryService struct {
 	database db.DB
 	config   *spec.ServiceProviderConfig
+	guard    QueryGuard
 }
 
 func (s *queryService) Do(ctx context.Context, req *QueryRequest) (resp *QueryResponse, err error) {
@@ -55,6 +76,12 @@ func (s *queryService) Do(ctx context.Context, req *QueryRequest) (resp *QueryRe
 		return
 	}
 
+	if s.guard != nil {
+		if err = s.guard.Check(ctx, req); err != nil {
+			return
+		}
+	}
+
 	resp = new(QueryResponse)
 	resp.Projection = req.Projection
 
@@ -62,22 +89,27 @@ func (s *queryService) Do(ctx context.Context, req *QueryRequest) (resp *QueryRe
 		resp.StartIndex = req.Pagination.StartIndex
 	}
 
-	if resp.TotalResults, err = s.database.Count(ctx, req.Filter); err != nil {
+	if resp.TotalResults, err = s.database.Count(ctx, countFilter(req.Filter)); err != nil {
+		return
+	}
+	if req.Cursor != nil {
+		err = s.queryCursor(ctx, req, resp)
 		return
 	}
 	if req.Pagination != nil && req.Pagination.Count == 0 {
 		return
 	}
 
-	if s.config.Filter.MaxResults > 0 {
-		if (req.Pagination == nil && resp.TotalResults > s.config.Filter.MaxResults) ||
-			(req.Pagination != nil && req.Pagination.Count > s.config.Filter.MaxResults) {
+	pagination := req.Pagination
+	if max := s.config.Filter.MaxResults; max > 0 {
+		if pagination == nil && resp.TotalResults > max {
 			err = spec.ErrTooMany
 			return
 		}
+		pagination = clampCount(pagination, max)
 	}
 
-	resources, err := s.database.Query(ctx, req.Filter, req.Sort, req.Pagination, req.Projection)
+	resources, err := s.database.Query(ctx, req.Filter, req.Sort, pagination, req.Projection)
 	if err != nil {
 		return
 	}
@@ -89,14 +121,62 @@ func (s *queryService) Do(ctx context.Context, req *QueryRequest) (resp *QueryRe
 	return
 }
 
+func (s *queryService) queryCursor(ctx context.Context, req *QueryRequest, resp *QueryResponse) error {
+	cursorDB, ok := s.database.(db.CursorDB)
+	if !ok {
+		return fmt.Errorf("%w: cursor pagination is not supported", spec.ErrInvalidSyntax)
+	}
+
+	// Honor the page size limits of the service provider, rather than rejecting the request.
+	pagination := *req.Cursor
+	if pagination.Count <= 0 {
+		pagination.Count = s.config.Pagination.DefaultPageSize
+	}
+	if max := s.config.Pagination.MaxPageSize; max > 0 && (pagination.Count <= 0 || pagination.Count > max) {
+		pagination.Count = max
+	}
+	if max := s.config.Filter.MaxResults; max > 0 && pagination.Count <= 0 && resp.TotalResults > max {
+		return spec.ErrTooMany
+	}
+
+	resources, next, err := cursorDB.QueryCursor(ctx, req.Filter, req.Sort, &pagination, req.Projection)
+	if err != nil {
+		return err
+	}
+	for _, r := range resources {
+		resp.Resources = append(resp.Resources, r)
+	}
+	resp.ItemsPerPage = len(resp.Resources)
+	resp.NextCursor = next
+	return nil
+}
+
 func (s *queryService) checkSupport(request *QueryRequest) error {
-	if !s.config.Filter.Supported {
+	if err := checkQuerySupport(s.config, request); err != nil {
+		return err
+	}
+
+	if request.Cursor != nil {
+		if !s.config.Pagination.Cursor {
+			return fmt.Errorf("%w: cursor pagination is not supported", spec.ErrInvalidSyntax)
+		}
+		if request.Pagination != nil {
+			return fmt.Errorf("%w: only one of startIndex and cursor may be used", spec.ErrInvalidSyntax)
+		}
+	}
+
+	return nil
+}
+
+// Checks the filter and sort of the request against the features advertised by the service provider.
+func checkQuerySupport(config *spec.ServiceProviderConfig, request *QueryRequest) error {
+	if !config.Filter.Supported {
 		if len(request.Filter) > 0 {
 			return fmt.Errorf("%w: filter is not supported", spec.ErrInvalidSyntax)
 		}
 	}
 
-	if !s.config.Sort.Supported {
+	if !config.Sort.Supported {
 		if request.Sort != nil && len(request.Sort.By) > 0 {
 			return fmt.Errorf("%w: sorting is not supported", spec.ErrInvalidSyntax)
 		}
@@ -105,10 +185,31 @@ func (s *queryService) checkSupport(request *QueryRequest) error {
 	return nil
 }
 
+// Returns the filter to count the resources matching the filter with, which is empty for the default filter of
+// requests without one (see QueryRequest.ValidateAndDefault), so that databases count all resources without evaluating
+// every one of them (see db.DB.Count).
+func countFilter(filter string) string {
+	if filter == defaultFilter {
+		return ""
+	}
+	return filter
+}
+
+// Returns the pagination, if any, with the count reduced to the maximum number of results, as the service provider may
+// return fewer results than requested. The pagination is copied rather than modified, as it belongs to the caller.
+func clampCount(pagination *crud.Pagination, max int) *crud.Pagination {
+	if pagination == nil || pagination.Count <= max {
+		return pagination
+	}
+	clamped := *pagination
+	clamped.Count = max
+	return &clamped
+}
+
 func (q *QueryRequest) ValidateAndDefault() error {
 	if len(q.Filter) == 0 {
-		q.Filter = "id pr"
-	} else {
+		q.Filter = defaultFilter
+	} else if q.compiledFilter == nil || q.compiledFilter.String() != q.Filter {
 		if _, err := expr.CompileFilter(q.Filter); err != nil {
 			return err
 		}
@@ -121,16 +222,16 @@ func (q *QueryRequest) ValidateAndDefault() error {
 	if q.Sort != nil {
 		if len(q.Sort.By) == 0 {
 			q.Sort.By = "id"
-		} else {
-			if _, err := expr.CompilePath(q.Sort.By); err != nil {
+		}
+		keys, err := q.Sort.Keys()
+		if err != nil {
+			return err
+		}
+		for _, key := range keys {
+			if _, err := expr.CompilePath(key.By); err != nil {
 				return err
 			}
 		}
-		switch q.Sort.Order {
-		case "", crud.SortAsc, crud.SortDesc:
-		default:
-			return fmt.Errorf("%w: invalid sortOrder", spec.ErrInvalidSyntax)
-		}
 	}
 	if q.Projection != nil {
 		if len(q.Projection.Attributes) > 0 && len(q.Projection.ExcludedAttributes) > 0 {
@@ -0,0 +1,140 @@
+package service
+
+import (
+	"fmt"
+	"github.com/imulab/go-scim/pkg/v2/crud"
+	"github.com/imulab/go-scim/pkg/v2/crud/expr"
+	"github.com/imulab/go-scim/pkg/v2/spec"
+	"strings"
+)
+
+// NewQueryRequest returns a new QueryRequestBuilder to build QueryRequest from already parsed structures, so that
+// internal callers (i.e. group sync, admin jobs) do not need to format query parameters as strings and have them parsed
+// again. For instance:
+//
+//	service.NewQueryRequest().
+//		Where(crud.Filter().Eq("userName", name)).
+//		SortBy(crud.SortKey{By: "meta.created", Order: crud.SortDesc}).
+//		Paginate(1, 10).
+//		Attributes("id", "userName").
+//		Build()
+//
+// Errors are deferred until Build, which validates the request in the same way as the query service does.
+func NewQueryRequest() *QueryRequestBuilder {
+	return &QueryRequestBuilder{req: new(QueryRequest)}
+}
+
+// QueryRequestBuilder builds QueryRequest. See NewQueryRequest.
+type QueryRequestBuilder struct {
+	req *QueryRequest
+	err error
+}
+
+// Filter sets the compiled filter of the request.
+func (b *QueryRequestBuilder) Filter(filter *expr.Expression) *QueryRequestBuilder {
+	if filter == nil || filter.IsPath() {
+		return b.fail(fmt.Errorf("%w: expects a compiled filter", spec.ErrInvalidFilter))
+	}
+	b.req.Filter = filter.String()
+	b.req.compiledFilter = filter
+	return b
+}
+
+// Where sets the filter of the request to the one built by the filter builder.
+func (b *QueryRequestBuilder) Where(filter *crud.FilterBuilder) *QueryRequestBuilder {
+	if filter == nil {
+		return b.fail(fmt.Errorf("%w: expects a filter", spec.ErrInvalidFilter))
+	}
+	root, _, err := filter.Build()
+	if err != nil {
+		return b.fail(err)
+	}
+	return b.Filter(root)
+}
+
+// SortBy sets the sort keys of the request, in the order of precedence.
+func (b *QueryRequestBuilder) SortBy(keys ...crud.SortKey) *QueryRequestBuilder {
+	if len(keys) == 0 {
+		b.req.Sort = nil
+		return b
+	}
+
+	var (
+		paths  = make([]string, 0, len(keys))
+		orders = make([]string, 0, len(keys))
+		mixed  = false
+	)
+	for _, key := range keys {
+		paths = append(paths, key.By)
+		orders = append(orders, string(key.Order))
+		mixed = mixed || key.Order != keys[0].Order
+	}
+
+	b.req.Sort = &crud.Sort{By: strings.Join(paths, ",")}
+	if mixed {
+		b.req.Sort.Order = crud.SortOrder(strings.Join(orders, ","))
+	} else {
+		b.req.Sort.Order = keys[0].Order
+	}
+	return b
+}
+
+// Sort sets the sort option of the request.
+func (b *QueryRequestBuilder) Sort(sort *crud.Sort) *QueryRequestBuilder {
+	b.req.Sort = sort
+	return b
+}
+
+// Paginate sets the 1-based start index and the page size of the request. It replaces any cursor based pagination.
+func (b *QueryRequestBuilder) Paginate(startIndex int, count int) *QueryRequestBuilder {
+	return b.Pagination(&crud.Pagination{StartIndex: startIndex, Count: count})
+}
+
+// Pagination sets the pagination option of the request. It replaces any cursor based pagination.
+func (b *QueryRequestBuilder) Pagination(pagination *crud.Pagination) *QueryRequestBuilder {
+	b.req.Pagination = pagination
+	b.req.Cursor = nil
+	return b
+}
+
+// Cursor sets the cursor pagination option of the request. It replaces any startIndex based pagination.
+func (b *QueryRequestBuilder) Cursor(cursor *crud.CursorPagination) *QueryRequestBuilder {
+	b.req.Cursor = cursor
+	b.req.Pagination = nil
+	return b
+}
+
+// Attributes sets the attributes to include in the response. It replaces any excluded attributes.
+func (b *QueryRequestBuilder) Attributes(paths ...string) *QueryRequestBuilder {
+	return b.Projection(&crud.Projection{Attributes: paths})
+}
+
+// ExcludedAttributes sets the attributes to exclude from the response. It replaces any included attributes.
+func (b *QueryRequestBuilder) ExcludedAttributes(paths ...string) *QueryRequestBuilder {
+	return b.Projection(&crud.Projection{ExcludedAttributes: paths})
+}
+
+// Projection sets the projection option of the request.
+func (b *QueryRequestBuilder) Projection(projection *crud.Projection) *QueryRequestBuilder {
+	b.req.Projection = projection
+	return b
+}
+
+// Build validates the request (see QueryRequest.ValidateAndDefault) and returns it, or returns the first error that
+// has occurred during the building process.
+func (b *QueryRequestBuilder) Build() (*QueryRequest, error) {
+	if b.err != nil {
+		return nil, b.err
+	}
+	if err := b.req.ValidateAndDefault(); err != nil {
+		return nil, err
+	}
+	return b.req, nil
+}
+
+func (b *QueryRequestBuilder) fail(err error) *QueryRequestBuilder {
+	if b.err == nil {
+		b.err = err
+	}
+	return b
+}
@@ -0,0 +1,106 @@
+package service
+
+import (
+	"errors"
+	"github.com/imulab/go-scim/pkg/v2/crud"
+	"github.com/imulab/go-scim/pkg/v2/crud/expr"
+	"github.com/imulab/go-scim/pkg/v2/spec"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestQueryRequestBuilder(t *testing.T) {
+	tests := []struct {
+		name    string
+		builder func(t *testing.T) *QueryRequestBuilder
+		expect  func(t *testing.T, req *QueryRequest, err error)
+	}{
+		{
+			name: "all options",
+			builder: func(t *testing.T) *QueryRequestBuilder {
+				return NewQueryRequest().
+					Where(crud.Filter().Eq("userName", "foo").Or(crud.Filter().Pr("emails"))).
+					SortBy(crud.SortKey{By: "meta.created", Order: crud.SortDesc}, crud.SortKey{By: "userName", Order: crud.SortDesc}).
+					Paginate(0, 10).
+					Attributes("id", "userName")
+			},
+			expect: func(t *testing.T, req *QueryRequest, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, `userName eq "foo" or emails pr`, req.Filter)
+				assert.Equal(t, &crud.Sort{By: "meta.created,userName", Order: crud.SortDesc}, req.Sort)
+				assert.Equal(t, &crud.Pagination{StartIndex: 1, Count: 10}, req.Pagination)
+				assert.Equal(t, []string{"id", "userName"}, req.Projection.Attributes)
+			},
+		},
+		{
+			name: "compiled filter",
+			builder: func(t *testing.T) *QueryRequestBuilder {
+				root, err := expr.CompileFilter(`not (active eq true)`)
+				require.Nil(t, err)
+				return NewQueryRequest().Filter(root).Cursor(&crud.CursorPagination{Count: 5})
+			},
+			expect: func(t *testing.T, req *QueryRequest, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, `not (active eq true)`, req.Filter)
+				assert.NotNil(t, req.compiledFilter)
+				assert.Nil(t, req.Pagination)
+				assert.Equal(t, 5, req.Cursor.Count)
+			},
+		},
+		{
+			name: "mixed sort orders",
+			builder: func(t *testing.T) *QueryRequestBuilder {
+				return NewQueryRequest().SortBy(crud.SortKey{By: "userName"}, crud.SortKey{By: "id", Order: crud.SortDesc})
+			},
+			expect: func(t *testing.T, req *QueryRequest, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, "id pr", req.Filter)
+				assert.Equal(t, &crud.Sort{By: "userName,id", Order: ",descending"}, req.Sort)
+				keys, err := req.Sort.Keys()
+				assert.Nil(t, err)
+				assert.Equal(t, []crud.SortKey{{By: "userName"}, {By: "id", Order: crud.SortDesc}}, keys)
+			},
+		},
+		{
+			name: "filter error is deferred",
+			builder: func(t *testing.T) *QueryRequestBuilder {
+				return NewQueryRequest().Where(crud.Filter().Eq("userName", struct{}{})).Paginate(1, 10)
+			},
+			expect: func(t *testing.T, req *QueryRequest, err error) {
+				assert.Nil(t, req)
+				assert.True(t, errors.Is(err, spec.ErrInvalidFilter))
+			},
+		},
+		{
+			name: "path is not a filter",
+			builder: func(t *testing.T) *QueryRequestBuilder {
+				root, err := expr.CompilePath("userName")
+				require.Nil(t, err)
+				return NewQueryRequest().Filter(root)
+			},
+			expect: func(t *testing.T, req *QueryRequest, err error) {
+				assert.True(t, errors.Is(err, spec.ErrInvalidFilter))
+			},
+		},
+		{
+			name: "invalid projection",
+			builder: func(t *testing.T) *QueryRequestBuilder {
+				return NewQueryRequest().Projection(&crud.Projection{
+					Attributes:         []string{"id"},
+					ExcludedAttributes: []string{"userName"},
+				})
+			},
+			expect: func(t *testing.T, req *QueryRequest, err error) {
+				assert.True(t, errors.Is(err, spec.ErrInvalidSyntax))
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req, err := test.builder(t).Build()
+			test.expect(t, req, err)
+		})
+	}
+}
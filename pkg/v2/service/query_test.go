@@ -3,6 +3,8 @@ package service
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"github.com/imulab/go-scim/pkg/v2/crud"
 	"github.com/imulab/go-scim/pkg/v2/db"
 	"github.com/imulab/go-scim/pkg/v2/prop"
@@ -13,6 +15,7 @@ import (
 	"io/ioutil"
 	"os"
 	"testing"
+	"time"
 )
 
 func TestQueryService(t *testing.T) {
@@ -171,6 +174,362 @@ func (s *QueryServiceTestSuite) TestDo() {
 	}
 }
 
+func (s *QueryServiceTestSuite) TestDoCursor() {
+	database := db.Memory()
+	for _, userData := range []interface{}{
+		map[string]interface{}{"id": "user003", "userName": "bob"},
+		map[string]interface{}{"id": "user001", "userName": "alice"},
+		map[string]interface{}{"id": "user005", "userName": "eve"},
+		map[string]interface{}{"id": "user002", "userName": "bob"},
+		map[string]interface{}{"id": "user004", "userName": "dan"},
+	} {
+		require.Nil(s.T(), database.Insert(context.TODO(), s.resourceOf(s.T(), userData)))
+	}
+	service := QueryService(s.config, database)
+
+	page := func(cursor string) *QueryResponse {
+		resp, err := service.Do(context.TODO(), &QueryRequest{
+			Filter: "userName pr",
+			Sort:   &crud.Sort{By: "userName"},
+			Cursor: &crud.CursorPagination{Cursor: cursor, Count: 2},
+		})
+		require.Nil(s.T(), err)
+		assert.Equal(s.T(), 0, resp.StartIndex)
+		return resp
+	}
+	ids := func(resp *QueryResponse) []string {
+		var ids []string
+		for _, r := range resp.Resources {
+			ids = append(ids, r.(*prop.Resource).IdOrEmpty())
+		}
+		return ids
+	}
+
+	first := page("")
+	assert.Equal(s.T(), 5, first.TotalResults)
+	assert.Equal(s.T(), []string{"user001", "user002"}, ids(first))
+	assert.NotEmpty(s.T(), first.NextCursor)
+
+	// deleting a resource already returned does not shift the next page
+	deleted, err := database.Get(context.TODO(), "user001", nil)
+	require.Nil(s.T(), err)
+	require.Nil(s.T(), database.Delete(context.TODO(), deleted))
+
+	second := page(first.NextCursor)
+	assert.Equal(s.T(), []string{"user003", "user004"}, ids(second))
+	assert.NotEmpty(s.T(), second.NextCursor)
+
+	last := page(second.NextCursor)
+	assert.Equal(s.T(), []string{"user005"}, ids(last))
+	assert.Empty(s.T(), last.NextCursor)
+
+	// cursor does not match the sort order
+	_, err = service.Do(context.TODO(), &QueryRequest{
+		Filter: "userName pr",
+		Sort:   &crud.Sort{By: "userName,id"},
+		Cursor: &crud.CursorPagination{Cursor: first.NextCursor, Count: 2},
+	})
+	assert.Equal(s.T(), spec.ErrInvalidCursor, errors.Unwrap(err))
+
+	// startIndex and cursor are mutually exclusive
+	_, err = service.Do(context.TODO(), &QueryRequest{
+		Filter:     "userName pr",
+		Pagination: &crud.Pagination{StartIndex: 1, Count: 2},
+		Cursor:     &crud.CursorPagination{Count: 2},
+	})
+	assert.Equal(s.T(), spec.ErrInvalidSyntax, errors.Unwrap(err))
+}
+
+func (s *QueryServiceTestSuite) TestDoWithCostGuard() {
+	database := db.Memory()
+	require.Nil(s.T(), database.Insert(context.TODO(), s.resourceOf(s.T(), map[string]interface{}{
+		"id":          "user001",
+		"userName":    "alice",
+		"displayName": "Alice",
+	})))
+
+	var observed *crud.Cost
+	service := QueryServiceWithGuard(s.config, database, &CostGuard{
+		ResourceType: s.resourceType,
+		RejectScan:   true,
+		MaxScore:     2,
+		Observe: func(ctx context.Context, req *QueryRequest, cost *crud.Cost) error {
+			observed = cost
+			return nil
+		},
+	})
+
+	resp, err := service.Do(context.TODO(), &QueryRequest{Filter: `userName eq "alice" or id eq "user002"`})
+	assert.Nil(s.T(), err)
+	assert.Equal(s.T(), 1, resp.TotalResults)
+	require.NotNil(s.T(), observed)
+	assert.Equal(s.T(), 2*crud.CostIndexed, observed.Score)
+
+	_, err = service.Do(context.TODO(), &QueryRequest{Filter: `displayName co "li"`})
+	assert.Equal(s.T(), spec.ErrInvalidFilter, errors.Unwrap(err))
+
+	_, err = service.Do(context.TODO(), &QueryRequest{Filter: `userName eq "a" or userName eq "b" or userName eq "c"`})
+	assert.Equal(s.T(), spec.ErrTooMany, errors.Unwrap(err))
+}
+
+func (s *QueryServiceTestSuite) TestDoWithServiceProviderLimits() {
+	database := db.Memory()
+	for _, id := range []string{"user001", "user002", "user003"} {
+		require.Nil(s.T(), database.Insert(context.TODO(), s.resourceOf(s.T(), map[string]interface{}{
+			"id":       id,
+			"userName": id,
+		})))
+	}
+
+	config := new(spec.ServiceProviderConfig)
+	config.Filter.MaxResults = 2
+	service := QueryService(config, database)
+
+	// count is reduced to maxResults, leaving the pagination of the request as it is
+	pagination := &crud.Pagination{StartIndex: 1, Count: 10}
+	resp, err := service.Do(context.TODO(), &QueryRequest{Pagination: pagination})
+	assert.Nil(s.T(), err)
+	assert.Equal(s.T(), 3, resp.TotalResults)
+	assert.Equal(s.T(), 2, resp.ItemsPerPage)
+	assert.Equal(s.T(), 10, pagination.Count)
+
+	// unpaginated results beyond maxResults
+	_, err = service.Do(context.TODO(), &QueryRequest{})
+	assert.Equal(s.T(), spec.ErrTooMany, err)
+
+	// filter and sort are not advertised
+	_, err = service.Do(context.TODO(), &QueryRequest{Filter: `userName eq "user001"`})
+	assert.Equal(s.T(), spec.ErrInvalidSyntax, errors.Unwrap(err))
+	_, err = service.Do(context.TODO(), &QueryRequest{Sort: &crud.Sort{By: "userName"}})
+	assert.Equal(s.T(), spec.ErrInvalidSyntax, errors.Unwrap(err))
+}
+
+func (s *QueryServiceTestSuite) TestDoCountOnly() {
+	database := &countOnlyDB{DB: db.Memory()}
+	for _, id := range []string{"user001", "user002", "user003"} {
+		require.Nil(s.T(), database.Insert(context.TODO(), s.resourceOf(s.T(), map[string]interface{}{
+			"id":       id,
+			"userName": id,
+		})))
+	}
+	service := QueryService(s.config, database)
+
+	resp, err := service.Do(context.TODO(), &QueryRequest{
+		Pagination: &crud.Pagination{StartIndex: 1, Count: 0},
+	})
+	assert.Nil(s.T(), err)
+	assert.Equal(s.T(), 3, resp.TotalResults)
+	assert.Empty(s.T(), resp.Resources)
+
+	resp, err = service.Do(context.TODO(), &QueryRequest{
+		Filter:     `userName eq "user001"`,
+		Pagination: &crud.Pagination{StartIndex: 1, Count: 0},
+	})
+	assert.Nil(s.T(), err)
+	assert.Equal(s.T(), 1, resp.TotalResults)
+
+	// requests without filter count all resources with the empty filter
+	assert.Equal(s.T(), []string{"", `userName eq "user001"`}, database.filters)
+}
+
+func (s *QueryServiceTestSuite) TestDoWithIndexes() {
+	indexed, err := db.MemoryWithIndexes(s.resourceType, "userName", "emails.value", "meta.created")
+	require.Nil(s.T(), err)
+	scanned := db.Memory()
+
+	for _, userData := range []interface{}{
+		map[string]interface{}{
+			"id":       "user001",
+			"userName": "Alice",
+			"emails":   []interface{}{map[string]interface{}{"value": "alice@foo.com"}, map[string]interface{}{"value": "a@bar.com"}},
+			"meta":     map[string]interface{}{"created": "2020-01-01T00:00:00Z"},
+		},
+		map[string]interface{}{
+			"id":       "user002",
+			"userName": "bob",
+			"emails":   []interface{}{map[string]interface{}{"value": "bob@foo.com"}},
+			"meta":     map[string]interface{}{"created": "2020-02-01T08:00:00+08:00"},
+		},
+		map[string]interface{}{
+			"id":       "user003",
+			"userName": "alex",
+			"meta":     map[string]interface{}{"created": "2020-03-01T00:00:00Z"},
+		},
+		map[string]interface{}{
+			"id":       "user004",
+			"userName": "carol",
+			"emails":   []interface{}{map[string]interface{}{"value": "carol@bar.com"}},
+		},
+	} {
+		require.Nil(s.T(), indexed.Insert(context.TODO(), s.resourceOf(s.T(), userData)))
+		require.Nil(s.T(), scanned.Insert(context.TODO(), s.resourceOf(s.T(), userData)))
+	}
+
+	idsOf := func(database db.DB, filter string) []string {
+		resp, err := QueryService(s.config, database).Do(context.TODO(), &QueryRequest{
+			Filter:     filter,
+			Sort:       &crud.Sort{By: "id"},
+			Pagination: &crud.Pagination{StartIndex: 1, Count: 10},
+		})
+		require.Nil(s.T(), err)
+		ids := make([]string, 0)
+		for _, r := range resp.Resources {
+			ids = append(ids, r.(*prop.Resource).IdOrEmpty())
+		}
+		return ids
+	}
+
+	for _, test := range []struct {
+		filter string
+		expect []string
+	}{
+		{filter: `userName eq "ALICE"`, expect: []string{"user001"}},
+		{filter: `userName sw "al"`, expect: []string{"user001", "user003"}},
+		{filter: `emails.value eq "bob@foo.com"`, expect: []string{"user002"}},
+		{filter: `emails.value sw "a"`, expect: []string{"user001"}},
+		{filter: `userName eq "bob" or emails.value eq "carol@bar.com"`, expect: []string{"user002", "user004"}},
+		{filter: `userName sw "a" and emails.value pr`, expect: []string{"user001"}},
+		{filter: `userName sw "a" and not (emails.value pr)`, expect: []string{"user003"}},
+		{filter: `meta.created eq "2020-02-01T00:00:00Z"`, expect: []string{"user002"}},
+		{filter: `meta.created gt "2020-01-01T00:00:00Z"`, expect: []string{"user002", "user003"}},
+		{filter: `meta.created le "2020-02-01T00:00:00Z"`, expect: []string{"user001", "user002"}},
+		{filter: `meta.created lt "2020-01-01T00:00:00Z"`, expect: []string{}},
+		{filter: `userName ew "b" or emails.value eq "alice@foo.com"`, expect: []string{"user001", "user002"}},
+	} {
+		s.T().Run(test.filter, func(t *testing.T) {
+			assert.Equal(t, test.expect, idsOf(indexed, test.filter))
+			assert.Equal(t, idsOf(scanned, test.filter), idsOf(indexed, test.filter))
+		})
+	}
+
+	// indexes are maintained upon writes
+	ref, err := indexed.Get(context.TODO(), "user002", nil)
+	require.Nil(s.T(), err)
+	require.Nil(s.T(), indexed.Replace(context.TODO(), ref, s.resourceOf(s.T(), map[string]interface{}{
+		"id":       "user002",
+		"userName": "robert",
+	})))
+	assert.Equal(s.T(), []string{}, idsOf(indexed, `userName eq "bob"`))
+	assert.Equal(s.T(), []string{"user002"}, idsOf(indexed, `userName eq "Robert"`))
+	assert.Equal(s.T(), []string{}, idsOf(indexed, `emails.value eq "bob@foo.com"`))
+
+	ref, err = indexed.Get(context.TODO(), "user001", nil)
+	require.Nil(s.T(), err)
+	require.Nil(s.T(), indexed.Delete(context.TODO(), ref))
+	assert.Equal(s.T(), []string{"user003"}, idsOf(indexed, `userName sw "al"`))
+
+	// changes rolled back are reverted in the indexes
+	assert.NotNil(s.T(), db.WithTx(context.TODO(), indexed, func(ctx context.Context) error {
+		if err := indexed.Insert(ctx, s.resourceOf(s.T(), map[string]interface{}{
+			"id":       "user005",
+			"userName": "alfred",
+		})); err != nil {
+			return err
+		}
+		return errors.New("rollback")
+	}))
+	assert.Equal(s.T(), []string{"user003"}, idsOf(indexed, `userName sw "al"`))
+
+	// indexes are managed at runtime
+	indexes := indexed.(db.IndexedDB)
+	assert.Equal(s.T(), []string{"emails.value", "meta.created", "userName"}, indexes.Indexes())
+	assert.Nil(s.T(), indexes.DropIndex("userName"))
+	assert.Nil(s.T(), indexes.CreateIndex("externalId"))
+	assert.Equal(s.T(), []string{"emails.value", "externalId", "meta.created"}, indexes.Indexes())
+	assert.Equal(s.T(), []string{"user003"}, idsOf(indexed, `userName sw "al"`))
+	assert.True(s.T(), errors.Is(indexes.CreateIndex("emails"), spec.ErrInvalidPath))
+	assert.True(s.T(), errors.Is(indexes.CreateIndex("foo"), spec.ErrInvalidPath))
+}
+
+func (s *QueryServiceTestSuite) TestDoWithExpiry() {
+	schema := new(spec.Schema)
+	require.Nil(s.T(), json.Unmarshal([]byte(`
+{
+  "id": "urn:imulab:scim:schemas:test:Invitation",
+  "name": "Invitation",
+  "attributes": [
+    {
+      "id": "urn:imulab:scim:schemas:test:Invitation:email",
+      "name": "email",
+      "type": "string",
+      "_index": 100,
+      "_path": "email"
+    },
+    {
+      "id": "urn:imulab:scim:schemas:test:Invitation:expiresAt",
+      "name": "expiresAt",
+      "type": "dateTime",
+      "_index": 101,
+      "_path": "expiresAt",
+      "_annotations": {
+        "@ExpiresAt": {"ttl": "1h"}
+      }
+    }
+  ]
+}
+`), schema))
+	spec.Schemas().Register(schema)
+	resourceType := new(spec.ResourceType)
+	require.Nil(s.T(), json.Unmarshal([]byte(`
+{
+  "id": "Invitation",
+  "name": "Invitation",
+  "endpoint": "/Invitations",
+  "schema": "urn:imulab:scim:schemas:test:Invitation"
+}
+`), resourceType))
+	crud.Register(resourceType)
+
+	_, err := db.Expiring(s.resourceType, db.Memory(), db.ExpiryOptions{})
+	assert.True(s.T(), errors.Is(err, spec.ErrInternal), "users do not expire")
+
+	stored := db.Memory()
+	database, err := db.Expiring(resourceType, stored, db.ExpiryOptions{LazyPurge: true, PurgeBatch: 1})
+	require.Nil(s.T(), err)
+	for _, data := range []map[string]interface{}{
+		{"id": "inv001", "email": "alice@foo.com", "expiresAt": "2020-01-01T00:00:00Z"},
+		{"id": "inv002", "email": "bob@foo.com", "expiresAt": "2020-01-02T00:00:00Z"},
+		{"id": "inv003", "email": "carol@foo.com", "expiresAt": time.Now().Add(time.Hour).UTC().Format(spec.ISO8601)},
+		{"id": "inv004", "email": "dave@foo.com"},
+	} {
+		r := prop.NewResource(resourceType)
+		require.Nil(s.T(), r.Navigator().Replace(data).Error())
+		require.Nil(s.T(), stored.Insert(context.TODO(), r))
+	}
+
+	idsOf := func(filter string) []string {
+		resp, err := QueryService(s.config, database).Do(context.TODO(), &QueryRequest{
+			Filter:     filter,
+			Sort:       &crud.Sort{By: "id"},
+			Pagination: &crud.Pagination{StartIndex: 1, Count: 10},
+		})
+		require.Nil(s.T(), err)
+		ids := make([]string, 0)
+		for _, r := range resp.Resources {
+			ids = append(ids, r.(*prop.Resource).IdOrEmpty())
+		}
+		return ids
+	}
+	assert.Equal(s.T(), []string{"inv003", "inv004"}, idsOf(""))
+	assert.Equal(s.T(), []string{"inv003"}, idsOf(`email sw "c" or email sw "a"`))
+	assert.Equal(s.T(), []string{"inv001", "inv002"}, idsOf(`expiresAt lt "2021-01-01T00:00:00Z"`), "queried explicitly")
+
+	_, err = GetService(database).Do(context.TODO(), &GetRequest{ResourceID: "inv001"})
+	assert.True(s.T(), errors.Is(err, spec.ErrNotFound))
+	_, err = stored.Get(context.TODO(), "inv001", nil)
+	assert.True(s.T(), errors.Is(err, spec.ErrNotFound), "purged lazily")
+
+	n, err := db.PurgeExpired(context.TODO(), database)
+	require.Nil(s.T(), err)
+	assert.Equal(s.T(), 1, n)
+	n, err = stored.Count(context.TODO(), "")
+	require.Nil(s.T(), err)
+	assert.Equal(s.T(), 2, n)
+
+	_, err = db.PurgeExpired(context.TODO(), stored)
+	assert.True(s.T(), errors.Is(err, spec.ErrInternal), "memory database does not expire resources")
+}
+
 func (s *QueryServiceTestSuite) resourceOf(t *testing.T, data interface{}) *prop.Resource {
 	r := prop.NewResource(s.resourceType)
 	require.Nil(t, r.Navigator().Replace(data).Error())
@@ -235,7 +594,27 @@ func (s *QueryServiceTestSuite) SetupSuite() {
   },
   "sort": {
     "supported": true
+  },
+  "pagination": {
+    "cursor": true,
+    "index": true
   }
 }
 `), s.config))
 }
+
+// countOnlyDB records the filters it counts resources with, and fails to query them, so that tests can check that
+// resources are counted without being read.
+type countOnlyDB struct {
+	db.DB
+	filters []string
+}
+
+func (d *countOnlyDB) Count(ctx context.Context, filter string) (int, error) {
+	d.filters = append(d.filters, filter)
+	return d.DB.Count(ctx, filter)
+}
+
+func (d *countOnlyDB) Query(_ context.Context, _ string, _ *crud.Sort, _ *crud.Pagination, _ *crud.Projection) ([]*prop.Resource, error) {
+	return nil, fmt.Errorf("%w: resources are not expected to be read", spec.ErrInternal)
+}
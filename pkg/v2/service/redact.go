@@ -0,0 +1,160 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	scimjson "github.com/imulab/go-scim/pkg/v2/json"
+	"github.com/imulab/go-scim/pkg/v2/prop"
+	"github.com/imulab/go-scim/pkg/v2/spec"
+	"strings"
+)
+
+// Redacted replaces the values of sensitive attributes in redacted payloads.
+const Redacted = "[REDACTED]"
+
+// NewRedactor returns a Redactor of the payloads of the resource type. The values of attributes that are never
+// returned or are writeOnly, i.e. password, are always redacted, as are the values of the attributes at the paths,
+// i.e. "emails.value" or "urn:ietf:params:scim:schemas:extension:enterprise:2.0:User:employeeNumber", which should
+// name the personally identifiable information of the resource type. An error of spec.ErrInvalidPath is returned for a
+// path that does not name an attribute of the resource type.
+func NewRedactor(resourceType *spec.ResourceType, paths ...string) (*Redactor, error) {
+	r := &Redactor{
+		resourceType: resourceType,
+		root:         resourceType.SuperAttribute(true),
+		attributes:   make([]*spec.Attribute, 0, len(paths)),
+	}
+	for _, path := range paths {
+		attr, err := (&PatchOperation{Path: path}).targetAttribute(resourceType, r.root)
+		if err != nil {
+			return nil, err
+		}
+		r.attributes = append(r.attributes, attr)
+	}
+	return r, nil
+}
+
+// Redactor masks the values of sensitive attributes in the payloads of a resource type, so that they can be logged.
+// Values are replaced with Redacted, whereas the attributes themselves are retained, so that it is still visible which
+// attributes were sent. Payloads that are not valid JSON are replaced as a whole.
+type Redactor struct {
+	resourceType *spec.ResourceType
+	root         *spec.Attribute
+	attributes   []*spec.Attribute
+}
+
+// Resource returns a copy of the JSON representation of a resource, i.e. the payload of a create or replace request,
+// with the values of the sensitive attributes redacted.
+func (r *Redactor) Resource(raw []byte) []byte {
+	var data interface{}
+	if err := unmarshal(raw, &data); err != nil {
+		return redacted()
+	}
+	return r.marshal(r.redact(data, r.root))
+}
+
+// Patch returns a copy of the JSON representation of a patch request, with the values of the operations redacted
+// where they target sensitive attributes, or contain them. The value of an operation whose path cannot be resolved is
+// redacted as a whole.
+func (r *Redactor) Patch(raw []byte) []byte {
+	var data map[string]interface{}
+	if err := unmarshal(raw, &data); err != nil {
+		return redacted()
+	}
+
+	for key, value := range data {
+		operations, ok := value.([]interface{})
+		if !ok || strings.ToLower(key) != "operations" {
+			continue
+		}
+		for _, each := range operations {
+			if operation, ok := each.(map[string]interface{}); ok {
+				r.redactOperation(operation)
+			}
+		}
+	}
+	return r.marshal(data)
+}
+
+// Serialize returns the JSON representation of the resource, i.e. as returned to clients, with the values of the
+// sensitive attributes redacted.
+func (r *Redactor) Serialize(resource *prop.Resource) []byte {
+	raw, err := scimjson.Serialize(resource)
+	if err != nil {
+		return redacted()
+	}
+	return r.Resource(raw)
+}
+
+func (r *Redactor) redactOperation(operation map[string]interface{}) {
+	var path, valueKey string
+	for key, value := range operation {
+		switch strings.ToLower(key) {
+		case "path":
+			path, _ = value.(string)
+		case "value":
+			valueKey = key
+		}
+	}
+	if len(valueKey) == 0 {
+		return
+	}
+
+	attr, err := (&PatchOperation{Path: path}).targetAttribute(r.resourceType, r.root)
+	if err != nil {
+		operation[valueKey] = Redacted
+		return
+	}
+	operation[valueKey] = r.redact(operation[valueKey], attr)
+}
+
+// Returns the value of the attribute, with the values of the sensitive attributes redacted.
+func (r *Redactor) redact(value interface{}, attr *spec.Attribute) interface{} {
+	if r.sensitive(attr) {
+		return Redacted
+	}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, child := range v {
+			if subAttr := attr.SubAttributeForName(key); subAttr != nil {
+				v[key] = r.redact(child, subAttr)
+			}
+		}
+	case []interface{}:
+		for i, elem := range v {
+			v[i] = r.redact(elem, attr)
+		}
+	}
+	return value
+}
+
+func (r *Redactor) sensitive(attr *spec.Attribute) bool {
+	if attr.Returned() == spec.ReturnedNever || attr.Mutability() == spec.MutabilityWriteOnly {
+		return true
+	}
+	for _, each := range r.attributes {
+		if attr.Equals(each) || attr.IsElementAttributeOf(each) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Redactor) marshal(data interface{}) []byte {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return redacted()
+	}
+	return raw
+}
+
+func unmarshal(raw []byte, v interface{}) error {
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.UseNumber()
+	return decoder.Decode(v)
+}
+
+func redacted() []byte {
+	raw, _ := json.Marshal(Redacted)
+	return raw
+}
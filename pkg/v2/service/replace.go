@@ -8,11 +8,15 @@ import (
 	"github.com/imulab/go-scim/pkg/v2/prop"
 	"github.com/imulab/go-scim/pkg/v2/service/filter"
 	"github.com/imulab/go-scim/pkg/v2/spec"
+	"github.com/imulab/go-scim/pkg/v2/trace"
 	"io"
-	"io/ioutil"
 )
 
-// ReplaceService returns a replace service.
+// ReplaceService returns a replace service. As per RFC 7644 section 3.5.1, the values of readOnly attributes are
+// carried over from the stored resource, regardless of the replacement, and so are those of immutable attributes the
+// replacement omits, whereas replacing a value of an immutable attribute fails with an error of spec.ErrMutability.
+// Dry run requests are filtered, hence validated, like others, but the replacement is not saved, and the
+// OnAfterReplace hook is not called.
 func ReplaceService(
 	config *spec.ServiceProviderConfig,
 	resourceType *spec.ResourceType,
@@ -27,6 +31,24 @@ func ReplaceService(
 	}
 }
 
+// ReplaceServiceWithHooks returns a replace resource service like ReplaceService, except that the OnBeforeReplace and
+// OnAfterReplace hooks are called around the replacement (see Hooks).
+func ReplaceServiceWithHooks(
+	config *spec.ServiceProviderConfig,
+	resourceType *spec.ResourceType,
+	database db.DB,
+	filters []filter.ByResource,
+	hooks *Hooks,
+) Replace {
+	return &replaceService{
+		resourceType: resourceType,
+		filters:      filters,
+		database:     database,
+		config:       config,
+		hooks:        hooks,
+	}
+}
+
 type (
 	// Replace resource service
 	Replace interface {
@@ -36,13 +58,17 @@ type (
 	ReplaceRequest struct {
 		ResourceID    string                             // id of the resource to be replaced
 		PayloadSource io.Reader                          // source to read replacement payload from
+		Resource      *prop.Resource                     // replacement instead of the payload, i.e. decoded from protobuf
 		MatchCriteria func(resource *prop.Resource) bool // extra criteria to meet in order to be replaced
+		Version       string                             // version the resource has to be of, i.e. from If-Match, or db.AnyVersion
+		DryRun        bool                               // only validate the replacement, running the filters, but do not persist it
 	}
 	// Replace resource response
 	ReplaceResponse struct {
 		Replaced bool           // true if resource was replaced; false if resource was not replaced, but has no error
 		Ref      *prop.Resource // reference resource (before state)
 		Resource *prop.Resource // replaced resource (after state)
+		DryRun   bool           // true if the resource would have been replaced, but was not persisted
 	}
 )
 
@@ -51,6 +77,7 @@ type replaceService struct {
 	filters      []filter.ByResource
 	database     db.DB
 	config       *spec.ServiceProviderConfig
+	hooks        *Hooks
 }
 
 func (s *replaceService) Do(ctx context.Context, req *ReplaceRequest) (resp *ReplaceResponse, err error) {
@@ -66,11 +93,25 @@ func (s *replaceService) Do(ctx context.Context, req *ReplaceRequest) (resp *Rep
 		}
 	}
 
-	replacement, err := s.parseResource(req)
+	if s.config.ETag.Supported && len(req.Version) > 0 {
+		if err = db.MatchVersion(ref, req.Version); err != nil {
+			return
+		}
+	}
+
+	replacement, err := s.parseResource(ctx, req)
 	if err != nil {
 		return
 	}
 
+	if err = preserveMutability(replacement.Navigator(), ref.RootProperty()); err != nil {
+		return
+	}
+
+	if err = s.hooks.beforeReplace(ctx, replacement, ref); err != nil {
+		return
+	}
+
 	for _, f := range s.filters {
 		if err = f.FilterRef(ctx, replacement, ref); err != nil {
 			return
@@ -89,7 +130,22 @@ func (s *replaceService) Do(ctx context.Context, req *ReplaceRequest) (resp *Rep
 		return
 	}
 
-	if err = s.database.Replace(ctx, ref, replacement); err != nil {
+	if req.DryRun {
+		resp = &ReplaceResponse{
+			Replaced: true,
+			Resource: replacement,
+			Ref:      ref,
+			DryRun:   true,
+		}
+		return
+	}
+
+	if s.config.ETag.Supported && len(req.Version) > 0 {
+		err = db.ReplaceIfMatch(ctx, s.database, ref, replacement, req.Version)
+	} else {
+		err = s.database.Replace(ctx, ref, replacement)
+	}
+	if err != nil {
 		return
 	}
 
@@ -98,23 +154,68 @@ func (s *replaceService) Do(ctx context.Context, req *ReplaceRequest) (resp *Rep
 		Resource: replacement,
 		Ref:      ref,
 	}
+	err = s.hooks.afterReplace(ctx, replacement, ref)
 	return
 }
 
-func (s *replaceService) parseResource(req *ReplaceRequest) (*prop.Resource, error) {
+func (s *replaceService) parseResource(ctx context.Context, req *ReplaceRequest) (*prop.Resource, error) {
+	if req != nil && req.Resource != nil {
+		return requestResource(s.resourceType, req.Resource)
+	}
 	if req == nil || req.PayloadSource == nil {
 		return nil, fmt.Errorf("%w: no payload for replace service", spec.ErrInternal)
 	}
 
-	raw, err := ioutil.ReadAll(req.PayloadSource)
+	raw, err := readPayload(req.PayloadSource)
 	if err != nil {
-		return nil, fmt.Errorf("%w: failed to read request body", spec.ErrInternal)
+		return nil, err
 	}
 
 	resource := prop.NewResource(s.resourceType)
-	if err := json.Deserialize(raw, resource); err != nil {
+	_, end := trace.Start(ctx, trace.Deserialize)
+	err = json.Deserialize(raw, resource)
+	end(err)
+	if err != nil {
 		return nil, err
 	}
 
 	return resource, nil
 }
+
+// Carries over the values of readOnly attributes, and of immutable attributes omitted by the replacement, from the
+// reference, as PUT shall not modify them (RFC 7644 section 3.5.1). An error of spec.ErrMutability is returned when the
+// replacement modifies the value of an immutable attribute. Singular complex attributes are descended into, whereas
+// multiValued attributes are carried over or compared as a whole.
+func preserveMutability(nav prop.Navigator, ref prop.Property) error {
+	return ref.ForEachChild(func(_ int, refChild prop.Property) error {
+		attr := refChild.Attribute()
+		if nav.Dot(attr.Name()).HasError() {
+			return nav.Error()
+		}
+		defer nav.Retract()
+
+		switch attr.Mutability() {
+		case spec.MutabilityReadOnly:
+			if refChild.IsUnassigned() {
+				return nav.Delete().Error()
+			}
+			return nav.Replace(refChild.Raw()).Error()
+		case spec.MutabilityImmutable:
+			if refChild.IsUnassigned() {
+				return nil
+			}
+			if nav.Current().IsUnassigned() {
+				return nav.Replace(refChild.Raw()).Error()
+			}
+			if !nav.Current().Matches(refChild) {
+				return fmt.Errorf("%w: '%s' is immutable", spec.ErrMutability, attr.Path())
+			}
+			return nil
+		}
+
+		if !attr.MultiValued() && attr.Type() == spec.TypeComplex {
+			return preserveMutability(nav, refChild)
+		}
+		return nil
+	})
+}
@@ -127,6 +127,58 @@ func (s *ReplaceServiceTestSuite) TestDo() {
 				assert.False(t, resp.Replaced)
 			},
 		},
+		{
+			name: "replace carries over readOnly attributes",
+			setup: func(t *testing.T) Replace {
+				database := db.Memory()
+				err := database.Insert(context.TODO(), s.resourceOf(t, map[string]interface{}{
+					"schemas":  []interface{}{"urn:ietf:params:scim:schemas:core:2.0:User"},
+					"id":       "foo",
+					"userName": "foo",
+					"groups": []interface{}{
+						map[string]interface{}{
+							"value": "g1",
+						},
+					},
+				}))
+				require.Nil(t, err)
+				return ReplaceService(&spec.ServiceProviderConfig{}, s.resourceType, database, []filter.ByResource{
+					filter.ByPropertyToByResource(filter.ValidationFilter(database)),
+					filter.MetaFilter(),
+				})
+			},
+			getRequest: func() *ReplaceRequest {
+				return &ReplaceRequest{
+					ResourceID: "foo",
+					PayloadSource: strings.NewReader(`
+{
+  "schemas": [
+    "urn:ietf:params:scim:schemas:core:2.0:User"
+  ],
+  "userName": "bar",
+  "emails": [
+    {
+      "value": "foo@bar.com"
+    }
+  ],
+  "groups": [
+    {
+      "value": "g2"
+    }
+  ]
+}
+`),
+				}
+			},
+			expect: func(t *testing.T, resp *ReplaceResponse, err error) {
+				assert.Nil(t, err)
+				assert.True(t, resp.Replaced)
+				assert.Equal(t, "foo", resp.Resource.IdOrEmpty())
+				assert.Equal(t, "bar", resp.Resource.Navigator().Dot("userName").Current().Raw())
+				assert.Equal(t, 1, resp.Resource.Navigator().Dot("groups").Current().CountChildren())
+				assert.Equal(t, "g1", resp.Resource.Navigator().Dot("groups").At(0).Dot("value").Current().Raw())
+			},
+		},
 		{
 			name: "replace with an invalid resource",
 			setup: func(t *testing.T) Replace {
@@ -190,6 +242,34 @@ func (s *ReplaceServiceTestSuite) resourceOf(t *testing.T, data interface{}) *pr
 	return r
 }
 
+func (s *ReplaceServiceTestSuite) TestDoDryRun() {
+	database := db.Memory()
+	require.Nil(s.T(), database.Insert(context.TODO(), s.resourceOf(s.T(), map[string]interface{}{
+		"schemas":  []interface{}{"urn:ietf:params:scim:schemas:core:2.0:User"},
+		"id":       "foo",
+		"userName": "foo",
+	})))
+	service := ReplaceService(&spec.ServiceProviderConfig{}, s.resourceType, database, []filter.ByResource{
+		filter.ByPropertyToByResource(filter.ReadOnlyFilter()),
+		filter.ByPropertyToByResource(filter.ValidationFilter(database)),
+		filter.MetaFilter(),
+	})
+
+	resp, err := service.Do(context.TODO(), &ReplaceRequest{
+		ResourceID:    "foo",
+		PayloadSource: strings.NewReader(`{"schemas": ["urn:ietf:params:scim:schemas:core:2.0:User"], "id": "foo", "userName": "bar", "emails": [{"value": "foo@bar.com"}]}`),
+		DryRun:        true,
+	})
+	require.Nil(s.T(), err)
+	assert.True(s.T(), resp.Replaced)
+	assert.True(s.T(), resp.DryRun)
+	assert.Equal(s.T(), "bar", resp.Resource.Navigator().Dot("userName").Current().Raw())
+
+	stored, err := database.Get(context.TODO(), "foo", nil)
+	require.Nil(s.T(), err)
+	assert.Equal(s.T(), "foo", stored.Navigator().Dot("userName").Current().Raw())
+}
+
 func (s *ReplaceServiceTestSuite) SetupSuite() {
 	for _, each := range []struct {
 		filepath  string
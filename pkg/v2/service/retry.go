@@ -0,0 +1,111 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"github.com/imulab/go-scim/pkg/v2/spec"
+	"math/rand"
+	"time"
+)
+
+// ConflictRetry tunes RetryPatchOnConflict and RetryMembershipOnConflict. Zero values use the defaults.
+type ConflictRetry struct {
+	// Attempts is the maximum number of attempts to patch the resource. Defaults to 3.
+	Attempts int
+	// Backoff is the maximum delay before the second attempt, doubled for every attempt after. The actual delay is
+	// random up to the maximum, so that concurrent requests retrying at once do not conflict again. Defaults to 10
+	// milliseconds.
+	Backoff time.Duration
+}
+
+// RetryPatchOnConflict returns a patch resource service that retries the patch service when it fails with an error of
+// spec.ErrConflict because the resource was concurrently modified between being read and being replaced (see
+// db.DB.Replace). Every attempt reads the resource again and re-applies the patch operations to its current state,
+// which is what clients would do upon the error, so that they only see it once the attempts are exhausted.
+//
+// Requests with MatchCriteria or Version, i.e. from an If-Match header, are not retried, since the client asked for the
+// patch to apply to the version it read only, and shall read the resource again itself.
+func RetryPatchOnConflict(service Patch, retry ConflictRetry) Patch {
+	return &retryPatchService{service: service, retry: retry.withDefaults()}
+}
+
+// RetryMembershipOnConflict returns a membership service that retries the membership service upon conflicts, like
+// RetryPatchOnConflict does, so that members can be added to and removed from large groups while they are modified
+// concurrently.
+func RetryMembershipOnConflict(service Membership, retry ConflictRetry) Membership {
+	return &retryMembershipService{service: service, retry: retry.withDefaults()}
+}
+
+type retryPatchService struct {
+	service Patch
+	retry   ConflictRetry
+}
+
+func (s *retryPatchService) Do(ctx context.Context, req *PatchRequest) (resp *PatchResponse, err error) {
+	if req == nil || req.PayloadSource == nil || req.MatchCriteria != nil || len(req.Version) > 0 || req.DryRun {
+		return s.service.Do(ctx, req)
+	}
+
+	// the payload is read again by every attempt
+	raw, err := readPayload(req.PayloadSource)
+	if err != nil {
+		return
+	}
+
+	err = s.retry.do(ctx, func() (err error) {
+		retried := *req
+		retried.PayloadSource = bytes.NewReader(raw)
+		resp, err = s.service.Do(ctx, &retried)
+		return
+	})
+	return
+}
+
+type retryMembershipService struct {
+	service Membership
+	retry   ConflictRetry
+}
+
+func (s *retryMembershipService) Do(ctx context.Context, req *MembershipRequest) (resp *PatchResponse, err error) {
+	if req == nil || req.MatchCriteria != nil || len(req.Version) > 0 || req.DryRun {
+		return s.service.Do(ctx, req)
+	}
+
+	err = s.retry.do(ctx, func() (err error) {
+		resp, err = s.service.Do(ctx, req)
+		return
+	})
+	return
+}
+
+func (r ConflictRetry) withDefaults() ConflictRetry {
+	if r.Attempts < 1 {
+		r.Attempts = 3
+	}
+	if r.Backoff <= 0 {
+		r.Backoff = 10 * time.Millisecond
+	}
+	return r
+}
+
+// Calls the call function until it does not fail with an error of spec.ErrConflict, the attempts are exhausted, or
+// the context is done, and returns the error of the last call.
+func (r ConflictRetry) do(ctx context.Context, call func() error) error {
+	backoff := r.Backoff
+	for attempt := 1; ; attempt++ {
+		err := call()
+		if err == nil || !errors.Is(err, spec.ErrConflict) || attempt == r.Attempts {
+			return err
+		}
+
+		timer := time.NewTimer(time.Duration(rand.Int63n(int64(backoff)) + 1))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+		backoff *= 2
+	}
+}
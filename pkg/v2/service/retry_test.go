@@ -0,0 +1,194 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/imulab/go-scim/pkg/v2/crud"
+	"github.com/imulab/go-scim/pkg/v2/db"
+	"github.com/imulab/go-scim/pkg/v2/prop"
+	"github.com/imulab/go-scim/pkg/v2/service/filter"
+	"github.com/imulab/go-scim/pkg/v2/spec"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRetryPatchOnConflict(t *testing.T) {
+	s := new(RetryPatchOnConflictTestSuite)
+	suite.Run(t, s)
+}
+
+type RetryPatchOnConflictTestSuite struct {
+	suite.Suite
+	config       *spec.ServiceProviderConfig
+	resourceType *spec.ResourceType
+}
+
+func (s *RetryPatchOnConflictTestSuite) TestRetry() {
+	const payload = `
+{
+  "schemas": ["urn:ietf:params:scim:api:messages:2.0:PatchOp"],
+  "Operations": [{"op": "add", "path": "emails", "value": [{"value": "foo@example.com"}]}]
+}`
+
+	tests := []struct {
+		name      string
+		conflicts int
+		criteria  func(resource *prop.Resource) bool
+		expect    func(t *testing.T, database *conflictingDB, resp *PatchResponse, err error)
+	}{
+		{
+			name:      "patch is re-applied to the concurrently modified resource",
+			conflicts: 2,
+			expect: func(t *testing.T, database *conflictingDB, resp *PatchResponse, err error) {
+				require.Nil(t, err)
+				assert.True(t, resp.Patched)
+				assert.Equal(t, 3, database.replaced)
+				// the concurrent modification is retained
+				assert.Equal(t, "concurrent 2", resp.Resource.Navigator().Dot("displayName").Current().Raw())
+				assert.Equal(t, 1, resp.Resource.Navigator().Dot("emails").Current().CountChildren())
+			},
+		},
+		{
+			name:      "conflict is returned when the attempts are exhausted",
+			conflicts: 5,
+			expect: func(t *testing.T, database *conflictingDB, resp *PatchResponse, err error) {
+				assert.True(t, errors.Is(err, spec.ErrConflict))
+				assert.Equal(t, 3, database.replaced)
+			},
+		},
+		{
+			name:      "request with pre condition is not retried",
+			conflicts: 1,
+			criteria: func(resource *prop.Resource) bool {
+				return true
+			},
+			expect: func(t *testing.T, database *conflictingDB, resp *PatchResponse, err error) {
+				assert.True(t, errors.Is(err, spec.ErrConflict))
+				assert.Equal(t, 1, database.replaced)
+			},
+		},
+	}
+
+	for _, test := range tests {
+		s.T().Run(test.name, func(t *testing.T) {
+			resource := prop.NewResource(s.resourceType)
+			require.False(t, resource.Navigator().Replace(map[string]interface{}{
+				"schemas":  []interface{}{"urn:ietf:params:scim:schemas:core:2.0:User"},
+				"id":       "foo",
+				"userName": "foo",
+				"meta": map[string]interface{}{
+					"version": "W/\"1\"",
+				},
+			}).HasError())
+			database := &conflictingDB{DB: db.Memory(), conflicts: test.conflicts}
+			require.Nil(t, database.DB.Insert(context.Background(), resource))
+
+			patch := RetryPatchOnConflict(PatchService(s.config, database, nil, []filter.ByResource{
+				filter.MetaFilter(),
+			}), ConflictRetry{Backoff: time.Millisecond})
+			resp, err := patch.Do(context.Background(), &PatchRequest{
+				ResourceID:    "foo",
+				MatchCriteria: test.criteria,
+				PayloadSource: strings.NewReader(payload),
+			})
+			test.expect(t, database, resp, err)
+		})
+	}
+}
+
+// conflictingDB modifies the resource concurrently to the first attempts to replace it.
+type conflictingDB struct {
+	db.DB
+	conflicts int
+	replaced  int
+}
+
+func (d *conflictingDB) Replace(ctx context.Context, ref *prop.Resource, replacement *prop.Resource) error {
+	d.replaced++
+	if d.replaced <= d.conflicts {
+		concurrent := ref.Clone()
+		if err := concurrent.Navigator().Replace(map[string]interface{}{
+			"displayName": fmt.Sprintf("concurrent %d", d.replaced),
+		}).Error(); err != nil {
+			return err
+		}
+		if err := filter.MetaFilter().FilterRef(ctx, concurrent, ref); err != nil {
+			return err
+		}
+		if err := d.DB.Replace(ctx, ref, concurrent); err != nil {
+			return err
+		}
+	}
+	return d.DB.Replace(ctx, ref, replacement)
+}
+
+func (s *RetryPatchOnConflictTestSuite) SetupSuite() {
+	for _, each := range []struct {
+		filepath  string
+		structure interface{}
+		post      func(parsed interface{})
+	}{
+		{
+			filepath:  "../../../public/schemas/core_schema.json",
+			structure: new(spec.Schema),
+			post: func(parsed interface{}) {
+				spec.Schemas().Register(parsed.(*spec.Schema))
+			},
+		},
+		{
+			filepath:  "../../../public/schemas/user_schema.json",
+			structure: new(spec.Schema),
+			post: func(parsed interface{}) {
+				spec.Schemas().Register(parsed.(*spec.Schema))
+			},
+		},
+		{
+			filepath:  "../../../public/schemas/user_enterprise_extension_schema.json",
+			structure: new(spec.Schema),
+			post: func(parsed interface{}) {
+				spec.Schemas().Register(parsed.(*spec.Schema))
+			},
+		},
+		{
+			filepath:  "../../../public/resource_types/user_resource_type.json",
+			structure: new(spec.ResourceType),
+			post: func(parsed interface{}) {
+				s.resourceType = parsed.(*spec.ResourceType)
+				crud.Register(s.resourceType)
+			},
+		},
+	} {
+		f, err := os.Open(each.filepath)
+		require.Nil(s.T(), err)
+
+		raw, err := ioutil.ReadAll(f)
+		require.Nil(s.T(), err)
+
+		err = json.Unmarshal(raw, each.structure)
+		require.Nil(s.T(), err)
+
+		if each.post != nil {
+			each.post(each.structure)
+		}
+	}
+
+	s.config = new(spec.ServiceProviderConfig)
+	require.Nil(s.T(), json.Unmarshal([]byte(`
+{
+  "patch": {
+    "supported": true
+  },
+  "etag": {
+    "supported": true
+  }
+}
+`), s.config))
+}
@@ -0,0 +1,242 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"github.com/imulab/go-scim/pkg/v2/crud"
+	scimjson "github.com/imulab/go-scim/pkg/v2/json"
+	"github.com/imulab/go-scim/pkg/v2/prop"
+	"github.com/imulab/go-scim/pkg/v2/spec"
+	"io"
+)
+
+// SearchRequestSchema is the schema of the search request payload, see RFC7644 section 3.4.3.
+const SearchRequestSchema = "urn:ietf:params:scim:api:messages:2.0:SearchRequest"
+
+// SearchService returns a search service that queries resources with a SearchRequest payload sent over HTTP POST
+// (i.e. POST /Users/.search), for clients that would rather not put filters in the query string. The payload is
+// validated and converted to a QueryRequest, which is carried out by the query service. For the server root endpoint
+// (POST /.search), use a query service returned by RootQueryService.
+func SearchService(query Query) Search {
+	return &searchService{query: query}
+}
+
+type (
+	// Search resource service
+	Search interface {
+		Do(ctx context.Context, req *SearchRequest) (resp *QueryResponse, err error)
+	}
+	// Search resource request
+	SearchRequest struct {
+		PayloadSource io.Reader
+	}
+	// SearchPayload is the parsed payload of a search request
+	SearchPayload struct {
+		Schemas            []string `json:"schemas"`
+		Attributes         []string `json:"attributes"`
+		ExcludedAttributes []string `json:"excludedAttributes"`
+		Filter             string   `json:"filter"`
+		SortBy             string   `json:"sortBy"`
+		SortOrder          string   `json:"sortOrder"`
+		StartIndex         int      `json:"startIndex"`
+		Count              int      `json:"count"`
+		Cursor             *string  `json:"cursor"`
+	}
+)
+
+type searchService struct {
+	query Query
+}
+
+func (s *searchService) Do(ctx context.Context, req *SearchRequest) (resp *QueryResponse, err error) {
+	if req == nil || req.PayloadSource == nil {
+		err = fmt.Errorf("%w: missing search request payload", spec.ErrInvalidSyntax)
+		return
+	}
+
+	payload, err := ParseSearchPayload(req.PayloadSource)
+	if err != nil {
+		return
+	}
+
+	qr, err := payload.QueryRequest()
+	if err != nil {
+		return
+	}
+
+	return s.query.Do(ctx, qr)
+}
+
+// ParseSearchPayload reads and parses the search request payload from the reader. The payload is not validated.
+func ParseSearchPayload(source io.Reader) (*SearchPayload, error) {
+	raw, err := readPayload(source)
+	if err != nil {
+		return nil, err
+	}
+
+	payload := new(SearchPayload)
+	if err := scimjson.Unmarshal(raw, payload); err != nil {
+		return nil, err
+	}
+	return payload, nil
+}
+
+// QueryRequest validates the payload, and returns the QueryRequest it describes. An error of spec.ErrInvalidSyntax is
+// returned if the payload does not have SearchRequestSchema as its only schema, or specifies both startIndex and cursor.
+func (p *SearchPayload) QueryRequest() (*QueryRequest, error) {
+	if len(p.Schemas) != 1 || p.Schemas[0] != SearchRequestSchema {
+		return nil, fmt.Errorf("%w: invalid schema for search request", spec.ErrInvalidSyntax)
+	}
+
+	qr := &QueryRequest{
+		Filter: p.Filter,
+	}
+
+	if len(p.SortBy) > 0 {
+		qr.Sort = &crud.Sort{
+			By:    p.SortBy,
+			Order: crud.SortOrder(p.SortOrder), // validate it later
+		}
+	}
+
+	if len(p.Attributes) > 0 || len(p.ExcludedAttributes) > 0 {
+		qr.Projection = &crud.Projection{
+			Attributes:         p.Attributes,
+			ExcludedAttributes: p.ExcludedAttributes,
+		}
+	}
+
+	if p.Cursor != nil {
+		if p.StartIndex > 0 {
+			return nil, fmt.Errorf("%w: only one of startIndex and cursor may be specified", spec.ErrInvalidSyntax)
+		}
+		qr.Cursor = &crud.CursorPagination{
+			Cursor: *p.Cursor,
+			Count:  p.Count,
+		}
+	} else if p.StartIndex > 0 || p.Count > 0 {
+		startIndex := p.StartIndex
+		if startIndex == 0 {
+			startIndex = 1
+		}
+		qr.Pagination = &crud.Pagination{
+			StartIndex: startIndex,
+			Count:      p.Count,
+		}
+	}
+
+	return qr, nil
+}
+
+// RootQueryService returns a query service for the server root endpoint, which queries resources of all types served
+// by the given single type query services (see QueryService). The request is carried out by every query service
+// without pagination, and the results are merged, sorted and paginated in memory. Hence, the number of resources that
+// may match a root query is bounded by the maxResults of the service provider, except for requests of the total only
+// (count=0), for which the query services count the resources instead. Resources are sorted by id when the
+// request does not specify a sort order. Cursor pagination is not supported.
+//
+// Filters on attributes that are not defined in some of the resource types are passed on to their query services as
+// is, and it is up to their databases to either treat the attributes as unassigned, or return an error.
+func RootQueryService(config *spec.ServiceProviderConfig, queries ...Query) Query {
+	return &rootQueryService{
+		config:  config,
+		queries: queries,
+	}
+}
+
+type rootQueryService struct {
+	config  *spec.ServiceProviderConfig
+	queries []Query
+}
+
+func (s *rootQueryService) Do(ctx context.Context, req *QueryRequest) (resp *QueryResponse, err error) {
+	if req.Cursor != nil {
+		err = fmt.Errorf("%w: cursor pagination is not supported for root query", spec.ErrInvalidSyntax)
+		return
+	}
+
+	if err = checkQuerySupport(s.config, req); err != nil {
+		return
+	}
+
+	if err = req.ValidateAndDefault(); err != nil {
+		return
+	}
+
+	if req.Pagination != nil && req.Pagination.Count == 0 {
+		return s.count(ctx, req)
+	}
+
+	resources := make([]*prop.Resource, 0)
+	for _, query := range s.queries {
+		// Projection is left to the rendering, so that sort attributes are always available.
+		sub, err := query.Do(ctx, &QueryRequest{
+			Filter:         req.Filter,
+			Sort:           req.Sort,
+			compiledFilter: req.compiledFilter,
+		})
+		if err != nil {
+			return nil, err
+		}
+		for _, each := range sub.Resources {
+			r, ok := each.(*prop.Resource)
+			if !ok {
+				return nil, fmt.Errorf("%w: root query expects resources from query services", spec.ErrInternal)
+			}
+			resources = append(resources, r)
+		}
+	}
+
+	resp = new(QueryResponse)
+	resp.Projection = req.Projection
+	resp.TotalResults = len(resources)
+
+	pagination := req.Pagination
+	if max := s.config.Filter.MaxResults; max > 0 {
+		if pagination == nil && resp.TotalResults > max {
+			err = spec.ErrTooMany
+			return
+		}
+		pagination = clampCount(pagination, max)
+	}
+
+	sort := crud.Sort{By: "id"}
+	if req.Sort != nil {
+		sort = *req.Sort
+	}
+	if err = sort.Sort(resources); err != nil {
+		return
+	}
+
+	if pagination != nil {
+		resp.StartIndex = pagination.StartIndex
+		resources = pagination.Page(resources)
+	}
+
+	for _, r := range resources {
+		resp.Resources = append(resp.Resources, r)
+	}
+	resp.ItemsPerPage = len(resp.Resources)
+	return
+}
+
+// Responds to the request for the total number of resources only, i.e. of count=0, with the sum of the totals of the
+// query services, which count the resources without reading them.
+func (s *rootQueryService) count(ctx context.Context, req *QueryRequest) (*QueryResponse, error) {
+	resp := &QueryResponse{
+		StartIndex: req.Pagination.StartIndex,
+		Projection: req.Projection,
+	}
+	for _, query := range s.queries {
+		sub, err := query.Do(ctx, &QueryRequest{
+			Filter:         req.Filter,
+			Pagination:     &crud.Pagination{StartIndex: 1},
+			compiledFilter: req.compiledFilter,
+		})
+		if err != nil {
+			return nil, err
+		}
+		resp.TotalResults += sub.TotalResults
+	}
+	return resp, nil
+}
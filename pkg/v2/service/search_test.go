@@ -0,0 +1,335 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/imulab/go-scim/pkg/v2/crud"
+	"github.com/imulab/go-scim/pkg/v2/db"
+	"github.com/imulab/go-scim/pkg/v2/prop"
+	"github.com/imulab/go-scim/pkg/v2/spec"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestSearchService(t *testing.T) {
+	s := new(SearchServiceTestSuite)
+	suite.Run(t, s)
+}
+
+type SearchServiceTestSuite struct {
+	suite.Suite
+	config            *spec.ServiceProviderConfig
+	userResourceType  *spec.ResourceType
+	groupResourceType *spec.ResourceType
+	userDatabase      db.DB
+	groupDatabase     db.DB
+}
+
+func (s *SearchServiceTestSuite) TestDo() {
+	tests := []struct {
+		name    string
+		payload string
+		expect  func(t *testing.T, resp *QueryResponse, err error)
+	}{
+		{
+			name: "search with filter, sort and pagination",
+			payload: `
+{
+  "schemas": ["urn:ietf:params:scim:api:messages:2.0:SearchRequest"],
+  "filter": "userName sw \"a\"",
+  "sortBy": "userName",
+  "sortOrder": "descending",
+  "startIndex": 1,
+  "count": 2
+}`,
+			expect: func(t *testing.T, resp *QueryResponse, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, 3, resp.TotalResults)
+				assert.Equal(t, 1, resp.StartIndex)
+				assert.Equal(t, 2, resp.ItemsPerPage)
+				assert.Equal(t, []string{"user003", "user002"}, ids(resp))
+			},
+		},
+		{
+			name: "search with projection",
+			payload: `
+{
+  "schemas": ["urn:ietf:params:scim:api:messages:2.0:SearchRequest"],
+  "attributes": ["userName"]
+}`,
+			expect: func(t *testing.T, resp *QueryResponse, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, 4, resp.TotalResults)
+				assert.Equal(t, []string{"userName"}, resp.Projection.Attributes)
+			},
+		},
+		{
+			name: "invalid schema",
+			payload: `
+{
+  "schemas": ["urn:ietf:params:scim:api:messages:2.0:ListResponse"],
+  "filter": "userName pr"
+}`,
+			expect: func(t *testing.T, resp *QueryResponse, err error) {
+				assert.True(t, errors.Is(err, spec.ErrInvalidSyntax))
+			},
+		},
+		{
+			name: "both startIndex and cursor",
+			payload: `
+{
+  "schemas": ["urn:ietf:params:scim:api:messages:2.0:SearchRequest"],
+  "startIndex": 2,
+  "cursor": ""
+}`,
+			expect: func(t *testing.T, resp *QueryResponse, err error) {
+				assert.True(t, errors.Is(err, spec.ErrInvalidSyntax))
+			},
+		},
+		{
+			name: "invalid filter",
+			payload: `
+{
+  "schemas": ["urn:ietf:params:scim:api:messages:2.0:SearchRequest"],
+  "filter": "userName eq"
+}`,
+			expect: func(t *testing.T, resp *QueryResponse, err error) {
+				assert.NotNil(t, err)
+			},
+		},
+	}
+
+	for _, test := range tests {
+		s.T().Run(test.name, func(t *testing.T) {
+			svc := SearchService(QueryService(s.config, s.userDatabase))
+			resp, err := svc.Do(context.TODO(), &SearchRequest{
+				PayloadSource: strings.NewReader(test.payload),
+			})
+			test.expect(t, resp, err)
+		})
+	}
+}
+
+func (s *SearchServiceTestSuite) TestRootQuery() {
+	tests := []struct {
+		name    string
+		request *QueryRequest
+		expect  func(t *testing.T, resp *QueryResponse, err error)
+	}{
+		{
+			name:    "all resources",
+			request: &QueryRequest{},
+			expect: func(t *testing.T, resp *QueryResponse, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, 6, resp.TotalResults)
+				assert.Equal(t, []string{"group001", "group002", "user001", "user002", "user003", "user004"}, ids(resp))
+			},
+		},
+		{
+			name: "sorted and paginated",
+			request: &QueryRequest{
+				Filter:     "meta.resourceType pr",
+				Sort:       &crud.Sort{By: "meta.created", Order: crud.SortDesc},
+				Pagination: &crud.Pagination{StartIndex: 2, Count: 3},
+			},
+			expect: func(t *testing.T, resp *QueryResponse, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, 6, resp.TotalResults)
+				assert.Equal(t, 2, resp.StartIndex)
+				assert.Equal(t, []string{"group001", "user003", "user002"}, ids(resp))
+			},
+		},
+		{
+			name: "page beyond results",
+			request: &QueryRequest{
+				Pagination: &crud.Pagination{StartIndex: 10, Count: 3},
+			},
+			expect: func(t *testing.T, resp *QueryResponse, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, 6, resp.TotalResults)
+				assert.Equal(t, 0, resp.ItemsPerPage)
+			},
+		},
+		{
+			name: "filter on attribute of one resource type",
+			request: &QueryRequest{
+				Filter: "displayName eq \"Admins\"",
+			},
+			expect: func(t *testing.T, resp *QueryResponse, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, []string{"group002"}, ids(resp))
+			},
+		},
+		{
+			name: "cursor pagination",
+			request: &QueryRequest{
+				Cursor: &crud.CursorPagination{Count: 2},
+			},
+			expect: func(t *testing.T, resp *QueryResponse, err error) {
+				assert.True(t, errors.Is(err, spec.ErrInvalidSyntax))
+			},
+		},
+	}
+
+	for _, test := range tests {
+		s.T().Run(test.name, func(t *testing.T) {
+			svc := RootQueryService(s.config, QueryService(s.config, s.userDatabase), QueryService(s.config, s.groupDatabase))
+			resp, err := svc.Do(context.TODO(), test.request)
+			test.expect(t, resp, err)
+		})
+	}
+}
+
+func (s *SearchServiceTestSuite) TestRootQueryCountOnly() {
+	svc := RootQueryService(s.config,
+		QueryService(s.config, &countOnlyDB{DB: s.userDatabase}),
+		QueryService(s.config, &countOnlyDB{DB: s.groupDatabase}))
+
+	resp, err := svc.Do(context.TODO(), &QueryRequest{
+		Pagination: &crud.Pagination{StartIndex: 1, Count: 0},
+	})
+	assert.Nil(s.T(), err)
+	assert.Equal(s.T(), 6, resp.TotalResults)
+	assert.Equal(s.T(), 1, resp.StartIndex)
+	assert.Empty(s.T(), resp.Resources)
+}
+
+func ids(resp *QueryResponse) []string {
+	var ids []string
+	for _, r := range resp.Resources {
+		ids = append(ids, r.(*prop.Resource).IdOrEmpty())
+	}
+	return ids
+}
+
+func (s *SearchServiceTestSuite) SetupSuite() {
+	for _, each := range []struct {
+		filepath  string
+		structure interface{}
+		post      func(parsed interface{})
+	}{
+		{
+			filepath:  "../../../public/schemas/core_schema.json",
+			structure: new(spec.Schema),
+			post: func(parsed interface{}) {
+				spec.Schemas().Register(parsed.(*spec.Schema))
+			},
+		},
+		{
+			filepath:  "../../../public/schemas/user_schema.json",
+			structure: new(spec.Schema),
+			post: func(parsed interface{}) {
+				spec.Schemas().Register(parsed.(*spec.Schema))
+			},
+		},
+		{
+			filepath:  "../../../public/schemas/user_enterprise_extension_schema.json",
+			structure: new(spec.Schema),
+			post: func(parsed interface{}) {
+				spec.Schemas().Register(parsed.(*spec.Schema))
+			},
+		},
+		{
+			filepath:  "../../../public/schemas/group_schema.json",
+			structure: new(spec.Schema),
+			post: func(parsed interface{}) {
+				spec.Schemas().Register(parsed.(*spec.Schema))
+			},
+		},
+		{
+			filepath:  "../../../public/resource_types/user_resource_type.json",
+			structure: new(spec.ResourceType),
+			post: func(parsed interface{}) {
+				s.userResourceType = parsed.(*spec.ResourceType)
+				crud.Register(s.userResourceType)
+			},
+		},
+		{
+			filepath:  "../../../public/resource_types/group_resource_type.json",
+			structure: new(spec.ResourceType),
+			post: func(parsed interface{}) {
+				s.groupResourceType = parsed.(*spec.ResourceType)
+				crud.Register(s.groupResourceType)
+			},
+		},
+	} {
+		f, err := os.Open(each.filepath)
+		require.Nil(s.T(), err)
+
+		raw, err := ioutil.ReadAll(f)
+		require.Nil(s.T(), err)
+
+		err = json.Unmarshal(raw, each.structure)
+		require.Nil(s.T(), err)
+
+		if each.post != nil {
+			each.post(each.structure)
+		}
+	}
+
+	s.config = new(spec.ServiceProviderConfig)
+	require.Nil(s.T(), json.Unmarshal([]byte(`
+{
+  "filter": {
+    "supported": true
+  },
+  "sort": {
+    "supported": true
+  },
+  "pagination": {
+    "cursor": true,
+    "index": true
+  }
+}
+`), s.config))
+
+	s.userDatabase = db.Memory()
+	for _, each := range []struct {
+		id       string
+		userName string
+		created  string
+	}{
+		{id: "user001", userName: "alice", created: "2020-01-01T00:00:00"},
+		{id: "user002", userName: "amy", created: "2020-01-03T00:00:00"},
+		{id: "user003", userName: "anna", created: "2020-01-05T00:00:00"},
+		{id: "user004", userName: "bob", created: "2020-01-07T00:00:00"},
+	} {
+		r := prop.NewResource(s.userResourceType)
+		require.Nil(s.T(), r.Navigator().Replace(map[string]interface{}{
+			"id":       each.id,
+			"userName": each.userName,
+			"meta": map[string]interface{}{
+				"resourceType": "User",
+				"created":      each.created,
+			},
+		}).Error())
+		require.Nil(s.T(), s.userDatabase.Insert(context.TODO(), r))
+	}
+
+	s.groupDatabase = db.Memory()
+	for _, each := range []struct {
+		id          string
+		displayName string
+		created     string
+	}{
+		{id: "group001", displayName: "Users", created: "2020-01-06T00:00:00"},
+		{id: "group002", displayName: "Admins", created: "2020-01-02T00:00:00"},
+	} {
+		r := prop.NewResource(s.groupResourceType)
+		require.Nil(s.T(), r.Navigator().Replace(map[string]interface{}{
+			"id":          each.id,
+			"displayName": each.displayName,
+			"meta": map[string]interface{}{
+				"resourceType": "Group",
+				"created":      each.created,
+			},
+		}).Error())
+		require.Nil(s.T(), s.groupDatabase.Insert(context.TODO(), r))
+	}
+}
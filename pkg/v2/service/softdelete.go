@@ -0,0 +1,211 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"github.com/imulab/go-scim/pkg/v2/crud"
+	"github.com/imulab/go-scim/pkg/v2/db"
+	"github.com/imulab/go-scim/pkg/v2/prop"
+	"github.com/imulab/go-scim/pkg/v2/service/filter"
+	"github.com/imulab/go-scim/pkg/v2/spec"
+	"time"
+)
+
+// SoftDeleteService returns a delete resource service that soft deletes resources, rather than deleting them from the
+// database. Soft deleted resources are tombstoned with the current time as meta.deleted, and are replaced in the
+// database after the filters (usually filter.MetaFilter) are run against them. To hide soft deleted resources from
+// other services, wrap the database with db.SoftDelete for them. Soft deleted resources can be restored with
+// RestoreService, and permanently deleted with PurgeService.
+func SoftDeleteService(config *spec.ServiceProviderConfig, database db.DB, filters []filter.ByResource) Delete {
+	return &softDeleteService{
+		database: database,
+		config:   config,
+		filters:  filters,
+	}
+}
+
+type softDeleteService struct {
+	database db.DB
+	config   *spec.ServiceProviderConfig
+	filters  []filter.ByResource
+}
+
+func (s *softDeleteService) Do(ctx context.Context, req *DeleteRequest) (resp *DeleteResponse, err error) {
+	resource, err := s.database.Get(ctx, req.ResourceID, nil)
+	if err != nil {
+		return
+	}
+	if len(resource.MetaDeletedOrEmpty()) > 0 {
+		err = fmt.Errorf("%w: resource not found by id", spec.ErrNotFound)
+		return
+	}
+
+	if s.config.ETag.Supported && req.MatchCriteria != nil {
+		if !req.MatchCriteria(resource) {
+			err = fmt.Errorf("%w: resource does not meet pre condition", spec.ErrConflict)
+			return
+		}
+	}
+
+	if s.config.ETag.Supported && len(req.Version) > 0 {
+		if err = db.MatchVersion(resource, req.Version); err != nil {
+			return
+		}
+	}
+
+	ref := resource.Clone()
+	if err = resource.Navigator().Dot("meta").Dot("deleted").Replace(time.Now().UTC().Format(spec.ISO8601)).Error(); err != nil {
+		return
+	}
+	for _, f := range s.filters {
+		if err = f.FilterRef(ctx, resource, ref); err != nil {
+			return
+		}
+	}
+
+	if s.config.ETag.Supported && len(req.Version) > 0 {
+		err = db.ReplaceIfMatch(ctx, s.database, ref, resource, req.Version)
+	} else {
+		err = s.database.Replace(ctx, ref, resource)
+	}
+	if err != nil {
+		return
+	}
+
+	resp = &DeleteResponse{Deleted: resource}
+	return
+}
+
+// RestoreService returns a service to restore resources soft deleted by SoftDeleteService. The meta.deleted tombstone
+// of the resource is removed, and the resource is replaced in the database after the filters (usually
+// filter.MetaFilter) are run against it. The database must not be wrapped by db.SoftDelete, which hides soft deleted
+// resources.
+func RestoreService(config *spec.ServiceProviderConfig, database db.DB, filters []filter.ByResource) Restore {
+	return &restoreService{
+		database: database,
+		config:   config,
+		filters:  filters,
+	}
+}
+
+type (
+	// Restore resource service
+	Restore interface {
+		Do(ctx context.Context, req *RestoreRequest) (resp *RestoreResponse, err error)
+	}
+	// Restore resource request
+	RestoreRequest struct {
+		ResourceID    string                             // id of the soft deleted resource to restore
+		MatchCriteria func(resource *prop.Resource) bool // extra criteria the resource has to meet in order to be restored
+	}
+	// Restore resource response
+	RestoreResponse struct {
+		Resource *prop.Resource // the restored resource
+	}
+)
+
+type restoreService struct {
+	database db.DB
+	config   *spec.ServiceProviderConfig
+	filters  []filter.ByResource
+}
+
+func (s *restoreService) Do(ctx context.Context, req *RestoreRequest) (resp *RestoreResponse, err error) {
+	resource, err := getSoftDeleted(ctx, s.database, req.ResourceID)
+	if err != nil {
+		return
+	}
+
+	if s.config.ETag.Supported && req.MatchCriteria != nil {
+		if !req.MatchCriteria(resource) {
+			err = fmt.Errorf("%w: resource does not meet pre condition", spec.ErrConflict)
+			return
+		}
+	}
+
+	ref := resource.Clone()
+	if err = resource.Navigator().Dot("meta").Dot("deleted").Delete().Error(); err != nil {
+		return
+	}
+	for _, f := range s.filters {
+		if err = f.FilterRef(ctx, resource, ref); err != nil {
+			return
+		}
+	}
+
+	if err = s.database.Replace(ctx, ref, resource); err != nil {
+		return
+	}
+
+	resp = &RestoreResponse{Resource: resource}
+	return
+}
+
+// PurgeService returns a service to permanently delete resources soft deleted by SoftDeleteService, either by id, or
+// all that were soft deleted before a point in time, i.e. to enforce a retention period. The database must not be
+// wrapped by db.SoftDelete, which hides soft deleted resources.
+func PurgeService(database db.DB) Purge {
+	return &purgeService{database: database}
+}
+
+type (
+	// Purge resource service
+	Purge interface {
+		Do(ctx context.Context, req *PurgeRequest) (resp *PurgeResponse, err error)
+	}
+	// Purge resource request. Exactly one of ResourceID and DeletedBefore shall be specified.
+	PurgeRequest struct {
+		ResourceID    string    // id of the soft deleted resource to purge
+		DeletedBefore time.Time // purge all resources soft deleted before this time
+	}
+	// Purge resource response
+	PurgeResponse struct {
+		Purged []*prop.Resource // the resources purged
+	}
+)
+
+type purgeService struct {
+	database db.DB
+}
+
+func (s *purgeService) Do(ctx context.Context, req *PurgeRequest) (resp *PurgeResponse, err error) {
+	if len(req.ResourceID) > 0 == !req.DeletedBefore.IsZero() {
+		err = fmt.Errorf("%w: exactly one of resource id and deleted before shall be specified", spec.ErrInternal)
+		return
+	}
+
+	var resources []*prop.Resource
+	if len(req.ResourceID) > 0 {
+		var resource *prop.Resource
+		if resource, err = getSoftDeleted(ctx, s.database, req.ResourceID); err != nil {
+			return
+		}
+		resources = []*prop.Resource{resource}
+	} else {
+		query := crud.Filter().Lt("meta.deleted", req.DeletedBefore.UTC()).String()
+		if resources, err = s.database.Query(ctx, query, nil, nil, nil); err != nil {
+			return
+		}
+	}
+
+	resp = new(PurgeResponse)
+	for _, resource := range resources {
+		if err = s.database.Delete(ctx, resource); err != nil {
+			return
+		}
+		resp.Purged = append(resp.Purged, resource)
+	}
+	return
+}
+
+// Returns the soft deleted resource by id, or an error of spec.ErrNotFound if it is not soft deleted.
+func getSoftDeleted(ctx context.Context, database db.DB, id string) (*prop.Resource, error) {
+	resource, err := database.Get(ctx, id, nil)
+	if err != nil {
+		return nil, err
+	}
+	if len(resource.MetaDeletedOrEmpty()) == 0 {
+		return nil, fmt.Errorf("%w: no soft deleted resource by id '%s'", spec.ErrNotFound, id)
+	}
+	return resource, nil
+}
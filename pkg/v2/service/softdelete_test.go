@@ -0,0 +1,196 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/imulab/go-scim/pkg/v2/crud"
+	"github.com/imulab/go-scim/pkg/v2/db"
+	"github.com/imulab/go-scim/pkg/v2/prop"
+	"github.com/imulab/go-scim/pkg/v2/service/filter"
+	"github.com/imulab/go-scim/pkg/v2/spec"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestSoftDeleteService(t *testing.T) {
+	s := new(SoftDeleteServiceTestSuite)
+	suite.Run(t, s)
+}
+
+type SoftDeleteServiceTestSuite struct {
+	suite.Suite
+	config       *spec.ServiceProviderConfig
+	resourceType *spec.ResourceType
+}
+
+func (s *SoftDeleteServiceTestSuite) TestSoftDelete() {
+	database := s.databaseWith("foo", "bar")
+	hidden := db.SoftDelete(database)
+	svc := SoftDeleteService(s.config, hidden, []filter.ByResource{filter.MetaFilter()})
+
+	before, err := hidden.Get(context.TODO(), "foo", nil)
+	require.Nil(s.T(), err)
+
+	resp, err := svc.Do(context.TODO(), &DeleteRequest{ResourceID: "foo"})
+	require.Nil(s.T(), err)
+	assert.NotEmpty(s.T(), resp.Deleted.MetaDeletedOrEmpty())
+	assert.NotEqual(s.T(), before.MetaVersionOrEmpty(), resp.Deleted.MetaVersionOrEmpty())
+
+	// hidden from services
+	_, err = hidden.Get(context.TODO(), "foo", nil)
+	assert.True(s.T(), errors.Is(err, spec.ErrNotFound))
+	_, err = svc.Do(context.TODO(), &DeleteRequest{ResourceID: "foo"})
+	assert.True(s.T(), errors.Is(err, spec.ErrNotFound))
+
+	resp2, err := QueryService(s.config, hidden).Do(context.TODO(), &QueryRequest{})
+	require.Nil(s.T(), err)
+	assert.Equal(s.T(), 1, resp2.TotalResults)
+	assert.Equal(s.T(), []string{"bar"}, ids(resp2))
+
+	resp2, err = QueryService(s.config, hidden).Do(context.TODO(), &QueryRequest{Filter: "userName pr"})
+	require.Nil(s.T(), err)
+	assert.Equal(s.T(), []string{"bar"}, ids(resp2))
+
+	// unless explicitly included
+	resp2, err = QueryService(s.config, hidden).Do(context.TODO(), &QueryRequest{Filter: "meta.deleted pr"})
+	require.Nil(s.T(), err)
+	assert.Equal(s.T(), []string{"foo"}, ids(resp2))
+
+	// still in the database
+	_, err = database.Get(context.TODO(), "foo", nil)
+	assert.Nil(s.T(), err)
+}
+
+func (s *SoftDeleteServiceTestSuite) TestRestore() {
+	database := s.databaseWith("foo")
+	hidden := db.SoftDelete(database)
+	filters := []filter.ByResource{filter.MetaFilter()}
+
+	_, err := RestoreService(s.config, database, filters).Do(context.TODO(), &RestoreRequest{ResourceID: "foo"})
+	assert.True(s.T(), errors.Is(err, spec.ErrNotFound))
+
+	_, err = SoftDeleteService(s.config, hidden, filters).Do(context.TODO(), &DeleteRequest{ResourceID: "foo"})
+	require.Nil(s.T(), err)
+
+	resp, err := RestoreService(s.config, database, filters).Do(context.TODO(), &RestoreRequest{ResourceID: "foo"})
+	require.Nil(s.T(), err)
+	assert.Empty(s.T(), resp.Resource.MetaDeletedOrEmpty())
+
+	r, err := hidden.Get(context.TODO(), "foo", nil)
+	require.Nil(s.T(), err)
+	assert.Equal(s.T(), resp.Resource.MetaVersionOrEmpty(), r.MetaVersionOrEmpty())
+}
+
+func (s *SoftDeleteServiceTestSuite) TestPurge() {
+	database := s.databaseWith("foo", "bar", "baz")
+	hidden := db.SoftDelete(database)
+	svc := SoftDeleteService(s.config, hidden, []filter.ByResource{filter.MetaFilter()})
+	for _, id := range []string{"foo", "bar"} {
+		_, err := svc.Do(context.TODO(), &DeleteRequest{ResourceID: id})
+		require.Nil(s.T(), err)
+	}
+
+	_, err := PurgeService(database).Do(context.TODO(), &PurgeRequest{ResourceID: "baz"})
+	assert.True(s.T(), errors.Is(err, spec.ErrNotFound))
+
+	resp, err := PurgeService(database).Do(context.TODO(), &PurgeRequest{ResourceID: "foo"})
+	require.Nil(s.T(), err)
+	assert.Len(s.T(), resp.Purged, 1)
+	_, err = database.Get(context.TODO(), "foo", nil)
+	assert.True(s.T(), errors.Is(err, spec.ErrNotFound))
+
+	resp, err = PurgeService(database).Do(context.TODO(), &PurgeRequest{DeletedBefore: time.Now().Add(-time.Hour)})
+	require.Nil(s.T(), err)
+	assert.Len(s.T(), resp.Purged, 0)
+
+	resp, err = PurgeService(database).Do(context.TODO(), &PurgeRequest{DeletedBefore: time.Now().Add(time.Hour)})
+	require.Nil(s.T(), err)
+	assert.Len(s.T(), resp.Purged, 1)
+
+	n, err := database.Count(context.TODO(), "")
+	require.Nil(s.T(), err)
+	assert.Equal(s.T(), 1, n)
+}
+
+func (s *SoftDeleteServiceTestSuite) databaseWith(ids ...string) db.DB {
+	database := db.Memory()
+	for _, id := range ids {
+		r := prop.NewResource(s.resourceType)
+		require.Nil(s.T(), r.Navigator().Replace(map[string]interface{}{
+			"schemas":  []interface{}{"urn:ietf:params:scim:schemas:core:2.0:User"},
+			"id":       id,
+			"userName": id,
+			"meta": map[string]interface{}{
+				"version": "W/\"1\"",
+			},
+		}).Error())
+		require.Nil(s.T(), database.Insert(context.TODO(), r))
+	}
+	return database
+}
+
+func (s *SoftDeleteServiceTestSuite) SetupSuite() {
+	for _, each := range []struct {
+		filepath  string
+		structure interface{}
+		post      func(parsed interface{})
+	}{
+		{
+			filepath:  "../../../public/schemas/core_schema.json",
+			structure: new(spec.Schema),
+			post: func(parsed interface{}) {
+				spec.Schemas().Register(parsed.(*spec.Schema))
+			},
+		},
+		{
+			filepath:  "../../../public/schemas/user_schema.json",
+			structure: new(spec.Schema),
+			post: func(parsed interface{}) {
+				spec.Schemas().Register(parsed.(*spec.Schema))
+			},
+		},
+		{
+			filepath:  "../../../public/schemas/user_enterprise_extension_schema.json",
+			structure: new(spec.Schema),
+			post: func(parsed interface{}) {
+				spec.Schemas().Register(parsed.(*spec.Schema))
+			},
+		},
+		{
+			filepath:  "../../../public/resource_types/user_resource_type.json",
+			structure: new(spec.ResourceType),
+			post: func(parsed interface{}) {
+				s.resourceType = parsed.(*spec.ResourceType)
+				crud.Register(s.resourceType)
+			},
+		},
+	} {
+		f, err := os.Open(each.filepath)
+		require.Nil(s.T(), err)
+
+		raw, err := ioutil.ReadAll(f)
+		require.Nil(s.T(), err)
+
+		err = json.Unmarshal(raw, each.structure)
+		require.Nil(s.T(), err)
+
+		if each.post != nil {
+			each.post(each.structure)
+		}
+	}
+
+	s.config = &spec.ServiceProviderConfig{}
+	require.Nil(s.T(), json.Unmarshal([]byte(`
+{
+  "filter": {
+    "supported": true
+  }
+}
+`), s.config))
+}
@@ -25,6 +25,13 @@ type ServiceProviderConfig struct {
 	ETag struct {
 		Supported bool `json:"supported"`
 	} `json:"etag"`
+	// Pagination methods supported, see draft-ietf-scim-cursor-pagination.
+	Pagination struct {
+		Cursor          bool `json:"cursor"`
+		Index           bool `json:"index"`
+		DefaultPageSize int  `json:"defaultPageSize,omitempty"`
+		MaxPageSize     int  `json:"maxPageSize,omitempty"`
+	} `json:"pagination"`
 	AuthSchemes []struct {
 		Type        string `json:"type"`
 		Name        string `json:"name"`
@@ -0,0 +1,19 @@
+package spec
+
+import (
+	"fmt"
+	"time"
+)
+
+// ParseDateTime parses the dateTime value in xsd:dateTime notation (see RFC7643 section 2.3.5). The value may carry
+// fractional seconds, and a time zone designator of either "Z" or a numeric offset like "+02:00". Values without a
+// designator are interpreted as UTC, in line with the ISO8601 layout. The result is always normalized to UTC, so
+// that values given in different offsets can be compared and formatted consistently.
+func ParseDateTime(value string) (time.Time, error) {
+	for _, layout := range []string{time.RFC3339Nano, ISO8601} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t.UTC(), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("%w: '%s' is not a valid dateTime", ErrInvalidValue, value)
+}
@@ -0,0 +1,35 @@
+package spec
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestParseDateTime(t *testing.T) {
+	expect := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	for _, each := range []struct {
+		value  string
+		expect time.Time
+	}{
+		{value: "2024-01-01T00:00:00", expect: expect},
+		{value: "2024-01-01T00:00:00Z", expect: expect},
+		{value: "2024-01-01T02:00:00+02:00", expect: expect},
+		{value: "2023-12-31T19:00:00-05:00", expect: expect},
+		{value: "2024-01-01T00:00:00.250Z", expect: expect.Add(250 * time.Millisecond)},
+		{value: "2024-01-01T05:30:00.5+05:30", expect: expect.Add(500 * time.Millisecond)},
+		{value: "2024-01-01T00:00:00.123456789", expect: expect.Add(123456789 * time.Nanosecond)},
+	} {
+		parsed, err := ParseDateTime(each.value)
+		assert.Nil(t, err, each.value)
+		assert.True(t, each.expect.Equal(parsed), each.value)
+		assert.Equal(t, time.UTC, parsed.Location(), each.value)
+	}
+
+	for _, each := range []string{"", "2024-01-01", "2024-01-01 00:00:00", "2024-01-01T00:00:00+2"} {
+		_, err := ParseDateTime(each)
+		assert.Equal(t, ErrInvalidValue, errors.Unwrap(err), each)
+	}
+}
@@ -1,5 +1,10 @@
 package spec
 
+import (
+	"errors"
+	"strings"
+)
+
 // Error prototypes
 var (
 	// The specified filter syntax was invalid, or the specified attribute and filter comparison combination is not supported.
@@ -37,6 +42,39 @@ var (
 	// The resource is in conflict with some pre conditions.
 	ErrConflict = &Error{Status: 412, Type: "conflict"}
 
+	// The cursor for pagination is invalid, or does not belong to the query (see draft-ietf-scim-cursor-pagination).
+	ErrInvalidCursor = &Error{Status: 400, Type: "invalidCursor"}
+
+	// The request payload exceeds the limits of the service provider, i.e. the maximum number of bulk operations.
+	ErrPayloadTooLarge = &Error{Status: 413, Type: "tooLarge"}
+
+	// The caller is not authenticated, i.e. the request carries no valid credentials.
+	ErrUnauthorized = &Error{Status: 401, Type: "unauthorized"}
+
+	// The operation is not permitted to the caller, i.e. the modification of an attribute it may not write.
+	ErrForbidden = &Error{Status: 403, Type: "forbidden"}
+
+	// The request would exceed a quota of the service provider, i.e. the maximum number of resources of a tenant.
+	ErrQuotaExceeded = &Error{Status: 403, Type: "quotaExceeded"}
+
+	// The caller sent more requests than the rate limit of the service provider allows, and shall retry later.
+	ErrTooManyRequests = &Error{Status: 429, Type: "tooManyRequests"}
+
+	// The requested operation, or feature of it, is not supported as advertised in the service provider config.
+	ErrNotImplemented = &Error{Status: 501, Type: "notImplemented"}
+
+	// The HTTP method is not supported by the endpoint, i.e. DELETE on /Users.
+	ErrMethodNotAllowed = &Error{Status: 405, Type: "methodNotAllowed"}
+
+	// The request body is not of a media type supported, i.e. neither application/scim+json nor application/json.
+	ErrUnsupportedMediaType = &Error{Status: 415, Type: "unsupportedMediaType"}
+
+	// The client accepts none of the media types of the responses, i.e. application/scim+json.
+	ErrNotAcceptable = &Error{Status: 406, Type: "notAcceptable"}
+
+	// The SCIM protocol version requested is not supported (see RFC 7644 section 3.13).
+	ErrInvalidVersion = &Error{Status: 400, Type: "invalidVers"}
+
 	// Server encountered internal error.
 	ErrInternal = &Error{Status: 500, Type: "internal"}
 )
@@ -54,6 +92,42 @@ func (s Error) Error() string {
 	return s.Type
 }
 
+// Errors aggregates multiple errors, i.e. all the validation violations of a resource, so that they can be reported at
+// once instead of one at a time. Errors unwraps to the cause of its first error, hence, like errors wrapping a single
+// error prototype, it is reported with the status and type of its first error.
+type Errors []error
+
+func (e Errors) Error() string {
+	messages := make([]string, 0, len(e))
+	for _, err := range e {
+		messages = append(messages, err.Error())
+	}
+	return strings.Join(messages, "; ")
+}
+
+func (e Errors) Unwrap() error {
+	if len(e) == 0 {
+		return nil
+	}
+	if cause := errors.Unwrap(e[0]); cause != nil {
+		return cause
+	}
+	return e[0]
+}
+
+// AsError returns nil if there are no errors, the only error if there is one, or the Errors themselves otherwise.
+func (e Errors) AsError() error {
+	switch len(e) {
+	case 0:
+		return nil
+	case 1:
+		return e[0]
+	default:
+		return e
+	}
+}
+
 var (
 	_ error = (*Error)(nil)
+	_ error = (Errors)(nil)
 )
@@ -0,0 +1,23 @@
+package spec
+
+import (
+	"errors"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestErrors(t *testing.T) {
+	errs := Errors{
+		fmt.Errorf("%w: 'userName' is required", ErrInvalidValue),
+		fmt.Errorf("%w: value of 'userName' is not unique", ErrUniqueness),
+	}
+	assert.Equal(t, "invalidValue: 'userName' is required; uniqueness: value of 'userName' is not unique", errs.Error())
+	assert.Equal(t, ErrInvalidValue, errors.Unwrap(errs))
+	assert.True(t, errors.Is(errs, ErrInvalidValue))
+
+	assert.Nil(t, Errors{}.AsError())
+	assert.Equal(t, errs[0], Errors{errs[0]}.AsError())
+	assert.Equal(t, errs, errs.AsError())
+	assert.Equal(t, ErrInternal, errors.Unwrap(Errors{ErrInternal}))
+}
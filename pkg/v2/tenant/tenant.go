@@ -0,0 +1,45 @@
+// This package threads the tenant of a request through context, so that a single server instance can host many
+// isolated SCIM directories. The tenant is placed in the request context by the transport (i.e. from a HTTP header),
+// and is consulted by the databases to keep the resources, and everything keyed by them, apart (see db.TenantDB).
+//
+// Tenants only own their resources: schemas and resource types are registered once for the process (see
+// spec.Schemas), hence shared by all tenants of a server instance.
+package tenant
+
+import (
+	"context"
+	"fmt"
+	"github.com/imulab/go-scim/pkg/v2/spec"
+)
+
+type tenantKey struct{}
+
+// With returns a copy of the context carrying the id of the tenant.
+func With(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, tenantKey{}, id)
+}
+
+// From returns the id of the tenant carried by the context, or an empty string if there is none.
+func From(ctx context.Context) string {
+	id, _ := ctx.Value(tenantKey{}).(string)
+	return id
+}
+
+// Require returns the id of the tenant carried by the context, or an error of spec.ErrInternal if there is none, as
+// the transport is expected to have rejected requests without a tenant.
+func Require(ctx context.Context) (string, error) {
+	id := From(ctx)
+	if len(id) == 0 {
+		return "", fmt.Errorf("%w: no tenant in context", spec.ErrInternal)
+	}
+	return id, nil
+}
+
+// Scope returns the key prefixed with the tenant carried by the context, if any, so that keys of different tenants
+// never collide.
+func Scope(ctx context.Context, key string) string {
+	if id := From(ctx); len(id) > 0 {
+		return id + "/" + key
+	}
+	return key
+}
@@ -0,0 +1,24 @@
+package tenant
+
+import (
+	"context"
+	"errors"
+	"github.com/imulab/go-scim/pkg/v2/spec"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestTenant(t *testing.T) {
+	ctx := context.Background()
+	assert.Equal(t, "", From(ctx))
+	assert.Equal(t, "key", Scope(ctx, "key"))
+	_, err := Require(ctx)
+	assert.True(t, errors.Is(err, spec.ErrInternal))
+
+	ctx = With(ctx, "acme")
+	assert.Equal(t, "acme", From(ctx))
+	assert.Equal(t, "acme/key", Scope(ctx, "key"))
+	id, err := Require(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, "acme", id)
+}
@@ -0,0 +1,57 @@
+// This package lets the stages of the request pipeline, which are not otherwise decorated, report spans to a
+// tracer, i.e. the deserialization of payloads, the evaluation of filters in memory and the serialization of
+// resources. It does not depend on any tracing library: no spans are created until a Tracer is set, i.e. by the
+// OpenTelemetry module, which adapts the Tracer to OpenTelemetry and decorates the services and databases.
+package trace
+
+import (
+	"context"
+	"sync/atomic"
+)
+
+// Names of the spans started by this module.
+const (
+	Deserialize = "scim.deserialize"     // parsing the payload of a create, replace or patch request
+	Patch       = "scim.patch.apply"     // applying the operations of a patch request
+	Evaluate    = "scim.filter.evaluate" // evaluating a filter against the resources of an in-memory database
+	Serialize   = "scim.serialize"       // rendering the resources of a response
+)
+
+type (
+	// Tracer starts spans as children of the span carried by the context, if any.
+	Tracer interface {
+		// Start starts a span of the name, and returns a copy of the context carrying it.
+		Start(ctx context.Context, name string) (context.Context, Span)
+	}
+	// Span is a unit of work started by a Tracer.
+	Span interface {
+		// End ends the span, which failed with the error, if not nil.
+		End(err error)
+	}
+)
+
+// SetTracer sets the Tracer of the process. It is intended to be called once during initialization. A nil Tracer
+// stops tracing.
+func SetTracer(t Tracer) {
+	tracer.Store(tracerHolder{t})
+}
+
+// Start starts a span of the name with the Tracer of the process, and returns a copy of the context carrying it,
+// together with the function to end it. When there is no Tracer, the context is returned as is.
+func Start(ctx context.Context, name string) (context.Context, func(err error)) {
+	h, ok := tracer.Load().(tracerHolder)
+	if !ok || h.t == nil {
+		return ctx, noop
+	}
+	ctx, span := h.t.Start(ctx, name)
+	return ctx, span.End
+}
+
+var tracer atomic.Value
+
+// atomic.Value requires values of the same concrete type.
+type tracerHolder struct {
+	t Tracer
+}
+
+func noop(error) {}
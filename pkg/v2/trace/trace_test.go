@@ -0,0 +1,52 @@
+package trace
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+type recordingTracer struct {
+	started []string
+	ended   []error
+}
+
+type recordingSpan struct {
+	tracer *recordingTracer
+}
+
+type spanKey struct{}
+
+func (t *recordingTracer) Start(ctx context.Context, name string) (context.Context, Span) {
+	t.started = append(t.started, name)
+	return context.WithValue(ctx, spanKey{}, name), recordingSpan{tracer: t}
+}
+
+func (s recordingSpan) End(err error) {
+	s.tracer.ended = append(s.tracer.ended, err)
+}
+
+func TestStart(t *testing.T) {
+	ctx := context.Background()
+
+	// no tracer
+	spanCtx, end := Start(ctx, Deserialize)
+	assert.Equal(t, ctx, spanCtx)
+	end(nil)
+
+	tracer := new(recordingTracer)
+	SetTracer(tracer)
+	defer SetTracer(nil)
+
+	spanCtx, end = Start(ctx, Serialize)
+	assert.Equal(t, Serialize, spanCtx.Value(spanKey{}))
+	end(errors.New("boom"))
+	assert.Equal(t, []string{Serialize}, tracer.started)
+	assert.EqualError(t, tracer.ended[0], "boom")
+
+	SetTracer(nil)
+	_, end = Start(ctx, Evaluate)
+	end(nil)
+	assert.Len(t, tracer.started, 1)
+}
@@ -0,0 +1,105 @@
+package v2
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/imulab/go-scim/pkg/v2/db"
+	"github.com/imulab/go-scim/pkg/v2/spec"
+	"github.com/lib/pq"
+	"strings"
+	"time"
+)
+
+// DBWithChanges creates the same db.DB as DB, which also implements db.ChangeStreamDB by listening to the
+// notifications of the trigger created by the statements of ChangeSchema, i.e. by calling EnsureChangeSchema when the
+// application starts. Since notifications require a connection of their own, every subscription opens one with the
+// connection string, which shall connect to the database of the connection pool.
+func DBWithChanges(resourceType *spec.ResourceType, conn *sql.DB, table string, dsn string) db.DB {
+	return &changeStreamDB{
+		postgresDB: DB(resourceType, conn, table).(*postgresDB),
+		dsn:        dsn,
+	}
+}
+
+type changeStreamDB struct {
+	*postgresDB
+	dsn string
+}
+
+// Subscribe listens to the notifications of the changes of the table, and implements db.ChangeStreamDB. PostgreSQL
+// delivers the notifications of a transaction once it is committed, in the order of the commits. The resource of
+// inserts and updates is looked up when the notification is received, which may reflect a later change, or be nil if
+// the resource was deleted since.
+//
+// The connection is re-established after it is lost, but the changes made while it was lost are missed, as PostgreSQL
+// does not keep notifications for disconnected listeners. Subscribers that cannot tolerate missed changes shall
+// reconcile their state, i.e. by expiring caches, when the subscription restarts.
+func (d *changeStreamDB) Subscribe(ctx context.Context, fn func(ctx context.Context, change *db.Change) error) error {
+	listener := pq.NewListener(d.dsn, time.Second, time.Minute, nil)
+	defer func() {
+		_ = listener.Close()
+	}()
+	if err := listener.Listen(d.table.channel); err != nil {
+		return fmt.Errorf("%w: failed to listen to changes: %v", spec.ErrInternal, err)
+	}
+
+	for {
+		var n *pq.Notification
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case n = <-listener.Notify:
+		}
+		if n == nil {
+			// the connection was re-established
+			continue
+		}
+
+		change, err := d.changeOf(ctx, n.Extra)
+		if err != nil {
+			return err
+		}
+		if err := fn(ctx, change); err != nil {
+			return err
+		}
+	}
+}
+
+// Returns the change of the payload of a notification (see ChangeSchema).
+func (d *changeStreamDB) changeOf(ctx context.Context, payload string) (*db.Change, error) {
+	var n struct {
+		Op      string    `json:"op"`
+		ID      string    `json:"id"`
+		Version string    `json:"version"`
+		Time    time.Time `json:"time"`
+	}
+	if err := json.Unmarshal([]byte(payload), &n); err != nil {
+		return nil, fmt.Errorf("%w: invalid notification of change: %v", spec.ErrInternal, err)
+	}
+
+	change := &db.Change{
+		Type:    strings.ToLower(n.Op),
+		ID:      n.ID,
+		Version: n.Version,
+		Time:    n.Time,
+	}
+	if change.Type == db.ChangeDelete {
+		return change, nil
+	}
+
+	resource, err := d.Get(ctx, change.ID, nil)
+	switch {
+	case err == nil:
+		change.Resource = resource
+	case !errors.Is(err, spec.ErrNotFound):
+		return nil, err
+	}
+	return change, nil
+}
+
+var (
+	_ db.ChangeStreamDB = (*changeStreamDB)(nil)
+)
@@ -0,0 +1,251 @@
+package v2
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"github.com/imulab/go-scim/pkg/v2/crud"
+	"github.com/imulab/go-scim/pkg/v2/crud/translate"
+	"github.com/imulab/go-scim/pkg/v2/db"
+	scimjson "github.com/imulab/go-scim/pkg/v2/json"
+	"github.com/imulab/go-scim/pkg/v2/prop"
+	"github.com/imulab/go-scim/pkg/v2/spec"
+	"github.com/lib/pq"
+)
+
+// Create a db.DB implementation that persists data in PostgreSQL. This implementation supports one-to-one
+// correspondence of a SCIM resource type to a PostgreSQL table, which shall have been created with the statements
+// returned by Schema, i.e. by calling EnsureSchema when the application starts.
+//
+// Resources are stored as JSONB documents of all their attributes, including those that are never returned to clients,
+// along with the id, meta.version and meta.lastModified in columns of their own. Filters, sort and pagination are
+// translated into SQL (see translate.SQLCompiler) and executed by PostgreSQL: attributes with generated columns (see
+// Schema) are compared using these columns and their indexes, equality on the other attributes that compare exactly is
+// expressed as containment served by the GIN index of the documents, and the rest is evaluated against the documents.
+// Sorting by multiValued attributes, or attributes within them, is rejected with an error of spec.ErrInvalidSyntax.
+// Queries are ordered by id when not sorted, so that pages are stable.
+//
+// Insert and Replace return an error of spec.ErrUniqueness when a unique index is violated, which prevents duplicates
+// from concurrent writes that the uniqueness check of filter.ValidationFilter cannot. Replace and Delete only modify
+// the resource if its stored version is still the version of the given resource, and return an error of
+// spec.ErrConflict otherwise, in the same way as the MongoDB implementation.
+//
+// This implementation ignores the projection parameters and always returns complete resources, which leaves it to the
+// serialization to return the requested attributes.
+//
+// The calls with a context carrying a transaction on the same connection pool are part of the transaction (see
+// Transaction), so that multi-resource operations can be made atomic. The returned DB implements db.TxDB, whose
+// WithTx starts such a transaction with the default options, which the databases of other tables on the same
+// connection pool take part in.
+func DB(resourceType *spec.ResourceType, conn *sql.DB, table string) db.DB {
+	t := newTable(resourceType, table)
+	return &postgresDB{
+		resourceType: resourceType,
+		conn:         conn,
+		table:        t,
+		compiler:     translate.SQLCompiler(resourceType, t.mapping(), translate.Dollar),
+	}
+}
+
+type postgresDB struct {
+	resourceType *spec.ResourceType
+	conn         *sql.DB
+	table        *table
+	compiler     translate.SQL
+}
+
+func (d *postgresDB) Insert(ctx context.Context, resource *prop.Resource) error {
+	doc, err := d.document(resource)
+	if err != nil {
+		return err
+	}
+
+	_, err = querierFor(ctx, d.conn).ExecContext(ctx,
+		"INSERT INTO "+d.table.quoted+" ("+idColumn+", "+versionColumn+", "+lastModifiedColumn+", "+docColumn+") VALUES ($1, $2, $3, $4)",
+		resource.IdOrEmpty(), resource.MetaVersionOrEmpty(), lastModified(resource), doc)
+	if err != nil {
+		return d.table.errWrite(err)
+	}
+	return nil
+}
+
+func (d *postgresDB) Count(ctx context.Context, filter string) (int, error) {
+	clause, err := d.compiler.Compile(filter, nil, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	var n int
+	if err := querierFor(ctx, d.conn).QueryRowContext(ctx, "SELECT count(*) FROM "+d.table.quoted+clause.String(), clause.Args...).Scan(&n); err != nil {
+		return 0, errDatabase(err)
+	}
+	return n, nil
+}
+
+func (d *postgresDB) Get(ctx context.Context, id string, _ *crud.Projection) (*prop.Resource, error) {
+	var raw []byte
+	err := querierFor(ctx, d.conn).QueryRowContext(ctx, "SELECT "+docColumn+" FROM "+d.table.quoted+" WHERE "+idColumn+" = $1", id).Scan(&raw)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("%w: resource not found by id '%s'", spec.ErrNotFound, id)
+		}
+		return nil, errDatabase(err)
+	}
+	return d.resource(raw)
+}
+
+// GetMany gets the resources by their ids in one query, and implements db.BatchDB.
+func (d *postgresDB) GetMany(ctx context.Context, ids []string, _ *crud.Projection) ([]*prop.Resource, error) {
+	resources, err := d.query(ctx, "SELECT "+docColumn+" FROM "+d.table.quoted+" WHERE "+idColumn+" = ANY($1)", pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	return db.SortByIDs(resources, ids), nil
+}
+
+func (d *postgresDB) Replace(ctx context.Context, ref *prop.Resource, replacement *prop.Resource) error {
+	doc, err := d.document(replacement)
+	if err != nil {
+		return err
+	}
+
+	var (
+		id      = ref.IdOrEmpty()
+		version = ref.MetaVersionOrEmpty()
+		query   = "UPDATE " + d.table.quoted + " SET " + versionColumn + " = $1, " + lastModifiedColumn + " = $2, " + docColumn + " = $3 WHERE " + idColumn + " = $4"
+		args    = []interface{}{replacement.MetaVersionOrEmpty(), lastModified(replacement), doc, id}
+	)
+	if len(version) > 0 {
+		query += " AND " + versionColumn + " = $5"
+		args = append(args, version)
+	}
+
+	result, err := querierFor(ctx, d.conn).ExecContext(ctx, query, args...)
+	if err != nil {
+		return d.table.errWrite(err)
+	}
+	return d.errIfNotAffected(result, id, version)
+}
+
+func (d *postgresDB) Delete(ctx context.Context, resource *prop.Resource) error {
+	var (
+		id      = resource.IdOrEmpty()
+		version = resource.MetaVersionOrEmpty()
+		query   = "DELETE FROM " + d.table.quoted + " WHERE " + idColumn + " = $1"
+		args    = []interface{}{id}
+	)
+	if len(version) > 0 {
+		query += " AND " + versionColumn + " = $2"
+		args = append(args, version)
+	}
+
+	result, err := querierFor(ctx, d.conn).ExecContext(ctx, query, args...)
+	if err != nil {
+		return errDatabase(err)
+	}
+	return d.errIfNotAffected(result, id, version)
+}
+
+func (d *postgresDB) Query(ctx context.Context, filter string, sort *crud.Sort, pagination *crud.Pagination, _ *crud.Projection) ([]*prop.Resource, error) {
+	clause, err := d.compiler.Compile(filter, sort, pagination)
+	if err != nil {
+		return nil, err
+	}
+	if len(clause.OrderBy) == 0 {
+		clause.OrderBy = idColumn + " ASC"
+	}
+	return d.query(ctx, "SELECT "+docColumn+" FROM "+d.table.quoted+clause.String(), clause.Args...)
+}
+
+// Returns the resources of the documents selected by the query.
+func (d *postgresDB) query(ctx context.Context, query string, args ...interface{}) ([]*prop.Resource, error) {
+	rows, err := querierFor(ctx, d.conn).QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, errDatabase(err)
+	}
+
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	results := make([]*prop.Resource, 0)
+	for rows.Next() {
+		var raw []byte
+		if err := rows.Scan(&raw); err != nil {
+			return nil, errDatabase(err)
+		}
+		resource, err := d.resource(raw)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, resource)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errDatabase(err)
+	}
+
+	return results, nil
+}
+
+// Returns the JSONB document of the resource. Unlike the JSON serialization for clients, the document contains all
+// assigned attributes, so that the resource can be restored as it is.
+func (d *postgresDB) document(resource *prop.Resource) (string, error) {
+	raw, err := json.Marshal(prop.Document(resource.RootProperty()))
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", spec.ErrInternal, err)
+	}
+	return string(raw), nil
+}
+
+// Returns the resource restored from the JSONB document.
+func (d *postgresDB) resource(raw []byte) (*prop.Resource, error) {
+	resource := prop.NewResource(d.resourceType)
+	if err := scimjson.Deserialize(raw, resource); err != nil {
+		return nil, err
+	}
+	return resource, nil
+}
+
+// Returns nil if the statement modified a resource, or otherwise, an error of spec.ErrConflict if the statement was
+// conditioned on the version, and spec.ErrNotFound if not.
+func (d *postgresDB) errIfNotAffected(result sql.Result, id string, version string) error {
+	n, err := result.RowsAffected()
+	if err != nil {
+		return errDatabase(err)
+	}
+	if n > 0 {
+		return nil
+	}
+	if len(version) > 0 {
+		return fmt.Errorf("%w: resource by id '%s' was not found or was modified since by another request", spec.ErrConflict, id)
+	}
+	return fmt.Errorf("%w: resource not found by id '%s'", spec.ErrNotFound, id)
+}
+
+// Returns the meta.lastModified of the resource, or nil if it has none.
+func lastModified(resource *prop.Resource) interface{} {
+	nav := resource.Navigator().Dot("meta").Dot("lastModified")
+	if nav.HasError() {
+		return nil
+	}
+	raw, ok := nav.Current().Raw().(string)
+	if !ok {
+		return nil
+	}
+	t, err := spec.ParseDateTime(raw)
+	if err != nil {
+		return nil
+	}
+	return t
+}
+
+// WithTx calls fn in a transaction on the connection pool of the database, and implements db.TxDB (see Transaction).
+func (d *postgresDB) WithTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	return Transaction(ctx, d.conn, nil, fn)
+}
+
+var (
+	_ db.BatchDB = (*postgresDB)(nil)
+	_ db.TxDB    = (*postgresDB)(nil)
+)
@@ -0,0 +1,3 @@
+// This package provides PostgreSQL implementation of db.DB interface, which stores resources as JSONB documents and
+// pushes SCIM filters, sort and pagination down to the database as SQL.
+package v2
@@ -0,0 +1,11 @@
+module github.com/imulab/go-scim/postgres/v2
+
+go 1.13
+
+require (
+	github.com/imulab/go-scim/pkg/v2 v2.0.0
+	github.com/lib/pq v1.10.9
+	github.com/stretchr/testify v1.4.0
+)
+
+replace github.com/imulab/go-scim/pkg/v2 => ../../pkg/v2
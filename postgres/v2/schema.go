@@ -0,0 +1,335 @@
+package v2
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/imulab/go-scim/pkg/v2/crud/translate"
+	"github.com/imulab/go-scim/pkg/v2/spec"
+	"github.com/lib/pq"
+	"hash/fnv"
+	"strings"
+)
+
+const (
+	// @PostgresIndex annotates a singular attribute so that a generated column of its value, and an index on the
+	// column, is created in PostgreSQL. Attributes whose uniqueness is server or global always have one, with a unique
+	// index.
+	AnnotationPostgresIndex = "@PostgresIndex"
+)
+
+// Error codes of PostgreSQL (see https://www.postgresql.org/docs/current/errcodes-appendix.html)
+const (
+	uniqueViolationCode      = "23505"
+	serializationFailureCode = "40001"
+	deadlockDetectedCode     = "40P01"
+)
+
+// PostgreSQL truncates identifiers longer than 63 bytes.
+const maxIdentifierLength = 63
+
+// Columns of the table other than the generated ones.
+const (
+	idColumn           = `"id"`
+	versionColumn      = `"version"`
+	lastModifiedColumn = `"last_modified"`
+	docColumn          = `"doc"`
+)
+
+// Schema returns the statements to create the table of the resource type, along with its indexes, in the order they
+// shall be executed. The statements are idempotent, so that they can be executed every time the application starts,
+// and require PostgreSQL 12 or later for generated columns.
+//
+// Resources are stored as JSONB documents in the "doc" column, which has a GIN index to serve the equality filters
+// translated into containment (see translate.JSONBContainment). The id, meta.version and meta.lastModified are stored
+// in columns of their own. For every singular attribute outside of multiValued attributes that is unique, or annotated
+// with "@PostgresIndex", a generated column is created from the document, with an index on its value, or on its lower
+// case value for case insensitive strings. The index is unique when the attribute's uniqueness is server or global.
+// Generated columns are not created for dateTime attributes, as the conversion of text to timestamps is not immutable.
+// The table name is quoted, and hence is case sensitive, and shall not contain the schema.
+func Schema(resourceType *spec.ResourceType, table string) []string {
+	return newTable(resourceType, table).statements()
+}
+
+// EnsureSchema executes the statements returned by Schema on the database, within a transaction.
+func EnsureSchema(ctx context.Context, conn *sql.DB, resourceType *spec.ResourceType, table string) error {
+	return Transaction(ctx, conn, nil, func(ctx context.Context) error {
+		for _, statement := range Schema(resourceType, table) {
+			if _, err := querierFor(ctx, conn).ExecContext(ctx, statement); err != nil {
+				return errDatabase(err)
+			}
+		}
+		return nil
+	})
+}
+
+// ChangeSchema returns the statements to create the trigger, along with its function, that notifies the changes of the
+// rows of the table on the channel subscribed to by the database of DBWithChanges, in the order they shall be executed.
+// The table shall have been created with the statements of Schema. The statements replace the trigger and its function
+// if they exist, so that they can be executed every time the application starts, and require PostgreSQL 11 or later.
+//
+// The notification of every row inserted, updated or deleted is a JSON object of the operation, and the id and version
+// of the row after the change, or before the deletion, along with the time of the change:
+//
+//	{"op": "UPDATE", "id": "...", "version": "...", "time": "2020-01-01T00:00:00.000000+00:00"}
+//
+// Resources are not included, as PostgreSQL limits notifications to 8000 bytes.
+func ChangeSchema(table string) []string {
+	return changeStatements(table)
+}
+
+// EnsureChangeSchema executes the statements returned by ChangeSchema on the database, within a transaction.
+func EnsureChangeSchema(ctx context.Context, conn *sql.DB, table string) error {
+	return Transaction(ctx, conn, nil, func(ctx context.Context) error {
+		for _, statement := range ChangeSchema(table) {
+			if _, err := querierFor(ctx, conn).ExecContext(ctx, statement); err != nil {
+				return errDatabase(err)
+			}
+		}
+		return nil
+	})
+}
+
+type table struct {
+	name    string
+	quoted  string
+	channel string // of the notifications of changes (see ChangeSchema)
+	columns []*generatedColumn
+	// scim paths of the attributes of the unique indexes and constraints, by name
+	uniqueIndexes map[string]string
+}
+
+// generatedColumn holds the value of a singular attribute, extracted from the document.
+type generatedColumn struct {
+	attr   *spec.Attribute
+	path   []*spec.Attribute // from the top level attribute to attr
+	name   string
+	index  string
+	unique bool
+}
+
+func newTable(resourceType *spec.ResourceType, name string) *table {
+	t := &table{
+		name:          name,
+		quoted:        pq.QuoteIdentifier(name),
+		channel:       changeChannel(name),
+		uniqueIndexes: map[string]string{identifier(name, "pkey"): "id"},
+	}
+
+	var collect func(attr *spec.Attribute, path []*spec.Attribute)
+	collect = func(attr *spec.Attribute, path []*spec.Attribute) {
+		_ = attr.ForEachSubAttribute(func(sub *spec.Attribute) error {
+			if sub.MultiValued() {
+				return nil
+			}
+			subPath := append(append([]*spec.Attribute{}, path...), sub)
+			if sub.Type() == spec.TypeComplex {
+				collect(sub, subPath)
+				return nil
+			}
+			if !t.generates(sub) {
+				return nil
+			}
+
+			names := make([]string, 0, len(subPath))
+			for _, each := range subPath {
+				names = append(names, each.Name())
+			}
+			column := &generatedColumn{
+				attr:   sub,
+				path:   subPath,
+				name:   identifier("c", sanitize(strings.Join(names, "_"))),
+				unique: sub.Uniqueness() == spec.UniquenessServer || sub.Uniqueness() == spec.UniquenessGlobal,
+			}
+			if column.unique {
+				column.index = identifier(name, column.name, "key")
+				t.uniqueIndexes[column.index] = sub.Path()
+			} else {
+				column.index = identifier(name, column.name, "idx")
+			}
+			t.columns = append(t.columns, column)
+			return nil
+		})
+	}
+	collect(resourceType.SuperAttribute(true), nil)
+
+	return t
+}
+
+// Returns true if a generated column shall be created for the singular attribute.
+func (t *table) generates(attr *spec.Attribute) bool {
+	switch attr.ID() {
+	case "id", "meta.version", "meta.lastModified":
+		return false // columns of their own
+	}
+	if attr.Type() == spec.TypeDateTime {
+		return false
+	}
+	if attr.Uniqueness() != spec.UniquenessNone {
+		return true
+	}
+	_, ok := attr.Annotation(AnnotationPostgresIndex)
+	return ok
+}
+
+func (t *table) statements() []string {
+	statements := []string{
+		fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (%s text NOT NULL, %s text NOT NULL DEFAULT '', %s timestamptz, %s jsonb NOT NULL, CONSTRAINT %s PRIMARY KEY (%s))",
+			t.quoted, idColumn, versionColumn, lastModifiedColumn, docColumn, pq.QuoteIdentifier(identifier(t.name, "pkey")), idColumn),
+		fmt.Sprintf("CREATE INDEX IF NOT EXISTS %s ON %s USING GIN (%s jsonb_path_ops)",
+			pq.QuoteIdentifier(identifier(t.name, "doc", "idx")), t.quoted, docColumn),
+		fmt.Sprintf("CREATE INDEX IF NOT EXISTS %s ON %s (%s)",
+			pq.QuoteIdentifier(identifier(t.name, "last_modified", "idx")), t.quoted, lastModifiedColumn),
+	}
+
+	for _, column := range t.columns {
+		statements = append(statements, fmt.Sprintf("ALTER TABLE %s ADD COLUMN IF NOT EXISTS %s %s GENERATED ALWAYS AS (%s) STORED",
+			t.quoted, pq.QuoteIdentifier(column.name), column.sqlType(), column.extract()))
+
+		key := pq.QuoteIdentifier(column.name)
+		if column.caseInsensitive() {
+			key = "LOWER(" + key + ")"
+		}
+		create := "CREATE INDEX"
+		if column.unique {
+			create = "CREATE UNIQUE INDEX"
+		}
+		statements = append(statements, fmt.Sprintf("%s IF NOT EXISTS %s ON %s (%s)",
+			create, pq.QuoteIdentifier(column.index), t.quoted, key))
+	}
+
+	return statements
+}
+
+func changeStatements(table string) []string {
+	var (
+		quoted   = pq.QuoteIdentifier(table)
+		function = pq.QuoteIdentifier(identifier(table, "notify"))
+		trigger  = pq.QuoteIdentifier(identifier(table, "changes"))
+	)
+	return []string{
+		fmt.Sprintf(`CREATE OR REPLACE FUNCTION %s() RETURNS trigger AS $$
+DECLARE
+	r RECORD;
+BEGIN
+	IF TG_OP = 'DELETE' THEN
+		r := OLD;
+	ELSE
+		r := NEW;
+	END IF;
+	PERFORM pg_notify(%s, json_build_object('op', TG_OP, 'id', r.%s, 'version', r.%s, 'time', clock_timestamp())::text);
+	RETURN NULL;
+END;
+$$ LANGUAGE plpgsql`, function, pq.QuoteLiteral(changeChannel(table)), idColumn, versionColumn),
+		fmt.Sprintf("DROP TRIGGER IF EXISTS %s ON %s", trigger, quoted),
+		fmt.Sprintf("CREATE TRIGGER %s AFTER INSERT OR UPDATE OR DELETE ON %s FOR EACH ROW EXECUTE FUNCTION %s()",
+			trigger, quoted, function),
+	}
+}
+
+// Returns the channel of the notifications of the changes of the table.
+func changeChannel(table string) string {
+	return identifier(table, "changes")
+}
+
+// Returns the mapping of attributes to the columns of the table: id, meta.version, meta.lastModified and the attributes
+// of generated columns are mapped to their columns, and the rest to the document.
+func (t *table) mapping() translate.Mapping {
+	columns := map[string]string{
+		"id":                idColumn,
+		"meta.version":      versionColumn,
+		"meta.lastModified": lastModifiedColumn,
+	}
+	for _, column := range t.columns {
+		columns[column.attr.ID()] = pq.QuoteIdentifier(column.name)
+	}
+
+	return translate.Chain(
+		translate.MappingFunc(func(path []*spec.Attribute) (translate.Column, bool) {
+			for _, attr := range path {
+				if attr.MultiValued() {
+					return translate.Column{}, false
+				}
+			}
+			if column, ok := columns[path[len(path)-1].ID()]; ok {
+				return translate.Column{Expr: column}, true
+			}
+			return translate.Column{}, false
+		}),
+		translate.JSONBContainment(docColumn),
+	)
+}
+
+// Returns an error of spec.ErrUniqueness if err reports a violation of a unique index, naming the attribute of the
+// index if it was created by Schema; otherwise, returns the error of errDatabase.
+func (t *table) errWrite(err error) error {
+	if e, ok := err.(*pq.Error); ok && e.Code == uniqueViolationCode {
+		if path, ok := t.uniqueIndexes[e.Constraint]; ok {
+			return fmt.Errorf("%w: value of '%s' is not unique", spec.ErrUniqueness, path)
+		}
+		return fmt.Errorf("%w: %s", spec.ErrUniqueness, e.Message)
+	}
+	return errDatabase(err)
+}
+
+// Returns an error of spec.ErrConflict if err reports a transaction that failed because of concurrent transactions,
+// which may succeed when retried; otherwise, returns an error of spec.ErrInternal.
+func errDatabase(err error) error {
+	if e, ok := err.(*pq.Error); ok && (e.Code == serializationFailureCode || e.Code == deadlockDetectedCode) {
+		return fmt.Errorf("%w: %s", spec.ErrConflict, e.Message)
+	}
+	return fmt.Errorf("%w: %v", spec.ErrInternal, err)
+}
+
+func (c *generatedColumn) caseInsensitive() bool {
+	return c.attr.Type() == spec.TypeString && !c.attr.CaseExact()
+}
+
+func (c *generatedColumn) sqlType() string {
+	switch c.attr.Type() {
+	case spec.TypeInteger:
+		return "bigint"
+	case spec.TypeDecimal:
+		return "numeric"
+	case spec.TypeBoolean:
+		return "boolean"
+	default:
+		return "text"
+	}
+}
+
+// Returns the expression extracting the value of the attribute from the document, i.e. doc #>> '{"name","givenName"}'
+func (c *generatedColumn) extract() string {
+	elements := make([]string, 0, len(c.path))
+	for _, attr := range c.path {
+		elements = append(elements, `"`+strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(attr.Name())+`"`)
+	}
+	extract := docColumn + " #>> " + pq.QuoteLiteral("{"+strings.Join(elements, ",")+"}")
+	if sqlType := c.sqlType(); sqlType != "text" {
+		return "(" + extract + ")::" + sqlType
+	}
+	return extract
+}
+
+// Returns the identifier joining the parts with underscores, shortened with a hash suffix when it exceeds the length
+// limit of PostgreSQL, so that long identifiers remain distinct.
+func identifier(parts ...string) string {
+	id := strings.Join(parts, "_")
+	if len(id) <= maxIdentifierLength {
+		return id
+	}
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(id))
+	suffix := fmt.Sprintf("_%08x", h.Sum32())
+	return id[:maxIdentifierLength-len(suffix)] + suffix
+}
+
+// Returns the lower case name with characters other than letters, digits and underscores replaced by underscores.
+func sanitize(name string) string {
+	return strings.Map(func(r rune) rune {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') || r == '_' {
+			return r
+		}
+		return '_'
+	}, strings.ToLower(name))
+}
@@ -0,0 +1,189 @@
+package v2
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/imulab/go-scim/pkg/v2/crud"
+	"github.com/imulab/go-scim/pkg/v2/crud/translate"
+	"github.com/imulab/go-scim/pkg/v2/spec"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSchema(t *testing.T) {
+	s := new(SchemaTestSuite)
+	suite.Run(t, s)
+}
+
+type SchemaTestSuite struct {
+	suite.Suite
+	resourceType *spec.ResourceType
+}
+
+func (s *SchemaTestSuite) TestStatements() {
+	statements := Schema(s.resourceType, "users")
+	require.Len(s.T(), statements, 5)
+	assert.Equal(s.T(), `CREATE TABLE IF NOT EXISTS "users" ("id" text NOT NULL, "version" text NOT NULL DEFAULT '', "last_modified" timestamptz, "doc" jsonb NOT NULL, CONSTRAINT "users_pkey" PRIMARY KEY ("id"))`, statements[0])
+	assert.Equal(s.T(), `CREATE INDEX IF NOT EXISTS "users_doc_idx" ON "users" USING GIN ("doc" jsonb_path_ops)`, statements[1])
+	assert.Equal(s.T(), `CREATE INDEX IF NOT EXISTS "users_last_modified_idx" ON "users" ("last_modified")`, statements[2])
+	assert.Equal(s.T(), `ALTER TABLE "users" ADD COLUMN IF NOT EXISTS "c_username" text GENERATED ALWAYS AS ("doc" #>> '{"userName"}') STORED`, statements[3])
+	assert.Equal(s.T(), `CREATE UNIQUE INDEX IF NOT EXISTS "users_c_username_key" ON "users" (LOWER("c_username"))`, statements[4])
+}
+
+func (s *SchemaTestSuite) TestChangeStatements() {
+	statements := ChangeSchema("users")
+	require.Len(s.T(), statements, 3)
+	assert.True(s.T(), strings.HasPrefix(statements[0], `CREATE OR REPLACE FUNCTION "users_notify"() RETURNS trigger AS $$`))
+	assert.Contains(s.T(), statements[0], `PERFORM pg_notify('users_changes', json_build_object('op', TG_OP, 'id', r."id", 'version', r."version", 'time', clock_timestamp())::text);`)
+	assert.Equal(s.T(), `DROP TRIGGER IF EXISTS "users_changes" ON "users"`, statements[1])
+	assert.Equal(s.T(), `CREATE TRIGGER "users_changes" AFTER INSERT OR UPDATE OR DELETE ON "users" FOR EACH ROW EXECUTE FUNCTION "users_notify"()`, statements[2])
+}
+
+func (s *SchemaTestSuite) TestCompile() {
+	compiler := translate.SQLCompiler(s.resourceType, newTable(s.resourceType, "users").mapping(), translate.Dollar)
+
+	tests := []struct {
+		name       string
+		filter     string
+		sort       *crud.Sort
+		pagination *crud.Pagination
+		expect     func(t *testing.T, clause *translate.SQLClause, err error)
+	}{
+		{
+			name:   "generated column",
+			filter: `userName eq "foo"`,
+			expect: func(t *testing.T, clause *translate.SQLClause, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, `LOWER("c_username") = LOWER($1)`, clause.Where)
+			},
+		},
+		{
+			name:   "columns of their own",
+			filter: `id eq "foo" and meta.version eq "W/\"1\"" and meta.lastModified gt "2020-01-01T00:00:00Z"`,
+			expect: func(t *testing.T, clause *translate.SQLClause, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, `(("id" = $1 AND LOWER("version") = LOWER($2)) AND "last_modified" > $3)`, clause.Where)
+				assert.Equal(t, time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC), clause.Args[2])
+			},
+		},
+		{
+			name:   "containment",
+			filter: `active eq true and emails.primary eq true`,
+			expect: func(t *testing.T, clause *translate.SQLClause, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, `("doc" @> $1::jsonb AND "doc" @> $2::jsonb)`, clause.Where)
+				assert.Equal(t, []interface{}{`{"active":true}`, `{"emails":[{"primary":true}]}`}, clause.Args)
+			},
+		},
+		{
+			name:   "document",
+			filter: `emails.value sw "foo" or name.familyName eq "Qiu"`,
+			expect: func(t *testing.T, clause *translate.SQLClause, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, `(EXISTS (SELECT 1 FROM jsonb_array_elements("doc"->'emails') AS elem WHERE LOWER(elem->>'value') LIKE LOWER($1) ESCAPE '\') OR LOWER("doc"->'name'->>'familyName') = LOWER($2))`, clause.Where)
+			},
+		},
+		{
+			name:       "sort and pagination",
+			sort:       &crud.Sort{By: "userName", Order: crud.SortDesc},
+			pagination: &crud.Pagination{StartIndex: 11, Count: 10},
+			expect: func(t *testing.T, clause *translate.SQLClause, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, `CASE WHEN "c_username" IS NULL THEN 1 ELSE 0 END DESC, LOWER("c_username") DESC, "id" ASC`, clause.OrderBy)
+				assert.Equal(t, "LIMIT $1 OFFSET $2", clause.Limit)
+				assert.Equal(t, []interface{}{10, 10}, clause.Args)
+			},
+		},
+	}
+
+	for _, test := range tests {
+		s.T().Run(test.name, func(t *testing.T) {
+			clause, err := compiler.Compile(test.filter, test.sort, test.pagination)
+			test.expect(t, clause, err)
+		})
+	}
+}
+
+func (s *SchemaTestSuite) TestErrWrite() {
+	t := newTable(s.resourceType, "users")
+
+	err := t.errWrite(&pq.Error{Code: uniqueViolationCode, Constraint: "users_c_username_key"})
+	assert.True(s.T(), errors.Is(err, spec.ErrUniqueness))
+	assert.Contains(s.T(), err.Error(), "'userName'")
+
+	err = t.errWrite(&pq.Error{Code: uniqueViolationCode, Constraint: "users_pkey"})
+	assert.True(s.T(), errors.Is(err, spec.ErrUniqueness))
+	assert.Contains(s.T(), err.Error(), "'id'")
+
+	assert.True(s.T(), errors.Is(t.errWrite(&pq.Error{Code: serializationFailureCode}), spec.ErrConflict))
+	assert.True(s.T(), errors.Is(t.errWrite(fmt.Errorf("connection reset")), spec.ErrInternal))
+}
+
+func (s *SchemaTestSuite) TestIdentifier() {
+	assert.Equal(s.T(), "users_c_username_key", identifier("users", "c_username", "key"))
+
+	long := identifier("users", "c", sanitize("urn:ietf:params:scim:schemas:extension:enterprise:2.0:User_employeeNumber"))
+	other := identifier("users", "c", sanitize("urn:ietf:params:scim:schemas:extension:enterprise:2.0:User_costCenter"))
+	assert.Len(s.T(), long, maxIdentifierLength)
+	assert.True(s.T(), strings.HasPrefix(long, "users_c_urn_ietf_params_scim_schemas_extension"))
+	assert.NotEqual(s.T(), long, other)
+}
+
+func (s *SchemaTestSuite) SetupSuite() {
+	for _, each := range []struct {
+		filepath  string
+		structure interface{}
+		post      func(parsed interface{})
+	}{
+		{
+			filepath:  "../../public/schemas/core_schema.json",
+			structure: new(spec.Schema),
+			post: func(parsed interface{}) {
+				spec.Schemas().Register(parsed.(*spec.Schema))
+			},
+		},
+		{
+			filepath:  "../../public/schemas/user_schema.json",
+			structure: new(spec.Schema),
+			post: func(parsed interface{}) {
+				spec.Schemas().Register(parsed.(*spec.Schema))
+			},
+		},
+		{
+			filepath:  "../../public/schemas/user_enterprise_extension_schema.json",
+			structure: new(spec.Schema),
+			post: func(parsed interface{}) {
+				spec.Schemas().Register(parsed.(*spec.Schema))
+			},
+		},
+		{
+			filepath:  "../../public/resource_types/user_resource_type.json",
+			structure: new(spec.ResourceType),
+			post: func(parsed interface{}) {
+				s.resourceType = parsed.(*spec.ResourceType)
+				crud.Register(s.resourceType)
+			},
+		},
+	} {
+		f, err := os.Open(each.filepath)
+		require.Nil(s.T(), err)
+
+		raw, err := ioutil.ReadAll(f)
+		require.Nil(s.T(), err)
+
+		err = json.Unmarshal(raw, each.structure)
+		require.Nil(s.T(), err)
+
+		if each.post != nil {
+			each.post(each.structure)
+		}
+	}
+}
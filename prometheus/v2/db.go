@@ -0,0 +1,51 @@
+package v2
+
+import (
+	"context"
+	"github.com/imulab/go-scim/pkg/v2/db"
+	"github.com/imulab/go-scim/pkg/v2/spec"
+	"github.com/prometheus/client_golang/prometheus"
+	"time"
+)
+
+// DB returns a db.DB that counts the calls to the database of the resource type, by operation and scimType of the
+// error, observes their latency, and the number of resources they read, count or write (see db.Instrumented). The
+// operations are named after the methods, i.e. insert, get and query_cursor.
+//
+// The returned DB also implements db.CursorDB, returning an error of spec.ErrInvalidSyntax if the database does not,
+// db.BatchDB, db.BulkWriteDB, and db.TxDB, which calls db.WithTx on the database. Transactions are observed as the
+// transaction operation, whose latency includes the calls within, and whose size is not observed. Bulk writes are
+// observed once, with the scimType of the first resource that failed. It implements db.ChangeStreamDB as well, by
+// calling db.Subscribe on the database; subscriptions are not observed, as they last until their context is done.
+func (m *Metrics) DB(resourceType *spec.ResourceType, database db.DB) db.CursorDB {
+	return db.Instrumented(resourceType, database, m.observeDB).(db.CursorDB)
+}
+
+func (m *Metrics) observeDB(o db.Observation) {
+	m.dbOperations.WithLabelValues(o.ResourceType, o.Method, scimType(o.Err)).Inc()
+	m.dbLatency.WithLabelValues(o.ResourceType, o.Method).Observe(o.Duration.Seconds())
+	if o.Method != "transaction" {
+		m.dbResults.WithLabelValues(o.ResourceType, o.Method).Observe(float64(o.Size))
+	}
+}
+
+// CountResources registers the db_resources gauge of the resource type, which counts the resources in the database
+// every time the metrics are collected, waiting at most the timeout, or reports -1 if the count fails. Since the count may be expensive, i.e. for large
+// databases, scrapes should not be too frequent. The context of the count is derived from ctx, which may carry a
+// tenant, as required by db.TenantDB.
+func (m *Metrics) CountResources(ctx context.Context, resourceType *spec.ResourceType, database db.DB, timeout time.Duration) error {
+	return m.registerer.Register(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace:   m.namespace,
+		Name:        "db_resources",
+		Help:        "Number of resources in the database.",
+		ConstLabels: prometheus.Labels{"resource_type": resourceType.ID()},
+	}, func() float64 {
+		ctx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+		n, err := database.Count(ctx, "")
+		if err != nil {
+			return -1
+		}
+		return float64(n)
+	}))
+}
@@ -0,0 +1,3 @@
+// This package provides optional instrumentation of the services, databases and HTTP handlers with Prometheus metrics,
+// i.e. request counts, latencies and error classes, resource counts, and the time spent parsing and evaluating filters.
+package v2
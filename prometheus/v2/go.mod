@@ -0,0 +1,11 @@
+module github.com/imulab/go-scim/prometheus/v2
+
+go 1.13
+
+require (
+	github.com/imulab/go-scim/pkg/v2 v2.0.0
+	github.com/prometheus/client_golang v1.11.0
+	github.com/stretchr/testify v1.4.0
+)
+
+replace github.com/imulab/go-scim/pkg/v2 => ../../pkg/v2
@@ -0,0 +1,24 @@
+package v2
+
+import (
+	"github.com/imulab/go-scim/pkg/v2/groupsync"
+)
+
+// ObserveGroupSync records the observation of a group sync message, and is meant to be the observer of
+// groupsync.ConsumeOptions. It counts the messages by outcome, i.e. applied or dead_lettered, the failed attempts to
+// apply them, and observes their lag, if known, so that alerts can fire when the workers fall behind or keep failing.
+func (m *Metrics) ObserveGroupSync(o groupsync.Observation) {
+	m.syncMessages.WithLabelValues(o.Outcome).Inc()
+
+	failed := o.Attempts
+	if o.Outcome == groupsync.OutcomeApplied {
+		failed--
+	}
+	if failed > 0 {
+		m.syncFailures.Add(float64(failed))
+	}
+
+	if o.Lag > 0 {
+		m.syncLag.Observe(o.Lag.Seconds())
+	}
+}
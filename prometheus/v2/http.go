@@ -0,0 +1,32 @@
+package v2
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Handler returns a http.Handler that counts the requests handled by next, by method, route and status, and observes
+// their latency. The route is the pattern of the path served by next, i.e. "/Users/:id", rather than the path itself,
+// so that the number of series stays bounded.
+func (m *Metrics) Handler(route string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		recorder := &statusRecorder{ResponseWriter: rw, status: http.StatusOK}
+		next.ServeHTTP(recorder, r)
+
+		m.httpRequests.WithLabelValues(r.Method, route, strconv.Itoa(recorder.status)).Inc()
+		m.httpLatency.WithLabelValues(r.Method, route).Observe(time.Since(start).Seconds())
+	})
+}
+
+// Records the status written to the wrapped http.ResponseWriter.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
@@ -0,0 +1,166 @@
+package v2
+
+import (
+	"errors"
+	"github.com/imulab/go-scim/pkg/v2/crud"
+	"github.com/imulab/go-scim/pkg/v2/crud/expr"
+	"github.com/imulab/go-scim/pkg/v2/spec"
+	"github.com/prometheus/client_golang/prometheus"
+	"time"
+)
+
+// Metrics are the collectors of the instrumentation. The metrics are named after the namespace, i.e.
+// scim_service_requests_total for namespace scim:
+//
+//	service_requests_total{resource_type, operation, scim_type}        calls to the services, see Interceptor
+//	service_request_duration_seconds{resource_type, operation}         latency of the services
+//	db_operations_total{resource_type, operation, scim_type}           calls to the databases, see DB
+//	db_operation_duration_seconds{resource_type, operation}            latency of the databases
+//	db_operation_results{resource_type, operation}                     resources read, counted or written by the databases
+//	db_resources{resource_type}                                        number of resources, see CountResources
+//	http_requests_total{method, route, status}                         HTTP requests, see Handler
+//	http_request_duration_seconds{method, route}                       latency of the HTTP requests
+//	filter_parse_duration_seconds{result}                              time spent parsing filters, see ObserveFilters
+//	filter_evaluate_duration_seconds{result}                           time spent evaluating filters
+//	group_sync_messages_total{outcome}                                 group sync messages consumed, see ObserveGroupSync
+//	group_sync_failed_attempts_total                                   attempts to apply group sync messages that failed
+//	group_sync_lag_seconds                                             time from the membership change to its sync
+//
+// The scim_type label is empty for calls that succeed, and is the scimType of the error otherwise, or "internal" for
+// errors other than spec.Error, so that i.e. uniqueness violations can be told apart from failures of the database.
+// The result label is either "ok" or "error".
+type Metrics struct {
+	namespace       string
+	registerer      prometheus.Registerer
+	serviceRequests *prometheus.CounterVec
+	serviceLatency  *prometheus.HistogramVec
+	dbOperations    *prometheus.CounterVec
+	dbLatency       *prometheus.HistogramVec
+	dbResults       *prometheus.HistogramVec
+	httpRequests    *prometheus.CounterVec
+	httpLatency     *prometheus.HistogramVec
+	filterParse     *prometheus.HistogramVec
+	filterEvaluate  *prometheus.HistogramVec
+	syncMessages    *prometheus.CounterVec
+	syncFailures    prometheus.Counter
+	syncLag         prometheus.Histogram
+}
+
+// New creates the metrics in the namespace, and registers them with the registerer, i.e. prometheus.DefaultRegisterer.
+func New(registerer prometheus.Registerer, namespace string) (*Metrics, error) {
+	m := &Metrics{
+		namespace:  namespace,
+		registerer: registerer,
+		serviceRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "service_requests_total",
+			Help:      "Number of calls to the resource services.",
+		}, []string{"resource_type", "operation", "scim_type"}),
+		serviceLatency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "service_request_duration_seconds",
+			Help:      "Latency of the calls to the resource services.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"resource_type", "operation"}),
+		dbOperations: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "db_operations_total",
+			Help:      "Number of calls to the databases.",
+		}, []string{"resource_type", "operation", "scim_type"}),
+		dbLatency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "db_operation_duration_seconds",
+			Help:      "Latency of the calls to the databases.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"resource_type", "operation"}),
+		dbResults: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "db_operation_results",
+			Help:      "Number of resources read, counted or written by the calls to the databases.",
+			Buckets:   []float64{0, 1, 10, 50, 100, 500, 1000, 5000, 10000, 100000},
+		}, []string{"resource_type", "operation"}),
+		httpRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "http_requests_total",
+			Help:      "Number of HTTP requests.",
+		}, []string{"method", "route", "status"}),
+		httpLatency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "http_request_duration_seconds",
+			Help:      "Latency of the HTTP requests.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"method", "route"}),
+		filterParse: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "filter_parse_duration_seconds",
+			Help:      "Time spent parsing SCIM filters.",
+			Buckets:   []float64{1e-6, 5e-6, 1e-5, 5e-5, 1e-4, 5e-4, 1e-3, 5e-3},
+		}, []string{"result"}),
+		filterEvaluate: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "filter_evaluate_duration_seconds",
+			Help:      "Time spent evaluating SCIM filters against a resource in memory.",
+			Buckets:   []float64{1e-6, 5e-6, 1e-5, 5e-5, 1e-4, 5e-4, 1e-3, 5e-3},
+		}, []string{"result"}),
+		syncMessages: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "group_sync_messages_total",
+			Help:      "Number of group sync messages consumed, by outcome.",
+		}, []string{"outcome"}),
+		syncFailures: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "group_sync_failed_attempts_total",
+			Help:      "Number of attempts to apply group sync messages that failed.",
+		}),
+		syncLag: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "group_sync_lag_seconds",
+			Help:      "Time from the change of memberships to the outcome of their group sync messages.",
+			Buckets:   []float64{0.1, 0.5, 1, 5, 10, 30, 60, 300, 900, 3600},
+		}),
+	}
+
+	for _, c := range []prometheus.Collector{
+		m.serviceRequests, m.serviceLatency,
+		m.dbOperations, m.dbLatency, m.dbResults,
+		m.httpRequests, m.httpLatency,
+		m.filterParse, m.filterEvaluate,
+		m.syncMessages, m.syncFailures, m.syncLag,
+	} {
+		if err := registerer.Register(c); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// ObserveFilters starts recording the time spent parsing and evaluating filters in memory, by all the databases and
+// services of the process (see expr.SetCompileObserver and crud.SetEvaluateObserver). Since the evaluation of each
+// resource is observed, this incurs a small overhead on in-memory queries.
+func (m *Metrics) ObserveFilters() {
+	expr.SetCompileObserver(func(d time.Duration, err error) {
+		m.filterParse.WithLabelValues(result(err)).Observe(d.Seconds())
+	})
+	crud.SetEvaluateObserver(func(d time.Duration, err error) {
+		m.filterEvaluate.WithLabelValues(result(err)).Observe(d.Seconds())
+	})
+}
+
+// Returns the scimType label of the error.
+func scimType(err error) string {
+	if err == nil {
+		return ""
+	}
+	var scimErr *spec.Error
+	if errors.As(err, &scimErr) {
+		return scimErr.Type
+	}
+	return spec.ErrInternal.Type
+}
+
+func result(err error) string {
+	if err != nil {
+		return "error"
+	}
+	return "ok"
+}
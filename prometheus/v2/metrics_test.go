@@ -0,0 +1,265 @@
+package v2
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/imulab/go-scim/pkg/v2/crud"
+	"github.com/imulab/go-scim/pkg/v2/crud/expr"
+	"github.com/imulab/go-scim/pkg/v2/db"
+	"github.com/imulab/go-scim/pkg/v2/groupsync"
+	"github.com/imulab/go-scim/pkg/v2/prop"
+	"github.com/imulab/go-scim/pkg/v2/service"
+	"github.com/imulab/go-scim/pkg/v2/service/filter"
+	"github.com/imulab/go-scim/pkg/v2/spec"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMetrics(t *testing.T) {
+	s := new(MetricsTestSuite)
+	suite.Run(t, s)
+}
+
+type MetricsTestSuite struct {
+	suite.Suite
+	resourceType *spec.ResourceType
+}
+
+func (s *MetricsTestSuite) TestServicesAndDatabases() {
+	var (
+		registry = prometheus.NewRegistry()
+		ctx      = context.Background()
+	)
+	metrics, err := New(registry, "scim")
+	require.Nil(s.T(), err)
+
+	database := metrics.DB(s.resourceType, db.Memory())
+	create := service.Interceptors(metrics.Interceptor()).Create(s.resourceType, service.CreateService(s.resourceType, database, []filter.ByResource{
+		filter.ByPropertyToByResource(filter.UUIDFilter()),
+		filter.MetaFilter(),
+		filter.ByPropertyToByResource(filter.ValidationFilter(database)),
+	}))
+
+	for _, payload := range []string{
+		`{"schemas":["urn:ietf:params:scim:schemas:core:2.0:User"],"userName":"foo","emails":[{"value":"foo@example.com"}]}`,
+		`{"schemas":["urn:ietf:params:scim:schemas:core:2.0:User"],"userName":"foo","emails":[{"value":"foo@example.com"}]}`,
+		`{"schemas":["urn:ietf:params:scim:schemas:core:2.0:User"]}`,
+	} {
+		_, _ = create.Do(ctx, &service.CreateRequest{PayloadSource: strings.NewReader(payload)})
+	}
+	require.Nil(s.T(), metrics.CountResources(ctx, s.resourceType, database, time.Second))
+
+	assert.Equal(s.T(), float64(1), testutil.ToFloat64(metrics.serviceRequests.WithLabelValues("User", service.OpCreate, "")))
+	assert.Equal(s.T(), float64(1), testutil.ToFloat64(metrics.serviceRequests.WithLabelValues("User", service.OpCreate, "uniqueness")))
+	assert.Equal(s.T(), float64(1), testutil.ToFloat64(metrics.serviceRequests.WithLabelValues("User", service.OpCreate, "invalidValue")))
+	assert.Equal(s.T(), float64(1), testutil.ToFloat64(metrics.dbOperations.WithLabelValues("User", "insert", "")))
+	assert.Equal(s.T(), 1, testutil.CollectAndCount(metrics.serviceLatency))
+
+	assert.Nil(s.T(), testutil.GatherAndCompare(registry, strings.NewReader(`
+# HELP scim_db_resources Number of resources in the database.
+# TYPE scim_db_resources gauge
+scim_db_resources{resource_type="User"} 1
+`), "scim_db_resources"))
+}
+
+func (s *MetricsTestSuite) TestDatabaseResults() {
+	var (
+		registry = prometheus.NewRegistry()
+		ctx      = context.Background()
+	)
+	metrics, err := New(registry, "scim")
+	require.Nil(s.T(), err)
+
+	database := metrics.DB(s.resourceType, db.Memory())
+	for _, id := range []string{"foo", "bar"} {
+		r := prop.NewResource(s.resourceType)
+		require.Nil(s.T(), r.Navigator().Replace(map[string]interface{}{
+			"schemas":  []interface{}{"urn:ietf:params:scim:schemas:core:2.0:User"},
+			"id":       id,
+			"userName": id,
+		}).Error())
+		require.Nil(s.T(), database.Insert(ctx, r))
+	}
+	results, err := database.Query(ctx, `userName pr`, nil, nil, nil)
+	require.Nil(s.T(), err)
+	require.Len(s.T(), results, 2)
+	require.Nil(s.T(), db.WithTx(ctx, database, func(ctx context.Context) error { return nil }))
+
+	// transactions are not observed
+	assert.Nil(s.T(), testutil.GatherAndCompare(registry, strings.NewReader(`
+# HELP scim_db_operation_results Number of resources read, counted or written by the calls to the databases.
+# TYPE scim_db_operation_results histogram
+scim_db_operation_results_bucket{operation="insert",resource_type="User",le="0"} 0
+scim_db_operation_results_bucket{operation="insert",resource_type="User",le="1"} 2
+scim_db_operation_results_bucket{operation="insert",resource_type="User",le="10"} 2
+scim_db_operation_results_bucket{operation="insert",resource_type="User",le="50"} 2
+scim_db_operation_results_bucket{operation="insert",resource_type="User",le="100"} 2
+scim_db_operation_results_bucket{operation="insert",resource_type="User",le="500"} 2
+scim_db_operation_results_bucket{operation="insert",resource_type="User",le="1000"} 2
+scim_db_operation_results_bucket{operation="insert",resource_type="User",le="5000"} 2
+scim_db_operation_results_bucket{operation="insert",resource_type="User",le="10000"} 2
+scim_db_operation_results_bucket{operation="insert",resource_type="User",le="100000"} 2
+scim_db_operation_results_bucket{operation="insert",resource_type="User",le="+Inf"} 2
+scim_db_operation_results_sum{operation="insert",resource_type="User"} 2
+scim_db_operation_results_count{operation="insert",resource_type="User"} 2
+scim_db_operation_results_bucket{operation="query",resource_type="User",le="0"} 0
+scim_db_operation_results_bucket{operation="query",resource_type="User",le="1"} 0
+scim_db_operation_results_bucket{operation="query",resource_type="User",le="10"} 1
+scim_db_operation_results_bucket{operation="query",resource_type="User",le="50"} 1
+scim_db_operation_results_bucket{operation="query",resource_type="User",le="100"} 1
+scim_db_operation_results_bucket{operation="query",resource_type="User",le="500"} 1
+scim_db_operation_results_bucket{operation="query",resource_type="User",le="1000"} 1
+scim_db_operation_results_bucket{operation="query",resource_type="User",le="5000"} 1
+scim_db_operation_results_bucket{operation="query",resource_type="User",le="10000"} 1
+scim_db_operation_results_bucket{operation="query",resource_type="User",le="100000"} 1
+scim_db_operation_results_bucket{operation="query",resource_type="User",le="+Inf"} 1
+scim_db_operation_results_sum{operation="query",resource_type="User"} 2
+scim_db_operation_results_count{operation="query",resource_type="User"} 1
+`), "scim_db_operation_results"))
+	assert.Equal(s.T(), float64(1), testutil.ToFloat64(metrics.dbOperations.WithLabelValues("User", "transaction", "")))
+}
+
+func (s *MetricsTestSuite) TestObserveGroupSync() {
+	metrics, err := New(prometheus.NewRegistry(), "scim")
+	require.Nil(s.T(), err)
+
+	for _, o := range []groupsync.Observation{
+		{Outcome: groupsync.OutcomeApplied, Attempts: 1, Lag: time.Second},
+		{Outcome: groupsync.OutcomeApplied, Attempts: 3, Lag: 2 * time.Second},
+		{Outcome: groupsync.OutcomeDeadLettered, Attempts: 5, Err: spec.ErrConflict, Lag: time.Minute},
+		{Outcome: groupsync.OutcomeDropped, Err: spec.ErrInvalidSyntax},
+	} {
+		metrics.ObserveGroupSync(o)
+	}
+
+	assert.Equal(s.T(), float64(2), testutil.ToFloat64(metrics.syncMessages.WithLabelValues(groupsync.OutcomeApplied)))
+	assert.Equal(s.T(), float64(1), testutil.ToFloat64(metrics.syncMessages.WithLabelValues(groupsync.OutcomeDeadLettered)))
+	assert.Equal(s.T(), float64(1), testutil.ToFloat64(metrics.syncMessages.WithLabelValues(groupsync.OutcomeDropped)))
+	assert.Equal(s.T(), float64(7), testutil.ToFloat64(metrics.syncFailures))
+	assert.Nil(s.T(), testutil.CollectAndCompare(metrics.syncLag, strings.NewReader(`
+# HELP scim_group_sync_lag_seconds Time from the change of memberships to the outcome of their group sync messages.
+# TYPE scim_group_sync_lag_seconds histogram
+scim_group_sync_lag_seconds_bucket{le="0.1"} 0
+scim_group_sync_lag_seconds_bucket{le="0.5"} 0
+scim_group_sync_lag_seconds_bucket{le="1"} 1
+scim_group_sync_lag_seconds_bucket{le="5"} 2
+scim_group_sync_lag_seconds_bucket{le="10"} 2
+scim_group_sync_lag_seconds_bucket{le="30"} 2
+scim_group_sync_lag_seconds_bucket{le="60"} 3
+scim_group_sync_lag_seconds_bucket{le="300"} 3
+scim_group_sync_lag_seconds_bucket{le="900"} 3
+scim_group_sync_lag_seconds_bucket{le="3600"} 3
+scim_group_sync_lag_seconds_bucket{le="+Inf"} 3
+scim_group_sync_lag_seconds_sum 63
+scim_group_sync_lag_seconds_count 3
+`)))
+}
+
+func (s *MetricsTestSuite) TestHandler() {
+	metrics, err := New(prometheus.NewRegistry(), "scim")
+	require.Nil(s.T(), err)
+
+	handler := metrics.Handler("/Users/:id", http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "missing") {
+			rw.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = rw.Write([]byte("{}"))
+	}))
+	for _, path := range []string{"/Users/foo", "/Users/bar", "/Users/missing"} {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	assert.Equal(s.T(), float64(2), testutil.ToFloat64(metrics.httpRequests.WithLabelValues("GET", "/Users/:id", "200")))
+	assert.Equal(s.T(), float64(1), testutil.ToFloat64(metrics.httpRequests.WithLabelValues("GET", "/Users/:id", "404")))
+}
+
+func (s *MetricsTestSuite) TestObserveFilters() {
+	metrics, err := New(prometheus.NewRegistry(), "scim")
+	require.Nil(s.T(), err)
+
+	metrics.ObserveFilters()
+	defer func() {
+		expr.SetCompileObserver(nil)
+		crud.SetEvaluateObserver(nil)
+	}()
+
+	_, err = expr.CompileFilter(`userName eq "foo"`)
+	assert.Nil(s.T(), err)
+	_, err = expr.CompileFilter(`userName eq`)
+	assert.NotNil(s.T(), err)
+	_, err = crud.Evaluate(prop.NewResource(s.resourceType), `userName eq "foo"`)
+	assert.Nil(s.T(), err)
+
+	// one series for each result
+	assert.Equal(s.T(), 2, testutil.CollectAndCount(metrics.filterParse))
+	assert.Equal(s.T(), 1, testutil.CollectAndCount(metrics.filterEvaluate))
+}
+
+func (s *MetricsTestSuite) TestScimType() {
+	assert.Equal(s.T(), "", scimType(nil))
+	assert.Equal(s.T(), "uniqueness", scimType(fmt.Errorf("%w: taken", spec.ErrUniqueness)))
+	assert.Equal(s.T(), "internal", scimType(fmt.Errorf("boom")))
+}
+
+func (s *MetricsTestSuite) SetupSuite() {
+	for _, each := range []struct {
+		filepath  string
+		structure interface{}
+		post      func(parsed interface{})
+	}{
+		{
+			filepath:  "../../public/schemas/core_schema.json",
+			structure: new(spec.Schema),
+			post: func(parsed interface{}) {
+				spec.Schemas().Register(parsed.(*spec.Schema))
+			},
+		},
+		{
+			filepath:  "../../public/schemas/user_schema.json",
+			structure: new(spec.Schema),
+			post: func(parsed interface{}) {
+				spec.Schemas().Register(parsed.(*spec.Schema))
+			},
+		},
+		{
+			filepath:  "../../public/schemas/user_enterprise_extension_schema.json",
+			structure: new(spec.Schema),
+			post: func(parsed interface{}) {
+				spec.Schemas().Register(parsed.(*spec.Schema))
+			},
+		},
+		{
+			filepath:  "../../public/resource_types/user_resource_type.json",
+			structure: new(spec.ResourceType),
+			post: func(parsed interface{}) {
+				s.resourceType = parsed.(*spec.ResourceType)
+				crud.Register(s.resourceType)
+			},
+		},
+	} {
+		f, err := os.Open(each.filepath)
+		require.Nil(s.T(), err)
+
+		raw, err := ioutil.ReadAll(f)
+		require.Nil(s.T(), err)
+
+		err = json.Unmarshal(raw, each.structure)
+		require.Nil(s.T(), err)
+
+		if each.post != nil {
+			each.post(each.structure)
+		}
+	}
+}
@@ -0,0 +1,36 @@
+package v2
+
+import (
+	"context"
+	"github.com/imulab/go-scim/pkg/v2/service"
+	"time"
+)
+
+// Interceptor returns an Interceptor that counts the calls to the services it wraps (see service.Interceptors), by
+// resource type, operation and scimType of the error, and observes their latency.
+func (m *Metrics) Interceptor() service.Interceptor {
+	return &metricsInterceptor{metrics: m}
+}
+
+type metricsInterceptor struct {
+	metrics *Metrics
+}
+
+type startKey struct{}
+
+func (i *metricsInterceptor) Before(ctx context.Context, _ *service.Invocation) (context.Context, error) {
+	return context.WithValue(ctx, startKey{}, time.Now()), nil
+}
+
+func (i *metricsInterceptor) After(ctx context.Context, inv *service.Invocation, err error) error {
+	resourceType := ""
+	if inv.ResourceType != nil {
+		resourceType = inv.ResourceType.ID()
+	}
+
+	i.metrics.serviceRequests.WithLabelValues(resourceType, inv.Operation, scimType(err)).Inc()
+	if start, ok := ctx.Value(startKey{}).(time.Time); ok {
+		i.metrics.serviceLatency.WithLabelValues(resourceType, inv.Operation).Observe(time.Since(start).Seconds())
+	}
+	return err
+}
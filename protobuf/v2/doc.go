@@ -0,0 +1,6 @@
+// This package provides the protobuf representation of SCIM resources, list responses, patch requests and errors, along
+// with converters to and from the property tree, so SCIM data can be carried between internal services without the
+// round trip through JSON. The ResourceService of NewServer serves the resource services over gRPC with it.
+package v2
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative scim.proto service.proto
@@ -0,0 +1,85 @@
+package v2
+
+import (
+	"errors"
+	"github.com/imulab/go-scim/pkg/v2/spec"
+)
+
+// ErrorToProto converts the error to its protobuf representation. Errors not wrapping a *spec.Error are treated
+// as internal errors. The detail is the full error message.
+func ErrorToProto(err error) *Error {
+	message := &Error{
+		Status:   int32(spec.ErrInternal.Status),
+		ScimType: spec.ErrInternal.Type,
+		Detail:   err.Error(),
+	}
+
+	var scimError *spec.Error
+	if errors.As(err, &scimError) {
+		message.Status = int32(scimError.Status)
+		message.ScimType = scimError.Type
+	}
+
+	return message
+}
+
+// ErrorFromProto converts the protobuf representation back to an error. When the scimType matches one of the error
+// prototypes in the spec package, the returned error wraps that prototype so that errors.Is works as expected on both
+// ends of the wire.
+func ErrorFromProto(message *Error) error {
+	for _, each := range []*spec.Error{
+		spec.ErrInvalidFilter,
+		spec.ErrTooMany,
+		spec.ErrUniqueness,
+		spec.ErrMutability,
+		spec.ErrInvalidSyntax,
+		spec.ErrInvalidPath,
+		spec.ErrNoTarget,
+		spec.ErrInvalidValue,
+		spec.ErrNotFound,
+		spec.ErrSensitive,
+		spec.ErrConflict,
+		spec.ErrInvalidCursor,
+		spec.ErrPayloadTooLarge,
+		spec.ErrUnauthorized,
+		spec.ErrForbidden,
+		spec.ErrQuotaExceeded,
+		spec.ErrTooManyRequests,
+		spec.ErrNotImplemented,
+		spec.ErrMethodNotAllowed,
+		spec.ErrUnsupportedMediaType,
+		spec.ErrNotAcceptable,
+		spec.ErrInvalidVersion,
+		spec.ErrInternal,
+	} {
+		if each.Type == message.GetScimType() && each.Status == int(message.GetStatus()) {
+			return &wireError{cause: each, detail: message.GetDetail()}
+		}
+	}
+	return &wireError{
+		cause:  &spec.Error{Status: int(message.GetStatus()), Type: message.GetScimType()},
+		detail: message.GetDetail(),
+	}
+}
+
+// wireError is an error received over the wire. It keeps the original detail as its message, which already includes
+// the scimType, while still unwrapping to the spec error.
+type wireError struct {
+	cause  *spec.Error
+	detail string
+}
+
+func (e *wireError) Error() string {
+	if len(e.detail) == 0 {
+		return e.cause.Error()
+	}
+	return e.detail
+}
+
+func (e *wireError) Unwrap() error {
+	return e.cause
+}
+
+var (
+	_ error = (*wireError)(nil)
+)
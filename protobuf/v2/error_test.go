@@ -0,0 +1,104 @@
+package v2
+
+import (
+	"errors"
+	"fmt"
+	"github.com/imulab/go-scim/pkg/v2/spec"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"testing"
+)
+
+func TestError(t *testing.T) {
+	tests := []struct {
+		name   string
+		err    error
+		expect func(t *testing.T, message *Error, converted error)
+	}{
+		{
+			name: "wrapped spec error",
+			err:  fmt.Errorf("%w: userName is already taken", spec.ErrUniqueness),
+			expect: func(t *testing.T, message *Error, converted error) {
+				assert.Equal(t, int32(409), message.GetStatus())
+				assert.Equal(t, "uniqueness", message.GetScimType())
+				assert.True(t, errors.Is(converted, spec.ErrUniqueness))
+				assert.Equal(t, "uniqueness: userName is already taken", converted.Error())
+			},
+		},
+		{
+			name: "wrapped spec error of a status shared with others",
+			err:  fmt.Errorf("%w: request body exceeds 1024 bytes", spec.ErrPayloadTooLarge),
+			expect: func(t *testing.T, message *Error, converted error) {
+				assert.Equal(t, int32(413), message.GetStatus())
+				assert.Equal(t, "tooLarge", message.GetScimType())
+				assert.True(t, errors.Is(converted, spec.ErrPayloadTooLarge))
+			},
+		},
+		{
+			name: "arbitrary error",
+			err:  errors.New("boom"),
+			expect: func(t *testing.T, message *Error, converted error) {
+				assert.Equal(t, int32(500), message.GetStatus())
+				assert.Equal(t, "internal", message.GetScimType())
+				assert.True(t, errors.Is(converted, spec.ErrInternal))
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			message := ErrorToProto(test.err)
+			test.expect(t, message, ErrorFromProto(message))
+		})
+	}
+}
+
+func TestErrorStatus(t *testing.T) {
+	tests := []struct {
+		name   string
+		err    error
+		code   codes.Code
+		expect *spec.Error
+	}{
+		{
+			name:   "wrapped spec error",
+			err:    ErrorToStatus(fmt.Errorf("%w: userName is already taken", spec.ErrUniqueness)).Err(),
+			code:   codes.AlreadyExists,
+			expect: spec.ErrUniqueness,
+		},
+		{
+			name:   "wrapped spec error of a code shared with others",
+			err:    ErrorToStatus(fmt.Errorf("%w: bad cursor", spec.ErrInvalidCursor)).Err(),
+			code:   codes.InvalidArgument,
+			expect: spec.ErrInvalidCursor,
+		},
+		{
+			name:   "arbitrary error",
+			err:    ErrorToStatus(errors.New("boom")).Err(),
+			code:   codes.Internal,
+			expect: spec.ErrInternal,
+		},
+		{
+			name:   "status without details",
+			err:    status.Error(codes.PermissionDenied, "denied"),
+			code:   codes.PermissionDenied,
+			expect: spec.ErrForbidden,
+		},
+		{
+			name:   "not a status",
+			err:    errors.New("boom"),
+			code:   codes.Unknown,
+			expect: spec.ErrInternal,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.code, status.Code(test.err))
+			assert.True(t, errors.Is(ErrorFromStatus(test.err), test.expect))
+		})
+	}
+
+	assert.Nil(t, ErrorFromStatus(nil))
+}
@@ -0,0 +1,12 @@
+module github.com/imulab/go-scim/protobuf/v2
+
+go 1.13
+
+require (
+	github.com/imulab/go-scim/pkg/v2 v2.0.0
+	github.com/stretchr/testify v1.7.0
+	google.golang.org/grpc v1.50.1
+	google.golang.org/protobuf v1.28.1
+)
+
+replace github.com/imulab/go-scim/pkg/v2 => ../../pkg/v2
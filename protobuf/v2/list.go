@@ -0,0 +1,62 @@
+package v2
+
+import (
+	"fmt"
+	"github.com/imulab/go-scim/pkg/v2/prop"
+	"github.com/imulab/go-scim/pkg/v2/service"
+	"github.com/imulab/go-scim/pkg/v2/spec"
+)
+
+// ListResponseToProto converts the query service response to its protobuf representation. All resources in the
+// response are expected to be *prop.Resource, as returned by the query service.
+func ListResponseToProto(resp *service.QueryResponse) (*ListResponse, error) {
+	message := &ListResponse{
+		TotalResults: int64(resp.TotalResults),
+		StartIndex:   int64(resp.StartIndex),
+		ItemsPerPage: int64(resp.ItemsPerPage),
+		NextCursor:   resp.NextCursor,
+		Resources:    make([]*Resource, 0, len(resp.Resources)),
+	}
+
+	for _, each := range resp.Resources {
+		resource, ok := each.(*prop.Resource)
+		if !ok {
+			return nil, fmt.Errorf("%w: list response contains non-resource element", spec.ErrInternal)
+		}
+		message.Resources = append(message.Resources, ResourceToProto(resource))
+	}
+
+	return message, nil
+}
+
+// ListResponseFromProto converts the protobuf representation back to a query service response. The resourceTypes
+// are used to look up the resource type of each resource by id, so that a response from a root query may be converted.
+func ListResponseFromProto(message *ListResponse, resourceTypes ...*spec.ResourceType) (*service.QueryResponse, error) {
+	resp := &service.QueryResponse{
+		TotalResults: int(message.GetTotalResults()),
+		StartIndex:   int(message.GetStartIndex()),
+		ItemsPerPage: int(message.GetItemsPerPage()),
+		NextCursor:   message.GetNextCursor(),
+	}
+
+	for _, each := range message.GetResources() {
+		var resourceType *spec.ResourceType
+		for _, rt := range resourceTypes {
+			if rt.ID() == each.GetResourceType() {
+				resourceType = rt
+				break
+			}
+		}
+		if resourceType == nil {
+			return nil, fmt.Errorf("%w: unknown resource type '%s'", spec.ErrInvalidValue, each.GetResourceType())
+		}
+
+		resource, err := ResourceFromProto(each, resourceType)
+		if err != nil {
+			return nil, err
+		}
+		resp.Resources = append(resp.Resources, resource)
+	}
+
+	return resp, nil
+}
@@ -0,0 +1,131 @@
+package v2
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/imulab/go-scim/pkg/v2/crud/expr"
+	scimjson "github.com/imulab/go-scim/pkg/v2/json"
+	"github.com/imulab/go-scim/pkg/v2/prop"
+	"github.com/imulab/go-scim/pkg/v2/service"
+	"github.com/imulab/go-scim/pkg/v2/spec"
+)
+
+// PatchRequestToProto converts the patch payload to its protobuf representation. The value of each operation is
+// interpreted against the attribute its path points to in the given resource type, so it is carried with the correct
+// value kinds instead of as opaque JSON.
+func PatchRequestToProto(payload *service.PatchPayload, resourceType *spec.ResourceType) (*PatchRequest, error) {
+	message := &PatchRequest{
+		Schemas:    payload.Schemas,
+		Operations: make([]*PatchOperation, 0, len(payload.Operations)),
+	}
+
+	for _, each := range payload.Operations {
+		op := &PatchOperation{Op: each.Op, Path: each.Path}
+
+		if len(each.Value) > 0 {
+			attr, err := patchTargetAttribute(resourceType, each.Path)
+			if err != nil {
+				return nil, err
+			}
+
+			p := prop.NewProperty(attr)
+			if err := scimjson.DeserializeProperty(each.Value, p, strings.ToLower(each.Op) == "add"); err != nil {
+				return nil, err
+			}
+			op.Value = PropertyToProto(p)
+		}
+
+		message.Operations = append(message.Operations, op)
+	}
+
+	return message, nil
+}
+
+// PatchRequestFromProto converts the protobuf representation back to a patch payload, which could be fed to the
+// patch service.
+func PatchRequestFromProto(message *PatchRequest) (*service.PatchPayload, error) {
+	payload := &service.PatchPayload{
+		Schemas:    message.GetSchemas(),
+		Operations: make([]service.PatchOperation, 0, len(message.GetOperations())),
+	}
+
+	for _, each := range message.GetOperations() {
+		op := service.PatchOperation{Op: each.GetOp(), Path: each.GetPath()}
+
+		if each.GetValue() != nil {
+			raw, err := json.Marshal(valueToInterface(each.GetValue()))
+			if err != nil {
+				return nil, fmt.Errorf("%w: failed to encode patch value", spec.ErrInternal)
+			}
+			op.Value = raw
+		}
+
+		payload.Operations = append(payload.Operations, op)
+	}
+
+	return payload, nil
+}
+
+// Returns the attribute targeted by the patch path. When path is empty, the resource root attribute is returned.
+func patchTargetAttribute(resourceType *spec.ResourceType, path string) (*spec.Attribute, error) {
+	attr := resourceType.SuperAttribute(true)
+	if len(path) == 0 {
+		return attr, nil
+	}
+
+	head, err := expr.CompilePath(path)
+	if err != nil {
+		return nil, err
+	}
+	if head.IsPath() && strings.ToLower(head.Token()) == strings.ToLower(resourceType.Schema().ID()) {
+		head = head.Next()
+	}
+
+	for cursor := head; cursor != nil && attr != nil; cursor = cursor.Next() {
+		if cursor.IsRootOfFilter() {
+			continue
+		}
+		attr = attr.SubAttributeForName(cursor.Token())
+	}
+
+	if attr == nil {
+		return nil, fmt.Errorf("%w: path '%s' is invalid", spec.ErrInvalidPath, path)
+	}
+
+	return attr, nil
+}
+
+func valueToInterface(value *Value) interface{} {
+	switch k := value.GetKind().(type) {
+	case *Value_StringValue:
+		return k.StringValue
+	case *Value_IntegerValue:
+		return k.IntegerValue
+	case *Value_DecimalValue:
+		return k.DecimalValue
+	case *Value_BooleanValue:
+		return k.BooleanValue
+	case *Value_DateTimeValue:
+		return k.DateTimeValue
+	case *Value_ReferenceValue:
+		return k.ReferenceValue
+	case *Value_BinaryValue:
+		return k.BinaryValue
+	case *Value_ComplexValue:
+		m := make(map[string]interface{}, len(k.ComplexValue.GetAttributes()))
+		for name, v := range k.ComplexValue.GetAttributes() {
+			m[name] = valueToInterface(v)
+		}
+		return m
+	case *Value_MultiValue:
+		a := make([]interface{}, 0, len(k.MultiValue.GetElements()))
+		for _, v := range k.MultiValue.GetElements() {
+			a = append(a, valueToInterface(v))
+		}
+		return a
+	default:
+		return nil
+	}
+}
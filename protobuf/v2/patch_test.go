@@ -0,0 +1,87 @@
+package v2
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/imulab/go-scim/pkg/v2/service"
+	"github.com/imulab/go-scim/pkg/v2/spec"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/proto"
+	"testing"
+)
+
+func (s *ResourceTestSuite) TestPatchRoundTrip() {
+	tests := []struct {
+		name    string
+		payload string
+		expect  func(t *testing.T, message *PatchRequest, err error)
+	}{
+		{
+			name: "mixed operations",
+			payload: `
+{
+  "schemas": ["urn:ietf:params:scim:api:messages:2.0:PatchOp"],
+  "Operations": [
+    {"op": "add", "path": "emails", "value": {"value": "imulab@foo.com", "type": "work"}},
+    {"op": "replace", "path": "name.familyName", "value": "Qiu"},
+    {"op": "replace", "path": "emails[type eq \"work\"].primary", "value": true},
+    {"op": "add", "value": {"userName": "imulab", "active": false}},
+    {"op": "remove", "path": "nickName"}
+  ]
+}
+`,
+			expect: func(t *testing.T, message *PatchRequest, err error) {
+				assert.Nil(t, err)
+				assert.Len(t, message.GetOperations(), 5)
+				assert.NotNil(t, message.GetOperations()[0].GetValue().GetMultiValue())
+				assert.Equal(t, "Qiu", message.GetOperations()[1].GetValue().GetStringValue())
+				assert.True(t, message.GetOperations()[2].GetValue().GetBooleanValue())
+				assert.Nil(t, message.GetOperations()[4].GetValue())
+			},
+		},
+		{
+			name: "invalid path",
+			payload: `
+{
+  "schemas": ["urn:ietf:params:scim:api:messages:2.0:PatchOp"],
+  "Operations": [
+    {"op": "replace", "path": "foo", "value": "bar"}
+  ]
+}
+`,
+			expect: func(t *testing.T, message *PatchRequest, err error) {
+				assert.Equal(t, spec.ErrInvalidPath, errors.Unwrap(err))
+			},
+		},
+	}
+
+	for _, test := range tests {
+		s.T().Run(test.name, func(t *testing.T) {
+			payload := new(service.PatchPayload)
+			assert.Nil(t, json.Unmarshal([]byte(test.payload), payload))
+
+			message, err := PatchRequestToProto(payload, s.resourceType)
+			test.expect(t, message, err)
+			if err != nil {
+				return
+			}
+
+			raw, err := proto.Marshal(message)
+			assert.Nil(t, err)
+			message = new(PatchRequest)
+			assert.Nil(t, proto.Unmarshal(raw, message))
+
+			converted, err := PatchRequestFromProto(message)
+			assert.Nil(t, err)
+			assert.Nil(t, converted.Validate())
+			assert.Equal(t, payload.Schemas, converted.Schemas)
+			for i := range payload.Operations {
+				assert.Equal(t, payload.Operations[i].Op, converted.Operations[i].Op)
+				assert.Equal(t, payload.Operations[i].Path, converted.Operations[i].Path)
+				if len(payload.Operations[i].Value) > 0 {
+					assert.NotEmpty(t, converted.Operations[i].Value)
+				}
+			}
+		})
+	}
+}
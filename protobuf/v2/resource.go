@@ -0,0 +1,296 @@
+package v2
+
+import (
+	"fmt"
+	"github.com/imulab/go-scim/pkg/v2/crud"
+	"github.com/imulab/go-scim/pkg/v2/prop"
+	"github.com/imulab/go-scim/pkg/v2/spec"
+	"strings"
+)
+
+// ResourceToProto converts the resource to its protobuf representation. Unassigned properties are omitted.
+func ResourceToProto(resource *prop.Resource) *Resource {
+	return &Resource{
+		ResourceType: resource.ResourceType().ID(),
+		Attributes:   complexToProto(resource.RootProperty(), nil),
+	}
+}
+
+// ResourceFromProto converts the protobuf representation back to a resource of the given resource type. An error
+// is returned if the message was produced for a different resource type, or if any value does not fit the attribute
+// it is keyed under.
+func ResourceFromProto(message *Resource, resourceType *spec.ResourceType) (*prop.Resource, error) {
+	if message.GetResourceType() != resourceType.ID() {
+		return nil, fmt.Errorf("%w: expect resource type '%s', got '%s'",
+			spec.ErrInvalidValue, resourceType.ID(), message.GetResourceType())
+	}
+
+	resource := prop.NewResource(resourceType)
+	if err := (&deserializer{navigator: resource.Navigator()}).complexFromProto(message.GetAttributes()); err != nil {
+		return nil, err
+	}
+
+	return resource, nil
+}
+
+// ReturnedResourceToProto converts the resource to its protobuf representation as it is returned to clients, following
+// the return-ability rules like the JSON serialization: writeOnly attributes and those of returned=never are left out,
+// and so are those of returned=request, unless the projection includes them. The attributes or excludedAttributes of
+// the projection, if not nil, select the attributes of returned=default. Readable, if not nil, leaves out the
+// attributes it rejects, except those of returned=always, i.e. those the caller may not read (see authz.Access).
+func ReturnedResourceToProto(resource *prop.Resource, projection *crud.Projection, readable func(attr *spec.Attribute) bool) *Resource {
+	r := &returner{readable: readable}
+	if projection != nil {
+		prefix := strings.ToLower(resource.ResourceType().Schema().ID() + ":")
+		for _, path := range projection.Attributes {
+			if len(path) > 0 {
+				r.includes = append(r.includes, strings.TrimPrefix(strings.ToLower(path), prefix))
+			}
+		}
+		for _, path := range projection.ExcludedAttributes {
+			if len(path) > 0 {
+				r.excludes = append(r.excludes, strings.TrimPrefix(strings.ToLower(path), prefix))
+			}
+		}
+	}
+	return &Resource{
+		ResourceType: resource.ResourceType().ID(),
+		Attributes:   complexToProto(resource.RootProperty(), r.returns),
+	}
+}
+
+// PropertyToProto converts the property to a protobuf value. Nil is returned for unassigned properties.
+func PropertyToProto(property prop.Property) *Value {
+	return propertyToProto(property, nil)
+}
+
+// Converts the property to a protobuf value, leaving out the sub properties for which returns, if not nil, is false.
+func propertyToProto(property prop.Property, returns func(property prop.Property) bool) *Value {
+	if property.IsUnassigned() {
+		return nil
+	}
+
+	if property.Attribute().MultiValued() {
+		elements := make([]*Value, 0, property.CountChildren())
+		_ = property.ForEachChild(func(_ int, child prop.Property) error {
+			if v := propertyToProto(child, returns); v != nil {
+				elements = append(elements, v)
+			}
+			return nil
+		})
+		return &Value{Kind: &Value_MultiValue{MultiValue: &Multi{Elements: elements}}}
+	}
+
+	switch property.Attribute().Type() {
+	case spec.TypeString:
+		return &Value{Kind: &Value_StringValue{StringValue: property.Raw().(string)}}
+	case spec.TypeInteger:
+		return &Value{Kind: &Value_IntegerValue{IntegerValue: property.Raw().(int64)}}
+	case spec.TypeDecimal:
+		return &Value{Kind: &Value_DecimalValue{DecimalValue: property.Raw().(float64)}}
+	case spec.TypeBoolean:
+		return &Value{Kind: &Value_BooleanValue{BooleanValue: property.Raw().(bool)}}
+	case spec.TypeDateTime:
+		return &Value{Kind: &Value_DateTimeValue{DateTimeValue: property.Raw().(string)}}
+	case spec.TypeReference:
+		return &Value{Kind: &Value_ReferenceValue{ReferenceValue: property.Raw().(string)}}
+	case spec.TypeBinary:
+		return &Value{Kind: &Value_BinaryValue{BinaryValue: property.Raw().(string)}}
+	case spec.TypeComplex:
+		return &Value{Kind: &Value_ComplexValue{ComplexValue: complexToProto(property, returns)}}
+	default:
+		panic("invalid attribute type")
+	}
+}
+
+// PropertyFromProto assigns the protobuf value to the property. A nil value deletes the property.
+func PropertyFromProto(value *Value, property prop.Property) error {
+	return (&deserializer{navigator: prop.Navigate(property)}).valueFromProto(value)
+}
+
+func complexToProto(property prop.Property, returns func(property prop.Property) bool) *Complex {
+	c := &Complex{Attributes: map[string]*Value{}}
+	_ = property.ForEachChild(func(_ int, child prop.Property) error {
+		if returns != nil && !returns(child) {
+			return nil
+		}
+		if v := propertyToProto(child, returns); v != nil {
+			c.Attributes[child.Attribute().Name()] = v
+		}
+		return nil
+	})
+	return c
+}
+
+// returner decides which properties are returned to clients, like the JSON serializer does.
+type returner struct {
+	includes []string
+	excludes []string
+	readable func(attr *spec.Attribute) bool
+}
+
+func (r *returner) returns(property prop.Property) bool {
+	attr := property.Attribute()
+	if attr.Mutability() == spec.MutabilityWriteOnly {
+		return false
+	}
+	if r.readable != nil && attr.Returned() != spec.ReturnedAlways && !r.readable(attr) {
+		return false
+	}
+
+	test := strings.ToLower(attr.Path())
+	switch attr.Returned() {
+	case spec.ReturnedAlways:
+		return true
+	case spec.ReturnedNever:
+		return false
+	case spec.ReturnedRequest:
+		return r.included(test)
+	default:
+		if len(r.includes) > 0 {
+			return r.included(test)
+		}
+		for _, exclude := range r.excludes {
+			if exclude == test || strings.HasPrefix(test, exclude+".") {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// Returns true if the path, its parent, or any of its sub attributes is included.
+func (r *returner) included(path string) bool {
+	for _, include := range r.includes {
+		if include == path || strings.HasPrefix(include, path+".") || strings.HasPrefix(path, include+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// deserializer assigns protobuf values to the property currently focused by the navigator.
+type deserializer struct {
+	navigator prop.Navigator
+}
+
+func (d *deserializer) valueFromProto(value *Value) error {
+	p := d.navigator.Current()
+
+	if value == nil || value.GetKind() == nil {
+		_, err := p.Delete()
+		return err
+	}
+
+	if p.Attribute().MultiValued() {
+		multi, ok := value.GetKind().(*Value_MultiValue)
+		if !ok {
+			return d.errValueType(p.Attribute())
+		}
+		return d.multiFromProto(multi.MultiValue)
+	}
+
+	var raw interface{}
+	{
+		switch k := value.GetKind().(type) {
+		case *Value_StringValue:
+			raw = k.StringValue
+		case *Value_IntegerValue:
+			raw = k.IntegerValue
+		case *Value_DecimalValue:
+			raw = k.DecimalValue
+		case *Value_BooleanValue:
+			raw = k.BooleanValue
+		case *Value_DateTimeValue:
+			raw = k.DateTimeValue
+		case *Value_ReferenceValue:
+			raw = k.ReferenceValue
+		case *Value_BinaryValue:
+			raw = k.BinaryValue
+		case *Value_ComplexValue:
+			if p.Attribute().Type() != spec.TypeComplex {
+				return d.errValueType(p.Attribute())
+			}
+			return d.complexFromProto(k.ComplexValue)
+		default:
+			return d.errValueType(p.Attribute())
+		}
+	}
+
+	if !d.kindMatches(value, p.Attribute()) {
+		return d.errValueType(p.Attribute())
+	}
+
+	_, err := p.Replace(raw)
+	return err
+}
+
+func (d *deserializer) complexFromProto(c *Complex) error {
+	for name, v := range c.GetAttributes() {
+		if _, err := d.navigator.Current().ChildAtIndex(name); err != nil {
+			return fmt.Errorf("%w: no attribute named '%s' from '%s'",
+				spec.ErrInvalidPath, name, d.navigator.Current().Attribute().Path())
+		}
+
+		d.navigator.Dot(name)
+		if d.navigator.HasError() {
+			return d.navigator.Error()
+		}
+
+		if err := d.valueFromProto(v); err != nil {
+			return err
+		}
+
+		d.navigator.Retract()
+	}
+	return nil
+}
+
+func (d *deserializer) multiFromProto(m *Multi) error {
+	mv, ok := d.navigator.Current().(interface {
+		AppendElement() int
+	})
+	if !ok {
+		return fmt.Errorf("%w: expect property to implement AppendElement", spec.ErrInternal)
+	}
+
+	for _, elem := range m.GetElements() {
+		d.navigator.At(mv.AppendElement())
+		if d.navigator.HasError() {
+			return d.navigator.Error()
+		}
+
+		if err := d.valueFromProto(elem); err != nil {
+			return err
+		}
+
+		d.navigator.Retract()
+	}
+
+	return nil
+}
+
+func (d *deserializer) kindMatches(value *Value, attr *spec.Attribute) bool {
+	switch value.GetKind().(type) {
+	case *Value_StringValue:
+		return attr.Type() == spec.TypeString
+	case *Value_IntegerValue:
+		return attr.Type() == spec.TypeInteger
+	case *Value_DecimalValue:
+		return attr.Type() == spec.TypeDecimal
+	case *Value_BooleanValue:
+		return attr.Type() == spec.TypeBoolean
+	case *Value_DateTimeValue:
+		return attr.Type() == spec.TypeDateTime
+	case *Value_ReferenceValue:
+		return attr.Type() == spec.TypeReference
+	case *Value_BinaryValue:
+		return attr.Type() == spec.TypeBinary
+	default:
+		return false
+	}
+}
+
+func (d *deserializer) errValueType(attr *spec.Attribute) error {
+	return fmt.Errorf("%w: value incompatible with '%s'", spec.ErrInvalidValue, attr.Path())
+}
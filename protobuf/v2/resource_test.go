@@ -0,0 +1,279 @@
+package v2
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/imulab/go-scim/pkg/v2/crud"
+	scimjson "github.com/imulab/go-scim/pkg/v2/json"
+	"github.com/imulab/go-scim/pkg/v2/prop"
+	"github.com/imulab/go-scim/pkg/v2/spec"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"google.golang.org/protobuf/proto"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestResource(t *testing.T) {
+	s := new(ResourceTestSuite)
+	suite.Run(t, s)
+}
+
+type ResourceTestSuite struct {
+	suite.Suite
+	resourceType *spec.ResourceType
+}
+
+func (s *ResourceTestSuite) TestRoundTrip() {
+	tests := []struct {
+		name        string
+		getResource func(t *testing.T) *prop.Resource
+	}{
+		{
+			name: "user with extension",
+			getResource: func(t *testing.T) *prop.Resource {
+				r := prop.NewResource(s.resourceType)
+				assert.False(t, r.Navigator().Replace(map[string]interface{}{
+					"schemas": []interface{}{
+						"urn:ietf:params:scim:schemas:core:2.0:User",
+						"urn:ietf:params:scim:schemas:extension:enterprise:2.0:User",
+					},
+					"id":       "3cc032f5-2361-417f-9e2f-bc80adddf4a3",
+					"userName": "imulab",
+					"name": map[string]interface{}{
+						"familyName": "Qiu",
+						"givenName":  "Weinan",
+					},
+					"active": true,
+					"emails": []interface{}{
+						map[string]interface{}{
+							"value":   "imulab@foo.com",
+							"type":    "work",
+							"primary": true,
+						},
+						map[string]interface{}{
+							"value": "imulab@bar.com",
+							"type":  "home",
+						},
+					},
+					"meta": map[string]interface{}{
+						"resourceType": "User",
+						"created":      "2019-11-20T13:09:00",
+						"version":      "W/\"1\"",
+					},
+					"urn:ietf:params:scim:schemas:extension:enterprise:2.0:User": map[string]interface{}{
+						"employeeNumber": "6546579",
+						"manager": map[string]interface{}{
+							"value": "b1a3ea41-1e6a-47c9-8a4e-6cc3b4c5d7d4",
+						},
+					},
+				}).HasError())
+				return r
+			},
+		},
+		{
+			name: "empty user",
+			getResource: func(t *testing.T) *prop.Resource {
+				return prop.NewResource(s.resourceType)
+			},
+		},
+	}
+
+	for _, test := range tests {
+		s.T().Run(test.name, func(t *testing.T) {
+			resource := test.getResource(t)
+
+			raw, err := proto.Marshal(ResourceToProto(resource))
+			assert.Nil(t, err)
+
+			message := new(Resource)
+			assert.Nil(t, proto.Unmarshal(raw, message))
+
+			converted, err := ResourceFromProto(message, s.resourceType)
+			assert.Nil(t, err)
+			assert.Equal(t, resource.Hash(), converted.Hash())
+
+			expect, err := scimjson.Serialize(resource)
+			assert.Nil(t, err)
+			actual, err := scimjson.Serialize(converted)
+			assert.Nil(t, err)
+			assert.JSONEq(t, string(expect), string(actual))
+		})
+	}
+}
+
+func (s *ResourceTestSuite) TestReturnedToProto() {
+	r := prop.NewResource(s.resourceType)
+	require.False(s.T(), r.Navigator().Replace(map[string]interface{}{
+		"schemas": []interface{}{
+			"urn:ietf:params:scim:schemas:core:2.0:User",
+			"urn:ietf:params:scim:schemas:extension:enterprise:2.0:User",
+		},
+		"id":       "3cc032f5-2361-417f-9e2f-bc80adddf4a3",
+		"userName": "imulab",
+		"password": "s3cret",
+		"name": map[string]interface{}{
+			"givenName":  "Weinan",
+			"familyName": "Qiu",
+		},
+		"emails": []interface{}{
+			map[string]interface{}{"value": "imulab@foo.com", "primary": true},
+		},
+		"urn:ietf:params:scim:schemas:extension:enterprise:2.0:User": map[string]interface{}{
+			"employeeNumber": "6546579",
+		},
+	}).HasError())
+
+	tests := []struct {
+		name       string
+		projection *crud.Projection
+		options    []scimjson.Options
+	}{
+		{
+			name: "no projection",
+		},
+		{
+			name:       "attributes",
+			projection: &crud.Projection{Attributes: []string{"name.givenName", "emails"}},
+			options:    []scimjson.Options{scimjson.Include("name.givenName", "emails")},
+		},
+		{
+			name:       "excludedAttributes",
+			projection: &crud.Projection{ExcludedAttributes: []string{"urn:ietf:params:scim:schemas:core:2.0:User:name", "emails.primary"}},
+			options:    []scimjson.Options{scimjson.Exclude("urn:ietf:params:scim:schemas:core:2.0:User:name", "emails.primary")},
+		},
+	}
+
+	for _, test := range tests {
+		s.T().Run(test.name, func(t *testing.T) {
+			returned, err := ResourceFromProto(ReturnedResourceToProto(r, test.projection, nil), s.resourceType)
+			require.Nil(t, err)
+			assert.True(t, returned.Navigator().Dot("password").Current().IsUnassigned())
+
+			expect, err := scimjson.Serialize(r, test.options...)
+			assert.Nil(t, err)
+			actual, err := scimjson.Serialize(returned, test.options...)
+			assert.Nil(t, err)
+			assert.JSONEq(t, string(expect), string(actual))
+		})
+	}
+
+	// attributes the caller may not read are left out, except those always returned
+	returned := ReturnedResourceToProto(r, nil, func(attr *spec.Attribute) bool {
+		return attr.Name() != "emails" && attr.Name() != "id"
+	})
+	assert.NotContains(s.T(), returned.GetAttributes().GetAttributes(), "emails")
+	assert.Contains(s.T(), returned.GetAttributes().GetAttributes(), "id")
+	assert.Contains(s.T(), returned.GetAttributes().GetAttributes(), "userName")
+}
+
+func (s *ResourceTestSuite) TestFromProtoErrors() {
+	tests := []struct {
+		name    string
+		message *Resource
+		expect  func(t *testing.T, err error)
+	}{
+		{
+			name:    "wrong resource type",
+			message: &Resource{ResourceType: "Group"},
+			expect: func(t *testing.T, err error) {
+				assert.Equal(t, spec.ErrInvalidValue, errors.Unwrap(err))
+			},
+		},
+		{
+			name: "unknown attribute",
+			message: &Resource{
+				ResourceType: "User",
+				Attributes: &Complex{Attributes: map[string]*Value{
+					"foo": {Kind: &Value_StringValue{StringValue: "bar"}},
+				}},
+			},
+			expect: func(t *testing.T, err error) {
+				assert.Equal(t, spec.ErrInvalidPath, errors.Unwrap(err))
+			},
+		},
+		{
+			name: "incompatible value kind",
+			message: &Resource{
+				ResourceType: "User",
+				Attributes: &Complex{Attributes: map[string]*Value{
+					"active": {Kind: &Value_StringValue{StringValue: "true"}},
+				}},
+			},
+			expect: func(t *testing.T, err error) {
+				assert.Equal(t, spec.ErrInvalidValue, errors.Unwrap(err))
+			},
+		},
+		{
+			name: "singular value for multiValued attribute",
+			message: &Resource{
+				ResourceType: "User",
+				Attributes: &Complex{Attributes: map[string]*Value{
+					"emails": {Kind: &Value_StringValue{StringValue: "imulab@foo.com"}},
+				}},
+			},
+			expect: func(t *testing.T, err error) {
+				assert.Equal(t, spec.ErrInvalidValue, errors.Unwrap(err))
+			},
+		},
+	}
+
+	for _, test := range tests {
+		s.T().Run(test.name, func(t *testing.T) {
+			_, err := ResourceFromProto(test.message, s.resourceType)
+			test.expect(t, err)
+		})
+	}
+}
+
+func (s *ResourceTestSuite) SetupSuite() {
+	for _, each := range []struct {
+		filepath  string
+		structure interface{}
+		post      func(parsed interface{})
+	}{
+		{
+			filepath:  "../../public/schemas/core_schema.json",
+			structure: new(spec.Schema),
+			post: func(parsed interface{}) {
+				spec.Schemas().Register(parsed.(*spec.Schema))
+			},
+		},
+		{
+			filepath:  "../../public/schemas/user_schema.json",
+			structure: new(spec.Schema),
+			post: func(parsed interface{}) {
+				spec.Schemas().Register(parsed.(*spec.Schema))
+			},
+		},
+		{
+			filepath:  "../../public/schemas/user_enterprise_extension_schema.json",
+			structure: new(spec.Schema),
+			post: func(parsed interface{}) {
+				spec.Schemas().Register(parsed.(*spec.Schema))
+			},
+		},
+		{
+			filepath:  "../../public/resource_types/user_resource_type.json",
+			structure: new(spec.ResourceType),
+			post: func(parsed interface{}) {
+				s.resourceType = parsed.(*spec.ResourceType)
+			},
+		},
+	} {
+		f, err := os.Open(each.filepath)
+		require.Nil(s.T(), err)
+
+		raw, err := ioutil.ReadAll(f)
+		require.Nil(s.T(), err)
+
+		err = json.Unmarshal(raw, each.structure)
+		require.Nil(s.T(), err)
+
+		if each.post != nil {
+			each.post(each.structure)
+		}
+	}
+}
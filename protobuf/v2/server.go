@@ -0,0 +1,293 @@
+package v2
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/imulab/go-scim/pkg/v2/authz"
+	"github.com/imulab/go-scim/pkg/v2/crud"
+	"github.com/imulab/go-scim/pkg/v2/handlerutil"
+	"github.com/imulab/go-scim/pkg/v2/prop"
+	"github.com/imulab/go-scim/pkg/v2/service"
+	"github.com/imulab/go-scim/pkg/v2/spec"
+)
+
+// ServerOptions configures the ResourceServiceServer returned by NewServer.
+type ServerOptions struct {
+	// Endpoints are the resource types served, keyed by the resource_type of the requests, and the services of their
+	// resources, as served over HTTP by handlerutil.NewServer. Calls to services that are nil are answered with an error
+	// of spec.ErrNotImplemented.
+	Endpoints []*handlerutil.Endpoint
+	// Search serves the queries without resource_type, across all endpoints, if not nil (see service.RootQueryService).
+	Search service.Query
+	// OnError, if not nil, is called with the errors of the services before they are returned, i.e. to log them.
+	OnError func(ctx context.Context, err error)
+}
+
+// NewServer returns a ResourceServiceServer calling the same resource services as the HTTP endpoints, to be registered
+// with RegisterResourceServiceServer. The resources received are converted from protobuf and handed to the create and
+// replace services as is, without the round trip through JSON; only the patch values, which are interpreted against
+// the attributes their paths point to, are. The resources returned follow the return-ability rules, the projection of
+// the request, and the authz.Access of the context, if any, like the HTTP responses.
+//
+// Errors are returned as gRPC statuses (see ErrorToStatus), which clients convert back with ErrorFromStatus.
+func NewServer(options ServerOptions) ResourceServiceServer {
+	s := &server{
+		options:   options,
+		endpoints: map[string]*handlerutil.Endpoint{},
+	}
+	for _, endpoint := range options.Endpoints {
+		s.endpoints[endpoint.ResourceType.ID()] = endpoint
+	}
+	return s
+}
+
+type server struct {
+	UnimplementedResourceServiceServer
+	options   ServerOptions
+	endpoints map[string]*handlerutil.Endpoint
+}
+
+func (s *server) Create(ctx context.Context, req *CreateRequest) (*CreateResponse, error) {
+	endpoint, err := s.endpoint(req.GetResource().GetResourceType(), "create", func(e *handlerutil.Endpoint) bool { return e.Create != nil })
+	if err != nil {
+		return nil, s.error(ctx, err)
+	}
+
+	resource, err := ResourceFromProto(req.GetResource(), endpoint.ResourceType)
+	if err != nil {
+		return nil, s.error(ctx, err)
+	}
+
+	resp, err := endpoint.Create.Do(ctx, &service.CreateRequest{
+		Resource:       resource,
+		IdempotencyKey: req.GetIdempotencyKey(),
+		DryRun:         req.GetDryRun(),
+	})
+	if err != nil {
+		return nil, s.error(ctx, err)
+	}
+
+	return &CreateResponse{
+		Resource: returned(ctx, resp.Resource, nil),
+		Replayed: resp.Replayed,
+		DryRun:   resp.DryRun,
+	}, nil
+}
+
+func (s *server) Get(ctx context.Context, req *GetRequest) (*GetResponse, error) {
+	endpoint, err := s.endpoint(req.GetResourceType(), "get", func(e *handlerutil.Endpoint) bool { return e.Get != nil })
+	if err != nil {
+		return nil, s.error(ctx, err)
+	}
+
+	projection, err := projectionFromProto(req.GetProjection())
+	if err != nil {
+		return nil, s.error(ctx, err)
+	}
+
+	resp, err := endpoint.Get.Do(ctx, &service.GetRequest{ResourceID: req.GetResourceId(), Projection: projection})
+	if err != nil {
+		return nil, s.error(ctx, err)
+	}
+
+	return &GetResponse{Resource: returned(ctx, resp.Resource, projection)}, nil
+}
+
+func (s *server) Replace(ctx context.Context, req *ReplaceRequest) (*ReplaceResponse, error) {
+	endpoint, err := s.endpoint(req.GetResource().GetResourceType(), "replace", func(e *handlerutil.Endpoint) bool { return e.Replace != nil })
+	if err != nil {
+		return nil, s.error(ctx, err)
+	}
+
+	resource, err := ResourceFromProto(req.GetResource(), endpoint.ResourceType)
+	if err != nil {
+		return nil, s.error(ctx, err)
+	}
+
+	resp, err := endpoint.Replace.Do(ctx, &service.ReplaceRequest{
+		ResourceID: req.GetResourceId(),
+		Resource:   resource,
+		Version:    req.GetVersion(),
+		DryRun:     req.GetDryRun(),
+	})
+	if err != nil {
+		return nil, s.error(ctx, err)
+	}
+
+	message := &ReplaceResponse{Replaced: resp.Replaced, DryRun: resp.DryRun}
+	if resp.Replaced {
+		message.Resource = returned(ctx, resp.Resource, nil)
+	}
+	return message, nil
+}
+
+func (s *server) Patch(ctx context.Context, req *PatchResourceRequest) (*PatchResponse, error) {
+	endpoint, err := s.endpoint(req.GetResourceType(), "patch", func(e *handlerutil.Endpoint) bool { return e.Patch != nil })
+	if err != nil {
+		return nil, s.error(ctx, err)
+	}
+
+	payload, err := PatchRequestFromProto(req.GetPatch())
+	if err != nil {
+		return nil, s.error(ctx, err)
+	}
+	raw, err := json.Marshal(payload)
+	if err != nil {
+		return nil, s.error(ctx, fmt.Errorf("%w: failed to encode patch payload", spec.ErrInternal))
+	}
+
+	resp, err := endpoint.Patch.Do(ctx, &service.PatchRequest{
+		ResourceID:    req.GetResourceId(),
+		PayloadSource: bytes.NewReader(raw),
+		Version:       req.GetVersion(),
+		DryRun:        req.GetDryRun(),
+	})
+	if err != nil {
+		return nil, s.error(ctx, err)
+	}
+
+	message := &PatchResponse{Patched: resp.Patched, DryRun: resp.DryRun}
+	if resp.Patched {
+		message.Resource = returned(ctx, resp.Resource, nil)
+	}
+	return message, nil
+}
+
+func (s *server) Delete(ctx context.Context, req *DeleteRequest) (*DeleteResponse, error) {
+	endpoint, err := s.endpoint(req.GetResourceType(), "delete", func(e *handlerutil.Endpoint) bool { return e.Delete != nil })
+	if err != nil {
+		return nil, s.error(ctx, err)
+	}
+
+	if _, err := endpoint.Delete.Do(ctx, &service.DeleteRequest{
+		ResourceID: req.GetResourceId(),
+		Version:    req.GetVersion(),
+	}); err != nil {
+		return nil, s.error(ctx, err)
+	}
+
+	return &DeleteResponse{}, nil
+}
+
+func (s *server) Query(ctx context.Context, req *QueryRequest) (*ListResponse, error) {
+	query := s.options.Search
+	if len(req.GetResourceType()) > 0 {
+		endpoint, err := s.endpoint(req.GetResourceType(), "query", func(e *handlerutil.Endpoint) bool { return e.Query != nil })
+		if err != nil {
+			return nil, s.error(ctx, err)
+		}
+		query = endpoint.Query
+	} else if query == nil {
+		return nil, s.error(ctx, fmt.Errorf("%w: query across all resource types is not supported", spec.ErrNotImplemented))
+	}
+
+	qr, err := queryRequestFromProto(req)
+	if err != nil {
+		return nil, s.error(ctx, err)
+	}
+
+	resp, err := query.Do(ctx, qr)
+	if err != nil {
+		return nil, s.error(ctx, err)
+	}
+
+	message := &ListResponse{
+		TotalResults: int64(resp.TotalResults),
+		StartIndex:   int64(resp.StartIndex),
+		ItemsPerPage: int64(resp.ItemsPerPage),
+		NextCursor:   resp.NextCursor,
+		Resources:    make([]*Resource, 0, len(resp.Resources)),
+	}
+	for _, each := range resp.Resources {
+		resource, ok := each.(*prop.Resource)
+		if !ok {
+			return nil, s.error(ctx, fmt.Errorf("%w: list response contains non-resource element", spec.ErrInternal))
+		}
+		message.Resources = append(message.Resources, returned(ctx, resource, resp.Projection))
+	}
+	return message, nil
+}
+
+// Returns the endpoint of the resource type, if it has the service of the operation, according to has.
+func (s *server) endpoint(resourceType string, operation string, has func(endpoint *handlerutil.Endpoint) bool) (*handlerutil.Endpoint, error) {
+	endpoint, ok := s.endpoints[resourceType]
+	if !ok {
+		return nil, fmt.Errorf("%w: no endpoint of resource type '%s'", spec.ErrNotFound, resourceType)
+	}
+	if !has(endpoint) {
+		return nil, fmt.Errorf("%w: %s is not supported on resource type '%s'", spec.ErrNotImplemented, operation, resourceType)
+	}
+	return endpoint, nil
+}
+
+func (s *server) error(ctx context.Context, err error) error {
+	if s.options.OnError != nil {
+		s.options.OnError(ctx, err)
+	}
+	return ErrorToStatus(err).Err()
+}
+
+// Returns the protobuf representation of the resource as it is returned to the caller (see ReturnedResourceToProto).
+func returned(ctx context.Context, resource *prop.Resource, projection *crud.Projection) *Resource {
+	var readable func(attr *spec.Attribute) bool
+	if access := authz.From(ctx); access != nil {
+		readable = func(attr *spec.Attribute) bool {
+			return access.Readable(resource.ResourceType(), attr)
+		}
+	}
+	return ReturnedResourceToProto(resource, projection, readable)
+}
+
+func projectionFromProto(message *Projection) (*crud.Projection, error) {
+	switch {
+	case len(message.GetAttributes()) > 0 && len(message.GetExcludedAttributes()) > 0:
+		return nil, fmt.Errorf("%w: only one of attributes and excludedAttributes may be specified", spec.ErrInvalidSyntax)
+	case len(message.GetAttributes()) > 0:
+		return &crud.Projection{Attributes: message.GetAttributes()}, nil
+	case len(message.GetExcludedAttributes()) > 0:
+		return &crud.Projection{ExcludedAttributes: message.GetExcludedAttributes()}, nil
+	default:
+		return nil, nil
+	}
+}
+
+// Returns the query request of the message, validated like the query parameters of HTTP requests (see
+// handlerutil.QueryRequestFromGet).
+func queryRequestFromProto(message *QueryRequest) (qr *service.QueryRequest, err error) {
+	qr = &service.QueryRequest{Filter: message.GetFilter()}
+
+	if len(message.GetSortBy()) > 0 {
+		qr.Sort = &crud.Sort{
+			By:    message.GetSortBy(),
+			Order: crud.SortOrder(message.GetSortOrder()),
+		}
+	}
+
+	if message.Count != nil && message.GetCount() < 0 {
+		return nil, fmt.Errorf("%w: count must be a non-negative integer", spec.ErrInvalidSyntax)
+	}
+	switch {
+	case message.Cursor != nil:
+		if message.StartIndex != nil {
+			return nil, fmt.Errorf("%w: only one of startIndex and cursor may be specified", spec.ErrInvalidSyntax)
+		}
+		qr.Cursor = &crud.CursorPagination{Cursor: message.GetCursor(), Count: int(message.GetCount())}
+	case message.StartIndex != nil || message.Count != nil:
+		qr.Pagination = &crud.Pagination{StartIndex: 1, Count: int(message.GetCount())}
+		if message.StartIndex != nil {
+			if message.GetStartIndex() < 1 {
+				return nil, fmt.Errorf("%w: startIndex must be a 1-based integer", spec.ErrInvalidSyntax)
+			}
+			qr.Pagination.StartIndex = int(message.GetStartIndex())
+		}
+	}
+
+	qr.Projection, err = projectionFromProto(message.GetProjection())
+	return
+}
+
+var (
+	_ ResourceServiceServer = (*server)(nil)
+)
@@ -0,0 +1,316 @@
+package v2
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/imulab/go-scim/pkg/v2/crud"
+	"github.com/imulab/go-scim/pkg/v2/db"
+	"github.com/imulab/go-scim/pkg/v2/handlerutil"
+	"github.com/imulab/go-scim/pkg/v2/prop"
+	"github.com/imulab/go-scim/pkg/v2/service"
+	"github.com/imulab/go-scim/pkg/v2/service/filter"
+	"github.com/imulab/go-scim/pkg/v2/spec"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"io/ioutil"
+	"net"
+	"os"
+	"testing"
+)
+
+func TestServer(t *testing.T) {
+	s := new(ServerTestSuite)
+	suite.Run(t, s)
+}
+
+type ServerTestSuite struct {
+	suite.Suite
+	resourceType *spec.ResourceType
+	config       *spec.ServiceProviderConfig
+	server       *grpc.Server
+	conn         *grpc.ClientConn
+	client       ResourceServiceClient
+}
+
+func (s *ServerTestSuite) TestResourceLifecycle() {
+	ctx := context.TODO()
+
+	user := prop.NewResource(s.resourceType)
+	require.Nil(s.T(), user.Navigator().Replace(map[string]interface{}{
+		"schemas":  []interface{}{"urn:ietf:params:scim:schemas:core:2.0:User"},
+		"userName": "foo",
+		"password": "s3cret",
+		"emails":   []interface{}{map[string]interface{}{"value": "foo@bar.com"}},
+	}).Error())
+
+	created, err := s.client.Create(ctx, &CreateRequest{Resource: ResourceToProto(user)})
+	require.Nil(s.T(), err)
+	attributes := created.GetResource().GetAttributes().GetAttributes()
+	id := attributes["id"].GetStringValue()
+	assert.NotEmpty(s.T(), id)
+	assert.Equal(s.T(), "foo", attributes["userName"].GetStringValue())
+	assert.NotContains(s.T(), attributes, "password")
+
+	got, err := s.client.Get(ctx, &GetRequest{
+		ResourceType: "User",
+		ResourceId:   id,
+		Projection:   &Projection{Attributes: []string{"userName"}},
+	})
+	require.Nil(s.T(), err)
+	assert.Contains(s.T(), got.GetResource().GetAttributes().GetAttributes(), "id")
+	assert.Contains(s.T(), got.GetResource().GetAttributes().GetAttributes(), "userName")
+	assert.NotContains(s.T(), got.GetResource().GetAttributes().GetAttributes(), "emails")
+
+	count := int64(10)
+	list, err := s.client.Query(ctx, &QueryRequest{ResourceType: "User", Filter: `userName eq "foo"`, Count: &count})
+	require.Nil(s.T(), err)
+	assert.Equal(s.T(), int64(1), list.GetTotalResults())
+	require.Len(s.T(), list.GetResources(), 1)
+	assert.Equal(s.T(), id, list.GetResources()[0].GetAttributes().GetAttributes()["id"].GetStringValue())
+
+	patched, err := s.client.Patch(ctx, &PatchResourceRequest{
+		ResourceType: "User",
+		ResourceId:   id,
+		Patch: &PatchRequest{
+			Schemas: []string{"urn:ietf:params:scim:api:messages:2.0:PatchOp"},
+			Operations: []*PatchOperation{
+				{Op: "replace", Path: "displayName", Value: &Value{Kind: &Value_StringValue{StringValue: "Foo"}}},
+			},
+		},
+	})
+	require.Nil(s.T(), err)
+	assert.True(s.T(), patched.GetPatched())
+	assert.Equal(s.T(), "Foo", patched.GetResource().GetAttributes().GetAttributes()["displayName"].GetStringValue())
+
+	replacement := prop.NewResource(s.resourceType)
+	require.Nil(s.T(), replacement.Navigator().Replace(map[string]interface{}{
+		"schemas":  []interface{}{"urn:ietf:params:scim:schemas:core:2.0:User"},
+		"userName": "bar",
+		"emails":   []interface{}{map[string]interface{}{"value": "bar@bar.com"}},
+	}).Error())
+	replaced, err := s.client.Replace(ctx, &ReplaceRequest{Resource: ResourceToProto(replacement), ResourceId: id})
+	require.Nil(s.T(), err)
+	assert.True(s.T(), replaced.GetReplaced())
+	assert.Equal(s.T(), "bar", replaced.GetResource().GetAttributes().GetAttributes()["userName"].GetStringValue())
+	assert.Equal(s.T(), id, replaced.GetResource().GetAttributes().GetAttributes()["id"].GetStringValue())
+
+	_, err = s.client.Delete(ctx, &DeleteRequest{ResourceType: "User", ResourceId: id})
+	require.Nil(s.T(), err)
+
+	_, err = s.client.Get(ctx, &GetRequest{ResourceType: "User", ResourceId: id})
+	assert.Equal(s.T(), codes.NotFound, status.Code(err))
+	assert.True(s.T(), errors.Is(ErrorFromStatus(err), spec.ErrNotFound))
+}
+
+func (s *ServerTestSuite) TestErrors() {
+	ctx := context.TODO()
+	zero := int64(0)
+	cursor := ""
+
+	tests := []struct {
+		name   string
+		call   func() error
+		code   codes.Code
+		expect *spec.Error
+	}{
+		{
+			name: "unknown resource type",
+			call: func() error {
+				_, err := s.client.Get(ctx, &GetRequest{ResourceType: "Group", ResourceId: "foo"})
+				return err
+			},
+			code:   codes.NotFound,
+			expect: spec.ErrNotFound,
+		},
+		{
+			name: "service not supported",
+			call: func() error {
+				_, err := s.client.Delete(ctx, &DeleteRequest{ResourceType: "Other", ResourceId: "foo"})
+				return err
+			},
+			code:   codes.Unimplemented,
+			expect: spec.ErrNotImplemented,
+		},
+		{
+			name: "root query not supported",
+			call: func() error {
+				_, err := s.client.Query(ctx, &QueryRequest{})
+				return err
+			},
+			code:   codes.Unimplemented,
+			expect: spec.ErrNotImplemented,
+		},
+		{
+			name: "startIndex is not 1-based",
+			call: func() error {
+				_, err := s.client.Query(ctx, &QueryRequest{ResourceType: "User", StartIndex: &zero})
+				return err
+			},
+			code:   codes.InvalidArgument,
+			expect: spec.ErrInvalidSyntax,
+		},
+		{
+			name: "both startIndex and cursor",
+			call: func() error {
+				one := int64(1)
+				_, err := s.client.Query(ctx, &QueryRequest{ResourceType: "User", StartIndex: &one, Cursor: &cursor})
+				return err
+			},
+			code:   codes.InvalidArgument,
+			expect: spec.ErrInvalidSyntax,
+		},
+		{
+			name: "both attributes and excludedAttributes",
+			call: func() error {
+				_, err := s.client.Get(ctx, &GetRequest{ResourceType: "User", ResourceId: "foo", Projection: &Projection{
+					Attributes:         []string{"userName"},
+					ExcludedAttributes: []string{"emails"},
+				}})
+				return err
+			},
+			code:   codes.InvalidArgument,
+			expect: spec.ErrInvalidSyntax,
+		},
+		{
+			name: "invalid resource",
+			call: func() error {
+				_, err := s.client.Create(ctx, &CreateRequest{Resource: &Resource{
+					ResourceType: "User",
+					Attributes: &Complex{Attributes: map[string]*Value{
+						"userName": {Kind: &Value_IntegerValue{IntegerValue: 1}},
+					}},
+				}})
+				return err
+			},
+			code:   codes.InvalidArgument,
+			expect: spec.ErrInvalidValue,
+		},
+	}
+
+	for _, test := range tests {
+		s.T().Run(test.name, func(t *testing.T) {
+			err := test.call()
+			assert.Equal(t, test.code, status.Code(err))
+			assert.True(t, errors.Is(ErrorFromStatus(err), test.expect))
+		})
+	}
+}
+
+func (s *ServerTestSuite) SetupTest() {
+	database := db.Memory()
+	other := new(spec.ResourceType)
+	require.Nil(s.T(), json.Unmarshal([]byte(`{"id": "Other", "name": "Other", "endpoint": "/Others", "schema": "urn:ietf:params:scim:schemas:core:2.0:User"}`), other))
+
+	listener := bufconn.Listen(1024 * 1024)
+	s.server = grpc.NewServer()
+	RegisterResourceServiceServer(s.server, NewServer(ServerOptions{
+		Endpoints: []*handlerutil.Endpoint{
+			{
+				ResourceType: s.resourceType,
+				Create: service.CreateService(s.resourceType, database, []filter.ByResource{
+					filter.ByPropertyToByResource(
+						filter.ReadOnlyFilter(),
+						filter.UUIDFilter(),
+						filter.BCryptFilter(),
+					),
+					filter.MetaFilter(),
+					filter.ByPropertyToByResource(filter.ValidationFilter(database)),
+				}),
+				Get:   service.GetService(database),
+				Query: service.QueryService(s.config, database),
+				Replace: service.ReplaceService(s.config, s.resourceType, database, []filter.ByResource{
+					filter.ByPropertyToByResource(
+						filter.ReadOnlyFilter(),
+						filter.BCryptFilter(),
+					),
+					filter.ByPropertyToByResource(filter.ValidationFilter(database)),
+					filter.MetaFilter(),
+				}),
+				Patch: service.PatchService(s.config, database, nil, []filter.ByResource{
+					filter.ByPropertyToByResource(filter.ValidationFilter(database)),
+					filter.MetaFilter(),
+				}),
+				Delete: service.DeleteService(s.config, database),
+			},
+			{ResourceType: other},
+		},
+	}))
+	go func() {
+		_ = s.server.Serve(listener)
+	}()
+
+	conn, err := grpc.Dial("bufconn",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithInsecure(),
+	)
+	require.Nil(s.T(), err)
+	s.conn = conn
+	s.client = NewResourceServiceClient(conn)
+}
+
+func (s *ServerTestSuite) TearDownTest() {
+	_ = s.conn.Close()
+	s.server.Stop()
+}
+
+func (s *ServerTestSuite) SetupSuite() {
+	for _, each := range []struct {
+		filepath  string
+		structure interface{}
+		post      func(parsed interface{})
+	}{
+		{
+			filepath:  "../../public/schemas/core_schema.json",
+			structure: new(spec.Schema),
+			post: func(parsed interface{}) {
+				spec.Schemas().Register(parsed.(*spec.Schema))
+			},
+		},
+		{
+			filepath:  "../../public/schemas/user_schema.json",
+			structure: new(spec.Schema),
+			post: func(parsed interface{}) {
+				spec.Schemas().Register(parsed.(*spec.Schema))
+			},
+		},
+		{
+			filepath:  "../../public/schemas/user_enterprise_extension_schema.json",
+			structure: new(spec.Schema),
+			post: func(parsed interface{}) {
+				spec.Schemas().Register(parsed.(*spec.Schema))
+			},
+		},
+		{
+			filepath:  "../../public/resource_types/user_resource_type.json",
+			structure: new(spec.ResourceType),
+			post: func(parsed interface{}) {
+				s.resourceType = parsed.(*spec.ResourceType)
+				crud.Register(s.resourceType)
+			},
+		},
+	} {
+		f, err := os.Open(each.filepath)
+		require.Nil(s.T(), err)
+
+		raw, err := ioutil.ReadAll(f)
+		require.Nil(s.T(), err)
+
+		err = json.Unmarshal(raw, each.structure)
+		require.Nil(s.T(), err)
+
+		if each.post != nil {
+			each.post(each.structure)
+		}
+	}
+
+	s.config = new(spec.ServiceProviderConfig)
+	require.Nil(s.T(), json.Unmarshal([]byte(`{"patch": {"supported": true}, "filter": {"supported": true, "maxResults": 100}}`), s.config))
+}
@@ -0,0 +1,91 @@
+package v2
+
+import (
+	"github.com/imulab/go-scim/pkg/v2/handlerutil"
+	"github.com/imulab/go-scim/pkg/v2/spec"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"net/http"
+)
+
+// ErrorToStatus converts the error to a gRPC status, whose code matches the status of the SCIM error the error is
+// reported as in HTTP responses (see handlerutil.MapError), and whose details carry that error as an Error, with the
+// full error message as detail.
+func ErrorToStatus(err error) *status.Status {
+	scimErr := handlerutil.MapError(err)
+	message := &Error{
+		Status:   int32(scimErr.Status),
+		ScimType: scimErr.Type,
+		Detail:   err.Error(),
+	}
+	s := status.New(statusCode(scimErr.Status), message.GetDetail())
+	if withDetails, detailsErr := s.WithDetails(message); detailsErr == nil {
+		s = withDetails
+	}
+	return s
+}
+
+// ErrorFromStatus converts the error returned by a gRPC call back to a SCIM error, which wraps the matching spec error
+// prototype like ErrorFromProto does, so that errors.Is works on the client too. Errors without an Error in their
+// status details, i.e. those of the transport, wrap the spec error of their code, or spec.ErrInternal. A nil error
+// remains nil.
+func ErrorFromStatus(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	s, ok := status.FromError(err)
+	if !ok {
+		return &wireError{cause: spec.ErrInternal, detail: err.Error()}
+	}
+	for _, detail := range s.Details() {
+		if message, ok := detail.(*Error); ok {
+			return ErrorFromProto(message)
+		}
+	}
+
+	var cause *spec.Error
+	switch s.Code() {
+	case codes.InvalidArgument:
+		cause = spec.ErrInvalidValue
+	case codes.Unauthenticated:
+		cause = spec.ErrUnauthorized
+	case codes.PermissionDenied:
+		cause = spec.ErrForbidden
+	case codes.NotFound:
+		cause = spec.ErrNotFound
+	case codes.AlreadyExists:
+		cause = spec.ErrUniqueness
+	case codes.FailedPrecondition:
+		cause = spec.ErrConflict
+	case codes.Unimplemented:
+		cause = spec.ErrNotImplemented
+	default:
+		cause = spec.ErrInternal
+	}
+	return &wireError{cause: cause, detail: s.Message()}
+}
+
+// Returns the gRPC code of the HTTP status of a SCIM error.
+func statusCode(status int) codes.Code {
+	switch status {
+	case http.StatusBadRequest, http.StatusUnsupportedMediaType, http.StatusNotAcceptable:
+		return codes.InvalidArgument
+	case http.StatusUnauthorized:
+		return codes.Unauthenticated
+	case http.StatusForbidden:
+		return codes.PermissionDenied
+	case http.StatusNotFound:
+		return codes.NotFound
+	case http.StatusConflict:
+		return codes.AlreadyExists
+	case http.StatusPreconditionFailed:
+		return codes.FailedPrecondition
+	case http.StatusRequestEntityTooLarge, http.StatusTooManyRequests:
+		return codes.ResourceExhausted
+	case http.StatusNotImplemented, http.StatusMethodNotAllowed:
+		return codes.Unimplemented
+	default:
+		return codes.Internal
+	}
+}
@@ -0,0 +1,64 @@
+package v2
+
+import (
+	"context"
+	"fmt"
+	"github.com/go-redis/redis/v8"
+	"github.com/imulab/go-scim/pkg/v2/db"
+	"github.com/imulab/go-scim/pkg/v2/spec"
+	"time"
+)
+
+// Cache returns a db.Cache implementation that stores the entries in Redis, so that they are shared by all instances
+// of the server, and writes through any instance invalidate the entries of all. The client may be a single node,
+// sentinel or cluster client. Entries expire in Redis with their TTL, and are otherwise evicted by the eviction policy
+// of the Redis server, i.e. allkeys-lru.
+func Cache(client redis.UniversalClient) db.Cache {
+	return &redisCache{client: client}
+}
+
+type redisCache struct {
+	client redis.UniversalClient
+}
+
+func (c *redisCache) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	value, err := c.client.Get(ctx, key).Bytes()
+	if err != nil {
+		if err == redis.Nil {
+			return nil, false, nil
+		}
+		return nil, false, errRedis(err)
+	}
+	return value, true, nil
+}
+
+func (c *redisCache) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	if ttl <= 0 {
+		ttl = 0 // no expiration
+	}
+	if err := c.client.Set(ctx, key, value, ttl).Err(); err != nil {
+		return errRedis(err)
+	}
+	return nil
+}
+
+func (c *redisCache) Delete(ctx context.Context, keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	// Keys are deleted one by one in a pipeline, as a cluster rejects deleting keys of different slots at once.
+	_, err := c.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, key := range keys {
+			pipe.Del(ctx, key)
+		}
+		return nil
+	})
+	if err != nil {
+		return errRedis(err)
+	}
+	return nil
+}
+
+func errRedis(err error) error {
+	return fmt.Errorf("%w: %v", spec.ErrInternal, err)
+}
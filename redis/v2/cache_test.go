@@ -0,0 +1,311 @@
+package v2
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/imulab/go-scim/pkg/v2/crud"
+	"github.com/imulab/go-scim/pkg/v2/db"
+	scimjson "github.com/imulab/go-scim/pkg/v2/json"
+	"github.com/imulab/go-scim/pkg/v2/prop"
+	"github.com/imulab/go-scim/pkg/v2/spec"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestRedisCache(t *testing.T) {
+	s := new(RedisCacheTestSuite)
+	suite.Run(t, s)
+}
+
+type RedisCacheTestSuite struct {
+	suite.Suite
+	resourceType *spec.ResourceType
+	server       *miniredis.Miniredis
+	client       *redis.Client
+}
+
+func (s *RedisCacheTestSuite) TestCache() {
+	cache := Cache(s.client)
+	ctx := context.Background()
+
+	_, ok, err := cache.Get(ctx, "foo")
+	require.Nil(s.T(), err)
+	assert.False(s.T(), ok)
+
+	require.Nil(s.T(), cache.Set(ctx, "foo", []byte("bar"), time.Minute))
+	require.Nil(s.T(), cache.Set(ctx, "forever", []byte("ever"), 0))
+	value, ok, err := cache.Get(ctx, "foo")
+	require.Nil(s.T(), err)
+	assert.True(s.T(), ok)
+	assert.Equal(s.T(), "bar", string(value))
+
+	s.server.FastForward(2 * time.Minute)
+	_, ok, err = cache.Get(ctx, "foo")
+	require.Nil(s.T(), err)
+	assert.False(s.T(), ok)
+	_, ok, err = cache.Get(ctx, "forever")
+	require.Nil(s.T(), err)
+	assert.True(s.T(), ok)
+
+	require.Nil(s.T(), cache.Delete(ctx, "forever", "missing"))
+	_, ok, err = cache.Get(ctx, "forever")
+	require.Nil(s.T(), err)
+	assert.False(s.T(), ok)
+	assert.Nil(s.T(), cache.Delete(ctx))
+}
+
+func (s *RedisCacheTestSuite) TestCacheError() {
+	server := miniredis.NewMiniRedis()
+	require.Nil(s.T(), server.Start())
+	client := redis.NewClient(&redis.Options{Addr: server.Addr(), MaxRetries: -1})
+	defer client.Close()
+	server.Close()
+
+	_, _, err := Cache(client).Get(context.Background(), "foo")
+	assert.True(s.T(), errors.Is(err, spec.ErrInternal))
+}
+
+func (s *RedisCacheTestSuite) TestCached() {
+	ctx := context.Background()
+	database := &countingDB{DB: db.Memory()}
+	// Two instances of the server, sharing the cache.
+	first := db.Cached(s.resourceType, database, Cache(s.client), db.CacheOptions{})
+	second := db.Cached(s.resourceType, database, Cache(s.client), db.CacheOptions{})
+
+	foo := s.user(`{"schemas": ["urn:ietf:params:scim:schemas:core:2.0:User"], "id": "user001", "userName": "foo", "password": "s3cret", "meta": {"version": "W/\"1\""}}`)
+	require.Nil(s.T(), first.Insert(ctx, foo))
+
+	got, err := second.Get(ctx, "user001", nil)
+	require.Nil(s.T(), err)
+	assert.Equal(s.T(), foo.Hash(), got.Hash())
+	assert.Equal(s.T(), 0, database.reads)
+
+	results, err := second.Query(ctx, `userName eq "foo"`, nil, nil, nil)
+	require.Nil(s.T(), err)
+	require.Len(s.T(), results, 1)
+	assert.Equal(s.T(), 1, database.reads)
+	results, err = first.Query(ctx, `userName eq "foo"`, nil, nil, nil)
+	require.Nil(s.T(), err)
+	require.Len(s.T(), results, 1)
+	assert.Equal(s.T(), 1, database.reads)
+	n, err := first.Count(ctx, `userName eq "foo"`)
+	require.Nil(s.T(), err)
+	assert.Equal(s.T(), 1, n)
+	_, err = first.Count(ctx, `userName eq "foo"`)
+	require.Nil(s.T(), err)
+	assert.Equal(s.T(), 2, database.reads)
+
+	// Filters other than a single eq comparison are not cached.
+	_, err = first.Query(ctx, `userName sw "f"`, nil, nil, nil)
+	require.Nil(s.T(), err)
+	_, err = first.Query(ctx, `userName sw "f"`, nil, nil, nil)
+	require.Nil(s.T(), err)
+	assert.Equal(s.T(), 4, database.reads)
+
+	// Writes through any instance invalidate the query results.
+	replacement := s.user(`{"schemas": ["urn:ietf:params:scim:schemas:core:2.0:User"], "id": "user001", "userName": "bar", "meta": {"version": "W/\"2\""}}`)
+	require.Nil(s.T(), second.Replace(ctx, foo, replacement))
+	results, err = first.Query(ctx, `userName eq "foo"`, nil, nil, nil)
+	require.Nil(s.T(), err)
+	assert.Len(s.T(), results, 0)
+	got, err = first.Get(ctx, "user001", nil)
+	require.Nil(s.T(), err)
+	assert.Equal(s.T(), replacement.Hash(), got.Hash())
+	assert.Equal(s.T(), 5, database.reads)
+
+	err = first.Replace(ctx, foo, replacement)
+	assert.True(s.T(), errors.Is(err, spec.ErrConflict))
+
+	bar := s.user(`{"schemas": ["urn:ietf:params:scim:schemas:core:2.0:User"], "id": "user002", "userName": "baz"}`)
+	require.Nil(s.T(), database.Insert(ctx, bar))
+	resources, err := first.(db.BatchDB).GetMany(ctx, []string{"user002", "user001", "missing"}, nil)
+	require.Nil(s.T(), err)
+	require.Len(s.T(), resources, 2)
+	assert.Equal(s.T(), "user002", resources[0].IdOrEmpty())
+	assert.Equal(s.T(), "user001", resources[1].IdOrEmpty())
+
+	require.Nil(s.T(), second.Delete(ctx, replacement))
+	_, err = first.Get(ctx, "user001", nil)
+	assert.True(s.T(), errors.Is(err, spec.ErrNotFound))
+
+	_, _, err = first.(db.CursorDB).QueryCursor(ctx, "", nil, &crud.CursorPagination{Count: 10}, nil)
+	assert.Nil(s.T(), err)
+}
+
+func (s *RedisCacheTestSuite) TestCachedStale() {
+	ctx := context.Background()
+	server := miniredis.NewMiniRedis()
+	require.Nil(s.T(), server.Start())
+	defer server.Close()
+	client := redis.NewClient(&redis.Options{Addr: server.Addr(), MaxRetries: -1})
+	defer client.Close()
+
+	database := &countingDB{DB: db.Memory()}
+	cached := db.Cached(s.resourceType, database, Cache(client), db.CacheOptions{})
+
+	foo := s.user(`{"schemas": ["urn:ietf:params:scim:schemas:core:2.0:User"], "id": "user001", "userName": "foo"}`)
+	server.SetError("READONLY")
+	err := cached.Insert(ctx, foo)
+	assert.True(s.T(), errors.Is(err, spec.ErrInternal))
+
+	// Reads fall back to the database when the cache fails.
+	got, err := cached.Get(ctx, "user001", nil)
+	require.Nil(s.T(), err)
+	assert.Equal(s.T(), foo.Hash(), got.Hash())
+}
+
+func (s *RedisCacheTestSuite) TestCachedSubscribe() {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	database := db.Memory()
+	cached := db.Cached(s.resourceType, database, Cache(s.client), db.CacheOptions{})
+	changes := make(chan string, 10)
+	done := make(chan error, 1)
+	go func() {
+		done <- db.Subscribe(ctx, cached, func(_ context.Context, change *db.Change) error {
+			changes <- change.ID
+			return nil
+		})
+	}()
+
+	// wait for the subscription, by writing until the first change is notified
+	for i := 0; ; i++ {
+		require.Nil(s.T(), database.Insert(ctx, s.user(fmt.Sprintf(`{"schemas": ["urn:ietf:params:scim:schemas:core:2.0:User"], "id": "probe%d", "userName": "probe%d"}`, i, i))))
+		select {
+		case <-changes:
+		case <-time.After(10 * time.Millisecond):
+			continue
+		}
+		break
+	}
+
+	foo := s.user(`{"schemas": ["urn:ietf:params:scim:schemas:core:2.0:User"], "id": "user001", "userName": "foo", "meta": {"version": "W/\"1\""}}`)
+	require.Nil(s.T(), cached.Insert(ctx, foo))
+	assert.Equal(s.T(), "user001", <-changes)
+	results, err := cached.Query(ctx, `userName eq "foo"`, nil, nil, nil)
+	require.Nil(s.T(), err)
+	assert.Len(s.T(), results, 1)
+
+	// Writes to the database other than through the decorator are removed from the cache once notified.
+	replacement := s.user(`{"schemas": ["urn:ietf:params:scim:schemas:core:2.0:User"], "id": "user001", "userName": "bar", "meta": {"version": "W/\"2\""}}`)
+	require.Nil(s.T(), database.Replace(ctx, foo, replacement))
+	assert.Equal(s.T(), "user001", <-changes)
+	got, err := cached.Get(ctx, "user001", nil)
+	require.Nil(s.T(), err)
+	assert.Equal(s.T(), replacement.Hash(), got.Hash())
+	results, err = cached.Query(ctx, `userName eq "foo"`, nil, nil, nil)
+	require.Nil(s.T(), err)
+	assert.Len(s.T(), results, 0)
+
+	cancel()
+	assert.Equal(s.T(), context.Canceled, <-done)
+
+	// Databases without change streams cannot be subscribed to.
+	err = db.Subscribe(context.Background(), db.Cached(s.resourceType, &countingDB{DB: database}, Cache(s.client), db.CacheOptions{}), nil)
+	assert.True(s.T(), errors.Is(err, spec.ErrInternal))
+}
+
+func (s *RedisCacheTestSuite) user(raw string) *prop.Resource {
+	resource := prop.NewResource(s.resourceType)
+	require.Nil(s.T(), scimjson.Deserialize([]byte(raw), resource))
+	return resource
+}
+
+func (s *RedisCacheTestSuite) SetupTest() {
+	s.server.FlushAll()
+}
+
+func (s *RedisCacheTestSuite) TearDownSuite() {
+	_ = s.client.Close()
+	s.server.Close()
+}
+
+func (s *RedisCacheTestSuite) SetupSuite() {
+	for _, each := range []struct {
+		filepath  string
+		structure interface{}
+		post      func(parsed interface{})
+	}{
+		{
+			filepath:  "../../public/schemas/core_schema.json",
+			structure: new(spec.Schema),
+			post: func(parsed interface{}) {
+				spec.Schemas().Register(parsed.(*spec.Schema))
+			},
+		},
+		{
+			filepath:  "../../public/schemas/user_schema.json",
+			structure: new(spec.Schema),
+			post: func(parsed interface{}) {
+				spec.Schemas().Register(parsed.(*spec.Schema))
+			},
+		},
+		{
+			filepath:  "../../public/schemas/user_enterprise_extension_schema.json",
+			structure: new(spec.Schema),
+			post: func(parsed interface{}) {
+				spec.Schemas().Register(parsed.(*spec.Schema))
+			},
+		},
+		{
+			filepath:  "../../public/resource_types/user_resource_type.json",
+			structure: new(spec.ResourceType),
+			post: func(parsed interface{}) {
+				s.resourceType = parsed.(*spec.ResourceType)
+				crud.Register(s.resourceType)
+			},
+		},
+	} {
+		f, err := os.Open(each.filepath)
+		require.Nil(s.T(), err)
+
+		raw, err := ioutil.ReadAll(f)
+		require.Nil(s.T(), err)
+
+		err = json.Unmarshal(raw, each.structure)
+		require.Nil(s.T(), err)
+
+		if each.post != nil {
+			each.post(each.structure)
+		}
+	}
+
+	s.server = miniredis.NewMiniRedis()
+	require.Nil(s.T(), s.server.Start())
+	s.client = redis.NewClient(&redis.Options{Addr: s.server.Addr()})
+}
+
+// countingDB counts the reads that reach the database.
+type countingDB struct {
+	db.DB
+	reads int
+}
+
+func (d *countingDB) Get(ctx context.Context, id string, projection *crud.Projection) (*prop.Resource, error) {
+	d.reads++
+	return d.DB.Get(ctx, id, projection)
+}
+
+func (d *countingDB) Count(ctx context.Context, filter string) (int, error) {
+	d.reads++
+	return d.DB.Count(ctx, filter)
+}
+
+func (d *countingDB) Query(ctx context.Context, filter string, sort *crud.Sort, pagination *crud.Pagination, projection *crud.Projection) ([]*prop.Resource, error) {
+	d.reads++
+	return d.DB.Query(ctx, filter, sort, pagination, projection)
+}
+
+func (d *countingDB) QueryCursor(ctx context.Context, filter string, sort *crud.Sort, pagination *crud.CursorPagination, projection *crud.Projection) ([]*prop.Resource, string, error) {
+	return d.DB.(db.CursorDB).QueryCursor(ctx, filter, sort, pagination, projection)
+}
@@ -0,0 +1,4 @@
+// This package provides Redis implementation of db.Cache interface, which lets the resources and query results cached
+// by db.Cached be shared by all instances of the server, and of ratelimit.Store, which enforces the rate limits of
+// ratelimit.Middleware across them.
+package v2
@@ -0,0 +1,12 @@
+module github.com/imulab/go-scim/redis/v2
+
+go 1.15
+
+require (
+	github.com/alicebob/miniredis/v2 v2.23.0
+	github.com/go-redis/redis/v8 v8.11.5
+	github.com/imulab/go-scim/pkg/v2 v2.0.0
+	github.com/stretchr/testify v1.7.0
+)
+
+replace github.com/imulab/go-scim/pkg/v2 => ../../pkg/v2
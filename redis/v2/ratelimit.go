@@ -0,0 +1,57 @@
+package v2
+
+import (
+	"context"
+	"github.com/go-redis/redis/v8"
+	"github.com/imulab/go-scim/pkg/v2/ratelimit"
+	"time"
+)
+
+// RateLimitStore returns a ratelimit.Store that keeps the token buckets in Redis, so that the limits are enforced
+// across all instances of the server. Each bucket is a hash, which is taken from and refilled atomically by a script
+// against the clock of the Redis server, and expires once it would be full again. The keys of the buckets are prefixed
+// with "ratelimit:".
+func RateLimitStore(client redis.UniversalClient) ratelimit.Store {
+	return &redisRateLimitStore{client: client}
+}
+
+// takeScript takes a token from the bucket of KEYS[1], refilled with ARGV[1] tokens per second up to ARGV[2] tokens,
+// and returns zero, or the microseconds until the bucket holds a token again.
+var takeScript = redis.NewScript(`
+local rate = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local time = redis.call('TIME')
+local now = tonumber(time[1]) * 1000000 + tonumber(time[2])
+
+local bucket = redis.call('HMGET', KEYS[1], 'tokens', 'updated')
+local tokens = tonumber(bucket[1]) or burst
+local updated = tonumber(bucket[2]) or now
+tokens = math.min(burst, tokens + math.max(0, now - updated) * rate / 1000000)
+
+local wait = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+else
+	wait = math.ceil((1 - tokens) * 1000000 / rate)
+end
+
+redis.call('HMSET', KEYS[1], 'tokens', tostring(tokens), 'updated', tostring(now))
+redis.call('PEXPIRE', KEYS[1], math.ceil((burst - tokens) * 1000 / rate) + 1)
+return wait
+`)
+
+type redisRateLimitStore struct {
+	client redis.UniversalClient
+}
+
+func (s *redisRateLimitStore) Take(ctx context.Context, key string, limit ratelimit.Limit) (time.Duration, error) {
+	wait, err := takeScript.Run(ctx, s.client, []string{"ratelimit:" + key}, limit.Rate, limit.Burst).Int64()
+	if err != nil {
+		return 0, errRedis(err)
+	}
+	return time.Duration(wait) * time.Microsecond, nil
+}
+
+var (
+	_ ratelimit.Store = (*redisRateLimitStore)(nil)
+)
@@ -0,0 +1,68 @@
+package v2
+
+import (
+	"context"
+	"errors"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/imulab/go-scim/pkg/v2/ratelimit"
+	"github.com/imulab/go-scim/pkg/v2/spec"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestRateLimitStore(t *testing.T) {
+	server := miniredis.NewMiniRedis()
+	require.Nil(t, server.Start())
+	defer server.Close()
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	defer func() { _ = client.Close() }()
+
+	now := time.Now()
+	server.SetTime(now)
+
+	ctx := context.Background()
+	store := RateLimitStore(client)
+	limit := ratelimit.Limit{Rate: 2, Burst: 3}
+	take := func(key string) time.Duration {
+		wait, err := store.Take(ctx, key, limit)
+		require.Nil(t, err)
+		return wait
+	}
+
+	// the bucket is full at first
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, time.Duration(0), take("foo"))
+	}
+	assert.Equal(t, 500*time.Millisecond, take("foo"))
+	assert.Equal(t, time.Duration(0), take("bar"))
+
+	// refilled with one token after half a second
+	now = now.Add(250 * time.Millisecond)
+	server.SetTime(now)
+	assert.Equal(t, 250*time.Millisecond, take("foo"))
+	now = now.Add(250 * time.Millisecond)
+	server.SetTime(now)
+	assert.Equal(t, time.Duration(0), take("foo"))
+	assert.Equal(t, 500*time.Millisecond, take("foo"))
+
+	// the bucket expires once it would be full again
+	assert.True(t, server.Exists("ratelimit:foo"))
+	assert.Equal(t, 1500*time.Millisecond+time.Millisecond, server.TTL("ratelimit:foo"))
+	server.FastForward(2 * time.Second)
+	assert.False(t, server.Exists("ratelimit:foo"))
+
+	// refilled up to the burst only
+	now = now.Add(time.Hour)
+	server.SetTime(now)
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, time.Duration(0), take("bar"))
+	}
+	assert.NotEqual(t, time.Duration(0), take("bar"))
+
+	server.Close()
+	_, err := store.Take(ctx, "foo", limit)
+	assert.True(t, errors.Is(err, spec.ErrInternal))
+}
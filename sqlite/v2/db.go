@@ -0,0 +1,283 @@
+package v2
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"github.com/imulab/go-scim/pkg/v2/crud"
+	"github.com/imulab/go-scim/pkg/v2/crud/translate"
+	"github.com/imulab/go-scim/pkg/v2/db"
+	scimjson "github.com/imulab/go-scim/pkg/v2/json"
+	"github.com/imulab/go-scim/pkg/v2/prop"
+	"github.com/imulab/go-scim/pkg/v2/spec"
+	"net/url"
+	"strings"
+)
+
+// Open opens the SQLite database in the file of the name, or a private in-memory database when the name is empty or
+// ":memory:", with the options the implementation of this package relies on: LIKE compares case sensitively, so that
+// substring filters on caseExact attributes are exact, and writers wait for locks held by other connections instead of
+// failing right away. As every connection to ":memory:" opens a database of its own, the connection pool of in-memory
+// databases is limited to a single connection, which is kept open for as long as the pool.
+func Open(name string) (*sql.DB, error) {
+	memory := len(name) == 0 || name == ":memory:"
+	dsn := "file::memory:?_cslike=1"
+	if !memory {
+		dsn = "file:" + (&url.URL{Path: name}).EscapedPath() + "?_cslike=1&_busy_timeout=5000"
+	}
+
+	conn, err := sql.Open("sqlite3", dsn)
+	if err != nil {
+		return nil, errDatabase(err)
+	}
+	if memory {
+		conn.SetMaxOpenConns(1)
+		conn.SetConnMaxLifetime(0)
+	}
+	return conn, nil
+}
+
+// Create a db.DB implementation that persists data in SQLite. This implementation supports one-to-one correspondence
+// of a SCIM resource type to a SQLite table, which shall have been created by EnsureSchema, and is intended for
+// development and CI, where it exercises the same SQL translation as a database server without depending on one. The
+// connection shall be opened with case sensitive LIKE, i.e. by Open.
+//
+// Resources are stored as JSON documents of all their attributes, including those that are never returned to clients,
+// along with the id, meta.version and meta.lastModified in columns of their own. Filters, sort and pagination are
+// translated into SQL (see translate.SQLCompiler) and executed by SQLite: attributes with generated columns (see
+// EnsureSchema) are compared using these columns and their indexes, and the rest is evaluated against the documents
+// using the JSON1 functions (see translate.JSON1). Sorting by multiValued attributes, or attributes within them, is
+// rejected with an error of spec.ErrInvalidSyntax. Queries are ordered by id when not sorted, so that pages are stable.
+//
+// Insert and Replace return an error of spec.ErrUniqueness when the primary key or a unique index is violated. Replace
+// and Delete only modify the resource if its stored version is still the version of the given resource, and return an
+// error of spec.ErrConflict otherwise, in the same way as the MongoDB and PostgreSQL implementations.
+//
+// This implementation ignores the projection parameters and always returns complete resources, which leaves it to the
+// serialization to return the requested attributes.
+//
+// The calls with a context carrying a transaction on the same connection pool are part of the transaction (see
+// Transaction), and the returned DB implements db.TxDB, whose WithTx starts such a transaction with the default
+// options, which the databases of other tables on the same connection pool take part in.
+func DB(resourceType *spec.ResourceType, conn *sql.DB, table string) db.DB {
+	t := newTable(resourceType, table)
+	return &sqliteDB{
+		resourceType: resourceType,
+		conn:         conn,
+		table:        t,
+		compiler:     translate.SQLCompiler(resourceType, t.mapping(), translate.Question),
+	}
+}
+
+type sqliteDB struct {
+	resourceType *spec.ResourceType
+	conn         *sql.DB
+	table        *table
+	compiler     translate.SQL
+}
+
+func (d *sqliteDB) Insert(ctx context.Context, resource *prop.Resource) error {
+	doc, err := d.document(resource)
+	if err != nil {
+		return err
+	}
+
+	_, err = querierFor(ctx, d.conn).ExecContext(ctx,
+		"INSERT INTO "+d.table.quoted+" ("+idColumn+", "+versionColumn+", "+lastModifiedColumn+", "+docColumn+") VALUES (?, ?, ?, ?)",
+		resource.IdOrEmpty(), resource.MetaVersionOrEmpty(), lastModified(resource), doc)
+	if err != nil {
+		return d.table.errWrite(err)
+	}
+	return nil
+}
+
+func (d *sqliteDB) Count(ctx context.Context, filter string) (int, error) {
+	clause, err := d.compiler.Compile(filter, nil, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	var n int
+	if err := querierFor(ctx, d.conn).QueryRowContext(ctx, "SELECT count(*) FROM "+d.table.quoted+clause.String(), clause.Args...).Scan(&n); err != nil {
+		return 0, errDatabase(err)
+	}
+	return n, nil
+}
+
+func (d *sqliteDB) Get(ctx context.Context, id string, _ *crud.Projection) (*prop.Resource, error) {
+	var raw string
+	err := querierFor(ctx, d.conn).QueryRowContext(ctx, "SELECT "+docColumn+" FROM "+d.table.quoted+" WHERE "+idColumn+" = ?", id).Scan(&raw)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("%w: resource not found by id '%s'", spec.ErrNotFound, id)
+		}
+		return nil, errDatabase(err)
+	}
+	return d.resource(raw)
+}
+
+// GetMany gets the resources by their ids in one query, and implements db.BatchDB.
+func (d *sqliteDB) GetMany(ctx context.Context, ids []string, _ *crud.Projection) ([]*prop.Resource, error) {
+	if len(ids) == 0 {
+		return []*prop.Resource{}, nil
+	}
+
+	args := make([]interface{}, 0, len(ids))
+	for _, id := range ids {
+		args = append(args, id)
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(ids)), ", ")
+
+	resources, err := d.query(ctx, "SELECT "+docColumn+" FROM "+d.table.quoted+" WHERE "+idColumn+" IN ("+placeholders+")", args...)
+	if err != nil {
+		return nil, err
+	}
+	return db.SortByIDs(resources, ids), nil
+}
+
+func (d *sqliteDB) Replace(ctx context.Context, ref *prop.Resource, replacement *prop.Resource) error {
+	doc, err := d.document(replacement)
+	if err != nil {
+		return err
+	}
+
+	var (
+		id      = ref.IdOrEmpty()
+		version = ref.MetaVersionOrEmpty()
+		query   = "UPDATE " + d.table.quoted + " SET " + versionColumn + " = ?, " + lastModifiedColumn + " = ?, " + docColumn + " = ? WHERE " + idColumn + " = ?"
+		args    = []interface{}{replacement.MetaVersionOrEmpty(), lastModified(replacement), doc, id}
+	)
+	if len(version) > 0 {
+		query += " AND " + versionColumn + " = ?"
+		args = append(args, version)
+	}
+
+	result, err := querierFor(ctx, d.conn).ExecContext(ctx, query, args...)
+	if err != nil {
+		return d.table.errWrite(err)
+	}
+	return d.errIfNotAffected(result, id, version)
+}
+
+func (d *sqliteDB) Delete(ctx context.Context, resource *prop.Resource) error {
+	var (
+		id      = resource.IdOrEmpty()
+		version = resource.MetaVersionOrEmpty()
+		query   = "DELETE FROM " + d.table.quoted + " WHERE " + idColumn + " = ?"
+		args    = []interface{}{id}
+	)
+	if len(version) > 0 {
+		query += " AND " + versionColumn + " = ?"
+		args = append(args, version)
+	}
+
+	result, err := querierFor(ctx, d.conn).ExecContext(ctx, query, args...)
+	if err != nil {
+		return errDatabase(err)
+	}
+	return d.errIfNotAffected(result, id, version)
+}
+
+func (d *sqliteDB) Query(ctx context.Context, filter string, sort *crud.Sort, pagination *crud.Pagination, _ *crud.Projection) ([]*prop.Resource, error) {
+	clause, err := d.compiler.Compile(filter, sort, pagination)
+	if err != nil {
+		return nil, err
+	}
+	if len(clause.OrderBy) == 0 {
+		clause.OrderBy = idColumn + " ASC"
+	}
+	return d.query(ctx, "SELECT "+docColumn+" FROM "+d.table.quoted+clause.String(), clause.Args...)
+}
+
+// Returns the resources of the documents selected by the query.
+func (d *sqliteDB) query(ctx context.Context, query string, args ...interface{}) ([]*prop.Resource, error) {
+	rows, err := querierFor(ctx, d.conn).QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, errDatabase(err)
+	}
+
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	results := make([]*prop.Resource, 0)
+	for rows.Next() {
+		var raw string
+		if err := rows.Scan(&raw); err != nil {
+			return nil, errDatabase(err)
+		}
+		resource, err := d.resource(raw)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, resource)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errDatabase(err)
+	}
+
+	return results, nil
+}
+
+// Returns the JSON document of the resource. Unlike the JSON serialization for clients, the document contains all
+// assigned attributes, so that the resource can be restored as it is.
+func (d *sqliteDB) document(resource *prop.Resource) (string, error) {
+	raw, err := json.Marshal(prop.Document(resource.RootProperty()))
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", spec.ErrInternal, err)
+	}
+	return string(raw), nil
+}
+
+// Returns the resource restored from the JSON document.
+func (d *sqliteDB) resource(raw string) (*prop.Resource, error) {
+	resource := prop.NewResource(d.resourceType)
+	if err := scimjson.Deserialize([]byte(raw), resource); err != nil {
+		return nil, err
+	}
+	return resource, nil
+}
+
+// Returns nil if the statement modified a resource, or otherwise, an error of spec.ErrConflict if the statement was
+// conditioned on the version, and spec.ErrNotFound if not.
+func (d *sqliteDB) errIfNotAffected(result sql.Result, id string, version string) error {
+	n, err := result.RowsAffected()
+	if err != nil {
+		return errDatabase(err)
+	}
+	if n > 0 {
+		return nil
+	}
+	if len(version) > 0 {
+		return fmt.Errorf("%w: resource by id '%s' was not found or was modified since by another request", spec.ErrConflict, id)
+	}
+	return fmt.Errorf("%w: resource not found by id '%s'", spec.ErrNotFound, id)
+}
+
+// Returns the meta.lastModified of the resource as a Julian day number, or nil if it has none.
+func lastModified(resource *prop.Resource) interface{} {
+	nav := resource.Navigator().Dot("meta").Dot("lastModified")
+	if nav.HasError() {
+		return nil
+	}
+	raw, ok := nav.Current().Raw().(string)
+	if !ok {
+		return nil
+	}
+	t, err := spec.ParseDateTime(raw)
+	if err != nil {
+		return nil
+	}
+	return translate.JulianDay(t)
+}
+
+// WithTx calls fn in a transaction on the connection pool of the database, and implements db.TxDB (see Transaction).
+func (d *sqliteDB) WithTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	return Transaction(ctx, d.conn, nil, fn)
+}
+
+var (
+	_ db.BatchDB = (*sqliteDB)(nil)
+	_ db.TxDB    = (*sqliteDB)(nil)
+)
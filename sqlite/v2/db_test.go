@@ -0,0 +1,287 @@
+package v2
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/imulab/go-scim/pkg/v2/crud"
+	"github.com/imulab/go-scim/pkg/v2/db"
+	scimjson "github.com/imulab/go-scim/pkg/v2/json"
+	"github.com/imulab/go-scim/pkg/v2/prop"
+	"github.com/imulab/go-scim/pkg/v2/spec"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSQLiteDatabase(t *testing.T) {
+	s := new(SQLiteDatabaseTestSuite)
+	suite.Run(t, s)
+}
+
+type SQLiteDatabaseTestSuite struct {
+	suite.Suite
+	resourceType *spec.ResourceType
+}
+
+func (s *SQLiteDatabaseTestSuite) TestDocument() {
+	d := DB(s.resourceType, nil, "users").(*sqliteDB)
+
+	resource := s.user(`{
+		"schemas": ["urn:ietf:params:scim:schemas:core:2.0:User", "urn:ietf:params:scim:schemas:extension:enterprise:2.0:User"],
+		"id": "user001",
+		"userName": "foo",
+		"password": "s3cret",
+		"active": true,
+		"emails": [{"value": "foo@bar.com", "primary": true}],
+		"meta": {"version": "W/\"1\"", "lastModified": "2020-01-01T00:00:00Z"},
+		"urn:ietf:params:scim:schemas:extension:enterprise:2.0:User": {"employeeNumber": "42"}
+	}`)
+
+	doc, err := d.document(resource)
+	require.Nil(s.T(), err)
+	assert.Contains(s.T(), doc, `"password":"s3cret"`)
+
+	restored, err := d.resource(doc)
+	require.Nil(s.T(), err)
+	assert.Equal(s.T(), resource.Hash(), restored.Hash())
+	assert.Equal(s.T(), 2458849.5, lastModified(restored))
+}
+
+func (s *SQLiteDatabaseTestSuite) TestCRUD() {
+	conn := s.memory()
+	defer conn.Close()
+	database := s.database(conn)
+	ctx := context.Background()
+
+	foo := s.user(`{"schemas": ["urn:ietf:params:scim:schemas:core:2.0:User"], "id": "user001", "userName": "foo", "meta": {"version": "W/\"1\""}}`)
+	require.Nil(s.T(), database.Insert(ctx, foo))
+	err := database.Insert(ctx, s.user(`{"schemas": ["urn:ietf:params:scim:schemas:core:2.0:User"], "id": "user002", "userName": "FOO"}`))
+	assert.True(s.T(), errors.Is(err, spec.ErrUniqueness))
+	assert.Contains(s.T(), err.Error(), "'userName'")
+	err = database.Insert(ctx, s.user(`{"schemas": ["urn:ietf:params:scim:schemas:core:2.0:User"], "id": "user001", "userName": "bar"}`))
+	assert.True(s.T(), errors.Is(err, spec.ErrUniqueness))
+	assert.Contains(s.T(), err.Error(), "'id'")
+
+	got, err := database.Get(ctx, "user001", nil)
+	require.Nil(s.T(), err)
+	assert.Equal(s.T(), foo.Hash(), got.Hash())
+	_, err = database.Get(ctx, "missing", nil)
+	assert.True(s.T(), errors.Is(err, spec.ErrNotFound))
+
+	replacement := s.user(`{"schemas": ["urn:ietf:params:scim:schemas:core:2.0:User"], "id": "user001", "userName": "bar", "meta": {"version": "W/\"2\""}}`)
+	require.Nil(s.T(), database.Replace(ctx, foo, replacement))
+	err = database.Replace(ctx, foo, replacement)
+	assert.True(s.T(), errors.Is(err, spec.ErrConflict), "replaced with a stale version")
+
+	require.Nil(s.T(), database.Insert(ctx, s.user(`{"schemas": ["urn:ietf:params:scim:schemas:core:2.0:User"], "id": "user002", "userName": "foo"}`)), "userName was released")
+
+	err = database.Delete(ctx, foo)
+	assert.True(s.T(), errors.Is(err, spec.ErrConflict), "deleted with a stale version")
+	require.Nil(s.T(), database.Delete(ctx, replacement))
+	err = database.Delete(ctx, replacement)
+	assert.True(s.T(), errors.Is(err, spec.ErrConflict))
+
+	n, err := database.Count(ctx, "")
+	require.Nil(s.T(), err)
+	assert.Equal(s.T(), 1, n)
+}
+
+func (s *SQLiteDatabaseTestSuite) TestQuery() {
+	conn := s.memory()
+	defer conn.Close()
+	database := s.database(conn)
+	ctx := context.Background()
+
+	for _, each := range []string{
+		`{"schemas": ["urn:ietf:params:scim:schemas:core:2.0:User"], "id": "user001", "userName": "alice", "active": true, "emails": [{"value": "alice@foo.com"}], "meta": {"lastModified": "2020-01-01T00:00:00Z"}}`,
+		`{"schemas": ["urn:ietf:params:scim:schemas:core:2.0:User"], "id": "user002", "userName": "Bob", "active": false, "emails": [{"value": "bob@bar.com"}], "meta": {"lastModified": "2020-01-02T08:00:00+08:00"}}`,
+		`{"schemas": ["urn:ietf:params:scim:schemas:core:2.0:User"], "id": "user003", "userName": "carol", "active": true, "name": {"familyName": "Qiu"}, "meta": {"lastModified": "2020-01-03T00:00:00Z"}}`,
+	} {
+		require.Nil(s.T(), database.Insert(ctx, s.user(each)))
+	}
+
+	tests := []struct {
+		filter     string
+		sort       *crud.Sort
+		pagination *crud.Pagination
+		expect     []string
+	}{
+		{filter: `userName eq "BOB"`, expect: []string{"user002"}},
+		{filter: `active eq true`, expect: []string{"user001", "user003"}},
+		{filter: `emails.value ew "FOO.COM" or name.familyName pr`, expect: []string{"user001", "user003"}},
+		{filter: `name.familyName sw "Q"`, expect: []string{"user003"}},
+		{filter: `not (active eq true)`, expect: []string{"user002"}},
+		{filter: `not (name.familyName eq "Qiu")`, expect: []string{"user001", "user002"}},
+		{filter: `meta.lastModified gt "2020-01-01T00:00:00Z"`, expect: []string{"user002", "user003"}},
+		{filter: `meta.lastModified eq "2020-01-02T00:00:00Z"`, expect: []string{"user002"}},
+		{filter: `active eq true`, sort: &crud.Sort{By: "userName", Order: crud.SortDesc}, expect: []string{"user003", "user001"}},
+		{sort: &crud.Sort{By: "userName"}, pagination: &crud.Pagination{StartIndex: 2, Count: 1}, expect: []string{"user002"}},
+		{pagination: &crud.Pagination{StartIndex: 5, Count: 1}, expect: []string{}},
+	}
+	for _, test := range tests {
+		s.T().Run(fmt.Sprintf("%s %v %v", test.filter, test.sort, test.pagination), func(t *testing.T) {
+			results, err := database.Query(ctx, test.filter, test.sort, test.pagination, nil)
+			require.Nil(t, err)
+			assert.Equal(t, test.expect, s.ids(results))
+		})
+	}
+
+	n, err := database.Count(ctx, `active eq true`)
+	require.Nil(s.T(), err)
+	assert.Equal(s.T(), 2, n)
+
+	_, err = database.Query(ctx, "", &crud.Sort{By: "emails.value"}, nil, nil)
+	assert.True(s.T(), errors.Is(err, spec.ErrInvalidSyntax))
+
+	results, err := db.GetMany(ctx, database, []string{"user003", "missing", "user001"}, nil)
+	require.Nil(s.T(), err)
+	assert.Equal(s.T(), []string{"user003", "user001"}, s.ids(results))
+}
+
+func (s *SQLiteDatabaseTestSuite) TestTransaction() {
+	conn := s.memory()
+	defer conn.Close()
+	database := s.database(conn)
+	ctx := context.Background()
+
+	err := db.WithTx(ctx, database, func(ctx context.Context) error {
+		if err := database.Insert(ctx, s.user(`{"schemas": ["urn:ietf:params:scim:schemas:core:2.0:User"], "id": "user001", "userName": "foo"}`)); err != nil {
+			return err
+		}
+		return database.Insert(ctx, s.user(`{"schemas": ["urn:ietf:params:scim:schemas:core:2.0:User"], "id": "user002", "userName": "foo"}`))
+	})
+	assert.True(s.T(), errors.Is(err, spec.ErrUniqueness))
+	_, err = database.Get(ctx, "user001", nil)
+	assert.True(s.T(), errors.Is(err, spec.ErrNotFound), "insert was rolled back")
+
+	err = Transaction(ctx, conn, nil, func(ctx context.Context) error {
+		if err := database.Insert(ctx, s.user(`{"schemas": ["urn:ietf:params:scim:schemas:core:2.0:User"], "id": "user001", "userName": "foo"}`)); err != nil {
+			return err
+		}
+		// Nested transactions join the outer one.
+		return db.WithTx(ctx, database, func(ctx context.Context) error {
+			n, err := database.Count(ctx, "")
+			if err == nil && n != 1 {
+				err = fmt.Errorf("expected 1 resource in transaction, got %d", n)
+			}
+			return err
+		})
+	})
+	require.Nil(s.T(), err)
+	_, err = database.Get(ctx, "user001", nil)
+	assert.Nil(s.T(), err)
+}
+
+func (s *SQLiteDatabaseTestSuite) TestEnsureSchema() {
+	dir, err := ioutil.TempDir("", "sqlite")
+	require.Nil(s.T(), err)
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+	ctx := context.Background()
+
+	conn, err := Open(filepath.Join(dir, "scim.db"))
+	require.Nil(s.T(), err)
+	defer conn.Close()
+
+	// table of an earlier version of the schema, without the generated column of userName
+	_, err = conn.Exec(`CREATE TABLE "users" ("id" TEXT NOT NULL, "version" TEXT NOT NULL DEFAULT '', "last_modified" REAL, "doc" TEXT NOT NULL, CONSTRAINT "users_pkey" PRIMARY KEY ("id"))`)
+	require.Nil(s.T(), err)
+	_, err = conn.Exec(`INSERT INTO "users" ("id", "doc") VALUES ('user001', '{"schemas":["urn:ietf:params:scim:schemas:core:2.0:User"],"id":"user001","userName":"foo"}')`)
+	require.Nil(s.T(), err)
+
+	require.Nil(s.T(), EnsureSchema(ctx, conn, s.resourceType, "users"))
+	require.Nil(s.T(), EnsureSchema(ctx, conn, s.resourceType, "users"), "idempotent")
+
+	database := DB(s.resourceType, conn, "users")
+	err = database.Insert(ctx, s.user(`{"schemas": ["urn:ietf:params:scim:schemas:core:2.0:User"], "id": "user002", "userName": "Foo"}`))
+	assert.True(s.T(), errors.Is(err, spec.ErrUniqueness), "unique index covers existing rows")
+
+	results, err := database.Query(ctx, `userName eq "FOO"`, nil, nil, nil)
+	require.Nil(s.T(), err)
+	assert.Equal(s.T(), []string{"user001"}, s.ids(results))
+}
+
+// Returns an in-memory database.
+func (s *SQLiteDatabaseTestSuite) memory() *sql.DB {
+	conn, err := Open(":memory:")
+	require.Nil(s.T(), err)
+	return conn
+}
+
+func (s *SQLiteDatabaseTestSuite) database(conn *sql.DB) db.DB {
+	require.Nil(s.T(), EnsureSchema(context.Background(), conn, s.resourceType, "users"))
+	return DB(s.resourceType, conn, "users")
+}
+
+func (s *SQLiteDatabaseTestSuite) user(raw string) *prop.Resource {
+	resource := prop.NewResource(s.resourceType)
+	require.Nil(s.T(), scimjson.Deserialize([]byte(raw), resource))
+	return resource
+}
+
+func (s *SQLiteDatabaseTestSuite) ids(resources []*prop.Resource) []string {
+	ids := make([]string, 0, len(resources))
+	for _, each := range resources {
+		ids = append(ids, each.IdOrEmpty())
+	}
+	return ids
+}
+
+func (s *SQLiteDatabaseTestSuite) SetupSuite() {
+	for _, each := range []struct {
+		filepath  string
+		structure interface{}
+		post      func(parsed interface{})
+	}{
+		{
+			filepath:  "../../public/schemas/core_schema.json",
+			structure: new(spec.Schema),
+			post: func(parsed interface{}) {
+				spec.Schemas().Register(parsed.(*spec.Schema))
+			},
+		},
+		{
+			filepath:  "../../public/schemas/user_schema.json",
+			structure: new(spec.Schema),
+			post: func(parsed interface{}) {
+				spec.Schemas().Register(parsed.(*spec.Schema))
+			},
+		},
+		{
+			filepath:  "../../public/schemas/user_enterprise_extension_schema.json",
+			structure: new(spec.Schema),
+			post: func(parsed interface{}) {
+				spec.Schemas().Register(parsed.(*spec.Schema))
+			},
+		},
+		{
+			filepath:  "../../public/resource_types/user_resource_type.json",
+			structure: new(spec.ResourceType),
+			post: func(parsed interface{}) {
+				s.resourceType = parsed.(*spec.ResourceType)
+				crud.Register(s.resourceType)
+			},
+		},
+	} {
+		f, err := os.Open(each.filepath)
+		require.Nil(s.T(), err)
+
+		raw, err := ioutil.ReadAll(f)
+		require.Nil(s.T(), err)
+
+		err = json.Unmarshal(raw, each.structure)
+		require.Nil(s.T(), err)
+
+		if each.post != nil {
+			each.post(each.structure)
+		}
+	}
+}
@@ -0,0 +1,4 @@
+// This package provides SQLite implementation of db.DB interface, which stores resources as JSON documents and pushes
+// SCIM filters, sort and pagination down to the database as SQL. It is intended for development and CI, where it can
+// run in memory without a database server.
+package v2
@@ -0,0 +1,11 @@
+module github.com/imulab/go-scim/sqlite/v2
+
+go 1.13
+
+require (
+	github.com/imulab/go-scim/pkg/v2 v2.0.0
+	github.com/mattn/go-sqlite3 v1.14.16
+	github.com/stretchr/testify v1.4.0
+)
+
+replace github.com/imulab/go-scim/pkg/v2 => ../../pkg/v2
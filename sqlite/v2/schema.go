@@ -0,0 +1,325 @@
+package v2
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/imulab/go-scim/pkg/v2/crud/translate"
+	"github.com/imulab/go-scim/pkg/v2/spec"
+	"github.com/mattn/go-sqlite3"
+	"strings"
+	"time"
+)
+
+const (
+	// @SQLiteIndex annotates a singular attribute so that a generated column of its value, and an index on the column,
+	// is created in SQLite. Attributes whose uniqueness is server or global always have one, with a unique index.
+	AnnotationSQLiteIndex = "@SQLiteIndex"
+)
+
+// Columns of the table other than the generated ones.
+const (
+	idColumn           = `"id"`
+	versionColumn      = `"version"`
+	lastModifiedColumn = `"last_modified"`
+	docColumn          = `"doc"`
+)
+
+// EnsureSchema creates the table of the resource type in the database, along with its indexes, unless they already
+// exist, so that it can be called every time the application starts. SQLite 3.31 or later is required for generated
+// columns, which the bundled SQLite of github.com/mattn/go-sqlite3 satisfies.
+//
+// Resources are stored as JSON documents in the "doc" column. The id, meta.version and meta.lastModified are stored in
+// columns of their own, the latter as Julian day numbers (see translate.JulianDay). For every singular attribute outside
+// of multiValued attributes that is unique, or annotated with "@SQLiteIndex", a virtual generated column is created from
+// the document, with an index on its value, or on its lower case value for case insensitive strings. The index is unique
+// when the attribute's uniqueness is server or global. Generated columns are not created for dateTime attributes, in
+// the same way as the PostgreSQL implementation.
+//
+// Generated columns missing from an existing table are added to it, but SQLite cannot add unique indexes over existing
+// rows that violate them, in which case an error of spec.ErrUniqueness is returned. The table name is quoted, and hence
+// is case sensitive.
+func EnsureSchema(ctx context.Context, conn *sql.DB, resourceType *spec.ResourceType, table string) error {
+	t := newTable(resourceType, table)
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return errDatabase(err)
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	if _, err := tx.ExecContext(ctx, t.createTable()); err != nil {
+		return errDatabase(err)
+	}
+
+	existing, err := t.existingColumns(ctx, tx)
+	if err != nil {
+		return err
+	}
+	for _, statement := range t.statements(existing) {
+		if _, err := tx.ExecContext(ctx, statement); err != nil {
+			return t.errWrite(err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return errDatabase(err)
+	}
+	return nil
+}
+
+type table struct {
+	name    string
+	quoted  string
+	columns []*generatedColumn
+	// scim paths of the attributes of the unique indexes, by name
+	uniqueIndexes map[string]string
+}
+
+// generatedColumn holds the value of a singular attribute, extracted from the document.
+type generatedColumn struct {
+	attr   *spec.Attribute
+	path   []*spec.Attribute // from the top level attribute to attr
+	name   string
+	index  string
+	unique bool
+}
+
+func newTable(resourceType *spec.ResourceType, name string) *table {
+	t := &table{
+		name:          name,
+		quoted:        quoteIdentifier(name),
+		uniqueIndexes: map[string]string{},
+	}
+
+	var collect func(attr *spec.Attribute, path []*spec.Attribute)
+	collect = func(attr *spec.Attribute, path []*spec.Attribute) {
+		_ = attr.ForEachSubAttribute(func(sub *spec.Attribute) error {
+			if sub.MultiValued() {
+				return nil
+			}
+			subPath := append(append([]*spec.Attribute{}, path...), sub)
+			if sub.Type() == spec.TypeComplex {
+				collect(sub, subPath)
+				return nil
+			}
+			if !t.generates(sub) {
+				return nil
+			}
+
+			names := make([]string, 0, len(subPath))
+			for _, each := range subPath {
+				names = append(names, each.Name())
+			}
+			column := &generatedColumn{
+				attr:   sub,
+				path:   subPath,
+				name:   "c_" + sanitize(strings.Join(names, "_")),
+				unique: sub.Uniqueness() == spec.UniquenessServer || sub.Uniqueness() == spec.UniquenessGlobal,
+			}
+			if column.unique {
+				column.index = name + "_" + column.name + "_key"
+				t.uniqueIndexes[column.index] = sub.Path()
+			} else {
+				column.index = name + "_" + column.name + "_idx"
+			}
+			t.columns = append(t.columns, column)
+			return nil
+		})
+	}
+	collect(resourceType.SuperAttribute(true), nil)
+
+	return t
+}
+
+// Returns true if a generated column shall be created for the singular attribute.
+func (t *table) generates(attr *spec.Attribute) bool {
+	switch attr.ID() {
+	case "id", "meta.version", "meta.lastModified":
+		return false // columns of their own
+	}
+	if attr.Type() == spec.TypeDateTime {
+		return false
+	}
+	if attr.Uniqueness() != spec.UniquenessNone {
+		return true
+	}
+	_, ok := attr.Annotation(AnnotationSQLiteIndex)
+	return ok
+}
+
+// Returns the statement to create the table, with the generated columns.
+func (t *table) createTable() string {
+	columns := []string{
+		idColumn + " TEXT NOT NULL",
+		versionColumn + " TEXT NOT NULL DEFAULT ''",
+		lastModifiedColumn + " REAL",
+		docColumn + " TEXT NOT NULL",
+	}
+	for _, column := range t.columns {
+		columns = append(columns, column.definition())
+	}
+	columns = append(columns, "CONSTRAINT "+quoteIdentifier(t.name+"_pkey")+" PRIMARY KEY ("+idColumn+")")
+
+	return "CREATE TABLE IF NOT EXISTS " + t.quoted + " (" + strings.Join(columns, ", ") + ")"
+}
+
+// Returns the names of the columns of the existing table.
+func (t *table) existingColumns(ctx context.Context, tx *sql.Tx) (map[string]struct{}, error) {
+	rows, err := tx.QueryContext(ctx, "SELECT name FROM pragma_table_xinfo(?)", t.name)
+	if err != nil {
+		return nil, errDatabase(err)
+	}
+
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	existing := make(map[string]struct{})
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, errDatabase(err)
+		}
+		existing[name] = struct{}{}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errDatabase(err)
+	}
+	return existing, nil
+}
+
+// Returns the statements to add the generated columns missing from the existing columns, and to create the indexes,
+// in the order they shall be executed after the table is created.
+func (t *table) statements(existing map[string]struct{}) []string {
+	statements := []string{
+		fmt.Sprintf("CREATE INDEX IF NOT EXISTS %s ON %s (%s)",
+			quoteIdentifier(t.name+"_last_modified_idx"), t.quoted, lastModifiedColumn),
+	}
+
+	for _, column := range t.columns {
+		if _, ok := existing[column.name]; !ok {
+			statements = append(statements, "ALTER TABLE "+t.quoted+" ADD COLUMN "+column.definition())
+		}
+
+		key := quoteIdentifier(column.name)
+		if column.caseInsensitive() {
+			key = "LOWER(" + key + ")"
+		}
+		create := "CREATE INDEX"
+		if column.unique {
+			create = "CREATE UNIQUE INDEX"
+		}
+		statements = append(statements, fmt.Sprintf("%s IF NOT EXISTS %s ON %s (%s)",
+			create, quoteIdentifier(column.index), t.quoted, key))
+	}
+
+	return statements
+}
+
+// Returns the mapping of attributes to the columns of the table: id, meta.version, meta.lastModified and the attributes
+// of generated columns are mapped to their columns, and the rest to the document.
+func (t *table) mapping() translate.Mapping {
+	columns := map[string]translate.Column{
+		"id":                {Expr: idColumn},
+		"meta.version":      {Expr: versionColumn},
+		"meta.lastModified": {Expr: lastModifiedColumn, Convert: convertJulianDay},
+	}
+	for _, column := range t.columns {
+		columns[column.attr.ID()] = translate.Column{Expr: quoteIdentifier(column.name)}
+	}
+
+	return translate.Chain(
+		translate.MappingFunc(func(path []*spec.Attribute) (translate.Column, bool) {
+			for _, attr := range path {
+				if attr.MultiValued() {
+					return translate.Column{}, false
+				}
+			}
+			column, ok := columns[path[len(path)-1].ID()]
+			return column, ok
+		}),
+		translate.JSON1(docColumn),
+	)
+}
+
+// Returns an error of spec.ErrUniqueness if err reports a violation of the primary key or a unique index, naming the
+// attribute of the index if it was created by EnsureSchema; otherwise, returns the error of errDatabase.
+func (t *table) errWrite(err error) error {
+	if e, ok := err.(sqlite3.Error); ok && e.Code == sqlite3.ErrConstraint {
+		switch e.ExtendedCode {
+		case sqlite3.ErrConstraintPrimaryKey:
+			return fmt.Errorf("%w: value of 'id' is not unique", spec.ErrUniqueness)
+		case sqlite3.ErrConstraintUnique:
+			// SQLite names the index of expressions, i.e. "UNIQUE constraint failed: index 'users_c_username_key'"
+			for index, path := range t.uniqueIndexes {
+				if strings.Contains(e.Error(), "'"+index+"'") {
+					return fmt.Errorf("%w: value of '%s' is not unique", spec.ErrUniqueness, path)
+				}
+			}
+			return fmt.Errorf("%w: %s", spec.ErrUniqueness, e.Error())
+		}
+	}
+	return errDatabase(err)
+}
+
+// Returns an error of spec.ErrConflict if err reports that the database was locked by another connection, which may
+// succeed when retried; otherwise, returns an error of spec.ErrInternal.
+func errDatabase(err error) error {
+	if e, ok := err.(sqlite3.Error); ok && (e.Code == sqlite3.ErrBusy || e.Code == sqlite3.ErrLocked) {
+		return fmt.Errorf("%w: %s", spec.ErrConflict, e.Error())
+	}
+	return fmt.Errorf("%w: %v", spec.ErrInternal, err)
+}
+
+func (c *generatedColumn) caseInsensitive() bool {
+	return c.attr.Type() == spec.TypeString && !c.attr.CaseExact()
+}
+
+func (c *generatedColumn) sqlType() string {
+	switch c.attr.Type() {
+	case spec.TypeInteger, spec.TypeBoolean:
+		return "INTEGER"
+	case spec.TypeDecimal:
+		return "REAL"
+	default:
+		return "TEXT"
+	}
+}
+
+// Returns the definition of the column, which extracts the value of the attribute from the document, i.e.
+// "c_name_givenname" TEXT GENERATED ALWAYS AS (json_extract("doc", '$."name"."givenName"')) VIRTUAL
+func (c *generatedColumn) definition() string {
+	elements := make([]string, 0, len(c.path))
+	for _, attr := range c.path {
+		elements = append(elements, `"`+strings.Replace(attr.Name(), `"`, `\"`, -1)+`"`)
+	}
+	jsonPath := "'" + strings.Replace("$."+strings.Join(elements, "."), "'", "''", -1) + "'"
+	return fmt.Sprintf("%s %s GENERATED ALWAYS AS (json_extract(%s, %s)) VIRTUAL",
+		quoteIdentifier(c.name), c.sqlType(), docColumn, jsonPath)
+}
+
+// Converts the time in filters on meta.lastModified to the Julian day number it is stored as.
+func convertJulianDay(value interface{}) interface{} {
+	if t, ok := value.(time.Time); ok {
+		return translate.JulianDay(t)
+	}
+	return value
+}
+
+// Returns the identifier in double quotes, which escapes double quotes within by doubling them.
+func quoteIdentifier(name string) string {
+	return `"` + strings.Replace(name, `"`, `""`, -1) + `"`
+}
+
+// Returns the lower case name with characters other than letters, digits and underscores replaced by underscores.
+func sanitize(name string) string {
+	return strings.Map(func(r rune) rune {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') || r == '_' {
+			return r
+		}
+		return '_'
+	}, strings.ToLower(name))
+}
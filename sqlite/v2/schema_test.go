@@ -0,0 +1,147 @@
+package v2
+
+import (
+	"encoding/json"
+	"github.com/imulab/go-scim/pkg/v2/crud"
+	"github.com/imulab/go-scim/pkg/v2/crud/translate"
+	"github.com/imulab/go-scim/pkg/v2/spec"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestSchema(t *testing.T) {
+	s := new(SchemaTestSuite)
+	suite.Run(t, s)
+}
+
+type SchemaTestSuite struct {
+	suite.Suite
+	resourceType *spec.ResourceType
+}
+
+func (s *SchemaTestSuite) TestStatements() {
+	t := newTable(s.resourceType, "users")
+
+	assert.Equal(s.T(), `CREATE TABLE IF NOT EXISTS "users" ("id" TEXT NOT NULL, "version" TEXT NOT NULL DEFAULT '', "last_modified" REAL, "doc" TEXT NOT NULL, "c_username" TEXT GENERATED ALWAYS AS (json_extract("doc", '$."userName"')) VIRTUAL, CONSTRAINT "users_pkey" PRIMARY KEY ("id"))`, t.createTable())
+
+	statements := t.statements(map[string]struct{}{"c_username": {}})
+	require.Len(s.T(), statements, 2)
+	assert.Equal(s.T(), `CREATE INDEX IF NOT EXISTS "users_last_modified_idx" ON "users" ("last_modified")`, statements[0])
+	assert.Equal(s.T(), `CREATE UNIQUE INDEX IF NOT EXISTS "users_c_username_key" ON "users" (LOWER("c_username"))`, statements[1])
+
+	statements = t.statements(map[string]struct{}{})
+	require.Len(s.T(), statements, 3)
+	assert.Equal(s.T(), `ALTER TABLE "users" ADD COLUMN "c_username" TEXT GENERATED ALWAYS AS (json_extract("doc", '$."userName"')) VIRTUAL`, statements[1])
+}
+
+func (s *SchemaTestSuite) TestCompile() {
+	compiler := translate.SQLCompiler(s.resourceType, newTable(s.resourceType, "users").mapping(), translate.Question)
+
+	tests := []struct {
+		name       string
+		filter     string
+		sort       *crud.Sort
+		pagination *crud.Pagination
+		expect     func(t *testing.T, clause *translate.SQLClause, err error)
+	}{
+		{
+			name:   "generated column",
+			filter: `userName eq "foo"`,
+			expect: func(t *testing.T, clause *translate.SQLClause, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, `LOWER("c_username") = LOWER(?)`, clause.Where)
+			},
+		},
+		{
+			name:   "columns of their own",
+			filter: `id eq "foo" and meta.lastModified gt "2020-01-01T00:00:00Z"`,
+			expect: func(t *testing.T, clause *translate.SQLClause, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, `("id" = ? AND "last_modified" > ?)`, clause.Where)
+				assert.Equal(t, translate.JulianDay(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)), clause.Args[1])
+			},
+		},
+		{
+			name:   "document",
+			filter: `emails.value sw "foo" or name.familyName eq "Qiu"`,
+			expect: func(t *testing.T, clause *translate.SQLClause, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, `(EXISTS (SELECT 1 FROM json_each("doc", '$."emails"') AS elem WHERE LOWER(json_extract(elem.value, '$."value"')) LIKE LOWER(?) ESCAPE '\') OR LOWER(json_extract("doc", '$."name"."familyName"')) = LOWER(?))`, clause.Where)
+			},
+		},
+		{
+			name:       "sort and pagination",
+			sort:       &crud.Sort{By: "userName", Order: crud.SortDesc},
+			pagination: &crud.Pagination{StartIndex: 11, Count: 10},
+			expect: func(t *testing.T, clause *translate.SQLClause, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, `CASE WHEN "c_username" IS NULL THEN 1 ELSE 0 END DESC, LOWER("c_username") DESC, "id" ASC`, clause.OrderBy)
+				assert.Equal(t, "LIMIT ? OFFSET ?", clause.Limit)
+				assert.Equal(t, []interface{}{10, 10}, clause.Args)
+			},
+		},
+	}
+
+	for _, test := range tests {
+		s.T().Run(test.name, func(t *testing.T) {
+			clause, err := compiler.Compile(test.filter, test.sort, test.pagination)
+			test.expect(t, clause, err)
+		})
+	}
+}
+
+func (s *SchemaTestSuite) SetupSuite() {
+	for _, each := range []struct {
+		filepath  string
+		structure interface{}
+		post      func(parsed interface{})
+	}{
+		{
+			filepath:  "../../public/schemas/core_schema.json",
+			structure: new(spec.Schema),
+			post: func(parsed interface{}) {
+				spec.Schemas().Register(parsed.(*spec.Schema))
+			},
+		},
+		{
+			filepath:  "../../public/schemas/user_schema.json",
+			structure: new(spec.Schema),
+			post: func(parsed interface{}) {
+				spec.Schemas().Register(parsed.(*spec.Schema))
+			},
+		},
+		{
+			filepath:  "../../public/schemas/user_enterprise_extension_schema.json",
+			structure: new(spec.Schema),
+			post: func(parsed interface{}) {
+				spec.Schemas().Register(parsed.(*spec.Schema))
+			},
+		},
+		{
+			filepath:  "../../public/resource_types/user_resource_type.json",
+			structure: new(spec.ResourceType),
+			post: func(parsed interface{}) {
+				s.resourceType = parsed.(*spec.ResourceType)
+				crud.Register(s.resourceType)
+			},
+		},
+	} {
+		f, err := os.Open(each.filepath)
+		require.Nil(s.T(), err)
+
+		raw, err := ioutil.ReadAll(f)
+		require.Nil(s.T(), err)
+
+		err = json.Unmarshal(raw, each.structure)
+		require.Nil(s.T(), err)
+
+		if each.post != nil {
+			each.post(each.structure)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package v2
+
+import (
+	"context"
+	"database/sql"
+)
+
+// Transaction calls fn with a context carrying a transaction started on conn with the options, which may be nil for
+// the defaults. The calls of the databases on conn with this context (see DB) are part of the transaction, which is
+// committed when fn returns nil, and rolled back when it returns an error or panics. When the context already carries
+// a transaction on conn, fn joins it instead, and it is up to the outermost call to commit or roll back.
+//
+// SQLite allows a single writer at a time: a transaction that fails to acquire the lock of the database within the busy
+// timeout fails with an error of spec.ErrConflict, and may be retried. In-memory databases opened by Open have a single
+// connection, which the transaction holds until it ends, so that calls with other contexts wait for it.
+func Transaction(ctx context.Context, conn *sql.DB, opts *sql.TxOptions, fn func(ctx context.Context) error) error {
+	if t, ok := ctx.Value(txKey{}).(*transaction); ok && t.conn == conn {
+		return fn(ctx)
+	}
+
+	tx, err := conn.BeginTx(ctx, opts)
+	if err != nil {
+		return errDatabase(err)
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			_ = tx.Rollback()
+			panic(r)
+		}
+	}()
+
+	if err := fn(context.WithValue(ctx, txKey{}, &transaction{conn: conn, tx: tx})); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return errDatabase(err)
+	}
+	return nil
+}
+
+type txKey struct{}
+
+type transaction struct {
+	conn *sql.DB
+	tx   *sql.Tx
+}
+
+// querier is implemented by both *sql.DB and *sql.Tx.
+type querier interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// Returns the transaction on conn carried by the context, or conn itself if there is none.
+func querierFor(ctx context.Context, conn *sql.DB) querier {
+	if t, ok := ctx.Value(txKey{}).(*transaction); ok && t.conn == conn {
+		return t.tx
+	}
+	return conn
+}